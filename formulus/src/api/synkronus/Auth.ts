@@ -109,12 +109,13 @@ export const login = async (
 
 /**
  * Self-registration: calls POST /auth/register (public endpoint).
- * Creates a new user with read-write role and returns a JWT token
- * so the user is immediately logged in after registration.
+ * Redeems an admin-issued invitation, creates a user with the invitation's
+ * role and returns a JWT token so the user is immediately logged in.
  */
 export const register = async (
   username: string,
   password: string,
+  inviteToken: string,
 ): Promise<UserInfo> => {
   const { serverConfigService } = await import(
     '../../services/ServerConfigService'
@@ -132,7 +133,7 @@ export const register = async (
       'Content-Type': 'application/json',
       Accept: 'application/json',
     },
-    body: JSON.stringify({ username, password }),
+    body: JSON.stringify({ username, password, inviteToken }),
   });
 
   if (!response.ok) {
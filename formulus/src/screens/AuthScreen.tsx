@@ -25,6 +25,7 @@ const AuthScreen = () => {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
   const [confirmPassword, setConfirmPassword] = useState('');
+  const [inviteCode, setInviteCode] = useState('');
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [errorMessage, setErrorMessage] = useState('');
 
@@ -34,8 +35,14 @@ const AuthScreen = () => {
     const hasUsername = username.trim().length >= 3;
     const hasPassword = password.trim().length >= 6;
     if (isLogin) return hasUsername && hasPassword;
-    return hasUsername && hasPassword && password === confirmPassword;
-  }, [username, password, confirmPassword, isLogin]);
+    const hasInviteCode = inviteCode.trim().length > 0;
+    return (
+      hasUsername &&
+      hasPassword &&
+      hasInviteCode &&
+      password === confirmPassword
+    );
+  }, [username, password, confirmPassword, inviteCode, isLogin]);
 
   const handleSubmit = useCallback(async () => {
     if (!isFormValid || isSubmitting) return;
@@ -55,7 +62,7 @@ const AuthScreen = () => {
         await login(trimmedUsername, trimmedPassword);
         ToastService.showShort('Welcome back!');
       } else {
-        await register(trimmedUsername, trimmedPassword);
+        await register(trimmedUsername, trimmedPassword, inviteCode.trim());
         // Also store credentials in Keychain for auto-login
         await Keychain.setGenericPassword(trimmedUsername, trimmedPassword);
         ToastService.showShort('Account created! Welcome to RentFreely.');
@@ -77,6 +84,9 @@ const AuthScreen = () => {
         // Use server-provided error message if available
         if (err.message.includes('already taken')) {
           message = 'This username is already taken. Try a different one.';
+        } else if (err.message.includes('nvitation')) {
+          message =
+            'This invite code is invalid, expired or already used. Ask your administrator for a new one.';
         } else if (
           err.message.includes('Invalid credentials') ||
           err.message.includes('invalid credentials')
@@ -102,6 +112,7 @@ const AuthScreen = () => {
     isSubmitting,
     username,
     password,
+    inviteCode,
     isLogin,
   ]);
 
@@ -228,6 +239,16 @@ const AuthScreen = () => {
             </Text>
           )}
 
+          {!isLogin && (
+            <ODEInput
+              placeholder="Invite Code"
+              value={inviteCode}
+              onChangeText={setInviteCode}
+              autoCapitalize="none"
+              autoCorrect={false}
+            />
+          )}
+
           <Button
             title={
               isSubmitting
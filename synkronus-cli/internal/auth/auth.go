@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -124,8 +125,14 @@ func RefreshToken() (*TokenResponse, error) {
 	return &tokenResp, nil
 }
 
+// tokenMu serializes GetToken, so parallel requests refresh an expiring token once
+var tokenMu sync.Mutex
+
 // GetToken returns the current token, refreshing it if necessary
 func GetToken() (string, error) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+
 	token := viper.GetString("auth.token")
 	expiresAt := viper.GetInt64("auth.expires_at")
 
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/bundlecache"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/validation"
 	"github.com/fatih/color"
@@ -15,9 +21,10 @@ import (
 func init() {
 	// App Bundle command group
 	appBundleCmd := &cobra.Command{
-		Use:   "app-bundle",
-		Short: "Manage app bundles",
-		Long:  `Commands for managing app bundles in the Synkronus API.`,
+		Use:     "app-bundle",
+		Aliases: []string{"bundle"},
+		Short:   "Manage app bundles",
+		Long:    `Commands for managing app bundles in the Synkronus API.`,
 	}
 	rootCmd.AddCommand(appBundleCmd)
 
@@ -25,13 +32,32 @@ func init() {
 	manifestCmd := &cobra.Command{
 		Use:   "manifest",
 		Short: "Get app bundle manifest",
-		Long:  `Retrieve the current app bundle manifest from the Synkronus API.`,
+		Long: `Retrieve the current app bundle manifest from the Synkronus API.
+
+With --cached, the manifest saved by the last 'bundle cache refresh' is shown instead,
+without contacting the server.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.NewClient()
-			manifest, err := c.GetAppBundleManifest()
-			if err != nil {
-				cmd.SilenceUsage = true
-				return fmt.Errorf("failed to get app bundle manifest: %w", err)
+			var manifest map[string]interface{}
+			var err error
+			if cached, _ := cmd.Flags().GetBool("cached"); cached {
+				cache, err := openBundleCache()
+				if err != nil {
+					return err
+				}
+				var meta *bundlecache.Meta
+				manifest, meta, err = cache.ActiveManifest()
+				if err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to load cached app bundle manifest: %w", err)
+				}
+				printCacheNotice(meta)
+			} else {
+				manifest, err = client.NewClient().GetAppBundleManifest()
+				if err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to get app bundle manifest: %w", err)
+				}
+				cacheManifest(manifest)
 			}
 
 			// Format output as JSON
@@ -77,20 +103,20 @@ func init() {
 	}
 	manifestCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
 	manifestCmd.Flags().Bool("all", false, "Show all files in manifest")
+	manifestCmd.Flags().Bool("cached", false, "Show the manifest from the offline cache")
 	appBundleCmd.AddCommand(manifestCmd)
 
 	// Get versions command
 	versionsCmd := &cobra.Command{
 		Use:   "versions",
 		Short: "List app bundle versions",
-		Long:  `List all available app bundle versions from the Synkronus API.`,
+		Long: `List all available app bundle versions from the Synkronus API, newest first.
+
+The active version is marked with *. Author and form count are shown when the
+server records them. With --cached, the list saved by the last 'bundle cache refresh'
+is shown instead.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			c := client.NewClient()
-			response, err := c.GetAppBundleVersions()
-			if err != nil {
-				cmd.SilenceUsage = true
-				return err
-			}
 
 			// Format output as JSON
 			jsonOutput, err := cmd.Flags().GetBool("json")
@@ -98,7 +124,13 @@ func init() {
 				return err
 			}
 
-			if jsonOutput {
+			cached, _ := cmd.Flags().GetBool("cached")
+			if jsonOutput && !cached {
+				response, err := c.GetAppBundleVersions()
+				if err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
 				jsonData, err := json.MarshalIndent(response, "", "  ")
 				if err != nil {
 					return err
@@ -107,21 +139,68 @@ func init() {
 				return nil
 			}
 
-			// Display formatted output
-			fmt.Println("Available App Bundle Versions:")
-			versions, ok := response["versions"].([]interface{})
-			if ok {
-				for _, version := range versions {
-					fmt.Printf("- %s\n", version)
+			var list *client.AppBundleVersionList
+			if cached {
+				cache, err := openBundleCache()
+				if err != nil {
+					return err
 				}
+				if list, err = cache.LoadVersions(); err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to load cached versions: %w", err)
+				}
+				meta, _ := cache.Meta()
+				printCacheNotice(meta)
 			} else {
+				if list, err = c.ListAppBundleVersions(); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+			}
+
+			if jsonOutput {
+				jsonData, err := json.MarshalIndent(list, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsonData))
+				return nil
+			}
+
+			if len(list.Details) == 0 {
 				fmt.Println("No versions found")
+				return nil
+			}
+
+			// Display formatted output
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\tVERSION\tAUTHOR\tCREATED\tFORMS")
+			for _, v := range list.Details {
+				marker := ""
+				if v.Active {
+					marker = "*"
+				}
+				author := v.Author
+				if author == "" {
+					author = "-"
+				}
+				created := "-"
+				if !v.CreatedAt.IsZero() {
+					created = v.CreatedAt.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", marker, v.Version, author, created, v.FormCount)
+			}
+			w.Flush()
+
+			if list.Scheduled != nil {
+				fmt.Printf("\nScheduled: switch to %s at %s\n", list.Scheduled.Version, list.Scheduled.EffectiveAt.Format(time.RFC3339))
 			}
 
 			return nil
 		},
 	}
 	versionsCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	versionsCmd.Flags().Bool("cached", false, "List the versions from the offline cache")
 	appBundleCmd.AddCommand(versionsCmd)
 
 	// Download command
@@ -130,10 +209,30 @@ func init() {
 		Short: "Download app bundle files",
 		Long: `Download files from the app bundle to a local directory.
 
-Use the --preview flag to ensure you get the preview version of the app bundle.`,
+Use the --preview flag to ensure you get the preview version of the app bundle.
+Use --zip to download the active bundle as a single bundle.zip instead.
+
+Files are written to a .part file first. If a download is interrupted, run the same
+command again with --resume to continue where it stopped.`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			c := client.NewClient()
+			resume, _ := cmd.Flags().GetBool("resume")
+
+			if asZip, _ := cmd.Flags().GetBool("zip"); asZip {
+				if len(args) > 0 {
+					return fmt.Errorf("a path can't be combined with --zip")
+				}
+				outputDir, _ := cmd.Flags().GetString("output")
+				destPath := filepath.Join(outputDir, "bundle.zip")
+				fmt.Printf("Downloading %s...\n", destPath)
+				if err := c.DownloadAppBundleZip(destPath, resume); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+				fmt.Printf("Downloaded bundle to %s\n", destPath)
+				return nil
+			}
 
 			// Get manifest first
 			manifest, err := c.GetAppBundleManifest()
@@ -141,6 +240,7 @@ Use the --preview flag to ensure you get the preview version of the app bundle.`
 				cmd.SilenceUsage = true
 				return err
 			}
+			cacheManifest(manifest)
 
 			// Determine output directory
 			outputDir, err := cmd.Flags().GetString("output")
@@ -192,7 +292,7 @@ Use the --preview flag to ensure you get the preview version of the app bundle.`
 				fmt.Printf("Downloading %s...\n", filePath)
 
 				preview, _ := cmd.Flags().GetBool("preview")
-				err = c.DownloadAppBundleFile(filePath, destPath, preview)
+				err = c.DownloadAppBundleFile(filePath, destPath, preview, resume)
 				if err != nil {
 					cmd.SilenceUsage = true
 					return err
@@ -212,6 +312,8 @@ Use the --preview flag to ensure you get the preview version of the app bundle.`
 	}
 	downloadCmd.Flags().StringP("output", "o", "", "Output directory for downloaded files")
 	downloadCmd.Flags().Bool("preview", false, "Download the preview (or latest version if no preview exists) version of the app bundle")
+	downloadCmd.Flags().Bool("resume", false, "Continue partial downloads left by an interrupted run")
+	downloadCmd.Flags().Bool("zip", false, "Download the active bundle as a single bundle.zip")
 	appBundleCmd.AddCommand(downloadCmd)
 
 	// Upload command
@@ -223,7 +325,11 @@ Use the --preview flag to ensure you get the preview version of the app bundle.`
 The bundle will be validated before upload to ensure it has the correct structure.
 Use --skip-validation to bypass validation (not recommended).
 
-After upload, use --activate to automatically activate the new version.`,
+After upload, use --activate to automatically activate the new version.
+
+Use --draft to stage the bundle in the server's draft slot instead. A draft is
+validated but gets no version number until promoted with 'synk app-bundle promote',
+so experimental pushes do not use up the limited version slots.`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			bundlePath := args[0]
@@ -238,6 +344,11 @@ After upload, use --activate to automatically activate the new version.`,
 			skipValidation, _ := cmd.Flags().GetBool("skip-validation")
 			activate, _ := cmd.Flags().GetBool("activate")
 			verbose, _ := cmd.Flags().GetBool("verbose")
+			draft, _ := cmd.Flags().GetBool("draft")
+
+			if draft && activate {
+				return fmt.Errorf("--activate cannot be used with --draft; promote the draft first")
+			}
 
 			// Validate bundle structure (unless skipped)
 			if !skipValidation {
@@ -247,6 +358,16 @@ After upload, use --activate to automatically activate the new version.`,
 					return fmt.Errorf("bundle validation failed: %w", err)
 				}
 				color.Green("✓ Bundle structure is valid")
+				if warnings, err := validation.UnrenderedFieldWarnings(bundlePath); err == nil {
+					for _, warning := range warnings {
+						color.Yellow("⚠ %s", warning)
+					}
+				}
+				if warnings, err := validation.ExtensionWarnings(bundlePath); err == nil {
+					for _, warning := range warnings {
+						color.Yellow("⚠ %s", warning)
+					}
+				}
 			} else {
 				color.Yellow("⚠ Skipping validation (not recommended)")
 			}
@@ -266,13 +387,33 @@ After upload, use --activate to automatically activate the new version.`,
 			}
 
 			// Upload bundle
-			color.Cyan("Uploading bundle...")
 			c := client.NewClient()
+			if wait, _ := cmd.Flags().GetDuration("wait"); wait > 0 {
+				c.SetPushWait(wait)
+			}
+			if force, _ := cmd.Flags().GetBool("force"); force {
+				color.Yellow("⚠ Asking the server to accept the bundle beyond its push limits")
+				c.SetOverrideLimits(true)
+			}
+			if draft {
+				color.Cyan("Uploading bundle as draft...")
+				if _, err := c.UploadAppBundleDraft(bundlePath); err != nil {
+					cmd.SilenceUsage = true
+					return pushFailure("failed to upload app bundle draft", err)
+				}
+
+				color.Green("✓ App bundle draft staged successfully!")
+				fmt.Println()
+				color.Cyan("Tip: Turn the draft into a numbered version with:")
+				fmt.Println("  synk app-bundle promote")
+				return nil
+			}
+
+			color.Cyan("Uploading bundle...")
 			response, err := c.UploadAppBundle(bundlePath)
 			if err != nil {
 				cmd.SilenceUsage = true
-				// Try to parse error message for better output
-				return fmt.Errorf("failed to upload app bundle: %w", err)
+				return pushFailure("failed to upload app bundle", err)
 			}
 
 			color.Green("✓ App bundle uploaded successfully!")
@@ -321,7 +462,7 @@ After upload, use --activate to automatically activate the new version.`,
 			if activate && version != "" {
 				fmt.Println()
 				color.Cyan("Activating version %s...", version)
-				switchResponse, err := c.SwitchAppBundleVersion(version)
+				switchResponse, err := c.SwitchAppBundleVersion(version, false)
 				if err != nil {
 					color.Yellow("⚠ Warning: Failed to activate version automatically: %v", err)
 					color.Yellow("   You can activate it manually with: synk app-bundle switch %s", version)
@@ -345,17 +486,122 @@ After upload, use --activate to automatically activate the new version.`,
 	uploadCmd.Flags().Bool("skip-validation", false, "Skip bundle validation before upload (not recommended)")
 	uploadCmd.Flags().BoolP("activate", "a", false, "Automatically activate the uploaded version")
 	uploadCmd.Flags().BoolP("verbose", "v", false, "Show detailed information about the bundle and manifest")
+	uploadCmd.Flags().Bool("draft", false, "Stage the bundle in the draft slot without assigning a version")
+	uploadCmd.Flags().Duration("wait", 0, "Queue behind a push that is already running, for up to this long (e.g. 2m)")
+	uploadCmd.Flags().Bool("force", false, "Push the bundle even if it exceeds the server's size, form or renderer limits (admin override)")
 	appBundleCmd.AddCommand(uploadCmd)
 
+	// Promote draft command
+	promoteCmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the staged draft to a new version",
+		Long: `Turn the bundle staged with 'synk app-bundle upload --draft' into the next
+numbered version on the server (admin only).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			activate, _ := cmd.Flags().GetBool("activate")
+
+			c := client.NewClient()
+			if wait, _ := cmd.Flags().GetDuration("wait"); wait > 0 {
+				c.SetPushWait(wait)
+			}
+			response, err := c.PromoteAppBundleDraft()
+			if err != nil {
+				cmd.SilenceUsage = true
+				return pushFailure("failed to promote app bundle draft", err)
+			}
+
+			var version string
+			if manifest, ok := response["manifest"].(map[string]interface{}); ok {
+				version, _ = manifest["version"].(string)
+			}
+			color.Green("✓ Draft promoted to version %s", version)
+
+			if activate && version != "" {
+				color.Cyan("Activating version %s...", version)
+				if _, err := c.SwitchAppBundleVersion(version, false); err != nil {
+					color.Yellow("⚠ Warning: Failed to activate version automatically: %v", err)
+					color.Yellow("   You can activate it manually with: synk app-bundle switch %s", version)
+				} else {
+					color.Green("✓ Version %s activated successfully!", version)
+				}
+			} else if version != "" {
+				fmt.Println()
+				color.Cyan("Tip: Activate this version with:")
+				fmt.Printf("  synk app-bundle switch %s\n", version)
+			}
+
+			return nil
+		},
+	}
+	promoteCmd.Flags().BoolP("activate", "a", false, "Automatically activate the promoted version")
+	promoteCmd.Flags().Duration("wait", 0, "Queue behind a push that is already running, for up to this long (e.g. 2m)")
+	appBundleCmd.AddCommand(promoteCmd)
+
+	// Push status command
+	pushStatusCmd := &cobra.Command{
+		Use:   "push-status",
+		Short: "Show whether an app bundle push is running",
+		Long: `Show the upload, draft upload or promotion currently running on the server
+(admin only). The server runs them one at a time; others are rejected unless they
+pass --wait.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := client.NewClient()
+			status, err := c.GetAppBundlePushStatus()
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("failed to get app bundle push status: %w", err)
+			}
+
+			if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+				jsonData, err := json.MarshalIndent(status, "", "  ")
+				if err != nil {
+					return fmt.Errorf("error formatting JSON: %w", err)
+				}
+				fmt.Println(string(jsonData))
+				return nil
+			}
+
+			if !status.Locked {
+				color.Green("✓ No app bundle push is running")
+				return nil
+			}
+			color.Yellow("App bundle %s in progress", status.Operation)
+			if status.User != "" {
+				fmt.Printf("User: %s\n", status.User)
+			}
+			if status.StartedAt != nil {
+				fmt.Printf("Started: %s\n", status.StartedAt.Local().Format("2006-01-02 15:04:05"))
+			}
+			fmt.Printf("Waiting: %d\n", status.Waiting)
+			if status.RetryAfterSeconds > 0 {
+				fmt.Printf("Expected to finish in: %ds\n", status.RetryAfterSeconds)
+			}
+			return nil
+		},
+	}
+	pushStatusCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	appBundleCmd.AddCommand(pushStatusCmd)
+
 	// Changes command
 	changesCmd := &cobra.Command{
-		Use:   "changes",
-		Short: "Show changes between app bundle versions",
+		Use:     "changes",
+		Aliases: []string{"diff"},
+		Short:   "Show changes between app bundle versions",
 		Long: `Compare two versions of the app bundle and display the changes.
 
 If no versions are specified, shows changes between the current version and the previous one.
-If only one version is specified, compares it with the current version.`,
-		Args: cobra.MaximumNArgs(2),
+If only one version is specified, compares it with the current version.
+
+With --cached, the file changes are worked out from cached manifests without contacting
+the server. Manifests are cached by 'bundle cache refresh' and whenever a manifest
+is fetched, so both versions must have been seen while online.
+
+With --fail-on-breaking, the form changes are shown instead and the command fails if
+any is breaking, so CI can stop a release that doesn't fit collected data.`,
+		Args:              cobra.MaximumNArgs(2),
+		ValidArgsFunction: completeBundleVersions,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			c := client.NewClient()
 
@@ -373,8 +619,38 @@ If only one version is specified, compares it with the current version.`,
 				targetVersion = args[1]
 			}
 
-			// Get changes from API
-			changes, err := c.GetAppBundleChanges(currentVersion, targetVersion)
+			if failOnBreaking, _ := cmd.Flags().GetBool("fail-on-breaking"); failOnBreaking {
+				cmd.SilenceUsage = true
+				if cached, _ := cmd.Flags().GetBool("cached"); cached {
+					return fmt.Errorf("--fail-on-breaking needs the server's form change log and can't be used with --cached")
+				}
+				changeLog, err := c.GetAppBundleChangeLog(currentVersion, targetVersion)
+				if err != nil {
+					return fmt.Errorf("failed to get app bundle changes: %w", err)
+				}
+				if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+					jsonData, err := json.MarshalIndent(changeLog, "", "  ")
+					if err != nil {
+						return fmt.Errorf("error formatting JSON: %w", err)
+					}
+					fmt.Println(string(jsonData))
+				} else {
+					printChangeLog(changeLog)
+				}
+				if changeLog.Breaking {
+					return fmt.Errorf("breaking form changes from %s to %s", changeLog.CompareVersionA, changeLog.CompareVersionB)
+				}
+				return nil
+			}
+
+			// Get changes from API, or from the offline cache
+			var changes *client.AppBundleChanges
+			var err error
+			if cached, _ := cmd.Flags().GetBool("cached"); cached {
+				changes, err = cachedBundleChanges(currentVersion, targetVersion)
+			} else {
+				changes, err = c.GetAppBundleChanges(currentVersion, targetVersion)
+			}
 			if err != nil {
 				cmd.SilenceUsage = true
 				return fmt.Errorf("failed to get app bundle changes: %w", err)
@@ -430,29 +706,277 @@ If only one version is specified, compares it with the current version.`,
 		},
 	}
 	changesCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	changesCmd.Flags().Bool("cached", false, "Compare cached manifests instead of asking the server")
+	changesCmd.Flags().Bool("fail-on-breaking", false, "Show the form changes and fail if any is breaking")
 	appBundleCmd.AddCommand(changesCmd)
 
 	// Switch version command
 	switchCmd := &cobra.Command{
-		Use:   "switch [version]",
+		Use:   "switch <version>",
 		Short: "Switch to a specific app bundle version",
-		Long:  `Switch to a specific app bundle version on the server (admin only).`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Switch to a specific app bundle version on the server (admin only).
+
+Asks for confirmation unless --yes is given, then shows the form changes between
+the previously active version and the new one.
+
+Use --at to schedule the switch for a maintenance window. Until the cutover, the
+manifest advertises the version as upcoming so devices can download it in advance
+and switch atomically at that time.
+
+With --reject-breaking the server refuses the switch if data collected with the active
+version may not fit the new one (e.g. a field changed type or a required field was
+removed), and the breaking changes are shown.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeBundleVersions,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			version := args[0]
+			at, _ := cmd.Flags().GetString("at")
+			yes, _ := cmd.Flags().GetBool("yes")
+			rejectBreaking, _ := cmd.Flags().GetBool("reject-breaking")
+
+			var effectiveAt time.Time
+			if at != "" {
+				var err error
+				effectiveAt, err = time.Parse(time.RFC3339, at)
+				if err != nil {
+					return fmt.Errorf("invalid --at value %q: expected RFC 3339, e.g. 2025-06-01T18:00:00Z", at)
+				}
+			}
 
 			c := client.NewClient()
-			response, err := c.SwitchAppBundleVersion(version)
+
+			// Look up the active version for the confirmation and the change log
+			previous := ""
+			if list, err := c.ListAppBundleVersions(); err == nil {
+				for _, v := range list.Details {
+					if v.Active {
+						previous = v.Version
+					}
+				}
+			}
+			if previous == version {
+				fmt.Printf("Version %s is already active\n", version)
+				return nil
+			}
+
+			if !yes {
+				question := fmt.Sprintf("Switch the active app bundle from %s to %s", displayVersion(previous), version)
+				if at != "" {
+					question += " at " + effectiveAt.Format(time.RFC3339)
+				}
+				ok, err := confirm(question + "?")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			if at != "" {
+				response, err := c.ScheduleAppBundleSwitch(version, effectiveAt, rejectBreaking)
+				if err != nil {
+					cmd.SilenceUsage = true
+					return switchFailure("failed to schedule app bundle version switch", err)
+				}
+				fmt.Printf("Message: %s\n", response["message"])
+				return nil
+			}
+
+			response, err := c.SwitchAppBundleVersion(version, rejectBreaking)
 			if err != nil {
 				cmd.SilenceUsage = true
-				return fmt.Errorf("failed to switch app bundle version: %w", err)
+				return switchFailure("failed to switch app bundle version", err)
 			}
 
-			fmt.Println("App bundle version switched successfully!")
+			color.Green("✓ App bundle version switched successfully!")
 			fmt.Printf("Message: %s\n", response["message"])
 
+			if previous != "" {
+				changeLog, err := c.GetAppBundleChangeLog(previous, version)
+				if err != nil {
+					color.Yellow("⚠ Could not load the change log: %v", err)
+					return nil
+				}
+				fmt.Println()
+				printChangeLog(changeLog)
+			}
+
 			return nil
 		},
 	}
+	switchCmd.Flags().String("at", "", "Schedule the switch for this RFC 3339 time instead of switching now")
+	switchCmd.Flags().BoolP("yes", "y", false, "Switch without asking for confirmation")
+	switchCmd.Flags().Bool("reject-breaking", false, "Refuse the switch if its form changes from the active version are breaking")
 	appBundleCmd.AddCommand(switchCmd)
+
+	// Rollback command
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back to the previous app bundle version",
+		Long: `Switch the server back to the newest released version older than the active one
+(admin only), without looking up its number. A pending scheduled switch is dropped.
+
+The server regenerates the manifest of that version as a health check and keeps the
+active version if it fails. Asks for confirmation unless --yes is given, then shows the
+form changes of the rollback.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			yes, _ := cmd.Flags().GetBool("yes")
+			c := client.NewClient()
+
+			if !yes {
+				active := ""
+				if list, err := c.ListAppBundleVersions(); err == nil {
+					for _, v := range list.Details {
+						if v.Active {
+							active = v.Version
+						}
+					}
+				}
+				ok, err := confirm(fmt.Sprintf("Roll back the active app bundle %s to the previous version?", displayVersion(active)))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			rollback, err := c.RollbackAppBundle()
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("failed to roll back app bundle version: %w", err)
+			}
+
+			color.Green("✓ Rolled back from app bundle version %s to %s", rollback.FromVersion, rollback.ToVersion)
+			fmt.Printf("Manifest: %d files, hash %s\n", rollback.FileCount, rollback.ManifestHash)
+
+			changeLog, err := c.GetAppBundleChangeLog(rollback.FromVersion, rollback.ToVersion)
+			if err != nil {
+				color.Yellow("⚠ Could not load the change log: %v", err)
+				return nil
+			}
+			fmt.Println()
+			printChangeLog(changeLog)
+			return nil
+		},
+	}
+	rollbackCmd.Flags().BoolP("yes", "y", false, "Roll back without asking for confirmation")
+	appBundleCmd.AddCommand(rollbackCmd)
+
+	addBundleCacheCommands(appBundleCmd)
+	addBundleFormCommands(appBundleCmd)
+}
+
+// pushFailure wraps a failed push, with a hint when another push holds the server's
+// push lock or the bundle exceeds the server's push limits
+func pushFailure(message string, err error) error {
+	var inProgress *client.PushInProgressError
+	if errors.As(err, &inProgress) {
+		color.Yellow("Another push is running on the server. Check it with 'synk app-bundle push-status',")
+		color.Yellow("or retry with --wait to queue behind it.")
+	}
+	var limitErr *client.BundleLimitError
+	if errors.As(err, &limitErr) {
+		for _, v := range limitErr.Violations {
+			for _, file := range v.Largest {
+				color.Yellow("  %s: %.1f MB", file.Path, float64(file.Size)/(1<<20))
+			}
+		}
+		color.Yellow("Remove the large files, or retry with --force if the bundle really needs to be this big.")
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// confirm asks a yes/no question on stdin; anything but y/yes declines
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N]: ", question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return false, fmt.Errorf("failed to read confirmation (use --yes to skip): %w", err)
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+// displayVersion shows a version name, or a placeholder when none is active
+func displayVersion(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
+
+// printChangeLog prints the form changes between two app bundle versions
+func printChangeLog(changeLog *client.AppBundleChangeLog) {
+	color.Cyan("Changes from %s to %s:", changeLog.CompareVersionA, changeLog.CompareVersionB)
+
+	if len(changeLog.NewForms) == 0 && len(changeLog.RemovedForms) == 0 && len(changeLog.ModifiedForms) == 0 {
+		fmt.Println("  No form changes")
+		return
+	}
+	for _, form := range changeLog.NewForms {
+		fmt.Printf("  + %s (new form)\n", form.Form)
+	}
+	for _, form := range changeLog.RemovedForms {
+		color.Red("  - %s (removed form, breaking)", form.Form)
+	}
+	for _, form := range changeLog.ModifiedForms {
+		var parts []string
+		if form.SchemaChanged {
+			parts = append(parts, "schema")
+		}
+		if form.UIChanged {
+			parts = append(parts, "ui")
+		}
+		if form.CoreChanged {
+			parts = append(parts, "core fields")
+		}
+		fmt.Printf("  ~ %s (%s changed)\n", form.Form, strings.Join(parts, ", "))
+		for _, field := range form.AddedFields {
+			fmt.Printf("      + %s (%s)\n", field.Field, field.Type)
+		}
+		for _, field := range form.RemovedFields {
+			fmt.Printf("      - %s (%s)\n", field.Field, field.Type)
+		}
+		for _, change := range form.Changes {
+			if change.Breaking {
+				color.Red("      ! %s", describeFormChange(change))
+			}
+		}
+	}
+	if changeLog.Breaking {
+		color.Red("  Breaking: data collected with %s may not fit %s", changeLog.CompareVersionA, changeLog.CompareVersionB)
+	}
+}
+
+// describeFormChange describes a breaking form change for printChangeLog
+func describeFormChange(change client.AppBundleFormChange) string {
+	switch change.Kind {
+	case "type_changed":
+		return fmt.Sprintf("%s changed type from %s to %s", change.Field, change.OldType, change.NewType)
+	case "field_removed":
+		return fmt.Sprintf("%s was removed", change.Field)
+	case "field_added":
+		return fmt.Sprintf("%s was added as a required field", change.Field)
+	case "made_required":
+		return fmt.Sprintf("%s was made required", change.Field)
+	case "core_changed":
+		return "core fields changed"
+	}
+	return strings.TrimSpace(change.Kind + " " + change.Field)
+}
+
+// switchFailure wraps a failed version switch, showing the breaking changes when the
+// server refused the switch for them
+func switchFailure(message string, err error) error {
+	var breaking *client.BreakingSwitchError
+	if errors.As(err, &breaking) {
+		printChangeLog(breaking.ChangeLog)
+		color.Yellow("Switch without --reject-breaking to switch anyway.")
+	}
+	return fmt.Errorf("%s: %w", message, err)
 }
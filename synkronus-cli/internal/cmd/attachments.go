@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/attachsync"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
 	"github.com/spf13/cobra"
 )
@@ -95,14 +98,233 @@ var existsCmd = &cobra.Command{
 	},
 }
 
+// syncAttachmentsCmd represents the sync command
+var syncAttachmentsCmd = &cobra.Command{
+	Use:   "sync <dir>",
+	Short: "Sync a local folder with the server's attachments",
+	Long: `Compare a local folder with the server using the attachment manifest and bring both in sync:
+files missing on the server are uploaded, attachments missing locally are downloaded,
+and local files deleted on the server are removed.
+
+Progress is recorded in ` + attachsync.StateFileName + ` inside the folder, so later runs only
+process manifest changes since the previous sync. File names are used as attachment IDs.
+Attachments are immutable on the server, so local files whose content differs from the
+server's copy are reported as conflicts and left untouched.
+
+The hashes of the local files are sent with the manifest request, so attachments whose
+content is already in the folder under another name are copied instead of downloaded.
+
+Downloads run on --workers parallel connections. Each file is checked against the size
+and hash in the manifest before it is moved into place, and downloads interrupted by a
+failed run are continued on the next one. Failed downloads are listed in
+` + attachsync.ReportFileName + ` inside the folder, or in the --report file.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		dir := args[0]
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		noDelete, _ := cmd.Flags().GetBool("no-delete")
+		clientID, _ := cmd.Flags().GetString("client-id")
+		workers, _ := cmd.Flags().GetInt("workers")
+		reportPath, _ := cmd.Flags().GetString("report")
+		if workers < 1 {
+			return fmt.Errorf("--workers must be at least 1")
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		state, err := attachsync.LoadState(dir)
+		if err != nil {
+			return err
+		}
+		if clientID == "" {
+			clientID = state.ClientID
+		}
+		if clientID == "" {
+			hostname, _ := os.Hostname()
+			clientID = "synk-cli-" + hostname
+		}
+		if state.ClientID != clientID {
+			// A different client sees a different manifest, so start over
+			state.ClientID = clientID
+			state.SinceVersion = 0
+		}
+
+		local, err := attachsync.ScanDir(dir)
+		if err != nil {
+			return err
+		}
+
+		c := client.NewClient()
+		manifest, err := c.GetAttachmentManifest(clientID, state.SinceVersion, attachsync.KnownHashes(local))
+		if err != nil {
+			return fmt.Errorf("failed to get attachment manifest: %w", err)
+		}
+
+		operations := make([]attachsync.Operation, 0, len(manifest.Operations))
+		downloads := make(map[string]attachsync.DownloadJob)
+		for _, op := range manifest.Operations {
+			operations = append(operations, attachsync.Operation{
+				Operation:    op.Operation,
+				AttachmentID: op.AttachmentID,
+				Hash:         op.Hash,
+			})
+			job := attachsync.DownloadJob{AttachmentID: op.AttachmentID, SHA256: op.Hash, Size: -1}
+			if op.Size != nil {
+				job.Size = *op.Size
+			}
+			downloads[op.AttachmentID] = job
+		}
+		plan := attachsync.BuildPlan(local, operations, state)
+
+		fmt.Printf("Server version %d (last synced %d): %d to download, %d to copy, %d to delete, %d new local file(s)\n",
+			manifest.CurrentVersion, state.SinceVersion, len(plan.Downloads), len(plan.Copies), len(plan.Deletes), len(plan.UploadCandidates))
+		if manifest.SkippableDownloadSize > 0 {
+			fmt.Printf("Skipping %d bytes of downloads already held locally\n", manifest.SkippableDownloadSize)
+		}
+		copies := make([]string, 0, len(plan.Copies))
+		for id := range plan.Copies {
+			copies = append(copies, id)
+		}
+		sort.Strings(copies)
+		if dryRun {
+			for _, id := range plan.Downloads {
+				fmt.Printf("  download %s\n", id)
+			}
+			for _, id := range copies {
+				fmt.Printf("  copy     %s (same content as %s)\n", id, plan.Copies[id])
+			}
+			for _, id := range plan.Deletes {
+				if noDelete {
+					fmt.Printf("  keep     %s (deleted on server)\n", id)
+				} else {
+					fmt.Printf("  delete   %s\n", id)
+				}
+			}
+			for _, id := range plan.UploadCandidates {
+				fmt.Printf("  upload   %s (unless already on server)\n", id)
+			}
+			for _, id := range plan.Conflicts {
+				fmt.Printf("  conflict %s (local content differs from server)\n", id)
+			}
+			return nil
+		}
+
+		jobs := make([]attachsync.DownloadJob, 0, len(plan.Downloads))
+		for _, id := range plan.Downloads {
+			jobs = append(jobs, downloads[id])
+		}
+		var finished int
+		report := attachsync.DownloadAll(jobs, workers, func(job attachsync.DownloadJob) (attachsync.LocalFile, error) {
+			path := filepath.Join(dir, job.AttachmentID)
+			if err := c.DownloadAttachmentVerified(job.AttachmentID, path, job.SHA256, job.Size); err != nil {
+				return attachsync.LocalFile{}, err
+			}
+			return attachsync.HashFile(path)
+		}, func(job attachsync.DownloadJob, file attachsync.LocalFile, err error) {
+			finished++
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to download %s (%d/%d): %v\n", job.AttachmentID, finished, len(jobs), err)
+				return
+			}
+			plan.Synced[job.AttachmentID] = attachsync.FileState{Size: file.Size, SHA256: file.SHA256}
+			fmt.Printf("Downloaded %s (%d/%d)\n", job.AttachmentID, finished, len(jobs))
+		})
+		failed := len(report.Failures)
+		if reportPath == "" {
+			reportPath = filepath.Join(dir, attachsync.ReportFileName)
+		}
+		if failed > 0 {
+			if err := report.Save(reportPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d of %d download(s) failed, see %s\n", failed, len(jobs), reportPath)
+		} else {
+			os.Remove(reportPath)
+		}
+
+		// Copies run before deletes, which may remove their source
+		for _, id := range copies {
+			source := plan.Copies[id]
+			if err := attachsync.CopyFile(filepath.Join(dir, source), dir, id); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to copy %s to %s: %v\n", source, id, err)
+				failed++
+				continue
+			}
+			plan.Synced[id] = attachsync.FileState{Size: local[source].Size, SHA256: local[source].SHA256}
+			fmt.Printf("Copied %s from %s\n", id, source)
+		}
+
+		for _, id := range plan.Deletes {
+			if noDelete {
+				fmt.Printf("Kept %s (deleted on server)\n", id)
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, id)); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", id, err)
+				failed++
+				continue
+			}
+			fmt.Printf("Deleted %s\n", id)
+		}
+
+		for _, id := range plan.UploadCandidates {
+			exists, err := c.AttachmentExists(id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to check %s: %v\n", id, err)
+				failed++
+				continue
+			}
+			if !exists {
+				if _, err := c.UploadAttachment(id, filepath.Join(dir, id)); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to upload %s: %v\n", id, err)
+					failed++
+					continue
+				}
+				fmt.Printf("Uploaded %s\n", id)
+			}
+			file := local[id]
+			plan.Synced[id] = attachsync.FileState{Size: file.Size, SHA256: file.SHA256}
+		}
+
+		for _, id := range plan.Conflicts {
+			fmt.Fprintf(os.Stderr, "Conflict: %s differs from the server's copy; rename it to upload it as a new attachment\n", id)
+		}
+
+		// Only advance the watermark when every manifest operation was applied,
+		// so failed downloads and deletes are retried on the next run
+		state.Files = plan.Synced
+		if failed == 0 {
+			state.SinceVersion = manifest.CurrentVersion
+		}
+		if err := state.Save(dir); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d attachment(s) failed to sync", failed)
+		}
+		fmt.Println("Attachments are in sync.")
+		return nil
+	},
+}
+
 func init() {
 	// Add commands to the attachments command group
 	attachmentsCmd.AddCommand(uploadCmd)
 	attachmentsCmd.AddCommand(downloadCmd)
 	attachmentsCmd.AddCommand(existsCmd)
+	attachmentsCmd.AddCommand(syncAttachmentsCmd)
 
 	// Add flags
 	uploadCmd.Flags().String("id", "", "Attachment ID (defaults to filename if not provided)")
+	syncAttachmentsCmd.Flags().Bool("dry-run", false, "Show what would be synced without changing anything")
+	syncAttachmentsCmd.Flags().Bool("no-delete", false, "Keep local files that were deleted on the server")
+	syncAttachmentsCmd.Flags().Int("workers", 4, "Number of attachments to download in parallel")
+	syncAttachmentsCmd.Flags().String("report", "", "Write the failed downloads to this JSON file (defaults to "+attachsync.ReportFileName+" in the folder)")
+	syncAttachmentsCmd.Flags().String("client-id", "", "Client ID for the attachment manifest (defaults to the last used ID or synk-cli-<hostname>)")
 
 	// Add attachments command to root
 	rootCmd.AddCommand(attachmentsCmd)
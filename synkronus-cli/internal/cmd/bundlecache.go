@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/bundlecache"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// addBundleCacheCommands adds the info command and the cache command group to the
+// app bundle commands
+func addBundleCacheCommands(appBundleCmd *cobra.Command) {
+	// Info command
+	infoCmd := &cobra.Command{
+		Use:   "info",
+		Short: "Show the active app bundle and its forms",
+		Long: `Show the active app bundle version, its files and the forms described by its
+APP_INFO.json.
+
+With --cached, the state saved by the last 'bundle cache refresh' is shown instead,
+without contacting the server.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var manifest map[string]interface{}
+			var appInfo *client.AppInfo
+			var err error
+
+			if cached, _ := cmd.Flags().GetBool("cached"); cached {
+				cache, err := openBundleCache()
+				if err != nil {
+					return err
+				}
+				var meta *bundlecache.Meta
+				if manifest, meta, err = cache.ActiveManifest(); err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to load cached app bundle: %w", err)
+				}
+				if appInfo, err = cache.LoadAppInfo(meta.ActiveVersion); err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to load cached app bundle: %w", err)
+				}
+				printCacheNotice(meta)
+			} else {
+				c := client.NewClient()
+				if manifest, err = c.GetAppBundleManifest(); err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to get app bundle manifest: %w", err)
+				}
+				if appInfo, err = c.GetAppBundleAppInfo(); err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("failed to get APP_INFO.json: %w", err)
+				}
+				cacheManifest(manifest)
+				cacheAppInfo(appInfo)
+			}
+
+			if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+				jsonData, err := json.MarshalIndent(map[string]interface{}{
+					"manifest": manifest,
+					"app_info": appInfo,
+				}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("error formatting JSON: %w", err)
+				}
+				fmt.Println(string(jsonData))
+				return nil
+			}
+
+			printBundleInfo(manifest, appInfo)
+			return nil
+		},
+	}
+	infoCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	infoCmd.Flags().Bool("cached", false, "Show the app bundle from the offline cache")
+	appBundleCmd.AddCommand(infoCmd)
+
+	// Cache command group
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the offline app bundle cache",
+		Long: `Manage the local copy of app bundle manifests, the version list and APP_INFO.json
+that commands read when given --cached.
+
+The cache lives in the user cache directory (override with cache.dir in the config
+file), with one directory per server URL.`,
+	}
+	appBundleCmd.AddCommand(cacheCmd)
+
+	refreshCmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Refresh the offline cache from the server",
+		Long: `Download the active manifest, the version list and the active APP_INFO.json into
+the offline cache. Manifests and APP_INFO.json of earlier versions stay cached, so
+'bundle changes --cached' can compare versions seen in earlier refreshes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := openBundleCache()
+			if err != nil {
+				return err
+			}
+			c := client.NewClient()
+			cmd.SilenceUsage = true
+
+			manifest, err := c.GetAppBundleManifest()
+			if err != nil {
+				return fmt.Errorf("failed to get app bundle manifest: %w", err)
+			}
+			list, err := c.ListAppBundleVersions()
+			if err != nil {
+				return fmt.Errorf("failed to list app bundle versions: %w", err)
+			}
+			appInfo, err := c.GetAppBundleAppInfo()
+			if err != nil {
+				return fmt.Errorf("failed to get APP_INFO.json: %w", err)
+			}
+
+			if err := cache.SaveManifest(manifest); err != nil {
+				return err
+			}
+			if err := cache.SaveVersions(list); err != nil {
+				return err
+			}
+			if err := cache.SaveAppInfo(appInfo); err != nil {
+				return err
+			}
+			version, _ := manifest["version"].(string)
+			if err := cache.MarkRefreshed(version, time.Now()); err != nil {
+				return err
+			}
+
+			color.Green("✓ Offline cache refreshed")
+			fmt.Printf("Active version: %s\n", displayVersion(version))
+			fmt.Printf("Versions: %d\n", len(list.Details))
+			fmt.Printf("Forms: %d\n", len(appInfo.Forms))
+			fmt.Printf("Location: %s\n", cache.Dir())
+			return nil
+		},
+	}
+	cacheCmd.AddCommand(refreshCmd)
+
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove the offline cache for the configured server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := openBundleCache()
+			if err != nil {
+				return err
+			}
+			if err := cache.Clear(); err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("failed to clear the offline cache: %w", err)
+			}
+			color.Green("✓ Offline cache cleared")
+			return nil
+		},
+	}
+	cacheCmd.AddCommand(clearCmd)
+}
+
+// openBundleCache opens the offline cache of the configured server
+func openBundleCache() (*bundlecache.Cache, error) {
+	root := viper.GetString("cache.dir")
+	if root == "" {
+		var err error
+		if root, err = bundlecache.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return bundlecache.Open(root, viper.GetString("api.url")), nil
+}
+
+// cacheManifest keeps a fetched manifest for offline use. Caching is best effort and
+// never fails the command.
+func cacheManifest(manifest map[string]interface{}) {
+	if cache, err := openBundleCache(); err == nil {
+		_ = cache.SaveManifest(manifest)
+	}
+}
+
+// cacheAppInfo keeps a fetched APP_INFO.json for offline use, on a best effort basis
+func cacheAppInfo(appInfo *client.AppInfo) {
+	if cache, err := openBundleCache(); err == nil {
+		_ = cache.SaveAppInfo(appInfo)
+	}
+}
+
+// printCacheNotice tells the user the output comes from the cache. It goes to stderr
+// so JSON output stays parseable.
+func printCacheNotice(meta *bundlecache.Meta) {
+	if meta == nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, color.YellowString("Using cached data from %s (refreshed %s)",
+		meta.Server, meta.RefreshedAt.Local().Format("2006-01-02 15:04")))
+}
+
+// cachedBundleChanges compares two cached manifests using the same defaults as the
+// server: no versions compares the active one with the one before it, and a single
+// version is compared with the active one
+func cachedBundleChanges(currentVersion, targetVersion string) (*client.AppBundleChanges, error) {
+	cache, err := openBundleCache()
+	if err != nil {
+		return nil, err
+	}
+
+	if currentVersion == "" {
+		meta, err := cache.Meta()
+		if err != nil {
+			return nil, err
+		}
+		currentVersion = meta.ActiveVersion
+		printCacheNotice(meta)
+	}
+	if targetVersion == "" {
+		list, err := cache.LoadVersions()
+		if err != nil {
+			return nil, err
+		}
+		// Versions are listed newest first, so the previous one follows the current one
+		for i, v := range list.Details {
+			if v.Version == currentVersion && i+1 < len(list.Details) {
+				targetVersion = list.Details[i+1].Version
+			}
+		}
+		if targetVersion == "" {
+			targetVersion = currentVersion
+		}
+	}
+
+	current, err := cache.LoadManifest(currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := cache.LoadManifest(targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	return bundlecache.DiffManifests(current, target), nil
+}
+
+// printBundleInfo prints a summary of an app bundle version and its forms
+func printBundleInfo(manifest map[string]interface{}, appInfo *client.AppInfo) {
+	fmt.Printf("Version: %s\n", manifest["version"])
+	fmt.Printf("Hash: %s\n", manifest["hash"])
+
+	var size int64
+	files, _ := manifest["files"].([]interface{})
+	for _, file := range files {
+		if fileMap, ok := file.(map[string]interface{}); ok {
+			if n, ok := fileMap["size"].(float64); ok {
+				size += int64(n)
+			}
+		}
+	}
+	fmt.Printf("Files: %d (%d bytes)\n", len(files), size)
+
+	if appInfo.Timestamp != "" {
+		fmt.Printf("Built At: %s\n", appInfo.Timestamp)
+	}
+
+	names := make([]string, 0, len(appInfo.Forms))
+	for name := range appInfo.Forms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Forms: %d\n", len(names))
+	for _, name := range names {
+		form := appInfo.Forms[name]
+		required := 0
+		for _, field := range form.Fields {
+			if field.Required {
+				required++
+			}
+		}
+		fmt.Printf("  - %s (%d fields, %d required)\n", name, len(form.Fields), required)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/bundleforms"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/validation"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// addBundleFormCommands adds the commands that split bundles into per-form
+// repositories and merge forms back into a bundle
+func addBundleFormCommands(appBundleCmd *cobra.Command) {
+	extractCmd := &cobra.Command{
+		Use:   "extract-forms <bundle.zip|directory>",
+		Short: "Split an app bundle into one repository per form",
+		Long: `Write each form of an app bundle to its own directory below --output, so teams can
+own and version forms independently.
+
+Each directory holds forms/<form>/, the renderers/ the form references, the extension
+modules it loads and a forms/ext.json reduced to the extension renderers it uses.
+Functions in forms/ext.json can't be traced to the forms that call them and are kept
+in every repository. Combine repositories again with 'synk bundle merge-forms'.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			forms, _ := cmd.Flags().GetStringSlice("forms")
+
+			src, err := bundleforms.Load(args[0])
+			if err != nil {
+				return err
+			}
+			if len(forms) == 0 {
+				forms = src.Forms()
+			}
+			if len(forms) == 0 {
+				return fmt.Errorf("%s contains no forms", args[0])
+			}
+
+			cmd.SilenceUsage = true
+			for _, form := range forms {
+				files, deps, err := src.Extract(form)
+				if err != nil {
+					return err
+				}
+				dir := filepath.Join(output, form)
+				if err := bundleforms.WriteDir(dir, files); err != nil {
+					return fmt.Errorf("failed to write %s: %w", dir, err)
+				}
+				color.Green("✓ %s → %s", form, dir)
+				printFormDependencies(deps)
+			}
+			return nil
+		},
+	}
+	extractCmd.Flags().StringP("output", "o", ".", "Directory to write the form repositories to")
+	extractCmd.Flags().StringSlice("forms", nil, "Forms to extract (default: all)")
+	appBundleCmd.AddCommand(extractCmd)
+
+	mergeCmd := &cobra.Command{
+		Use:   "merge-forms <source>...",
+		Short: "Merge forms from several sources into one app bundle",
+		Long: `Build a deployable app bundle ZIP from forms kept in separate sources. A source is
+a bundle ZIP or a directory laid out like a bundle, such as a repository written by
+'synk bundle extract-forms'.
+
+The renderers, extension renderers and modules each selected form depends on are
+copied along with it, and the forms/ext.json entries of all sources are combined.
+A form, renderer or extension found in more than one source must be identical in
+each of them. The app/ directory comes from --app, or from the first source that has
+app/index.html. The result is validated like 'synk bundle upload' does.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			forms, _ := cmd.Flags().GetStringSlice("forms")
+			appPath, _ := cmd.Flags().GetString("app")
+			skipValidation, _ := cmd.Flags().GetBool("skip-validation")
+
+			var sources []*bundleforms.Source
+			for _, arg := range args {
+				src, err := bundleforms.Load(arg)
+				if err != nil {
+					return err
+				}
+				sources = append(sources, src)
+			}
+			opts := bundleforms.MergeOptions{Forms: forms}
+			if appPath != "" {
+				app, err := bundleforms.Load(appPath)
+				if err != nil {
+					return err
+				}
+				opts.App = app
+			}
+
+			cmd.SilenceUsage = true
+			result, err := bundleforms.Merge(sources, opts)
+			if err != nil {
+				return fmt.Errorf("failed to merge forms: %w", err)
+			}
+
+			// Write next to the output and move into place once valid, so a failed merge
+			// never replaces a good bundle
+			tmp, err := os.CreateTemp(filepath.Dir(output), ".merge-*.zip")
+			if err != nil {
+				return err
+			}
+			tmp.Close()
+			defer os.Remove(tmp.Name())
+			if err := bundleforms.WriteZip(tmp.Name(), result.Files); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+			if !skipValidation {
+				if err := validation.ValidateBundle(tmp.Name()); err != nil {
+					return fmt.Errorf("merged bundle is not valid: %w", err)
+				}
+			}
+			if err := os.Rename(tmp.Name(), output); err != nil {
+				return err
+			}
+
+			for _, form := range result.Forms {
+				color.Green("✓ %s (from %s)", form.Name, form.Source)
+				printFormDependencies(form.Dependencies)
+			}
+			fmt.Printf("App: %s\n", result.App)
+			color.Green("✓ Wrote %s with %d forms", output, len(result.Forms))
+			return nil
+		},
+	}
+	mergeCmd.Flags().StringP("output", "o", "bundle.zip", "Bundle ZIP to write")
+	mergeCmd.Flags().StringSlice("forms", nil, "Forms to include (default: all forms of all sources)")
+	mergeCmd.Flags().String("app", "", "Bundle ZIP or directory to take app/ from")
+	mergeCmd.Flags().Bool("skip-validation", false, "Skip validating the merged bundle (not recommended)")
+	appBundleCmd.AddCommand(mergeCmd)
+}
+
+// printFormDependencies lists what a form pulled in besides its own directory
+func printFormDependencies(deps *bundleforms.Dependencies) {
+	if len(deps.Renderers) > 0 {
+		fmt.Printf("  Renderers: %s\n", strings.Join(deps.Renderers, ", "))
+	}
+	if len(deps.Extensions) > 0 {
+		fmt.Printf("  Extension renderers: %s\n", strings.Join(deps.Extensions, ", "))
+	}
+	if len(deps.Modules) > 0 {
+		fmt.Printf("  Modules: %s\n", strings.Join(deps.Modules, ", "))
+	}
+}
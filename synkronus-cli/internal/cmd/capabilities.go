@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/utils"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	capabilitiesCmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "Show what the server supports",
+		Long: `Show who you are on the server and what the deployment supports: enabled feature
+flags, async pushes, app bundle channels, export formats, attachment storage and sync
+behavior. Scripts can use --json to adapt instead of failing on unsupported endpoints.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := client.NewClient()
+			capabilities, err := c.GetCapabilities()
+			if err != nil {
+				cmd.SilenceUsage = true
+				if errors.Is(err, client.ErrCapabilitiesUnsupported) {
+					return fmt.Errorf("%w; upgrade the server or check `synk version`", err)
+				}
+				return fmt.Errorf("failed to get server capabilities: %w", err)
+			}
+
+			if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+				jsonData, err := json.MarshalIndent(capabilities, "", "  ")
+				if err != nil {
+					return fmt.Errorf("error formatting JSON: %w", err)
+				}
+				fmt.Println(string(jsonData))
+				return nil
+			}
+
+			printCapabilities(capabilities)
+			return nil
+		},
+	}
+	capabilitiesCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	rootCmd.AddCommand(capabilitiesCmd)
+}
+
+// printCapabilities prints the server's capabilities as key-value lines
+func printCapabilities(capabilities *client.Capabilities) {
+	if capabilities.User != nil {
+		fmt.Printf("%s\n", utils.FormatKeyValue("User", fmt.Sprintf("%s (%s)", capabilities.User.Username, capabilities.User.Role)))
+	}
+	fmt.Printf("%s\n", utils.FormatKeyValue("Feature flags", listOrNone(capabilities.Features)))
+	fmt.Printf("%s\n", utils.FormatKeyValue("Async push", yesNo(capabilities.AsyncPush)))
+	fmt.Printf("%s\n", utils.FormatKeyValue("Channels", yesNo(capabilities.Channels)))
+	fmt.Printf("%s\n", utils.FormatKeyValue("Export formats", listOrNone(capabilities.ExportFormats)))
+
+	storage := capabilities.Storage.Backend
+	var extras []string
+	if capabilities.Storage.Replication {
+		extras = append(extras, "replicated")
+	}
+	if capabilities.Storage.SignedURLs {
+		extras = append(extras, "signed URLs")
+	}
+	if capabilities.Storage.AppBundleCDN {
+		extras = append(extras, "app bundle CDN")
+	}
+	if len(extras) > 0 {
+		storage += " (" + strings.Join(extras, ", ") + ")"
+	}
+	fmt.Printf("%s\n", utils.FormatKeyValue("Storage", storage))
+
+	fmt.Printf("%s\n", utils.FormatKeyValue("Conflict policy", capabilities.Sync.ConflictPolicy))
+	fmt.Printf("%s\n", utils.FormatKeyValue("Data validation", yesNo(capabilities.Sync.DataValidation)))
+	retention := "forever"
+	if capabilities.Sync.TombstoneRetentionDays > 0 {
+		retention = fmt.Sprintf("%d days", capabilities.Sync.TombstoneRetentionDays)
+	}
+	fmt.Printf("%s\n", utils.FormatKeyValue("Deletes kept", retention))
+	changeFeed := capabilities.ChangeFeed
+	if changeFeed == "" {
+		changeFeed = "disabled"
+	}
+	fmt.Printf("%s\n", utils.FormatKeyValue("Change feed", changeFeed))
+}
+
+// listOrNone joins values with commas, or returns "none"
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+// yesNo formats a capability flag
+func yesNo(enabled bool) string {
+	if enabled {
+		return utils.Success("yes")
+	}
+	return "no"
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the server requests of shell completion, so an unreachable
+// server doesn't hang the shell
+const completionTimeout = 3 * time.Second
+
+// completionClient returns a client for shell completion
+func completionClient() *client.Client {
+	c := client.NewClient()
+	c.HTTPClient.Timeout = completionTimeout
+	return c
+}
+
+// argsComplete reports whether the command would not accept another argument
+func argsComplete(cmd *cobra.Command, args []string) bool {
+	return cmd.Args != nil && cmd.Args(cmd, append(args, "")) != nil
+}
+
+// completeBundleVersions offers the server's app bundle versions for shell completion
+func completeBundleVersions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if argsComplete(cmd, args) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	list, err := completionClient().ListAppBundleVersions()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := make([]string, 0, len(list.Details))
+	for _, v := range list.Details {
+		description := fmt.Sprintf("%d forms", v.FormCount)
+		if v.Author != "" {
+			description += ", by " + v.Author
+		}
+		if v.Active {
+			description = "active, " + description
+		}
+		completions = append(completions, v.Version+"\t"+description)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeUsernames offers the server's usernames for shell completion. Listing users
+// takes an admin token; without one nothing is offered.
+func completeUsernames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if argsComplete(cmd, args) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	users, err := completionClient().ListUsers()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := make([]string, 0, len(users))
+	for _, user := range users {
+		username, _ := user["username"].(string)
+		if username == "" {
+			continue
+		}
+		if role, _ := user["role"].(string); role != "" {
+			username += "\t" + role
+		}
+		completions = append(completions, username)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeUsernameFlag offers usernames for a --username flag
+func completeUsernameFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeUsernames(cmd, nil, toComplete)
+}
+
+// completeFormTypes offers the form types of the active app bundle for a flag that takes
+// a comma-separated list of them. They come from the server's APP_INFO.json, or from the
+// offline cache when the server can't be reached.
+func completeFormTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	forms := completionForms()
+	if len(forms) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// Complete the last entry of the list, keeping those before it
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+	chosen := make(map[string]bool)
+	for _, name := range strings.Split(prefix, ",") {
+		chosen[name] = true
+	}
+
+	names := make([]string, 0, len(forms))
+	for name := range forms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	completions := make([]string, 0, len(names))
+	for _, name := range names {
+		if chosen[name] {
+			continue
+		}
+		completions = append(completions, fmt.Sprintf("%s%s\t%d fields", prefix, name, len(forms[name].Fields)))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completionForms returns the forms of the active app bundle like pullForms does, but
+// quietly and without touching the offline cache
+func completionForms() map[string]client.FormInfo {
+	if appInfo, err := completionClient().GetAppBundleAppInfo(); err == nil {
+		return appInfo.Forms
+	}
+	if cache, err := openBundleCache(); err == nil {
+		if _, meta, err := cache.ActiveManifest(); err == nil {
+			if appInfo, err := cache.LoadAppInfo(meta.ActiveVersion); err == nil {
+				return appInfo.Forms
+			}
+		}
+	}
+	return nil
+}
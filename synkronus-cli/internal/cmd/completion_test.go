@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stubServer serves canned JSON responses by path and points the CLI at it
+func stubServer(t *testing.T, responses map[string]string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	viper.Set("api.url", server.URL)
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+	viper.Set("cache.dir", t.TempDir())
+}
+
+func TestCompleteUsernames(t *testing.T) {
+	stubServer(t, map[string]string{
+		"/users": `[{"username":"alice","role":"admin"},{"username":"bob"},{"role":"read-only"}]`,
+	})
+	cmd := &cobra.Command{Args: cobra.ExactArgs(1)}
+
+	completions, directive := completeUsernames(cmd, nil, "")
+	if want := []string{"alice\tadmin", "bob"}; !reflect.DeepEqual(completions, want) {
+		t.Errorf("completions = %q, want %q", completions, want)
+	}
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v", directive)
+	}
+
+	// The command takes no more usernames
+	if completions, _ := completeUsernames(cmd, []string{"alice"}, ""); completions != nil {
+		t.Errorf("completions after the last argument = %q", completions)
+	}
+}
+
+func TestCompleteUsernames_NotAdmin(t *testing.T) {
+	stubServer(t, map[string]string{})
+	completions, _ := completeUsernames(&cobra.Command{}, nil, "")
+	if completions != nil {
+		t.Errorf("completions = %q, want none", completions)
+	}
+}
+
+func TestCompleteFormTypes(t *testing.T) {
+	stubServer(t, map[string]string{
+		"/app-bundle/download/APP_INFO.json": `{"forms":{
+			"survey":{"fields":[{"name":"age","type":"integer"},{"name":"name","type":"string"}]},
+			"household":{"fields":[{"name":"size","type":"integer"}]}
+		}}`,
+	})
+
+	completions, directive := completeFormTypes(&cobra.Command{}, nil, "")
+	if want := []string{"household\t1 fields", "survey\t2 fields"}; !reflect.DeepEqual(completions, want) {
+		t.Errorf("completions = %q, want %q", completions, want)
+	}
+	if directive != cobra.ShellCompDirectiveNoFileComp|cobra.ShellCompDirectiveNoSpace {
+		t.Errorf("directive = %v", directive)
+	}
+
+	// Entries already in the list are kept and not offered again
+	completions, _ = completeFormTypes(&cobra.Command{}, nil, "survey,h")
+	if want := []string{"survey,household\t1 fields"}; !reflect.DeepEqual(completions, want) {
+		t.Errorf("completions = %q, want %q", completions, want)
+	}
+}
+
+func TestCompleteFormTypes_Unreachable(t *testing.T) {
+	stubServer(t, map[string]string{})
+	if completions, _ := completeFormTypes(&cobra.Command{}, nil, ""); completions != nil {
+		t.Errorf("completions = %q, want none without a server or cache", completions)
+	}
+}
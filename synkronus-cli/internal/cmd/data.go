@@ -1,10 +1,22 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/utils"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/exportcrypt"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/exportinspect"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/tabular"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // dataCmd represents the data command group
@@ -41,7 +53,320 @@ Examples:
 	},
 }
 
+// dataDecryptCmd represents the data decrypt command
+var dataDecryptCmd = &cobra.Command{
+	Use:   "decrypt <input_file> <output_file> --key <private_key.pem>",
+	Short: "Decrypt sensitive columns in an export archive",
+	Long: `Decrypt fields that the server encrypted for the export recipient key.
+
+When the server is configured with EXPORT_PUBLIC_KEY_PATH, fields tagged
+x-sensitive in form schemas are encrypted in exports. This command unwraps
+the export's data key with the matching RSA private key and writes a copy
+of the archive with those columns restored to plaintext.
+
+Examples:
+  synk data decrypt exports.zip exports_plain.zip --key ./keys/export.pem`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile, outputFile := args[0], args[1]
+
+		keyPath, _ := cmd.Flags().GetString("key")
+		if keyPath == "" {
+			return fmt.Errorf("--key is required")
+		}
+
+		cmd.SilenceUsage = true
+
+		key, err := exportcrypt.LoadPrivateKey(keyPath)
+		if err != nil {
+			return err
+		}
+
+		result, err := exportcrypt.DecryptExport(inputFile, outputFile, key)
+		if err != nil {
+			return fmt.Errorf("data decrypt failed: %w", err)
+		}
+
+		fmt.Printf("Decrypted %d values in %d files\n", result.ValuesDecrypted, result.FilesDecrypted)
+		fmt.Printf("Decrypted export saved to %s\n", outputFile)
+		return nil
+	},
+}
+
+// dataInspectCmd represents the data inspect command
+var dataInspectCmd = &cobra.Command{
+	Use:   "inspect <export.zip>",
+	Short: "Preview the tables of a downloaded export",
+	Long: `Read a Parquet or CSV export archive locally and print, per form type, a typed
+preview of the first rows and each column's null count and min/max.
+
+Long output is shown in $PAGER (less by default) when writing to a terminal.
+
+With --format csv or jsonl the matching rows of one form type are written to stdout
+instead, for small extracts; every matching row is written unless --head is given.
+
+Examples:
+  synk data inspect exports.zip
+  synk data inspect exports.zip --form-type survey --head 50
+  synk data inspect exports.zip --form-type survey --columns observation_id,updated_at --filter deleted=false
+  synk data inspect exports.zip --form-type survey --filter deleted=false --format csv > survey.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formType, _ := cmd.Flags().GetString("form-type")
+		head, _ := cmd.Flags().GetInt("head")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		filterArgs, _ := cmd.Flags().GetStringArray("filter")
+		noPager, _ := cmd.Flags().GetBool("no-pager")
+		formatName, _ := cmd.Flags().GetString("format")
+		if head < 0 {
+			return fmt.Errorf("--head must not be negative")
+		}
+		format, err := tabular.ParseFormat(formatName, tabular.FormatTable, tabular.FormatCSV, tabular.FormatJSONL)
+		if err != nil {
+			return err
+		}
+		if format != tabular.FormatTable && !cmd.Flags().Changed("head") {
+			head = math.MaxInt
+		}
+
+		filters := make(map[string]string, len(filterArgs))
+		for _, f := range filterArgs {
+			name, value, ok := strings.Cut(f, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid --filter %q, expected column=value", f)
+			}
+			filters[name] = value
+		}
+
+		cmd.SilenceUsage = true
+
+		tables, err := exportinspect.Inspect(args[0], exportinspect.Options{
+			FormType: formType,
+			Head:     head,
+			Columns:  columns,
+			Filters:  filters,
+		})
+		if err != nil {
+			return fmt.Errorf("data inspect failed: %w", err)
+		}
+		if len(tables) == 0 {
+			fmt.Println("No Parquet or CSV files found in the export")
+			return nil
+		}
+		if format != tabular.FormatTable {
+			if len(tables) > 1 {
+				return fmt.Errorf("the export has %d form types, choose one with --form-type", len(tables))
+			}
+			return writeTabularFile(os.Stdout, inspectedTabular(tables[0]), format)
+		}
+
+		var out bytes.Buffer
+		for i, table := range tables {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			writeInspectedTable(&out, table, len(filters) > 0)
+		}
+		return page(out.Bytes(), noPager)
+	},
+}
+
+// maxCellWidth truncates long values in the preview
+const maxCellWidth = 32
+
+// writeInspectedTable prints a table's preview and column statistics
+func writeInspectedTable(w io.Writer, table *exportinspect.Table, filtered bool) {
+	summary := fmt.Sprintf("%d rows", table.Total)
+	if filtered {
+		summary = fmt.Sprintf("%d of %d rows match", table.Matched, table.Total)
+	}
+	fmt.Fprintf(w, "%s %s\n\n", utils.Heading(table.FormType), utils.Gray("("+table.File+", "+summary+")"))
+
+	if len(table.Rows) > 0 {
+		header := make([]string, len(table.Columns))
+		for i, col := range table.Columns {
+			header[i] = col.Name
+		}
+		rows := make([][]cell, len(table.Rows))
+		for r, row := range table.Rows {
+			rows[r] = make([]cell, len(row))
+			for c, value := range row {
+				rows[r][c] = valueCell(value, table.Columns[c].Type)
+			}
+		}
+		writeGrid(w, header, rows)
+		if more := table.Matched - len(table.Rows); more == 1 {
+			fmt.Fprintf(w, "%s\n", utils.Gray("... 1 more row"))
+		} else if more > 1 {
+			fmt.Fprintf(w, "%s\n", utils.Gray(fmt.Sprintf("... %d more rows", more)))
+		}
+		fmt.Fprintln(w)
+	}
+
+	stats := make([][]cell, len(table.Columns))
+	for i, col := range table.Columns {
+		nulls := cell{text: fmt.Sprint(col.Nulls)}
+		if col.Nulls > 0 {
+			nulls.color = utils.Warning
+		}
+		stats[i] = []cell{
+			{text: col.Name, color: utils.Bold},
+			{text: col.Type, color: utils.Gray},
+			nulls,
+			valueCell(col.Min, col.Type),
+			valueCell(col.Max, col.Type),
+		}
+	}
+	writeGrid(w, []string{"COLUMN", "TYPE", "NULLS", "MIN", "MAX"}, stats)
+}
+
+// inspectedTabular returns the previewed rows of an export table
+func inspectedTabular(table *exportinspect.Table) *tabular.Table {
+	columns := make([]tabular.Column, len(table.Columns))
+	for i, col := range table.Columns {
+		columns[i] = tabular.Column{Name: col.Name, Type: col.Type}
+	}
+	return &tabular.Table{Columns: columns, Rows: table.Rows}
+}
+
+// writeTabular prints flattened records as an aligned table
+func writeTabular(w io.Writer, table *tabular.Table) {
+	if len(table.Rows) == 0 {
+		fmt.Fprintln(w, "No records")
+		return
+	}
+	header := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		header[i] = col.Name
+	}
+	rows := make([][]cell, len(table.Rows))
+	for r, row := range table.Rows {
+		rows[r] = make([]cell, len(row))
+		for c, value := range row {
+			rows[r][c] = valueCell(value, table.Columns[c].Type)
+		}
+	}
+	writeGrid(w, header, rows)
+}
+
+// writeTabularFile writes a table as CSV or JSON lines
+func writeTabularFile(w io.Writer, table *tabular.Table, format string) error {
+	var err error
+	if format == tabular.FormatCSV {
+		err = tabular.WriteCSV(w, table)
+	} else {
+		err = tabular.WriteJSONL(w, table)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing records: %w", err)
+	}
+	return nil
+}
+
+// cell is a table cell with an optional color
+type cell struct {
+	text  string
+	color func(a ...interface{}) string
+}
+
+// valueCell colors a value by its column type; nulls are shown as a gray dash
+func valueCell(value interface{}, columnType string) cell {
+	if value == nil {
+		return cell{text: "-", color: utils.Gray}
+	}
+	text := strings.ReplaceAll(exportinspect.FormatValue(value), "\n", " ")
+	if utf8.RuneCountInString(text) > maxCellWidth {
+		text = string([]rune(text)[:maxCellWidth-1]) + "…"
+	}
+	switch columnType {
+	case exportinspect.TypeInteger, exportinspect.TypeNumber:
+		return cell{text: text, color: utils.Cyan}
+	case exportinspect.TypeBoolean:
+		return cell{text: text, color: utils.Warning}
+	case exportinspect.TypeTimestamp:
+		return cell{text: text, color: utils.Success}
+	}
+	return cell{text: text}
+}
+
+// writeGrid aligns cells into columns. Widths are measured before coloring, which
+// tabwriter can't do because it counts the color escape codes.
+func writeGrid(w io.Writer, header []string, rows [][]cell) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i, c := range row {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	pad := func(i int, text string) string {
+		if i == len(widths)-1 {
+			return ""
+		}
+		return strings.Repeat(" ", widths[i]-utf8.RuneCountInString(text)+2)
+	}
+	for i, h := range header {
+		fmt.Fprint(w, utils.Bold(h)+pad(i, h))
+	}
+	fmt.Fprintln(w)
+	for _, row := range rows {
+		for i, c := range row {
+			text := c.text
+			if c.color != nil {
+				text = c.color(c.text)
+			}
+			fmt.Fprint(w, text+pad(i, c.text))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// page writes output through $PAGER when it doesn't fit the terminal
+func page(output []byte, disabled bool) error {
+	fd := int(os.Stdout.Fd())
+	if disabled || !term.IsTerminal(fd) {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	if _, height, err := term.GetSize(fd); err != nil || bytes.Count(output, []byte("\n")) < height {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	fields := strings.Fields(pager)
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Without a working pager the output is still shown
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	return nil
+}
+
 func init() {
+	dataInspectCmd.Flags().StringP("form-type", "f", "", "Only inspect this form type")
+	dataInspectCmd.Flags().IntP("head", "n", 20, "Number of rows to preview per form type")
+	dataInspectCmd.Flags().StringSlice("columns", nil, "Comma-separated columns to show, in order")
+	dataInspectCmd.Flags().StringArray("filter", nil, "Only include rows where column=value (repeatable)")
+	dataInspectCmd.Flags().Bool("no-pager", false, "Print directly instead of through $PAGER")
+	dataInspectCmd.Flags().String("format", tabular.FormatTable, "Output format: table (preview and statistics), csv or jsonl")
+
+	dataDecryptCmd.Flags().StringP("key", "k", "", "PEM-encoded RSA private key matching the server's export public key")
+	dataDecryptCmd.MarkFlagRequired("key")
+
 	dataCmd.AddCommand(dataExportCmd)
+	dataCmd.AddCommand(dataDecryptCmd)
+	dataCmd.AddCommand(dataInspectCmd)
 	rootCmd.AddCommand(dataCmd)
 }
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/devserver"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	devCmd := &cobra.Command{
+		Use:   "dev",
+		Short: "Tools for developing app bundles locally",
+	}
+	rootCmd.AddCommand(devCmd)
+
+	serveCmd := &cobra.Command{
+		Use:   "serve <bundle-dir>",
+		Short: "Serve an app bundle directory to the mobile app without a Synkronus server",
+		Long: `Run a local mini-server with the app bundle endpoints of the Synkronus API
+(manifest, file and zip downloads) over an unzipped bundle directory, so form and
+renderer developers can point the mobile app at their laptop.
+
+The manifest is rebuilt on every request, so saved edits reach the app on its next
+bundle sync. Any username and password log in, as an admin. With --sync the server
+also keeps pushed observations and uploaded attachments in memory and serves them to
+pulls; they are lost when it stops. Without --sync, sync requests fail with 501.
+
+The device must reach the laptop, e.g. on the same Wi-Fi network; use one of the
+printed addresses as the server URL in the app.`,
+		Example: `  synk dev serve ./my-bundle
+  synk dev serve ./my-bundle --port 9000 --sync`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			port, _ := cmd.Flags().GetInt("port")
+			host, _ := cmd.Flags().GetString("host")
+			enableSync, _ := cmd.Flags().GetBool("sync")
+			version, _ := cmd.Flags().GetString("bundle-version")
+			quiet, _ := cmd.Flags().GetBool("quiet")
+
+			config := devserver.Config{BundleDir: args[0], Version: version, Sync: enableSync}
+			if !quiet {
+				config.Logf = func(format string, args ...any) {
+					fmt.Printf("%s %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+				}
+			}
+			server, err := devserver.New(config)
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+
+			manifest, err := server.Manifest()
+			if err != nil {
+				return err
+			}
+			listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				return fmt.Errorf("failed to listen: %w", err)
+			}
+
+			color.Green("✓ Serving %s (%d files) as app bundle version %s", args[0], len(manifest.Files), manifest.Version)
+			for _, url := range devServerURLs(host, listener.Addr().(*net.TCPAddr).Port) {
+				fmt.Printf("  %s\n", url)
+			}
+			if enableSync {
+				fmt.Println("In-memory sync is enabled; pushed data is lost when the server stops.")
+			}
+			fmt.Println("Press Ctrl+C to stop.")
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			httpServer := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				<-ctx.Done()
+				shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				httpServer.Shutdown(shutdown)
+			}()
+			if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("dev server failed: %w", err)
+			}
+			return nil
+		},
+	}
+	serveCmd.Flags().IntP("port", "p", 8080, "Port to listen on")
+	serveCmd.Flags().String("host", "", "Address to listen on (defaults to every interface, so devices on the network can connect)")
+	serveCmd.Flags().Bool("sync", false, "Keep pushed observations and attachments in memory and serve them to pulls")
+	serveCmd.Flags().String("bundle-version", devserver.DefaultVersion, "App bundle version reported in the manifest")
+	serveCmd.Flags().BoolP("quiet", "q", false, "Don't log requests")
+	devCmd.AddCommand(serveCmd)
+}
+
+// devServerURLs lists the URLs the dev server can be reached at: the listen host, or
+// localhost and the machine's IPv4 addresses when listening on every interface
+func devServerURLs(host string, port int) []string {
+	if host != "" {
+		return []string{fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port)))}
+	}
+	urls := []string{fmt.Sprintf("http://localhost:%d", port)}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return urls
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			urls = append(urls, fmt.Sprintf("http://%s:%d", ipNet.IP, port))
+		}
+	}
+	return urls
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocsCommand(t *testing.T) {
+	manDir := filepath.Join(t.TempDir(), "man1")
+	markdownDir := filepath.Join(t.TempDir(), "cli")
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	generate := func() {
+		t.Helper()
+		docsCmd.Flags().Set("man", manDir)
+		docsCmd.Flags().Set("markdown", markdownDir)
+		t.Cleanup(func() {
+			docsCmd.Flags().Set("man", "")
+			docsCmd.Flags().Set("markdown", "")
+		})
+		if err := docsCmd.RunE(docsCmd, nil); err != nil {
+			t.Fatalf("docs: %v", err)
+		}
+	}
+
+	generate()
+	page := filepath.Join(manDir, "synk-docs.1")
+	first, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatalf("man page of docs: %v", err)
+	}
+	if !strings.Contains(string(first), "Nov 2023") {
+		t.Errorf("man page is not dated by SOURCE_DATE_EPOCH:\n%s", first)
+	}
+	if _, err := os.Stat(filepath.Join(markdownDir, "synk_user_delete.md")); err != nil {
+		t.Errorf("Markdown page of user delete: %v", err)
+	}
+	markdown, err := os.ReadFile(filepath.Join(markdownDir, "synk_docs.md"))
+	if err != nil {
+		t.Fatalf("Markdown page of docs: %v", err)
+	}
+	if strings.Contains(string(markdown), "Auto generated") {
+		t.Errorf("Markdown page has a generation date:\n%s", markdown)
+	}
+
+	// Regenerating gives the same pages
+	generate()
+	second, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatalf("man page of docs: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("regenerated man page differs")
+	}
+}
+
+func TestDocsCommand_NoOutput(t *testing.T) {
+	if err := docsCmd.RunE(docsCmd, nil); err == nil {
+		t.Error("docs without --man or --markdown succeeded")
+	}
+}
+
+func TestManDate(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if date, err := manDate(); err != nil || date.Unix() != 0 {
+		t.Errorf("manDate() = %v, %v, want the Unix epoch", date, err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := manDate(); err == nil {
+		t.Error("manDate accepted an invalid SOURCE_DATE_EPOCH")
+	}
+}
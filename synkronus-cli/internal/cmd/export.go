@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/cronexpr"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command group
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Manage server-side exports (admin only)",
+}
+
+// exportScheduleCmd represents the 'export schedule' command group
+var exportScheduleCmd = &cobra.Command{
+	Use:     "schedule",
+	Aliases: []string{"schedules"},
+	Short:   "Manage recurring deliveries of export reports (admin only)",
+	Long: `Export schedules run a named export report on a cron expression and deliver it
+as CSV or JSON, either as a new file in a directory under the server's
+EXPORT_SCHEDULE_DIR or as a POST to a webhook URL.`,
+}
+
+// createExportScheduleCmd represents the 'export schedule create' command
+var createExportScheduleCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create or replace an export schedule",
+	Long: `Create an export schedule, or replace the schedule of the same name.
+
+The cron expression has five fields (minute, hour, day of month, month, day of
+week) evaluated in UTC, or is one of @hourly, @daily, @weekly, @monthly and
+@yearly. It is checked before anything is sent to the server. Give exactly one
+of --dir, a directory relative to the server's EXPORT_SCHEDULE_DIR ("." for the
+directory itself), and --webhook.`,
+	Example: `  synk export schedule create nightly-counts --cron "0 2 * * *" --report daily-counts --param since=2025-01-01 --dir warehouse
+  synk export schedule create hourly-feed --cron @hourly --report recent --format json --webhook https://etl.example.org/ingest`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cronSpec, _ := cmd.Flags().GetString("cron")
+		report, _ := cmd.Flags().GetString("report")
+		format, _ := cmd.Flags().GetString("format")
+		paramArgs, _ := cmd.Flags().GetStringArray("param")
+		dir, _ := cmd.Flags().GetString("dir")
+		webhook, _ := cmd.Flags().GetString("webhook")
+
+		expr, err := cronexpr.Parse(cronSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if expr.Next(time.Now()).IsZero() {
+			fmt.Fprintf(os.Stderr, "Error: cron expression %q never matches\n", cronSpec)
+			os.Exit(1)
+		}
+		if format != "csv" && format != "json" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --format %q, expected csv or json\n", format)
+			os.Exit(1)
+		}
+
+		var destination client.ExportScheduleDestination
+		switch {
+		case dir != "" && webhook != "":
+			fmt.Fprintln(os.Stderr, "Error: give either --dir or --webhook, not both")
+			os.Exit(1)
+		case dir != "":
+			destination = client.ExportScheduleDestination{Type: "directory"}
+			if dir != "." {
+				destination.Path = dir
+			}
+		case webhook != "":
+			destination = client.ExportScheduleDestination{Type: "webhook", URL: webhook}
+		default:
+			fmt.Fprintln(os.Stderr, "Error: a destination is required, give --dir or --webhook")
+			os.Exit(1)
+		}
+
+		params := make(map[string]string, len(paramArgs))
+		for _, p := range paramArgs {
+			name, value, ok := strings.Cut(p, "=")
+			if !ok || name == "" {
+				fmt.Fprintf(os.Stderr, "Error: invalid --param %q, expected name=value\n", p)
+				os.Exit(1)
+			}
+			params[name] = value
+		}
+
+		c := client.NewClient()
+		saved, err := c.SaveExportSchedule(args[0], client.ExportSchedule{
+			Cron:        cronSpec,
+			Report:      report,
+			Format:      format,
+			Parameters:  params,
+			Destination: destination,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving export schedule: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Export schedule '%s' saved: report %s to %s.\n", saved.Name, saved.Report, describeDestination(saved.Destination))
+		if saved.NextRunAt != nil {
+			fmt.Printf("Next run: %s\n", saved.NextRunAt.UTC().Format(time.RFC3339))
+		}
+	},
+}
+
+// listExportSchedulesCmd represents the 'export schedule list' command
+var listExportSchedulesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List export schedules with their next and latest runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient()
+		schedules, err := c.ListExportSchedules()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing export schedules: %v\n", err)
+			os.Exit(1)
+		}
+		if len(schedules) == 0 {
+			fmt.Println("No export schedules found.")
+			return
+		}
+		fmt.Printf("%-24s %-14s %-20s %-5s %-21s %-21s %s\n", "NAME", "CRON", "REPORT", "FMT", "NEXT RUN", "LAST RUN", "LAST STATUS")
+		fmt.Println(strings.Repeat("-", 120))
+		for _, s := range schedules {
+			status := s.LastStatus
+			if s.LastError != "" {
+				status += ": " + s.LastError
+			}
+			fmt.Printf("%-24s %-14s %-20s %-5s %-21s %-21s %s\n", s.Name, s.Cron, s.Report, s.Format, formatRunTime(s.NextRunAt), formatRunTime(s.LastRunAt), status)
+			fmt.Printf("  -> %s\n", describeDestination(s.Destination))
+		}
+	},
+}
+
+// deleteExportScheduleCmd represents the 'export schedule delete' command
+var deleteExportScheduleCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete an export schedule; files it delivered are kept",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient()
+		if err := c.DeleteExportSchedule(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting export schedule: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Export schedule '%s' deleted.\n", args[0])
+	},
+}
+
+// runExportScheduleCmd represents the 'export schedule run-now' command
+var runExportScheduleCmd = &cobra.Command{
+	Use:   "run-now <name>",
+	Short: "Run an export schedule at once, without moving its next run",
+	Long: `Run a schedule's report and deliver it at once, to check a new schedule or to
+redeliver after a failure. The command exits non-zero when the run fails.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient()
+		run, err := c.RunExportSchedule(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running export schedule: %v\n", err)
+			os.Exit(1)
+		}
+		if run.Status != "ok" {
+			fmt.Fprintf(os.Stderr, "Export schedule '%s' failed: %s\n", run.Schedule, run.Error)
+			os.Exit(1)
+		}
+		fmt.Printf("Export schedule '%s' delivered %d rows of %s to %s.\n", run.Schedule, run.Rows, run.Report, run.Delivery)
+		if run.Truncated {
+			fmt.Println("Warning: the report was truncated at the server's EXPORT_REPORT_MAX_ROWS.")
+		}
+	},
+}
+
+// describeDestination renders a schedule destination for output
+func describeDestination(d client.ExportScheduleDestination) string {
+	if d.Type == "webhook" {
+		return "webhook " + d.URL
+	}
+	if d.Path == "" {
+		return "directory EXPORT_SCHEDULE_DIR"
+	}
+	return "directory EXPORT_SCHEDULE_DIR/" + d.Path
+}
+
+// formatRunTime renders an optional run time for the schedule list
+func formatRunTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func init() {
+	createExportScheduleCmd.Flags().String("cron", "", "Cron expression in UTC, e.g. \"0 2 * * *\" or @daily")
+	createExportScheduleCmd.Flags().String("report", "", "Name of the export report to run")
+	createExportScheduleCmd.Flags().String("format", "csv", "Output format: csv or json")
+	createExportScheduleCmd.Flags().StringArray("param", nil, "Report parameter as name=value (repeatable)")
+	createExportScheduleCmd.Flags().String("dir", "", "Deliver to a directory under the server's EXPORT_SCHEDULE_DIR")
+	createExportScheduleCmd.Flags().String("webhook", "", "Deliver as a POST to this http(s) URL")
+	createExportScheduleCmd.MarkFlagRequired("cron")
+	createExportScheduleCmd.MarkFlagRequired("report")
+
+	exportScheduleCmd.AddCommand(createExportScheduleCmd)
+	exportScheduleCmd.AddCommand(listExportSchedulesCmd)
+	exportScheduleCmd.AddCommand(deleteExportScheduleCmd)
+	exportScheduleCmd.AddCommand(runExportScheduleCmd)
+	exportCmd.AddCommand(exportScheduleCmd)
+
+	rootCmd.AddCommand(exportCmd)
+}
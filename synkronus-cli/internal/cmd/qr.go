@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/base64"
 	"fmt"
 	"net/url"
 	"os"
@@ -10,29 +9,13 @@ import (
 
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/auth"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/utils"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/provisioning"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	qrcode "github.com/yeqown/go-qrcode/v2"
 	"github.com/yeqown/go-qrcode/writer/standard"
 )
 
-// encodeFRMLS replicates the FRMLS encoding used by the Formulus generateQR.ts script.
-// Format: FRMLS:v:<b64(v)>;s:<b64(serverUrl)>;u:<b64(username)>;p:<b64(password)>;;
-func encodeFRMLS(version int, serverURL, username, password string) string {
-	b64 := func(s string) string {
-		return base64.StdEncoding.EncodeToString([]byte(s))
-	}
-
-	parts := []string{
-		fmt.Sprintf("v:%s", b64(fmt.Sprintf("%d", version))),
-		fmt.Sprintf("s:%s", b64(serverURL)),
-		fmt.Sprintf("u:%s", b64(username)),
-		fmt.Sprintf("p:%s", b64(password)),
-	}
-
-	return "FRMLS:" + strings.Join(parts, ";") + ";;"
-}
-
 // deriveOutputFilename builds a safe default filename from the server URL, using only
 // the hostname and path segments (no scheme or port), and appending .png.
 func deriveOutputFilename(serverURL string) string {
@@ -142,7 +125,7 @@ for the Formulus mobile app. The QR encodes server URL, username, and password.`
 				return fmt.Errorf("password is required")
 			}
 
-			encoded := encodeFRMLS(1, serverURL, username, password)
+			encoded := provisioning.EncodeFRMLS(1, serverURL, username, password)
 
 			outputFile, err := cmd.Flags().GetString("output")
 			if err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/config"
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/internal/utils"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/httplog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -18,9 +19,25 @@ var (
 		Short: "Synkronus CLI - A command-line interface for the Synkronus API",
 		Long: `Synkronus CLI is a command-line tool for interacting with the Synkronus API.
 It provides functionality for authentication, sync operations, app bundle management, and more.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if traceHTTP(cmd) {
+				httplog.Enable(os.Stderr)
+			}
+		},
 	}
 )
 
+// traceHTTP reports whether --trace-http or --verbose is set. Commands with their own
+// --verbose flag trace HTTP too.
+func traceHTTP(cmd *cobra.Command) bool {
+	for _, name := range []string{"trace-http", "verbose"} {
+		if enabled, err := cmd.Flags().GetBool(name); err == nil && enabled {
+			return true
+		}
+	}
+	return false
+}
+
 // completionCmd represents the completion command
 var completionCmd = &cobra.Command{
 	Use:   "completion [bash|zsh|fish|powershell]",
@@ -75,6 +92,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.synkronus.yaml)")
 	rootCmd.PersistentFlags().String("api-url", "http://localhost:8080", "Synkronus API URL")
 	rootCmd.PersistentFlags().String("api-version", "1.0.0", "API version to use")
+	rootCmd.PersistentFlags().Bool("trace-http", false, "Log every API request and response (status, timing, proxy, TLS, redacted headers) to stderr")
+	rootCmd.PersistentFlags().Bool("verbose", false, "Same as --trace-http")
 
 	viper.BindPFlag("api.url", rootCmd.PersistentFlags().Lookup("api-url"))
 	viper.BindPFlag("api.version", rootCmd.PersistentFlags().Lookup("api-version"))
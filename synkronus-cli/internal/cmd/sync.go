@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/tabular"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
@@ -26,12 +29,36 @@ func init() {
 		Short: "Pull data from the server",
 		Long: `Pull updated records from the Synkronus API server and save the response to a file.
 
+With --format table, csv or jsonl the pulled records are flattened into one column
+per data field, the way the data export does it, using the forms of the active app
+bundle's APP_INFO.json. table prints to the terminal; the other formats write the
+output file, or stdout when it is omitted or "-".
+
 Examples:
   synk sync pull output.json --client-id my-client
-  synk sync pull data.json --client-id my-client --current-version 123 --limit 100`,
-		Args: cobra.ExactArgs(1),
+  synk sync pull data.json --client-id my-client --current-version 123 --limit 100
+  synk sync pull --client-id my-client --schema-types survey --format table
+  synk sync pull survey.csv --client-id my-client --schema-types survey --format csv`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			outputFile := args[0]
+			formatName, _ := cmd.Flags().GetString("format")
+			format, err := tabular.ParseFormat(formatName, tabular.FormatJSON, tabular.FormatTable, tabular.FormatCSV, tabular.FormatJSONL)
+			if err != nil {
+				return err
+			}
+
+			outputFile := ""
+			if len(args) > 0 && args[0] != "-" {
+				outputFile = args[0]
+			}
+			if format == tabular.FormatTable && outputFile != "" {
+				return fmt.Errorf("--format table prints to the terminal and takes no output_file")
+			}
+			// Progress goes to stderr when the records are written to stdout
+			status := io.Writer(os.Stdout)
+			if outputFile == "" {
+				status = os.Stderr
+			}
 
 			clientID, err := cmd.Flags().GetString("client-id")
 			if err != nil {
@@ -62,19 +89,19 @@ Examples:
 				return err
 			}
 
-			fmt.Printf("Pulling data from Synkronus API...\n")
-			fmt.Printf("Client ID: %s\n", clientID)
+			fmt.Fprintf(status, "Pulling data from Synkronus API...\n")
+			fmt.Fprintf(status, "Client ID: %s\n", clientID)
 			if currentVersion > 0 {
-				fmt.Printf("Current Version: %d\n", currentVersion)
+				fmt.Fprintf(status, "Current Version: %d\n", currentVersion)
 			}
 			if len(schemaTypesStr) > 0 {
-				fmt.Printf("Schema Types: %s\n", strings.Join(schemaTypesStr, ", "))
+				fmt.Fprintf(status, "Schema Types: %s\n", strings.Join(schemaTypesStr, ", "))
 			}
 			if limit > 0 {
-				fmt.Printf("Limit: %d\n", limit)
+				fmt.Fprintf(status, "Limit: %d\n", limit)
 			}
 			if pageToken != "" {
-				fmt.Printf("Page Token: %s\n", pageToken)
+				fmt.Fprintf(status, "Page Token: %s\n", pageToken)
 			}
 
 			c := client.NewClient()
@@ -83,29 +110,40 @@ Examples:
 				return fmt.Errorf("sync pull failed: %w", err)
 			}
 
-			// Save response to file
-			jsonData, err := json.MarshalIndent(response, "", "  ")
-			if err != nil {
-				return fmt.Errorf("error formatting JSON: %w", err)
-			}
+			if format == tabular.FormatJSON {
+				// Save response to file
+				jsonData, err := json.MarshalIndent(response, "", "  ")
+				if err != nil {
+					return fmt.Errorf("error formatting JSON: %w", err)
+				}
 
-			if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
-				return fmt.Errorf("error writing to file: %w", err)
+				if outputFile == "" {
+					fmt.Println(string(jsonData))
+				} else if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
+					return fmt.Errorf("error writing to file: %w", err)
+				}
+			} else {
+				cmd.SilenceUsage = true
+				if err := writePulledRecords(c, response, format, outputFile); err != nil {
+					return err
+				}
 			}
 
-			fmt.Printf("\nSync pull completed successfully!\n")
-			fmt.Printf("Response saved to: %s\n", outputFile)
+			fmt.Fprintf(status, "\nSync pull completed successfully!\n")
+			if outputFile != "" {
+				fmt.Fprintf(status, "Response saved to: %s\n", outputFile)
+			}
 
 			// Display summary information
 			if currentVersionResp, ok := response["current_version"]; ok {
-				fmt.Printf("Current Version: %v\n", currentVersionResp)
+				fmt.Fprintf(status, "Current Version: %v\n", currentVersionResp)
 			}
 			if records, ok := response["records"].([]interface{}); ok {
-				fmt.Printf("Records Retrieved: %d\n", len(records))
+				fmt.Fprintf(status, "Records Retrieved: %d\n", len(records))
 			}
 			if hasMore, ok := response["has_more"].(bool); ok && hasMore {
 				if nextPageToken, ok := response["next_page_token"].(string); ok {
-					fmt.Printf("More data available. Use --page-token=%s for next page\n", nextPageToken)
+					fmt.Fprintf(status, "More data available. Use --page-token=%s for next page\n", nextPageToken)
 				}
 			}
 
@@ -117,7 +155,9 @@ Examples:
 	pullCmd.Flags().StringSlice("schema-types", []string{}, "Comma-separated list of schema types to filter")
 	pullCmd.Flags().Int("limit", 0, "Maximum number of records to return")
 	pullCmd.Flags().String("page-token", "", "Pagination token from previous response")
+	pullCmd.Flags().String("format", tabular.FormatJSON, "Output format: json (full response), table, csv or jsonl")
 	pullCmd.MarkFlagRequired("client-id")
+	pullCmd.RegisterFlagCompletionFunc("schema-types", completeFormTypes)
 	syncCmd.AddCommand(pullCmd)
 
 	// Push command
@@ -196,8 +236,13 @@ Examples:
 				transmissionID = uuid.New().String()
 			}
 
+			dryRun, err := cmd.Flags().GetBool("dry-run")
+			if err != nil {
+				return err
+			}
+
 			c := client.NewClient()
-			response, err := c.SyncPush(clientID, transmissionID, recordsFormatted)
+			response, err := c.SyncPush(clientID, transmissionID, recordsFormatted, dryRun)
 			if err != nil {
 				return fmt.Errorf("sync push failed: %w", err)
 			}
@@ -218,7 +263,11 @@ Examples:
 			}
 
 			// Display formatted output
-			fmt.Println("Sync Push Results:")
+			if dryRun {
+				fmt.Println("Sync Push Dry Run (nothing was stored):")
+			} else {
+				fmt.Println("Sync Push Results:")
+			}
 			fmt.Printf("Server Data Version: %v\n", response["current_version"])
 			fmt.Printf("Success Count: %v\n", response["success_count"])
 
@@ -234,6 +283,18 @@ Examples:
 				}
 			}
 
+			if outcomes, ok := response["outcomes"].([]interface{}); ok && len(outcomes) > 0 {
+				counts := map[string]int{}
+				for _, outcome := range outcomes {
+					if outcomeMap, ok := outcome.(map[string]interface{}); ok {
+						name, _ := outcomeMap["outcome"].(string)
+						counts[name]++
+					}
+				}
+				fmt.Printf("Would Create: %d, Would Update: %d, Would Fail: %d\n",
+					counts["create"], counts["update"], counts["failed"])
+			}
+
 			if warnings, ok := response["warnings"].([]interface{}); ok && len(warnings) > 0 {
 				fmt.Printf("Warnings: %d\n", len(warnings))
 				for _, warning := range warnings {
@@ -253,5 +314,60 @@ Examples:
 	pushCmd.Flags().String("client-id", "", "Client ID for synchronization")
 	pushCmd.Flags().String("transmission-id", "", "Unique ID for this transmission (for idempotency)")
 	pushCmd.Flags().BoolP("json", "j", false, "Output in JSON format")
+	pushCmd.Flags().Bool("dry-run", false, "Check the records and report what the push would do without storing anything")
 	syncCmd.AddCommand(pushCmd)
 }
+
+// writePulledRecords flattens the records of a pull response and writes them as a table,
+// CSV or JSON lines; outputFile "" is stdout
+func writePulledRecords(c *client.Client, response map[string]interface{}, format, outputFile string) error {
+	rawRecords, _ := response["records"].([]interface{})
+	records := make([]map[string]interface{}, 0, len(rawRecords))
+	for _, raw := range rawRecords {
+		if record, ok := raw.(map[string]interface{}); ok {
+			records = append(records, record)
+		}
+	}
+	table := tabular.FromRecords(records, pullForms(c))
+
+	if format == tabular.FormatTable {
+		var out bytes.Buffer
+		writeTabular(&out, table)
+		return page(out.Bytes(), false)
+	}
+
+	if outputFile == "" {
+		return writeTabularFile(os.Stdout, table, format)
+	}
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error writing to file: %w", err)
+	}
+	if err := writeTabularFile(f, table, format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing to file: %w", err)
+	}
+	return nil
+}
+
+// pullForms returns the forms of the active app bundle, from the offline cache when the
+// server's APP_INFO.json can't be fetched. Without either, records are flattened by
+// their data alone.
+func pullForms(c *client.Client) map[string]client.FormInfo {
+	if appInfo, err := c.GetAppBundleAppInfo(); err == nil {
+		cacheAppInfo(appInfo)
+		return appInfo.Forms
+	}
+	if cache, err := openBundleCache(); err == nil {
+		if _, meta, err := cache.ActiveManifest(); err == nil {
+			if appInfo, err := cache.LoadAppInfo(meta.ActiveVersion); err == nil {
+				printCacheNotice(meta)
+				return appInfo.Forms
+			}
+		}
+	}
+	return nil
+}
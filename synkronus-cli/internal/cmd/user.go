@@ -4,15 +4,19 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/provisioning"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // userCmd represents the user command group
 var userCmd = &cobra.Command{
-	Use:   "user",
-	Short: "Manage Synkronus users (admin only for most operations)",
+	Use:     "user",
+	Aliases: []string{"users"},
+	Short:   "Manage Synkronus users (admin only for most operations)",
 }
 
 // listUsersCmd represents the 'user list' command
@@ -48,11 +52,13 @@ var createUserCmd = &cobra.Command{
 		username, _ := cmd.Flags().GetString("username")
 		password, _ := cmd.Flags().GetString("password")
 		role, _ := cmd.Flags().GetString("role")
+		email, _ := cmd.Flags().GetString("email")
 		c := client.NewClient()
 		resp, err := c.CreateUser(client.UserCreateRequest{
 			Username: username,
 			Password: password,
 			Role:     role,
+			Email:    email,
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating user: %v\n", err)
@@ -64,9 +70,10 @@ var createUserCmd = &cobra.Command{
 
 // deleteUserCmd represents the 'user delete' command
 var deleteUserCmd = &cobra.Command{
-	Use:   "delete [username]",
-	Short: "Delete a user by username (admin only)",
-	Args:  cobra.ExactArgs(1),
+	Use:               "delete [username]",
+	Short:             "Delete a user by username (admin only)",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeUsernames,
 	Run: func(cmd *cobra.Command, args []string) {
 		username := args[0]
 		c := client.NewClient()
@@ -99,6 +106,30 @@ var resetPasswordCmd = &cobra.Command{
 	},
 }
 
+// setEmailCmd represents the 'user set-email' command
+var setEmailCmd = &cobra.Command{
+	Use:   "set-email",
+	Short: "Set the email address used for password reset (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		email, _ := cmd.Flags().GetString("email")
+		c := client.NewClient()
+		err := c.SetUserEmail(client.UserSetEmailRequest{
+			Username: username,
+			Email:    email,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting email: %v\n", err)
+			os.Exit(1)
+		}
+		if email == "" {
+			fmt.Printf("Email cleared for user '%s'.\n", username)
+			return
+		}
+		fmt.Printf("Email for user '%s' set to %s.\n", username, email)
+	},
+}
+
 // changePasswordCmd represents the 'user change-password' command
 var changePasswordCmd = &cobra.Command{
 	Use:   "change-password",
@@ -119,11 +150,258 @@ var changePasswordCmd = &cobra.Command{
 	},
 }
 
+// inviteUserCmd represents the 'user invite' command
+var inviteUserCmd = &cobra.Command{
+	Use:   "invite",
+	Short: "Create a single-use registration invitation (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		role, _ := cmd.Flags().GetString("role")
+		email, _ := cmd.Flags().GetString("email")
+		expires, _ := cmd.Flags().GetDuration("expires")
+		c := client.NewClient()
+		resp, err := c.CreateInvitation(client.InvitationCreateRequest{
+			Role:           role,
+			Email:          email,
+			ExpiresInHours: int(expires.Hours()),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating invitation: %v\n", err)
+			os.Exit(1)
+		}
+		invitation, _ := resp["invitation"].(map[string]interface{})
+		fmt.Printf("Invitation created (role: %v, expires: %v).\n", invitation["role"], invitation["expiresAt"])
+		fmt.Printf("Invite token: %v\n", resp["token"])
+		if link, ok := resp["registrationUrl"].(string); ok && link != "" {
+			fmt.Printf("Registration link: %s\n", link)
+		}
+		fmt.Println("The token is shown only once; share it with the invitee.")
+	},
+}
+
+// listInvitationsCmd represents the 'user invitations' command
+var listInvitationsCmd = &cobra.Command{
+	Use:   "invitations",
+	Short: "List registration invitations (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient()
+		invitations, err := c.ListInvitations()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing invitations: %v\n", err)
+			os.Exit(1)
+		}
+		if len(invitations) == 0 {
+			fmt.Println("No invitations found.")
+			return
+		}
+		fmt.Printf("%-36s %-12s %-24s %-26s %-16s\n", "ID", "ROLE", "EMAIL", "EXPIRES", "USED BY")
+		fmt.Println(strings.Repeat("-", 118))
+		for _, inv := range invitations {
+			id, _ := inv["id"].(string)
+			role, _ := inv["role"].(string)
+			email, _ := inv["email"].(string)
+			expiresAt, _ := inv["expiresAt"].(string)
+			usedBy, _ := inv["usedBy"].(string)
+			fmt.Printf("%-36s %-12s %-24s %-26s %-16s\n", id, role, email, expiresAt, usedBy)
+		}
+	},
+}
+
+// revokeInvitationCmd represents the 'user revoke-invite' command
+var revokeInvitationCmd = &cobra.Command{
+	Use:   "revoke-invite [id]",
+	Short: "Revoke a registration invitation by ID (admin only)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := args[0]
+		c := client.NewClient()
+		if err := c.RevokeInvitation(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error revoking invitation: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Invitation '%s' revoked successfully.\n", id)
+	},
+}
+
+// impersonateUserCmd represents the 'user impersonate' command
+var impersonateUserCmd = &cobra.Command{
+	Use:   "impersonate [username]",
+	Short: "Get a short-lived, read-only token that acts as a user (admin only)",
+	Long: `Get a token that acts as another user, to troubleshoot what they pull and may
+access without asking for their password. The token is read-only, cannot be
+refreshed and expires after the server's IMPERSONATION_TOKEN_TTL_MINUTES.
+Issuing it and every request made with it are audit-logged with the reason.`,
+	Example:           `  synk user impersonate alice --reason "ticket 42: households missing on tablet"`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeUsernames,
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		c := client.NewClient()
+		resp, err := c.ImpersonateUser(args[0], client.ImpersonateRequest{Reason: reason})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error impersonating user: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Impersonating %v (session %v, expires %v).\n", resp["username"], resp["sessionId"], resp["expiresAt"])
+		fmt.Printf("Token: %v\n", resp["token"])
+		fmt.Println("Every request made with this token is recorded in the impersonation audit trail.")
+	},
+}
+
+// listImpersonationsCmd represents the 'user impersonations' command
+var listImpersonationsCmd = &cobra.Command{
+	Use:   "impersonations",
+	Short: "List the impersonation audit trail, newest first (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		limit, _ := cmd.Flags().GetInt("limit")
+		c := client.NewClient()
+		entries, err := c.ListImpersonations(username, limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing impersonations: %v\n", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No impersonations found.")
+			return
+		}
+		fmt.Printf("%-26s %-16s %-16s %-8s %s\n", "TIME", "ADMIN", "USER", "ACTION", "DETAIL")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, entry := range entries {
+			createdAt, _ := entry["createdAt"].(string)
+			admin, _ := entry["admin"].(string)
+			user, _ := entry["username"].(string)
+			action, _ := entry["action"].(string)
+			detail, _ := entry["reason"].(string)
+			if action == "request" {
+				detail = fmt.Sprintf("%v %v -> %v", entry["method"], entry["path"], entry["status"])
+			}
+			fmt.Printf("%-26s %-16s %-16s %-8s %s\n", createdAt, admin, user, action, detail)
+		}
+	},
+}
+
+// importUsersCmd represents the 'user import' command
+var importUsersCmd = &cobra.Command{
+	Use:   "import <users.csv>",
+	Short: "Create users in bulk from a CSV and write a provisioning bundle (admin only)",
+	Long: `Create users from a CSV with a header row and the columns username, role,
+password and email (only username is required). Users without a password get a
+generated one; users without a role get --role.
+
+The provisioning zip holds credentials.csv with the outcome of every row,
+provisioning.pdf with a printable login card per created user and, with --qr,
+a Formulus QR code per user that configures the app in one scan. It contains
+plain-text passwords: hand it out and delete it.`,
+	Example: `  synk user import enumerators.csv --qr
+  synk users import enumerators.csv --role read-write --output cohort-3.zip --dry-run`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		defaultRole, _ := cmd.Flags().GetString("role")
+		output, _ := cmd.Flags().GetString("output")
+		withQR, _ := cmd.Flags().GetBool("qr")
+		serverURL, _ := cmd.Flags().GetString("server-url")
+		passwordLength, _ := cmd.Flags().GetInt("password-length")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if !provisioning.ValidRole(defaultRole) {
+			fmt.Fprintf(os.Stderr, "Error: invalid --role %q (expected %s)\n", defaultRole, strings.Join(provisioning.Roles, ", "))
+			os.Exit(1)
+		}
+		if serverURL == "" {
+			serverURL = viper.GetString("api.url")
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening CSV: %v\n", err)
+			os.Exit(1)
+		}
+		entries, err := provisioning.ParseCSV(file, defaultRole)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := provisioning.FillPasswords(entries, passwordLength); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if dryRun {
+			fmt.Printf("%-24s %-12s %-10s %s\n", "USERNAME", "ROLE", "PASSWORD", "EMAIL")
+			fmt.Println(strings.Repeat("-", 60))
+			for _, e := range entries {
+				password := "from CSV"
+				if e.Generated {
+					password = "generated"
+				}
+				fmt.Printf("%-24s %-12s %-10s %s\n", e.Username, e.Role, password, e.Email)
+			}
+			fmt.Printf("\n%d users would be created. Nothing was sent to the server.\n", len(entries))
+			return
+		}
+
+		// The bundle is the only copy of generated passwords, so an earlier one is never replaced
+		if _, err := os.Stat(output); err == nil {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists; choose another --output\n", output)
+			os.Exit(1)
+		}
+		out, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+
+		c := client.NewClient()
+		results := make([]provisioning.Result, 0, len(entries))
+		failed := 0
+		for i, e := range entries {
+			result := provisioning.Result{Entry: e, Status: provisioning.StatusCreated}
+			_, err := c.CreateUser(client.UserCreateRequest{
+				Username: e.Username,
+				Password: e.Password,
+				Role:     e.Role,
+				Email:    e.Email,
+			})
+			if err != nil {
+				result.Status = provisioning.StatusFailed
+				result.Error = err.Error()
+				failed++
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: %v\n", i+1, len(entries), e.Username, err)
+			} else {
+				fmt.Printf("[%d/%d] %s created\n", i+1, len(entries), e.Username)
+			}
+			results = append(results, result)
+		}
+
+		err = provisioning.WriteBundle(out, results, provisioning.BundleOptions{
+			ServerURL: serverURL,
+			QR:        withQR,
+			CreatedAt: time.Now(),
+		})
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing provisioning bundle: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\n%d of %d users created. Provisioning bundle: %s\n", len(entries)-failed, len(entries), output)
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d users failed; see credentials.csv in the bundle and re-import those rows.\n", failed)
+			os.Exit(1)
+		}
+	},
+}
+
 func init() {
 	// Attach user subcommands
 	createUserCmd.Flags().String("username", "", "Username for the new user")
 	createUserCmd.Flags().String("password", "", "Password for the new user")
 	createUserCmd.Flags().String("role", "read-only", "Role for the new user (read-only, read-write, admin)")
+	createUserCmd.Flags().String("email", "", "Email address for password reset (optional)")
 	createUserCmd.MarkFlagRequired("username")
 	createUserCmd.MarkFlagRequired("password")
 	createUserCmd.MarkFlagRequired("role")
@@ -132,17 +410,48 @@ func init() {
 	resetPasswordCmd.Flags().String("new-password", "", "New password for the user")
 	resetPasswordCmd.MarkFlagRequired("username")
 	resetPasswordCmd.MarkFlagRequired("new-password")
+	resetPasswordCmd.RegisterFlagCompletionFunc("username", completeUsernameFlag)
+
+	setEmailCmd.Flags().String("username", "", "Username of the user")
+	setEmailCmd.Flags().String("email", "", "Email address (empty to clear)")
+	setEmailCmd.MarkFlagRequired("username")
+	setEmailCmd.RegisterFlagCompletionFunc("username", completeUsernameFlag)
 
 	changePasswordCmd.Flags().String("old-password", "", "Current password")
 	changePasswordCmd.Flags().String("new-password", "", "New password")
 	changePasswordCmd.MarkFlagRequired("old-password")
 	changePasswordCmd.MarkFlagRequired("new-password")
 
+	inviteUserCmd.Flags().String("role", "read-write", "Role for the invited user (read-only, read-write, admin)")
+	inviteUserCmd.Flags().String("email", "", "Email address of the invitee (for reference)")
+	inviteUserCmd.Flags().Duration("expires", 0, "Invitation lifetime, e.g. 48h (defaults to the server setting)")
+
+	impersonateUserCmd.Flags().String("reason", "", "Why the user is impersonated, recorded in the audit trail")
+	impersonateUserCmd.MarkFlagRequired("reason")
+
+	listImpersonationsCmd.Flags().String("username", "", "Only entries of this impersonated user")
+	listImpersonationsCmd.Flags().Int("limit", 100, "Maximum number of entries (1-1000)")
+	listImpersonationsCmd.RegisterFlagCompletionFunc("username", completeUsernameFlag)
+
+	importUsersCmd.Flags().String("role", "read-write", "Role for rows without one (read-only, read-write, admin)")
+	importUsersCmd.Flags().StringP("output", "o", "users-provisioning.zip", "Provisioning zip to write; must not exist")
+	importUsersCmd.Flags().Bool("qr", false, "Include a Formulus QR code per user in the bundle and on the login cards")
+	importUsersCmd.Flags().String("server-url", "", "Server URL printed on the cards and encoded in QR codes (default: api.url from the config)")
+	importUsersCmd.Flags().Int("password-length", 12, "Length of generated passwords")
+	importUsersCmd.Flags().Bool("dry-run", false, "Validate the CSV and show the users without creating them")
+
 	userCmd.AddCommand(listUsersCmd)
 	userCmd.AddCommand(createUserCmd)
 	userCmd.AddCommand(deleteUserCmd)
 	userCmd.AddCommand(resetPasswordCmd)
+	userCmd.AddCommand(setEmailCmd)
 	userCmd.AddCommand(changePasswordCmd)
+	userCmd.AddCommand(inviteUserCmd)
+	userCmd.AddCommand(listInvitationsCmd)
+	userCmd.AddCommand(revokeInvitationCmd)
+	userCmd.AddCommand(importUsersCmd)
+	userCmd.AddCommand(impersonateUserCmd)
+	userCmd.AddCommand(listImpersonationsCmd)
 
 	rootCmd.AddCommand(userCmd)
 }
@@ -0,0 +1,101 @@
+package attachsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReportFileName is the file in the synced folder listing the downloads that failed in
+// the last run
+const ReportFileName = ".synk-attachments-failures.json"
+
+// validatorSuffix marks the resume validators kept next to partial downloads
+const validatorSuffix = ".part.validator"
+
+// DownloadJob is an attachment to download into the synced folder
+type DownloadJob struct {
+	AttachmentID string
+	// SHA256 is the hex hash from the manifest; empty when the server has none
+	SHA256 string
+	// Size is the size from the manifest; negative when unknown
+	Size int64
+}
+
+// DownloadFailure is a download that failed, as listed in the report
+type DownloadFailure struct {
+	AttachmentID   string `json:"attachment_id"`
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+	Error          string `json:"error"`
+}
+
+// Report summarizes the downloads of a sync run
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Attempted   int               `json:"attempted"`
+	Downloaded  int               `json:"downloaded"`
+	Failures    []DownloadFailure `json:"failures"`
+}
+
+// DownloadAll runs fetch for every job on up to workers goroutines. done is called for
+// each finished job one at a time, so it may update shared state without locking. It
+// returns the report of the run, with the failures sorted by attachment ID.
+func DownloadAll(jobs []DownloadJob, workers int, fetch func(DownloadJob) (LocalFile, error), done func(DownloadJob, LocalFile, error)) *Report {
+	if workers < 1 {
+		workers = 1
+	}
+	report := &Report{GeneratedAt: time.Now().UTC(), Attempted: len(jobs), Failures: []DownloadFailure{}}
+
+	queue := make(chan DownloadJob)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				file, err := fetch(job)
+
+				mu.Lock()
+				if err != nil {
+					report.Failures = append(report.Failures, DownloadFailure{AttachmentID: job.AttachmentID, ExpectedSHA256: job.SHA256, Error: err.Error()})
+				} else {
+					report.Downloaded++
+				}
+				if done != nil {
+					done(job, file, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Slice(report.Failures, func(i, j int) bool { return report.Failures[i].AttachmentID < report.Failures[j].AttachmentID })
+	return report
+}
+
+// Save writes the report to path
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode download report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write download report: %w", err)
+	}
+	return nil
+}
+
+// isPartial reports whether name is a partial download or its resume validator
+func isPartial(name string) bool {
+	return strings.HasSuffix(name, partialSuffix) || strings.HasSuffix(name, validatorSuffix)
+}
@@ -0,0 +1,66 @@
+package attachsync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadAll(t *testing.T) {
+	jobs := []DownloadJob{
+		{AttachmentID: "c.jpg", SHA256: "ccc"},
+		{AttachmentID: "a.jpg", SHA256: "aaa"},
+		{AttachmentID: "b.jpg", SHA256: "bbb"},
+		{AttachmentID: "d.jpg"},
+	}
+
+	var running, peak atomic.Int32
+	var finished []string
+	report := DownloadAll(jobs, 2, func(job DownloadJob) (LocalFile, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if job.AttachmentID == "b.jpg" || job.AttachmentID == "a.jpg" {
+			return LocalFile{}, errors.New("checksum mismatch")
+		}
+		return LocalFile{Size: 1, SHA256: job.SHA256}, nil
+	}, func(job DownloadJob, file LocalFile, err error) {
+		finished = append(finished, job.AttachmentID)
+	})
+
+	if peak.Load() != 2 {
+		t.Errorf("Expected 2 downloads at a time, got %d", peak.Load())
+	}
+	if len(finished) != 4 {
+		t.Errorf("Expected done for every job, got %v", finished)
+	}
+	if report.Attempted != 4 || report.Downloaded != 2 || len(report.Failures) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if report.Failures[0].AttachmentID != "a.jpg" || report.Failures[0].ExpectedSHA256 != "aaa" || report.Failures[1].AttachmentID != "b.jpg" {
+		t.Errorf("Expected the failures sorted by attachment ID, got %+v", report.Failures)
+	}
+
+	path := filepath.Join(t.TempDir(), ReportFileName)
+	if err := report.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Report
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Failures) != 2 || saved.Failures[0].Error != "checksum mismatch" {
+		t.Errorf("Unexpected saved report %s: %v", data, err)
+	}
+}
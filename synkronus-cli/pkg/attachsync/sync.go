@@ -0,0 +1,253 @@
+// Package attachsync compares a local attachment folder with the server's
+// attachment manifest and works out what to upload, download and delete.
+package attachsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StateFileName is the file in the synced folder that records sync progress
+const StateFileName = ".synk-attachments.json"
+
+// partialSuffix marks downloads in progress; such files are never uploaded
+const partialSuffix = ".part"
+
+// FileState records a file known to be in sync with the server
+type FileState struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// State is persisted in the synced folder between runs
+type State struct {
+	ClientID     string               `json:"client_id"`
+	SinceVersion int64                `json:"since_version"`
+	Files        map[string]FileState `json:"files"`
+}
+
+// LocalFile describes a file in the synced folder
+type LocalFile struct {
+	Size   int64
+	SHA256 string
+}
+
+// Operation is an entry from the server's attachment manifest
+type Operation struct {
+	Operation    string // "download" or "delete"
+	AttachmentID string
+	Hash         string // hex SHA-256, when the server provides it
+}
+
+// Plan lists the actions needed to bring the folder and the server in sync
+type Plan struct {
+	// Downloads are attachments on the server that are missing locally
+	Downloads []string
+	// Copies are attachments missing locally whose content is already in the folder
+	// under another name; they map the attachment ID to that file
+	Copies map[string]string
+	// Deletes are local files deleted on the server
+	Deletes []string
+	// UploadCandidates are local files the manifest doesn't mention; they are
+	// uploaded unless the server already has them
+	UploadCandidates []string
+	// Synced are files whose content is known to match the server
+	Synced map[string]FileState
+	// Conflicts are files whose local content differs from the server's
+	Conflicts []string
+}
+
+// LoadState reads the sync state from dir; a missing file yields an empty state
+func LoadState(dir string) (*State, error) {
+	state := &State{Files: make(map[string]FileState)}
+
+	data, err := os.ReadFile(filepath.Join(dir, StateFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid sync state %s: %w", StateFileName, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]FileState)
+	}
+	return state, nil
+}
+
+// Save writes the sync state to dir
+func (s *State) Save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+
+	tmp := filepath.Join(dir, StateFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, StateFileName)); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
+
+// ScanDir hashes the regular files at the top level of dir. Hidden files, partial
+// downloads and their resume validators are skipped.
+func ScanDir(dir string) (map[string]LocalFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	files := make(map[string]LocalFile)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || isPartial(name) {
+			continue
+		}
+
+		file, err := HashFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = file
+	}
+	return files, nil
+}
+
+// HashFile returns the size and SHA-256 of a file
+func HashFile(path string) (LocalFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return LocalFile{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return LocalFile{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return LocalFile{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// KnownHashes returns the distinct hashes of the local files, sorted, for the server to
+// mark downloads of content the folder already holds as skippable
+func KnownHashes(local map[string]LocalFile) []string {
+	seen := make(map[string]bool, len(local))
+	hashes := make([]string, 0, len(local))
+	for _, file := range local {
+		if !seen[file.SHA256] {
+			seen[file.SHA256] = true
+			hashes = append(hashes, file.SHA256)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// CopyFile copies the file at source to attachmentID in dir, through its partial path so
+// an interrupted copy is never taken for a complete file
+func CopyFile(source, dir, attachmentID string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	partial := PartialPath(dir, attachmentID)
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, filepath.Join(dir, attachmentID))
+}
+
+// PartialPath returns the temporary path used while downloading attachmentID into dir
+func PartialPath(dir, attachmentID string) string {
+	return filepath.Join(dir, "."+attachmentID+partialSuffix)
+}
+
+// BuildPlan compares the local files with the manifest operations received since
+// state.SinceVersion. Attachments are immutable on the server, so a local file
+// that differs from the server's copy is reported as a conflict and left alone.
+func BuildPlan(local map[string]LocalFile, operations []Operation, state *State) Plan {
+	plan := Plan{Synced: make(map[string]FileState), Copies: make(map[string]string)}
+
+	byHash := make(map[string]string, len(local))
+	for id, file := range local {
+		if existing, ok := byHash[file.SHA256]; !ok || id < existing {
+			byHash[file.SHA256] = id
+		}
+	}
+
+	// Carry over files from previous runs that are still present and unchanged
+	for id, known := range state.Files {
+		if file, ok := local[id]; ok && file.SHA256 == known.SHA256 {
+			plan.Synced[id] = known
+		}
+	}
+
+	mentioned := make(map[string]bool)
+	for _, op := range operations {
+		mentioned[op.AttachmentID] = true
+		file, exists := local[op.AttachmentID]
+
+		switch op.Operation {
+		case "delete":
+			delete(plan.Synced, op.AttachmentID)
+			if exists {
+				plan.Deletes = append(plan.Deletes, op.AttachmentID)
+			}
+		case "download":
+			switch {
+			case !exists && op.Hash != "" && byHash[op.Hash] != "":
+				plan.Copies[op.AttachmentID] = byHash[op.Hash]
+			case !exists:
+				plan.Downloads = append(plan.Downloads, op.AttachmentID)
+			case op.Hash != "" && op.Hash != file.SHA256:
+				plan.Conflicts = append(plan.Conflicts, op.AttachmentID)
+			default:
+				plan.Synced[op.AttachmentID] = FileState{Size: file.Size, SHA256: file.SHA256}
+			}
+		}
+	}
+
+	for id, file := range local {
+		if mentioned[id] {
+			continue
+		}
+		known, wasSynced := state.Files[id]
+		switch {
+		case !wasSynced:
+			plan.UploadCandidates = append(plan.UploadCandidates, id)
+		case known.SHA256 != file.SHA256:
+			plan.Conflicts = append(plan.Conflicts, id)
+		}
+	}
+
+	sort.Strings(plan.Downloads)
+	sort.Strings(plan.Deletes)
+	sort.Strings(plan.UploadCandidates)
+	sort.Strings(plan.Conflicts)
+	return plan
+}
@@ -0,0 +1,138 @@
+package attachsync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	local := map[string]LocalFile{
+		"photo1.jpg":   {Size: 10, SHA256: "aaa"}, // already synced, unchanged
+		"photo2.jpg":   {Size: 20, SHA256: "bbb"}, // deleted on server
+		"photo3.jpg":   {Size: 30, SHA256: "ccc"}, // new locally
+		"photo4.jpg":   {Size: 40, SHA256: "ddd"}, // edited since last sync
+		"photo5.jpg":   {Size: 50, SHA256: "eee"}, // on server with the same hash
+		"photo6.jpg":   {Size: 60, SHA256: "fff"}, // on server with a different hash
+		"audio1.m4a":   {Size: 70, SHA256: "ggg"}, // on server, no hash provided
+		"collected.db": {Size: 80, SHA256: "hhh"}, // new locally
+		"backup.jpg":   {Size: 90, SHA256: "jjj"}, // new locally, restored copy of restored.jpg
+	}
+	state := &State{
+		SinceVersion: 5,
+		Files: map[string]FileState{
+			"photo1.jpg": {Size: 10, SHA256: "aaa"},
+			"photo2.jpg": {Size: 20, SHA256: "bbb"},
+			"photo4.jpg": {Size: 40, SHA256: "old"},
+			"gone.jpg":   {Size: 90, SHA256: "iii"},
+		},
+	}
+	operations := []Operation{
+		{Operation: "delete", AttachmentID: "photo2.jpg"},
+		{Operation: "download", AttachmentID: "photo5.jpg", Hash: "eee"},
+		{Operation: "download", AttachmentID: "photo6.jpg", Hash: "zzz"},
+		{Operation: "download", AttachmentID: "audio1.m4a"},
+		{Operation: "download", AttachmentID: "new.jpg"},
+		{Operation: "download", AttachmentID: "restored.jpg", Hash: "jjj"},
+		{Operation: "delete", AttachmentID: "never-had.jpg"},
+	}
+
+	plan := BuildPlan(local, operations, state)
+
+	if want := []string{"new.jpg"}; !reflect.DeepEqual(plan.Downloads, want) {
+		t.Errorf("Downloads = %v, want %v", plan.Downloads, want)
+	}
+	if want := []string{"photo2.jpg"}; !reflect.DeepEqual(plan.Deletes, want) {
+		t.Errorf("Deletes = %v, want %v", plan.Deletes, want)
+	}
+	if want := map[string]string{"restored.jpg": "backup.jpg"}; !reflect.DeepEqual(plan.Copies, want) {
+		t.Errorf("Copies = %v, want %v", plan.Copies, want)
+	}
+	if want := []string{"backup.jpg", "collected.db", "photo3.jpg"}; !reflect.DeepEqual(plan.UploadCandidates, want) {
+		t.Errorf("UploadCandidates = %v, want %v", plan.UploadCandidates, want)
+	}
+	if want := []string{"photo4.jpg", "photo6.jpg"}; !reflect.DeepEqual(plan.Conflicts, want) {
+		t.Errorf("Conflicts = %v, want %v", plan.Conflicts, want)
+	}
+
+	synced := make([]string, 0, len(plan.Synced))
+	for id := range plan.Synced {
+		synced = append(synced, id)
+	}
+	for _, id := range []string{"photo1.jpg", "photo5.jpg", "audio1.m4a"} {
+		if _, ok := plan.Synced[id]; !ok {
+			t.Errorf("Expected %s to be synced, got %v", id, synced)
+		}
+	}
+	for _, id := range []string{"photo2.jpg", "gone.jpg", "photo4.jpg"} {
+		if _, ok := plan.Synced[id]; ok {
+			t.Errorf("Expected %s not to be synced", id)
+		}
+	}
+}
+
+func TestStateRoundTripAndScan(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := LoadState(dir)
+	if err != nil {
+		t.Fatalf("LoadState on empty dir: %v", err)
+	}
+	if state.SinceVersion != 0 || len(state.Files) != 0 {
+		t.Fatalf("Expected empty state, got %+v", state)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PartialPath(dir, "b.jpg"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A download interrupted on the way, kept for resuming
+	for _, name := range []string{"d.jpg.part", "d.jpg.part.validator"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	state.ClientID = "office-pc"
+	state.SinceVersion = 42
+	state.Files["a.jpg"] = FileState{Size: 5, SHA256: "x"}
+	if err := state.Save(dir); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	files, err := ScanDir(dir)
+	if err != nil {
+		t.Fatalf("ScanDir: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected only a.jpg to be scanned, got %v", files)
+	}
+	// sha256("hello")
+	if got := files["a.jpg"].SHA256; got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Unexpected hash %s", got)
+	}
+
+	if err := CopyFile(filepath.Join(dir, "a.jpg"), dir, "c.jpg"); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "c.jpg")); err != nil || string(data) != "hello" {
+		t.Errorf("Expected c.jpg to hold the content of a.jpg, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(PartialPath(dir, "c.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Expected no partial file after the copy, got %v", err)
+	}
+
+	loaded, err := LoadState(dir)
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("Loaded state %+v, want %+v", loaded, state)
+	}
+}
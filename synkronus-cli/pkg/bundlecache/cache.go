@@ -0,0 +1,257 @@
+// Package bundlecache keeps the last-synced app bundle manifests, version list and
+// APP_INFO.json files on disk so bundle commands can run without a connection.
+package bundlecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+)
+
+// ErrNotCached is returned when the requested data has not been cached yet
+var ErrNotCached = errors.New("not in the offline cache (run 'synk bundle cache refresh' while online)")
+
+// unsafeKeyChars are replaced when turning a server URL into a directory name
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Meta records where the cache came from and when it was last refreshed
+type Meta struct {
+	Server        string    `json:"server"`
+	RefreshedAt   time.Time `json:"refreshed_at"`
+	ActiveVersion string    `json:"active_version"`
+}
+
+// Cache is the offline copy of one server's app bundle metadata. Layout:
+//
+//	meta.json                 Meta
+//	versions.json             the version list
+//	manifests/<version>.json  manifests, one per version seen
+//	app-info/<version>.json   APP_INFO.json, one per version seen
+type Cache struct {
+	dir    string
+	server string
+}
+
+// DefaultDir returns the per-user cache directory for the CLI
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "synkronus"), nil
+}
+
+// Open returns the cache for the server at apiURL below root. Each server gets its
+// own directory so switching configs never mixes bundles. Nothing is created until
+// the first write.
+func Open(root, apiURL string) *Cache {
+	return &Cache{dir: filepath.Join(root, serverKey(apiURL)), server: apiURL}
+}
+
+// Dir returns the directory holding this server's cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// SaveManifest caches a manifest under its version
+func (c *Cache) SaveManifest(manifest map[string]interface{}) error {
+	version, _ := manifest["version"].(string)
+	if version == "" {
+		return fmt.Errorf("manifest has no version")
+	}
+	return c.writeJSON(filepath.Join("manifests", versionFile(version)), manifest)
+}
+
+// LoadManifest returns the cached manifest of a version
+func (c *Cache) LoadManifest(version string) (map[string]interface{}, error) {
+	var manifest map[string]interface{}
+	if err := c.readJSON(filepath.Join("manifests", versionFile(version)), &manifest); err != nil {
+		return nil, fmt.Errorf("manifest of version %s: %w", version, err)
+	}
+	return manifest, nil
+}
+
+// SaveVersions caches the server's version list
+func (c *Cache) SaveVersions(list *client.AppBundleVersionList) error {
+	return c.writeJSON("versions.json", list)
+}
+
+// LoadVersions returns the cached version list
+func (c *Cache) LoadVersions() (*client.AppBundleVersionList, error) {
+	var list client.AppBundleVersionList
+	if err := c.readJSON("versions.json", &list); err != nil {
+		return nil, fmt.Errorf("version list: %w", err)
+	}
+	return &list, nil
+}
+
+// SaveAppInfo caches the APP_INFO.json of a version
+func (c *Cache) SaveAppInfo(info *client.AppInfo) error {
+	if info.Version == "" {
+		return fmt.Errorf("APP_INFO.json has no version")
+	}
+	return c.writeJSON(filepath.Join("app-info", versionFile(info.Version)), info)
+}
+
+// LoadAppInfo returns the cached APP_INFO.json of a version
+func (c *Cache) LoadAppInfo(version string) (*client.AppInfo, error) {
+	var info client.AppInfo
+	if err := c.readJSON(filepath.Join("app-info", versionFile(version)), &info); err != nil {
+		return nil, fmt.Errorf("APP_INFO.json of version %s: %w", version, err)
+	}
+	return &info, nil
+}
+
+// MarkRefreshed records a completed refresh and the version that was active
+func (c *Cache) MarkRefreshed(activeVersion string, at time.Time) error {
+	return c.writeJSON("meta.json", Meta{Server: c.server, RefreshedAt: at.UTC(), ActiveVersion: activeVersion})
+}
+
+// Meta returns the state recorded by the last refresh
+func (c *Cache) Meta() (*Meta, error) {
+	var meta Meta
+	if err := c.readJSON("meta.json", &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// ActiveManifest returns the manifest of the version that was active at the last refresh
+func (c *Cache) ActiveManifest() (map[string]interface{}, *Meta, error) {
+	meta, err := c.Meta()
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, err := c.LoadManifest(meta.ActiveVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, meta, nil
+}
+
+// Clear removes everything cached for this server
+func (c *Cache) Clear() error {
+	return os.RemoveAll(c.dir)
+}
+
+// DiffManifests compares the files of two manifests by path and hash
+func DiffManifests(current, target map[string]interface{}) *client.AppBundleChanges {
+	currentFiles := manifestFiles(current)
+	targetFiles := manifestFiles(target)
+
+	changes := &client.AppBundleChanges{
+		Added:    []map[string]any{},
+		Modified: []map[string]any{},
+		Removed:  []map[string]any{},
+	}
+	changes.CurrentVersion, _ = current["version"].(string)
+	changes.TargetVersion, _ = target["version"].(string)
+
+	for _, path := range sortedPaths(targetFiles) {
+		file := targetFiles[path]
+		previous, ok := currentFiles[path]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, file)
+		case previous["hash"] != file["hash"]:
+			changes.Modified = append(changes.Modified, file)
+		}
+	}
+	for _, path := range sortedPaths(currentFiles) {
+		if _, ok := targetFiles[path]; !ok {
+			changes.Removed = append(changes.Removed, currentFiles[path])
+		}
+	}
+	return changes
+}
+
+// manifestFiles indexes the files of a manifest by path
+func manifestFiles(manifest map[string]interface{}) map[string]map[string]any {
+	files := make(map[string]map[string]any)
+	list, _ := manifest["files"].([]interface{})
+	for _, entry := range list {
+		file, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if path, ok := file["path"].(string); ok {
+			files[path] = file
+		}
+	}
+	return files
+}
+
+// sortedPaths returns the keys of files in order
+func sortedPaths(files map[string]map[string]any) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// serverKey turns an API URL into a directory name, e.g. synk.example.org_8443
+func serverKey(apiURL string) string {
+	key := apiURL
+	if u, err := url.Parse(apiURL); err == nil && u.Host != "" {
+		key = u.Host + u.Path
+	}
+	key = unsafeKeyChars.ReplaceAllString(key, "_")
+	if key == "" || key == "." || key == ".." {
+		return "default"
+	}
+	return key
+}
+
+// versionFile returns the file name a version is cached under
+func versionFile(version string) string {
+	return unsafeKeyChars.ReplaceAllString(version, "_") + ".json"
+}
+
+// writeJSON writes v below the cache directory, replacing the file atomically so an
+// interrupted refresh never leaves a truncated cache behind
+func (c *Cache) writeJSON(name string, v interface{}) error {
+	path := filepath.Join(c.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// readJSON reads a cache file, reporting ErrNotCached when it doesn't exist
+func (c *Cache) readJSON(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotCached
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cache file: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("corrupt cache file %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package bundlecache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+)
+
+func manifest(version string, files ...string) map[string]interface{} {
+	list := []interface{}{}
+	for i := 0; i+1 < len(files); i += 2 {
+		list = append(list, map[string]interface{}{"path": files[i], "hash": files[i+1]})
+	}
+	return map[string]interface{}{"version": version, "files": list}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	cache := Open(root, "https://synk.example.org:8443/")
+
+	if _, _, err := cache.ActiveManifest(); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected ErrNotCached from an empty cache, got %v", err)
+	}
+
+	if err := cache.SaveManifest(manifest("0002", "index.html", "a")); err != nil {
+		t.Fatalf("SaveManifest: %v", err)
+	}
+	if err := cache.SaveVersions(&client.AppBundleVersionList{Details: []client.AppBundleVersion{{Version: "0002", Active: true}, {Version: "0001"}}}); err != nil {
+		t.Fatalf("SaveVersions: %v", err)
+	}
+	if err := cache.SaveAppInfo(&client.AppInfo{Version: "0002", Forms: map[string]client.FormInfo{"household": {FormHash: "f"}}}); err != nil {
+		t.Fatalf("SaveAppInfo: %v", err)
+	}
+	if err := cache.MarkRefreshed("0002", time.Now()); err != nil {
+		t.Fatalf("MarkRefreshed: %v", err)
+	}
+
+	// A fresh handle on the same server reads everything back
+	cache = Open(root, "https://synk.example.org:8443/")
+	active, meta, err := cache.ActiveManifest()
+	if err != nil {
+		t.Fatalf("ActiveManifest: %v", err)
+	}
+	if active["version"] != "0002" || meta.Server != "https://synk.example.org:8443/" {
+		t.Errorf("Unexpected active manifest %v / meta %+v", active, meta)
+	}
+	info, err := cache.LoadAppInfo("0002")
+	if err != nil || info.Forms["household"].FormHash != "f" {
+		t.Errorf("Unexpected APP_INFO.json %+v (%v)", info, err)
+	}
+	list, err := cache.LoadVersions()
+	if err != nil || len(list.Details) != 2 {
+		t.Errorf("Unexpected version list %+v (%v)", list, err)
+	}
+
+	// Other servers don't see this cache
+	if _, err := Open(root, "http://localhost:8080").Meta(); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected caches to be separated per server, got %v", err)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if _, err := cache.LoadManifest("0002"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached after Clear, got %v", err)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	current := manifest("0001", "index.html", "a", "forms/a/schema.json", "b", "old.js", "c")
+	target := manifest("0002", "index.html", "a", "forms/a/schema.json", "B", "new.js", "d")
+
+	changes := DiffManifests(current, target)
+	if changes.CurrentVersion != "0001" || changes.TargetVersion != "0002" {
+		t.Errorf("Unexpected versions %s -> %s", changes.CurrentVersion, changes.TargetVersion)
+	}
+	if len(changes.Added) != 1 || changes.Added[0]["path"] != "new.js" {
+		t.Errorf("Unexpected added files %v", changes.Added)
+	}
+	if len(changes.Modified) != 1 || changes.Modified[0]["path"] != "forms/a/schema.json" {
+		t.Errorf("Unexpected modified files %v", changes.Modified)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0]["path"] != "old.js" {
+		t.Errorf("Unexpected removed files %v", changes.Removed)
+	}
+}
@@ -0,0 +1,421 @@
+// Package bundleforms splits app bundles into per-form repositories and merges forms
+// from several sources back into one deployable bundle, carrying along the renderers
+// and extension modules each form depends on.
+package bundleforms
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/validation"
+)
+
+// rootExtension is the bundle-wide extension file shared by all forms
+const rootExtension = "forms/ext.json"
+
+// rendererKeys are the schema and UI schema keys whose values name a renderer
+var rendererKeys = []string{"x-renderer", "rendererType", "x-question-type", "format"}
+
+// Source is an app bundle ZIP or a form repository directory, held in memory. File
+// paths are slash-separated and relative to the bundle root.
+type Source struct {
+	Path  string
+	Files map[string][]byte
+}
+
+// Dependencies are what a form needs from its bundle besides its own directory
+type Dependencies struct {
+	// Renderers are the renderers/<name> directories the form references
+	Renderers []string
+	// Extensions are the forms/ext.json renderers whose format the form uses
+	Extensions []string
+	// Modules are the bundle files that the form's extensions load
+	Modules []string
+}
+
+// Load reads a bundle ZIP or a directory laid out like a bundle. Hidden files and
+// directories (such as .git) are skipped.
+func Load(sourcePath string) (*Source, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	src := &Source{Path: sourcePath, Files: make(map[string][]byte)}
+	if info.IsDir() {
+		err = src.loadDir()
+	} else {
+		err = src.loadZip()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sourcePath, err)
+	}
+	return src, nil
+}
+
+func (s *Source) loadDir() error {
+	return filepath.WalkDir(s.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != s.Path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Path, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		s.Files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+}
+
+func (s *Source) loadZip() error {
+	reader, err := zip.OpenReader(s.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+		s.Files[file.Name] = data
+	}
+	return nil
+}
+
+// Forms returns the names of the forms in the source, sorted
+func (s *Source) Forms() []string {
+	var forms []string
+	for name := range s.Files {
+		parts := strings.Split(name, "/")
+		if len(parts) == 3 && parts[0] == "forms" && parts[2] == "schema.json" {
+			forms = append(forms, parts[1])
+		}
+	}
+	sort.Strings(forms)
+	return forms
+}
+
+// HasForm reports whether the source contains the form
+func (s *Source) HasForm(form string) bool {
+	_, ok := s.Files["forms/"+form+"/schema.json"]
+	return ok
+}
+
+// Dependencies resolves the renderers, extension renderers and extension modules the
+// form uses. Built-in renderers and known formats need nothing from the bundle and
+// are not listed.
+func (s *Source) Dependencies(form string) (*Dependencies, error) {
+	if !s.HasForm(form) {
+		return nil, fmt.Errorf("form '%s' not found in %s", form, s.Path)
+	}
+
+	names := make(map[string]bool)
+	for _, file := range []string{"schema.json", "ui.json"} {
+		data, ok := s.Files["forms/"+form+"/"+file]
+		if !ok {
+			continue
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON in forms/%s/%s: %w", form, file, err)
+		}
+		collectRendererNames(doc, names)
+	}
+
+	root, err := s.extension(rootExtension)
+	if err != nil {
+		return nil, err
+	}
+	rootFormats := make(map[string]string)
+	if root != nil {
+		for key, data := range root.Renderers {
+			rootFormats[rendererFormat(key, data)] = key
+		}
+	}
+
+	deps := &Dependencies{}
+	modules := make(map[string]bool)
+	for name := range names {
+		if _, ok := s.Files["renderers/"+name+"/renderer.jsx"]; ok {
+			deps.Renderers = append(deps.Renderers, name)
+		} else if key, ok := rootFormats[name]; ok {
+			deps.Extensions = append(deps.Extensions, key)
+			for _, module := range rendererModules(root.Renderers[key]) {
+				modules[module] = true
+			}
+		}
+	}
+
+	// Functions can't be traced to the forms that call them, so every form depends on
+	// all functions of the shared extension file. A form's own ext.json goes with it.
+	if root != nil {
+		for _, module := range functionModules(root.Functions) {
+			modules[module] = true
+		}
+	}
+	formExt, err := s.extension("forms/" + form + "/ext.json")
+	if err != nil {
+		return nil, err
+	}
+	if formExt != nil {
+		for _, data := range formExt.Renderers {
+			for _, module := range rendererModules(data) {
+				modules[module] = true
+			}
+		}
+		for _, module := range functionModules(formExt.Functions) {
+			modules[module] = true
+		}
+	}
+
+	for module := range modules {
+		if file, ok := s.resolveModule(module); ok && !strings.HasPrefix(file, "forms/"+form+"/") {
+			deps.Modules = append(deps.Modules, file)
+		}
+	}
+
+	sort.Strings(deps.Renderers)
+	sort.Strings(deps.Extensions)
+	sort.Strings(deps.Modules)
+	return deps, nil
+}
+
+// Extract returns the files of a standalone repository for the form: its directory,
+// the renderers and modules it depends on and, when it uses any, a forms/ext.json
+// reduced to the extension renderers it needs
+func (s *Source) Extract(form string) (map[string][]byte, *Dependencies, error) {
+	deps, err := s.Dependencies(form)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefixes := []string{"forms/" + form + "/"}
+	for _, renderer := range deps.Renderers {
+		prefixes = append(prefixes, "renderers/"+renderer+"/")
+	}
+	files := make(map[string][]byte)
+	for _, prefix := range prefixes {
+		for name, data := range s.Files {
+			if strings.HasPrefix(name, prefix) {
+				files[name] = data
+			}
+		}
+	}
+	for _, module := range deps.Modules {
+		files[module] = s.Files[module]
+	}
+
+	ext, err := s.reducedExtension(deps)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ext != nil {
+		data, err := json.MarshalIndent(ext, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		files[rootExtension] = append(data, '\n')
+	}
+	return files, deps, nil
+}
+
+// reducedExtension returns the source's forms/ext.json with only the extension
+// renderers in deps, or nil when there is nothing left to keep
+func (s *Source) reducedExtension(deps *Dependencies) (*validation.ExtensionDefinition, error) {
+	root, err := s.extension(rootExtension)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	reduced := *root
+	reduced.Renderers = nil
+	for _, key := range deps.Extensions {
+		if reduced.Renderers == nil {
+			reduced.Renderers = make(map[string]interface{})
+		}
+		reduced.Renderers[key] = root.Renderers[key]
+	}
+	if reduced.Renderers == nil && len(reduced.Functions) == 0 && len(reduced.Schemas) == 0 && len(reduced.Definitions) == 0 {
+		return nil, nil
+	}
+	return &reduced, nil
+}
+
+// extension parses an ext.json file of the source; a missing file returns nil
+func (s *Source) extension(name string) (*validation.ExtensionDefinition, error) {
+	data, ok := s.Files[name]
+	if !ok {
+		return nil, nil
+	}
+	var ext validation.ExtensionDefinition
+	if err := json.Unmarshal(data, &ext); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", validation.ErrInvalidExtension, name, err)
+	}
+	return &ext, nil
+}
+
+// resolveModule finds the bundle file of an extension module path, looking in the
+// same places as bundle validation
+func (s *Source) resolveModule(module string) (string, bool) {
+	normalized := strings.TrimPrefix(module, "/")
+	for _, candidate := range []string{module, normalized, "forms/" + normalized, "app/" + normalized} {
+		if _, ok := s.Files[candidate]; ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// collectRendererNames gathers the string values of renderer keys anywhere in doc
+func collectRendererNames(doc interface{}, names map[string]bool) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for _, key := range rendererKeys {
+			if name, ok := v[key].(string); ok && name != "" {
+				names[name] = true
+			}
+		}
+		for _, value := range v {
+			collectRendererNames(value, names)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectRendererNames(item, names)
+		}
+	}
+}
+
+// decodeRenderer converts an ext.json renderer entry to its typed form
+func decodeRenderer(data interface{}) validation.ExtensionRenderer {
+	var renderer validation.ExtensionRenderer
+	raw, err := json.Marshal(data)
+	if err == nil {
+		_ = json.Unmarshal(raw, &renderer)
+	}
+	return renderer
+}
+
+// rendererFormat is the format an ext.json renderer handles: its key, or the legacy
+// format field when set
+func rendererFormat(key string, data interface{}) string {
+	if renderer := decodeRenderer(data); renderer.Format != "" {
+		return renderer.Format
+	}
+	return key
+}
+
+// rendererModules lists the module paths an ext.json renderer loads
+func rendererModules(data interface{}) []string {
+	renderer := decodeRenderer(data)
+	var modules []string
+	if renderer.Renderer != nil && renderer.Renderer.Path != "" {
+		modules = append(modules, renderer.Renderer.Path)
+	}
+	if renderer.Tester != nil && renderer.Tester.Path != "" {
+		modules = append(modules, renderer.Tester.Path)
+	}
+	if renderer.Module != "" {
+		modules = append(modules, renderer.Module)
+	}
+	return modules
+}
+
+// functionModules lists the module paths of ext.json functions
+func functionModules(functions map[string]interface{}) []string {
+	var modules []string
+	for _, data := range functions {
+		fn, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if p, ok := fn["path"].(string); ok && p != "" {
+			modules = append(modules, p)
+		} else if m, ok := fn["module"].(string); ok && m != "" {
+			modules = append(modules, m)
+		}
+	}
+	return modules
+}
+
+// WriteDir writes files below dir, creating directories as needed
+func WriteDir(dir string, files map[string][]byte) error {
+	for _, name := range sortedNames(files) {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("refusing to write %s outside %s", name, dir)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipEpoch is the modification time of every ZIP entry, so merging the same sources
+// twice produces the same bundle
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// WriteZip writes files to a bundle ZIP in sorted order
+func WriteZip(zipPath string, files map[string][]byte) error {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		if !filepath.IsLocal(filepath.FromSlash(name)) || path.Clean(name) != name {
+			return fmt.Errorf("invalid bundle path %s", name)
+		}
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: zipEpoch})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(zipPath, buf.Bytes(), 0644)
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,149 @@
+package bundleforms
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/validation"
+)
+
+const testSchema = `{"type":"object","properties":{"name":{"type":"string"}}}`
+
+func testBundle(path string) *Source {
+	return &Source{Path: path, Files: map[string][]byte{
+		"app/index.html":                []byte("<html></html>"),
+		"forms/household/schema.json":   []byte(`{"type":"object","properties":{"name":{"type":"string","x-renderer":"fancy"},"phone":{"type":"string","format":"phone"}}}`),
+		"forms/household/ui.json":       []byte(`{"type":"VerticalLayout","elements":[{"type":"Control","scope":"#/properties/name"},{"type":"Control","scope":"#/properties/phone"}]}`),
+		"forms/survey/schema.json":      []byte(testSchema),
+		"forms/survey/ui.json":          []byte(`{"type":"VerticalLayout","elements":[{"type":"Control","scope":"#/properties/name"}]}`),
+		"renderers/fancy/renderer.jsx":  []byte("export default function Fancy() {}"),
+		"renderers/unused/renderer.jsx": []byte("export default function Unused() {}"),
+		"forms/ext.json":                []byte(`{"version":"1","renderers":{"phone":{"renderer":{"path":"/ext/phone.js","export":"Phone"}},"map":{"renderer":{"path":"/ext/map.js","export":"Map"}}}}`),
+		"app/ext/phone.js":              []byte("export const Phone = () => null"),
+		"app/ext/map.js":                []byte("export const Map = () => null"),
+	}}
+}
+
+func TestDependencies(t *testing.T) {
+	src := testBundle("bundle.zip")
+
+	deps, err := src.Dependencies("household")
+	if err != nil {
+		t.Fatalf("Dependencies: %v", err)
+	}
+	want := &Dependencies{Renderers: []string{"fancy"}, Extensions: []string{"phone"}, Modules: []string{"app/ext/phone.js"}}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("Expected %+v, got %+v", want, deps)
+	}
+
+	deps, err = src.Dependencies("survey")
+	if err != nil || len(deps.Renderers)+len(deps.Extensions)+len(deps.Modules) != 0 {
+		t.Errorf("Expected survey to have no dependencies, got %+v (%v)", deps, err)
+	}
+
+	if _, err := src.Dependencies("missing"); err == nil {
+		t.Error("Expected an error for a form that isn't in the bundle")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	files, _, err := testBundle("bundle.zip").Extract("household")
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	want := []string{"app/ext/phone.js", "forms/ext.json", "forms/household/schema.json", "forms/household/ui.json", "renderers/fancy/renderer.jsx"}
+	if got := sortedNames(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected files %v, got %v", want, got)
+	}
+
+	var ext validation.ExtensionDefinition
+	if err := json.Unmarshal(files["forms/ext.json"], &ext); err != nil {
+		t.Fatalf("Invalid forms/ext.json: %v", err)
+	}
+	if _, ok := ext.Renderers["map"]; ok || ext.Renderers["phone"] == nil || ext.Version != "1" {
+		t.Errorf("Expected ext.json reduced to the phone renderer, got %+v", ext)
+	}
+}
+
+func TestMergeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := testBundle("bundle.zip")
+
+	// Split the bundle into one repository per form, then merge them back
+	var sources []*Source
+	for _, form := range src.Forms() {
+		files, _, err := src.Extract(form)
+		if err != nil {
+			t.Fatalf("Extract %s: %v", form, err)
+		}
+		if err := WriteDir(filepath.Join(dir, form), files); err != nil {
+			t.Fatalf("WriteDir: %v", err)
+		}
+		repo, err := Load(filepath.Join(dir, form))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		sources = append(sources, repo)
+	}
+
+	result, err := Merge(sources, MergeOptions{App: src})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if len(result.Forms) != 2 || result.App != "bundle.zip" {
+		t.Errorf("Unexpected merge result %+v", result)
+	}
+	if _, ok := result.Files["renderers/unused/renderer.jsx"]; ok {
+		t.Error("Expected renderers no form uses to be left out")
+	}
+
+	bundlePath := filepath.Join(dir, "merged.zip")
+	if err := WriteZip(bundlePath, result.Files); err != nil {
+		t.Fatalf("WriteZip: %v", err)
+	}
+	if err := validation.ValidateBundle(bundlePath); err != nil {
+		t.Errorf("Expected the merged bundle to validate, got %v", err)
+	}
+	merged, err := Load(bundlePath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(merged.Forms(), []string{"household", "survey"}) {
+		t.Errorf("Unexpected forms %v", merged.Forms())
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	a := testBundle("a.zip")
+	b := testBundle("b.zip")
+
+	// Identical copies of a form merge cleanly
+	if _, err := Merge([]*Source{a, b}, MergeOptions{Forms: []string{"survey"}}); err != nil {
+		t.Errorf("Expected identical forms to merge, got %v", err)
+	}
+
+	b.Files["forms/survey/ui.json"] = []byte(`{"type":"VerticalLayout","elements":[]}`)
+	_, err := Merge([]*Source{a, b}, MergeOptions{Forms: []string{"survey"}})
+	if err == nil || !strings.Contains(err.Error(), "forms/survey/ui.json differs between a.zip and b.zip") {
+		t.Errorf("Expected a conflict on the survey UI schema, got %v", err)
+	}
+
+	b.Files["forms/ext.json"] = []byte(`{"renderers":{"phone":{"renderer":{"path":"/ext/phone.js","export":"PhoneV2"}}}}`)
+	_, err = Merge([]*Source{a, b}, MergeOptions{Forms: []string{"household"}})
+	if err == nil || !strings.Contains(err.Error(), "renderers.phone differs") {
+		t.Errorf("Expected a conflict on the phone extension renderer, got %v", err)
+	}
+
+	if _, err := Merge([]*Source{a}, MergeOptions{Forms: []string{"missing"}}); err == nil {
+		t.Error("Expected an error for a form that isn't in any source")
+	}
+
+	delete(a.Files, "app/index.html")
+	if _, err := Merge([]*Source{a}, MergeOptions{}); err == nil {
+		t.Error("Expected an error when no source has an app")
+	}
+}
@@ -0,0 +1,197 @@
+package bundleforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/validation"
+)
+
+// MergeOptions selects what goes into a merged bundle
+type MergeOptions struct {
+	// Forms are the forms to include; empty includes every form of every source
+	Forms []string
+	// App is the source whose app/ directory is used; nil uses the first source that
+	// has app/index.html
+	App *Source
+}
+
+// MergedForm records where a form of a merged bundle came from
+type MergedForm struct {
+	Name         string
+	Source       string
+	Dependencies *Dependencies
+}
+
+// MergeResult is a merged bundle
+type MergeResult struct {
+	Files map[string][]byte
+	Forms []MergedForm
+	App   string
+}
+
+// merger accumulates files and remembers which source wrote each one, so two sources
+// disagreeing about a file is reported instead of silently resolved
+type merger struct {
+	files     map[string][]byte
+	origins   map[string]string
+	extension *validation.ExtensionDefinition
+	extOrigin map[string]string
+}
+
+// Merge combines the selected forms of several sources, with their renderers and
+// extensions, and an app/ directory into one bundle. A form found in more than one
+// source is taken from all of them, so the copies must be identical; the same holds
+// for renderers, modules and ext.json entries shared between sources.
+func Merge(sources []*Source, opts MergeOptions) (*MergeResult, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources to merge")
+	}
+
+	forms := opts.Forms
+	if len(forms) == 0 {
+		seen := make(map[string]bool)
+		for _, src := range sources {
+			for _, form := range src.Forms() {
+				if !seen[form] {
+					seen[form] = true
+					forms = append(forms, form)
+				}
+			}
+		}
+		sort.Strings(forms)
+	}
+	if len(forms) == 0 {
+		return nil, fmt.Errorf("the sources contain no forms")
+	}
+
+	m := &merger{
+		files:     make(map[string][]byte),
+		origins:   make(map[string]string),
+		extOrigin: make(map[string]string),
+	}
+	result := &MergeResult{}
+
+	for _, form := range forms {
+		found := false
+		for _, src := range sources {
+			if !src.HasForm(form) {
+				continue
+			}
+			files, deps, err := src.Extract(form)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range sortedNames(files) {
+				if name == rootExtension {
+					continue
+				}
+				if err := m.add(name, files[name], src.Path); err != nil {
+					return nil, err
+				}
+			}
+			ext, err := src.reducedExtension(deps)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.addExtension(ext, src.Path); err != nil {
+				return nil, err
+			}
+			if !found {
+				result.Forms = append(result.Forms, MergedForm{Name: form, Source: src.Path, Dependencies: deps})
+			}
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("form '%s' is not in any of the sources", form)
+		}
+	}
+
+	app := opts.App
+	if app == nil {
+		for _, src := range sources {
+			if _, ok := src.Files["app/index.html"]; ok {
+				app = src
+				break
+			}
+		}
+	}
+	if app == nil {
+		return nil, fmt.Errorf("no source has app/index.html; choose the app with an explicit app source")
+	}
+	if _, ok := app.Files["app/index.html"]; !ok {
+		return nil, fmt.Errorf("%s has no app/index.html", app.Path)
+	}
+	for _, name := range sortedNames(app.Files) {
+		if strings.HasPrefix(name, "app/") {
+			if err := m.add(name, app.Files[name], app.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result.App = app.Path
+
+	if m.extension != nil {
+		data, err := json.MarshalIndent(m.extension, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		m.files[rootExtension] = append(data, '\n')
+	}
+	result.Files = m.files
+	return result, nil
+}
+
+// add puts a file into the bundle unless another source already put different content there
+func (m *merger) add(name string, data []byte, origin string) error {
+	if existing, ok := m.files[name]; ok {
+		if !bytes.Equal(existing, data) {
+			return fmt.Errorf("%s differs between %s and %s", name, m.origins[name], origin)
+		}
+		return nil
+	}
+	m.files[name] = data
+	m.origins[name] = origin
+	return nil
+}
+
+// addExtension merges the entries of a source's forms/ext.json into the bundle's
+func (m *merger) addExtension(ext *validation.ExtensionDefinition, origin string) error {
+	if ext == nil {
+		return nil
+	}
+	if m.extension == nil {
+		m.extension = &validation.ExtensionDefinition{Version: ext.Version, Description: ext.Description}
+	}
+	sections := []struct {
+		name string
+		dst  *map[string]interface{}
+		src  map[string]interface{}
+	}{
+		{"renderers", &m.extension.Renderers, ext.Renderers},
+		{"functions", &m.extension.Functions, ext.Functions},
+		{"schemas", &m.extension.Schemas, ext.Schemas},
+		{"definitions", &m.extension.Definitions, ext.Definitions},
+	}
+	for _, section := range sections {
+		for key, value := range section.src {
+			id := section.name + "." + key
+			if *section.dst == nil {
+				*section.dst = make(map[string]interface{})
+			}
+			if existing, ok := (*section.dst)[key]; ok {
+				if !reflect.DeepEqual(existing, value) {
+					return fmt.Errorf("%s: %s differs between %s and %s", rootExtension, id, m.extOrigin[id], origin)
+				}
+				continue
+			}
+			(*section.dst)[key] = value
+			m.extOrigin[id] = origin
+		}
+	}
+	return nil
+}
@@ -2,12 +2,16 @@ package client
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
 )
 
 // UploadAttachment uploads a file to the server with the specified attachment ID
@@ -105,6 +109,38 @@ func (c *Client) DownloadAttachment(attachmentID string, outputPath string) erro
 	return nil
 }
 
+// ErrChecksumMismatch is returned when a downloaded attachment doesn't match the size or
+// hash the attachment manifest gives for it
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// DownloadAttachmentVerified downloads an attachment to destPath, continuing the partial
+// download an interrupted run left next to it. The content is checked against size and
+// sha256Hex before it is moved into place; pass a negative size or an empty hash to skip
+// that check. A mismatch discards the download and returns ErrChecksumMismatch.
+func (c *Client) DownloadAttachmentVerified(attachmentID, destPath, sha256Hex string, size int64) error {
+	url := fmt.Sprintf("%s/attachments/%s", c.BaseURL, attachmentID)
+	return c.downloadToFileVerified(url, destPath, true, func(partPath string) error {
+		f, err := os.Open(partPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		n, err := io.Copy(h, f)
+		if err != nil {
+			return fmt.Errorf("error hashing download: %w", err)
+		}
+		if size >= 0 && n != size {
+			return fmt.Errorf("%w: got %d bytes, expected %d", ErrChecksumMismatch, n, size)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); sha256Hex != "" && !strings.EqualFold(got, sha256Hex) {
+			return fmt.Errorf("%w: got sha256 %s, expected %s", ErrChecksumMismatch, got, sha256Hex)
+		}
+		return nil
+	})
+}
+
 // AttachmentExists checks if an attachment exists on the server
 func (c *Client) AttachmentExists(attachmentID string) (bool, error) {
 	// Create request
@@ -130,3 +166,63 @@ func (c *Client) AttachmentExists(attachmentID string) (bool, error) {
 		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 }
+
+// AttachmentOperation is an entry in the attachment manifest
+type AttachmentOperation struct {
+	Operation    string  `json:"operation"`
+	AttachmentID string  `json:"attachment_id"`
+	DownloadURL  *string `json:"download_url,omitempty"`
+	Size         *int64  `json:"size,omitempty"`
+	ContentType  *string `json:"content_type,omitempty"`
+	Hash         string  `json:"hash,omitempty"`
+	Version      int64   `json:"version"`
+	// Skippable is set when Hash is one of the known hashes sent with the request
+	Skippable bool `json:"skippable,omitempty"`
+}
+
+// AttachmentManifest lists the latest operation per attachment since a version
+type AttachmentManifest struct {
+	CurrentVersion    int64                 `json:"current_version"`
+	Operations        []AttachmentOperation `json:"operations"`
+	TotalDownloadSize int64                 `json:"total_download_size"`
+	// SkippableDownloadSize is the size of the downloads the client already holds
+	SkippableDownloadSize int64 `json:"skippable_download_size,omitempty"`
+}
+
+// GetAttachmentManifest retrieves the attachment operations since sinceVersion.
+// Downloads of content with one of knownHashes (hex SHA-256) are marked skippable.
+func (c *Client) GetAttachmentManifest(clientID string, sinceVersion int64, knownHashes []string) (*AttachmentManifest, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"client_id":     clientID,
+		"since_version": sinceVersion,
+		"known_hashes":  knownHashes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/attachments/manifest", c.BaseURL)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var manifest AttachmentManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	return &manifest, nil
+}
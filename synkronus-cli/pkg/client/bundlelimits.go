@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// BundleLimitOverrideHeader makes the server accept a bundle beyond its push limits
+const BundleLimitOverrideHeader = "X-Bundle-Limit-Override"
+
+// BundleLimitViolation is a server push limit a bundle exceeds
+type BundleLimitViolation struct {
+	Limit   string `json:"limit"`
+	Max     int64  `json:"max"`
+	Actual  int64  `json:"actual"`
+	Largest []struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+	} `json:"largest,omitempty"`
+}
+
+// BundleLimitError is returned when the server rejects a bundle that exceeds its push
+// limits; pushing again with SetOverrideLimits accepts it
+type BundleLimitError struct {
+	Message    string
+	Violations []BundleLimitViolation
+}
+
+func (e *BundleLimitError) Error() string {
+	return e.Message
+}
+
+// SetOverrideLimits makes pushes and draft uploads ask the server to accept bundles beyond
+// its push limits
+func (c *Client) SetOverrideLimits(override bool) {
+	c.OverrideLimits = override
+}
+
+// bundleLimitError reads the 413 response of a push rejected by the push limits
+func bundleLimitError(body []byte) error {
+	var errResp struct {
+		Error      string                 `json:"error"`
+		Violations []BundleLimitViolation `json:"violations"`
+	}
+	err := &BundleLimitError{Message: "app bundle exceeds the server's push limits"}
+	if json.Unmarshal(body, &errResp) == nil {
+		if errResp.Error != "" {
+			err.Message = errResp.Error
+		}
+		err.Violations = errResp.Violations
+	}
+	return err
+}
+
+// setLimitOverride adds the limit override header to a push request when requested
+func (c *Client) setLimitOverride(req *http.Request) {
+	if c.OverrideLimits {
+		req.Header.Set(BundleLimitOverrideHeader, "true")
+	}
+}
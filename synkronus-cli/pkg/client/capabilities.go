@@ -0,0 +1,75 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Capabilities lists what a server deployment supports
+type Capabilities struct {
+	User *struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	} `json:"user,omitempty"`
+	Features      []string `json:"features"`
+	AsyncPush     bool     `json:"async_push"`
+	Channels      bool     `json:"channels"`
+	ExportFormats []string `json:"export_formats"`
+	Storage       struct {
+		Backend      string `json:"backend"`
+		Replication  bool   `json:"replication"`
+		SignedURLs   bool   `json:"signed_urls"`
+		AppBundleCDN bool   `json:"app_bundle_cdn"`
+	} `json:"storage"`
+	Sync struct {
+		ConflictPolicy         string `json:"conflict_policy"`
+		DataValidation         bool   `json:"data_validation"`
+		TombstoneRetentionDays int    `json:"tombstone_retention_days"`
+	} `json:"sync"`
+	ChangeFeed string `json:"change_feed,omitempty"`
+}
+
+// SupportsExportFormat reports whether the server serves /dataexport/{format}
+func (c *Capabilities) SupportsExportFormat(format string) bool {
+	for _, f := range c.ExportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrCapabilitiesUnsupported is returned by GetCapabilities for servers that predate
+// GET /capabilities
+var ErrCapabilitiesUnsupported = errors.New("server does not support capability discovery")
+
+// GetCapabilities retrieves what the server supports
+func (c *Client) GetCapabilities() (*Capabilities, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/capabilities", c.BaseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrCapabilitiesUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var capabilities Capabilities
+	if err := json.NewDecoder(resp.Body).Decode(&capabilities); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	return &capabilities, nil
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/capabilities" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"user":{"username":"alice","role":"admin"},"features":["anonymized_export"],"async_push":false,"channels":false,"export_formats":["parquet","csv"],"storage":{"backend":"local","replication":true},"sync":{"conflict_policy":"reject","data_validation":true}}`))
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	capabilities, err := c.GetCapabilities()
+	if err != nil {
+		t.Fatalf("GetCapabilities: %v", err)
+	}
+	if capabilities.User == nil || capabilities.User.Username != "alice" || !capabilities.Storage.Replication || capabilities.Sync.ConflictPolicy != "reject" {
+		t.Errorf("capabilities = %+v", capabilities)
+	}
+	if !capabilities.SupportsExportFormat("csv") || capabilities.SupportsExportFormat("duckdb") {
+		t.Errorf("export formats = %v", capabilities.ExportFormats)
+	}
+
+	// Servers from before capability discovery
+	status = http.StatusNotFound
+	if _, err := c.GetCapabilities(); !errors.Is(err, ErrCapabilitiesUnsupported) {
+		t.Errorf("error = %v, want ErrCapabilitiesUnsupported", err)
+	}
+}
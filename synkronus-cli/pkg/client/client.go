@@ -26,6 +26,98 @@ type AppBundleChanges struct {
 	Removed        []map[string]any `json:"removed"`
 }
 
+// AppBundleVersion describes an app bundle version as listed by the server
+type AppBundleVersion struct {
+	Version   string    `json:"version"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author,omitempty"`
+	FormCount int       `json:"form_count"`
+}
+
+// AppBundleVersionList is the response of /app-bundle/versions
+type AppBundleVersionList struct {
+	Versions  []string           `json:"versions"`
+	Details   []AppBundleVersion `json:"details,omitempty"` // absent on older servers
+	Scheduled *struct {
+		Version     string    `json:"version"`
+		EffectiveAt time.Time `json:"effective_at"`
+	} `json:"scheduled,omitempty"`
+}
+
+// AppBundleChangeLog describes form changes between two app bundle versions
+type AppBundleChangeLog struct {
+	CompareVersionA string `json:"compare_version_a"`
+	CompareVersionB string `json:"compare_version_b"`
+	FormChanges     bool   `json:"form_changes"`
+	UIChanges       bool   `json:"ui_changes"`
+	NewForms        []struct {
+		Form string `json:"form"`
+	} `json:"new_forms,omitempty"`
+	RemovedForms []struct {
+		Form string `json:"form"`
+	} `json:"removed_forms,omitempty"`
+	ModifiedForms []struct {
+		Form          string `json:"form"`
+		SchemaChanged bool   `json:"schema_changed"`
+		UIChanged     bool   `json:"ui_changed"`
+		CoreChanged   bool   `json:"core_changed"`
+		AddedFields   []struct {
+			Field string `json:"field"`
+			Type  string `json:"type"`
+		} `json:"added_fields,omitempty"`
+		RemovedFields []struct {
+			Field string `json:"field"`
+			Type  string `json:"type"`
+		} `json:"removed_fields,omitempty"`
+		Breaking bool                  `json:"breaking"`
+		Changes  []AppBundleFormChange `json:"changes,omitempty"`
+	} `json:"modified_forms,omitempty"`
+	// Breaking is set when data collected with the old version may not fit the new one
+	Breaking bool `json:"breaking"`
+}
+
+// AppBundleFormChange is a change of a form classified by the server as breaking or not
+type AppBundleFormChange struct {
+	Kind     string `json:"kind"`
+	Field    string `json:"field,omitempty"`
+	OldType  string `json:"old_type,omitempty"`
+	NewType  string `json:"new_type,omitempty"`
+	Breaking bool   `json:"breaking"`
+}
+
+// BreakingSwitchError is returned when the server refuses a version switch requested
+// with rejectBreaking because it is breaking
+type BreakingSwitchError struct {
+	Message   string              `json:"message"`
+	ChangeLog *AppBundleChangeLog `json:"changes"`
+}
+
+func (e *BreakingSwitchError) Error() string {
+	return e.Message
+}
+
+// AppInfo is the APP_INFO.json the server generates for each app bundle version
+type AppInfo struct {
+	Version   string              `json:"version"`
+	Timestamp string              `json:"timestamp,omitempty"`
+	Forms     map[string]FormInfo `json:"forms,omitempty"`
+}
+
+// FormInfo describes a form in APP_INFO.json
+type FormInfo struct {
+	CoreHash string `json:"core_hash"`
+	FormHash string `json:"form_hash"`
+	UIHash   string `json:"ui_hash"`
+	Fields   []struct {
+		Name         string `json:"name"`
+		Type         string `json:"type"`
+		Required     bool   `json:"required"`
+		QuestionType string `json:"question_type,omitempty"`
+		Core         bool   `json:"core"`
+	} `json:"fields"`
+}
+
 // SystemVersionInfo represents the version information of the Synkronus server
 type SystemVersionInfo struct {
 	Server   ServerInfo   `json:"server"`
@@ -61,6 +153,9 @@ type Client struct {
 	BaseURL    string
 	APIVersion string
 	HTTPClient *http.Client
+	PushWait   time.Duration // How long pushes queue behind a running push, see SetPushWait
+	// OverrideLimits asks the server to accept bundles beyond its push limits
+	OverrideLimits bool
 }
 
 // NewClient creates a new Synkronus API client
@@ -150,6 +245,33 @@ func (c *Client) GetAppBundleManifest() (map[string]interface{}, error) {
 	return result, nil
 }
 
+// GetAppBundleAppInfo retrieves the APP_INFO.json of the active app bundle version
+func (c *Client) GetAppBundleAppInfo() (*AppInfo, error) {
+	url := fmt.Sprintf("%s/app-bundle/download/APP_INFO.json", c.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var info AppInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("error parsing APP_INFO.json: %w", err)
+	}
+
+	return &info, nil
+}
+
 // GetAppBundleVersions retrieves available app bundle versions
 func (c *Client) GetAppBundleVersions() (map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/app-bundle/versions", c.BaseURL)
@@ -177,6 +299,75 @@ func (c *Client) GetAppBundleVersions() (map[string]interface{}, error) {
 	return result, nil
 }
 
+// ListAppBundleVersions retrieves the available app bundle versions with their details
+func (c *Client) ListAppBundleVersions() (*AppBundleVersionList, error) {
+	url := fmt.Sprintf("%s/app-bundle/versions", c.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result AppBundleVersionList
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	// Older servers only list names, with the active one marked by " *"
+	if len(result.Details) == 0 {
+		for _, version := range result.Versions {
+			result.Details = append(result.Details, AppBundleVersion{
+				Version: strings.TrimSuffix(version, " *"),
+				Active:  strings.HasSuffix(version, " *"),
+			})
+		}
+	}
+
+	return &result, nil
+}
+
+// GetAppBundleChangeLog gets the form changes from one app bundle version to another
+func (c *Client) GetAppBundleChangeLog(fromVersion, toVersion string) (*AppBundleChangeLog, error) {
+	url := fmt.Sprintf("%s/app-bundle/changes", c.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	q := req.URL.Query()
+	q.Add("current", fromVersion)
+	q.Add("target", toVersion)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var changeLog AppBundleChangeLog
+	if err := json.NewDecoder(resp.Body).Decode(&changeLog); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	return &changeLog, nil
+}
+
 // GetAppBundleChanges gets the changes between two app bundle versions
 func (c *Client) GetAppBundleChanges(currentVersion, targetVersion string) (*AppBundleChanges, error) {
 	url := fmt.Sprintf("%s/app-bundle/changes", c.BaseURL)
@@ -216,13 +407,26 @@ func (c *Client) GetAppBundleChanges(currentVersion, targetVersion string) (*App
 }
 
 // DownloadAppBundleFile downloads a specific file from the app bundle
-// If preview is true, adds ?preview=true to the request URL
-func (c *Client) DownloadAppBundleFile(path, destPath string, preview bool) error {
+// If preview is true, adds ?preview=true to the request URL. If resume is true, a partial
+// download left by an earlier attempt is continued instead of starting over.
+func (c *Client) DownloadAppBundleFile(path, destPath string, preview, resume bool) error {
 	url := fmt.Sprintf("%s/app-bundle/download/%s", c.BaseURL, url.PathEscape(path))
 	if preview {
 		url += "?preview=true"
 	}
 
+	return c.downloadToFile(url, destPath, resume)
+}
+
+// DownloadAppBundleZip downloads the active app bundle as a single zip file
+func (c *Client) DownloadAppBundleZip(destPath string, resume bool) error {
+	return c.downloadToFile(fmt.Sprintf("%s/app-bundle/download-zip", c.BaseURL), destPath, resume)
+}
+
+// DownloadParquetExport downloads the Parquet export ZIP archive to the specified destination path
+func (c *Client) DownloadParquetExport(destPath string) error {
+	url := fmt.Sprintf("%s/dataexport/parquet", c.BaseURL)
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
@@ -261,52 +465,45 @@ func (c *Client) DownloadAppBundleFile(path, destPath string, preview bool) erro
 	return nil
 }
 
-// DownloadParquetExport downloads the Parquet export ZIP archive to the specified destination path
-func (c *Client) DownloadParquetExport(destPath string) error {
-	url := fmt.Sprintf("%s/dataexport/parquet", c.BaseURL)
+// UploadAppBundle uploads a new app bundle
+func (c *Client) UploadAppBundle(bundlePath string) (map[string]interface{}, error) {
+	return c.uploadBundle(c.pushURL("/app-bundle/push"), bundlePath)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// UploadAppBundleDraft uploads an app bundle into the server's draft slot without assigning a version
+func (c *Client) UploadAppBundleDraft(bundlePath string) (map[string]interface{}, error) {
+	return c.uploadBundle(c.pushURL("/app-bundle/draft"), bundlePath)
+}
+
+// PromoteAppBundleDraft turns the staged draft into a numbered version
+func (c *Client) PromoteAppBundleDraft() (map[string]interface{}, error) {
+	url := c.pushURL("/app-bundle/draft/promote")
+
+	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, pushError(resp)
 	}
 
-	// Create destination directory if it doesn't exist
-	destDir := filepath.Dir(destPath)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return err
-	}
-
-	// Create destination file
-	out, err := os.Create(destPath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Copy response body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
 	}
 
-	return nil
+	return result, nil
 }
 
-// UploadAppBundle uploads a new app bundle
-func (c *Client) UploadAppBundle(bundlePath string) (map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/app-bundle/push", c.BaseURL)
-
+// uploadBundle posts a bundle ZIP as multipart form data to url
+func (c *Client) uploadBundle(url, bundlePath string) (map[string]interface{}, error) {
 	// Open the bundle file
 	file, err := os.Open(bundlePath)
 	if err != nil {
@@ -344,6 +541,7 @@ func (c *Client) UploadAppBundle(bundlePath string) (map[string]interface{}, err
 
 	// Set content type
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.setLimitOverride(req)
 
 	// Send request
 	resp, err := c.doRequest(req)
@@ -353,8 +551,7 @@ func (c *Client) UploadAppBundle(bundlePath string) (map[string]interface{}, err
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, pushError(resp)
 	}
 
 	var result map[string]interface{}
@@ -365,9 +562,27 @@ func (c *Client) UploadAppBundle(bundlePath string) (map[string]interface{}, err
 	return result, nil
 }
 
-// SwitchAppBundleVersion switches to a specific app bundle version
-func (c *Client) SwitchAppBundleVersion(version string) (map[string]interface{}, error) {
+// SwitchAppBundleVersion switches to a specific app bundle version. With rejectBreaking,
+// a switch whose change log from the active version is breaking fails with a
+// *BreakingSwitchError.
+func (c *Client) SwitchAppBundleVersion(version string, rejectBreaking bool) (map[string]interface{}, error) {
+	return c.switchAppBundleVersion(version, url.Values{}, rejectBreaking)
+}
+
+// ScheduleAppBundleSwitch switches to a specific app bundle version at effectiveAt.
+// Until then, clients see the version as upcoming in the manifest.
+func (c *Client) ScheduleAppBundleSwitch(version string, effectiveAt time.Time, rejectBreaking bool) (map[string]interface{}, error) {
+	return c.switchAppBundleVersion(version, url.Values{"effective_at": {effectiveAt.UTC().Format(time.RFC3339)}}, rejectBreaking)
+}
+
+func (c *Client) switchAppBundleVersion(version string, query url.Values, rejectBreaking bool) (map[string]interface{}, error) {
+	if rejectBreaking {
+		query.Set("reject_breaking", "true")
+	}
 	url := fmt.Sprintf("%s/app-bundle/switch/%s", c.BaseURL, version)
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
 
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
@@ -382,6 +597,10 @@ func (c *Client) SwitchAppBundleVersion(version string) (map[string]interface{},
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		breaking := &BreakingSwitchError{}
+		if resp.StatusCode == http.StatusConflict && json.Unmarshal(body, breaking) == nil && breaking.ChangeLog != nil {
+			return nil, breaking
+		}
 		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
@@ -419,6 +638,11 @@ func (c *Client) SyncPull(clientID string, currentVersion int64, schemaTypes []s
 		"client_id": clientID,
 	}
 
+	// The limit goes in the body; it is repeated in the query for older servers
+	if limit > 0 {
+		reqBody["limit"] = limit
+	}
+
 	// Add 'since' object if currentVersion is provided
 	if currentVersion > 0 {
 		reqBody["since"] = map[string]interface{}{
@@ -472,8 +696,9 @@ func (c *Client) SyncPull(clientID string, currentVersion int64, schemaTypes []s
 	return result, nil
 }
 
-// SyncPush pushes records to the server
-func (c *Client) SyncPush(clientID string, transmissionID string, records []map[string]interface{}) (map[string]interface{}, error) {
+// SyncPush pushes records to the server. A dry run checks the records and reports what
+// the push would do with each of them without storing anything.
+func (c *Client) SyncPush(clientID string, transmissionID string, records []map[string]interface{}, dryRun bool) (map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/sync/push", c.BaseURL)
 
 	// Prepare request body
@@ -482,6 +707,9 @@ func (c *Client) SyncPush(clientID string, transmissionID string, records []map[
 		"transmission_id": transmissionID,
 		"records":         records,
 	}
+	if dryRun {
+		reqBody["dry_run"] = true
+	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffixes of the files kept next to an unfinished download
+const (
+	partialSuffix   = ".part"
+	validatorSuffix = ".part.validator"
+)
+
+// downloadToFile downloads url to destPath. The body is written to destPath.part and
+// renamed into place once complete, so an interrupted download never leaves a truncated
+// file behind. With resume, an existing destPath.part is continued with a Range request
+// guarded by If-Range; if the file changed on the server in the meantime the server
+// answers with the full content and the download starts over.
+func (c *Client) downloadToFile(url, destPath string, resume bool) error {
+	return c.downloadToFileVerified(url, destPath, resume, nil)
+}
+
+// downloadToFileVerified is downloadToFile with a check of the complete destPath.part
+// before it is renamed into place. When verify fails the partial download is discarded,
+// so the next attempt starts from scratch.
+func (c *Client) downloadToFileVerified(url, destPath string, resume bool, verify func(partPath string) error) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+
+	partPath := destPath + partialSuffix
+	validatorPath := destPath + validatorSuffix
+
+	var offset int64
+	var validator string
+	if resume {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+		if data, err := os.ReadFile(validatorPath); err == nil {
+			validator = strings.TrimSpace(string(data))
+		}
+		// Without a validator the partial content can't be matched to the server's file
+		if validator == "" {
+			offset = 0
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if offset == 0 || !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("unexpected partial response for %s: %s", url, resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is at least as long as the server's; start again from scratch
+		os.Remove(partPath)
+		os.Remove(validatorPath)
+		return c.downloadToFileVerified(url, destPath, false, verify)
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if v := responseValidator(resp); v != "" {
+			if err := os.WriteFile(validatorPath, []byte(v), 0644); err != nil {
+				return err
+			}
+		} else {
+			os.Remove(validatorPath)
+		}
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return fmt.Errorf("download interrupted, run again with --resume to continue: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(validatorPath)
+	if verify != nil {
+		if err := verify(partPath); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+	}
+	return os.Rename(partPath, destPath)
+}
+
+// responseValidator returns the value to send in If-Range when resuming a download of
+// the response. Weak ETags can't be used for ranges, so Last-Modified is used instead.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
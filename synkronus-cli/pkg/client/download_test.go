@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestDownloadToFileResume(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	content := []byte("0123456789abcdefghij")
+	etag := `"v1"`
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "bundle.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, HTTPClient: server.Client()}
+	dest := filepath.Join(t.TempDir(), "bundle.zip")
+
+	// Simulate an interrupted download of the current file
+	if err := os.WriteFile(dest+partialSuffix, content[:8], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+validatorSuffix, []byte(etag), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.downloadToFile(server.URL, dest, true); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if gotRange != "bytes=8-" {
+		t.Errorf("Range = %q, want bytes=8-", gotRange)
+	}
+	assertFile(t, dest, content)
+
+	// A partial file from an older version of the bundle is discarded
+	if err := os.WriteFile(dest+partialSuffix, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+validatorSuffix, []byte(`"v0"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.downloadToFile(server.URL, dest, true); err != nil {
+		t.Fatalf("restart failed: %v", err)
+	}
+	assertFile(t, dest, content)
+
+	// Without --resume any partial file is ignored
+	if err := os.WriteFile(dest+partialSuffix, content[:8], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.downloadToFile(server.URL, dest, false); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if gotRange != "" {
+		t.Errorf("Range = %q, want none", gotRange)
+	}
+	assertFile(t, dest, content)
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+	for _, suffix := range []string{partialSuffix, validatorSuffix} {
+		if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s%s was not cleaned up", path, suffix)
+		}
+	}
+}
+
+func TestDownloadAttachmentVerified(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	content := []byte("photo bytes")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"photo"`)
+		http.ServeContent(w, r, "photo.jpg", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, HTTPClient: server.Client()}
+	dir := t.TempDir()
+
+	dest := filepath.Join(dir, "photo.jpg")
+	if err := c.DownloadAttachmentVerified("photo.jpg", dest, hash, int64(len(content))); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	assertFile(t, dest, content)
+
+	// Content that doesn't match the manifest is discarded
+	dest = filepath.Join(dir, "other.jpg")
+	if err := c.DownloadAttachmentVerified("other.jpg", dest, strings.Repeat("0", 64), -1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	for _, path := range []string{dest, dest + partialSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was kept after a checksum mismatch", path)
+		}
+	}
+	if err := c.DownloadAttachmentVerified("other.jpg", dest, "", 3); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for the size, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// ExportScheduleDestination is where a scheduled export is delivered: a directory under the
+// server's EXPORT_SCHEDULE_DIR or a webhook URL
+type ExportScheduleDestination struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ExportSchedule runs a named export report on a cron expression and delivers its output
+type ExportSchedule struct {
+	Name         string                    `json:"name,omitempty"`
+	Cron         string                    `json:"cron"`
+	Report       string                    `json:"report"`
+	Format       string                    `json:"format,omitempty"`
+	Parameters   map[string]string         `json:"parameters,omitempty"`
+	Destination  ExportScheduleDestination `json:"destination"`
+	NextRunAt    *time.Time                `json:"next_run_at,omitempty"`
+	LastRunAt    *time.Time                `json:"last_run_at,omitempty"`
+	LastStatus   string                    `json:"last_status,omitempty"`
+	LastError    string                    `json:"last_error,omitempty"`
+	LastDelivery string                    `json:"last_delivery,omitempty"`
+}
+
+// ExportScheduleRun is the outcome of running a schedule
+type ExportScheduleRun struct {
+	Schedule  string    `json:"schedule"`
+	Report    string    `json:"report"`
+	Status    string    `json:"status"`
+	Rows      int       `json:"rows"`
+	Truncated bool      `json:"truncated"`
+	Delivery  string    `json:"delivery,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	RanAt     time.Time `json:"ran_at"`
+}
+
+// ListExportSchedules calls GET /dataexport/schedules (admin)
+func (c *Client) ListExportSchedules() ([]ExportSchedule, error) {
+	url := fmt.Sprintf("%s/dataexport/schedules", c.BaseURL)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var result struct {
+		Schedules []ExportSchedule `json:"schedules"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Schedules, nil
+}
+
+// SaveExportSchedule calls PUT /dataexport/schedules/{name} (admin), creating or replacing
+// the schedule
+func (c *Client) SaveExportSchedule(name string, schedule ExportSchedule) (*ExportSchedule, error) {
+	url := fmt.Sprintf("%s/dataexport/schedules/%s", c.BaseURL, neturl.PathEscape(name))
+	body, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var saved ExportSchedule
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &saved, nil
+}
+
+// DeleteExportSchedule calls DELETE /dataexport/schedules/{name} (admin)
+func (c *Client) DeleteExportSchedule(name string) error {
+	url := fmt.Sprintf("%s/dataexport/schedules/%s", c.BaseURL, neturl.PathEscape(name))
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("API error: %v", apiErr)
+	}
+	return nil
+}
+
+// RunExportSchedule calls POST /dataexport/schedules/{name}/run (admin). A run that fails to
+// produce or deliver the report is returned with status failed, not as an error.
+func (c *Client) RunExportSchedule(name string) (*ExportScheduleRun, error) {
+	url := fmt.Sprintf("%s/dataexport/schedules/%s/run", c.BaseURL, neturl.PathEscape(name))
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var run ExportScheduleRun
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &run, nil
+}
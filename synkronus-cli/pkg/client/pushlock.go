@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AppBundlePushStatus describes the push holding the server's push lock
+type AppBundlePushStatus struct {
+	Locked            bool       `json:"locked"`
+	Operation         string     `json:"operation,omitempty"`
+	User              string     `json:"user,omitempty"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	Waiting           int        `json:"waiting"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+}
+
+// PushInProgressError is returned when the server rejects a push because another
+// push, draft upload or promotion is running
+type PushInProgressError struct {
+	Message    string
+	RetryAfter time.Duration // Zero when the server gave no estimate
+}
+
+func (e *PushInProgressError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s; retry in %s", e.Message, e.RetryAfter)
+	}
+	return e.Message
+}
+
+// SetPushWait makes pushes and promotions queue up to d behind a running push on the
+// server instead of failing straight away. The request timeout grows by d.
+func (c *Client) SetPushWait(d time.Duration) {
+	c.PushWait = d
+	if c.HTTPClient != nil && c.HTTPClient.Timeout > 0 {
+		c.HTTPClient.Timeout += d
+	}
+}
+
+// pushURL returns the URL of a push endpoint, with the wait set by SetPushWait
+func (c *Client) pushURL(path string) string {
+	u := fmt.Sprintf("%s%s", c.BaseURL, path)
+	if seconds := int(c.PushWait / time.Second); seconds > 0 {
+		u += "?wait=" + strconv.Itoa(seconds)
+	}
+	return u
+}
+
+// pushError turns a failed push response into an error, reporting a held push lock
+// as *PushInProgressError and exceeded push limits as *BundleLimitError
+func pushError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return bundleLimitError(body)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	err := &PushInProgressError{Message: "another app bundle push is in progress"}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+		err.Message = errResp.Error
+	}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
+
+// GetAppBundlePushStatus reports the push holding the server's push lock, if any
+func (c *Client) GetAppBundlePushStatus() (*AppBundlePushStatus, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/app-bundle/push/status", c.BaseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var status AppBundlePushStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	return &status, nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestPromoteAppBundleDraftPushInProgress(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	var gotWait string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotWait = r.URL.Query().Get("wait")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"another app bundle push is in progress (push by alice)","message":"Another app bundle push is in progress, retry later"}`))
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	c.SetPushWait(90 * time.Second)
+	if c.HTTPClient.Timeout != 120*time.Second {
+		t.Errorf("timeout = %s, want 2m0s", c.HTTPClient.Timeout)
+	}
+
+	_, err := c.PromoteAppBundleDraft()
+	if gotWait != "90" {
+		t.Errorf("wait = %q, want 90", gotWait)
+	}
+
+	var inProgress *PushInProgressError
+	if !errors.As(err, &inProgress) {
+		t.Fatalf("error = %v, want *PushInProgressError", err)
+	}
+	if inProgress.RetryAfter != 12*time.Second {
+		t.Errorf("RetryAfter = %s, want 12s", inProgress.RetryAfter)
+	}
+	if want := "another app bundle push is in progress (push by alice); retry in 12s"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestUploadAppBundleLimitExceeded(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	var gotOverride string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOverride = r.Header.Get(BundleLimitOverrideHeader)
+		w.Header().Set("Content-Type", "application/json")
+		if gotOverride == "true" {
+			w.Write([]byte(`{"message":"App bundle successfully pushed","manifest":{"version":"0004"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(`{"error":"app bundle exceeds push limits: files total 500.2 MB, the limit is 100.0 MB (largest: app/media/intro.mp4 500.0 MB)","violations":[{"limit":"max_bytes","max":104857600,"actual":524496896,"largest":[{"path":"app/media/intro.mp4","size":524288000}]}]}`))
+	}))
+	defer server.Close()
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := os.WriteFile(bundlePath, []byte("zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{BaseURL: server.URL, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	_, err := c.UploadAppBundle(bundlePath)
+	var limitErr *BundleLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("error = %v, want *BundleLimitError", err)
+	}
+	if gotOverride != "" {
+		t.Errorf("override header = %q, want none", gotOverride)
+	}
+	if len(limitErr.Violations) != 1 || limitErr.Violations[0].Largest[0].Path != "app/media/intro.mp4" {
+		t.Errorf("violations = %+v", limitErr.Violations)
+	}
+
+	c.SetOverrideLimits(true)
+	if _, err := c.UploadAppBundle(bundlePath); err != nil {
+		t.Fatalf("override upload: %v", err)
+	}
+	if gotOverride != "true" {
+		t.Errorf("override header = %q, want true", gotOverride)
+	}
+}
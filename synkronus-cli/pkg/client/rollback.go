@@ -0,0 +1,48 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// AppBundleRollback is a rollback to the version before the active one
+type AppBundleRollback struct {
+	FromVersion  string `json:"from_version"`
+	ToVersion    string `json:"to_version"`
+	ManifestHash string `json:"manifest_hash"`
+	FileCount    int    `json:"file_count"`
+}
+
+// RollbackAppBundle switches the server to the released version before the active one.
+// The server restores the active version if the manifest of the previous one fails to
+// regenerate.
+func (c *Client) RollbackAppBundle() (*AppBundleRollback, error) {
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/app-bundle/rollback", c.BaseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Rollback *AppBundleRollback `json:"rollback"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	if result.Rollback == nil {
+		return nil, fmt.Errorf("error parsing response: no rollback")
+	}
+	return result.Rollback, nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRollbackAppBundle(t *testing.T) {
+	viper.Set("auth.token", "test-token")
+	viper.Set("auth.expires_at", time.Now().Add(time.Hour).Unix())
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app-bundle/rollback" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"message":"Rolled back from app bundle version 0004 to 0003","rollback":{"from_version":"0004","to_version":"0003","manifest_hash":"abc","file_count":12}}`))
+		} else {
+			w.Write([]byte(`{"error":"no earlier app bundle version to roll back to"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	rollback, err := c.RollbackAppBundle()
+	if err != nil {
+		t.Fatalf("RollbackAppBundle: %v", err)
+	}
+	if *rollback != (AppBundleRollback{FromVersion: "0004", ToVersion: "0003", ManifestHash: "abc", FileCount: 12}) {
+		t.Errorf("rollback = %+v", rollback)
+	}
+
+	status = http.StatusConflict
+	if _, err := c.RollbackAppBundle(); err == nil || !strings.Contains(err.Error(), "status 409") {
+		t.Errorf("error = %v, want the 409", err)
+	}
+}
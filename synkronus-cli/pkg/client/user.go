@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	neturl "net/url"
 )
 
 // UserCreateRequest represents the payload for creating a user
@@ -12,6 +13,13 @@ type UserCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	Email    string `json:"email,omitempty"`
+}
+
+// UserSetEmailRequest represents the payload for setting a user's email address
+type UserSetEmailRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
 }
 
 // UserResetPasswordRequest represents the payload for resetting a user's password
@@ -103,6 +111,31 @@ func (c *Client) ResetUserPassword(reqBody UserResetPasswordRequest) error {
 	return nil
 }
 
+// SetUserEmail calls POST /users/set-email (admin)
+func (c *Client) SetUserEmail(reqBody UserSetEmailRequest) error {
+	url := fmt.Sprintf("%s/users/set-email", c.BaseURL)
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("API error: %v", apiErr)
+	}
+	return nil
+}
+
 // ChangeOwnPassword calls POST /users/change-password (self)
 func (c *Client) ChangeOwnPassword(reqBody UserChangePasswordRequest) error {
 	url := fmt.Sprintf("%s/users/change-password", c.BaseURL)
@@ -151,3 +184,150 @@ func (c *Client) ListUsers() ([]map[string]interface{}, error) {
 	}
 	return users, nil
 }
+
+// InvitationCreateRequest represents the payload for creating a registration invitation
+type InvitationCreateRequest struct {
+	Role           string `json:"role"`
+	Email          string `json:"email,omitempty"`
+	ExpiresInHours int    `json:"expiresInHours,omitempty"`
+}
+
+// CreateInvitation calls POST /users/invitations (admin)
+func (c *Client) CreateInvitation(reqBody InvitationCreateRequest) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/users/invitations", c.BaseURL)
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("only admin can create invitations")
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// ListInvitations calls GET /users/invitations (admin)
+func (c *Client) ListInvitations() ([]map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/users/invitations", c.BaseURL)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var invitations []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&invitations); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation calls DELETE /users/invitations/{id} (admin)
+func (c *Client) RevokeInvitation(id string) error {
+	url := fmt.Sprintf("%s/users/invitations/%s", c.BaseURL, id)
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("API error: %v", apiErr)
+	}
+	return nil
+}
+
+// ImpersonateRequest represents the payload for impersonating a user
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ImpersonateUser calls POST /users/impersonate/{username} (admin) and returns a short-lived,
+// read-only token that acts as the user
+func (c *Client) ImpersonateUser(username string, reqBody ImpersonateRequest) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/users/impersonate/%s", c.BaseURL, username)
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// ListImpersonations calls GET /users/impersonations (admin), optionally for one impersonated user
+func (c *Client) ListImpersonations(username string, limit int) ([]map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/users/impersonations?limit=%d", c.BaseURL, limit)
+	if username != "" {
+		url += "&username=" + neturl.QueryEscape(username)
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API error: %v", apiErr)
+	}
+	var result struct {
+		Entries []map[string]interface{} `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Entries, nil
+}
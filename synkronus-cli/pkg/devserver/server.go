@@ -0,0 +1,373 @@
+// Package devserver serves an app bundle directory with the part of the Synkronus API the
+// mobile app uses, so form and renderer developers can point the app at their laptop
+// instead of a full Synkronus deployment. Every login succeeds; nothing is persisted.
+package devserver
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultVersion is the bundle version the manifest reports unless one is configured
+const DefaultVersion = "dev"
+
+// tokenTTL is the lifetime reported for login tokens; the dev server doesn't check tokens
+const tokenTTL = 24 * time.Hour
+
+// Config contains dev server configuration
+type Config struct {
+	// BundleDir is the unzipped app bundle, with app/ and forms/ at its root
+	BundleDir string
+	// Version is the bundle version reported in the manifest; empty is DefaultVersion
+	Version string
+	// Sync enables in-memory /sync and /attachments endpoints; without it they return
+	// 501 Not Implemented
+	Sync bool
+	// Logf logs each request; nil logs nothing
+	Logf func(format string, args ...any)
+}
+
+// File is one file of the bundle manifest
+type File struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Hash     string    `json:"hash"`
+	MimeType string    `json:"mimeType"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// Manifest lists the files of the bundle directory as the server's
+// GET /app-bundle/manifest does. It is rebuilt on every request, so edits show up on the
+// app's next bundle sync.
+type Manifest struct {
+	Files       []File `json:"files"`
+	Version     string `json:"version"`
+	GeneratedAt string `json:"generatedAt"`
+	Hash        string `json:"hash"`
+}
+
+// Server is a dev server for one bundle directory
+type Server struct {
+	config Config
+	mux    *http.ServeMux
+	data   *store
+}
+
+// New creates a dev server for a bundle directory
+func New(config Config) (*Server, error) {
+	info, err := os.Stat(config.BundleDir)
+	if err != nil {
+		return nil, fmt.Errorf("bundle directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("bundle directory: %s is not a directory", config.BundleDir)
+	}
+	if config.Version == "" {
+		config.Version = DefaultVersion
+	}
+
+	s := &Server{config: config, mux: http.NewServeMux(), data: newStore()}
+	// Routes are also registered under /api, like the server does for the portal
+	for _, prefix := range []string{"", "/api"} {
+		s.mux.HandleFunc("GET "+prefix+"/health", s.health)
+		s.mux.HandleFunc("GET "+prefix+"/version", s.version)
+		s.mux.HandleFunc("POST "+prefix+"/auth/login", s.login)
+		s.mux.HandleFunc("POST "+prefix+"/auth/refresh", s.login)
+		s.mux.HandleFunc("POST "+prefix+"/auth/logout", s.logout)
+		s.mux.HandleFunc("GET "+prefix+"/app-bundle/manifest", s.manifest)
+		s.mux.HandleFunc("GET "+prefix+"/app-bundle/download/{path...}", s.download)
+		s.mux.HandleFunc("GET "+prefix+"/app-bundle/download-zip", s.downloadZip)
+		s.mux.HandleFunc("POST "+prefix+"/sync/pull", s.requireSync(s.pull))
+		s.mux.HandleFunc("POST "+prefix+"/sync/push", s.requireSync(s.push))
+		s.mux.HandleFunc("POST "+prefix+"/attachments/manifest", s.requireSync(s.attachmentManifest))
+		s.mux.HandleFunc("PUT "+prefix+"/attachments/{attachment_id}", s.requireSync(s.uploadAttachment))
+		s.mux.HandleFunc("GET "+prefix+"/attachments/{attachment_id}", s.requireSync(s.downloadAttachment))
+		s.mux.HandleFunc("HEAD "+prefix+"/attachments/{attachment_id}", s.requireSync(s.downloadAttachment))
+	}
+	return s, nil
+}
+
+// ServeHTTP serves the dev API. Browsers and the formplayer may call it from another
+// origin, so every origin is allowed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, HEAD, OPTIONS")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(recorder, r)
+	if s.config.Logf != nil {
+		s.config.Logf("%s %s %d", r.Method, r.URL.Path, recorder.status)
+	}
+}
+
+// statusRecorder remembers the status of a response for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// sendJSON writes a JSON response
+func sendJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// sendError writes an error in the server's {error, message} format
+func sendError(w http.ResponseWriter, status int, message string) {
+	sendJSON(w, status, map[string]string{"error": message, "message": message})
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, map[string]any{
+		"server":   map[string]string{"version": "dev"},
+		"features": []string{},
+	})
+}
+
+// login accepts any credentials and returns an unsigned token whose claims name the user
+// as an admin, which is all the app reads from it
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Username == "" {
+		req.Username = "dev"
+	}
+
+	expiresAt := time.Now().Add(tokenTTL)
+	token := Token(req.Username, expiresAt)
+	sendJSON(w, http.StatusOK, map[string]any{
+		"token":        token,
+		"refreshToken": token,
+		"expiresAt":    expiresAt.Unix(),
+	})
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Token returns an unsigned JWT for username with the admin role
+func Token(username string, expiresAt time.Time) string {
+	encode := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	header := encode(map[string]string{"alg": "none", "typ": "JWT"})
+	claims := encode(map[string]any{"username": username, "role": "admin", "exp": expiresAt.Unix()})
+	return header + "." + claims + "."
+}
+
+// Manifest lists the files of the bundle directory, sorted by path. Hidden files and
+// directories, e.g. .git, are left out.
+func (s *Server) Manifest() (*Manifest, error) {
+	files := []File{}
+	err := filepath.WalkDir(s.config.BundleDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != s.config.BundleDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.config.BundleDir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{
+			Path:     filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Hash:     hash,
+			MimeType: mimeType(rel),
+			ModTime:  info.ModTime().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundle files: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s:%s\n", file.Path, file.Hash)
+	}
+	return &Manifest{
+		Files:       files,
+		Version:     s.config.Version,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Hash:        hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func (s *Server) manifest(w http.ResponseWriter, r *http.Request) {
+	manifest, err := s.Manifest()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	etag := fmt.Sprintf("%q", manifest.Hash)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	sendJSON(w, http.StatusOK, manifest)
+}
+
+// bundlePath resolves a bundle file path below the bundle directory. Cleaning the path
+// as rooted keeps it from leaving the directory; hidden files aren't served.
+func (s *Server) bundlePath(name string) (string, bool) {
+	clean := path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))
+	if clean == "/" {
+		return "", false
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	return filepath.Join(s.config.BundleDir, filepath.FromSlash(clean)), true
+}
+
+// download serves one bundle file. The path may be URL-encoded as one segment, as the app
+// requests it, or given as nested segments.
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.bundlePath(r.PathValue("path"))
+	if !ok {
+		sendError(w, http.StatusBadRequest, "Invalid file path")
+		return
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	hash, err := hashFile(p)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", mimeType(p))
+	w.Header().Set("ETag", fmt.Sprintf("%q", hash))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// downloadZip serves the whole bundle as a zip, for the app's one-shot bundle install
+func (s *Server) downloadZip(w http.ResponseWriter, r *http.Request) {
+	manifest, err := s.Manifest()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=bundle-%s.zip", manifest.Version))
+	w.Header().Set("ETag", fmt.Sprintf("%q", manifest.Hash))
+	if err := writeZip(w, s.config.BundleDir, manifest.Files); err != nil && s.config.Logf != nil {
+		s.config.Logf("failed to write bundle zip: %v", err)
+	}
+}
+
+// writeZip writes the listed files of dir as a zip
+func writeZip(w io.Writer, dir string, files []File) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: file.Path, Method: zip.Deflate, Modified: file.ModTime})
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// requireSync answers 501 for sync and attachment endpoints unless Sync is enabled
+func (s *Server) requireSync(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.config.Sync {
+			sendError(w, http.StatusNotImplemented, "Sync is disabled on this dev server; start it with --sync")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// mimeType guesses a file's content type from its extension, as the server does
+func mimeType(name string) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,209 @@
+package devserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBundle writes a small bundle directory
+func testBundle(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"app/index.html":             "<html></html>",
+		"forms/survey/schema.json":   `{"type":"object"}`,
+		"forms/survey/ui.json":       `{"type":"VerticalLayout"}`,
+		".git/HEAD":                  "ref: refs/heads/main",
+		"forms/survey/.schema.json~": "backup",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func do(t *testing.T, s *Server, method, target string, body io.Reader, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_AppBundle(t *testing.T) {
+	dir := testBundle(t)
+	s, err := New(Config{BundleDir: dir})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	w := do(t, s, http.MethodGet, "/app-bundle/manifest", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if manifest.Version != DefaultVersion || len(manifest.Files) != 3 || manifest.Files[0].Path != "app/index.html" {
+		t.Fatalf("Unexpected manifest %+v", manifest)
+	}
+	etag := w.Header().Get("ETag")
+	if w := do(t, s, http.MethodGet, "/api/app-bundle/manifest", nil, http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged bundle, got %d", w.Code)
+	}
+
+	// Edits change the manifest hash
+	if err := os.WriteFile(filepath.Join(dir, "forms", "survey", "schema.json"), []byte(`{"type":"object","required":["name"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(t, s, http.MethodGet, "/app-bundle/manifest", nil, http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK {
+		t.Errorf("Expected the edited bundle's manifest, got %d", w.Code)
+	}
+
+	// Files are served by encoded or nested path; hidden files and paths outside the
+	// bundle are not
+	for _, target := range []string{"/app-bundle/download/forms%2Fsurvey%2Fschema.json", "/app-bundle/download/forms/survey/schema.json"} {
+		w := do(t, s, http.MethodGet, target, nil, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "required") {
+			t.Errorf("%s: expected the schema, got %d %s", target, w.Code, w.Body.String())
+		}
+	}
+	for _, target := range []string{"/app-bundle/download/.git%2FHEAD", "/app-bundle/download/..%2F..%2Fetc%2Fpasswd", "/app-bundle/download/forms%2Fmissing.json"} {
+		if w := do(t, s, http.MethodGet, target, nil, nil); w.Code == http.StatusOK {
+			t.Errorf("%s: expected an error, got %s", target, w.Body.String())
+		}
+	}
+
+	w = do(t, s, http.MethodGet, "/app-bundle/download-zip", nil, nil)
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	if len(archive.File) != 3 {
+		t.Errorf("Expected 3 files in the zip, got %d", len(archive.File))
+	}
+}
+
+func TestServer_Login(t *testing.T) {
+	s, err := New(Config{BundleDir: testBundle(t)})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	w := do(t, s, http.MethodPost, "/auth/login", strings.NewReader(`{"username":"alice","password":"x"}`), nil)
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected login response %d %s", w.Code, w.Body.String())
+	}
+	if resp.ExpiresAt <= time.Now().Unix() {
+		t.Errorf("Token already expired: %d", resp.ExpiresAt)
+	}
+	parts := strings.Split(resp.Token, ".")
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Invalid token %s: %v", resp.Token, err)
+	}
+	var decoded map[string]any
+	json.Unmarshal(claims, &decoded)
+	if decoded["username"] != "alice" || decoded["role"] != "admin" {
+		t.Errorf("Unexpected claims %v", decoded)
+	}
+}
+
+func TestServer_Sync(t *testing.T) {
+	dir := testBundle(t)
+	disabled, err := New(Config{BundleDir: dir})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if w := do(t, disabled, http.MethodPost, "/sync/pull", strings.NewReader(`{"client_id":"c"}`), nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without --sync, got %d", w.Code)
+	}
+
+	s, err := New(Config{BundleDir: dir, Sync: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	push := `{"transmission_id":"t1","client_id":"a","records":[
+		{"observation_id":"o1","form_type":"survey","data":{"name":"x"},"created_at":"2025-01-01T00:00:00Z"},
+		{"observation_id":"o2","form_type":"visit","data":{},"created_at":"2025-01-01T00:00:00Z"},
+		{"form_type":"survey","data":{}}]}`
+	w := do(t, s, http.MethodPost, "/sync/push", strings.NewReader(push), nil)
+	var pushed struct {
+		CurrentVersion int64            `json:"current_version"`
+		SuccessCount   int              `json:"success_count"`
+		FailedRecords  []map[string]any `json:"failed_records"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &pushed)
+	if pushed.CurrentVersion != 2 || pushed.SuccessCount != 2 || len(pushed.FailedRecords) != 1 {
+		t.Fatalf("Unexpected push response %s", w.Body.String())
+	}
+
+	pull := func(body string) (records []Observation, hasMore bool, cutoff int64) {
+		w := do(t, s, http.MethodPost, "/sync/pull", strings.NewReader(body), nil)
+		var resp struct {
+			Records      []Observation `json:"records"`
+			HasMore      bool          `json:"has_more"`
+			ChangeCutoff int64         `json:"change_cutoff"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid pull response %s", w.Body.String())
+		}
+		return resp.Records, resp.HasMore, resp.ChangeCutoff
+	}
+	records, hasMore, cutoff := pull(`{"client_id":"b","limit":1}`)
+	if len(records) != 1 || records[0].ObservationID != "o1" || !hasMore || cutoff != 1 {
+		t.Errorf("Unexpected first page %+v %v %d", records, hasMore, cutoff)
+	}
+	records, hasMore, _ = pull(`{"client_id":"b","since":{"version":1}}`)
+	if len(records) != 1 || records[0].ObservationID != "o2" || hasMore {
+		t.Errorf("Unexpected second page %+v", records)
+	}
+	if records, _, _ := pull(`{"client_id":"b","schema_types":["visit"]}`); len(records) != 1 || records[0].FormType != "visit" {
+		t.Errorf("Expected only visit records, got %+v", records)
+	}
+
+	// Uploaded attachments are listed in the attachment manifest and downloadable
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, _ := form.CreateFormFile("file", "photo.jpg")
+	part.Write([]byte("jpeg"))
+	form.Close()
+	w = do(t, s, http.MethodPut, "/attachments/photo.jpg", body, http.Header{"Content-Type": {form.FormDataContentType()}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "created") {
+		t.Fatalf("Unexpected upload response %d %s", w.Code, w.Body.String())
+	}
+	w = do(t, s, http.MethodPost, "/attachments/manifest", strings.NewReader(`{"client_id":"b","since_version":0}`), nil)
+	if !strings.Contains(w.Body.String(), `"attachment_id":"photo.jpg"`) {
+		t.Errorf("Expected the upload in the manifest, got %s", w.Body.String())
+	}
+	if w := do(t, s, http.MethodGet, "/attachments/photo.jpg", nil, nil); w.Body.String() != "jpeg" {
+		t.Errorf("Unexpected attachment content %q", w.Body.String())
+	}
+	if w := do(t, s, http.MethodHead, "/attachments/missing.jpg", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing attachment, got %d", w.Code)
+	}
+}
@@ -0,0 +1,255 @@
+package devserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultPullLimit is the page size of pulls that don't ask for one
+const defaultPullLimit = 50
+
+// Observation is a synced record as the server stores it
+type Observation struct {
+	ObservationID string          `json:"observation_id"`
+	FormType      string          `json:"form_type"`
+	FormVersion   string          `json:"form_version"`
+	Data          json.RawMessage `json:"data"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+	SyncedAt      *string         `json:"synced_at,omitempty"`
+	Deleted       bool            `json:"deleted"`
+	Version       int64           `json:"version"`
+	Geolocation   json.RawMessage `json:"geolocation,omitempty"`
+}
+
+// attachment is an uploaded attachment
+type attachment struct {
+	data        []byte
+	contentType string
+	hash        string
+	version     int64
+}
+
+// store holds the observations and attachments synced with the dev server. It lives in
+// memory only, so every restart begins empty.
+type store struct {
+	mu                sync.Mutex
+	version           int64
+	observations      map[string]Observation
+	attachmentVersion int64
+	attachments       map[string]attachment
+}
+
+func newStore() *store {
+	return &store{
+		observations: make(map[string]Observation),
+		attachments:  make(map[string]attachment),
+	}
+}
+
+// pull returns the observations changed after a version, in version order
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClientID string `json:"client_id"`
+		Since    *struct {
+			Version int64 `json:"version"`
+		} `json:"since"`
+		SchemaTypes []string `json:"schema_types"`
+		Limit       *int     `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if req.ClientID == "" {
+		sendError(w, http.StatusBadRequest, "client_id is required")
+		return
+	}
+	since := int64(0)
+	if req.Since != nil {
+		since = req.Since.Version
+	}
+	limit := defaultPullLimit
+	if req.Limit != nil && *req.Limit > 0 {
+		limit = *req.Limit
+	}
+	formTypes := make(map[string]bool, len(req.SchemaTypes))
+	for _, formType := range req.SchemaTypes {
+		formTypes[formType] = true
+	}
+
+	s.data.mu.Lock()
+	current := s.data.version
+	records := []Observation{}
+	for _, obs := range s.data.observations {
+		if obs.Version > since && (len(formTypes) == 0 || formTypes[obs.FormType]) {
+			records = append(records, obs)
+		}
+	}
+	s.data.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	hasMore := len(records) > limit
+	cutoff := current
+	if hasMore {
+		records = records[:limit]
+		cutoff = records[limit-1].Version
+	}
+	sendJSON(w, http.StatusOK, map[string]any{
+		"current_version": current,
+		"records":         records,
+		"change_cutoff":   cutoff,
+		"has_more":        hasMore,
+	})
+}
+
+// push stores pushed observations, each with the next version
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TransmissionID string        `json:"transmission_id"`
+		ClientID       string        `json:"client_id"`
+		Records        []Observation `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if req.TransmissionID == "" {
+		sendError(w, http.StatusBadRequest, "transmission_id is required")
+		return
+	}
+
+	syncedAt := time.Now().UTC().Format(time.RFC3339)
+	failed := []map[string]any{}
+	success := 0
+
+	s.data.mu.Lock()
+	for i, record := range req.Records {
+		if record.ObservationID == "" {
+			failed = append(failed, map[string]any{"index": i, "error": "observation_id is required", "record": record})
+			continue
+		}
+		if record.UpdatedAt == "" {
+			record.UpdatedAt = record.CreatedAt
+		}
+		s.data.version++
+		record.Version = s.data.version
+		record.SyncedAt = &syncedAt
+		s.data.observations[record.ObservationID] = record
+		success++
+	}
+	current := s.data.version
+	s.data.mu.Unlock()
+
+	response := map[string]any{"current_version": current, "success_count": success}
+	if len(failed) > 0 {
+		response["failed_records"] = failed
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// attachmentManifest lists the attachments uploaded after since_version for download
+func (s *Server) attachmentManifest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClientID     string `json:"client_id"`
+		SinceVersion int64  `json:"since_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	s.data.mu.Lock()
+	operations := []map[string]any{}
+	var total int64
+	for id, a := range s.data.attachments {
+		if a.version <= req.SinceVersion {
+			continue
+		}
+		operations = append(operations, map[string]any{
+			"operation":     "download",
+			"attachment_id": id,
+			"download_url":  "/attachments/" + id,
+			"size":          len(a.data),
+			"content_type":  a.contentType,
+			"version":       a.version,
+			"hash":          a.hash,
+		})
+		total += int64(len(a.data))
+	}
+	current := s.data.attachmentVersion
+	s.data.mu.Unlock()
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i]["version"].(int64) < operations[j]["version"].(int64)
+	})
+	sendJSON(w, http.StatusOK, map[string]any{
+		"current_version":     current,
+		"operations":          operations,
+		"total_download_size": total,
+		"operation_count":     map[string]int{"download": len(operations), "delete": 0},
+	})
+}
+
+// uploadAttachment stores the multipart "file" of an upload
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mimeType(header.Filename)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	id := r.PathValue("attachment_id")
+	s.data.mu.Lock()
+	outcome := "created"
+	if existing, ok := s.data.attachments[id]; ok {
+		outcome = "replaced"
+		if existing.hash == hash {
+			outcome = "unchanged"
+		}
+	}
+	if outcome != "unchanged" {
+		s.data.attachmentVersion++
+		s.data.attachments[id] = attachment{data: data, contentType: contentType, hash: hash, version: s.data.attachmentVersion}
+	}
+	s.data.mu.Unlock()
+
+	sendJSON(w, http.StatusOK, map[string]string{"status": "success", "outcome": outcome, "sha256": hash})
+}
+
+// downloadAttachment serves an uploaded attachment; HEAD checks that it exists
+func (s *Server) downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	s.data.mu.Lock()
+	a, ok := s.data.attachments[r.PathValue("attachment_id")]
+	s.data.mu.Unlock()
+	if !ok {
+		sendError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("ETag", `"`+a.hash+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(a.data))
+}
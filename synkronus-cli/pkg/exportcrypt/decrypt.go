@@ -0,0 +1,505 @@
+package exportcrypt
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+const (
+	// ManifestName is the ZIP entry written by the server describing encrypted columns
+	ManifestName = "encryption.json"
+	// Algorithm is the only encryption scheme currently produced by the server
+	Algorithm = "RSA-OAEP-SHA256+AES-256-GCM"
+	// ValuePrefix marks an encrypted cell value
+	ValuePrefix = "enc:v1:"
+)
+
+var (
+	ErrNoManifest          = errors.New("export does not contain " + ManifestName)
+	ErrUnsupportedScheme   = errors.New("unsupported encryption algorithm")
+	ErrInvalidPrivateKey   = errors.New("invalid private key")
+	ErrFingerprintMismatch = errors.New("private key does not match the export recipient key")
+	ErrSameFile            = errors.New("output file must differ from the export being decrypted")
+)
+
+// Column describes an encrypted column and its original type
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Manifest mirrors the server's encryption.json
+type Manifest struct {
+	Algorithm      string              `json:"algorithm"`
+	KeyFingerprint string              `json:"key_fingerprint"`
+	EncryptedKey   string              `json:"encrypted_key"`
+	Files          map[string][]Column `json:"files"`
+}
+
+// Result summarizes a decryption run
+type Result struct {
+	FilesDecrypted  int
+	ValuesDecrypted int
+}
+
+// LoadPrivateKey reads a PEM-encoded RSA private key (PKCS#8 or PKCS#1)
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found in %s", ErrInvalidPrivateKey, path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: only RSA keys are supported", ErrInvalidPrivateKey)
+		}
+		return rsaKey, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block type %q", ErrInvalidPrivateKey, block.Type)
+	}
+}
+
+// DecryptExport writes a copy of the export ZIP at inputPath to outputPath with
+// all encrypted columns restored to plaintext. The encryption manifest is dropped.
+// The copy is written next to outputPath and only moved there once complete, so a
+// failed run leaves no partial output behind.
+func DecryptExport(inputPath, outputPath string, key *rsa.PrivateKey) (_ *Result, err error) {
+	if same, err := samePath(inputPath, outputPath); err != nil {
+		return nil, err
+	} else if same {
+		return nil, ErrSameFile
+	}
+
+	zr, err := zip.OpenReader(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export: %w", err)
+	}
+	defer zr.Close()
+
+	manifest, err := readManifest(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := unwrapDataKey(manifest, key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	zw := zip.NewWriter(out)
+	result, err := decryptEntries(zw, &zr.Reader, manifest, aead)
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize output: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(out.Name(), outputPath); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return result, nil
+}
+
+// decryptEntries copies the entries of an export to zw, decrypting the encrypted columns
+func decryptEntries(zw *zip.Writer, zr *zip.Reader, manifest *Manifest, aead cipher.AEAD) (*Result, error) {
+	result := &Result{}
+
+	for _, f := range zr.File {
+		if f.Name == ManifestName {
+			continue
+		}
+
+		data, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+
+		columns := manifest.Files[f.Name]
+		if len(columns) > 0 {
+			d := &decrypter{aead: aead}
+			switch {
+			case strings.HasSuffix(f.Name, ".parquet"):
+				data, err = d.decryptParquet(data, columns)
+			case strings.HasSuffix(f.Name, ".csv"):
+				data, err = d.decryptCSV(data, columns)
+			default:
+				err = fmt.Errorf("unsupported file type")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %w", f.Name, err)
+			}
+			result.FilesDecrypted++
+			result.ValuesDecrypted += d.count
+		}
+
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ZIP entry %s: %w", f.Name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write ZIP entry %s: %w", f.Name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// samePath reports whether two paths name the same file
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	if absA == absB {
+		return true, nil
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB), nil
+}
+
+func readManifest(zr *zip.Reader) (*Manifest, error) {
+	for _, f := range zr.File {
+		if f.Name != ManifestName {
+			continue
+		}
+		data, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+		}
+		if m.Algorithm != Algorithm {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, m.Algorithm)
+		}
+		return &m, nil
+	}
+	return nil, ErrNoManifest
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func unwrapDataKey(m *Manifest, key *rsa.PrivateKey) (cipher.AEAD, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	if m.KeyFingerprint != "" && fmt.Sprintf("%x", sum) != m.KeyFingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(m.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted key: %w", err)
+	}
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decrypter decrypts individual cell values and counts them
+type decrypter struct {
+	aead  cipher.AEAD
+	count int
+}
+
+// open returns the JSON plaintext of an encrypted cell
+func (d *decrypter) open(column, value string) ([]byte, error) {
+	if !strings.HasPrefix(value, ValuePrefix) {
+		return nil, fmt.Errorf("value in column %s is not encrypted", column)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, ValuePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value in column %s: %w", column, err)
+	}
+	if len(sealed) < d.aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value in column %s", column)
+	}
+	nonce, ciphertext := sealed[:d.aead.NonceSize()], sealed[d.aead.NonceSize():]
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value in column %s: %w", column, err)
+	}
+	d.count++
+	return plaintext, nil
+}
+
+// openText returns the decrypted value as display text
+func (d *decrypter) openText(column, value string) (string, error) {
+	plaintext, err := d.open(column, value)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := json.Unmarshal(plaintext, &s); err == nil {
+		return s, nil
+	}
+	return string(plaintext), nil
+}
+
+func (d *decrypter) decryptCSV(data []byte, columns []Column) ([]byte, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return data, nil
+	}
+
+	encrypted := make(map[int]string)
+	for i, name := range rows[0] {
+		for _, col := range columns {
+			if col.Name == name {
+				encrypted[i] = name
+			}
+		}
+	}
+
+	for _, row := range rows[1:] {
+		for i, name := range encrypted {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			if row[i], err = d.openText(name, row[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *decrypter) decryptParquet(data []byte, columns []Column) ([]byte, error) {
+	mem := memory.NewGoAllocator()
+
+	pf, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet: %w", err)
+	}
+	defer pf.Close()
+
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, mem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet: %w", err)
+	}
+
+	table, err := fr.ReadTable(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet: %w", err)
+	}
+	defer table.Release()
+
+	colTypes := make(map[string]string, len(columns))
+	for _, col := range columns {
+		colTypes[col.Name] = col.Type
+	}
+
+	fields := make([]arrow.Field, 0, table.NumCols())
+	arrays := make([]arrow.Array, 0, table.NumCols())
+	defer func() {
+		for _, a := range arrays {
+			a.Release()
+		}
+	}()
+
+	for i := 0; i < int(table.NumCols()); i++ {
+		col := table.Column(i)
+		field := table.Schema().Field(i)
+
+		sqlType, encrypted := colTypes[field.Name]
+		if !encrypted {
+			merged, err := concatChunks(field.Type, col.Data().Chunks(), mem)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+			arrays = append(arrays, merged)
+			continue
+		}
+
+		arr, dt, err := d.decryptColumn(field.Name, sqlType, col.Data().Chunks(), mem)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, arrow.Field{Name: field.Name, Type: dt, Nullable: true})
+		arrays = append(arrays, arr)
+	}
+
+	schema := arrow.NewSchema(fields, nil)
+	record := array.NewRecord(schema, arrays, table.NumRows())
+	defer record.Release()
+
+	buf := &bytes.Buffer{}
+	writer, err := pqarrow.NewFileWriter(schema, buf, parquet.NewWriterProperties(), pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+	if err := writer.Write(record); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to write parquet: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write parquet: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// concatChunks merges column chunks into a single array
+func concatChunks(dt arrow.DataType, chunks []arrow.Array, mem memory.Allocator) (arrow.Array, error) {
+	switch len(chunks) {
+	case 0:
+		b := array.NewBuilder(mem, dt)
+		defer b.Release()
+		return b.NewArray(), nil
+	case 1:
+		chunks[0].Retain()
+		return chunks[0], nil
+	default:
+		return array.Concatenate(chunks, mem)
+	}
+}
+
+// decryptColumn rebuilds an encrypted string column with its original type
+func (d *decrypter) decryptColumn(name, sqlType string, chunks []arrow.Array, mem memory.Allocator) (arrow.Array, arrow.DataType, error) {
+	var dt arrow.DataType
+	switch sqlType {
+	case "numeric":
+		dt = arrow.PrimitiveTypes.Float64
+	case "boolean":
+		dt = arrow.FixedWidthTypes.Boolean
+	default:
+		dt = arrow.BinaryTypes.String
+	}
+
+	builder := array.NewBuilder(mem, dt)
+	defer builder.Release()
+
+	for _, chunk := range chunks {
+		strs, ok := chunk.(*array.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("encrypted column %s is not a string column", name)
+		}
+		for i := 0; i < strs.Len(); i++ {
+			if strs.IsNull(i) {
+				builder.AppendNull()
+				continue
+			}
+
+			switch b := builder.(type) {
+			case *array.Float64Builder:
+				plaintext, err := d.open(name, strs.Value(i))
+				if err != nil {
+					return nil, nil, err
+				}
+				var v float64
+				if err := json.Unmarshal(plaintext, &v); err != nil {
+					b.AppendNull()
+					continue
+				}
+				b.Append(v)
+			case *array.BooleanBuilder:
+				plaintext, err := d.open(name, strs.Value(i))
+				if err != nil {
+					return nil, nil, err
+				}
+				var v bool
+				if err := json.Unmarshal(plaintext, &v); err != nil {
+					b.AppendNull()
+					continue
+				}
+				b.Append(v)
+			case *array.StringBuilder:
+				v, err := d.openText(name, strs.Value(i))
+				if err != nil {
+					return nil, nil, err
+				}
+				b.Append(v)
+			}
+		}
+	}
+
+	return builder.NewArray(), dt, nil
+}
@@ -0,0 +1,360 @@
+package exportcrypt
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+// exportEncryptor encrypts values the way the server's dataexport package does: a random
+// AES-256-GCM data key wrapped with RSA-OAEP-SHA256, and each value sealed as JSON with
+// its column name as additional data
+type exportEncryptor struct {
+	t        *testing.T
+	aead     cipher.AEAD
+	manifest Manifest
+}
+
+func newExportEncryptor(t *testing.T, pub *rsa.PublicKey) *exportEncryptor {
+	t.Helper()
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, dataKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+
+	return &exportEncryptor{
+		t:    t,
+		aead: aead,
+		manifest: Manifest{
+			Algorithm:      Algorithm,
+			KeyFingerprint: hex.EncodeToString(sum[:]),
+			EncryptedKey:   base64.StdEncoding.EncodeToString(wrapped),
+			Files:          map[string][]Column{},
+		},
+	}
+}
+
+func (e *exportEncryptor) encrypt(column string, value any) string {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		e.t.Fatal(err)
+	}
+	return ValuePrefix + base64.StdEncoding.EncodeToString(e.aead.Seal(nonce, nonce, plaintext, []byte(column)))
+}
+
+// surveyParquet builds a Parquet export whose name, age and consent columns are encrypted
+func (e *exportEncryptor) surveyParquet() []byte {
+	e.t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "observation_id", Type: arrow.BinaryTypes.String},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "age", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "consent", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).AppendValues([]string{"obs-1", "obs-2"}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{e.encrypt("name", "Amina"), ""}, []bool{true, false})
+	b.Field(2).(*array.StringBuilder).AppendValues([]string{e.encrypt("age", 41.5), e.encrypt("age", 7)}, nil)
+	b.Field(3).(*array.StringBuilder).AppendValues([]string{e.encrypt("consent", true), e.encrypt("consent", false)}, nil)
+	record := b.NewRecord()
+	defer record.Release()
+
+	buf := &bytes.Buffer{}
+	w, err := pqarrow.NewFileWriter(schema, buf, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	if err != nil {
+		e.t.Fatalf("Failed to create parquet writer: %v", err)
+	}
+	if err := w.Write(record); err != nil {
+		e.t.Fatalf("Failed to write parquet: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		e.t.Fatalf("Failed to close parquet writer: %v", err)
+	}
+	e.manifest.Files["survey.parquet"] = []Column{{Name: "name", Type: "text"}, {Name: "age", Type: "numeric"}, {Name: "consent", Type: "boolean"}}
+	return buf.Bytes()
+}
+
+// householdCSV builds a CSV export whose head column is encrypted
+func (e *exportEncryptor) householdCSV() []byte {
+	e.manifest.Files["household.csv"] = []Column{{Name: "head", Type: "text"}}
+	return []byte("observation_id,head,size\nobs-3," + e.encrypt("head", "Joseph") + ",4\nobs-4,,2\n")
+}
+
+// writeExport writes a ZIP with the given entries, in order
+func writeExport(t *testing.T, path string, entries [][2]string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encryptedExport writes an encrypted export for key and returns its path
+func encryptedExport(t *testing.T, dir string, key *rsa.PrivateKey) string {
+	t.Helper()
+	e := newExportEncryptor(t, &key.PublicKey)
+	parquetData := e.surveyParquet()
+	csvData := e.householdCSV()
+	manifest, err := json.Marshal(e.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "export.zip")
+	writeExport(t, path, [][2]string{
+		{"survey.parquet", string(parquetData)},
+		{"household.csv", string(csvData)},
+		{"README.txt", "Survey export"},
+		{ManifestName, string(manifest)},
+	})
+	return path
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// readOutput returns the entries of a ZIP by name
+func readOutput(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer zr.Close()
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		data, err := readEntry(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[f.Name] = data
+	}
+	return entries
+}
+
+// assertNoOutput checks that a failed run left nothing in dir besides the input
+func assertNoOutput(t *testing.T, dir, input string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if filepath.Join(dir, entry.Name()) != input {
+			t.Errorf("failed run left %s behind", entry.Name())
+		}
+	}
+}
+
+func TestDecryptExport(t *testing.T) {
+	dir := t.TempDir()
+	key := generateKey(t)
+	input := encryptedExport(t, dir, key)
+	output := filepath.Join(dir, "decrypted.zip")
+
+	result, err := DecryptExport(input, output, key)
+	if err != nil {
+		t.Fatalf("DecryptExport: %v", err)
+	}
+	if result.FilesDecrypted != 2 || result.ValuesDecrypted != 6 {
+		t.Errorf("result = %+v, want 2 files and 6 values", result)
+	}
+
+	entries := readOutput(t, output)
+	if _, ok := entries[ManifestName]; ok {
+		t.Errorf("output still contains %s", ManifestName)
+	}
+	if got := string(entries["README.txt"]); got != "Survey export" {
+		t.Errorf("README.txt = %q", got)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(entries["household.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read household.csv: %v", err)
+	}
+	want := [][]string{{"observation_id", "head", "size"}, {"obs-3", "Joseph", "4"}, {"obs-4", "", "2"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("household.csv = %q, want %q", rows, want)
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(entries["survey.parquet"]))
+	if err != nil {
+		t.Fatalf("Failed to read survey.parquet: %v", err)
+	}
+	defer pf.Close()
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.NewGoAllocator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := fr.ReadTable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Release()
+
+	name := table.Column(1).Data().Chunk(0).(*array.String)
+	if name.Value(0) != "Amina" || !name.IsNull(1) {
+		t.Errorf("name = %v", name)
+	}
+	age, ok := table.Column(2).Data().Chunk(0).(*array.Float64)
+	if !ok || age.Value(0) != 41.5 || age.Value(1) != 7 {
+		t.Errorf("age = %v, want numeric 41.5 and 7", table.Column(2).Data().Chunk(0))
+	}
+	consent, ok := table.Column(3).Data().Chunk(0).(*array.Boolean)
+	if !ok || !consent.Value(0) || consent.Value(1) {
+		t.Errorf("consent = %v, want booleans true and false", table.Column(3).Data().Chunk(0))
+	}
+}
+
+func TestDecryptExport_WrongKey(t *testing.T) {
+	dir := t.TempDir()
+	input := encryptedExport(t, dir, generateKey(t))
+
+	_, err := DecryptExport(input, filepath.Join(dir, "decrypted.zip"), generateKey(t))
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("error = %v, want ErrFingerprintMismatch", err)
+	}
+	assertNoOutput(t, dir, input)
+}
+
+func TestDecryptExport_NoManifest(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "export.zip")
+	writeExport(t, input, [][2]string{{"household.csv", "observation_id\nobs-1\n"}})
+
+	_, err := DecryptExport(input, filepath.Join(dir, "decrypted.zip"), generateKey(t))
+	if !errors.Is(err, ErrNoManifest) {
+		t.Errorf("error = %v, want ErrNoManifest", err)
+	}
+	assertNoOutput(t, dir, input)
+}
+
+func TestDecryptExport_TamperedValue(t *testing.T) {
+	dir := t.TempDir()
+	key := generateKey(t)
+	e := newExportEncryptor(t, &key.PublicKey)
+	csvData := string(e.householdCSV())
+	manifest, err := json.Marshal(e.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a character of the sealed value; GCM authentication must catch it
+	i := strings.Index(csvData, ValuePrefix) + len(ValuePrefix) + 20
+	tampered := csvData[:i] + string(csvData[i]^1) + csvData[i+1:]
+	input := filepath.Join(dir, "export.zip")
+	writeExport(t, input, [][2]string{{"household.csv", tampered}, {ManifestName, string(manifest)}})
+
+	_, err = DecryptExport(input, filepath.Join(dir, "decrypted.zip"), key)
+	if err == nil || !strings.Contains(err.Error(), "household.csv") {
+		t.Errorf("error = %v, want a decryption failure of household.csv", err)
+	}
+	assertNoOutput(t, dir, input)
+}
+
+func TestDecryptExport_SameFile(t *testing.T) {
+	dir := t.TempDir()
+	key := generateKey(t)
+	input := encryptedExport(t, dir, key)
+	before, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecryptExport(input, filepath.Join(dir, ".", "export.zip"), key); !errors.Is(err, ErrSameFile) {
+		t.Errorf("error = %v, want ErrSameFile", err)
+	}
+	after, err := os.ReadFile(input)
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("export was modified")
+	}
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+	key := generateKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := filepath.Join(dir, "pkcs8.pem")
+	os.WriteFile(pkcs8, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	pkcs1 := filepath.Join(dir, "pkcs1.pem")
+	os.WriteFile(pkcs1, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+
+	for _, path := range []string{pkcs8, pkcs1} {
+		loaded, err := LoadPrivateKey(path)
+		if err != nil || !loaded.Equal(key) {
+			t.Errorf("LoadPrivateKey(%s) = %v", filepath.Base(path), err)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	os.WriteFile(invalid, []byte("not a key"), 0600)
+	if _, err := LoadPrivateKey(invalid); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("error = %v, want ErrInvalidPrivateKey", err)
+	}
+}
@@ -0,0 +1,406 @@
+// Package exportinspect reads downloaded export archives locally and summarizes their
+// tables: a typed preview of the first rows and per-column null counts and ranges.
+package exportinspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+// ErrFormTypeNotFound is returned when the archive has no table for the requested form type
+var ErrFormTypeNotFound = errors.New("form type not found in export")
+
+// Column types
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeNumber    = "number"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+)
+
+// Options selects what is inspected
+type Options struct {
+	// FormType limits the inspection to one table; empty inspects all of them
+	FormType string
+	// Head is the number of rows previewed per table
+	Head int
+	// Columns limits the preview and stats to these columns, in this order
+	Columns []string
+	// Filters keeps only rows whose column has the given value, as displayed
+	Filters map[string]string
+}
+
+// Column is a column of a table with its statistics over the matching rows
+type Column struct {
+	Name  string
+	Type  string
+	Nulls int
+	// Min and Max are nil when the column has no values
+	Min interface{}
+	Max interface{}
+}
+
+// Table is one form type's data file
+type Table struct {
+	File     string
+	FormType string
+	Columns  []Column
+	// Rows holds the first Head matching rows; a nil value is null
+	Rows [][]interface{}
+	// Total is the number of rows in the file, Matched the number passing the filters
+	Total   int
+	Matched int
+}
+
+// Inspect reads the Parquet and CSV files of an export archive
+func Inspect(archivePath string, opts Options) ([]*Table, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export: %w", err)
+	}
+	defer zr.Close()
+
+	var tables []*Table
+	for _, f := range zr.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".parquet" && ext != ".csv" {
+			continue
+		}
+		formType := strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		if opts.FormType != "" && formType != opts.FormType {
+			continue
+		}
+
+		data, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		var columns []Column
+		var rows [][]interface{}
+		if ext == ".parquet" {
+			columns, rows, err = readParquet(data)
+		} else {
+			columns, rows, err = readCSV(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+
+		table, err := summarize(columns, rows, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		table.File, table.FormType = f.Name, formType
+		tables = append(tables, table)
+	}
+
+	if opts.FormType != "" && len(tables) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFormTypeNotFound, opts.FormType)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].FormType < tables[j].FormType })
+	return tables, nil
+}
+
+// summarize selects columns, filters rows and computes the statistics
+func summarize(columns []Column, rows [][]interface{}, opts Options) (*Table, error) {
+	index := make(map[string]int, len(columns))
+	for i, col := range columns {
+		index[col.Name] = i
+	}
+
+	selected := make([]int, 0, len(columns))
+	if len(opts.Columns) == 0 {
+		for i := range columns {
+			selected = append(selected, i)
+		}
+	}
+	for _, name := range opts.Columns {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s", name)
+		}
+		selected = append(selected, i)
+	}
+
+	filters := make(map[int]string, len(opts.Filters))
+	for name, value := range opts.Filters {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter column %s", name)
+		}
+		filters[i] = value
+	}
+
+	table := &Table{Total: len(rows), Rows: [][]interface{}{}}
+	for _, i := range selected {
+		table.Columns = append(table.Columns, Column{Name: columns[i].Name, Type: columns[i].Type})
+	}
+
+rows:
+	for _, row := range rows {
+		for i, want := range filters {
+			if FormatValue(row[i]) != want {
+				continue rows
+			}
+		}
+		table.Matched++
+
+		preview := make([]interface{}, len(selected))
+		for j, i := range selected {
+			value := row[i]
+			preview[j] = value
+			col := &table.Columns[j]
+			if value == nil {
+				col.Nulls++
+				continue
+			}
+			if col.Min == nil || less(value, col.Min) {
+				col.Min = value
+			}
+			if col.Max == nil || less(col.Max, value) {
+				col.Max = value
+			}
+		}
+		if len(table.Rows) < opts.Head {
+			table.Rows = append(table.Rows, preview)
+		}
+	}
+	return table, nil
+}
+
+// less orders two non-null values of the same column
+func less(a, b interface{}) bool {
+	switch a := a.(type) {
+	case int64:
+		return a < b.(int64)
+	case float64:
+		return a < b.(float64)
+	case bool:
+		return !a && b.(bool)
+	case time.Time:
+		return a.Before(b.(time.Time))
+	case string:
+		return a < b.(string)
+	}
+	return FormatValue(a) < FormatValue(b)
+}
+
+// FormatValue renders a value for display; null is empty
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// readParquet reads all rows of a Parquet file with their Arrow types
+func readParquet(data []byte) ([]Column, [][]interface{}, error) {
+	pf, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pf.Close()
+
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.NewGoAllocator())
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := fr.ReadTable(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer table.Release()
+
+	columns := make([]Column, table.NumCols())
+	for i, field := range table.Schema().Fields() {
+		columns[i] = Column{Name: field.Name, Type: arrowType(field.Type)}
+	}
+
+	rows := make([][]interface{}, 0, table.NumRows())
+	reader := array.NewTableReader(table, 1024)
+	defer reader.Release()
+	for reader.Next() {
+		record := reader.Record()
+		for r := 0; r < int(record.NumRows()); r++ {
+			row := make([]interface{}, record.NumCols())
+			for c := range row {
+				row[c] = arrowValue(record.Column(c), r)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return columns, rows, nil
+}
+
+func arrowType(dt arrow.DataType) string {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return TypeInteger
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64, arrow.DECIMAL128, arrow.DECIMAL256:
+		return TypeNumber
+	case arrow.BOOL:
+		return TypeBoolean
+	case arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return TypeTimestamp
+	}
+	return TypeString
+}
+
+func arrowValue(arr arrow.Array, i int) interface{} {
+	if arr.IsNull(i) {
+		return nil
+	}
+	switch a := arr.(type) {
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Int32:
+		return int64(a.Value(i))
+	case *array.Int16:
+		return int64(a.Value(i))
+	case *array.Int8:
+		return int64(a.Value(i))
+	case *array.Uint32:
+		return int64(a.Value(i))
+	case *array.Uint16:
+		return int64(a.Value(i))
+	case *array.Uint8:
+		return int64(a.Value(i))
+	case *array.Float64:
+		return a.Value(i)
+	case *array.Float32:
+		return float64(a.Value(i))
+	case *array.Boolean:
+		return a.Value(i)
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return a.Value(i).ToTime(unit).UTC()
+	case *array.Date32:
+		return a.Value(i).ToTime().UTC()
+	case *array.Date64:
+		return a.Value(i).ToTime().UTC()
+	}
+	// Other types (unsigned 64-bit, decimals, nested values) are kept as text
+	return arr.ValueStr(i)
+}
+
+// readCSV reads a CSV file with a header row, inferring each column's type from its
+// values; empty cells are null
+func readCSV(data []byte) ([]Column, [][]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return []Column{}, nil, nil
+	}
+
+	header := records[0]
+	columns := make([]Column, len(header))
+	for c, name := range header {
+		columns[c] = Column{Name: name, Type: inferType(records[1:], c)}
+	}
+
+	rows := make([][]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make([]interface{}, len(header))
+		for c := range header {
+			if c < len(record) && record[c] != "" {
+				row[c] = parseValue(record[c], columns[c].Type)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// inferType picks the narrowest type all non-empty values of a CSV column parse as
+func inferType(records [][]string, c int) string {
+	candidates := []string{TypeInteger, TypeNumber, TypeBoolean, TypeTimestamp}
+	seen := false
+	for _, record := range records {
+		if c >= len(record) || record[c] == "" {
+			continue
+		}
+		seen = true
+		kept := candidates[:0]
+		for _, t := range candidates {
+			if parseValue(record[c], t) != nil {
+				kept = append(kept, t)
+			}
+		}
+		candidates = kept
+		if len(candidates) == 0 {
+			return TypeString
+		}
+	}
+	if !seen {
+		return TypeString
+	}
+	return candidates[0]
+}
+
+// parseValue converts a CSV cell to a value of the type, or nil when it doesn't parse
+func parseValue(s, t string) interface{} {
+	switch t {
+	case TypeInteger:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case TypeNumber:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case TypeBoolean:
+		if v, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+			return v
+		}
+	case TypeTimestamp:
+		if v, err := time.Parse(time.RFC3339, s); err == nil {
+			return v.UTC()
+		}
+	case TypeString:
+		return s
+	}
+	return nil
+}
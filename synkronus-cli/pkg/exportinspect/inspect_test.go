@@ -0,0 +1,141 @@
+package exportinspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+// surveyParquet builds a Parquet file shaped like the server's exports
+func surveyParquet(t *testing.T) []byte {
+	t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "observation_id", Type: arrow.BinaryTypes.String},
+		{Name: "version", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "deleted", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "age", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).AppendValues([]string{"obs-1", "obs-2", "obs-3"}, nil)
+	b.Field(1).(*array.Int64Builder).AppendValues([]int64{12, 7, 30}, nil)
+	b.Field(2).(*array.BooleanBuilder).AppendValues([]bool{false, false, true}, nil)
+	b.Field(3).(*array.Float64Builder).AppendValues([]float64{41.5, 0, 19}, []bool{true, false, true})
+	record := b.NewRecord()
+	defer record.Release()
+
+	buf := &bytes.Buffer{}
+	w, err := pqarrow.NewFileWriter(schema, buf, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("Failed to create parquet writer: %v", err)
+	}
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write parquet: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close parquet writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func writeExport(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create export: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create entry: %v", err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write export: %v", err)
+	}
+	return path
+}
+
+func TestInspect(t *testing.T) {
+	path := writeExport(t, map[string][]byte{
+		"survey.parquet":  surveyParquet(t),
+		"visit.csv":       []byte("observation_id,visited_at,score,done\nv-1,2025-01-02T10:00:00Z,3,true\nv-2,,4.5,false\n"),
+		"encryption.json": []byte(`{}`),
+	})
+
+	tables, err := Inspect(path, Options{Head: 2})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if len(tables) != 2 || tables[0].FormType != "survey" || tables[1].FormType != "visit" {
+		t.Fatalf("Unexpected tables %+v", tables)
+	}
+
+	survey := tables[0]
+	if survey.Total != 3 || survey.Matched != 3 || len(survey.Rows) != 2 {
+		t.Errorf("Expected 3 rows with 2 previewed, got %d/%d/%d", survey.Total, survey.Matched, len(survey.Rows))
+	}
+	version, age := survey.Columns[1], survey.Columns[3]
+	if version.Type != TypeInteger || version.Min != int64(7) || version.Max != int64(30) {
+		t.Errorf("Unexpected version column %+v", version)
+	}
+	if age.Type != TypeNumber || age.Nulls != 1 || age.Min != 19.0 || age.Max != 41.5 {
+		t.Errorf("Unexpected age column %+v", age)
+	}
+	if survey.Rows[1][3] != nil {
+		t.Errorf("Expected a null age, got %v", survey.Rows[1][3])
+	}
+
+	visit := tables[1]
+	wantTypes := []string{TypeString, TypeTimestamp, TypeNumber, TypeBoolean}
+	for i, col := range visit.Columns {
+		if col.Type != wantTypes[i] {
+			t.Errorf("Column %s: expected type %s, got %s", col.Name, wantTypes[i], col.Type)
+		}
+	}
+	if visit.Columns[1].Nulls != 1 || visit.Columns[1].Min != time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC) {
+		t.Errorf("Unexpected visited_at column %+v", visit.Columns[1])
+	}
+}
+
+func TestInspect_FilterAndColumns(t *testing.T) {
+	path := writeExport(t, map[string][]byte{"survey.parquet": surveyParquet(t)})
+
+	tables, err := Inspect(path, Options{
+		FormType: "survey",
+		Head:     10,
+		Columns:  []string{"version", "observation_id"},
+		Filters:  map[string]string{"deleted": "false"},
+	})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	table := tables[0]
+	if table.Matched != 2 || len(table.Columns) != 2 || table.Columns[0].Name != "version" {
+		t.Fatalf("Unexpected table %+v", table)
+	}
+	if table.Columns[0].Max != int64(12) || table.Rows[1][1] != "obs-2" {
+		t.Errorf("Expected stats over the matching rows only, got %+v %v", table.Columns[0], table.Rows)
+	}
+
+	if _, err := Inspect(path, Options{FormType: "household"}); !errors.Is(err, ErrFormTypeNotFound) {
+		t.Errorf("Expected ErrFormTypeNotFound, got %v", err)
+	}
+	if _, err := Inspect(path, Options{Columns: []string{"missing"}}); err == nil {
+		t.Error("Expected an unknown column error")
+	}
+}
@@ -0,0 +1,233 @@
+// Package httplog traces the HTTP requests the CLI makes, in the style of curl -v: the
+// request and status lines, headers with credentials redacted, the proxy used, connection
+// and TLS details, and timings. It is meant for diagnosing proxy and TLS problems.
+package httplog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedHeaders carry credentials and are logged without their values
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// redactedParams are query parameters whose values are credentials, e.g. in signed URLs
+var redactedParams = []string{"token", "signature", "sig", "key", "secret", "password", "credential"}
+
+const redacted = "[redacted]"
+
+// Transport is an http.RoundTripper that logs every request it sends through Base
+type Transport struct {
+	Base http.RoundTripper
+	Out  io.Writer
+
+	mu sync.Mutex
+}
+
+// NewTransport returns a Transport logging to out; a nil base uses http.DefaultTransport
+func NewTransport(base http.RoundTripper, out io.Writer) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Out: out}
+}
+
+// Enable traces every request made through http.DefaultTransport, which the CLI's clients
+// and http.DefaultClient use, to out
+func Enable(out io.Writer) {
+	if _, ok := http.DefaultTransport.(*Transport); ok {
+		return
+	}
+	http.DefaultTransport = NewTransport(http.DefaultTransport, out)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Dials run in their own goroutines and may report after the response arrived
+	var linesMu sync.Mutex
+	var lines []string
+	done := false
+	started := map[string]time.Time{} // When the DNS lookup and each dial started
+	mark := func(step string) {
+		linesMu.Lock()
+		defer linesMu.Unlock()
+		started[step] = time.Now()
+	}
+	took := func(step string) time.Duration {
+		linesMu.Lock()
+		defer linesMu.Unlock()
+		return since(started[step])
+	}
+	add := func(format string, a ...any) {
+		linesMu.Lock()
+		defer linesMu.Unlock()
+		if !done {
+			lines = append(lines, fmt.Sprintf(format, a...))
+		}
+	}
+	flush := func() {
+		linesMu.Lock()
+		done = true
+		out := lines
+		linesMu.Unlock()
+		t.write(out)
+	}
+
+	add("> %s %s", req.Method, RedactURL(req.URL))
+	for _, line := range headerLines(req.Header) {
+		add("> %s", line)
+	}
+	if base, ok := t.Base.(*http.Transport); ok && base.Proxy != nil {
+		if proxy, err := base.Proxy(req); err == nil && proxy != nil {
+			add("* via proxy %s", RedactURL(proxy))
+		}
+	}
+
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mark("dns") },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				add("* DNS lookup failed after %s: %v", took("dns"), info.Err)
+				return
+			}
+			add("* DNS lookup took %s", took("dns"))
+		},
+		ConnectStart: func(network, addr string) { mark(addr) },
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				add("* connecting to %s failed after %s: %v", addr, took(addr), err)
+				return
+			}
+			add("* connected to %s in %s", addr, took(addr))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				add("* reusing connection to %s", info.Conn.RemoteAddr())
+			}
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				add("* TLS handshake failed: %v", err)
+				return
+			}
+			add("* %s", describeTLS(state))
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		add("! %s %s failed after %s: %v", req.Method, RedactURL(req.URL), since(start), err)
+		flush()
+		return nil, err
+	}
+
+	add("< %s %s (%s)", resp.Proto, resp.Status, since(start))
+	for _, line := range headerLines(resp.Header) {
+		add("< %s", line)
+	}
+	flush()
+	return resp, nil
+}
+
+// write prints the lines of one request together, so concurrent requests don't interleave
+func (t *Transport) write(lines []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(t.Out, strings.Join(lines, "\n"))
+}
+
+// headerLines formats headers sorted by name, with credentials redacted
+func headerLines(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		for _, value := range header[name] {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, RedactHeader(name, value)))
+		}
+	}
+	return lines
+}
+
+// RedactHeader returns the value of a header as it is logged; credentials keep only their
+// scheme, e.g. "Bearer [redacted]"
+func RedactHeader(name, value string) string {
+	name = http.CanonicalHeaderKey(name)
+	if !redactedHeaders[name] {
+		return value
+	}
+	if scheme, _, ok := strings.Cut(value, " "); ok && (name == "Authorization" || name == "Proxy-Authorization") {
+		return scheme + " " + redacted
+	}
+	return redacted
+}
+
+// RedactURL returns u without its password and the values of credential query parameters
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	clean := *u
+	if _, ok := clean.User.Password(); ok {
+		clean.User = url.UserPassword(clean.User.Username(), "xxxxx")
+	}
+	if clean.RawQuery != "" {
+		query := clean.Query()
+		changed := false
+		for name := range query {
+			if isCredentialParam(name) {
+				query.Set(name, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			clean.RawQuery = query.Encode()
+		}
+	}
+	return clean.String()
+}
+
+func isCredentialParam(name string) bool {
+	lower := strings.ToLower(name)
+	for _, param := range redactedParams {
+		if strings.Contains(lower, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTLS summarizes a TLS connection and the server certificate
+func describeTLS(state tls.ConnectionState) string {
+	description := fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		description += fmt.Sprintf(", certificate %q issued by %q, valid until %s",
+			cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format(time.DateOnly))
+	}
+	return description
+}
+
+func since(start time.Time) time.Duration {
+	return time.Since(start).Round(time.Millisecond)
+}
@@ -0,0 +1,227 @@
+package provisioning
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	qrcode "github.com/yeqown/go-qrcode/v2"
+	"github.com/yeqown/go-qrcode/writer/standard"
+)
+
+// Status of an imported user
+const (
+	StatusCreated = "created"
+	StatusFailed  = "failed"
+	StatusPlanned = "planned" // Dry run: validated but not sent to the server
+)
+
+// Result is the outcome of importing one entry
+type Result struct {
+	Entry
+	Status string
+	Error  string
+}
+
+// BundleOptions control what goes into the provisioning zip
+type BundleOptions struct {
+	ServerURL string    // Server the users log in to; printed on the cards and encoded in QR codes
+	QR        bool      // Include a Formulus QR code per created user
+	CreatedAt time.Time // Printed on the cards
+}
+
+// WriteBundle writes the provisioning zip:
+//
+//	credentials.csv   every row of the import with its status; passwords of created users only
+//	provisioning.pdf  a printable login card per created user
+//	qr/<username>.png the Formulus QR code per created user (with opts.QR)
+func WriteBundle(w io.Writer, results []Result, opts BundleOptions) error {
+	zw := zip.NewWriter(w)
+
+	var created []Result
+	for _, r := range results {
+		if r.Status == StatusCreated {
+			created = append(created, r)
+		}
+	}
+
+	qrImages := make(map[string][]byte)
+	if opts.QR {
+		for _, r := range created {
+			png, err := qrPNG(EncodeFRMLS(1, opts.ServerURL, r.Username, r.Password))
+			if err != nil {
+				return fmt.Errorf("failed to create QR code for %s: %w", r.Username, err)
+			}
+			qrImages[r.Username] = png
+		}
+	}
+
+	f, err := zw.Create("credentials.csv")
+	if err != nil {
+		return err
+	}
+	if err := writeCredentialsCSV(f, results); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("provisioning.pdf")
+	if err != nil {
+		return err
+	}
+	if err := writeCardsPDF(f, created, qrImages, opts); err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool)
+	for _, r := range created {
+		png, ok := qrImages[r.Username]
+		if !ok {
+			continue
+		}
+		name := fileName(r.Username)
+		for i := 2; taken[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s_%d", fileName(r.Username), i)
+		}
+		taken[strings.ToLower(name)] = true
+		f, err := zw.Create("qr/" + name + ".png")
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(png); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeCredentialsCSV writes one row per result
+func writeCredentialsCSV(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"username", "role", "email", "password", "status", "error"}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		password := ""
+		if r.Status == StatusCreated {
+			password = r.Password
+		}
+		if err := writer.Write([]string{r.Username, r.Role, r.Email, password, r.Status, r.Error}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Card layout on an A4 page, in millimeters: two columns of three cards
+const (
+	cardColumns = 2
+	cardRows    = 3
+	cardWidth   = 90.0
+	cardHeight  = 88.0
+	cardMarginX = 12.0
+	cardMarginY = 12.0
+	cardGap     = 6.0
+	qrSize      = 48.0
+)
+
+// writeCardsPDF writes a login card per user, to be printed and cut out
+func writeCardsPDF(w io.Writer, results []Result, qrImages map[string][]byte, opts BundleOptions) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Synkronus user provisioning", true)
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	if len(results) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.Text(cardMarginX, cardMarginY+10, "No users were created.")
+	}
+
+	perPage := cardColumns * cardRows
+	for i, r := range results {
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+		slot := i % perPage
+		x := cardMarginX + float64(slot%cardColumns)*(cardWidth+cardGap)
+		y := cardMarginY + float64(slot/cardColumns)*(cardHeight+cardGap)
+
+		pdf.SetDrawColor(160, 160, 160)
+		pdf.SetDashPattern([]float64{2, 2}, 0)
+		pdf.Rect(x, y, cardWidth, cardHeight, "D")
+		pdf.SetDashPattern([]float64{}, 0)
+
+		pdf.SetXY(x+5, y+5)
+		pdf.SetFont("Helvetica", "B", 13)
+		pdf.CellFormat(cardWidth-10, 7, tr(r.Username), "", 2, "L", false, 0, "")
+
+		pdf.SetFont("Helvetica", "", 9)
+		lines := []string{
+			"Server: " + opts.ServerURL,
+			"Password: " + r.Password,
+			"Role: " + r.Role,
+		}
+		for _, line := range lines {
+			pdf.SetX(x + 5)
+			pdf.CellFormat(cardWidth-10, 5, tr(line), "", 2, "L", false, 0, "")
+		}
+
+		if png, ok := qrImages[r.Username]; ok {
+			name := fmt.Sprintf("qr-%d", i)
+			pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+			pdf.ImageOptions(name, x+(cardWidth-qrSize)/2, y+28, qrSize, qrSize, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.SetXY(x+5, y+cardHeight-10)
+			pdf.SetFont("Helvetica", "I", 7)
+			pdf.CellFormat(cardWidth-10, 4, "Scan in Formulus to configure the app", "", 2, "C", false, 0, "")
+		}
+
+		if !opts.CreatedAt.IsZero() {
+			pdf.SetXY(x+5, y+cardHeight-6)
+			pdf.SetFont("Helvetica", "", 6)
+			pdf.CellFormat(cardWidth-10, 3, "Issued "+opts.CreatedAt.Format("2006-01-02"), "", 2, "R", false, 0, "")
+		}
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to build provisioning PDF: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// qrPNG renders content as a QR code PNG
+func qrPNG(content string) ([]byte, error) {
+	qrc, err := qrcode.New(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := qrc.Save(standard.NewWithWriter(nopCloser{&buf}, standard.WithQRWidth(10), standard.WithBuiltinImageEncoder(standard.PNG_FORMAT))); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nopCloser lets the QR writer write into a buffer
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// fileName makes a username safe to use as a file name
+func fileName(username string) string {
+	out := []rune(username)
+	for i, r := range out {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
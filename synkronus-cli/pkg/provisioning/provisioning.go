@@ -0,0 +1,193 @@
+// Package provisioning onboards users in bulk: it reads a user CSV, generates initial
+// passwords and packages the credentials, Formulus QR codes and a printable sheet of
+// login cards into a single zip.
+package provisioning
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidCSV is returned for a user CSV that can't be imported
+var ErrInvalidCSV = errors.New("invalid user CSV")
+
+// Roles are the roles a user can be created with
+var Roles = []string{"read-only", "read-write", "admin"}
+
+// passwordAlphabet leaves out characters that are easily confused on paper (0/O, 1/l/I)
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// MinPasswordLength is the shortest generated password
+const MinPasswordLength = 8
+
+// Entry is one user to create
+type Entry struct {
+	Line      int // Line in the CSV, for error messages
+	Username  string
+	Role      string
+	Password  string
+	Email     string
+	Generated bool // Password was generated rather than read from the CSV
+}
+
+// ParseCSV reads users from a CSV with a header row. The username column is required;
+// role, password and email are optional. Rows without a role get defaultRole. Every
+// problem in the file is reported at once, so it can be fixed in one go.
+func ParseCSV(r io.Reader, defaultRole string) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "username", "role", "password", "email":
+			if _, dup := columns[name]; dup {
+				return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidCSV, name)
+			}
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("%w: unknown column %q (expected username, role, password, email)", ErrInvalidCSV, name)
+		}
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("%w: a username column is required", ErrInvalidCSV)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	var problems []string
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue // blank line
+		}
+
+		entry := Entry{
+			Line:     line,
+			Username: field(record, "username"),
+			Role:     field(record, "role"),
+			Password: field(record, "password"),
+			Email:    field(record, "email"),
+		}
+		if entry.Role == "" {
+			entry.Role = defaultRole
+		}
+
+		switch {
+		case entry.Username == "":
+			problems = append(problems, fmt.Sprintf("line %d: username is empty", line))
+			continue
+		case !ValidRole(entry.Role):
+			problems = append(problems, fmt.Sprintf("line %d: invalid role %q (expected %s)", line, entry.Role, strings.Join(Roles, ", ")))
+		case entry.Email != "" && !strings.Contains(entry.Email, "@"):
+			problems = append(problems, fmt.Sprintf("line %d: invalid email %q", line, entry.Email))
+		}
+		key := strings.ToLower(entry.Username)
+		if first, dup := seen[key]; dup {
+			problems = append(problems, fmt.Sprintf("line %d: username %q already on line %d", line, entry.Username, first))
+			continue
+		}
+		seen[key] = line
+		entries = append(entries, entry)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w:\n  %s", ErrInvalidCSV, strings.Join(problems, "\n  "))
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no users in the file", ErrInvalidCSV)
+	}
+	return entries, nil
+}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneratePassword returns a random password of the given length from characters that
+// are easy to read and type
+func GeneratePassword(length int) (string, error) {
+	if length < MinPasswordLength {
+		return "", fmt.Errorf("passwords must be at least %d characters", MinPasswordLength)
+	}
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// FillPasswords generates a password for every entry without one
+func FillPasswords(entries []Entry, length int) error {
+	for i := range entries {
+		if entries[i].Password != "" {
+			continue
+		}
+		password, err := GeneratePassword(length)
+		if err != nil {
+			return err
+		}
+		entries[i].Password = password
+		entries[i].Generated = true
+	}
+	return nil
+}
+
+// EncodeFRMLS replicates the FRMLS encoding used by the Formulus generateQR.ts script.
+// Format: FRMLS:v:<b64(v)>;s:<b64(serverUrl)>;u:<b64(username)>;p:<b64(password)>;;
+func EncodeFRMLS(version int, serverURL, username, password string) string {
+	b64 := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	parts := []string{
+		fmt.Sprintf("v:%s", b64(fmt.Sprintf("%d", version))),
+		fmt.Sprintf("s:%s", b64(serverURL)),
+		fmt.Sprintf("u:%s", b64(username)),
+		fmt.Sprintf("p:%s", b64(password)),
+	}
+
+	return "FRMLS:" + strings.Join(parts, ";") + ";;"
+}
@@ -0,0 +1,151 @@
+package provisioning
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := "\ufeffUsername, Role,password,email\n" +
+		"alice,admin,s3cret!,alice@example.org\n" +
+		"bob,,,\n" +
+		"\n" +
+		"carol\n"
+
+	entries, err := ParseCSV(strings.NewReader(input), "read-write")
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Username != "alice" || e.Role != "admin" || e.Password != "s3cret!" || e.Email != "alice@example.org" || e.Line != 2 {
+		t.Errorf("Unexpected first entry: %+v", e)
+	}
+	if e := entries[1]; e.Role != "read-write" || e.Password != "" {
+		t.Errorf("Expected the default role and no password, got %+v", e)
+	}
+	if e := entries[2]; e.Username != "carol" || e.Line != 5 {
+		t.Errorf("Unexpected short row: %+v", e)
+	}
+}
+
+func TestParseCSV_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		contains []string
+	}{
+		"empty":          {input: "", contains: []string{"empty"}},
+		"no username":    {input: "role,password\nadmin,x\n", contains: []string{"username column is required"}},
+		"unknown column": {input: "username,team\na,b\n", contains: []string{`unknown column "team"`}},
+		"header only":    {input: "username\n", contains: []string{"no users"}},
+		"every problem": {
+			input: "username,role,email\nalice,boss,\n,admin,\nAlice,admin,\nbob,admin,not-an-email\n",
+			contains: []string{
+				`line 2: invalid role "boss"`,
+				"line 3: username is empty",
+				`line 4: username "Alice" already on line 2`,
+				`line 5: invalid email "not-an-email"`,
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.input), "read-write")
+			if !errors.Is(err, ErrInvalidCSV) {
+				t.Fatalf("Expected ErrInvalidCSV, got %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected %q in %q", want, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestFillPasswords(t *testing.T) {
+	entries := []Entry{{Username: "a", Password: "given"}, {Username: "b"}, {Username: "c"}}
+	if err := FillPasswords(entries, 12); err != nil {
+		t.Fatalf("Failed to fill passwords: %v", err)
+	}
+	if entries[0].Password != "given" || entries[0].Generated {
+		t.Errorf("Expected the given password to be kept, got %+v", entries[0])
+	}
+	for _, e := range entries[1:] {
+		if len(e.Password) != 12 || !e.Generated || strings.ContainsAny(e.Password, "0O1lI") {
+			t.Errorf("Unexpected generated password %+v", e)
+		}
+	}
+	if entries[1].Password == entries[2].Password {
+		t.Errorf("Expected different passwords")
+	}
+	if err := FillPasswords([]Entry{{Username: "d"}}, 4); err == nil {
+		t.Errorf("Expected short passwords to be rejected")
+	}
+}
+
+func TestEncodeFRMLS(t *testing.T) {
+	got := EncodeFRMLS(1, "https://sync.example.org", "alice", "pw")
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	want := "FRMLS:v:" + b64("1") + ";s:" + b64("https://sync.example.org") + ";u:" + b64("alice") + ";p:" + b64("pw") + ";;"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	results := []Result{
+		{Entry: Entry{Username: "alice", Role: "admin", Password: "pw-alice"}, Status: StatusCreated},
+		{Entry: Entry{Username: "bob", Role: "read-write", Password: "pw-bob"}, Status: StatusFailed, Error: "API error: user exists"},
+		{Entry: Entry{Username: "a/b", Role: "read-only", Password: "pw-ab"}, Status: StatusCreated},
+		{Entry: Entry{Username: "a_b", Role: "read-only", Password: "pw-ab2"}, Status: StatusCreated},
+	}
+
+	var buf bytes.Buffer
+	err := WriteBundle(&buf, results, BundleOptions{ServerURL: "https://sync.example.org", QR: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	for _, name := range []string{"credentials.csv", "provisioning.pdf", "qr/alice.png", "qr/a_b.png", "qr/a_b_2.png"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s in the bundle, got %d files", name, len(files))
+		}
+	}
+	if _, ok := files["qr/bob.png"]; ok {
+		t.Errorf("Expected no QR code for a user that wasn't created")
+	}
+	if !bytes.HasPrefix(files["provisioning.pdf"], []byte("%PDF")) {
+		t.Errorf("Expected a PDF")
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(files["credentials.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read credentials.csv: %v", err)
+	}
+	if len(rows) != 5 || rows[1][3] != "pw-alice" || rows[1][4] != StatusCreated {
+		t.Errorf("Unexpected credentials: %v", rows)
+	}
+	if rows[2][3] != "" || rows[2][4] != StatusFailed || rows[2][5] != "API error: user exists" {
+		t.Errorf("Expected the failed row without a password, got %v", rows[2])
+	}
+}
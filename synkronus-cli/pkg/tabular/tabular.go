@@ -0,0 +1,279 @@
+// Package tabular turns pulled observations into rows with one column per data field and
+// writes them as CSV or JSON lines. Records are flattened the way the server's data export
+// does it: the observation's own fields first, then a data_<key> column per top-level data
+// key, with nested objects and arrays kept as JSON text.
+package tabular
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+)
+
+// Output formats
+const (
+	FormatJSON  = "json"
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// ParseFormat checks an output format name; allowed lists the formats the command offers
+func ParseFormat(name string, allowed ...string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(name))
+	for _, a := range allowed {
+		if format == a {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, expected %s", name, strings.Join(allowed, ", "))
+}
+
+// Column types
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeNumber    = "number"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+	// TypeJSON columns hold objects and arrays as JSON text
+	TypeJSON = "json"
+)
+
+// Column is a named, typed column
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is a list of rows of typed values; a nil value is null
+type Table struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// coreColumns are the observation fields every row starts with, as in the export
+var coreColumns = []Column{
+	{Name: "observation_id", Type: TypeString},
+	{Name: "form_type", Type: TypeString},
+	{Name: "form_version", Type: TypeString},
+	{Name: "created_at", Type: TypeTimestamp},
+	{Name: "updated_at", Type: TypeTimestamp},
+	{Name: "synced_at", Type: TypeTimestamp},
+	{Name: "deleted", Type: TypeBoolean},
+	{Name: "version", Type: TypeInteger},
+	{Name: "geolocation", Type: TypeJSON},
+}
+
+// dataPrefix names the data columns, as in the export
+const dataPrefix = "data_"
+
+// FromRecords flattens pulled records. forms are the forms of the app bundle's
+// APP_INFO.json: their fields come first, in declaration order, so a field gets a column
+// even when no pulled record has it. Keys no form declares follow in name order. Columns
+// are typed by their values, or by the declared type when there are none; a key whose
+// values have different types becomes a string column, like a mixed-type column in the
+// export. forms may be nil.
+func FromRecords(records []map[string]interface{}, forms map[string]client.FormInfo) *Table {
+	// Data keys in column order, with the JSON types seen for each
+	var keys []string
+	seen := make(map[string]map[string]bool)
+	declared := make(map[string]string)
+	addKey := func(key string) {
+		if _, ok := seen[key]; !ok {
+			seen[key] = make(map[string]bool)
+			keys = append(keys, key)
+		}
+	}
+
+	var formTypes []string
+	for _, record := range records {
+		formType, _ := record["form_type"].(string)
+		if _, ok := forms[formType]; ok && !slices.Contains(formTypes, formType) {
+			formTypes = append(formTypes, formType)
+		}
+	}
+	sort.Strings(formTypes)
+	for _, formType := range formTypes {
+		for _, field := range forms[formType].Fields {
+			addKey(field.Name)
+			if _, ok := declared[field.Name]; !ok {
+				declared[field.Name] = field.Type
+			}
+		}
+	}
+
+	var undeclared []string
+	for _, record := range records {
+		data, _ := record["data"].(map[string]interface{})
+		for key, value := range data {
+			if _, ok := seen[key]; !ok {
+				undeclared = append(undeclared, key)
+				seen[key] = make(map[string]bool)
+			}
+			if value != nil {
+				seen[key][jsonType(value)] = true
+			}
+		}
+	}
+	sort.Strings(undeclared)
+	keys = append(keys, undeclared...)
+
+	table := &Table{Columns: append([]Column{}, coreColumns...)}
+	for _, key := range keys {
+		table.Columns = append(table.Columns, Column{Name: dataPrefix + key, Type: columnType(declared[key], seen[key])})
+	}
+
+	for _, record := range records {
+		row := make([]interface{}, 0, len(table.Columns))
+		for _, col := range coreColumns {
+			row = append(row, cellValue(record[col.Name], col.Type))
+		}
+		data, _ := record["data"].(map[string]interface{})
+		for i, key := range keys {
+			row = append(row, cellValue(data[key], table.Columns[len(coreColumns)+i].Type))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case float64:
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	case string:
+		return TypeString
+	}
+	return TypeJSON
+}
+
+// columnType picks the type of a data column from its declared type and the JSON types of
+// its values
+func columnType(declaredType string, types map[string]bool) string {
+	switch declaredType {
+	case "number", "integer":
+		declaredType = TypeNumber
+	case "boolean":
+		declaredType = TypeBoolean
+	case "object", "array":
+		declaredType = TypeJSON
+	case "string":
+		declaredType = TypeString
+	default:
+		declaredType = ""
+	}
+
+	switch {
+	case len(types) == 0 && declaredType != "":
+		return declaredType
+	case len(types) == 1:
+		for t := range types {
+			return t
+		}
+	}
+	return TypeString
+}
+
+// cellValue converts a decoded JSON value to a value of the column type. Values that
+// aren't strings end up as JSON text in string and JSON columns.
+func cellValue(value interface{}, columnType string) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch columnType {
+	case TypeInteger:
+		if f, ok := value.(float64); ok {
+			return int64(f)
+		}
+	case TypeNumber, TypeBoolean:
+		return value
+	}
+	if s, ok := value.(string); ok && columnType != TypeJSON {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// FormatValue renders a value as CSV and table cells show it; null is empty
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// WriteCSV writes the table with a header row
+func WriteCSV(w io.Writer, table *Table) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		header[i] = col.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for i, value := range row {
+			record[i] = FormatValue(value)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONL writes one JSON object per row, with the columns in table order
+func WriteJSONL(w io.Writer, table *Table) error {
+	for _, row := range table.Rows {
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			name, _ := json.Marshal(table.Columns[i].Name)
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", table.Columns[i].Name, err)
+			}
+			b.Write(name)
+			b.WriteByte(':')
+			b.Write(encoded)
+		}
+		b.WriteString("}\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
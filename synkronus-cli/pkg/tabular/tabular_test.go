@@ -0,0 +1,122 @@
+package tabular
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/OpenDataEnsemble/ode/synkronus-cli/pkg/client"
+)
+
+func decodeRecords(t *testing.T, data string) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &records); err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+	return records
+}
+
+func testForms(t *testing.T) map[string]client.FormInfo {
+	t.Helper()
+	var forms map[string]client.FormInfo
+	err := json.Unmarshal([]byte(`{"household": {"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "members", "type": "integer"},
+		{"name": "visited", "type": "boolean"}
+	]}}`), &forms)
+	if err != nil {
+		t.Fatalf("Failed to decode forms: %v", err)
+	}
+	return forms
+}
+
+const testRecords = `[
+	{"observation_id": "obs-1", "form_type": "household", "form_version": "1", "created_at": "2025-03-03T08:00:00Z",
+	 "updated_at": "2025-03-03T08:00:00Z", "deleted": false, "version": 7,
+	 "geolocation": {"latitude": 0.3, "longitude": 32.5, "accuracy": 5},
+	 "data": {"name": "Aisha, Kato", "members": 4, "tags": ["a", "b"], "extra": 1}},
+	{"observation_id": "obs-2", "form_type": "household", "form_version": "1", "created_at": "2025-03-04T08:00:00Z",
+	 "updated_at": "2025-03-04T08:00:00Z", "deleted": true, "version": 8,
+	 "data": {"name": "Brian", "extra": "one"}}
+]`
+
+func TestFromRecords(t *testing.T) {
+	table := FromRecords(decodeRecords(t, testRecords), testForms(t))
+
+	var names, types []string
+	for _, col := range table.Columns {
+		names = append(names, col.Name)
+		types = append(types, col.Type)
+	}
+	wantNames := "observation_id,form_type,form_version,created_at,updated_at,synced_at,deleted,version,geolocation,data_name,data_members,data_visited,data_extra,data_tags"
+	if got := strings.Join(names, ","); got != wantNames {
+		t.Errorf("Expected columns %s, got %s", wantNames, got)
+	}
+	// visited has no values and keeps its declared type; extra has mixed values
+	wantTypes := "string,string,string,timestamp,timestamp,timestamp,boolean,integer,json,string,number,boolean,string,json"
+	if got := strings.Join(types, ","); got != wantTypes {
+		t.Errorf("Expected types %s, got %s", wantTypes, got)
+	}
+
+	if len(table.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(table.Rows))
+	}
+	row := table.Rows[0]
+	if row[7] != int64(7) || row[10] != float64(4) || row[11] != nil || row[12] != "1" || row[13] != `["a","b"]` {
+		t.Errorf("Unexpected row %v", row)
+	}
+	if row[8] != `{"accuracy":5,"latitude":0.3,"longitude":32.5}` {
+		t.Errorf("Expected geolocation as JSON text, got %v", row[8])
+	}
+	if table.Rows[1][6] != true || table.Rows[1][12] != "one" {
+		t.Errorf("Unexpected row %v", table.Rows[1])
+	}
+}
+
+func TestFromRecords_WithoutForms(t *testing.T) {
+	table := FromRecords(decodeRecords(t, testRecords), nil)
+	var names []string
+	for _, col := range table.Columns[len(coreColumns):] {
+		names = append(names, col.Name)
+	}
+	if got := strings.Join(names, ","); got != "data_extra,data_members,data_name,data_tags" {
+		t.Errorf("Expected data columns in name order, got %s", got)
+	}
+}
+
+func TestWriteCSVAndJSONL(t *testing.T) {
+	table := &Table{
+		Columns: []Column{{Name: "id", Type: TypeString}, {Name: "n", Type: TypeNumber}, {Name: "ok", Type: TypeBoolean}},
+		Rows: [][]interface{}{
+			{"a, b", float64(1.5), true},
+			{"c", nil, nil},
+		},
+	}
+
+	var csvOut bytes.Buffer
+	if err := WriteCSV(&csvOut, table); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	if want := "id,n,ok\n\"a, b\",1.5,true\nc,,\n"; csvOut.String() != want {
+		t.Errorf("Expected CSV %q, got %q", want, csvOut.String())
+	}
+
+	var jsonlOut bytes.Buffer
+	if err := WriteJSONL(&jsonlOut, table); err != nil {
+		t.Fatalf("Failed to write JSONL: %v", err)
+	}
+	if want := "{\"id\":\"a, b\",\"n\":1.5,\"ok\":true}\n{\"id\":\"c\",\"n\":null,\"ok\":null}\n"; jsonlOut.String() != want {
+		t.Errorf("Expected JSONL %q, got %q", want, jsonlOut.String())
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat(" CSV ", FormatJSON, FormatCSV); err != nil || format != FormatCSV {
+		t.Errorf("Expected csv, got %q, %v", format, err)
+	}
+	if _, err := ParseFormat("xml", FormatJSON, FormatCSV); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
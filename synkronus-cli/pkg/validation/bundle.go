@@ -129,7 +129,17 @@ func ValidateBundle(bundlePath string) error {
 	}
 
 	// Fourth pass: validate form references to renderers (including extension renderers)
-	return validateFormRendererReferences(&zipFile.Reader)
+	if err := validateFormRendererReferences(&zipFile.Reader); err != nil {
+		return err
+	}
+
+	// Fifth pass: cross-check ui.json scopes against schema.json
+	if err := validateFormUIScopes(&zipFile.Reader); err != nil {
+		return err
+	}
+
+	// Sixth pass: check that ui.json rules can be evaluated against schema.json
+	return validateFormUIRules(&zipFile.Reader)
 }
 
 // validateFormFile validates a single form file
@@ -155,9 +165,10 @@ func validateRendererFile(file *zip.File) error {
 		return nil
 	}
 
-	// Expected path format: renderers/{rendererName}/renderer.jsx
+	// Expected path format: renderers/{rendererName}/renderer.jsx, with an optional
+	// renderer.json version manifest next to it
 	parts := strings.Split(file.Name, "/")
-	if len(parts) != 3 || parts[2] != "renderer.jsx" {
+	if len(parts) != 3 || (parts[2] != "renderer.jsx" && parts[2] != "renderer.json") {
 		return fmt.Errorf("%w: invalid renderer file path: %s (expected renderers/{name}/renderer.jsx)", ErrInvalidRendererStructure, file.Name)
 	}
 
@@ -181,38 +192,13 @@ func validateFormRendererReferences(zipReader *zip.Reader) error {
 	}
 
 	// Second, collect extension renderers from ext.json files
-	for _, file := range zipReader.File {
-		// Collect both root-level (forms/ext.json) and form-level (forms/{formName}/ext.json) ext.json files
-		if file.Name == "forms/ext.json" || strings.HasSuffix(file.Name, "/ext.json") {
-			rc, err := file.Open()
-			if err != nil {
-				continue // Skip if can't open
-			}
-
-			var ext ExtensionDefinition
-			decoder := json.NewDecoder(rc)
-			if err := decoder.Decode(&ext); err != nil {
-				rc.Close()
-				continue // Skip if can't parse
-			}
-			rc.Close()
-
-			// Extract renderer formats
-			if ext.Renderers != nil {
-				for key, rendererData := range ext.Renderers {
-					rendererBytes, _ := json.Marshal(rendererData)
-					var renderer ExtensionRenderer
-					if err := json.Unmarshal(rendererBytes, &renderer); err == nil {
-						// In v1 format, the key is the format name
-						// In legacy format, use Format field
-						format := key
-						if renderer.Format != "" {
-							format = renderer.Format
-						}
-						extensionRenderers[format] = true
-					}
-				}
-			}
+	lint := lintBundleExtensions(zipReader)
+	if len(lint.Problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidExtension, strings.Join(lint.Problems, "; "))
+	}
+	for _, f := range lint.files {
+		for _, declared := range rendererFormats(f, f.doc) {
+			extensionRenderers[declared.format] = true
 		}
 	}
 
@@ -409,123 +395,17 @@ type ExtensionRenderer struct {
 
 // validateExtensions validates extension files (ext.json) in the bundle
 func validateExtensions(zipReader *zip.Reader) error {
-	// Track extension files
-	extensionFiles := make(map[string]*zip.File)
-	extensionRenderers := make(map[string]ExtensionRenderer)
-	extensionModules := make(map[string]bool)
-
-	// First pass: collect extension files and validate structure
-	for _, file := range zipReader.File {
-		// Collect both root-level (forms/ext.json) and form-level (forms/{formName}/ext.json) ext.json files
-		if file.Name == "forms/ext.json" || strings.HasSuffix(file.Name, "/ext.json") {
-			extensionFiles[file.Name] = file
-
-			// Validate JSON structure
-			if err := validateJSONFile(file); err != nil {
-				return fmt.Errorf("%w: %s: %v", ErrInvalidExtension, file.Name, err)
-			}
-
-			// Parse and validate extension structure
-			rc, err := file.Open()
-			if err != nil {
-				return fmt.Errorf("failed to open extension file %s: %w", file.Name, err)
-			}
-
-			var ext ExtensionDefinition
-			decoder := json.NewDecoder(rc)
-			if err := decoder.Decode(&ext); err != nil {
-				rc.Close()
-				return fmt.Errorf("%w: %s: failed to parse: %v", ErrInvalidExtension, file.Name, err)
-			}
-			rc.Close()
-
-			// Validate renderers
-			if ext.Renderers != nil {
-				for key, rendererData := range ext.Renderers {
-					rendererBytes, err := json.Marshal(rendererData)
-					if err != nil {
-						return fmt.Errorf("%w: %s: failed to marshal renderer %s: %v", ErrInvalidExtension, file.Name, key, err)
-					}
-
-					var renderer ExtensionRenderer
-					if err := json.Unmarshal(rendererBytes, &renderer); err != nil {
-						return fmt.Errorf("%w: %s: invalid renderer %s: %v", ErrInvalidExtension, file.Name, key, err)
-					}
-
-					// Determine format/name - use key as format for v1 format, or use Format field for legacy
-					format := key
-					if renderer.Format != "" {
-						format = renderer.Format
-					}
-
-					// Validate v1 format (new format with renderer/tester objects)
-					if renderer.Renderer != nil {
-						// New v1 format: renderer is an object with path and export
-						if renderer.Renderer.Path == "" {
-							return fmt.Errorf("%w: %s: renderer %s missing 'renderer.path' field", ErrInvalidExtensionRenderer, file.Name, key)
-						}
-						if renderer.Renderer.Export == "" {
-							return fmt.Errorf("%w: %s: renderer %s missing 'renderer.export' field", ErrInvalidExtensionRenderer, file.Name, key)
-						}
-						// Track renderer module path
-						extensionModules[renderer.Renderer.Path] = true
-
-						// Validate tester if present
-						if renderer.Tester != nil {
-							if renderer.Tester.Path == "" {
-								return fmt.Errorf("%w: %s: renderer %s missing 'tester.path' field", ErrInvalidExtensionRenderer, file.Name, key)
-							}
-							if renderer.Tester.Export == "" {
-								return fmt.Errorf("%w: %s: renderer %s missing 'tester.export' field", ErrInvalidExtensionRenderer, file.Name, key)
-							}
-							// Track tester module path
-							extensionModules[renderer.Tester.Path] = true
-						}
-					} else if renderer.Module != "" {
-						// Legacy format: validate required fields (as per PR #226)
-						if renderer.Name == "" {
-							return fmt.Errorf("%w: %s: renderer %s missing 'name' field", ErrInvalidExtensionRenderer, file.Name, key)
-						}
-						if renderer.Format == "" {
-							return fmt.Errorf("%w: %s: renderer %s missing 'format' field", ErrInvalidExtensionRenderer, file.Name, key)
-						}
-						// Module already checked in the condition
-						extensionModules[renderer.Module] = true
-					} else {
-						// Neither format present
-						return fmt.Errorf("%w: %s: renderer %s must have either 'renderer' object (v1 format) or 'module' string (legacy format)", ErrInvalidExtensionRenderer, file.Name, key)
-					}
-
-					// Store renderer for later validation (use key as format)
-					extensionRenderers[format] = renderer
-				}
-			}
-
-			// Validate functions
-			if ext.Functions != nil {
-				for key, funcData := range ext.Functions {
-					funcMap, ok := funcData.(map[string]interface{})
-					if !ok {
-						return fmt.Errorf("%w: %s: function %s must be an object", ErrInvalidExtension, file.Name, key)
-					}
+	// First pass: check ext.json files against the extension schema and collect the
+	// modules they reference
+	lint := lintBundleExtensions(zipReader)
+	if len(lint.Problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidExtension, strings.Join(lint.Problems, "; "))
+	}
 
-					// Support v1 format (path/export) and legacy format (name/module)
-					if path, ok := funcMap["path"].(string); ok && path != "" {
-						// New v1 format: path and export
-						if export, ok := funcMap["export"].(string); !ok || export == "" {
-							return fmt.Errorf("%w: %s: function %s missing or invalid 'export' field", ErrInvalidExtension, file.Name, key)
-						}
-						extensionModules[path] = true
-					} else if name, ok := funcMap["name"].(string); ok && name != "" {
-						// Legacy format: name and module
-						if module, ok := funcMap["module"].(string); ok && module != "" {
-							extensionModules[module] = true
-						}
-					} else {
-						return fmt.Errorf("%w: %s: function %s must have either 'path' and 'export' (v1 format) or 'name' (legacy format)", ErrInvalidExtension, file.Name, key)
-					}
-				}
-			}
+	extensionModules := make(map[string]bool)
+	for _, f := range lint.files {
+		for _, path := range extensionModulePaths(f.doc) {
+			extensionModules[path] = true
 		}
 	}
 
@@ -107,6 +107,15 @@ func TestValidateBundle(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid form file path",
 		},
+		{
+			name: "renderer with version manifest",
+			files: map[string]string{
+				"app/index.html":                 "<html></html>",
+				"renderers/button/renderer.jsx":  "export default function Button() {}",
+				"renderers/button/renderer.json": `{"version": "1.0.0", "min_host_version": "2.1.0"}`,
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid renderer structure - wrong extension",
 			files: map[string]string{
@@ -229,6 +238,42 @@ func TestValidateBundle(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "unparseable extension file",
+			files: map[string]string{
+				"app/index.html": "<html></html>",
+				"forms/user/schema.json": `{"type": "object"}`,
+				"forms/user/ui.json": "{}",
+				"forms/ext.json": "{\n  \"renderers\": {,}\n}",
+			},
+			wantErr: true,
+			errMsg:  "forms/ext.json:2:17: invalid JSON",
+		},
+		{
+			name: "extension renderer with a bad module path",
+			files: map[string]string{
+				"app/index.html": "<html></html>",
+				"forms/user/schema.json": `{"type": "object"}`,
+				"forms/user/ui.json": "{}",
+				"forms/ext.json": `{"renderers": {"map": {"renderer": {"path": "/extensions/Map.css", "export": "default"}}}}`,
+			},
+			wantErr: true,
+			errMsg:  `forms/ext.json:1:37: /renderers/map/renderer/path: "/extensions/Map.css" is not a module path`,
+		},
+		{
+			name: "renderer format declared twice",
+			files: map[string]string{
+				"app/index.html": "<html></html>",
+				"forms/user/schema.json": `{"type": "object"}`,
+				"forms/user/ui.json": "{}",
+				"forms/user/ext.json": `{"renderers": {
+					"a": {"name": "A", "format": "custom", "module": "renderers/A.tsx"},
+					"b": {"name": "B", "format": "custom", "module": "renderers/B.tsx"}
+				}}`,
+			},
+			wantErr: true,
+			errMsg:  `renderer format "custom" is already declared at forms/user/ext.json:2:6`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,239 @@
+package validation
+
+import (
+	"archive/zip"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// extensionSchemaJSON is the JSON Schema of ext.json files
+//
+//go:embed schemas/ext.schema.json
+var extensionSchemaJSON []byte
+
+// extensionSchema is extensionSchemaJSON decoded
+var extensionSchema = func() map[string]interface{} {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(extensionSchemaJSON, &schema); err != nil {
+		panic(fmt.Sprintf("invalid ext.json schema: %v", err))
+	}
+	return schema
+}()
+
+// extensionFile is an ext.json file devices load
+type extensionFile struct {
+	name string
+	// scope is the form the file extends, or "" for all forms
+	scope     string
+	data      []byte
+	positions map[string]int
+	// doc is the decoded file, nil when it is not valid JSON
+	doc interface{}
+}
+
+// at returns the file, line and column of the value at pointer, or of the closest
+// enclosing value with a known position
+func (f *extensionFile) at(pointer string) string {
+	for {
+		if offset, ok := f.positions[pointer]; ok {
+			line, column := lineColumn(f.data, offset)
+			return fmt.Sprintf("%s:%d:%d", f.name, line, column)
+		}
+		if pointer == "" {
+			return f.name
+		}
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// extensionLint is the outcome of checking the ext.json files of a bundle
+type extensionLint struct {
+	// Problems fail the push
+	Problems []string
+	// Warnings are unknown keys and files devices ignore
+	Warnings []string
+	// files are the ext.json files devices load
+	files []*extensionFile
+}
+
+// extensionScope returns the form an ext.json path extends, "" for the files extending
+// all forms, and false for paths devices don't load
+func extensionScope(name string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(name, "app/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "forms":
+		return "", true
+	case len(parts) == 3 && parts[0] == "forms" && parts[1] != "":
+		return parts[1], true
+	}
+	return "", false
+}
+
+// lintBundleExtensions checks the ext.json files of a bundle against the extension
+// schema, and the renderer formats they declare against each other
+func lintBundleExtensions(zipReader *zip.Reader) extensionLint {
+	var lint extensionLint
+	var files []*extensionFile
+	for _, file := range zipReader.File {
+		if path.Base(file.Name) != "ext.json" || file.FileInfo().IsDir() {
+			continue
+		}
+		scope, loaded := extensionScope(file.Name)
+		if !loaded {
+			if strings.HasPrefix(file.Name, "forms/") || strings.HasPrefix(file.Name, "app/forms/") {
+				lint.Warnings = append(lint.Warnings, fmt.Sprintf("%s: not loaded by devices, which read forms/ext.json and forms/{form}/ext.json", file.Name))
+			}
+			continue
+		}
+		data, err := readZipBytes(file)
+		if err != nil {
+			lint.Problems = append(lint.Problems, fmt.Sprintf("%s: %v", file.Name, err))
+			continue
+		}
+		files = append(files, &extensionFile{name: file.Name, scope: scope, data: data})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	lint.files = files
+
+	formats := make(map[string][]declaredFormat)
+	for _, f := range files {
+		var doc interface{}
+		if err := json.Unmarshal(f.data, &doc); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				// Offset counts the byte that broke the syntax
+				line, column := lineColumn(f.data, int(syntax.Offset)-1)
+				lint.Problems = append(lint.Problems, fmt.Sprintf("%s:%d:%d: invalid JSON: %v", f.name, line, column, err))
+			} else {
+				lint.Problems = append(lint.Problems, fmt.Sprintf("%s: invalid JSON: %v", f.name, err))
+			}
+			continue
+		}
+		f.doc = doc
+		f.positions = jsonPositions(f.data)
+
+		for _, violation := range checkSchema(extensionSchema, doc) {
+			// Unknown keys are named by the message
+			message := violation.Message
+			if violation.Pointer != "" && violation.Keyword != "additionalProperties" {
+				message = violation.Pointer + ": " + message
+			}
+			message = f.at(violation.Pointer) + ": " + message
+			if violation.Keyword == "additionalProperties" {
+				lint.Warnings = append(lint.Warnings, message+", ignored by devices")
+			} else {
+				lint.Problems = append(lint.Problems, message)
+			}
+		}
+
+		for _, declared := range rendererFormats(f, doc) {
+			formats[declared.format] = append(formats[declared.format], declared)
+		}
+	}
+
+	names := make([]string, 0, len(formats))
+	for format := range formats {
+		names = append(names, format)
+	}
+	sort.Strings(names)
+	for _, format := range names {
+		declared := formats[format]
+		for i, a := range declared {
+			for _, b := range declared[i+1:] {
+				switch {
+				case a.file.scope == b.file.scope:
+					lint.Problems = append(lint.Problems, fmt.Sprintf("%s: renderer format %q is already declared at %s", b.location, format, a.location))
+				case a.file.scope == "":
+					lint.Warnings = append(lint.Warnings, fmt.Sprintf("%s: renderer format %q overrides the one at %s for form '%s'", b.location, format, a.location, b.file.scope))
+				case b.file.scope == "":
+					lint.Warnings = append(lint.Warnings, fmt.Sprintf("%s: renderer format %q overrides the one at %s for form '%s'", a.location, format, b.location, a.file.scope))
+				}
+			}
+		}
+	}
+	return lint
+}
+
+// declaredFormat is a renderer format declared in an ext.json file
+type declaredFormat struct {
+	format   string
+	file     *extensionFile
+	location string
+}
+
+// rendererFormats lists the formats of the renderers of an ext.json: the format of
+// legacy renderers, or else the renderer's key
+func rendererFormats(f *extensionFile, doc interface{}) []declaredFormat {
+	root, _ := doc.(map[string]interface{})
+	renderers, _ := root["renderers"].(map[string]interface{})
+	keys := make([]string, 0, len(renderers))
+	for key := range renderers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var formats []declaredFormat
+	for _, key := range keys {
+		format := key
+		if renderer, ok := renderers[key].(map[string]interface{}); ok {
+			if legacy, ok := renderer["format"].(string); ok && legacy != "" {
+				format = legacy
+			}
+		}
+		formats = append(formats, declaredFormat{format: format, file: f, location: f.at("/renderers/" + escapeJSONPointer(key))})
+	}
+	return formats
+}
+
+// ExtensionWarnings lists the ext.json content devices ignore or override
+func ExtensionWarnings(bundlePath string) ([]string, error) {
+	zipFile, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer zipFile.Close()
+
+	return lintBundleExtensions(&zipFile.Reader).Warnings, nil
+}
+
+// extensionModulePaths lists the module paths the renderers and functions of an ext.json
+// document reference
+func extensionModulePaths(doc interface{}) []string {
+	root, _ := doc.(map[string]interface{})
+	var paths []string
+	for _, section := range []string{"renderers", "functions"} {
+		entries, _ := root[section].(map[string]interface{})
+		for _, entry := range entries {
+			fields, _ := entry.(map[string]interface{})
+			for _, key := range []string{"renderer", "tester"} {
+				if reference, ok := fields[key].(map[string]interface{}); ok {
+					if path, ok := reference["path"].(string); ok {
+						paths = append(paths, path)
+					}
+				}
+			}
+			for _, key := range []string{"path", "module"} {
+				if path, ok := fields[key].(string); ok && path != "" {
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// readZipBytes reads a file from the bundle
+func readZipBytes(file *zip.File) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
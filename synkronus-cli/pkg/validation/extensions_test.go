@@ -0,0 +1,29 @@
+package validation
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExtensionWarnings(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"app/index.html":         "<html></html>",
+		"forms/ext.json":         `{"version": "1", "renderers": {"map": {"renderer": {"path": "/extensions/Map.jsx", "export": "default"}}}, "extras": {}}`,
+		"forms/user/ext.json":    `{"renderers": {"map": {"renderer": {"path": "/extensions/UserMap.jsx", "export": "default"}}}}`,
+		"forms/user/schema.json": `{"type": "object"}`,
+	})
+	defer os.Remove(bundlePath)
+
+	warnings, err := ExtensionWarnings(bundlePath)
+	if err != nil {
+		t.Fatalf("ExtensionWarnings() error = %v", err)
+	}
+	want := []string{
+		`forms/ext.json:1:108: unknown key "extras", ignored by devices`,
+		`forms/user/ext.json:1:16: renderer format "map" overrides the one at forms/ext.json:1:32 for form 'user'`,
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("ExtensionWarnings() = %q, want %q", warnings, want)
+	}
+}
@@ -0,0 +1,310 @@
+package validation
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidUIRule is returned when a ui.json rule can't be evaluated the way it is written
+var ErrInvalidUIRule = errors.New("invalid UI schema rule")
+
+// ruleEffects are the effects a JSON Forms rule can have
+var ruleEffects = map[string]bool{"SHOW": true, "HIDE": true, "ENABLE": true, "DISABLE": true}
+
+// lintUIRules checks the rules of a UI schema against the data schema and returns what is
+// wrong with them. Devices treat a rule they can't evaluate as met, so a broken rule shows,
+// hides or disables its element unconditionally instead of failing. Rule scopes that don't
+// resolve are left to lintUIScopes.
+func lintUIRules(schema, ui map[string]interface{}) []string {
+	var problems []string
+
+	var walk func(node interface{}, bases []interface{})
+	walk = func(node interface{}, bases []interface{}) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			if rule, ok := v["rule"]; ok {
+				for _, problem := range checkRule(schema, bases, rule) {
+					problems = append(problems, fmt.Sprintf("rule on %s: %s", describeUIElement(v), problem))
+				}
+			}
+			if _, ok := v["x-visible-if"]; ok {
+				problems = append(problems, fmt.Sprintf("%s: x-visible-if is not evaluated by devices, use a rule with a SHOW effect", describeUIElement(v)))
+			}
+			if scope, ok := v["scope"].(string); ok && v["type"] == "Control" {
+				if target, found := resolveScope(schema, bases, scope); found {
+					if items, ok := target["items"].(map[string]interface{}); ok {
+						bases = append(bases[:len(bases):len(bases)], items)
+					}
+				}
+			}
+			for key, value := range v {
+				if key == "rule" {
+					continue
+				}
+				walk(value, bases)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item, bases)
+			}
+		}
+	}
+	walk(ui, []interface{}{schema})
+
+	sort.Strings(problems)
+	return problems
+}
+
+// describeUIElement names a UI schema element in rule problems
+func describeUIElement(element map[string]interface{}) string {
+	elementType, _ := element["type"].(string)
+	if elementType == "" {
+		elementType = "element"
+	}
+	if scope, ok := element["scope"].(string); ok {
+		return fmt.Sprintf("%s '%s'", elementType, scope)
+	}
+	if label, ok := element["label"].(string); ok && label != "" {
+		return fmt.Sprintf("%s '%s'", elementType, label)
+	}
+	return elementType
+}
+
+// checkRule checks the effect and condition of a rule
+func checkRule(schema map[string]interface{}, bases []interface{}, rule interface{}) []string {
+	r, ok := rule.(map[string]interface{})
+	if !ok {
+		return []string{"rule is not an object"}
+	}
+	var problems []string
+	if effect, _ := r["effect"].(string); !ruleEffects[effect] {
+		problems = append(problems, fmt.Sprintf("effect %v is not one of SHOW, HIDE, ENABLE and DISABLE", r["effect"]))
+	}
+	return append(problems, checkRuleCondition(schema, bases, r["condition"])...)
+}
+
+// checkRuleCondition checks a schema-based condition, or each condition of an AND or OR
+// condition
+func checkRuleCondition(schema map[string]interface{}, bases []interface{}, condition interface{}) []string {
+	c, ok := condition.(map[string]interface{})
+	if !ok {
+		return []string{"condition is missing or not an object"}
+	}
+
+	switch c["type"] {
+	case "AND", "OR":
+		conditions, _ := c["conditions"].([]interface{})
+		if len(conditions) == 0 {
+			return []string{fmt.Sprintf("%s condition has no conditions", c["type"])}
+		}
+		var problems []string
+		for _, nested := range conditions {
+			problems = append(problems, checkRuleCondition(schema, bases, nested)...)
+		}
+		return problems
+	case "LEAF":
+		return []string{"LEAF conditions are not evaluated by devices, use a condition with a scope and a schema"}
+	}
+
+	scope, _ := c["scope"].(string)
+	conditionSchema, ok := c["schema"].(map[string]interface{})
+	if scope == "" || !ok {
+		return []string{"condition needs a scope and a schema object"}
+	}
+	field, found := resolveScope(schema, bases, scope)
+	if !found {
+		return nil
+	}
+	return checkConditionSchema(scope, field, conditionSchema)
+}
+
+// checkConditionSchema checks that the keywords of a condition schema can match values of
+// the field the condition is scoped to
+func checkConditionSchema(scope string, field, conditionSchema map[string]interface{}) []string {
+	types := schemaTypes(field)
+	allowed, hasAllowed := allowedValues(field)
+	var problems []string
+
+	checkValue := func(keyword string, value interface{}) {
+		if len(types) > 0 && !valueHasType(value, types) {
+			problems = append(problems, fmt.Sprintf("%s %s %v can never match %s field '%s'",
+				keyword, jsonType(value), formatRuleValue(value), strings.Join(types, " or "), scope))
+		} else if hasAllowed && !containsValue(allowed, value) {
+			problems = append(problems, fmt.Sprintf("%s %v is not one of the values of '%s'", keyword, formatRuleValue(value), scope))
+		}
+	}
+	requireType := func(keyword string, want ...string) {
+		if len(types) == 0 {
+			return
+		}
+		for _, t := range types {
+			for _, w := range want {
+				if t == w {
+					return
+				}
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s only applies to %s values but '%s' is %s",
+			keyword, strings.Join(want, " or "), scope, strings.Join(types, " or ")))
+	}
+
+	if value, ok := conditionSchema["const"]; ok {
+		checkValue("const", value)
+	}
+	if values, ok := conditionSchema["enum"]; ok {
+		list, isList := values.([]interface{})
+		if !isList || len(list) == 0 {
+			problems = append(problems, "enum is not a non-empty array")
+		}
+		for _, value := range list {
+			checkValue("enum value", value)
+		}
+	}
+	if not, ok := conditionSchema["not"]; ok {
+		nested, isObject := not.(map[string]interface{})
+		if !isObject {
+			problems = append(problems, "not is not an object")
+		} else {
+			problems = append(problems, checkConditionSchema(scope, field, nested)...)
+		}
+	}
+	if pattern, ok := conditionSchema["pattern"]; ok {
+		if _, isString := pattern.(string); !isString {
+			problems = append(problems, "pattern is not a string")
+		}
+		requireType("pattern", "string")
+	}
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"} {
+		if bound, ok := conditionSchema[keyword]; ok {
+			if _, isNumber := bound.(float64); !isNumber {
+				problems = append(problems, fmt.Sprintf("%s is not a number", keyword))
+			}
+			requireType(keyword, "number", "integer")
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the JSON types a schema allows; empty when it doesn't say
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// allowedValues returns the values a field is limited to by enum or by oneOf/anyOf consts
+func allowedValues(field map[string]interface{}) ([]interface{}, bool) {
+	if values, ok := field["enum"].([]interface{}); ok {
+		return values, true
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		options, ok := field[keyword].([]interface{})
+		if !ok || len(options) == 0 {
+			continue
+		}
+		values := make([]interface{}, 0, len(options))
+		for _, option := range options {
+			o, _ := option.(map[string]interface{})
+			value, hasConst := o["const"]
+			if !hasConst {
+				return nil, false
+			}
+			values = append(values, value)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// containsValue reports whether value is one of values
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if fmt.Sprint(v) == fmt.Sprint(value) && jsonType(v) == jsonType(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueHasType reports whether a decoded JSON value is of one of the JSON schema types
+func valueHasType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, ok := value.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		default:
+			if jsonType(value) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON schema type of a decoded JSON value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// formatRuleValue renders a condition value in rule problems, quoting strings
+func formatRuleValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(value)
+}
+
+// validateFormUIRules rejects forms whose ui.json rules can't be evaluated as written
+func validateFormUIRules(zipReader *zip.Reader) error {
+	forms := readBundleForms(zipReader)
+	names := make([]string, 0, len(forms))
+	for name := range forms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		for _, problem := range lintUIRules(forms[name].schema, forms[name].ui) {
+			problems = append(problems, fmt.Sprintf("form '%s': %s", name, problem))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidUIRule, strings.Join(problems, "; "))
+	}
+	return nil
+}
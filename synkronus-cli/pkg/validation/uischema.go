@@ -0,0 +1,267 @@
+package validation
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidUIScope is returned when a ui.json scope doesn't point at a schema property
+var ErrInvalidUIScope = errors.New("invalid UI schema scope")
+
+// UIScopeLint is the result of cross-checking a form's ui.json against its schema.json
+type UIScopeLint struct {
+	// Missing lists scopes that don't resolve to a schema property. Controls with such
+	// a scope render as blank questions on devices.
+	Missing []string
+	// Unrendered lists top-level schema properties that no control renders. Core fields
+	// are set by the app and are not reported.
+	Unrendered []string
+}
+
+// LintUIScopes cross-checks the ui.json of every form in the bundle against its
+// schema.json, keyed by form name. Forms missing either file, or with invalid JSON,
+// are reported by ValidateBundle instead.
+func LintUIScopes(bundlePath string) (map[string]UIScopeLint, error) {
+	zipFile, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer zipFile.Close()
+
+	return lintBundleUIScopes(&zipFile.Reader), nil
+}
+
+// UnrenderedFieldWarnings lists, per form, the schema properties no control renders
+func UnrenderedFieldWarnings(bundlePath string) ([]string, error) {
+	lints, err := LintUIScopes(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, name := range sortedFormNames(lints) {
+		if unrendered := lints[name].Unrendered; len(unrendered) > 0 {
+			warnings = append(warnings, fmt.Sprintf("form '%s': %s not rendered by any ui.json control", name, strings.Join(unrendered, ", ")))
+		}
+	}
+	return warnings, nil
+}
+
+// validateFormUIScopes rejects forms whose ui.json scopes point at properties missing
+// from schema.json
+func validateFormUIScopes(zipReader *zip.Reader) error {
+	lints := lintBundleUIScopes(zipReader)
+
+	var problems []string
+	for _, name := range sortedFormNames(lints) {
+		for _, scope := range lints[name].Missing {
+			problems = append(problems, fmt.Sprintf("form '%s': scope '%s' does not match a property in schema.json", name, scope))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidUIScope, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// bundleForm is a form's parsed schema.json and ui.json
+type bundleForm struct {
+	schema, ui map[string]interface{}
+}
+
+// readBundleForms parses every form that has both a parseable schema.json and ui.json
+func readBundleForms(zipReader *zip.Reader) map[string]bundleForm {
+	type formFiles struct{ schema, ui *zip.File }
+	forms := make(map[string]*formFiles)
+	for _, file := range zipReader.File {
+		parts := strings.Split(file.Name, "/")
+		if len(parts) != 3 || parts[0] != "forms" {
+			continue
+		}
+		if forms[parts[1]] == nil {
+			forms[parts[1]] = &formFiles{}
+		}
+		switch parts[2] {
+		case "schema.json":
+			forms[parts[1]].schema = file
+		case "ui.json":
+			forms[parts[1]].ui = file
+		}
+	}
+
+	parsed := make(map[string]bundleForm)
+	for name, files := range forms {
+		if files.schema == nil || files.ui == nil {
+			continue
+		}
+		var form bundleForm
+		if readZipJSON(files.schema, &form.schema) != nil || readZipJSON(files.ui, &form.ui) != nil {
+			continue
+		}
+		parsed[name] = form
+	}
+	return parsed
+}
+
+// lintBundleUIScopes lints every form that has both a parseable schema.json and ui.json
+func lintBundleUIScopes(zipReader *zip.Reader) map[string]UIScopeLint {
+	lints := make(map[string]UIScopeLint)
+	for name, form := range readBundleForms(zipReader) {
+		lints[name] = lintUIScopes(form.schema, form.ui)
+	}
+	return lints
+}
+
+// lintUIScopes cross-checks the Control and rule scopes of a UI schema against the data schema
+func lintUIScopes(schema, ui map[string]interface{}) UIScopeLint {
+	var lint UIScopeLint
+	rendered := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	var walk func(node interface{}, bases []interface{})
+	walk = func(node interface{}, bases []interface{}) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			if scope, ok := v["scope"].(string); ok {
+				target, found := resolveScope(schema, bases, scope)
+				if !found {
+					missing[scope] = true
+				} else if v["type"] == "Control" {
+					if name, ok := topLevelProperty(scope); ok && len(bases) == 1 {
+						rendered[name] = true
+					}
+					// Array details are scoped relative to the items schema
+					if items, ok := target["items"].(map[string]interface{}); ok {
+						bases = append(bases[:len(bases):len(bases)], items)
+					}
+				}
+			}
+			for key, value := range v {
+				if key == "scope" {
+					continue
+				}
+				walk(value, bases)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item, bases)
+			}
+		}
+	}
+	walk(ui, []interface{}{schema})
+
+	props, _ := schema["properties"].(map[string]interface{})
+	for name, prop := range props {
+		field, _ := prop.(map[string]interface{})
+		isCore, _ := field["x-core"].(bool)
+		if !isCore && !strings.HasPrefix(name, "core_") && !rendered[name] {
+			lint.Unrendered = append(lint.Unrendered, name)
+		}
+	}
+	for scope := range missing {
+		lint.Missing = append(lint.Missing, scope)
+	}
+	sort.Strings(lint.Unrendered)
+	sort.Strings(lint.Missing)
+	return lint
+}
+
+// topLevelProperty returns the property name of a scope of the form #/properties/{name}
+func topLevelProperty(scope string) (string, bool) {
+	tokens := scopeTokens(scope)
+	if len(tokens) < 2 || tokens[0] != "properties" {
+		return "", false
+	}
+	return tokens[1], true
+}
+
+// resolveScope resolves a scope against the innermost schema in bases first and then
+// against the enclosing ones, so both absolute and item-relative detail scopes work
+func resolveScope(root map[string]interface{}, bases []interface{}, scope string) (map[string]interface{}, bool) {
+	if scope == "#" || scope == "#/" {
+		return root, true
+	}
+	if !strings.HasPrefix(scope, "#/") {
+		return nil, false
+	}
+	tokens := scopeTokens(scope)
+	for i := len(bases) - 1; i >= 0; i-- {
+		if target, ok := resolvePointer(root, bases[i], tokens); ok {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// scopeTokens splits a JSON pointer scope into unescaped reference tokens
+func scopeTokens(scope string) []string {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(scope, "#"), "/")
+	if trimmed == "" {
+		return nil
+	}
+	tokens := strings.Split(trimmed, "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// resolvePointer walks tokens from node, following local $ref definitions
+func resolvePointer(root map[string]interface{}, node interface{}, tokens []string) (map[string]interface{}, bool) {
+	for _, token := range tokens {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				ref, isRef := v["$ref"].(string)
+				if !isRef || !strings.HasPrefix(ref, "#/") {
+					return nil, false
+				}
+				target, found := resolvePointer(root, root, scopeTokens(ref))
+				if !found {
+					return nil, false
+				}
+				if next, ok = target[token]; !ok {
+					return nil, false
+				}
+			}
+			node = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			node = v[index]
+		default:
+			return nil, false
+		}
+	}
+	target, ok := node.(map[string]interface{})
+	return target, ok
+}
+
+// sortedFormNames returns the form names of lints in order
+func sortedFormNames(lints map[string]UIScopeLint) []string {
+	names := make([]string, 0, len(lints))
+	for name := range lints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readZipJSON decodes a JSON file from the bundle
+func readZipJSON(file *zip.File, v interface{}) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
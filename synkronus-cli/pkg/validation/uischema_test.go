@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUIScopeValidation(t *testing.T) {
+	schema := `{"type": "object", "properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer"},
+		"core_id": {"type": "string"},
+		"members": {"type": "array", "items": {"type": "object", "properties": {"member_name": {"type": "string"}}}}
+	}}`
+
+	valid := createTestBundle(t, map[string]string{
+		"app/index.html":         "<html></html>",
+		"forms/user/schema.json": schema,
+		"forms/user/ui.json": `{"type": "VerticalLayout", "elements": [
+			{"type": "Control", "scope": "#/properties/name"},
+			{"type": "Control", "scope": "#/properties/members", "options": {"detail": {"type": "Control", "scope": "#/properties/member_name"}}}
+		]}`,
+	})
+	defer os.Remove(valid)
+
+	if err := ValidateBundle(valid); err != nil {
+		t.Fatalf("ValidateBundle() error = %v", err)
+	}
+	warnings, err := UnrenderedFieldWarnings(valid)
+	if err != nil {
+		t.Fatalf("UnrenderedFieldWarnings() error = %v", err)
+	}
+	want := []string{"form 'user': age not rendered by any ui.json control"}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("UnrenderedFieldWarnings() = %v, want %v", warnings, want)
+	}
+
+	broken := createTestBundle(t, map[string]string{
+		"app/index.html":         "<html></html>",
+		"forms/user/schema.json": schema,
+		"forms/user/ui.json":     `{"type": "Control", "scope": "#/properties/nmae"}`,
+	})
+	defer os.Remove(broken)
+
+	if err := ValidateBundle(broken); !errors.Is(err, ErrInvalidUIScope) {
+		t.Errorf("ValidateBundle() error = %v, want ErrInvalidUIScope", err)
+	}
+}
+
+func TestUIRuleValidation(t *testing.T) {
+	schema := `{"type": "object", "properties": {
+		"consent": {"type": "boolean"},
+		"age": {"type": "integer"},
+		"village": {"type": "string", "enum": ["north", "south"]}
+	}}`
+
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr string
+	}{
+		{"valid", `{"effect": "SHOW", "condition": {"type": "OR", "conditions": [
+			{"scope": "#/properties/consent", "schema": {"const": true}},
+			{"scope": "#/properties/age", "schema": {"minimum": 18}}
+		]}}`, ""},
+		{"effect", `{"effect": "VISIBLE", "condition": {"scope": "#/properties/consent", "schema": {"const": true}}}`,
+			"effect VISIBLE is not one of SHOW, HIDE, ENABLE and DISABLE"},
+		{"type mismatch", `{"effect": "SHOW", "condition": {"scope": "#/properties/age", "schema": {"const": "18"}}}`,
+			"const string \"18\" can never match integer field '#/properties/age'"},
+		{"unknown value", `{"effect": "HIDE", "condition": {"scope": "#/properties/village", "schema": {"enum": ["east"]}}}`,
+			"enum value \"east\" is not one of the values of '#/properties/village'"},
+		{"missing schema", `{"effect": "HIDE", "condition": {"scope": "#/properties/village"}}`,
+			"condition needs a scope and a schema object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := createTestBundle(t, map[string]string{
+				"app/index.html":         "<html></html>",
+				"forms/user/schema.json": schema,
+				"forms/user/ui.json":     `{"type": "Control", "scope": "#/properties/village", "rule": ` + tt.rule + `}`,
+			})
+			defer os.Remove(bundle)
+
+			err := ValidateBundle(bundle)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateBundle() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidUIRule) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateBundle() error = %v, want ErrInvalidUIRule containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
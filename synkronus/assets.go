@@ -0,0 +1,49 @@
+// Package synkronus embeds the files the server ships with, the favicon and other static
+// assets, the Swagger UI and OpenAPI document, and the portal when it is built into the
+// binary, so a single binary serves them wherever it runs.
+package synkronus
+
+import (
+	"embed"
+	"io/fs"
+)
+
+var (
+	//go:embed static
+	staticFiles embed.FS
+
+	//go:embed openapi/swagger-ui.html openapi/synkronus.yaml
+	openAPIFiles embed.FS
+
+	// portal holds the built portal (synkronus-portal/dist) when it was copied there
+	// before the build; otherwise only a placeholder
+	//go:embed all:portal
+	portalFiles embed.FS
+)
+
+// StaticFS returns the embedded static assets
+func StaticFS() fs.FS {
+	return mustSub(staticFiles, "static")
+}
+
+// OpenAPIFS returns the embedded Swagger UI and OpenAPI document
+func OpenAPIFS() fs.FS {
+	return mustSub(openAPIFiles, "openapi")
+}
+
+// PortalFS returns the embedded portal, or nil when the binary was built without it
+func PortalFS() fs.FS {
+	portal := mustSub(portalFiles, "portal")
+	if _, err := fs.Stat(portal, "index.html"); err != nil {
+		return nil
+	}
+	return portal
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
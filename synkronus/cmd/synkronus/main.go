@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -17,14 +18,40 @@ import (
 	"github.com/opendataensemble/synkronus/pkg/appbundle"
 	"github.com/opendataensemble/synkronus/pkg/attachment"
 	"github.com/opendataensemble/synkronus/pkg/auth"
+	"github.com/opendataensemble/synkronus/pkg/batchupdate"
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/cdn"
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+	"github.com/opendataensemble/synkronus/pkg/checkpoint"
+	"github.com/opendataensemble/synkronus/pkg/completeness"
 	"github.com/opendataensemble/synkronus/pkg/config"
 	"github.com/opendataensemble/synkronus/pkg/database"
 	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/dedup"
+	"github.com/opendataensemble/synkronus/pkg/demo"
+	"github.com/opendataensemble/synkronus/pkg/diagnostics"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	"github.com/opendataensemble/synkronus/pkg/exportschedule"
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
+	"github.com/opendataensemble/synkronus/pkg/formaccess"
+	"github.com/opendataensemble/synkronus/pkg/formmigration"
+	"github.com/opendataensemble/synkronus/pkg/formpermission"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+	"github.com/opendataensemble/synkronus/pkg/maintenance"
 	"github.com/opendataensemble/synkronus/pkg/migrations"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
+	"github.com/opendataensemble/synkronus/pkg/render"
+	"github.com/opendataensemble/synkronus/pkg/requiredattachment"
+	"github.com/opendataensemble/synkronus/pkg/stats"
+	"github.com/opendataensemble/synkronus/pkg/strictschema"
 	"github.com/opendataensemble/synkronus/pkg/sync"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
 	"github.com/opendataensemble/synkronus/pkg/user"
 	"github.com/opendataensemble/synkronus/pkg/version"
+	"github.com/opendataensemble/synkronus/pkg/workflow"
 )
 
 func redactPassword(dsn string) string {
@@ -49,12 +76,18 @@ func main() {
 		logger.WithPrettyPrint(true),
 	)
 
+	demoMode := flag.Bool("demo", false, "seed demo users, a sample app bundle and synthetic observations (same as DEMO_MODE=true)")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.Load(preLog)
 	if err != nil {
 		preLog.Error("Error loading configuration", "error", err)
 		os.Exit(1)
 	}
+	if *demoMode {
+		cfg.DemoMode = true
+	}
 
 	// Initialize the logger
 	logLevel := logger.LevelInfo
@@ -79,11 +112,40 @@ func main() {
 	log.Info("Configuration loaded from", "source", cfg.Source)
 	log.Debug("Configuration details", "port", cfg.Port, "logLevel", cfg.LogLevel, "appBundlePath", cfg.AppBundlePath)
 
+	// Initialize tracing before the database so queries are instrumented
+	tracingConfig := tracing.DefaultConfig()
+	tracingConfig.Endpoint = cfg.OTLPEndpoint
+	tracingConfig.ServiceName = cfg.TraceServiceName
+	tracingConfig.SampleRatio = cfg.TraceSampleRatio
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig)
+	if err != nil {
+		log.Error("Failed to initialize tracing", "error", err)
+		log.Info("Exiting due to tracing initialization error")
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("Failed to flush traces", "error", err)
+		}
+	}()
+	if cfg.OTLPEndpoint != "" {
+		log.Info("Tracing enabled", "endpoint", cfg.OTLPEndpoint, "serviceName", cfg.TraceServiceName)
+	}
+
 	// Initialize database
 	dbConfig := database.DefaultConfig()
 	// Override database config from configuration
 	dbConfig.ConnectionString = cfg.DatabaseURL
 	dbConfig.MigrationsFS = migrations.GetFS()
+	dbConfig.Retry.MaxAttempts = cfg.DBRetryMaxAttempts
+	dbConfig.Retry.InitialBackoff = time.Duration(cfg.DBRetryInitialBackoffMs) * time.Millisecond
+	dbConfig.Retry.MaxBackoff = time.Duration(cfg.DBRetryMaxBackoffMs) * time.Millisecond
+	dbConfig.Retry.BreakerThreshold = cfg.DBBreakerThreshold
+	dbConfig.Retry.BreakerCooldown = time.Duration(cfg.DBBreakerCooldownSeconds) * time.Second
+	dbConfig.StatementCacheSize = cfg.DBStatementCacheSize
 
 	log.Info("Initializing database connection", "connection_string", redactPassword(cfg.DatabaseURL))
 	db, err := database.New(dbConfig, log)
@@ -103,13 +165,61 @@ func main() {
 	}
 	log.Info("Database migrations completed successfully")
 
+	// Make sure the sync hot paths are indexed; databases restored from dumps or
+	// created outside the migrations often miss them
+	diagnosticsConfig := diagnostics.DefaultConfig()
+	diagnosticsConfig.EnsureIndexes = cfg.EnsureIndexes
+	diagnosticsConfig.SlowQueryThreshold = time.Duration(cfg.SlowQueryThresholdMs) * time.Millisecond
+	diagnosticsConfig.Retry = db.Retrier()
+
+	diagnosticsService := diagnostics.NewService(db.DB(), diagnosticsConfig, log)
+	if created, err := diagnosticsService.EnsureIndexes(context.Background()); err != nil {
+		log.Error("Failed to ensure database indexes", "error", err)
+	} else if len(created) > 0 {
+		log.Info("Created missing database indexes", "indexes", created)
+	}
+
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db, log)
+	inviteRepo := repository.NewInvitationRepository(db, log)
+	resetRepo := repository.NewPasswordResetRepository(db, log)
+	sessionRepo := repository.NewSessionRepository(db, log)
 
 	// Initialize auth service
 	authConfig := auth.DefaultConfig()
 	// Override auth config from configuration
 	authConfig.JWTSecret = cfg.JWTSecret
+	if cfg.Argon2MemoryKB <= 0 || cfg.Argon2Iterations <= 0 || cfg.Argon2Parallelism <= 0 || cfg.Argon2Parallelism > 255 {
+		log.Error("Invalid argon2 parameters", "memoryKB", cfg.Argon2MemoryKB, "iterations", cfg.Argon2Iterations, "parallelism", cfg.Argon2Parallelism)
+		return
+	}
+	authConfig.Password = auth.PasswordConfig{
+		Algorithm:         cfg.PasswordHashAlgorithm,
+		BcryptCost:        cfg.BcryptCost,
+		Argon2Memory:      uint32(cfg.Argon2MemoryKB),
+		Argon2Iterations:  uint32(cfg.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+	if err := authConfig.Password.Validate(); err != nil {
+		log.Error("Invalid password hashing configuration", "error", err)
+		return
+	}
+	if cfg.ImpersonationTokenTTLMinutes <= 0 {
+		log.Error("Invalid impersonation token lifetime", "minutes", cfg.ImpersonationTokenTTLMinutes)
+		return
+	}
+	authConfig.ImpersonationTokenExpiration = time.Duration(cfg.ImpersonationTokenTTLMinutes) * time.Minute
+
+	sameSite, err := auth.ParseSameSite(cfg.PortalCookieSameSite)
+	if err != nil {
+		log.Error("Invalid portal cookie configuration", "error", err)
+		return
+	}
+	authConfig.Cookies = auth.CookieConfig{
+		Enabled:  cfg.PortalCookieSessions,
+		Secure:   cfg.PortalCookieSecure,
+		SameSite: sameSite,
+	}
 
 	// These can still be overridden by environment variables for security
 	if adminUsername := os.Getenv("ADMIN_USERNAME"); adminUsername != "" {
@@ -119,7 +229,7 @@ func main() {
 		authConfig.AdminPassword = adminPassword
 	}
 
-	authService := auth.NewService(authConfig, userRepo, log)
+	authService := auth.NewService(authConfig, userRepo, sessionRepo, log)
 
 	// Initialize the auth service and create admin user if needed
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -135,6 +245,34 @@ func main() {
 	// Override app bundle config from configuration
 	appBundleConfig.BundlePath = cfg.AppBundlePath
 	appBundleConfig.MaxVersions = cfg.MaxVersionsKept
+	appBundleConfig.History = appbundle.NewChangeHistory(db.DB())
+	appBundleConfig.Limits = appbundle.Limits{
+		MaxBytes:     int64(cfg.AppBundleMaxSizeMB) << 20,
+		MaxForms:     cfg.AppBundleMaxForms,
+		MaxRenderers: cfg.AppBundleMaxRenderers,
+	}
+	appBundleConfig.MaxUploadBytes = int64(cfg.AppBundleMaxUploadMB) << 20
+	switch cfg.AppBundleUploadStore {
+	case "memory":
+		appBundleConfig.Uploads = appbundle.NewMemoryUploadStore()
+	case "disk":
+	default:
+		log.Warn("Unknown APP_BUNDLE_UPLOAD_STORE; staging app bundle uploads on disk", "store", cfg.AppBundleUploadStore)
+	}
+	if cfg.AppBundleBootCheckChrome != "" {
+		appBundleConfig.BootChecker = appbundle.NewChromeBootChecker(cfg.AppBundleBootCheckChrome, time.Duration(cfg.AppBundleBootCheckTimeout)*time.Second)
+	}
+	if cfg.CDNPublicURL != "" {
+		cdnConfig := cdn.DefaultConfig()
+		cdnConfig.PublicURL = cfg.CDNPublicURL
+		cdnConfig.PurgeURL = cfg.CDNPurgeURL
+		cdnConfig.PurgeToken = cfg.CDNPurgeToken
+		cdnConfig.BatchSize = cfg.CDNPurgeBatchSize
+		appBundleConfig.CDN = cdn.New(cdnConfig)
+		if !cdnConfig.Enabled() {
+			log.Warn("CDN_PUBLIC_URL is set without CDN_PURGE_URL; cached app bundle files may be stale after version switches")
+		}
+	}
 
 	appBundleService := appbundle.NewService(appBundleConfig, log)
 
@@ -145,11 +283,69 @@ func main() {
 		return
 	}
 
+	// Initialize the calculation service; pushes take the server's values of calculated
+	// fields and stored observations are backfilled when the formulas change
+	calculationConfig := calculation.DefaultConfig()
+	calculationConfig.BundlePath = cfg.AppBundlePath
+	calculationConfig.BackfillInterval = time.Duration(cfg.CalculationBackfillMinutes) * time.Minute
+	calculationService := calculation.NewService(db.DB(), calculationConfig, log)
+
+	calculationCtx, stopCalculation := context.WithCancel(context.Background())
+	defer stopCalculation()
+	calculationService.Start(calculationCtx)
+
 	// Initialize sync service
 	syncConfig := sync.DefaultConfig()
+	syncConfig.Calculator = calculationService
+	formAccessConfig := formaccess.DefaultConfig()
+	formAccessConfig.BundlePath = cfg.AppBundlePath
+	syncConfig.Access = formaccess.NewService(formAccessConfig, log)
+	// Granted form types sync only for the roles and users they are granted to
+	formPermissionService := formpermission.NewService(db.DB(), log)
+	syncConfig.Permissions = formPermissionService
+	strictSchemaConfig := strictschema.DefaultConfig()
+	strictSchemaConfig.BundlePath = cfg.AppBundlePath
+	syncConfig.Schemas = strictschema.NewService(strictSchemaConfig, log)
+	syncConfig.ClockSkewTolerance = time.Duration(cfg.SyncClockSkewToleranceSeconds) * time.Second
+	if syncConfig.TimestampFormat, err = sync.ParseTimestampFormat(cfg.SyncTimestampFormat); err != nil {
+		log.Error("Invalid SYNC_TIMESTAMP_FORMAT", "error", err)
+		os.Exit(1)
+	}
+	if syncConfig.FutureTimestampPolicy, err = sync.ParseFutureTimestampPolicy(cfg.SyncFutureTimestampPolicy); err != nil {
+		log.Error("Invalid SYNC_FUTURE_TIMESTAMP_POLICY", "error", err)
+		os.Exit(1)
+	}
+	if syncConfig.ConflictPolicy, err = sync.ParseConflictPolicy(cfg.SyncConflictPolicy); err != nil {
+		log.Error("Invalid SYNC_CONFLICT_POLICY", "error", err)
+		os.Exit(1)
+	}
+	if cfg.SyncValidateData {
+		syncConfig.Validator = sync.NewSchemaValidator(appBundleService, log)
+	}
 
+	syncConfig.Retry = db.Retrier()
+	syncConfig.Statements = db.Statements()
+
+	// Review locks hold off pushes of observations being corrected
+	observationLockConfig := observationlock.DefaultConfig()
+	observationLockConfig.DefaultTTL = time.Duration(cfg.ObservationLockDefaultTTLMinutes) * time.Minute
+	observationLockConfig.MaxTTL = time.Duration(cfg.ObservationLockMaxTTLMinutes) * time.Minute
+	observationLockService := observationlock.NewService(db.DB(), observationLockConfig, log)
+	syncConfig.Locks = observationLockService
+
+	// Fields tagged x-attachment-required are checked for uploaded media on push
+	requiredAttachmentConfig := requiredattachment.DefaultConfig()
+	requiredAttachmentConfig.BundlePath = cfg.AppBundlePath
+	requiredAttachmentConfig.Grace = time.Duration(cfg.AttachmentRequiredGraceMinutes) * time.Minute
+	syncConfig.Attachments = requiredattachment.NewService(db.DB(), requiredAttachmentConfig, log)
 	syncService := sync.NewService(db.DB(), syncConfig, log)
 
+	// Review workflows of forms with x-workflow, hidden like their observations
+	workflowConfig := workflow.DefaultConfig()
+	workflowConfig.BundlePath = cfg.AppBundlePath
+	workflowConfig.Access = syncConfig.Access
+	workflowService := workflow.NewService(db.DB(), workflowConfig, log)
+
 	// Initialize the sync service
 	if err := syncService.Initialize(ctx); err != nil {
 		log.Error("Failed to initialize sync service", "error", err)
@@ -158,23 +354,252 @@ func main() {
 	}
 
 	// Initialize user service
-	userService := user.NewService(userRepo, authService, log)
+	var mailer mail.Mailer
+	mailConfig := mail.Config{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+	if mailConfig.Enabled() {
+		if mailConfig.From == "" {
+			log.Error("SMTP_FROM is required when SMTP_HOST is set")
+			return
+		}
+		mailer = mail.NewSMTPMailer(mailConfig)
+	} else {
+		log.Info("SMTP_HOST not set, password reset by email is disabled")
+	}
+	resetConfig := user.DefaultPasswordResetConfig()
+	resetConfig.TTL = time.Duration(cfg.PasswordResetTTLMinutes) * time.Minute
+	resetConfig.URLBase = cfg.PasswordResetURLBase
+	userService := user.NewService(userRepo, inviteRepo, resetRepo, authService, mailer, resetConfig, log)
 
 	// Initialize version service
 	versionService := version.NewService(db.DB())
 
 	// Initialize attachment manifest service
-	attachmentManifestService := attachment.NewManifestService(db.DB(), cfg, log)
+	attachmentManifestService := attachment.WithRetry(attachment.NewCachedManifestService(db.DB(), db.Statements(), cfg, log), db.Retrier())
 	if err := attachmentManifestService.Initialize(ctx); err != nil {
 		log.Error("Failed to initialize attachment manifest service", "error", err)
 		log.Info("Exiting due to attachment manifest service initialization error")
 		return
 	}
 
+	// Compact attachment operations that no client can still need
+	compactionConfig := attachment.DefaultCompactionConfig()
+	compactionConfig.Interval = time.Duration(cfg.AttachmentCompactionMinutes) * time.Minute
+	compactionConfig.ClientTTL = time.Duration(cfg.AttachmentCompactionClientTTL) * 24 * time.Hour
+
+	compactionCtx, stopCompaction := context.WithCancel(context.Background())
+	defer stopCompaction()
+	attachment.NewCompactionService(db.DB(), compactionConfig, log).Start(compactionCtx)
+
+	// Purge tombstones of observations deleted before the retention window
+	tombstoneConfig := sync.DefaultCompactionConfig()
+	tombstoneConfig.Interval = time.Duration(cfg.SyncTombstoneCompactionMinutes) * time.Minute
+	tombstoneConfig.Retention = time.Duration(cfg.SyncTombstoneRetentionDays) * 24 * time.Hour
+	sync.NewCompactionService(db.DB(), tombstoneConfig, log).Start(compactionCtx)
+
 	// Initialize data export service
-	dataExportDB := dataexport.NewPostgresDB(db.DB())
+	dataExportDB := dataexport.WithRetry(dataexport.NewPostgresDB(db.DB()), db.Retrier())
 	dataExportService := dataexport.NewService(dataExportDB, cfg)
 
+	// Initialize observation stats service and start the refresh schedule
+	statsConfig := stats.DefaultConfig()
+	statsConfig.RefreshInterval = time.Duration(cfg.StatsRefreshMinutes) * time.Minute
+	statsConfig.GridSize = cfg.StatsGridSize
+
+	statsService := stats.NewService(db.DB(), statsConfig, log)
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	defer stopStats()
+	statsService.Start(statsCtx)
+
+	// Initialize the duplicate-detection report service
+	dedupConfig := dedup.DefaultConfig()
+	dedupConfig.TimeWindow = time.Duration(cfg.DedupTimeWindowHours) * time.Hour
+	dedupConfig.MaxDistanceMeters = cfg.DedupMaxDistanceMeters
+	dedupConfig.MinScore = cfg.DedupMinScore
+	dedupConfig.MaxObservations = cfg.DedupMaxObservations
+	dedupService := dedup.NewService(db.DB(), dedupConfig, log)
+
+	// Initialize the feature flag service
+	featureFlagConfig := featureflag.DefaultConfig()
+	featureFlagConfig.CacheTTL = time.Duration(cfg.FeatureFlagCacheSeconds) * time.Second
+	featureFlagService := featureflag.NewService(db.DB(), featureFlagConfig, log)
+
+	// Initialize the maintenance mode service
+	maintenanceConfig := maintenance.DefaultConfig()
+	maintenanceConfig.CacheTTL = time.Duration(cfg.MaintenanceCacheSeconds) * time.Second
+	maintenanceConfig.RetryAfter = time.Duration(cfg.MaintenanceRetryAfterSeconds) * time.Second
+	maintenanceService := maintenance.NewService(db.DB(), maintenanceConfig, log)
+
+	// Initialize payload encryption; session keys are sealed with the JWT secret unless a
+	// separate secret is set
+	payloadConfig := payloadcrypto.DefaultConfig()
+	if payloadConfig.Mode, err = payloadcrypto.ParseMode(cfg.PayloadEncryption); err != nil {
+		log.Error("Invalid PAYLOAD_ENCRYPTION", "error", err)
+		os.Exit(1)
+	}
+	payloadConfig.Secret = cfg.PayloadEncryptionSecret
+	if payloadConfig.Secret == "" {
+		payloadConfig.Secret = cfg.JWTSecret
+	}
+	payloadConfig.KeyTTL = time.Duration(cfg.PayloadKeyTTLHours) * time.Hour
+	if cfg.PayloadMaxBodyMB > 0 {
+		payloadConfig.MaxBodySize = int64(cfg.PayloadMaxBodyMB) << 20
+	}
+	payloadCryptoService, err := payloadcrypto.NewService(db.DB(), payloadConfig, log)
+	if err != nil {
+		log.Error("Failed to initialize payload encryption", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize the batch update service; changed observations get the server's values
+	// of their calculated fields
+	batchUpdateConfig := batchupdate.DefaultConfig()
+	batchUpdateConfig.Calculator = calculationService
+	batchUpdateService := batchupdate.NewService(db.DB(), batchUpdateConfig, log)
+	if err := batchUpdateService.Initialize(ctx); err != nil {
+		log.Error("Failed to initialize batch update service", "error", err)
+	}
+
+	// Initialize the observation change feed; changes are recorded in an outbox by the
+	// transaction that makes them and published to the broker after it commits
+	changeFeedConfig := changefeed.DefaultConfig()
+	changeFeedConfig.Broker = cfg.ChangeFeedBroker
+	changeFeedConfig.Topic = cfg.ChangeFeedTopic
+	changeFeedConfig.PollInterval = time.Duration(cfg.ChangeFeedPollSeconds) * time.Second
+	changeFeedConfig.BatchSize = cfg.ChangeFeedBatchSize
+	changeFeedConfig.Retention = time.Duration(cfg.ChangeFeedRetentionDays) * 24 * time.Hour
+	var changeFeedPublisher changefeed.Publisher
+	if cfg.ChangeFeedBroker != "" {
+		if changeFeedPublisher, err = changefeed.NewPublisher(cfg.ChangeFeedBroker, cfg.ChangeFeedURL, cfg.ChangeFeedTopic); err != nil {
+			log.Error("Invalid change feed configuration", "error", err)
+			os.Exit(1)
+		}
+	}
+	changeFeedService := changefeed.NewService(db.DB(), changeFeedConfig, changeFeedPublisher, log)
+	if err := changeFeedService.Initialize(ctx); err != nil {
+		log.Error("Failed to initialize change feed", "error", err)
+	}
+	changeFeedCtx, stopChangeFeed := context.WithCancel(context.Background())
+	defer stopChangeFeed()
+	changeFeedService.Start(changeFeedCtx)
+
+	// Initialize form migration; the active bundle's migration scripts bring stored
+	// observations up to the current form version
+	formMigrationConfig := formmigration.DefaultConfig()
+	formMigrationConfig.NodePath = cfg.BundleMigrationNodePath
+	formMigrationConfig.Timeout = time.Duration(cfg.BundleMigrationTimeoutSeconds) * time.Second
+	formMigrationService := formmigration.NewService(db.DB(), appBundleService, formMigrationConfig, log)
+
+	// Initialize the required-field completeness report; required fields and attachments
+	// come from the active bundle's form schemas
+	completenessConfig := completeness.DefaultConfig()
+	completenessConfig.AttachmentGrace = requiredAttachmentConfig.Grace
+	completenessService := completeness.NewService(db.DB(), appBundleService, completenessConfig, log)
+
+	// Initialize the rendering service; observation PDFs embed attached photos and signatures
+	renderConfig := render.DefaultConfig()
+	renderConfig.BundlePath = cfg.AppBundlePath
+	renderConfig.PageSize = cfg.PDFPageSize
+	var renderAttachments render.Attachments
+	attachmentService, err := attachment.NewService(cfg)
+	if err != nil {
+		log.Error("Failed to initialize attachment storage", "error", err)
+	} else {
+		renderAttachments = attachmentService
+	}
+	renderService := render.NewService(db.DB(), renderAttachments, renderConfig, log)
+
+	// Initialize attachment replication; uploads are mirrored to the replica path in the
+	// background and their replication status is tracked in the attachments table
+	replicationConfig := attachment.DefaultReplicationConfig()
+	replicationConfig.Interval = time.Duration(cfg.AttachmentReplicationIntervalSeconds) * time.Second
+	replicationConfig.MaxAttempts = cfg.AttachmentReplicationMaxAttempts
+	var replica attachment.ReplicaStore
+	if cfg.AttachmentReplicaPath != "" && attachmentService != nil {
+		if replica, err = attachment.NewDirReplica(cfg.AttachmentReplicaPath); err != nil {
+			log.Error("Failed to initialize attachment replica", "error", err)
+		}
+	}
+	replicationService := attachment.NewReplicationService(db.DB(), attachmentService, replica, replicationConfig, log)
+	replicationCtx, stopReplication := context.WithCancel(context.Background())
+	defer stopReplication()
+	replicationService.Start(replicationCtx)
+
+	// Initialize video transcoding; uploaded videos are transcoded with ffmpeg in the
+	// background and the transcoded variant is served by default
+	transcodeConfig := attachment.DefaultTranscodeConfig()
+	transcodeConfig.Interval = time.Duration(cfg.AttachmentTranscodeIntervalSeconds) * time.Second
+	transcodeConfig.Timeout = time.Duration(cfg.AttachmentTranscodeTimeoutSeconds) * time.Second
+	transcodeConfig.KeepOriginal = cfg.AttachmentTranscodeKeepOriginal
+	var transcoder attachment.Transcoder
+	if cfg.AttachmentTranscodeFFmpegPath != "" && attachmentService != nil {
+		transcoder = attachment.NewFFmpegTranscoder(attachment.FFmpegConfig{
+			Path:       cfg.AttachmentTranscodeFFmpegPath,
+			MaxHeight:  cfg.AttachmentTranscodeMaxHeight,
+			VideoCodec: cfg.AttachmentTranscodeVideoCodec,
+			CRF:        cfg.AttachmentTranscodeCRF,
+		})
+	}
+	transcodeService := attachment.NewTranscodeService(db.DB(), attachmentService, transcoder, transcodeConfig, log)
+	transcodeCtx, stopTranscode := context.WithCancel(context.Background())
+	defer stopTranscode()
+	transcodeService.Start(transcodeCtx)
+
+	// Initialize the registry of downstream export consumers and the versions they ingested
+	exportConsumerService := exportconsumer.NewService(db.DB(), log)
+
+	// Initialize the admin-defined export reports
+	exportReportConfig := exportreport.DefaultConfig()
+	exportReportConfig.MaxRows = cfg.ExportReportMaxRows
+	exportReportConfig.Timeout = time.Duration(cfg.ExportReportTimeoutSeconds) * time.Second
+	exportReportService := exportreport.NewService(db.DB(), exportReportConfig, log)
+
+	// Run export reports on their schedules and deliver them to directories or webhooks
+	exportScheduleConfig := exportschedule.DefaultConfig()
+	exportScheduleConfig.Dir = cfg.ExportScheduleDir
+	exportScheduleConfig.Interval = time.Duration(cfg.ExportScheduleIntervalSeconds) * time.Second
+	exportScheduleConfig.WebhookTimeout = time.Duration(cfg.ExportScheduleWebhookTimeoutSeconds) * time.Second
+	exportScheduleService := exportschedule.NewService(db.DB(), exportReportService, exportScheduleConfig, log)
+	exportScheduleCtx, stopExportSchedules := context.WithCancel(context.Background())
+	defer stopExportSchedules()
+	exportScheduleService.Start(exportScheduleCtx)
+
+	// Initialize client sync checkpoints and start the stalled-client alerts
+	checkpointConfig := checkpoint.DefaultConfig()
+	checkpointConfig.StalledAfter = time.Duration(cfg.SyncStalledClientHours) * time.Hour
+	checkpointConfig.CheckInterval = time.Duration(cfg.SyncStalledCheckMinutes) * time.Minute
+	checkpointConfig.AlertEmail = cfg.SyncStalledAlertEmail
+	if checkpointConfig.AlertEmail != "" && mailer == nil {
+		log.Warn("SYNC_STALLED_ALERT_EMAIL is set but SMTP_HOST is not, stalled-client alerts are only logged")
+	}
+	checkpointService := checkpoint.NewService(db.DB(), mailer, checkpointConfig, log)
+	checkpointCtx, stopCheckpoints := context.WithCancel(context.Background())
+	defer stopCheckpoints()
+	checkpointService.Start(checkpointCtx)
+
+	// Seed demo data for evaluation installs and end-to-end tests
+	if cfg.DemoMode {
+		demoConfig := demo.DefaultConfig()
+		demoConfig.Password = cfg.DemoPassword
+		demoService := demo.NewService(db.DB(), userService, appBundleService, syncService, attachmentService, attachmentManifestService, demoConfig, log)
+		seedCtx, cancelSeed := context.WithTimeout(context.Background(), 2*time.Minute)
+		result, err := demoService.Seed(seedCtx)
+		cancelSeed()
+		if err != nil {
+			log.Error("Failed to seed demo data", "error", err)
+			log.Info("Exiting due to demo seeding error")
+			return
+		}
+		log.Warn("Demo mode is on; demo users share the DEMO_PASSWORD, don't use this install for real data",
+			"createdUsers", result.Users, "bundleVersion", result.BundleVersion,
+			"observations", result.Observations, "attachments", result.Attachments)
+	}
+
 	// Convert concrete types to interfaces if needed
 	var (
 		authSvc      auth.AuthServiceInterface           = authService
@@ -194,6 +619,26 @@ func main() {
 		versionService,
 		attachmentManifestService,
 		dataExportService,
+		statsService,
+		diagnosticsService,
+		dedupService,
+		featureFlagService,
+		calculationService,
+		batchUpdateService,
+		renderService,
+		maintenanceService,
+		changeFeedService,
+		formMigrationService,
+		completenessService,
+		replicationService,
+		exportConsumerService,
+		checkpointService,
+		observationLockService,
+		exportReportService,
+		exportScheduleService,
+		workflowService,
+		payloadCryptoService,
+		formPermissionService,
 	)
 
 	// Create the API router with handlers
@@ -1,19 +1,23 @@
 package api
 
 import (
+	"io/fs"
 	"net/http"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 
+	"github.com/opendataensemble/synkronus"
 	"github.com/opendataensemble/synkronus/internal/handlers"
 	"github.com/opendataensemble/synkronus/internal/models"
 	"github.com/opendataensemble/synkronus/pkg/attachment"
 	"github.com/opendataensemble/synkronus/pkg/logger"
 	"github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/middleware/security"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
 )
 
 // NewRouter creates a new router with all API routes configured
@@ -38,14 +42,22 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(tracing.Middleware)
 	r.Use(middleware.RedirectSlashes) // redirects /users to /users/ etc.
 
+	cfg := h.GetConfig()
+	r.Use(security.Headers(security.Config{
+		Enabled:               cfg.SecurityHeaders,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		HSTSMaxAge:            time.Duration(cfg.HSTSMaxAgeSeconds) * time.Second,
+	}))
+
 	// Add CORS middleware
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"accept", "authorization", "content-type", "x-csrf-token", "if-none-match"},
-		ExposedHeaders:   []string{"link", "etag"},
+		AllowedHeaders:   []string{"accept", "authorization", "content-type", "x-csrf-token", "if-none-match", "x-bundle-limit-override", "x-payload-key"},
+		ExposedHeaders:   []string{"link", "etag", "x-payload-key"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -57,42 +69,32 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 
 	r.Get("/openapi/swagger", http.RedirectHandler("/openapi/swagger-ui.html", http.StatusMovedPermanently).ServeHTTP)
 
-	// Serve favicon.ico
+	// Serve the favicon, static files and the OpenAPI documentation (Swagger UI) from the
+	// copies embedded in the binary, unless STATIC_DIR or OPENAPI_DIR point elsewhere
+	staticFS := assetFS(cfg.StaticDir, synkronus.StaticFS())
 	r.Get("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
-		// Get the executable directory
-		execDir, err := os.Executable()
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		// Get the root directory (parent of the executable directory)
-		rootDir := filepath.Dir(filepath.Dir(execDir))
-		// Serve the favicon from the static directory
-		faviconPath := filepath.Join(rootDir, "static", "favicon.ico")
-		http.ServeFile(w, r, faviconPath)
+		http.ServeFileFS(w, r, staticFS, "favicon.ico")
 	})
+	FileServer(r, "/static", http.FS(staticFS))
+	FileServer(r, "/openapi", http.FS(assetFS(cfg.OpenAPIDir, synkronus.OpenAPIFS())))
 
-	// Serve static files
-	// Get the executable directory
-	execDir, err := os.Executable()
-	if err == nil {
-		// Get the root directory (parent of the executable directory)
-		rootDir := filepath.Dir(filepath.Dir(execDir))
-		// Serve static files from the static directory
-		staticDir := filepath.Join(rootDir, "static")
-		FileServer(r, "/static", http.Dir(staticDir))
-
-		// Serve OpenAPI documentation (Swagger UI)
-		appDir := filepath.Dir(execDir)
-		openapiDir := filepath.Join(appDir, "openapi")
-		FileServer(r, "/openapi", http.Dir(openapiDir))
+	// Serve the portal at / when it is embedded or PORTAL_DIR is set
+	var portal fs.FS
+	if cfg.PortalDir != "" {
+		portal = os.DirFS(cfg.PortalDir)
+	} else {
+		portal = synkronus.PortalFS()
 	}
+	r.NotFound(notFoundHandler(r, portal))
 
 	// Authentication routes (public — no auth required)
 	authRoutes := func(r chi.Router) {
 		r.Post("/login", h.Login)
 		r.Post("/refresh", h.RefreshToken)
 		r.Post("/register", h.Register)
+		r.Post("/forgot-password", h.ForgotPassword)
+		r.Post("/reset-password", h.ResetPasswordWithToken)
+		r.With(auth.AuthMiddleware(h.GetAuthService(), log)).Post("/logout", h.Logout)
 	}
 	r.Route("/auth", authRoutes)
 	// Also register under /api for portal compatibility
@@ -104,26 +106,63 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 		log.Error("Failed to initialize attachment service", "error", err)
 	}
 
+	// Create attachment previews; audio other than WAV is decoded by the transcoding ffmpeg
+	previewConfig := attachment.DefaultPreviewConfig()
+	previewConfig.DefaultSize = cfg.AttachmentPreviewDefaultSize
+	previewConfig.MaxSize = cfg.AttachmentPreviewMaxSize
+	previewConfig.MaxSourceBytes = int64(cfg.AttachmentPreviewMaxSourceMB) << 20
+	previewConfig.PDFToPPMPath = cfg.AttachmentPreviewPDFToPPMPath
+	previewConfig.FFmpegPath = cfg.AttachmentTranscodeFFmpegPath
+	previewConfig.Timeout = time.Duration(cfg.AttachmentPreviewTimeoutSeconds) * time.Second
+	var previewService attachment.PreviewService
+	if attachmentService != nil {
+		previewService = attachment.NewPreviewService(attachmentService, previewConfig, log)
+	}
+
 	// Create attachment handler
-	attachmentHandler := handlers.NewAttachmentHandler(log, attachmentService)
+	attachmentHandler := handlers.NewAttachmentHandler(log, attachmentService, h.GetAttachmentManifestService(), previewService)
+
+	// Register attachment routes (including manifest endpoint). These apply authentication
+	// per route so that downloads can also be authorized by a signed URL. Uploads may be
+	// encrypted with a negotiated payload key.
+	uploadMiddleware := func(next http.Handler) http.Handler {
+		return h.RejectDuringMaintenance(h.EncryptPayload(next))
+	}
+	attachmentHandler.RegisterRoutes(r, h.AttachmentManifestHandler, auth.AuthMiddleware(h.GetAuthService(), log), uploadMiddleware)
 
 	// Protected routes - require authentication
 	r.Group(func(r chi.Router) {
 		// Add authentication middleware
 		r.Use(auth.AuthMiddleware(h.GetAuthService(), log))
 
-		// Register attachment routes (including manifest endpoint)
-		attachmentHandler.RegisterRoutes(r, h.AttachmentManifestHandler)
-
 		// Sync routes
 		r.Route("/sync", func(r chi.Router) {
 			// Pull endpoint - accessible to all authenticated users
-			r.Post("/pull", h.Pull)
+			r.With(h.RejectDuringMaintenance, h.EncryptPayload).Post("/pull", h.Pull)
 
 			// Push endpoint - requires read-write or admin role
-			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin)).Post("/push", h.Push)
+			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin), h.RejectDuringMaintenance, h.EncryptPayload).Post("/push", h.Push)
+
+			// Warnings returned by pushes: clients acknowledge their own, admins review all
+			r.Get("/warnings/catalog", h.GetSyncWarningCatalog)
+			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin)).Post("/warnings/ack", h.AcknowledgeSyncWarnings)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/warnings", h.GetSyncWarnings)
+
+			// Sync watermarks: every client that pulls reports its own, admins see who is behind
+			r.Post("/checkpoint", h.RecordSyncCheckpoint)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/clients", h.GetSyncClients)
 		})
 
+		// Payload encryption keys - every user manages their own, admins anyone's
+		cryptoRoutes := func(r chi.Router) {
+			r.Post("/keys", h.NegotiatePayloadKey)
+			r.Get("/keys", h.ListPayloadKeys)
+			r.Delete("/keys/{key_id}", h.RevokePayloadKey)
+		}
+		r.Route("/crypto", cryptoRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/crypto", cryptoRoutes)
+
 		// App bundle routes
 		appBundleRoutes := func(r chi.Router) {
 			// Read endpoints - accessible to all authenticated users
@@ -132,10 +171,19 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 			r.Get("/download-zip", h.DownloadBundleZip)
 			r.Get("/versions", h.GetAppBundleVersions)
 			r.Get("/changes", h.CompareAppBundleVersions)
+			r.Get("/changes/history", h.GetAppBundleChangeHistory)
+			r.Get("/migrations", h.GetFormMigrations)
 
 			// Write endpoints - require admin role
-			r.With(auth.RequireRole(models.RoleAdmin)).Post("/push", h.PushAppBundle)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/push", h.PushAppBundle)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/push/status", h.GetAppBundlePushStatus)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/draft", h.PushAppBundleDraft)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/draft/promote", h.PromoteAppBundleDraft)
 			r.With(auth.RequireRole(models.RoleAdmin)).Post("/switch/{version}", h.SwitchAppBundleVersion)
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/rollback", h.RollbackAppBundle)
+			r.With(auth.RequireRole(models.RoleAdmin)).Put("/versions/{version}/visibility", h.SetAppBundleVersionVisibility)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/versions/{version}/screenshot", h.GetAppBundleBootScreenshot)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/migrations/run", h.RunFormMigration)
 		}
 		r.Route("/app-bundle", appBundleRoutes)
 		// Also register under /api for portal compatibility
@@ -155,9 +203,18 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 			r.With(auth.RequireRole(models.RoleAdmin)).Post("/create", h.CreateUserHandler)
 			r.With(auth.RequireRole(models.RoleAdmin)).Delete("/delete/{username}", h.DeleteUserHandler)
 			r.With(auth.RequireRole(models.RoleAdmin)).Post("/reset-password", h.ResetPasswordHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/set-email", h.SetEmailHandler)
 			r.With(auth.RequireRole(models.RoleAdmin)).Get("/", h.ListUsersHandler)
-			// Authenticated user route
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/invitations", h.CreateInvitationHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/invitations", h.ListInvitationsHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Delete("/invitations/{id}", h.RevokeInvitationHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/logout/{username}", h.LogoutUserHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/impersonate/{username}", h.ImpersonateUserHandler)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/impersonations", h.ListImpersonationAuditHandler)
+			// Authenticated user routes
 			r.Post("/change-password", h.ChangePasswordHandler)
+			r.Get("/sessions", h.ListSessionsHandler)
+			r.Delete("/sessions/{id}", h.RevokeSessionHandler)
 		}
 		r.Route("/users", userRoutes)
 		// Also register under /api for portal compatibility
@@ -167,15 +224,153 @@ func NewRouter(log *logger.Logger, h *handlers.Handler) http.Handler {
 		dataExportRoutes := func(r chi.Router) {
 			// Parquet export - accessible to read-only users and above
 			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/parquet", h.ParquetExportHandler)
+			// CSV export with the Parquet columns, for tools without Arrow support
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/csv", h.CSVExportHandler)
+			// Changes since a version as upsert/delete files with a merge manifest
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/delta", h.DeltaExportHandler)
+			// FHIR resources (NDJSON) for form types mapped in the app bundle
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/fhir", h.FHIRExportHandler)
+			// Single DuckDB database file with one table per form type
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/duckdb", h.DuckDBExportHandler)
+			// Downstream consumers record the last version they loaded; exports with
+			// ?consumer= start after it
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/consumers", h.ListExportConsumers)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/consumers/{name}", h.GetExportConsumer)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Post("/consumers/{name}/ack", h.AckExportConsumer)
+			r.With(auth.RequireRole(models.RoleAdmin)).Delete("/consumers/{name}", h.DeleteExportConsumer)
+			// Named reports: admins define them; each report lists the roles that may run it
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/reports", h.ListExportReports)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/reports/{name}", h.GetExportReport)
+			r.With(auth.RequireRole(models.RoleAdmin)).Put("/reports/{name}", h.SaveExportReport)
+			r.With(auth.RequireRole(models.RoleAdmin)).Delete("/reports/{name}", h.DeleteExportReport)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/report/{name}", h.RunExportReport)
+			// Scheduled deliveries of reports - admin only
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/schedules", h.ListExportSchedules)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/schedules/{name}", h.GetExportSchedule)
+			r.With(auth.RequireRole(models.RoleAdmin)).Put("/schedules/{name}", h.SaveExportSchedule)
+			r.With(auth.RequireRole(models.RoleAdmin)).Delete("/schedules/{name}", h.DeleteExportSchedule)
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/schedules/{name}/run", h.RunExportSchedule)
 		}
 		r.Route("/dataexport", dataExportRoutes)
 		// Also register under /api for portal compatibility
 		r.Route("/api/dataexport", dataExportRoutes)
 
+		// Observation statistics routes - accessible to read-only users and above
+		statsRoutes := func(r chi.Router) {
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/observations", h.GetObservationStats)
+		}
+		r.Route("/stats", statsRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/stats", statsRoutes)
+
+		// Data quality report routes - admin only
+		reportRoutes := func(r chi.Router) {
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/duplicates", h.GetDuplicateReport)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/completeness", h.GetCompletenessReport)
+		}
+		r.Route("/reports", reportRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/reports", reportRoutes)
+
+		// Database and storage diagnostics routes - admin only
+		diagnosticsRoutes := func(r chi.Router) {
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/database", h.GetDatabaseDiagnostics)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/attachment-replication", h.GetAttachmentReplicationReport)
+		}
+		r.Route("/diagnostics", diagnosticsRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/diagnostics", diagnosticsRoutes)
+
+		// Calculated field routes - admin only
+		calculationRoutes := func(r chi.Router) {
+			r.With(auth.RequireRole(models.RoleAdmin)).Post("/backfill", h.BackfillCalculations)
+		}
+		r.Route("/calculations", calculationRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/calculations", calculationRoutes)
+
+		// Observation routes - own submissions for everyone, PDFs for read-only users and above, review locks and
+		// workflow transitions for read-write users and admins, data cleaning and reviewer assignment for admins
+		observationRoutes := func(r chi.Router) {
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/batch-update", h.BatchUpdateObservations)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Post("/merge", h.MergeObservations)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/batch-update", h.ListBatchUpdates)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/batch-update/{id}", h.GetBatchUpdate)
+			r.Get("/mine", h.GetMyObservations)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/core-id/{core_id}", h.GetObservationsByCoreID)
+			r.With(auth.RequireRole(models.RoleAdmin)).Get("/locks", h.ListObservationLocks)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/{id}/lock", h.GetObservationLock)
+			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin), h.RejectDuringMaintenance).Post("/{id}/lock", h.LockObservation)
+			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin)).Delete("/{id}/lock", h.UnlockObservation)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/{id}/pdf", h.GetObservationPDF)
+			r.With(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin)).Get("/{id}/workflow", h.GetObservationWorkflow)
+			r.With(auth.RequireRole(models.RoleReadWrite, models.RoleAdmin), h.RejectDuringMaintenance).Post("/{id}/workflow/transitions", h.TransitionObservationWorkflow)
+			r.With(auth.RequireRole(models.RoleAdmin), h.RejectDuringMaintenance).Put("/{id}/workflow/assignee", h.AssignObservationWorkflow)
+		}
+		r.Route("/observations", observationRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/observations", observationRoutes)
+
+		// Workflow routes - review queues and state changes for read-only users and above
+		workflowRoutes := func(r chi.Router) {
+			r.Use(auth.RequireRole(models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin))
+			r.Get("/observations", h.ListWorkflowObservations)
+			r.Get("/changes", h.GetWorkflowChanges)
+		}
+		r.Route("/workflow", workflowRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/workflow", workflowRoutes)
+
+		// Feature flag routes - admin only
+		featureFlagRoutes := func(r chi.Router) {
+			r.Use(auth.RequireRole(models.RoleAdmin))
+			r.Get("/", h.ListFeatureFlags)
+			r.Put("/{name}", h.SetFeatureFlag)
+			r.Delete("/{name}", h.ResetFeatureFlag)
+		}
+		r.Route("/feature-flags", featureFlagRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/feature-flags", featureFlagRoutes)
+
+		// Form permission routes - admin only
+		formPermissionRoutes := func(r chi.Router) {
+			r.Use(auth.RequireRole(models.RoleAdmin))
+			r.Get("/", h.ListFormPermissions)
+			r.Post("/", h.GrantFormPermission)
+			r.Delete("/{id}", h.RevokeFormPermission)
+		}
+		r.Route("/form-permissions", formPermissionRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/form-permissions", formPermissionRoutes)
+
+		// Maintenance mode routes - admin only
+		maintenanceRoutes := func(r chi.Router) {
+			r.Use(auth.RequireRole(models.RoleAdmin))
+			r.Get("/", h.GetMaintenance)
+			r.Put("/", h.SetMaintenance)
+		}
+		r.Route("/maintenance", maintenanceRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/maintenance", maintenanceRoutes)
+
+		// Observation change feed routes - admin only
+		changeFeedRoutes := func(r chi.Router) {
+			r.Use(auth.RequireRole(models.RoleAdmin))
+			r.Get("/", h.GetChangeFeedStatus)
+			r.Post("/replay", h.ReplayChangeFeed)
+		}
+		r.Route("/change-feed", changeFeedRoutes)
+		// Also register under /api for portal compatibility
+		r.Route("/api/change-feed", changeFeedRoutes)
+
 		// Version routes
 		r.Get("/version", h.GetVersion)
 		r.Get("/api/version", h.GetVersion)      // Also under /api for portal compatibility
 		r.Get("/api/versions", h.GetAPIVersions) // Not implemented yet
+
+		// Capability discovery: what this deployment supports, for clients to adapt to
+		r.Get("/capabilities", h.GetCapabilities)
+		r.Get("/api/capabilities", h.GetCapabilities)
 	})
 
 	return r
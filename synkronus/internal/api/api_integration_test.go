@@ -50,6 +50,26 @@ func TestProtectedEndpoints(t *testing.T) {
 		mockVersionService,
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	)
 
 	// Create a new router with the handler
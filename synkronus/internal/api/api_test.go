@@ -42,6 +42,26 @@ func TestNewRouter(t *testing.T) {
 		mockVersionService,
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	)
 
 	// Create a new router
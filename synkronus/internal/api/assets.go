@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// assetFS returns the directory dir when it is set, and the copy embedded in the binary
+// otherwise
+func assetFS(dir string, embedded fs.FS) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return embedded
+}
+
+// portalHandler serves the portal: files that exist as is, and index.html for other page
+// requests, so that reloading a client-side route works
+func portalHandler(portal fs.FS) http.HandlerFunc {
+	files := http.FileServerFS(portal)
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		if info, err := fs.Stat(portal, name); err == nil && !info.IsDir() {
+			files.ServeHTTP(w, r)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFileFS(w, r, portal, "index.html")
+	}
+}
+
+// notFoundHandler answers requests no route matched. The portal calls every endpoint
+// under /api, which a reverse proxy in front of the server would strip, so those are
+// routed again without the prefix. Other GET requests go to the portal when it is served.
+func notFoundHandler(router http.Handler, portal fs.FS) http.HandlerFunc {
+	var portalPages http.HandlerFunc
+	if portal != nil {
+		portalPages = portalHandler(portal)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/api/"); ok {
+			// Drop the routing state of this attempt, so the router starts over
+			stripped := r.Clone(context.WithValue(r.Context(), chi.RouteCtxKey, nil))
+			stripped.URL.Path = "/" + rest
+			stripped.URL.RawPath = ""
+			router.ServeHTTP(w, stripped)
+			return
+		}
+		if portalPages != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			portalPages(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
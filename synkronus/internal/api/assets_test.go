@@ -0,0 +1,83 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus"
+)
+
+func TestEmbeddedAssets(t *testing.T) {
+	for _, name := range []string{"favicon.ico"} {
+		if _, err := fs.Stat(synkronus.StaticFS(), name); err != nil {
+			t.Errorf("Expected %s to be embedded: %v", name, err)
+		}
+	}
+	for _, name := range []string{"swagger-ui.html", "synkronus.yaml"} {
+		if _, err := fs.Stat(synkronus.OpenAPIFS(), name); err != nil {
+			t.Errorf("Expected %s to be embedded: %v", name, err)
+		}
+	}
+
+	// A directory set in the configuration replaces the embedded copy
+	dir := t.TempDir()
+	if _, err := fs.Stat(assetFS(dir, synkronus.StaticFS()), "favicon.ico"); err == nil {
+		t.Error("Expected the configured directory to be served instead of the embedded files")
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	portal := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>portal</html>")},
+		"assets/index.js": {Data: []byte("console.log('portal')")},
+	}
+	r := chi.NewRouter()
+	r.Route("/users", func(r chi.Router) {
+		r.Get("/me", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("me")) })
+	})
+	r.NotFound(notFoundHandler(r, portal))
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for target, expected := range map[string]string{
+		"/users/me":        "me",
+		"/api/users/me":    "me",
+		"/assets/index.js": "console.log('portal')",
+	} {
+		if w := get(target, ""); w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Errorf("%s: expected 200 %q, got %d %q", target, expected, w.Code, w.Body.String())
+		}
+	}
+	if w := get("/", "text/html"); w.Code != http.StatusOK || w.Body.String() != "<html>portal</html>" {
+		t.Errorf("Expected the portal at /, got %d %q", w.Code, w.Body.String())
+	}
+	// Client-side routes of the portal get index.html, other missing files 404
+	if w := get("/settings/profile", "text/html,application/xhtml+xml"); w.Code != http.StatusOK || w.Body.String() != "<html>portal</html>" {
+		t.Errorf("Expected index.html for a page, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/assets/missing.js", "*/*"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing file, got %d", w.Code)
+	}
+	if w := get("/users/missing", "application/json"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown endpoint, got %d", w.Code)
+	}
+
+	// Without a portal, unmatched requests are not found
+	r = chi.NewRouter()
+	r.NotFound(notFoundHandler(r, nil))
+	if w := get("/", "text/html"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a portal, got %d", w.Code)
+	}
+}
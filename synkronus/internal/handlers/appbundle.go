@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -27,20 +28,50 @@ func (h *Handler) GetAppBundleManifest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if ETag matches
+	// Warnings depend on the declared host app version, so it is part of the ETag
 	etag := fmt.Sprintf("\"%s\"", manifest.Hash)
-	if r.Header.Get("If-None-Match") == etag {
-		w.WriteHeader(http.StatusNotModified)
+	hostVersion := r.Header.Get(appbundle.HostAppVersionHeader)
+	if hostVersion != "" {
+		if !appbundle.ValidHostVersion(hostVersion) {
+			SendErrorResponse(w, http.StatusBadRequest, nil, "Invalid "+appbundle.HostAppVersionHeader+" header: expected a semantic version such as 2.1.0")
+			return
+		}
+		etag = fmt.Sprintf("\"%s-%s\"", manifest.Hash, hostVersion)
+	}
+	w.Header().Set("Vary", appbundle.HostAppVersionHeader)
+
+	// The manifest changes with the active version, so clients revalidate it every time
+	if writeCacheHeaders(w, r, cacheValidators{ETag: etag, CacheControl: cacheRevalidate}) {
 		return
 	}
 
-	// Set ETag header
-	w.Header().Set("ETag", etag)
+	if hostVersion != "" {
+		if warnings := h.rendererWarnings(r, manifest.Version, hostVersion); len(warnings) > 0 {
+			withWarnings := *manifest
+			withWarnings.Warnings = warnings
+			manifest = &withWarnings
+		}
+	}
 
 	// Send the response
 	SendJSONResponse(w, http.StatusOK, manifest)
 }
 
+// rendererWarnings lists the renderers of a bundle version that need a newer host app.
+// Bundles pushed before renderers were versioned have none.
+func (h *Handler) rendererWarnings(r *http.Request, version, hostVersion string) []appbundle.RendererWarning {
+	appInfo, err := h.appBundleService.GetAppInfo(r.Context(), version)
+	if err != nil {
+		h.log.Warn("Failed to read app info for renderer compatibility", "version", version, "error", err)
+		return nil
+	}
+	warnings := appInfo.IncompatibleRenderers(hostVersion)
+	if len(warnings) > 0 {
+		h.log.Info("Client host app is too old for some renderers", "version", version, "hostVersion", hostVersion, "renderers", len(warnings))
+	}
+	return warnings
+}
+
 // GetAppBundleFile handles the /app-bundle/{path} endpoint
 func (h *Handler) GetAppBundleFile(w http.ResponseWriter, r *http.Request) {
 	// Get and decode the file path from the URL
@@ -72,15 +103,35 @@ func (h *Handler) GetAppBundleFile(w http.ResponseWriter, r *http.Request) {
 		err      error
 	)
 
-	// Get the file from either the preview version or the active version
-	if preview {
+	// Get the file from a requested version (e.g. the upcoming one), the preview version or the active version.
+	// Internal versions are only served to admins and testers; others preview the newest released version.
+	version := r.URL.Query().Get("version")
+	if version != "" || preview {
+		hidden, latest, hiddenErr := h.hiddenVersions(r.Context(), r)
+		if hiddenErr != nil {
+			h.log.Error("Failed to get app bundle versions", "error", hiddenErr)
+			SendErrorResponse(w, http.StatusInternalServerError, hiddenErr, "Failed to get file")
+			return
+		}
+		if hidden[version] {
+			SendErrorResponse(w, http.StatusNotFound, nil, "File not found")
+			return
+		}
+		if version == "" && len(hidden) > 0 {
+			version = latest
+		}
+	}
+	switch {
+	case version != "":
+		file, fileInfo, err = h.appBundleService.GetVersionFile(r.Context(), version, filePath)
+	case preview:
 		file, fileInfo, err = h.appBundleService.GetLatestVersionFile(r.Context(), filePath)
-	} else {
+	default:
 		file, fileInfo, err = h.appBundleService.GetFile(r.Context(), filePath)
 	}
 
 	if err != nil {
-		h.log.Error("Failed to get file from app bundle", "error", err, "path", filePath, "preview", preview)
+		h.log.Error("Failed to get file from app bundle", "error", err, "path", filePath, "preview", preview, "version", version)
 		if errors.Is(err, os.ErrNotExist) || errors.Is(err, appbundle.ErrFileNotFound) {
 			SendErrorResponse(w, http.StatusNotFound, err, "File not found")
 		} else {
@@ -90,34 +141,39 @@ func (h *Handler) GetAppBundleFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Set the appropriate headers
-	etag := fmt.Sprintf("\"%s\"", fileInfo.Hash)
-	w.Header().Set("Content-Type", fileInfo.MimeType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size))
-	w.Header().Set("ETag", etag)
 	if preview {
 		w.Header().Set("x-is-preview", "true")
 	}
 
-	// Check If-None-Match header for caching
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == etag || match == "*" {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	// Files of a requested version never change; those of the active or preview version
+	// change with it and are revalidated
+	pinned := r.URL.Query().Get("version") != ""
+	cacheControl := bundleCacheControl(pinned, (pinned || preview) && h.canSeeInternalVersions(r))
+	if writeCacheHeaders(w, r, cacheValidators{ETag: fmt.Sprintf("\"%s\"", fileInfo.Hash), LastModified: fileInfo.ModTime, CacheControl: cacheControl}) {
+		return
 	}
 
 	// Stream the file to the response
-	h.streamFile(w, file, fileInfo)
+	h.streamFile(w, r, file, fileInfo)
 }
 
-func (h *Handler) streamFile(w http.ResponseWriter, file io.ReadCloser, fileInfo *appbundle.File) {
+// streamFile writes an app bundle file. Seekable files (the filesystem store) are served
+// with http.ServeContent so Range and If-Range requests can resume interrupted downloads;
+// other readers are streamed whole and advertise that ranges are not supported.
+func (h *Handler) streamFile(w http.ResponseWriter, r *http.Request, file io.ReadCloser, fileInfo *appbundle.File) {
 	defer file.Close()
 
-	// Set content type and headers
+	// Set content type and headers; callers set the caching headers
 	w.Header().Set("Content-Type", fileInfo.MimeType)
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		// ServeContent sets Content-Length and Accept-Ranges and answers 206/416 as needed
+		http.ServeContent(w, r, path.Base(fileInfo.Path), fileInfo.ModTime, seeker)
+		return
+	}
+
 	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
-	w.Header().Set("ETag", "\""+fileInfo.Hash+"\"")
+	w.Header().Set("Accept-Ranges", "none")
 
 	// Stream the file
 	if _, err := io.Copy(w, file); err != nil {
@@ -134,8 +190,21 @@ func (h *Handler) DownloadBundleZip(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	info, err := os.Stat(zipPath)
+	if err != nil {
+		h.log.Error("Failed to stat bundle zip", "error", err)
+		SendErrorResponse(w, http.StatusNotFound, err, "Bundle zip not available")
+		return
+	}
+
+	// The zip is replaced when the active version changes, so clients revalidate it
+	if writeCacheHeaders(w, r, fileValidators(info, bundleCacheControl(false, false))) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", `attachment; filename="bundle.zip"`)
+	// ServeFile answers Range and If-Range (ETag or Last-Modified) requests, so clients can resume
 	http.ServeFile(w, r, zipPath)
 }
 
@@ -146,12 +215,26 @@ func (h *Handler) CompareAppBundleVersions(w http.ResponseWriter, r *http.Reques
 
 	// Get query parameters
 	preview := r.URL.Query().Get("preview") == "true"
+	detail := r.URL.Query().Get("detail")
+	if detail != "" && detail != "files" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "detail must be files")
+		return
+	}
+
+	// Internal versions can only be compared by admins and testers; others compare with
+	// the newest version they can see instead of the latest one
+	hidden, latest, err := h.hiddenVersions(ctx, r)
+	if err != nil {
+		h.log.Error("Failed to get app bundle versions", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get versions")
+		return
+	}
 
 	// Get the current version
 	currentVersion := r.URL.Query().Get("current")
 	if currentVersion == "" {
 		// If no current version is specified, use the latest released version
-		versions, err := h.appBundleService.GetVersions(ctx)
+		versions, err := h.visibleVersions(ctx, hidden)
 		if err != nil || len(versions) == 0 {
 			h.log.Error("Failed to get current version", "error", err)
 			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get current version")
@@ -161,11 +244,13 @@ func (h *Handler) CompareAppBundleVersions(w http.ResponseWriter, r *http.Reques
 		currentVersion = strings.TrimSuffix(versions[len(versions)-1], " *")
 	}
 
-	// Determine the target version (preview or previous)
+	// Determine the target version (explicit, preview or previous)
 	targetVersion := "latest"
-	if !preview {
+	if target := r.URL.Query().Get("target"); target != "" {
+		targetVersion = target
+	} else if !preview {
 		// If not preview, compare with the previous version
-		versions, err := h.appBundleService.GetVersions(ctx)
+		versions, err := h.visibleVersions(ctx, hidden)
 		if err != nil {
 			h.log.Error("Failed to get versions", "error", err)
 			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get versions")
@@ -185,10 +270,14 @@ func (h *Handler) CompareAppBundleVersions(w http.ResponseWriter, r *http.Reques
 
 		if currentIdx <= 0 {
 			// If no previous version exists, return an empty change log
-			SendJSONResponse(w, http.StatusOK, &appbundle.ChangeLog{
+			changeLog := &appbundle.ChangeLog{
 				CompareVersionA: currentVersion,
 				CompareVersionB: currentVersion,
-			})
+			}
+			if detail == "files" {
+				changeLog.Files = appbundle.CompareFiles(nil, nil)
+			}
+			SendJSONResponse(w, http.StatusOK, changeLog)
 			return
 		}
 
@@ -196,6 +285,14 @@ func (h *Handler) CompareAppBundleVersions(w http.ResponseWriter, r *http.Reques
 		targetVersion = strings.TrimSuffix(versions[currentIdx-1], " *")
 	}
 
+	if hidden[currentVersion] || hidden[targetVersion] {
+		SendErrorResponse(w, http.StatusNotFound, nil, "Version not found")
+		return
+	}
+	if targetVersion == "latest" && len(hidden) > 0 {
+		targetVersion = latest
+	}
+
 	// Compare the versions
 	changeLog, err := h.appBundleService.CompareAppInfos(ctx, currentVersion, targetVersion)
 	if err != nil {
@@ -207,6 +304,71 @@ func (h *Handler) CompareAppBundleVersions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// List the changed files so clients can download only those
+	if detail == "files" {
+		changeLog.Files, err = h.appBundleService.CompareBundleFiles(ctx, currentVersion, targetVersion)
+		if err != nil {
+			h.log.Error("Failed to compare app bundle files",
+				"versionA", currentVersion,
+				"versionB", targetVersion,
+				"error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to compare version files")
+			return
+		}
+	}
+
 	// Send the response
 	SendJSONResponse(w, http.StatusOK, changeLog)
 }
+
+// GetAppBundleChangeHistory handles the /app-bundle/changes/history endpoint
+func (h *Handler) GetAppBundleChangeHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := appbundle.ChangeHistoryFilter{
+		Form:  query.Get("form"),
+		Field: query.Get("field"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be a non-negative number")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	hidden, _, err := h.hiddenVersions(ctx, r)
+	if err != nil {
+		h.log.Error("Failed to get app bundle versions", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle change history")
+		return
+	}
+	// Transitions involving internal versions are dropped before the limit is applied
+	limit := filter.Limit
+	if len(hidden) > 0 {
+		filter.Limit = 0
+	}
+
+	entries, err := h.appBundleService.GetChangeHistory(ctx, filter)
+	if err != nil {
+		h.log.Error("Failed to get app bundle change history", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle change history")
+		return
+	}
+	if len(hidden) > 0 {
+		visible := make([]appbundle.ChangeHistoryEntry, 0, len(entries))
+		for _, entry := range entries {
+			if limit > 0 && len(visible) == limit {
+				break
+			}
+			if !hidden[entry.FromVersion] && !hidden[entry.ToVersion] {
+				visible = append(visible, entry)
+			}
+		}
+		entries = visible
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]any{"changes": entries})
+}
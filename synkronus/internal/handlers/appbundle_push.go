@@ -1,17 +1,75 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
 	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
 )
 
 // PushAppBundle handles the /app-bundle/push endpoint
 func (h *Handler) PushAppBundle(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("App bundle push requested")
+	h.receiveAppBundle(w, r, h.appBundleService.PushBundle, "App bundle successfully pushed")
+}
+
+// PushAppBundleDraft handles the /app-bundle/draft endpoint
+func (h *Handler) PushAppBundleDraft(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("App bundle draft push requested")
+	h.receiveAppBundle(w, r, h.appBundleService.PushDraft, "App bundle draft successfully staged")
+}
+
+// PromoteAppBundleDraft handles the /app-bundle/draft/promote endpoint
+func (h *Handler) PromoteAppBundleDraft(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(authmw.UserKey).(*models.User)
+	if !ok || user == nil {
+		h.log.Warn("Unauthorized app bundle draft promotion attempt")
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	h.log.Info("App bundle draft promotion requested", "user", user.Username)
+
+	ctx, ok := h.pushWaitContext(w, r)
+	if !ok {
+		return
+	}
+	if ctx, ok = h.internalVersionContext(ctx, w, r); !ok {
+		return
+	}
+
+	manifest, err := h.appBundleService.PromoteDraft(ctx)
+	if err != nil {
+		if errors.Is(err, appbundle.ErrNoDraft) {
+			SendErrorResponse(w, http.StatusNotFound, err, "No app bundle draft to promote")
+			return
+		}
+		if h.sendPushInProgress(w, err) {
+			return
+		}
+		h.log.Error("Failed to promote app bundle draft", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to promote app bundle draft")
+		return
+	}
+
+	h.log.Info("App bundle draft promoted", "version", manifest.Version, "user", user.Username)
+	SendJSONResponse(w, http.StatusOK, map[string]any{
+		"message":  fmt.Sprintf("App bundle draft promoted to version %s", manifest.Version),
+		"manifest": manifest,
+	})
+}
+
+// receiveAppBundle reads the multipart 'bundle' file and hands it to push
+func (h *Handler) receiveAppBundle(w http.ResponseWriter, r *http.Request, push func(context.Context, io.Reader) (*appbundle.Manifest, error), message string) {
 	ctx := r.Context()
 
 	// Get user from context (this should be set by the auth middleware)
@@ -22,15 +80,35 @@ func (h *Handler) PushAppBundle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the request is a multipart form
-	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB max
-		h.log.Error("Failed to parse multipart form", "error", err)
-		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format. Expected multipart form with a 'bundle' file")
+	ctx, ok = h.pushWaitContext(w, r)
+	if !ok {
+		return
+	}
+	if ctx, ok = h.internalVersionContext(ctx, w, r); !ok {
+		return
+	}
+	if ctx, ok = limitOverrideContext(ctx, w, r); !ok {
+		return
+	}
+	if ctx, ok = bootCheckOverrideContext(ctx, w, r); !ok {
 		return
 	}
 
-	// Get the file from the form
-	file, header, err := r.FormFile("bundle")
+	// Stream the 'bundle' part to the service instead of parsing the whole form, which
+	// would spool a large bundle to a temporary file before the service stages it again
+	reader, err := r.MultipartReader()
+	if err != nil {
+		h.log.Error("Failed to read multipart form", "error", err)
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format. Expected multipart form with a 'bundle' file")
+		return
+	}
+	var file *multipart.Part
+	for {
+		if file, err = reader.NextPart(); err != nil || file.FormName() == "bundle" {
+			break
+		}
+		file.Close()
+	}
 	if err != nil {
 		h.log.Error("Failed to get bundle file from form", "error", err)
 		SendErrorResponse(w, http.StatusBadRequest, err, "Failed to get bundle file from form")
@@ -39,24 +117,160 @@ func (h *Handler) PushAppBundle(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Log the upload
-	h.log.Info("Processing app bundle upload", "filename", header.Filename, "size", header.Size, "user", user.Username)
+	h.log.Info("Processing app bundle upload", "filename", file.FileName(), "user", user.Username)
 
 	// Push the bundle
-	manifest, err := h.appBundleService.PushBundle(ctx, file)
+	manifest, err := push(ctx, file)
 	if err != nil {
+		if h.sendPushInProgress(w, err) || h.sendBundleLimitExceeded(w, err) || h.sendBootCheckFailed(w, err) {
+			return
+		}
+		if errors.Is(err, appbundle.ErrUploadTooLarge) {
+			h.log.Warn("App bundle upload rejected as too large", "error", err)
+			SendErrorResponse(w, http.StatusRequestEntityTooLarge, err, "The app bundle zip is larger than the server accepts")
+			return
+		}
 		h.log.Error("Failed to push app bundle", "error", err)
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to process app bundle")
 		return
 	}
 
 	// Return the new manifest
-	h.log.Info("App bundle successfully pushed", "user", user.Username)
+	h.log.Info(message, "user", user.Username)
 	SendJSONResponse(w, http.StatusOK, map[string]any{
-		"message":  "App bundle successfully pushed",
+		"message":  message,
 		"manifest": manifest,
 	})
 }
 
+// GetAppBundlePushStatus handles the /app-bundle/push/status endpoint
+func (h *Handler) GetAppBundlePushStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.appBundleService.GetPushStatus(r.Context())
+	if err != nil {
+		h.log.Error("Failed to get app bundle push status", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle push status")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, status)
+}
+
+// pushWaitContext applies the optional 'wait' query parameter, the number of seconds a
+// push may queue behind a running push, capped by the server configuration
+func (h *Handler) pushWaitContext(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	raw := r.URL.Query().Get("wait")
+	if raw == "" {
+		return r.Context(), true
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		SendErrorResponse(w, http.StatusBadRequest, err, "wait must be a non-negative number of seconds")
+		return nil, false
+	}
+	if h.config != nil && seconds > h.config.AppBundlePushMaxWaitSeconds {
+		seconds = h.config.AppBundlePushMaxWaitSeconds
+	}
+	return appbundle.WithPushWait(r.Context(), time.Duration(seconds)*time.Second), true
+}
+
+// BundleLimitErrorResponse is the 413 response when a pushed bundle exceeds the push limits
+type BundleLimitErrorResponse struct {
+	Error      string                     `json:"error"`
+	Message    string                     `json:"message"`
+	Violations []appbundle.LimitViolation `json:"violations"`
+}
+
+// limitOverrideContext applies the optional override header with which an admin pushes
+// a bundle beyond the push limits
+func limitOverrideContext(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	raw := r.Header.Get(appbundle.LimitOverrideHeader)
+	if raw == "" {
+		return ctx, true
+	}
+	override, err := strconv.ParseBool(raw)
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, appbundle.LimitOverrideHeader+" must be true or false")
+		return nil, false
+	}
+	if override {
+		ctx = appbundle.WithLimitOverride(ctx)
+	}
+	return ctx, true
+}
+
+// sendBundleLimitExceeded answers 413 with the exceeded limits when err reports that the
+// bundle is beyond the push limits
+func (h *Handler) sendBundleLimitExceeded(w http.ResponseWriter, err error) bool {
+	var limitErr *appbundle.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	h.log.Warn("App bundle push rejected by push limits", "error", err)
+	SendJSONResponse(w, http.StatusRequestEntityTooLarge, BundleLimitErrorResponse{
+		Error:      err.Error(),
+		Message:    "The app bundle exceeds the push limits; remove the large files or push again with " + appbundle.LimitOverrideHeader + ": true",
+		Violations: limitErr.Violations,
+	})
+	return true
+}
+
+// BootCheckErrorResponse is the 422 response when a pushed bundle's app logs errors while
+// it boots
+type BootCheckErrorResponse struct {
+	Error         string   `json:"error"`
+	Message       string   `json:"message"`
+	ConsoleErrors []string `json:"console_errors"`
+}
+
+// bootCheckOverrideContext applies the optional override header with which an admin
+// pushes a bundle that fails the boot check
+func bootCheckOverrideContext(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	raw := r.Header.Get(appbundle.BootCheckOverrideHeader)
+	if raw == "" {
+		return ctx, true
+	}
+	override, err := strconv.ParseBool(raw)
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, appbundle.BootCheckOverrideHeader+" must be true or false")
+		return nil, false
+	}
+	if override {
+		ctx = appbundle.WithBootCheckOverride(ctx)
+	}
+	return ctx, true
+}
+
+// sendBootCheckFailed answers 422 with the console errors when err reports that the
+// bundle's app fails the boot check
+func (h *Handler) sendBootCheckFailed(w http.ResponseWriter, err error) bool {
+	var bootErr *appbundle.BootCheckError
+	if !errors.As(err, &bootErr) {
+		return false
+	}
+	h.log.Warn("App bundle push rejected by boot check", "error", err)
+	SendJSONResponse(w, http.StatusUnprocessableEntity, BootCheckErrorResponse{
+		Error:         err.Error(),
+		Message:       "The app logs errors while it boots; fix them or push again with " + appbundle.BootCheckOverrideHeader + ": true",
+		ConsoleErrors: bootErr.ConsoleErrors,
+	})
+	return true
+}
+
+// sendPushInProgress answers 409 with a Retry-After hint when err reports that another
+// push holds the push lock
+func (h *Handler) sendPushInProgress(w http.ResponseWriter, err error) bool {
+	var inProgress *appbundle.PushInProgressError
+	if !errors.As(err, &inProgress) {
+		return false
+	}
+	h.log.Warn("App bundle push rejected while another push is running",
+		"operation", inProgress.Status.Operation, "holder", inProgress.Status.User)
+	if seconds := int(inProgress.RetryAfter / time.Second); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	SendErrorResponse(w, http.StatusConflict, err, "Another app bundle push is in progress, retry later")
+	return true
+}
+
 // GetAppBundleVersions handles the /app-bundle/versions endpoint
 func (h *Handler) GetAppBundleVersions(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("App bundle versions requested")
@@ -70,10 +284,50 @@ func (h *Handler) GetAppBundleVersions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return the versions
-	SendJSONResponse(w, http.StatusOK, map[string]any{
+	details, err := h.appBundleService.GetVersionDetails(ctx)
+	if err != nil {
+		h.log.Error("Failed to get app bundle version details", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle versions")
+		return
+	}
+
+	// Only admins and testers learn about internal versions
+	if !h.canSeeInternalVersions(r) {
+		hidden := make(map[string]bool)
+		released := make([]appbundle.VersionInfo, 0, len(details))
+		for _, detail := range details {
+			if detail.Internal {
+				hidden[detail.Version] = true
+			} else {
+				released = append(released, detail)
+			}
+		}
+		if versions, err = h.visibleVersions(ctx, hidden); err != nil {
+			h.log.Error("Failed to get app bundle versions", "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle versions")
+			return
+		}
+		details = released
+	}
+
+	response := map[string]any{
 		"versions": versions,
-	})
+		"details":  details,
+	}
+
+	// Include a pending switch so admins can see the upcoming cutover
+	scheduled, err := h.appBundleService.GetScheduledSwitch(ctx)
+	if err != nil {
+		h.log.Error("Failed to get scheduled app bundle switch", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle versions")
+		return
+	}
+	if scheduled != nil {
+		response["scheduled"] = scheduled
+	}
+
+	// Return the versions
+	SendJSONResponse(w, http.StatusOK, response)
 }
 
 // SwitchAppBundleVersion handles the /app-bundle/switch/{version} endpoint
@@ -93,11 +347,36 @@ func (h *Handler) SwitchAppBundleVersion(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// An optional effective_at schedules the switch for a maintenance window
+	var effectiveAt time.Time
+	if raw := r.URL.Query().Get("effective_at"); raw != "" {
+		var err error
+		if effectiveAt, err = time.Parse(time.RFC3339, raw); err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "effective_at must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	if r.URL.Query().Get("reject_breaking") == "true" && !h.checkNonBreakingSwitch(w, r, version) {
+		return
+	}
+
+	if !effectiveAt.IsZero() {
+		if effectiveAt.After(time.Now()) {
+			h.scheduleAppBundleSwitch(w, r, version, effectiveAt, user.Username)
+			return
+		}
+	}
+
 	h.log.Info("App bundle version switch requested", "version", version, "user", user.Username)
 	ctx := r.Context()
 
 	// Switch to the version
 	err := h.appBundleService.SwitchVersion(ctx, version)
+	if errors.Is(err, appbundle.ErrVersionInternal) {
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to switch app bundle version", "error", err, "version", version)
 		SendErrorResponse(w, http.StatusInternalServerError, err, fmt.Sprintf("Failed to switch to version %s", version))
@@ -110,3 +389,71 @@ func (h *Handler) SwitchAppBundleVersion(w http.ResponseWriter, r *http.Request)
 		"message": fmt.Sprintf("Switched to app bundle version %s", version),
 	})
 }
+
+// BreakingSwitchResponse is returned when a switch with reject_breaking=true is breaking
+type BreakingSwitchResponse struct {
+	Error   string               `json:"error"`
+	Message string               `json:"message"`
+	Changes *appbundle.ChangeLog `json:"changes"`
+}
+
+// checkNonBreakingSwitch compares the active version with version and sends 409 with the
+// change log when switching is breaking. It returns false after sending a response.
+func (h *Handler) checkNonBreakingSwitch(w http.ResponseWriter, r *http.Request, version string) bool {
+	ctx := r.Context()
+	details, err := h.appBundleService.GetVersionDetails(ctx)
+	if err != nil {
+		h.log.Error("Failed to get app bundle versions", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle versions")
+		return false
+	}
+	active := ""
+	for _, detail := range details {
+		if detail.Active {
+			active = detail.Version
+		}
+	}
+	if active == "" || active == version {
+		return true
+	}
+
+	changeLog, err := h.appBundleService.CompareAppInfos(ctx, active, version)
+	if err != nil {
+		h.log.Error("Failed to compare app bundle versions", "versionA", active, "versionB", version, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to compare versions")
+		return false
+	}
+	if changeLog.Breaking {
+		h.log.Info("Breaking app bundle version switch rejected", "from", active, "to", version)
+		SendJSONResponse(w, http.StatusConflict, BreakingSwitchResponse{
+			Error:   "breaking_change",
+			Message: fmt.Sprintf("Switching from %s to %s is breaking", active, version),
+			Changes: changeLog,
+		})
+		return false
+	}
+	return true
+}
+
+// scheduleAppBundleSwitch schedules a version switch for effectiveAt; until then the
+// manifest advertises the version as upcoming
+func (h *Handler) scheduleAppBundleSwitch(w http.ResponseWriter, r *http.Request, version string, effectiveAt time.Time, username string) {
+	h.log.Info("App bundle version switch scheduled", "version", version, "effectiveAt", effectiveAt, "user", username)
+
+	err := h.appBundleService.ScheduleSwitch(r.Context(), version, effectiveAt)
+	if errors.Is(err, appbundle.ErrVersionInternal) {
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to schedule app bundle version switch", "error", err, "version", version)
+		SendErrorResponse(w, http.StatusInternalServerError, err, fmt.Sprintf("Failed to schedule switch to version %s", version))
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]any{
+		"message":      fmt.Sprintf("Scheduled switch to app bundle version %s at %s", version, effectiveAt.UTC().Format(time.RFC3339)),
+		"version":      version,
+		"effective_at": effectiveAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -10,12 +12,14 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
 	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
 	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
 	"github.com/opendataensemble/synkronus/pkg/logger"
 	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
 	"github.com/stretchr/testify/assert"
@@ -37,7 +41,7 @@ func TestPushAppBundle(t *testing.T) {
 	mockDataExportService := mocks.NewMockDataExportService()
 
 	// Create a handler for testing
-	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService)
+	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService, mocks.NewMockStatsService(), mocks.NewMockDiagnosticsService(), mocks.NewMockDedupService(), mocks.NewMockFeatureFlagService(), mocks.NewMockCalculationService(), mocks.NewMockBatchUpdateService(), mocks.NewMockRenderService(), mocks.NewMockMaintenanceService(), mocks.NewMockChangeFeedService(), mocks.NewMockFormMigrationService(), mocks.NewMockCompletenessService(), mocks.NewMockReplicationService(), mocks.NewMockExportConsumerService(), mocks.NewMockCheckpointService(), mocks.NewMockObservationLockService(), mocks.NewMockExportReportService(), mocks.NewMockExportScheduleService(), mocks.NewMockWorkflowService(), mocks.NewMockPayloadCryptoService(), mocks.NewMockFormPermissionService())
 
 	// Create a temporary test file
 	tempDir := t.TempDir()
@@ -175,7 +179,7 @@ func TestGetAppBundleVersions(t *testing.T) {
 	mockDataExportService := mocks.NewMockDataExportService()
 
 	// Create a handler for testing
-	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService)
+	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService, mocks.NewMockStatsService(), mocks.NewMockDiagnosticsService(), mocks.NewMockDedupService(), mocks.NewMockFeatureFlagService(), mocks.NewMockCalculationService(), mocks.NewMockBatchUpdateService(), mocks.NewMockRenderService(), mocks.NewMockMaintenanceService(), mocks.NewMockChangeFeedService(), mocks.NewMockFormMigrationService(), mocks.NewMockCompletenessService(), mocks.NewMockReplicationService(), mocks.NewMockExportConsumerService(), mocks.NewMockCheckpointService(), mocks.NewMockObservationLockService(), mocks.NewMockExportReportService(), mocks.NewMockExportScheduleService(), mocks.NewMockWorkflowService(), mocks.NewMockPayloadCryptoService(), mocks.NewMockFormPermissionService())
 
 	// Test cases
 	tests := []struct {
@@ -192,6 +196,14 @@ func TestGetAppBundleVersions(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   `"versions":["20250101-000000","20250102-000000"]`,
 		},
+		{
+			name: "Includes version details",
+			setupRequest: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/app-bundle/versions", nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"details":[{"version":"20250102-000000"`,
+		},
 	}
 
 	for _, tc := range tests {
@@ -231,12 +243,13 @@ func TestSwitchAppBundleVersion(t *testing.T) {
 	mockDataExportService := mocks.NewMockDataExportService()
 
 	// Create a handler for testing
-	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService)
+	h := NewHandler(log, mockConfig, mockAuthService, mockAppBundleService, mockSyncService, mockUserService, mockVersionService, mockAttachmentManifestService, mockDataExportService, mocks.NewMockStatsService(), mocks.NewMockDiagnosticsService(), mocks.NewMockDedupService(), mocks.NewMockFeatureFlagService(), mocks.NewMockCalculationService(), mocks.NewMockBatchUpdateService(), mocks.NewMockRenderService(), mocks.NewMockMaintenanceService(), mocks.NewMockChangeFeedService(), mocks.NewMockFormMigrationService(), mocks.NewMockCompletenessService(), mocks.NewMockReplicationService(), mocks.NewMockExportConsumerService(), mocks.NewMockCheckpointService(), mocks.NewMockObservationLockService(), mocks.NewMockExportReportService(), mocks.NewMockExportScheduleService(), mocks.NewMockWorkflowService(), mocks.NewMockPayloadCryptoService(), mocks.NewMockFormPermissionService())
 
 	// Test cases
 	tests := []struct {
 		name           string
 		version        string
+		query          string
 		setupContext   func(r *http.Request)
 		expectedStatus int
 		expectedBody   string
@@ -257,6 +270,39 @@ func TestSwitchAppBundleVersion(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   `"message":"Switched to app bundle version`,
 		},
+		{
+			name:    "Past effective_at switches immediately",
+			version: "1.0.0-alpha009",
+			query:   "?effective_at=2020-01-01T00:00:00Z",
+			setupContext: func(r *http.Request) {
+				adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+				*r = *r.WithContext(context.WithValue(r.Context(), authmw.UserKey, &adminUser))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"message":"Switched to app bundle version`,
+		},
+		{
+			name:    "Scheduled Switch - Future effective_at",
+			version: "1.0.0-alpha008",
+			query:   "?effective_at=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			setupContext: func(r *http.Request) {
+				adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+				*r = *r.WithContext(context.WithValue(r.Context(), authmw.UserKey, &adminUser))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"message":"Scheduled switch to app bundle version 1.0.0-alpha008`,
+		},
+		{
+			name:    "Bad Request - Invalid effective_at",
+			version: "1.0.0-alpha008",
+			query:   "?effective_at=tomorrow",
+			setupContext: func(r *http.Request) {
+				adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+				*r = *r.WithContext(context.WithValue(r.Context(), authmw.UserKey, &adminUser))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "effective_at must be an RFC 3339 timestamp",
+		},
 		{
 			name:    "Unauthorized - No User in Context",
 			version: "1.0.0-alpha007",
@@ -287,7 +333,7 @@ func TestSwitchAppBundleVersion(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create a test request with the version as a URL parameter
-			url := "/app-bundle/switch/" + tc.version
+			url := "/app-bundle/switch/" + tc.version + tc.query
 			req := httptest.NewRequest(http.MethodPost, url, nil)
 
 			// Setup the chi router context with URL params
@@ -315,4 +361,296 @@ func TestSwitchAppBundleVersion(t *testing.T) {
 			}
 		})
 	}
+
+	// The scheduled switch is reported alongside the versions
+	scheduled, err := mockAppBundleService.GetScheduledSwitch(context.Background())
+	assert.NoError(t, err)
+	if assert.NotNil(t, scheduled) {
+		assert.Equal(t, "1.0.0-alpha008", scheduled.Version)
+	}
+	rr := httptest.NewRecorder()
+	h.GetAppBundleVersions(rr, httptest.NewRequest(http.MethodGet, "/app-bundle/versions", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"scheduled":{"version":"1.0.0-alpha008"`)
+}
+
+func TestSwitchAppBundleVersion_RejectBreaking(t *testing.T) {
+	h, bundles := createTestHandler()
+	require.NoError(t, bundles.SwitchVersion(context.Background(), "20250101-000000"))
+	bundles.SetChangeLog("20250101-000000", "20250102-000000", &appbundle.ChangeLog{
+		CompareVersionA: "20250101-000000",
+		CompareVersionB: "20250102-000000",
+		FormChanges:     true,
+		Breaking:        true,
+		ModifiedForms: []appbundle.FormModification{{
+			FormName: "household", SchemaChange: true, Breaking: true,
+			Changes: []appbundle.ClassifiedChange{{Kind: appbundle.ChangeTypeChanged, Field: "size", OldType: "string", NewType: "integer", Breaking: true}},
+		}},
+	})
+
+	switchTo := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/switch/20250102-000000"+query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("version", "20250102-000000")
+		req = withTestUser(req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)), "admin", models.RoleAdmin)
+		rr := httptest.NewRecorder()
+		h.SwitchAppBundleVersion(rr, req)
+		return rr
+	}
+
+	// Breaking switches are refused, also when scheduled, with the change log
+	for _, query := range []string{"?reject_breaking=true", "?reject_breaking=true&effective_at=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)} {
+		rr := switchTo(query)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"error":"breaking_change"`)
+		assert.Contains(t, rr.Body.String(), `"kind":"type_changed"`)
+	}
+	scheduled, err := bundles.GetScheduledSwitch(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, scheduled)
+
+	// Without reject_breaking the switch goes ahead
+	assert.Equal(t, http.StatusOK, switchTo("").Code)
+}
+
+func TestPromoteAppBundleDraft(t *testing.T) {
+	h, _ := createTestHandler()
+
+	tests := []struct {
+		name           string
+		withUser       bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Promotion - Admin User",
+			withUser:       true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"message":"App bundle draft promoted to version 0003"`,
+		},
+		{
+			name:           "Unauthorized - No User in Context",
+			withUser:       false,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/app-bundle/draft/promote", nil)
+			if tc.withUser {
+				adminUser := models.User{
+					ID:       uuid.New(),
+					Username: "admin",
+					Role:     models.RoleAdmin,
+				}
+				req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+			}
+
+			rr := httptest.NewRecorder()
+			h.PromoteAppBundleDraft(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestPromoteAppBundleDraftPushInProgress(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	startedAt := time.Now().UTC()
+	mockAppBundleService.SetPushError(&appbundle.PushInProgressError{
+		Status: appbundle.PushStatus{
+			Locked:    true,
+			Operation: appbundle.PushOperationPush,
+			User:      "alice",
+			StartedAt: &startedAt,
+		},
+		RetryAfter: 12 * time.Second,
+	})
+
+	adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+
+	t.Run("Rejected With Retry-After", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/draft/promote?wait=5", nil)
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+		rr := httptest.NewRecorder()
+		h.PromoteAppBundleDraft(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "12", rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), "push by alice")
+	})
+
+	t.Run("Invalid Wait", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/draft/promote?wait=soon", nil)
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+		rr := httptest.NewRecorder()
+		h.PromoteAppBundleDraft(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestPushAppBundleLimitExceeded(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	mockAppBundleService.SetPushError(&appbundle.LimitError{Violations: []appbundle.LimitViolation{{
+		Limit:   appbundle.LimitMaxBytes,
+		Max:     100 << 20,
+		Actual:  500 << 20,
+		Largest: []appbundle.BundleFileSize{{Path: "app/media/intro.mp4", Size: 500 << 20}},
+	}}})
+
+	adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+	push := func(override string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("bundle", "bundle.zip")
+		require.NoError(t, err)
+		_, err = part.Write([]byte("zip"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/push", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if override != "" {
+			req.Header.Set(appbundle.LimitOverrideHeader, override)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+		rr := httptest.NewRecorder()
+		h.PushAppBundle(rr, req)
+		return rr
+	}
+
+	t.Run("Rejected With Violations", func(t *testing.T) {
+		rr := push("")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+		var response BundleLimitErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Contains(t, response.Error, "files total 500.0 MB, the limit is 100.0 MB (largest: app/media/intro.mp4 500.0 MB)")
+		assert.Contains(t, response.Message, appbundle.LimitOverrideHeader)
+		require.Len(t, response.Violations, 1)
+		assert.Equal(t, "app/media/intro.mp4", response.Violations[0].Largest[0].Path)
+	})
+
+	t.Run("Invalid Override", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, push("please").Code)
+	})
+}
+
+func TestPushAppBundleStreaming(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+
+	push := func(fields ...string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, field := range fields {
+			part, err := writer.CreateFormFile(field, field+".zip")
+			require.NoError(t, err)
+			_, err = part.Write([]byte("zip"))
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/push", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+		rr := httptest.NewRecorder()
+		h.PushAppBundle(rr, req)
+		return rr
+	}
+
+	// Parts before the bundle are skipped
+	assert.Equal(t, http.StatusOK, push("notes", "bundle").Code)
+	assert.Equal(t, http.StatusBadRequest, push("notes").Code)
+
+	mockAppBundleService.SetPushError(fmt.Errorf("%w of 256.0 MB", appbundle.ErrUploadTooLarge))
+	rr := push("bundle")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "larger than the server accepts")
+}
+
+func TestGetAppBundlePushStatus(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	startedAt := time.Date(2025, 9, 8, 10, 0, 0, 0, time.UTC)
+	mockAppBundleService.SetPushStatus(&appbundle.PushStatus{
+		Locked:            true,
+		Operation:         appbundle.PushOperationDraft,
+		User:              "alice",
+		StartedAt:         &startedAt,
+		Waiting:           1,
+		RetryAfterSeconds: 30,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/app-bundle/push/status", nil)
+	rr := httptest.NewRecorder()
+	h.GetAppBundlePushStatus(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"locked":true,"operation":"draft","user":"alice","started_at":"2025-09-08T10:00:00Z","waiting":1,"retry_after_seconds":30}`, rr.Body.String())
+}
+
+func TestPushAppBundleBootCheckFailed(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	mockAppBundleService.SetPushError(&appbundle.BootCheckError{ConsoleErrors: []string{"Uncaught TypeError: x is undefined (main.js:3)"}})
+
+	adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+	push := func(override string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("bundle", "bundle.zip")
+		require.NoError(t, err)
+		_, err = part.Write([]byte("zip"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/push", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if override != "" {
+			req.Header.Set(appbundle.BootCheckOverrideHeader, override)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &adminUser))
+		rr := httptest.NewRecorder()
+		h.PushAppBundle(rr, req)
+		return rr
+	}
+
+	t.Run("Rejected With Console Errors", func(t *testing.T) {
+		rr := push("")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		var response BootCheckErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Contains(t, response.Message, appbundle.BootCheckOverrideHeader)
+		assert.Equal(t, []string{"Uncaught TypeError: x is undefined (main.js:3)"}, response.ConsoleErrors)
+	})
+
+	t.Run("Invalid Override", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, push("sure").Code)
+	})
+}
+
+func TestGetAppBundleBootScreenshot(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	mockAppBundleService.SetBootScreenshot("0002", []byte("\x89PNG"))
+
+	get := func(version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app-bundle/versions/"+version+"/screenshot", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("version", version)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		h.GetAppBundleBootScreenshot(rr, req)
+		return rr
+	}
+
+	rr := get("0002")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "\x89PNG", rr.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("0001").Code)
 }
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// RollbackResponse is the response of a successful rollback
+type RollbackResponse struct {
+	Message  string                    `json:"message"`
+	Rollback *appbundle.RollbackResult `json:"rollback"`
+}
+
+// RollbackAppBundle handles POST /app-bundle/rollback
+// @Summary Roll back to the previous app bundle version
+// @Description Switches to the newest released version older than the active one, replacing any scheduled switch, and regenerates its manifest as a health check. When the manifest fails to regenerate or doesn't serve app/index.html, the version that was active is restored. Rollbacks are recorded in the change history.
+// @Tags AppBundle
+// @Produce json
+// @Success 200 {object} RollbackResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "No earlier released version"
+// @Failure 500 {object} ErrorResponse "The previous version failed the health check and the active version was restored"
+// @Security BearerAuth
+// @Router /app-bundle/rollback [post]
+func (h *Handler) RollbackAppBundle(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(authmw.UserKey).(*models.User)
+	if !ok || user == nil {
+		h.log.Warn("Unauthorized app bundle rollback attempt")
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	h.log.Info("App bundle rollback requested", "user", user.Username)
+	result, err := h.appBundleService.RollbackVersion(r.Context())
+	switch {
+	case errors.Is(err, appbundle.ErrNoRollbackTarget):
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	case errors.Is(err, appbundle.ErrRollbackUnhealthy):
+		h.log.Error("App bundle rollback failed the health check", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "The previous version failed the health check; the active version was kept")
+		return
+	case err != nil:
+		h.log.Error("Failed to roll back app bundle version", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to roll back app bundle version")
+		return
+	}
+
+	h.log.Info("App bundle version rolled back", "from", result.FromVersion, "to", result.ToVersion, "user", user.Username)
+	SendJSONResponse(w, http.StatusOK, RollbackResponse{
+		Message:  fmt.Sprintf("Rolled back from app bundle version %s to %s", result.FromVersion, result.ToVersion),
+		Rollback: result,
+	})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackAppBundle(t *testing.T) {
+	adminUser := models.User{ID: uuid.New(), Username: "admin", Role: models.RoleAdmin}
+	rollback := func(h *Handler, user *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/app-bundle/rollback", nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, user))
+		}
+		rr := httptest.NewRecorder()
+		h.RollbackAppBundle(rr, req)
+		return rr
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		h, mockAppBundleService := createTestHandler()
+		mockAppBundleService.RollbackVersionFunc = func(ctx context.Context) (*appbundle.RollbackResult, error) {
+			return &appbundle.RollbackResult{FromVersion: "0004", ToVersion: "0003", ManifestHash: "abc", FileCount: 12}, nil
+		}
+
+		rr := rollback(h, &adminUser)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var response RollbackResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "Rolled back from app bundle version 0004 to 0003", response.Message)
+		assert.Equal(t, &appbundle.RollbackResult{FromVersion: "0004", ToVersion: "0003", ManifestHash: "abc", FileCount: 12}, response.Rollback)
+	})
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{"No Earlier Version", fmt.Errorf("%w: version 0001 is the oldest released version", appbundle.ErrNoRollbackTarget), http.StatusConflict},
+		{"Unhealthy", fmt.Errorf("%w: manifest of version 0003 has no app/index.html", appbundle.ErrRollbackUnhealthy), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mockAppBundleService := createTestHandler()
+			mockAppBundleService.RollbackVersionFunc = func(ctx context.Context) (*appbundle.RollbackResult, error) {
+				return nil, tt.err
+			}
+			assert.Equal(t, tt.expectedStatus, rollback(h, &adminUser).Code)
+		})
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		h, _ := createTestHandler()
+		assert.Equal(t, http.StatusUnauthorized, rollback(h, nil).Code)
+	})
+}
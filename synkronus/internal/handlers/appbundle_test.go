@@ -2,12 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -247,6 +254,138 @@ func TestGetAppBundleFileNotModified(t *testing.T) {
 	assert.Equal(t, http.StatusNotModified, resp2.StatusCode, "Expected status code %d, got %d", http.StatusNotModified, resp2.StatusCode)
 }
 
+func TestGetAppBundleFileRange(t *testing.T) {
+	h, _ := createTestHandler()
+	r := chi.NewRouter()
+	r.Get("/app-bundle/download/{path}", h.GetAppBundleFile)
+
+	full := httptest.NewRecorder()
+	r.ServeHTTP(full, httptest.NewRequest(http.MethodGet, "/app-bundle/download/index.html", nil))
+	require.Equal(t, http.StatusOK, full.Code)
+	assert.Equal(t, "bytes", full.Header().Get("Accept-Ranges"))
+	content := full.Body.String()
+	etag := full.Header().Get("ETag")
+
+	for _, query := range []string{"", "?preview=true", "?version=0002"} {
+		t.Run("resume"+query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/app-bundle/download/index.html"+query, nil)
+			req.Header.Set("Range", "bytes=6-")
+			req.Header.Set("If-Range", etag)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusPartialContent, w.Code)
+			assert.Equal(t, content[6:], w.Body.String())
+			assert.Equal(t, fmt.Sprintf("bytes 6-%d/%d", len(content)-1, len(content)), w.Header().Get("Content-Range"))
+		})
+	}
+
+	// A stale validator returns the whole file so the client starts over
+	req := httptest.NewRequest(http.MethodGet, "/app-bundle/download/index.html", nil)
+	req.Header.Set("Range", "bytes=6-")
+	req.Header.Set("If-Range", `"stale"`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.String())
+}
+
+func TestGetAppBundleFileCaching(t *testing.T) {
+	h, _ := createTestHandler()
+	r := chi.NewRouter()
+	r.Get("/app-bundle/download/{path}", h.GetAppBundleFile)
+
+	get := func(query string, header http.Header, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app-bundle/download/index.html"+query, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req = withTestUser(req, "carol", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Active files are revalidated; files of a version are kept for good, by a CDN only
+	// when the requester can't see internal versions
+	w := get("", nil, models.RoleReadOnly)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, lastModified)
+	assert.Equal(t, "public, max-age=31536000, immutable", get("?version=0002", nil, models.RoleReadOnly).Header().Get("Cache-Control"))
+	assert.Equal(t, "private, max-age=31536000, immutable", get("?version=0002", nil, models.RoleAdmin).Header().Get("Cache-Control"))
+	assert.Equal(t, "private, no-cache", get("?preview=true", nil, models.RoleAdmin).Header().Get("Cache-Control"))
+
+	w = get("", http.Header{"If-Modified-Since": {lastModified}}, models.RoleReadOnly)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestDownloadBundleZip(t *testing.T) {
+	h, mockService := createTestHandler()
+	zipPath := filepath.Join(t.TempDir(), "bundle.zip")
+	require.NoError(t, os.WriteFile(zipPath, []byte("PK zip content"), 0o644))
+	mockService.SetBundleZipPath(zipPath)
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app-bundle/download-zip", nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		h.DownloadBundleZip(w, req)
+		return w
+	}
+
+	w := get(nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "PK zip content", w.Body.String())
+	assert.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	require.NotEmpty(t, etag)
+	require.NotEmpty(t, lastModified)
+
+	for name, header := range map[string]http.Header{
+		"If-None-Match":     {"If-None-Match": {etag}},
+		"If-Modified-Since": {"If-Modified-Since": {lastModified}},
+	} {
+		w := get(header)
+		assert.Equal(t, http.StatusNotModified, w.Code, name)
+		assert.Empty(t, w.Body.String(), name)
+		assert.Equal(t, etag, w.Header().Get("ETag"), name)
+	}
+
+	// Resuming with the ETag returns the rest of the zip
+	w = get(http.Header{"Range": {"bytes=3-"}, "If-Range": {etag}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "zip content", w.Body.String())
+
+	// A replaced zip (a new active version) gets a new ETag
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(zipPath, later, later))
+	w = get(http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	mockService.SetBundleZipPath(filepath.Join(t.TempDir(), "missing.zip"))
+	assert.Equal(t, http.StatusNotFound, get(nil).Code)
+}
+
+func TestStreamFile_NotSeekable(t *testing.T) {
+	h, _ := createTestHandler()
+	req := httptest.NewRequest(http.MethodGet, "/app-bundle/download/a.txt", nil)
+	req.Header.Set("Range", "bytes=2-")
+	w := httptest.NewRecorder()
+
+	h.streamFile(w, req, io.NopCloser(strings.NewReader("hello")), &appbundle.File{Path: "a.txt", Size: 5, Hash: "h", MimeType: "text/plain"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "none", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "hello", w.Body.String())
+}
+
 func TestGetAppBundleManifestNotModified(t *testing.T) {
 	// Create a test handler with a mock service
 	h, _ := createTestHandler()
@@ -280,6 +419,51 @@ func TestGetAppBundleManifestNotModified(t *testing.T) {
 	assert.Empty(t, body, "Expected empty response body, got %s", string(body))
 }
 
+func TestGetAppBundleManifestRendererWarnings(t *testing.T) {
+	h, mockService := createTestHandler()
+	mockService.SetAppInfo(&appbundle.AppInfo{Renderers: map[string]appbundle.RendererInfo{
+		"signature": {Version: "1.2.0", MinHostVersion: "2.1.0"},
+		"gps":       {},
+	}})
+
+	get := func(hostVersion, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app-bundle/manifest", nil)
+		if hostVersion != "" {
+			req.Header.Set(appbundle.HostAppVersionHeader, hostVersion)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		h.GetAppBundleManifest(w, req)
+		return w
+	}
+
+	w := get("2.0.0", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var manifest appbundle.Manifest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	require.Len(t, manifest.Warnings, 1)
+	assert.Equal(t, "signature", manifest.Warnings[0].Renderer)
+	assert.Equal(t, "2.1.0", manifest.Warnings[0].MinHostVersion)
+	assert.Equal(t, appbundle.HostAppVersionHeader, w.Header().Get("Vary"))
+
+	// Upgrading the app changes the ETag, so the client doesn't keep a stale warning
+	assert.Equal(t, http.StatusNotModified, get("2.0.0", w.Header().Get("ETag")).Code)
+	w = get("2.1.0", w.Header().Get("ETag"))
+	require.Equal(t, http.StatusOK, w.Code)
+	manifest = appbundle.Manifest{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	assert.Empty(t, manifest.Warnings)
+
+	// Clients that don't declare a version get no warnings
+	w = get("", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "warnings")
+
+	assert.Equal(t, http.StatusBadRequest, get("latest", "").Code)
+}
+
 func TestCompareAppBundleVersions(t *testing.T) {
 	// Create a test handler with a mock service
 	h, _ := createTestHandler()
@@ -287,6 +471,7 @@ func TestCompareAppBundleVersions(t *testing.T) {
 	tests := []struct {
 		name           string
 		currentVersion string
+		targetVersion  string
 		preview        string
 		expectedCode   int
 	}{
@@ -301,6 +486,12 @@ func TestCompareAppBundleVersions(t *testing.T) {
 			preview:        "true",
 			expectedCode:   http.StatusOK,
 		},
+		{
+			name:           "compare with explicit target",
+			currentVersion: "0003",
+			targetVersion:  "0001",
+			expectedCode:   http.StatusOK,
+		},
 		{
 			name:         "no current version",
 			expectedCode: http.StatusOK,
@@ -315,6 +506,9 @@ func TestCompareAppBundleVersions(t *testing.T) {
 			if tc.currentVersion != "" {
 				q.Add("current", tc.currentVersion)
 			}
+			if tc.targetVersion != "" {
+				q.Add("target", tc.targetVersion)
+			}
 			if tc.preview != "" {
 				q.Add("preview", tc.preview)
 			}
@@ -341,6 +535,42 @@ func TestCompareAppBundleVersions(t *testing.T) {
 				assert.Contains(t, respBody, "compare_version_a")
 				assert.Contains(t, respBody, "compare_version_b")
 			}
+			if tc.targetVersion != "" {
+				assert.Equal(t, tc.currentVersion, respBody["compare_version_a"])
+				assert.Equal(t, tc.targetVersion, respBody["compare_version_b"])
+			}
 		})
 	}
 }
+
+func TestCompareAppBundleVersions_Files(t *testing.T) {
+	h, bundles := createTestHandler()
+	bundles.SetFileChanges("0001", "0003", &appbundle.FileChanges{
+		Added:        []appbundle.FileChange{{Path: "forms/visit/schema.json", Hash: "abc", Size: 12}},
+		Removed:      []appbundle.FileChange{},
+		Modified:     []appbundle.FileChange{},
+		DownloadSize: 12,
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app-bundle/changes?"+query, nil)
+		w := httptest.NewRecorder()
+		h.CompareAppBundleVersions(w, req)
+		return w
+	}
+
+	w := get("current=0001&target=0003&detail=files")
+	require.Equal(t, http.StatusOK, w.Code)
+	var changeLog appbundle.ChangeLog
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &changeLog))
+	require.NotNil(t, changeLog.Files)
+	assert.Equal(t, "forms/visit/schema.json", changeLog.Files.Added[0].Path)
+	assert.Equal(t, int64(12), changeLog.Files.DownloadSize)
+
+	// Files are only listed on request
+	w = get("current=0001&target=0003")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"files"`)
+
+	assert.Equal(t, http.StatusBadRequest, get("current=0001&target=0003&detail=fields").Code)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// VersionVisibilityRequest marks an app bundle version internal or released
+type VersionVisibilityRequest struct {
+	Internal bool `json:"internal"`
+}
+
+// SetAppBundleVersionVisibility handles PUT /app-bundle/versions/{version}/visibility
+// @Summary Mark an app bundle version internal or released
+// @Description Internal versions are only listed by /app-bundle/versions and served with preview or version to admins and the users in APP_BUNDLE_TESTERS, so a version can be tried out before everyone learns about it. Internal versions can't be activated, and the active or scheduled version can't be made internal.
+// @Tags AppBundle
+// @Accept json
+// @Produce json
+// @Param version path string true "Version"
+// @Param body body VersionVisibilityRequest true "Visibility"
+// @Success 200 {object} appbundle.VersionInfo
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Version not found"
+// @Failure 409 {object} ErrorResponse "The version is active or scheduled"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /app-bundle/versions/{version}/visibility [put]
+func (h *Handler) SetAppBundleVersionVisibility(w http.ResponseWriter, r *http.Request) {
+	version := chi.URLParam(r, "version")
+	var req VersionVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+
+	err := h.appBundleService.SetVersionInternal(r.Context(), version, req.Internal)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		SendErrorResponse(w, http.StatusNotFound, err, fmt.Sprintf("Version %s not found", version))
+		return
+	case errors.Is(err, appbundle.ErrVersionInternal):
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to change app bundle version visibility", "error", err, "version", version)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to change version visibility")
+		return
+	}
+
+	details, err := h.appBundleService.GetVersionDetails(r.Context())
+	if err != nil {
+		h.log.Error("Failed to get app bundle version details", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle versions")
+		return
+	}
+	for _, detail := range details {
+		if detail.Version == version {
+			SendJSONResponse(w, http.StatusOK, detail)
+			return
+		}
+	}
+	SendErrorResponse(w, http.StatusNotFound, nil, fmt.Sprintf("Version %s not found", version))
+}
+
+// GetAppBundleBootScreenshot handles GET /app-bundle/versions/{version}/screenshot
+// @Summary Get the boot check screenshot of an app bundle version
+// @Description Returns the screenshot taken when the version's app/index.html was loaded in a headless browser at push time. Versions pushed without a boot check have none.
+// @Tags AppBundle
+// @Produce png
+// @Param version path string true "Version"
+// @Success 200 {file} binary
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Version or screenshot not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /app-bundle/versions/{version}/screenshot [get]
+func (h *Handler) GetAppBundleBootScreenshot(w http.ResponseWriter, r *http.Request) {
+	version := chi.URLParam(r, "version")
+	screenshot, err := h.appBundleService.GetBootScreenshot(r.Context(), version)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			SendErrorResponse(w, http.StatusNotFound, err, fmt.Sprintf("Version %s has no boot screenshot", version))
+			return
+		}
+		h.log.Error("Failed to read app bundle boot screenshot", "error", err, "version", version)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to read boot screenshot")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(screenshot)))
+	w.Write(screenshot)
+}
+
+// canSeeInternalVersions reports whether the caller is an admin or a configured tester
+func (h *Handler) canSeeInternalVersions(r *http.Request) bool {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		return false
+	}
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+	if h.config == nil {
+		return false
+	}
+	for _, tester := range strings.Split(h.config.AppBundleTesters, ",") {
+		if strings.TrimSpace(tester) == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenVersions returns the versions the caller may not see, and the newest version
+// they may. Admins and testers see every version.
+func (h *Handler) hiddenVersions(ctx context.Context, r *http.Request) (hidden map[string]bool, latest string, err error) {
+	details, err := h.appBundleService.GetVersionDetails(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	privileged := h.canSeeInternalVersions(r)
+	hidden = make(map[string]bool)
+	for _, detail := range details {
+		if detail.Internal && !privileged {
+			hidden[detail.Version] = true
+		} else if latest == "" {
+			latest = detail.Version
+		}
+	}
+	return hidden, latest, nil
+}
+
+// visibleVersions lists the versions as GetVersions does, without the hidden ones
+func (h *Handler) visibleVersions(ctx context.Context, hidden map[string]bool) ([]string, error) {
+	versions, err := h.appBundleService.GetVersions(ctx)
+	if err != nil || len(hidden) == 0 {
+		return versions, err
+	}
+	visible := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if !hidden[strings.TrimSuffix(version, " *")] {
+			visible = append(visible, version)
+		}
+	}
+	return visible, nil
+}
+
+// internalVersionContext applies the optional 'internal' query parameter of pushes and
+// promotions, which creates the version as internal
+func (h *Handler) internalVersionContext(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	raw := r.URL.Query().Get("internal")
+	if raw == "" {
+		return ctx, true
+	}
+	internal, err := strconv.ParseBool(raw)
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "internal must be true or false")
+		return nil, false
+	}
+	if internal {
+		ctx = appbundle.WithInternalVersion(ctx)
+	}
+	return ctx, true
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+func withTestUser(r *http.Request, username string, role models.Role) *http.Request {
+	user := &models.User{Username: username, Role: role}
+	return r.WithContext(context.WithValue(r.Context(), authmw.UserKey, user))
+}
+
+func TestGetAppBundleVersionsHidesInternalVersions(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	h.config.AppBundleTesters = "alice, bob"
+	require.NoError(t, mockAppBundleService.SetVersionInternal(context.Background(), "20250102-000000", true))
+
+	tests := []struct {
+		name     string
+		username string
+		role     models.Role
+		visible  bool
+	}{
+		{name: "read-write user", username: "carol", role: models.RoleReadWrite, visible: false},
+		{name: "tester", username: "bob", role: models.RoleReadOnly, visible: true},
+		{name: "admin", username: "admin", role: models.RoleAdmin, visible: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := withTestUser(httptest.NewRequest(http.MethodGet, "/app-bundle/versions", nil), tc.username, tc.role)
+			rr := httptest.NewRecorder()
+
+			h.GetAppBundleVersions(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tc.visible, strings.Contains(rr.Body.String(), "20250102-000000"))
+			assert.Contains(t, rr.Body.String(), "20250101-000000")
+		})
+	}
+}
+
+func TestGetAppBundleFileHidesInternalVersion(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	require.NoError(t, mockAppBundleService.SetVersionInternal(context.Background(), "20250102-000000", true))
+
+	req := httptest.NewRequest(http.MethodGet, "/app-bundle/download/index.html?version=20250102-000000", nil)
+	req = withTestUser(req, "carol", models.RoleReadWrite)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("path", "index.html")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	h.GetAppBundleFile(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSetAppBundleVersionVisibility(t *testing.T) {
+	tests := []struct {
+		name           string
+		version        string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "mark internal",
+			version:        "20250102-000000",
+			body:           `{"internal":true}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"internal":true`,
+		},
+		{
+			name:           "invalid body",
+			version:        "20250102-000000",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown version",
+			version:        "20990101-000000",
+			body:           `{"internal":true}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+			req := httptest.NewRequest(http.MethodPut, "/app-bundle/versions/"+tc.version+"/visibility", strings.NewReader(tc.body))
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("version", tc.version)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+
+			h.SetAppBundleVersionVisibility(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedBody != "" {
+				assert.Contains(t, rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetAppBundleChangeHistory(t *testing.T) {
+	h, mockAppBundleService := createTestHandler()
+	require.NoError(t, mockAppBundleService.SetVersionInternal(context.Background(), "20250102-000000", true))
+	mockAppBundleService.SetChangeHistory([]appbundle.ChangeHistoryEntry{
+		{ID: 3, Action: appbundle.ChangeActionPush, FromVersion: "20250101-000000", ToVersion: "20250102-000000", Actor: "admin"},
+		{ID: 2, Action: appbundle.ChangeActionSwitch, ToVersion: "20250101-000000", Actor: "admin"},
+		{ID: 1, Action: appbundle.ChangeActionPush, ToVersion: "20250101-000000", Actor: "admin"},
+	})
+
+	get := func(query, username string, role models.Role) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(http.MethodGet, "/app-bundle/changes/history"+query, nil), username, role)
+		rr := httptest.NewRecorder()
+		h.GetAppBundleChangeHistory(rr, req)
+		return rr
+	}
+	ids := func(rr *httptest.ResponseRecorder) []int64 {
+		var response struct {
+			Changes []appbundle.ChangeHistoryEntry `json:"changes"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		var ids []int64
+		for _, entry := range response.Changes {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	rr := get("?form=household&field=phone&limit=2", "admin", models.RoleAdmin)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []int64{3, 2}, ids(rr))
+	assert.Equal(t, appbundle.ChangeHistoryFilter{Form: "household", Field: "phone", Limit: 2}, mockAppBundleService.ChangeHistoryFilter())
+
+	// Transitions to internal versions are hidden before the limit applies
+	rr = get("?limit=2", "carol", models.RoleReadWrite)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []int64{2, 1}, ids(rr))
+
+	rr = get("?limit=-1", "admin", models.RoleAdmin)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -1,44 +1,110 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/opendataensemble/synkronus/pkg/attachment"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
 )
 
+type contextKey string
+
+// signedAccessKey marks requests authorized by a signed download URL
+const signedAccessKey contextKey = "signed_access"
+
 type AttachmentHandler struct {
-	service attachment.Service
-	log     *logger.Logger
+	service  attachment.Service
+	manifest attachment.ManifestService // used for signed URLs and download auditing; may be nil
+	previews attachment.PreviewService  // may be nil
+	log      *logger.Logger
 }
 
-func NewAttachmentHandler(log *logger.Logger, service attachment.Service) *AttachmentHandler {
+func NewAttachmentHandler(log *logger.Logger, service attachment.Service, manifest attachment.ManifestService, previews attachment.PreviewService) *AttachmentHandler {
 	return &AttachmentHandler{
-		service: service,
-		log:     log,
+		service:  service,
+		manifest: manifest,
+		previews: previews,
+		log:      log,
 	}
 }
 
-// RegisterRoutes registers the attachment routes
-func (h *AttachmentHandler) RegisterRoutes(r chi.Router, manifestHandler func(http.ResponseWriter, *http.Request)) {
+// RegisterRoutes registers the attachment routes. Downloads and previews accept either a
+// signed URL or the regular authentication; all other routes require authMiddleware. Uploads also pass
+// through uploadMiddleware.
+func (h *AttachmentHandler) RegisterRoutes(r chi.Router, manifestHandler func(http.ResponseWriter, *http.Request), authMiddleware, uploadMiddleware func(http.Handler) http.Handler) {
 	r.Route("/attachments", func(r chi.Router) {
 		// Manifest endpoint
-		r.Post("/manifest", manifestHandler)
+		r.With(authMiddleware).Post("/manifest", manifestHandler)
+		r.With(authMiddleware).Post("/manifest/refresh", h.RefreshDownloadURLs)
+
+		// Bulk download of many attachments as one ZIP
+		r.With(authMiddleware).Post("/archive", h.DownloadArchive)
 
 		// Individual attachment routes
 		r.Route("/{attachment_id}", func(r chi.Router) {
-			r.Put("/", h.UploadAttachment)
-			r.Get("/", h.DownloadAttachment)
-			r.Head("/", h.CheckAttachment)
+			r.With(authMiddleware, uploadMiddleware).Put("/", h.UploadAttachment)
+			r.With(h.signedOrAuthenticated(authMiddleware)).Get("/", h.DownloadAttachment)
+			r.With(authMiddleware).Head("/", h.CheckAttachment)
+			r.With(authMiddleware).Get("/meta", h.GetAttachmentMetadata)
+			r.With(h.signedOrAuthenticated(authMiddleware)).Get("/preview", h.PreviewAttachment)
 		})
 	})
 }
 
+// signedOrAuthenticated lets requests carrying a valid download signature through without
+// a token and hands everything else to authMiddleware
+func (h *AttachmentHandler) signedOrAuthenticated(authMiddleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authenticated := authMiddleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			signature := query.Get("signature")
+			if signature == "" || h.manifest == nil {
+				authenticated.ServeHTTP(w, r)
+				return
+			}
+
+			attachmentID := chi.URLParam(r, "attachment_id")
+			err := h.manifest.VerifyDownloadURL(attachmentID, query.Get("client_id"), query.Get("expires"), signature)
+			if err != nil {
+				h.log.Warn("Rejected signed attachment download", "attachmentId", attachmentID, "error", err)
+				SendErrorResponse(w, http.StatusForbidden, err, "Invalid or expired download URL")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), signedAccessKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OverwritePolicyHeader selects what an upload to an existing attachment ID does
+const OverwritePolicyHeader = "X-Overwrite-Policy"
+
 // UploadAttachment handles PUT /attachments/{attachment_id}
+// @Summary Upload an attachment
+// @Description Stores the attachment. An upload to an existing ID is handled by the policy in the X-Overwrite-Policy header (reject, overwrite or idempotent), or the server's ATTACHMENT_OVERWRITE_POLICY without one: reject answers 409; idempotent answers 200 for identical content and 409 otherwise; overwrite replaces differing content, keeping the previous content as a version. The outcome field reports created, replaced or unchanged.
+// @Tags Attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param attachment_id path string true "Attachment ID"
+// @Param X-Overwrite-Policy header string false "reject, overwrite or idempotent"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 409 {object} ErrorResponse "Conflict"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /attachments/{attachment_id} [put]
 func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
 	// Get attachment ID from URL
 	attachmentID := chi.URLParam(r, "attachment_id")
@@ -47,6 +113,16 @@ func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Without the header the service applies the configured policy
+	var policy attachment.OverwritePolicy
+	if value := r.Header.Get(OverwritePolicyHeader); value != "" {
+		var err error
+		if policy, err = attachment.ParseOverwritePolicy(value); err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+	}
+
 	// Parse the multipart form
 	err := r.ParseMultipartForm(32 << 20) // 32MB max memory
 	if err != nil {
@@ -55,7 +131,7 @@ func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get the file from the form data
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		if errors.Is(err, http.ErrMissingFile) {
 			SendErrorResponse(w, http.StatusBadRequest, nil, "file is required")
@@ -66,10 +142,13 @@ func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Requ
 	}
 	defer file.Close()
 
-	// Save the attachment
-	err = h.service.Save(r.Context(), attachmentID, file)
+	result, err := h.service.Save(r.Context(), attachmentID, file, policy)
 	if err != nil {
-		if os.IsExist(err) {
+		if errors.Is(err, attachment.ErrContentConflict) {
+			SendErrorResponse(w, http.StatusConflict, err, "Attachment already exists with different content")
+			return
+		}
+		if errors.Is(err, os.ErrExist) {
 			SendErrorResponse(w, http.StatusConflict, err, "Attachment already exists")
 			return
 		}
@@ -77,13 +156,46 @@ func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	switch result.Outcome {
+	case attachment.OutcomeCreated:
+		h.recordUpload(r, attachmentID, header, result, "create")
+	case attachment.OutcomeReplaced:
+		h.log.Info("Attachment replaced",
+			"attachmentId", attachmentID,
+			"previousSha256", result.PreviousSHA256,
+			"previousVersion", result.PreviousVersion,
+			"sha256", result.SHA256)
+		h.recordUpload(r, attachmentID, header, result, "update")
+	}
+
 	// Return success response
 	SendJSONResponse(w, http.StatusOK, map[string]string{
-		"status": "success",
+		"status":  "success",
+		"outcome": result.Outcome,
+		"sha256":  result.SHA256,
 	})
 }
 
+// AttachmentVariantHeader tells which variant of an attachment a download returned
+const AttachmentVariantHeader = "X-Attachment-Variant"
+
+// variantOriginal requests the attachment as uploaded, rather than its web variant
+const variantOriginal = "original"
+
 // DownloadAttachment handles GET /attachments/{attachment_id}
+// @Summary Download an attachment
+// @Description Returns the attachment. Videos that were transcoded are served as their web-friendly MP4 variant, with range request support for streaming; ?variant=original returns the video as uploaded when the server keeps originals.
+// @Tags Attachments
+// @Produce octet-stream
+// @Param attachment_id path string true "Attachment ID"
+// @Param variant query string false "original for the uploaded content instead of the transcoded video"
+// @Success 200 {file} binary
+// @Success 206 {file} binary "Partial content of a transcoded video"
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /attachments/{attachment_id} [get]
 func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
 	// Get attachment ID from URL
 	attachmentID := chi.URLParam(r, "attachment_id")
@@ -103,6 +215,18 @@ func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	variant := r.URL.Query().Get("variant")
+	switch variant {
+	case "", attachment.VariantWeb:
+		if h.serveVariant(w, r, attachmentID) {
+			return
+		}
+	case variantOriginal:
+	default:
+		SendErrorResponse(w, http.StatusBadRequest, nil, "variant must be web or original")
+		return
+	}
+
 	// Get the attachment
 	file, err := h.service.Get(r.Context(), attachmentID)
 	if err != nil {
@@ -111,9 +235,12 @@ func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Re
 	}
 	defer file.Close()
 
+	h.auditDownload(r, attachmentID)
+
 	// Set headers for file download
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Disposition", "attachment; filename="+attachmentID)
+	w.Header().Set(AttachmentVariantHeader, variantOriginal)
 
 	// Stream the file to the response
 	_, err = io.Copy(w, file)
@@ -124,6 +251,219 @@ func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Re
 	}
 }
 
+// serveVariant serves the transcoded web variant of a video with range support, so it can
+// be streamed. It returns false when the attachment has no variant.
+func (h *AttachmentHandler) serveVariant(w http.ResponseWriter, r *http.Request, attachmentID string) bool {
+	file, err := h.service.GetVariant(r.Context(), attachmentID, attachment.VariantWeb)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		h.log.Error("Failed to open attachment variant", "attachmentId", attachmentID, "error", err)
+		return false
+	}
+	defer file.Close()
+
+	h.auditDownload(r, attachmentID)
+
+	w.Header().Set("Content-Type", attachment.TranscodedContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+attachmentID)
+	w.Header().Set(AttachmentVariantHeader, attachment.VariantWeb)
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
+		return true
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		h.log.Error("Failed to stream attachment variant", "error", err)
+	}
+	return true
+}
+
+// auditDownload records who downloaded an attachment; failures are logged but never block the download
+func (h *AttachmentHandler) auditDownload(r *http.Request, attachmentID string) {
+	event := attachment.DownloadEvent{
+		AttachmentID: attachmentID,
+		ClientID:     r.URL.Query().Get("client_id"),
+		IPAddress:    r.RemoteAddr,
+		UserAgent:    r.UserAgent(),
+	}
+	if event.ClientID == "" {
+		event.ClientID = r.Header.Get("X-Client-ID")
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		event.IPAddress = host
+	}
+	if user := authmw.GetUserFromContext(r.Context()); user != nil {
+		event.Username = user.Username
+	}
+	event.Signed, _ = r.Context().Value(signedAccessKey).(bool)
+
+	h.log.Info("Attachment downloaded",
+		"attachmentId", event.AttachmentID,
+		"username", event.Username,
+		"clientId", event.ClientID,
+		"ip", event.IPAddress,
+		"signed", event.Signed)
+
+	if h.manifest == nil {
+		return
+	}
+	if err := h.manifest.RecordDownload(r.Context(), event); err != nil {
+		h.log.Error("Failed to record attachment download", "attachmentId", attachmentID, "error", err)
+	}
+}
+
+// recordUpload stores the attachment metadata and adds a create or update operation to the
+// attachment manifest so other clients download the new content; failures are logged but
+// never fail the upload
+func (h *AttachmentHandler) recordUpload(r *http.Request, attachmentID string, header *multipart.FileHeader, result *attachment.SaveResult, operation string) {
+	if h.manifest == nil {
+		return
+	}
+	size := int(result.Size)
+	var contentType *string
+	if ct := header.Header.Get("Content-Type"); ct != "" {
+		contentType = &ct
+	}
+
+	meta := attachment.Metadata{
+		AttachmentID: attachmentID,
+		Size:         result.Size,
+		ContentType:  contentType,
+		SHA256:       &result.SHA256,
+		Exif:         result.Exif,
+	}
+	if user := authmw.GetUserFromContext(r.Context()); user != nil {
+		meta.UploadedBy = &user.Username
+	}
+	if err := h.manifest.RecordMetadata(r.Context(), meta); err != nil {
+		h.log.Error("Failed to record attachment metadata", "attachmentId", attachmentID, "error", err)
+	}
+
+	// Recorded without a client ID so the operation is visible to every client
+	if err := h.manifest.RecordOperation(r.Context(), attachmentID, operation, "", &size, contentType); err != nil {
+		h.log.Error("Failed to record attachment upload", "attachmentId", attachmentID, "error", err)
+	}
+}
+
+// GetAttachmentMetadata handles GET /attachments/{attachment_id}/meta
+// @Summary Get attachment metadata
+// @Description Returns size, content type, SHA-256 hash, upload time, uploader, linked observations and scan status of an attachment without downloading it
+// @Tags Attachments
+// @Produce json
+// @Param attachment_id path string true "Attachment ID"
+// @Success 200 {object} attachment.Metadata
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /attachments/{attachment_id}/meta [get]
+func (h *AttachmentHandler) GetAttachmentMetadata(w http.ResponseWriter, r *http.Request) {
+	attachmentID := chi.URLParam(r, "attachment_id")
+	if attachmentID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "attachment_id is required")
+		return
+	}
+	if h.manifest == nil {
+		SendErrorResponse(w, http.StatusNotFound, nil, "Attachment metadata not found")
+		return
+	}
+
+	meta, err := h.manifest.GetMetadata(r.Context(), attachmentID)
+	if err != nil {
+		if errors.Is(err, attachment.ErrMetadataNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, nil, "Attachment metadata not found")
+			return
+		}
+		h.log.Error("Failed to get attachment metadata", "attachmentId", attachmentID, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get attachment metadata")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, meta)
+}
+
+// PreviewKindHeader tells which kind of preview a preview request returned
+const PreviewKindHeader = "X-Preview-Kind"
+
+// PreviewAttachment handles GET /attachments/{attachment_id}/preview
+// @Summary Preview an attachment
+// @Description Returns a size-limited inline preview for review tools: images downscaled to a JPEG, the first page of a PDF as a JPEG, or the waveform of an audio recording as JSON. Attachments of other types answer 415.
+// @Tags Attachments
+// @Produce jpeg
+// @Produce json
+// @Param attachment_id path string true "Attachment ID"
+// @Param size query int false "Longest edge in pixels of image and PDF previews"
+// @Param points query int false "Number of waveform peaks"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 413 {object} ErrorResponse "Attachment too large to preview"
+// @Failure 415 {object} ErrorResponse "Attachment can't be previewed"
+// @Failure 501 {object} ErrorResponse "Previews of this type are not configured"
+// @Security BearerAuth
+// @Router /attachments/{attachment_id}/preview [get]
+func (h *AttachmentHandler) PreviewAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID := chi.URLParam(r, "attachment_id")
+	if attachmentID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "attachment_id is required")
+		return
+	}
+	if h.previews == nil {
+		SendErrorResponse(w, http.StatusNotImplemented, nil, "Attachment previews are not available")
+		return
+	}
+
+	var options attachment.PreviewOptions
+	for name, target := range map[string]*int{"size": &options.Size, "points": &options.Points} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, name+" must be a positive integer")
+			return
+		}
+		*target = n
+	}
+	// The uploaded content type recognizes audio formats that sniffing doesn't
+	if h.manifest != nil {
+		if meta, err := h.manifest.GetMetadata(r.Context(), attachmentID); err == nil && meta.ContentType != nil {
+			options.ContentType = *meta.ContentType
+		}
+	}
+
+	preview, err := h.previews.Preview(r.Context(), attachmentID, options)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		SendErrorResponse(w, http.StatusNotFound, nil, "Attachment not found")
+		return
+	case errors.Is(err, attachment.ErrPreviewUnsupported):
+		SendErrorResponse(w, http.StatusUnsupportedMediaType, err, "Attachment can't be previewed")
+		return
+	case errors.Is(err, attachment.ErrPreviewTooLarge):
+		SendErrorResponse(w, http.StatusRequestEntityTooLarge, err, "Attachment is too large to preview")
+		return
+	case errors.Is(err, attachment.ErrPreviewUnavailable):
+		SendErrorResponse(w, http.StatusNotImplemented, err, "Previews of this type are not configured on the server")
+		return
+	case err != nil:
+		h.log.Error("Failed to preview attachment", "attachmentId", attachmentID, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to preview attachment")
+		return
+	}
+
+	w.Header().Set("Content-Type", preview.ContentType)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set(PreviewKindHeader, preview.Kind)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(preview.Data); err != nil {
+		h.log.Error("Failed to send attachment preview", "error", err)
+	}
+}
+
 // CheckAttachment handles HEAD /attachments/{attachment_id}
 func (h *AttachmentHandler) CheckAttachment(w http.ResponseWriter, r *http.Request) {
 	// Get attachment ID from URL
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+)
+
+// archiveMissingName is the archive entry listing selected attachments whose files are missing
+const archiveMissingName = "MISSING.txt"
+
+// DownloadArchive handles POST /attachments/archive. It streams one ZIP with the selected
+// attachments, so reviewing a day's photos takes one request instead of hundreds.
+func (h *AttachmentHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	if h.manifest == nil {
+		SendErrorResponse(w, http.StatusServiceUnavailable, nil, "Attachment archives are not available")
+		return
+	}
+
+	var req attachment.ArchiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	entries, err := h.manifest.ArchiveEntries(r.Context(), req)
+	switch {
+	case errors.Is(err, attachment.ErrInvalidArchiveRequest), errors.Is(err, attachment.ErrArchiveTooLarge):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case errors.Is(err, attachment.ErrArchiveEmpty):
+		SendErrorResponse(w, http.StatusNotFound, err, "No attachments match the request")
+		return
+	case err != nil:
+		h.log.Error("Failed to resolve attachment archive", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to resolve attachments")
+		return
+	}
+
+	// Check all files before the first byte is sent; afterwards errors can't be reported
+	var present []attachment.ArchiveEntry
+	var missing []string
+	for _, entry := range entries {
+		exists, err := h.service.Exists(r.Context(), entry.AttachmentID)
+		if err != nil {
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to check attachment existence")
+			return
+		}
+		if exists {
+			present = append(present, entry)
+		} else {
+			missing = append(missing, entry.AttachmentID)
+		}
+	}
+	if len(present) == 0 {
+		SendErrorResponse(w, http.StatusNotFound, nil, "None of the selected attachments exist")
+		return
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="attachments-%s.zip"`, now.Format("20060102T150405Z")))
+
+	zw := zip.NewWriter(w)
+	for _, entry := range present {
+		if err := h.writeArchiveEntry(r, zw, entry, now); err != nil {
+			// Leave the archive unterminated so the client sees a broken download rather
+			// than a valid ZIP that silently lacks files
+			h.log.Error("Failed to stream attachment archive", "error", err, "attachmentId", entry.AttachmentID)
+			return
+		}
+	}
+	if len(missing) > 0 {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: archiveMissingName, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			_, err = io.WriteString(f, "These attachments were selected but their files are missing on the server:\n"+strings.Join(missing, "\n")+"\n")
+		}
+		if err != nil {
+			h.log.Error("Failed to stream attachment archive", "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		h.log.Error("Failed to finish attachment archive", "error", err)
+		return
+	}
+
+	h.log.Info("Attachment archive downloaded", "files", len(present), "missing", len(missing))
+}
+
+// writeArchiveEntry copies one attachment into the archive and audits the download.
+// Attachments are mostly photos and other compressed media, so they are stored as is.
+func (h *AttachmentHandler) writeArchiveEntry(r *http.Request, zw *zip.Writer, entry attachment.ArchiveEntry, modified time.Time) error {
+	file, err := h.service.Get(r.Context(), entry.AttachmentID)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.Name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, file); err != nil {
+		return err
+	}
+	h.auditDownload(r, entry.AttachmentID)
+	return nil
+}
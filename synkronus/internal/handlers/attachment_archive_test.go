@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadArchive(t *testing.T) {
+	mockSvc := &mockAttachmentService{}
+	mockSvc.On("Exists", mock.Anything, "photo.jpg").Return(true, nil)
+	mockSvc.On("Exists", mock.Anything, "sig.png").Return(true, nil)
+	mockSvc.On("Exists", mock.Anything, "lost.jpg").Return(false, nil)
+	mockSvc.On("Get", mock.Anything, "photo.jpg").Return(io.NopCloser(strings.NewReader("jpeg bytes")), nil)
+	mockSvc.On("Get", mock.Anything, "sig.png").Return(io.NopCloser(strings.NewReader("png bytes")), nil)
+
+	var received attachment.ArchiveRequest
+	var downloaded []string
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		ArchiveEntriesFunc: func(ctx context.Context, req attachment.ArchiveRequest) ([]attachment.ArchiveEntry, error) {
+			received = req
+			return []attachment.ArchiveEntry{
+				{AttachmentID: "photo.jpg", Name: "household/obs-1/photo.jpg"},
+				{AttachmentID: "sig.png", Name: "household/obs-1/sig.png"},
+				{AttachmentID: "lost.jpg", Name: "household/obs-2/lost.jpg"},
+			}, nil
+		},
+		RecordDownloadFunc: func(ctx context.Context, event attachment.DownloadEvent) error {
+			downloaded = append(downloaded, event.AttachmentID)
+			return nil
+		},
+	}
+	handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/attachments/archive", strings.NewReader(`{"observations":{"form_type":"household","since":"2025-09-14T00:00:00Z"}}`))
+	rr := httptest.NewRecorder()
+	handler.DownloadArchive(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), `filename="attachments-`)
+	require.NotNil(t, received.Observations)
+	assert.Equal(t, "household", received.Observations.FormType)
+	assert.Equal(t, []string{"photo.jpg", "sig.png"}, downloaded)
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	require.NoError(t, err)
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(data)
+	}
+	assert.Equal(t, "jpeg bytes", contents["household/obs-1/photo.jpg"])
+	assert.Equal(t, "png bytes", contents["household/obs-1/sig.png"])
+	assert.Contains(t, contents[archiveMissingName], "lost.jpg")
+}
+
+func TestDownloadArchive_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		entriesErr     error
+		exists         bool
+		expectedStatus int
+	}{
+		{name: "invalid json", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid request", body: `{}`, entriesErr: attachment.ErrInvalidArchiveRequest, expectedStatus: http.StatusBadRequest},
+		{name: "too many files", body: `{"attachment_ids":["a.jpg"]}`, entriesErr: attachment.ErrArchiveTooLarge, expectedStatus: http.StatusBadRequest},
+		{name: "nothing matches", body: `{"observations":{"form_type":"survey"}}`, entriesErr: attachment.ErrArchiveEmpty, expectedStatus: http.StatusNotFound},
+		{name: "database error", body: `{"attachment_ids":["a.jpg"]}`, entriesErr: errors.New("db down"), expectedStatus: http.StatusInternalServerError},
+		{name: "no file exists", body: `{"attachment_ids":["a.jpg"]}`, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockAttachmentService{}
+			mockSvc.On("Exists", mock.Anything, "a.jpg").Return(tt.exists, nil)
+			manifestSvc := &mocks.MockAttachmentManifestService{
+				ArchiveEntriesFunc: func(ctx context.Context, req attachment.ArchiveRequest) ([]attachment.ArchiveEntry, error) {
+					if tt.entriesErr != nil {
+						return nil, tt.entriesErr
+					}
+					return []attachment.ArchiveEntry{{AttachmentID: "a.jpg", Name: "a.jpg"}}, nil
+				},
+			}
+			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+
+			rr := httptest.NewRecorder()
+			handler.DownloadArchive(rr, httptest.NewRequest(http.MethodPost, "/attachments/archive", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+		})
+	}
+}
@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/opendataensemble/synkronus/pkg/attachment"
 )
 
-// AttachmentManifestHandler handles POST /attachments/manifest
+// AttachmentManifestHandler handles POST /attachments/manifest. Clients that poll send
+// the ETag of their last manifest in If-None-Match and get 304 while it still holds.
 func (h *Handler) AttachmentManifestHandler(w http.ResponseWriter, r *http.Request) {
 	var req attachment.AttachmentManifestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -26,8 +30,54 @@ func (h *Handler) AttachmentManifestHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if req.MaxDownloadBudgetBytes < 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "max_download_budget_bytes must be non-negative")
+		return
+	}
+
+	if req.Cursor != "" && req.MaxDownloadBudgetBytes == 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "cursor requires max_download_budget_bytes")
+		return
+	}
+
+	if len(req.KnownHashes) > attachment.MaxKnownHashes {
+		SendErrorResponse(w, http.StatusBadRequest, nil, fmt.Sprintf("known_hashes may hold at most %d hashes", attachment.MaxKnownHashes))
+		return
+	}
+	for _, hash := range req.KnownHashes {
+		if !attachment.ValidHash(hash) {
+			SendErrorResponse(w, http.StatusBadRequest, nil, "known_hashes must be hex SHA-256 hashes")
+			return
+		}
+	}
+
+	// Background polls of an unchanged manifest only cost a version lookup
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag, err := h.attachmentManifestService.ManifestETag(r.Context(), req)
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		if err != nil {
+			h.log.Error("Failed to get attachment manifest ETag", "error", err, "clientId", req.ClientID)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to generate attachment manifest")
+			return
+		}
+		if etagMatches(match, etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	// Get the manifest from the service
 	manifest, err := h.attachmentManifestService.GetManifest(r.Context(), req)
+	if errors.Is(err, attachment.ErrInvalidCursor) {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid cursor; request the manifest again without it")
+		return
+	}
+	if h.sendDatabaseUnavailable(w, err) {
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to get attachment manifest", "error", err, "clientId", req.ClientID, "sinceVersion", req.SinceVersion)
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to generate attachment manifest")
@@ -42,8 +92,25 @@ func (h *Handler) AttachmentManifestHandler(w http.ResponseWriter, r *http.Reque
 		"operationCount", len(manifest.Operations),
 		"downloadCount", manifest.OperationCount.Download,
 		"deleteCount", manifest.OperationCount.Delete,
-		"totalDownloadSize", manifest.TotalDownloadSize)
+		"totalDownloadSize", manifest.TotalDownloadSize,
+		"deferredCount", manifest.OperationCount.Deferred,
+		"skippableCount", manifest.OperationCount.Skippable,
+		"skippableDownloadSize", manifest.SkippableDownloadSize)
 
 	// Send the response
+	if manifest.ETag != "" {
+		w.Header().Set("ETag", manifest.ETag)
+	}
 	SendJSONResponse(w, http.StatusOK, manifest)
 }
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing weakly
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -35,6 +35,9 @@ func TestAttachmentManifestHandler(t *testing.T) {
 	// Create mock attachment manifest service
 	mockAttachmentManifestService := &mocks.MockAttachmentManifestService{
 		GetManifestFunc: func(ctx context.Context, req attachment.AttachmentManifestRequest) (*attachment.AttachmentManifestResponse, error) {
+			if req.Cursor == "stale" {
+				return nil, attachment.ErrInvalidCursor
+			}
 			return &attachment.AttachmentManifestResponse{
 				CurrentVersion: 45,
 				Operations: []attachment.AttachmentOperation{
@@ -73,6 +76,26 @@ func TestAttachmentManifestHandler(t *testing.T) {
 		mockVersionService,
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	)
 
 	tests := []struct {
@@ -105,6 +128,50 @@ func TestAttachmentManifestHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name: "negative max_download_budget_bytes",
+			requestBody: attachment.AttachmentManifestRequest{
+				ClientID:               "mobile-app-123",
+				MaxDownloadBudgetBytes: -1,
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "cursor without budget",
+			requestBody: attachment.AttachmentManifestRequest{
+				ClientID: "mobile-app-123",
+				Cursor:   "abc",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid cursor",
+			requestBody: attachment.AttachmentManifestRequest{
+				ClientID:               "mobile-app-123",
+				SinceVersion:           42,
+				MaxDownloadBudgetBytes: 1024,
+				Cursor:                 "stale",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "known hashes",
+			requestBody: attachment.AttachmentManifestRequest{
+				ClientID:     "mobile-app-123",
+				SinceVersion: 42,
+				KnownHashes:  []string{"E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"},
+			},
+			expectedStatus: http.StatusOK,
+			expectedOps:    2,
+		},
+		{
+			name: "malformed known hash",
+			requestBody: attachment.AttachmentManifestRequest{
+				ClientID:    "mobile-app-123",
+				KnownHashes: []string{"not-a-hash"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -169,3 +236,50 @@ func stringPtr(s string) *string {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestAttachmentManifestHandler_ConditionalRequests(t *testing.T) {
+	h, _ := createTestHandler()
+	built := 0
+	h.attachmentManifestService = &mocks.MockAttachmentManifestService{
+		GetManifestFunc: func(ctx context.Context, req attachment.AttachmentManifestRequest) (*attachment.AttachmentManifestResponse, error) {
+			built++
+			return &attachment.AttachmentManifestResponse{CurrentVersion: 45, Operations: []attachment.AttachmentOperation{}, ETag: `"45-abc"`}, nil
+		},
+		ManifestETagFunc: func(ctx context.Context, req attachment.AttachmentManifestRequest) (string, error) {
+			return `"45-abc"`, nil
+		},
+	}
+
+	post := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(attachment.AttachmentManifestRequest{ClientID: "client-1", SinceVersion: 40})
+		req := httptest.NewRequest(http.MethodPost, "/attachments/manifest", bytes.NewReader(body))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.AttachmentManifestHandler(w, req)
+		return w
+	}
+
+	w := post("")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"45-abc"` {
+		t.Fatalf("Expected 200 with the manifest ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	for _, match := range []string{`"45-abc"`, `W/"45-abc"`, `"44-xyz", "45-abc"`} {
+		w = post(match)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: expected an empty 304, got %d", match, w.Code)
+		}
+		if w.Header().Get("ETag") != `"45-abc"` {
+			t.Errorf("If-None-Match %s: expected the ETag on the 304, got %q", match, w.Header().Get("ETag"))
+		}
+	}
+	if built != 1 {
+		t.Errorf("Expected the manifest to be built only without a matching ETag, built %d times", built)
+	}
+
+	if w = post(`"44-xyz"`); w.Code != http.StatusOK {
+		t.Errorf("Expected a stale ETag to get the manifest, got %d", w.Code)
+	}
+}
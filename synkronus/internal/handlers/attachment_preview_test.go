@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePreviewService previews "photo.jpg" and "voice.m4a", the latter only when told it's audio
+type fakePreviewService struct {
+	options attachment.PreviewOptions
+}
+
+func (f *fakePreviewService) Preview(ctx context.Context, attachmentID string, options attachment.PreviewOptions) (*attachment.Preview, error) {
+	f.options = options
+	switch attachmentID {
+	case "photo.jpg":
+		return &attachment.Preview{Kind: attachment.PreviewImage, ContentType: attachment.PreviewImageContentType, Data: []byte("jpeg")}, nil
+	case "voice.m4a":
+		if options.ContentType != "audio/mp4" {
+			return nil, attachment.ErrPreviewUnsupported
+		}
+		return &attachment.Preview{Kind: attachment.PreviewWaveform, ContentType: attachment.PreviewWaveformContentType, Data: []byte(`{"peaks":[]}`)}, nil
+	case "huge.png":
+		return nil, attachment.ErrPreviewTooLarge
+	case "scan.pdf":
+		return nil, attachment.ErrPreviewUnavailable
+	case "notes.txt":
+		return nil, fmt.Errorf("%w: plain text", attachment.ErrPreviewUnsupported)
+	}
+	return nil, &os.PathError{Op: "open", Path: attachmentID, Err: os.ErrNotExist}
+}
+
+func TestPreviewAttachment(t *testing.T) {
+	contentType := "audio/mp4"
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		GetMetadataFunc: func(ctx context.Context, attachmentID string) (*attachment.Metadata, error) {
+			if attachmentID == "voice.m4a" {
+				return &attachment.Metadata{AttachmentID: attachmentID, ContentType: &contentType}, nil
+			}
+			return nil, attachment.ErrMetadataNotFound
+		},
+	}
+	previews := &fakePreviewService{}
+	handler := NewAttachmentHandler(logger.NewLogger(), &mockAttachmentService{}, manifestSvc, previews)
+	r := chi.NewRouter()
+	r.Get("/attachments/{attachment_id}/preview", handler.PreviewAttachment)
+
+	for name, tc := range map[string]struct {
+		path        string
+		status      int
+		contentType string
+		kind        string
+	}{
+		"image":               {path: "/attachments/photo.jpg/preview?size=256", status: http.StatusOK, contentType: "image/jpeg", kind: attachment.PreviewImage},
+		"audio by type":       {path: "/attachments/voice.m4a/preview", status: http.StatusOK, contentType: "application/json", kind: attachment.PreviewWaveform},
+		"unsupported":         {path: "/attachments/notes.txt/preview", status: http.StatusUnsupportedMediaType},
+		"too large":           {path: "/attachments/huge.png/preview", status: http.StatusRequestEntityTooLarge},
+		"not configured":      {path: "/attachments/scan.pdf/preview", status: http.StatusNotImplemented},
+		"missing":             {path: "/attachments/gone.jpg/preview", status: http.StatusNotFound},
+		"invalid size":        {path: "/attachments/photo.jpg/preview?size=big", status: http.StatusBadRequest},
+		"non-positive points": {path: "/attachments/photo.jpg/preview?points=0", status: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.status, rr.Code, rr.Body.String())
+			if tc.status == http.StatusOK {
+				assert.Equal(t, tc.contentType, rr.Header().Get("Content-Type"))
+				assert.Equal(t, "inline", rr.Header().Get("Content-Disposition"))
+				assert.Equal(t, tc.kind, rr.Header().Get(PreviewKindHeader))
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/attachments/photo.jpg/preview?size=256&points=50", nil))
+	assert.Equal(t, 256, previews.options.Size)
+	assert.Equal(t, 50, previews.options.Points)
+}
+
+func TestPreviewAttachment_Disabled(t *testing.T) {
+	handler := NewAttachmentHandler(logger.NewLogger(), &mockAttachmentService{}, nil, nil)
+	r := chi.NewRouter()
+	r.Get("/attachments/{attachment_id}/preview", handler.PreviewAttachment)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/attachments/photo.jpg/preview", nil))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
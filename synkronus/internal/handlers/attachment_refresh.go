@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+)
+
+// RefreshDownloadURLs handles POST /attachments/manifest/refresh. Clients working through
+// a long download queue renew the signed URLs of a manifest before they expire, without
+// requesting the manifest again.
+func (h *AttachmentHandler) RefreshDownloadURLs(w http.ResponseWriter, r *http.Request) {
+	if h.manifest == nil {
+		SendErrorResponse(w, http.StatusServiceUnavailable, nil, "Attachment manifests are not available")
+		return
+	}
+
+	var req attachment.RefreshURLsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.ClientID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "client_id is required")
+		return
+	}
+	if len(req.AttachmentIDs) == 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "attachment_ids is required")
+		return
+	}
+	if len(req.AttachmentIDs) > attachment.MaxRefreshURLs {
+		SendErrorResponse(w, http.StatusBadRequest, nil, fmt.Sprintf("attachment_ids may hold at most %d IDs", attachment.MaxRefreshURLs))
+		return
+	}
+
+	response, err := h.manifest.RefreshDownloadURLs(r.Context(), req)
+	if err != nil {
+		h.log.Error("Failed to refresh attachment download URLs", "error", err, "clientId", req.ClientID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to refresh download URLs")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshDownloadURLs(t *testing.T) {
+	expiresAt := time.Date(2025, 9, 14, 10, 15, 0, 0, time.UTC)
+	var received attachment.RefreshURLsRequest
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		RefreshURLsFunc: func(ctx context.Context, req attachment.RefreshURLsRequest) (*attachment.RefreshURLsResponse, error) {
+			received = req
+			return &attachment.RefreshURLsResponse{
+				URLs:    []attachment.RefreshedURL{{AttachmentID: "photo.jpg", DownloadURL: "http://localhost:8080/attachments/photo.jpg?signature=abc", URLExpiresAt: &expiresAt}},
+				Missing: []string{"removed.jpg"},
+			}, nil
+		},
+	}
+	handler := NewAttachmentHandler(logger.NewLogger(), &mockAttachmentService{}, manifestSvc, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/attachments/manifest/refresh", strings.NewReader(`{"client_id":"client-1","attachment_ids":["photo.jpg","removed.jpg"]}`))
+	rr := httptest.NewRecorder()
+	handler.RefreshDownloadURLs(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "client-1", received.ClientID)
+	assert.Equal(t, []string{"photo.jpg", "removed.jpg"}, received.AttachmentIDs)
+
+	var response attachment.RefreshURLsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.URLs, 1)
+	assert.True(t, response.URLs[0].URLExpiresAt.Equal(expiresAt))
+	assert.Equal(t, []string{"removed.jpg"}, response.Missing)
+}
+
+func TestRefreshDownloadURLsValidation(t *testing.T) {
+	tooMany, _ := json.Marshal(attachment.RefreshURLsRequest{ClientID: "client-1", AttachmentIDs: make([]string, attachment.MaxRefreshURLs+1)})
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid body", body: `{`},
+		{name: "missing client_id", body: `{"attachment_ids":["photo.jpg"]}`},
+		{name: "no attachment IDs", body: `{"client_id":"client-1"}`},
+		{name: "too many attachment IDs", body: string(tooMany)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAttachmentHandler(logger.NewLogger(), &mockAttachmentService{}, &mocks.MockAttachmentManifestService{}, nil)
+			rr := httptest.NewRecorder()
+			handler.RefreshDownloadURLs(rr, httptest.NewRequest(http.MethodPost, "/attachments/manifest/refresh", strings.NewReader(tt.body)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
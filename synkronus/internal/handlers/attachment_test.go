@@ -3,6 +3,8 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"mime/multipart"
@@ -12,6 +14,8 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
 	"github.com/opendataensemble/synkronus/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,9 +25,18 @@ type mockAttachmentService struct {
 	mock.Mock
 }
 
-func (m *mockAttachmentService) Save(ctx context.Context, attachmentID string, file io.Reader) error {
-	args := m.Called(ctx, attachmentID, file)
-	return args.Error(0)
+func (m *mockAttachmentService) Save(ctx context.Context, attachmentID string, file io.Reader, policy attachment.OverwritePolicy) (*attachment.SaveResult, error) {
+	args := m.Called(ctx, attachmentID, file, policy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*attachment.SaveResult), args.Error(1)
+}
+
+// savedResult is the result of saving content as a new attachment
+func savedResult(content string) *attachment.SaveResult {
+	sum := sha256.Sum256([]byte(content))
+	return &attachment.SaveResult{Outcome: attachment.OutcomeCreated, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))}
 }
 
 func (m *mockAttachmentService) Get(ctx context.Context, attachmentID string) (io.ReadCloser, error) {
@@ -39,10 +52,31 @@ func (m *mockAttachmentService) Exists(ctx context.Context, attachmentID string)
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *mockAttachmentService) SaveVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string, content io.Reader) (*attachment.SaveResult, error) {
+	args := m.Called(ctx, attachmentID, variant, sourceSHA256, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*attachment.SaveResult), args.Error(1)
+}
+
+func (m *mockAttachmentService) GetVariant(ctx context.Context, attachmentID, variant string) (io.ReadCloser, error) {
+	args := m.Called(ctx, attachmentID, variant)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
+func (m *mockAttachmentService) PromoteVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string) error {
+	return m.Called(ctx, attachmentID, variant, sourceSHA256).Error(0)
+}
+
 func TestAttachmentHandler_UploadAttachment(t *testing.T) {
 	tests := []struct {
 		name           string
 		attachmentID   string
+		policy         string
 		setupMocks     func(*mockAttachmentService)
 		expectedStatus int
 		expectedBody   string
@@ -51,22 +85,52 @@ func TestAttachmentHandler_UploadAttachment(t *testing.T) {
 			name:         "successful upload",
 			attachmentID: "testfile.txt",
 			setupMocks: func(mas *mockAttachmentService) {
-				mas.On("Save", mock.Anything, "testfile.txt", mock.Anything).
-					Return(nil)
+				mas.On("Save", mock.Anything, "testfile.txt", mock.Anything, attachment.OverwritePolicy("")).
+					Return(savedResult("test content"), nil)
 			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   `{"status":"success"}`,
+			expectedBody:   `{"status":"success", "outcome":"created", "sha256":"6ae8a75555209fd6c44157c0aed8016e763ff435a19cf186f76863140143ff72"}`,
 		},
 		{
 			name:         "file already exists",
 			attachmentID: "existing.txt",
 			setupMocks: func(mas *mockAttachmentService) {
-				mas.On("Save", mock.Anything, "existing.txt", mock.Anything).
-					Return(os.ErrExist)
+				mas.On("Save", mock.Anything, "existing.txt", mock.Anything, mock.Anything).
+					Return(nil, os.ErrExist)
 			},
 			expectedStatus: http.StatusConflict,
 			expectedBody:   `{"error":"file already exists", "message":"Attachment already exists"}`,
 		},
+		{
+			name:         "identical upload accepted",
+			attachmentID: "existing.txt",
+			policy:       "idempotent",
+			setupMocks: func(mas *mockAttachmentService) {
+				result := savedResult("test content")
+				result.Outcome = attachment.OutcomeUnchanged
+				mas.On("Save", mock.Anything, "existing.txt", mock.Anything, attachment.PolicyIdempotent).
+					Return(result, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:         "different upload refused",
+			attachmentID: "existing.txt",
+			policy:       "idempotent",
+			setupMocks: func(mas *mockAttachmentService) {
+				mas.On("Save", mock.Anything, "existing.txt", mock.Anything, attachment.PolicyIdempotent).
+					Return(nil, attachment.ErrContentConflict)
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"file already exists with different content", "message":"Attachment already exists with different content"}`,
+		},
+		{
+			name:           "unknown policy",
+			attachmentID:   "existing.txt",
+			policy:         "clobber",
+			setupMocks:     func(mas *mockAttachmentService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tc := range tests {
@@ -76,7 +140,7 @@ func TestAttachmentHandler_UploadAttachment(t *testing.T) {
 			tc.setupMocks(mockSvc)
 
 			// Create handler with mock service
-			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc)
+			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, nil, nil)
 
 			// Create a test file
 			var b bytes.Buffer
@@ -88,6 +152,9 @@ func TestAttachmentHandler_UploadAttachment(t *testing.T) {
 			// Create request
 			req := httptest.NewRequest("PUT", "/attachments/"+tc.attachmentID, &b)
 			req.Header.Set("Content-Type", w.FormDataContentType())
+			if tc.policy != "" {
+				req.Header.Set(OverwritePolicyHeader, tc.policy)
+			}
 
 			// Create response recorder
 			rr := httptest.NewRecorder()
@@ -120,6 +187,7 @@ func TestAttachmentHandler_DownloadAttachment(t *testing.T) {
 			setupMocks: func(mas *mockAttachmentService) {
 				mas.On("Exists", mock.Anything, "testfile.txt").
 					Return(true, nil)
+				mas.On("GetVariant", mock.Anything, "testfile.txt", attachment.VariantWeb).Return(nil, os.ErrNotExist)
 				mas.On("Get", mock.Anything, "testfile.txt").
 					Return(io.NopCloser(bytes.NewBufferString("file content")), nil)
 			},
@@ -144,7 +212,7 @@ func TestAttachmentHandler_DownloadAttachment(t *testing.T) {
 			tc.setupMocks(mockSvc)
 
 			// Create handler with mock service
-			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc)
+			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, nil, nil)
 
 			// Create request
 			req := httptest.NewRequest("GET", "/attachments/"+tc.attachmentID, nil)
@@ -200,7 +268,7 @@ func TestAttachmentHandler_CheckAttachment(t *testing.T) {
 			tc.setupMocks(mockSvc)
 
 			// Create handler with mock service
-			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc)
+			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, nil, nil)
 
 			// Create request
 			req := httptest.NewRequest("HEAD", "/attachments/"+tc.attachmentID, nil)
@@ -230,9 +298,10 @@ func TestDownloadAttachment_StreamingErrorLogged(t *testing.T) {
 
 	mockSvc := &mockAttachmentService{}
 	mockSvc.On("Exists", mock.Anything, "badfile").Return(true, nil)
+	mockSvc.On("GetVariant", mock.Anything, "badfile", attachment.VariantWeb).Return(nil, os.ErrNotExist)
 	mockSvc.On("Get", mock.Anything, "badfile").Return(io.NopCloser(errReader{}), nil)
 
-	handler := NewAttachmentHandler(log, mockSvc)
+	handler := NewAttachmentHandler(log, mockSvc, nil, nil)
 
 	req := httptest.NewRequest("GET", "/attachments/badfile", nil)
 	rr := httptest.NewRecorder()
@@ -243,3 +312,289 @@ func TestDownloadAttachment_StreamingErrorLogged(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, buf.String(), "Failed to stream attachment")
 }
+
+// seekableFile is an opened file for ServeContent
+type seekableFile struct{ *bytes.Reader }
+
+func (seekableFile) Close() error { return nil }
+
+func TestDownloadAttachment_TranscodedVariant(t *testing.T) {
+	mockSvc := &mockAttachmentService{}
+	mockSvc.On("Exists", mock.Anything, "clip.mov").Return(true, nil)
+	mockSvc.On("GetVariant", mock.Anything, "clip.mov", attachment.VariantWeb).
+		Return(seekableFile{bytes.NewReader([]byte("mp4 video bytes"))}, nil)
+	mockSvc.On("Get", mock.Anything, "clip.mov").Return(io.NopCloser(bytes.NewReader([]byte("raw video"))), nil)
+
+	handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, nil, nil)
+	r := chi.NewRouter()
+	r.Get("/attachments/{attachment_id}", handler.DownloadAttachment)
+	download := func(target, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The transcoded video is served by default and can be streamed in ranges
+	rr := download("/attachments/clip.mov", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "mp4 video bytes", rr.Body.String())
+	assert.Equal(t, "video/mp4", rr.Header().Get("Content-Type"))
+	assert.Equal(t, attachment.VariantWeb, rr.Header().Get(AttachmentVariantHeader))
+
+	rr = download("/attachments/clip.mov", "bytes=0-2")
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "mp4", rr.Body.String())
+
+	rr = download("/attachments/clip.mov?variant=original", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "raw video", rr.Body.String())
+	assert.Equal(t, "original", rr.Header().Get(AttachmentVariantHeader))
+
+	assert.Equal(t, http.StatusBadRequest, download("/attachments/clip.mov?variant=thumbnail", "").Code)
+}
+
+func TestUploadAttachment_RecordsManifestOperation(t *testing.T) {
+	mockSvc := &mockAttachmentService{}
+	mockSvc.On("Save", mock.Anything, "photo.jpg", mock.Anything, mock.Anything).Return(savedResult("jpeg bytes"), nil)
+
+	var recorded []string
+	var recordedSize int
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		RecordOperationFunc: func(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error {
+			recorded = append(recorded, attachmentID+":"+operation+":"+clientID)
+			if size != nil {
+				recordedSize = *size
+			}
+			return errors.New("manifest unavailable")
+		},
+	}
+	handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	part, _ := w.CreateFormFile("file", "photo.jpg")
+	part.Write([]byte("jpeg bytes"))
+	w.Close()
+
+	req := httptest.NewRequest("PUT", "/attachments/photo.jpg", &b)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rr := httptest.NewRecorder()
+	r := chi.NewRouter()
+	r.Put("/attachments/{attachment_id}", handler.UploadAttachment)
+	r.ServeHTTP(rr, req)
+
+	// A manifest failure is logged but does not fail the upload
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"photo.jpg:create:"}, recorded)
+	assert.Equal(t, len("jpeg bytes"), recordedSize)
+}
+
+func TestUploadAttachment_ReplacedRecordsUpdate(t *testing.T) {
+	result := savedResult("new bytes")
+	result.Outcome = attachment.OutcomeReplaced
+	mockSvc := &mockAttachmentService{}
+	mockSvc.On("Save", mock.Anything, "photo.jpg", mock.Anything, attachment.PolicyOverwrite).Return(result, nil)
+
+	var recorded []string
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		RecordOperationFunc: func(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error {
+			recorded = append(recorded, attachmentID+":"+operation)
+			return nil
+		},
+	}
+	handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	part, _ := w.CreateFormFile("file", "photo.jpg")
+	part.Write([]byte("new bytes"))
+	w.Close()
+
+	req := httptest.NewRequest("PUT", "/attachments/photo.jpg", &b)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set(OverwritePolicyHeader, "overwrite")
+	rr := httptest.NewRecorder()
+	r := chi.NewRouter()
+	r.Put("/attachments/{attachment_id}", handler.UploadAttachment)
+	r.ServeHTTP(rr, req)
+
+	// Clients that already downloaded the attachment download the new content
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"outcome":"replaced"`)
+	assert.Equal(t, []string{"photo.jpg:update"}, recorded)
+}
+
+func TestDownloadAttachment_SignedURL(t *testing.T) {
+	// denyAll stands in for the token middleware
+	denyAll := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		verifyErr      error
+		expectedStatus int
+		expectAudit    bool
+	}{
+		{
+			name:           "valid signature bypasses token auth",
+			query:          "?expires=9999999999&client_id=c1&signature=good",
+			expectedStatus: http.StatusOK,
+			expectAudit:    true,
+		},
+		{
+			name:           "expired signature is rejected",
+			query:          "?expires=1&client_id=c1&signature=good",
+			verifyErr:      attachment.ErrSignatureExpired,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "no signature falls through to auth",
+			query:          "",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mockAttachmentService{}
+			mockSvc.On("Exists", mock.Anything, "photo.jpg").Return(true, nil)
+			mockSvc.On("GetVariant", mock.Anything, "photo.jpg", attachment.VariantWeb).Return(nil, os.ErrNotExist)
+			mockSvc.On("Get", mock.Anything, "photo.jpg").Return(io.NopCloser(bytes.NewReader([]byte("data"))), nil)
+
+			var recorded []attachment.DownloadEvent
+			manifestSvc := &mocks.MockAttachmentManifestService{
+				VerifyDownloadURLFunc: func(attachmentID, clientID, expires, signature string) error {
+					assert.Equal(t, "photo.jpg", attachmentID)
+					assert.Equal(t, "c1", clientID)
+					return tc.verifyErr
+				},
+				RecordDownloadFunc: func(ctx context.Context, event attachment.DownloadEvent) error {
+					recorded = append(recorded, event)
+					return nil
+				},
+			}
+
+			handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+			r := chi.NewRouter()
+			handler.RegisterRoutes(r, func(w http.ResponseWriter, r *http.Request) {}, denyAll, denyAll)
+
+			req := httptest.NewRequest("GET", "/attachments/photo.jpg"+tc.query, nil)
+			req.RemoteAddr = "10.0.0.7:52100"
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectAudit {
+				if assert.Len(t, recorded, 1) {
+					assert.Equal(t, "photo.jpg", recorded[0].AttachmentID)
+					assert.Equal(t, "c1", recorded[0].ClientID)
+					assert.Equal(t, "10.0.0.7", recorded[0].IPAddress)
+					assert.True(t, recorded[0].Signed)
+				}
+			} else {
+				assert.Empty(t, recorded)
+			}
+		})
+	}
+}
+
+func TestUploadAttachment_RecordsMetadata(t *testing.T) {
+	mockSvc := &mockAttachmentService{}
+	mockSvc.On("Save", mock.Anything, "photo.jpg", mock.Anything, mock.Anything).
+		Return(savedResult("jpeg bytes"), nil)
+
+	var recorded attachment.Metadata
+	manifestSvc := &mocks.MockAttachmentManifestService{
+		RecordMetadataFunc: func(ctx context.Context, meta attachment.Metadata) error {
+			recorded = meta
+			return nil
+		},
+	}
+	handler := NewAttachmentHandler(logger.NewLogger(), mockSvc, manifestSvc, nil)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	part, _ := w.CreateFormFile("file", "photo.jpg")
+	part.Write([]byte("jpeg bytes"))
+	w.Close()
+
+	req := httptest.NewRequest("PUT", "/attachments/photo.jpg", &b)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rr := httptest.NewRecorder()
+	r := chi.NewRouter()
+	r.Put("/attachments/{attachment_id}", handler.UploadAttachment)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "photo.jpg", recorded.AttachmentID)
+	assert.Equal(t, int64(len("jpeg bytes")), recorded.Size)
+	if assert.NotNil(t, recorded.SHA256) {
+		sum := sha256.Sum256([]byte("jpeg bytes"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), *recorded.SHA256)
+	}
+}
+
+func TestGetAttachmentMetadata(t *testing.T) {
+	contentType := "image/jpeg"
+	tests := []struct {
+		name           string
+		getMetadata    func(ctx context.Context, attachmentID string) (*attachment.Metadata, error)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "found",
+			getMetadata: func(ctx context.Context, attachmentID string) (*attachment.Metadata, error) {
+				return &attachment.Metadata{
+					AttachmentID: attachmentID,
+					Size:         10,
+					ContentType:  &contentType,
+					ScanStatus:   attachment.ScanStatusNotScanned,
+					Observations: []string{"obs-1"},
+				}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"observations":["obs-1"]`,
+		},
+		{
+			name: "not found",
+			getMetadata: func(ctx context.Context, attachmentID string) (*attachment.Metadata, error) {
+				return nil, attachment.ErrMetadataNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Attachment metadata not found",
+		},
+		{
+			name: "database error",
+			getMetadata: func(ctx context.Context, attachmentID string) (*attachment.Metadata, error) {
+				return nil, errors.New("connection refused")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Failed to get attachment metadata",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			manifestSvc := &mocks.MockAttachmentManifestService{GetMetadataFunc: tc.getMetadata}
+			handler := NewAttachmentHandler(logger.NewLogger(), &mockAttachmentService{}, manifestSvc, nil)
+
+			req := httptest.NewRequest("GET", "/attachments/photo.jpg/meta", nil)
+			rr := httptest.NewRecorder()
+			r := chi.NewRouter()
+			r.Get("/attachments/{attachment_id}/meta", handler.GetAttachmentMetadata)
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tc.expectedBody)
+		})
+	}
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
-	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
 	"github.com/opendataensemble/synkronus/pkg/user"
 )
 
@@ -13,12 +16,19 @@ import (
 type LoginRequest struct {
 	Username string `json:"username"` // Using 'username' as per memory requirements
 	Password string `json:"password"`
+	// DeviceName labels the session in the user's session list; optional
+	DeviceName string `json:"deviceName,omitempty"`
+	// PayloadKey is the client's base64 X25519 public key, sent to negotiate a payload
+	// encryption key; ignored when payload encryption is off
+	PayloadKey string `json:"payloadKey,omitempty"`
 }
 
 // RegisterRequest represents the self-registration request payload
 type RegisterRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	InviteToken string `json:"inviteToken"` // Token from an admin-issued invitation
+	DeviceName  string `json:"deviceName,omitempty"`
 }
 
 // RegisterResponse represents the self-registration response
@@ -35,6 +45,8 @@ type LoginResponse struct {
 	Token        string `json:"token"`
 	RefreshToken string `json:"refreshToken"`
 	ExpiresAt    int64  `json:"expiresAt"`
+	// PayloadKey is the server's half of the payload key negotiation, when requested
+	PayloadKey *payloadcrypto.Negotiation `json:"payloadKey,omitempty"`
 }
 
 // Login handles the /auth/login endpoint
@@ -69,25 +81,30 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.authService.GenerateToken(user)
-	if err != nil {
-		h.log.Error("Failed to generate token", "error", err)
-		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to generate token")
-		return
+	// Negotiate a payload key when the client asks for one and the server encrypts payloads
+	var payloadKey *payloadcrypto.Negotiation
+	if req.PayloadKey != "" && h.payloadCryptoService.Mode() != payloadcrypto.ModeOff {
+		var ok bool
+		if payloadKey, ok = h.negotiatePayloadKey(w, r, user.Username, req.PayloadKey); !ok {
+			return
+		}
 	}
 
-	// Generate refresh token
-	refreshToken, err := h.authService.GenerateRefreshToken(user)
+	// Start a session for this device and generate its tokens
+	token, refreshToken, err := h.authService.StartSession(r.Context(), user, clientInfo(r, req.DeviceName))
 	if err != nil {
-		h.log.Error("Failed to generate refresh token", "error", err)
-		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to generate refresh token")
+		h.log.Error("Failed to generate token", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to generate token")
 		return
 	}
 
 	// Calculate token expiration
 	expiresAt := time.Now().Add(h.authService.Config().TokenExpiration).Unix()
 
+	if !h.setSessionCookies(w, r, token, refreshToken) {
+		return
+	}
+
 	h.log.Info("User logged in successfully", "username", req.Username)
 
 	// Send response
@@ -95,9 +112,26 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		Token:        token,
 		RefreshToken: refreshToken,
 		ExpiresAt:    expiresAt,
+		PayloadKey:   payloadKey,
 	})
 }
 
+// setSessionCookies sets the tokens of a portal login as cookies when cookie sessions are
+// enabled and the request came through the /api routes. It reports whether the response
+// may go on.
+func (h *Handler) setSessionCookies(w http.ResponseWriter, r *http.Request, token, refreshToken string) bool {
+	config := h.authService.Config()
+	if !authmw.PortalCookies(config, r) {
+		return true
+	}
+	if err := authmw.SetSessionCookies(w, config, token, refreshToken); err != nil {
+		h.log.Error("Failed to set session cookies", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to start cookie session")
+		return false
+	}
+	return true
+}
+
 // RefreshRequest represents the token refresh request payload
 type RefreshRequest struct {
 	RefreshToken string `json:"refreshToken"`
@@ -107,13 +141,24 @@ type RefreshRequest struct {
 func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req RefreshRequest
 
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// Decode request body; portal cookie sessions may send none
+	cookie := authmw.SessionCookie(h.authService.Config(), r, authmw.RefreshCookieName)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && (cookie == "" || !errors.Is(err, io.EOF)) {
 		h.log.Error("Failed to decode refresh token request", "error", err)
 		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
 		return
 	}
 
+	// Fall back to the refresh token cookie of a portal cookie session
+	if req.RefreshToken == "" && cookie != "" {
+		if !authmw.CheckCSRF(r) {
+			h.log.Warn("Missing or invalid CSRF token in refresh request")
+			SendErrorResponse(w, http.StatusForbidden, nil, "Missing or invalid CSRF token")
+			return
+		}
+		req.RefreshToken = cookie
+	}
+
 	// Validate request fields
 	if req.RefreshToken == "" {
 		h.log.Warn("Missing refresh token in request")
@@ -122,7 +167,7 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Refresh token
-	token, refreshToken, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
+	token, refreshToken, err := h.authService.RefreshToken(r.Context(), req.RefreshToken, clientInfo(r, ""))
 	if err != nil {
 		h.log.Error("Failed to refresh token", "error", err)
 		SendErrorResponse(w, http.StatusUnauthorized, err, "Invalid refresh token")
@@ -132,6 +177,10 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	// Calculate token expiration
 	expiresAt := time.Now().Add(h.authService.Config().TokenExpiration).Unix()
 
+	if !h.setSessionCookies(w, r, token, refreshToken) {
+		return
+	}
+
 	h.log.Info("Token refreshed successfully")
 
 	// Send response
@@ -143,8 +192,8 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 }
 
 // Register handles the /auth/register endpoint (public — no auth required)
-// It creates a new user with read-write role and returns a JWT token so
-// the client is immediately logged in after registration.
+// It redeems an admin-issued invitation, creates a user with the invitation's
+// role and returns a JWT token so the client is immediately logged in after registration.
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 
@@ -174,9 +223,18 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create user with read-write role (standard app user)
-	newUser, err := h.userService.CreateUser(r.Context(), req.Username, req.Password, models.RoleReadWrite)
+	if req.InviteToken == "" {
+		SendErrorResponse(w, http.StatusForbidden, nil, "Registration requires an invitation")
+		return
+	}
+
+	// Create user with the role assigned by the invitation
+	newUser, err := h.userService.RegisterWithInvitation(r.Context(), req.InviteToken, req.Username, req.Password)
 	if err != nil {
+		if errors.Is(err, user.ErrInvalidInvitation) {
+			SendErrorResponse(w, http.StatusForbidden, err, "Invitation is invalid, expired or already used")
+			return
+		}
 		if err == user.ErrUserExists {
 			SendErrorResponse(w, http.StatusConflict, err, "Username already taken")
 			return
@@ -186,23 +244,20 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token so the user is immediately logged in
-	token, err := h.authService.GenerateToken(newUser)
+	// Start a session so the user is immediately logged in
+	token, refreshToken, err := h.authService.StartSession(r.Context(), newUser, clientInfo(r, req.DeviceName))
 	if err != nil {
 		h.log.Error("Failed to generate token after registration", "error", err)
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Registration succeeded but login failed")
 		return
 	}
 
-	refreshToken, err := h.authService.GenerateRefreshToken(newUser)
-	if err != nil {
-		h.log.Error("Failed to generate refresh token after registration", "error", err)
-		SendErrorResponse(w, http.StatusInternalServerError, err, "Registration succeeded but login failed")
+	expiresAt := time.Now().Add(h.authService.Config().TokenExpiration).Unix()
+
+	if !h.setSessionCookies(w, r, token, refreshToken) {
 		return
 	}
 
-	expiresAt := time.Now().Add(h.authService.Config().TokenExpiration).Unix()
-
 	h.log.Info("User registered successfully", "username", req.Username)
 
 	SendJSONResponse(w, http.StatusCreated, RegisterResponse{
@@ -213,3 +268,71 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		Role:         string(newUser.Role),
 	})
 }
+
+// ForgotPasswordRequest represents the password reset request payload
+type ForgotPasswordRequest struct {
+	Identifier string `json:"identifier"` // Username or email address
+}
+
+// ResetPasswordWithTokenRequest represents the payload setting a new password with an emailed token
+type ResetPasswordWithTokenRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ForgotPassword handles the /auth/forgot-password endpoint
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+	if req.Identifier == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Username or email is required")
+		return
+	}
+
+	if err := h.userService.RequestPasswordReset(r.Context(), req.Identifier); err != nil {
+		if errors.Is(err, user.ErrPasswordResetDisabled) {
+			SendErrorResponse(w, http.StatusServiceUnavailable, err, "Password reset by email is not available; ask an administrator")
+			return
+		}
+		h.log.Error("Failed to request password reset", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to request password reset")
+		return
+	}
+
+	// The same answer whether or not the account exists
+	SendJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "If the account exists and has an email address, a password reset link has been sent",
+	})
+}
+
+// ResetPasswordWithToken handles the /auth/reset-password endpoint
+func (h *Handler) ResetPasswordWithToken(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordWithTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Missing required fields")
+		return
+	}
+	if len(req.NewPassword) < 6 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Password must be at least 6 characters")
+		return
+	}
+
+	if err := h.userService.ResetPasswordWithToken(r.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, user.ErrInvalidResetToken) {
+			SendErrorResponse(w, http.StatusBadRequest, err, "Reset link is invalid, expired or already used")
+			return
+		}
+		h.log.Error("Failed to reset password with token", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to reset password")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Password reset successfully"})
+}
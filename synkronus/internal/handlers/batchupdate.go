@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/batchupdate"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// BatchUpdateRequest is a batch update with the choice to only preview it
+type BatchUpdateRequest struct {
+	batchupdate.Request
+	// DryRun reports what would change without changing anything
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BatchUpdateJobsResponse lists batch update jobs
+type BatchUpdateJobsResponse struct {
+	Jobs []batchupdate.Job `json:"jobs"`
+}
+
+// BatchUpdateObservations handles POST /observations/batch-update
+// @Summary Update the data of matching observations in bulk
+// @Description Applies a field set or a JSON Patch to the data of every observation of form_type for which the where predicate is true, e.g. to fix a systematically mis-coded option value. With dry_run the changes are only previewed; otherwise the update runs as a background job whose progress is reported by GET /observations/batch-update/{id}. Changed observations get new sync versions and an audit entry each.
+// @Tags Observations
+// @Accept json
+// @Produce json
+// @Param body body BatchUpdateRequest true "Batch update"
+// @Success 200 {object} batchupdate.Preview "Dry run"
+// @Success 202 {object} batchupdate.Job "Job started"
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/batch-update [post]
+func (h *Handler) BatchUpdateObservations(w http.ResponseWriter, r *http.Request) {
+	var req BatchUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+
+	if req.DryRun {
+		preview, err := h.batchUpdateService.Preview(r.Context(), req.Request)
+		if err != nil {
+			h.sendBatchUpdateError(w, err, "Failed to preview batch update")
+			return
+		}
+		SendJSONResponse(w, http.StatusOK, preview)
+		return
+	}
+
+	requestedBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		requestedBy = currentUser.Username
+	}
+	job, err := h.batchUpdateService.Submit(r.Context(), req.Request, requestedBy)
+	if err != nil {
+		h.sendBatchUpdateError(w, err, "Failed to start batch update")
+		return
+	}
+	SendJSONResponse(w, http.StatusAccepted, job)
+}
+
+// sendBatchUpdateError answers invalid requests with 400 and other errors with 500
+func (h *Handler) sendBatchUpdateError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, batchupdate.ErrInvalidRequest) {
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+	h.log.Error(message, "error", err)
+	SendErrorResponse(w, http.StatusInternalServerError, err, message)
+}
+
+// GetBatchUpdate handles GET /observations/batch-update/{id}
+// @Summary Get a batch update job
+// @Description Reports the status and progress of a batch update job
+// @Tags Observations
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} batchupdate.Job
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/batch-update/{id} [get]
+func (h *Handler) GetBatchUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid job ID")
+		return
+	}
+
+	job, err := h.batchUpdateService.GetJob(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, batchupdate.ErrJobNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Batch update job not found")
+			return
+		}
+		h.log.Error("Failed to get batch update job", "error", err, "id", id)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get batch update job")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, job)
+}
+
+// ListBatchUpdates handles GET /observations/batch-update
+// @Summary List batch update jobs
+// @Description Lists the most recent batch update jobs, newest first
+// @Tags Observations
+// @Produce json
+// @Param limit query int false "Maximum number of jobs (default 50, max 500)"
+// @Success 200 {object} BatchUpdateJobsResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/batch-update [get]
+func (h *Handler) ListBatchUpdates(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	jobs, err := h.batchUpdateService.ListJobs(r.Context(), limit)
+	if err != nil {
+		h.log.Error("Failed to list batch update jobs", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list batch update jobs")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, BatchUpdateJobsResponse{Jobs: jobs})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/batchupdate"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+func TestHandler_BatchUpdateObservations(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectPreview  bool
+	}{
+		{
+			name:           "dry run",
+			body:           `{"form_type":"household","where":"water_source == 'bore hole'","set":{"water_source":"borehole"},"dry_run":true}`,
+			expectedStatus: http.StatusOK,
+			expectPreview:  true,
+		},
+		{
+			name:           "submit",
+			body:           `{"form_type":"household","set":{"water_source":"borehole"},"reason":"fix"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "invalid request",
+			body:           `{"form_type":"household"}`,
+			serviceErr:     fmt.Errorf("%w: exactly one of set and patch is required", batchupdate.ErrInvalidRequest),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid json",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "service error",
+			body:           `{"form_type":"household","set":{"a":1},"dry_run":true}`,
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var requestedBy string
+			mockService := mocks.NewMockBatchUpdateService()
+			mockService.PreviewFunc = func(ctx context.Context, req batchupdate.Request) (*batchupdate.Preview, error) {
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &batchupdate.Preview{Scanned: 3, Matched: 2, Changed: 2, Changes: []batchupdate.Change{}}, nil
+			}
+			mockService.SubmitFunc = func(ctx context.Context, req batchupdate.Request, user string) (*batchupdate.Job, error) {
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				requestedBy = user
+				return &batchupdate.Job{ID: 9, Status: batchupdate.StatusQueued, Request: req, RequestedBy: user}, nil
+			}
+			h.batchUpdateService = mockService
+
+			req := httptest.NewRequest(http.MethodPost, "/observations/batch-update", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "admin", Role: models.RoleAdmin}))
+			w := httptest.NewRecorder()
+			h.BatchUpdateObservations(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			switch {
+			case tt.expectPreview:
+				var preview batchupdate.Preview
+				if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if preview.Changed != 2 {
+					t.Errorf("Unexpected preview: %+v", preview)
+				}
+			case tt.expectedStatus == http.StatusAccepted:
+				var job batchupdate.Job
+				if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if job.ID != 9 || job.Request.Reason != "fix" || requestedBy != "admin" {
+					t.Errorf("Unexpected job: %+v", job)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_GetBatchUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{"found", "9", http.StatusOK},
+		{"not found", "10", http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+			mockService := mocks.NewMockBatchUpdateService()
+			mockService.GetJobFunc = func(ctx context.Context, id int64) (*batchupdate.Job, error) {
+				if id != 9 {
+					return nil, batchupdate.ErrJobNotFound
+				}
+				return &batchupdate.Job{ID: 9, Status: batchupdate.StatusRunning, Scanned: 500}, nil
+			}
+			h.batchUpdateService = mockService
+
+			req := httptest.NewRequest(http.MethodGet, "/observations/batch-update/"+tt.id, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			h.GetBatchUpdate(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_ListBatchUpdates(t *testing.T) {
+	h, _ := createTestHandler()
+
+	var receivedLimit int
+	mockService := mocks.NewMockBatchUpdateService()
+	mockService.ListJobsFunc = func(ctx context.Context, limit int) ([]batchupdate.Job, error) {
+		receivedLimit = limit
+		return []batchupdate.Job{{ID: 2}, {ID: 1}}, nil
+	}
+	h.batchUpdateService = mockService
+
+	w := httptest.NewRecorder()
+	h.ListBatchUpdates(w, httptest.NewRequest(http.MethodGet, "/observations/batch-update?limit=10", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response BatchUpdateJobsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if receivedLimit != 10 || len(response.Jobs) != 2 {
+		t.Errorf("Unexpected response for limit %d: %+v", receivedLimit, response)
+	}
+
+	w = httptest.NewRecorder()
+	h.ListBatchUpdates(w, httptest.NewRequest(http.MethodGet, "/observations/batch-update?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit, got %d", w.Code)
+	}
+}
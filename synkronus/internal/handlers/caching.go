@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Cache-Control policies of app bundle downloads
+const (
+	// cacheRevalidate lets clients keep a download but revalidate it with a conditional GET
+	// before each use, for content that changes when the active version does
+	cacheRevalidate = "no-cache"
+	// cacheImmutable lets clients keep a download for a year without revalidating, for
+	// content pinned to a version
+	cacheImmutable = "max-age=31536000, immutable"
+)
+
+// cacheValidators describe a download for caching and conditional GETs
+type cacheValidators struct {
+	// ETag is the quoted strong ETag of the content
+	ETag string
+	// LastModified is sent when set and compared with If-Modified-Since
+	LastModified time.Time
+	// CacheControl is one of the cache policies, optionally prefixed with public or private
+	CacheControl string
+}
+
+// bundleCacheControl is the Cache-Control of an app bundle download. Downloads pinned to a
+// version never change. Shared caches such as a CDN may only keep them when the requester
+// can't see internal versions, since those must not be served to others.
+func bundleCacheControl(pinned, private bool) string {
+	policy := cacheRevalidate
+	if pinned {
+		policy = cacheImmutable
+	}
+	if private {
+		return "private, " + policy
+	}
+	return "public, " + policy
+}
+
+// fileValidators are the validators of a file served from disk. Its ETag combines the
+// modification time and size, so it changes whenever the file is replaced.
+func fileValidators(info os.FileInfo, cacheControl string) cacheValidators {
+	return cacheValidators{
+		ETag:         fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+		CacheControl: cacheControl,
+	}
+}
+
+// writeCacheHeaders sets the ETag, Last-Modified and Cache-Control headers of a download
+// and answers a GET or HEAD whose cached copy is still current with 304. It reports
+// whether it did, in which case the caller must not write a body. If-None-Match takes
+// precedence over If-Modified-Since, as RFC 9110 requires.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, v cacheValidators) bool {
+	header := w.Header()
+	if v.ETag != "" {
+		header.Set("ETag", v.ETag)
+	}
+	if !v.LastModified.IsZero() {
+		header.Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if v.CacheControl != "" {
+		header.Set("Cache-Control", v.CacheControl)
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	notModified := false
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		notModified = v.ETag != "" && etagMatches(match, v.ETag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !v.LastModified.IsZero() {
+		// HTTP dates have a resolution of one second
+		notModified = !v.LastModified.Truncate(time.Second).After(since)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return notModified
+}
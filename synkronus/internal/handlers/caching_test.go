@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCacheHeaders(t *testing.T) {
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 500, time.UTC)
+	validators := cacheValidators{ETag: `"abc"`, LastModified: modified, CacheControl: cacheRevalidate}
+
+	tests := []struct {
+		name        string
+		method      string
+		header      http.Header
+		notModified bool
+	}{
+		{"unconditional", http.MethodGet, nil, false},
+		{"matching ETag", http.MethodGet, http.Header{"If-None-Match": {`"old", W/"abc"`}}, true},
+		{"stale ETag", http.MethodGet, http.Header{"If-None-Match": {`"old"`}}, false},
+		{"HEAD", http.MethodHead, http.Header{"If-None-Match": {`"abc"`}}, true},
+		{"not modified since", http.MethodGet, http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}}, true},
+		{"modified since", http.MethodGet, http.Header{"If-Modified-Since": {modified.Add(-time.Minute).Format(http.TimeFormat)}}, false},
+		// If-None-Match takes precedence
+		{"stale ETag, not modified since", http.MethodGet, http.Header{
+			"If-None-Match":     {`"old"`},
+			"If-Modified-Since": {modified.Format(http.TimeFormat)},
+		}, false},
+		{"invalid date", http.MethodGet, http.Header{"If-Modified-Since": {"yesterday"}}, false},
+		{"POST", http.MethodPost, http.Header{"If-None-Match": {`"abc"`}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/app-bundle/download-zip", nil)
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			w := httptest.NewRecorder()
+
+			assert.Equal(t, tt.notModified, writeCacheHeaders(w, req, validators))
+			if tt.notModified {
+				assert.Equal(t, http.StatusNotModified, w.Code)
+			}
+			assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+			assert.Equal(t, "Sat, 01 Mar 2025 12:00:00 GMT", w.Header().Get("Last-Modified"))
+			assert.Equal(t, cacheRevalidate, w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestBundleCacheControl(t *testing.T) {
+	assert.Equal(t, "public, no-cache", bundleCacheControl(false, false))
+	assert.Equal(t, "public, max-age=31536000, immutable", bundleCacheControl(true, false))
+	assert.Equal(t, "private, max-age=31536000, immutable", bundleCacheControl(true, true))
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+)
+
+// BackfillCalculations handles POST /calculations/backfill
+// @Summary Recompute calculated fields of stored observations
+// @Description Recomputes the x-calculated fields of stored observations whose form formulas changed in the active app bundle since their last backfill. Changed observations get new sync versions so clients pull the server's values. The server also does this on a schedule; this runs it now.
+// @Tags Calculations
+// @Produce json
+// @Param form_type query string false "Recompute only this form type, even if its formulas are unchanged"
+// @Success 200 {object} calculation.BackfillResult
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /calculations/backfill [post]
+func (h *Handler) BackfillCalculations(w http.ResponseWriter, r *http.Request) {
+	query := calculation.BackfillQuery{FormType: r.URL.Query().Get("form_type")}
+
+	result, err := h.calculationService.Backfill(r.Context(), query)
+	if err != nil {
+		h.log.Error("Failed to backfill calculated fields", "error", err, "formType", query.FormType)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to backfill calculated fields")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, result)
+}
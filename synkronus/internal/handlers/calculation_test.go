@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+)
+
+func TestHandler_BackfillCalculations(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		expectedForm   string
+	}{
+		{
+			name:           "changed formulas",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "single form type",
+			query:          "?form_type=anc_visit",
+			expectedStatus: http.StatusOK,
+			expectedForm:   "anc_visit",
+		},
+		{
+			name:           "service error",
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received calculation.BackfillQuery
+			mockCalculationService := mocks.NewMockCalculationService()
+			mockCalculationService.BackfillFunc = func(ctx context.Context, query calculation.BackfillQuery) (*calculation.BackfillResult, error) {
+				received = query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &calculation.BackfillResult{
+					Forms:          []calculation.FormBackfill{{FormType: "anc_visit", Fingerprint: "abc", Scanned: 10, Updated: 4}},
+					CurrentVersion: 42,
+				}, nil
+			}
+			h.calculationService = mockCalculationService
+
+			w := httptest.NewRecorder()
+			h.BackfillCalculations(w, httptest.NewRequest(http.MethodPost, "/calculations/backfill"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if received.FormType != tt.expectedForm {
+				t.Errorf("Expected form_type %q, got %q", tt.expectedForm, received.FormType)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var result calculation.BackfillResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(result.Forms) != 1 || result.Forms[0].Updated != 4 || result.CurrentVersion != 42 {
+				t.Errorf("Unexpected result: %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// CapabilitiesResponse lists what this deployment supports, so scripts and clients can
+// adapt instead of failing on endpoints it doesn't have
+type CapabilitiesResponse struct {
+	// User is the caller as the server authenticated them
+	User *CapabilitiesUser `json:"user,omitempty"`
+	// Features are the enabled feature flags, as in /version
+	Features []string `json:"features"`
+	// AsyncPush is true when sync pushes are queued and stored after the response; this
+	// server stores them before it answers
+	AsyncPush bool `json:"async_push"`
+	// Channels is true when clients can follow app bundle release channels other than the
+	// active version
+	Channels bool `json:"channels"`
+	// ExportFormats are the formats served under /dataexport
+	ExportFormats []string            `json:"export_formats"`
+	Storage       StorageCapabilities `json:"storage"`
+	Sync          SyncCapabilities    `json:"sync"`
+	// ChangeFeed is the broker observation changes are published to; empty when disabled
+	ChangeFeed string `json:"change_feed,omitempty"`
+}
+
+// CapabilitiesUser is the caller of /capabilities
+type CapabilitiesUser struct {
+	Username string      `json:"username"`
+	Role     models.Role `json:"role"`
+}
+
+// StorageCapabilities describes where attachments and the app bundle are served from
+type StorageCapabilities struct {
+	// Backend stores attachments; always local, the DATA_DIR of the server
+	Backend string `json:"backend"`
+	// Replication is true when uploads are mirrored to ATTACHMENT_REPLICA_PATH
+	Replication bool `json:"replication"`
+	// SignedURLs is true when the attachment manifest issues expiring download URLs
+	SignedURLs bool `json:"signed_urls"`
+	// AppBundleCDN is true when manifest file URLs point at a CDN
+	AppBundleCDN bool `json:"app_bundle_cdn"`
+}
+
+// SyncCapabilities describes how sync pushes and pulls behave
+type SyncCapabilities struct {
+	// ConflictPolicy is SYNC_CONFLICT_POLICY
+	ConflictPolicy string `json:"conflict_policy"`
+	// DataValidation is true when pushed data is checked against the form schemas
+	DataValidation bool `json:"data_validation"`
+	// TombstoneRetentionDays is how long deletes are kept for pulls; 0 keeps them forever
+	TombstoneRetentionDays int `json:"tombstone_retention_days"`
+}
+
+// GetCapabilities handles GET /capabilities
+// @Summary List the capabilities of this server
+// @Description Returns the caller and the features enabled on this deployment: feature flags, async pushes, app bundle channels, export formats, storage and sync behavior.
+// @Tags Version
+// @Produce json
+// @Success 200 {object} CapabilitiesResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /capabilities [get]
+func (h *Handler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	capabilities := CapabilitiesResponse{
+		Features:      h.featureFlagService.Active(ctx),
+		ExportFormats: dataexport.Formats(),
+		Storage:       StorageCapabilities{Backend: "local"},
+	}
+	if capabilities.Features == nil {
+		capabilities.Features = []string{}
+	}
+	if user := authmw.GetUserFromContext(ctx); user != nil {
+		capabilities.User = &CapabilitiesUser{Username: user.Username, Role: user.Role}
+	}
+	if cfg := h.config; cfg != nil {
+		capabilities.Storage.Replication = cfg.AttachmentReplicaPath != ""
+		capabilities.Storage.SignedURLs = cfg.AttachmentURLTTL > 0
+		capabilities.Storage.AppBundleCDN = cfg.CDNPublicURL != ""
+		capabilities.Sync = SyncCapabilities{
+			ConflictPolicy:         cfg.SyncConflictPolicy,
+			DataValidation:         cfg.SyncValidateData,
+			TombstoneRetentionDays: cfg.SyncTombstoneRetentionDays,
+		}
+		capabilities.ChangeFeed = cfg.ChangeFeedBroker
+	}
+	SendJSONResponse(w, http.StatusOK, capabilities)
+}
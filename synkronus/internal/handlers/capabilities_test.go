@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+func TestHandler_GetCapabilities(t *testing.T) {
+	h, _ := createTestHandler()
+	flags := mocks.NewMockFeatureFlagService()
+	flags.Flags["anonymized_export"] = true
+	h.featureFlagService = flags
+	h.config.SyncConflictPolicy = "reject"
+	h.config.SyncValidateData = true
+	h.config.AttachmentReplicaPath = "/mnt/replica"
+	h.config.ChangeFeedBroker = "nats"
+
+	req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+	req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "alice", Role: models.RoleReadWrite}))
+	w := httptest.NewRecorder()
+	h.GetCapabilities(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var capabilities CapabilitiesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &capabilities); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if capabilities.User == nil || capabilities.User.Username != "alice" || capabilities.User.Role != models.RoleReadWrite {
+		t.Errorf("Expected the caller, got %+v", capabilities.User)
+	}
+	if strings.Join(capabilities.Features, ",") != "anonymized_export" {
+		t.Errorf("Expected the enabled flags, got %v", capabilities.Features)
+	}
+	if capabilities.AsyncPush || capabilities.Channels {
+		t.Errorf("Expected no async pushes or channels, got %+v", capabilities)
+	}
+	if !strings.HasPrefix(strings.Join(capabilities.ExportFormats, ","), "parquet,csv,delta,fhir") {
+		t.Errorf("Unexpected export formats %v", capabilities.ExportFormats)
+	}
+	if capabilities.Storage != (StorageCapabilities{Backend: "local", Replication: true}) {
+		t.Errorf("Unexpected storage %+v", capabilities.Storage)
+	}
+	if capabilities.Sync != (SyncCapabilities{ConflictPolicy: "reject", DataValidation: true}) {
+		t.Errorf("Unexpected sync %+v", capabilities.Sync)
+	}
+	if capabilities.ChangeFeed != "nats" {
+		t.Errorf("Expected the change feed broker, got %q", capabilities.ChangeFeed)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+)
+
+// ChangeFeedReplayRequest is the request body for POST /change-feed/replay
+type ChangeFeedReplayRequest struct {
+	FromSeq *int64 `json:"from_seq"`
+	// Consumer replays the changes after the export consumer's last acknowledged version
+	Consumer string `json:"consumer"`
+}
+
+// ChangeFeedReplayResponse reports how many changes will be published again; from_seq is 0
+// when a consumer has no changes to replay
+type ChangeFeedReplayResponse struct {
+	FromSeq  int64 `json:"from_seq"`
+	Requeued int64 `json:"requeued"`
+}
+
+// GetChangeFeedStatus handles GET /change-feed
+// @Summary Get the observation change feed status
+// @Description Returns whether observation changes are published to a broker, how many are waiting, and the last published change
+// @Tags ChangeFeed
+// @Produce json
+// @Success 200 {object} changefeed.Status
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /change-feed [get]
+func (h *Handler) GetChangeFeedStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.changeFeedService.Status(r.Context())
+	if err != nil {
+		h.log.Error("Failed to get change feed status", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get change feed status")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, status)
+}
+
+// ReplayChangeFeed handles POST /change-feed/replay
+// @Summary Replay observation changes
+// @Description Publishes the retained changes from from_seq on again, e.g. after a consumer lost data. Instead of from_seq, pass consumer to replay the changes after an export consumer's last acknowledged version. Consumers see them a second time and should skip seqs they already processed.
+// @Tags ChangeFeed
+// @Accept json
+// @Produce json
+// @Param body body ChangeFeedReplayRequest true "First change to publish again, or the consumer to replay for"
+// @Success 200 {object} ChangeFeedReplayResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export consumer not found"
+// @Failure 409 {object} ErrorResponse "The change feed is disabled"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /change-feed/replay [post]
+func (h *Handler) ReplayChangeFeed(w http.ResponseWriter, r *http.Request) {
+	var req ChangeFeedReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Consumer != "" {
+		if req.FromSeq != nil {
+			SendErrorResponse(w, http.StatusBadRequest, nil, "Use either from_seq or consumer, not both")
+			return
+		}
+		fromSeq, ok := h.consumerReplaySeq(w, r, req.Consumer)
+		if !ok {
+			return
+		}
+		if fromSeq == 0 {
+			SendJSONResponse(w, http.StatusOK, ChangeFeedReplayResponse{})
+			return
+		}
+		req.FromSeq = &fromSeq
+	}
+	if req.FromSeq == nil || *req.FromSeq < 1 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "from_seq must be a positive integer")
+		return
+	}
+
+	requeued, err := h.changeFeedService.Replay(r.Context(), *req.FromSeq)
+	switch {
+	case errors.Is(err, changefeed.ErrDisabled):
+		SendErrorResponse(w, http.StatusConflict, err, "The change feed is not enabled")
+		return
+	case errors.Is(err, changefeed.ErrReplayUnavailable):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to replay change feed", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to replay changes")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, ChangeFeedReplayResponse{FromSeq: *req.FromSeq, Requeued: requeued})
+}
+
+// consumerReplaySeq finds the first change after an export consumer's last acknowledged
+// version, or 0 when there is none. It returns false after sending an error response.
+func (h *Handler) consumerReplaySeq(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	consumer, err := h.exportConsumerService.Get(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, exportconsumer.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export consumer not found")
+			return 0, false
+		}
+		h.log.Error("Failed to get export consumer", "consumer", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get export consumer")
+		return 0, false
+	}
+
+	fromSeq, err := h.changeFeedService.FirstSeqAfterVersion(r.Context(), consumer.AckedVersion)
+	if err != nil {
+		if errors.Is(err, changefeed.ErrReplayUnavailable) {
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+			return 0, false
+		}
+		h.log.Error("Failed to find changes to replay", "consumer", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to replay changes")
+		return 0, false
+	}
+	return fromSeq, true
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeed(t *testing.T) {
+	h, _ := createTestHandler()
+	feed := mocks.NewMockChangeFeedService()
+	h.changeFeedService = feed
+	r := chi.NewRouter()
+	r.Get("/change-feed", h.GetChangeFeedStatus)
+	r.Post("/change-feed/replay", h.ReplayChangeFeed)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	// Disabled until a broker is configured
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/change-feed/replay", `{"from_seq":1}`).Code)
+
+	lastSeq := int64(41)
+	feed.StatusValue = changefeed.Status{Enabled: true, Broker: "nats", Topic: "synkronus.observations", Pending: 3, LastPublishedSeq: &lastSeq, OldestReplayableSeq: 10}
+	w := do(http.MethodGet, "/change-feed", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var status changefeed.Status
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.True(t, status.Enabled)
+	assert.Equal(t, int64(3), status.Pending)
+	assert.Equal(t, int64(10), status.OldestReplayableSeq)
+
+	feed.ReplayFunc = func(ctx context.Context, fromSeq int64) (int64, error) {
+		if fromSeq < 10 {
+			return 0, fmt.Errorf("%w (oldest replayable change is 10)", changefeed.ErrReplayUnavailable)
+		}
+		return 32, nil
+	}
+	w = do(http.MethodPost, "/change-feed/replay", `{"from_seq":10}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ChangeFeedReplayResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ChangeFeedReplayResponse{FromSeq: 10, Requeued: 32}, resp)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/change-feed/replay", `{"from_seq":5}`).Code, "pruned changes")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/change-feed/replay", `{}`).Code, "from_seq is required")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/change-feed/replay", `{"from_seq":0}`).Code)
+	assert.Equal(t, []int64{1, 10, 5}, feed.ReplayedFrom)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/completeness"
+)
+
+// GetCompletenessReport handles GET /reports/completeness
+// @Summary Get a report of observations missing required fields
+// @Description Counts, per form type, client and time window, the stored observations missing fields the active app bundle's form schemas require. A field is missing when it is absent, null or an empty string. Clients enforce required fields, so a high incomplete_percent for some clients points at an app version that bypasses validation. Without form_type, every form with required fields is reported.
+// @Tags Reports
+// @Produce json
+// @Param form_type query string false "Only report this form type"
+// @Param window query string false "Time window observations are grouped by: hour, day (default) or week"
+// @Param from query string false "First creation day to include (YYYY-MM-DD); defaults to 30 days ago"
+// @Param to query string false "Last creation day to include (YYYY-MM-DD)"
+// @Success 200 {object} completeness.Report
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Unknown form type"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /reports/completeness [get]
+func (h *Handler) GetCompletenessReport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := completeness.Query{FormType: params.Get("form_type"), Window: params.Get("window")}
+
+	if query.Window != "" && !completeness.ValidWindow(query.Window) {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "window must be hour, day or week")
+		return
+	}
+	if from := params.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		query.From = &day
+	}
+	if to := params.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		// to is inclusive by day
+		end := day.AddDate(0, 0, 1)
+		query.To = &end
+	}
+
+	report, err := h.completenessService.Report(r.Context(), query)
+	switch {
+	case errors.Is(err, completeness.ErrUnknownFormType):
+		SendErrorResponse(w, http.StatusNotFound, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to build completeness report", "error", err, "formType", query.FormType)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to build completeness report")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, report)
+}
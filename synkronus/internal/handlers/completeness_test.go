@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/completeness"
+)
+
+func TestHandler_GetCompletenessReport(t *testing.T) {
+	report := &completeness.Report{
+		BundleVersion: "4",
+		Window:        completeness.WindowDay,
+		Forms: []completeness.FormReport{{
+			FormType:          "household",
+			RequiredFields:    []string{"name"},
+			Total:             4,
+			Incomplete:        1,
+			IncompletePercent: 25,
+			Missing:           map[string]int64{"name": 1},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		check          func(t *testing.T, q completeness.Query, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "report for a form by hour",
+			query:          "?form_type=household&window=hour&from=2025-06-01&to=2025-06-07",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, q completeness.Query, w *httptest.ResponseRecorder) {
+				if q.FormType != "household" || q.Window != completeness.WindowHour {
+					t.Errorf("Unexpected query: %+v", q)
+				}
+				if q.From == nil || q.To == nil || !q.To.Equal(time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("Expected an inclusive day range, got %v..%v", q.From, q.To)
+				}
+				var got completeness.Report
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(got.Forms) != 1 || got.Forms[0].IncompletePercent != 25 || got.Forms[0].Missing["name"] != 1 {
+					t.Errorf("Unexpected forms: %+v", got.Forms)
+				}
+			},
+		},
+		{
+			name:           "defaults",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, q completeness.Query, w *httptest.ResponseRecorder) {
+				if q.FormType != "" || q.Window != "" || q.From != nil || q.To != nil {
+					t.Errorf("Expected an empty query, got %+v", q)
+				}
+			},
+		},
+		{
+			name:           "invalid window",
+			query:          "?window=month",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid date",
+			query:          "?to=tomorrow",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown form type",
+			query:          "?form_type=other",
+			serviceErr:     fmt.Errorf("%w: other", completeness.ErrUnknownFormType),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "service error",
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received completeness.Query
+			mockCompletenessService := mocks.NewMockCompletenessService()
+			mockCompletenessService.ReportFunc = func(ctx context.Context, query completeness.Query) (*completeness.Report, error) {
+				received = query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return report, nil
+			}
+			h.completenessService = mockCompletenessService
+
+			w := httptest.NewRecorder()
+			h.GetCompletenessReport(w, httptest.NewRequest(http.MethodGet, "/reports/completeness"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.check != nil {
+				tt.check(t, received, w)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// CoreIDObservationsResponse is one page of the observations of a core ID
+type CoreIDObservationsResponse struct {
+	CoreID       string             `json:"core_id"`
+	Observations []sync.Observation `json:"observations"`
+	Limit        int                `json:"limit"`
+	Offset       int                `json:"offset"`
+	HasMore      bool               `json:"has_more"`
+}
+
+// GetObservationsByCoreID handles GET /observations/core-id/{core_id}
+// @Summary List the observations of a core ID
+// @Description Lists the observations whose data has this core_id, the participant or household identifier, across form types and oldest first, so all records of a case can be reviewed together. Form types the caller's role may not see are left out.
+// @Tags Observations
+// @Produce json
+// @Param core_id path string true "Core ID"
+// @Param form_type query string false "Only this form type"
+// @Param include_deleted query bool false "Include deleted observations"
+// @Param limit query int false "Maximum number of observations (default 100, max 500)"
+// @Param offset query int false "Number of observations to skip"
+// @Success 200 {object} CoreIDObservationsResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/core-id/{core_id} [get]
+func (h *Handler) GetObservationsByCoreID(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := sync.CoreIDQuery{
+		CoreID:   chi.URLParam(r, "core_id"),
+		FormType: params.Get("form_type"),
+		Limit:    100,
+	}
+	if query.CoreID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "core_id is required")
+		return
+	}
+	if value := params.Get("include_deleted"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "include_deleted must be true or false")
+			return
+		}
+		query.IncludeDeleted = parsed
+	}
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 500")
+			return
+		}
+		query.Limit = parsed
+	}
+	if value := params.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "offset must be a non-negative integer")
+			return
+		}
+		query.Offset = parsed
+	}
+
+	page, err := h.syncService.ListByCoreID(r.Context(), query)
+	if err != nil {
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		h.log.Error("Failed to list observations by core ID", "error", err, "core_id", query.CoreID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list observations")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, CoreIDObservationsResponse{
+		CoreID:       query.CoreID,
+		Observations: page.Observations,
+		Limit:        query.Limit,
+		Offset:       query.Offset,
+		HasMore:      page.HasMore,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+func TestHandler_GetObservationsByCoreID(t *testing.T) {
+	tests := []struct {
+		name           string
+		coreID         string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		check          func(t *testing.T, query sync.CoreIDQuery)
+	}{
+		{
+			name:           "defaults",
+			coreID:         "HH-0042",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, query sync.CoreIDQuery) {
+				if query.CoreID != "HH-0042" || query.FormType != "" || query.IncludeDeleted || query.Limit != 100 || query.Offset != 0 {
+					t.Errorf("Unexpected query: %+v", query)
+				}
+			},
+		},
+		{
+			name:           "filters",
+			coreID:         "HH-0042",
+			query:          "?form_type=visit&include_deleted=true&limit=10&offset=20",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, query sync.CoreIDQuery) {
+				if query.FormType != "visit" || !query.IncludeDeleted || query.Limit != 10 || query.Offset != 20 {
+					t.Errorf("Unexpected query: %+v", query)
+				}
+			},
+		},
+		{name: "missing core ID", expectedStatus: http.StatusBadRequest},
+		{name: "invalid include_deleted", coreID: "HH-0042", query: "?include_deleted=maybe", expectedStatus: http.StatusBadRequest},
+		{name: "limit too large", coreID: "HH-0042", query: "?limit=501", expectedStatus: http.StatusBadRequest},
+		{name: "negative offset", coreID: "HH-0042", query: "?offset=-1", expectedStatus: http.StatusBadRequest},
+		{name: "service error", coreID: "HH-0042", serviceErr: errors.New("db down"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received sync.CoreIDQuery
+			mockSyncService := mocks.NewMockSyncService()
+			mockSyncService.ListByCoreIDFunc = func(ctx context.Context, query sync.CoreIDQuery) (*sync.CoreIDPage, error) {
+				received = query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &sync.CoreIDPage{
+					Observations: []sync.Observation{
+						{ObservationID: "obs-1", FormType: "household", Data: json.RawMessage(`{"core_id":"HH-0042"}`), Version: 3},
+						{ObservationID: "obs-2", FormType: "visit", Data: json.RawMessage(`{"core_id":"HH-0042"}`), Version: 5},
+					},
+					HasMore: true,
+				}, nil
+			}
+			h.syncService = mockSyncService
+
+			req := withTestUser(httptest.NewRequest(http.MethodGet, "/observations/core-id/"+tt.coreID+tt.query, nil), "supervisor", models.RoleReadOnly)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("core_id", tt.coreID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			h.GetObservationsByCoreID(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			tt.check(t, received)
+
+			var response CoreIDObservationsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.CoreID != "HH-0042" || len(response.Observations) != 2 || !response.HasMore || response.Observations[1].FormType != "visit" {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+		})
+	}
+}
+
+func TestPullByCoreID(t *testing.T) {
+	h, _ := createTestHandler()
+	_, err := h.syncService.ProcessPushedRecords(context.Background(), []sync.Observation{
+		{ObservationID: "obs-1", FormType: "household", Data: json.RawMessage(`{"core_id":"HH-0042"}`)},
+		{ObservationID: "obs-2", FormType: "household", Data: json.RawMessage(`{"core_id":"HH-0043"}`)},
+		{ObservationID: "obs-3", FormType: "visit", Data: json.RawMessage(`{"core_id":"HH-0042"}`)},
+	}, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to push records: %v", err)
+	}
+
+	body, _ := json.Marshal(SyncPullRequest{ClientID: "client-2", CoreID: "HH-0042"})
+	req := httptest.NewRequest(http.MethodPost, "/sync/pull", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	h.Pull(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response SyncPullResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Records) != 2 || response.Records[0].ObservationID != "obs-1" || response.Records[1].ObservationID != "obs-3" {
+		t.Errorf("Expected the household and visit of HH-0042, got %+v", response.Records)
+	}
+}
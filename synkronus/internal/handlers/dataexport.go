@@ -1,25 +1,48 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
 )
 
 // ParquetExportHandler handles GET /dataexport/parquet
 // @Summary Download a ZIP archive of Parquet exports
-// @Description Returns a ZIP file containing multiple Parquet files, each representing a flattened export of observations per form type. Supports downloading the entire dataset as separate Parquet files bundled together.
+// @Description Returns a ZIP file containing multiple Parquet files, each representing a flattened export of observations per form type. Supports downloading the entire dataset as separate Parquet files bundled together. Fields tagged x-sensitive are omitted unless the caller is an admin, and for all callers while the anonymized_export feature flag is on.
 // @Tags DataExport
 // @Produce application/zip
+// @Param since_version query integer false "Only export observations changed after this version; form types without changes have no file"
+// @Param since query integer false "Alias of since_version"
+// @Param consumer query string false "Only export observations changed after this consumer's last acknowledged version"
+// @Param form_type query string false "Only export these form types; repeated or comma-separated"
 // @Success 200 {file} binary "ZIP archive stream containing Parquet files"
+// @Header 200 {integer} X-Export-Version "Version to acknowledge once the export is loaded"
+// @Failure 400 {object} ErrorResponse "Invalid since_version or consumer"
 // @Failure 401 {object} ErrorResponse "Unauthorized"
 // @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Security BearerAuth
 // @Router /dataexport/parquet [get]
 func (h *Handler) ParquetExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.exportVersionRange(w, r)
+	if !ok {
+		return
+	}
+	ctx = dataexport.WithFormTypes(ctx, exportFormTypes(r)...)
+	if h.featureFlagService.IsEnabled(ctx, featureflag.AnonymizedExport) {
+		ctx = dataexport.WithAnonymization(ctx)
+	}
+
 	// Export data as parquet ZIP
-	zipReader, err := h.dataExportService.ExportParquetZip(r.Context())
+	zipReader, err := h.dataExportService.ExportParquetZip(ctx)
 	if err != nil {
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to export parquet data")
 		return
 	}
@@ -37,3 +60,208 @@ func (h *Handler) ParquetExportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// exportFormTypes returns the form types of ?form_type=, which may be repeated or
+// comma-separated
+func exportFormTypes(r *http.Request) []string {
+	var formTypes []string
+	for _, value := range r.URL.Query()["form_type"] {
+		for _, formType := range strings.Split(value, ",") {
+			if formType = strings.TrimSpace(formType); formType != "" {
+				formTypes = append(formTypes, formType)
+			}
+		}
+	}
+	return formTypes
+}
+
+// CSVExportHandler handles GET /dataexport/csv
+// @Summary Download a ZIP archive of CSV exports
+// @Description Returns a ZIP file with a CSV file per form type, with a header row and the same flattened columns as the Parquet export, for analysts without Arrow tooling. Null values are empty cells and nested columns hold JSON. Sensitive fields are handled as in the Parquet export.
+// @Tags DataExport
+// @Produce application/zip
+// @Param since query integer false "Only export observations changed after this version"
+// @Param consumer query string false "Only export observations changed after this consumer's last acknowledged version"
+// @Success 200 {file} binary "ZIP archive stream containing CSV files"
+// @Header 200 {integer} X-Export-Version "Version to acknowledge once the export is loaded"
+// @Failure 400 {object} ErrorResponse "Invalid since or consumer"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/csv [get]
+func (h *Handler) CSVExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.exportVersionRange(w, r)
+	if !ok {
+		return
+	}
+	if h.featureFlagService.IsEnabled(ctx, featureflag.AnonymizedExport) {
+		ctx = dataexport.WithAnonymization(ctx)
+	}
+
+	zipReader, err := h.dataExportService.ExportCSVZip(ctx)
+	if err != nil {
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to export CSV data")
+		return
+	}
+	defer zipReader.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"observations_export_csv.zip\"")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, zipReader); err != nil {
+		// Response already started, can't send error response
+		h.log.Error("Failed to stream CSV export", "error", err)
+		return
+	}
+}
+
+// DeltaExportHandler handles GET /dataexport/delta
+// @Summary Download the changes since a version as merge instructions
+// @Description Returns a ZIP file with a {form_type}_changes.parquet file per form type with changes and a delta_manifest.json. Each changes file has the columns of the Parquet export plus an op column: upsert rows insert or replace the observation, delete rows remove it. The manifest lists the files with their upsert and delete counts and a MERGE statement, and the version range the delta takes a base snapshot from and to. Sensitive fields are handled as in the Parquet export.
+// @Tags DataExport
+// @Produce application/zip
+// @Param since query integer false "Only export observations changed after this version"
+// @Param consumer query string false "Only export observations changed after this consumer's last acknowledged version"
+// @Success 200 {file} binary "ZIP archive with changes files and delta_manifest.json"
+// @Header 200 {integer} X-Export-Since "Version the base snapshot must be at"
+// @Header 200 {integer} X-Export-Version "Version to acknowledge once the delta is merged"
+// @Failure 400 {object} ErrorResponse "Invalid since or consumer"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/delta [get]
+func (h *Handler) DeltaExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.exportVersionRange(w, r)
+	if !ok {
+		return
+	}
+	if h.featureFlagService.IsEnabled(ctx, featureflag.AnonymizedExport) {
+		ctx = dataexport.WithAnonymization(ctx)
+	}
+
+	zipReader, err := h.dataExportService.ExportDeltaZip(ctx)
+	if err != nil {
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to export changes")
+		return
+	}
+	defer zipReader.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"observations_delta.zip\"")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, zipReader); err != nil {
+		// Response already started, can't send error response
+		h.log.Error("Failed to stream delta export", "error", err)
+		return
+	}
+}
+
+// FHIRExportHandler handles GET /dataexport/fhir
+// @Summary Download observations as FHIR resources
+// @Description Returns Patient, Observation and QuestionnaireResponse resources as NDJSON, one resource per line. Only form types with a fhir.json mapping file next to their schema.json in the app bundle are exported. Fields tagged x-sensitive are omitted unless the caller is an admin and exports are neither anonymized nor encrypted.
+// @Tags DataExport
+// @Produce application/fhir+ndjson
+// @Param since query integer false "Only export observations changed after this version"
+// @Param consumer query string false "Only export observations changed after this consumer's last acknowledged version"
+// @Success 200 {file} binary "NDJSON stream of FHIR resources"
+// @Header 200 {integer} X-Export-Version "Version to acknowledge once the export is loaded"
+// @Failure 400 {object} ErrorResponse "Invalid since or consumer"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 422 {object} ErrorResponse "A fhir.json mapping in the app bundle is invalid"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/fhir [get]
+func (h *Handler) FHIRExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.exportVersionRange(w, r)
+	if !ok {
+		return
+	}
+	if h.featureFlagService.IsEnabled(ctx, featureflag.AnonymizedExport) {
+		ctx = dataexport.WithAnonymization(ctx)
+	}
+
+	ndjson, err := h.dataExportService.ExportFHIR(ctx)
+	if err != nil {
+		if errors.Is(err, dataexport.ErrInvalidFHIRMapping) {
+			SendErrorResponse(w, http.StatusUnprocessableEntity, err, err.Error())
+			return
+		}
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to export FHIR resources")
+		return
+	}
+	defer ndjson.Close()
+
+	w.Header().Set("Content-Type", "application/fhir+ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"observations_export.ndjson\"")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, ndjson); err != nil {
+		// Response already started, can't send error response
+		h.log.Error("Failed to stream FHIR export", "error", err)
+		return
+	}
+}
+
+// DuckDBExportHandler handles GET /dataexport/duckdb
+// @Summary Download observations as a DuckDB database
+// @Description Returns a single DuckDB database file with one table per form type, with typed columns and indexes on observation_id and created_at. Fields tagged x-sensitive are omitted unless the caller is an admin and exports are neither anonymized nor encrypted. Requires a server built with the duckdb tag.
+// @Tags DataExport
+// @Produce application/octet-stream
+// @Param since query integer false "Only export observations changed after this version"
+// @Param consumer query string false "Only export observations changed after this consumer's last acknowledged version"
+// @Success 200 {file} binary "DuckDB database file"
+// @Header 200 {integer} X-Export-Version "Version to acknowledge once the export is loaded"
+// @Failure 400 {object} ErrorResponse "Invalid since or consumer"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 501 {object} ErrorResponse "Server built without DuckDB support"
+// @Security BearerAuth
+// @Router /dataexport/duckdb [get]
+func (h *Handler) DuckDBExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.exportVersionRange(w, r)
+	if !ok {
+		return
+	}
+	if h.featureFlagService.IsEnabled(ctx, featureflag.AnonymizedExport) {
+		ctx = dataexport.WithAnonymization(ctx)
+	}
+
+	database, err := h.dataExportService.ExportDuckDB(ctx)
+	if err != nil {
+		if errors.Is(err, dataexport.ErrDuckDBUnavailable) {
+			SendErrorResponse(w, http.StatusNotImplemented, err, err.Error())
+			return
+		}
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to export DuckDB database")
+		return
+	}
+	defer database.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"observations_export.duckdb\"")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, database); err != nil {
+		// Response already started, can't send error response
+		h.log.Error("Failed to stream DuckDB export", "error", err)
+		return
+	}
+}
@@ -3,12 +3,18 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
 )
 
 func TestHandler_ParquetExportHandler(t *testing.T) {
@@ -94,6 +100,42 @@ func TestHandler_ParquetExportHandler(t *testing.T) {
 	}
 }
 
+func TestHandler_ParquetExportHandlerIncremental(t *testing.T) {
+	h, _ := createTestHandler()
+	consumers := mocks.NewMockExportConsumerService()
+	consumers.Version = 40
+	h.exportConsumerService = consumers
+
+	var versions dataexport.VersionRange
+	var formTypes []string
+	mockDataExportService := mocks.NewMockDataExportService()
+	mockDataExportService.ExportParquetZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		versions = dataexport.VersionRangeOf(ctx)
+		formTypes = dataexport.FormTypesOf(ctx)
+		return io.NopCloser(strings.NewReader("PK")), nil
+	}
+	h.dataExportService = mockDataExportService
+
+	w := httptest.NewRecorder()
+	h.ParquetExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/parquet?since_version=12&form_type=survey,visit&form_type=household", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if versions != (dataexport.VersionRange{Since: 12, Until: 40}) {
+		t.Errorf("Expected the changes after version 12, got %+v", versions)
+	}
+	if strings.Join(formTypes, ",") != "survey,visit,household" {
+		t.Errorf("Expected the requested form types, got %v", formTypes)
+	}
+
+	w = httptest.NewRecorder()
+	h.ParquetExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/parquet?since_version=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a negative since_version, got %d", w.Code)
+	}
+}
+
 func TestHandler_ParquetExportHandler_Integration(t *testing.T) {
 	// This test verifies the handler works with a more realistic mock
 	h, _ := createTestHandler()
@@ -146,3 +188,163 @@ func TestHandler_ParquetExportHandler_Integration(t *testing.T) {
 		}
 	}
 }
+
+func TestHandler_FHIRExportHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		exportErr      error
+		expectedStatus int
+	}{
+		{name: "successful export", expectedStatus: http.StatusOK},
+		{name: "invalid mapping", exportErr: fmt.Errorf("%w for visit: resource 0: Observation needs a code", dataexport.ErrInvalidFHIRMapping), expectedStatus: http.StatusUnprocessableEntity},
+		{name: "export service error", exportErr: io.ErrUnexpectedEOF, expectedStatus: http.StatusInternalServerError},
+		{name: "database unavailable", exportErr: fmt.Errorf("failed to get form types: %w", &database.UnavailableError{Operation: "export form types", RetryAfter: 5 * time.Second}), expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+			mockDataExportService := mocks.NewMockDataExportService()
+			mockDataExportService.ExportFHIRFunc = func(ctx context.Context) (io.ReadCloser, error) {
+				if tt.exportErr != nil {
+					return nil, tt.exportErr
+				}
+				return io.NopCloser(strings.NewReader(`{"resourceType":"Patient","id":"obs1-patient"}` + "\n")), nil
+			}
+			h.dataExportService = mockDataExportService
+
+			w := httptest.NewRecorder()
+			h.FHIRExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/fhir", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "5" {
+				t.Errorf("Expected Retry-After 5, got %q", w.Header().Get("Retry-After"))
+			}
+			if tt.exportErr == nil {
+				if ct := w.Header().Get("Content-Type"); ct != "application/fhir+ndjson" {
+					t.Errorf("Expected Content-Type application/fhir+ndjson, got %s", ct)
+				}
+				if !strings.Contains(w.Body.String(), `"resourceType":"Patient"`) {
+					t.Errorf("Expected the resources in the body, got %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_DeltaExportHandler(t *testing.T) {
+	h, _ := createTestHandler()
+	consumers := mocks.NewMockExportConsumerService()
+	consumers.Version = 40
+	consumers.Consumers["lake"] = exportconsumer.Consumer{Name: "lake", AckedVersion: 25}
+	h.exportConsumerService = consumers
+
+	var versions dataexport.VersionRange
+	mockDataExportService := mocks.NewMockDataExportService()
+	mockDataExportService.ExportDeltaZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		versions = dataexport.VersionRangeOf(ctx)
+		return io.NopCloser(strings.NewReader("PK")), nil
+	}
+	h.dataExportService = mockDataExportService
+
+	w := httptest.NewRecorder()
+	h.DeltaExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/delta?consumer=lake", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if versions != (dataexport.VersionRange{Since: 25, Until: 40}) {
+		t.Errorf("Expected the changes after the consumer's acknowledgement, got %+v", versions)
+	}
+	if w.Header().Get("X-Export-Since") != "25" || w.Header().Get("X-Export-Version") != "40" {
+		t.Errorf("Expected X-Export-Since 25 and X-Export-Version 40, got %v", w.Header())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "observations_delta.zip") {
+		t.Errorf("Expected a delta ZIP attachment, got %s", cd)
+	}
+
+	mockDataExportService.ExportDeltaZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	w = httptest.NewRecorder()
+	h.DeltaExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/delta?since=3", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 when the export fails, got %d", w.Code)
+	}
+}
+
+func TestHandler_DuckDBExportHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		exportErr      error
+		expectedStatus int
+	}{
+		{name: "successful export", expectedStatus: http.StatusOK},
+		{name: "built without DuckDB", exportErr: dataexport.ErrDuckDBUnavailable, expectedStatus: http.StatusNotImplemented},
+		{name: "export service error", exportErr: io.ErrUnexpectedEOF, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+			mockDataExportService := mocks.NewMockDataExportService()
+			mockDataExportService.ExportDuckDBFunc = func(ctx context.Context) (io.ReadCloser, error) {
+				if tt.exportErr != nil {
+					return nil, tt.exportErr
+				}
+				return io.NopCloser(strings.NewReader("DUCK")), nil
+			}
+			h.dataExportService = mockDataExportService
+
+			w := httptest.NewRecorder()
+			h.DuckDBExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/duckdb", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.exportErr == nil {
+				if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "observations_export.duckdb") {
+					t.Errorf("Expected a .duckdb attachment, got %s", cd)
+				}
+				if w.Body.String() != "DUCK" {
+					t.Errorf("Expected the database file in the body, got %q", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_CSVExportHandler(t *testing.T) {
+	h, _ := createTestHandler()
+	called := false
+	mockDataExportService := mocks.NewMockDataExportService()
+	mockDataExportService.ExportCSVZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		called = true
+		return io.NopCloser(strings.NewReader("PK")), nil
+	}
+	h.dataExportService = mockDataExportService
+
+	w := httptest.NewRecorder()
+	h.CSVExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/csv", nil))
+
+	if w.Code != http.StatusOK || !called {
+		t.Fatalf("Expected status 200 from the CSV export, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Expected a ZIP, got %s", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "observations_export_csv.zip") {
+		t.Errorf("Expected a CSV ZIP attachment, got %s", cd)
+	}
+
+	mockDataExportService.ExportCSVZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	w = httptest.NewRecorder()
+	h.CSVExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/csv", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 when the export fails, got %d", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/dedup"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// GetDuplicateReport handles GET /reports/duplicates
+// @Summary Get a report of probable duplicate observations
+// @Description Compares existing observations of the same form type created within a time window (and, when both are located, within a distance) and groups pairs whose data similarity reaches min_score into clusters for review. Query parameters override the server's configured heuristics.
+// @Tags Reports
+// @Produce json
+// @Produce text/csv
+// @Param form_type query string false "Only scan this form type"
+// @Param from query string false "First creation day to include (YYYY-MM-DD)"
+// @Param to query string false "Last creation day to include (YYYY-MM-DD)"
+// @Param fields query string false "Comma-separated data fields to compare (default: all)"
+// @Param min_score query number false "Data similarity (0..1) at which a pair is reported"
+// @Param window_hours query number false "Maximum creation time difference in hours"
+// @Param max_distance_m query number false "Maximum distance in meters between located observations; 0 ignores location"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} dedup.Report
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /reports/duplicates [get]
+func (h *Handler) GetDuplicateReport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := dedup.Query{FormType: params.Get("form_type")}
+
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "format must be json or csv")
+		return
+	}
+
+	if from := params.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		query.From = &day
+	}
+	if to := params.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		// to is inclusive by day
+		end := day.AddDate(0, 0, 1)
+		query.To = &end
+	}
+
+	if fields := params.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				query.Fields = append(query.Fields, field)
+			}
+		}
+	}
+
+	if value := params.Get("min_score"); value != "" {
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil || score < 0 || score > 1 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "min_score must be a number between 0 and 1")
+			return
+		}
+		query.MinScore = &score
+	}
+	if value := params.Get("window_hours"); value != "" {
+		hours, err := strconv.ParseFloat(value, 64)
+		if err != nil || hours < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "window_hours must be a non-negative number")
+			return
+		}
+		window := time.Duration(hours * float64(time.Hour))
+		query.TimeWindow = &window
+	}
+	if value := params.Get("max_distance_m"); value != "" {
+		distance, err := strconv.ParseFloat(value, 64)
+		if err != nil || distance < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "max_distance_m must be a non-negative number")
+			return
+		}
+		query.MaxDistanceMeters = &distance
+	}
+
+	report, err := h.dedupService.Report(r.Context(), query)
+	if err != nil {
+		h.log.Error("Failed to build duplicate report", "error", err, "formType", query.FormType)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to build duplicate report")
+		return
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		if err := dedup.WriteCSV(&buf, report); err != nil {
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to write duplicate report")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"duplicates.csv\"")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, report)
+}
+
+// MergeObservations handles POST /observations/merge
+// @Summary Merge duplicate observations into one
+// @Description Keeps the winner and marks the losers deleted, linked to the winner by merged_into, so devices pull them as tombstones. Attachment fields of the losers the winner has no value for are copied to the winner, which then gets a new version and an audit entry. All observations must exist, not be deleted and share a form type. Observations another user holds a review lock on are refused with 409 unless force is set.
+// @Tags Observations
+// @Accept json
+// @Produce json
+// @Param body body dedup.MergeRequest true "Merge"
+// @Success 200 {object} dedup.MergeResult
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Observation not found"
+// @Failure 409 {object} ObservationLockedResponse "Another user holds a review lock"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/merge [post]
+func (h *Handler) MergeObservations(w http.ResponseWriter, r *http.Request) {
+	var req dedup.MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+
+	mergedBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		mergedBy = currentUser.Username
+	}
+	result, err := h.dedupService.Merge(r.Context(), req, mergedBy)
+	var locked *observationlock.LockedError
+	switch {
+	case errors.As(err, &locked):
+		SendJSONResponse(w, http.StatusConflict, ObservationLockedResponse{
+			Error:   err.Error(),
+			Message: "Observation is locked by another user; merge with force to override the lock",
+			Code:    sync.FailureLocked,
+			Lock:    locked.Lock,
+		})
+		return
+	case errors.Is(err, dedup.ErrInvalidMerge):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case errors.Is(err, dedup.ErrObservationNotFound):
+		SendErrorResponse(w, http.StatusNotFound, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to merge observations", "error", err, "winner", req.Winner)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to merge observations")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, result)
+}
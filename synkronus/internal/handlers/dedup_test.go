@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/dedup"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+)
+
+func TestHandler_GetDuplicateReport(t *testing.T) {
+	report := &dedup.Report{
+		ObservationsScanned: 3,
+		MinScore:            0.8,
+		Clusters: []dedup.Cluster{{
+			ID:             1,
+			FormType:       "household",
+			ObservationIDs: []string{"obs1", "obs2"},
+			MaxScore:       0.95,
+			Pairs:          []dedup.Pair{{ObservationID: "obs1", MatchedObservationID: "obs2", Score: 0.95, TimeDeltaSeconds: 60}},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		check          func(t *testing.T, q dedup.Query, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "json report with overrides",
+			query:          "?form_type=household&from=2025-06-01&to=2025-06-07&fields=name,+members&min_score=0.8&window_hours=6&max_distance_m=0",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, q dedup.Query, w *httptest.ResponseRecorder) {
+				if q.FormType != "household" || strings.Join(q.Fields, ",") != "name,members" {
+					t.Errorf("Unexpected query: %+v", q)
+				}
+				if q.From == nil || q.To == nil || !q.To.Equal(time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("Expected an inclusive day range, got %v..%v", q.From, q.To)
+				}
+				if q.MinScore == nil || *q.MinScore != 0.8 || q.TimeWindow == nil || *q.TimeWindow != 6*time.Hour {
+					t.Errorf("Expected heuristic overrides, got %+v", q)
+				}
+				if q.MaxDistanceMeters == nil || *q.MaxDistanceMeters != 0 {
+					t.Errorf("Expected max distance override of 0, got %v", q.MaxDistanceMeters)
+				}
+				var got dedup.Report
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(got.Clusters) != 1 || got.Clusters[0].ObservationIDs[1] != "obs2" {
+					t.Errorf("Unexpected clusters: %+v", got.Clusters)
+				}
+			},
+		},
+		{
+			name:           "csv report",
+			query:          "?format=csv",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, q dedup.Query, w *httptest.ResponseRecorder) {
+				if w.Header().Get("Content-Type") != "text/csv" {
+					t.Errorf("Expected text/csv, got %s", w.Header().Get("Content-Type"))
+				}
+				if !strings.Contains(w.Body.String(), "1,household,obs1,obs2,0.95,60,") {
+					t.Errorf("Unexpected CSV body: %q", w.Body.String())
+				}
+			},
+		},
+		{
+			name:           "invalid format",
+			query:          "?format=xlsx",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "min_score out of range",
+			query:          "?min_score=1.5",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid date",
+			query:          "?from=last-week",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "service error",
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received dedup.Query
+			mockDedupService := mocks.NewMockDedupService()
+			mockDedupService.ReportFunc = func(ctx context.Context, query dedup.Query) (*dedup.Report, error) {
+				received = query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return report, nil
+			}
+			h.dedupService = mockDedupService
+
+			w := httptest.NewRecorder()
+			h.GetDuplicateReport(w, httptest.NewRequest(http.MethodGet, "/reports/duplicates"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.check != nil {
+				tt.check(t, received, w)
+			}
+		})
+	}
+}
+
+func TestHandler_MergeObservations(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		serviceErr     error
+		expectedStatus int
+	}{
+		{name: "merged", body: `{"winner":"obs1","losers":["obs2"]}`, expectedStatus: http.StatusOK},
+		{name: "malformed body", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid merge", body: `{"winner":"obs1"}`, serviceErr: dedup.ErrInvalidMerge, expectedStatus: http.StatusBadRequest},
+		{name: "unknown observation", body: `{"winner":"obs1","losers":["obs9"]}`, serviceErr: dedup.ErrObservationNotFound, expectedStatus: http.StatusNotFound},
+		{name: "locked by another reviewer", body: `{"winner":"obs1","losers":["obs2"]}`, serviceErr: &observationlock.LockedError{Lock: observationlock.Lock{ObservationID: "obs2", Owner: "alice"}}, expectedStatus: http.StatusConflict},
+		{name: "service failure", body: `{"winner":"obs1","losers":["obs2"]}`, serviceErr: errors.New("db down"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received dedup.MergeRequest
+			var receivedBy string
+			mockDedupService := mocks.NewMockDedupService()
+			mockDedupService.MergeFunc = func(ctx context.Context, req dedup.MergeRequest, mergedBy string) (*dedup.MergeResult, error) {
+				received, receivedBy = req, mergedBy
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &dedup.MergeResult{ID: 1, Winner: req.Winner, Losers: req.Losers, Attachments: []dedup.MergedAttachment{}}, nil
+			}
+			h.dedupService = mockDedupService
+
+			req := httptest.NewRequest(http.MethodPost, "/observations/merge", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "admin", Role: models.RoleAdmin}))
+			w := httptest.NewRecorder()
+			h.MergeObservations(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var result dedup.MergeResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if result.Winner != "obs1" || received.Winner != "obs1" || receivedBy != "admin" {
+				t.Errorf("Unexpected merge %+v by %q, result %+v", received, receivedBy, result)
+			}
+		})
+	}
+}
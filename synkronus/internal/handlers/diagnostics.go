@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// GetDatabaseDiagnostics handles GET /diagnostics/database
+// @Summary Get database diagnostics
+// @Description Reports required sync indexes that are missing, scan counters for the sync tables and, when pg_stat_statements is installed, the slowest queries.
+// @Tags Diagnostics
+// @Produce json
+// @Success 200 {object} diagnostics.Report
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /diagnostics/database [get]
+func (h *Handler) GetDatabaseDiagnostics(w http.ResponseWriter, r *http.Request) {
+	report, err := h.diagnosticsService.Report(r.Context())
+	if err != nil {
+		h.log.Error("Failed to build database diagnostics", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get database diagnostics")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, report)
+}
+
+// GetAttachmentReplicationReport handles GET /diagnostics/attachment-replication
+// @Summary Get the attachment replication consistency report
+// @Description Counts attachments by replication status (pending, replicated, failed) and lists those that failed too often to be retried. With verify=true, replicated attachments are re-hashed on the primary and the replica storage; replicas that are missing or differ are listed and queued for replication again.
+// @Tags Diagnostics
+// @Produce json
+// @Param verify query boolean false "Re-hash replicas and compare them with the primary copies"
+// @Success 200 {object} attachment.ReplicationReport
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /diagnostics/attachment-replication [get]
+func (h *Handler) GetAttachmentReplicationReport(w http.ResponseWriter, r *http.Request) {
+	verify := false
+	if value := r.URL.Query().Get("verify"); value != "" {
+		var err error
+		if verify, err = strconv.ParseBool(value); err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "verify must be true or false")
+			return
+		}
+	}
+
+	report, err := h.replicationService.Report(r.Context(), verify)
+	if err != nil {
+		h.log.Error("Failed to build attachment replication report", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get attachment replication report")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, report)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/diagnostics"
+)
+
+func TestHandler_GetDatabaseDiagnostics(t *testing.T) {
+	h, _ := createTestHandler()
+
+	mockDiagnosticsService := mocks.NewMockDiagnosticsService()
+	mockDiagnosticsService.ReportFunc = func(ctx context.Context) (*diagnostics.Report, error) {
+		return &diagnostics.Report{
+			MissingIndexes: []diagnostics.RequiredIndex{diagnostics.RequiredIndexes[0]},
+			Tables:         []diagnostics.TableScanStats{{Table: "observations", SeqScans: 12}},
+			SlowQueries:    []diagnostics.SlowQuery{},
+		}, nil
+	}
+	h.diagnosticsService = mockDiagnosticsService
+
+	w := httptest.NewRecorder()
+	h.GetDatabaseDiagnostics(w, httptest.NewRequest(http.MethodGet, "/diagnostics/database", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var report diagnostics.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(report.MissingIndexes) != 1 || report.MissingIndexes[0].Name != diagnostics.RequiredIndexes[0].Name {
+		t.Errorf("Unexpected missing indexes: %+v", report.MissingIndexes)
+	}
+
+	mockDiagnosticsService.ReportFunc = func(ctx context.Context) (*diagnostics.Report, error) {
+		return nil, errors.New("connection refused")
+	}
+	w = httptest.NewRecorder()
+	h.GetDatabaseDiagnostics(w, httptest.NewRequest(http.MethodGet, "/diagnostics/database", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
+
+func TestHandler_GetAttachmentReplicationReport(t *testing.T) {
+	h, _ := createTestHandler()
+
+	var verified []bool
+	mockReplicationService := mocks.NewMockReplicationService()
+	mockReplicationService.ReportFunc = func(ctx context.Context, verify bool) (*attachment.ReplicationReport, error) {
+		verified = append(verified, verify)
+		return &attachment.ReplicationReport{
+			Enabled:    true,
+			Pending:    2,
+			Replicated: 10,
+			Failures:   []attachment.ReplicationFailure{},
+			Problems:   []attachment.ReplicaProblem{{AttachmentID: "photo.jpg", Problem: attachment.ReplicaMissing}},
+		}, nil
+	}
+	h.replicationService = mockReplicationService
+
+	w := httptest.NewRecorder()
+	h.GetAttachmentReplicationReport(w, httptest.NewRequest(http.MethodGet, "/diagnostics/attachment-replication?verify=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report attachment.ReplicationReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Pending != 2 || len(report.Problems) != 1 || report.Problems[0].Problem != attachment.ReplicaMissing {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	w = httptest.NewRecorder()
+	h.GetAttachmentReplicationReport(w, httptest.NewRequest(http.MethodGet, "/diagnostics/attachment-replication", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if len(verified) != 2 || !verified[0] || verified[1] {
+		t.Errorf("Expected verify only on the first request, got %v", verified)
+	}
+
+	w = httptest.NewRecorder()
+	h.GetAttachmentReplicationReport(w, httptest.NewRequest(http.MethodGet, "/diagnostics/attachment-replication?verify=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// Headers that tell an export's caller which versions it contains
+const (
+	exportSinceHeader   = "X-Export-Since"
+	exportVersionHeader = "X-Export-Version"
+)
+
+// ExportConsumerAckRequest is the request body for POST /dataexport/consumers/{name}/ack
+type ExportConsumerAckRequest struct {
+	// Version is the X-Export-Version of the last export the consumer loaded
+	Version *int64 `json:"version"`
+	// Reset allows moving the consumer back to an earlier version, e.g. to reload
+	Reset bool `json:"reset"`
+}
+
+// ExportConsumerListResponse lists the registered export consumers
+type ExportConsumerListResponse struct {
+	CurrentVersion int64                     `json:"current_version"`
+	Consumers      []exportconsumer.Consumer `json:"consumers"`
+}
+
+// exportVersionRange limits an export to the versions after ?since_version= (or ?since=) or
+// after the last acknowledgement of ?consumer=, up to the current version. The current version is sent in
+// X-Export-Version for the consumer to acknowledge once it has loaded the export. It
+// returns false after sending an error response.
+func (h *Handler) exportVersionRange(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	sinceParam, consumer := query.Get("since_version"), query.Get("consumer")
+	if sinceParam == "" {
+		sinceParam = query.Get("since")
+	}
+	if sinceParam != "" && consumer != "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Use either since or consumer, not both")
+		return nil, false
+	}
+
+	var since int64
+	switch {
+	case sinceParam != "":
+		var err error
+		if since, err = strconv.ParseInt(sinceParam, 10, 64); err != nil || since < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "since must be a non-negative integer")
+			return nil, false
+		}
+	case consumer != "":
+		if !exportconsumer.ValidName(consumer) {
+			SendErrorResponse(w, http.StatusBadRequest, exportconsumer.ErrInvalidName, exportconsumer.ErrInvalidName.Error())
+			return nil, false
+		}
+		// A consumer that never acknowledged a version gets everything
+		acked, err := h.exportConsumerService.Get(ctx, consumer)
+		switch {
+		case err == nil:
+			since = acked.AckedVersion
+		case !errors.Is(err, exportconsumer.ErrNotFound):
+			h.log.Error("Failed to get export consumer", "consumer", consumer, "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get export consumer")
+			return nil, false
+		}
+	}
+
+	// Cap the export at the current version, so changes committed while it runs are left
+	// for the next one instead of being loaded twice
+	current, err := h.exportConsumerService.CurrentVersion(ctx)
+	if err != nil {
+		h.log.Error("Failed to get current version for export", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get current version")
+		return nil, false
+	}
+	if since > current {
+		since = current
+	}
+
+	w.Header().Set(exportSinceHeader, strconv.FormatInt(since, 10))
+	w.Header().Set(exportVersionHeader, strconv.FormatInt(current, 10))
+	return dataexport.WithVersionRange(ctx, dataexport.VersionRange{Since: since, Until: current}), true
+}
+
+// ListExportConsumers handles GET /dataexport/consumers
+// @Summary List export consumers
+// @Description Lists the downstream systems that acknowledged an export, with the last version each loaded and how far it is behind
+// @Tags DataExport
+// @Produce json
+// @Success 200 {object} ExportConsumerListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/consumers [get]
+func (h *Handler) ListExportConsumers(w http.ResponseWriter, r *http.Request) {
+	current, err := h.exportConsumerService.CurrentVersion(r.Context())
+	if err != nil {
+		h.log.Error("Failed to get current version", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list export consumers")
+		return
+	}
+	consumers, err := h.exportConsumerService.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list export consumers", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list export consumers")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, ExportConsumerListResponse{CurrentVersion: current, Consumers: consumers})
+}
+
+// GetExportConsumer handles GET /dataexport/consumers/{name}
+// @Summary Get an export consumer
+// @Description Returns the last version a downstream system acknowledged and how far it is behind
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Success 200 {object} exportconsumer.Consumer
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export consumer not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/consumers/{name} [get]
+func (h *Handler) GetExportConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	consumer, err := h.exportConsumerService.Get(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, exportconsumer.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export consumer not found")
+			return
+		}
+		h.log.Error("Failed to get export consumer", "consumer", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get export consumer")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, consumer)
+}
+
+// AckExportConsumer handles POST /dataexport/consumers/{name}/ack
+// @Summary Acknowledge an export
+// @Description Records that a downstream system loaded everything up to version, normally the X-Export-Version of its last export. The consumer is created on its first acknowledgement. Later exports with ?consumer= and change feed replays for the consumer start after this version. Moving a consumer back to an earlier version requires reset.
+// @Tags DataExport
+// @Accept json
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Param body body ExportConsumerAckRequest true "Version the consumer loaded"
+// @Success 200 {object} exportconsumer.Consumer
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "The version is ahead of the server or behind the consumer's last acknowledgement"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/consumers/{name}/ack [post]
+func (h *Handler) AckExportConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	var req ExportConsumerAckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Version == nil || *req.Version < 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "version must be a non-negative integer")
+		return
+	}
+
+	var ackedBy string
+	if caller := authmw.GetUserFromContext(r.Context()); caller != nil {
+		ackedBy = caller.Username
+	}
+
+	consumer, err := h.exportConsumerService.Ack(r.Context(), name, *req.Version, req.Reset, ackedBy)
+	switch {
+	case errors.Is(err, exportconsumer.ErrInvalidName):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case errors.Is(err, exportconsumer.ErrVersionAhead), errors.Is(err, exportconsumer.ErrVersionBehind):
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to acknowledge export", "consumer", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to acknowledge export")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, consumer)
+}
+
+// DeleteExportConsumer handles DELETE /dataexport/consumers/{name} (admin only)
+// @Summary Delete an export consumer
+// @Description Forgets a downstream system that no longer loads exports
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export consumer not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/consumers/{name} [delete]
+func (h *Handler) DeleteExportConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := h.exportConsumerService.Delete(r.Context(), name); err != nil {
+		if errors.Is(err, exportconsumer.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export consumer not found")
+			return
+		}
+		h.log.Error("Failed to delete export consumer", "consumer", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to delete export consumer")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Export consumer deleted"})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportConsumers(t *testing.T) {
+	h, _ := createTestHandler()
+	consumers := mocks.NewMockExportConsumerService()
+	consumers.Version = 120
+	h.exportConsumerService = consumers
+	r := chi.NewRouter()
+	r.Get("/dataexport/consumers", h.ListExportConsumers)
+	r.Get("/dataexport/consumers/{name}", h.GetExportConsumer)
+	r.Post("/dataexport/consumers/{name}/ack", h.AckExportConsumer)
+	r.Delete("/dataexport/consumers/{name}", h.DeleteExportConsumer)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(method, target, strings.NewReader(body)), "loader", models.RoleReadOnly)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/dataexport/consumers/warehouse/ack", `{"version":100}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var consumer exportconsumer.Consumer
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &consumer))
+	assert.Equal(t, int64(100), consumer.AckedVersion)
+	assert.Equal(t, int64(20), consumer.Lag)
+	require.NotNil(t, consumer.AckedBy)
+	assert.Equal(t, "loader", *consumer.AckedBy)
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/dataexport/consumers/warehouse/ack", `{"version":90}`).Code, "moving back needs reset")
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/dataexport/consumers/warehouse/ack", `{"version":90,"reset":true}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/dataexport/consumers/warehouse/ack", `{"version":121}`).Code, "ahead of the server")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/dataexport/consumers/warehouse/ack", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/dataexport/consumers/Ware%20House/ack", `{"version":1}`).Code)
+
+	w = do(http.MethodGet, "/dataexport/consumers", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ExportConsumerListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, int64(120), list.CurrentVersion)
+	require.Len(t, list.Consumers, 1)
+	assert.Equal(t, int64(90), list.Consumers[0].AckedVersion)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/dataexport/consumers/warehouse", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/dataexport/consumers/warehouse", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/dataexport/consumers/warehouse", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/dataexport/consumers/warehouse", "").Code)
+}
+
+func TestExportSinceConsumer(t *testing.T) {
+	h, _ := createTestHandler()
+	consumers := mocks.NewMockExportConsumerService()
+	consumers.Version = 120
+	h.exportConsumerService = consumers
+	_, err := consumers.Ack(context.Background(), "warehouse", 100, false, "loader")
+	require.NoError(t, err)
+
+	var exported dataexport.VersionRange
+	export := mocks.NewMockDataExportService()
+	export.ExportParquetZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		exported = dataexport.VersionRangeOf(ctx)
+		return io.NopCloser(bytes.NewReader([]byte("PK"))), nil
+	}
+	h.dataExportService = export
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ParquetExportHandler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/dataexport/parquet?consumer=warehouse")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, dataexport.VersionRange{Since: 100, Until: 120}, exported)
+	assert.Equal(t, "100", w.Header().Get("X-Export-Since"))
+	assert.Equal(t, "120", w.Header().Get("X-Export-Version"))
+
+	// A consumer's first export has everything
+	require.Equal(t, http.StatusOK, get("/dataexport/parquet?consumer=dashboard").Code)
+	assert.Equal(t, dataexport.VersionRange{Since: 0, Until: 120}, exported)
+
+	require.Equal(t, http.StatusOK, get("/dataexport/parquet?since=110").Code)
+	assert.Equal(t, dataexport.VersionRange{Since: 110, Until: 120}, exported)
+
+	assert.Equal(t, http.StatusBadRequest, get("/dataexport/parquet?since=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/dataexport/parquet?since=1&consumer=warehouse").Code)
+}
+
+func TestReplayChangeFeedForConsumer(t *testing.T) {
+	h, _ := createTestHandler()
+	consumers := mocks.NewMockExportConsumerService()
+	consumers.Version = 120
+	h.exportConsumerService = consumers
+	feed := mocks.NewMockChangeFeedService()
+	feed.StatusValue = changefeed.Status{Enabled: true}
+	feed.ReplayFunc = func(ctx context.Context, fromSeq int64) (int64, error) { return 7, nil }
+	h.changeFeedService = feed
+	_, err := consumers.Ack(context.Background(), "warehouse", 100, false, "loader")
+	require.NoError(t, err)
+
+	replay := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ReplayChangeFeed(w, httptest.NewRequest(http.MethodPost, "/change-feed/replay", strings.NewReader(body)))
+		return w
+	}
+
+	feed.SeqAfterVersion = 5031
+	w := replay(`{"consumer":"warehouse"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ChangeFeedReplayResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ChangeFeedReplayResponse{FromSeq: 5031, Requeued: 7}, resp)
+	assert.Equal(t, []int64{5031}, feed.ReplayedFrom)
+
+	// Nothing changed since the consumer's acknowledgement
+	feed.SeqAfterVersion = 0
+	w = replay(`{"consumer":"warehouse"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"from_seq":0,"requeued":0}`, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, replay(`{"consumer":"dashboard"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, replay(`{"consumer":"warehouse","from_seq":1}`).Code)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// exportReportTruncatedHeader tells the caller the report had more rows than it returned
+const exportReportTruncatedHeader = "X-Report-Truncated"
+
+// ExportReportListResponse lists the reports the caller may run
+type ExportReportListResponse struct {
+	Reports []exportreport.Definition `json:"reports"`
+}
+
+// ListExportReports handles GET /dataexport/reports
+// @Summary List export reports
+// @Description Lists the report definitions the caller may run; admins see every report
+// @Tags DataExport
+// @Produce json
+// @Success 200 {object} ExportReportListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/reports [get]
+func (h *Handler) ListExportReports(w http.ResponseWriter, r *http.Request) {
+	definitions, err := h.exportReportService.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list export reports", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list export reports")
+		return
+	}
+
+	role := callerRole(r)
+	reports := []exportreport.Definition{}
+	for _, definition := range definitions {
+		if definition.CanRun(role) {
+			reports = append(reports, definition)
+		}
+	}
+
+	SendJSONResponse(w, http.StatusOK, ExportReportListResponse{Reports: reports})
+}
+
+// GetExportReport handles GET /dataexport/reports/{name}
+// @Summary Get an export report
+// @Description Returns a report definition the caller may run
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Report name"
+// @Success 200 {object} exportreport.Definition
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export report not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/reports/{name} [get]
+func (h *Handler) GetExportReport(w http.ResponseWriter, r *http.Request) {
+	definition, ok := h.runnableExportReport(w, r)
+	if !ok {
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, definition)
+}
+
+// SaveExportReport handles PUT /dataexport/reports/{name} (admin only)
+// @Summary Create or replace an export report
+// @Description Registers a named report: either a single SELECT statement with :name placeholders, or a spec joining form types. The report may only read the observations and attachments tables, which is checked against the query plan. Reports read the stored data without export exclusions or redaction, so only admins run them unless roles names other roles.
+// @Tags DataExport
+// @Accept json
+// @Produce json
+// @Param name path string true "Report name"
+// @Param body body exportreport.Definition true "Report definition; the name is taken from the path"
+// @Success 200 {object} exportreport.Definition
+// @Failure 400 {object} ErrorResponse "Invalid report definition"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/reports/{name} [put]
+func (h *Handler) SaveExportReport(w http.ResponseWriter, r *http.Request) {
+	var definition exportreport.Definition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	definition.Name = chi.URLParam(r, "name")
+
+	var savedBy string
+	if caller := authmw.GetUserFromContext(r.Context()); caller != nil {
+		savedBy = caller.Username
+	}
+
+	saved, err := h.exportReportService.Save(r.Context(), definition, savedBy)
+	switch {
+	case errors.Is(err, exportreport.ErrInvalidName), errors.Is(err, exportreport.ErrInvalidDefinition):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to save export report", "report", definition.Name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to save export report")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, saved)
+}
+
+// DeleteExportReport handles DELETE /dataexport/reports/{name} (admin only)
+// @Summary Delete an export report
+// @Description Removes a report definition
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Report name"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export report not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/reports/{name} [delete]
+func (h *Handler) DeleteExportReport(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := h.exportReportService.Delete(r.Context(), name); err != nil {
+		if errors.Is(err, exportreport.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export report not found")
+			return
+		}
+		h.log.Error("Failed to delete export report", "report", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to delete export report")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Export report deleted"})
+}
+
+// RunExportReport handles GET /dataexport/report/{name}
+// @Summary Run an export report
+// @Description Runs a report with its parameters given as query parameters of the same name, in a read-only transaction. Reports stop at EXPORT_REPORT_MAX_ROWS rows; X-Report-Truncated is true when rows were left out.
+// @Tags DataExport
+// @Produce text/csv
+// @Produce json
+// @Param name path string true "Report name"
+// @Param format query string false "csv (default) or json"
+// @Success 200 {file} file "The report rows"
+// @Failure 400 {object} ErrorResponse "Missing or malformed parameter"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export report not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/report/{name} [get]
+func (h *Handler) RunExportReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = exportreport.FormatCSV
+	}
+	if format != exportreport.FormatCSV && format != exportreport.FormatJSON {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "format must be csv or json")
+		return
+	}
+
+	definition, ok := h.runnableExportReport(w, r)
+	if !ok {
+		return
+	}
+
+	values := make(map[string]string, len(query))
+	for key := range query {
+		if key != "format" {
+			values[key] = query.Get(key)
+		}
+	}
+
+	result, err := h.exportReportService.Run(r.Context(), definition, values)
+	switch {
+	case errors.Is(err, exportreport.ErrInvalidParameter):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to run export report", "report", definition.Name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to run export report")
+		return
+	}
+
+	// Render before writing the headers, so a failure still gets an error response
+	var body bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	write := result.WriteCSV
+	if format == exportreport.FormatJSON {
+		contentType, write = "application/json", result.WriteJSON
+	}
+	if err := write(&body); err != nil {
+		h.log.Error("Failed to write export report", "report", definition.Name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to write export report")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+definition.Name+"."+format+`"`)
+	w.Header().Set(exportReportTruncatedHeader, strconv.FormatBool(result.Truncated))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// runnableExportReport looks up the report named in the path and checks the caller may
+// run it. Reports the caller may not run are reported as not found. It returns false
+// after sending an error response.
+func (h *Handler) runnableExportReport(w http.ResponseWriter, r *http.Request) (*exportreport.Definition, bool) {
+	name := chi.URLParam(r, "name")
+	definition, err := h.exportReportService.Get(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, exportreport.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export report not found")
+			return nil, false
+		}
+		h.log.Error("Failed to get export report", "report", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get export report")
+		return nil, false
+	}
+	if !definition.CanRun(callerRole(r)) {
+		SendErrorResponse(w, http.StatusNotFound, exportreport.ErrNotFound, "Export report not found")
+		return nil, false
+	}
+	return definition, true
+}
+
+// callerRole returns the role of the authenticated user, or "" without one
+func callerRole(r *http.Request) models.Role {
+	if caller := authmw.GetUserFromContext(r.Context()); caller != nil {
+		return caller.Role
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportReports(t *testing.T) {
+	h, _ := createTestHandler()
+	reports := mocks.NewMockExportReportService()
+	var ranWith map[string]string
+	reports.RunFunc = func(ctx context.Context, definition *exportreport.Definition, values map[string]string) (*exportreport.Result, error) {
+		if values["since"] == "yesterday" {
+			return nil, exportreport.ErrInvalidParameter
+		}
+		ranWith = values
+		return &exportreport.Result{
+			Columns:   []string{"form_type", "count"},
+			Rows:      [][]any{{"household", int64(12)}, {"member", int64(40)}},
+			Truncated: true,
+		}, nil
+	}
+	h.exportReportService = reports
+	r := chi.NewRouter()
+	r.Get("/dataexport/reports", h.ListExportReports)
+	r.Get("/dataexport/reports/{name}", h.GetExportReport)
+	r.Put("/dataexport/reports/{name}", h.SaveExportReport)
+	r.Delete("/dataexport/reports/{name}", h.DeleteExportReport)
+	r.Get("/dataexport/report/{name}", h.RunExportReport)
+
+	do := func(role models.Role, method, target, body string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(method, target, strings.NewReader(body)), "analyst", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(models.RoleAdmin, http.MethodPut, "/dataexport/reports/counts", `{"sql":"SELECT form_type, count(*) FROM observations GROUP BY form_type","roles":["read-only"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var saved exportreport.Definition
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &saved))
+	assert.Equal(t, "counts", saved.Name, "the name is taken from the path")
+	require.NotNil(t, saved.CreatedBy)
+	assert.Equal(t, "analyst", *saved.CreatedBy)
+	_, err := reports.Save(context.Background(), exportreport.Definition{Name: "payroll", SQL: "SELECT 1"}, "admin")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, do(models.RoleAdmin, http.MethodPut, "/dataexport/reports/empty", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(models.RoleAdmin, http.MethodPut, "/dataexport/reports/Bad%20Name", `{"sql":"SELECT 1"}`).Code)
+
+	// Users only see and run the reports opened to their role
+	w = do(models.RoleReadOnly, http.MethodGet, "/dataexport/reports", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ExportReportListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Reports, 1)
+	assert.Equal(t, "counts", list.Reports[0].Name)
+	w = do(models.RoleAdmin, http.MethodGet, "/dataexport/reports", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Reports, 2)
+	assert.Equal(t, http.StatusOK, do(models.RoleReadOnly, http.MethodGet, "/dataexport/reports/counts", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(models.RoleReadOnly, http.MethodGet, "/dataexport/reports/payroll", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(models.RoleReadWrite, http.MethodGet, "/dataexport/report/counts", "").Code)
+
+	w = do(models.RoleReadOnly, http.MethodGet, "/dataexport/report/counts?since=2025-09-01", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="counts.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "true", w.Header().Get(exportReportTruncatedHeader))
+	assert.Equal(t, "form_type,count\nhousehold,12\nmember,40\n", w.Body.String())
+	assert.Equal(t, map[string]string{"since": "2025-09-01"}, ranWith)
+
+	w = do(models.RoleReadOnly, http.MethodGet, "/dataexport/report/counts?format=json", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[{"form_type":"household","count":12},{"form_type":"member","count":40}]`, w.Body.String())
+	assert.Empty(t, ranWith, "format is not a report parameter")
+
+	assert.Equal(t, http.StatusBadRequest, do(models.RoleReadOnly, http.MethodGet, "/dataexport/report/counts?format=xlsx", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(models.RoleReadOnly, http.MethodGet, "/dataexport/report/counts?since=yesterday", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(models.RoleAdmin, http.MethodGet, "/dataexport/report/missing", "").Code)
+
+	assert.Equal(t, http.StatusOK, do(models.RoleAdmin, http.MethodDelete, "/dataexport/reports/counts", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(models.RoleAdmin, http.MethodDelete, "/dataexport/reports/counts", "").Code)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/exportschedule"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// ExportScheduleListResponse lists the export schedules
+type ExportScheduleListResponse struct {
+	Schedules []exportschedule.Schedule `json:"schedules"`
+}
+
+// ListExportSchedules handles GET /dataexport/schedules (admin only)
+// @Summary List export schedules
+// @Description Lists the schedules that run export reports and deliver them, with their next run and the outcome of their latest run
+// @Tags DataExport
+// @Produce json
+// @Success 200 {object} ExportScheduleListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/schedules [get]
+func (h *Handler) ListExportSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.exportScheduleService.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list export schedules", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list export schedules")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, ExportScheduleListResponse{Schedules: schedules})
+}
+
+// GetExportSchedule handles GET /dataexport/schedules/{name} (admin only)
+// @Summary Get an export schedule
+// @Description Returns a schedule with its next run and the outcome of its latest run
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Schedule name"
+// @Success 200 {object} exportschedule.Schedule
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export schedule not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/schedules/{name} [get]
+func (h *Handler) GetExportSchedule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	schedule, err := h.exportScheduleService.Get(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, exportschedule.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export schedule not found")
+			return
+		}
+		h.log.Error("Failed to get export schedule", "schedule", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get export schedule")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, schedule)
+}
+
+// SaveExportSchedule handles PUT /dataexport/schedules/{name} (admin only)
+// @Summary Create or replace an export schedule
+// @Description Runs a named export report on a cron expression (five fields, in UTC, or a shorthand like @daily) with fixed parameter values, and delivers it as CSV or JSON to a new file in a directory under EXPORT_SCHEDULE_DIR or as a POST to a webhook URL
+// @Tags DataExport
+// @Accept json
+// @Produce json
+// @Param name path string true "Schedule name"
+// @Param body body exportschedule.Schedule true "Schedule; the name is taken from the path"
+// @Success 200 {object} exportschedule.Schedule
+// @Failure 400 {object} ErrorResponse "Invalid export schedule"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/schedules/{name} [put]
+func (h *Handler) SaveExportSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule exportschedule.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	schedule.Name = chi.URLParam(r, "name")
+
+	var savedBy string
+	if caller := authmw.GetUserFromContext(r.Context()); caller != nil {
+		savedBy = caller.Username
+	}
+
+	saved, err := h.exportScheduleService.Save(r.Context(), schedule, savedBy)
+	switch {
+	case errors.Is(err, exportschedule.ErrInvalidName), errors.Is(err, exportschedule.ErrInvalidSchedule):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to save export schedule", "schedule", schedule.Name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to save export schedule")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, saved)
+}
+
+// DeleteExportSchedule handles DELETE /dataexport/schedules/{name} (admin only)
+// @Summary Delete an export schedule
+// @Description Removes a schedule; files it delivered are kept
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Schedule name"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export schedule not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/schedules/{name} [delete]
+func (h *Handler) DeleteExportSchedule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := h.exportScheduleService.Delete(r.Context(), name); err != nil {
+		if errors.Is(err, exportschedule.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export schedule not found")
+			return
+		}
+		h.log.Error("Failed to delete export schedule", "schedule", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to delete export schedule")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Export schedule deleted"})
+}
+
+// RunExportSchedule handles POST /dataexport/schedules/{name}/run (admin only)
+// @Summary Run an export schedule now
+// @Description Runs a schedule's report and delivers it at once, without moving its next scheduled run. A failed run is reported with status failed and recorded on the schedule.
+// @Tags DataExport
+// @Produce json
+// @Param name path string true "Schedule name"
+// @Success 200 {object} exportschedule.RunResult
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Export schedule not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /dataexport/schedules/{name}/run [post]
+func (h *Handler) RunExportSchedule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	result, err := h.exportScheduleService.RunNow(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, exportschedule.ErrNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Export schedule not found")
+			return
+		}
+		h.log.Error("Failed to run export schedule", "schedule", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to run export schedule")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, result)
+}
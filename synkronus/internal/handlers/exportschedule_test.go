@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/exportschedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSchedules(t *testing.T) {
+	h, _ := createTestHandler()
+	schedules := mocks.NewMockExportScheduleService()
+	schedules.RunFunc = func(ctx context.Context, schedule *exportschedule.Schedule) *exportschedule.RunResult {
+		return &exportschedule.RunResult{
+			Schedule: schedule.Name,
+			Report:   schedule.Report,
+			Status:   exportschedule.StatusFailed,
+			Error:    "webhook responded 502 Bad Gateway",
+			RanAt:    time.Now(),
+		}
+	}
+	h.exportScheduleService = schedules
+	r := chi.NewRouter()
+	r.Get("/dataexport/schedules", h.ListExportSchedules)
+	r.Get("/dataexport/schedules/{name}", h.GetExportSchedule)
+	r.Put("/dataexport/schedules/{name}", h.SaveExportSchedule)
+	r.Delete("/dataexport/schedules/{name}", h.DeleteExportSchedule)
+	r.Post("/dataexport/schedules/{name}/run", h.RunExportSchedule)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(method, target, strings.NewReader(body)), "ops", models.RoleAdmin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPut, "/dataexport/schedules/nightly", `{"cron":"0 2 * * *","report":"counts","format":"csv","destination":{"type":"directory","path":"nightly"}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var saved exportschedule.Schedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &saved))
+	assert.Equal(t, "nightly", saved.Name, "the name is taken from the path")
+	require.NotNil(t, saved.CreatedBy)
+	assert.Equal(t, "ops", *saved.CreatedBy)
+	require.NotNil(t, saved.NextRunAt)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/dataexport/schedules/nightly", `{"cron":"0 25 * * *"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/dataexport/schedules/Bad%20Name", `{"cron":"@daily"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/dataexport/schedules/nightly", `not json`).Code)
+
+	w = do(http.MethodGet, "/dataexport/schedules", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ExportScheduleListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Schedules, 1)
+	assert.Equal(t, "0 2 * * *", list.Schedules[0].Cron)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/dataexport/schedules/nightly", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/dataexport/schedules/missing", "").Code)
+
+	// A failed delivery is a result of the run, not an error of the request
+	w = do(http.MethodPost, "/dataexport/schedules/nightly/run", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result exportschedule.RunResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, exportschedule.StatusFailed, result.Status)
+	assert.Equal(t, "webhook responded 502 Bad Gateway", result.Error)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/dataexport/schedules/missing/run", "").Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/dataexport/schedules/nightly", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/dataexport/schedules/nightly", "").Code)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// FeatureFlagUpdateRequest is the request body for PUT /feature-flags/{name}
+type FeatureFlagUpdateRequest struct {
+	Enabled     *bool  `json:"enabled"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListFeatureFlags handles GET /feature-flags
+// @Summary List feature flags
+// @Description Returns the flags honored by the server, with their defaults, and any other flags set for this deployment
+// @Tags FeatureFlags
+// @Produce json
+// @Success 200 {array} featureflag.Flag
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /feature-flags [get]
+func (h *Handler) ListFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.featureFlagService.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list feature flags", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list feature flags")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, flags)
+}
+
+// SetFeatureFlag handles PUT /feature-flags/{name}
+// @Summary Turn a feature flag on or off
+// @Description Stores the flag for this deployment. The change applies immediately on this instance and on other instances once their flag cache expires.
+// @Tags FeatureFlags
+// @Accept json
+// @Produce json
+// @Param name path string true "Flag name (lowercase snake_case)"
+// @Param body body FeatureFlagUpdateRequest true "New state"
+// @Success 200 {object} featureflag.Flag
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /feature-flags/{name} [put]
+func (h *Handler) SetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req FeatureFlagUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Enabled == nil {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "enabled is required")
+		return
+	}
+
+	updatedBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		updatedBy = currentUser.Username
+	}
+
+	flag, err := h.featureFlagService.Set(r.Context(), name, *req.Enabled, req.Description, updatedBy)
+	if err != nil {
+		if errors.Is(err, featureflag.ErrInvalidName) {
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+		h.log.Error("Failed to set feature flag", "flag", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to set feature flag")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, flag)
+}
+
+// ResetFeatureFlag handles DELETE /feature-flags/{name}
+// @Summary Reset a feature flag to its default
+// @Description Removes the stored state so the flag uses its built-in default (off for flags the server doesn't know)
+// @Tags FeatureFlags
+// @Param name path string true "Flag name"
+// @Success 204 "Reset"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Flag has no stored state"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /feature-flags/{name} [delete]
+func (h *Handler) ResetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := h.featureFlagService.Reset(r.Context(), name); err != nil {
+		if errors.Is(err, featureflag.ErrFlagNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Feature flag not found")
+			return
+		}
+		h.log.Error("Failed to reset feature flag", "flag", name, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to reset feature flag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
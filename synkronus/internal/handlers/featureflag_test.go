@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
+	"github.com/opendataensemble/synkronus/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newFeatureFlagRouter(h *Handler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/feature-flags", h.ListFeatureFlags)
+	r.Put("/feature-flags/{name}", h.SetFeatureFlag)
+	r.Delete("/feature-flags/{name}", h.ResetFeatureFlag)
+	r.Get("/version", h.GetVersion)
+	return r
+}
+
+func TestFeatureFlagEndpoints(t *testing.T) {
+	h, _ := createTestHandler()
+	versionService := mocks.NewMockVersionService()
+	versionService.On("GetVersion", mock.Anything).Return(&version.SystemVersionInfo{}, nil)
+	h.versionService = versionService
+	r := newFeatureFlagRouter(h)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPut, "/feature-flags/anonymized_export", `{"enabled":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var flag featureflag.Flag
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flag))
+	assert.Equal(t, "anonymized_export", flag.Name)
+	assert.True(t, flag.Enabled)
+
+	w = do(http.MethodGet, "/feature-flags", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var flags []featureflag.Flag
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flags))
+	require.Len(t, flags, 1)
+
+	w = do(http.MethodGet, "/version", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info version.SystemVersionInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, []string{"anonymized_export"}, info.Features)
+
+	w = do(http.MethodDelete, "/feature-flags/anonymized_export", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(http.MethodDelete, "/feature-flags/anonymized_export", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodPut, "/feature-flags/async_push", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "enabled is required")
+}
+
+func TestSetFeatureFlag_InvalidName(t *testing.T) {
+	h, _ := createTestHandler()
+	h.featureFlagService = &mocks.MockFeatureFlagService{
+		SetFunc: func(ctx context.Context, name string, enabled bool, description, updatedBy string) (*featureflag.Flag, error) {
+			return nil, featureflag.ErrInvalidName
+		},
+	}
+
+	w := httptest.NewRecorder()
+	newFeatureFlagRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/feature-flags/Bad-Name", strings.NewReader(`{"enabled":true}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestParquetExport_AnonymizedExportFlag(t *testing.T) {
+	h, _ := createTestHandler()
+	flags := mocks.NewMockFeatureFlagService()
+	h.featureFlagService = flags
+
+	exports := mocks.NewMockDataExportService()
+	var anonymized bool
+	exports.ExportParquetZipFunc = func(ctx context.Context) (io.ReadCloser, error) {
+		anonymized = dataexport.Anonymized(ctx)
+		return io.NopCloser(strings.NewReader("zip")), nil
+	}
+	h.dataExportService = exports
+
+	for _, enabled := range []bool{false, true} {
+		flags.Flags[featureflag.AnonymizedExport] = enabled
+		w := httptest.NewRecorder()
+		h.ParquetExportHandler(w, httptest.NewRequest(http.MethodGet, "/dataexport/parquet", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, enabled, anonymized)
+	}
+}
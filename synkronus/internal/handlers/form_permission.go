@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/formpermission"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// FormPermissionRequest is the request body for POST /form-permissions
+type FormPermissionRequest struct {
+	FormType string      `json:"form_type"`
+	Role     models.Role `json:"role,omitempty"`
+	Username string      `json:"username,omitempty"`
+}
+
+// ListFormPermissions handles GET /form-permissions
+// @Summary List form permissions
+// @Description Returns the grants of form types to roles and users. Form types without grants are open to every user.
+// @Tags FormPermissions
+// @Produce json
+// @Param form_type query string false "Only grants of this form type"
+// @Param role query string false "Only grants to this role"
+// @Param username query string false "Only grants to this user"
+// @Success 200 {array} formpermission.Grant
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /form-permissions [get]
+func (h *Handler) ListFormPermissions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	grants, err := h.formPermissionService.List(r.Context(), formpermission.Filter{
+		FormType: query.Get("form_type"),
+		Role:     models.Role(query.Get("role")),
+		Username: query.Get("username"),
+	})
+	if err != nil {
+		h.log.Error("Failed to list form permissions", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list form permissions")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, grants)
+}
+
+// GrantFormPermission handles POST /form-permissions
+// @Summary Grant a form type to a role or a user
+// @Description Once a form type has a grant, only admins and the granted roles and users push and pull its observations. A role grant includes the roles above it. Granting an existing grant returns it.
+// @Tags FormPermissions
+// @Accept json
+// @Produce json
+// @Param body body FormPermissionRequest true "Form type and either a role or a username"
+// @Success 201 {object} formpermission.Grant
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /form-permissions [post]
+func (h *Handler) GrantFormPermission(w http.ResponseWriter, r *http.Request) {
+	var req FormPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	createdBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		createdBy = currentUser.Username
+	}
+
+	grant, err := h.formPermissionService.Grant(r.Context(), formpermission.Grant{
+		FormType: req.FormType,
+		Role:     req.Role,
+		Username: req.Username,
+	}, createdBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, formpermission.ErrInvalidGrant), errors.Is(err, formpermission.ErrUnknownRole):
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		case errors.Is(err, formpermission.ErrUserNotFound):
+			SendErrorResponse(w, http.StatusNotFound, err, err.Error())
+		default:
+			h.log.Error("Failed to grant form permission", "formType", req.FormType, "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to grant form permission")
+		}
+		return
+	}
+
+	SendJSONResponse(w, http.StatusCreated, grant)
+}
+
+// RevokeFormPermission handles DELETE /form-permissions/{id}
+// @Summary Revoke a form permission
+// @Description Removes a grant. A form type whose last grant is revoked is open to every user again.
+// @Tags FormPermissions
+// @Param id path int true "Grant ID"
+// @Success 204 "Revoked"
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Grant not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /form-permissions/{id} [delete]
+func (h *Handler) RevokeFormPermission(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid grant ID")
+		return
+	}
+
+	if err := h.formPermissionService.Revoke(r.Context(), id); err != nil {
+		if errors.Is(err, formpermission.ErrGrantNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Form permission not found")
+			return
+		}
+		h.log.Error("Failed to revoke form permission", "id", id, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to revoke form permission")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
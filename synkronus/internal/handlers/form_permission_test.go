@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/formpermission"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormPermissionEndpoints(t *testing.T) {
+	h, _ := createTestHandler()
+	r := chi.NewRouter()
+	r.Get("/form-permissions", h.ListFormPermissions)
+	r.Post("/form-permissions", h.GrantFormPermission)
+	r.Delete("/form-permissions/{id}", h.RevokeFormPermission)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "admin", Role: models.RoleAdmin}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/form-permissions", `{"form_type":"payments","role":"read-write"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var grant formpermission.Grant
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grant))
+	assert.Equal(t, "payments", grant.FormType)
+	assert.Equal(t, models.RoleReadWrite, grant.Role)
+	assert.Equal(t, "admin", grant.CreatedBy)
+
+	w = do(http.MethodPost, "/form-permissions", `{"form_type":"salaries","username":"alice"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = do(http.MethodGet, "/form-permissions?form_type=payments", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var grants []formpermission.Grant
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grants))
+	require.Len(t, grants, 1)
+	assert.Equal(t, grant.ID, grants[0].ID)
+
+	w = do(http.MethodPost, "/form-permissions", `{"form_type":"payments","role":"read-write","username":"alice"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a grant names a role or a user, not both")
+	w = do(http.MethodPost, "/form-permissions", `{"form_type":"payments","role":"owner"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(http.MethodDelete, "/form-permissions/1", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(http.MethodDelete, "/form-permissions/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(http.MethodDelete, "/form-permissions/abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/formmigration"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// FormMigrationsResponse lists the migration scripts that bring data of a form version up
+// to the form's version in the active bundle
+type FormMigrationsResponse struct {
+	BundleVersion string `json:"bundle_version"`
+	FormType      string `json:"form_type"`
+	From          string `json:"from,omitempty"`
+	To            string `json:"to"`
+	// Migrations run in order; without from, all scripts of the form are listed
+	Migrations []appbundle.MigrationInfo `json:"migrations"`
+}
+
+// GetFormMigrations handles GET /app-bundle/migrations
+// @Summary Get the migration scripts of a form
+// @Description Returns the migrations/{from}_{to}.js scripts that transform observation data of form version from to the form's version in the active app bundle, in the order they must run. Scripts are downloaded like other bundle files.
+// @Tags AppBundle
+// @Produce json
+// @Param form_type query string true "Form type"
+// @Param from query string false "Form version of the data to migrate; all scripts of the form are listed when omitted"
+// @Success 200 {object} FormMigrationsResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Unknown form or no migration path"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /app-bundle/migrations [get]
+func (h *Handler) GetFormMigrations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	formType := r.URL.Query().Get("form_type")
+	if formType == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "form_type is required")
+		return
+	}
+
+	manifest, err := h.appBundleService.GetManifest(ctx)
+	if err != nil {
+		h.log.Error("Failed to get app bundle manifest", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app bundle manifest")
+		return
+	}
+	appInfo, err := h.appBundleService.GetAppInfo(ctx, manifest.Version)
+	if err != nil {
+		h.log.Error("Failed to get app info", "error", err, "version", manifest.Version)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get app info")
+		return
+	}
+	form, ok := appInfo.Forms[formType]
+	if !ok {
+		SendErrorResponse(w, http.StatusNotFound, nil, fmt.Sprintf("The active app bundle has no form %s", formType))
+		return
+	}
+
+	resp := FormMigrationsResponse{
+		BundleVersion: manifest.Version,
+		FormType:      formType,
+		To:            form.Version,
+		Migrations:    form.Migrations,
+	}
+	if resp.Migrations == nil {
+		resp.Migrations = []appbundle.MigrationInfo{}
+	}
+	if from := r.URL.Query().Get("from"); from != "" {
+		chain, err := form.MigrationChain(from)
+		if err != nil {
+			SendErrorResponse(w, http.StatusNotFound, err, err.Error())
+			return
+		}
+		resp.From, resp.Migrations = from, chain
+	}
+
+	SendJSONResponse(w, http.StatusOK, resp)
+}
+
+// RunFormMigration handles POST /app-bundle/migrations/run
+// @Summary Migrate stored observations to the current form version
+// @Description Runs the active bundle's migration scripts over the stored observations of form_type whose form version is older, with Node.js on the server. Migrated observations get the current form version, new sync versions and an audit entry each. With dry_run nothing is stored and the first changes are listed.
+// @Tags AppBundle
+// @Accept json
+// @Produce json
+// @Param body body formmigration.Request true "Form to migrate"
+// @Success 200 {object} formmigration.Result
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 501 {object} ErrorResponse "Node.js is not available on the server"
+// @Security BearerAuth
+// @Router /app-bundle/migrations/run [post]
+func (h *Handler) RunFormMigration(w http.ResponseWriter, r *http.Request) {
+	var req formmigration.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+
+	requestedBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		requestedBy = currentUser.Username
+	}
+	result, err := h.formMigrationService.Run(r.Context(), req, requestedBy)
+	switch {
+	case errors.Is(err, formmigration.ErrInvalidRequest):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case errors.Is(err, formmigration.ErrUnavailable):
+		SendErrorResponse(w, http.StatusNotImplemented, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to migrate observations", "error", err, "formType", req.FormType)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to migrate observations")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/formmigration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFormMigrations(t *testing.T) {
+	h, bundle := createTestHandler()
+	bundle.SetAppInfo(&appbundle.AppInfo{Forms: map[string]appbundle.FormInfo{
+		"survey": {
+			Version: "3",
+			Migrations: []appbundle.MigrationInfo{
+				{From: "1", To: "2", Path: "forms/survey/migrations/1_2.js", Hash: "a"},
+				{From: "2", To: "3", Path: "forms/survey/migrations/2_3.js", Hash: "b"},
+			},
+		},
+		"visit": {Version: "1"},
+	}})
+	r := chi.NewRouter()
+	r.Get("/app-bundle/migrations", h.GetFormMigrations)
+
+	get := func(query string) (*httptest.ResponseRecorder, FormMigrationsResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app-bundle/migrations"+query, nil))
+		var resp FormMigrationsResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	w, resp := get("?form_type=survey&from=2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "3", resp.To)
+	require.Len(t, resp.Migrations, 1)
+	assert.Equal(t, "forms/survey/migrations/2_3.js", resp.Migrations[0].Path)
+
+	w, resp = get("?form_type=survey")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, resp.Migrations, 2)
+
+	w, resp = get("?form_type=visit")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, resp.Migrations)
+	assert.Empty(t, resp.Migrations)
+
+	w, _ = get("?form_type=survey&from=0.5")
+	assert.Equal(t, http.StatusNotFound, w.Code, "no migration path")
+	w, _ = get("?form_type=unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w, _ = get("")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRunFormMigration(t *testing.T) {
+	h, _ := createTestHandler()
+	migrations := mocks.NewMockFormMigrationService()
+	h.formMigrationService = migrations
+	r := chi.NewRouter()
+	r.Post("/app-bundle/migrations/run", h.RunFormMigration)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/app-bundle/migrations/run", strings.NewReader(body)))
+		return w
+	}
+
+	// Node.js is not available
+	assert.Equal(t, http.StatusNotImplemented, post(`{"form_type":"survey"}`).Code)
+
+	migrations.RunFunc = func(ctx context.Context, req formmigration.Request, requestedBy string) (*formmigration.Result, error) {
+		if req.FormType != "survey" {
+			return nil, formmigration.ErrInvalidRequest
+		}
+		return &formmigration.Result{FormType: req.FormType, ToVersion: "3", DryRun: req.DryRun, Scanned: 5, Migrated: 5}, nil
+	}
+	w := post(`{"form_type":"survey","dry_run":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result formmigration.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 5, result.Migrated)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"form_type":"visit"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`not json`).Code)
+}
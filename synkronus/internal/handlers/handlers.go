@@ -4,12 +4,31 @@ import (
 	"github.com/opendataensemble/synkronus/pkg/appbundle"
 	"github.com/opendataensemble/synkronus/pkg/attachment"
 	"github.com/opendataensemble/synkronus/pkg/auth"
+	"github.com/opendataensemble/synkronus/pkg/batchupdate"
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+	"github.com/opendataensemble/synkronus/pkg/checkpoint"
+	"github.com/opendataensemble/synkronus/pkg/completeness"
 	"github.com/opendataensemble/synkronus/pkg/config"
 	"github.com/opendataensemble/synkronus/pkg/dataexport"
+	"github.com/opendataensemble/synkronus/pkg/dedup"
+	"github.com/opendataensemble/synkronus/pkg/diagnostics"
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	"github.com/opendataensemble/synkronus/pkg/exportschedule"
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
+	"github.com/opendataensemble/synkronus/pkg/formmigration"
+	"github.com/opendataensemble/synkronus/pkg/formpermission"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/maintenance"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
+	"github.com/opendataensemble/synkronus/pkg/render"
+	"github.com/opendataensemble/synkronus/pkg/stats"
 	"github.com/opendataensemble/synkronus/pkg/sync"
 	"github.com/opendataensemble/synkronus/pkg/user"
 	"github.com/opendataensemble/synkronus/pkg/version"
+	"github.com/opendataensemble/synkronus/pkg/workflow"
 )
 
 // Handler manages all API endpoints
@@ -23,6 +42,26 @@ type Handler struct {
 	versionService            version.Service
 	attachmentManifestService attachment.ManifestService
 	dataExportService         dataexport.Service
+	statsService              stats.Service
+	diagnosticsService        diagnostics.Service
+	dedupService              dedup.Service
+	featureFlagService        featureflag.Service
+	calculationService        calculation.Service
+	batchUpdateService        batchupdate.Service
+	renderService             render.Service
+	maintenanceService        maintenance.Service
+	changeFeedService         changefeed.Service
+	formMigrationService      formmigration.Service
+	completenessService       completeness.Service
+	replicationService        attachment.ReplicationService
+	exportConsumerService     exportconsumer.Service
+	checkpointService         checkpoint.Service
+	observationLockService    observationlock.Service
+	exportReportService       exportreport.Service
+	exportScheduleService     exportschedule.Service
+	workflowService           workflow.Service
+	payloadCryptoService      payloadcrypto.Service
+	formPermissionService     formpermission.Service
 }
 
 // NewHandler creates a new Handler instance
@@ -36,6 +75,26 @@ func NewHandler(
 	versionService version.Service,
 	attachmentManifestService attachment.ManifestService,
 	dataExportService dataexport.Service,
+	statsService stats.Service,
+	diagnosticsService diagnostics.Service,
+	dedupService dedup.Service,
+	featureFlagService featureflag.Service,
+	calculationService calculation.Service,
+	batchUpdateService batchupdate.Service,
+	renderService render.Service,
+	maintenanceService maintenance.Service,
+	changeFeedService changefeed.Service,
+	formMigrationService formmigration.Service,
+	completenessService completeness.Service,
+	replicationService attachment.ReplicationService,
+	exportConsumerService exportconsumer.Service,
+	checkpointService checkpoint.Service,
+	observationLockService observationlock.Service,
+	exportReportService exportreport.Service,
+	exportScheduleService exportschedule.Service,
+	workflowService workflow.Service,
+	payloadCryptoService payloadcrypto.Service,
+	formPermissionService formpermission.Service,
 ) *Handler {
 	return &Handler{
 		log:                       log,
@@ -47,6 +106,26 @@ func NewHandler(
 		versionService:            versionService,
 		attachmentManifestService: attachmentManifestService,
 		dataExportService:         dataExportService,
+		statsService:              statsService,
+		diagnosticsService:        diagnosticsService,
+		dedupService:              dedupService,
+		featureFlagService:        featureFlagService,
+		calculationService:        calculationService,
+		batchUpdateService:        batchUpdateService,
+		renderService:             renderService,
+		maintenanceService:        maintenanceService,
+		changeFeedService:         changeFeedService,
+		formMigrationService:      formMigrationService,
+		completenessService:       completenessService,
+		replicationService:        replicationService,
+		exportConsumerService:     exportConsumerService,
+		checkpointService:         checkpointService,
+		observationLockService:    observationLockService,
+		exportReportService:       exportReportService,
+		exportScheduleService:     exportScheduleService,
+		workflowService:           workflowService,
+		payloadCryptoService:      payloadCryptoService,
+		formPermissionService:     formPermissionService,
 	}
 }
 
@@ -55,6 +134,11 @@ func (h *Handler) GetAuthService() auth.AuthServiceInterface {
 	return h.authService
 }
 
+// GetAttachmentManifestService returns the attachment manifest service
+func (h *Handler) GetAttachmentManifestService() attachment.ManifestService {
+	return h.attachmentManifestService
+}
+
 // GetConfig returns the application configuration
 func (h *Handler) GetConfig() *config.Config {
 	return h.config
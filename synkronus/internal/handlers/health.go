@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/database"
 )
 
-// HealthCheck handles the /health endpoint
+// HealthCheck handles the /health endpoint. It answers DEGRADED while database operations
+// need retries, and 503 UNAVAILABLE while the database circuit breaker is open.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("Health check requested")
 	w.Header().Set("content-type", "text/plain")
@@ -15,12 +21,37 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	status, body := http.StatusOK, "OK"
+	switch health := h.diagnosticsService.ConnectionHealth(r.Context()); health.Status {
+	case database.HealthDegraded:
+		body = "DEGRADED"
+	case database.HealthUnavailable:
+		h.log.Warn("Health check failed, database unavailable", "lastError", health.LastError)
+		status, body = http.StatusServiceUnavailable, "UNAVAILABLE"
+	}
+	w.WriteHeader(status)
 
 	// Only write body for GET requests
 	if r.Method == http.MethodGet {
-		if _, err := w.Write([]byte("OK")); err != nil {
+		if _, err := w.Write([]byte(body)); err != nil {
 			h.log.Error("Failed to write health check response", "error", err)
 		}
 	}
 }
+
+// sendDatabaseUnavailable answers 503 with Retry-After when err is the database being
+// unreachable after retries, so clients back off instead of treating it as a failure
+func (h *Handler) sendDatabaseUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, database.ErrUnavailable) {
+		return false
+	}
+	retryAfter := time.Second
+	var unavailable *database.UnavailableError
+	if errors.As(err, &unavailable) && unavailable.RetryAfter > retryAfter {
+		retryAfter = unavailable.RetryAfter
+	}
+	h.log.Warn("Request failed, database unavailable", "error", err)
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	SendErrorResponse(w, http.StatusServiceUnavailable, err, "Database temporarily unavailable, retry later")
+	return true
+}
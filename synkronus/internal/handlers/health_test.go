@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/database"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,3 +38,29 @@ func TestHealthCheck(t *testing.T) {
 	assert.NoError(t, err, "Failed to read response body")
 	assert.Equal(t, "OK", string(body), "Expected response body 'OK', got '%s'")
 }
+
+func TestHealthCheck_DatabaseHealth(t *testing.T) {
+	tests := []struct {
+		status         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{database.HealthDegraded, http.StatusOK, "DEGRADED"},
+		{database.HealthUnavailable, http.StatusServiceUnavailable, "UNAVAILABLE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			h, _ := createTestHandler()
+			diagnosticsService := mocks.NewMockDiagnosticsService()
+			diagnosticsService.Health = database.Health{Status: tt.status}
+			h.diagnosticsService = diagnosticsService
+
+			w := httptest.NewRecorder()
+			h.HealthCheck(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// ImpersonateRequest is the request body for impersonating a user
+type ImpersonateRequest struct {
+	// Reason is recorded in the impersonation audit trail
+	Reason string `json:"reason"`
+}
+
+// ImpersonateResponse holds a token for an admin to act as another user
+type ImpersonateResponse struct {
+	Token          string    `json:"token"`
+	Username       string    `json:"username"`
+	ImpersonatedBy string    `json:"impersonatedBy"`
+	SessionID      uuid.UUID `json:"sessionId"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// ImpersonationAuditResponse lists impersonation audit entries, newest first
+type ImpersonationAuditResponse struct {
+	Entries []models.ImpersonationAuditEntry `json:"entries"`
+}
+
+// ImpersonateUserHandler handles POST /users/impersonate/{username} (admin only)
+// @Summary Impersonate a user
+// @Description Issues the admin a short-lived token that acts as a non-admin user, to troubleshoot what the user pulls and may access. The token is read-only, cannot be refreshed, is marked with the admin in its claims and is revocable as one of the user's sessions. Issuing it and every request made with it are recorded in the impersonation audit trail.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param body body ImpersonateRequest true "Reason for impersonating"
+// @Success 200 {object} ImpersonateResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden or the user is an admin"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /users/impersonate/{username} [post]
+func (h *Handler) ImpersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin := authmw.GetUserFromContext(r.Context())
+	if admin == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "A reason is required to impersonate a user")
+		return
+	}
+	if len(req.Reason) > auth.MaxImpersonationReasonLength {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "reason must be at most "+strconv.Itoa(auth.MaxImpersonationReasonLength)+" bytes")
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	token, session, err := h.authService.Impersonate(r.Context(), admin.Username, username, req.Reason, clientInfo(r, ""))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUserNotFound):
+			SendErrorResponse(w, http.StatusNotFound, err, "User not found")
+		case errors.Is(err, auth.ErrImpersonationNotAllowed):
+			SendErrorResponse(w, http.StatusForbidden, err, "Admins cannot be impersonated")
+		default:
+			h.log.Error("Failed to impersonate user", "admin", admin.Username, "username", username, "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to impersonate user")
+		}
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, ImpersonateResponse{
+		Token:          token,
+		Username:       username,
+		ImpersonatedBy: admin.Username,
+		SessionID:      session.ID,
+		ExpiresAt:      session.ExpiresAt,
+	})
+}
+
+// ListImpersonationAuditHandler handles GET /users/impersonations (admin only)
+// @Summary List the impersonation audit trail
+// @Description Lists who impersonated whom and why, and every request made with impersonation tokens, newest first.
+// @Tags Users
+// @Produce json
+// @Param username query string false "Only entries of this impersonated user"
+// @Param limit query integer false "Maximum number of entries (1-1000, default 100)"
+// @Success 200 {object} ImpersonationAuditResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /users/impersonations [get]
+func (h *Handler) ListImpersonationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 1000")
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := h.authService.ListImpersonationAudit(r.Context(), r.URL.Query().Get("username"), limit)
+	if err != nil {
+		h.log.Error("Failed to list impersonation audit", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list impersonation audit")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, ImpersonationAuditResponse{Entries: entries})
+}
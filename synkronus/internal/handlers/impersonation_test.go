@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+)
+
+func TestImpersonateUserHandler(t *testing.T) {
+	h, _ := createTestHandler()
+
+	impersonate := func(username, body string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(http.MethodPost, "/users/impersonate/"+username, strings.NewReader(body)), "admin", models.RoleAdmin)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("username", username)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		h.ImpersonateUserHandler(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusBadRequest, impersonate("testuser", `{"reason":"  "}`).Code)
+	assert.Equal(t, http.StatusBadRequest, impersonate("testuser", `{"reason":"`+strings.Repeat("x", 501)+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, impersonate("nobody", `{"reason":"ticket 42"}`).Code)
+	assert.Equal(t, http.StatusForbidden, impersonate("admin", `{"reason":"ticket 42"}`).Code)
+
+	rr := impersonate("testuser", `{"reason":"ticket 42: missing households"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response ImpersonateResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+	assert.Equal(t, "testuser", response.Username)
+	assert.Equal(t, "admin", response.ImpersonatedBy)
+
+	// The user sees the impersonation among their sessions
+	req := withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions", nil), "testuser", models.RoleReadWrite)
+	status, sessions := listSessions(t, h, req)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, sessions.Sessions, 1)
+	assert.Equal(t, response.SessionID, sessions.Sessions[0].ID)
+	require.NotNil(t, sessions.Sessions[0].ImpersonatedBy)
+	assert.Equal(t, "admin", *sessions.Sessions[0].ImpersonatedBy)
+
+	// The audit trail records who, whom and why
+	req = withTestUser(httptest.NewRequest(http.MethodGet, "/users/impersonations?username=testuser", nil), "admin", models.RoleAdmin)
+	rr = httptest.NewRecorder()
+	h.ListImpersonationAuditHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var audit ImpersonationAuditResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &audit))
+	require.Len(t, audit.Entries, 1)
+	assert.Equal(t, models.ImpersonationStart, audit.Entries[0].Action)
+	assert.Equal(t, "admin", audit.Entries[0].Admin)
+	require.NotNil(t, audit.Entries[0].Reason)
+	assert.Equal(t, "ticket 42: missing households", *audit.Entries[0].Reason)
+
+	req = withTestUser(httptest.NewRequest(http.MethodGet, "/users/impersonations?limit=0", nil), "admin", models.RoleAdmin)
+	rr = httptest.NewRecorder()
+	h.ListImpersonationAuditHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/user"
+)
+
+// InvitationCreateRequest represents the request body for creating an invitation
+type InvitationCreateRequest struct {
+	Role           models.Role `json:"role"`
+	Email          string      `json:"email,omitempty"`
+	ExpiresInHours int         `json:"expiresInHours,omitempty"`
+}
+
+// InvitationCreateResponse represents the response body for a created invitation.
+// The token is only ever returned here.
+type InvitationCreateResponse struct {
+	Invitation      *models.Invitation `json:"invitation"`
+	Token           string             `json:"token"`
+	RegistrationURL string             `json:"registrationUrl,omitempty"`
+}
+
+// CreateInvitationHandler handles POST /users/invitations (admin only)
+func (h *Handler) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var req InvitationCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Role == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Missing required fields")
+		return
+	}
+	if req.ExpiresInHours < 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "expiresInHours must be positive")
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = h.config.InviteTTLHours
+	}
+
+	createdBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		createdBy = currentUser.Username
+	}
+
+	ttl := time.Duration(req.ExpiresInHours) * time.Hour
+	invitation, token, err := h.userService.CreateInvitation(r.Context(), req.Role, req.Email, createdBy, ttl)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidRole) {
+			SendErrorResponse(w, http.StatusBadRequest, err, "Invalid role")
+			return
+		}
+		h.log.Error("Failed to create invitation", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to create invitation")
+		return
+	}
+
+	response := InvitationCreateResponse{
+		Invitation: invitation,
+		Token:      token,
+	}
+	if h.config.InviteURLBase != "" {
+		if base, err := url.Parse(h.config.InviteURLBase); err == nil {
+			query := base.Query()
+			query.Set("invite", token)
+			base.RawQuery = query.Encode()
+			response.RegistrationURL = base.String()
+		}
+	}
+
+	SendJSONResponse(w, http.StatusCreated, response)
+}
+
+// ListInvitationsHandler handles GET /users/invitations (admin only)
+func (h *Handler) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.userService.ListInvitations(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list invitations", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list invitations")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, invitations)
+}
+
+// RevokeInvitationHandler handles DELETE /users/invitations/{id} (admin only)
+func (h *Handler) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid invitation ID")
+		return
+	}
+
+	if err := h.userService.RevokeInvitation(r.Context(), id); err != nil {
+		if errors.Is(err, user.ErrInvitationNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Invitation not found")
+			return
+		}
+		h.log.Error("Failed to revoke invitation", "error", err, "id", id)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to revoke invitation")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Invitation revoked successfully"})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInvitationHandler(t *testing.T) {
+	h, _ := userHandlerTestHelper()
+	h.config.InviteURLBase = "https://app.example.com/register"
+
+	body, _ := json.Marshal(map[string]any{"role": "read-write", "email": "new@example.com", "expiresInHours": 2})
+	r := httptest.NewRequest(http.MethodPost, "/users/invitations", bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), authmw.UserKey, &models.User{Username: "admin", Role: models.RoleAdmin}))
+	w := httptest.NewRecorder()
+	h.CreateInvitationHandler(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp InvitationCreateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Token)
+	assert.Equal(t, "https://app.example.com/register?invite="+resp.Token, resp.RegistrationURL)
+	assert.Equal(t, models.RoleReadWrite, resp.Invitation.Role)
+	assert.Equal(t, "admin", resp.Invitation.CreatedBy)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), resp.Invitation.ExpiresAt, time.Minute)
+
+	t.Run("invalid role", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]any{"role": "superuser"})
+		w := httptest.NewRecorder()
+		h.CreateInvitationHandler(w, httptest.NewRequest(http.MethodPost, "/users/invitations", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRevokeInvitationHandler(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+	invitation, _, err := mockUserService.CreateInvitation(context.Background(), models.RoleReadOnly, "", "admin", time.Hour)
+	require.NoError(t, err)
+
+	revoke := func(id string) int {
+		r := httptest.NewRequest(http.MethodDelete, "/users/invitations/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		h.RevokeInvitationHandler(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, revoke("not-a-uuid"))
+	assert.Equal(t, http.StatusOK, revoke(invitation.ID.String()))
+	assert.Equal(t, http.StatusNotFound, revoke(invitation.ID.String()))
+}
+
+func TestRegisterRequiresInvitation(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+	_, token, err := mockUserService.CreateInvitation(context.Background(), models.RoleReadOnly, "", "admin", time.Hour)
+	require.NoError(t, err)
+
+	register := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		w := httptest.NewRecorder()
+		h.Register(w, httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body)))
+		return w
+	}
+
+	w := register(map[string]any{"username": "newuser", "password": "password123"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = register(map[string]any{"username": "newuser", "password": "password123", "inviteToken": "bogus"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = register(map[string]any{"username": "newuser", "password": "password123", "inviteToken": token})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp RegisterResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "read-only", string(resp.Role))
+
+	// Invitations are single use
+	w = register(map[string]any{"username": "otheruser", "password": "password123", "inviteToken": token})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/opendataensemble/synkronus/pkg/maintenance"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// MaintenanceUpdateRequest is the request body for PUT /maintenance
+type MaintenanceUpdateRequest struct {
+	Enabled           *bool  `json:"enabled"`
+	Message           string `json:"message,omitempty"`
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"`
+}
+
+// GetMaintenance handles GET /maintenance
+// @Summary Get maintenance mode
+// @Description Returns whether maintenance mode is on, as stored in the database
+// @Tags Maintenance
+// @Produce json
+// @Success 200 {object} maintenance.State
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /maintenance [get]
+func (h *Handler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	state, err := h.maintenanceService.Get(r.Context())
+	if err != nil {
+		h.log.Error("Failed to get maintenance mode", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get maintenance mode")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, state)
+}
+
+// SetMaintenance handles PUT /maintenance
+// @Summary Turn maintenance mode on or off
+// @Description While maintenance mode is on, sync, upload and data-changing requests are answered with 503 and Retry-After. Health, version and bundle downloads keep working.
+// @Tags Maintenance
+// @Accept json
+// @Produce json
+// @Param body body MaintenanceUpdateRequest true "New state"
+// @Success 200 {object} maintenance.State
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /maintenance [put]
+func (h *Handler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Enabled == nil {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "enabled is required")
+		return
+	}
+
+	updatedBy := ""
+	if currentUser := authmw.GetUserFromContext(r.Context()); currentUser != nil {
+		updatedBy = currentUser.Username
+	}
+
+	state, err := h.maintenanceService.Set(r.Context(), *req.Enabled, req.Message, req.RetryAfterSeconds, updatedBy)
+	if err != nil {
+		if errors.Is(err, maintenance.ErrInvalidRetryAfter) {
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+		h.log.Error("Failed to set maintenance mode", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to set maintenance mode")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, state)
+}
+
+// RejectDuringMaintenance is middleware answering 503 with Retry-After while maintenance
+// mode is on, so clients back off instead of writing half their data during a migration
+func (h *Handler) RejectDuringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := h.maintenanceService.Current(r.Context())
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		message := state.Message
+		if message == "" {
+			message = "The server is in maintenance mode, please retry later"
+		}
+		h.log.Info("Rejected request during maintenance", "method", r.Method, "path", r.URL.Path)
+		w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfterSeconds))
+		SendErrorResponse(w, http.StatusServiceUnavailable, errors.New("maintenance mode"), message)
+	})
+}
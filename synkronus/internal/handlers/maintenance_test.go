@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/maintenance"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	h, _ := createTestHandler()
+	r := chi.NewRouter()
+	r.Get("/maintenance", h.GetMaintenance)
+	r.Put("/maintenance", h.SetMaintenance)
+	r.Get("/health", h.HealthCheck)
+	r.With(h.RejectDuringMaintenance).Post("/sync/pull", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/sync/pull", "").Code)
+
+	w := do(http.MethodPut, "/maintenance", `{"enabled":true,"message":"Upgrading the database","retry_after_seconds":600}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = do(http.MethodGet, "/maintenance", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var state maintenance.State
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.True(t, state.Enabled)
+	assert.Equal(t, 600, state.RetryAfterSeconds)
+
+	// Sync is held off with Retry-After, health keeps answering
+	w = do(http.MethodPost, "/sync/pull", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "600", w.Header().Get("Retry-After"))
+	var errResp ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, "Upgrading the database", errResp.Message)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/health", "").Code)
+
+	w = do(http.MethodPut, "/maintenance", `{"enabled":false}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/sync/pull", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/maintenance", `{}`).Code, "enabled is required")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/maintenance", `{"enabled":true,"retry_after_seconds":-5}`).Code)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -13,8 +14,26 @@ import (
 
 // MockAppBundleService is a mock implementation of the appbundle.AppBundleServiceInterface for testing
 type MockAppBundleService struct {
-	manifest *appbundle.Manifest
-	files    map[string]*mockFile
+	manifest   *appbundle.Manifest
+	files      map[string]*mockFile
+	scheduled  *appbundle.ScheduledSwitch
+	pushStatus *appbundle.PushStatus
+	pushErr    error
+	appInfo    *appbundle.AppInfo
+	internal   map[string]bool
+	history    []appbundle.ChangeHistoryEntry
+	// historyFilter is the filter of the last GetChangeHistory call
+	historyFilter appbundle.ChangeHistoryFilter
+	// changeLogs are returned by CompareAppInfos, keyed by "versionA..versionB"
+	changeLogs map[string]*appbundle.ChangeLog
+	// fileChanges are returned by CompareBundleFiles, keyed by "versionA..versionB"
+	fileChanges map[string]*appbundle.FileChanges
+	// bundleZipPath is returned by GetBundleZipPath when set
+	bundleZipPath string
+	// screenshots are returned by GetBootScreenshot, keyed by version
+	screenshots map[string][]byte
+	// RollbackVersionFunc overrides RollbackVersion
+	RollbackVersionFunc func(ctx context.Context) (*appbundle.RollbackResult, error)
 }
 
 type mockFile struct {
@@ -94,15 +113,30 @@ func (m *MockAppBundleService) GetFile(ctx context.Context, path string) (io.Rea
 		return nil, nil, appbundle.ErrFileNotFound
 	}
 
-	return io.NopCloser(bytes.NewReader(file.content)), &file.fileInfo, nil
+	// Seekable like the *os.File returned by the filesystem store
+	return seekableFile{bytes.NewReader(file.content)}, &file.fileInfo, nil
 }
 
+// seekableFile adds a no-op Close to a bytes.Reader
+type seekableFile struct {
+	*bytes.Reader
+}
+
+// Close implements io.Closer
+func (seekableFile) Close() error { return nil }
+
 // GetLatestVersionFile returns a file from the latest version of the app bundle
 func (m *MockAppBundleService) GetLatestVersionFile(ctx context.Context, path string) (io.ReadCloser, *appbundle.File, error) {
 	// For testing, just return the same as GetFile
 	return m.GetFile(ctx, path)
 }
 
+// GetVersionFile returns a file from a specific version of the app bundle
+func (m *MockAppBundleService) GetVersionFile(ctx context.Context, version, path string) (io.ReadCloser, *appbundle.File, error) {
+	// For testing, just return the same as GetFile
+	return m.GetFile(ctx, path)
+}
+
 // GetFileHash returns the hash for a specific file
 func (m *MockAppBundleService) GetFileHash(ctx context.Context, path string, useLatest bool) (string, error) {
 	file, exists := m.files[path]
@@ -121,20 +155,113 @@ func (m *MockAppBundleService) RefreshManifest() error {
 
 // PushBundle uploads a new app bundle from a zip file
 func (m *MockAppBundleService) PushBundle(ctx context.Context, zipReader io.Reader) (*appbundle.Manifest, error) {
+	if m.pushErr != nil {
+		return nil, m.pushErr
+	}
 	// For testing, just return the current manifest
 	return m.manifest, nil
 }
 
+// PushDraft stages an app bundle in the draft slot
+func (m *MockAppBundleService) PushDraft(ctx context.Context, zipReader io.Reader) (*appbundle.Manifest, error) {
+	// For testing, return a manifest for the draft slot
+	return &appbundle.Manifest{
+		Version:     appbundle.DraftVersion,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// PromoteDraft promotes the draft to a numbered version
+func (m *MockAppBundleService) PromoteDraft(ctx context.Context) (*appbundle.Manifest, error) {
+	if m.pushErr != nil {
+		return nil, m.pushErr
+	}
+	// For testing, return a manifest for the next version
+	return &appbundle.Manifest{
+		Version:     "0003",
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// SetPushError makes PushBundle and PromoteDraft fail with err
+func (m *MockAppBundleService) SetPushError(err error) {
+	m.pushErr = err
+}
+
+// GetPushStatus reports the configured push status, unlocked by default
+func (m *MockAppBundleService) GetPushStatus(ctx context.Context) (*appbundle.PushStatus, error) {
+	if m.pushStatus != nil {
+		return m.pushStatus, nil
+	}
+	return &appbundle.PushStatus{}, nil
+}
+
+// SetPushStatus sets the status returned by GetPushStatus
+func (m *MockAppBundleService) SetPushStatus(status *appbundle.PushStatus) {
+	m.pushStatus = status
+}
+
 // GetVersions returns a list of available app bundle versions
 func (m *MockAppBundleService) GetVersions(ctx context.Context) ([]string, error) {
 	// For testing, just return a static list of versions
 	return []string{"20250101-000000", "20250102-000000"}, nil
 }
 
+// GetVersionDetails returns the static versions with placeholder details
+func (m *MockAppBundleService) GetVersionDetails(ctx context.Context) ([]appbundle.VersionInfo, error) {
+	versions, _ := m.GetVersions(ctx)
+	details := make([]appbundle.VersionInfo, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		details = append(details, appbundle.VersionInfo{
+			Version:   versions[i],
+			Active:    m.manifest != nil && m.manifest.Version == versions[i],
+			Author:    "admin",
+			FormCount: 1,
+			Internal:  m.internal[versions[i]],
+		})
+	}
+	return details, nil
+}
+
+// SetVersionInternal marks a version internal or released
+func (m *MockAppBundleService) SetVersionInternal(ctx context.Context, version string, internal bool) error {
+	if m.internal == nil {
+		m.internal = make(map[string]bool)
+	}
+	m.internal[version] = internal
+	return nil
+}
+
+// GetBootScreenshot returns the screenshot set for a version
+func (m *MockAppBundleService) GetBootScreenshot(ctx context.Context, version string) ([]byte, error) {
+	screenshot, ok := m.screenshots[version]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return screenshot, nil
+}
+
+// SetBootScreenshot sets the screenshot GetBootScreenshot returns for a version
+func (m *MockAppBundleService) SetBootScreenshot(version string, screenshot []byte) {
+	if m.screenshots == nil {
+		m.screenshots = make(map[string][]byte)
+	}
+	m.screenshots[version] = screenshot
+}
+
+// RollbackVersion rolls back to the version before the mock's manifest version
+func (m *MockAppBundleService) RollbackVersion(ctx context.Context) (*appbundle.RollbackResult, error) {
+	if m.RollbackVersionFunc != nil {
+		return m.RollbackVersionFunc(ctx)
+	}
+	return &appbundle.RollbackResult{FromVersion: m.manifest.Version, ToVersion: "20250101-000000", ManifestHash: "hash", FileCount: len(m.files)}, nil
+}
+
 // SwitchVersion switches to a specific app bundle version
 func (m *MockAppBundleService) SwitchVersion(ctx context.Context, version string) error {
 	// In a real implementation, this would switch to the specified version
 	// For the mock, we'll just update the manifest's version and timestamp
+	m.scheduled = nil
 	if m.manifest == nil {
 		m.manifest = &appbundle.Manifest{
 			Version:     version,
@@ -147,8 +274,27 @@ func (m *MockAppBundleService) SwitchVersion(ctx context.Context, version string
 	return nil
 }
 
+// ScheduleSwitch records a version switch that takes effect at effectiveAt
+func (m *MockAppBundleService) ScheduleSwitch(ctx context.Context, version string, effectiveAt time.Time) error {
+	if !effectiveAt.After(time.Now()) {
+		return m.SwitchVersion(ctx, version)
+	}
+	m.scheduled = &appbundle.ScheduledSwitch{Version: version, EffectiveAt: effectiveAt.UTC()}
+	return nil
+}
+
+// GetScheduledSwitch returns the pending version switch, if any
+func (m *MockAppBundleService) GetScheduledSwitch(ctx context.Context) (*appbundle.ScheduledSwitch, error) {
+	return m.scheduled, nil
+}
+
 // GetAppInfo retrieves the app info for a specific version
 func (m *MockAppBundleService) GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error) {
+	if m.appInfo != nil {
+		info := *m.appInfo
+		info.Version = version
+		return &info, nil
+	}
 	// Return a mock AppInfo
 	return &appbundle.AppInfo{
 		Version: version,
@@ -156,6 +302,11 @@ func (m *MockAppBundleService) GetAppInfo(ctx context.Context, version string) (
 	}, nil
 }
 
+// SetAppInfo sets the forms GetAppInfo returns for every version
+func (m *MockAppBundleService) SetAppInfo(info *appbundle.AppInfo) {
+	m.appInfo = info
+}
+
 // GetLatestAppInfo retrieves the app info for the latest version (including unreleased)
 func (m *MockAppBundleService) GetLatestAppInfo(ctx context.Context) (*appbundle.AppInfo, error) {
 	// Return a mock latest AppInfo
@@ -167,11 +318,22 @@ func (m *MockAppBundleService) GetLatestAppInfo(ctx context.Context) (*appbundle
 
 // GetBundleZipPath returns the path to the active bundle's zip archive
 func (m *MockAppBundleService) GetBundleZipPath(ctx context.Context) (string, error) {
+	if m.bundleZipPath != "" {
+		return m.bundleZipPath, nil
+	}
 	return "/mock/bundle.zip", nil
 }
 
+// SetBundleZipPath sets the path GetBundleZipPath returns
+func (m *MockAppBundleService) SetBundleZipPath(zipPath string) {
+	m.bundleZipPath = zipPath
+}
+
 // CompareAppInfos compares two versions and returns the change log
 func (m *MockAppBundleService) CompareAppInfos(ctx context.Context, versionA, versionB string) (*appbundle.ChangeLog, error) {
+	if changeLog, ok := m.changeLogs[versionA+".."+versionB]; ok {
+		return changeLog, nil
+	}
 	// Return a mock change log
 	return &appbundle.ChangeLog{
 		CompareVersionA: versionA,
@@ -183,3 +345,47 @@ func (m *MockAppBundleService) CompareAppInfos(ctx context.Context, versionA, ve
 		ModifiedForms:   []appbundle.FormModification{},
 	}, nil
 }
+
+// CompareBundleFiles returns the file changes set with SetFileChanges, or none
+func (m *MockAppBundleService) CompareBundleFiles(ctx context.Context, versionA, versionB string) (*appbundle.FileChanges, error) {
+	if changes, ok := m.fileChanges[versionA+".."+versionB]; ok {
+		return changes, nil
+	}
+	return appbundle.CompareFiles(nil, nil), nil
+}
+
+// SetFileChanges sets the file changes CompareBundleFiles returns for two versions
+func (m *MockAppBundleService) SetFileChanges(versionA, versionB string, changes *appbundle.FileChanges) {
+	if m.fileChanges == nil {
+		m.fileChanges = make(map[string]*appbundle.FileChanges)
+	}
+	m.fileChanges[versionA+".."+versionB] = changes
+}
+
+// GetChangeHistory returns the entries set with SetChangeHistory, up to the filter's limit
+func (m *MockAppBundleService) GetChangeHistory(ctx context.Context, filter appbundle.ChangeHistoryFilter) ([]appbundle.ChangeHistoryEntry, error) {
+	m.historyFilter = filter
+	entries := append([]appbundle.ChangeHistoryEntry{}, m.history...)
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+// SetChangeHistory sets the entries GetChangeHistory returns
+func (m *MockAppBundleService) SetChangeHistory(entries []appbundle.ChangeHistoryEntry) {
+	m.history = entries
+}
+
+// SetChangeLog sets the change log CompareAppInfos returns for two versions
+func (m *MockAppBundleService) SetChangeLog(versionA, versionB string, changeLog *appbundle.ChangeLog) {
+	if m.changeLogs == nil {
+		m.changeLogs = make(map[string]*appbundle.ChangeLog)
+	}
+	m.changeLogs[versionA+".."+versionB] = changeLog
+}
+
+// ChangeHistoryFilter returns the filter of the last GetChangeHistory call
+func (m *MockAppBundleService) ChangeHistoryFilter() appbundle.ChangeHistoryFilter {
+	return m.historyFilter
+}
@@ -8,9 +8,16 @@ import (
 
 // MockAttachmentManifestService is a mock implementation of attachment.ManifestService
 type MockAttachmentManifestService struct {
-	GetManifestFunc     func(ctx context.Context, req attachment.AttachmentManifestRequest) (*attachment.AttachmentManifestResponse, error)
-	RecordOperationFunc func(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error
-	InitializeFunc      func(ctx context.Context) error
+	GetManifestFunc       func(ctx context.Context, req attachment.AttachmentManifestRequest) (*attachment.AttachmentManifestResponse, error)
+	ManifestETagFunc      func(ctx context.Context, req attachment.AttachmentManifestRequest) (string, error)
+	RecordOperationFunc   func(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error
+	RecordDownloadFunc    func(ctx context.Context, event attachment.DownloadEvent) error
+	RecordMetadataFunc    func(ctx context.Context, meta attachment.Metadata) error
+	GetMetadataFunc       func(ctx context.Context, attachmentID string) (*attachment.Metadata, error)
+	VerifyDownloadURLFunc func(attachmentID, clientID, expires, signature string) error
+	RefreshURLsFunc       func(ctx context.Context, req attachment.RefreshURLsRequest) (*attachment.RefreshURLsResponse, error)
+	ArchiveEntriesFunc    func(ctx context.Context, req attachment.ArchiveRequest) ([]attachment.ArchiveEntry, error)
+	InitializeFunc        func(ctx context.Context) error
 }
 
 // GetManifest implements attachment.ManifestService
@@ -29,6 +36,14 @@ func (m *MockAttachmentManifestService) GetManifest(ctx context.Context, req att
 	}, nil
 }
 
+// ManifestETag implements attachment.ManifestService
+func (m *MockAttachmentManifestService) ManifestETag(ctx context.Context, req attachment.AttachmentManifestRequest) (string, error) {
+	if m.ManifestETagFunc != nil {
+		return m.ManifestETagFunc(ctx, req)
+	}
+	return `"42-mock"`, nil
+}
+
 // RecordOperation implements attachment.ManifestService
 func (m *MockAttachmentManifestService) RecordOperation(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error {
 	if m.RecordOperationFunc != nil {
@@ -37,6 +52,67 @@ func (m *MockAttachmentManifestService) RecordOperation(ctx context.Context, att
 	return nil
 }
 
+// RecordDownload implements attachment.ManifestService
+func (m *MockAttachmentManifestService) RecordDownload(ctx context.Context, event attachment.DownloadEvent) error {
+	if m.RecordDownloadFunc != nil {
+		return m.RecordDownloadFunc(ctx, event)
+	}
+	return nil
+}
+
+// RecordMetadata implements attachment.ManifestService
+func (m *MockAttachmentManifestService) RecordMetadata(ctx context.Context, meta attachment.Metadata) error {
+	if m.RecordMetadataFunc != nil {
+		return m.RecordMetadataFunc(ctx, meta)
+	}
+	return nil
+}
+
+// GetMetadata implements attachment.ManifestService
+func (m *MockAttachmentManifestService) GetMetadata(ctx context.Context, attachmentID string) (*attachment.Metadata, error) {
+	if m.GetMetadataFunc != nil {
+		return m.GetMetadataFunc(ctx, attachmentID)
+	}
+	return nil, attachment.ErrMetadataNotFound
+}
+
+// VerifyDownloadURL implements attachment.ManifestService
+func (m *MockAttachmentManifestService) VerifyDownloadURL(attachmentID, clientID, expires, signature string) error {
+	if m.VerifyDownloadURLFunc != nil {
+		return m.VerifyDownloadURLFunc(attachmentID, clientID, expires, signature)
+	}
+	return attachment.ErrInvalidSignature
+}
+
+// RefreshDownloadURLs implements attachment.ManifestService; by default every attachment
+// gets a permanent path
+func (m *MockAttachmentManifestService) RefreshDownloadURLs(ctx context.Context, req attachment.RefreshURLsRequest) (*attachment.RefreshURLsResponse, error) {
+	if m.RefreshURLsFunc != nil {
+		return m.RefreshURLsFunc(ctx, req)
+	}
+	response := &attachment.RefreshURLsResponse{URLs: []attachment.RefreshedURL{}}
+	for _, id := range req.AttachmentIDs {
+		response.URLs = append(response.URLs, attachment.RefreshedURL{AttachmentID: id, DownloadURL: "http://localhost:8080/attachments/" + id})
+	}
+	return response, nil
+}
+
+// ArchiveEntries implements attachment.ManifestService; by default every attachment ID
+// is archived under its own name
+func (m *MockAttachmentManifestService) ArchiveEntries(ctx context.Context, req attachment.ArchiveRequest) ([]attachment.ArchiveEntry, error) {
+	if m.ArchiveEntriesFunc != nil {
+		return m.ArchiveEntriesFunc(ctx, req)
+	}
+	if len(req.AttachmentIDs) == 0 {
+		return nil, attachment.ErrInvalidArchiveRequest
+	}
+	entries := make([]attachment.ArchiveEntry, 0, len(req.AttachmentIDs))
+	for _, id := range req.AttachmentIDs {
+		entries = append(entries, attachment.ArchiveEntry{AttachmentID: id, Name: id})
+	}
+	return entries, nil
+}
+
 // Initialize implements attachment.ManifestService
 func (m *MockAttachmentManifestService) Initialize(ctx context.Context) error {
 	if m.InitializeFunc != nil {
@@ -0,0 +1,39 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+)
+
+// MockReplicationService is a mock implementation of attachment.ReplicationService
+type MockReplicationService struct {
+	ReportFunc func(ctx context.Context, verify bool) (*attachment.ReplicationReport, error)
+}
+
+// NewMockReplicationService creates a new mock attachment replication service
+func NewMockReplicationService() *MockReplicationService {
+	return &MockReplicationService{}
+}
+
+// Replicate implements attachment.ReplicationService
+func (m *MockReplicationService) Replicate(ctx context.Context) (*attachment.ReplicationResult, error) {
+	return &attachment.ReplicationResult{}, nil
+}
+
+// Report implements attachment.ReplicationService
+func (m *MockReplicationService) Report(ctx context.Context, verify bool) (*attachment.ReplicationReport, error) {
+	if m.ReportFunc != nil {
+		return m.ReportFunc(ctx, verify)
+	}
+	return &attachment.ReplicationReport{
+		Failures: []attachment.ReplicationFailure{},
+		Problems: []attachment.ReplicaProblem{},
+	}, nil
+}
+
+// Start implements attachment.ReplicationService
+func (m *MockReplicationService) Start(ctx context.Context) {}
+
+// Ensure MockReplicationService implements attachment.ReplicationService
+var _ attachment.ReplicationService = (*MockReplicationService)(nil)
@@ -17,6 +17,7 @@ import (
 type MockAuthService struct {
 	// Mock data for testing
 	userRepository     repository.UserRepositoryInterface
+	sessionRepository  *mocks.MockSessionRepository
 	validRefreshTokens map[string]string // map[refreshToken]username
 	config             auth.Config
 	log                *logger.Logger
@@ -35,6 +36,7 @@ func NewMockAuthService(mockUserRepo ...repository.UserRepositoryInterface) *Moc
 
 	// Create the mock service
 	mock := &MockAuthService{
+		sessionRepository:  mocks.NewMockSessionRepository(),
 		validRefreshTokens: make(map[string]string),
 		config:             config,
 		log:                logger.NewLogger(),
@@ -92,6 +94,11 @@ func (m *MockAuthService) AddUser(user *models.User) {
 	}
 }
 
+// SetConfig replaces the service configuration, such as to enable cookie sessions
+func (m *MockAuthService) SetConfig(config auth.Config) {
+	m.config = config
+}
+
 // GetTestUser returns a test user by username
 func (m *MockAuthService) GetTestUser(username string) models.User {
 	user, _ := m.userRepository.GetByUsername(context.Background(), username)
@@ -156,8 +163,32 @@ func (m *MockAuthService) GenerateRefreshToken(user *models.User) (string, error
 	return refreshToken, nil
 }
 
+// StartSession records a session for the user and returns its mock tokens
+func (m *MockAuthService) StartSession(ctx context.Context, user *models.User, client auth.ClientInfo) (string, string, error) {
+	session := &models.Session{
+		UserID:     user.ID,
+		DeviceName: client.DeviceName,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		ExpiresAt:  time.Now().Add(m.config.RefreshTokenExpiration),
+	}
+	if err := m.sessionRepository.Create(ctx, session); err != nil {
+		return "", "", err
+	}
+
+	token, err := m.GenerateToken(user)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := m.GenerateRefreshToken(user)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
 // RefreshToken mocks the token refresh process
-func (m *MockAuthService) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+func (m *MockAuthService) RefreshToken(ctx context.Context, refreshToken string, client auth.ClientInfo) (string, string, error) {
 	// Check if the refresh token is valid
 	username, valid := m.validRefreshTokens[refreshToken]
 	if !valid {
@@ -190,6 +221,109 @@ func (m *MockAuthService) RefreshToken(ctx context.Context, refreshToken string)
 	return token, newRefreshToken, nil
 }
 
+// CheckSession rejects claims whose session isn't active; mock tokens carry no session
+func (m *MockAuthService) CheckSession(ctx context.Context, claims *auth.AuthClaims) error {
+	if claims.SessionID == "" {
+		return nil
+	}
+	id, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return auth.ErrSessionRevoked
+	}
+	if active, _ := m.sessionRepository.IsActive(ctx, id); !active {
+		return auth.ErrSessionRevoked
+	}
+	return nil
+}
+
+// ListSessions lists the sessions started for a user
+func (m *MockAuthService) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	user, _ := m.userRepository.GetByUsername(ctx, username)
+	if user == nil {
+		return nil, auth.ErrUserNotFound
+	}
+	return m.sessionRepository.ListActive(ctx, user.ID)
+}
+
+// RevokeSession revokes one of a user's sessions
+func (m *MockAuthService) RevokeSession(ctx context.Context, username string, id uuid.UUID) error {
+	user, _ := m.userRepository.GetByUsername(ctx, username)
+	if user == nil {
+		return auth.ErrUserNotFound
+	}
+	if ok, _ := m.sessionRepository.Revoke(ctx, id, user.ID); !ok {
+		return auth.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessions revokes all of a user's sessions
+func (m *MockAuthService) RevokeSessions(ctx context.Context, username string) (int, error) {
+	return m.RevokeOtherSessions(ctx, username, uuid.Nil)
+}
+
+// RevokeOtherSessions revokes a user's sessions except keep
+func (m *MockAuthService) RevokeOtherSessions(ctx context.Context, username string, keep uuid.UUID) (int, error) {
+	user, _ := m.userRepository.GetByUsername(ctx, username)
+	if user == nil {
+		return 0, auth.ErrUserNotFound
+	}
+	ids, err := m.sessionRepository.RevokeForUser(ctx, user.ID, keep)
+	return len(ids), err
+}
+
+// Impersonate records an impersonation session of a non-admin user and returns a mock token
+func (m *MockAuthService) Impersonate(ctx context.Context, admin, username, reason string, client auth.ClientInfo) (string, *models.Session, error) {
+	user, _ := m.userRepository.GetByUsername(ctx, username)
+	if user == nil {
+		return "", nil, auth.ErrUserNotFound
+	}
+	if user.Role == models.RoleAdmin {
+		return "", nil, auth.ErrImpersonationNotAllowed
+	}
+
+	session := &models.Session{
+		UserID:         user.ID,
+		IPAddress:      client.IPAddress,
+		UserAgent:      client.UserAgent,
+		ExpiresAt:      time.Now().Add(15 * time.Minute),
+		ImpersonatedBy: &admin,
+	}
+	if err := m.sessionRepository.Create(ctx, session); err != nil {
+		return "", nil, err
+	}
+	err := m.sessionRepository.AddImpersonationAudit(ctx, &models.ImpersonationAuditEntry{
+		SessionID: session.ID,
+		Admin:     admin,
+		Username:  username,
+		Action:    models.ImpersonationStart,
+		Reason:    &reason,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return "mock-impersonation-token-for-" + username, session, nil
+}
+
+// RecordImpersonatedRequest adds a request made with an impersonation token to the audit trail
+func (m *MockAuthService) RecordImpersonatedRequest(ctx context.Context, claims *auth.AuthClaims, method, path string, status int) error {
+	sessionID, _ := uuid.Parse(claims.SessionID)
+	return m.sessionRepository.AddImpersonationAudit(ctx, &models.ImpersonationAuditEntry{
+		SessionID: sessionID,
+		Admin:     claims.ImpersonatedBy,
+		Username:  claims.Username,
+		Action:    models.ImpersonationRequest,
+		Method:    &method,
+		Path:      &path,
+		Status:    &status,
+	})
+}
+
+// ListImpersonationAudit lists the newest impersonation audit entries
+func (m *MockAuthService) ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error) {
+	return m.sessionRepository.ListImpersonationAudit(ctx, username, limit)
+}
+
 // Initialize mocks the initialization process
 func (m *MockAuthService) Initialize(ctx context.Context) error {
 	// Nothing to do for the mock
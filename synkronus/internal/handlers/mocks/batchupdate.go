@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/batchupdate"
+)
+
+// MockBatchUpdateService is a mock implementation of batchupdate.Service
+type MockBatchUpdateService struct {
+	PreviewFunc  func(ctx context.Context, req batchupdate.Request) (*batchupdate.Preview, error)
+	SubmitFunc   func(ctx context.Context, req batchupdate.Request, requestedBy string) (*batchupdate.Job, error)
+	GetJobFunc   func(ctx context.Context, id int64) (*batchupdate.Job, error)
+	ListJobsFunc func(ctx context.Context, limit int) ([]batchupdate.Job, error)
+}
+
+// NewMockBatchUpdateService creates a new mock batch update service
+func NewMockBatchUpdateService() *MockBatchUpdateService {
+	return &MockBatchUpdateService{}
+}
+
+// Initialize implements batchupdate.Service
+func (m *MockBatchUpdateService) Initialize(ctx context.Context) error { return nil }
+
+// Preview implements batchupdate.Service
+func (m *MockBatchUpdateService) Preview(ctx context.Context, req batchupdate.Request) (*batchupdate.Preview, error) {
+	if m.PreviewFunc != nil {
+		return m.PreviewFunc(ctx, req)
+	}
+	return &batchupdate.Preview{Changes: []batchupdate.Change{}}, nil
+}
+
+// Submit implements batchupdate.Service
+func (m *MockBatchUpdateService) Submit(ctx context.Context, req batchupdate.Request, requestedBy string) (*batchupdate.Job, error) {
+	if m.SubmitFunc != nil {
+		return m.SubmitFunc(ctx, req, requestedBy)
+	}
+	return &batchupdate.Job{ID: 1, Status: batchupdate.StatusQueued, Request: req, RequestedBy: requestedBy}, nil
+}
+
+// GetJob implements batchupdate.Service
+func (m *MockBatchUpdateService) GetJob(ctx context.Context, id int64) (*batchupdate.Job, error) {
+	if m.GetJobFunc != nil {
+		return m.GetJobFunc(ctx, id)
+	}
+	return nil, batchupdate.ErrJobNotFound
+}
+
+// ListJobs implements batchupdate.Service
+func (m *MockBatchUpdateService) ListJobs(ctx context.Context, limit int) ([]batchupdate.Job, error) {
+	if m.ListJobsFunc != nil {
+		return m.ListJobsFunc(ctx, limit)
+	}
+	return []batchupdate.Job{}, nil
+}
+
+// Ensure MockBatchUpdateService implements batchupdate.Service
+var _ batchupdate.Service = (*MockBatchUpdateService)(nil)
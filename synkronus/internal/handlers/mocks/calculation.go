@@ -0,0 +1,41 @@
+package mocks
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+)
+
+// MockCalculationService is a mock implementation of calculation.Service
+type MockCalculationService struct {
+	RecomputeFunc func(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []calculation.Mismatch, error)
+	BackfillFunc  func(ctx context.Context, query calculation.BackfillQuery) (*calculation.BackfillResult, error)
+}
+
+// NewMockCalculationService creates a new mock calculation service
+func NewMockCalculationService() *MockCalculationService {
+	return &MockCalculationService{}
+}
+
+// Recompute implements calculation.Service
+func (m *MockCalculationService) Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []calculation.Mismatch, error) {
+	if m.RecomputeFunc != nil {
+		return m.RecomputeFunc(ctx, formType, data)
+	}
+	return data, nil, nil
+}
+
+// Backfill implements calculation.Service
+func (m *MockCalculationService) Backfill(ctx context.Context, query calculation.BackfillQuery) (*calculation.BackfillResult, error) {
+	if m.BackfillFunc != nil {
+		return m.BackfillFunc(ctx, query)
+	}
+	return &calculation.BackfillResult{Forms: []calculation.FormBackfill{}}, nil
+}
+
+// Start implements calculation.Service
+func (m *MockCalculationService) Start(ctx context.Context) {}
+
+// Ensure MockCalculationService implements calculation.Service
+var _ calculation.Service = (*MockCalculationService)(nil)
@@ -0,0 +1,63 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/changefeed"
+)
+
+// MockChangeFeedService is a mock implementation of changefeed.Service
+type MockChangeFeedService struct {
+	StatusValue  changefeed.Status
+	ReplayFunc   func(ctx context.Context, fromSeq int64) (int64, error)
+	ReplayedFrom []int64
+	// SeqAfterVersion is returned by FirstSeqAfterVersion
+	SeqAfterVersion int64
+}
+
+// NewMockChangeFeedService creates a new mock change feed service with the change feed disabled
+func NewMockChangeFeedService() *MockChangeFeedService {
+	return &MockChangeFeedService{StatusValue: changefeed.Status{OldestReplayableSeq: 1}}
+}
+
+// Initialize implements changefeed.Service
+func (m *MockChangeFeedService) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Start implements changefeed.Service
+func (m *MockChangeFeedService) Start(ctx context.Context) {}
+
+// PublishPending implements changefeed.Service
+func (m *MockChangeFeedService) PublishPending(ctx context.Context) (int, error) {
+	if !m.StatusValue.Enabled {
+		return 0, changefeed.ErrDisabled
+	}
+	return 0, nil
+}
+
+// Status implements changefeed.Service
+func (m *MockChangeFeedService) Status(ctx context.Context) (*changefeed.Status, error) {
+	status := m.StatusValue
+	return &status, nil
+}
+
+// Replay implements changefeed.Service
+func (m *MockChangeFeedService) Replay(ctx context.Context, fromSeq int64) (int64, error) {
+	m.ReplayedFrom = append(m.ReplayedFrom, fromSeq)
+	if m.ReplayFunc != nil {
+		return m.ReplayFunc(ctx, fromSeq)
+	}
+	if !m.StatusValue.Enabled {
+		return 0, changefeed.ErrDisabled
+	}
+	return 0, nil
+}
+
+// FirstSeqAfterVersion implements changefeed.Service
+func (m *MockChangeFeedService) FirstSeqAfterVersion(ctx context.Context, version int64) (int64, error) {
+	return m.SeqAfterVersion, nil
+}
+
+// Ensure MockChangeFeedService implements changefeed.Service
+var _ changefeed.Service = (*MockChangeFeedService)(nil)
@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/checkpoint"
+)
+
+// MockCheckpointService is an in-memory implementation of checkpoint.Service
+type MockCheckpointService struct {
+	Version int64
+	Clients map[string]checkpoint.Client
+}
+
+// NewMockCheckpointService creates a new mock checkpoint service with no clients
+func NewMockCheckpointService() *MockCheckpointService {
+	return &MockCheckpointService{Clients: map[string]checkpoint.Client{}}
+}
+
+// Record implements checkpoint.Service
+func (m *MockCheckpointService) Record(ctx context.Context, cp checkpoint.Checkpoint) (*checkpoint.Client, error) {
+	if cp.ClientID == "" || cp.PulledVersion < 0 || cp.PushedCount < 0 {
+		return nil, checkpoint.ErrInvalidCheckpoint
+	}
+	if cp.PulledVersion > m.Version {
+		return nil, fmt.Errorf("%w (current version is %d)", checkpoint.ErrVersionAhead, m.Version)
+	}
+	client := m.Clients[cp.ClientID]
+	client.ClientID = cp.ClientID
+	if cp.Username != "" {
+		username := cp.Username
+		client.Username = &username
+	}
+	client.PulledVersion = cp.PulledVersion
+	client.PushedCount = cp.PushedCount
+	client.CheckpointAt = time.Now()
+	client.LastSeenAt = client.CheckpointAt
+	client.Stalled = false
+	m.Clients[cp.ClientID] = client
+
+	client = m.withBehind(client)
+	return &client, nil
+}
+
+// List implements checkpoint.Service
+func (m *MockCheckpointService) List(ctx context.Context, query checkpoint.Query) (*checkpoint.ClientList, error) {
+	list := &checkpoint.ClientList{CurrentVersion: m.Version, Clients: []checkpoint.Client{}}
+	for _, client := range m.Clients {
+		client = m.withBehind(client)
+		if client.Behind < query.MinBehind || (query.StalledOnly && !client.Stalled) {
+			continue
+		}
+		list.Clients = append(list.Clients, client)
+	}
+	sort.Slice(list.Clients, func(i, j int) bool {
+		if list.Clients[i].PulledVersion != list.Clients[j].PulledVersion {
+			return list.Clients[i].PulledVersion < list.Clients[j].PulledVersion
+		}
+		return list.Clients[i].ClientID < list.Clients[j].ClientID
+	})
+	return list, nil
+}
+
+// AlertStalled implements checkpoint.Service
+func (m *MockCheckpointService) AlertStalled(ctx context.Context) ([]checkpoint.Client, error) {
+	return []checkpoint.Client{}, nil
+}
+
+// Start implements checkpoint.Service
+func (m *MockCheckpointService) Start(ctx context.Context) {}
+
+func (m *MockCheckpointService) withBehind(client checkpoint.Client) checkpoint.Client {
+	client.Behind = 0
+	if m.Version > client.PulledVersion {
+		client.Behind = m.Version - client.PulledVersion
+	}
+	return client
+}
@@ -0,0 +1,28 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/completeness"
+)
+
+// MockCompletenessService is a mock implementation of completeness.Service
+type MockCompletenessService struct {
+	ReportFunc func(ctx context.Context, query completeness.Query) (*completeness.Report, error)
+}
+
+// NewMockCompletenessService creates a new mock completeness report service
+func NewMockCompletenessService() *MockCompletenessService {
+	return &MockCompletenessService{}
+}
+
+// Report implements completeness.Service
+func (m *MockCompletenessService) Report(ctx context.Context, query completeness.Query) (*completeness.Report, error) {
+	if m.ReportFunc != nil {
+		return m.ReportFunc(ctx, query)
+	}
+	return &completeness.Report{Forms: []completeness.FormReport{}}, nil
+}
+
+// Ensure MockCompletenessService implements completeness.Service
+var _ completeness.Service = (*MockCompletenessService)(nil)
@@ -11,5 +11,9 @@ func NewTestConfig() *config.Config {
 		JWTSecret:     "test-secret",
 		LogLevel:      "debug",
 		DataDir:       "./testdata",
+
+		InviteTTLHours: 72,
+
+		AppBundlePushMaxWaitSeconds: 300,
 	}
 }
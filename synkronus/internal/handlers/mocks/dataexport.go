@@ -10,6 +10,10 @@ import (
 // MockDataExportService is a mock implementation of dataexport.Service
 type MockDataExportService struct {
 	ExportParquetZipFunc func(ctx context.Context) (io.ReadCloser, error)
+	ExportCSVZipFunc     func(ctx context.Context) (io.ReadCloser, error)
+	ExportDeltaZipFunc   func(ctx context.Context) (io.ReadCloser, error)
+	ExportFHIRFunc       func(ctx context.Context) (io.ReadCloser, error)
+	ExportDuckDBFunc     func(ctx context.Context) (io.ReadCloser, error)
 }
 
 // NewMockDataExportService creates a new mock data export service
@@ -25,5 +29,37 @@ func (m *MockDataExportService) ExportParquetZip(ctx context.Context) (io.ReadCl
 	return io.NopCloser(io.LimitReader(nil, 0)), nil
 }
 
+// ExportCSVZip implements dataexport.Service
+func (m *MockDataExportService) ExportCSVZip(ctx context.Context) (io.ReadCloser, error) {
+	if m.ExportCSVZipFunc != nil {
+		return m.ExportCSVZipFunc(ctx)
+	}
+	return io.NopCloser(io.LimitReader(nil, 0)), nil
+}
+
+// ExportDeltaZip implements dataexport.Service
+func (m *MockDataExportService) ExportDeltaZip(ctx context.Context) (io.ReadCloser, error) {
+	if m.ExportDeltaZipFunc != nil {
+		return m.ExportDeltaZipFunc(ctx)
+	}
+	return io.NopCloser(io.LimitReader(nil, 0)), nil
+}
+
+// ExportFHIR implements dataexport.Service
+func (m *MockDataExportService) ExportFHIR(ctx context.Context) (io.ReadCloser, error) {
+	if m.ExportFHIRFunc != nil {
+		return m.ExportFHIRFunc(ctx)
+	}
+	return io.NopCloser(io.LimitReader(nil, 0)), nil
+}
+
+// ExportDuckDB implements dataexport.Service
+func (m *MockDataExportService) ExportDuckDB(ctx context.Context) (io.ReadCloser, error) {
+	if m.ExportDuckDBFunc != nil {
+		return m.ExportDuckDBFunc(ctx)
+	}
+	return io.NopCloser(io.LimitReader(nil, 0)), nil
+}
+
 // Ensure MockDataExportService implements dataexport.Service
 var _ dataexport.Service = (*MockDataExportService)(nil)
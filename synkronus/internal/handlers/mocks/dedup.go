@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/dedup"
+)
+
+// MockDedupService is a mock implementation of dedup.Service
+type MockDedupService struct {
+	ReportFunc func(ctx context.Context, query dedup.Query) (*dedup.Report, error)
+	MergeFunc  func(ctx context.Context, req dedup.MergeRequest, mergedBy string) (*dedup.MergeResult, error)
+}
+
+// NewMockDedupService creates a new mock deduplication service
+func NewMockDedupService() *MockDedupService {
+	return &MockDedupService{}
+}
+
+// Report implements dedup.Service
+func (m *MockDedupService) Report(ctx context.Context, query dedup.Query) (*dedup.Report, error) {
+	if m.ReportFunc != nil {
+		return m.ReportFunc(ctx, query)
+	}
+	return &dedup.Report{Clusters: []dedup.Cluster{}}, nil
+}
+
+// Merge implements dedup.Service
+func (m *MockDedupService) Merge(ctx context.Context, req dedup.MergeRequest, mergedBy string) (*dedup.MergeResult, error) {
+	if m.MergeFunc != nil {
+		return m.MergeFunc(ctx, req, mergedBy)
+	}
+	return &dedup.MergeResult{Winner: req.Winner, Losers: req.Losers, Attachments: []dedup.MergedAttachment{}}, nil
+}
+
+// Ensure MockDedupService implements dedup.Service
+var _ dedup.Service = (*MockDedupService)(nil)
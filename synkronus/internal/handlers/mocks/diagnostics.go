@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/diagnostics"
+)
+
+// MockDiagnosticsService is a mock implementation of diagnostics.Service
+type MockDiagnosticsService struct {
+	EnsureIndexesFunc func(ctx context.Context) ([]string, error)
+	ReportFunc        func(ctx context.Context) (*diagnostics.Report, error)
+	// Health is returned by ConnectionHealth; the zero value reports ok
+	Health database.Health
+}
+
+// NewMockDiagnosticsService creates a new mock diagnostics service
+func NewMockDiagnosticsService() *MockDiagnosticsService {
+	return &MockDiagnosticsService{}
+}
+
+// EnsureIndexes implements diagnostics.Service
+func (m *MockDiagnosticsService) EnsureIndexes(ctx context.Context) ([]string, error) {
+	if m.EnsureIndexesFunc != nil {
+		return m.EnsureIndexesFunc(ctx)
+	}
+	return nil, nil
+}
+
+// Report implements diagnostics.Service
+func (m *MockDiagnosticsService) Report(ctx context.Context) (*diagnostics.Report, error) {
+	if m.ReportFunc != nil {
+		return m.ReportFunc(ctx)
+	}
+	return &diagnostics.Report{
+		MissingIndexes: []diagnostics.RequiredIndex{},
+		Tables:         []diagnostics.TableScanStats{},
+		SlowQueries:    []diagnostics.SlowQuery{},
+		GeneratedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// ConnectionHealth implements diagnostics.Service
+func (m *MockDiagnosticsService) ConnectionHealth(ctx context.Context) database.Health {
+	if m.Health.Status == "" {
+		return database.Health{Status: database.HealthOK}
+	}
+	return m.Health
+}
+
+// Ensure MockDiagnosticsService implements diagnostics.Service
+var _ diagnostics.Service = (*MockDiagnosticsService)(nil)
@@ -0,0 +1,89 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/exportconsumer"
+)
+
+// MockExportConsumerService is an in-memory implementation of exportconsumer.Service
+type MockExportConsumerService struct {
+	Version   int64
+	Consumers map[string]exportconsumer.Consumer
+}
+
+// NewMockExportConsumerService creates a new mock export consumer service with no consumers
+func NewMockExportConsumerService() *MockExportConsumerService {
+	return &MockExportConsumerService{Consumers: map[string]exportconsumer.Consumer{}}
+}
+
+// CurrentVersion implements exportconsumer.Service
+func (m *MockExportConsumerService) CurrentVersion(ctx context.Context) (int64, error) {
+	return m.Version, nil
+}
+
+// List implements exportconsumer.Service
+func (m *MockExportConsumerService) List(ctx context.Context) ([]exportconsumer.Consumer, error) {
+	list := []exportconsumer.Consumer{}
+	for _, consumer := range m.Consumers {
+		list = append(list, m.withLag(consumer))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get implements exportconsumer.Service
+func (m *MockExportConsumerService) Get(ctx context.Context, name string) (*exportconsumer.Consumer, error) {
+	consumer, ok := m.Consumers[name]
+	if !ok {
+		return nil, exportconsumer.ErrNotFound
+	}
+	consumer = m.withLag(consumer)
+	return &consumer, nil
+}
+
+// Ack implements exportconsumer.Service
+func (m *MockExportConsumerService) Ack(ctx context.Context, name string, version int64, reset bool, ackedBy string) (*exportconsumer.Consumer, error) {
+	if !exportconsumer.ValidName(name) {
+		return nil, exportconsumer.ErrInvalidName
+	}
+	if version > m.Version {
+		return nil, fmt.Errorf("%w (current version is %d)", exportconsumer.ErrVersionAhead, m.Version)
+	}
+	now := time.Now()
+	consumer, ok := m.Consumers[name]
+	if ok && !reset && version < consumer.AckedVersion {
+		return nil, exportconsumer.ErrVersionBehind
+	}
+	if !ok {
+		consumer = exportconsumer.Consumer{Name: name, CreatedAt: now}
+	}
+	consumer.AckedVersion = version
+	consumer.AckedAt = now
+	consumer.AckedBy = &ackedBy
+	m.Consumers[name] = consumer
+	consumer = m.withLag(consumer)
+	return &consumer, nil
+}
+
+// Delete implements exportconsumer.Service
+func (m *MockExportConsumerService) Delete(ctx context.Context, name string) error {
+	if _, ok := m.Consumers[name]; !ok {
+		return exportconsumer.ErrNotFound
+	}
+	delete(m.Consumers, name)
+	return nil
+}
+
+func (m *MockExportConsumerService) withLag(consumer exportconsumer.Consumer) exportconsumer.Consumer {
+	if m.Version > consumer.AckedVersion {
+		consumer.Lag = m.Version - consumer.AckedVersion
+	}
+	return consumer
+}
+
+// Ensure MockExportConsumerService implements exportconsumer.Service
+var _ exportconsumer.Service = (*MockExportConsumerService)(nil)
@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+)
+
+// MockExportReportService is an in-memory implementation of exportreport.Service
+type MockExportReportService struct {
+	Reports map[string]exportreport.Definition
+	// RunFunc answers Run; by default reports return no rows
+	RunFunc func(ctx context.Context, definition *exportreport.Definition, values map[string]string) (*exportreport.Result, error)
+}
+
+// NewMockExportReportService creates a new mock export report service with no reports
+func NewMockExportReportService() *MockExportReportService {
+	return &MockExportReportService{Reports: map[string]exportreport.Definition{}}
+}
+
+// List implements exportreport.Service
+func (m *MockExportReportService) List(ctx context.Context) ([]exportreport.Definition, error) {
+	list := []exportreport.Definition{}
+	for _, definition := range m.Reports {
+		list = append(list, definition)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get implements exportreport.Service
+func (m *MockExportReportService) Get(ctx context.Context, name string) (*exportreport.Definition, error) {
+	definition, ok := m.Reports[name]
+	if !ok {
+		return nil, exportreport.ErrNotFound
+	}
+	return &definition, nil
+}
+
+// Save implements exportreport.Service
+func (m *MockExportReportService) Save(ctx context.Context, definition exportreport.Definition, savedBy string) (*exportreport.Definition, error) {
+	if !exportreport.ValidName(definition.Name) {
+		return nil, exportreport.ErrInvalidName
+	}
+	if (definition.SQL == "") == (definition.Spec == nil) {
+		return nil, exportreport.ErrInvalidDefinition
+	}
+	now := time.Now()
+	if existing, ok := m.Reports[definition.Name]; ok {
+		definition.CreatedBy, definition.CreatedAt = existing.CreatedBy, existing.CreatedAt
+	} else {
+		definition.CreatedBy, definition.CreatedAt = &savedBy, now
+	}
+	definition.UpdatedBy, definition.UpdatedAt = &savedBy, now
+	m.Reports[definition.Name] = definition
+	return &definition, nil
+}
+
+// Delete implements exportreport.Service
+func (m *MockExportReportService) Delete(ctx context.Context, name string) error {
+	if _, ok := m.Reports[name]; !ok {
+		return exportreport.ErrNotFound
+	}
+	delete(m.Reports, name)
+	return nil
+}
+
+// Run implements exportreport.Service
+func (m *MockExportReportService) Run(ctx context.Context, definition *exportreport.Definition, values map[string]string) (*exportreport.Result, error) {
+	if m.RunFunc != nil {
+		return m.RunFunc(ctx, definition, values)
+	}
+	return &exportreport.Result{}, nil
+}
+
+var _ exportreport.Service = (*MockExportReportService)(nil)
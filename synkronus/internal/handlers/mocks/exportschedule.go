@@ -0,0 +1,88 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/exportschedule"
+)
+
+// MockExportScheduleService is an in-memory implementation of exportschedule.Service
+type MockExportScheduleService struct {
+	Schedules map[string]exportschedule.Schedule
+	// RunFunc answers RunNow; by default runs succeed without rows
+	RunFunc func(ctx context.Context, schedule *exportschedule.Schedule) *exportschedule.RunResult
+}
+
+// NewMockExportScheduleService creates a new mock export schedule service with no schedules
+func NewMockExportScheduleService() *MockExportScheduleService {
+	return &MockExportScheduleService{Schedules: map[string]exportschedule.Schedule{}}
+}
+
+// List implements exportschedule.Service
+func (m *MockExportScheduleService) List(ctx context.Context) ([]exportschedule.Schedule, error) {
+	list := []exportschedule.Schedule{}
+	for _, schedule := range m.Schedules {
+		list = append(list, schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get implements exportschedule.Service
+func (m *MockExportScheduleService) Get(ctx context.Context, name string) (*exportschedule.Schedule, error) {
+	schedule, ok := m.Schedules[name]
+	if !ok {
+		return nil, exportschedule.ErrNotFound
+	}
+	return &schedule, nil
+}
+
+// Save implements exportschedule.Service
+func (m *MockExportScheduleService) Save(ctx context.Context, schedule exportschedule.Schedule, savedBy string) (*exportschedule.Schedule, error) {
+	if !exportschedule.ValidName(schedule.Name) {
+		return nil, exportschedule.ErrInvalidName
+	}
+	cron, err := exportschedule.ParseCron(schedule.Cron)
+	if err != nil {
+		return nil, exportschedule.ErrInvalidSchedule
+	}
+	now := time.Now()
+	next := cron.Next(now)
+	schedule.NextRunAt = &next
+	if existing, ok := m.Schedules[schedule.Name]; ok {
+		schedule.CreatedBy, schedule.CreatedAt = existing.CreatedBy, existing.CreatedAt
+	} else {
+		schedule.CreatedBy, schedule.CreatedAt = &savedBy, now
+	}
+	schedule.UpdatedBy, schedule.UpdatedAt = &savedBy, now
+	m.Schedules[schedule.Name] = schedule
+	return &schedule, nil
+}
+
+// Delete implements exportschedule.Service
+func (m *MockExportScheduleService) Delete(ctx context.Context, name string) error {
+	if _, ok := m.Schedules[name]; !ok {
+		return exportschedule.ErrNotFound
+	}
+	delete(m.Schedules, name)
+	return nil
+}
+
+// RunNow implements exportschedule.Service
+func (m *MockExportScheduleService) RunNow(ctx context.Context, name string) (*exportschedule.RunResult, error) {
+	schedule, ok := m.Schedules[name]
+	if !ok {
+		return nil, exportschedule.ErrNotFound
+	}
+	if m.RunFunc != nil {
+		return m.RunFunc(ctx, &schedule), nil
+	}
+	return &exportschedule.RunResult{Schedule: name, Report: schedule.Report, Status: exportschedule.StatusOK, RanAt: time.Now()}, nil
+}
+
+// Start implements exportschedule.Service; the mock never runs schedules on its own
+func (m *MockExportScheduleService) Start(ctx context.Context) {}
+
+var _ exportschedule.Service = (*MockExportScheduleService)(nil)
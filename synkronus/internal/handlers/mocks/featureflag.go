@@ -0,0 +1,68 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+
+	"github.com/opendataensemble/synkronus/pkg/featureflag"
+)
+
+// MockFeatureFlagService is an in-memory implementation of featureflag.Service
+type MockFeatureFlagService struct {
+	Flags map[string]bool
+
+	SetFunc func(ctx context.Context, name string, enabled bool, description, updatedBy string) (*featureflag.Flag, error)
+}
+
+// NewMockFeatureFlagService creates a new mock feature flag service with all flags off
+func NewMockFeatureFlagService() *MockFeatureFlagService {
+	return &MockFeatureFlagService{Flags: map[string]bool{}}
+}
+
+// IsEnabled implements featureflag.Service
+func (m *MockFeatureFlagService) IsEnabled(ctx context.Context, name string) bool {
+	return m.Flags[name]
+}
+
+// Active implements featureflag.Service
+func (m *MockFeatureFlagService) Active(ctx context.Context) []string {
+	active := []string{}
+	for name, enabled := range m.Flags {
+		if enabled {
+			active = append(active, name)
+		}
+	}
+	sort.Strings(active)
+	return active
+}
+
+// List implements featureflag.Service
+func (m *MockFeatureFlagService) List(ctx context.Context) ([]featureflag.Flag, error) {
+	list := []featureflag.Flag{}
+	for name, enabled := range m.Flags {
+		list = append(list, featureflag.Flag{Name: name, Enabled: enabled})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Set implements featureflag.Service
+func (m *MockFeatureFlagService) Set(ctx context.Context, name string, enabled bool, description, updatedBy string) (*featureflag.Flag, error) {
+	if m.SetFunc != nil {
+		return m.SetFunc(ctx, name, enabled, description, updatedBy)
+	}
+	m.Flags[name] = enabled
+	return &featureflag.Flag{Name: name, Enabled: enabled, Description: description, UpdatedBy: &updatedBy}, nil
+}
+
+// Reset implements featureflag.Service
+func (m *MockFeatureFlagService) Reset(ctx context.Context, name string) error {
+	if _, ok := m.Flags[name]; !ok {
+		return featureflag.ErrFlagNotFound
+	}
+	delete(m.Flags, name)
+	return nil
+}
+
+// Ensure MockFeatureFlagService implements featureflag.Service
+var _ featureflag.Service = (*MockFeatureFlagService)(nil)
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/formmigration"
+)
+
+// MockFormMigrationService is a mock implementation of formmigration.Service
+type MockFormMigrationService struct {
+	RunFunc  func(ctx context.Context, req formmigration.Request, requestedBy string) (*formmigration.Result, error)
+	Requests []formmigration.Request
+}
+
+// NewMockFormMigrationService creates a new mock form migration service that can't run scripts
+func NewMockFormMigrationService() *MockFormMigrationService {
+	return &MockFormMigrationService{}
+}
+
+// Run implements formmigration.Service
+func (m *MockFormMigrationService) Run(ctx context.Context, req formmigration.Request, requestedBy string) (*formmigration.Result, error) {
+	m.Requests = append(m.Requests, req)
+	if m.RunFunc != nil {
+		return m.RunFunc(ctx, req, requestedBy)
+	}
+	return nil, formmigration.ErrUnavailable
+}
+
+// Ensure MockFormMigrationService implements formmigration.Service
+var _ formmigration.Service = (*MockFormMigrationService)(nil)
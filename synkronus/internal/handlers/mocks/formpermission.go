@@ -0,0 +1,89 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/formpermission"
+)
+
+// MockFormPermissionService is an in-memory implementation of formpermission.Service
+type MockFormPermissionService struct {
+	Grants map[int64]formpermission.Grant
+	next   int64
+}
+
+// NewMockFormPermissionService creates a new mock form permission service without grants
+func NewMockFormPermissionService() *MockFormPermissionService {
+	return &MockFormPermissionService{Grants: map[int64]formpermission.Grant{}}
+}
+
+// List implements formpermission.Service
+func (m *MockFormPermissionService) List(ctx context.Context, filter formpermission.Filter) ([]formpermission.Grant, error) {
+	grants := []formpermission.Grant{}
+	for _, grant := range m.Grants {
+		if (filter.FormType == "" || grant.FormType == filter.FormType) &&
+			(filter.Role == "" || grant.Role == filter.Role) &&
+			(filter.Username == "" || grant.Username == filter.Username) {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].ID < grants[j].ID })
+	return grants, nil
+}
+
+// Grant implements formpermission.Service
+func (m *MockFormPermissionService) Grant(ctx context.Context, grant formpermission.Grant, createdBy string) (*formpermission.Grant, error) {
+	if grant.FormType == "" || (grant.Role == "") == (grant.Username == "") {
+		return nil, formpermission.ErrInvalidGrant
+	}
+	if grant.Role != "" && grant.Role != models.RoleReadOnly && grant.Role != models.RoleReadWrite && grant.Role != models.RoleAdmin {
+		return nil, fmt.Errorf("%w %q", formpermission.ErrUnknownRole, grant.Role)
+	}
+	for _, existing := range m.Grants {
+		if existing.FormType == grant.FormType && existing.Role == grant.Role && existing.Username == grant.Username {
+			return &existing, nil
+		}
+	}
+	m.next++
+	grant.ID = m.next
+	grant.CreatedAt = time.Now()
+	grant.CreatedBy = createdBy
+	m.Grants[grant.ID] = grant
+	return &grant, nil
+}
+
+// Revoke implements formpermission.Service
+func (m *MockFormPermissionService) Revoke(ctx context.Context, id int64) error {
+	if _, ok := m.Grants[id]; !ok {
+		return formpermission.ErrGrantNotFound
+	}
+	delete(m.Grants, id)
+	return nil
+}
+
+// DeniedFormTypes implements formpermission.Service; role grants only match the exact role
+func (m *MockFormPermissionService) DeniedFormTypes(ctx context.Context, user *models.User) ([]string, error) {
+	if user == nil || user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	granted := map[string]bool{}
+	all := map[string]bool{}
+	for _, grant := range m.Grants {
+		all[grant.FormType] = true
+		if grant.Username == user.Username || grant.Role == user.Role {
+			granted[grant.FormType] = true
+		}
+	}
+	var denied []string
+	for formType := range all {
+		if !granted[formType] {
+			denied = append(denied, formType)
+		}
+	}
+	sort.Strings(denied)
+	return denied, nil
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/maintenance"
+)
+
+// MockMaintenanceService is an in-memory implementation of maintenance.Service
+type MockMaintenanceService struct {
+	State maintenance.State
+}
+
+// NewMockMaintenanceService creates a new mock maintenance service with maintenance off
+func NewMockMaintenanceService() *MockMaintenanceService {
+	return &MockMaintenanceService{State: maintenance.State{RetryAfterSeconds: 300}}
+}
+
+// Current implements maintenance.Service
+func (m *MockMaintenanceService) Current(ctx context.Context) maintenance.State {
+	return m.State
+}
+
+// Get implements maintenance.Service
+func (m *MockMaintenanceService) Get(ctx context.Context) (*maintenance.State, error) {
+	state := m.State
+	return &state, nil
+}
+
+// Set implements maintenance.Service
+func (m *MockMaintenanceService) Set(ctx context.Context, enabled bool, message string, retryAfterSeconds int, updatedBy string) (*maintenance.State, error) {
+	if retryAfterSeconds < 0 {
+		return nil, maintenance.ErrInvalidRetryAfter
+	}
+	if retryAfterSeconds == 0 {
+		retryAfterSeconds = 300
+	}
+	m.State = maintenance.State{Enabled: enabled, Message: message, RetryAfterSeconds: retryAfterSeconds, UpdatedBy: &updatedBy}
+	state := m.State
+	return &state, nil
+}
+
+// Ensure MockMaintenanceService implements maintenance.Service
+var _ maintenance.Service = (*MockMaintenanceService)(nil)
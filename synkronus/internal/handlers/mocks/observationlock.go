@@ -0,0 +1,99 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+)
+
+// MockObservationLockService is an in-memory implementation of observationlock.Service
+type MockObservationLockService struct {
+	Locks map[string]observationlock.Lock
+	// Observations lists the observations that can be locked; nil allows any
+	Observations map[string]bool
+}
+
+// NewMockObservationLockService creates a new mock observation lock service with no locks
+func NewMockObservationLockService() *MockObservationLockService {
+	return &MockObservationLockService{Locks: map[string]observationlock.Lock{}}
+}
+
+// Acquire implements observationlock.Service
+func (m *MockObservationLockService) Acquire(ctx context.Context, observationID, owner, reason string, ttl time.Duration, force bool) (*observationlock.Lock, error) {
+	if m.Observations != nil && !m.Observations[observationID] {
+		return nil, observationlock.ErrObservationNotFound
+	}
+	if ttl < 0 {
+		return nil, observationlock.ErrInvalidTTL
+	}
+	if ttl == 0 {
+		ttl = 30 * time.Minute
+	}
+	now := time.Now()
+	lock, held := m.active(observationID)
+	if held && lock.Owner != owner && !force {
+		return nil, &observationlock.LockedError{Lock: lock}
+	}
+	if !held || lock.Owner != owner {
+		lock = observationlock.Lock{ObservationID: observationID, Owner: owner, AcquiredAt: now}
+	}
+	lock.Reason = reason
+	lock.ExpiresAt = now.Add(ttl)
+	m.Locks[observationID] = lock
+	return &lock, nil
+}
+
+// Release implements observationlock.Service
+func (m *MockObservationLockService) Release(ctx context.Context, observationID, owner string, force bool) error {
+	lock, held := m.active(observationID)
+	if !held {
+		return observationlock.ErrNotLocked
+	}
+	if lock.Owner != owner && !force {
+		return &observationlock.LockedError{Lock: lock}
+	}
+	delete(m.Locks, observationID)
+	return nil
+}
+
+// Get implements observationlock.Service
+func (m *MockObservationLockService) Get(ctx context.Context, observationID string) (*observationlock.Lock, error) {
+	lock, held := m.active(observationID)
+	if !held {
+		return nil, observationlock.ErrNotLocked
+	}
+	return &lock, nil
+}
+
+// List implements observationlock.Service
+func (m *MockObservationLockService) List(ctx context.Context) ([]observationlock.Lock, error) {
+	locks := []observationlock.Lock{}
+	for id := range m.Locks {
+		if lock, held := m.active(id); held {
+			locks = append(locks, lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].ExpiresAt.Before(locks[j].ExpiresAt) })
+	return locks, nil
+}
+
+// HeldByOthers implements observationlock.Service
+func (m *MockObservationLockService) HeldByOthers(ctx context.Context, observationIDs []string, username string) (map[string]observationlock.Lock, error) {
+	held := make(map[string]observationlock.Lock)
+	for _, id := range observationIDs {
+		if lock, ok := m.active(id); ok && lock.Owner != username {
+			held[id] = lock
+		}
+	}
+	return held, nil
+}
+
+func (m *MockObservationLockService) active(observationID string) (observationlock.Lock, bool) {
+	lock, ok := m.Locks[observationID]
+	return lock, ok && lock.ExpiresAt.After(time.Now())
+}
+
+// Ensure MockObservationLockService implements observationlock.Service
+var _ observationlock.Service = (*MockObservationLockService)(nil)
@@ -0,0 +1,103 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
+)
+
+// MockPayloadCryptoService is an in-memory implementation of payloadcrypto.Service that
+// derives real session keys
+type MockPayloadCryptoService struct {
+	ModeValue payloadcrypto.Mode
+	// MaxBodySizeValue is the body size limit; the default configuration's when 0
+	MaxBodySizeValue int64
+	Keys             map[string]payloadcrypto.Key
+	// Material holds the session keys by key ID
+	Material map[string][]byte
+	next     int
+}
+
+// NewMockPayloadCryptoService creates a new mock payload key service with encryption off
+func NewMockPayloadCryptoService() *MockPayloadCryptoService {
+	return &MockPayloadCryptoService{
+		ModeValue: payloadcrypto.ModeOff,
+		Keys:      map[string]payloadcrypto.Key{},
+		Material:  map[string][]byte{},
+	}
+}
+
+// AddKey stores a session key for username
+func (m *MockPayloadCryptoService) AddKey(keyID, username string, material []byte) {
+	now := time.Now()
+	m.Keys[keyID] = payloadcrypto.Key{KeyID: keyID, Username: username, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	m.Material[keyID] = material
+}
+
+// Mode implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) Mode() payloadcrypto.Mode {
+	return m.ModeValue
+}
+
+// MaxBodySize implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) MaxBodySize() int64 {
+	if m.MaxBodySizeValue == 0 {
+		return payloadcrypto.DefaultConfig().MaxBodySize
+	}
+	return m.MaxBodySizeValue
+}
+
+// Negotiate implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) Negotiate(ctx context.Context, username, clientPublicKey string) (*payloadcrypto.Negotiation, error) {
+	if m.ModeValue == payloadcrypto.ModeOff {
+		return nil, payloadcrypto.ErrDisabled
+	}
+	m.next++
+	keyID := fmt.Sprintf("key-%d", m.next)
+	serverPublicKey, material, err := payloadcrypto.DeriveServerKey(clientPublicKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+	m.AddKey(keyID, username, material)
+	return &payloadcrypto.Negotiation{
+		KeyID:           keyID,
+		ServerPublicKey: serverPublicKey,
+		Algorithm:       payloadcrypto.Algorithm,
+		ExpiresAt:       m.Keys[keyID].ExpiresAt,
+	}, nil
+}
+
+// SessionKey implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) SessionKey(ctx context.Context, keyID, username string) ([]byte, error) {
+	key, ok := m.Keys[keyID]
+	if !ok || key.Username != username || !key.ExpiresAt.After(time.Now()) {
+		return nil, payloadcrypto.ErrKeyNotFound
+	}
+	return m.Material[keyID], nil
+}
+
+// List implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) List(ctx context.Context, username string) ([]payloadcrypto.Key, error) {
+	keys := []payloadcrypto.Key{}
+	for _, key := range m.Keys {
+		if username == "" || key.Username == username {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys, nil
+}
+
+// Revoke implements payloadcrypto.Service
+func (m *MockPayloadCryptoService) Revoke(ctx context.Context, keyID, username string, force bool) error {
+	key, ok := m.Keys[keyID]
+	if !ok || (key.Username != username && !force) {
+		return payloadcrypto.ErrKeyNotFound
+	}
+	delete(m.Keys, keyID)
+	delete(m.Material, keyID)
+	return nil
+}
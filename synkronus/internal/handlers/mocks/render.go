@@ -0,0 +1,28 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/render"
+)
+
+// MockRenderService is a mock implementation of render.Service
+type MockRenderService struct {
+	ObservationPDFFunc func(ctx context.Context, observationID string) (*render.PDF, error)
+}
+
+// NewMockRenderService creates a new mock rendering service
+func NewMockRenderService() *MockRenderService {
+	return &MockRenderService{}
+}
+
+// ObservationPDF implements render.Service
+func (m *MockRenderService) ObservationPDF(ctx context.Context, observationID string) (*render.PDF, error) {
+	if m.ObservationPDFFunc != nil {
+		return m.ObservationPDFFunc(ctx, observationID)
+	}
+	return nil, render.ErrObservationNotFound
+}
+
+// Ensure MockRenderService implements render.Service
+var _ render.Service = (*MockRenderService)(nil)
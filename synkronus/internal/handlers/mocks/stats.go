@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/stats"
+)
+
+// MockStatsService is a mock implementation of stats.Service
+type MockStatsService struct {
+	RefreshFunc             func(ctx context.Context) error
+	GetObservationStatsFunc func(ctx context.Context, query stats.Query) (*stats.ObservationStats, error)
+}
+
+// NewMockStatsService creates a new mock stats service
+func NewMockStatsService() *MockStatsService {
+	return &MockStatsService{}
+}
+
+// Refresh implements stats.Service
+func (m *MockStatsService) Refresh(ctx context.Context) error {
+	if m.RefreshFunc != nil {
+		return m.RefreshFunc(ctx)
+	}
+	return nil
+}
+
+// GetObservationStats implements stats.Service
+func (m *MockStatsService) GetObservationStats(ctx context.Context, query stats.Query) (*stats.ObservationStats, error) {
+	if m.GetObservationStatsFunc != nil {
+		return m.GetObservationStatsFunc(ctx, query)
+	}
+	return &stats.ObservationStats{GroupBy: query.GroupBy, Buckets: []stats.Bucket{}}, nil
+}
+
+// Start implements stats.Service
+func (m *MockStatsService) Start(ctx context.Context) {}
+
+// Ensure MockStatsService implements stats.Service
+var _ stats.Service = (*MockStatsService)(nil)
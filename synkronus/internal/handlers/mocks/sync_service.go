@@ -12,6 +12,16 @@ type MockSyncService struct {
 	currentVersion int64
 	observations   []sync.Observation
 	initialized    bool
+
+	// AcknowledgeWarningsFunc and GetWarningSummaryFunc override the default behavior
+	AcknowledgeWarningsFunc func(ctx context.Context, clientID string, ack sync.WarningAck) (int64, error)
+	GetWarningSummaryFunc   func(ctx context.Context, query sync.WarningQuery) ([]sync.WarningSummary, error)
+
+	// ListSubmissionsFunc overrides the default behavior of ListSubmissions
+	ListSubmissionsFunc func(ctx context.Context, query sync.SubmissionQuery) (*sync.SubmissionPage, error)
+
+	// ListByCoreIDFunc overrides the default behavior of ListByCoreID
+	ListByCoreIDFunc func(ctx context.Context, query sync.CoreIDQuery) (*sync.CoreIDPage, error)
 }
 
 // NewMockSyncService creates a new mock sync service
@@ -44,9 +54,10 @@ func (m *MockSyncService) GetRecordsSinceVersion(ctx context.Context, sinceVersi
 	}
 
 	// Filter observations by version
+	coreID := sync.CoreIDOf(ctx)
 	var filteredRecords []sync.Observation
 	for _, obs := range m.observations {
-		if obs.Version > sinceVersion {
+		if obs.Version > sinceVersion && (coreID == "" || obs.CoreID() == coreID) {
 			// Apply schema type filter if specified
 			if len(schemaTypes) > 0 {
 				found := false
@@ -97,6 +108,8 @@ func (m *MockSyncService) ProcessPushedRecords(ctx context.Context, records []sy
 	var successCount int
 	var failedRecords []map[string]interface{}
 	var warnings []sync.SyncWarning
+	var outcomes []sync.RecordOutcome
+	dryRun := sync.IsDryRun(ctx)
 
 	for i, record := range records {
 		// Basic validation
@@ -106,18 +119,33 @@ func (m *MockSyncService) ProcessPushedRecords(ctx context.Context, records []sy
 				"error":  "observation_id is required",
 				"record": record,
 			})
+			outcomes = append(outcomes, sync.RecordOutcome{Index: i, Outcome: sync.OutcomeFailed})
 			continue
 		}
 
 		// Generate warnings for missing optional fields
 		if record.FormType == "" {
 			warnings = append(warnings, sync.SyncWarning{
-				ID:      record.ObservationID,
-				Code:    "MISSING_FORM_TYPE",
-				Message: "form_type is empty but record was processed",
+				ID:       record.ObservationID,
+				Code:     sync.WarningMissingFormType,
+				Severity: sync.SeverityWarning,
+				Message:  "form_type is empty but record was processed",
 			})
 		}
 
+		// Dry runs store nothing
+		if dryRun {
+			outcome := sync.OutcomeCreate
+			for _, stored := range m.observations {
+				if stored.ObservationID == record.ObservationID {
+					outcome = sync.OutcomeUpdate
+				}
+			}
+			outcomes = append(outcomes, sync.RecordOutcome{Index: i, ObservationID: record.ObservationID, Outcome: outcome})
+			successCount++
+			continue
+		}
+
 		// Mock successful processing - add to observations
 		record.Version = m.currentVersion + 1
 		m.observations = append(m.observations, record)
@@ -125,10 +153,53 @@ func (m *MockSyncService) ProcessPushedRecords(ctx context.Context, records []sy
 		successCount++
 	}
 
-	return &sync.SyncPushResult{
+	result := &sync.SyncPushResult{
 		CurrentVersion: m.currentVersion,
 		SuccessCount:   successCount,
 		FailedRecords:  failedRecords,
 		Warnings:       warnings,
-	}, nil
+	}
+	if dryRun {
+		result.DryRun, result.Outcomes = true, outcomes
+	}
+	return result, nil
+}
+
+// AcknowledgeWarnings mocks acknowledging warnings; by default every selector matches one warning
+func (m *MockSyncService) AcknowledgeWarnings(ctx context.Context, clientID string, ack sync.WarningAck) (int64, error) {
+	if m.AcknowledgeWarningsFunc != nil {
+		return m.AcknowledgeWarningsFunc(ctx, clientID, ack)
+	}
+	return int64(len(ack.IDs) + len(ack.Codes)), nil
+}
+
+// GetWarningSummary mocks the warning summary; by default there are no warnings
+func (m *MockSyncService) GetWarningSummary(ctx context.Context, query sync.WarningQuery) ([]sync.WarningSummary, error) {
+	if m.GetWarningSummaryFunc != nil {
+		return m.GetWarningSummaryFunc(ctx, query)
+	}
+	return []sync.WarningSummary{}, nil
+}
+
+// ListSubmissions mocks listing a user's submissions; by default there are none
+func (m *MockSyncService) ListSubmissions(ctx context.Context, query sync.SubmissionQuery) (*sync.SubmissionPage, error) {
+	if m.ListSubmissionsFunc != nil {
+		return m.ListSubmissionsFunc(ctx, query)
+	}
+	return &sync.SubmissionPage{Submissions: []sync.Submission{}}, nil
+}
+
+// ListByCoreID mocks listing the observations of a core ID from the stored observations
+func (m *MockSyncService) ListByCoreID(ctx context.Context, query sync.CoreIDQuery) (*sync.CoreIDPage, error) {
+	if m.ListByCoreIDFunc != nil {
+		return m.ListByCoreIDFunc(ctx, query)
+	}
+	page := &sync.CoreIDPage{Observations: []sync.Observation{}}
+	for _, obs := range m.observations {
+		if obs.CoreID() != query.CoreID || (obs.Deleted && !query.IncludeDeleted) || (query.FormType != "" && obs.FormType != query.FormType) {
+			continue
+		}
+		page.Observations = append(page.Observations, obs)
+	}
+	return page, nil
 }
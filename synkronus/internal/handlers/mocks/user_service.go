@@ -2,6 +2,8 @@ package mocks
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
@@ -10,13 +12,20 @@ import (
 
 // MockUserService is a mock implementation of the userPkg.UserServiceInterface for testing
 type MockUserService struct {
-	users map[string]*models.User
+	users         map[string]*models.User
+	invitations   map[string]*models.Invitation // keyed by token
+	resetTokens   map[string]string             // password reset token -> username
+	resetDisabled bool
+	keptSessions  map[string]uuid.UUID // username -> session kept by the last password change
 }
 
 // NewMockUserService creates a new mock user service
 func NewMockUserService() *MockUserService {
 	return &MockUserService{
-		users: make(map[string]*models.User),
+		users:        make(map[string]*models.User),
+		invitations:  make(map[string]*models.Invitation),
+		resetTokens:  make(map[string]string),
+		keptSessions: make(map[string]uuid.UUID),
 	}
 }
 
@@ -74,7 +83,7 @@ func (m *MockUserService) ResetPassword(ctx context.Context, username, newPasswo
 }
 
 // ChangePassword implements userPkg.UserServiceInterface
-func (m *MockUserService) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error {
+func (m *MockUserService) ChangePassword(ctx context.Context, username, currentPassword, newPassword string, keepSession uuid.UUID) error {
 	// Check if user exists
 	userRecord, exists := m.users[username]
 	if !exists {
@@ -88,10 +97,16 @@ func (m *MockUserService) ChangePassword(ctx context.Context, username, currentP
 
 	// Update password
 	userRecord.PasswordHash = newPassword // In the mock, we don't actually hash the password
+	m.keptSessions[username] = keepSession
 
 	return nil
 }
 
+// KeptSession returns the session the last password change of a user kept logged in
+func (m *MockUserService) KeptSession(username string) uuid.UUID {
+	return m.keptSessions[username]
+}
+
 // ListUsers implements userPkg.UserServiceInterface
 func (m *MockUserService) ListUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
@@ -100,3 +115,120 @@ func (m *MockUserService) ListUsers(ctx context.Context) ([]models.User, error)
 	}
 	return users, nil
 }
+
+// AddInvitation adds an invitation redeemable with token to the mock service
+func (m *MockUserService) AddInvitation(token string, invitation *models.Invitation) {
+	m.invitations[token] = invitation
+}
+
+// CreateInvitation implements userPkg.UserServiceInterface
+func (m *MockUserService) CreateInvitation(ctx context.Context, role models.Role, email, createdBy string, ttl time.Duration) (*models.Invitation, string, error) {
+	if role != models.RoleReadOnly && role != models.RoleReadWrite && role != models.RoleAdmin {
+		return nil, "", userPkg.ErrInvalidRole
+	}
+
+	now := time.Now()
+	invitation := &models.Invitation{
+		ID:        uuid.New(),
+		Role:      role,
+		Email:     email,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	token := "invite-" + invitation.ID.String()
+	m.invitations[token] = invitation
+
+	return invitation, token, nil
+}
+
+// ListInvitations implements userPkg.UserServiceInterface
+func (m *MockUserService) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	invitations := []models.Invitation{}
+	for _, invitation := range m.invitations {
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation implements userPkg.UserServiceInterface
+func (m *MockUserService) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	for token, invitation := range m.invitations {
+		if invitation.ID == id {
+			delete(m.invitations, token)
+			return nil
+		}
+	}
+	return userPkg.ErrInvitationNotFound
+}
+
+// RegisterWithInvitation implements userPkg.UserServiceInterface
+func (m *MockUserService) RegisterWithInvitation(ctx context.Context, token, username, password string) (*models.User, error) {
+	invitation, exists := m.invitations[token]
+	if !exists || !invitation.IsRedeemable(time.Now()) {
+		return nil, userPkg.ErrInvalidInvitation
+	}
+
+	newUser, err := m.CreateUser(ctx, username, password, invitation.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	usedAt := time.Now()
+	invitation.UsedAt = &usedAt
+	invitation.UsedBy = username
+
+	return newUser, nil
+}
+
+// SetEmail implements userPkg.UserServiceInterface
+func (m *MockUserService) SetEmail(ctx context.Context, username, email string) error {
+	userRecord, exists := m.users[username]
+	if !exists {
+		return userPkg.ErrUserNotFound
+	}
+	if email != "" && !strings.Contains(email, "@") {
+		return userPkg.ErrInvalidEmail
+	}
+	for _, other := range m.users {
+		if other != userRecord && email != "" && strings.EqualFold(other.Email, email) {
+			return userPkg.ErrEmailInUse
+		}
+	}
+	userRecord.Email = email
+	return nil
+}
+
+// SetPasswordResetDisabled makes RequestPasswordReset fail as if SMTP were not configured
+func (m *MockUserService) SetPasswordResetDisabled(disabled bool) {
+	m.resetDisabled = disabled
+}
+
+// AddResetToken adds a password reset token for username to the mock service
+func (m *MockUserService) AddResetToken(token, username string) {
+	m.resetTokens[token] = username
+}
+
+// RequestPasswordReset implements userPkg.UserServiceInterface
+func (m *MockUserService) RequestPasswordReset(ctx context.Context, identifier string) error {
+	if m.resetDisabled {
+		return userPkg.ErrPasswordResetDisabled
+	}
+	return nil
+}
+
+// ResetPasswordWithToken implements userPkg.UserServiceInterface
+func (m *MockUserService) ResetPasswordWithToken(ctx context.Context, token, newPassword string) error {
+	username, exists := m.resetTokens[token]
+	if !exists {
+		return userPkg.ErrInvalidResetToken
+	}
+	delete(m.resetTokens, token)
+
+	userRecord, exists := m.users[username]
+	if !exists {
+		return userPkg.ErrInvalidResetToken
+	}
+	userRecord.PasswordHash = newPassword // In the mock, we don't actually hash the password
+	return nil
+}
@@ -0,0 +1,148 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/workflow"
+)
+
+// MockWorkflowService is an in-memory implementation of workflow.Service
+type MockWorkflowService struct {
+	// Definitions are the workflows by form type
+	Definitions map[string]*workflow.Definition
+	// Observations are the form types of the known observations by ID
+	Observations map[string]string
+	// Users are the roles of the users observations can be assigned to
+	Users   map[string]models.Role
+	Records map[string]workflow.Record
+	Events  map[string][]workflow.Event
+	version int64
+}
+
+// NewMockWorkflowService creates a new mock workflow service without observations
+func NewMockWorkflowService() *MockWorkflowService {
+	return &MockWorkflowService{
+		Definitions:  map[string]*workflow.Definition{},
+		Observations: map[string]string{},
+		Users:        map[string]models.Role{},
+		Records:      map[string]workflow.Record{},
+		Events:       map[string][]workflow.Event{},
+	}
+}
+
+// Definition implements workflow.Service
+func (m *MockWorkflowService) Definition(formType string) (*workflow.Definition, error) {
+	return m.Definitions[formType], nil
+}
+
+// Get implements workflow.Service
+func (m *MockWorkflowService) Get(ctx context.Context, observationID string) (*workflow.Detail, error) {
+	record, def, err := m.current(observationID)
+	if err != nil {
+		return nil, err
+	}
+	history := append([]workflow.Event{}, m.Events[observationID]...)
+	return &workflow.Detail{Record: record, Transitions: def.Next(record.State), History: history}, nil
+}
+
+// Transition implements workflow.Service
+func (m *MockWorkflowService) Transition(ctx context.Context, observationID string, req workflow.TransitionRequest) (*workflow.Record, error) {
+	record, def, err := m.current(observationID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Assignee != "" && record.Assignee != req.Actor && !req.Admin {
+		return nil, workflow.ErrNotAssignee
+	}
+	if !def.Allows(record.State, req.To) && !(req.Force && req.To != record.State && def.HasState(req.To)) {
+		return nil, &workflow.TransitionError{From: record.State, To: req.To, Allowed: def.Next(record.State)}
+	}
+	from := record.State
+	record.State, record.Comment = req.To, req.Comment
+	return m.save(record, from, req.Actor), nil
+}
+
+// Assign implements workflow.Service
+func (m *MockWorkflowService) Assign(ctx context.Context, observationID, assignee, actor string) (*workflow.Record, error) {
+	if role, ok := m.Users[assignee]; assignee != "" && (!ok || role == models.RoleReadOnly) {
+		return nil, workflow.ErrInvalidAssignee
+	}
+	record, _, err := m.current(observationID)
+	if err != nil {
+		return nil, err
+	}
+	record.Assignee = assignee
+	return m.save(record, record.State, actor), nil
+}
+
+// List implements workflow.Service
+func (m *MockWorkflowService) List(ctx context.Context, query workflow.Query) ([]workflow.Record, error) {
+	def := m.Definitions[query.FormType]
+	if def == nil {
+		return nil, workflow.ErrNoWorkflow
+	}
+	if query.State != "" && !def.HasState(query.State) {
+		return nil, workflow.ErrUnknownState
+	}
+	records := []workflow.Record{}
+	for id, formType := range m.Observations {
+		if formType != query.FormType {
+			continue
+		}
+		record, _, _ := m.current(id)
+		if (query.State == "" || record.State == query.State) && (query.Assignee == "" || record.Assignee == query.Assignee) {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ObservationID < records[j].ObservationID })
+	return records, nil
+}
+
+// Changes implements workflow.Service
+func (m *MockWorkflowService) Changes(ctx context.Context, sinceVersion int64, limit int) (*workflow.ChangesPage, error) {
+	page := &workflow.ChangesPage{CurrentVersion: m.version, Records: []workflow.Record{}, NextSinceVersion: max(sinceVersion, m.version)}
+	for _, record := range m.Records {
+		if record.Version > sinceVersion {
+			page.Records = append(page.Records, record)
+		}
+	}
+	sort.Slice(page.Records, func(i, j int) bool { return page.Records[i].Version < page.Records[j].Version })
+	if limit > 0 && len(page.Records) > limit {
+		page.Records = page.Records[:limit]
+		page.HasMore = true
+		page.NextSinceVersion = page.Records[limit-1].Version
+	}
+	return page, nil
+}
+
+func (m *MockWorkflowService) current(observationID string) (workflow.Record, *workflow.Definition, error) {
+	formType, ok := m.Observations[observationID]
+	if !ok {
+		return workflow.Record{}, nil, workflow.ErrNotFound
+	}
+	def := m.Definitions[formType]
+	if def == nil {
+		return workflow.Record{}, nil, workflow.ErrNoWorkflow
+	}
+	record, ok := m.Records[observationID]
+	if !ok {
+		record = workflow.Record{ObservationID: observationID, FormType: formType, State: def.Initial}
+	}
+	return record, def, nil
+}
+
+func (m *MockWorkflowService) save(record workflow.Record, from, actor string) *workflow.Record {
+	m.version++
+	record.UpdatedBy, record.UpdatedAt, record.Version = actor, time.Now(), m.version
+	m.Records[record.ObservationID] = record
+	m.Events[record.ObservationID] = append(m.Events[record.ObservationID], workflow.Event{
+		FromState: from, ToState: record.State, Assignee: record.Assignee, Actor: actor, Comment: record.Comment, CreatedAt: record.UpdatedAt,
+	})
+	return &record
+}
+
+// Ensure MockWorkflowService implements workflow.Service
+var _ workflow.Service = (*MockWorkflowService)(nil)
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// ObservationLockRequest is the optional request body for POST /observations/{id}/lock
+type ObservationLockRequest struct {
+	// TTLSeconds is how long the lock lasts; 0 uses the default
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ObservationLockedResponse is the 409 response when another user holds the lock
+type ObservationLockedResponse struct {
+	Error   string               `json:"error"`
+	Message string               `json:"message"`
+	Code    string               `json:"code"`
+	Lock    observationlock.Lock `json:"lock"`
+}
+
+// LockObservation handles POST /observations/{id}/lock
+// @Summary Lock an observation for review
+// @Description Locks an observation so sync pushes of it by other users fail with the LOCKED code until the lock is released or expires. Locking again extends the caller's lock. Admins take over another user's lock with force=true.
+// @Tags Observations
+// @Accept json
+// @Produce json
+// @Param id path string true "Observation ID"
+// @Param force query bool false "Take over another user's lock (admin only)"
+// @Param body body ObservationLockRequest false "Lock duration and reason"
+// @Success 200 {object} observationlock.Lock
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 409 {object} ObservationLockedResponse "Locked by another user"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/lock [post]
+func (h *Handler) LockObservation(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+	force, ok := h.lockOverride(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req ObservationLockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	lock, err := h.observationLockService.Acquire(r.Context(), observationID, user.Username, req.Reason, time.Duration(req.TTLSeconds)*time.Second, force)
+	if err != nil {
+		h.sendLockError(w, err, observationID, "Failed to lock observation")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, lock)
+}
+
+// UnlockObservation handles DELETE /observations/{id}/lock
+// @Summary Release an observation lock
+// @Description Releases the caller's lock on an observation. Admins release another user's lock with force=true.
+// @Tags Observations
+// @Param id path string true "Observation ID"
+// @Param force query bool false "Release another user's lock (admin only)"
+// @Success 204 "No Content"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Not locked"
+// @Failure 409 {object} ObservationLockedResponse "Locked by another user"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/lock [delete]
+func (h *Handler) UnlockObservation(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+	force, ok := h.lockOverride(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.observationLockService.Release(r.Context(), observationID, user.Username, force); err != nil {
+		h.sendLockError(w, err, observationID, "Failed to release observation lock")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetObservationLock handles GET /observations/{id}/lock
+// @Summary Get the lock of an observation
+// @Tags Observations
+// @Produce json
+// @Param id path string true "Observation ID"
+// @Success 200 {object} observationlock.Lock
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not locked"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/lock [get]
+func (h *Handler) GetObservationLock(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	lock, err := h.observationLockService.Get(r.Context(), observationID)
+	if err != nil {
+		h.sendLockError(w, err, observationID, "Failed to get observation lock")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, lock)
+}
+
+// ListObservationLocks handles GET /observations/locks
+// @Summary List active observation locks (admin only)
+// @Tags Observations
+// @Produce json
+// @Success 200 {object} map[string][]observationlock.Lock
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/locks [get]
+func (h *Handler) ListObservationLocks(w http.ResponseWriter, r *http.Request) {
+	locks, err := h.observationLockService.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list observation locks", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list observation locks")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, map[string]any{"locks": locks})
+}
+
+// lockOverride reads the force parameter, which only admins may set
+func (h *Handler) lockOverride(w http.ResponseWriter, r *http.Request, user *models.User) (bool, bool) {
+	force := r.URL.Query().Get("force") == "true"
+	if force && user.Role != models.RoleAdmin {
+		SendErrorResponse(w, http.StatusForbidden, nil, "Only admins can override observation locks")
+		return false, false
+	}
+	return force, true
+}
+
+// sendLockError maps observation lock errors to responses
+func (h *Handler) sendLockError(w http.ResponseWriter, err error, observationID, message string) {
+	var locked *observationlock.LockedError
+	switch {
+	case errors.As(err, &locked):
+		SendJSONResponse(w, http.StatusConflict, ObservationLockedResponse{
+			Error:   err.Error(),
+			Message: "Observation is locked by another user",
+			Code:    sync.FailureLocked,
+			Lock:    locked.Lock,
+		})
+	case errors.Is(err, observationlock.ErrNotLocked):
+		SendErrorResponse(w, http.StatusNotFound, err, "Observation is not locked")
+	case errors.Is(err, observationlock.ErrObservationNotFound):
+		SendErrorResponse(w, http.StatusNotFound, err, "Observation not found")
+	case errors.Is(err, observationlock.ErrInvalidTTL):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+	default:
+		h.log.Error(message, "error", err, "observationId", observationID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, message)
+	}
+}
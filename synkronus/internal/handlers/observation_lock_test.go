@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservationLocks(t *testing.T) {
+	h, _ := createTestHandler()
+	locks := mocks.NewMockObservationLockService()
+	locks.Observations = map[string]bool{"obs-1": true}
+	h.observationLockService = locks
+
+	r := chi.NewRouter()
+	r.Get("/observations/locks", h.ListObservationLocks)
+	r.Get("/observations/{id}/lock", h.GetObservationLock)
+	r.Post("/observations/{id}/lock", h.LockObservation)
+	r.Delete("/observations/{id}/lock", h.UnlockObservation)
+
+	do := func(user models.User, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &user))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alice := models.User{Username: "alice", Role: models.RoleReadWrite}
+	bob := models.User{Username: "bob", Role: models.RoleReadWrite}
+	admin := models.User{Username: "admin", Role: models.RoleAdmin}
+
+	w := do(alice, http.MethodPost, "/observations/obs-1/lock", `{"ttl_seconds":600,"reason":"fixing age"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var lock observationlock.Lock
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &lock))
+	assert.Equal(t, "alice", lock.Owner)
+	assert.Equal(t, "fixing age", lock.Reason)
+
+	// Another reviewer gets the owner in the conflict
+	w = do(bob, http.MethodPost, "/observations/obs-1/lock", "")
+	require.Equal(t, http.StatusConflict, w.Code)
+	var conflict ObservationLockedResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &conflict))
+	assert.Equal(t, "LOCKED", conflict.Code)
+	assert.Equal(t, "alice", conflict.Lock.Owner)
+	assert.Equal(t, http.StatusConflict, do(bob, http.MethodDelete, "/observations/obs-1/lock", "").Code)
+
+	// Only admins override
+	assert.Equal(t, http.StatusForbidden, do(bob, http.MethodPost, "/observations/obs-1/lock?force=true", "").Code)
+	w = do(admin, http.MethodPost, "/observations/obs-1/lock?force=true", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "admin", locks.Locks["obs-1"].Owner)
+
+	w = do(admin, http.MethodGet, "/observations/locks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"owner":"admin"`)
+
+	assert.Equal(t, http.StatusNoContent, do(admin, http.MethodDelete, "/observations/obs-1/lock", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(alice, http.MethodGet, "/observations/obs-1/lock", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(alice, http.MethodPost, "/observations/missing/lock", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(alice, http.MethodPost, "/observations/obs-1/lock", `{"ttl_seconds":-1}`).Code)
+}
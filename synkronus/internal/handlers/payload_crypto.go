@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
+)
+
+// PayloadKeyHeader names the negotiated key a request body is encrypted with. Encrypted
+// responses carry it too.
+const PayloadKeyHeader = "X-Payload-Key"
+
+// PayloadKeyRequest is the request body for POST /crypto/keys
+type PayloadKeyRequest struct {
+	// PublicKey is the client's base64 X25519 public key
+	PublicKey string `json:"publicKey"`
+}
+
+// EncryptPayload decrypts request bodies sent with an X-Payload-Key header and encrypts
+// the response with the same key. Bodies are the 12-byte nonce followed by the AES-256-GCM
+// ciphertext; see payloadcrypto.RequestAAD for the data they are bound to. In required
+// mode, requests without the header are rejected.
+func (h *Handler) EncryptPayload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := h.payloadCryptoService.Mode()
+		keyID := r.Header.Get(PayloadKeyHeader)
+		if keyID == "" {
+			if mode == payloadcrypto.ModeRequired {
+				h.log.Warn("Rejected plaintext payload", "method", r.Method, "path", r.URL.Path)
+				SendErrorResponse(w, http.StatusBadRequest, nil, "This server requires encrypted payloads; negotiate a payload key and send its ID in the X-Payload-Key header")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if mode == payloadcrypto.ModeOff {
+			SendErrorResponse(w, http.StatusBadRequest, payloadcrypto.ErrDisabled, "Payload encryption is disabled on this server")
+			return
+		}
+
+		user := authmw.GetUserFromContext(r.Context())
+		if user == nil {
+			SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+			return
+		}
+		key, err := h.payloadCryptoService.SessionKey(r.Context(), keyID, user.Username)
+		if errors.Is(err, payloadcrypto.ErrKeyNotFound) {
+			SendErrorResponse(w, http.StatusUnauthorized, err, "Unknown or expired payload key; negotiate a new one")
+			return
+		}
+		if err != nil {
+			h.log.Error("Failed to read payload key", "error", err, "keyId", keyID)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to read payload key")
+			return
+		}
+
+		// The whole body is held in memory to be decrypted, so it is capped; plaintext
+		// attachment uploads spill to disk instead
+		maxBodySize := h.payloadCryptoService.MaxBodySize()
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.log.Warn("Rejected encrypted payload as too large", "username", user.Username, "path", r.URL.Path, "limit", maxBodySize)
+			SendErrorResponse(w, http.StatusRequestEntityTooLarge, err, "Encrypted request body is larger than the server accepts")
+			return
+		}
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "Failed to read request body")
+			return
+		}
+		if len(body) > 0 {
+			plaintext, err := payloadcrypto.Open(key, body, payloadcrypto.RequestAAD(r.Method, r.URL.Path, keyID))
+			if err != nil {
+				h.log.Warn("Failed to decrypt payload", "username", user.Username, "keyId", keyID, "path", r.URL.Path)
+				SendErrorResponse(w, http.StatusBadRequest, err, "Failed to decrypt request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(plaintext))
+			r.ContentLength = int64(len(plaintext))
+			r.Header.Set("Content-Length", strconv.Itoa(len(plaintext)))
+		}
+
+		recorder := &payloadRecorder{ResponseWriter: w, status: http.StatusOK, limit: maxBodySize}
+		next.ServeHTTP(recorder, r)
+		if recorder.overflow {
+			h.log.Error("Response too large to encrypt", "path", r.URL.Path, "limit", maxBodySize)
+			w.Header().Del("Content-Type")
+			SendErrorResponse(w, http.StatusInternalServerError, errResponseTooLarge, "Response is too large to encrypt; request a smaller page")
+			return
+		}
+
+		sealed, err := payloadcrypto.Seal(key, recorder.body.Bytes(), payloadcrypto.ResponseAAD(r.Method, r.URL.Path, keyID))
+		if err != nil {
+			h.log.Error("Failed to encrypt response", "error", err, "keyId", keyID)
+			w.Header().Del("Content-Type")
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to encrypt response")
+			return
+		}
+		w.Header().Set(PayloadKeyHeader, keyID)
+		w.Header().Set("Content-Length", strconv.Itoa(len(sealed)))
+		w.WriteHeader(recorder.status)
+		if _, err := w.Write(sealed); err != nil {
+			h.log.Error("Failed to write encrypted response", "error", err)
+		}
+	})
+}
+
+// errResponseTooLarge is reported when a response outgrows the body size limit
+var errResponseTooLarge = errors.New("response exceeds the payload size limit")
+
+// payloadRecorder holds back a response so it can be encrypted as a whole, up to limit
+// bytes. Headers go straight to the underlying writer.
+type payloadRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (p *payloadRecorder) WriteHeader(status int) {
+	p.status = status
+}
+
+func (p *payloadRecorder) Write(data []byte) (int, error) {
+	if p.overflow || int64(p.body.Len()+len(data)) > p.limit {
+		// Nothing more is buffered; the response is replaced by an error
+		p.overflow = true
+		p.body.Reset()
+		return 0, errResponseTooLarge
+	}
+	return p.body.Write(data)
+}
+
+// NegotiatePayloadKey handles POST /crypto/keys
+// @Summary Negotiate a payload encryption key
+// @Description Derives a new session key from the client's X25519 public key, as login does when given payloadKey. Clients use it to rotate their key before it expires.
+// @Tags Crypto
+// @Accept json
+// @Produce json
+// @Param body body PayloadKeyRequest true "Client public key"
+// @Success 201 {object} payloadcrypto.Negotiation
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "Payload encryption is disabled"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /crypto/keys [post]
+func (h *Handler) NegotiatePayloadKey(w http.ResponseWriter, r *http.Request) {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	var req PayloadKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	negotiation, ok := h.negotiatePayloadKey(w, r, user.Username, req.PublicKey)
+	if !ok {
+		return
+	}
+	SendJSONResponse(w, http.StatusCreated, negotiation)
+}
+
+// ListPayloadKeys handles GET /crypto/keys
+// @Summary List payload encryption keys
+// @Description Lists the caller's unexpired payload keys. Admins list another user's keys with ?username=, or everyone's with ?username=*.
+// @Tags Crypto
+// @Produce json
+// @Param username query string false "User whose keys to list (admin only)"
+// @Success 200 {object} map[string][]payloadcrypto.Key
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /crypto/keys [get]
+func (h *Handler) ListPayloadKeys(w http.ResponseWriter, r *http.Request) {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	username := user.Username
+	if requested := r.URL.Query().Get("username"); requested != "" && requested != user.Username {
+		if user.Role != models.RoleAdmin {
+			SendErrorResponse(w, http.StatusForbidden, nil, "Only admins can list other users' payload keys")
+			return
+		}
+		username = requested
+		if requested == "*" {
+			username = ""
+		}
+	}
+
+	keys, err := h.payloadCryptoService.List(r.Context(), username)
+	if err != nil {
+		h.log.Error("Failed to list payload keys", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list payload keys")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+// RevokePayloadKey handles DELETE /crypto/keys/{key_id}
+// @Summary Revoke a payload encryption key
+// @Description Deletes one of the caller's payload keys; requests encrypted with it fail from then on. Admins revoke any user's key.
+// @Tags Crypto
+// @Param key_id path string true "Key ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /crypto/keys/{key_id} [delete]
+func (h *Handler) RevokePayloadKey(w http.ResponseWriter, r *http.Request) {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	keyID := chi.URLParam(r, "key_id")
+	err := h.payloadCryptoService.Revoke(r.Context(), keyID, user.Username, user.Role == models.RoleAdmin)
+	if errors.Is(err, payloadcrypto.ErrKeyNotFound) {
+		SendErrorResponse(w, http.StatusNotFound, err, "Payload key not found")
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to revoke payload key", "error", err, "keyId", keyID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to revoke payload key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// negotiatePayloadKey negotiates a key for username and reports whether the response may
+// go on
+func (h *Handler) negotiatePayloadKey(w http.ResponseWriter, r *http.Request, username, publicKey string) (*payloadcrypto.Negotiation, bool) {
+	negotiation, err := h.payloadCryptoService.Negotiate(r.Context(), username, publicKey)
+	switch {
+	case err == nil:
+		return negotiation, true
+	case errors.Is(err, payloadcrypto.ErrDisabled):
+		SendErrorResponse(w, http.StatusConflict, err, "Payload encryption is disabled on this server")
+	case errors.Is(err, payloadcrypto.ErrInvalidPublicKey):
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid payload public key")
+	default:
+		h.log.Error("Failed to negotiate payload key", "error", err, "username", username)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to negotiate payload key")
+	}
+	return nil, false
+}
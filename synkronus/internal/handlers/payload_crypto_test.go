@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/payloadcrypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptPayload(t *testing.T) {
+	h, _ := createTestHandler()
+	keys := mocks.NewMockPayloadCryptoService()
+	keys.ModeValue = payloadcrypto.ModeOptional
+	h.payloadCryptoService = keys
+	key := bytes.Repeat([]byte{7}, 32)
+	keys.AddKey("k1", "alice", key)
+
+	// The wrapped handler echoes the plaintext body it received
+	var received string
+	r := chi.NewRouter()
+	r.With(h.EncryptPayload).Post("/sync/push", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		SendJSONResponse(w, http.StatusAccepted, map[string]string{"echo": received})
+	})
+	do := func(username, keyID string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sync/push", bytes.NewReader(body))
+		if keyID != "" {
+			req.Header.Set(PayloadKeyHeader, keyID)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: username, Role: models.RoleReadWrite}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	sealed, err := payloadcrypto.Seal(key, []byte(`{"records":[]}`), payloadcrypto.RequestAAD(http.MethodPost, "/sync/push", "k1"))
+	require.NoError(t, err)
+	w := do("alice", "k1", sealed)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Equal(t, `{"records":[]}`, received)
+	assert.Equal(t, "k1", w.Header().Get(PayloadKeyHeader))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "records", "the response must be encrypted")
+	plaintext, err := payloadcrypto.Open(key, w.Body.Bytes(), payloadcrypto.ResponseAAD(http.MethodPost, "/sync/push", "k1"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"echo":"{\"records\":[]}"}`, string(plaintext))
+
+	// Another user's key, a tampered body and a body meant for another route are rejected
+	assert.Equal(t, http.StatusUnauthorized, do("bob", "k1", sealed).Code)
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	assert.Equal(t, http.StatusBadRequest, do("alice", "k1", tampered).Code)
+	pull, err := payloadcrypto.Seal(key, []byte(`{}`), payloadcrypto.RequestAAD(http.MethodPost, "/sync/pull", "k1"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, do("alice", "k1", pull).Code)
+
+	// Plaintext passes in optional mode only
+	w = do("alice", "", []byte(`{"plain":true}`))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Empty(t, w.Header().Get(PayloadKeyHeader))
+	assert.Contains(t, w.Body.String(), "plain")
+	keys.ModeValue = payloadcrypto.ModeRequired
+	assert.Equal(t, http.StatusBadRequest, do("alice", "", []byte(`{"plain":true}`)).Code)
+	keys.ModeValue = payloadcrypto.ModeOff
+	assert.Equal(t, http.StatusBadRequest, do("alice", "k1", sealed).Code)
+}
+
+func TestEncryptPayload_SizeLimit(t *testing.T) {
+	h, _ := createTestHandler()
+	keys := mocks.NewMockPayloadCryptoService()
+	keys.ModeValue = payloadcrypto.ModeRequired
+	keys.MaxBodySizeValue = 1024
+	h.payloadCryptoService = keys
+	key := bytes.Repeat([]byte{7}, 32)
+	keys.AddKey("k1", "alice", key)
+
+	// The wrapped upload handler answers with twice the bytes it received
+	called := false
+	r := chi.NewRouter()
+	r.With(h.EncryptPayload).Put("/attachments/{attachment_id}", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		body, _ := io.ReadAll(r.Body)
+		w.Write(bytes.Repeat([]byte("x"), 2*len(body)))
+	})
+	upload := func(size int) *httptest.ResponseRecorder {
+		sealed, err := payloadcrypto.Seal(key, bytes.Repeat([]byte{1}, size), payloadcrypto.RequestAAD(http.MethodPut, "/attachments/a1", "k1"))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/attachments/a1", bytes.NewReader(sealed))
+		req.Header.Set(PayloadKeyHeader, "k1")
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "alice", Role: models.RoleReadWrite}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload(512)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, called)
+
+	// An oversized encrypted upload is refused before it reaches the handler
+	called = false
+	w = upload(4096)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.False(t, called)
+	assert.Empty(t, w.Header().Get(PayloadKeyHeader))
+
+	// A response that outgrows the limit is replaced by an error rather than buffered
+	w = upload(600)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusInternalServerError, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "xxx")
+}
+
+func TestPayloadKeys(t *testing.T) {
+	h, _ := createTestHandler()
+	keys := mocks.NewMockPayloadCryptoService()
+	keys.ModeValue = payloadcrypto.ModeRequired
+	h.payloadCryptoService = keys
+
+	r := chi.NewRouter()
+	r.Post("/crypto/keys", h.NegotiatePayloadKey)
+	r.Get("/crypto/keys", h.ListPayloadKeys)
+	r.Delete("/crypto/keys/{key_id}", h.RevokePayloadKey)
+	do := func(user models.User, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &user))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alice := models.User{Username: "alice", Role: models.RoleReadWrite}
+	bob := models.User{Username: "bob", Role: models.RoleReadWrite}
+	admin := models.User{Username: "admin", Role: models.RoleAdmin}
+
+	client, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	body := `{"publicKey":"` + base64.StdEncoding.EncodeToString(client.PublicKey().Bytes()) + `"}`
+	w := do(alice, http.MethodPost, "/crypto/keys", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var negotiation payloadcrypto.Negotiation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &negotiation))
+	clientKey, err := payloadcrypto.DeriveClientKey(client, &negotiation)
+	require.NoError(t, err)
+	assert.Equal(t, keys.Material[negotiation.KeyID], clientKey)
+	assert.Equal(t, http.StatusBadRequest, do(alice, http.MethodPost, "/crypto/keys", `{"publicKey":"AAAA"}`).Code)
+
+	// Users list their own keys; admins anyone's
+	assert.Equal(t, http.StatusForbidden, do(bob, http.MethodGet, "/crypto/keys?username=alice", "").Code)
+	w = do(bob, http.MethodGet, "/crypto/keys", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys":[]}`, w.Body.String())
+	w = do(admin, http.MethodGet, "/crypto/keys?username=*", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), negotiation.KeyID)
+
+	assert.Equal(t, http.StatusNotFound, do(bob, http.MethodDelete, "/crypto/keys/"+negotiation.KeyID, "").Code)
+	assert.Equal(t, http.StatusNoContent, do(alice, http.MethodDelete, "/crypto/keys/"+negotiation.KeyID, "").Code)
+	assert.Empty(t, keys.Keys)
+
+	keys.ModeValue = payloadcrypto.ModeOff
+	assert.Equal(t, http.StatusConflict, do(alice, http.MethodPost, "/crypto/keys", body).Code)
+}
+
+func TestLogin_NegotiatesPayloadKey(t *testing.T) {
+	h, _ := createTestHandler()
+	keys := mocks.NewMockPayloadCryptoService()
+	h.payloadCryptoService = keys
+
+	client, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	body, err := json.Marshal(LoginRequest{
+		Username:   "testuser",
+		Password:   "password123",
+		PayloadKey: base64.StdEncoding.EncodeToString(client.PublicKey().Bytes()),
+	})
+	require.NoError(t, err)
+	login := func() LoginResponse {
+		w := httptest.NewRecorder()
+		h.Login(w, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// Servers without payload encryption leave the key out
+	assert.Nil(t, login().PayloadKey)
+
+	keys.ModeValue = payloadcrypto.ModeOptional
+	resp := login()
+	require.NotNil(t, resp.PayloadKey)
+	assert.Equal(t, payloadcrypto.Algorithm, resp.PayloadKey.Algorithm)
+	clientKey, err := payloadcrypto.DeriveClientKey(client, resp.PayloadKey)
+	require.NoError(t, err)
+	assert.Equal(t, keys.Material[resp.PayloadKey.KeyID], clientKey)
+	assert.Equal(t, "testuser", keys.Keys[resp.PayloadKey.KeyID].Username)
+}
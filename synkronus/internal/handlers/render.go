@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/pkg/render"
+)
+
+// GetObservationPDF handles GET /observations/{id}/pdf
+// @Summary Get a printable PDF of an observation
+// @Description Renders the answers of an observation under the labels of its form's UI schema in the active app bundle, with photos and signatures embedded, e.g. for consent forms and official records
+// @Tags Observations
+// @Produce application/pdf
+// @Param id path string true "Observation ID"
+// @Success 200 {file} binary
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/pdf [get]
+func (h *Handler) GetObservationPDF(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+
+	pdf, err := h.renderService.ObservationPDF(r.Context(), observationID)
+	if err != nil {
+		if errors.Is(err, render.ErrObservationNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Observation not found")
+			return
+		}
+		h.log.Error("Failed to render observation PDF", "error", err, "observationId", observationID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to render observation PDF")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+pdf.Filename()+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf.Content)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(pdf.Content); err != nil {
+		h.log.Error("Failed to write observation PDF", "error", err, "observationId", observationID)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/render"
+)
+
+func TestHandler_GetObservationPDF(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		serviceErr     error
+		expectedStatus int
+	}{
+		{"rendered", "obs-1", nil, http.StatusOK},
+		{"not found", "missing", render.ErrObservationNotFound, http.StatusNotFound},
+		{"service error", "obs-1", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+			mockService := mocks.NewMockRenderService()
+			mockService.ObservationPDFFunc = func(ctx context.Context, observationID string) (*render.PDF, error) {
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &render.PDF{ObservationID: observationID, FormType: "consent", Content: []byte("%PDF-1.3")}, nil
+			}
+			h.renderService = mockService
+
+			req := httptest.NewRequest(http.MethodGet, "/observations/"+tt.id+"/pdf", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			h.GetObservationPDF(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if w.Header().Get("Content-Type") != "application/pdf" {
+				t.Errorf("Unexpected content type %s", w.Header().Get("Content-Type"))
+			}
+			if w.Header().Get("Content-Disposition") != `inline; filename="consent-obs-1.pdf"` {
+				t.Errorf("Unexpected content disposition %s", w.Header().Get("Content-Disposition"))
+			}
+			if w.Body.String() != "%PDF-1.3" {
+				t.Errorf("Unexpected body %q", w.Body.String())
+			}
+		})
+	}
+}
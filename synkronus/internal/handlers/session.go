@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// SessionResponse is a login session in a user's session list
+type SessionResponse struct {
+	models.Session
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+}
+
+// SessionListResponse lists a user's active sessions
+type SessionListResponse struct {
+	Username string            `json:"username"`
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// clientInfo describes the device a request comes from; the router's RealIP middleware
+// has already applied proxy headers to RemoteAddr
+func clientInfo(r *http.Request, deviceName string) auth.ClientInfo {
+	client := auth.ClientInfo{
+		DeviceName: deviceName,
+		IPAddress:  r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client.IPAddress = host
+	}
+	return client
+}
+
+// ListSessionsHandler handles GET /users/sessions
+// @Summary List login sessions
+// @Description Lists the caller's active sessions with device name, IP address and last use. Admins can pass a username to list another user's sessions.
+// @Tags Users
+// @Produce json
+// @Param username query string false "User whose sessions to list (admin only)"
+// @Success 200 {object} SessionListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /users/sessions [get]
+func (h *Handler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	caller := authmw.GetUserFromContext(r.Context())
+	if caller == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	username := caller.Username
+	if requested := r.URL.Query().Get("username"); requested != "" && requested != caller.Username {
+		if caller.Role != models.RoleAdmin {
+			SendErrorResponse(w, http.StatusForbidden, nil, "Only admins can list other users' sessions")
+			return
+		}
+		username = requested
+	}
+
+	sessions, err := h.authService.ListSessions(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "User not found")
+			return
+		}
+		h.log.Error("Failed to list sessions", "username", username, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list sessions")
+		return
+	}
+
+	var currentSession string
+	if claims := authmw.GetClaimsFromContext(r.Context()); claims != nil && username == caller.Username {
+		currentSession = claims.SessionID
+	}
+	response := SessionListResponse{Username: username, Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			Session: session,
+			Current: currentSession != "" && session.ID.String() == currentSession,
+		})
+	}
+	SendJSONResponse(w, http.StatusOK, response)
+}
+
+// RevokeSessionHandler handles DELETE /users/sessions/{id}
+// @Summary Revoke one of your sessions
+// @Description Logs one of the caller's devices out: its refresh token stops working at once and its access token within the session check interval.
+// @Tags Users
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse "Invalid session ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Session not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /users/sessions/{id} [delete]
+func (h *Handler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	caller := authmw.GetUserFromContext(r.Context())
+	if caller == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid session ID")
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), caller.Username, id); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) || errors.Is(err, auth.ErrUserNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "Session not found")
+			return
+		}
+		h.log.Error("Failed to revoke session", "username", caller.Username, "session", id, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to revoke session")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// Logout handles POST /auth/logout
+// @Summary Log out
+// @Description Revokes the session of the request and clears the cookies of a portal cookie session.
+// @Tags Authentication
+// @Success 204 "Logged out"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing or invalid CSRF token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := authmw.GetClaimsFromContext(r.Context())
+	if claims == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	// Tokens issued before sessions were tracked have no session to revoke
+	if id, err := uuid.Parse(claims.SessionID); err == nil {
+		if err := h.authService.RevokeSession(r.Context(), claims.Username, id); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			h.log.Error("Failed to revoke session", "username", claims.Username, "session", id, "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to log out")
+			return
+		}
+	}
+
+	if config := h.authService.Config(); authmw.PortalCookies(config, r) {
+		authmw.ClearSessionCookies(w, config)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutUserHandler handles POST /users/logout/{username} (admin only)
+// @Summary Log a user out everywhere
+// @Description Revokes all of a user's sessions, for example when a device is lost or an account is compromised. The user has to log in again on every device.
+// @Tags Users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /users/logout/{username} [post]
+func (h *Handler) LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Username is required")
+		return
+	}
+
+	revoked, err := h.authService.RevokeSessions(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			SendErrorResponse(w, http.StatusNotFound, err, "User not found")
+			return
+		}
+		h.log.Error("Failed to log user out", "username", username, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to log user out")
+		return
+	}
+
+	if admin := authmw.GetUserFromContext(r.Context()); admin != nil {
+		h.log.Info("User logged out by admin", "username", username, "admin", admin.Username, "sessions", revoked)
+	}
+	SendJSONResponse(w, http.StatusOK, map[string]any{
+		"message":  "User logged out of all sessions",
+		"username": username,
+		"revoked":  revoked,
+	})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// loginFrom logs testuser in from a named device, which records a session
+func loginFrom(t *testing.T, h *Handler, deviceName string) {
+	t.Helper()
+	body, err := json.Marshal(LoginRequest{Username: "testuser", Password: "password123", DeviceName: deviceName})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body))
+	req.RemoteAddr = "10.0.0.7:51234"
+	rr := httptest.NewRecorder()
+	h.Login(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func listSessions(t *testing.T, h *Handler, req *http.Request) (int, SessionListResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ListSessionsHandler(rr, req)
+	var response SessionListResponse
+	if rr.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+	return rr.Code, response
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	h, _ := createTestHandler()
+	loginFrom(t, h, "Field tablet")
+	loginFrom(t, h, "Spare phone")
+
+	req := withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions", nil), "testuser", models.RoleReadWrite)
+	status, response := listSessions(t, h, req)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, response.Sessions, 2)
+	assert.Equal(t, "10.0.0.7", response.Sessions[0].IPAddress)
+
+	// Only admins list other users' sessions
+	req = withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions?username=admin", nil), "testuser", models.RoleReadWrite)
+	status, _ = listSessions(t, h, req)
+	assert.Equal(t, http.StatusForbidden, status)
+	req = withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions?username=testuser", nil), "admin", models.RoleAdmin)
+	status, response = listSessions(t, h, req)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, response.Sessions, 2)
+
+	// Revoke the lost phone
+	var lost string
+	for _, session := range response.Sessions {
+		if session.DeviceName == "Spare phone" {
+			lost = session.ID.String()
+		}
+	}
+	require.NotEmpty(t, lost)
+	revoke := func(username, id string) int {
+		req := withTestUser(httptest.NewRequest(http.MethodDelete, "/users/sessions/"+id, nil), username, models.RoleReadWrite)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		h.RevokeSessionHandler(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusNotFound, revoke("admin", lost))
+	assert.Equal(t, http.StatusBadRequest, revoke("testuser", "not-a-uuid"))
+	assert.Equal(t, http.StatusOK, revoke("testuser", lost))
+	assert.Equal(t, http.StatusNotFound, revoke("testuser", lost))
+
+	req = withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions", nil), "testuser", models.RoleReadWrite)
+	_, response = listSessions(t, h, req)
+	require.Len(t, response.Sessions, 1)
+	assert.Equal(t, "Field tablet", response.Sessions[0].DeviceName)
+}
+
+func TestLogoutUserHandler(t *testing.T) {
+	h, _ := createTestHandler()
+	loginFrom(t, h, "Field tablet")
+	loginFrom(t, h, "Spare phone")
+
+	logout := func(username string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(http.MethodPost, "/users/logout/"+username, nil), "admin", models.RoleAdmin)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("username", username)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		h.LogoutUserHandler(rr, req)
+		return rr
+	}
+
+	rr := logout("testuser")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"revoked":2`)
+
+	req := withTestUser(httptest.NewRequest(http.MethodGet, "/users/sessions", nil), "testuser", models.RoleReadWrite)
+	_, response := listSessions(t, h, req)
+	assert.Empty(t, response.Sessions)
+
+	assert.Equal(t, http.StatusNotFound, logout("nobody").Code)
+}
+
+func TestCookieSession(t *testing.T) {
+	h, _ := createTestHandler()
+	mockAuth := h.authService.(*mocks.MockAuthService)
+	config := mockAuth.Config()
+	config.Cookies = auth.CookieConfig{Enabled: true, Secure: true, SameSite: http.SameSiteStrictMode}
+	mockAuth.SetConfig(config)
+
+	login := func(path string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(LoginRequest{Username: "testuser", Password: "password123"})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		h.Login(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+	cookies := func(rr *httptest.ResponseRecorder) map[string]*http.Cookie {
+		byName := map[string]*http.Cookie{}
+		for _, cookie := range rr.Result().Cookies() {
+			byName[cookie.Name] = cookie
+		}
+		return byName
+	}
+
+	// Bearer clients logging in outside /api get no cookies
+	assert.Empty(t, cookies(login("/auth/login")))
+
+	set := cookies(login("/api/auth/login"))
+	require.Len(t, set, 3)
+	access, refresh, csrf := set[authmw.AccessCookieName], set[authmw.RefreshCookieName], set[authmw.CSRFCookieName]
+	assert.Equal(t, "mock-jwt-token-for-testuser", access.Value)
+	assert.True(t, access.HttpOnly)
+	assert.True(t, access.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, access.SameSite)
+	assert.Equal(t, "/api/", access.Path)
+	assert.Equal(t, "/api/auth/", refresh.Path)
+	assert.False(t, csrf.HttpOnly)
+	assert.NotEmpty(t, csrf.Value)
+
+	// Refreshing with the cookie needs the CSRF token
+	refreshWith := func(csrfHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		req.AddCookie(refresh)
+		req.AddCookie(csrf)
+		if csrfHeader != "" {
+			req.Header.Set(authmw.CSRFHeader, csrfHeader)
+		}
+		rr := httptest.NewRecorder()
+		h.RefreshToken(rr, req)
+		return rr
+	}
+	assert.Equal(t, http.StatusForbidden, refreshWith("").Code)
+	assert.Equal(t, http.StatusForbidden, refreshWith("forged").Code)
+	rr := refreshWith(csrf.Value)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEqual(t, csrf.Value, cookies(rr)[authmw.CSRFCookieName].Value)
+
+	// Logging out revokes the session and clears the cookies
+	sessions, err := mockAuth.ListSessions(context.Background(), "testuser")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	claims := &auth.AuthClaims{Username: "testuser", Role: models.RoleReadWrite, SessionID: sessions[1].ID.String()}
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req = req.WithContext(context.WithValue(req.Context(), authmw.ClaimsKey, claims))
+	rr = httptest.NewRecorder()
+	h.Logout(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	cleared := cookies(rr)
+	require.Len(t, cleared, 3)
+	for _, cookie := range cleared {
+		assert.Negative(t, cookie.MaxAge, cookie.Name)
+	}
+	sessions, err = mockAuth.ListSessions(context.Background(), "testuser")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
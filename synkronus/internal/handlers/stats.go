@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/stats"
+)
+
+// GetObservationStats handles GET /stats/observations
+// @Summary Get daily observation counts
+// @Description Returns pre-aggregated daily observation counts grouped by form type, client or geolocation grid cell. Counts are refreshed on a schedule, so they may lag recent pushes (see refreshed_at).
+// @Tags Stats
+// @Produce json
+// @Param group_by query string true "form_type, client or grid_cell"
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Success 200 {object} stats.ObservationStats
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /stats/observations [get]
+func (h *Handler) GetObservationStats(w http.ResponseWriter, r *http.Request) {
+	query := stats.Query{
+		GroupBy: r.URL.Query().Get("group_by"),
+	}
+	if !stats.ValidGroupBy(query.GroupBy) {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "group_by must be one of form_type, client, grid_cell")
+		return
+	}
+
+	for param, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, param+" must be a date in YYYY-MM-DD format")
+			return
+		}
+		*target = &day
+	}
+
+	result, err := h.statsService.GetObservationStats(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, stats.ErrInvalidGroupBy) {
+			SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+		h.log.Error("Failed to get observation stats", "error", err, "groupBy", query.GroupBy)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get observation stats")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/stats"
+)
+
+func TestHandler_GetObservationStats(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		expectedQuery  *stats.Query
+	}{
+		{
+			name:           "group by form type",
+			query:          "?group_by=form_type",
+			expectedStatus: http.StatusOK,
+			expectedQuery:  &stats.Query{GroupBy: stats.GroupByFormType},
+		},
+		{
+			name:           "date range",
+			query:          "?group_by=grid_cell&from=2025-01-01&to=2025-01-31",
+			expectedStatus: http.StatusOK,
+			expectedQuery:  &stats.Query{GroupBy: stats.GroupByGridCell},
+		},
+		{
+			name:           "missing group_by",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown group_by",
+			query:          "?group_by=observation_id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid date",
+			query:          "?group_by=client&from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "service error",
+			query:          "?group_by=client",
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received *stats.Query
+			mockStatsService := mocks.NewMockStatsService()
+			mockStatsService.GetObservationStatsFunc = func(ctx context.Context, query stats.Query) (*stats.ObservationStats, error) {
+				received = &query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &stats.ObservationStats{
+					GroupBy: query.GroupBy,
+					Buckets: []stats.Bucket{{Day: "2025-01-02", Key: "survey", Count: 3}},
+				}, nil
+			}
+			h.statsService = mockStatsService
+
+			req := httptest.NewRequest(http.MethodGet, "/stats/observations"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.GetObservationStats(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedQuery == nil {
+				return
+			}
+			if received == nil || received.GroupBy != tt.expectedQuery.GroupBy {
+				t.Fatalf("Expected service to be called with group_by %q, got %+v", tt.expectedQuery.GroupBy, received)
+			}
+
+			var result stats.ObservationStats
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(result.Buckets) != 1 || result.Buckets[0].Count != 3 {
+				t.Errorf("Unexpected buckets: %+v", result.Buckets)
+			}
+		})
+	}
+}
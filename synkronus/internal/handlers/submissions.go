@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// MyObservationsResponse is one page of the caller's own submissions
+type MyObservationsResponse struct {
+	Observations []sync.Submission `json:"observations"`
+	Limit        int               `json:"limit"`
+	Offset       int               `json:"offset"`
+	HasMore      bool              `json:"has_more"`
+}
+
+// GetMyObservations handles GET /observations/mine
+// @Summary List my submissions
+// @Description Lists the observations the caller pushed, newest first, with their status: synced, reviewed (corrected by an administrator) or flagged (unacknowledged sync warnings). Lets enumerators check that the day's work arrived.
+// @Tags Observations
+// @Produce json
+// @Param since query string false "Only observations created at or after this time (RFC3339 or YYYY-MM-DD)"
+// @Param until query string false "Only observations created before this time (RFC3339), or on or before this day (YYYY-MM-DD)"
+// @Param form_type query string false "Only this form type"
+// @Param status query string false "Only this status (synced, reviewed or flagged)"
+// @Param limit query int false "Maximum number of observations (default 50, max 500)"
+// @Param offset query int false "Number of observations to skip"
+// @Success 200 {object} MyObservationsResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/mine [get]
+func (h *Handler) GetMyObservations(w http.ResponseWriter, r *http.Request) {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Authentication required")
+		return
+	}
+
+	params := r.URL.Query()
+	query := sync.SubmissionQuery{
+		Username: user.Username,
+		FormType: params.Get("form_type"),
+		Status:   params.Get("status"),
+		Limit:    50,
+	}
+	if query.Status != "" && !sync.ValidSubmissionStatus(query.Status) {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "status must be synced, reviewed or flagged")
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 500")
+			return
+		}
+		query.Limit = parsed
+	}
+	if value := params.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "offset must be a non-negative integer")
+			return
+		}
+		query.Offset = parsed
+	}
+	if value := params.Get("since"); value != "" {
+		since, _, err := parseSubmissionTime(value)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "since must be an RFC3339 time or a YYYY-MM-DD date")
+			return
+		}
+		query.Since = &since
+	}
+	if value := params.Get("until"); value != "" {
+		until, dateOnly, err := parseSubmissionTime(value)
+		if err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "until must be an RFC3339 time or a YYYY-MM-DD date")
+			return
+		}
+		// A date includes the whole day
+		if dateOnly {
+			until = until.AddDate(0, 0, 1)
+		}
+		query.Until = &until
+	}
+
+	page, err := h.syncService.ListSubmissions(r.Context(), query)
+	if err != nil {
+		h.log.Error("Failed to list submissions", "error", err, "username", user.Username)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list observations")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, MyObservationsResponse{
+		Observations: page.Submissions,
+		Limit:        query.Limit,
+		Offset:       query.Offset,
+		HasMore:      page.HasMore,
+	})
+}
+
+// parseSubmissionTime parses an RFC3339 time or a YYYY-MM-DD date (midnight UTC) and
+// reports whether it was a date
+func parseSubmissionTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
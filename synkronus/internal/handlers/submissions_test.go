@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+func TestHandler_GetMyObservations(t *testing.T) {
+	created := time.Date(2025, 9, 14, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		url            string
+		anonymous      bool
+		serviceErr     error
+		expectedStatus int
+		check          func(t *testing.T, query sync.SubmissionQuery)
+	}{
+		{
+			name:           "defaults",
+			url:            "/observations/mine",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, query sync.SubmissionQuery) {
+				if query.Username != "enumerator" || query.Limit != 50 || query.Offset != 0 || query.Since != nil || query.Until != nil {
+					t.Errorf("Unexpected query: %+v", query)
+				}
+			},
+		},
+		{
+			name:           "one day of flagged records",
+			url:            "/observations/mine?since=2025-09-14&until=2025-09-14&status=flagged&form_type=household&limit=10&offset=20",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, query sync.SubmissionQuery) {
+				if query.Status != sync.SubmissionFlagged || query.FormType != "household" || query.Limit != 10 || query.Offset != 20 {
+					t.Errorf("Unexpected query: %+v", query)
+				}
+				if !query.Since.Equal(time.Date(2025, 9, 14, 0, 0, 0, 0, time.UTC)) || !query.Until.Equal(time.Date(2025, 9, 15, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("Expected the whole of 2025-09-14, got %v to %v", query.Since, query.Until)
+				}
+			},
+		},
+		{
+			name:           "rfc3339 until is exclusive as given",
+			url:            "/observations/mine?until=2025-09-14T12:00:00Z",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, query sync.SubmissionQuery) {
+				if !query.Until.Equal(time.Date(2025, 9, 14, 12, 0, 0, 0, time.UTC)) {
+					t.Errorf("Unexpected until %v", query.Until)
+				}
+			},
+		},
+		{name: "unknown status", url: "/observations/mine?status=approved", expectedStatus: http.StatusBadRequest},
+		{name: "limit too large", url: "/observations/mine?limit=501", expectedStatus: http.StatusBadRequest},
+		{name: "negative offset", url: "/observations/mine?offset=-1", expectedStatus: http.StatusBadRequest},
+		{name: "invalid since", url: "/observations/mine?since=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "anonymous", url: "/observations/mine", anonymous: true, expectedStatus: http.StatusUnauthorized},
+		{name: "service error", url: "/observations/mine", serviceErr: errors.New("db down"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var received sync.SubmissionQuery
+			mockSyncService := mocks.NewMockSyncService()
+			mockSyncService.ListSubmissionsFunc = func(ctx context.Context, query sync.SubmissionQuery) (*sync.SubmissionPage, error) {
+				received = query
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &sync.SubmissionPage{
+					Submissions: []sync.Submission{{
+						ObservationID: "obs-1", FormType: "household", FormVersion: "1.0",
+						CreatedAt: created, UpdatedAt: created, Version: 7,
+						Status: sync.SubmissionFlagged, Flags: []string{sync.WarningClockSkew},
+					}},
+					HasMore: true,
+				}, nil
+			}
+			h.syncService = mockSyncService
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if !tt.anonymous {
+				req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &models.User{Username: "enumerator", Role: models.RoleReadWrite}))
+			}
+			w := httptest.NewRecorder()
+			h.GetMyObservations(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			tt.check(t, received)
+
+			var response MyObservationsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Observations) != 1 || !response.HasMore || response.Observations[0].Flags[0] != sync.WarningClockSkew {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+		})
+	}
+}
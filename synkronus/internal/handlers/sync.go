@@ -3,7 +3,6 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/opendataensemble/synkronus/pkg/sync"
 )
@@ -13,6 +12,17 @@ type SyncPullRequest struct {
 	ClientID    string                `json:"client_id"`
 	Since       *SyncPullRequestSince `json:"since,omitempty"`
 	SchemaTypes []string              `json:"schema_types,omitempty"`
+	// CoreID limits the pull to the records of one participant or household
+	CoreID string `json:"core_id,omitempty"`
+	// Limit is the maximum number of records to return; the limit query parameter is still accepted
+	Limit *int `json:"limit,omitempty"`
+	// OrderBy sorts the records within the page: version (default), created_at, updated_at or form_type
+	OrderBy string `json:"order_by,omitempty"`
+	// Fields restricts the returned record fields; observation_id, version and deleted are always included
+	Fields []string `json:"fields,omitempty"`
+	// SyncFormatVersion selects the response format: 1.0 (default) returns record objects,
+	// 2.0 returns columns with lookup tables
+	SyncFormatVersion string `json:"sync_format_version,omitempty"`
 }
 
 // SyncPullRequestSince represents the pagination cursor in sync pull request
@@ -28,6 +38,8 @@ type SyncPullResponse struct {
 	ChangeCutoff      int64              `json:"change_cutoff"`
 	HasMore           *bool              `json:"has_more,omitempty"`
 	SyncFormatVersion *string            `json:"sync_format_version,omitempty"`
+	MinVersion        int64              `json:"min_version"`
+	ResyncRequired    bool               `json:"resync_required,omitempty"`
 }
 
 // Pull handles the /sync/pull endpoint
@@ -44,13 +56,10 @@ func (h *Handler) Pull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100 // default limit
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
+	opts, err := resolvePullOptions(&req, r.URL.Query())
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
 	}
 
 	schemaType := r.URL.Query().Get("schemaType")
@@ -78,24 +87,34 @@ func (h *Handler) Pull(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the sync service to get records
-	result, err := h.syncService.GetRecordsSinceVersion(r.Context(), sinceVersion, req.ClientID, schemaTypes, limit, cursor)
+	ctx := r.Context()
+	if req.CoreID != "" {
+		ctx = sync.WithCoreID(ctx, req.CoreID)
+	}
+	result, err := h.syncService.GetRecordsSinceVersion(ctx, sinceVersion, req.ClientID, schemaTypes, opts.limit, cursor)
 	if err != nil {
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
 		h.log.Error("Failed to get records since version", "error", err)
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to retrieve sync data")
 		return
 	}
 
 	// Build response
-	syncFormatVersion := "1.0"
+	syncFormatVersion := syncFormatRecords
 	response := SyncPullResponse{
 		CurrentVersion:    result.CurrentVersion,
 		Records:           result.Records,
 		ChangeCutoff:      result.ChangeCutoff,
 		HasMore:           &result.HasMore,
 		SyncFormatVersion: &syncFormatVersion,
+		MinVersion:        result.MinVersion,
+		ResyncRequired:    result.ResyncRequired,
 	}
 
 	// Note: Clients should use change_cutoff as the next since.version for pagination
+	sortRecords(response.Records, opts.orderBy)
 
 	h.log.Info("Sync pull request processed",
 		"clientId", req.ClientID,
@@ -103,8 +122,39 @@ func (h *Handler) Pull(w http.ResponseWriter, r *http.Request) {
 		"currentVersion", result.CurrentVersion,
 		"recordCount", len(result.Records),
 		"hasMore", result.HasMore,
+		"syncFormatVersion", opts.format,
 		"apiVersion", apiVersion)
 
+	if opts.format == syncFormatColumnar {
+		columns, lookups := columnarRecords(response.Records, opts.fields)
+		SendJSONResponse(w, http.StatusOK, SyncPullColumnarResponse{
+			CurrentVersion:    response.CurrentVersion,
+			ChangeCutoff:      response.ChangeCutoff,
+			HasMore:           response.HasMore,
+			SyncFormatVersion: syncFormatColumnar,
+			MinVersion:        response.MinVersion,
+			ResyncRequired:    response.ResyncRequired,
+			RecordCount:       len(response.Records),
+			Lookups:           lookups,
+			Columns:           columns,
+		})
+		return
+	}
+
+	if opts.fields != nil {
+		records, err := projectRecords(response.Records, opts.fields)
+		if err != nil {
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to build sync response")
+			return
+		}
+		// The outer records field replaces the full records of the embedded response
+		SendJSONResponse(w, http.StatusOK, struct {
+			SyncPullResponse
+			Records []map[string]json.RawMessage `json:"records"`
+		}{response, records})
+		return
+	}
+
 	SendJSONResponse(w, http.StatusOK, response)
 }
 
@@ -113,6 +163,9 @@ type SyncPushRequest struct {
 	TransmissionID string             `json:"transmission_id"`
 	ClientID       string             `json:"client_id"`
 	Records        []sync.Observation `json:"records"`
+	// DryRun runs every check of the push and reports the outcome per record without
+	// storing anything
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
 // SyncPushResponse represents the sync push response payload according to OpenAPI spec
@@ -121,6 +174,9 @@ type SyncPushResponse struct {
 	SuccessCount   int                      `json:"success_count"`
 	FailedRecords  []map[string]interface{} `json:"failed_records,omitempty"`
 	Warnings       []sync.SyncWarning       `json:"warnings,omitempty"`
+	DryRun         bool                     `json:"dry_run,omitempty"`
+	Outcomes       []sync.RecordOutcome     `json:"outcomes,omitempty"`
+	Conflicts      []sync.SyncConflict      `json:"conflicts,omitempty"`
 }
 
 // Push handles the /sync/push endpoint
@@ -152,8 +208,16 @@ func (h *Handler) Push(w http.ResponseWriter, r *http.Request) {
 	apiVersion := r.Header.Get("x-api-version")
 
 	// Process the records using the sync service
-	result, err := h.syncService.ProcessPushedRecords(r.Context(), req.Records, req.ClientID, req.TransmissionID)
+	ctx := r.Context()
+	if req.DryRun {
+		ctx = sync.WithDryRun(ctx)
+	}
+	result, err := h.syncService.ProcessPushedRecords(ctx, req.Records, req.ClientID, req.TransmissionID)
 	if err != nil {
+		// Nothing was stored; the client pushes the same records again
+		if h.sendDatabaseUnavailable(w, err) {
+			return
+		}
 		h.log.Error("Failed to process pushed records", "error", err)
 		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to process sync data")
 		return
@@ -165,6 +229,9 @@ func (h *Handler) Push(w http.ResponseWriter, r *http.Request) {
 		SuccessCount:   result.SuccessCount,
 		FailedRecords:  result.FailedRecords,
 		Warnings:       result.Warnings,
+		DryRun:         result.DryRun,
+		Outcomes:       result.Outcomes,
+		Conflicts:      result.Conflicts,
 	}
 
 	h.log.Info("Sync push request processed",
@@ -175,6 +242,7 @@ func (h *Handler) Push(w http.ResponseWriter, r *http.Request) {
 		"failedCount", len(result.FailedRecords),
 		"warningCount", len(result.Warnings),
 		"currentVersion", result.CurrentVersion,
+		"dryRun", result.DryRun,
 		"apiVersion", apiVersion)
 
 	// Send response
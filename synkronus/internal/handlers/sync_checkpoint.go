@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/opendataensemble/synkronus/pkg/checkpoint"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// SyncCheckpointRequest is the sync watermark a client reports after syncing
+type SyncCheckpointRequest struct {
+	ClientID string `json:"client_id"`
+	// PulledVersion is the current_version of the client's last complete pull
+	PulledVersion *int64 `json:"pulled_version"`
+	// PushedCount is how many records the client has pushed
+	PushedCount int64 `json:"pushed_count"`
+}
+
+// RecordSyncCheckpoint handles POST /sync/checkpoint
+// @Summary Report a sync checkpoint
+// @Description Records the version a client has pulled up to and how many records it has pushed, replacing its previous checkpoint. Checkpoints hold back attachment operation compaction and show admins which devices are behind; a client that is behind and stops reporting them is alerted as stalled.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param body body SyncCheckpointRequest true "Sync watermark of the client"
+// @Success 200 {object} checkpoint.Client
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "pulled_version is ahead of the server"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /sync/checkpoint [post]
+func (h *Handler) RecordSyncCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var req SyncCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+	if req.ClientID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "client_id is required")
+		return
+	}
+	if req.PulledVersion == nil {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "pulled_version is required")
+		return
+	}
+
+	cp := checkpoint.Checkpoint{ClientID: req.ClientID, PulledVersion: *req.PulledVersion, PushedCount: req.PushedCount}
+	if caller := authmw.GetUserFromContext(r.Context()); caller != nil {
+		cp.Username = caller.Username
+	}
+
+	client, err := h.checkpointService.Record(r.Context(), cp)
+	switch {
+	case errors.Is(err, checkpoint.ErrInvalidCheckpoint):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+		return
+	case errors.Is(err, checkpoint.ErrVersionAhead):
+		SendErrorResponse(w, http.StatusConflict, err, err.Error())
+		return
+	case err != nil:
+		h.log.Error("Failed to record sync checkpoint", "error", err, "clientId", req.ClientID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to record checkpoint")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, client)
+}
+
+// GetSyncClients handles GET /sync/clients
+// @Summary List sync clients
+// @Description Lists the clients that reported a sync checkpoint with how many versions each is behind, furthest behind first. Stalled clients are behind and have not reported a checkpoint within SYNC_STALLED_CLIENT_HOURS.
+// @Tags Sync
+// @Produce json
+// @Param behind query int false "Only clients at least this many versions behind"
+// @Param stalled query bool false "Only stalled clients"
+// @Success 200 {object} checkpoint.ClientList
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /sync/clients [get]
+func (h *Handler) GetSyncClients(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := checkpoint.Query{StalledOnly: params.Get("stalled") == "true"}
+	if behind := params.Get("behind"); behind != "" {
+		var err error
+		if query.MinBehind, err = strconv.ParseInt(behind, 10, 64); err != nil || query.MinBehind < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "behind must be a non-negative integer")
+			return
+		}
+	}
+
+	clients, err := h.checkpointService.List(r.Context(), query)
+	if err != nil {
+		h.log.Error("Failed to list sync clients", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to list sync clients")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, clients)
+}
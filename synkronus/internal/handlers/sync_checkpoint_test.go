@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/checkpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCheckpoints(t *testing.T) {
+	h, _ := createTestHandler()
+	checkpoints := mocks.NewMockCheckpointService()
+	checkpoints.Version = 50
+	h.checkpointService = checkpoints
+	r := chi.NewRouter()
+	r.Post("/sync/checkpoint", h.RecordSyncCheckpoint)
+	r.Get("/sync/clients", h.GetSyncClients)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := withTestUser(httptest.NewRequest(method, target, strings.NewReader(body)), "alice", models.RoleReadOnly)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/sync/checkpoint", `{"client_id":"tablet","pulled_version":10,"pushed_count":4}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var client checkpoint.Client
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &client))
+	assert.Equal(t, int64(40), client.Behind)
+	require.NotNil(t, client.Username)
+	assert.Equal(t, "alice", *client.Username)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/sync/checkpoint", `{"client_id":"phone","pulled_version":48}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/sync/checkpoint", `{"client_id":"phone","pulled_version":51}`).Code, "ahead of the server")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/sync/checkpoint", `{"client_id":"phone"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/sync/checkpoint", `{"pulled_version":1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/sync/checkpoint", `{"client_id":"phone","pulled_version":-1}`).Code)
+
+	w = do(http.MethodGet, "/sync/clients", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list checkpoint.ClientList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, int64(50), list.CurrentVersion)
+	require.Len(t, list.Clients, 2)
+	assert.Equal(t, "tablet", list.Clients[0].ClientID, "furthest behind first")
+
+	w = do(http.MethodGet, "/sync/clients?behind=5", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Clients, 1)
+	assert.Equal(t, "tablet", list.Clients[0].ClientID)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/sync/clients?behind=many", "").Code)
+}
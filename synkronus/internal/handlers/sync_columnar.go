@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// Pull response formats negotiated with sync_format_version
+const (
+	// syncFormatRecords returns an array of record objects
+	syncFormatRecords = "1.0"
+	// syncFormatColumnar returns an array per field, with repeated strings in lookup tables
+	syncFormatColumnar = "2.0"
+)
+
+// lookupFields are the columns sent as indexes into a lookup table, because a page
+// usually holds few distinct values repeated many times
+var lookupFields = map[string]bool{"form_type": true, "form_version": true}
+
+// SyncPullColumnarResponse is the pull response of format 2.0. Column i of every field
+// belongs to record i; form_type and form_version hold indexes into lookups.
+type SyncPullColumnarResponse struct {
+	CurrentVersion    int64               `json:"current_version"`
+	ChangeCutoff      int64               `json:"change_cutoff"`
+	HasMore           *bool               `json:"has_more,omitempty"`
+	SyncFormatVersion string              `json:"sync_format_version"`
+	MinVersion        int64               `json:"min_version"`
+	ResyncRequired    bool                `json:"resync_required,omitempty"`
+	RecordCount       int                 `json:"record_count"`
+	Lookups           map[string][]string `json:"lookups"`
+	// Columns holds the selected fields; fields that are null for every record are left out
+	Columns map[string]interface{} `json:"columns"`
+}
+
+// lookupTable assigns indexes to distinct strings in order of appearance
+type lookupTable struct {
+	values  []string
+	indexes map[string]int
+}
+
+func (t *lookupTable) index(value string) int {
+	if i, ok := t.indexes[value]; ok {
+		return i
+	}
+	if t.indexes == nil {
+		t.indexes = make(map[string]int)
+	}
+	t.indexes[value] = len(t.values)
+	t.values = append(t.values, value)
+	return len(t.values) - 1
+}
+
+// columnarRecords turns records into columns of the selected fields (all fields when
+// fields is nil) and the lookup tables they index
+func columnarRecords(records []sync.Observation, fields []string) (map[string]interface{}, map[string][]string) {
+	if fields == nil {
+		for field := range pullRecordFields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+
+	columns := make(map[string]interface{}, len(fields))
+	lookups := make(map[string][]string)
+	for _, field := range fields {
+		if lookupFields[field] {
+			var table lookupTable
+			column := make([]int, len(records))
+			for i := range records {
+				value := records[i].FormType
+				if field == "form_version" {
+					value = records[i].FormVersion
+				}
+				column[i] = table.index(value)
+			}
+			columns[field] = column
+			lookups[field] = append([]string{}, table.values...)
+			continue
+		}
+
+		switch field {
+		case "observation_id":
+			columns[field] = stringColumn(records, func(r *sync.Observation) string { return r.ObservationID })
+		case "created_at":
+			columns[field] = stringColumn(records, func(r *sync.Observation) string { return r.CreatedAt })
+		case "updated_at":
+			columns[field] = stringColumn(records, func(r *sync.Observation) string { return r.UpdatedAt })
+		case "data":
+			column := make([]json.RawMessage, len(records))
+			for i := range records {
+				column[i] = records[i].Data
+			}
+			columns[field] = column
+		case "deleted":
+			column := make([]bool, len(records))
+			for i := range records {
+				column[i] = records[i].Deleted
+			}
+			columns[field] = column
+		case "version":
+			column := make([]int64, len(records))
+			for i := range records {
+				column[i] = records[i].Version
+			}
+			columns[field] = column
+		case "synced_at":
+			column := make([]*string, len(records))
+			present := false
+			for i := range records {
+				column[i] = records[i].SyncedAt
+				present = present || column[i] != nil
+			}
+			if present {
+				columns[field] = column
+			}
+		case "geolocation":
+			column := make([]*sync.Geolocation, len(records))
+			present := false
+			for i := range records {
+				column[i] = records[i].Geolocation
+				present = present || column[i] != nil
+			}
+			if present {
+				columns[field] = column
+			}
+		}
+	}
+	return columns, lookups
+}
+
+func stringColumn(records []sync.Observation, value func(*sync.Observation) string) []string {
+	column := make([]string, len(records))
+	for i := range records {
+		column[i] = value(&records[i])
+	}
+	return column
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnarRecords(t *testing.T) {
+	syncedAt := "2025-01-04T00:00:00Z"
+	records := []sync.Observation{
+		{ObservationID: "a", FormType: "survey", FormVersion: "2", Data: json.RawMessage(`{"a":1}`), Version: 1, SyncedAt: &syncedAt},
+		{ObservationID: "b", FormType: "household", FormVersion: "1", Data: json.RawMessage(`{"a":2}`), Version: 2, Deleted: true},
+		{ObservationID: "c", FormType: "survey", FormVersion: "2", Data: json.RawMessage(`{"a":3}`), Version: 3},
+	}
+
+	columns, lookups := columnarRecords(records, nil)
+	assert.Equal(t, map[string][]string{
+		"form_type":    {"survey", "household"},
+		"form_version": {"2", "1"},
+	}, lookups)
+	assert.Equal(t, []int{0, 1, 0}, columns["form_type"])
+	assert.Equal(t, []int{0, 1, 0}, columns["form_version"])
+	assert.Equal(t, []string{"a", "b", "c"}, columns["observation_id"])
+	assert.Equal(t, []int64{1, 2, 3}, columns["version"])
+	assert.Equal(t, []bool{false, true, false}, columns["deleted"])
+	assert.Equal(t, []*string{&syncedAt, nil, nil}, columns["synced_at"])
+	assert.NotContains(t, columns, "geolocation", "columns that are null for every record are left out")
+
+	columns, lookups = columnarRecords(records, []string{"deleted", "form_type", "observation_id", "version"})
+	assert.Len(t, columns, 4)
+	assert.Equal(t, map[string][]string{"form_type": {"survey", "household"}}, lookups)
+}
+
+func TestPull_ColumnarFormat(t *testing.T) {
+	h, _ := createTestHandler()
+	_, err := h.syncService.ProcessPushedRecords(context.Background(), []sync.Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1", Data: json.RawMessage(`{"a":1}`), CreatedAt: "2025-01-01T00:00:00Z", UpdatedAt: "2025-01-01T00:00:00Z"},
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1", Data: json.RawMessage(`{"a":2}`), CreatedAt: "2025-01-02T00:00:00Z", UpdatedAt: "2025-01-02T00:00:00Z"},
+	}, "other-client", "tx-1")
+	require.NoError(t, err)
+
+	body, err := json.Marshal(SyncPullRequest{ClientID: "test-client-id", SyncFormatVersion: "2.0"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/sync/pull", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.Pull(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		SyncFormatVersion string                     `json:"sync_format_version"`
+		RecordCount       int                        `json:"record_count"`
+		Lookups           map[string][]string        `json:"lookups"`
+		Columns           map[string]json.RawMessage `json:"columns"`
+		Records           []json.RawMessage          `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "2.0", resp.SyncFormatVersion)
+	assert.Equal(t, 2, resp.RecordCount)
+	assert.Nil(t, resp.Records)
+	assert.Equal(t, []string{"survey"}, resp.Lookups["form_type"])
+	assert.JSONEq(t, `[0,0]`, string(resp.Columns["form_type"]))
+	assert.JSONEq(t, `[{"a":1},{"a":2}]`, string(resp.Columns["data"]))
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
@@ -282,6 +283,26 @@ func createTestServerWithDB(t *testing.T, db *sql.DB) *httptest.Server {
 		&mockVersionService{},
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	)
 
 	// Create router with authentication middleware
@@ -306,9 +327,36 @@ func (m *mockAuthService) GenerateToken(user *models.User) (string, error) { ret
 func (m *mockAuthService) GenerateRefreshToken(user *models.User) (string, error) {
 	return "refresh", nil
 }
-func (m *mockAuthService) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+func (m *mockAuthService) StartSession(ctx context.Context, user *models.User, client auth.ClientInfo) (string, string, error) {
+	return "token", "refresh", nil
+}
+func (m *mockAuthService) RefreshToken(ctx context.Context, refreshToken string, client auth.ClientInfo) (string, string, error) {
 	return "new-token", "new-refresh", nil
 }
+func (m *mockAuthService) CheckSession(ctx context.Context, claims *auth.AuthClaims) error {
+	return nil
+}
+func (m *mockAuthService) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	return []models.Session{}, nil
+}
+func (m *mockAuthService) RevokeSession(ctx context.Context, username string, id uuid.UUID) error {
+	return nil
+}
+func (m *mockAuthService) RevokeSessions(ctx context.Context, username string) (int, error) {
+	return 0, nil
+}
+func (m *mockAuthService) RevokeOtherSessions(ctx context.Context, username string, keep uuid.UUID) (int, error) {
+	return 0, nil
+}
+func (m *mockAuthService) Impersonate(ctx context.Context, admin, username, reason string, client auth.ClientInfo) (string, *models.Session, error) {
+	return "token", &models.Session{}, nil
+}
+func (m *mockAuthService) RecordImpersonatedRequest(ctx context.Context, claims *auth.AuthClaims, method, path string, status int) error {
+	return nil
+}
+func (m *mockAuthService) ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error) {
+	return []models.ImpersonationAuditEntry{}, nil
+}
 func (m *mockAuthService) ValidateToken(tokenString string) (*auth.AuthClaims, error) {
 	return &auth.AuthClaims{Username: "test", Role: models.RoleReadWrite}, nil
 }
@@ -328,6 +376,9 @@ func (m *mockAppBundleService) GetFile(ctx context.Context, path string) (io.Rea
 func (m *mockAppBundleService) GetLatestVersionFile(ctx context.Context, path string) (io.ReadCloser, *appbundle.File, error) {
 	return nil, nil, nil
 }
+func (m *mockAppBundleService) GetVersionFile(ctx context.Context, version, path string) (io.ReadCloser, *appbundle.File, error) {
+	return nil, nil, nil
+}
 func (m *mockAppBundleService) GetFileHash(ctx context.Context, path string, useLatest bool) (string, error) {
 	return "hash", nil
 }
@@ -335,10 +386,37 @@ func (m *mockAppBundleService) RefreshManifest() error { return nil }
 func (m *mockAppBundleService) PushBundle(ctx context.Context, zipReader io.Reader) (*appbundle.Manifest, error) {
 	return &appbundle.Manifest{Version: "1.0.0"}, nil
 }
+func (m *mockAppBundleService) PushDraft(ctx context.Context, zipReader io.Reader) (*appbundle.Manifest, error) {
+	return &appbundle.Manifest{Version: appbundle.DraftVersion}, nil
+}
+func (m *mockAppBundleService) PromoteDraft(ctx context.Context) (*appbundle.Manifest, error) {
+	return &appbundle.Manifest{Version: "1.0.1"}, nil
+}
+func (m *mockAppBundleService) GetPushStatus(ctx context.Context) (*appbundle.PushStatus, error) {
+	return &appbundle.PushStatus{}, nil
+}
 func (m *mockAppBundleService) GetVersions(ctx context.Context) ([]string, error) {
 	return []string{"1.0.0"}, nil
 }
+func (m *mockAppBundleService) GetVersionDetails(ctx context.Context) ([]appbundle.VersionInfo, error) {
+	return []appbundle.VersionInfo{{Version: "1.0.0", Active: true}}, nil
+}
+func (m *mockAppBundleService) SetVersionInternal(ctx context.Context, version string, internal bool) error {
+	return nil
+}
+func (m *mockAppBundleService) GetBootScreenshot(ctx context.Context, version string) ([]byte, error) {
+	return nil, nil
+}
 func (m *mockAppBundleService) SwitchVersion(ctx context.Context, version string) error { return nil }
+func (m *mockAppBundleService) RollbackVersion(ctx context.Context) (*appbundle.RollbackResult, error) {
+	return nil, nil
+}
+func (m *mockAppBundleService) ScheduleSwitch(ctx context.Context, version string, effectiveAt time.Time) error {
+	return nil
+}
+func (m *mockAppBundleService) GetScheduledSwitch(ctx context.Context) (*appbundle.ScheduledSwitch, error) {
+	return nil, nil
+}
 func (m *mockAppBundleService) GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error) {
 	return &appbundle.AppInfo{}, nil
 }
@@ -348,6 +426,12 @@ func (m *mockAppBundleService) GetLatestAppInfo(ctx context.Context) (*appbundle
 func (m *mockAppBundleService) CompareAppInfos(ctx context.Context, versionA, versionB string) (*appbundle.ChangeLog, error) {
 	return &appbundle.ChangeLog{}, nil
 }
+func (m *mockAppBundleService) CompareBundleFiles(ctx context.Context, versionA, versionB string) (*appbundle.FileChanges, error) {
+	return &appbundle.FileChanges{}, nil
+}
+func (m *mockAppBundleService) GetChangeHistory(ctx context.Context, filter appbundle.ChangeHistoryFilter) ([]appbundle.ChangeHistoryEntry, error) {
+	return []appbundle.ChangeHistoryEntry{}, nil
+}
 func (m *mockAppBundleService) GetBundleZipPath(ctx context.Context) (string, error) {
 	return "/mock/bundle.zip", nil
 }
@@ -361,12 +445,31 @@ func (m *mockUserService) DeleteUser(ctx context.Context, username string) error
 func (m *mockUserService) ResetPassword(ctx context.Context, username, newPassword string) error {
 	return nil
 }
-func (m *mockUserService) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error {
+func (m *mockUserService) ChangePassword(ctx context.Context, username, currentPassword, newPassword string, keepSession uuid.UUID) error {
 	return nil
 }
 func (m *mockUserService) ListUsers(ctx context.Context) ([]models.User, error) {
 	return []models.User{}, nil
 }
+func (m *mockUserService) CreateInvitation(ctx context.Context, role models.Role, email, createdBy string, ttl time.Duration) (*models.Invitation, string, error) {
+	return &models.Invitation{ID: uuid.New(), Role: role}, "token", nil
+}
+func (m *mockUserService) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	return []models.Invitation{}, nil
+}
+func (m *mockUserService) RevokeInvitation(ctx context.Context, id uuid.UUID) error { return nil }
+func (m *mockUserService) RegisterWithInvitation(ctx context.Context, token, username, password string) (*models.User, error) {
+	return &models.User{ID: uuid.New(), Username: username, Role: models.RoleReadWrite}, nil
+}
+func (m *mockUserService) SetEmail(ctx context.Context, username, email string) error {
+	return nil
+}
+func (m *mockUserService) RequestPasswordReset(ctx context.Context, identifier string) error {
+	return nil
+}
+func (m *mockUserService) ResetPasswordWithToken(ctx context.Context, token, newPassword string) error {
+	return nil
+}
 
 type mockVersionService struct{}
 
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// Record orderings accepted by order_by. Pages are always cut in version order so that
+// change_cutoff stays a valid cursor; order_by only sorts the records within a page.
+const (
+	pullOrderVersion   = "version"
+	pullOrderCreatedAt = "created_at"
+	pullOrderUpdatedAt = "updated_at"
+	pullOrderFormType  = "form_type"
+)
+
+// pullRecordFields are the record fields that can be selected with fields
+var pullRecordFields = map[string]bool{
+	"observation_id": true,
+	"form_type":      true,
+	"form_version":   true,
+	"data":           true,
+	"created_at":     true,
+	"updated_at":     true,
+	"synced_at":      true,
+	"deleted":        true,
+	"version":        true,
+	"geolocation":    true,
+}
+
+// pullRequiredFields are always returned because clients need them to apply a page
+var pullRequiredFields = []string{"observation_id", "version", "deleted"}
+
+// pullOptions are the validated paging and shaping options of a pull request
+type pullOptions struct {
+	limit   int // 0 lets the sync service apply its default
+	orderBy string
+	fields  []string // nil returns full records
+	format  string   // response format, a sync format version
+}
+
+// resolvePullOptions merges the body options with the legacy limit query parameter and
+// validates them. The query limit keeps its old leniency: a value that isn't a positive
+// integer is ignored and the default applies. A valid query limit that disagrees with the
+// body is rejected rather than silently picking one.
+func resolvePullOptions(req *SyncPullRequest, query url.Values) (*pullOptions, error) {
+	opts := &pullOptions{orderBy: pullOrderVersion, format: syncFormatRecords}
+
+	if req.Limit != nil {
+		if *req.Limit <= 0 {
+			return nil, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.limit = *req.Limit
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		if req.Limit != nil && *req.Limit != limit {
+			return nil, fmt.Errorf("limit in the query string (%d) conflicts with limit in the body (%d)", limit, *req.Limit)
+		}
+		opts.limit = limit
+	}
+
+	switch req.OrderBy {
+	case "":
+	case pullOrderVersion, pullOrderCreatedAt, pullOrderUpdatedAt, pullOrderFormType:
+		opts.orderBy = req.OrderBy
+	default:
+		return nil, fmt.Errorf("order_by must be one of version, created_at, updated_at, form_type")
+	}
+
+	if len(req.Fields) > 0 {
+		selected := make(map[string]bool, len(req.Fields)+len(pullRequiredFields))
+		for _, field := range pullRequiredFields {
+			selected[field] = true
+		}
+		for _, field := range req.Fields {
+			if !pullRecordFields[field] {
+				return nil, fmt.Errorf("unknown field %q in fields", field)
+			}
+			selected[field] = true
+		}
+		for field := range selected {
+			opts.fields = append(opts.fields, field)
+		}
+		sort.Strings(opts.fields)
+	}
+
+	switch req.SyncFormatVersion {
+	case "":
+	case syncFormatRecords, syncFormatColumnar:
+		opts.format = req.SyncFormatVersion
+	default:
+		return nil, fmt.Errorf("sync_format_version must be %s or %s", syncFormatRecords, syncFormatColumnar)
+	}
+
+	return opts, nil
+}
+
+// sortRecords orders the records of a page. The sort is stable, so ties keep version order.
+func sortRecords(records []sync.Observation, orderBy string) {
+	var less func(a, b *sync.Observation) bool
+	switch orderBy {
+	case pullOrderCreatedAt:
+		less = func(a, b *sync.Observation) bool { return a.CreatedAt < b.CreatedAt }
+	case pullOrderUpdatedAt:
+		less = func(a, b *sync.Observation) bool { return a.UpdatedAt < b.UpdatedAt }
+	case pullOrderFormType:
+		less = func(a, b *sync.Observation) bool { return a.FormType < b.FormType }
+	default:
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool { return less(&records[i], &records[j]) })
+}
+
+// projectRecords keeps only the selected fields of each record
+func projectRecords(records []sync.Observation, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &full); err != nil {
+			return nil, err
+		}
+		out := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := full[field]; ok {
+				out[field] = value
+			}
+		}
+		projected = append(projected, out)
+	}
+	return projected, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePullOptions(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+
+	tests := []struct {
+		name        string
+		req         SyncPullRequest
+		query       string
+		wantLimit   int
+		wantOrder   string
+		wantFields  []string
+		wantFormat  string
+		wantErrText string
+	}{
+		{name: "defaults", wantOrder: "version"},
+		{name: "limit from body", req: SyncPullRequest{Limit: intPtr(25)}, wantLimit: 25, wantOrder: "version"},
+		{name: "limit from query", query: "limit=30", wantLimit: 30, wantOrder: "version"},
+		{name: "same limit in both", req: SyncPullRequest{Limit: intPtr(30)}, query: "limit=30", wantLimit: 30, wantOrder: "version"},
+		{name: "conflicting limits", req: SyncPullRequest{Limit: intPtr(10)}, query: "limit=30", wantErrText: "conflicts"},
+		{name: "zero body limit", req: SyncPullRequest{Limit: intPtr(0)}, wantErrText: "positive"},
+		{name: "invalid query limit falls back to the default", query: "limit=abc", wantLimit: 0, wantOrder: "version"},
+		{name: "zero query limit falls back to the default", query: "limit=0", wantLimit: 0, wantOrder: "version"},
+		{name: "empty query limit falls back to the default", query: "limit=", wantLimit: 0, wantOrder: "version"},
+		{name: "invalid query limit keeps the body limit", req: SyncPullRequest{Limit: intPtr(25)}, query: "limit=-1", wantLimit: 25, wantOrder: "version"},
+		{name: "order by created_at", req: SyncPullRequest{OrderBy: "created_at"}, wantOrder: "created_at"},
+		{name: "unknown order", req: SyncPullRequest{OrderBy: "data"}, wantErrText: "order_by"},
+		{
+			name:       "fields include required ones",
+			req:        SyncPullRequest{Fields: []string{"data", "form_type"}},
+			wantOrder:  "version",
+			wantFields: []string{"data", "deleted", "form_type", "observation_id", "version"},
+		},
+		{name: "unknown field", req: SyncPullRequest{Fields: []string{"secret"}}, wantErrText: "unknown field"},
+		{name: "columnar format", req: SyncPullRequest{SyncFormatVersion: "2.0"}, wantOrder: "version", wantFormat: "2.0"},
+		{name: "unknown format", req: SyncPullRequest{SyncFormatVersion: "3.0"}, wantErrText: "sync_format_version"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			opts, err := resolvePullOptions(&tc.req, query)
+			if tc.wantErrText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrText)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantLimit, opts.limit)
+			assert.Equal(t, tc.wantOrder, opts.orderBy)
+			assert.Equal(t, tc.wantFields, opts.fields)
+			if tc.wantFormat == "" {
+				tc.wantFormat = "1.0"
+			}
+			assert.Equal(t, tc.wantFormat, opts.format)
+		})
+	}
+}
+
+func TestSortRecords(t *testing.T) {
+	records := []sync.Observation{
+		{ObservationID: "a", FormType: "survey", CreatedAt: "2025-01-03T00:00:00Z", Version: 1},
+		{ObservationID: "b", FormType: "household", CreatedAt: "2025-01-01T00:00:00Z", Version: 2},
+		{ObservationID: "c", FormType: "survey", CreatedAt: "2025-01-02T00:00:00Z", Version: 3},
+	}
+	ids := func() []string {
+		var out []string
+		for _, r := range records {
+			out = append(out, r.ObservationID)
+		}
+		return out
+	}
+
+	sortRecords(records, "version")
+	assert.Equal(t, []string{"a", "b", "c"}, ids())
+
+	sortRecords(records, "created_at")
+	assert.Equal(t, []string{"b", "c", "a"}, ids())
+
+	sortRecords(records, "form_type")
+	assert.Equal(t, []string{"b", "c", "a"}, ids(), "ties keep their previous order")
+}
+
+func TestPull_BodyOptions(t *testing.T) {
+	h, _ := createTestHandler()
+	_, err := h.syncService.ProcessPushedRecords(context.Background(), []sync.Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1", Data: json.RawMessage(`{"a":1}`), CreatedAt: "2025-01-02T00:00:00Z", UpdatedAt: "2025-01-02T00:00:00Z"},
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1", Data: json.RawMessage(`{"a":2}`), CreatedAt: "2025-01-01T00:00:00Z", UpdatedAt: "2025-01-01T00:00:00Z"},
+	}, "other-client", "tx-1")
+	require.NoError(t, err)
+
+	limit := 1
+	body, err := json.Marshal(SyncPullRequest{
+		ClientID: "test-client-id",
+		Limit:    &limit,
+		Fields:   []string{"form_type"},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/sync/pull", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.Pull(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Records []map[string]any `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Records, 1)
+	assert.ElementsMatch(t, []string{"observation_id", "version", "deleted", "form_type"}, recordKeys(resp.Records[0]))
+
+	// A query limit that disagrees with the body is rejected
+	req = httptest.NewRequest(http.MethodPost, "/sync/pull?limit=5", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	h.Pull(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func recordKeys(m map[string]any) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/opendataensemble/synkronus/pkg/sync"
@@ -263,3 +264,51 @@ func TestPush(t *testing.T) {
 		})
 	}
 }
+
+func TestPushDryRun(t *testing.T) {
+	h, _ := createTestHandler()
+
+	push := func(dryRun bool, records ...sync.Observation) SyncPushResponse {
+		t.Helper()
+		reqBytes, _ := json.Marshal(SyncPushRequest{TransmissionID: "tx-dry", ClientID: "test-client", Records: records, DryRun: dryRun})
+		rr := httptest.NewRecorder()
+		h.Push(rr, httptest.NewRequest("POST", "/sync/push", bytes.NewReader(reqBytes)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var resp SyncPushResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+	record := func(id string) sync.Observation {
+		return sync.Observation{ObservationID: id, FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`),
+			CreatedAt: "2025-06-25T12:00:00Z", UpdatedAt: "2025-06-25T12:00:00Z"}
+	}
+
+	stored := push(false, record("obs-stored"))
+
+	resp := push(true, record("obs-new"), record(""), record("obs-stored"))
+	if !resp.DryRun {
+		t.Error("expected the response to be marked as a dry run")
+	}
+	if resp.CurrentVersion != stored.CurrentVersion {
+		t.Errorf("expected a dry run to keep version %d, got %d", stored.CurrentVersion, resp.CurrentVersion)
+	}
+	if resp.SuccessCount != 2 || len(resp.FailedRecords) != 1 {
+		t.Errorf("expected 2 successes and 1 failure, got %d and %d", resp.SuccessCount, len(resp.FailedRecords))
+	}
+	outcomes := make([]string, len(resp.Outcomes))
+	for i, outcome := range resp.Outcomes {
+		outcomes[i] = outcome.Outcome
+	}
+	if strings.Join(outcomes, ",") != "create,failed,update" {
+		t.Errorf("expected outcomes create,failed,update, got %v", outcomes)
+	}
+
+	// Nothing was stored, so a real push still creates the record
+	if resp := push(false, record("obs-new")); resp.DryRun || resp.Outcomes != nil || resp.CurrentVersion != stored.CurrentVersion+1 {
+		t.Errorf("unexpected response to the real push: %+v", resp)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+// SyncWarningAckRequest selects warnings of a client to acknowledge
+type SyncWarningAckRequest struct {
+	ClientID   string   `json:"client_id"`
+	WarningIDs []int64  `json:"warning_ids,omitempty"`
+	Codes      []string `json:"codes,omitempty"`
+}
+
+// SyncWarningAckResponse reports how many warnings were acknowledged
+type SyncWarningAckResponse struct {
+	Acknowledged int64 `json:"acknowledged"`
+}
+
+// SyncWarningSummaryResponse is the admin dashboard view of recorded warnings
+type SyncWarningSummaryResponse struct {
+	Warnings []sync.WarningSummary `json:"warnings"`
+}
+
+// SyncWarningCatalogResponse lists the warning codes a push can return
+type SyncWarningCatalogResponse struct {
+	Warnings []sync.WarningDefinition `json:"warnings"`
+}
+
+// AcknowledgeSyncWarnings handles POST /sync/warnings/ack
+// @Summary Acknowledge sync warnings
+// @Description Marks warnings returned by earlier pushes as dealt with, by warning_id and/or by code. Only warnings of the given client are affected.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param body body SyncWarningAckRequest true "Warnings to acknowledge"
+// @Success 200 {object} SyncWarningAckResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /sync/warnings/ack [post]
+func (h *Handler) AcknowledgeSyncWarnings(w http.ResponseWriter, r *http.Request) {
+	var req SyncWarningAckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request format")
+		return
+	}
+	if req.ClientID == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "client_id is required")
+		return
+	}
+	if len(req.WarningIDs) == 0 && len(req.Codes) == 0 {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "warning_ids or codes is required")
+		return
+	}
+	for _, code := range req.Codes {
+		if _, ok := sync.LookupWarning(code); !ok {
+			SendErrorResponse(w, http.StatusBadRequest, nil, "Unknown warning code: "+code)
+			return
+		}
+	}
+
+	acknowledged, err := h.syncService.AcknowledgeWarnings(r.Context(), req.ClientID, sync.WarningAck{IDs: req.WarningIDs, Codes: req.Codes})
+	if err != nil {
+		h.log.Error("Failed to acknowledge sync warnings", "error", err, "clientId", req.ClientID)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to acknowledge warnings")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, SyncWarningAckResponse{Acknowledged: acknowledged})
+}
+
+// GetSyncWarnings handles GET /sync/warnings
+// @Summary Summarize recorded sync warnings
+// @Description Counts the warnings returned to clients per client and code, with the unacknowledged ones first. Pairs whose warnings are all acknowledged are left out unless include_acknowledged is true.
+// @Tags Sync
+// @Produce json
+// @Param client_id query string false "Only this client"
+// @Param code query string false "Only this warning code"
+// @Param include_acknowledged query bool false "Also list fully acknowledged client/code pairs"
+// @Success 200 {object} SyncWarningSummaryResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /sync/warnings [get]
+func (h *Handler) GetSyncWarnings(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := sync.WarningQuery{
+		ClientID:            params.Get("client_id"),
+		Code:                params.Get("code"),
+		IncludeAcknowledged: params.Get("include_acknowledged") == "true",
+	}
+	if query.Code != "" {
+		if _, ok := sync.LookupWarning(query.Code); !ok {
+			SendErrorResponse(w, http.StatusBadRequest, nil, "Unknown warning code: "+query.Code)
+			return
+		}
+	}
+
+	summaries, err := h.syncService.GetWarningSummary(r.Context(), query)
+	if err != nil {
+		h.log.Error("Failed to summarize sync warnings", "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to get sync warnings")
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, SyncWarningSummaryResponse{Warnings: summaries})
+}
+
+// GetSyncWarningCatalog handles GET /sync/warnings/catalog
+// @Summary List sync warning codes
+// @Description Lists every warning code a push can return, with its severity and meaning
+// @Tags Sync
+// @Produce json
+// @Success 200 {object} SyncWarningCatalogResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /sync/warnings/catalog [get]
+func (h *Handler) GetSyncWarningCatalog(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, SyncWarningCatalogResponse{Warnings: sync.WarningCatalog})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+)
+
+func TestHandler_AcknowledgeSyncWarnings(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectedAck    sync.WarningAck
+	}{
+		{
+			name:           "by id and code",
+			body:           `{"client_id":"device-1","warning_ids":[3,4],"codes":["CLOCK_SKEW"]}`,
+			expectedStatus: http.StatusOK,
+			expectedAck:    sync.WarningAck{IDs: []int64{3, 4}, Codes: []string{sync.WarningClockSkew}},
+		},
+		{
+			name:           "missing client id",
+			body:           `{"warning_ids":[3]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "nothing selected",
+			body:           `{"client_id":"device-1"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown code",
+			body:           `{"client_id":"device-1","codes":["NOPE"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid json",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "service error",
+			body:           `{"client_id":"device-1","warning_ids":[3]}`,
+			serviceErr:     errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedAck:    sync.WarningAck{IDs: []int64{3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := createTestHandler()
+
+			var receivedClient string
+			var received sync.WarningAck
+			mockSyncService := mocks.NewMockSyncService()
+			mockSyncService.AcknowledgeWarningsFunc = func(ctx context.Context, clientID string, ack sync.WarningAck) (int64, error) {
+				receivedClient, received = clientID, ack
+				if tt.serviceErr != nil {
+					return 0, tt.serviceErr
+				}
+				return 5, nil
+			}
+			h.syncService = mockSyncService
+
+			w := httptest.NewRecorder()
+			h.AcknowledgeSyncWarnings(w, httptest.NewRequest(http.MethodPost, "/sync/warnings/ack", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if len(tt.expectedAck.IDs)+len(tt.expectedAck.Codes) > 0 {
+				if receivedClient != "device-1" || len(received.IDs) != len(tt.expectedAck.IDs) || len(received.Codes) != len(tt.expectedAck.Codes) {
+					t.Errorf("Unexpected acknowledgement for %q: %+v", receivedClient, received)
+				}
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response SyncWarningAckResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Acknowledged != 5 {
+				t.Errorf("Expected 5 acknowledged, got %d", response.Acknowledged)
+			}
+		})
+	}
+}
+
+func TestHandler_GetSyncWarnings(t *testing.T) {
+	h, _ := createTestHandler()
+
+	var received sync.WarningQuery
+	seen := time.Date(2025, 9, 11, 8, 0, 0, 0, time.UTC)
+	mockSyncService := mocks.NewMockSyncService()
+	mockSyncService.GetWarningSummaryFunc = func(ctx context.Context, query sync.WarningQuery) ([]sync.WarningSummary, error) {
+		received = query
+		return []sync.WarningSummary{{
+			ClientID: "device-1", Code: sync.WarningClockSkew, Severity: sync.SeverityWarning,
+			Total: 12, Unacknowledged: 9, FirstSeenAt: seen, LastSeenAt: seen, LastMessage: "updated_at is 2h0m0s ahead of the server clock",
+		}}, nil
+	}
+	h.syncService = mockSyncService
+
+	w := httptest.NewRecorder()
+	h.GetSyncWarnings(w, httptest.NewRequest(http.MethodGet, "/sync/warnings?client_id=device-1&code=CLOCK_SKEW&include_acknowledged=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if received.ClientID != "device-1" || received.Code != sync.WarningClockSkew || !received.IncludeAcknowledged {
+		t.Errorf("Unexpected query: %+v", received)
+	}
+	var response SyncWarningSummaryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Warnings) != 1 || response.Warnings[0].Unacknowledged != 9 {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+
+	w = httptest.NewRecorder()
+	h.GetSyncWarnings(w, httptest.NewRequest(http.MethodGet, "/sync/warnings?code=NOPE", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown code, got %d", w.Code)
+	}
+}
+
+func TestHandler_GetSyncWarningCatalog(t *testing.T) {
+	h, _ := createTestHandler()
+
+	w := httptest.NewRecorder()
+	h.GetSyncWarningCatalog(w, httptest.NewRequest(http.MethodGet, "/sync/warnings/catalog", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response SyncWarningCatalogResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Warnings) != len(sync.WarningCatalog) {
+		t.Errorf("Expected %d catalog entries, got %d", len(sync.WarningCatalog), len(response.Warnings))
+	}
+}
@@ -45,6 +45,26 @@ func createTestHandler() (*Handler, *mocks.MockAppBundleService) {
 		mockVersionService,
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	)
 
 	return h, mockAppBundleService
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
 	"github.com/opendataensemble/synkronus/pkg/user"
 )
 
@@ -14,6 +18,7 @@ type UserCreateRequest struct {
 	Username string      `json:"username"`
 	Password string      `json:"password"`
 	Role     models.Role `json:"role"`
+	Email    string      `json:"email,omitempty"` // Optional; needed for password reset by email
 }
 
 // UserResponse represents the response body for a user
@@ -21,6 +26,7 @@ type UserCreateRequest struct {
 type UserResponse struct {
 	Username string      `json:"username"`
 	Role     models.Role `json:"role"`
+	Email    string      `json:"email,omitempty"`
 }
 
 // CreateUserHandler handles POST /users/create (admin only)
@@ -34,6 +40,12 @@ func (h *Handler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, http.StatusBadRequest, nil, "Missing required fields")
 		return
 	}
+	if req.Email != "" {
+		if err := mail.ValidateAddress(req.Email); err != nil {
+			SendErrorResponse(w, http.StatusBadRequest, err, "Invalid email address")
+			return
+		}
+	}
 	newUser, err := h.userService.CreateUser(r.Context(), req.Username, req.Password, req.Role)
 	if err != nil {
 		if err == user.ErrUserExists {
@@ -43,8 +55,16 @@ func (h *Handler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
 		return
 	}
+	if req.Email != "" {
+		// The user exists either way; an unusable address is reported but not fatal
+		if err := h.userService.SetEmail(r.Context(), newUser.Username, req.Email); err != nil {
+			h.log.Warn("Failed to set email for new user", "username", newUser.Username, "error", err)
+		} else {
+			newUser.Email = req.Email
+		}
+	}
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(UserResponse{Username: newUser.Username, Role: newUser.Role}); err != nil {
+	if err := json.NewEncoder(w).Encode(UserResponse{Username: newUser.Username, Role: newUser.Role, Email: newUser.Email}); err != nil {
 		h.log.Error("Failed to encode user response", "error", err)
 	}
 }
@@ -101,6 +121,41 @@ func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SetEmailRequest represents the request body for setting a user's email address
+type SetEmailRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"` // Empty clears the address
+}
+
+// SetEmailHandler handles POST /users/set-email (admin only)
+func (h *Handler) SetEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req SetEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.Username == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "Missing required fields")
+		return
+	}
+	err := h.userService.SetEmail(r.Context(), req.Username, req.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			SendErrorResponse(w, http.StatusNotFound, err, "User not found")
+		case errors.Is(err, user.ErrInvalidEmail):
+			SendErrorResponse(w, http.StatusBadRequest, err, "Invalid email address")
+		case errors.Is(err, user.ErrEmailInUse):
+			SendErrorResponse(w, http.StatusConflict, err, "Email address already used by another user")
+		default:
+			h.log.Error("Failed to set user email", "error", err)
+			SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to set email address")
+		}
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Email address updated successfully"})
+}
+
 // ListUsersHandler handles GET /users/list (admin only)
 func (h *Handler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
 	userList, err := h.userService.ListUsers(r.Context())
@@ -136,11 +191,21 @@ func (h *Handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request)
 		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
 		return
 	}
-	err := h.userService.ChangePassword(r.Context(), username, req.CurrentPassword, req.NewPassword)
-	if err != nil {
+	// The session changing the password stays logged in; tokens without one keep none
+	var keepSession uuid.UUID
+	if claims := authmw.GetClaimsFromContext(r.Context()); claims != nil {
+		keepSession, _ = uuid.Parse(claims.SessionID)
+	}
+	err := h.userService.ChangePassword(r.Context(), username, req.CurrentPassword, req.NewPassword, keepSession)
+	if errors.Is(err, user.ErrInvalidPassword) || errors.Is(err, user.ErrUserNotFound) {
 		SendErrorResponse(w, http.StatusUnauthorized, err, err.Error())
 		return
 	}
+	if err != nil {
+		h.log.Error("Failed to change password", "username", username, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, "Failed to change password")
+		return
+	}
 	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"}); err != nil {
 		h.log.Error("Failed to encode change password response", "error", err)
 	}
@@ -11,9 +11,12 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
 	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/auth"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,6 +41,26 @@ func userHandlerTestHelper() (*Handler, *mocks.MockUserService) {
 		mockVersionService,
 		mockAttachmentManifestService,
 		mockDataExportService,
+		mocks.NewMockStatsService(),
+		mocks.NewMockDiagnosticsService(),
+		mocks.NewMockDedupService(),
+		mocks.NewMockFeatureFlagService(),
+		mocks.NewMockCalculationService(),
+		mocks.NewMockBatchUpdateService(),
+		mocks.NewMockRenderService(),
+		mocks.NewMockMaintenanceService(),
+		mocks.NewMockChangeFeedService(),
+		mocks.NewMockFormMigrationService(),
+		mocks.NewMockCompletenessService(),
+		mocks.NewMockReplicationService(),
+		mocks.NewMockExportConsumerService(),
+		mocks.NewMockCheckpointService(),
+		mocks.NewMockObservationLockService(),
+		mocks.NewMockExportReportService(),
+		mocks.NewMockExportScheduleService(),
+		mocks.NewMockWorkflowService(),
+		mocks.NewMockPayloadCryptoService(),
+		mocks.NewMockFormPermissionService(),
 	), mockUserService
 }
 
@@ -211,3 +234,116 @@ func TestChangePasswordHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestChangePasswordHandler_KeepsCurrentSession(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+	mockUserService.AddUser(&models.User{Username: "changepw", PasswordHash: "oldpw", Role: models.RoleReadOnly})
+
+	session := uuid.New()
+	body, _ := json.Marshal(map[string]any{"currentPassword": "oldpw", "newPassword": "newpw"})
+	r := httptest.NewRequest(http.MethodPost, "/users/change-password", bytes.NewReader(body))
+	//nolint:staticcheck
+	ctx := context.WithValue(r.Context(), "username", "changepw") //nolint:staticcheck
+	ctx = context.WithValue(ctx, authmw.ClaimsKey, &auth.AuthClaims{Username: "changepw", SessionID: session.String()})
+	w := httptest.NewRecorder()
+	h.ChangePasswordHandler(w, r.WithContext(ctx))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, session, mockUserService.KeptSession("changepw"))
+}
+
+func TestSetEmailHandler(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+	mockUserService.AddUser(&models.User{Username: "alice", Role: models.RoleReadOnly})
+	mockUserService.AddUser(&models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleReadOnly})
+
+	tests := []struct {
+		name           string
+		payload        map[string]any
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			payload:        map[string]any{"username": "alice", "email": "alice@example.com"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "email in use",
+			payload:        map[string]any{"username": "alice", "email": "BOB@example.com"},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "invalid email",
+			payload:        map[string]any{"username": "alice", "email": "alice"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "user not found",
+			payload:        map[string]any{"username": "nouser", "email": "x@example.com"},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			r := httptest.NewRequest(http.MethodPost, "/users/set-email", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			h.SetEmailHandler(w, r)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+
+	// Unknown accounts get the same answer as known ones
+	body, _ := json.Marshal(map[string]any{"identifier": "nobody@example.com"})
+	w := httptest.NewRecorder()
+	h.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/auth/forgot-password", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	mockUserService.SetPasswordResetDisabled(true)
+	w = httptest.NewRecorder()
+	h.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/auth/forgot-password", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestResetPasswordWithTokenHandler(t *testing.T) {
+	h, mockUserService := userHandlerTestHelper()
+	mockUserService.AddUser(&models.User{Username: "alice", PasswordHash: "old", Role: models.RoleReadOnly})
+	mockUserService.AddResetToken("reset-token", "alice")
+
+	tests := []struct {
+		name           string
+		payload        map[string]any
+		expectedStatus int
+	}{
+		{
+			name:           "short password",
+			payload:        map[string]any{"token": "reset-token", "newPassword": "pw"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "success",
+			payload:        map[string]any{"token": "reset-token", "newPassword": "new-password"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token already used",
+			payload:        map[string]any{"token": "reset-token", "newPassword": "new-password"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			r := httptest.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			h.ResetPasswordWithToken(w, r)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+		})
+	}
+}
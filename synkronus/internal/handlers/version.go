@@ -17,6 +17,9 @@ func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients adapt to the behaviors enabled on this deployment
+	info.Features = h.featureFlagService.Active(ctx)
+
 	// Set response headers
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/workflow"
+)
+
+// WorkflowTransitionRequest is the request body for POST /observations/{id}/workflow/transitions
+type WorkflowTransitionRequest struct {
+	To      string `json:"to"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// WorkflowAssigneeRequest is the request body for PUT /observations/{id}/workflow/assignee
+type WorkflowAssigneeRequest struct {
+	// Assignee is the reviewer's username; empty to unassign
+	Assignee string `json:"assignee"`
+}
+
+// WorkflowTransitionErrorResponse is the 409 response when the workflow doesn't allow a transition
+type WorkflowTransitionErrorResponse struct {
+	Error   string   `json:"error"`
+	Message string   `json:"message"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Allowed []string `json:"allowed"`
+}
+
+// GetObservationWorkflow handles GET /observations/{id}/workflow
+// @Summary Get the workflow state of an observation
+// @Description Returns the review state of an observation of a form with x-workflow, its assignee, the states it may move to and its history
+// @Tags Workflow
+// @Produce json
+// @Param id path string true "Observation ID"
+// @Success 200 {object} workflow.Detail
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 409 {object} ErrorResponse "The form has no workflow"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/workflow [get]
+func (h *Handler) GetObservationWorkflow(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	detail, err := h.workflowService.Get(r.Context(), observationID)
+	if err != nil {
+		h.sendWorkflowError(w, err, "Failed to get observation workflow")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, detail)
+}
+
+// TransitionObservationWorkflow handles POST /observations/{id}/workflow/transitions
+// @Summary Move an observation to another workflow state
+// @Description Moves an observation to one of the states its form's workflow allows next. Observations assigned to a reviewer can only be moved by that reviewer or an admin. Admins move an observation to any state with force=true, e.g. to reopen an approved observation.
+// @Tags Workflow
+// @Accept json
+// @Produce json
+// @Param id path string true "Observation ID"
+// @Param force query bool false "Allow any state of the workflow (admin only)"
+// @Param body body WorkflowTransitionRequest true "Target state and comment"
+// @Success 200 {object} workflow.Record
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Assigned to another reviewer"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 409 {object} WorkflowTransitionErrorResponse "Transition not allowed"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/workflow/transitions [post]
+func (h *Handler) TransitionObservationWorkflow(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if force && user.Role != models.RoleAdmin {
+		SendErrorResponse(w, http.StatusForbidden, nil, "Only admins can force workflow transitions")
+		return
+	}
+
+	var req WorkflowTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.To == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "to is required")
+		return
+	}
+
+	record, err := h.workflowService.Transition(r.Context(), observationID, workflow.TransitionRequest{
+		To:      req.To,
+		Comment: req.Comment,
+		Actor:   user.Username,
+		Admin:   user.Role == models.RoleAdmin,
+		Force:   force,
+	})
+	if err != nil {
+		h.sendWorkflowError(w, err, "Failed to change observation workflow state")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, record)
+}
+
+// AssignObservationWorkflow handles PUT /observations/{id}/workflow/assignee
+// @Summary Assign an observation to a reviewer (admin only)
+// @Description Assigns an observation to a read-write or admin user, who then is the only non-admin allowed to move it. The state is kept; an empty assignee unassigns the observation.
+// @Tags Workflow
+// @Accept json
+// @Produce json
+// @Param id path string true "Observation ID"
+// @Param body body WorkflowAssigneeRequest true "Reviewer"
+// @Success 200 {object} workflow.Record
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Not Found"
+// @Failure 409 {object} ErrorResponse "The form has no workflow"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /observations/{id}/workflow/assignee [put]
+func (h *Handler) AssignObservationWorkflow(w http.ResponseWriter, r *http.Request) {
+	observationID := chi.URLParam(r, "id")
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	var req WorkflowAssigneeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	record, err := h.workflowService.Assign(r.Context(), observationID, req.Assignee, user.Username)
+	if err != nil {
+		h.sendWorkflowError(w, err, "Failed to assign observation")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, record)
+}
+
+// ListWorkflowObservations handles GET /workflow/observations
+// @Summary List observations by workflow state
+// @Description Lists the observations of a form type with their workflow state, oldest first, e.g. the returned observations or the review queue of a reviewer
+// @Tags Workflow
+// @Produce json
+// @Param form_type query string true "Form type"
+// @Param state query string false "Only observations in this state"
+// @Param assignee query string false "Only observations assigned to this user; me for the caller"
+// @Param limit query int false "Page size (1-500, default 100)"
+// @Param offset query int false "Observations to skip"
+// @Success 200 {object} map[string][]workflow.Record
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Form type not found"
+// @Failure 409 {object} ErrorResponse "The form has no workflow"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /workflow/observations [get]
+func (h *Handler) ListWorkflowObservations(w http.ResponseWriter, r *http.Request) {
+	user := authmw.GetUserFromContext(r.Context())
+	if user == nil {
+		SendErrorResponse(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	params := r.URL.Query()
+	query := workflow.Query{
+		FormType: params.Get("form_type"),
+		State:    params.Get("state"),
+		Assignee: params.Get("assignee"),
+	}
+	if query.FormType == "" {
+		SendErrorResponse(w, http.StatusBadRequest, nil, "form_type is required")
+		return
+	}
+	if query.Assignee == "me" {
+		query.Assignee = user.Username
+	}
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 500")
+			return
+		}
+		query.Limit = parsed
+	}
+	if value := params.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "offset must be a non-negative integer")
+			return
+		}
+		query.Offset = parsed
+	}
+
+	records, err := h.workflowService.List(r.Context(), query)
+	if err != nil {
+		h.sendWorkflowError(w, err, "Failed to list observations by workflow state")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, map[string]any{"observations": records})
+}
+
+// GetWorkflowChanges handles GET /workflow/changes
+// @Summary Get workflow state changes
+// @Description Returns the workflow records changed after since_version, oldest first, so clients keep the review state of observations next to the observations they pull. Workflow changes take versions from the same sequence as sync.
+// @Tags Workflow
+// @Produce json
+// @Param since_version query int false "Last version the client has seen (default 0)"
+// @Param limit query int false "Page size (1-500, default 100)"
+// @Success 200 {object} workflow.ChangesPage
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /workflow/changes [get]
+func (h *Handler) GetWorkflowChanges(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var since int64
+	if value := params.Get("since_version"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "since_version must be a non-negative integer")
+			return
+		}
+		since = parsed
+	}
+	var limit int
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			SendErrorResponse(w, http.StatusBadRequest, err, "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := h.workflowService.Changes(r.Context(), since, limit)
+	if err != nil {
+		h.sendWorkflowError(w, err, "Failed to get workflow changes")
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, page)
+}
+
+// sendWorkflowError maps workflow errors to responses
+func (h *Handler) sendWorkflowError(w http.ResponseWriter, err error, message string) {
+	var transition *workflow.TransitionError
+	switch {
+	case errors.As(err, &transition):
+		SendJSONResponse(w, http.StatusConflict, WorkflowTransitionErrorResponse{
+			Error:   err.Error(),
+			Message: "The workflow doesn't allow this transition",
+			From:    transition.From,
+			To:      transition.To,
+			Allowed: transition.Allowed,
+		})
+	case errors.Is(err, workflow.ErrNotFound):
+		SendErrorResponse(w, http.StatusNotFound, err, "Observation not found")
+	case errors.Is(err, workflow.ErrNoWorkflow):
+		SendErrorResponse(w, http.StatusConflict, err, "The form has no workflow")
+	case errors.Is(err, workflow.ErrNotAssignee):
+		SendErrorResponse(w, http.StatusForbidden, err, "Observation is assigned to another reviewer")
+	case errors.Is(err, workflow.ErrUnknownState), errors.Is(err, workflow.ErrInvalidAssignee):
+		SendErrorResponse(w, http.StatusBadRequest, err, err.Error())
+	default:
+		h.log.Error(message, "error", err)
+		SendErrorResponse(w, http.StatusInternalServerError, err, message)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opendataensemble/synkronus/internal/handlers/mocks"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/workflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservationWorkflow(t *testing.T) {
+	h, _ := createTestHandler()
+	workflows := mocks.NewMockWorkflowService()
+	workflows.Definitions["visit"] = workflow.DefaultDefinition()
+	workflows.Observations = map[string]string{"obs-1": "visit", "obs-2": "visit", "obs-3": "survey"}
+	workflows.Users = map[string]models.Role{"alice": models.RoleReadWrite, "viewer": models.RoleReadOnly}
+	h.workflowService = workflows
+
+	r := chi.NewRouter()
+	r.Get("/observations/{id}/workflow", h.GetObservationWorkflow)
+	r.Post("/observations/{id}/workflow/transitions", h.TransitionObservationWorkflow)
+	r.Put("/observations/{id}/workflow/assignee", h.AssignObservationWorkflow)
+	r.Get("/workflow/observations", h.ListWorkflowObservations)
+	r.Get("/workflow/changes", h.GetWorkflowChanges)
+
+	do := func(user models.User, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), authmw.UserKey, &user))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alice := models.User{Username: "alice", Role: models.RoleReadWrite}
+	bob := models.User{Username: "bob", Role: models.RoleReadWrite}
+	admin := models.User{Username: "admin", Role: models.RoleAdmin}
+
+	// Observations start submitted
+	w := do(bob, http.MethodGet, "/observations/obs-1/workflow", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var detail workflow.Detail
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, workflow.StateSubmitted, detail.State)
+	assert.Equal(t, []string{workflow.StateInReview}, detail.Transitions)
+
+	// Assignment is checked and then reserves the observation for the reviewer
+	assert.Equal(t, http.StatusBadRequest, do(admin, http.MethodPut, "/observations/obs-1/workflow/assignee", `{"assignee":"viewer"}`).Code)
+	w = do(admin, http.MethodPut, "/observations/obs-1/workflow/assignee", `{"assignee":"alice"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusForbidden, do(bob, http.MethodPost, "/observations/obs-1/workflow/transitions", `{"to":"in_review"}`).Code)
+
+	w = do(alice, http.MethodPost, "/observations/obs-1/workflow/transitions", `{"to":"in_review"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = do(alice, http.MethodPost, "/observations/obs-1/workflow/transitions", `{"to":"submitted"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	var conflict WorkflowTransitionErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &conflict))
+	assert.Equal(t, []string{workflow.StateApproved, workflow.StateReturned}, conflict.Allowed)
+	w = do(alice, http.MethodPost, "/observations/obs-1/workflow/transitions", `{"to":"returned","comment":"missing photo"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Only admins force transitions
+	assert.Equal(t, http.StatusForbidden, do(alice, http.MethodPost, "/observations/obs-2/workflow/transitions?force=true", `{"to":"approved"}`).Code)
+	assert.Equal(t, http.StatusOK, do(admin, http.MethodPost, "/observations/obs-2/workflow/transitions?force=true", `{"to":"approved"}`).Code)
+
+	w = do(alice, http.MethodGet, "/workflow/observations?form_type=visit&state=returned&assignee=me", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list struct {
+		Observations []workflow.Record `json:"observations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Observations, 1)
+	assert.Equal(t, "missing photo", list.Observations[0].Comment)
+
+	w = do(bob, http.MethodGet, "/workflow/changes?since_version=0&limit=1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page workflow.ChangesPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.True(t, page.HasMore)
+	assert.Equal(t, int64(3), page.NextSinceVersion)
+
+	assert.Equal(t, http.StatusBadRequest, do(bob, http.MethodGet, "/workflow/observations", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(bob, http.MethodGet, "/workflow/observations?form_type=visit&state=archived", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(bob, http.MethodGet, "/workflow/changes?since_version=-1", "").Code)
+	assert.Equal(t, http.StatusConflict, do(bob, http.MethodGet, "/observations/obs-3/workflow", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(bob, http.MethodGet, "/observations/missing/workflow", "").Code)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invitation grants a single self-registration with a preassigned role
+type Invitation struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	Role      Role       `json:"role" db:"role"`
+	Email     string     `json:"email,omitempty" db:"email"`
+	CreatedBy string     `json:"createdBy" db:"created_by"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" db:"used_at"`
+	UsedBy    string     `json:"usedBy,omitempty" db:"used_by"`
+}
+
+// IsRedeemable reports whether the invitation is unused and not yet expired at now
+func (i *Invitation) IsRedeemable(now time.Time) bool {
+	return i.UsedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device; refresh tokens stay valid only while it is active
+type Session struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"userId" db:"user_id"`
+	DeviceName string     `json:"deviceName" db:"device_name"`
+	IPAddress  string     `json:"ipAddress" db:"ip_address"`
+	UserAgent  string     `json:"userAgent" db:"user_agent"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt time.Time  `json:"lastUsedAt" db:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expiresAt" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	// ImpersonatedBy is the admin who started the session to act as the user, if any
+	ImpersonatedBy *string `json:"impersonatedBy,omitempty" db:"impersonated_by"`
+}
+
+// Impersonation audit actions
+const (
+	// ImpersonationStart records an admin starting to impersonate a user
+	ImpersonationStart = "start"
+	// ImpersonationRequest records a request made with an impersonation token
+	ImpersonationRequest = "request"
+)
+
+// ImpersonationAuditEntry is one entry in the audit trail of admin impersonation
+type ImpersonationAuditEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	SessionID uuid.UUID `json:"sessionId" db:"session_id"`
+	Admin     string    `json:"admin" db:"admin"`
+	Username  string    `json:"username" db:"username"`
+	Action    string    `json:"action" db:"action"`
+	Reason    *string   `json:"reason,omitempty" db:"reason"`
+	Method    *string   `json:"method,omitempty" db:"method"`
+	Path      *string   `json:"path,omitempty" db:"path"`
+	Status    *int      `json:"status,omitempty" db:"status"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
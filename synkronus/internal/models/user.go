@@ -22,6 +22,7 @@ const (
 type User struct {
 	ID           uuid.UUID `json:"id" db:"id"`
 	Username     string    `json:"username" db:"username"`
+	Email        string    `json:"email,omitempty" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
 	Role         Role      `json:"role" db:"role"`
 	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
@@ -12,6 +13,9 @@ type UserRepositoryInterface interface {
 	// GetByUsername retrieves a user by username
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
 
+	// GetByEmail retrieves a user by email address, ignoring case
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+
 	// Create creates a new user
 	Create(ctx context.Context, user *models.User) error
 
@@ -27,3 +31,68 @@ type UserRepositoryInterface interface {
 	// List lists all users
 	List(ctx context.Context) ([]models.User, error)
 }
+
+// InvitationRepositoryInterface defines the interface for invitation repository operations
+type InvitationRepositoryInterface interface {
+	// Create stores a new invitation
+	Create(ctx context.Context, invitation *models.Invitation) error
+
+	// GetByTokenHash retrieves an invitation by the hash of its token
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+
+	// Claim marks a redeemable invitation as used by username; it returns false if
+	// the invitation was already used or has expired
+	Claim(ctx context.Context, id uuid.UUID, username string) (bool, error)
+
+	// Release returns a claimed invitation to the unused state
+	Release(ctx context.Context, id uuid.UUID) error
+
+	// List lists all invitations, newest first
+	List(ctx context.Context) ([]models.Invitation, error)
+
+	// Delete deletes an invitation, revoking it if unused
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+// PasswordResetRepositoryInterface defines the interface for password reset token operations
+type PasswordResetRepositoryInterface interface {
+	// Create stores a new password reset token
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+
+	// Claim marks the unused, unexpired token with tokenHash as used and returns the
+	// username it was issued to, or "" if there is no such token
+	Claim(ctx context.Context, tokenHash string) (string, error)
+
+	// DeleteForUser deletes all tokens issued to a user, invalidating outstanding links
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// SessionRepositoryInterface defines the interface for login session operations
+type SessionRepositoryInterface interface {
+	// Create stores a new session
+	Create(ctx context.Context, session *models.Session) error
+
+	// Touch records a refresh of an active session of userID from ipAddress and extends it to
+	// expiresAt; it returns false if the session doesn't exist, is revoked or has expired
+	Touch(ctx context.Context, id, userID uuid.UUID, ipAddress string, expiresAt time.Time) (bool, error)
+
+	// IsActive reports whether a session exists and is neither revoked nor expired
+	IsActive(ctx context.Context, id uuid.UUID) (bool, error)
+
+	// ListActive lists a user's active sessions, most recently used first
+	ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+
+	// Revoke revokes an active session of a user; it returns false if there is none
+	Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error)
+
+	// RevokeForUser revokes the active sessions of a user other than except and returns
+	// their IDs; uuid.Nil revokes them all
+	RevokeForUser(ctx context.Context, userID, except uuid.UUID) ([]uuid.UUID, error)
+
+	// AddImpersonationAudit appends an entry to the impersonation audit trail
+	AddImpersonationAudit(ctx context.Context, entry *models.ImpersonationAuditEntry) error
+
+	// ListImpersonationAudit lists the newest limit impersonation audit entries, only those
+	// of the impersonated user username unless it is empty
+	ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error)
+}
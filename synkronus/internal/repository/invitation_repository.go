@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// InvitationRepository handles database operations for invitations
+// It implements the InvitationRepositoryInterface
+type InvitationRepository struct {
+	db  *database.Database
+	log *logger.Logger
+}
+
+// NewInvitationRepository creates a new invitation repository
+func NewInvitationRepository(db *database.Database, log *logger.Logger) *InvitationRepository {
+	return &InvitationRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create stores a new invitation
+func (r *InvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	if invitation.ID == uuid.Nil {
+		invitation.ID = uuid.New()
+	}
+	invitation.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO invitations (id, token_hash, role, email, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	var email sql.NullString
+	if invitation.Email != "" {
+		email = sql.NullString{String: invitation.Email, Valid: true}
+	}
+
+	_, err := r.db.DB().ExecContext(ctx, query,
+		invitation.ID,
+		invitation.TokenHash,
+		invitation.Role,
+		email,
+		invitation.CreatedBy,
+		invitation.CreatedAt,
+		invitation.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByTokenHash retrieves an invitation by the hash of its token
+func (r *InvitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	query := `
+		SELECT id, token_hash, role, email, created_by, created_at, expires_at, used_at, used_by
+		FROM invitations
+		WHERE token_hash = $1
+	`
+
+	invitation, err := scanInvitation(r.db.DB().QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Invitation not found
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// Claim marks a redeemable invitation as used by username
+func (r *InvitationRepository) Claim(ctx context.Context, id uuid.UUID, username string) (bool, error) {
+	query := `
+		UPDATE invitations
+		SET used_at = NOW(), used_by = $2
+		WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()
+	`
+
+	result, err := r.db.DB().ExecContext(ctx, query, id, username)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim invitation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim invitation: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// Release returns a claimed invitation to the unused state
+func (r *InvitationRepository) Release(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE invitations SET used_at = NULL, used_by = NULL WHERE id = $1`
+
+	if _, err := r.db.DB().ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to release invitation: %w", err)
+	}
+
+	return nil
+}
+
+// List lists all invitations, newest first
+func (r *InvitationRepository) List(ctx context.Context) ([]models.Invitation, error) {
+	query := `
+		SELECT id, token_hash, role, email, created_by, created_at, expires_at, used_at, used_by
+		FROM invitations
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.DB().QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return invitations, nil
+}
+
+// Delete deletes an invitation
+func (r *InvitationRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	result, err := r.db.DB().ExecContext(ctx, `DELETE FROM invitations WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// scanInvitation scans a single invitation row
+func scanInvitation(row interface{ Scan(...any) error }) (*models.Invitation, error) {
+	var invitation models.Invitation
+	var email, usedBy sql.NullString
+	var usedAt sql.NullTime
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.TokenHash,
+		&invitation.Role,
+		&email,
+		&invitation.CreatedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&usedAt,
+		&usedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Email = email.String
+	invitation.UsedBy = usedBy.String
+	if usedAt.Valid {
+		invitation.UsedAt = &usedAt.Time
+	}
+
+	return &invitation, nil
+}
@@ -0,0 +1,142 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+)
+
+// MockSessionRepository is an in-memory implementation of the repository.SessionRepositoryInterface for testing
+type MockSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*models.Session
+	audit    []models.ImpersonationAuditEntry
+}
+
+// NewMockSessionRepository creates a new mock session repository
+func NewMockSessionRepository() *MockSessionRepository {
+	return &MockSessionRepository{
+		sessions: make(map[uuid.UUID]*models.Session),
+	}
+}
+
+// active reports whether a session is neither revoked nor expired
+func active(session *models.Session) bool {
+	return session.RevokedAt == nil && session.ExpiresAt.After(time.Now())
+}
+
+// Create stores a new session
+func (m *MockSessionRepository) Create(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+
+	stored := *session
+	m.sessions[session.ID] = &stored
+	return nil
+}
+
+// Touch records a refresh of an active session and extends its expiry
+func (m *MockSessionRepository) Touch(ctx context.Context, id, userID uuid.UUID, ipAddress string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.UserID != userID || !active(session) {
+		return false, nil
+	}
+	session.LastUsedAt = time.Now()
+	session.IPAddress = ipAddress
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// IsActive reports whether a session exists and is neither revoked nor expired
+func (m *MockSessionRepository) IsActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	return ok && active(session), nil
+}
+
+// ListActive lists a user's active sessions, most recently used first
+func (m *MockSessionRepository) ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []models.Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && active(session) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// Revoke revokes an active session of a user
+func (m *MockSessionRepository) Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	return true, nil
+}
+
+// RevokeForUser revokes the active sessions of a user other than except
+func (m *MockSessionRepository) RevokeForUser(ctx context.Context, userID, except uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	ids := []uuid.UUID{}
+	for id, session := range m.sessions {
+		if session.UserID == userID && id != except && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// AddImpersonationAudit appends an entry to the impersonation audit trail
+func (m *MockSessionRepository) AddImpersonationAudit(ctx context.Context, entry *models.ImpersonationAuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = int64(len(m.audit) + 1)
+	entry.CreatedAt = time.Now()
+	m.audit = append(m.audit, *entry)
+	return nil
+}
+
+// ListImpersonationAudit lists the newest impersonation audit entries
+func (m *MockSessionRepository) ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []models.ImpersonationAuditEntry{}
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if username == "" || m.audit[i].Username == username {
+			entries = append(entries, m.audit[i])
+		}
+	}
+	return entries, nil
+}
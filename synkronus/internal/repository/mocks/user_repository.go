@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -57,6 +58,16 @@ func (m *MockUserRepository) GetByUsername(ctx context.Context, username string)
 	return user, nil
 }
 
+// GetByEmail retrieves a user by email address, ignoring case
+func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, nil // User not found, matching real implementation behavior
+}
+
 // Create creates a new user
 func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
 	// Check if user already exists
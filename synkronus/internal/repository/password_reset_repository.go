@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// PasswordResetRepository handles database operations for password reset tokens
+// It implements the PasswordResetRepositoryInterface
+type PasswordResetRepository struct {
+	db  *database.Database
+	log *logger.Logger
+}
+
+// NewPasswordResetRepository creates a new password reset token repository
+func NewPasswordResetRepository(db *database.Database, log *logger.Logger) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create stores a new password reset token
+func (r *PasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	token.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.DB().ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.TokenHash,
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// Claim marks a usable token as used and returns the username it was issued to
+func (r *PasswordResetRepository) Claim(ctx context.Context, tokenHash string) (string, error) {
+	// A single statement so concurrent resets cannot both use one token
+	query := `
+		UPDATE password_reset_tokens t
+		SET used_at = NOW()
+		FROM users u
+		WHERE u.id = t.user_id
+		  AND t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW()
+		RETURNING u.username
+	`
+
+	var username string
+	err := r.db.DB().QueryRowContext(ctx, query, tokenHash).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil // Unknown, used or expired token
+		}
+		return "", fmt.Errorf("failed to claim password reset token: %w", err)
+	}
+
+	return username, nil
+}
+
+// DeleteForUser deletes all tokens issued to a user
+func (r *PasswordResetRepository) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.db.DB().ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+	return nil
+}
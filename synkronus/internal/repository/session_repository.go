@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// SessionRepository handles database operations for login sessions
+// It implements the SessionRepositoryInterface
+type SessionRepository struct {
+	db  *database.Database
+	log *logger.Logger
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *database.Database, log *logger.Logger) *SessionRepository {
+	return &SessionRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create stores a new session
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+
+	query := `
+		INSERT INTO sessions (id, user_id, device_name, ip_address, user_agent, created_at, last_used_at, expires_at, impersonated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := r.db.DB().ExecContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.DeviceName,
+		session.IPAddress,
+		session.UserAgent,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.ExpiresAt,
+		session.ImpersonatedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records a refresh of an active session and extends its expiry
+func (r *SessionRepository) Touch(ctx context.Context, id, userID uuid.UUID, ipAddress string, expiresAt time.Time) (bool, error) {
+	// A single statement so a refresh cannot race a revocation
+	query := `
+		UPDATE sessions
+		SET last_used_at = NOW(), ip_address = $3, expires_at = $4
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	result, err := r.db.DB().ExecContext(ctx, query, id, userID, ipAddress, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// IsActive reports whether a session exists and is neither revoked nor expired
+func (r *SessionRepository) IsActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW())`
+
+	var active bool
+	if err := r.db.DB().QueryRowContext(ctx, query, id).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	return active, nil
+}
+
+// ListActive lists a user's active sessions, most recently used first
+func (r *SessionRepository) ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, device_name, ip_address, user_agent, created_at, last_used_at, expires_at, impersonated_by
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`
+
+	rows, err := r.db.DB().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.DeviceName,
+			&session.IPAddress,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.ImpersonatedBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return sessions, nil
+}
+
+// Revoke revokes an active session of a user
+func (r *SessionRepository) Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.DB().ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// RevokeForUser revokes the active sessions of a user other than except
+func (r *SessionRepository) RevokeForUser(ctx context.Context, userID, except uuid.UUID) ([]uuid.UUID, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id`
+
+	rows, err := r.db.DB().QueryContext(ctx, query, userID, except)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return ids, nil
+}
+
+// AddImpersonationAudit appends an entry to the impersonation audit trail
+func (r *SessionRepository) AddImpersonationAudit(ctx context.Context, entry *models.ImpersonationAuditEntry) error {
+	query := `
+		INSERT INTO impersonation_audit (session_id, admin, username, action, reason, method, path, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	err := r.db.DB().QueryRowContext(ctx, query,
+		entry.SessionID,
+		entry.Admin,
+		entry.Username,
+		entry.Action,
+		entry.Reason,
+		entry.Method,
+		entry.Path,
+		entry.Status,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add impersonation audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListImpersonationAudit lists the newest impersonation audit entries, optionally only those
+// of one impersonated user
+func (r *SessionRepository) ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error) {
+	query := `
+		SELECT id, session_id, admin, username, action, reason, method, path, status, created_at
+		FROM impersonation_audit
+		WHERE $1 = '' OR username = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.DB().QueryContext(ctx, query, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list impersonation audit: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.ImpersonationAuditEntry{}
+	for rows.Next() {
+		var entry models.ImpersonationAuditEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.SessionID,
+			&entry.Admin,
+			&entry.Username,
+			&entry.Action,
+			&entry.Reason,
+			&entry.Method,
+			&entry.Path,
+			&entry.Status,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan impersonation audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return entries, nil
+}
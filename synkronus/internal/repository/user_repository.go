@@ -31,21 +31,12 @@ func NewUserRepository(db *database.Database, log *logger.Logger) *UserRepositor
 // GetByUsername retrieves a user by username
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, username, password_hash, role, created_at, updated_at
+		SELECT id, username, email, password_hash, role, created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
 
-	var user models.User
-	err := r.db.DB().QueryRowContext(ctx, query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
+	user, err := scanUser(r.db.DB().QueryRowContext(ctx, query, username))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil // User not found
@@ -53,13 +44,32 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 		return nil, fmt.Errorf("failed to get user by username: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// GetByEmail retrieves a user by email address, ignoring case
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `
+		SELECT id, username, email, password_hash, role, created_at, updated_at
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+	`
+
+	user, err := scanUser(r.db.DB().QueryRowContext(ctx, query, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // User not found
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return user, nil
 }
 
 // List lists all users in the system (admin operation)
 func (r *UserRepository) List(ctx context.Context) ([]models.User, error) {
 	query := `
-		SELECT id, username, password_hash, role, created_at, updated_at
+		SELECT id, username, email, password_hash, role, created_at, updated_at
 		FROM users
 	`
 	rows, err := r.db.DB().QueryContext(ctx, query)
@@ -69,18 +79,11 @@ func (r *UserRepository) List(ctx context.Context) ([]models.User, error) {
 	defer rows.Close()
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.PasswordHash,
-			&user.Role,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -101,13 +104,14 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	user.UpdatedAt = now
 
 	query := `
-		INSERT INTO users (id, username, password_hash, role, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, username, email, password_hash, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 
 	_, err := r.db.DB().ExecContext(ctx, query,
 		user.ID,
 		user.Username,
+		nullableEmail(user.Email),
 		user.PasswordHash,
 		user.Role,
 		user.CreatedAt,
@@ -127,12 +131,13 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 
 	query := `
 		UPDATE users
-		SET username = $1, password_hash = $2, role = $3, updated_at = $4
-		WHERE id = $5
+		SET username = $1, email = $2, password_hash = $3, role = $4, updated_at = $5
+		WHERE id = $6
 	`
 
 	_, err := r.db.DB().ExecContext(ctx, query,
 		user.Username,
+		nullableEmail(user.Email),
 		user.PasswordHash,
 		user.Role,
 		user.UpdatedAt,
@@ -187,3 +192,30 @@ func (r *UserRepository) CreateAdminUserIfNotExists(ctx context.Context, usernam
 
 	return nil
 }
+
+// scanUser scans a single user row
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	var email sql.NullString
+
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Email = email.String
+	return &user, nil
+}
+
+// nullableEmail stores an empty email address as NULL so the unique index ignores it
+func nullableEmail(email string) sql.NullString {
+	return sql.NullString{String: email, Valid: email != ""}
+}
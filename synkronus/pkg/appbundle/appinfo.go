@@ -16,6 +16,8 @@ type AppInfo struct {
 	Version   string              `json:"version"`
 	Forms     map[string]FormInfo `json:"forms,omitempty"`
 	Timestamp string              `json:"timestamp,omitempty"`
+	// Renderers lists the bundle's custom renderers with their renderer.json versions
+	Renderers map[string]RendererInfo `json:"renderers,omitempty"`
 }
 
 // FormInfo contains information about a form
@@ -25,6 +27,10 @@ type FormInfo struct {
 	UIHash        string         `json:"ui_hash"`        // Hash of the UI schema
 	Fields        []FieldInfo    `json:"fields"`         // List of all fields
 	QuestionTypes map[string]any `json:"question_types"` // Map of question types referenced in the UI form
+	// Version is the form version the schema declares; observations record it as form_version
+	Version string `json:"version,omitempty"`
+	// Migrations transform data of older form versions, see MigrationInfo
+	Migrations []MigrationInfo `json:"migrations,omitempty"`
 }
 
 // FieldInfo contains information about a form field
@@ -35,6 +41,9 @@ type FieldInfo struct {
 	QuestionType string `json:"question_type"`
 	Default      any    `json:"default"`
 	Core         bool   `json:"core"`
+	// AttachmentRequired marks a field tagged x-attachment-required, whose answer must
+	// refer to an uploaded attachment
+	AttachmentRequired bool `json:"attachment_required,omitempty"`
 }
 
 // generateAppInfo generates the APP_INFO.json content for the bundle
@@ -89,6 +98,18 @@ func (s *Service) generateAppInfo(zipReader *zip.Reader, version string) ([]byte
 		}
 	}
 
+	migrations, err := collectMigrations(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	renderers, err := collectRenderers(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	if len(renderers) > 0 {
+		appInfo.Renderers = renderers
+	}
+
 	// Process each form
 	for formName, schemaFile := range formSchemas {
 		// Read and parse the form schema
@@ -133,6 +154,8 @@ func (s *Service) generateAppInfo(zipReader *zip.Reader, version string) ([]byte
 			FormHash:      hashData(schema),
 			Fields:        extractFields(schema),
 			QuestionTypes: make(map[string]any),
+			Version:       SchemaVersion(schema),
+			Migrations:    migrations[formName],
 		}
 
 		// Add UI hash if exists
@@ -212,6 +235,7 @@ func extractFields(schema map[string]any) []FieldInfo {
 			Core:         getBool(field, "x-core") || strings.HasPrefix(fieldName, "core_"),
 			Default:      field["default"], // Will be nil if not specified
 		}
+		fieldInfo.AttachmentRequired = getBool(field, "x-attachment-required")
 
 		fields = append(fields, fieldInfo)
 	}
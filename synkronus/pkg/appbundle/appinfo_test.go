@@ -130,6 +130,18 @@ func TestGenerateAppInfo(t *testing.T) {
 				assert.Contains(t, formInfo.QuestionTypes, "customField")
 			},
 		},
+		{
+			name:    "form with required attachment",
+			version: "3.1.0",
+			files: map[string]string{
+				"forms/test_form/schema.json": `{"type":"object","properties":{"photo":{"type":"string","x-attachment-required":true},"name":{"type":"string"}}}`,
+			},
+			validate: func(t *testing.T, info *AppInfo, s *Service) {
+				for _, field := range info.Forms["test_form"].Fields {
+					assert.Equal(t, field.Name == "photo", field.AttachmentRequired, field.Name)
+				}
+			},
+		},
 		{
 			name:    "multiple forms",
 			version: "4.0.0",
@@ -0,0 +1,300 @@
+package appbundle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BootCheckOverrideHeader is the request header with which an admin pushes a bundle that
+// fails the boot check anyway
+const BootCheckOverrideHeader = "X-Bundle-Boot-Check-Override"
+
+// ErrBootCheckFailed is returned when a pushed bundle's app logs errors while it boots
+var ErrBootCheckFailed = errors.New("app bundle fails the boot check")
+
+// bootScreenshotFile is the screenshot of the booted app. Like versionInfoFile it lives in
+// the version directory but is not part of the bundle served to clients.
+const bootScreenshotFile = "BOOT_SCREENSHOT.png"
+
+// maxBootErrors is how many console errors a boot check reports
+const maxBootErrors = 20
+
+// BootChecker loads the app/index.html of an extracted bundle in a headless browser
+type BootChecker interface {
+	// Check boots the app of the bundle extracted to dir. An error means the check could
+	// not run, not that the app is broken.
+	Check(ctx context.Context, dir string) (*BootResult, error)
+}
+
+// BootResult is what a headless browser saw while the app booted
+type BootResult struct {
+	// ConsoleErrors are the errors logged, thrown or failed loads, in order
+	ConsoleErrors []string
+	// Screenshot is a PNG of the booted app
+	Screenshot []byte
+}
+
+// BootCheck is the boot check recorded for a version
+type BootCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// Screenshot is whether a screenshot of the booted app was kept
+	Screenshot bool `json:"screenshot"`
+	// ConsoleErrors are only recorded for versions pushed with BootCheckOverrideHeader
+	ConsoleErrors []string `json:"console_errors,omitempty"`
+}
+
+// BootCheckError reports the errors of a bundle's app while it boots
+type BootCheckError struct {
+	ConsoleErrors []string
+}
+
+func (e *BootCheckError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrBootCheckFailed, strings.Join(e.ConsoleErrors, "; "))
+}
+
+// Is makes errors.Is(err, ErrBootCheckFailed) match
+func (e *BootCheckError) Is(target error) bool {
+	return target == ErrBootCheckFailed
+}
+
+// bootCheckOverrideKey marks pushes that may fail the boot check
+type bootCheckOverrideKey struct{}
+
+// WithBootCheckOverride returns a context in which pushes and draft uploads whose app logs
+// errors while it boots are accepted with a warning in the log
+func WithBootCheckOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bootCheckOverrideKey{}, true)
+}
+
+// bootCheckOverridden reports whether pushes in ctx may fail the boot check
+func bootCheckOverridden(ctx context.Context) bool {
+	overridden, _ := ctx.Value(bootCheckOverrideKey{}).(bool)
+	return overridden
+}
+
+// checkBoot boots the app of the bundle extracted to dir and keeps its screenshot there.
+// It fails with a *BootCheckError when the app logs errors, unless ctx overrides the check.
+// Without a boot checker, or when the browser can't run, it returns no check.
+func (s *Service) checkBoot(ctx context.Context, dir string) (*BootCheck, error) {
+	if s.bootChecker == nil {
+		return nil, nil
+	}
+	result, err := s.bootChecker.Check(ctx, dir)
+	if err != nil {
+		// A missing or crashing browser says nothing about the bundle
+		s.log.Error("Failed to run app bundle boot check", "error", err)
+		return nil, nil
+	}
+
+	check := &BootCheck{CheckedAt: time.Now().UTC()}
+	if len(result.Screenshot) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, bootScreenshotFile), result.Screenshot, 0644); err != nil {
+			s.log.Error("Failed to save app bundle boot screenshot", "error", err)
+		} else {
+			check.Screenshot = true
+		}
+	}
+	if len(result.ConsoleErrors) == 0 {
+		return check, nil
+	}
+	err = &BootCheckError{ConsoleErrors: result.ConsoleErrors}
+	if !bootCheckOverridden(ctx) {
+		return nil, err
+	}
+	s.log.Warn("Accepting app bundle that fails the boot check on override", "user", contextActor(ctx), "error", err)
+	check.ConsoleErrors = result.ConsoleErrors
+	return check, nil
+}
+
+// GetBootScreenshot returns the PNG taken when a version's app was boot checked
+func (s *Service) GetBootScreenshot(ctx context.Context, version string) ([]byte, error) {
+	if err := s.checkVersionExists(version); err != nil {
+		return nil, fmt.Errorf("%w: %v", os.ErrNotExist, err)
+	}
+	return os.ReadFile(filepath.Join(s.versionsPath, version, bootScreenshotFile))
+}
+
+// bootErrorMarker prefixes the console lines with which bootHook reports errors, as
+// Chrome logs all console messages of a page at the same level
+const bootErrorMarker = "SYNKRONUS_BOOT_ERROR:"
+
+// bootHook is injected into app/index.html before any of its scripts, reporting logged
+// and thrown errors, unhandled rejections and failed loads of scripts, styles and images
+const bootHook = `<script>(function () {
+  function report(message) { console.log("` + bootErrorMarker + `" + String(message).replace(/\s+/g, " ")); }
+  var error = console.error;
+  console.error = function () {
+    report(Array.prototype.map.call(arguments, String).join(" "));
+    return error.apply(console, arguments);
+  };
+  window.addEventListener("error", function (e) {
+    if (e.target && e.target !== window) {
+      report("failed to load " + (e.target.src || e.target.href));
+    } else {
+      report(e.message + (e.filename ? " (" + e.filename + ":" + e.lineno + ")" : ""));
+    }
+  }, true);
+  window.addEventListener("unhandledrejection", function (e) {
+    report("unhandled rejection: " + ((e.reason && e.reason.message) || e.reason));
+  });
+})();</script>`
+
+// headOpen finds the opening head tag bootHook is injected after
+var headOpen = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+// injectBootHook adds bootHook to the start of the head of an HTML page, or of the page
+// when it has no head
+func injectBootHook(page []byte) []byte {
+	loc := headOpen.FindIndex(page)
+	if loc == nil {
+		return append([]byte(bootHook), page...)
+	}
+	injected := make([]byte, 0, len(page)+len(bootHook))
+	injected = append(injected, page[:loc[1]]...)
+	injected = append(injected, bootHook...)
+	return append(injected, page[loc[1]:]...)
+}
+
+// chromeBootChecker boots apps in headless Chrome or Chromium. The bundle is served over
+// HTTP on the loopback interface, as module scripts don't load from file:// URLs.
+type chromeBootChecker struct {
+	chromePath string
+	timeout    time.Duration
+}
+
+// bootBudget is how long an app may take to boot, in the browser's virtual time
+const bootBudget = 5 * time.Second
+
+// bootWindow is the window size of the boot check, a typical phone screen
+const bootWindow = "412,915"
+
+// NewChromeBootChecker creates a boot checker using the Chrome or Chromium binary at
+// chromePath, looked up in PATH when it has no directory. A check is stopped after timeout.
+func NewChromeBootChecker(chromePath string, timeout time.Duration) BootChecker {
+	return &chromeBootChecker{chromePath: chromePath, timeout: timeout}
+}
+
+func (c *chromeBootChecker) Check(ctx context.Context, dir string) (*BootResult, error) {
+	chrome, err := exec.LookPath(c.chromePath)
+	if err != nil {
+		return nil, fmt.Errorf("headless browser unavailable: %w", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "app", "index.html"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app/index.html: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the boot check: %w", err)
+	}
+	server := &http.Server{Handler: bootHandler(dir, injectBootHook(index))}
+	go server.Serve(listener)
+	defer server.Close()
+
+	profile, err := os.MkdirTemp("", "synkronus-bootcheck-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser profile: %w", err)
+	}
+	defer os.RemoveAll(profile)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	screenshot := filepath.Join(profile, "screenshot.png")
+	url := "http://" + listener.Addr().String() + "/app/index.html"
+	cmd := exec.CommandContext(ctx, chrome, chromeArgs(profile, screenshot, url)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("headless browser stopped: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("headless browser failed: %v: %s", err, lastLines(stderr.String(), 5))
+	}
+
+	result := &BootResult{ConsoleErrors: parseBootErrors(stderr.String())}
+	if result.Screenshot, err = os.ReadFile(screenshot); err != nil {
+		return nil, fmt.Errorf("headless browser took no screenshot: %w", err)
+	}
+	return result, nil
+}
+
+// bootHandler serves the bundle extracted to dir, with index as app/index.html
+func bootHandler(dir string, index []byte) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// FileServer redirects index.html to its directory, so serve it directly
+		if r.URL.Path == "/app/index.html" || r.URL.Path == "/app/" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// chromeArgs builds the command line that loads url in a fresh profile, logs the page's
+// console to stderr and writes a screenshot once the page is idle or the boot budget is up
+func chromeArgs(profile, screenshot, url string) []string {
+	return []string{
+		"--headless=new",
+		"--disable-gpu",
+		// Servers commonly run as root in containers, where the sandbox can't start
+		"--no-sandbox",
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--user-data-dir=" + profile,
+		"--window-size=" + bootWindow,
+		"--virtual-time-budget=" + strconv.FormatInt(bootBudget.Milliseconds(), 10),
+		"--enable-logging=stderr",
+		"--v=0",
+		"--screenshot=" + screenshot,
+		url,
+	}
+}
+
+// bootErrorLine matches the console lines of bootHook in Chrome's log, e.g.
+// [...:INFO:CONSOLE(2)] "SYNKRONUS_BOOT_ERROR:boom (http://.../main.js:3)", source: ... (2)
+var bootErrorLine = regexp.MustCompile(`CONSOLE[^\]]*\] "` + regexp.QuoteMeta(bootErrorMarker) + `(.*)", source: `)
+
+// parseBootErrors returns the distinct errors bootHook reported, at most maxBootErrors
+func parseBootErrors(log string) []string {
+	var errs []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(log, "\n") {
+		match := bootErrorLine.FindStringSubmatch(line)
+		if match == nil || seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		if len(errs) == maxBootErrors {
+			errs = append(errs, "...")
+			break
+		}
+		errs = append(errs, match[1])
+	}
+	return errs
+}
+
+// lastLines returns the last n lines of a tool's output
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
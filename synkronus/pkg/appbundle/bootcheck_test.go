@@ -0,0 +1,150 @@
+package appbundle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubBootChecker returns a fixed result and records the directories it checked
+type stubBootChecker struct {
+	result  *BootResult
+	err     error
+	checked []string
+}
+
+func (c *stubBootChecker) Check(ctx context.Context, dir string) (*BootResult, error) {
+	c.checked = append(c.checked, dir)
+	return c.result, c.err
+}
+
+func TestInjectBootHook(t *testing.T) {
+	page := injectBootHook([]byte(`<!doctype html><HTML><Head lang="en"><script src="main.js"></script></head></HTML>`))
+	assert.True(t, bytes.HasPrefix(page, []byte(`<!doctype html><HTML><Head lang="en">`+bootHook+`<script src="main.js">`)))
+
+	page = injectBootHook([]byte(`<header></header><script src="main.js"></script>`))
+	assert.True(t, bytes.HasPrefix(page, []byte(bootHook+`<header>`)), "a page without a head gets the hook first")
+}
+
+func TestParseBootErrors(t *testing.T) {
+	log := `[1018/101010.123456:INFO:CONSOLE(2)] "ready", source: http://127.0.0.1:4000/app/index.html (2)
+[1018/101010.123457:INFO:CONSOLE(3)] "SYNKRONUS_BOOT_ERROR:Uncaught TypeError: x is undefined (http://127.0.0.1:4000/app/main.js:3)", source: http://127.0.0.1:4000/app/index.html (3)
+[1018/101010.123458:ERROR:bus.cc(407)] Failed to connect to the bus
+[1018/101010.123459:INFO:CONSOLE:3] "SYNKRONUS_BOOT_ERROR:failed to load http://127.0.0.1:4000/app/missing.css", source: http://127.0.0.1:4000/app/index.html (3)
+[1018/101010.123460:INFO:CONSOLE(3)] "SYNKRONUS_BOOT_ERROR:Uncaught TypeError: x is undefined (http://127.0.0.1:4000/app/main.js:3)", source: http://127.0.0.1:4000/app/index.html (3)
+`
+	assert.Equal(t, []string{
+		"Uncaught TypeError: x is undefined (http://127.0.0.1:4000/app/main.js:3)",
+		"failed to load http://127.0.0.1:4000/app/missing.css",
+	}, parseBootErrors(log))
+	assert.Empty(t, parseBootErrors(""))
+}
+
+func TestPushBundleBootCheck(t *testing.T) {
+	checker := &stubBootChecker{result: &BootResult{
+		ConsoleErrors: []string{"Uncaught ReferenceError: formulus is not defined"},
+		Screenshot:    []byte("png"),
+	}}
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+		bootChecker:  checker,
+	}
+	buf, err := createTestZip(t, map[string]string{
+		"app/index.html":      "<html></html>",
+		"forms/a/schema.json": `{"type":"object"}`,
+		"forms/a/ui.json":     `{"type":"VerticalLayout","elements":[]}`,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = service.PushBundle(ctx, bytes.NewReader(buf.Bytes()))
+	var bootErr *BootCheckError
+	require.ErrorAs(t, err, &bootErr)
+	assert.Equal(t, checker.result.ConsoleErrors, bootErr.ConsoleErrors)
+	_, err = service.PushDraft(ctx, bytes.NewReader(buf.Bytes()))
+	require.ErrorIs(t, err, ErrBootCheckFailed)
+	require.Len(t, checker.checked, 2)
+	assert.Equal(t, filepath.Join(service.versionsPath, DraftVersion), checker.checked[1])
+
+	entries, err := os.ReadDir(service.versionsPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "rejected pushes must not leave a version or draft behind")
+
+	manifest, err := service.PushBundle(WithBootCheckOverride(ctx), bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "0001", manifest.Version)
+	record, ok := service.readVersionRecord("0001")
+	require.True(t, ok)
+	require.NotNil(t, record.BootCheck)
+	assert.True(t, record.BootCheck.Screenshot)
+	assert.Equal(t, checker.result.ConsoleErrors, record.BootCheck.ConsoleErrors)
+	screenshot, err := service.GetBootScreenshot(ctx, "0001")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("png"), screenshot)
+	assert.NotContains(t, bundleFilePaths(filepath.Join(service.versionsPath, "0001")), bootScreenshotFile)
+
+	// A clean boot survives draft promotion
+	checker.result = &BootResult{Screenshot: []byte("clean")}
+	_, err = service.PushDraft(ctx, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	manifest, err = service.PromoteDraft(ctx)
+	require.NoError(t, err)
+	details, err := service.GetVersionDetails(ctx)
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+	assert.Equal(t, manifest.Version, details[0].Version)
+	require.NotNil(t, details[0].BootCheck)
+	assert.True(t, details[0].BootCheck.Screenshot)
+	assert.Empty(t, details[0].BootCheck.ConsoleErrors)
+	assert.WithinDuration(t, time.Now(), details[0].BootCheck.CheckedAt, time.Minute)
+
+	// A browser that can't run doesn't block pushes
+	checker.err = errors.New("chromium: not found")
+	manifest, err = service.PushBundle(ctx, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	record, ok = service.readVersionRecord(manifest.Version)
+	require.True(t, ok)
+	assert.Nil(t, record.BootCheck)
+	_, err = service.GetBootScreenshot(ctx, manifest.Version)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestChromeBootChecker(t *testing.T) {
+	var chrome string
+	for _, name := range []string{"chromium", "chromium-browser", "google-chrome", "chrome"} {
+		if path, err := exec.LookPath(name); err == nil {
+			chrome = path
+			break
+		}
+	}
+	if chrome == "" {
+		t.Skip("Chrome or Chromium not installed")
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "index.html"),
+		[]byte(`<html><head><script type="module" src="main.js"></script><link rel="stylesheet" href="missing.css"></head><body>Hi</body></html>`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "main.js"), []byte(`console.error("boom");`), 0644))
+
+	result, err := NewChromeBootChecker(chrome, time.Minute).Check(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Contains(t, result.ConsoleErrors, "boom")
+	assert.Len(t, result.ConsoleErrors, 2)
+	assert.True(t, bytes.HasPrefix(result.Screenshot, []byte("\x89PNG")))
+
+	_, err = NewChromeBootChecker("/nonexistent/chromium", time.Minute).Check(context.Background(), dir)
+	assert.Error(t, err)
+}
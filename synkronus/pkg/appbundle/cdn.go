@@ -0,0 +1,121 @@
+package appbundle
+
+import (
+	"context"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"sort"
+)
+
+// routePrefixes are the paths the app bundle endpoints are served under
+var routePrefixes = []string{"/app-bundle", "/api/app-bundle"}
+
+// downloadPath is the server path of a bundle file. With a version the path is pinned
+// to that version's content, so it can be cached forever under its own cache key.
+func downloadPath(filePath, version string) string {
+	p := routePrefixes[0] + "/download/" + url.PathEscape(filePath)
+	if version != "" {
+		p += "?version=" + url.QueryEscape(version)
+	}
+	return p
+}
+
+// fileURL is the URL clients download a file of version through
+func (s *Service) fileURL(filePath, version string) string {
+	p := downloadPath(filePath, version)
+	if s.cdn != nil {
+		return s.cdn.URL(p)
+	}
+	return p
+}
+
+// setFileURLs pins the download URLs of files to version. Files of a version that isn't
+// numbered (no versions pushed yet) are left without URLs.
+func (s *Service) setFileURLs(files []File, version string) {
+	if s.checkVersionExists(version) != nil {
+		return
+	}
+	for i := range files {
+		files[i].URL = s.fileURL(files[i].Path, version)
+	}
+}
+
+// activationPaths are the cached server paths whose content changes when the active
+// version does: the manifest, the zip, the versions list and the unpinned download path
+// of every file of the previous and new versions
+func activationPaths(filePaths []string) []string {
+	var paths []string
+	for _, prefix := range routePrefixes {
+		paths = append(paths, prefix+"/manifest", prefix+"/download-zip", prefix+"/versions")
+		for _, p := range filePaths {
+			paths = append(paths, prefix+"/download/"+url.PathEscape(p))
+		}
+	}
+	return paths
+}
+
+// pushPaths are the cached server paths whose content changes when a version is added:
+// the versions list and the preview download path of every file of the new version
+func pushPaths(filePaths []string) []string {
+	var paths []string
+	for _, prefix := range routePrefixes {
+		paths = append(paths, prefix+"/versions")
+		for _, p := range filePaths {
+			paths = append(paths, prefix+"/download/"+url.PathEscape(p)+"?preview=true")
+		}
+	}
+	return paths
+}
+
+// bundleFilePaths lists the relative paths of the files in dir, without hashing them
+func bundleFilePaths(dir string) []string {
+	var paths []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		if rel = filepath.ToSlash(rel); !isVersionMetadataFile(rel) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	return paths
+}
+
+// mergePaths returns the sorted union of path lists
+func mergePaths(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				merged = append(merged, p)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// purgeCDN evicts paths from the CDN cache in the background, so that a version change
+// reaches clients within seconds without delaying the request that made it
+func (s *Service) purgeCDN(paths []string, reason string) {
+	if s.cdn == nil || len(paths) == 0 {
+		return
+	}
+	s.purges.Add(1)
+	go func() {
+		defer s.purges.Done()
+		if err := s.cdn.Purge(context.Background(), paths); err != nil {
+			s.log.Error("Failed to purge app bundle from CDN", "reason", reason, "paths", len(paths), "error", err)
+			return
+		}
+		s.log.Info("Purged app bundle from CDN", "reason", reason, "paths", len(paths))
+	}()
+}
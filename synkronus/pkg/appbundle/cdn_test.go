@@ -0,0 +1,102 @@
+package appbundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCDN records purged paths
+type fakeCDN struct {
+	mu     sync.Mutex
+	purged [][]string
+}
+
+func (c *fakeCDN) URL(path string) string { return "https://cdn.example.org" + path }
+
+func (c *fakeCDN) Purge(ctx context.Context, paths []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purged = append(c.purged, paths)
+	return nil
+}
+
+func (c *fakeCDN) take() [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := c.purged
+	c.purged = nil
+	return purged
+}
+
+func TestCDNIntegration(t *testing.T) {
+	ctx := context.Background()
+	cdn := &fakeCDN{}
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+		cdn:          cdn,
+	}
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	push := func() {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = service.PushBundle(ctx, f)
+		require.NoError(t, err)
+	}
+
+	// A push purges the versions list and the preview downloads of the new version
+	push()
+	service.purges.Wait()
+	purged := cdn.take()
+	require.Len(t, purged, 1)
+	require.Contains(t, purged[0], "/app-bundle/versions")
+	require.Contains(t, purged[0], "/api/app-bundle/versions")
+	require.Contains(t, purged[0], "/app-bundle/download/app%2Findex.html?preview=true")
+	require.NotContains(t, purged[0], "/app-bundle/manifest")
+
+	// A switch purges the manifest, the zip and the unpinned downloads
+	require.NoError(t, service.SwitchVersion(ctx, "0001"))
+	service.purges.Wait()
+	purged = cdn.take()
+	require.Len(t, purged, 1)
+	for _, path := range []string{"/app-bundle/manifest", "/api/app-bundle/manifest", "/app-bundle/download-zip", "/app-bundle/download/app%2Findex.html"} {
+		require.Contains(t, purged[0], path)
+	}
+
+	// Manifest file URLs are pinned to the active version on the CDN
+	manifest, err := service.GetManifest(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, manifest.Files)
+	for _, file := range manifest.Files {
+		require.True(t, strings.HasPrefix(file.URL, "https://cdn.example.org/app-bundle/download/"), file.URL)
+		require.True(t, strings.HasSuffix(file.URL, "?version=0001"), file.URL)
+	}
+}
+
+func TestManifestURLsWithoutCDN(t *testing.T) {
+	service := &Service{log: logger.NewLogger(), versionsPath: t.TempDir()}
+	require.NoError(t, os.Mkdir(filepath.Join(service.versionsPath, "0003"), 0755))
+
+	files := []File{{Path: "forms/person/schema.json"}}
+	service.setFileURLs(files, "0003")
+	require.Equal(t, "/app-bundle/download/forms%2Fperson%2Fschema.json?version=0003", files[0].URL)
+
+	// Without a numbered version there is nothing to pin to
+	files = []File{{Path: "app/index.html"}}
+	service.setFileURLs(files, "current")
+	require.Empty(t, files[0].URL)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 )
 
 // ChangeLog represents the structure of CHANGE_LOG.json
@@ -16,6 +18,33 @@ type ChangeLog struct {
 	NewForms        []FormDiff         `json:"new_forms,omitempty"`
 	RemovedForms    []FormDiff         `json:"removed_forms,omitempty"`
 	ModifiedForms   []FormModification `json:"modified_forms,omitempty"`
+	// Breaking is set when a form was removed or a modification is breaking, i.e. data
+	// collected with the old version may not fit the new one
+	Breaking bool `json:"breaking"`
+	// Files lists the files that differ between the versions; only set when requested
+	Files *FileChanges `json:"files,omitempty"`
+}
+
+// FileChanges lists the files added, removed and modified between two versions, so
+// clients upgrading from version A only download what changed
+type FileChanges struct {
+	Added    []FileChange `json:"added"`
+	Removed  []FileChange `json:"removed"`
+	Modified []FileChange `json:"modified"`
+	// DownloadSize is the total size of the added and modified files
+	DownloadSize int64 `json:"download_size"`
+}
+
+// FileChange is a file that differs between two versions. Hash and Size describe the file
+// in version B, or in version A for removed files; OldHash and OldSize are set for
+// modified files. URL downloads the file of version B.
+type FileChange struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	OldHash string `json:"old_hash,omitempty"`
+	OldSize int64  `json:"old_size,omitempty"`
+	URL     string `json:"url,omitempty"`
 }
 
 // FormDiff represents a form that was added or removed
@@ -43,6 +72,33 @@ type FormModification struct {
 	CoreChange    bool          `json:"core_changed"`
 	AddedFields   []FieldChange `json:"added_fields,omitempty"`
 	RemovedFields []FieldChange `json:"removed_fields,omitempty"`
+	// Breaking is set when any of Changes is breaking
+	Breaking bool `json:"breaking"`
+	// Changes classifies each change of the form
+	Changes []ClassifiedChange `json:"changes,omitempty"`
+}
+
+// Kinds of classified changes
+const (
+	ChangeFieldAdded    = "field_added"    // Breaking when the new field is required or a core field
+	ChangeFieldRemoved  = "field_removed"  // Breaking when the removed field was required or a core field
+	ChangeTypeChanged   = "type_changed"   // Always breaking
+	ChangeMadeRequired  = "made_required"  // Always breaking
+	ChangeMadeOptional  = "made_optional"  // Never breaking
+	ChangeFieldDetails  = "field_details"  // Question type or default changed; never breaking
+	ChangeCoreChanged   = "core_changed"   // The core fields changed; always breaking
+	ChangeSchemaDetails = "schema_details" // Titles or help texts; never breaking
+	ChangeUIChanged     = "ui_changed"     // Never breaking
+)
+
+// ClassifiedChange is a single change of a form, classified as breaking or not
+type ClassifiedChange struct {
+	Kind string `json:"kind"`
+	// Field is empty for changes of the whole form
+	Field    string `json:"field,omitempty"`
+	OldType  string `json:"old_type,omitempty"`
+	NewType  string `json:"new_type,omitempty"`
+	Breaking bool   `json:"breaking"`
 }
 
 // CompareAppInfos compares two AppInfo objects and generates a ChangeLog
@@ -80,6 +136,7 @@ func CompareAppInfos(oldInfo, newInfo *AppInfo) (*ChangeLog, error) {
 			// Form removed
 			log.RemovedForms = append(log.RemovedForms, FormDiff{Name: formName})
 			log.FormChanges = true
+			log.Breaking = true
 
 		case oldExists && newExists:
 			// Form exists in both, check for changes
@@ -113,6 +170,11 @@ func CompareAppInfos(oldInfo, newInfo *AppInfo) (*ChangeLog, error) {
 			}
 
 			if mod.SchemaChange || mod.UIChange || mod.CoreChange {
+				mod.Changes = classifyChanges(oldForm, newForm, mod)
+				for _, change := range mod.Changes {
+					mod.Breaking = mod.Breaking || change.Breaking
+				}
+				log.Breaking = log.Breaking || mod.Breaking
 				log.ModifiedForms = append(log.ModifiedForms, mod)
 			}
 		}
@@ -121,6 +183,90 @@ func CompareAppInfos(oldInfo, newInfo *AppInfo) (*ChangeLog, error) {
 	return log, nil
 }
 
+// CompareFiles compares the files of two versions by hash, listing each kind of change
+// sorted by path
+func CompareFiles(oldFiles, newFiles []File) *FileChanges {
+	changes := &FileChanges{Added: []FileChange{}, Removed: []FileChange{}, Modified: []FileChange{}}
+
+	oldByPath := make(map[string]File, len(oldFiles))
+	for _, file := range oldFiles {
+		oldByPath[file.Path] = file
+	}
+	newPaths := make(map[string]bool, len(newFiles))
+	for _, file := range newFiles {
+		newPaths[file.Path] = true
+		old, exists := oldByPath[file.Path]
+		switch {
+		case !exists:
+			changes.Added = append(changes.Added, FileChange{Path: file.Path, Hash: file.Hash, Size: file.Size, URL: file.URL})
+			changes.DownloadSize += file.Size
+		case old.Hash != file.Hash:
+			changes.Modified = append(changes.Modified, FileChange{Path: file.Path, Hash: file.Hash, Size: file.Size,
+				OldHash: old.Hash, OldSize: old.Size, URL: file.URL})
+			changes.DownloadSize += file.Size
+		}
+	}
+	for _, file := range oldFiles {
+		if !newPaths[file.Path] {
+			changes.Removed = append(changes.Removed, FileChange{Path: file.Path, Hash: file.Hash, Size: file.Size})
+		}
+	}
+
+	for _, list := range [][]FileChange{changes.Added, changes.Removed, changes.Modified} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+	return changes
+}
+
+// classifyChanges lists the changes between two versions of a form, classified as
+// breaking when data collected with the old version may no longer fit the new one.
+// APP_INFO.json records no titles or help texts, so schema changes that touch no field
+// are taken to be such text changes.
+func classifyChanges(oldForm, newForm FormInfo, mod FormModification) []ClassifiedChange {
+	var changes []ClassifiedChange
+
+	oldFields := make(map[string]FieldInfo, len(oldForm.Fields))
+	for _, field := range oldForm.Fields {
+		oldFields[field.Name] = field
+	}
+	newFields := make(map[string]bool, len(newForm.Fields))
+	for _, field := range newForm.Fields {
+		newFields[field.Name] = true
+		old, exists := oldFields[field.Name]
+		switch {
+		case !exists:
+			changes = append(changes, ClassifiedChange{Kind: ChangeFieldAdded, Field: field.Name, NewType: field.Type,
+				Breaking: field.Required || field.Core})
+		case old.Type != field.Type:
+			changes = append(changes, ClassifiedChange{Kind: ChangeTypeChanged, Field: field.Name, OldType: old.Type, NewType: field.Type,
+				Breaking: true})
+		case !old.Required && field.Required:
+			changes = append(changes, ClassifiedChange{Kind: ChangeMadeRequired, Field: field.Name, Breaking: true})
+		case old.Required && !field.Required:
+			changes = append(changes, ClassifiedChange{Kind: ChangeMadeOptional, Field: field.Name})
+		case old.QuestionType != field.QuestionType || !reflect.DeepEqual(old.Default, field.Default):
+			changes = append(changes, ClassifiedChange{Kind: ChangeFieldDetails, Field: field.Name})
+		}
+	}
+	for _, field := range oldForm.Fields {
+		if !newFields[field.Name] {
+			changes = append(changes, ClassifiedChange{Kind: ChangeFieldRemoved, Field: field.Name, OldType: field.Type,
+				Breaking: field.Required || field.Core})
+		}
+	}
+
+	if mod.SchemaChange && len(changes) == 0 {
+		changes = append(changes, ClassifiedChange{Kind: ChangeSchemaDetails})
+	}
+	if mod.CoreChange {
+		changes = append(changes, ClassifiedChange{Kind: ChangeCoreChanged, Breaking: true})
+	}
+	if mod.UIChange {
+		changes = append(changes, ClassifiedChange{Kind: ChangeUIChanged})
+	}
+	return changes
+}
+
 // compareFieldLists compares two lists of fields and returns added and removed fields with their types
 func compareFieldLists(oldFields, newFields []FieldInfo) (added, removed []FieldChange) {
 	// Create maps of field names to their types
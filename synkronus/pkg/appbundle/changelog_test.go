@@ -1,10 +1,14 @@
 package appbundle
 
 import (
+	"context"
 	"encoding/json"
+	"os"
 	"testing"
 
+	"github.com/opendataensemble/synkronus/pkg/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createTestAppInfo(version string, forms map[string]FormInfo) *AppInfo {
@@ -165,6 +169,92 @@ func TestCompareAppInfos_TypeChangeDetection(t *testing.T) {
 	assert.Equal(t, "string", mod.RemovedFields[0].Type)
 }
 
+func TestCompareAppInfos_BreakingClassification(t *testing.T) {
+	oldInfo := createTestAppInfo("0001", map[string]FormInfo{
+		"household": createTestFormInfo("schema1", "ui1", "core1", []FieldInfo{
+			{Name: "size", Type: "string"},
+			{Name: "head", Type: "string", Required: true},
+			{Name: "notes", Type: "string"},
+			{Name: "phone", Type: "string"},
+			{Name: "village", Type: "string", Required: true},
+		}),
+		"visit": createTestFormInfo("schema1", "ui1", "core1", []FieldInfo{{Name: "date", Type: "string"}}),
+	})
+	newInfo := createTestAppInfo("0002", map[string]FormInfo{
+		"household": createTestFormInfo("schema2", "ui1", "core1", []FieldInfo{
+			{Name: "size", Type: "integer"},                    // Type changed
+			{Name: "notes", Type: "string", Required: true},    // Made required
+			{Name: "phone", Type: "string"},                    // Unchanged
+			{Name: "village", Type: "string"},                  // Made optional
+			{Name: "email", Type: "string"},                    // Optional field added
+			{Name: "consent", Type: "boolean", Required: true}, // Required field added
+		}),
+		// Only titles or help texts changed, and the layout
+		"visit": createTestFormInfo("schema2", "ui2", "core1", []FieldInfo{{Name: "date", Type: "string"}}),
+	})
+
+	log, err := CompareAppInfos(oldInfo, newInfo)
+	assert.NoError(t, err)
+	assert.True(t, log.Breaking)
+
+	forms := map[string]FormModification{}
+	for _, mod := range log.ModifiedForms {
+		forms[mod.FormName] = mod
+	}
+
+	household := forms["household"]
+	assert.True(t, household.Breaking)
+	breaking := map[string]bool{}
+	kinds := map[string]string{}
+	for _, change := range household.Changes {
+		breaking[change.Field] = change.Breaking
+		kinds[change.Field] = change.Kind
+	}
+	assert.Equal(t, map[string]string{
+		"size":    ChangeTypeChanged,
+		"head":    ChangeFieldRemoved,
+		"notes":   ChangeMadeRequired,
+		"village": ChangeMadeOptional,
+		"email":   ChangeFieldAdded,
+		"consent": ChangeFieldAdded,
+	}, kinds)
+	assert.Equal(t, map[string]bool{
+		"size": true, "head": true, "notes": true, "village": false, "email": false, "consent": true,
+	}, breaking)
+
+	visit := forms["visit"]
+	assert.False(t, visit.Breaking)
+	assert.Equal(t, []ClassifiedChange{{Kind: ChangeSchemaDetails}, {Kind: ChangeUIChanged}}, visit.Changes)
+
+	// Adding an optional field alone is not breaking, changing the core fields is
+	log, err = CompareAppInfos(oldInfo, createTestAppInfo("0003", map[string]FormInfo{
+		"household": oldInfo.Forms["household"],
+		"visit": createTestFormInfo("schema2", "ui1", "core1", []FieldInfo{
+			{Name: "date", Type: "string"}, {Name: "outcome", Type: "string"},
+		}),
+	}))
+	assert.NoError(t, err)
+	assert.False(t, log.Breaking)
+
+	log, err = CompareAppInfos(oldInfo, createTestAppInfo("0004", map[string]FormInfo{
+		"household": oldInfo.Forms["household"],
+		"visit":     createTestFormInfo("schema1", "ui1", "core2", []FieldInfo{{Name: "date", Type: "string"}}),
+	}))
+	assert.NoError(t, err)
+	assert.True(t, log.Breaking)
+	assert.Equal(t, []ClassifiedChange{{Kind: ChangeCoreChanged, Breaking: true}}, log.ModifiedForms[0].Changes)
+
+	// Removing a form is breaking, adding one isn't
+	log, err = CompareAppInfos(oldInfo, createTestAppInfo("0005", map[string]FormInfo{"household": oldInfo.Forms["household"]}))
+	assert.NoError(t, err)
+	assert.True(t, log.Breaking)
+	log, err = CompareAppInfos(newInfo, createTestAppInfo("0006", map[string]FormInfo{
+		"household": newInfo.Forms["household"], "visit": newInfo.Forms["visit"], "clinic": createTestFormInfo("s", "u", "c", nil),
+	}))
+	assert.NoError(t, err)
+	assert.False(t, log.Breaking)
+}
+
 func TestGenerateChangeLog_JSON(t *testing.T) {
 	// Setup test data
 	oldInfo := &AppInfo{
@@ -241,3 +331,70 @@ func TestGetChangeLogBetweenVersions(t *testing.T) {
 	_, err := service.GetChangeLogBetweenVersions("9999", "9998")
 	assert.Error(t, err)
 }
+
+func TestCompareFiles(t *testing.T) {
+	oldFiles := []File{
+		{Path: "app/index.html", Hash: "h1", Size: 10},
+		{Path: "forms/user/schema.json", Hash: "s1", Size: 20},
+		{Path: "forms/old/schema.json", Hash: "o1", Size: 5},
+	}
+	newFiles := []File{
+		{Path: "app/index.html", Hash: "h1", Size: 10},
+		{Path: "forms/user/schema.json", Hash: "s2", Size: 25, URL: "/app-bundle/download/forms%2Fuser%2Fschema.json?version=0002"},
+		{Path: "forms/new/schema.json", Hash: "n1", Size: 7},
+	}
+
+	changes := CompareFiles(oldFiles, newFiles)
+
+	assert.Equal(t, []FileChange{{Path: "forms/new/schema.json", Hash: "n1", Size: 7}}, changes.Added)
+	assert.Equal(t, []FileChange{{Path: "forms/old/schema.json", Hash: "o1", Size: 5}}, changes.Removed)
+	assert.Equal(t, []FileChange{{Path: "forms/user/schema.json", Hash: "s2", Size: 25, OldHash: "s1", OldSize: 20,
+		URL: "/app-bundle/download/forms%2Fuser%2Fschema.json?version=0002"}}, changes.Modified)
+	assert.Equal(t, int64(32), changes.DownloadSize)
+
+	// Identical versions have empty lists rather than null ones
+	data, err := json.Marshal(CompareFiles(oldFiles, oldFiles))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"added":[],"removed":[],"modified":[],"download_size":0}`, string(data))
+}
+
+func TestCompareBundleFiles(t *testing.T) {
+	service := NewService(Config{BundlePath: t.TempDir(), VersionsPath: t.TempDir(), MaxVersions: 5}, logger.NewLogger())
+	ctx := context.Background()
+
+	push := func(forms map[string]map[string]any) {
+		bundle, err := createTestFormBundle(t, forms)
+		require.NoError(t, err)
+		defer cleanupTestBundle(t, bundle)
+		f, err := os.Open(bundle)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = service.PushBundle(ctx, f)
+		require.NoError(t, err)
+	}
+	push(map[string]map[string]any{
+		"user": createFormSchema(map[string]any{"name": map[string]any{"type": "string"}}),
+		"old":  createFormSchema(map[string]any{"note": map[string]any{"type": "string"}}),
+	})
+	push(map[string]map[string]any{
+		"user": createFormSchema(map[string]any{"email": map[string]any{"type": "string"}}),
+	})
+
+	changes, err := service.CompareBundleFiles(ctx, "0001", "latest")
+	require.NoError(t, err)
+	assert.Empty(t, changes.Added)
+	removed := make([]string, 0, len(changes.Removed))
+	for _, file := range changes.Removed {
+		removed = append(removed, file.Path)
+	}
+	assert.Equal(t, []string{"forms/old/schema.json", "forms/old/ui.json"}, removed)
+	// The index and the user UI are unchanged
+	require.Len(t, changes.Modified, 2)
+	assert.Equal(t, "APP_INFO.json", changes.Modified[0].Path)
+	assert.Equal(t, "forms/user/schema.json", changes.Modified[1].Path)
+	assert.NotEqual(t, changes.Modified[1].OldHash, changes.Modified[1].Hash)
+	assert.Equal(t, "/app-bundle/download/forms%2Fuser%2Fschema.json?version=0002", changes.Modified[1].URL)
+
+	_, err = service.CompareBundleFiles(ctx, "0001", "0009")
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package appbundle
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDraftPushAndPromote(t *testing.T) {
+	ctx := context.Background()
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+	}
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	pushFile := func() *os.File {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	// Promoting without a draft fails
+	_, err = service.PromoteDraft(ctx)
+	require.ErrorIs(t, err, ErrNoDraft)
+
+	// Stage a draft: it gets no version number and is not listed
+	manifest, err := service.PushDraft(ctx, pushFile())
+	require.NoError(t, err)
+	require.Equal(t, DraftVersion, manifest.Version)
+
+	versions, err := service.GetVersions(ctx)
+	require.NoError(t, err)
+	require.Empty(t, versions, "Draft must not occupy a version slot")
+	require.Error(t, service.SwitchVersion(ctx, DraftVersion), "Draft must not be activatable")
+
+	// Staging again replaces the draft
+	_, err = service.PushDraft(ctx, pushFile())
+	require.NoError(t, err)
+
+	// A regular push still takes the next number
+	manifest, err = service.PushBundle(ctx, pushFile())
+	require.NoError(t, err)
+	require.Equal(t, "0001", manifest.Version)
+
+	// Promotion numbers the draft after existing versions and stamps APP_INFO.json
+	manifest, err = service.PromoteDraft(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "0002", manifest.Version)
+
+	data, err := os.ReadFile(filepath.Join(service.versionsPath, "0002", "APP_INFO.json"))
+	require.NoError(t, err)
+	var appInfo AppInfo
+	require.NoError(t, json.Unmarshal(data, &appInfo))
+	require.Equal(t, "2", appInfo.Version)
+
+	_, err = os.Stat(filepath.Join(service.versionsPath, DraftVersion))
+	require.True(t, os.IsNotExist(err), "Draft slot should be empty after promotion")
+
+	versions, err = service.GetVersions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0002", "0001"}, versions)
+}
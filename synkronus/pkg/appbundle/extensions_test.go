@@ -0,0 +1,78 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintBundleExtensions(t *testing.T) {
+	bundle := func(files map[string]string) *zip.Reader {
+		buf, err := createTestZip(t, files)
+		require.NoError(t, err)
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		return reader
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		problems []string
+		warnings []string
+	}{
+		{"v1", map[string]string{"forms/ext.json": `{
+  "version": "1",
+  "renderers": {
+    "map": {"renderer": {"path": "/extensions/renderers/Map.jsx", "export": "default"}, "tester": {"path": "/extensions/renderers/Map.jsx", "export": "tester"}}
+  },
+  "functions": {"age": {"path": "/extensions/functions.js", "export": "age"}}
+}`}, nil, nil},
+		{"legacy", map[string]string{"forms/ext.json": `{"renderers": {"custom": {"name": "Custom", "format": "custom", "module": "renderers/Custom.tsx"}}}`}, nil, nil},
+		{"invalid JSON", map[string]string{"forms/ext.json": "{\n  \"renderers\": {,}\n}"},
+			[]string{"forms/ext.json:2:17: invalid JSON: invalid character ',' looking for beginning of object key string"}, nil},
+		{"module path", map[string]string{"forms/ext.json": `{
+  "renderers": {
+    "map": {"renderer": {"path": "extensions/Map.css", "export": "default"}}
+  }
+}`}, []string{`forms/ext.json:3:26: /renderers/map/renderer/path: "extensions/Map.css" is not a module path in the bundle like /extensions/renderers/Map.jsx`}, nil},
+		{"missing export", map[string]string{"forms/ext.json": `{"functions": {"age": {"path": "/extensions/functions.js"}}}`},
+			[]string{`forms/ext.json:1:16: /functions/age: must be a v1 function with path and export or a legacy function with name`}, nil},
+		{"unknown key", map[string]string{"forms/ext.json": `{"renderer": {}}`}, nil,
+			[]string{`forms/ext.json:1:2: unknown key "renderer", ignored by devices`}},
+		{"unloaded file", map[string]string{"forms/extensions/renderers/ext.json": `{}`}, nil,
+			[]string{"forms/extensions/renderers/ext.json: not loaded by devices, which read forms/ext.json and forms/{form}/ext.json"}},
+		{"duplicate format", map[string]string{"forms/ext.json": `{"renderers": {
+  "custom": {"name": "Custom", "format": "custom", "module": "renderers/Custom.tsx"},
+  "other": {"name": "Other", "format": "custom", "module": "renderers/Other.tsx"}
+}}`}, []string{`forms/ext.json:3:3: renderer format "custom" is already declared at forms/ext.json:2:3`}, nil},
+		{"form override", map[string]string{
+			"forms/ext.json":      `{"renderers": {"map": {"renderer": {"path": "/extensions/Map.jsx", "export": "default"}}}}`,
+			"forms/user/ext.json": `{"renderers": {"map": {"renderer": {"path": "/extensions/UserMap.jsx", "export": "default"}}}}`,
+		}, nil, []string{`forms/user/ext.json:1:16: renderer format "map" overrides the one at forms/ext.json:1:16 for form 'user'`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lint := lintBundleExtensions(bundle(tt.files))
+			assert.Equal(t, tt.problems, lint.Problems)
+			assert.Equal(t, tt.warnings, lint.Warnings)
+		})
+	}
+}
+
+func TestValidateExtensions(t *testing.T) {
+	buf, err := createTestZip(t, map[string]string{
+		"app/index.html": "<html></html>",
+		"forms/ext.json": `{"functions": {"age": {"path": "/extensions/functions.js", "export": "1age"}}}`,
+	})
+	require.NoError(t, err)
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	err = (&Service{}).validateBundleStructure(reader)
+	require.ErrorIs(t, err, ErrInvalidExtension)
+	assert.Contains(t, err.Error(), `forms/ext.json:1:60: /functions/age/export: "1age" is not`)
+}
@@ -0,0 +1,128 @@
+// Package formschema finds the files of a form in an app bundle directory and caches what
+// the server reads from form schemas, so every feature resolves form types the same way.
+// It lives apart from package appbundle, which imports some of its consumers.
+package formschema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaFile is the name of the JSON schema in a form's directory
+const SchemaFile = "schema.json"
+
+// formDirs are the directories of an app bundle that hold one directory per form, forms/
+// before the older app/forms/
+var formDirs = []string{"forms", "app/forms"}
+
+// Dirs returns the directories of an app bundle that hold one directory per form, in
+// lookup order; none when bundlePath is empty
+func Dirs(bundlePath string) []string {
+	if bundlePath == "" {
+		return nil
+	}
+	dirs := make([]string, 0, len(formDirs))
+	for _, dir := range formDirs {
+		dirs = append(dirs, filepath.Join(bundlePath, filepath.FromSlash(dir)))
+	}
+	return dirs
+}
+
+// BundlePaths returns the slash-separated paths, as listed in a bundle manifest, that the
+// file name of a form type may have, in lookup order; none when formType isn't valid
+func BundlePaths(formType, name string) []string {
+	if !ValidFormType(formType) {
+		return nil
+	}
+	paths := make([]string, 0, len(formDirs))
+	for _, dir := range formDirs {
+		paths = append(paths, dir+"/"+formType+"/"+name)
+	}
+	return paths
+}
+
+// ValidFormType reports whether formType can name a form directory. Empty names, . and ..
+// and names with path separators are refused, so a form type never leads outside the
+// forms directories.
+func ValidFormType(formType string) bool {
+	return formType != "" && formType != "." && formType != ".." && !strings.ContainsAny(formType, `/\`)
+}
+
+// File returns the path of the file name of a form type in the app bundle at bundlePath,
+// or "" when the form has no such file or formType isn't valid
+func File(bundlePath, formType, name string) string {
+	if !ValidFormType(formType) {
+		return ""
+	}
+	for _, dir := range Dirs(bundlePath) {
+		path := filepath.Join(dir, formType, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Cache holds what parse made of the schema of each form type, and parses a schema again
+// when the bundle changes its file, as told by its modification time and size
+type Cache[T any] struct {
+	bundlePath string
+	parse      func(formType string, data []byte) (T, error)
+
+	mu      sync.Mutex
+	entries map[string]entry[T]
+}
+
+// entry is the parse result of a schema file as of its modification time
+type entry[T any] struct {
+	modTime time.Time
+	size    int64
+	value   T
+	err     error
+}
+
+// NewCache creates a cache of the schemas of the app bundle at bundlePath. An empty
+// bundlePath means no form has a schema.
+func NewCache[T any](bundlePath string, parse func(formType string, data []byte) (T, error)) *Cache[T] {
+	return &Cache[T]{
+		bundlePath: bundlePath,
+		parse:      parse,
+		entries:    make(map[string]entry[T]),
+	}
+}
+
+// Get returns what parse made of the schema of formType, or the zero value when the form
+// has none. Parse errors are kept until the file changes; failures to read it are not.
+func (c *Cache[T]) Get(formType string) (T, error) {
+	var zero T
+	path := File(c.bundlePath, formType, SchemaFile)
+	if path == "" {
+		return zero, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return zero, fmt.Errorf("failed to read schema of %s: %w", formType, err)
+	}
+
+	c.mu.Lock()
+	cached, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.value, cached.err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return zero, fmt.Errorf("failed to read schema of %s: %w", formType, err)
+	}
+	value, err := c.parse(formType, data)
+
+	c.mu.Lock()
+	c.entries[path] = entry[T]{modTime: info.ModTime(), size: info.Size(), value: value, err: err}
+	c.mu.Unlock()
+	return value, err
+}
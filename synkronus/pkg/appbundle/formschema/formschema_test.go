@@ -0,0 +1,109 @@
+package formschema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	bundle := t.TempDir()
+	writeFile(t, filepath.Join(bundle, "forms", "survey", SchemaFile), `{}`)
+	writeFile(t, filepath.Join(bundle, "app", "forms", "survey", SchemaFile), `{}`)
+	writeFile(t, filepath.Join(bundle, "app", "forms", "legacy", SchemaFile), `{}`)
+	writeFile(t, filepath.Join(bundle, "forms", SchemaFile), `{}`)
+	writeFile(t, filepath.Join(bundle, "app", SchemaFile), `{}`)
+
+	tests := []struct {
+		formType string
+		expected string
+	}{
+		{"survey", filepath.Join(bundle, "forms", "survey", SchemaFile)},
+		{"legacy", filepath.Join(bundle, "app", "forms", "legacy", SchemaFile)},
+		{"missing", ""},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"../forms/survey", ""},
+		{`..\app`, ""},
+	}
+	for _, tt := range tests {
+		if got := File(bundle, tt.formType, SchemaFile); got != tt.expected {
+			t.Errorf("File(%q) = %q, expected %q", tt.formType, got, tt.expected)
+		}
+	}
+	if got := File("", "survey", SchemaFile); got != "" {
+		t.Errorf("Expected no file without a bundle, got %q", got)
+	}
+}
+
+func TestBundlePaths(t *testing.T) {
+	got := BundlePaths("survey", SchemaFile)
+	expected := []string{"forms/survey/schema.json", "app/forms/survey/schema.json"}
+	if len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("BundlePaths(survey) = %q, expected %q", got, expected)
+	}
+	for _, formType := range []string{"", ".", "..", "../survey"} {
+		if got := BundlePaths(formType, SchemaFile); got != nil {
+			t.Errorf("BundlePaths(%q) = %q, expected none", formType, got)
+		}
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	bundle := t.TempDir()
+	path := filepath.Join(bundle, "forms", "survey", SchemaFile)
+	writeFile(t, path, `one`)
+
+	parses := 0
+	cache := NewCache(bundle, func(formType string, data []byte) (string, error) {
+		parses++
+		if string(data) == "bad" {
+			return "", errors.New("bad schema")
+		}
+		return formType + ":" + string(data), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if value, err := cache.Get("survey"); err != nil || value != "survey:one" {
+			t.Fatalf("Unexpected %q, %v", value, err)
+		}
+	}
+	if parses != 1 {
+		t.Errorf("Expected the schema to be parsed once, got %d", parses)
+	}
+
+	// A changed file is parsed again, and its parse error kept until it changes
+	writeFile(t, path, `bad`)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get("survey"); err == nil {
+			t.Fatal("Expected the parse error")
+		}
+	}
+	if parses != 2 {
+		t.Errorf("Expected 2 parses, got %d", parses)
+	}
+
+	if value, err := cache.Get("missing"); err != nil || value != "" {
+		t.Errorf("Expected the zero value for a form without a schema, got %q, %v", value, err)
+	}
+	if value, err := cache.Get(".."); err != nil || value != "" {
+		t.Errorf("Expected the zero value for an invalid form type, got %q, %v", value, err)
+	}
+}
@@ -0,0 +1,30 @@
+package formschema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// WriteSchema writes the schema.json of a form type into formsDir, a forms directory of a
+// test app bundle, for tests of the packages reading schemas through a Cache. A rewrite
+// gets a later modification time, so it is seen even on filesystems with coarse timestamps.
+func WriteSchema(t testing.TB, formsDir, formType, schema string) {
+	t.Helper()
+	dir := filepath.Join(formsDir, formType)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create form directory: %v", err)
+	}
+	path := filepath.Join(dir, SchemaFile)
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil && !modTime.After(info.ModTime()) {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(path, []byte(schema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set schema modification time: %v", err)
+	}
+}
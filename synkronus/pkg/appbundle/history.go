@@ -0,0 +1,222 @@
+package appbundle
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// Change actions: how a version transition happened
+const (
+	// ChangeActionPush is a pushed bundle becoming the newest version
+	ChangeActionPush = "push"
+	// ChangeActionPromote is a promoted draft becoming the newest version
+	ChangeActionPromote = "promote"
+	// ChangeActionSwitch is an admin activating a version
+	ChangeActionSwitch = "switch"
+	// ChangeActionScheduledSwitch is a scheduled switch activating a version at its cutover
+	ChangeActionScheduledSwitch = "scheduled_switch"
+	// ChangeActionRollback is an admin rolling back to the version before the active one
+	ChangeActionRollback = "rollback"
+)
+
+// ChangeHistoryEntry is a recorded version transition and the changes it made
+type ChangeHistoryEntry struct {
+	ID     int64  `json:"id"`
+	Action string `json:"action"`
+	// FromVersion is the newest version before a push or promotion, or the active version
+	// before a switch; empty for the first version
+	FromVersion string    `json:"from_version,omitempty"`
+	ToVersion   string    `json:"to_version"`
+	Actor       string    `json:"actor,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Changes     ChangeLog `json:"changes"`
+}
+
+// ChangeHistoryFilter narrows the change history
+type ChangeHistoryFilter struct {
+	// Form only keeps transitions that added, removed or modified this form
+	Form string
+	// Field only keeps transitions that added or removed this field, in Form if it is set
+	Field string
+	// Limit is the maximum number of entries; 0 returns all
+	Limit int
+}
+
+// ChangeHistory stores the version transitions of the app bundle
+type ChangeHistory interface {
+	// Record stores an entry, setting its ID and creation time
+	Record(ctx context.Context, entry *ChangeHistoryEntry) error
+	// List returns all entries, newest first
+	List(ctx context.Context) ([]ChangeHistoryEntry, error)
+}
+
+type dbChangeHistory struct {
+	db *sql.DB
+}
+
+// NewChangeHistory creates a change history stored in the app_bundle_changes table
+func NewChangeHistory(db *sql.DB) ChangeHistory {
+	return &dbChangeHistory{db: db}
+}
+
+func (h *dbChangeHistory) Record(ctx context.Context, entry *ChangeHistoryEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode change log: %w", err)
+	}
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO app_bundle_changes (action, from_version, to_version, actor, changes)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''), $5)
+		RETURNING id, created_at`,
+		entry.Action, entry.FromVersion, entry.ToVersion, entry.Actor, string(changes),
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record app bundle change: %w", err)
+	}
+	return nil
+}
+
+func (h *dbChangeHistory) List(ctx context.Context) ([]ChangeHistoryEntry, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, action, COALESCE(from_version, ''), to_version, COALESCE(actor, ''), changes, created_at
+		FROM app_bundle_changes
+		ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query app bundle changes: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []ChangeHistoryEntry{}
+	for rows.Next() {
+		var entry ChangeHistoryEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.FromVersion, &entry.ToVersion, &entry.Actor, &changes, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan app bundle change: %w", err)
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode change log of app bundle change %d: %w", entry.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read app bundle changes: %w", err)
+	}
+	return entries, nil
+}
+
+// GetChangeHistory returns the recorded version transitions, newest first. Without a
+// change history the list is empty.
+func (s *Service) GetChangeHistory(ctx context.Context, filter ChangeHistoryFilter) ([]ChangeHistoryEntry, error) {
+	if s.history == nil {
+		return []ChangeHistoryEntry{}, nil
+	}
+	entries, err := s.history.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]ChangeHistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if filter.Limit > 0 && len(matched) == filter.Limit {
+			break
+		}
+		if entry.Changes.touches(filter.Form, filter.Field) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched, nil
+}
+
+// touches reports whether the change log changed a form, or added or removed a field;
+// empty names match anything
+func (c *ChangeLog) touches(form, field string) bool {
+	if form == "" && field == "" {
+		return true
+	}
+	if field == "" {
+		for _, diffs := range [][]FormDiff{c.NewForms, c.RemovedForms} {
+			for _, diff := range diffs {
+				if diff.Name == form {
+					return true
+				}
+			}
+		}
+	}
+	for _, mod := range c.ModifiedForms {
+		if form != "" && mod.FormName != form {
+			continue
+		}
+		if field == "" {
+			return true
+		}
+		for _, fields := range [][]FieldChange{mod.AddedFields, mod.RemovedFields} {
+			for _, f := range fields {
+				if f.Name == field {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// recordChange stores the transition from one version to another in the change history.
+// Failures are logged; the transition itself already happened.
+func (s *Service) recordChange(ctx context.Context, action, actor, fromVersion, toVersion string) {
+	if s.history == nil || fromVersion == toVersion {
+		return
+	}
+
+	newInfo, err := s.GetAppInfo(ctx, toVersion)
+	if err != nil {
+		s.log.Error("Failed to record app bundle change", "action", action, "version", toVersion, "error", err)
+		return
+	}
+	// The first version adds every form
+	oldInfo := &AppInfo{}
+	if fromVersion != "" {
+		if oldInfo, err = s.GetAppInfo(ctx, fromVersion); err != nil {
+			s.log.Error("Failed to record app bundle change", "action", action, "version", fromVersion, "error", err)
+			return
+		}
+	}
+	changes, err := CompareAppInfos(oldInfo, newInfo)
+	if err != nil {
+		s.log.Error("Failed to record app bundle change", "action", action, "version", toVersion, "error", err)
+		return
+	}
+
+	entry := &ChangeHistoryEntry{
+		Action:      action,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Actor:       actor,
+		Changes:     *changes,
+	}
+	if err := s.history.Record(ctx, entry); err != nil {
+		s.log.Error("Failed to record app bundle change", "action", action, "version", toVersion, "error", err)
+	}
+}
+
+// latestVersion returns the newest numbered version, or "" when there is none
+func (s *Service) latestVersion(ctx context.Context) string {
+	versions, err := s.GetVersions(ctx)
+	if err != nil || len(versions) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(versions[0], " *")
+}
+
+// contextActor returns the username of the user in ctx, or ""
+func contextActor(ctx context.Context) string {
+	if user := authmw.GetUserFromContext(ctx); user != nil {
+		return user.Username
+	}
+	return ""
+}
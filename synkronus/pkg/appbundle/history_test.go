@@ -0,0 +1,135 @@
+package appbundle
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryChangeHistory keeps entries in memory, newest first
+type memoryChangeHistory struct {
+	entries []ChangeHistoryEntry
+}
+
+func (m *memoryChangeHistory) Record(ctx context.Context, entry *ChangeHistoryEntry) error {
+	entry.ID = int64(len(m.entries) + 1)
+	entry.CreatedAt = time.Now()
+	m.entries = append([]ChangeHistoryEntry{*entry}, m.entries...)
+	return nil
+}
+
+func (m *memoryChangeHistory) List(ctx context.Context) ([]ChangeHistoryEntry, error) {
+	return m.entries, nil
+}
+
+func TestChangeHistory(t *testing.T) {
+	history := &memoryChangeHistory{}
+	service := NewService(Config{BundlePath: t.TempDir(), VersionsPath: t.TempDir(), MaxVersions: 5, History: history}, logger.NewLogger())
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "alice", Role: models.RoleAdmin})
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+	push := func() {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = service.PushBundle(ctx, f)
+		require.NoError(t, err)
+	}
+
+	push()
+	push()
+	require.NoError(t, service.SwitchVersion(ctx, "0002"))
+	require.NoError(t, service.SwitchVersion(ctx, "0002"), "switching to the active version records nothing")
+
+	// A scheduled switch is recorded with the user who scheduled it
+	require.NoError(t, service.ScheduleSwitch(ctx, "0001", time.Now().Add(time.Hour)))
+	service.scheduled.EffectiveAt = time.Now().Add(-time.Second)
+	service.applyDueSwitch(context.Background())
+
+	entries, err := service.GetChangeHistory(ctx, ChangeHistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, ChangeActionScheduledSwitch, entries[0].Action)
+	assert.Equal(t, "0002", entries[0].FromVersion)
+	assert.Equal(t, "0001", entries[0].ToVersion)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, ChangeActionSwitch, entries[1].Action)
+	assert.Equal(t, "", entries[1].FromVersion, "no version was active")
+	assert.Equal(t, ChangeActionPush, entries[2].Action)
+	assert.Equal(t, "0001", entries[2].FromVersion)
+	assert.Equal(t, "0002", entries[2].ToVersion)
+	assert.False(t, entries[2].Changes.FormChanges)
+
+	// The first push adds every form
+	first := entries[3]
+	assert.Equal(t, "", first.FromVersion)
+	assert.Equal(t, "alice", first.Actor)
+	assert.Equal(t, []FormDiff{{Name: "sample"}}, first.Changes.NewForms)
+
+	// The form was added by the first push and by activating a version when none was active
+	entries, err = service.GetChangeHistory(ctx, ChangeHistoryFilter{Form: "sample"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = service.GetChangeHistory(ctx, ChangeHistoryFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestChangeLogTouches(t *testing.T) {
+	changes := ChangeLog{
+		NewForms: []FormDiff{{Name: "clinic"}},
+		ModifiedForms: []FormModification{{
+			FormName:    "household",
+			AddedFields: []FieldChange{{Name: "phone", Type: "string"}},
+		}},
+	}
+
+	assert.True(t, changes.touches("", ""))
+	assert.True(t, changes.touches("clinic", ""))
+	assert.True(t, changes.touches("household", ""))
+	assert.True(t, changes.touches("household", "phone"))
+	assert.True(t, changes.touches("", "phone"))
+	assert.False(t, changes.touches("clinic", "phone"))
+	assert.False(t, changes.touches("household", "name"))
+	assert.False(t, changes.touches("survey", ""))
+}
+
+func TestDBChangeHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	history := NewChangeHistory(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO app_bundle_changes`).
+		WithArgs(ChangeActionPush, "", "0001", "alice", `{"compare_version_a":"","compare_version_b":"1","form_changes":true,"ui_changes":false,"new_forms":[{"form":"sample"}],"breaking":false}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+	entry := &ChangeHistoryEntry{
+		Action:    ChangeActionPush,
+		ToVersion: "0001",
+		Actor:     "alice",
+		Changes:   ChangeLog{CompareVersionB: "1", FormChanges: true, NewForms: []FormDiff{{Name: "sample"}}},
+	}
+	require.NoError(t, history.Record(ctx, entry))
+	assert.Equal(t, int64(1), entry.ID)
+
+	mock.ExpectQuery(`SELECT id, action`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "action", "from_version", "to_version", "actor", "changes", "created_at"}).
+			AddRow(1, ChangeActionPush, "", "0001", "alice", []byte(`{"form_changes":true,"new_forms":[{"form":"sample"}]}`), now))
+	entries, err := history.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []FormDiff{{Name: "sample"}}, entries[0].Changes.NewForms)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -10,6 +10,16 @@ import (
 // ErrFileNotFound is returned when a requested file is not found
 var ErrFileNotFound = errors.New("file not found")
 
+// ErrNoDraft is returned when promoting without a staged draft
+var ErrNoDraft = errors.New("no draft bundle staged")
+
+// ErrVersionInternal is returned when activating an internal version, or when making the
+// active version internal
+var ErrVersionInternal = errors.New("app bundle version is internal")
+
+// DraftVersion is the name of the unnumbered draft slot in the versions directory
+const DraftVersion = "draft"
+
 // File represents a file in the app bundle
 type File struct {
 	Path     string    `json:"path"`
@@ -17,14 +27,30 @@ type File struct {
 	Hash     string    `json:"hash"`
 	MimeType string    `json:"mimeType"`
 	ModTime  time.Time `json:"modTime"`
+	// URL downloads this file's content of the manifest's version; it stays valid and
+	// cacheable after the active version changes
+	URL string `json:"url,omitempty"`
 }
 
 // Manifest represents the app bundle manifest
 type Manifest struct {
-	Files       []File `json:"files"`
+	Files       []File          `json:"files"`
+	Version     string          `json:"version"`
+	GeneratedAt string          `json:"generatedAt"`
+	Hash        string          `json:"hash"`               // Hash of the entire manifest for ETag
+	Upcoming    *UpcomingBundle `json:"upcoming,omitempty"` // Version scheduled to replace this one
+	// Warnings lists renderers that need a newer host app than the one the client declared
+	// in the X-Host-App-Version header
+	Warnings []RendererWarning `json:"warnings,omitempty"`
+}
+
+// UpcomingBundle describes a version scheduled to become active at EffectiveAt.
+// Clients can download its files ahead of time and switch at the cutover.
+type UpcomingBundle struct {
 	Version     string `json:"version"`
-	GeneratedAt string `json:"generatedAt"`
-	Hash        string `json:"hash"` // Hash of the entire manifest for ETag
+	EffectiveAt string `json:"effectiveAt"`
+	Files       []File `json:"files"`
+	Hash        string `json:"hash"`
 }
 
 // AppBundleServiceInterface defines the interface for app bundle operations
@@ -38,6 +64,9 @@ type AppBundleServiceInterface interface {
 	// GetLatestVersionFile gets a file from the latest version
 	GetLatestVersionFile(ctx context.Context, path string) (io.ReadCloser, *File, error)
 
+	// GetVersionFile gets a file from a specific version
+	GetVersionFile(ctx context.Context, version, path string) (io.ReadCloser, *File, error)
+
 	// GetFileHash returns the hash for a specific file, optionally from the latest version
 	GetFileHash(ctx context.Context, path string, useLatest bool) (string, error)
 
@@ -47,14 +76,43 @@ type AppBundleServiceInterface interface {
 	// PushBundle uploads a new app bundle from a zip file
 	PushBundle(ctx context.Context, zipReader io.Reader) (*Manifest, error)
 
+	// PushDraft uploads and validates a bundle into the draft slot without assigning a version number
+	PushDraft(ctx context.Context, zipReader io.Reader) (*Manifest, error)
+
+	// PromoteDraft turns the staged draft into the next numbered version
+	PromoteDraft(ctx context.Context) (*Manifest, error)
+
+	// GetPushStatus reports the push holding the push lock, if any
+	GetPushStatus(ctx context.Context) (*PushStatus, error)
+
 	// VersionInfo holds information about an app bundle version
 	// GetVersions returns a list of available app bundle versions
 	// The current version is marked with an asterisk (*) at the end
 	GetVersions(ctx context.Context) ([]string, error)
 
+	// GetVersionDetails returns the available versions, newest first, with their author,
+	// creation time and number of forms
+	GetVersionDetails(ctx context.Context) ([]VersionInfo, error)
+
+	// SetVersionInternal marks a version internal, so only admins and testers see it, or released
+	SetVersionInternal(ctx context.Context, version string, internal bool) error
+
+	// GetBootScreenshot returns the PNG taken when a version's app was boot checked
+	GetBootScreenshot(ctx context.Context, version string) ([]byte, error)
+
 	// SwitchVersion switches to a specific app bundle version
 	SwitchVersion(ctx context.Context, version string) error
 
+	// RollbackVersion switches to the version before the active one and checks that its
+	// manifest regenerates, restoring the active version if it doesn't
+	RollbackVersion(ctx context.Context) (*RollbackResult, error)
+
+	// ScheduleSwitch switches to a specific app bundle version at effectiveAt
+	ScheduleSwitch(ctx context.Context, version string, effectiveAt time.Time) error
+
+	// GetScheduledSwitch returns the pending version switch, or nil if none is scheduled
+	GetScheduledSwitch(ctx context.Context) (*ScheduledSwitch, error)
+
 	// GetAppInfo retrieves the app info for a specific version
 	GetAppInfo(ctx context.Context, version string) (*AppInfo, error)
 
@@ -64,6 +122,13 @@ type AppBundleServiceInterface interface {
 	// CompareAppInfos compares two versions and returns the change log
 	CompareAppInfos(ctx context.Context, versionA, versionB string) (*ChangeLog, error)
 
+	// CompareBundleFiles lists the files added, removed and modified between two versions
+	CompareBundleFiles(ctx context.Context, versionA, versionB string) (*FileChanges, error)
+
+	// GetChangeHistory returns the recorded pushes, promotions and switches with their
+	// change logs, newest first
+	GetChangeHistory(ctx context.Context, filter ChangeHistoryFilter) ([]ChangeHistoryEntry, error)
+
 	// GetBundleZipPath returns the filesystem path to the active bundle's zip archive
 	GetBundleZipPath(ctx context.Context) (string, error)
 }
@@ -0,0 +1,282 @@
+package appbundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaViolation is a value that doesn't match a JSON Schema
+type SchemaViolation struct {
+	// Pointer is the JSON pointer of the value
+	Pointer string
+	// Keyword is the schema keyword the value fails
+	Keyword string
+	Message string
+}
+
+// schemaChecker checks documents against the JSON Schema keywords bundle and form schemas
+// use: $ref to local definitions, type, required, properties, additionalProperties,
+// items, minItems, maxItems, anyOf, oneOf, enum, const, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, pattern, minLength and maxLength
+type schemaChecker struct {
+	root       map[string]any
+	violations []SchemaViolation
+}
+
+// CheckSchema returns the violations of doc, as decoded by encoding/json, against schema,
+// ordered by pointer
+func CheckSchema(schema map[string]any, doc any) []SchemaViolation {
+	c := &schemaChecker{root: schema}
+	c.check(schema, doc, "")
+	sort.SliceStable(c.violations, func(i, j int) bool { return c.violations[i].Pointer < c.violations[j].Pointer })
+	return c.violations
+}
+
+func (c *schemaChecker) fail(pointer, keyword, format string, args ...any) {
+	c.violations = append(c.violations, SchemaViolation{Pointer: pointer, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *schemaChecker) check(schema map[string]any, value any, pointer string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		if target := c.resolve(ref); target != nil {
+			c.check(target, value, pointer)
+		} else {
+			c.fail(pointer, "$ref", "schema reference %s cannot be resolved", ref)
+		}
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !valueHasType(value, types) {
+		c.fail(pointer, "type", "is %s, expected %s", jsonType(value), strings.Join(types, " or "))
+		return
+	}
+
+	if branches, ok := schema["anyOf"].([]any); ok {
+		var titles []string
+		matched := false
+		for _, branch := range branches {
+			branchSchema, _ := branch.(map[string]any)
+			sub := &schemaChecker{root: c.root}
+			sub.check(branchSchema, value, pointer)
+			if len(sub.violations) == 0 {
+				matched = true
+				break
+			}
+			if title, ok := branchSchema["title"].(string); ok {
+				titles = append(titles, title)
+			}
+		}
+		if !matched {
+			c.fail(pointer, "anyOf", "must be %s", strings.Join(titles, " or "))
+		}
+	}
+
+	if branches, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, branch := range branches {
+			branchSchema, _ := branch.(map[string]any)
+			sub := &schemaChecker{root: c.root}
+			sub.check(branchSchema, value, pointer)
+			if len(sub.violations) == 0 {
+				matches++
+			}
+		}
+		switch {
+		case matches == 0:
+			c.fail(pointer, "oneOf", "%s is not one of the allowed options", formatRuleValue(value))
+		case matches > 1:
+			c.fail(pointer, "oneOf", "matches more than one option")
+		}
+	}
+
+	if values, ok := schema["enum"].([]any); ok && !containsValue(values, value) {
+		c.fail(pointer, "enum", "%s is not one of the allowed values", formatRuleValue(value))
+	}
+	if constant, ok := schema["const"]; ok && !containsValue([]any{constant}, value) {
+		c.fail(pointer, "const", "must be %s", formatRuleValue(constant))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		c.checkObject(schema, v, pointer)
+	case []any:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			c.fail(pointer, "minItems", "has %d items, expected at least %s", len(v), formatNumber(min))
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			c.fail(pointer, "maxItems", "has %d items, expected at most %s", len(v), formatNumber(max))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				c.check(items, item, pointer+"/"+strconv.Itoa(i))
+			}
+		}
+	case float64:
+		c.checkNumber(schema, v, pointer)
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len([]rune(v))) < min {
+			if min <= 1 {
+				c.fail(pointer, "minLength", "must not be empty")
+			} else {
+				c.fail(pointer, "minLength", "must be at least %s characters", formatNumber(min))
+			}
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(len([]rune(v))) > max {
+			c.fail(pointer, "maxLength", "must be at most %s characters", formatNumber(max))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				if title, ok := schema["title"].(string); ok {
+					c.fail(pointer, "pattern", "%q is not %s", v, title)
+				} else {
+					c.fail(pointer, "pattern", "%q does not match %s", v, pattern)
+				}
+			}
+		}
+	}
+}
+
+// checkNumber checks the minimum, maximum, exclusiveMinimum and exclusiveMaximum keywords
+func (c *schemaChecker) checkNumber(schema map[string]any, n float64, pointer string) {
+	if min, ok := schema["minimum"].(float64); ok && n < min {
+		c.fail(pointer, "minimum", "%s is less than %s", formatNumber(n), formatNumber(min))
+	}
+	if max, ok := schema["maximum"].(float64); ok && n > max {
+		c.fail(pointer, "maximum", "%s is greater than %s", formatNumber(n), formatNumber(max))
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && n <= min {
+		c.fail(pointer, "exclusiveMinimum", "%s must be greater than %s", formatNumber(n), formatNumber(min))
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && n >= max {
+		c.fail(pointer, "exclusiveMaximum", "%s must be less than %s", formatNumber(n), formatNumber(max))
+	}
+}
+
+// formatNumber formats a schema number in its shortest form
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// checkObject checks the required, properties and additionalProperties keywords
+func (c *schemaChecker) checkObject(schema map[string]any, object map[string]any, pointer string) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, key := range required {
+			if name, ok := key.(string); ok {
+				if _, present := object[name]; !present {
+					c.fail(pointer, "required", "missing %q", name)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := pointer + "/" + escapeJSONPointer(key)
+		if property, ok := properties[key].(map[string]any); ok {
+			c.check(property, object[key], child)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				c.fail(child, "additionalProperties", "unknown key %q", key)
+			}
+		case map[string]any:
+			c.check(additional, object[key], child)
+		}
+	}
+}
+
+// resolve returns the schema a local reference like #/definitions/name points to
+func (c *schemaChecker) resolve(ref string) map[string]any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node any = c.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = object[strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")]
+	}
+	target, _ := node.(map[string]any)
+	return target
+}
+
+// escapeJSONPointer escapes a key for use in a JSON pointer
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// jsonPositions maps the JSON pointers of the values in data to the byte offset of their
+// key, or of the value itself for array items and the document
+func jsonPositions(data []byte) map[string]int {
+	positions := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var walk func(pointer string) error
+	walk = func(pointer string) error {
+		if _, ok := positions[pointer]; !ok {
+			positions[pointer] = skipJSONSeparators(data, int(dec.InputOffset()))
+		}
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := token.(json.Delim)
+		if !ok {
+			return nil
+		}
+		switch delim {
+		case '{':
+			for dec.More() {
+				at := skipJSONSeparators(data, int(dec.InputOffset()))
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := pointer + "/" + escapeJSONPointer(fmt.Sprint(key))
+				positions[child] = at
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := walk(pointer + "/" + strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	walk("")
+	return positions
+}
+
+// skipJSONSeparators returns the offset of the next token at or after offset
+func skipJSONSeparators(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// lineColumn returns the 1-based line and column of a byte offset in data
+func lineColumn(data []byte, offset int) (int, int) {
+	offset = min(max(offset, 0), len(data))
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	return line, offset - bytes.LastIndexByte(data[:offset], '\n')
+}
@@ -0,0 +1,60 @@
+package appbundle
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckSchema(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"sex": {"enum": ["male", "female"]},
+			"consent": {"const": true},
+			"score": {"type": "number", "exclusiveMinimum": 0, "maximum": 10},
+			"tags": {"type": "array", "maxItems": 2},
+			"code": {"type": "string", "minLength": 3, "maxLength": 5},
+			"contact": {"oneOf": [{"type": "string"}, {"type": "number"}]}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		doc      string
+		expected map[string]string
+	}{
+		{"valid", `{"sex":"female","consent":true,"score":10,"tags":["a"],"code":"abc","contact":"x"}`, map[string]string{}},
+		{"invalid", `{"sex":"other","consent":false,"score":0,"tags":["a","b","c"],"code":"ab","contact":true}`, map[string]string{
+			"/sex":     `"other" is not one of the allowed values`,
+			"/consent": "must be true",
+			"/score":   "0 must be greater than 0",
+			"/tags":    "has 3 items, expected at most 2",
+			"/code":    "must be at least 3 characters",
+			"/contact": "true is not one of the allowed options",
+		}},
+		{"too long", `{"code":"abcdef","score":11}`, map[string]string{
+			"/code":  "must be at most 5 characters",
+			"/score": "11 is greater than 10",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+			violations := CheckSchema(schema, doc)
+			if len(violations) != len(tt.expected) {
+				t.Fatalf("Expected %d violations, got %+v", len(tt.expected), violations)
+			}
+			for _, v := range violations {
+				if tt.expected[v.Pointer] != v.Message {
+					t.Errorf("Expected %s: %q, got %q", v.Pointer, tt.expected[v.Pointer], v.Message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LimitOverrideHeader is the request header with which an admin pushes a bundle that
+// exceeds the push limits anyway
+const LimitOverrideHeader = "X-Bundle-Limit-Override"
+
+// ErrBundleLimitExceeded is returned when a pushed bundle exceeds the push limits
+var ErrBundleLimitExceeded = errors.New("app bundle exceeds push limits")
+
+// Limits are the guardrails pushed bundles must stay within, so that a stray video or a
+// generated form explosion isn't downloaded by every device. Zero disables a limit.
+type Limits struct {
+	// MaxBytes is the largest total uncompressed size of the bundle's files
+	MaxBytes int64
+	// MaxForms is the largest number of forms
+	MaxForms int
+	// MaxRenderers is the largest number of custom renderers
+	MaxRenderers int
+}
+
+// DefaultLimits returns the push limits of a default configuration
+func DefaultLimits() Limits {
+	return Limits{
+		MaxBytes:     100 << 20,
+		MaxForms:     200,
+		MaxRenderers: 50,
+	}
+}
+
+// Limit names of a LimitViolation
+const (
+	LimitMaxBytes     = "max_bytes"
+	LimitMaxForms     = "max_forms"
+	LimitMaxRenderers = "max_renderers"
+)
+
+// largestFilesReported is how many of the biggest files a size violation names
+const largestFilesReported = 3
+
+// LimitViolation is a push limit a bundle exceeds
+type LimitViolation struct {
+	Limit  string `json:"limit"`
+	Max    int64  `json:"max"`
+	Actual int64  `json:"actual"`
+	// Largest are the biggest files of a bundle that exceeds max_bytes
+	Largest []BundleFileSize `json:"largest,omitempty"`
+}
+
+// BundleFileSize is the uncompressed size of a bundle file
+type BundleFileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// LimitError reports the push limits a bundle exceeds
+type LimitError struct {
+	Violations []LimitViolation
+}
+
+func (e *LimitError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		switch v.Limit {
+		case LimitMaxBytes:
+			largest := make([]string, len(v.Largest))
+			for j, file := range v.Largest {
+				largest[j] = fmt.Sprintf("%s %s", file.Path, formatMegabytes(file.Size))
+			}
+			messages[i] = fmt.Sprintf("files total %s, the limit is %s (largest: %s)",
+				formatMegabytes(v.Actual), formatMegabytes(v.Max), strings.Join(largest, ", "))
+		case LimitMaxForms:
+			messages[i] = fmt.Sprintf("%d forms, the limit is %d", v.Actual, v.Max)
+		case LimitMaxRenderers:
+			messages[i] = fmt.Sprintf("%d custom renderers, the limit is %d", v.Actual, v.Max)
+		}
+	}
+	return fmt.Sprintf("%s: %s", ErrBundleLimitExceeded, strings.Join(messages, "; "))
+}
+
+// Is makes errors.Is(err, ErrBundleLimitExceeded) match
+func (e *LimitError) Is(target error) bool {
+	return target == ErrBundleLimitExceeded
+}
+
+// limitOverrideKey marks pushes that may exceed the push limits
+type limitOverrideKey struct{}
+
+// WithLimitOverride returns a context in which pushes and draft uploads that exceed the
+// push limits are accepted with a warning in the log
+func WithLimitOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, limitOverrideKey{}, true)
+}
+
+// limitsOverridden reports whether pushes in ctx may exceed the push limits
+func limitsOverridden(ctx context.Context) bool {
+	overridden, _ := ctx.Value(limitOverrideKey{}).(bool)
+	return overridden
+}
+
+// checkLimits fails with a *LimitError when the bundle exceeds the push limits, unless
+// ctx overrides them
+func (s *Service) checkLimits(ctx context.Context, zipReader *zip.Reader) error {
+	violations := limitViolations(s.limits, zipReader)
+	if len(violations) == 0 {
+		return nil
+	}
+	err := &LimitError{Violations: violations}
+	if limitsOverridden(ctx) {
+		s.log.Warn("Accepting app bundle beyond push limits on override", "user", contextActor(ctx), "error", err)
+		return nil
+	}
+	return err
+}
+
+// limitViolations measures a validated bundle against limits
+func limitViolations(limits Limits, zipReader *zip.Reader) []LimitViolation {
+	var violations []LimitViolation
+
+	if limits.MaxBytes > 0 {
+		var total int64
+		var files []BundleFileSize
+		for _, file := range zipReader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			size := int64(file.UncompressedSize64)
+			total += size
+			files = append(files, BundleFileSize{Path: file.Name, Size: size})
+		}
+		if total > limits.MaxBytes {
+			sort.SliceStable(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+			if len(files) > largestFilesReported {
+				files = files[:largestFilesReported]
+			}
+			violations = append(violations, LimitViolation{Limit: LimitMaxBytes, Max: limits.MaxBytes, Actual: total, Largest: files})
+		}
+	}
+
+	if limits.MaxForms > 0 {
+		forms := make(map[string]bool)
+		for _, file := range zipReader.File {
+			if strings.HasSuffix(file.Name, "/schema.json") {
+				if name := getFormNameFromSchemaPath(file.Name); name != "" {
+					forms[name] = true
+				}
+			}
+		}
+		if len(forms) > limits.MaxForms {
+			violations = append(violations, LimitViolation{Limit: LimitMaxForms, Max: int64(limits.MaxForms), Actual: int64(len(forms))})
+		}
+	}
+
+	if limits.MaxRenderers > 0 {
+		// The bundle is validated, so its renderer manifests parse
+		renderers, _ := collectRenderers(zipReader)
+		if len(renderers) > limits.MaxRenderers {
+			violations = append(violations, LimitViolation{Limit: LimitMaxRenderers, Max: int64(limits.MaxRenderers), Actual: int64(len(renderers))})
+		}
+	}
+
+	return violations
+}
+
+// formatMegabytes renders a size in megabytes with one decimal
+func formatMegabytes(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
@@ -0,0 +1,83 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitViolations(t *testing.T) {
+	buf, err := createTestZip(t, map[string]string{
+		"app/index.html":              "<html></html>",
+		"app/media/intro.mp4":         strings.Repeat("v", 4000),
+		"forms/a/schema.json":         `{"type":"object"}`,
+		"forms/a/ui.json":             `{"type":"VerticalLayout","elements":[]}`,
+		"forms/b/schema.json":         `{"type":"object"}`,
+		"forms/b/ui.json":             `{"type":"VerticalLayout","elements":[]}`,
+		"app/forms/c/schema.json":     `{"type":"object"}`,
+		"app/forms/c/ui.json":         `{"type":"VerticalLayout","elements":[]}`,
+		"renderers/map/renderer.jsx":  "export default 1",
+		"renderers/sign/renderer.jsx": "export default 2",
+	})
+	require.NoError(t, err)
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	assert.Empty(t, limitViolations(Limits{}, reader), "zero limits are disabled")
+	assert.Empty(t, limitViolations(Limits{MaxBytes: 1 << 20, MaxForms: 3, MaxRenderers: 2}, reader))
+
+	violations := limitViolations(Limits{MaxBytes: 1000, MaxForms: 2, MaxRenderers: 1}, reader)
+	require.Len(t, violations, 3)
+	assert.Equal(t, LimitMaxBytes, violations[0].Limit)
+	assert.Equal(t, int64(1000), violations[0].Max)
+	assert.Greater(t, violations[0].Actual, int64(4000))
+	require.Len(t, violations[0].Largest, largestFilesReported)
+	assert.Equal(t, BundleFileSize{Path: "app/media/intro.mp4", Size: 4000}, violations[0].Largest[0])
+	assert.Equal(t, LimitViolation{Limit: LimitMaxForms, Max: 2, Actual: 3}, violations[1])
+	assert.Equal(t, LimitViolation{Limit: LimitMaxRenderers, Max: 1, Actual: 2}, violations[2])
+
+	err = &LimitError{Violations: violations}
+	assert.ErrorIs(t, err, ErrBundleLimitExceeded)
+	assert.Contains(t, err.Error(), "(largest: app/media/intro.mp4 0.0 MB")
+	assert.Contains(t, err.Error(), "; 3 forms, the limit is 2; 2 custom renderers, the limit is 1")
+}
+
+func TestPushBundleLimits(t *testing.T) {
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+		limits:       Limits{MaxForms: 1},
+	}
+	buf, err := createTestZip(t, map[string]string{
+		"app/index.html":      "<html></html>",
+		"forms/a/schema.json": `{"type":"object"}`,
+		"forms/a/ui.json":     `{"type":"VerticalLayout","elements":[]}`,
+		"forms/b/schema.json": `{"type":"object"}`,
+		"forms/b/ui.json":     `{"type":"VerticalLayout","elements":[]}`,
+	})
+	require.NoError(t, err)
+
+	_, err = service.PushBundle(context.Background(), bytes.NewReader(buf.Bytes()))
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, []LimitViolation{{Limit: LimitMaxForms, Max: 1, Actual: 2}}, limitErr.Violations)
+
+	_, err = service.PushDraft(context.Background(), bytes.NewReader(buf.Bytes()))
+	require.ErrorIs(t, err, ErrBundleLimitExceeded)
+
+	versions, err := service.GetVersions(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, versions, "rejected pushes must not create a version")
+
+	manifest, err := service.PushBundle(WithLimitOverride(context.Background()), bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "0001", manifest.Version)
+}
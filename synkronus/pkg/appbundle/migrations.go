@@ -0,0 +1,170 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoMigrationPath is returned when a bundle's migration scripts don't lead from a form
+// version to the form's current version
+var ErrNoMigrationPath = errors.New("no migration path")
+
+// MigrationInfo describes a data migration script shipped with a form. The script at Path
+// transforms observation data of form version From into form version To. It is a
+// CommonJS module exporting `function migrate(data, observation)` that returns the new data.
+type MigrationInfo struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Path string `json:"path"` // Path within the bundle, downloadable like any other bundle file
+	Hash string `json:"hash"` // SHA-256 of the script
+}
+
+// parseMigrationPath recognizes forms/{form}/migrations/{file} and
+// app/forms/{form}/migrations/{file}, returning the form name and file name
+func parseMigrationPath(path string) (formName, fileName string, ok bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 4 && parts[0] == "forms" && parts[2] == "migrations" {
+		return parts[1], parts[3], true
+	}
+	if len(parts) == 5 && parts[0] == "app" && parts[1] == "forms" && parts[3] == "migrations" {
+		return parts[2], parts[4], true
+	}
+	return "", "", false
+}
+
+// parseMigrationFileName splits {from}_{to}.js into its versions
+func parseMigrationFileName(name string) (from, to string, err error) {
+	base, ok := strings.CutSuffix(name, ".js")
+	if !ok {
+		return "", "", fmt.Errorf("migration script %s must be named {from}_{to}.js", name)
+	}
+	parts := strings.Split(base, "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("migration script %s must be named {from}_{to}.js", name)
+	}
+	if parts[0] == parts[1] {
+		return "", "", fmt.Errorf("migration script %s migrates a version to itself", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// collectMigrations returns each form's migration scripts ordered by From. Every version
+// may be migrated from at most once, so the path from an old version is unambiguous.
+func collectMigrations(zipReader *zip.Reader) (map[string][]MigrationInfo, error) {
+	migrations := make(map[string][]MigrationInfo)
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		formName, fileName, ok := parseMigrationPath(file.Name)
+		if !ok {
+			continue
+		}
+		from, to, err := parseMigrationFileName(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFormStructure, file.Name, err)
+		}
+		for _, existing := range migrations[formName] {
+			if existing.From == from {
+				return nil, fmt.Errorf("%w: form '%s' has more than one migration from version %s (%s and %s)",
+					ErrInvalidFormStructure, formName, from, existing.Path, file.Name)
+			}
+		}
+
+		script, err := readZipFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration script %s: %w", file.Name, err)
+		}
+		sum := sha256.Sum256(script)
+		migrations[formName] = append(migrations[formName], MigrationInfo{
+			From: from,
+			To:   to,
+			Path: file.Name,
+			Hash: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	for formName, scripts := range migrations {
+		sort.Slice(scripts, func(i, j int) bool { return scripts[i].From < scripts[j].From })
+		// A cycle would make clients and the server migrate forever
+		for _, script := range scripts {
+			if _, err := followMigrations(scripts, script.From, ""); err != nil {
+				return nil, fmt.Errorf("%w: form '%s': %v", ErrInvalidFormStructure, formName, err)
+			}
+		}
+	}
+	return migrations, nil
+}
+
+// validateMigrationScripts checks that migration scripts are well named, belong to a form
+// of the bundle and lead from each old version to exactly one newer one
+func (s *Service) validateMigrationScripts(zipReader *zip.Reader, formDirs map[string]struct{}) error {
+	migrations, err := collectMigrations(zipReader)
+	if err != nil {
+		return err
+	}
+	for formName := range migrations {
+		if _, ok := formDirs[formName]; !ok {
+			return fmt.Errorf("%w: migration scripts for unknown form '%s'", ErrInvalidFormStructure, formName)
+		}
+	}
+	return nil
+}
+
+// followMigrations chains scripts from version from until version to, or until no script
+// continues the chain when to is empty
+func followMigrations(scripts []MigrationInfo, from, to string) ([]MigrationInfo, error) {
+	next := make(map[string]MigrationInfo, len(scripts))
+	for _, script := range scripts {
+		next[script.From] = script
+	}
+
+	chain := []MigrationInfo{}
+	visited := map[string]bool{from: true}
+	for version := from; version != to; {
+		script, ok := next[version]
+		if !ok {
+			if to == "" {
+				break
+			}
+			return nil, fmt.Errorf("%w from version %s to %s", ErrNoMigrationPath, from, to)
+		}
+		if visited[script.To] {
+			return nil, fmt.Errorf("migrations from version %s loop back to version %s", from, script.To)
+		}
+		visited[script.To] = true
+		chain = append(chain, script)
+		version = script.To
+	}
+	return chain, nil
+}
+
+// MigrationChain returns the scripts that migrate observation data of version from to the
+// form's current version, in the order they run. It is empty when from is current.
+func (f FormInfo) MigrationChain(from string) ([]MigrationInfo, error) {
+	if from == f.Version {
+		return []MigrationInfo{}, nil
+	}
+	if f.Version == "" {
+		return nil, fmt.Errorf("%w: the form schema declares no version", ErrNoMigrationPath)
+	}
+	return followMigrations(f.Migrations, from, f.Version)
+}
+
+// SchemaVersion returns the version a form schema declares; a numeric version is formatted
+// in its shortest form, e.g. 2 rather than 2.0
+func SchemaVersion(schema map[string]any) string {
+	switch v := schema["version"].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
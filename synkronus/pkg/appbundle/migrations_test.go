@@ -0,0 +1,145 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBundleStructure_MigrationScripts(t *testing.T) {
+	base := func(extra map[string]string) map[string]string {
+		files := map[string]string{
+			"app/index.html":           "<html></html>",
+			"forms/survey/schema.json": `{"version": "3", "properties": {}}`,
+			"forms/survey/ui.json":     "{}",
+		}
+		for name, content := range extra {
+			files[name] = content
+		}
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "chain of scripts",
+			files: base(map[string]string{
+				"forms/survey/migrations/1_2.js": "module.exports = d => d",
+				"forms/survey/migrations/2_3.js": "module.exports = d => d",
+			}),
+		},
+		{
+			name: "AnthroCollect-style form",
+			files: map[string]string{
+				"app/index.html":                     "<html></html>",
+				"app/forms/survey/schema.json":       `{"version": "2"}`,
+				"app/forms/survey/ui.json":           "{}",
+				"app/forms/survey/migrations/1_2.js": "module.exports = d => d",
+			},
+		},
+		{
+			name:    "badly named script",
+			files:   base(map[string]string{"forms/survey/migrations/1-2.js": ""}),
+			wantErr: "must be named {from}_{to}.js",
+		},
+		{
+			name:    "not a script",
+			files:   base(map[string]string{"forms/survey/migrations/1_2.ts": ""}),
+			wantErr: "must be named {from}_{to}.js",
+		},
+		{
+			name:    "migration to the same version",
+			files:   base(map[string]string{"forms/survey/migrations/2_2.js": ""}),
+			wantErr: "migrates a version to itself",
+		},
+		{
+			name: "two migrations from one version",
+			files: base(map[string]string{
+				"forms/survey/migrations/1_2.js": "",
+				"forms/survey/migrations/1_3.js": "",
+			}),
+			wantErr: "more than one migration from version 1",
+		},
+		{
+			name: "cycle",
+			files: base(map[string]string{
+				"forms/survey/migrations/1_2.js": "",
+				"forms/survey/migrations/2_1.js": "",
+			}),
+			wantErr: "loop back",
+		},
+		{
+			name: "unknown form",
+			files: map[string]string{
+				"app/index.html":                    "<html></html>",
+				"app/forms/other/migrations/1_2.js": "",
+			},
+			wantErr: "unknown form 'other'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := createTestZip(t, tt.files)
+			require.NoError(t, err)
+			zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			s := &Service{coreFieldHashes: make(map[string]string)}
+			err = s.validateBundleStructure(zipReader)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidFormStructure), "expected ErrInvalidFormStructure, got %v", err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestGenerateAppInfo_Migrations(t *testing.T) {
+	s := &Service{coreFieldHashes: make(map[string]string), coreFieldMutex: sync.RWMutex{}}
+	zipReader := createAppInfoTestZip(t, map[string]string{
+		"forms/survey/schema.json":       `{"version": 3, "properties": {}}`,
+		"forms/survey/ui.json":           "{}",
+		"forms/survey/migrations/2_3.js": "module.exports = d => d",
+		"forms/survey/migrations/1_2.js": "module.exports = d => d",
+	})
+
+	data, err := s.generateAppInfo(zipReader, "7")
+	require.NoError(t, err)
+	var info AppInfo
+	require.NoError(t, json.Unmarshal(data, &info))
+
+	form := info.Forms["survey"]
+	assert.Equal(t, "3", form.Version)
+	require.Len(t, form.Migrations, 2)
+	first := form.Migrations[0]
+	assert.Equal(t, "1", first.From)
+	assert.Equal(t, "2", first.To)
+	assert.Equal(t, "forms/survey/migrations/1_2.js", first.Path)
+	assert.Len(t, first.Hash, 64)
+
+	chain, err := form.MigrationChain("1")
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, "2", chain[0].To)
+	assert.Equal(t, "3", chain[1].To)
+
+	chain, err = form.MigrationChain("3")
+	require.NoError(t, err)
+	assert.Empty(t, chain)
+
+	_, err = form.MigrationChain("0")
+	assert.ErrorIs(t, err, ErrNoMigrationPath)
+}
@@ -0,0 +1,180 @@
+package appbundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// ErrPushInProgress is returned when another push, draft upload or promotion holds
+// the push lock
+var ErrPushInProgress = errors.New("another app bundle push is in progress")
+
+// defaultPushRetryAfter is suggested to rejected pushes before any push has completed
+const defaultPushRetryAfter = 5 * time.Second
+
+// Push lock operations
+const (
+	PushOperationPush    = "push"
+	PushOperationDraft   = "draft"
+	PushOperationPromote = "promote"
+)
+
+// PushStatus describes the push holding the push lock, if any
+type PushStatus struct {
+	Locked            bool       `json:"locked"`
+	Operation         string     `json:"operation,omitempty"`
+	User              string     `json:"user,omitempty"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	Waiting           int        `json:"waiting"`                       // Pushes queued behind the holder
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"` // Estimated time until the lock is free
+}
+
+// PushInProgressError is returned when a push gives up waiting for the push lock
+type PushInProgressError struct {
+	Status     PushStatus
+	RetryAfter time.Duration
+}
+
+func (e *PushInProgressError) Error() string {
+	if e.Status.User == "" {
+		return fmt.Sprintf("%s (%s)", ErrPushInProgress, e.Status.Operation)
+	}
+	return fmt.Sprintf("%s (%s by %s)", ErrPushInProgress, e.Status.Operation, e.Status.User)
+}
+
+// Is makes errors.Is(err, ErrPushInProgress) match
+func (e *PushInProgressError) Is(target error) bool {
+	return target == ErrPushInProgress
+}
+
+// pushWaitKey carries how long a push may queue for the push lock
+type pushWaitKey struct{}
+
+// WithPushWait returns a context in which pushes wait up to d for a running push to
+// finish instead of failing with ErrPushInProgress straight away
+func WithPushWait(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, pushWaitKey{}, d)
+}
+
+// pushWait returns the wait set with WithPushWait
+func pushWait(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(pushWaitKey{}).(time.Duration)
+	return d
+}
+
+// pushLock serializes pushes, draft uploads and promotions so two admins can't
+// interleave version numbering or overwrite each other's draft. Its zero value is
+// unlocked.
+type pushLock struct {
+	mu           sync.Mutex
+	holder       *PushStatus
+	waiting      int
+	released     chan struct{} // closed and replaced whenever the lock is released
+	lastDuration time.Duration // how long the last push held the lock
+}
+
+// acquire takes the lock for operation, waiting up to wait for the current holder.
+// Waiters are woken together on release, so the queue is not strictly first come,
+// first served.
+func (l *pushLock) acquire(ctx context.Context, operation string, wait time.Duration) (func(), error) {
+	status := &PushStatus{Locked: true, Operation: operation}
+	if user := authmw.GetUserFromContext(ctx); user != nil {
+		status.User = user.Username
+	}
+	deadline := time.Now().Add(wait)
+
+	l.mu.Lock()
+	for l.holder != nil {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			current := l.statusLocked()
+			l.mu.Unlock()
+			return nil, &PushInProgressError{
+				Status:     current,
+				RetryAfter: time.Duration(current.RetryAfterSeconds) * time.Second,
+			}
+		}
+		if l.released == nil {
+			l.released = make(chan struct{})
+		}
+		released := l.released
+		l.waiting++
+		l.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-released:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+
+		l.mu.Lock()
+		l.waiting--
+		if err := ctx.Err(); err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+	}
+	startedAt := time.Now().UTC()
+	status.StartedAt = &startedAt
+	l.holder = status
+	l.mu.Unlock()
+
+	return l.release, nil
+}
+
+// release frees the lock and wakes every waiter
+func (l *pushLock) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.holder != nil {
+		l.lastDuration = time.Since(*l.holder.StartedAt)
+	}
+	l.holder = nil
+	if l.released != nil {
+		close(l.released)
+		l.released = nil
+	}
+}
+
+// status returns a snapshot of the lock
+func (l *pushLock) status() PushStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.statusLocked()
+}
+
+// statusLocked returns a snapshot of the lock. The caller must hold mu.
+func (l *pushLock) statusLocked() PushStatus {
+	if l.holder == nil {
+		return PushStatus{}
+	}
+	status := *l.holder
+	status.Waiting = l.waiting
+
+	// Estimate from the last push: what's left of the current one plus one full push
+	// for everyone already queued
+	retryAfter := defaultPushRetryAfter
+	if l.lastDuration > 0 {
+		retryAfter = l.lastDuration - time.Since(*status.StartedAt)
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		retryAfter += time.Duration(l.waiting) * l.lastDuration
+	}
+	status.RetryAfterSeconds = int((retryAfter + time.Second - 1) / time.Second)
+	return status
+}
+
+// GetPushStatus reports the push holding the push lock, if any
+func (s *Service) GetPushStatus(ctx context.Context) (*PushStatus, error) {
+	status := s.pushLock.status()
+	return &status, nil
+}
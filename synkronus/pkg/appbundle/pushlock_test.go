@@ -0,0 +1,82 @@
+package appbundle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushLockRejectsConcurrentPush(t *testing.T) {
+	var lock pushLock
+	admin := &models.User{ID: uuid.New(), Username: "alice", Role: models.RoleAdmin}
+	ctx := context.WithValue(context.Background(), authmw.UserKey, admin)
+
+	release, err := lock.acquire(ctx, PushOperationPush, 0)
+	require.NoError(t, err)
+
+	status := lock.status()
+	assert.True(t, status.Locked)
+	assert.Equal(t, PushOperationPush, status.Operation)
+	assert.Equal(t, "alice", status.User)
+	assert.Equal(t, int(defaultPushRetryAfter/time.Second), status.RetryAfterSeconds)
+
+	_, err = lock.acquire(context.Background(), PushOperationPromote, 0)
+	require.ErrorIs(t, err, ErrPushInProgress)
+	var inProgress *PushInProgressError
+	require.True(t, errors.As(err, &inProgress))
+	assert.Equal(t, "alice", inProgress.Status.User)
+	assert.Equal(t, defaultPushRetryAfter, inProgress.RetryAfter)
+
+	release()
+	assert.False(t, lock.status().Locked)
+
+	release, err = lock.acquire(context.Background(), PushOperationPromote, 0)
+	require.NoError(t, err)
+	release()
+}
+
+func TestPushLockQueuesWaitingPush(t *testing.T) {
+	var lock pushLock
+	release, err := lock.acquire(context.Background(), PushOperationDraft, 0)
+	require.NoError(t, err)
+
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := lock.acquire(context.Background(), PushOperationPromote, 5*time.Second)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	require.Eventually(t, func() bool { return lock.status().Waiting == 1 }, time.Second, 5*time.Millisecond)
+	release()
+
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued push did not get the lock")
+	}
+	assert.False(t, lock.status().Locked)
+}
+
+func TestPushLockWaitEndsWithContext(t *testing.T) {
+	var lock pushLock
+	release, err := lock.acquire(context.Background(), PushOperationPush, 0)
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = lock.acquire(ctx, PushOperationPush, time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, lock.status().Waiting)
+}
@@ -0,0 +1,120 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// HostAppVersionHeader is the request header in which clients declare the version of the
+// host app (e.g. Formulus) that runs the bundle's renderers
+const HostAppVersionHeader = "X-Host-App-Version"
+
+// RendererInfo describes a custom renderer, from the optional renderer.json manifest next to
+// its renderer.jsx:
+//
+//	{"version": "1.2.0", "min_host_version": "2.1.0"}
+type RendererInfo struct {
+	Version string `json:"version,omitempty"`
+	// MinHostVersion is the oldest host app version that can run the renderer
+	MinHostVersion string `json:"min_host_version,omitempty"`
+}
+
+// RendererWarning reports a renderer that requires a newer host app than the client has
+type RendererWarning struct {
+	Renderer       string `json:"renderer"`
+	Version        string `json:"version,omitempty"`
+	MinHostVersion string `json:"minHostVersion"`
+	Message        string `json:"message"`
+}
+
+// parseRendererPath recognizes renderers/{renderer}/{file}, returning the renderer and file name
+func parseRendererPath(path string) (renderer, fileName string, ok bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] != "renderers" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// ValidHostVersion reports whether version is a semantic version such as 2.1.0 or v2.1
+func ValidHostVersion(version string) bool {
+	return semver.IsValid(canonicalVersion(version))
+}
+
+// canonicalVersion adds the "v" prefix the semver package expects
+func canonicalVersion(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// collectRenderers returns every custom renderer of the bundle with its renderer.json
+// details, failing for invalid manifests and manifests without a renderer.jsx
+func collectRenderers(zipReader *zip.Reader) (map[string]RendererInfo, error) {
+	renderers := make(map[string]RendererInfo)
+	manifests := make(map[string]RendererInfo)
+
+	for _, file := range zipReader.File {
+		name, fileName, ok := parseRendererPath(file.Name)
+		if !ok {
+			continue
+		}
+		switch fileName {
+		case "renderer.jsx":
+			if _, exists := renderers[name]; !exists {
+				renderers[name] = RendererInfo{}
+			}
+		case "renderer.json":
+			data, err := readZipFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+			}
+			var info RendererInfo
+			if err := json.Unmarshal(data, &info); err != nil {
+				return nil, fmt.Errorf("%w: invalid JSON in %s: %v", ErrInvalidCellStructure, file.Name, err)
+			}
+			if info.Version != "" && !ValidHostVersion(info.Version) {
+				return nil, fmt.Errorf("%w: %s: version %q is not a semantic version", ErrInvalidCellStructure, file.Name, info.Version)
+			}
+			if info.MinHostVersion != "" && !ValidHostVersion(info.MinHostVersion) {
+				return nil, fmt.Errorf("%w: %s: min_host_version %q is not a semantic version", ErrInvalidCellStructure, file.Name, info.MinHostVersion)
+			}
+			manifests[name] = info
+		}
+	}
+
+	for name, info := range manifests {
+		if _, ok := renderers[name]; !ok {
+			return nil, fmt.Errorf("%w: renderers/%s/renderer.json has no renderer.jsx", ErrInvalidCellStructure, name)
+		}
+		renderers[name] = info
+	}
+	return renderers, nil
+}
+
+// IncompatibleRenderers returns the renderers that require a newer host app than
+// hostVersion, sorted by name. Renderers without a min_host_version run on any host.
+func (a *AppInfo) IncompatibleRenderers(hostVersion string) []RendererWarning {
+	host := canonicalVersion(hostVersion)
+	warnings := []RendererWarning{}
+	for name, renderer := range a.Renderers {
+		if renderer.MinHostVersion == "" || semver.Compare(host, canonicalVersion(renderer.MinHostVersion)) >= 0 {
+			continue
+		}
+		warnings = append(warnings, RendererWarning{
+			Renderer:       name,
+			Version:        renderer.Version,
+			MinHostVersion: renderer.MinHostVersion,
+			Message: fmt.Sprintf("Renderer %s requires app version %s or newer (this app is %s); update the app to use forms with it",
+				name, renderer.MinHostVersion, hostVersion),
+		})
+	}
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Renderer < warnings[j].Renderer })
+	return warnings
+}
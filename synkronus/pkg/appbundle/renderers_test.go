@@ -0,0 +1,131 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBundleStructure_RendererManifests(t *testing.T) {
+	base := func(extra map[string]string) map[string]string {
+		files := map[string]string{
+			"app/index.html":                   "<html></html>",
+			"renderers/signature/renderer.jsx": "export default () => null",
+		}
+		for name, content := range extra {
+			files[name] = content
+		}
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{name: "without manifest", files: base(nil)},
+		{
+			name:  "with manifest",
+			files: base(map[string]string{"renderers/signature/renderer.json": `{"version": "1.2.0", "min_host_version": "2.1"}`}),
+		},
+		{
+			name:    "invalid JSON",
+			files:   base(map[string]string{"renderers/signature/renderer.json": `{"version": `}),
+			wantErr: "invalid JSON",
+		},
+		{
+			name:    "invalid version",
+			files:   base(map[string]string{"renderers/signature/renderer.json": `{"min_host_version": "two"}`}),
+			wantErr: "is not a semantic version",
+		},
+		{
+			name:    "manifest without renderer",
+			files:   base(map[string]string{"renderers/gps/renderer.json": `{"version": "1.0.0"}`}),
+			wantErr: "has no renderer.jsx",
+		},
+		{
+			name:    "other file",
+			files:   base(map[string]string{"renderers/signature/README.md": "docs"}),
+			wantErr: "invalid renderer file path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := createTestZip(t, tt.files)
+			require.NoError(t, err)
+			zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			s := &Service{coreFieldHashes: make(map[string]string)}
+			err = s.validateBundleStructure(zipReader)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidCellStructure), "expected ErrInvalidCellStructure, got %v", err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestGenerateAppInfo_Renderers(t *testing.T) {
+	s := &Service{coreFieldHashes: make(map[string]string), coreFieldMutex: sync.RWMutex{}}
+	zipReader := createAppInfoTestZip(t, map[string]string{
+		"renderers/signature/renderer.jsx":  "export default () => null",
+		"renderers/signature/renderer.json": `{"version": "1.2.0", "min_host_version": "2.1.0"}`,
+		"renderers/gps/renderer.jsx":        "export default () => null",
+	})
+
+	data, err := s.generateAppInfo(zipReader, "7")
+	require.NoError(t, err)
+	var info AppInfo
+	require.NoError(t, json.Unmarshal(data, &info))
+
+	assert.Equal(t, map[string]RendererInfo{
+		"signature": {Version: "1.2.0", MinHostVersion: "2.1.0"},
+		"gps":       {},
+	}, info.Renderers)
+}
+
+func TestIncompatibleRenderers(t *testing.T) {
+	info := &AppInfo{Renderers: map[string]RendererInfo{
+		"signature": {Version: "1.2.0", MinHostVersion: "2.1.0"},
+		"audio":     {Version: "3.0.0", MinHostVersion: "v2.4"},
+		"gps":       {},
+	}}
+
+	warnings := info.IncompatibleRenderers("2.0.9")
+	require.Len(t, warnings, 2)
+	assert.Equal(t, "audio", warnings[0].Renderer)
+	assert.Equal(t, "signature", warnings[1].Renderer)
+	assert.Equal(t, "2.1.0", warnings[1].MinHostVersion)
+	assert.Contains(t, warnings[1].Message, "2.0.9")
+
+	warnings = info.IncompatibleRenderers("2.2.0")
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "audio", warnings[0].Renderer)
+
+	assert.Empty(t, info.IncompatibleRenderers("v2.4.0"))
+	assert.Empty(t, (&AppInfo{}).IncompatibleRenderers("1.0.0"))
+}
+
+func TestValidHostVersion(t *testing.T) {
+	for version, want := range map[string]bool{
+		"2.1.0":      true,
+		"v2.1":       true,
+		"2.1.0-rc.1": true,
+		"":           false,
+		"2.1.0 (42)": false,
+		"latest":     false,
+	} {
+		assert.Equal(t, want, ValidHostVersion(version), version)
+	}
+}
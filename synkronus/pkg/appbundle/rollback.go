@@ -0,0 +1,128 @@
+package appbundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoRollbackTarget is returned when no released version is older than the active one
+var ErrNoRollbackTarget = errors.New("no earlier app bundle version to roll back to")
+
+// ErrRollbackUnhealthy is returned when the manifest of the rolled back version fails to
+// regenerate; the version that was active is restored
+var ErrRollbackUnhealthy = errors.New("rolled back app bundle version failed the health check")
+
+// RollbackResult describes a rollback and the manifest that passed the health check
+type RollbackResult struct {
+	FromVersion  string `json:"from_version"`
+	ToVersion    string `json:"to_version"`
+	ManifestHash string `json:"manifest_hash"`
+	FileCount    int    `json:"file_count"`
+}
+
+// RollbackVersion switches to the newest released version older than the active one,
+// replacing any scheduled switch. The manifest of that version is then regenerated; if it
+// fails, or doesn't serve app/index.html, the version that was active is restored.
+func (s *Service) RollbackVersion(ctx context.Context) (*RollbackResult, error) {
+	from, to, err := s.switchToPrevious(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// generateManifest reads the schedule, so this runs after switchToPrevious unlocks it
+	manifest, err := s.regenerateHealthyManifest()
+	if err != nil {
+		s.log.Error("Rolled back app bundle version failed the health check", "version", to, "error", err)
+		if restoreErr := s.restoreAfterRollback(ctx, from, to); restoreErr != nil {
+			return nil, fmt.Errorf("%w: %v; restoring version %s failed: %v", ErrRollbackUnhealthy, err, from, restoreErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRollbackUnhealthy, err)
+	}
+	s.manifest = manifest
+
+	s.recordChange(ctx, ChangeActionRollback, contextActor(ctx), from, to)
+	s.log.Info("Rolled back app bundle version", "from", from, "to", to, "user", contextActor(ctx))
+	return &RollbackResult{
+		FromVersion:  from,
+		ToVersion:    to,
+		ManifestHash: manifest.Hash,
+		FileCount:    len(manifest.Files),
+	}, nil
+}
+
+// switchToPrevious activates the newest released version older than the active one and
+// returns both versions
+func (s *Service) switchToPrevious(ctx context.Context) (from, to string, err error) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	from, err = s.getCurrentVersion()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get current version: %w", err)
+	}
+	if from == "" {
+		return "", "", ErrNoRollbackTarget
+	}
+	if to, err = s.previousReleasedVersion(ctx, from); err != nil {
+		return "", "", err
+	}
+	if err := s.switchVersion(ctx, to); err != nil {
+		return "", "", err
+	}
+	if err := s.clearScheduledSwitch(); err != nil {
+		s.log.Error("Failed to clear scheduled app bundle switch", "error", err)
+	}
+	return from, to, nil
+}
+
+// previousReleasedVersion returns the newest released version older than version
+func (s *Service) previousReleasedVersion(ctx context.Context, version string) (string, error) {
+	versions, err := s.GetVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Versions are listed newest first
+	for _, candidate := range versions {
+		candidate = strings.TrimSuffix(candidate, " *")
+		if candidate >= version {
+			continue
+		}
+		if s.checkVersionReleased(candidate) == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: version %s is the oldest released version", ErrNoRollbackTarget, version)
+}
+
+// regenerateHealthyManifest regenerates the manifest of the active bundle, which must
+// serve app/index.html
+func (s *Service) regenerateHealthyManifest() (*Manifest, error) {
+	manifest, err := s.generateManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range manifest.Files {
+		if file.Path == "app/index.html" {
+			return manifest, nil
+		}
+	}
+	return nil, fmt.Errorf("manifest of version %s has no app/index.html", manifest.Version)
+}
+
+// restoreAfterRollback switches back to from, unless another switch replaced the rolled
+// back version in the meantime
+func (s *Service) restoreAfterRollback(ctx context.Context, from, to string) error {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	current, err := s.getCurrentVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get current version: %w", err)
+	}
+	if current != to {
+		return nil
+	}
+	return s.switchVersion(ctx, from)
+}
@@ -0,0 +1,78 @@
+package appbundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackVersion(t *testing.T) {
+	history := &memoryChangeHistory{}
+	service := NewService(Config{BundlePath: t.TempDir(), VersionsPath: t.TempDir(), MaxVersions: 5, History: history}, logger.NewLogger())
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "alice"})
+	_, err = service.RollbackVersion(ctx)
+	require.ErrorIs(t, err, ErrNoRollbackTarget, "nothing is active before the first push")
+
+	for i := 0; i < 4; i++ {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		_, err = service.PushBundle(ctx, f)
+		f.Close()
+		require.NoError(t, err)
+	}
+	require.NoError(t, service.SwitchVersion(ctx, "0004"))
+	require.NoError(t, service.SetVersionInternal(ctx, "0003", true))
+	require.NoError(t, service.ScheduleSwitch(ctx, "0001", time.Now().Add(time.Hour)))
+
+	// Internal versions are skipped and the pending switch is dropped
+	result, err := service.RollbackVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0004", result.FromVersion)
+	assert.Equal(t, "0002", result.ToVersion)
+	assert.NotEmpty(t, result.ManifestHash)
+	assert.Positive(t, result.FileCount)
+
+	manifest, err := service.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0002", manifest.Version)
+	assert.Equal(t, result.ManifestHash, manifest.Hash)
+	assert.Nil(t, manifest.Upcoming)
+	scheduled, err := service.GetScheduledSwitch(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, scheduled)
+
+	require.NotEmpty(t, history.entries)
+	assert.Equal(t, ChangeActionRollback, history.entries[0].Action)
+	assert.Equal(t, "0004", history.entries[0].FromVersion)
+	assert.Equal(t, "0002", history.entries[0].ToVersion)
+	assert.Equal(t, "alice", history.entries[0].Actor)
+
+	// A version whose manifest would not serve the app is not rolled back to
+	require.NoError(t, os.Remove(filepath.Join(service.versionsPath, "0001", "app", "index.html")))
+	_, err = service.RollbackVersion(ctx)
+	require.ErrorIs(t, err, ErrRollbackUnhealthy)
+	current, err := service.getCurrentVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "0002", current, "the active version is restored")
+	manifest, err = service.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0002", manifest.Version)
+	assert.Equal(t, "0002", history.entries[0].ToVersion, "failed rollbacks are not recorded as rollbacks")
+
+	require.NoError(t, service.SwitchVersion(ctx, "0001"))
+	_, err = service.RollbackVersion(ctx)
+	assert.ErrorIs(t, err, ErrNoRollbackTarget)
+}
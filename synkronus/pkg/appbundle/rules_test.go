@@ -0,0 +1,112 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintUIRules(t *testing.T) {
+	schema := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"consent": {"type": "boolean"},
+			"age": {"type": "integer"},
+			"village": {"type": "string", "enum": ["north", "south"]},
+			"notes": {"type": "string"},
+			"members": {
+				"type": "array",
+				"items": {"type": "object", "properties": {"sex": {"type": "string", "oneOf": [{"const": "f"}, {"const": "m"}]}, "pregnant": {"type": "boolean"}}}
+			}
+		}
+	}`), &schema))
+
+	rule := func(r string) map[string]any {
+		ui := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(`{"type": "VerticalLayout", "elements": [
+			{"type": "Control", "scope": "#/properties/notes", "rule": `+r+`}
+		]}`), &ui))
+		return ui
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		want []string
+	}{
+		{"const", `{"effect": "SHOW", "condition": {"scope": "#/properties/consent", "schema": {"const": true}}}`, nil},
+		{"enum", `{"effect": "HIDE", "condition": {"scope": "#/properties/village", "schema": {"enum": ["north"]}}}`, nil},
+		{"range", `{"effect": "ENABLE", "condition": {"scope": "#/properties/age", "schema": {"minimum": 18}}}`, nil},
+		{"compound", `{"effect": "SHOW", "condition": {"type": "AND", "conditions": [
+			{"scope": "#/properties/consent", "schema": {"const": true}},
+			{"scope": "#/properties/age", "schema": {"not": {"maximum": 17}}}
+		]}}`, nil},
+		{"unresolved scope is left to the scope lint", `{"effect": "SHOW", "condition": {"scope": "#/properties/nope", "schema": {"const": 1}}}`, nil},
+		{"effect", `{"effect": "show", "condition": {"scope": "#/properties/consent", "schema": {"const": true}}}`,
+			[]string{"rule on Control '#/properties/notes': effect show is not one of SHOW, HIDE, ENABLE and DISABLE"}},
+		{"missing schema", `{"effect": "SHOW", "condition": {"scope": "#/properties/consent"}}`,
+			[]string{"rule on Control '#/properties/notes': condition needs a scope and a schema object"}},
+		{"type mismatch", `{"effect": "SHOW", "condition": {"scope": "#/properties/consent", "schema": {"const": "yes"}}}`,
+			[]string{"rule on Control '#/properties/notes': const string \"yes\" can never match boolean field '#/properties/consent'"}},
+		{"fraction for integer", `{"effect": "SHOW", "condition": {"scope": "#/properties/age", "schema": {"enum": [18, 18.5]}}}`,
+			[]string{"rule on Control '#/properties/notes': enum value number 18.5 can never match integer field '#/properties/age'"}},
+		{"unknown enum value", `{"effect": "SHOW", "condition": {"scope": "#/properties/village", "schema": {"not": {"const": "east"}}}}`,
+			[]string{"rule on Control '#/properties/notes': const \"east\" is not one of the values of '#/properties/village'"}},
+		{"range on string", `{"effect": "SHOW", "condition": {"scope": "#/properties/notes", "schema": {"minimum": 3}}}`,
+			[]string{"rule on Control '#/properties/notes': minimum only applies to number or integer values but '#/properties/notes' is string"}},
+		{"empty compound", `{"effect": "SHOW", "condition": {"type": "OR", "conditions": []}}`,
+			[]string{"rule on Control '#/properties/notes': OR condition has no conditions"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, lintUIRules(schema, rule(tt.rule)))
+		})
+	}
+
+	t.Run("array details", func(t *testing.T) {
+		ui := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"type": "Control",
+			"scope": "#/properties/members",
+			"options": {"detail": {"type": "Group", "label": "Pregnancy", "elements": [
+				{"type": "Control", "scope": "#/properties/pregnant"}
+			], "rule": {"effect": "SHOW", "condition": {"scope": "#/properties/sex", "schema": {"const": "female"}}}}}
+		}`), &ui))
+		assert.Equal(t, []string{"rule on Group 'Pregnancy': const \"female\" is not one of the values of '#/properties/sex'"}, lintUIRules(schema, ui))
+	})
+
+	t.Run("x-visible-if", func(t *testing.T) {
+		ui := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(`{"type": "Control", "scope": "#/properties/notes", "x-visible-if": "consent == true"}`), &ui))
+		assert.Equal(t, []string{"Control '#/properties/notes': x-visible-if is not evaluated by devices, use a rule with a SHOW effect"}, lintUIRules(schema, ui))
+	})
+}
+
+func TestValidateFormUIRules(t *testing.T) {
+	bundle := func(ui string) *zip.Reader {
+		buf, err := createTestZip(t, map[string]string{
+			"app/index.html":         "<html></html>",
+			"forms/user/schema.json": `{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}}}`,
+			"forms/user/ui.json":     ui,
+		})
+		require.NoError(t, err)
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		return reader
+	}
+
+	s := &Service{}
+
+	assert.NoError(t, s.validateBundleStructure(bundle(`{"type":"Control","scope":"#/properties/name",
+		"rule":{"effect":"SHOW","condition":{"scope":"#/properties/age","schema":{"minimum":18}}}}`)))
+
+	err := s.validateBundleStructure(bundle(`{"type":"Control","scope":"#/properties/name",
+		"rule":{"effect":"SHOW","condition":{"scope":"#/properties/age","schema":{"const":"18"}}}}`))
+	require.ErrorIs(t, err, ErrInvalidUIRule)
+	assert.Contains(t, err.Error(), "form 'user': rule on Control '#/properties/name': const string \"18\" can never match integer field '#/properties/age'")
+}
@@ -0,0 +1,165 @@
+package appbundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// scheduledSwitchFile stores a pending version switch in the versions directory
+const scheduledSwitchFile = "SCHEDULED_SWITCH"
+
+// ScheduledSwitch is a version switch that takes effect at a cutover time
+type ScheduledSwitch struct {
+	Version     string    `json:"version"`
+	EffectiveAt time.Time `json:"effective_at"`
+	// ScheduledBy is the user who scheduled the switch, recorded as the actor of the
+	// version change
+	ScheduledBy string `json:"scheduled_by,omitempty"`
+}
+
+// ScheduleSwitch activates version at effectiveAt. Until then the manifest advertises
+// the version as upcoming so clients can download it ahead of the cutover. A time that
+// is not in the future switches immediately; scheduling again replaces the pending switch.
+func (s *Service) ScheduleSwitch(ctx context.Context, version string, effectiveAt time.Time) error {
+	if !effectiveAt.After(time.Now()) {
+		return s.SwitchVersion(ctx, version)
+	}
+
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	if err := s.checkVersionExists(version); err != nil {
+		return err
+	}
+	if err := s.checkVersionReleased(version); err != nil {
+		return err
+	}
+
+	scheduled := &ScheduledSwitch{Version: version, EffectiveAt: effectiveAt.UTC(), ScheduledBy: contextActor(ctx)}
+	data, err := json.Marshal(scheduled)
+	if err != nil {
+		return fmt.Errorf("failed to encode scheduled switch: %w", err)
+	}
+
+	path := filepath.Join(s.versionsPath, scheduledSwitchFile)
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scheduled switch: %w", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to save scheduled switch: %w", err)
+	}
+
+	s.scheduled = scheduled
+	s.manifest = nil // Force regeneration so the manifest advertises the upcoming version
+
+	s.log.Info("Scheduled app bundle version switch", "version", version, "effectiveAt", scheduled.EffectiveAt)
+	return nil
+}
+
+// GetScheduledSwitch returns the pending version switch, or nil if none is scheduled
+func (s *Service) GetScheduledSwitch(_ context.Context) (*ScheduledSwitch, error) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	if s.scheduled == nil {
+		return nil, nil
+	}
+	scheduled := *s.scheduled
+	return &scheduled, nil
+}
+
+// loadScheduledSwitch restores a pending switch saved before a restart
+func (s *Service) loadScheduledSwitch() error {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.versionsPath, scheduledSwitchFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read scheduled switch: %w", err)
+	}
+
+	var scheduled ScheduledSwitch
+	if err := json.Unmarshal(data, &scheduled); err != nil {
+		return fmt.Errorf("failed to parse scheduled switch: %w", err)
+	}
+	s.scheduled = &scheduled
+	return nil
+}
+
+// clearScheduledSwitch drops the pending switch. The caller must hold scheduleMutex.
+func (s *Service) clearScheduledSwitch() error {
+	if err := os.Remove(filepath.Join(s.versionsPath, scheduledSwitchFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove scheduled switch: %w", err)
+	}
+	if s.scheduled != nil {
+		s.scheduled = nil
+		s.manifest = nil
+	}
+	return nil
+}
+
+// applyDueSwitch activates the scheduled version once its cutover time has passed
+func (s *Service) applyDueSwitch(ctx context.Context) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	if s.scheduled == nil || time.Now().Before(s.scheduled.EffectiveAt) {
+		return
+	}
+
+	version, actor := s.scheduled.Version, s.scheduled.ScheduledBy
+	previous, err := s.getCurrentVersion()
+	if err != nil {
+		s.log.Error("Failed to apply scheduled app bundle switch", "version", version, "error", err)
+		return
+	}
+	if err := s.switchVersion(ctx, version); err != nil {
+		// Keep the schedule so the switch is retried on the next request
+		s.log.Error("Failed to apply scheduled app bundle switch", "version", version, "error", err)
+		return
+	}
+	if err := s.clearScheduledSwitch(); err != nil {
+		s.log.Error("Failed to clear scheduled app bundle switch", "version", version, "error", err)
+	}
+	s.recordChange(ctx, ChangeActionScheduledSwitch, actor, previous, version)
+}
+
+// scheduledVersion returns the version of the pending switch, if any
+func (s *Service) scheduledVersion() string {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	if s.scheduled == nil {
+		return ""
+	}
+	return s.scheduled.Version
+}
+
+// checkVersionExists returns an error unless version is a numbered version on disk
+func (s *Service) checkVersionExists(version string) error {
+	// The draft must be promoted before it can be activated
+	if version == DraftVersion || version == "" || filepath.Base(version) != version {
+		return fmt.Errorf("version %s does not exist", version)
+	}
+
+	info, err := os.Stat(filepath.Join(s.versionsPath, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("version %s does not exist", version)
+		}
+		return fmt.Errorf("failed to stat version directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("version %s does not exist", version)
+	}
+	return nil
+}
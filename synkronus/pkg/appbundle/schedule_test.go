@@ -0,0 +1,93 @@
+package appbundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleSwitch(t *testing.T) {
+	ctx := context.Background()
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+	}
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	push := func() {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = service.PushBundle(ctx, f)
+		require.NoError(t, err)
+	}
+	push()
+	push()
+	require.NoError(t, service.SwitchVersion(ctx, "0001"))
+
+	// Unknown versions cannot be scheduled
+	require.Error(t, service.ScheduleSwitch(ctx, "0009", time.Now().Add(time.Hour)))
+	require.Error(t, service.ScheduleSwitch(ctx, DraftVersion, time.Now().Add(time.Hour)))
+
+	// A future switch keeps the current version and advertises the upcoming one
+	effectiveAt := time.Now().Add(time.Hour)
+	require.NoError(t, service.ScheduleSwitch(ctx, "0002", effectiveAt))
+
+	manifest, err := service.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "0001", manifest.Version)
+	require.NotNil(t, manifest.Upcoming)
+	require.Equal(t, "0002", manifest.Upcoming.Version)
+	require.Equal(t, effectiveAt.UTC().Format(time.RFC3339), manifest.Upcoming.EffectiveAt)
+	require.NotEmpty(t, manifest.Upcoming.Files)
+	require.NotEmpty(t, manifest.Upcoming.Hash)
+
+	// Upcoming files can be downloaded before the cutover
+	file, info, err := service.GetVersionFile(ctx, "0002", manifest.Upcoming.Files[0].Path)
+	require.NoError(t, err)
+	file.Close()
+	require.Equal(t, manifest.Upcoming.Files[0].Hash, info.Hash)
+
+	// The schedule survives a restart
+	restarted := &Service{
+		bundlePath:   service.bundlePath,
+		versionsPath: service.versionsPath,
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+	}
+	require.NoError(t, restarted.loadScheduledSwitch())
+	scheduled, err := restarted.GetScheduledSwitch(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, scheduled)
+	require.Equal(t, "0002", scheduled.Version)
+
+	// Once the cutover passes, the next request activates the scheduled version
+	service.scheduled.EffectiveAt = time.Now().Add(-time.Second)
+	manifest, err = service.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "0002", manifest.Version)
+	require.Nil(t, manifest.Upcoming)
+
+	scheduled, err = service.GetScheduledSwitch(ctx)
+	require.NoError(t, err)
+	require.Nil(t, scheduled)
+	_, err = os.Stat(filepath.Join(service.versionsPath, scheduledSwitchFile))
+	require.True(t, os.IsNotExist(err), "Applied schedule should be removed from disk")
+
+	// An immediate switch replaces a pending schedule
+	require.NoError(t, service.ScheduleSwitch(ctx, "0001", time.Now().Add(time.Hour)))
+	require.NoError(t, service.SwitchVersion(ctx, "0002"))
+	scheduled, err = service.GetScheduledSwitch(ctx)
+	require.NoError(t, err)
+	require.Nil(t, scheduled)
+}
@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/opendataensemble/synkronus/pkg/cdn"
 	"github.com/opendataensemble/synkronus/pkg/logger"
 )
 
@@ -28,6 +29,17 @@ type Service struct {
 	log            *logger.Logger
 	manifest       *Manifest
 	versionMutex   sync.Mutex
+	draftMutex     sync.Mutex // serializes draft staging and promotion
+	scheduleMutex  sync.Mutex // guards scheduled and serializes version switches
+	scheduled      *ScheduledSwitch
+	pushLock       pushLock // serializes pushes, draft uploads and promotions
+	cdn            cdn.CDN
+	purges         sync.WaitGroup // background CDN purges
+	history        ChangeHistory
+	limits         Limits
+	uploads        UploadStore
+	maxUploadBytes int64
+	bootChecker    BootChecker
 
 	// Core field tracking
 	coreFieldMutex  sync.RWMutex
@@ -42,14 +54,32 @@ type Config struct {
 	VersionsPath string
 	// MaxVersions is the maximum number of versions to keep
 	MaxVersions int
+	// CDN caches the app bundle endpoints; when set, manifest file URLs point to it and
+	// changed URLs are purged on pushes and version switches
+	CDN cdn.CDN
+	// History records the change log of every push, promotion and version switch; nil
+	// keeps no history
+	History ChangeHistory
+	// Limits are the guardrails pushed bundles must stay within
+	Limits Limits
+	// Uploads stages pushed bundle zips while they are validated; nil stages them on disk
+	// in VersionsPath
+	Uploads UploadStore
+	// MaxUploadBytes is the largest bundle zip a push may upload, enforced while it is
+	// received and not overridable; zero is unlimited
+	MaxUploadBytes int64
+	// BootChecker loads the app of pushed bundles in a headless browser; nil skips the check
+	BootChecker BootChecker
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() Config {
 	return Config{
-		BundlePath:   "./app-bundle",
-		VersionsPath: "./app-bundle-versions",
-		MaxVersions:  5,
+		BundlePath:     "./app-bundle",
+		VersionsPath:   "./app-bundle-versions",
+		MaxVersions:    5,
+		Limits:         DefaultLimits(),
+		MaxUploadBytes: 256 << 20,
 	}
 }
 
@@ -61,6 +91,12 @@ func NewService(config Config, log *logger.Logger) *Service {
 		maxVersions:    config.MaxVersions,
 		currentVersion: "current", // Default version name
 		log:            log,
+		cdn:            config.CDN,
+		history:        config.History,
+		limits:         config.Limits,
+		uploads:        config.Uploads,
+		maxUploadBytes: config.MaxUploadBytes,
+		bootChecker:    config.BootChecker,
 	}
 }
 
@@ -88,6 +124,11 @@ func (s *Service) Initialize(ctx context.Context) error {
 		// Continue anyway, this is not critical for startup
 	}
 
+	// Restore a switch scheduled before a restart; GetManifest applies it if it is due
+	if err := s.loadScheduledSwitch(); err != nil {
+		s.log.Warn("Failed to load scheduled version switch", "error", err)
+	}
+
 	// Generate the initial manifest
 	if _, err := s.GetManifest(ctx); err != nil {
 		return fmt.Errorf("failed to generate initial manifest: %w", err)
@@ -104,6 +145,8 @@ func (s *Service) Initialize(ctx context.Context) error {
 
 // GetManifest retrieves the current app bundle manifest
 func (s *Service) GetManifest(ctx context.Context) (*Manifest, error) {
+	s.applyDueSwitch(ctx)
+
 	// If we already have a manifest, return it
 	if s.manifest != nil {
 		return s.manifest, nil
@@ -121,6 +164,8 @@ func (s *Service) GetManifest(ctx context.Context) (*Manifest, error) {
 
 // GetFile retrieves a specific file from the app bundle
 func (s *Service) GetFile(ctx context.Context, path string) (io.ReadCloser, *File, error) {
+	s.applyDueSwitch(ctx)
+
 	// Clean and validate the path
 	cleanPath := filepath.Clean(path)
 	if strings.Contains(cleanPath, "..") {
@@ -189,10 +234,22 @@ func (s *Service) GetLatestVersionFile(ctx context.Context, path string) (io.Rea
 
 	// Get the latest version (remove asterisk if present)
 	latestVersion := strings.TrimSuffix(versions[0], " *")
-	latestPath := filepath.Join(s.versionsPath, latestVersion, path)
+	return s.GetVersionFile(ctx, latestVersion, path)
+}
+
+// GetVersionFile gets a file from a specific version
+func (s *Service) GetVersionFile(_ context.Context, version, path string) (io.ReadCloser, *File, error) {
+	if err := s.checkVersionExists(version); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", os.ErrNotExist, err)
+	}
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		return nil, nil, fmt.Errorf("invalid path: %s", path)
+	}
+	versionFilePath := filepath.Join(s.versionsPath, version, cleanPath)
 
 	// Get file info
-	fileInfo, err := os.Stat(latestPath)
+	fileInfo, err := os.Stat(versionFilePath)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -203,20 +260,20 @@ func (s *Service) GetLatestVersionFile(ctx context.Context, path string) (io.Rea
 	}
 
 	// Open the file
-	file, err := os.Open(latestPath)
+	file, err := os.Open(versionFilePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	// Get file hash
-	hash, err := s.hashFile(latestPath)
+	hash, err := s.hashFile(versionFilePath)
 	if err != nil {
 		file.Close()
 		return nil, nil, fmt.Errorf("failed to hash file: %w", err)
 	}
 
 	// Determine MIME type
-	mimeType := mime.TypeByExtension(filepath.Ext(latestPath))
+	mimeType := mime.TypeByExtension(filepath.Ext(versionFilePath))
 	if mimeType == "" {
 		mimeType = "application/octet-stream"
 	}
@@ -265,14 +322,53 @@ func (s *Service) GetFileHash(ctx context.Context, path string, useLatest bool)
 
 // generateManifest generates a new manifest for the app bundle
 func (s *Service) generateManifest() (*Manifest, error) {
+	files, err := s.listBundleFiles(s.bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setFileURLs(files, s.currentVersion)
 	manifest := &Manifest{
-		Files:       []File{},
+		Files:       files,
 		Version:     s.currentVersion,
 		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
+	// Advertise a scheduled version so clients can download it before the cutover
+	if scheduled, _ := s.GetScheduledSwitch(context.Background()); scheduled != nil {
+		upcomingFiles, err := s.listBundleFiles(filepath.Join(s.versionsPath, scheduled.Version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list upcoming version %s: %w", scheduled.Version, err)
+		}
+		s.setFileURLs(upcomingFiles, scheduled.Version)
+		upcoming := &Manifest{Files: upcomingFiles, Version: scheduled.Version}
+		if upcoming.Hash, err = s.hashManifest(upcoming); err != nil {
+			return nil, fmt.Errorf("failed to hash upcoming manifest: %w", err)
+		}
+		manifest.Upcoming = &UpcomingBundle{
+			Version:     scheduled.Version,
+			EffectiveAt: scheduled.EffectiveAt.Format(time.RFC3339),
+			Files:       upcomingFiles,
+			Hash:        upcoming.Hash,
+		}
+	}
+
+	// Generate a hash for the entire manifest
+	manifestHash, err := s.hashManifest(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash manifest: %w", err)
+	}
+	manifest.Hash = manifestHash
+
+	return manifest, nil
+}
+
+// listBundleFiles describes every file of the bundle extracted in dir, sorted by path
+func (s *Service) listBundleFiles(dir string) ([]File, error) {
+	files := []File{}
+
 	// Walk the bundle directory
-	err := filepath.WalkDir(s.bundlePath, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -283,7 +379,7 @@ func (s *Service) generateManifest() (*Manifest, error) {
 		}
 
 		// Get the relative path
-		relPath, err := filepath.Rel(s.bundlePath, path)
+		relPath, err := filepath.Rel(dir, path)
 		if err != nil {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
@@ -291,7 +387,7 @@ func (s *Service) generateManifest() (*Manifest, error) {
 		// Use forward slashes for consistency across platforms
 		relPath = filepath.ToSlash(relPath)
 
-		if relPath == "bundle.zip" {
+		if isVersionMetadataFile(relPath) {
 			return nil
 		}
 
@@ -319,7 +415,7 @@ func (s *Service) generateManifest() (*Manifest, error) {
 		}
 
 		// Add to the manifest
-		manifest.Files = append(manifest.Files, File{
+		files = append(files, File{
 			Path:     relPath,
 			Size:     fileInfo.Size(),
 			Hash:     hash,
@@ -335,18 +431,11 @@ func (s *Service) generateManifest() (*Manifest, error) {
 	}
 
 	// Sort files by path for consistent ordering
-	sort.Slice(manifest.Files, func(i, j int) bool {
-		return manifest.Files[i].Path < manifest.Files[j].Path
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
 	})
 
-	// Generate a hash for the entire manifest
-	manifestHash, err := s.hashManifest(manifest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to hash manifest: %w", err)
-	}
-	manifest.Hash = manifestHash
-
-	return manifest, nil
+	return files, nil
 }
 
 // hashFile generates a SHA-256 hash for a file
@@ -411,6 +500,11 @@ func (s *Service) hashManifest(manifest *Manifest) (string, error) {
 	}
 	sb.WriteString(manifest.Version)
 	sb.WriteString(manifest.GeneratedAt)
+	if manifest.Upcoming != nil {
+		sb.WriteString(manifest.Upcoming.Version)
+		sb.WriteString(manifest.Upcoming.EffectiveAt)
+		sb.WriteString(manifest.Upcoming.Hash)
+	}
 
 	// Hash the string
 	hash := sha256.New()
@@ -441,7 +535,7 @@ func (s *Service) ensureCurrentVersionSet(_ context.Context) error {
 	// Collect version directories
 	var versions []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && entry.Name() != DraftVersion {
 			versions = append(versions, entry.Name())
 		}
 	}
@@ -472,7 +566,9 @@ func (s *Service) ensureCurrentVersionSet(_ context.Context) error {
 }
 
 // GetBundleZipPath returns the filesystem path to the active bundle's zip archive
-func (s *Service) GetBundleZipPath(_ context.Context) (string, error) {
+func (s *Service) GetBundleZipPath(ctx context.Context) (string, error) {
+	s.applyDueSwitch(ctx)
+
 	zipPath := filepath.Join(s.bundlePath, "bundle.zip")
 	if _, err := os.Stat(zipPath); err != nil {
 		if os.IsNotExist(err) {
@@ -0,0 +1,176 @@
+package appbundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUploadTooLarge is returned when an uploaded bundle zip is larger than the maximum
+// upload size. Unlike the push limits it can't be overridden.
+var ErrUploadTooLarge = errors.New("app bundle upload exceeds the maximum upload size")
+
+// UploadStore stages uploaded bundle zips while they are validated. A zip is only
+// readable once complete, since its directory is at the end, so uploads are written to
+// the store once and read back from it; an accepted upload is then kept as the version's
+// bundle.zip rather than copied again.
+type UploadStore interface {
+	// Stage returns a new, empty upload
+	Stage() (StagedUpload, error)
+}
+
+// StagedUpload is an uploaded bundle zip being written and then validated
+type StagedUpload interface {
+	io.Writer
+	io.ReaderAt
+	// Keep stores the complete upload at path
+	Keep(path string) error
+	// Discard releases the upload; it does nothing after Keep
+	Discard() error
+}
+
+// NewDiskUploadStore stages uploads as hidden files in dir. Kept uploads are renamed, so
+// dir should be on the filesystem of the versions directory.
+func NewDiskUploadStore(dir string) UploadStore {
+	return &diskUploadStore{dir: dir}
+}
+
+type diskUploadStore struct {
+	dir string
+}
+
+func (s *diskUploadStore) Stage() (StagedUpload, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	file, err := os.CreateTemp(s.dir, ".upload-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	return &diskUpload{File: file}, nil
+}
+
+// diskUpload is an upload staged in a file
+type diskUpload struct {
+	*os.File
+	kept bool
+}
+
+func (u *diskUpload) Keep(path string) error {
+	if err := u.File.Close(); err != nil {
+		return fmt.Errorf("failed to close upload: %w", err)
+	}
+	if err := os.Rename(u.Name(), path); err != nil {
+		// Another filesystem; fall back to a copy
+		if err := copyToFile(u.Name(), path); err != nil {
+			return err
+		}
+		os.Remove(u.Name())
+	}
+	u.kept = true
+	return nil
+}
+
+func (u *diskUpload) Discard() error {
+	if u.kept {
+		return nil
+	}
+	u.File.Close()
+	if err := os.Remove(u.Name()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload: %w", err)
+	}
+	return nil
+}
+
+// copyToFile copies the file at src to dst
+func copyToFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(dst), err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy upload: %w", err)
+	}
+	return out.Close()
+}
+
+// NewMemoryUploadStore stages uploads in memory, so a push only writes the extracted
+// files and bundle.zip. Every upload in progress takes its size in memory, so it suits
+// deployments with small bundles or without a writable temporary directory.
+func NewMemoryUploadStore() UploadStore {
+	return memoryUploadStore{}
+}
+
+type memoryUploadStore struct{}
+
+func (memoryUploadStore) Stage() (StagedUpload, error) {
+	return &memoryUpload{}, nil
+}
+
+// memoryUpload is an upload staged in memory
+type memoryUpload struct {
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+func (u *memoryUpload) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.data.Write(p)
+}
+
+func (u *memoryUpload) ReadAt(p []byte, off int64) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return bytes.NewReader(u.data.Bytes()).ReadAt(p, off)
+}
+
+func (u *memoryUpload) Keep(path string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := os.WriteFile(path, u.data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	u.data = bytes.Buffer{}
+	return nil
+}
+
+func (u *memoryUpload) Discard() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.data = bytes.Buffer{}
+	return nil
+}
+
+// stageUpload writes an upload to the upload store, failing with ErrUploadTooLarge as
+// soon as it grows beyond maxBytes (zero is unlimited). It returns the upload's size.
+func stageUpload(store UploadStore, r io.Reader, maxBytes int64) (StagedUpload, int64, error) {
+	upload, err := store.Stage()
+	if err != nil {
+		return nil, 0, err
+	}
+	if maxBytes > 0 {
+		// One byte more than allowed tells a full upload from a too large one
+		r = io.LimitReader(r, maxBytes+1)
+	}
+	size, err := io.Copy(upload, r)
+	if err != nil {
+		upload.Discard()
+		return nil, 0, fmt.Errorf("failed to receive bundle upload: %w", err)
+	}
+	if maxBytes > 0 && size > maxBytes {
+		upload.Discard()
+		return nil, 0, fmt.Errorf("%w of %s", ErrUploadTooLarge, formatMegabytes(maxBytes))
+	}
+	return upload, size, nil
+}
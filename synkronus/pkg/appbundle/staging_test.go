@@ -0,0 +1,89 @@
+package appbundle
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadStores(t *testing.T) {
+	stores := map[string]func(dir string) UploadStore{
+		"disk":   NewDiskUploadStore,
+		"memory": func(string) UploadStore { return NewMemoryUploadStore() },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := newStore(dir)
+
+			upload, size, err := stageUpload(store, strings.NewReader("zip content"), 0)
+			require.NoError(t, err)
+			assert.Equal(t, int64(11), size)
+			buf := make([]byte, 7)
+			_, err = upload.ReadAt(buf, 4)
+			require.NoError(t, err)
+			assert.Equal(t, "content", string(buf))
+
+			kept := filepath.Join(dir, "bundle.zip")
+			require.NoError(t, upload.Keep(kept))
+			require.NoError(t, upload.Discard(), "discarding a kept upload does nothing")
+			data, err := os.ReadFile(kept)
+			require.NoError(t, err)
+			assert.Equal(t, "zip content", string(data))
+
+			// Too large uploads are refused without leaving anything behind
+			_, _, err = stageUpload(store, strings.NewReader("zip content"), 10)
+			require.ErrorIs(t, err, ErrUploadTooLarge)
+			upload, _, err = stageUpload(store, strings.NewReader("zip content"), 11)
+			require.NoError(t, err, "an upload of exactly the maximum size is accepted")
+			require.NoError(t, upload.Discard())
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "bundle.zip", entries[0].Name())
+		})
+	}
+}
+
+func TestPushBundleStaging(t *testing.T) {
+	buf, err := createTestZip(t, map[string]string{
+		"app/index.html":      "<html></html>",
+		"forms/a/schema.json": `{"type":"object"}`,
+		"forms/a/ui.json":     `{"type":"VerticalLayout","elements":[]}`,
+	})
+	require.NoError(t, err)
+
+	for name, uploads := range map[string]UploadStore{"disk": nil, "memory": NewMemoryUploadStore()} {
+		t.Run(name, func(t *testing.T) {
+			versionsPath := t.TempDir()
+			service := NewService(Config{BundlePath: t.TempDir(), VersionsPath: versionsPath, MaxVersions: 5,
+				Uploads: uploads, MaxUploadBytes: int64(buf.Len())}, logger.NewLogger())
+
+			manifest, err := service.PushBundle(context.Background(), bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			kept, err := os.ReadFile(filepath.Join(versionsPath, manifest.Version, "bundle.zip"))
+			require.NoError(t, err)
+			assert.Equal(t, buf.Bytes(), kept, "the upload is kept as the version's zip")
+
+			// Staging files don't linger or count as versions
+			matches, err := filepath.Glob(filepath.Join(versionsPath, ".upload-*"))
+			require.NoError(t, err)
+			assert.Empty(t, matches)
+
+			larger := append(append([]byte{}, buf.Bytes()...), 0)
+			_, err = service.PushBundle(WithLimitOverride(context.Background()), bytes.NewReader(larger))
+			require.ErrorIs(t, err, ErrUploadTooLarge, "the override doesn't lift the upload size")
+			versions, err := service.GetVersions(context.Background())
+			require.NoError(t, err)
+			assert.Len(t, versions, 1)
+		})
+	}
+}
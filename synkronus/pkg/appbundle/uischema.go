@@ -0,0 +1,249 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidUIScope is returned when a ui.json scope doesn't point at a schema property
+var ErrInvalidUIScope = errors.New("invalid UI schema scope")
+
+// uiScopeLint is the result of cross-checking a form's ui.json against its schema.json
+type uiScopeLint struct {
+	// Missing lists scopes that don't resolve to a schema property. Controls with such
+	// a scope render as blank questions on devices.
+	Missing []string
+	// Unrendered lists top-level schema properties that no control renders. Core fields
+	// are set by the app and are not reported.
+	Unrendered []string
+}
+
+// lintUIScopes cross-checks the Control and rule scopes of a UI schema against the data schema
+func lintUIScopes(schema, ui map[string]any) uiScopeLint {
+	var lint uiScopeLint
+	rendered := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	var walk func(node any, bases []any)
+	walk = func(node any, bases []any) {
+		switch v := node.(type) {
+		case map[string]any:
+			if scope, ok := v["scope"].(string); ok {
+				target, found := resolveScope(schema, bases, scope)
+				if !found {
+					missing[scope] = true
+				} else if v["type"] == "Control" {
+					if name, ok := topLevelProperty(scope); ok && len(bases) == 1 {
+						rendered[name] = true
+					}
+					// Array details are scoped relative to the items schema
+					if items, ok := target["items"].(map[string]any); ok {
+						bases = append(bases[:len(bases):len(bases)], items)
+					}
+				}
+			}
+			for key, value := range v {
+				if key == "scope" {
+					continue
+				}
+				walk(value, bases)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item, bases)
+			}
+		}
+	}
+	walk(ui, []any{schema})
+
+	for _, field := range extractFields(schema) {
+		if !field.Core && !rendered[field.Name] {
+			lint.Unrendered = append(lint.Unrendered, field.Name)
+		}
+	}
+	for scope := range missing {
+		lint.Missing = append(lint.Missing, scope)
+	}
+	sort.Strings(lint.Unrendered)
+	sort.Strings(lint.Missing)
+	return lint
+}
+
+// topLevelProperty returns the property name of a scope of the form #/properties/{name}
+func topLevelProperty(scope string) (string, bool) {
+	tokens := scopeTokens(scope)
+	if len(tokens) < 2 || tokens[0] != "properties" {
+		return "", false
+	}
+	return tokens[1], true
+}
+
+// resolveScope resolves a scope against the innermost schema in bases first and then
+// against the enclosing ones, so both absolute and item-relative detail scopes work
+func resolveScope(root map[string]any, bases []any, scope string) (map[string]any, bool) {
+	if scope == "#" || scope == "#/" {
+		return root, true
+	}
+	if !strings.HasPrefix(scope, "#/") {
+		return nil, false
+	}
+	tokens := scopeTokens(scope)
+	for i := len(bases) - 1; i >= 0; i-- {
+		if target, ok := resolvePointer(root, bases[i], tokens); ok {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// scopeTokens splits a JSON pointer scope into unescaped reference tokens
+func scopeTokens(scope string) []string {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(scope, "#"), "/")
+	if trimmed == "" {
+		return nil
+	}
+	tokens := strings.Split(trimmed, "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// resolvePointer walks tokens from node, following local $ref definitions
+func resolvePointer(root map[string]any, node any, tokens []string) (map[string]any, bool) {
+	for _, token := range tokens {
+		switch v := node.(type) {
+		case map[string]any:
+			next, ok := v[token]
+			if !ok {
+				ref, isRef := v["$ref"].(string)
+				if !isRef || !strings.HasPrefix(ref, "#/") {
+					return nil, false
+				}
+				target, found := resolvePointer(root, root, scopeTokens(ref))
+				if !found {
+					return nil, false
+				}
+				if next, ok = target[token]; !ok {
+					return nil, false
+				}
+			}
+			node = next
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			node = v[index]
+		default:
+			return nil, false
+		}
+	}
+	target, ok := node.(map[string]any)
+	return target, ok
+}
+
+// bundleForm is a form's parsed schema.json and ui.json
+type bundleForm struct {
+	schema, ui map[string]any
+}
+
+// readBundleForms parses the schema.json and ui.json of every form in the bundle. Forms
+// missing either file, or with unparseable JSON, are left to the other validation passes.
+func readBundleForms(zipReader *zip.Reader) map[string]bundleForm {
+	type formFiles struct{ schema, ui *zip.File }
+	forms := make(map[string]*formFiles)
+	for _, file := range zipReader.File {
+		parts := strings.Split(file.Name, "/")
+		var formName, fileName string
+		switch {
+		case len(parts) == 3 && parts[0] == "forms":
+			formName, fileName = parts[1], parts[2]
+		case len(parts) == 4 && parts[0] == "app" && parts[1] == "forms":
+			formName, fileName = parts[2], parts[3]
+		default:
+			continue
+		}
+		if forms[formName] == nil {
+			forms[formName] = &formFiles{}
+		}
+		switch fileName {
+		case "schema.json":
+			forms[formName].schema = file
+		case "ui.json":
+			forms[formName].ui = file
+		}
+	}
+
+	parsed := make(map[string]bundleForm)
+	for name, files := range forms {
+		if files.schema == nil || files.ui == nil {
+			continue
+		}
+		var form bundleForm
+		if readZipJSON(files.schema, &form.schema) != nil || readZipJSON(files.ui, &form.ui) != nil {
+			continue
+		}
+		parsed[name] = form
+	}
+	return parsed
+}
+
+// lintBundleUIScopes cross-checks the ui.json of every form in the bundle against its
+// schema.json
+func lintBundleUIScopes(zipReader *zip.Reader) map[string]uiScopeLint {
+	lints := make(map[string]uiScopeLint)
+	for name, form := range readBundleForms(zipReader) {
+		lints[name] = lintUIScopes(form.schema, form.ui)
+	}
+	return lints
+}
+
+// validateFormUIScopes rejects forms whose ui.json scopes point at properties missing
+// from schema.json
+func (s *Service) validateFormUIScopes(zipReader *zip.Reader) error {
+	lints := lintBundleUIScopes(zipReader)
+	names := make([]string, 0, len(lints))
+	for name := range lints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		for _, scope := range lints[name].Missing {
+			problems = append(problems, fmt.Sprintf("form '%s': scope '%s' does not match a property in schema.json", name, scope))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidUIScope, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// logUnrenderedFields warns about schema properties that no ui.json control renders.
+// They are valid but usually a mistake, so they don't fail the push.
+func (s *Service) logUnrenderedFields(zipReader *zip.Reader) {
+	for name, lint := range lintBundleUIScopes(zipReader) {
+		if len(lint.Unrendered) > 0 {
+			s.log.Warn("Form schema properties are not rendered by any ui.json control",
+				"form", name, "properties", strings.Join(lint.Unrendered, ", "))
+		}
+	}
+}
+
+// readZipJSON decodes a JSON file from the bundle
+func readZipJSON(file *zip.File, v any) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
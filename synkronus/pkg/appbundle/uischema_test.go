@@ -0,0 +1,85 @@
+package appbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintUIScopes(t *testing.T) {
+	schema := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"definitions": {"person": {"type": "object", "properties": {"age": {"type": "integer"}}}},
+		"properties": {
+			"name": {"type": "string"},
+			"a/b": {"type": "string"},
+			"notes": {"type": "string"},
+			"core_id": {"type": "string"},
+			"head": {"$ref": "#/definitions/person"},
+			"members": {
+				"type": "array",
+				"items": {"type": "object", "properties": {"member_name": {"type": "string"}}}
+			}
+		}
+	}`), &schema))
+
+	ui := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "VerticalLayout",
+		"elements": [
+			{"type": "Control", "scope": "#/properties/name"},
+			{"type": "Control", "scope": "#/properties/a~1b"},
+			{"type": "Control", "scope": "#/properties/head/properties/age"},
+			{"type": "Control", "scope": "#/properties/nmae"},
+			{
+				"type": "Control",
+				"scope": "#/properties/members",
+				"options": {"detail": {"type": "VerticalLayout", "elements": [
+					{"type": "Control", "scope": "#/properties/member_name"},
+					{"type": "Control", "scope": "#/properties/members/items/properties/member_name"},
+					{"type": "Control", "scope": "#/properties/member_age"}
+				]}}
+			},
+			{
+				"type": "Control",
+				"scope": "#/properties/name",
+				"rule": {"effect": "SHOW", "condition": {"scope": "#/properties/consent", "schema": {"const": true}}}
+			}
+		]
+	}`), &ui))
+
+	lint := lintUIScopes(schema, ui)
+	assert.Equal(t, []string{"#/properties/consent", "#/properties/member_age", "#/properties/nmae"}, lint.Missing)
+	assert.Equal(t, []string{"notes"}, lint.Unrendered, "core fields are not expected in the UI")
+}
+
+func TestValidateFormUIScopes(t *testing.T) {
+	bundle := func(ui string) *zip.Reader {
+		buf, err := createTestZip(t, map[string]string{
+			"app/index.html":         "<html></html>",
+			"forms/user/schema.json": `{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}}}`,
+			"forms/user/ui.json":     ui,
+		})
+		require.NoError(t, err)
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		return reader
+	}
+
+	s := &Service{}
+
+	// Unrendered fields are allowed
+	assert.NoError(t, s.validateBundleStructure(bundle(`{"type":"Control","scope":"#/properties/name"}`)))
+
+	err := s.validateBundleStructure(bundle(`{"type":"VerticalLayout","elements":[{"type":"Control","scope":"#/properties/nam"}]}`))
+	require.ErrorIs(t, err, ErrInvalidUIScope)
+	assert.Contains(t, err.Error(), "form 'user': scope '#/properties/nam'")
+
+	lints := lintBundleUIScopes(bundle(`{"type":"Control","scope":"#/properties/name"}`))
+	assert.Equal(t, []string{"age"}, lints["user"].Unrendered)
+}
@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/strictschema"
 )
 
 var (
@@ -18,6 +21,7 @@ var (
 	ErrInvalidCellStructure     = errors.New("invalid renderer structure")
 	ErrCoreFieldModified        = errors.New("core_* fields cannot be modified")
 	ErrMissingRendererReference = errors.New("missing renderer reference")
+	ErrInvalidExtension         = errors.New("invalid extension file")
 )
 
 // validateBundleStructure validates the structure of the uploaded zip file
@@ -88,6 +92,10 @@ func (s *Service) validateBundleStructure(zipReader *zip.Reader) error {
 			if file.Name == "forms/ext.json" || strings.HasSuffix(file.Name, "/ext.json") {
 				continue
 			}
+			// Migration scripts are validated together below
+			if _, _, ok := parseMigrationPath(file.Name); ok {
+				continue
+			}
 			if err := s.validateFormFile(file); err != nil {
 				return err
 			}
@@ -135,8 +143,31 @@ func (s *Service) validateBundleStructure(zipReader *zip.Reader) error {
 		}
 	}
 
+	if err := s.validateMigrationScripts(zipReader, formDirs); err != nil {
+		return err
+	}
+
+	if _, err := collectRenderers(zipReader); err != nil {
+		return err
+	}
+
 	// Third pass: validate form references to renderers
-	return s.validateFormRendererReferences(zipReader)
+	if err := s.validateFormRendererReferences(zipReader); err != nil {
+		return err
+	}
+
+	// Fourth pass: cross-check ui.json scopes against schema.json
+	if err := s.validateFormUIScopes(zipReader); err != nil {
+		return err
+	}
+
+	// Fifth pass: check that ui.json rules can be evaluated against schema.json
+	if err := s.validateFormUIRules(zipReader); err != nil {
+		return err
+	}
+
+	// Sixth pass: check ext.json files against the extension schema
+	return s.validateExtensions(zipReader)
 }
 
 // getFormNameFromSchemaPath extracts form name from schema path.
@@ -213,6 +244,19 @@ func (s *Service) validateFormSchema(file *zip.File) error {
 		return fmt.Errorf("invalid file path: %s", file.Name)
 	}
 
+	// Calculated fields are recomputed by the server, so their formulas must parse
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("failed to read form schema: %w", err)
+	}
+	if _, err := calculation.ParseSchema(data); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFormStructure, file.Name, err)
+	}
+	// x-unknown-keys must name a mode, or pushes would silently store every key
+	if _, err := strictschema.ParseSchema(data); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFormStructure, file.Name, err)
+	}
+
 	// Check for core field modifications
 	if currentHash, exists := s.getCoreFieldsHash(formName); exists {
 		// Get current core fields
@@ -251,9 +295,10 @@ func (s *Service) validateRendererFile(file *zip.File) error {
 		return nil
 	}
 
-	// Expected path format: renderers/{rendererName}/renderer.jsx
-	parts := strings.Split(file.Name, "/")
-	if len(parts) != 3 || parts[2] != "renderer.jsx" {
+	// Expected path format: renderers/{rendererName}/renderer.jsx, with an optional
+	// renderer.json manifest next to it
+	_, fileName, ok := parseRendererPath(file.Name)
+	if !ok || (fileName != "renderer.jsx" && fileName != "renderer.json") {
 		return fmt.Errorf("%w: invalid renderer file path: %s", ErrInvalidCellStructure, file.Name)
 	}
 
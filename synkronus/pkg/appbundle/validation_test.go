@@ -635,6 +635,46 @@ func TestValidateFormSchema(t *testing.T) {
 			schema:  `{invalid: json}`,
 			isValid: false,
 		},
+		{
+			name: "valid calculated field",
+			schema: `{
+				"properties": {
+					"weight": {"type": "number"},
+					"height": {"type": "number"},
+					"bmi": {"type": "number", "x-calculated": "round(weight / ((height / 100) * (height / 100)), 1)"}
+				}
+			}`,
+			isValid: true,
+		},
+		{
+			name: "unparsable calculated field",
+			schema: `{
+				"properties": {
+					"bmi": {"type": "number", "x-calculated": "weight / (height"}
+				}
+			}`,
+			isValid: false,
+		},
+		{
+			name: "circular calculated fields",
+			schema: `{
+				"properties": {
+					"a": {"type": "number", "x-calculated": "b + 1"},
+					"b": {"type": "number", "x-calculated": "a + 1"}
+				}
+			}`,
+			isValid: false,
+		},
+		{
+			name:    "strict schema",
+			schema:  `{"x-unknown-keys": "reject", "properties": {}}`,
+			isValid: true,
+		},
+		{
+			name:    "unknown x-unknown-keys mode",
+			schema:  `{"x-unknown-keys": "warn", "properties": {}}`,
+			isValid: false,
+		},
 	}
 
 	for _, tt := range tests {
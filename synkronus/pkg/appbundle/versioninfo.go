@@ -0,0 +1,170 @@
+package appbundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// versionInfoFile records who created a version and when. It lives in the version
+// directory but is not part of the bundle served to clients.
+const versionInfoFile = "VERSION_INFO.json"
+
+// VersionInfo describes an available app bundle version
+type VersionInfo struct {
+	Version   string    `json:"version"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author,omitempty"` // empty for versions pushed before authors were recorded
+	FormCount int       `json:"form_count"`
+	// Internal versions are only listed and served to admins and testers
+	Internal bool `json:"internal"`
+	// BootCheck is nil for versions pushed without a boot checker
+	BootCheck *BootCheck `json:"boot_check,omitempty"`
+}
+
+// versionRecord is the content of versionInfoFile
+type versionRecord struct {
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Internal  bool      `json:"internal,omitempty"`
+	// BootCheck is set when the bundle was boot checked
+	BootCheck *BootCheck `json:"boot_check,omitempty"`
+}
+
+// internalVersionKey marks pushes and promotions that create an internal version
+type internalVersionKey struct{}
+
+// WithInternalVersion returns a context in which pushed and promoted versions are
+// internal from the start
+func WithInternalVersion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalVersionKey{}, true)
+}
+
+// isVersionMetadataFile reports whether a file of a version directory is kept by the
+// server rather than being part of the bundle
+func isVersionMetadataFile(rel string) bool {
+	return rel == "bundle.zip" || rel == versionInfoFile || rel == bootScreenshotFile
+}
+
+// writeVersionRecord stores the pushing user and time and the boot check of the bundle in
+// the version directory
+func (s *Service) writeVersionRecord(ctx context.Context, versionPath string, bootCheck *BootCheck) error {
+	internal, _ := ctx.Value(internalVersionKey{}).(bool)
+	record := versionRecord{CreatedAt: time.Now().UTC(), Internal: internal, BootCheck: bootCheck}
+	if user := authmw.GetUserFromContext(ctx); user != nil {
+		record.Author = user.Username
+	}
+
+	return saveVersionRecord(versionPath, record)
+}
+
+// saveVersionRecord writes the record of the version at versionPath
+func saveVersionRecord(versionPath string, record versionRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", versionInfoFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(versionPath, versionInfoFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", versionInfoFile, err)
+	}
+	return nil
+}
+
+// readVersionRecord returns the record of a version; ok is false for versions pushed
+// before records were kept
+func (s *Service) readVersionRecord(version string) (record versionRecord, ok bool) {
+	data, err := os.ReadFile(filepath.Join(s.versionsPath, version, versionInfoFile))
+	if err != nil || json.Unmarshal(data, &record) != nil {
+		return versionRecord{}, false
+	}
+	return record, true
+}
+
+// SetVersionInternal marks a version internal or released. The active version and a
+// version scheduled to become active can't be made internal.
+func (s *Service) SetVersionInternal(ctx context.Context, version string, internal bool) error {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	if err := s.checkVersionExists(version); err != nil {
+		return fmt.Errorf("%w: %v", os.ErrNotExist, err)
+	}
+	if internal {
+		current, err := s.getCurrentVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get current version: %w", err)
+		}
+		if version == current || (s.scheduled != nil && s.scheduled.Version == version) {
+			return fmt.Errorf("%w: version %s is active or scheduled to become active", ErrVersionInternal, version)
+		}
+	}
+
+	versionPath := filepath.Join(s.versionsPath, version)
+	record, ok := s.readVersionRecord(version)
+	if !ok {
+		// Keep the best estimate of the creation time of versions without a record
+		if stat, err := os.Stat(versionPath); err == nil {
+			record.CreatedAt = stat.ModTime().UTC()
+		}
+	}
+	record.Internal = internal
+	if err := saveVersionRecord(versionPath, record); err != nil {
+		return err
+	}
+	s.log.Info("Changed app bundle version visibility", "version", version, "internal", internal)
+	return nil
+}
+
+// checkVersionReleased returns ErrVersionInternal for an internal version, which must be
+// released before it can be activated
+func (s *Service) checkVersionReleased(version string) error {
+	if record, ok := s.readVersionRecord(version); ok && record.Internal {
+		return fmt.Errorf("%w: release version %s before activating it", ErrVersionInternal, version)
+	}
+	return nil
+}
+
+// GetVersionDetails returns the available versions, newest first, with their author,
+// creation time and number of forms
+func (s *Service) GetVersionDetails(ctx context.Context) ([]VersionInfo, error) {
+	versions, err := s.GetVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]VersionInfo, 0, len(versions))
+	for _, version := range versions {
+		info := VersionInfo{
+			Version: strings.TrimSuffix(version, " *"),
+			Active:  strings.HasSuffix(version, " *"),
+		}
+		versionPath := filepath.Join(s.versionsPath, info.Version)
+
+		if record, ok := s.readVersionRecord(info.Version); ok {
+			info.Author = record.Author
+			info.CreatedAt = record.CreatedAt
+			info.Internal = record.Internal
+			info.BootCheck = record.BootCheck
+		} else if stat, err := os.Stat(versionPath); err == nil {
+			// Older versions have no record; the directory time is the best estimate
+			info.CreatedAt = stat.ModTime().UTC()
+		}
+
+		if appInfo, err := s.GetAppInfo(ctx, info.Version); err == nil {
+			info.FormCount = len(appInfo.Forms)
+		} else {
+			s.log.Warn("Failed to read app info for version", "version", info.Version, "error", err)
+		}
+
+		details = append(details, info)
+	}
+
+	return details, nil
+}
@@ -0,0 +1,105 @@
+package appbundle
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVersionDetails(t *testing.T) {
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+	}
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	push := func(ctx context.Context) {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = service.PushBundle(ctx, f)
+		require.NoError(t, err)
+	}
+	push(context.Background())
+	push(context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "alice"}))
+	ctx := context.Background()
+	require.NoError(t, service.SwitchVersion(ctx, "0001"))
+
+	details, err := service.GetVersionDetails(ctx)
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+
+	assert.Equal(t, "0002", details[0].Version)
+	assert.False(t, details[0].Active)
+	assert.Equal(t, "alice", details[0].Author)
+	assert.False(t, details[0].CreatedAt.IsZero())
+
+	assert.Equal(t, "0001", details[1].Version)
+	assert.True(t, details[1].Active)
+	assert.Empty(t, details[1].Author)
+
+	appInfo, err := service.GetAppInfo(ctx, "0002")
+	require.NoError(t, err)
+	assert.Equal(t, len(appInfo.Forms), details[0].FormCount)
+
+	// The version record is not served as part of the bundle
+	manifest, err := service.GetManifest(ctx)
+	require.NoError(t, err)
+	for _, file := range manifest.Files {
+		assert.NotEqual(t, versionInfoFile, file.Path)
+	}
+}
+
+func TestSetVersionInternal(t *testing.T) {
+	service := &Service{
+		bundlePath:   t.TempDir(),
+		versionsPath: t.TempDir(),
+		maxVersions:  5,
+		log:          logger.NewLogger(),
+	}
+
+	bundlePath, err := createTestBundle(t, true, true, false)
+	require.NoError(t, err, "Failed to create test bundle")
+	defer cleanupTestBundle(t, bundlePath)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		f, err := os.Open(bundlePath)
+		require.NoError(t, err)
+		_, err = service.PushBundle(ctx, f)
+		f.Close()
+		require.NoError(t, err)
+	}
+	require.NoError(t, service.SwitchVersion(ctx, "0001"))
+
+	// The active version stays released
+	assert.ErrorIs(t, service.SetVersionInternal(ctx, "0001", true), ErrVersionInternal)
+	assert.ErrorIs(t, service.SetVersionInternal(ctx, "0009", true), os.ErrNotExist)
+
+	require.NoError(t, service.SetVersionInternal(ctx, "0002", true))
+	details, err := service.GetVersionDetails(ctx)
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+	assert.True(t, details[0].Internal)
+	assert.False(t, details[0].CreatedAt.IsZero(), "the creation time is kept")
+	assert.False(t, details[1].Internal)
+
+	// Internal versions must be released before they are activated
+	assert.ErrorIs(t, service.SwitchVersion(ctx, "0002"), ErrVersionInternal)
+	assert.ErrorIs(t, service.ScheduleSwitch(ctx, "0002", time.Now().Add(time.Hour)), ErrVersionInternal)
+
+	require.NoError(t, service.SetVersionInternal(ctx, "0002", false))
+	require.NoError(t, service.SwitchVersion(ctx, "0002"))
+}
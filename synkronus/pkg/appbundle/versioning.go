@@ -16,35 +16,19 @@ import (
 
 // PushBundle uploads a new app bundle from a zip file
 func (s *Service) PushBundle(ctx context.Context, zipReader io.Reader) (*Manifest, error) {
-	// Create a temporary file to store the zip content
-	tempZipFile, err := os.CreateTemp("", "appbundle-*.zip")
+	release, err := s.pushLock.acquire(ctx, PushOperationPush, pushWait(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, err
 	}
-	defer os.Remove(tempZipFile.Name())
-	defer tempZipFile.Close()
+	defer release()
 
-	// Copy the zip content to the temporary file
-	if _, err := io.Copy(tempZipFile, zipReader); err != nil {
-		return nil, fmt.Errorf("failed to copy zip content: %w", err)
-	}
-
-	// Rewind the file for reading
-	if _, err := tempZipFile.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("failed to rewind temporary file: %w", err)
-	}
-
-	// Open the zip file for validation
-	zipFile, err := zip.OpenReader(tempZipFile.Name())
+	upload, zipFile, err := s.openValidatedBundle(ctx, zipReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open zip file: %w", err)
+		return nil, err
 	}
-	defer zipFile.Close()
+	defer upload.Discard()
 
-	// Validate the bundle structure
-	if err := s.validateBundleStructure(&zipFile.Reader); err != nil {
-		return nil, fmt.Errorf("bundle validation failed: %w", err)
-	}
+	previous := s.latestVersion(ctx)
 
 	// Get the next version number after validation passes
 	versionNumber, err := s.getNextVersionNumber()
@@ -56,31 +40,206 @@ func (s *Service) PushBundle(ctx context.Context, zipReader io.Reader) (*Manifes
 	versionName := fmt.Sprintf("%04d", versionNumber)
 	versionPath := filepath.Join(s.versionsPath, versionName)
 
-	// Create the version directory
 	s.log.Info("Creating new app bundle version", "version", versionName)
-	if err := os.MkdirAll(versionPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create version directory: %w", err)
+	if err := s.writeBundleDir(zipFile, upload, versionPath, fmt.Sprint(versionNumber)); err != nil {
+		return nil, err
+	}
+	bootCheck, err := s.checkBoot(ctx, versionPath)
+	if err != nil {
+		os.RemoveAll(versionPath)
+		return nil, err
 	}
+	if err := s.writeVersionRecord(ctx, versionPath, bootCheck); err != nil {
+		s.log.Error("Failed to record app bundle version info", "version", versionName, "error", err)
+	}
+	s.purgeCDN(pushPaths(bundleFilePaths(versionPath)), "push")
+	s.recordChange(ctx, ChangeActionPush, contextActor(ctx), previous, versionName)
 
-	// Generate app info with the new version number
-	appInfoData, err := s.generateAppInfo(&zipFile.Reader, fmt.Sprint(versionNumber))
+	// Clean up old versions if needed
+	if err := s.cleanupOldVersions(); err != nil {
+		s.log.Error("Failed to clean up old versions", "error", err)
+		// Continue even if cleanup fails
+	}
+
+	// Return a minimal manifest with just the version
+	return &Manifest{
+		Version:     versionName,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		// Files will be populated when the manifest is generated
+	}, nil
+}
+
+// PushDraft uploads and validates a bundle into the draft slot without assigning a
+// version number, replacing any previous draft
+func (s *Service) PushDraft(ctx context.Context, zipReader io.Reader) (*Manifest, error) {
+	release, err := s.pushLock.acquire(ctx, PushOperationDraft, pushWait(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate app info: %w", err)
+		return nil, err
 	}
+	defer release()
 
-	// Write APP_INFO.json directly to the version directory
-	appInfoPath := filepath.Join(versionPath, "APP_INFO.json")
+	upload, zipFile, err := s.openValidatedBundle(ctx, zipReader)
+	if err != nil {
+		return nil, err
+	}
+	defer upload.Discard()
+
+	s.draftMutex.Lock()
+	defer s.draftMutex.Unlock()
+
+	draftPath := filepath.Join(s.versionsPath, DraftVersion)
+	if err := os.RemoveAll(draftPath); err != nil {
+		return nil, fmt.Errorf("failed to remove previous draft: %w", err)
+	}
+
+	s.log.Info("Staging app bundle draft")
+	if err := s.writeBundleDir(zipFile, upload, draftPath, DraftVersion); err != nil {
+		os.RemoveAll(draftPath)
+		return nil, err
+	}
+	bootCheck, err := s.checkBoot(ctx, draftPath)
+	if err != nil {
+		os.RemoveAll(draftPath)
+		return nil, err
+	}
+	if bootCheck != nil {
+		// Kept until promotion, which records the promoting user
+		if err := saveVersionRecord(draftPath, versionRecord{CreatedAt: time.Now().UTC(), BootCheck: bootCheck}); err != nil {
+			s.log.Error("Failed to record app bundle draft boot check", "error", err)
+		}
+	}
+
+	return &Manifest{
+		Version:     DraftVersion,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// PromoteDraft turns the staged draft into the next numbered version
+func (s *Service) PromoteDraft(ctx context.Context) (*Manifest, error) {
+	release, err := s.pushLock.acquire(ctx, PushOperationPromote, pushWait(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	s.draftMutex.Lock()
+	defer s.draftMutex.Unlock()
+
+	draftPath := filepath.Join(s.versionsPath, DraftVersion)
+	if _, err := os.Stat(draftPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoDraft
+		}
+		return nil, fmt.Errorf("failed to stat draft directory: %w", err)
+	}
+
+	previous := s.latestVersion(ctx)
+	versionNumber, err := s.getNextVersionNumber()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next version number: %w", err)
+	}
+	versionName := fmt.Sprintf("%04d", versionNumber)
+
+	// Stamp the version number into APP_INFO.json before the draft becomes visible
+	appInfoPath := filepath.Join(draftPath, "APP_INFO.json")
+	appInfoData, err := os.ReadFile(appInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read draft APP_INFO.json: %w", err)
+	}
+	var appInfo AppInfo
+	if err := json.Unmarshal(appInfoData, &appInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse draft APP_INFO.json: %w", err)
+	}
+	appInfo.Version = fmt.Sprint(versionNumber)
+	appInfoData, err = json.MarshalIndent(appInfo, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal APP_INFO.json: %w", err)
+	}
 	if err := os.WriteFile(appInfoPath, appInfoData, 0644); err != nil {
 		return nil, fmt.Errorf("failed to write APP_INFO.json: %w", err)
 	}
+	// The promoting user becomes the author of the version
+	draftRecord, _ := s.readVersionRecord(DraftVersion)
+	if err := s.writeVersionRecord(ctx, draftPath, draftRecord.BootCheck); err != nil {
+		s.log.Error("Failed to record app bundle version info", "version", versionName, "error", err)
+	}
 
-	// Rewind the zip file for extraction
-	if _, err := tempZipFile.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("failed to rewind temporary file: %w", err)
+	if err := os.Rename(draftPath, filepath.Join(s.versionsPath, versionName)); err != nil {
+		return nil, fmt.Errorf("failed to promote draft: %w", err)
+	}
+	s.log.Info("Promoted app bundle draft", "version", versionName)
+	s.purgeCDN(pushPaths(bundleFilePaths(filepath.Join(s.versionsPath, versionName))), "promote")
+	s.recordChange(ctx, ChangeActionPromote, contextActor(ctx), previous, versionName)
+
+	// Clean up old versions if needed
+	if err := s.cleanupOldVersions(); err != nil {
+		s.log.Error("Failed to clean up old versions", "error", err)
+		// Continue even if cleanup fails
+	}
+
+	return &Manifest{
+		Version:     versionName,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// openValidatedBundle stages an uploaded bundle in the upload store and validates its
+// structure and push limits. The caller must discard the returned upload.
+func (s *Service) openValidatedBundle(ctx context.Context, zipReader io.Reader) (StagedUpload, *zip.Reader, error) {
+	uploads := s.uploads
+	if uploads == nil {
+		uploads = NewDiskUploadStore(s.versionsPath)
+	}
+	upload, size, err := stageUpload(uploads, zipReader, s.maxUploadBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Open the zip for validation
+	zipFile, err := zip.NewReader(upload, size)
+	if err != nil {
+		upload.Discard()
+		return nil, nil, fmt.Errorf("failed to open zip file: %w", err)
+	}
+
+	// Validate the bundle structure
+	if err := s.validateBundleStructure(zipFile); err != nil {
+		upload.Discard()
+		return nil, nil, fmt.Errorf("bundle validation failed: %w", err)
+	}
+	if err := s.checkLimits(ctx, zipFile); err != nil {
+		upload.Discard()
+		return nil, nil, err
+	}
+	s.logUnrenderedFields(zipFile)
+	s.logExtensionWarnings(zipFile)
+
+	return upload, zipFile, nil
+}
+
+// writeBundleDir writes APP_INFO.json, the extracted bundle files and the original
+// bundle.zip into dir
+func (s *Service) writeBundleDir(zipReader *zip.Reader, upload StagedUpload, dir, version string) error {
+	// Create the version directory
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %w", err)
+	}
+
+	// Generate app info with the new version number
+	appInfoData, err := s.generateAppInfo(zipReader, version)
+	if err != nil {
+		return fmt.Errorf("failed to generate app info: %w", err)
+	}
+
+	// Write APP_INFO.json directly to the version directory
+	appInfoPath := filepath.Join(dir, "APP_INFO.json")
+	if err := os.WriteFile(appInfoPath, appInfoData, 0644); err != nil {
+		return fmt.Errorf("failed to write APP_INFO.json: %w", err)
 	}
 
 	// Extract the zip file to the version directory (using the original zip file)
-	for _, file := range zipFile.File {
+	for _, file := range zipReader.File {
 		// Skip directories and files with paths containing ".."
 		if file.FileInfo().IsDir() || strings.Contains(file.Name, "..") {
 			continue
@@ -91,31 +250,31 @@ func (s *Service) PushBundle(ctx context.Context, zipReader io.Reader) (*Manifes
 		cleanPath = filepath.ToSlash(cleanPath)
 
 		// Create the target file path
-		targetPath := filepath.Join(versionPath, cleanPath)
+		targetPath := filepath.Join(dir, cleanPath)
 
 		// Ensure the parent directory exists
 		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-			return nil, fmt.Errorf("failed to create directory for file %s: %w", cleanPath, err)
+			return fmt.Errorf("failed to create directory for file %s: %w", cleanPath, err)
 		}
 
 		// Open the file from the zip
 		srcFile, err := file.Open()
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s from zip: %w", cleanPath, err)
+			return fmt.Errorf("failed to open file %s from zip: %w", cleanPath, err)
 		}
 
 		// Create the target file
 		dstFile, err := os.Create(targetPath)
 		if err != nil {
 			srcFile.Close()
-			return nil, fmt.Errorf("failed to create file %s: %w", cleanPath, err)
+			return fmt.Errorf("failed to create file %s: %w", cleanPath, err)
 		}
 
 		// Copy the content
 		if _, err := io.Copy(dstFile, srcFile); err != nil {
 			srcFile.Close()
 			dstFile.Close()
-			return nil, fmt.Errorf("failed to copy file %s: %w", cleanPath, err)
+			return fmt.Errorf("failed to copy file %s: %w", cleanPath, err)
 		}
 
 		// Close the files
@@ -123,33 +282,12 @@ func (s *Service) PushBundle(ctx context.Context, zipReader io.Reader) (*Manifes
 		dstFile.Close()
 	}
 
-	// Save the original zip to the version directory for direct download
-	if _, err := tempZipFile.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("failed to rewind zip for saving: %w", err)
-	}
-	bundleZipPath := filepath.Join(versionPath, "bundle.zip")
-	bundleZipFile, err := os.Create(bundleZipPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create bundle.zip: %w", err)
+	// Keep the original zip in the version directory for direct download
+	if err := upload.Keep(filepath.Join(dir, "bundle.zip")); err != nil {
+		return fmt.Errorf("failed to save bundle.zip: %w", err)
 	}
-	if _, err := io.Copy(bundleZipFile, tempZipFile); err != nil {
-		bundleZipFile.Close()
-		return nil, fmt.Errorf("failed to save bundle.zip: %w", err)
-	}
-	bundleZipFile.Close()
 
-	// Clean up old versions if needed
-	if err := s.cleanupOldVersions(); err != nil {
-		s.log.Error("Failed to clean up old versions", "error", err)
-		// Continue even if cleanup fails
-	}
-
-	// Return a minimal manifest with just the version
-	return &Manifest{
-		Version:     versionName,
-		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
-		// Files will be populated when the manifest is generated
-	}, nil
+	return nil
 }
 
 // GetVersions returns a list of available app bundle versions
@@ -173,7 +311,7 @@ func (s *Service) GetVersions(ctx context.Context) ([]string, error) {
 	// Filter directories and collect versions
 	versions := make([]string, 0, len(entries))
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && entry.Name() != DraftVersion {
 			version := entry.Name()
 			// Mark current version with an asterisk
 			if version == currentVersion {
@@ -228,19 +366,41 @@ func (s *Service) getCurrentVersion() (string, error) {
 	return version, nil
 }
 
-// SwitchVersion switches to a specific app bundle version
+// SwitchVersion switches to a specific app bundle version immediately, replacing any
+// scheduled switch
 func (s *Service) SwitchVersion(ctx context.Context, version string) error {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	previous, err := s.getCurrentVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get current version: %w", err)
+	}
+	if err := s.switchVersion(ctx, version); err != nil {
+		return err
+	}
+	if err := s.clearScheduledSwitch(); err != nil {
+		s.log.Error("Failed to clear scheduled app bundle switch", "error", err)
+	}
+	s.recordChange(ctx, ChangeActionSwitch, contextActor(ctx), previous, version)
+	return nil
+}
+
+// switchVersion activates version. The caller must hold scheduleMutex.
+func (s *Service) switchVersion(_ context.Context, version string) error {
 	s.versionMutex.Lock()
 	defer s.versionMutex.Unlock()
 
 	// Validate the version
-	versionPath := filepath.Join(s.versionsPath, version)
-	if _, err := os.Stat(versionPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("version %s does not exist", version)
-		}
-		return fmt.Errorf("failed to stat version directory: %w", err)
+	if err := s.checkVersionExists(version); err != nil {
+		return err
+	}
+	if err := s.checkVersionReleased(version); err != nil {
+		return err
 	}
+	versionPath := filepath.Join(s.versionsPath, version)
+
+	previousFiles := bundleFilePaths(s.bundlePath)
 
 	// Clear the current bundle directory
 	if err := s.clearDirectory(s.bundlePath); err != nil {
@@ -273,6 +433,7 @@ func (s *Service) SwitchVersion(ctx context.Context, version string) error {
 	s.manifest = nil // Force regeneration of manifest
 
 	s.log.Info("Switched to app bundle version", "version", version)
+	s.purgeCDN(activationPaths(mergePaths(previousFiles, bundleFilePaths(s.bundlePath))), "switch")
 	return nil
 }
 
@@ -466,6 +627,34 @@ func (s *Service) CompareAppInfos(ctx context.Context, versionA, versionB string
 	return CompareAppInfos(appInfoA, appInfoB)
 }
 
+// CompareBundleFiles compares the files of two versions' directories
+func (s *Service) CompareBundleFiles(ctx context.Context, versionA, versionB string) (*FileChanges, error) {
+	var files [2][]File
+	for i, version := range []string{versionA, versionB} {
+		if version == "latest" {
+			versions, err := s.GetVersions(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get versions: %w", err)
+			}
+			if len(versions) == 0 {
+				return nil, fmt.Errorf("no versions available")
+			}
+			version = strings.TrimSuffix(versions[0], " *")
+		}
+		if err := s.checkVersionExists(version); err != nil {
+			return nil, err
+		}
+		list, err := s.listBundleFiles(filepath.Join(s.versionsPath, version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of version %s: %w", version, err)
+		}
+		s.setFileURLs(list, version)
+		files[i] = list
+	}
+
+	return CompareFiles(files[0], files[1]), nil
+}
+
 // cleanupOldVersions removes old versions to keep only the maximum number of versions
 func (s *Service) cleanupOldVersions() error {
 	// Get all versions
@@ -479,10 +668,14 @@ func (s *Service) cleanupOldVersions() error {
 		return nil
 	}
 
-	// Remove the oldest versions
+	// Remove the oldest versions, keeping one that is scheduled to become active
+	scheduled := s.scheduledVersion()
 	for i := s.maxVersions; i < len(versions); i++ {
 		// Remove asterisk from the version if present
 		version := strings.TrimSuffix(versions[i], " *")
+		if version == scheduled {
+			continue
+		}
 		versionPath := filepath.Join(s.versionsPath, version)
 		s.log.Info("Removing old app bundle version", "version", version)
 		if err := os.RemoveAll(versionPath); err != nil {
@@ -0,0 +1,157 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrArchiveTooLarge is returned when an archive would hold more attachments than allowed
+var ErrArchiveTooLarge = errors.New("too many attachments for one archive")
+
+// ErrArchiveEmpty is returned when no attachments match an archive request
+var ErrArchiveEmpty = errors.New("no attachments match the archive request")
+
+// ErrInvalidArchiveRequest is returned for archive requests that select nothing or
+// select in two ways at once
+var ErrInvalidArchiveRequest = errors.New("invalid archive request")
+
+// ArchiveRequest selects the attachments of an archive, either by ID or by the
+// observations that reference them
+type ArchiveRequest struct {
+	AttachmentIDs []string           `json:"attachment_ids,omitempty"`
+	Observations  *ObservationFilter `json:"observations,omitempty"`
+}
+
+// ObservationFilter selects live observations whose attachments go into an archive
+type ObservationFilter struct {
+	ObservationIDs []string   `json:"observation_ids,omitempty"`
+	FormType       string     `json:"form_type,omitempty"`
+	SubmittedBy    string     `json:"submitted_by,omitempty"`
+	Since          *time.Time `json:"since,omitempty"`
+	Until          *time.Time `json:"until,omitempty"`
+}
+
+// ArchiveEntry is one file of an archive
+type ArchiveEntry struct {
+	AttachmentID string
+	// Name is the path of the file in the archive
+	Name string
+}
+
+// ArchiveEntries resolves an archive request to the files of the archive. Attachments
+// selected by ID are named by their ID; attachments of observations are placed under
+// <form_type>/<observation_id>/. Only attachments with stored metadata are found through
+// observations.
+func (s *manifestService) ArchiveEntries(ctx context.Context, req ArchiveRequest) ([]ArchiveEntry, error) {
+	if len(req.AttachmentIDs) > 0 && req.Observations != nil {
+		return nil, fmt.Errorf("%w: select attachments either by attachment_ids or by observations", ErrInvalidArchiveRequest)
+	}
+	if len(req.AttachmentIDs) == 0 && req.Observations == nil {
+		return nil, fmt.Errorf("%w: attachment_ids or observations is required", ErrInvalidArchiveRequest)
+	}
+
+	var entries []ArchiveEntry
+	if req.Observations != nil {
+		var err error
+		if entries, err = s.observationAttachments(ctx, *req.Observations); err != nil {
+			return nil, err
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, id := range req.AttachmentIDs {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			entries = append(entries, ArchiveEntry{AttachmentID: id, Name: archiveName(id)})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrArchiveEmpty
+	}
+	if limit := s.cfg.AttachmentArchiveMaxFiles; limit > 0 && len(entries) > limit {
+		return nil, fmt.Errorf("%w: %d selected, at most %d allowed", ErrArchiveTooLarge, len(entries), limit)
+	}
+	return entries, nil
+}
+
+// observationAttachments lists the stored attachments referenced by matching observations
+func (s *manifestService) observationAttachments(ctx context.Context, filter ObservationFilter) ([]ArchiveEntry, error) {
+	conditions := []string{"NOT o.deleted"}
+	var args []interface{}
+	if len(filter.ObservationIDs) > 0 {
+		args = append(args, pq.Array(filter.ObservationIDs))
+		conditions = append(conditions, fmt.Sprintf("o.observation_id = ANY($%d)", len(args)))
+	}
+	if filter.FormType != "" {
+		args = append(args, filter.FormType)
+		conditions = append(conditions, fmt.Sprintf("o.form_type = $%d", len(args)))
+	}
+	if filter.SubmittedBy != "" {
+		args = append(args, filter.SubmittedBy)
+		conditions = append(conditions, fmt.Sprintf("o.submitted_by = $%d", len(args)))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		conditions = append(conditions, fmt.Sprintf("o.created_at >= $%d", len(args)))
+	}
+	if filter.Until != nil {
+		args = append(args, *filter.Until)
+		conditions = append(conditions, fmt.Sprintf("o.created_at < $%d", len(args)))
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: the observation filter needs at least one criterion", ErrInvalidArchiveRequest)
+	}
+
+	query := `
+		SELECT DISTINCT o.form_type, o.observation_id, a.attachment_id
+		FROM observations o
+		CROSS JOIN LATERAL jsonb_path_query(o.data, 'strict $.** ? (@.type() == "string")') AS v(value)
+		JOIN attachments a ON a.attachment_id = v.value #>> '{}'
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY o.form_type, o.observation_id, a.attachment_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []ArchiveEntry
+	for rows.Next() {
+		var formType, observationID, attachmentID string
+		if err := rows.Scan(&formType, &observationID, &attachmentID); err != nil {
+			return nil, fmt.Errorf("failed to scan observation attachment: %w", err)
+		}
+		entries = append(entries, ArchiveEntry{
+			AttachmentID: attachmentID,
+			Name:         path.Join(archiveName(formType), archiveName(observationID), archiveName(attachmentID)),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read observation attachments: %w", err)
+	}
+	return entries, nil
+}
+
+// archiveName makes a value usable as one path element of an archive entry
+func archiveName(value string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, value)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
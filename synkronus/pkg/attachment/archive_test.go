@@ -0,0 +1,96 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/config"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestArchiveEntries_ByID(t *testing.T) {
+	svc := NewManifestService(nil, &config.Config{Port: "8080", AttachmentArchiveMaxFiles: 2}, logger.NewLogger()).(*manifestService)
+	ctx := context.Background()
+
+	entries, err := svc.ArchiveEntries(ctx, ArchiveRequest{AttachmentIDs: []string{"a.jpg", "", "b.jpg", "a.jpg"}})
+	if err != nil {
+		t.Fatalf("ArchiveEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "a.jpg" || entries[1].AttachmentID != "b.jpg" {
+		t.Errorf("Expected a.jpg and b.jpg once each, got %+v", entries)
+	}
+
+	if _, err := svc.ArchiveEntries(ctx, ArchiveRequest{AttachmentIDs: []string{"a.jpg", "b.jpg", "c.jpg"}}); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("Expected ErrArchiveTooLarge, got %v", err)
+	}
+	if _, err := svc.ArchiveEntries(ctx, ArchiveRequest{}); !errors.Is(err, ErrInvalidArchiveRequest) {
+		t.Errorf("Expected ErrInvalidArchiveRequest for an empty request, got %v", err)
+	}
+	if _, err := svc.ArchiveEntries(ctx, ArchiveRequest{AttachmentIDs: []string{"a.jpg"}, Observations: &ObservationFilter{FormType: "survey"}}); !errors.Is(err, ErrInvalidArchiveRequest) {
+		t.Errorf("Expected ErrInvalidArchiveRequest when selecting both ways, got %v", err)
+	}
+	if _, err := svc.ArchiveEntries(ctx, ArchiveRequest{Observations: &ObservationFilter{}}); !errors.Is(err, ErrInvalidArchiveRequest) {
+		t.Errorf("Expected ErrInvalidArchiveRequest for an empty filter, got %v", err)
+	}
+}
+
+func TestArchiveEntries_ByObservations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewManifestService(db, &config.Config{Port: "8080"}, logger.NewLogger()).(*manifestService)
+
+	since := time.Date(2025, 9, 14, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 0, 1)
+	mock.ExpectQuery(`SELECT DISTINCT o.form_type, o.observation_id, a.attachment_id\s+FROM observations o\s+CROSS JOIN LATERAL jsonb_path_query.*JOIN attachments a ON a.attachment_id = v.value #>> '\{\}'\s+WHERE NOT o.deleted AND o.observation_id = ANY\(\$1\) AND o.form_type = \$2 AND o.submitted_by = \$3 AND o.created_at >= \$4 AND o.created_at < \$5`).
+		WithArgs(pq.Array([]string{"obs-1", "../obs-2"}), "household", "enumerator", since, until).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type", "observation_id", "attachment_id"}).
+			AddRow("household", "obs-1", "photo.jpg").
+			AddRow("household", "../obs-2", "sig.png"))
+
+	entries, err := svc.ArchiveEntries(context.Background(), ArchiveRequest{Observations: &ObservationFilter{
+		ObservationIDs: []string{"obs-1", "../obs-2"},
+		FormType:       "household",
+		SubmittedBy:    "enumerator",
+		Since:          &since,
+		Until:          &until,
+	}})
+	if err != nil {
+		t.Fatalf("ArchiveEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "household/obs-1/photo.jpg" || entries[1].Name != "household/.._obs-2/sig.png" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	mock.ExpectQuery(`SELECT DISTINCT`).WithArgs("survey").
+		WillReturnRows(sqlmock.NewRows([]string{"form_type", "observation_id", "attachment_id"}))
+	if _, err := svc.ArchiveEntries(context.Background(), ArchiveRequest{Observations: &ObservationFilter{FormType: "survey"}}); !errors.Is(err, ErrArchiveEmpty) {
+		t.Errorf("Expected ErrArchiveEmpty, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	tests := map[string]string{
+		"photo.jpg":     "photo.jpg",
+		"a/b\\c":        "a_b_c",
+		"..":            "_",
+		"":              "_",
+		"line\nbreak":   "line_break",
+		"über-foto.jpg": "über-foto.jpg",
+	}
+	for value, expected := range tests {
+		if got := archiveName(value); got != expected {
+			t.Errorf("archiveName(%q): expected %q, got %q", value, expected, got)
+		}
+	}
+}
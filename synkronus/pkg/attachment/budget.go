@@ -0,0 +1,275 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a manifest cursor that can't be continued
+var ErrInvalidCursor = errors.New("invalid manifest cursor")
+
+// thumbnailMaxSize is the largest image that is sent ahead of full-size files in a
+// budgeted manifest. Attachments are stored without variants, so small images stand in
+// for thumbnails.
+const thumbnailMaxSize = 64 * 1024
+
+// Priority tiers of a budgeted manifest. Deletes cost nothing and always come first.
+const (
+	tierStart = iota - 1 // Before every operation; the position of a fresh manifest
+	tierDelete
+	tierThumbnail
+	tierOriginal
+)
+
+// manifestPosition is the place of an operation in the priority order of a budgeted
+// manifest, and the continuation point of a cursor
+type manifestPosition struct {
+	Tier         int    `json:"t"`
+	ObservedAt   *int64 `json:"o,omitempty"` // Newest linked observation, Unix microseconds
+	AttachmentID string `json:"a,omitempty"`
+}
+
+// manifestCursor continues a budgeted manifest. It pins the version the first page was
+// built at so that later pages see the same operations.
+type manifestCursor struct {
+	SinceVersion int64            `json:"s"`
+	UntilVersion int64            `json:"u"`
+	After        manifestPosition `json:"p"`
+}
+
+// prioritizedOperation is an operation with its place in the priority order
+type prioritizedOperation struct {
+	op       AttachmentOperation
+	position manifestPosition
+}
+
+// comparePositions orders by tier, then newest observation first (attachments not
+// linked to an observation last), then by attachment ID
+func comparePositions(a, b manifestPosition) int {
+	if a.Tier != b.Tier {
+		return a.Tier - b.Tier
+	}
+	switch {
+	case a.ObservedAt != nil && b.ObservedAt == nil:
+		return -1
+	case a.ObservedAt == nil && b.ObservedAt != nil:
+		return 1
+	case a.ObservedAt != nil && *a.ObservedAt != *b.ObservedAt:
+		if *a.ObservedAt > *b.ObservedAt {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.AttachmentID, b.AttachmentID)
+}
+
+// operationTier places deletes first and small images ahead of other downloads
+func operationTier(op AttachmentOperation) int {
+	if op.Operation != "download" {
+		return tierDelete
+	}
+	if op.ContentType != nil && strings.HasPrefix(*op.ContentType, "image/") &&
+		op.Size != nil && *op.Size <= thumbnailMaxSize {
+		return tierThumbnail
+	}
+	return tierOriginal
+}
+
+// encodeCursor serializes a cursor for the client
+func encodeCursor(c manifestCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor from a client and checks it belongs to the request
+func decodeCursor(value string, sinceVersion, currentVersion int64) (*manifestCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c manifestCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.SinceVersion != sinceVersion {
+		return nil, fmt.Errorf("%w: since_version changed from %d", ErrInvalidCursor, c.SinceVersion)
+	}
+	if c.UntilVersion < sinceVersion || c.UntilVersion > currentVersion {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// getBudgetedManifest returns the operations between req.SinceVersion and the current
+// version in priority order, deferring downloads once req.MaxDownloadBudgetBytes is used up
+func (s *manifestService) getBudgetedManifest(ctx context.Context, req AttachmentManifestRequest, currentVersion int64) (*AttachmentManifestResponse, error) {
+	cursor := &manifestCursor{
+		SinceVersion: req.SinceVersion,
+		UntilVersion: currentVersion,
+		After:        manifestPosition{Tier: tierStart},
+	}
+	if req.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(req.Cursor, req.SinceVersion, currentVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	// Like the full manifest, but pinned to the cursor's version and with the creation
+	// time of the newest live observation referencing each downloaded attachment
+	query := `
+		WITH latest_operations AS (
+			SELECT DISTINCT ON (attachment_id)
+				attachment_id,
+				operation,
+				size,
+				content_type,
+				version
+			FROM attachment_operations
+			WHERE version > $1 AND version <= $3
+				AND (client_id = $2 OR client_id IS NULL)
+			ORDER BY attachment_id, version DESC
+		)
+		SELECT
+			l.attachment_id,
+			l.operation,
+			l.size,
+			l.content_type,
+			l.version,
+			linked.observed_at,
+			a.sha256
+		FROM latest_operations l
+		LEFT JOIN LATERAL (
+			SELECT MAX(o.created_at) AS observed_at
+			FROM observations o
+			WHERE l.operation <> 'delete'
+				AND NOT o.deleted
+				AND jsonb_path_exists(o.data, 'strict $.** ? (@ == $id)', jsonb_build_object('id', l.attachment_id::text))
+		) linked ON true
+		LEFT JOIN attachments a ON a.attachment_id = l.attachment_id AND l.operation <> 'delete'
+	`
+
+	rows, err := s.q.QueryContext(ctx, query, cursor.SinceVersion, req.ClientID, cursor.UntilVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachment operations: %w", err)
+	}
+	defer rows.Close()
+
+	known := knownHashSet(req.KnownHashes)
+	var pending []prioritizedOperation
+	for rows.Next() {
+		var op AttachmentOperation
+		var size sql.NullInt32
+		var contentType sql.NullString
+		var observedAt sql.NullTime
+		var hash sql.NullString
+
+		if err := rows.Scan(&op.AttachmentID, &op.Operation, &size, &contentType, &op.Version, &observedAt, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment operation: %w", err)
+		}
+		if size.Valid {
+			sizeInt := int(size.Int32)
+			op.Size = &sizeInt
+		}
+		if contentType.Valid {
+			op.ContentType = &contentType.String
+		}
+		if hash.Valid {
+			op.Hash = &hash.String
+		}
+		if op.Operation == "create" || op.Operation == "update" {
+			op.Operation = "download" // Normalize to download for client
+			op.Skippable = known.has(op.Hash)
+		}
+
+		position := manifestPosition{Tier: operationTier(op), AttachmentID: op.AttachmentID}
+		if observedAt.Valid {
+			micros := observedAt.Time.UnixMicro()
+			position.ObservedAt = &micros
+		}
+
+		// Operations up to the cursor were sent on earlier pages
+		if comparePositions(position, cursor.After) > 0 {
+			pending = append(pending, prioritizedOperation{op: op, position: position})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachment operations: %w", err)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return comparePositions(pending[i].position, pending[j].position) < 0
+	})
+
+	response := &AttachmentManifestResponse{
+		CurrentVersion: cursor.UntilVersion,
+		Operations:     make([]AttachmentOperation, 0, len(pending)),
+	}
+
+	// Operations are sent in priority order until the first download that doesn't fit,
+	// so everything after it is deferred and the cursor marks a single position.
+	// Skippable downloads are not transferred, so they don't use up the budget.
+	last := cursor.After
+	deferring := false
+	for _, p := range pending {
+		op := p.op
+		var size int64
+		if op.Size != nil {
+			size = int64(*op.Size)
+		}
+
+		transferred := response.TotalDownloadSize - response.SkippableDownloadSize
+		if op.Operation == "download" && (deferring || !op.Skippable && transferred+size > req.MaxDownloadBudgetBytes) {
+			deferring = true
+			op.Deferred = true
+			op.Skippable = false
+			response.DeferredDownloadSize += size
+			response.OperationCount.Deferred++
+			response.Operations = append(response.Operations, op)
+			continue
+		}
+
+		if op.Operation == "download" {
+			downloadURL, expiresAt := s.generateDownloadURL(op.AttachmentID, req.ClientID)
+			op.DownloadURL, op.URLExpiresAt = &downloadURL, expiresAt
+			response.TotalDownloadSize += size
+			response.OperationCount.Download++
+			if op.Skippable {
+				response.SkippableDownloadSize += size
+				response.OperationCount.Skippable++
+			}
+		} else if op.Operation == "delete" {
+			response.OperationCount.Delete++
+		}
+		last = p.position
+		response.Operations = append(response.Operations, op)
+	}
+
+	if deferring {
+		response.NextCursor = encodeCursor(manifestCursor{
+			SinceVersion: cursor.SinceVersion,
+			UntilVersion: cursor.UntilVersion,
+			After:        last,
+		})
+	}
+
+	s.log.Info("Generated budgeted attachment manifest",
+		"clientId", req.ClientID,
+		"sinceVersion", req.SinceVersion,
+		"untilVersion", cursor.UntilVersion,
+		"budget", req.MaxDownloadBudgetBytes,
+		"downloadCount", response.OperationCount.Download,
+		"deleteCount", response.OperationCount.Delete,
+		"deferredCount", response.OperationCount.Deferred,
+		"skippableCount", response.OperationCount.Skippable,
+		"totalDownloadSize", response.TotalDownloadSize,
+		"skippableDownloadSize", response.SkippableDownloadSize)
+
+	return response, nil
+}
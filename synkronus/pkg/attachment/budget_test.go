@@ -0,0 +1,152 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/config"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var budgetColumns = []string{"attachment_id", "operation", "size", "content_type", "version", "observed_at", "sha256"}
+
+// budgetRows returns the operations of a budgeted manifest in database order
+func budgetRows() *sqlmock.Rows {
+	older := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	return sqlmock.NewRows(budgetColumns).
+		AddRow("old-photo.jpg", "create", 500000, "image/jpeg", 11, older, hashOf("old-photo")).
+		AddRow("new-photo.jpg", "create", 400000, "image/jpeg", 12, newer, hashOf("new-photo")).
+		AddRow("new-thumb.jpg", "create", 20000, "image/jpeg", 13, newer, hashOf("new-thumb")).
+		AddRow("old-thumb.jpg", "update", 30000, "image/jpeg", 14, older, hashOf("old-thumb")).
+		AddRow("orphan.pdf", "create", 1000, "application/pdf", 15, nil, nil).
+		AddRow("removed.jpg", "delete", nil, nil, 16, nil, nil)
+}
+
+func newBudgetTestService(t *testing.T) (*manifestService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	svc := NewManifestService(db, &config.Config{Port: "8080"}, logger.NewLogger()).(*manifestService)
+	return svc, mock
+}
+
+func expectBudgetedManifest(mock sqlmock.Sqlmock, sinceVersion, currentVersion, untilVersion int64, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(currentVersion))
+	mock.ExpectExec(`INSERT INTO client_checkpoints`).
+		WithArgs("client-1", sinceVersion).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM latest_operations l\s+LEFT JOIN LATERAL`).
+		WithArgs(sinceVersion, "client-1", untilVersion).WillReturnRows(rows)
+}
+
+func operationIDs(ops []AttachmentOperation, deferred bool) []string {
+	var ids []string
+	for _, op := range ops {
+		if op.Deferred == deferred {
+			ids = append(ids, op.AttachmentID)
+		}
+	}
+	return ids
+}
+
+func TestGetManifest_DownloadBudget(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+
+	// First page: the delete, both thumbnails (newest first), then the newest original
+	expectBudgetedManifest(mock, 10, 25, 25, budgetRows())
+	first, err := svc.GetManifest(context.Background(), AttachmentManifestRequest{
+		ClientID: "client-1", SinceVersion: 10, MaxDownloadBudgetBytes: 460000,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.CurrentVersion != 25 {
+		t.Errorf("Expected current version 25, got %d", first.CurrentVersion)
+	}
+
+	sent := operationIDs(first.Operations, false)
+	want := []string{"removed.jpg", "new-thumb.jpg", "old-thumb.jpg", "new-photo.jpg"}
+	if len(sent) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, sent)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, sent)
+		}
+	}
+	if first.TotalDownloadSize != 450000 || first.OperationCount.Download != 3 || first.OperationCount.Delete != 1 {
+		t.Errorf("Unexpected totals %+v, size %d", first.OperationCount, first.TotalDownloadSize)
+	}
+
+	// Everything after the first download that doesn't fit is deferred, even if it is small
+	deferred := operationIDs(first.Operations, true)
+	if len(deferred) != 2 || deferred[0] != "old-photo.jpg" || deferred[1] != "orphan.pdf" {
+		t.Errorf("Expected old-photo.jpg and orphan.pdf to be deferred, got %v", deferred)
+	}
+	for _, op := range first.Operations {
+		if op.Deferred && op.DownloadURL != nil {
+			t.Errorf("Deferred operation %s has a download URL", op.AttachmentID)
+		}
+		if !op.Deferred && op.Operation == "download" && op.DownloadURL == nil {
+			t.Errorf("Download %s has no download URL", op.AttachmentID)
+		}
+	}
+	if first.OperationCount.Deferred != 2 || first.DeferredDownloadSize != 501000 || first.NextCursor == "" {
+		t.Fatalf("Unexpected deferral %+v, size %d, cursor %q", first.OperationCount, first.DeferredDownloadSize, first.NextCursor)
+	}
+
+	// Second page continues after new-photo.jpg, pinned to the version of the first page
+	// although more operations were recorded since
+	expectBudgetedManifest(mock, 10, 30, 25, budgetRows())
+	second, err := svc.GetManifest(context.Background(), AttachmentManifestRequest{
+		ClientID: "client-1", SinceVersion: 10, MaxDownloadBudgetBytes: 1 << 20, Cursor: first.NextCursor,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sent = operationIDs(second.Operations, false)
+	if len(sent) != 2 || sent[0] != "old-photo.jpg" || sent[1] != "orphan.pdf" {
+		t.Errorf("Expected the deferred downloads, got %v", sent)
+	}
+	if second.NextCursor != "" || second.OperationCount.Deferred != 0 || second.CurrentVersion != 25 {
+		t.Errorf("Expected the last page, got cursor %q, %+v, version %d", second.NextCursor, second.OperationCount, second.CurrentVersion)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetManifest_InvalidCursor(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+	cursor := encodeCursor(manifestCursor{SinceVersion: 10, UntilVersion: 20, After: manifestPosition{Tier: tierStart}})
+
+	for _, tc := range []struct {
+		name         string
+		cursor       string
+		sinceVersion int64
+	}{
+		{name: "garbage", cursor: "not a cursor!", sinceVersion: 10},
+		{name: "different since_version", cursor: cursor, sinceVersion: 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+				WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(30))
+			mock.ExpectExec(`INSERT INTO client_checkpoints`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			_, err := svc.GetManifest(context.Background(), AttachmentManifestRequest{
+				ClientID: "client-1", SinceVersion: tc.sinceVersion, MaxDownloadBudgetBytes: 1024, Cursor: tc.cursor,
+			})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
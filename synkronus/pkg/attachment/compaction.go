@@ -0,0 +1,188 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CompactionConfig contains attachment operation compaction configuration
+type CompactionConfig struct {
+	// Interval is how often compaction runs; 0 disables the schedule
+	Interval time.Duration
+	// ClientTTL is how long a client's checkpoint holds back compaction after it was
+	// last seen. Clients gone for longer are expected to resync from scratch.
+	ClientTTL time.Duration
+	// BatchSize caps the rows deleted per statement so compaction never holds long locks
+	BatchSize int
+}
+
+// DefaultCompactionConfig returns a default configuration
+func DefaultCompactionConfig() CompactionConfig {
+	return CompactionConfig{
+		Interval:  time.Hour,
+		ClientTTL: 90 * 24 * time.Hour,
+		BatchSize: 5000,
+	}
+}
+
+// CompactionResult summarizes a compaction run
+type CompactionResult struct {
+	Watermark  int64 `json:"watermark"`  // Operations at or below this version were considered
+	Superseded int64 `json:"superseded"` // Operations removed because a newer one replaces them
+	Deletes    int64 `json:"deletes"`    // Delete operations removed because every client has applied them
+}
+
+// CompactionService keeps attachment_operations small so manifest queries stay fast
+type CompactionService interface {
+	// Compact removes operations no client can still need and reports what was removed
+	Compact(ctx context.Context) (*CompactionResult, error)
+
+	// Start compacts on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type compactionService struct {
+	db     *sql.DB
+	config CompactionConfig
+	log    *logger.Logger
+}
+
+// NewCompactionService creates a new attachment operation compaction service
+func NewCompactionService(db *sql.DB, config CompactionConfig, log *logger.Logger) CompactionService {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultCompactionConfig().BatchSize
+	}
+	return &compactionService{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// The manifest returns the newest operation per attachment visible to a client, so an
+// operation followed by a newer one for the same audience (all clients, or the same
+// client) can never be returned again.
+const compactSupersededQuery = `DELETE FROM attachment_operations WHERE id IN (
+	SELECT op.id FROM attachment_operations op
+	WHERE op.version <= $1
+	  AND EXISTS (
+		SELECT 1 FROM attachment_operations newer
+		WHERE newer.attachment_id = op.attachment_id
+		  AND newer.version > op.version
+		  AND (newer.client_id IS NULL OR newer.client_id = op.client_id)
+	  )
+	LIMIT $2)`
+
+// A delete that is the only operation left for its attachment has been applied by every
+// tracked client, and clients starting from scratch never had the file.
+const compactDeletesQuery = `DELETE FROM attachment_operations WHERE id IN (
+	SELECT op.id FROM attachment_operations op
+	WHERE op.version <= $1
+	  AND op.operation = 'delete'
+	  AND NOT EXISTS (
+		SELECT 1 FROM attachment_operations other
+		WHERE other.attachment_id = op.attachment_id AND other.id <> op.id
+	  )
+	LIMIT $2)`
+
+// Start compacts on the configured schedule until ctx is cancelled
+func (s *compactionService) Start(ctx context.Context) {
+	if s.config.Interval <= 0 {
+		s.log.Info("Attachment operation compaction schedule disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Compact(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to compact attachment operations", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Compact removes operations no client can still need and reports what was removed
+func (s *compactionService) Compact(ctx context.Context) (result *CompactionResult, err error) {
+	ctx, span := tracing.Start(ctx, "attachment.Compact")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	start := time.Now()
+
+	// The oldest position among recently seen clients; without any there is nothing
+	// to measure against, so nothing is removed. A client's position is the lower of its
+	// attachment manifest since_version and the version it reported pulling in its sync
+	// checkpoint, as a client that fell back (e.g. after a reinstall) still needs the
+	// operations after it.
+	var watermark sql.NullInt64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT MIN(LEAST(attachment_version, pulled_version)) FROM client_checkpoints WHERE last_seen_at > $1",
+		time.Now().Add(-s.config.ClientTTL),
+	).Scan(&watermark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client checkpoints: %w", err)
+	}
+	result = &CompactionResult{}
+	if !watermark.Valid || watermark.Int64 <= 0 {
+		s.log.Debug("No client watermark, skipping attachment operation compaction")
+		return result, nil
+	}
+	result.Watermark = watermark.Int64
+	span.SetAttributes(attribute.Int64("attachment.compaction.watermark", result.Watermark))
+
+	// Superseded operations go first so deletes left on their own are removed in the same run
+	for _, stmt := range []struct {
+		name    string
+		query   string
+		removed *int64
+	}{
+		{"superseded", compactSupersededQuery, &result.Superseded},
+		{"delete", compactDeletesQuery, &result.Deletes},
+	} {
+		if *stmt.removed, err = s.deleteInBatches(ctx, stmt.query, result.Watermark); err != nil {
+			return nil, fmt.Errorf("failed to compact %s attachment operations: %w", stmt.name, err)
+		}
+	}
+
+	s.log.Info("Compacted attachment operations",
+		"watermark", result.Watermark,
+		"superseded", result.Superseded,
+		"deletes", result.Deletes,
+		"duration", time.Since(start))
+
+	return result, nil
+}
+
+// deleteInBatches runs a batched delete until a batch comes back short
+func (s *compactionService) deleteInBatches(ctx context.Context, query string, watermark int64) (int64, error) {
+	var total int64
+	for {
+		res, err := s.db.ExecContext(ctx, query, watermark, s.config.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(s.config.BatchSize) || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
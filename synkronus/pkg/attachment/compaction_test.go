@@ -0,0 +1,66 @@
+package attachment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestCompactionService_Compact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewCompactionService(db, CompactionConfig{ClientTTL: time.Hour, BatchSize: 2}, logger.NewLogger())
+
+	mock.ExpectQuery(`SELECT MIN\(LEAST\(attachment_version, pulled_version\)\) FROM client_checkpoints`).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(42))
+	// Full batches are repeated until one comes back short
+	mock.ExpectExec(`DELETE FROM attachment_operations .* newer\.version > op\.version`).
+		WithArgs(int64(42), 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM attachment_operations .* newer\.version > op\.version`).
+		WithArgs(int64(42), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM attachment_operations .* op\.operation = 'delete'`).
+		WithArgs(int64(42), 2).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := svc.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Watermark != 42 || result.Superseded != 3 || result.Deletes != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCompactionService_CompactWithoutClients(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewCompactionService(db, DefaultCompactionConfig(), logger.NewLogger())
+
+	// No recently seen client means no watermark, so nothing may be deleted
+	mock.ExpectQuery(`SELECT MIN\(LEAST\(attachment_version, pulled_version\)\) FROM client_checkpoints`).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(nil))
+
+	result, err := svc.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Watermark != 0 || result.Superseded != 0 || result.Deletes != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package attachment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ManifestETag records the client's checkpoint like GetManifest and returns the ETag of
+// the manifest GetManifest would return now, without building it. Every attachment
+// operation advances the sync version, so the manifest of a request only changes with it.
+func (s *manifestService) ManifestETag(ctx context.Context, req AttachmentManifestRequest) (string, error) {
+	var currentVersion int64
+	err := s.q.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&currentVersion)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current version: %w", err)
+	}
+
+	if req.ClientID != "" {
+		if err := s.recordCheckpoint(ctx, req.ClientID, req.SinceVersion); err != nil {
+			s.log.Warn("Failed to record client checkpoint", "clientId", req.ClientID, "error", err)
+		}
+	}
+	return s.manifestETag(req, currentVersion), nil
+}
+
+// manifestETag identifies the manifest of a request at a sync version: the version and
+// a digest of the client and the request fields that shape the manifest
+func (s *manifestService) manifestETag(req AttachmentManifestRequest, currentVersion int64) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%d\n%s\n", req.ClientID, req.SinceVersion, req.MaxDownloadBudgetBytes, req.Cursor)
+	known := make([]string, len(req.KnownHashes))
+	for i, hash := range req.KnownHashes {
+		known[i] = strings.ToLower(hash)
+	}
+	sort.Strings(known)
+	for _, hash := range known {
+		io.WriteString(h, hash+"\n")
+	}
+
+	// Signed download URLs expire, so a client only keeps using a manifest for half their
+	// lifetime; its URLs are then still valid for at least the other half
+	if s.signer != nil {
+		if window := int64(s.signer.ttl.Seconds() / 2); window > 0 {
+			fmt.Fprintf(h, "%d\n", s.signer.now().Unix()/window)
+		}
+	}
+	return fmt.Sprintf("\"%d-%s\"", currentVersion, hex.EncodeToString(h.Sum(nil))[:16])
+}
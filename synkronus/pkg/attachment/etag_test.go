@@ -0,0 +1,63 @@
+package attachment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestManifestETag(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+	req := AttachmentManifestRequest{ClientID: "client-1", SinceVersion: 10, KnownHashes: []string{hashOf("a"), hashOf("b")}}
+
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(20))
+	mock.ExpectExec(`INSERT INTO client_checkpoints`).
+		WithArgs("client-1", 10).WillReturnResult(sqlmock.NewResult(0, 1))
+	etag, err := svc.ManifestETag(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if etag != svc.manifestETag(req, 20) {
+		t.Errorf("Expected the ETag GetManifest sets, got %s", etag)
+	}
+
+	// The order of known hashes doesn't matter; the version and every other field do
+	reordered := req
+	reordered.KnownHashes = []string{hashOf("b"), hashOf("a")}
+	if svc.manifestETag(reordered, 20) != etag {
+		t.Errorf("Expected the same ETag for reordered known hashes")
+	}
+	if svc.manifestETag(req, 21) == etag {
+		t.Errorf("Expected a new ETag after the version advanced")
+	}
+	for _, changed := range []AttachmentManifestRequest{
+		{ClientID: "client-2", SinceVersion: 10, KnownHashes: req.KnownHashes},
+		{ClientID: "client-1", SinceVersion: 11, KnownHashes: req.KnownHashes},
+		{ClientID: "client-1", SinceVersion: 10, KnownHashes: req.KnownHashes, MaxDownloadBudgetBytes: 1000},
+		{ClientID: "client-1", SinceVersion: 10},
+	} {
+		if svc.manifestETag(changed, 20) == etag {
+			t.Errorf("Expected a different ETag for %+v", changed)
+		}
+	}
+
+	// With signed URLs a manifest is only reused for half their lifetime
+	now := time.Unix(1800*1000, 0)
+	svc.signer = NewURLSigner("secret", time.Hour)
+	svc.signer.now = func() time.Time { return now }
+	signed := svc.manifestETag(req, 20)
+	now = now.Add(29 * time.Minute)
+	if svc.manifestETag(req, 20) != signed {
+		t.Errorf("Expected the same ETag within the signing window")
+	}
+	now = now.Add(31 * time.Minute)
+	if svc.manifestETag(req, 20) == signed {
+		t.Errorf("Expected a new ETag once cached download URLs would run short")
+	}
+}
@@ -0,0 +1,513 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+)
+
+// ExifPolicy decides what happens to the EXIF metadata of uploaded JPEG and PNG images
+type ExifPolicy string
+
+const (
+	// ExifKeep stores images as uploaded
+	ExifKeep ExifPolicy = "keep"
+	// ExifStrip removes the GPS position and capture times from images before they are
+	// stored, along with XMP metadata. Orientation and camera details are kept so images
+	// still display upright.
+	ExifStrip ExifPolicy = "strip"
+	// ExifExtract stores images as uploaded and records their EXIF in the attachment metadata
+	ExifExtract ExifPolicy = "extract"
+)
+
+// ErrInvalidExifPolicy is returned for an unknown EXIF policy
+var ErrInvalidExifPolicy = errors.New("invalid EXIF policy")
+
+// ParseExifPolicy parses an EXIF policy name; empty yields ExifKeep
+func ParseExifPolicy(name string) (ExifPolicy, error) {
+	switch policy := ExifPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return ExifKeep, nil
+	case ExifKeep, ExifStrip, ExifExtract:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w %q: expected keep, strip or extract", ErrInvalidExifPolicy, name)
+	}
+}
+
+// ExifData is the EXIF metadata extracted from an image
+type ExifData struct {
+	Make        string `json:"make,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Software    string `json:"software,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+	// TakenAt is the capture time as recorded by the camera, as 2006-01-02T15:04:05 with
+	// the UTC offset appended when the image has one
+	TakenAt   string   `json:"taken_at,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Altitude is in meters above sea level
+	Altitude *float64 `json:"altitude,omitempty"`
+}
+
+var (
+	jpegMagic = []byte{0xFF, 0xD8, 0xFF}
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// isImage reports whether head starts like an image whose EXIF can be processed
+func isImage(head []byte) bool {
+	return bytes.HasPrefix(head, jpegMagic) || bytes.HasPrefix(head, pngMagic)
+}
+
+// processImage applies an EXIF policy to the content of a JPEG or PNG image. data may be
+// modified in place. Images too broken to find their metadata are returned unchanged.
+func processImage(data []byte, policy ExifPolicy) ([]byte, *ExifData) {
+	var out []byte
+	var exif *ExifData
+	var err error
+	switch {
+	case bytes.HasPrefix(data, jpegMagic):
+		out, exif, err = processJPEG(data, policy)
+	case bytes.HasPrefix(data, pngMagic):
+		out, exif, err = processPNG(data, policy)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return data, nil
+	}
+	return out, exif
+}
+
+// XMP packets repeat the EXIF fields, GPS position included
+var (
+	jpegExifHeader = []byte("Exif\x00\x00")
+	jpegXMPHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	pngXMPKeyword  = []byte("XML:com.adobe.xmp\x00")
+)
+
+// processJPEG walks the segments in front of the image data of a JPEG
+func processJPEG(data []byte, policy ExifPolicy) ([]byte, *ExifData, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	var exif *ExifData
+
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, nil, fmt.Errorf("invalid JPEG marker at %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		// The image data follows the start of scan and runs to the end of the file
+		if marker == 0xDA || marker == 0xD9 {
+			return append(out, data[pos:]...), exif, nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, nil, fmt.Errorf("truncated JPEG segment at %d", pos)
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) || end < pos+4 {
+			return nil, nil, fmt.Errorf("invalid JPEG segment length at %d", pos)
+		}
+		segment, payload := data[pos:end], data[pos+4:end]
+
+		keep := true
+		if marker == 0xE1 {
+			switch {
+			case bytes.HasPrefix(payload, jpegExifHeader):
+				keep = applyExifPolicy(payload[len(jpegExifHeader):], policy, &exif)
+			case bytes.HasPrefix(payload, jpegXMPHeader):
+				keep = policy != ExifStrip
+			}
+		}
+		if keep {
+			out = append(out, segment...)
+		}
+		pos = end
+	}
+}
+
+// processPNG walks the chunks of a PNG, where EXIF is stored in an eXIf chunk and XMP in
+// an iTXt chunk
+func processPNG(data []byte, policy ExifPolicy) ([]byte, *ExifData, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngMagic...)
+	var exif *ExifData
+
+	pos := len(pngMagic)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, nil, fmt.Errorf("truncated PNG chunk at %d", pos)
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) || end < pos {
+			return nil, nil, fmt.Errorf("invalid PNG chunk length at %d", pos)
+		}
+		chunkType, payload := data[pos+4:pos+8], data[pos+8:pos+8+length]
+
+		keep := true
+		switch string(chunkType) {
+		case "eXIf":
+			keep = applyExifPolicy(payload, policy, &exif)
+			if keep && policy == ExifStrip {
+				binary.BigEndian.PutUint32(data[end-4:], crc32.ChecksumIEEE(data[pos+4:end-4]))
+			}
+		case "iTXt":
+			keep = policy != ExifStrip || !bytes.HasPrefix(payload, pngXMPKeyword)
+		}
+		if keep {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if string(chunkType) == "IEND" {
+			break
+		}
+	}
+	return out, exif, nil
+}
+
+// applyExifPolicy scrubs or extracts a TIFF-formatted EXIF block and reports whether the
+// block is kept. A block that can't be scrubbed is dropped as a whole.
+func applyExifPolicy(block []byte, policy ExifPolicy, exif **ExifData) bool {
+	switch policy {
+	case ExifStrip:
+		t, err := parseTIFF(block)
+		if err != nil {
+			return false
+		}
+		return t.scrub() == nil
+	case ExifExtract:
+		if t, err := parseTIFF(block); err == nil && *exif == nil {
+			*exif = t.extract()
+		}
+	}
+	return true
+}
+
+// TIFF tags read or scrubbed
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagSoftware           = 0x0131
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+	tagGPSAltitudeRef     = 0x0005
+	tagGPSAltitude        = 0x0006
+)
+
+// timeTags are the tags of IFD0 and the Exif IFD that record when an image was taken
+var timeTags = map[uint16]bool{
+	tagDateTime:           true,
+	tagDateTimeOriginal:   true,
+	0x9004:                true, // DateTimeDigitized
+	0x9010:                true, // OffsetTime
+	tagOffsetTimeOriginal: true,
+	0x9012:                true, // OffsetTimeDigitized
+	0x9290:                true, // SubSecTime
+	0x9291:                true, // SubSecTimeOriginal
+	0x9292:                true, // SubSecTimeDigitized
+}
+
+// tiffTypeSizes are the sizes in bytes of the TIFF field types
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// tiff is a TIFF-formatted EXIF block
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+	ifd0  int
+}
+
+// ifdEntry is one field of an image file directory. value is a slice of the block, so
+// writing to it changes the block.
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count int
+	value []byte
+}
+
+// ifd is an image file directory with the offset of its entry count
+type ifd struct {
+	offset  int
+	entries []ifdEntry
+}
+
+func parseTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated TIFF header")
+	}
+	t := &tiff{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid TIFF header")
+	}
+	t.ifd0 = int(t.order.Uint32(data[4:]))
+	return t, nil
+}
+
+// readIFD reads the directory at offset
+func (t *tiff) readIFD(offset int) (*ifd, error) {
+	if offset < 8 || offset+2 > len(t.data) {
+		return nil, fmt.Errorf("IFD offset %d out of range", offset)
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	if offset+2+n*12 > len(t.data) {
+		return nil, fmt.Errorf("IFD at %d is truncated", offset)
+	}
+
+	dir := &ifd{offset: offset, entries: make([]ifdEntry, 0, n)}
+	for i := 0; i < n; i++ {
+		raw := t.data[offset+2+i*12 : offset+2+(i+1)*12]
+		entry := ifdEntry{
+			tag:   t.order.Uint16(raw),
+			typ:   t.order.Uint16(raw[2:]),
+			count: int(t.order.Uint32(raw[4:])),
+		}
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok || entry.count < 0 || entry.count > len(t.data) {
+			// Unknown types can't be located; they aren't ones we read or scrub
+			continue
+		}
+		length := size * entry.count
+		if length <= 4 {
+			entry.value = raw[8 : 8+length]
+		} else {
+			start := int(t.order.Uint32(raw[8:]))
+			if start < 0 || start+length > len(t.data) || start+length < start {
+				return nil, fmt.Errorf("value of tag 0x%04X out of range", entry.tag)
+			}
+			entry.value = t.data[start : start+length]
+		}
+		dir.entries = append(dir.entries, entry)
+	}
+	return dir, nil
+}
+
+// subIFD reads the directory a pointer tag of dir refers to; nil when dir has no such tag
+func (t *tiff) subIFD(dir *ifd, tag uint16) (*ifd, error) {
+	for _, entry := range dir.entries {
+		if entry.tag == tag && len(entry.value) == 4 {
+			return t.readIFD(int(t.order.Uint32(entry.value)))
+		}
+	}
+	return nil, nil
+}
+
+// scrub zeroes the capture times and the whole GPS directory in place
+func (t *tiff) scrub() error {
+	ifd0, err := t.readIFD(t.ifd0)
+	if err != nil {
+		return err
+	}
+	exifIFD, err := t.subIFD(ifd0, tagExifIFD)
+	if err != nil {
+		return err
+	}
+	gpsIFD, err := t.subIFD(ifd0, tagGPSIFD)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []*ifd{ifd0, exifIFD} {
+		if dir == nil {
+			continue
+		}
+		for _, entry := range dir.entries {
+			if timeTags[entry.tag] {
+				clear(entry.value)
+			}
+		}
+	}
+	if gpsIFD != nil {
+		for _, entry := range gpsIFD.entries {
+			clear(entry.value)
+		}
+		// An empty directory keeps the pointer in IFD0 valid
+		n := int(t.order.Uint16(t.data[gpsIFD.offset:]))
+		clear(t.data[gpsIFD.offset : gpsIFD.offset+2+n*12])
+	}
+	return nil
+}
+
+// extract reads the camera, capture time and GPS position; nil when none are present
+func (t *tiff) extract() *ExifData {
+	ifd0, err := t.readIFD(t.ifd0)
+	if err != nil {
+		return nil
+	}
+	exif := &ExifData{}
+	var dateTime, dateTimeOriginal, offsetTimeOriginal string
+	for _, entry := range ifd0.entries {
+		switch entry.tag {
+		case tagMake:
+			exif.Make = t.ascii(entry)
+		case tagModel:
+			exif.Model = t.ascii(entry)
+		case tagSoftware:
+			exif.Software = t.ascii(entry)
+		case tagOrientation:
+			exif.Orientation = t.uint(entry)
+		case tagDateTime:
+			dateTime = t.ascii(entry)
+		}
+	}
+
+	if exifIFD, err := t.subIFD(ifd0, tagExifIFD); err == nil && exifIFD != nil {
+		for _, entry := range exifIFD.entries {
+			switch entry.tag {
+			case tagDateTimeOriginal:
+				dateTimeOriginal = t.ascii(entry)
+			case tagOffsetTimeOriginal:
+				offsetTimeOriginal = t.ascii(entry)
+			}
+		}
+	}
+	if dateTimeOriginal != "" {
+		exif.TakenAt = exifTime(dateTimeOriginal, offsetTimeOriginal)
+	} else {
+		exif.TakenAt = exifTime(dateTime, "")
+	}
+
+	if gpsIFD, err := t.subIFD(ifd0, tagGPSIFD); err == nil && gpsIFD != nil {
+		t.extractGPS(gpsIFD, exif)
+	}
+
+	if *exif == (ExifData{}) {
+		return nil
+	}
+	return exif
+}
+
+// extractGPS reads the position of the GPS directory
+func (t *tiff) extractGPS(dir *ifd, exif *ExifData) {
+	var latRef, lonRef string
+	var lat, lon, alt []float64
+	altRef := 0
+	for _, entry := range dir.entries {
+		switch entry.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.ascii(entry)
+		case tagGPSLatitude:
+			lat = t.rationals(entry)
+		case tagGPSLongitudeRef:
+			lonRef = t.ascii(entry)
+		case tagGPSLongitude:
+			lon = t.rationals(entry)
+		case tagGPSAltitudeRef:
+			altRef = t.uint(entry)
+		case tagGPSAltitude:
+			alt = t.rationals(entry)
+		}
+	}
+
+	if value, ok := degrees(lat, latRef, "S"); ok && math.Abs(value) <= 90 {
+		exif.Latitude = &value
+	}
+	if value, ok := degrees(lon, lonRef, "W"); ok && math.Abs(value) <= 180 {
+		exif.Longitude = &value
+	}
+	if len(alt) == 1 && !math.IsNaN(alt[0]) {
+		value := alt[0]
+		if altRef == 1 {
+			value = -value
+		}
+		exif.Altitude = &value
+	}
+}
+
+// degrees converts degrees, minutes and seconds to decimal degrees, negative for the
+// negative reference
+func degrees(dms []float64, ref, negative string) (float64, bool) {
+	if len(dms) != 3 {
+		return 0, false
+	}
+	value := dms[0] + dms[1]/60 + dms[2]/3600
+	if math.IsNaN(value) {
+		return 0, false
+	}
+	if strings.EqualFold(ref, negative) {
+		value = -value
+	}
+	return value, true
+}
+
+// exifTime turns an EXIF "2006:01:02 15:04:05" time into 2006-01-02T15:04:05, with the
+// offset appended when there is one
+func exifTime(value, offset string) string {
+	if len(value) != 19 || value == "0000:00:00 00:00:00" {
+		return ""
+	}
+	t := strings.Replace(value[:10], ":", "-", 2) + "T" + value[11:]
+	if len(offset) == 6 && (offset[0] == '+' || offset[0] == '-') {
+		t += offset
+	}
+	return t
+}
+
+func (t *tiff) ascii(entry ifdEntry) string {
+	if entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiff) uint(entry ifdEntry) int {
+	switch {
+	case entry.typ == 3 && len(entry.value) >= 2:
+		return int(t.order.Uint16(entry.value))
+	case entry.typ == 4 && len(entry.value) >= 4:
+		return int(t.order.Uint32(entry.value))
+	case entry.typ == 1 && len(entry.value) >= 1:
+		return int(entry.value[0])
+	}
+	return 0
+}
+
+// rationals reads unsigned rationals; a zero denominator yields NaN
+func (t *tiff) rationals(entry ifdEntry) []float64 {
+	if entry.typ != 5 {
+		return nil
+	}
+	values := make([]float64, 0, entry.count)
+	for i := 0; i+8 <= len(entry.value); i += 8 {
+		num, den := t.order.Uint32(entry.value[i:]), t.order.Uint32(entry.value[i+4:])
+		if den == 0 {
+			values = append(values, math.NaN())
+			continue
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
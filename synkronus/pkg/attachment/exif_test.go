@@ -0,0 +1,290 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// buildTIFF lays out little-endian directories one after the other, followed by the
+// values that don't fit in an entry. The value of an Exif or GPS pointer entry is the
+// index of the directory it points to.
+func buildTIFF(ifds ...[]testEntry) []byte {
+	le := binary.LittleEndian
+	offsets := make([]int, len(ifds))
+	pos := 8
+	for i, entries := range ifds {
+		offsets[i] = pos
+		pos += 2 + 12*len(entries) + 4
+	}
+
+	out := []byte("II*\x00\x08\x00\x00\x00")
+	var values []byte
+	for _, entries := range ifds {
+		out = le.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = le.AppendUint16(out, e.tag)
+			out = le.AppendUint16(out, e.typ)
+			out = le.AppendUint32(out, e.count)
+			switch {
+			case e.tag == tagExifIFD || e.tag == tagGPSIFD:
+				out = le.AppendUint32(out, uint32(offsets[e.value[0]]))
+			case len(e.value) <= 4:
+				out = append(out, append(e.value, make([]byte, 4-len(e.value))...)...)
+			default:
+				out = le.AppendUint32(out, uint32(pos+len(values)))
+				values = append(values, e.value...)
+			}
+		}
+		out = le.AppendUint32(out, 0)
+	}
+	return append(out, values...)
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func rationalEntry(tag uint16, values ...uint32) testEntry {
+	var b []byte
+	for i := 0; i < len(values); i += 2 {
+		b = binary.LittleEndian.AppendUint32(b, values[i])
+		b = binary.LittleEndian.AppendUint32(b, values[i+1])
+	}
+	return testEntry{tag, 5, uint32(len(values) / 2), b}
+}
+
+// testExif is the EXIF of a phone photo taken at 1°30'S 36°45'E, 1500 m up
+func testExif() []byte {
+	return buildTIFF(
+		[]testEntry{
+			asciiEntry(tagMake, "Acme"),
+			asciiEntry(tagModel, "Phone 9"),
+			{tagOrientation, 3, 1, []byte{6, 0}},
+			asciiEntry(tagDateTime, "2024:05:01 10:20:31"),
+			{tagExifIFD, 4, 1, []byte{1}},
+			{tagGPSIFD, 4, 1, []byte{2}},
+		},
+		[]testEntry{
+			asciiEntry(tagDateTimeOriginal, "2024:05:01 10:20:30"),
+			asciiEntry(tagOffsetTimeOriginal, "+03:00"),
+		},
+		[]testEntry{
+			asciiEntry(tagGPSLatitudeRef, "S"),
+			rationalEntry(tagGPSLatitude, 1, 1, 30, 1, 0, 1),
+			asciiEntry(tagGPSLongitudeRef, "E"),
+			rationalEntry(tagGPSLongitude, 36, 1, 45, 1, 0, 1),
+			{tagGPSAltitudeRef, 1, 1, []byte{0}},
+			rationalEntry(tagGPSAltitude, 3000, 2),
+		},
+	)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+}
+
+// scanData stands in for the compressed image, which processing must not touch
+var scanData = []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0x00, 0x56, 0xFF, 0xD9}
+
+func testJPEG(exif []byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, jpegSegment(0xE0, []byte("JFIF\x00\x01\x02"))...)
+	data = append(data, jpegSegment(0xE1, append([]byte("Exif\x00\x00"), exif...))...)
+	data = append(data, jpegSegment(0xE1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), "<x:xmpmeta/>"...))...)
+	return append(data, scanData...)
+}
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	b = append(b, chunkType...)
+	b = append(b, payload...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func testPNG(exif []byte) []byte {
+	data := append([]byte{}, pngMagic...)
+	data = append(data, pngChunk("IHDR", make([]byte, 13))...)
+	data = append(data, pngChunk("eXIf", exif)...)
+	data = append(data, pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00"), "<x:xmpmeta/>"...))...)
+	data = append(data, pngChunk("IDAT", []byte{1, 2, 3})...)
+	return append(data, pngChunk("IEND", nil)...)
+}
+
+func assertFloat(t *testing.T, name string, expected float64, actual *float64) {
+	t.Helper()
+	if actual == nil || math.Abs(*actual-expected) > 1e-9 {
+		t.Errorf("Expected %s %v, got %v", name, expected, actual)
+	}
+}
+
+func TestParseExifPolicy(t *testing.T) {
+	for name, expected := range map[string]ExifPolicy{"": ExifKeep, "keep": ExifKeep, " Strip ": ExifStrip, "extract": ExifExtract} {
+		if policy, err := ParseExifPolicy(name); err != nil || policy != expected {
+			t.Errorf("ParseExifPolicy(%q) = %q, %v; expected %q", name, policy, err, expected)
+		}
+	}
+	if _, err := ParseExifPolicy("remove"); !errors.Is(err, ErrInvalidExifPolicy) {
+		t.Errorf("Expected ErrInvalidExifPolicy, got %v", err)
+	}
+}
+
+func TestProcessImage_Extract(t *testing.T) {
+	for name, data := range map[string][]byte{"jpeg": testJPEG(testExif()), "png": testPNG(testExif())} {
+		t.Run(name, func(t *testing.T) {
+			original := append([]byte{}, data...)
+			out, exif := processImage(data, ExifExtract)
+			if !bytes.Equal(out, original) {
+				t.Error("Expected the image to be unchanged")
+			}
+			if exif == nil {
+				t.Fatal("Expected EXIF")
+			}
+			if exif.Make != "Acme" || exif.Model != "Phone 9" || exif.Orientation != 6 {
+				t.Errorf("Unexpected camera details: %+v", exif)
+			}
+			if exif.TakenAt != "2024-05-01T10:20:30+03:00" {
+				t.Errorf("Expected the original capture time, got %q", exif.TakenAt)
+			}
+			assertFloat(t, "latitude", -1.5, exif.Latitude)
+			assertFloat(t, "longitude", 36.75, exif.Longitude)
+			assertFloat(t, "altitude", 1500, exif.Altitude)
+		})
+	}
+}
+
+func TestProcessImage_StripJPEG(t *testing.T) {
+	out, exif := processImage(testJPEG(testExif()), ExifStrip)
+	if exif != nil {
+		t.Errorf("Expected no EXIF to be recorded, got %+v", exif)
+	}
+	if !bytes.HasSuffix(out, scanData) {
+		t.Error("Expected the image data to be unchanged")
+	}
+	if bytes.Contains(out, []byte("xmpmeta")) {
+		t.Error("Expected the XMP segment to be removed")
+	}
+	if bytes.Contains(out, []byte("2024:05:01")) || bytes.Contains(out, []byte("+03:00")) {
+		t.Error("Expected the capture times to be removed")
+	}
+
+	_, remaining := processImage(out, ExifExtract)
+	if remaining == nil || remaining.Make != "Acme" || remaining.Orientation != 6 {
+		t.Fatalf("Expected camera details and orientation to be kept, got %+v", remaining)
+	}
+	if remaining.Latitude != nil || remaining.Longitude != nil || remaining.Altitude != nil || remaining.TakenAt != "" {
+		t.Errorf("Expected no position or capture time, got %+v", remaining)
+	}
+}
+
+func TestProcessImage_StripPNG(t *testing.T) {
+	out, _ := processImage(testPNG(testExif()), ExifStrip)
+	if bytes.Contains(out, []byte("xmpmeta")) {
+		t.Error("Expected the XMP chunk to be removed")
+	}
+
+	// Every chunk must still carry a valid checksum
+	for pos := len(pngMagic); pos < len(out); {
+		length := int(binary.BigEndian.Uint32(out[pos:]))
+		end := pos + 12 + length
+		if crc32.ChecksumIEEE(out[pos+4:end-4]) != binary.BigEndian.Uint32(out[end-4:]) {
+			t.Errorf("Invalid checksum of chunk %s", out[pos+4:pos+8])
+		}
+		pos = end
+	}
+
+	_, remaining := processImage(out, ExifExtract)
+	if remaining == nil || remaining.Latitude != nil || remaining.TakenAt != "" {
+		t.Errorf("Expected EXIF without position or capture time, got %+v", remaining)
+	}
+}
+
+func TestProcessImage_StripDropsUnreadableExif(t *testing.T) {
+	out, _ := processImage(testJPEG([]byte("not a TIFF block")), ExifStrip)
+	if bytes.Contains(out, []byte("Exif\x00\x00")) {
+		t.Error("Expected the unreadable EXIF segment to be removed")
+	}
+	if !bytes.HasSuffix(out, scanData) {
+		t.Error("Expected the image data to be unchanged")
+	}
+}
+
+func TestProcessImage_BrokenImageUnchanged(t *testing.T) {
+	data := testJPEG(testExif())[:20]
+	original := append([]byte{}, data...)
+	out, exif := processImage(data, ExifStrip)
+	if !bytes.Equal(out, original) || exif != nil {
+		t.Error("Expected a truncated image to be stored as uploaded")
+	}
+}
+
+func TestSave_ExifPolicies(t *testing.T) {
+	newService := func(t *testing.T, policy string) *service {
+		svc, err := NewService(&config.Config{DataDir: t.TempDir(), AttachmentExifPolicy: policy})
+		if err != nil {
+			t.Fatalf("Failed to create service: %v", err)
+		}
+		return svc.(*service)
+	}
+	ctx := context.Background()
+
+	t.Run("strip", func(t *testing.T) {
+		s := newService(t, "strip")
+		result, err := s.Save(ctx, "photo.jpg", bytes.NewReader(testJPEG(testExif())), PolicyIdempotent)
+		if err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		stored, _ := os.ReadFile(filepath.Join(s.storagePath, "photo.jpg"))
+		if bytes.Contains(stored, []byte("2024:05:01")) || int64(len(stored)) != result.Size {
+			t.Error("Expected the stripped image to be stored")
+		}
+
+		// The same photo uploaded again strips to the same content
+		again, err := s.Save(ctx, "photo.jpg", bytes.NewReader(testJPEG(testExif())), PolicyIdempotent)
+		if err != nil || again.Outcome != OutcomeUnchanged {
+			t.Errorf("Expected a repeated upload to be unchanged, got %+v, %v", again, err)
+		}
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		s := newService(t, "extract")
+		result, err := s.Save(ctx, "photo.jpg", bytes.NewReader(testJPEG(testExif())), "")
+		if err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		if result.Exif == nil || result.Exif.Latitude == nil {
+			t.Errorf("Expected extracted EXIF, got %+v", result.Exif)
+		}
+	})
+
+	t.Run("other files are stored as uploaded", func(t *testing.T) {
+		s := newService(t, "strip")
+		if _, err := s.Save(ctx, "notes.txt", bytes.NewReader([]byte("hi")), ""); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		if content := readAttachment(t, s, "notes.txt"); content != "hi" {
+			t.Errorf("Expected the file to be unchanged, got %q", content)
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		if _, err := NewService(&config.Config{DataDir: t.TempDir(), AttachmentExifPolicy: "remove"}); !errors.Is(err, ErrInvalidExifPolicy) {
+			t.Errorf("Expected ErrInvalidExifPolicy, got %v", err)
+		}
+	})
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/opendataensemble/synkronus/pkg/config"
+	"github.com/opendataensemble/synkronus/pkg/database"
 	"github.com/opendataensemble/synkronus/pkg/logger"
 )
 
@@ -19,12 +21,30 @@ type AttachmentOperation struct {
 	Size         *int    `json:"size,omitempty" db:"size"`
 	ContentType  *string `json:"content_type,omitempty" db:"content_type"`
 	Version      int64   `json:"version" db:"version"`
+	// Hash is the hex SHA-256 of the content to download, when it was recorded on upload
+	Hash *string `json:"hash,omitempty" db:"sha256"`
+	// Skippable marks downloads whose hash is in the request's known_hashes; the client
+	// already holds the content and can copy it instead of downloading it
+	Skippable bool `json:"skippable,omitempty"`
+	// Deferred marks downloads left out of a budgeted manifest; they have no download URL
+	Deferred bool `json:"deferred,omitempty"`
+	// URLExpiresAt is when a signed DownloadURL stops working; nil for permanent paths.
+	// Expired URLs are renewed through POST /attachments/manifest/refresh.
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
 }
 
 // AttachmentManifestRequest represents the request for attachment manifest
 type AttachmentManifestRequest struct {
 	ClientID     string `json:"client_id"`
 	SinceVersion int64  `json:"since_version"`
+	// MaxDownloadBudgetBytes limits the downloads in the manifest to this many bytes,
+	// newest observations and thumbnails first; 0 returns every download
+	MaxDownloadBudgetBytes int64 `json:"max_download_budget_bytes,omitempty"`
+	// Cursor continues a budgeted manifest from the next_cursor of the previous one
+	Cursor string `json:"cursor,omitempty"`
+	// KnownHashes are the hex SHA-256 hashes of files the client already holds, e.g.
+	// restored from a backup or shared with another app on the device
+	KnownHashes []string `json:"known_hashes,omitempty"`
 }
 
 // AttachmentManifestResponse represents the response containing attachment manifest
@@ -33,12 +53,35 @@ type AttachmentManifestResponse struct {
 	Operations        []AttachmentOperation `json:"operations"`
 	TotalDownloadSize int64                 `json:"total_download_size"`
 	OperationCount    OperationCount        `json:"operation_count"`
+	// DeferredDownloadSize is the total size of the deferred downloads
+	DeferredDownloadSize int64 `json:"deferred_download_size,omitempty"`
+	// SkippableDownloadSize is the total size of the skippable downloads, the bytes the
+	// client saves by skipping them
+	SkippableDownloadSize int64 `json:"skippable_download_size,omitempty"`
+	// NextCursor is set when downloads were deferred. Request it with the same
+	// since_version, and only advance to current_version once no cursor is returned.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// ETag identifies the manifest for conditional requests; it is sent as a header
+	ETag string `json:"-"`
 }
 
 // OperationCount represents the count of operations by type
 type OperationCount struct {
 	Download int `json:"download"`
 	Delete   int `json:"delete"`
+	Deferred int `json:"deferred,omitempty"`
+	// Skippable counts downloads the client can skip; they are also counted in Download
+	Skippable int `json:"skippable,omitempty"`
+}
+
+// DownloadEvent describes a single attachment download for auditing
+type DownloadEvent struct {
+	AttachmentID string
+	Username     string
+	ClientID     string
+	IPAddress    string
+	UserAgent    string
+	Signed       bool // true if access was granted by a signed URL
 }
 
 // ManifestService defines the interface for attachment manifest operations
@@ -46,19 +89,48 @@ type ManifestService interface {
 	// GetManifest returns attachment operations since the specified version
 	GetManifest(ctx context.Context, req AttachmentManifestRequest) (*AttachmentManifestResponse, error)
 
+	// ManifestETag returns the ETag of the manifest GetManifest would return for req, so
+	// unchanged manifests can be answered with 304 without building them
+	ManifestETag(ctx context.Context, req AttachmentManifestRequest) (string, error)
+
 	// RecordOperation records an attachment operation for sync tracking
 	RecordOperation(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error
 
+	// RecordDownload writes an audit entry for an attachment download
+	RecordDownload(ctx context.Context, event DownloadEvent) error
+
+	// RecordMetadata stores the metadata of a newly uploaded attachment
+	RecordMetadata(ctx context.Context, meta Metadata) error
+
+	// GetMetadata returns the stored metadata of an attachment; it returns
+	// ErrMetadataNotFound when none is stored
+	GetMetadata(ctx context.Context, attachmentID string) (*Metadata, error)
+
+	// VerifyDownloadURL checks a signed download URL; it returns ErrInvalidSignature
+	// when signing is disabled or the signature does not match
+	VerifyDownloadURL(attachmentID, clientID, expires, signature string) error
+
+	// RefreshDownloadURLs issues new download URLs for attachments of an earlier manifest
+	// whose URLs expired before the client got to them
+	RefreshDownloadURLs(ctx context.Context, req RefreshURLsRequest) (*RefreshURLsResponse, error)
+
+	// ArchiveEntries resolves an archive request to the files of the archive; it returns
+	// ErrArchiveEmpty when nothing is selected and ErrArchiveTooLarge when too much is
+	ArchiveEntries(ctx context.Context, req ArchiveRequest) ([]ArchiveEntry, error)
+
 	// Initialize initializes the manifest service
 	Initialize(ctx context.Context) error
 }
 
 // manifestService implements ManifestService
 type manifestService struct {
-	db      *sql.DB
+	db *sql.DB
+	// q runs the manifest queries clients poll; the statement cache when there is one
+	q       database.Querier
 	cfg     *config.Config
 	log     *logger.Logger
 	baseURL string
+	signer  *URLSigner // nil when signed URLs are disabled
 }
 
 // NewManifestService creates a new attachment manifest service
@@ -66,14 +138,73 @@ func NewManifestService(db *sql.DB, cfg *config.Config, log *logger.Logger) Mani
 	// Construct base URL from config port
 	baseURL := fmt.Sprintf("http://localhost:%s", cfg.Port)
 
+	// Issue expiring signed URLs instead of permanent paths when a TTL is configured
+	var signer *URLSigner
+	if cfg.AttachmentURLTTL > 0 {
+		secret := cfg.AttachmentURLSecret
+		if secret == "" {
+			secret = cfg.JWTSecret
+		}
+		signer = NewURLSigner(secret, time.Duration(cfg.AttachmentURLTTL)*time.Second)
+	}
+
 	return &manifestService{
 		db:      db,
+		q:       db,
 		cfg:     cfg,
 		log:     log,
 		baseURL: baseURL,
+		signer:  signer,
 	}
 }
 
+// NewCachedManifestService creates an attachment manifest service that runs the manifest
+// queries clients poll as prepared statements from stmts; a nil stmts runs them unprepared
+func NewCachedManifestService(db *sql.DB, stmts *database.StatementCache, cfg *config.Config, log *logger.Logger) ManifestService {
+	svc := NewManifestService(db, cfg, log).(*manifestService)
+	if stmts != nil {
+		svc.q = stmts
+	}
+	return svc
+}
+
+// retryManifestService retries manifest queries failing with connection errors
+type retryManifestService struct {
+	ManifestService
+	retry *database.Retrier
+}
+
+// WithRetry wraps svc so GetManifest is retried when it fails with a connection error,
+// e.g. during a primary failover
+func WithRetry(svc ManifestService, retry *database.Retrier) ManifestService {
+	if retry == nil {
+		return svc
+	}
+	return &retryManifestService{ManifestService: svc, retry: retry}
+}
+
+// GetManifest returns attachment operations since the specified version
+func (s *retryManifestService) GetManifest(ctx context.Context, req AttachmentManifestRequest) (*AttachmentManifestResponse, error) {
+	var manifest *AttachmentManifestResponse
+	err := s.retry.Do(ctx, "attachment manifest", func(ctx context.Context) error {
+		var err error
+		manifest, err = s.ManifestService.GetManifest(ctx, req)
+		return err
+	})
+	return manifest, err
+}
+
+// ManifestETag implements ManifestService with retries
+func (s *retryManifestService) ManifestETag(ctx context.Context, req AttachmentManifestRequest) (string, error) {
+	var etag string
+	err := s.retry.Do(ctx, "attachment manifest", func(ctx context.Context) error {
+		var err error
+		etag, err = s.ManifestService.ManifestETag(ctx, req)
+		return err
+	})
+	return etag, err
+}
+
 // Initialize initializes the manifest service
 func (s *manifestService) Initialize(ctx context.Context) error {
 	// Check if attachment_operations table exists
@@ -102,11 +233,28 @@ func (s *manifestService) Initialize(ctx context.Context) error {
 func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifestRequest) (*AttachmentManifestResponse, error) {
 	// Get current version
 	var currentVersion int64
-	err := s.db.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&currentVersion)
+	err := s.q.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&currentVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current version: %w", err)
 	}
 
+	// The requested version is everything this client has applied; compaction must not
+	// remove operations it could still need
+	if req.ClientID != "" {
+		if err := s.recordCheckpoint(ctx, req.ClientID, req.SinceVersion); err != nil {
+			s.log.Warn("Failed to record client checkpoint", "clientId", req.ClientID, "error", err)
+		}
+	}
+
+	if req.MaxDownloadBudgetBytes > 0 {
+		manifest, err := s.getBudgetedManifest(ctx, req, currentVersion)
+		if err != nil {
+			return nil, err
+		}
+		manifest.ETag = s.manifestETag(req, currentVersion)
+		return manifest, nil
+	}
+
 	// Query attachment operations since the specified version
 	// We need to get the latest operation for each attachment_id
 	query := `
@@ -123,30 +271,35 @@ func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifes
 			ORDER BY attachment_id, version DESC
 		)
 		SELECT 
-			attachment_id,
-			operation,
-			size,
-			content_type,
-			version
-		FROM latest_operations
-		ORDER BY version ASC
+			l.attachment_id,
+			l.operation,
+			l.size,
+			l.content_type,
+			l.version,
+			a.sha256
+		FROM latest_operations l
+		LEFT JOIN attachments a ON a.attachment_id = l.attachment_id AND l.operation <> 'delete'
+		ORDER BY l.version ASC
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, req.SinceVersion, req.ClientID)
+	rows, err := s.q.QueryContext(ctx, query, req.SinceVersion, req.ClientID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query attachment operations: %w", err)
 	}
 	defer rows.Close()
 
+	known := knownHashSet(req.KnownHashes)
 	var operations []AttachmentOperation
-	var totalDownloadSize int64
+	var totalDownloadSize, skippableDownloadSize int64
 	downloadCount := 0
 	deleteCount := 0
+	skippableCount := 0
 
 	for rows.Next() {
 		var op AttachmentOperation
 		var size sql.NullInt32
 		var contentType sql.NullString
+		var hash sql.NullString
 
 		err := rows.Scan(
 			&op.AttachmentID,
@@ -154,6 +307,7 @@ func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifes
 			&size,
 			&contentType,
 			&op.Version,
+			&hash,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan attachment operation: %w", err)
@@ -167,17 +321,27 @@ func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifes
 		if contentType.Valid {
 			op.ContentType = &contentType.String
 		}
+		if hash.Valid {
+			op.Hash = &hash.String
+		}
 
 		// Generate download URL for download operations
 		if op.Operation == "create" || op.Operation == "update" {
 			op.Operation = "download" // Normalize to download for client
-			downloadURL := s.generateDownloadURL(op.AttachmentID)
-			op.DownloadURL = &downloadURL
+			downloadURL, expiresAt := s.generateDownloadURL(op.AttachmentID, req.ClientID)
+			op.DownloadURL, op.URLExpiresAt = &downloadURL, expiresAt
 
 			if op.Size != nil {
 				totalDownloadSize += int64(*op.Size)
 			}
 			downloadCount++
+
+			if op.Skippable = known.has(op.Hash); op.Skippable {
+				if op.Size != nil {
+					skippableDownloadSize += int64(*op.Size)
+				}
+				skippableCount++
+			}
 		} else if op.Operation == "delete" {
 			deleteCount++
 		}
@@ -190,12 +354,15 @@ func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifes
 	}
 
 	response := &AttachmentManifestResponse{
-		CurrentVersion:    currentVersion,
-		Operations:        operations,
-		TotalDownloadSize: totalDownloadSize,
+		CurrentVersion:        currentVersion,
+		Operations:            operations,
+		TotalDownloadSize:     totalDownloadSize,
+		SkippableDownloadSize: skippableDownloadSize,
+		ETag:                  s.manifestETag(req, currentVersion),
 		OperationCount: OperationCount{
-			Download: downloadCount,
-			Delete:   deleteCount,
+			Download:  downloadCount,
+			Delete:    deleteCount,
+			Skippable: skippableCount,
 		},
 	}
 
@@ -206,7 +373,9 @@ func (s *manifestService) GetManifest(ctx context.Context, req AttachmentManifes
 		"operationCount", len(operations),
 		"downloadCount", downloadCount,
 		"deleteCount", deleteCount,
-		"totalDownloadSize", totalDownloadSize)
+		"totalDownloadSize", totalDownloadSize,
+		"skippableCount", skippableCount,
+		"skippableDownloadSize", skippableDownloadSize)
 
 	return response, nil
 }
@@ -248,9 +417,60 @@ func (s *manifestService) RecordOperation(ctx context.Context, attachmentID, ope
 	return nil
 }
 
-// generateDownloadURL generates a download URL for an attachment
-func (s *manifestService) generateDownloadURL(attachmentID string) string {
+// recordCheckpoint stores the attachment version a client has synced up to. A client
+// that starts over (e.g. after a reinstall) moves its checkpoint back.
+func (s *manifestService) recordCheckpoint(ctx context.Context, clientID string, sinceVersion int64) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO client_checkpoints (client_id, attachment_version, last_seen_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (client_id) DO UPDATE
+		SET attachment_version = EXCLUDED.attachment_version, last_seen_at = EXCLUDED.last_seen_at
+	`, clientID, sinceVersion)
+	return err
+}
+
+// RecordDownload writes an audit entry for an attachment download
+func (s *manifestService) RecordDownload(ctx context.Context, event DownloadEvent) error {
+	query := `
+		INSERT INTO attachment_downloads (attachment_id, username, client_id, ip_address, user_agent, signed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		event.AttachmentID, nullIfEmpty(event.Username), nullIfEmpty(event.ClientID),
+		nullIfEmpty(event.IPAddress), nullIfEmpty(event.UserAgent), event.Signed)
+	if err != nil {
+		return fmt.Errorf("failed to record attachment download: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyDownloadURL checks a signed download URL
+func (s *manifestService) VerifyDownloadURL(attachmentID, clientID, expires, signature string) error {
+	if s.signer == nil {
+		return ErrInvalidSignature
+	}
+	return s.signer.Verify(attachmentID, clientID, expires, signature)
+}
+
+// generateDownloadURL generates a download URL for an attachment, signed if enabled, and
+// returns when it expires; nil for permanent paths
+func (s *manifestService) generateDownloadURL(attachmentID, clientID string) (string, *time.Time) {
 	baseURL := strings.TrimSuffix(s.baseURL, "/")
 	escapedID := url.PathEscape(attachmentID)
-	return fmt.Sprintf("%s/attachments/%s", baseURL, escapedID)
+	downloadURL := fmt.Sprintf("%s/attachments/%s", baseURL, escapedID)
+	if s.signer == nil {
+		return downloadURL, nil
+	}
+	expiresAt := s.signer.Expiry()
+	return downloadURL + "?" + s.signer.SignUntil(attachmentID, clientID, expiresAt).Encode(), &expiresAt
+}
+
+// nullIfEmpty maps an empty string to SQL NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
 }
@@ -0,0 +1,183 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Scan statuses of stored attachments
+const (
+	ScanStatusNotScanned = "not_scanned"
+	ScanStatusPending    = "pending"
+	ScanStatusClean      = "clean"
+	ScanStatusInfected   = "infected"
+	ScanStatusError      = "error"
+)
+
+// ErrMetadataNotFound is returned when no metadata is stored for an attachment
+var ErrMetadataNotFound = errors.New("attachment metadata not found")
+
+// Metadata describes a stored attachment without its content
+type Metadata struct {
+	AttachmentID string     `json:"attachment_id"`
+	Size         int64      `json:"size"`
+	ContentType  *string    `json:"content_type,omitempty"`
+	SHA256       *string    `json:"sha256,omitempty"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+	UploadedBy   *string    `json:"uploaded_by,omitempty"`
+	ScanStatus   string     `json:"scan_status"`
+	ScannedAt    *time.Time `json:"scanned_at,omitempty"`
+	// Exif is recorded for images uploaded with the extract EXIF policy
+	Exif *ExifData `json:"exif,omitempty"`
+	// Transcode is recorded for videos
+	Transcode *TranscodeInfo `json:"transcode,omitempty"`
+	// Observations lists live observations whose data references the attachment ID
+	Observations []string `json:"observations"`
+}
+
+// RecordMetadata stores the metadata of a newly uploaded attachment
+func (s *manifestService) RecordMetadata(ctx context.Context, meta Metadata) error {
+	query := `
+		INSERT INTO attachments (attachment_id, size, content_type, sha256, uploaded_by, scan_status, exif, transcode_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $3::text LIKE 'video/%' THEN 'pending' END)
+		ON CONFLICT (attachment_id) DO UPDATE SET
+			size = EXCLUDED.size,
+			content_type = EXCLUDED.content_type,
+			sha256 = EXCLUDED.sha256,
+			uploaded_by = EXCLUDED.uploaded_by,
+			uploaded_at = NOW(),
+			scan_status = EXCLUDED.scan_status,
+			scanned_at = NULL,
+			exif = EXCLUDED.exif,
+			replication_status = 'pending',
+			replication_attempts = 0,
+			replication_error = NULL,
+			replicated_at = NULL,
+			transcode_status = EXCLUDED.transcode_status,
+			transcode_attempts = 0,
+			transcode_error = NULL,
+			transcoded_at = NULL,
+			transcoded_size = NULL
+	`
+
+	status := meta.ScanStatus
+	if status == "" {
+		status = ScanStatusNotScanned
+	}
+
+	var exif []byte
+	if meta.Exif != nil {
+		var err error
+		if exif, err = json.Marshal(meta.Exif); err != nil {
+			return fmt.Errorf("failed to encode attachment EXIF: %w", err)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		meta.AttachmentID, meta.Size, meta.ContentType, meta.SHA256, meta.UploadedBy, status, exif)
+	if err != nil {
+		return fmt.Errorf("failed to record attachment metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetMetadata returns the stored metadata of an attachment and the observations linked to it
+func (s *manifestService) GetMetadata(ctx context.Context, attachmentID string) (*Metadata, error) {
+	query := `
+		SELECT attachment_id, size, content_type, sha256, uploaded_at, uploaded_by, scan_status, scanned_at, exif,
+			transcode_status, transcode_attempts, transcode_error, transcoded_at, transcoded_size
+		FROM attachments
+		WHERE attachment_id = $1
+	`
+
+	meta := &Metadata{}
+	var contentType, sha, uploadedBy sql.NullString
+	var scannedAt sql.NullTime
+	var exif []byte
+	var transcodeStatus, transcodeError sql.NullString
+	var transcodeAttempts int
+	var transcodedAt sql.NullTime
+	var transcodedSize sql.NullInt64
+	err := s.db.QueryRowContext(ctx, query, attachmentID).Scan(
+		&meta.AttachmentID, &meta.Size, &contentType, &sha, &meta.UploadedAt, &uploadedBy, &meta.ScanStatus, &scannedAt, &exif,
+		&transcodeStatus, &transcodeAttempts, &transcodeError, &transcodedAt, &transcodedSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMetadataNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment metadata: %w", err)
+	}
+
+	if contentType.Valid {
+		meta.ContentType = &contentType.String
+	}
+	if sha.Valid {
+		meta.SHA256 = &sha.String
+	}
+	if uploadedBy.Valid {
+		meta.UploadedBy = &uploadedBy.String
+	}
+	if scannedAt.Valid {
+		meta.ScannedAt = &scannedAt.Time
+	}
+	if len(exif) > 0 {
+		if err := json.Unmarshal(exif, &meta.Exif); err != nil {
+			return nil, fmt.Errorf("failed to decode attachment EXIF: %w", err)
+		}
+	}
+	if transcodeStatus.Valid {
+		meta.Transcode = &TranscodeInfo{Status: transcodeStatus.String, Attempts: transcodeAttempts}
+		if transcodeError.Valid {
+			meta.Transcode.Error = transcodeError.String
+		}
+		if transcodedAt.Valid {
+			meta.Transcode.TranscodedAt = &transcodedAt.Time
+		}
+		if transcodedSize.Valid {
+			meta.Transcode.Size = &transcodedSize.Int64
+		}
+	}
+
+	meta.Observations, err = s.linkedObservations(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// linkedObservations finds live observations with a data value equal to the attachment ID
+func (s *manifestService) linkedObservations(ctx context.Context, attachmentID string) ([]string, error) {
+	query := `
+		SELECT observation_id
+		FROM observations
+		WHERE NOT deleted
+			AND jsonb_path_exists(data, 'strict $.** ? (@ == $id)', jsonb_build_object('id', $1::text))
+		ORDER BY observation_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, attachmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query linked observations: %w", err)
+	}
+	defer rows.Close()
+
+	observations := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan linked observation: %w", err)
+		}
+		observations = append(observations, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read linked observations: %w", err)
+	}
+
+	return observations, nil
+}
@@ -0,0 +1,137 @@
+package attachment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OverwritePolicy decides what an upload to an existing attachment ID does
+type OverwritePolicy string
+
+const (
+	// PolicyReject refuses every upload to an existing attachment ID
+	PolicyReject OverwritePolicy = "reject"
+	// PolicyOverwrite replaces the stored content when the upload differs from it, keeping
+	// the replaced content as a numbered version
+	PolicyOverwrite OverwritePolicy = "overwrite"
+	// PolicyIdempotent accepts an upload identical to the stored content without storing it
+	// again, and refuses one that differs
+	PolicyIdempotent OverwritePolicy = "idempotent"
+)
+
+// Outcomes of a save
+const (
+	OutcomeCreated   = "created"
+	OutcomeReplaced  = "replaced"
+	OutcomeUnchanged = "unchanged"
+)
+
+// ErrContentConflict is returned when an upload differs from the content already stored
+// under its ID. It wraps os.ErrExist.
+var ErrContentConflict = fmt.Errorf("%w with different content", os.ErrExist)
+
+// ErrInvalidPolicy is returned for an unknown overwrite policy
+var ErrInvalidPolicy = errors.New("invalid overwrite policy")
+
+// ParseOverwritePolicy parses a policy name; empty yields PolicyReject
+func ParseOverwritePolicy(name string) (OverwritePolicy, error) {
+	switch policy := OverwritePolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return PolicyReject, nil
+	case PolicyReject, PolicyOverwrite, PolicyIdempotent:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w %q: expected reject, overwrite or idempotent", ErrInvalidPolicy, name)
+	}
+}
+
+// SaveResult describes a successful save
+type SaveResult struct {
+	Outcome string
+	// SHA256 is the hex hash of the stored content
+	SHA256 string
+	// Size is the size of the stored content in bytes
+	Size int64
+	// PreviousSHA256 is the hash of the replaced content
+	PreviousSHA256 string
+	// PreviousVersion is the version number the replaced content was kept under
+	PreviousVersion int
+	// Exif is the EXIF metadata of an image saved with the extract EXIF policy
+	Exif *ExifData
+}
+
+// Directories under the storage path that hold no attachments; IDs can't start with them
+const (
+	uploadsDir  = ".uploads"
+	versionsDir = ".versions"
+	variantsDir = ".variants"
+)
+
+// writeUpload writes file to a temporary file next to the attachments, returning its
+// path, hash and size
+func (s *service) writeUpload(file io.Reader) (string, string, int64, error) {
+	dir := filepath.Join(s.storagePath, uploadsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+	return tmp.Name(), hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// fileSHA256 hashes a stored file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// keepVersion moves the content stored at path into the version history of attachmentID
+// and returns its version number. Versions are numbered from 1, oldest first.
+func (s *service) keepVersion(attachmentID, path string) (int, error) {
+	dir := filepath.Join(s.storagePath, versionsDir, filepath.Clean(attachmentID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	for _, entry := range entries {
+		if n, err := strconv.Atoi(entry.Name()); err == nil && n >= version {
+			version = n + 1
+		}
+	}
+	if err := os.Rename(path, filepath.Join(dir, strconv.Itoa(version))); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
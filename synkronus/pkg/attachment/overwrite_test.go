@@ -0,0 +1,129 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func newTestService(t *testing.T, policy string) *service {
+	t.Helper()
+	svc, err := NewService(&config.Config{DataDir: t.TempDir(), AttachmentOverwritePolicy: policy})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	return svc.(*service)
+}
+
+func readAttachment(t *testing.T, s *service, attachmentID string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(s.storagePath, attachmentID))
+	if err != nil {
+		t.Fatalf("Failed to read attachment: %v", err)
+	}
+	return string(data)
+}
+
+func TestSave_Policies(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          OverwritePolicy
+		content         string
+		expectedOutcome string
+		expectedErr     error
+		expectedContent string
+	}{
+		{"reject identical", PolicyReject, "v1", "", os.ErrExist, "v1"},
+		{"reject different", PolicyReject, "v2", "", os.ErrExist, "v1"},
+		{"idempotent identical", PolicyIdempotent, "v1", OutcomeUnchanged, nil, "v1"},
+		{"idempotent different", PolicyIdempotent, "v2", "", ErrContentConflict, "v1"},
+		{"overwrite identical", PolicyOverwrite, "v1", OutcomeUnchanged, nil, "v1"},
+		{"overwrite different", PolicyOverwrite, "v2", OutcomeReplaced, nil, "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, "")
+			ctx := context.Background()
+
+			created, err := s.Save(ctx, "photo.jpg", strings.NewReader("v1"), tt.policy)
+			if err != nil || created.Outcome != OutcomeCreated || created.Size != 2 {
+				t.Fatalf("Failed to create attachment: %+v, %v", created, err)
+			}
+
+			result, err := s.Save(ctx, "photo.jpg", strings.NewReader(tt.content), tt.policy)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected %v, got %v", tt.expectedErr, err)
+				}
+			} else if err != nil || result.Outcome != tt.expectedOutcome {
+				t.Errorf("Expected %s, got %+v, %v", tt.expectedOutcome, result, err)
+			}
+			if content := readAttachment(t, s, "photo.jpg"); content != tt.expectedContent {
+				t.Errorf("Expected content %q, got %q", tt.expectedContent, content)
+			}
+
+			// Nothing is left behind in the upload directory
+			if entries, _ := os.ReadDir(filepath.Join(s.storagePath, uploadsDir)); len(entries) != 0 {
+				t.Errorf("Expected no leftover uploads, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestSave_OverwriteKeepsVersions(t *testing.T) {
+	s := newTestService(t, "overwrite")
+	ctx := context.Background()
+
+	for _, content := range []string{"v1", "v2", "v3"} {
+		// An empty policy uses the configured one
+		if _, err := s.Save(ctx, "forms/photo.jpg", strings.NewReader(content), ""); err != nil {
+			t.Fatalf("Failed to save %s: %v", content, err)
+		}
+	}
+	result, err := s.Save(ctx, "forms/photo.jpg", strings.NewReader("v4"), "")
+	if err != nil {
+		t.Fatalf("Failed to save v4: %v", err)
+	}
+	if result.PreviousVersion != 3 || result.PreviousSHA256 == "" || result.PreviousSHA256 == result.SHA256 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	for version, content := range map[string]string{"1": "v1", "2": "v2", "3": "v3"} {
+		data, err := os.ReadFile(filepath.Join(s.storagePath, versionsDir, "forms", "photo.jpg", version))
+		if err != nil || string(data) != content {
+			t.Errorf("Expected version %s to hold %q, got %q, %v", version, content, data, err)
+		}
+	}
+	if content := readAttachment(t, s, "forms/photo.jpg"); content != "v4" {
+		t.Errorf("Expected the latest content, got %q", content)
+	}
+}
+
+func TestSave_ReservedIDs(t *testing.T) {
+	s := newTestService(t, "")
+	for _, id := range []string{".versions/photo.jpg/1", ".uploads/upload-1"} {
+		if _, err := s.Save(context.Background(), id, strings.NewReader("x"), ""); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("Expected %s to be refused, got %v", id, err)
+		}
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for name, expected := range map[string]OverwritePolicy{"": PolicyReject, "Overwrite": PolicyOverwrite, " idempotent ": PolicyIdempotent} {
+		if policy, err := ParseOverwritePolicy(name); err != nil || policy != expected {
+			t.Errorf("Expected %q to parse as %s, got %s, %v", name, expected, policy, err)
+		}
+	}
+	if _, err := ParseOverwritePolicy("clobber"); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Expected ErrInvalidPolicy, got %v", err)
+	}
+	if _, err := NewService(&config.Config{DataDir: t.TempDir(), AttachmentOverwritePolicy: "clobber"}); err == nil {
+		t.Errorf("Expected an invalid configured policy to be refused")
+	}
+}
@@ -0,0 +1,616 @@
+package attachment
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers GIF decoding for image previews
+	"image/jpeg"
+	_ "image/png" // registers PNG decoding for image previews
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Kinds of attachment previews
+const (
+	// PreviewImage is a downscaled JPEG of an image
+	PreviewImage = "image"
+	// PreviewPDF is a JPEG of the first page of a PDF
+	PreviewPDF = "pdf"
+	// PreviewWaveform is the waveform of an audio recording as JSON
+	PreviewWaveform = "waveform"
+)
+
+// Content types of previews
+const (
+	PreviewImageContentType    = "image/jpeg"
+	PreviewWaveformContentType = "application/json"
+)
+
+var (
+	// ErrPreviewUnsupported is returned for attachments that aren't images, PDFs or audio,
+	// or whose content can't be decoded
+	ErrPreviewUnsupported = errors.New("attachment can't be previewed")
+	// ErrPreviewTooLarge is returned for attachments above the configured preview limits
+	ErrPreviewTooLarge = errors.New("attachment is too large to preview")
+	// ErrPreviewUnavailable is returned when the tool a preview needs isn't configured
+	ErrPreviewUnavailable = errors.New("previews of this type are not configured")
+)
+
+// PreviewConfig contains attachment preview configuration
+type PreviewConfig struct {
+	// DefaultSize is the longest edge in pixels of image and PDF previews
+	DefaultSize int
+	// MaxSize caps the requested size
+	MaxSize int
+	// DefaultPoints is the number of peaks in a waveform
+	DefaultPoints int
+	// MaxPoints caps the requested number of peaks
+	MaxPoints int
+	// MaxSourceBytes is the largest attachment that is previewed
+	MaxSourceBytes int64
+	// MaxPixels is the largest image, in pixels, that is decoded
+	MaxPixels int
+	// FFmpegPath decodes audio other than PCM WAV; empty previews only WAV files
+	FFmpegPath string
+	// PDFToPPMPath renders PDF pages; empty disables PDF previews
+	PDFToPPMPath string
+	// Timeout bounds making one preview
+	Timeout time.Duration
+	// TempDir holds the copies ffmpeg and pdftoppm read; empty uses the system default
+	TempDir string
+}
+
+// DefaultPreviewConfig returns a default configuration
+func DefaultPreviewConfig() PreviewConfig {
+	return PreviewConfig{
+		DefaultSize:    512,
+		MaxSize:        1024,
+		DefaultPoints:  200,
+		MaxPoints:      2000,
+		MaxSourceBytes: 50 << 20,
+		MaxPixels:      50_000_000,
+		Timeout:        30 * time.Second,
+	}
+}
+
+// PreviewOptions select the preview of an attachment
+type PreviewOptions struct {
+	// Size is the longest edge of image and PDF previews; 0 uses the default
+	Size int
+	// Points is the number of waveform peaks; 0 uses the default
+	Points int
+	// ContentType is the uploaded content type, which recognizes audio formats that
+	// can't be told from their content
+	ContentType string
+}
+
+// Preview is a size-limited rendition of an attachment
+type Preview struct {
+	Kind        string
+	ContentType string
+	Data        []byte
+}
+
+// Waveform summarizes an audio recording for display
+type Waveform struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Peaks are the loudest amplitudes, from 0 to 1, of equal slices of the recording
+	Peaks []float64 `json:"peaks"`
+}
+
+// PreviewService renders previews of attachments, so review tools can show them without
+// downloading the originals
+type PreviewService interface {
+	// Preview returns the preview of an attachment. The error wraps os.ErrNotExist when
+	// the attachment doesn't exist.
+	Preview(ctx context.Context, attachmentID string, options PreviewOptions) (*Preview, error)
+}
+
+type previewService struct {
+	storage Service
+	config  PreviewConfig
+	log     *logger.Logger
+}
+
+// NewPreviewService creates a service previewing the attachments in storage
+func NewPreviewService(storage Service, config PreviewConfig, log *logger.Logger) PreviewService {
+	defaults := DefaultPreviewConfig()
+	if config.DefaultSize <= 0 {
+		config.DefaultSize = defaults.DefaultSize
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaults.MaxSize
+	}
+	if config.DefaultPoints <= 0 {
+		config.DefaultPoints = defaults.DefaultPoints
+	}
+	if config.MaxPoints <= 0 {
+		config.MaxPoints = defaults.MaxPoints
+	}
+	if config.MaxSourceBytes <= 0 {
+		config.MaxSourceBytes = defaults.MaxSourceBytes
+	}
+	if config.MaxPixels <= 0 {
+		config.MaxPixels = defaults.MaxPixels
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	return &previewService{
+		storage: storage,
+		config:  config,
+		log:     log,
+	}
+}
+
+// Preview returns the preview of an attachment
+func (s *previewService) Preview(ctx context.Context, attachmentID string, options PreviewOptions) (preview *Preview, err error) {
+	ctx, span := tracing.Start(ctx, "attachment.Preview", attribute.String("attachment.id", attachmentID))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	size := clampOption(options.Size, s.config.DefaultSize, s.config.MaxSize)
+	points := clampOption(options.Points, s.config.DefaultPoints, s.config.MaxPoints)
+
+	file, err := s.storage.Get(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(512)
+	kind := previewKind(head, options.ContentType)
+	if kind == "" {
+		return nil, ErrPreviewUnsupported
+	}
+	span.SetAttributes(attribute.String("attachment.preview_kind", kind))
+	preview = &Preview{Kind: kind, ContentType: PreviewImageContentType}
+	if kind == PreviewWaveform {
+		preview.ContentType = PreviewWaveformContentType
+	}
+
+	// Only the default preview is kept, so odd sizes can't fill the disk with variants.
+	// Variants are removed when the attachment is replaced, so a kept preview is current.
+	variant := ""
+	if size == s.config.DefaultSize && points == s.config.DefaultPoints {
+		variant = "preview-" + kind
+		if cached, err := s.storage.GetVariant(ctx, attachmentID, variant); err == nil {
+			preview.Data, err = io.ReadAll(cached)
+			cached.Close()
+			if err == nil {
+				return preview, nil
+			}
+		}
+	}
+
+	hash := sha256.New()
+	data, err := io.ReadAll(io.LimitReader(io.TeeReader(reader, hash), s.config.MaxSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.config.MaxSourceBytes {
+		return nil, ErrPreviewTooLarge
+	}
+
+	renderCtx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	switch kind {
+	case PreviewImage:
+		preview.Data, err = s.previewImage(data, size)
+	case PreviewPDF:
+		preview.Data, err = s.previewPDF(renderCtx, data, size)
+	case PreviewWaveform:
+		preview.Data, err = s.previewAudio(renderCtx, data, points)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if variant != "" {
+		_, err := s.storage.SaveVariant(ctx, attachmentID, variant, hex.EncodeToString(hash.Sum(nil)), bytes.NewReader(preview.Data))
+		if err != nil && !errors.Is(err, ErrSourceChanged) {
+			s.log.Warn("Failed to keep attachment preview", "attachmentId", attachmentID, "error", err)
+		}
+	}
+	return preview, nil
+}
+
+// clampOption returns value within 1 and limit, or fallback when value isn't set
+func clampOption(value, fallback, limit int) int {
+	if value <= 0 {
+		value = fallback
+	}
+	return min(value, limit)
+}
+
+// previewKind tells the preview of an attachment from the start of its content, or from
+// its content type for audio formats sniffing doesn't recognize. It returns "" when there
+// is no preview.
+func previewKind(head []byte, contentType string) string {
+	switch sniffed := http.DetectContentType(head); {
+	case sniffed == "image/jpeg", sniffed == "image/png", sniffed == "image/gif":
+		return PreviewImage
+	case sniffed == "application/pdf":
+		return PreviewPDF
+	case sniffed == "audio/midi":
+		// Notes, not sound
+		return ""
+	case strings.HasPrefix(sniffed, "audio/"), sniffed == "application/ogg":
+		return PreviewWaveform
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mediaType, "audio/") {
+		return PreviewWaveform
+	}
+	return ""
+}
+
+// previewImage downscales an image so its longest edge is at most size, turned upright
+// by its EXIF orientation
+func (s *previewService) previewImage(data []byte, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewUnsupported, err)
+	}
+	if cfg.Width*cfg.Height > s.config.MaxPixels {
+		return nil, ErrPreviewTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewUnsupported, err)
+	}
+
+	thumb := downscale(img, size)
+	if _, exif := processImage(data, ExifExtract); exif != nil {
+		thumb = orient(thumb, exif.Orientation)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks an image so its longest edge is at most size, averaging the pixels
+// each output pixel covers. Transparent areas become white, as JPEG has no transparency.
+// Smaller images keep their size.
+func downscale(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+
+	dw, dh := sw, sh
+	switch {
+	case sw <= size && sh <= size:
+		return src
+	case sw >= sh:
+		dw, dh = size, max(1, (sh*size+sw/2)/sw)
+	default:
+		dw, dh = max(1, (sw*size+sh/2)/sh), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4:]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xFF
+		}
+	}
+	return dst
+}
+
+// orient turns an image as its EXIF orientation (2 to 8) says, so it displays upright
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	ow, oh := w, h
+	if orientation >= 5 {
+		// The orientations from 5 on swap the width and height
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontally
+				dx, dy = w-1-x, y
+			case 3: // half turn
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertically
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // quarter turn clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // quarter turn counterclockwise
+				dx, dy = y, w-1-x
+			}
+			copy(out.Pix[dy*out.Stride+dx*4:][:4], img.Pix[y*img.Stride+x*4:][:4])
+		}
+	}
+	return out
+}
+
+// previewPDF renders the first page of a PDF with pdftoppm
+func (s *previewService) previewPDF(ctx context.Context, data []byte, size int) ([]byte, error) {
+	if s.config.PDFToPPMPath == "" {
+		return nil, ErrPreviewUnavailable
+	}
+	dir, err := os.MkdirTemp(s.config.TempDir, "preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+	output := filepath.Join(dir, "page")
+	if err := s.run(ctx, "pdftoppm", exec.CommandContext(ctx, s.config.PDFToPPMPath, pdftoppmArgs(input, output, size)...)); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(output + ".jpg")
+}
+
+// pdftoppmArgs builds the pdftoppm command line rendering the first page as a JPEG whose
+// longest edge is size, written to outputPrefix.jpg
+func pdftoppmArgs(input, outputPrefix string, size int) []string {
+	return []string{"-f", "1", "-l", "1", "-singlefile", "-jpeg", "-scale-to", strconv.Itoa(size), input, outputPrefix}
+}
+
+// run runs a preview tool. Content the tool rejects is reported as ErrPreviewUnsupported.
+func (s *previewService) run(ctx context.Context, name string, cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxStderr}
+	if err := cmd.Run(); err != nil {
+		return toolError(ctx, name, err, &stderr)
+	}
+	return nil
+}
+
+// toolError describes the failure of a preview tool
+func toolError(ctx context.Context, name string, err error, stderr *bytes.Buffer) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s stopped: %w", name, ctx.Err())
+	}
+	return fmt.Errorf("%w: %s failed: %v: %s", ErrPreviewUnsupported, name, err, strings.TrimSpace(stderr.String()))
+}
+
+// previewAudio computes the waveform of a recording. PCM WAV files are read directly;
+// other formats are decoded by ffmpeg.
+func (s *previewService) previewAudio(ctx context.Context, data []byte, points int) ([]byte, error) {
+	waveform, err := parseWAV(data, points)
+	if errors.Is(err, errNotPCM) {
+		if s.config.FFmpegPath == "" {
+			return nil, ErrPreviewUnavailable
+		}
+		waveform, err = s.decodeAudio(ctx, data, points)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(waveform)
+}
+
+// decodeRate is the sample rate ffmpeg decodes audio to; peaks need no more
+const decodeRate = 8000
+
+// decodeAudio computes the waveform of a recording decoded by ffmpeg to mono 16-bit PCM
+func (s *previewService) decodeAudio(ctx context.Context, data []byte, points int) (*Waveform, error) {
+	input, err := os.CreateTemp(s.config.TempDir, "preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input.Name())
+	_, err = input.Write(data)
+	if closeErr := input.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, s.config.FFmpegPath, "-nostdin", "-hide_banner", "-loglevel", "error",
+		"-i", input.Name(), "-vn", "-ac", "1", "-ar", strconv.Itoa(decodeRate), "-f", "s16le", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxStderr}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, toolError(ctx, "ffmpeg", err, &stderr)
+	}
+
+	peaks := newPeakBuilder(decodeRate)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := io.ReadFull(stdout, buf)
+		for i := 0; i+1 < n; i += 2 {
+			peaks.add(float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, toolError(ctx, "ffmpeg", err, &stderr)
+	}
+	return peaks.waveform(points), nil
+}
+
+// errNotPCM is returned by parseWAV for content that isn't uncompressed WAV
+var errNotPCM = errors.New("not a PCM WAV file")
+
+// WAV sample formats
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// parseWAV computes the waveform of an uncompressed WAV file. Truncated files, e.g. of
+// interrupted recordings, yield the waveform of what was written.
+func parseWAV(data []byte, points int) (*Waveform, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errNotPCM
+	}
+	malformed := fmt.Errorf("%w: malformed WAV file", ErrPreviewUnsupported)
+
+	var format, channels, bits, rate int
+	var samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		body := data[pos+8:]
+		size = min(size, len(body))
+		body = body[:size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, malformed
+			}
+			format = int(binary.LittleEndian.Uint16(body[0:]))
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			rate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits = int(binary.LittleEndian.Uint16(body[14:]))
+			if format == wavFormatExtensible && size >= 26 {
+				// The sub format GUID starts with the actual format
+				format = int(binary.LittleEndian.Uint16(body[24:]))
+			}
+		case "data":
+			samples = body
+		}
+		pos += 8 + size + size%2
+	}
+	if samples == nil || channels == 0 || rate == 0 {
+		return nil, malformed
+	}
+
+	var sample func([]byte) float64
+	switch {
+	case format == wavFormatPCM && bits == 8:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == wavFormatPCM && bits == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case format == wavFormatPCM && bits == 24:
+		sample = func(b []byte) float64 {
+			return float64(int32(b[0])|int32(b[1])<<8|int32(int8(b[2]))<<16) / 8388608
+		}
+	case format == wavFormatPCM && bits == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648 }
+	case format == wavFormatFloat && bits == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	default:
+		return nil, errNotPCM
+	}
+
+	width := bits / 8
+	frame := width * channels
+	peaks := newPeakBuilder(rate)
+	for off := 0; off+frame <= len(samples); off += frame {
+		// The loudest channel
+		var peak float64
+		for c := 0; c < channels; c++ {
+			peak = max(peak, math.Abs(sample(samples[off+c*width:])))
+		}
+		peaks.add(peak)
+	}
+	return peaks.waveform(points), nil
+}
+
+// peakRate is the number of peaks per second a recording is first reduced to, so long
+// recordings aren't held in memory sample by sample
+const peakRate = 100
+
+// peakBuilder collects the peaks of a recording
+type peakBuilder struct {
+	rate   int
+	block  int // samples per peak
+	n      int // samples in the current block
+	peak   float64
+	peaks  []float64
+	frames int64
+}
+
+func newPeakBuilder(rate int) *peakBuilder {
+	return &peakBuilder{rate: rate, block: max(1, rate/peakRate)}
+}
+
+// add adds one sample
+func (b *peakBuilder) add(amplitude float64) {
+	b.peak = max(b.peak, math.Abs(amplitude))
+	b.n++
+	b.frames++
+	if b.n == b.block {
+		b.flush()
+	}
+}
+
+func (b *peakBuilder) flush() {
+	b.peaks = append(b.peaks, min(b.peak, 1))
+	b.peak, b.n = 0, 0
+}
+
+// waveform reduces the collected peaks to at most points peaks
+func (b *peakBuilder) waveform(points int) *Waveform {
+	if b.n > 0 {
+		b.flush()
+	}
+	count := min(points, len(b.peaks))
+	peaks := make([]float64, count)
+	for i := range peaks {
+		var peak float64
+		for _, p := range b.peaks[i*len(b.peaks)/count : (i+1)*len(b.peaks)/count] {
+			peak = max(peak, p)
+		}
+		peaks[i] = math.Round(peak*1000) / 1000
+	}
+	return &Waveform{
+		DurationSeconds: math.Round(float64(b.frames)/float64(b.rate)*1000) / 1000,
+		Peaks:           peaks,
+	}
+}
@@ -0,0 +1,251 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// wavFile builds a 16-bit mono PCM WAV file of the samples
+func wavFile(rate int, samples []int16) []byte {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []any{uint32(16), uint16(wavFormatPCM), uint16(1), uint32(rate), uint32(rate * 2), uint16(2), uint16(16)} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+func pngFile(t *testing.T, w, h int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestPreviewService(t *testing.T, files map[string][]byte, config PreviewConfig) (*service, PreviewService) {
+	t.Helper()
+	storage := newTestService(t, "")
+	for id, content := range files {
+		if _, err := storage.Save(context.Background(), id, bytes.NewReader(content), ""); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+	return storage, NewPreviewService(storage, config, logger.NewLogger())
+}
+
+func TestPreview_DownscalesImages(t *testing.T) {
+	storage, svc := newTestPreviewService(t, map[string][]byte{
+		"wide.png":        pngFile(t, 2000, 1000, color.NRGBA{R: 200, A: 0xFF}),
+		"transparent.png": pngFile(t, 40, 20, color.NRGBA{}),
+	}, PreviewConfig{})
+	ctx := context.Background()
+
+	preview, err := svc.Preview(ctx, "wide.png", PreviewOptions{})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Kind != PreviewImage || preview.ContentType != PreviewImageContentType {
+		t.Errorf("Expected a JPEG image preview, got %s %s", preview.Kind, preview.ContentType)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(preview.Data))
+	if err != nil {
+		t.Fatalf("Preview is not a JPEG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 512 || size.Y != 256 {
+		t.Errorf("Expected 512x256, got %v", size)
+	}
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 < 180 {
+		t.Errorf("Expected the red of the image, got red %d", r>>8)
+	}
+
+	// The default preview is kept; other sizes are made on request
+	if _, err := storage.GetVariant(ctx, "wide.png", "preview-image"); err != nil {
+		t.Errorf("Expected the default preview to be kept: %v", err)
+	}
+	small, err := svc.Preview(ctx, "wide.png", PreviewOptions{Size: 100})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if img, _ := jpeg.Decode(bytes.NewReader(small.Data)); img.Bounds().Dx() != 100 {
+		t.Errorf("Expected a width of 100, got %d", img.Bounds().Dx())
+	}
+	huge, err := svc.Preview(ctx, "wide.png", PreviewOptions{Size: 5000})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if img, _ := jpeg.Decode(bytes.NewReader(huge.Data)); img.Bounds().Dx() != 1024 {
+		t.Errorf("Expected the size capped at 1024, got %d", img.Bounds().Dx())
+	}
+
+	// Small images keep their size; transparency turns white
+	preview, err = svc.Preview(ctx, "transparent.png", PreviewOptions{})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	img, _ = jpeg.Decode(bytes.NewReader(preview.Data))
+	if size := img.Bounds().Size(); size.X != 40 || size.Y != 20 {
+		t.Errorf("Expected 40x20, got %v", size)
+	}
+	if r, g, b, _ := img.At(5, 5).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("Expected white, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestPreview_Replaced(t *testing.T) {
+	storage, svc := newTestPreviewService(t, map[string][]byte{
+		"photo.png": pngFile(t, 20, 20, color.NRGBA{R: 0xFF, A: 0xFF}),
+	}, PreviewConfig{})
+	ctx := context.Background()
+	if _, err := svc.Preview(ctx, "photo.png", PreviewOptions{}); err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+
+	// Replacing the attachment drops the kept preview
+	if _, err := storage.Save(ctx, "photo.png", bytes.NewReader(pngFile(t, 30, 10, color.NRGBA{B: 0xFF, A: 0xFF})), PolicyOverwrite); err != nil {
+		t.Fatalf("Failed to replace: %v", err)
+	}
+	preview, err := svc.Preview(ctx, "photo.png", PreviewOptions{})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if img, _ := jpeg.Decode(bytes.NewReader(preview.Data)); img.Bounds().Dx() != 30 {
+		t.Errorf("Expected the preview of the new content, got width %d", img.Bounds().Dx())
+	}
+}
+
+func TestPreview_Waveform(t *testing.T) {
+	// One second of silence followed by one second at half volume
+	samples := make([]int16, 16000)
+	for i := 8000; i < len(samples); i++ {
+		samples[i] = 16384
+		if i%2 == 0 {
+			samples[i] = -16384
+		}
+	}
+	_, svc := newTestPreviewService(t, map[string][]byte{"note.wav": wavFile(8000, samples)}, PreviewConfig{})
+
+	preview, err := svc.Preview(context.Background(), "note.wav", PreviewOptions{Points: 4})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Kind != PreviewWaveform || preview.ContentType != PreviewWaveformContentType {
+		t.Errorf("Expected a JSON waveform, got %s %s", preview.Kind, preview.ContentType)
+	}
+	var waveform Waveform
+	if err := json.Unmarshal(preview.Data, &waveform); err != nil {
+		t.Fatalf("Invalid waveform: %v", err)
+	}
+	if waveform.DurationSeconds != 2 {
+		t.Errorf("Expected 2 seconds, got %v", waveform.DurationSeconds)
+	}
+	expected := []float64{0, 0, 0.5, 0.5}
+	if len(waveform.Peaks) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, waveform.Peaks)
+	}
+	for i := range expected {
+		if waveform.Peaks[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, waveform.Peaks)
+			break
+		}
+	}
+}
+
+func TestPreview_Errors(t *testing.T) {
+	_, svc := newTestPreviewService(t, map[string][]byte{
+		"notes.txt": []byte("plain text"),
+		"scan.pdf":  []byte("%PDF-1.7\n"),
+		"voice.m4a": []byte("\x00\x00\x00\x20ftypM4A compressed audio"),
+		"big.png":   pngFile(t, 300, 300, color.White),
+	}, PreviewConfig{MaxPixels: 10_000})
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		id          string
+		contentType string
+		expected    error
+	}{
+		"not previewable":         {id: "notes.txt", expected: ErrPreviewUnsupported},
+		"missing":                 {id: "gone.png", expected: os.ErrNotExist},
+		"too many pixels":         {id: "big.png", expected: ErrPreviewTooLarge},
+		"pdf without pdftoppm":    {id: "scan.pdf", expected: ErrPreviewUnavailable},
+		"audio without ffmpeg":    {id: "voice.m4a", contentType: "audio/mp4", expected: ErrPreviewUnavailable},
+		"unknown without content": {id: "voice.m4a", expected: ErrPreviewUnsupported},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Preview(ctx, tc.id, PreviewOptions{ContentType: tc.contentType})
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	_, small := newTestPreviewService(t, map[string][]byte{"big.wav": wavFile(8000, make([]int16, 1000))}, PreviewConfig{MaxSourceBytes: 100})
+	if _, err := small.Preview(ctx, "big.wav", PreviewOptions{}); !errors.Is(err, ErrPreviewTooLarge) {
+		t.Errorf("Expected ErrPreviewTooLarge, got %v", err)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 2x1 image, red on the left and blue on the right
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 0xFF, A: 0xFF})
+	img.Set(1, 0, color.RGBA{B: 0xFF, A: 0xFF})
+
+	for orientation, expected := range map[int][]string{
+		1: {"red", "blue"},
+		2: {"blue", "red"},
+		6: {"red", "blue"}, // turned clockwise: red on top
+		8: {"blue", "red"}, // turned counterclockwise: blue on top
+	} {
+		out := orient(img, orientation)
+		var got []string
+		for _, p := range []image.Point{{0, 0}, {out.Rect.Dx() - 1, out.Rect.Dy() - 1}} {
+			if r, _, _, _ := out.At(p.X, p.Y).RGBA(); r > 0 {
+				got = append(got, "red")
+			} else {
+				got = append(got, "blue")
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("Orientation %d: expected %v, got %v", orientation, expected, got)
+		}
+		if orientation >= 5 && out.Rect.Dx() != 1 {
+			t.Errorf("Orientation %d: expected the width and height swapped, got %v", orientation, out.Rect)
+		}
+	}
+}
+
+func TestPdftoppmArgs(t *testing.T) {
+	args := strings.Join(pdftoppmArgs("in.pdf", "out", 512), " ")
+	if args != "-f 1 -l 1 -singlefile -jpeg -scale-to 512 in.pdf out" {
+		t.Errorf("Unexpected arguments: %s", args)
+	}
+}
@@ -0,0 +1,82 @@
+package attachment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxRefreshURLs limits the attachment IDs of one URL refresh request
+const MaxRefreshURLs = 1000
+
+// RefreshURLsRequest asks for new download URLs of attachments in a manifest
+type RefreshURLsRequest struct {
+	ClientID      string   `json:"client_id"`
+	AttachmentIDs []string `json:"attachment_ids"`
+}
+
+// RefreshedURL is a new download URL of an attachment
+type RefreshedURL struct {
+	AttachmentID string `json:"attachment_id"`
+	DownloadURL  string `json:"download_url"`
+	// URLExpiresAt is when DownloadURL stops working; nil for permanent paths
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// RefreshURLsResponse has the new download URLs of a refresh request
+type RefreshURLsResponse struct {
+	URLs []RefreshedURL `json:"urls"`
+	// Missing are requested attachments that are unknown or were deleted since the
+	// manifest; the client drops their downloads
+	Missing []string `json:"missing,omitempty"`
+}
+
+// RefreshDownloadURLs issues new download URLs, signed for req.ClientID when signing is
+// enabled, for the attachments whose latest operation is not a delete
+func (s *manifestService) RefreshDownloadURLs(ctx context.Context, req RefreshURLsRequest) (*RefreshURLsResponse, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (attachment_id) attachment_id, operation
+		FROM attachment_operations
+		WHERE attachment_id = ANY($1)
+		ORDER BY attachment_id, version DESC
+	`, pq.Array(req.AttachmentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachment operations: %w", err)
+	}
+	defer rows.Close()
+
+	live := make(map[string]bool)
+	for rows.Next() {
+		var attachmentID, operation string
+		if err := rows.Scan(&attachmentID, &operation); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment operation: %w", err)
+		}
+		live[attachmentID] = operation != "delete"
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachment operations: %w", err)
+	}
+
+	response := &RefreshURLsResponse{URLs: []RefreshedURL{}}
+	seen := make(map[string]bool, len(req.AttachmentIDs))
+	for _, id := range req.AttachmentIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !live[id] {
+			response.Missing = append(response.Missing, id)
+			continue
+		}
+		downloadURL, expiresAt := s.generateDownloadURL(id, req.ClientID)
+		response.URLs = append(response.URLs, RefreshedURL{AttachmentID: id, DownloadURL: downloadURL, URLExpiresAt: expiresAt})
+	}
+
+	s.log.Info("Refreshed attachment download URLs",
+		"clientId", req.ClientID,
+		"refreshedCount", len(response.URLs),
+		"missingCount", len(response.Missing))
+	return response, nil
+}
@@ -0,0 +1,46 @@
+package attachment
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestManifestService_RefreshDownloadURLs(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+	now := time.Unix(1700000000, 0)
+	svc.signer = NewURLSigner("secret", 15*time.Minute)
+	svc.signer.now = func() time.Time { return now }
+
+	mock.ExpectQuery(`SELECT DISTINCT ON \(attachment_id\) attachment_id, operation\s+FROM attachment_operations\s+WHERE attachment_id = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "operation"}).
+			AddRow("photo.jpg", "update").
+			AddRow("removed.jpg", "delete"))
+
+	response, err := svc.RefreshDownloadURLs(context.Background(), RefreshURLsRequest{
+		ClientID:      "client-1",
+		AttachmentIDs: []string{"photo.jpg", "removed.jpg", "unknown.jpg", "photo.jpg"},
+	})
+	if err != nil {
+		t.Fatalf("RefreshDownloadURLs: %v", err)
+	}
+	if len(response.URLs) != 1 || response.URLs[0].AttachmentID != "photo.jpg" {
+		t.Fatalf("Expected one URL for photo.jpg, got %+v", response.URLs)
+	}
+	refreshed := response.URLs[0]
+	if !strings.HasPrefix(refreshed.DownloadURL, "http://localhost:8080/attachments/photo.jpg?") || !strings.Contains(refreshed.DownloadURL, "client_id=client-1") {
+		t.Errorf("Unexpected download URL %s", refreshed.DownloadURL)
+	}
+	if refreshed.URLExpiresAt == nil || !refreshed.URLExpiresAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("Expected the URL to expire in 15 minutes, got %v", refreshed.URLExpiresAt)
+	}
+	if len(response.Missing) != 2 || response.Missing[0] != "removed.jpg" || response.Missing[1] != "unknown.jpg" {
+		t.Errorf("Expected removed.jpg and unknown.jpg to be missing, got %v", response.Missing)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
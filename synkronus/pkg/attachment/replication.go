@@ -0,0 +1,481 @@
+package attachment
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Replication statuses of stored attachments
+const (
+	ReplicationPending    = "pending"
+	ReplicationReplicated = "replicated"
+	ReplicationFailed     = "failed"
+)
+
+// Consistency problems found when verifying replicas
+const (
+	ReplicaMissing      = "missing"
+	ReplicaHashMismatch = "hash_mismatch"
+)
+
+// ReplicationConfig contains attachment replication configuration
+type ReplicationConfig struct {
+	// Interval is how often pending attachments are replicated; 0 disables the schedule
+	Interval time.Duration
+	// BatchSize caps the attachments replicated per pass
+	BatchSize int
+	// MaxAttempts is how often a failing attachment is retried before it is left for an admin
+	MaxAttempts int
+	// VerifyLimit caps the replicas re-hashed by one verifying report
+	VerifyLimit int
+}
+
+// DefaultReplicationConfig returns a default configuration
+func DefaultReplicationConfig() ReplicationConfig {
+	return ReplicationConfig{
+		Interval:    time.Minute,
+		BatchSize:   100,
+		MaxAttempts: 5,
+		VerifyLimit: 1000,
+	}
+}
+
+// ReplicaStore is the secondary storage attachments are mirrored to
+type ReplicaStore interface {
+	// Put stores the content of an attachment, replacing any previous copy
+	Put(ctx context.Context, attachmentID string, content io.Reader) error
+	// Hash returns the SHA-256 of the stored copy; the error wraps os.ErrNotExist when there is none
+	Hash(ctx context.Context, attachmentID string) (string, error)
+	// Location describes the store for reports
+	Location() string
+}
+
+// dirReplica mirrors attachments into a directory, e.g. a second disk or a mounted bucket
+type dirReplica struct {
+	path string
+}
+
+// NewDirReplica creates a replica store writing to the directory at path
+func NewDirReplica(path string) (ReplicaStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create replica directory: %w", err)
+	}
+	return &dirReplica{path: path}, nil
+}
+
+func (d *dirReplica) attachmentPath(attachmentID string) (string, error) {
+	if !filepath.IsLocal(attachmentID) {
+		return "", os.ErrInvalid
+	}
+	return filepath.Join(d.path, attachmentID), nil
+}
+
+func (d *dirReplica) Put(ctx context.Context, attachmentID string, content io.Reader) error {
+	path, err := d.attachmentPath(attachmentID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write next to the target and rename, so a replica is never half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".replica-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *dirReplica) Hash(ctx context.Context, attachmentID string) (string, error) {
+	path, err := d.attachmentPath(attachmentID)
+	if err != nil {
+		return "", err
+	}
+	return fileSHA256(path)
+}
+
+func (d *dirReplica) Location() string {
+	return d.path
+}
+
+// ReplicationResult summarizes a replication pass
+type ReplicationResult struct {
+	Replicated int `json:"replicated"`
+	Failed     int `json:"failed"`
+}
+
+// ReplicationFailure is an attachment that could not be replicated
+type ReplicationFailure struct {
+	AttachmentID string `json:"attachment_id"`
+	Attempts     int    `json:"attempts"`
+	Error        string `json:"error"`
+}
+
+// ReplicaProblem is a replicated attachment whose replica no longer matches the primary copy
+type ReplicaProblem struct {
+	AttachmentID string `json:"attachment_id"`
+	Problem      string `json:"problem"` // missing or hash_mismatch
+}
+
+// ReplicationReport describes how far the secondary storage is behind the primary one
+type ReplicationReport struct {
+	Enabled bool   `json:"enabled"`
+	Replica string `json:"replica,omitempty"`
+	// Pending, Replicated and Failed count attachments by replication status
+	Pending    int64 `json:"pending"`
+	Replicated int64 `json:"replicated"`
+	Failed     int64 `json:"failed"`
+	// OldestPending is the upload time of the longest waiting attachment
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+	// Failures lists attachments that are no longer retried
+	Failures []ReplicationFailure `json:"failures"`
+	// Verified is the number of replicas re-hashed; problems found are queued for replication again
+	Verified int              `json:"verified"`
+	Problems []ReplicaProblem `json:"problems"`
+}
+
+// ReplicationService mirrors uploaded attachments to a secondary storage
+type ReplicationService interface {
+	// Replicate copies a batch of pending attachments to the replica
+	Replicate(ctx context.Context) (*ReplicationResult, error)
+
+	// Report counts attachments by replication status. With verify, replicated attachments
+	// are re-hashed on both sides and the ones that differ are queued again.
+	Report(ctx context.Context, verify bool) (*ReplicationReport, error)
+
+	// Start replicates on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type replicationService struct {
+	db      *sql.DB
+	primary Service
+	replica ReplicaStore // nil when replication is not configured
+	config  ReplicationConfig
+	log     *logger.Logger
+}
+
+// NewReplicationService creates a replication service copying from primary to replica.
+// A nil replica disables replication; reports still count pending attachments.
+func NewReplicationService(db *sql.DB, primary Service, replica ReplicaStore, config ReplicationConfig, log *logger.Logger) ReplicationService {
+	defaults := DefaultReplicationConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.VerifyLimit <= 0 {
+		config.VerifyLimit = defaults.VerifyLimit
+	}
+	return &replicationService{
+		db:      db,
+		primary: primary,
+		replica: replica,
+		config:  config,
+		log:     log,
+	}
+}
+
+// Start replicates on the configured schedule until ctx is cancelled
+func (s *replicationService) Start(ctx context.Context) {
+	if s.replica == nil || s.config.Interval <= 0 {
+		s.log.Info("Attachment replication disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			// Keep going while full batches come back, so a backlog drains quickly
+			for {
+				result, err := s.Replicate(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						s.log.Error("Failed to replicate attachments", "error", err)
+					}
+					break
+				}
+				if result.Replicated+result.Failed < s.config.BatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pendingAttachment is an attachment waiting to be replicated
+type pendingAttachment struct {
+	id         string
+	sha256     sql.NullString
+	uploadedAt time.Time
+	attempts   int
+}
+
+// Replicate copies a batch of pending attachments to the replica
+func (s *replicationService) Replicate(ctx context.Context) (result *ReplicationResult, err error) {
+	ctx, span := tracing.Start(ctx, "attachment.Replicate")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if s.replica == nil {
+		return &ReplicationResult{}, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attachment_id, sha256, uploaded_at, replication_attempts
+		FROM attachments
+		WHERE replication_status = $1 OR (replication_status = $2 AND replication_attempts < $3)
+		ORDER BY uploaded_at
+		LIMIT $4`,
+		ReplicationPending, ReplicationFailed, s.config.MaxAttempts, s.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending attachments: %w", err)
+	}
+	var pending []pendingAttachment
+	for rows.Next() {
+		var p pendingAttachment
+		if err := rows.Scan(&p.id, &p.sha256, &p.uploadedAt, &p.attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending attachment: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending attachments: %w", err)
+	}
+
+	result = &ReplicationResult{}
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		status, message := ReplicationReplicated, ""
+		if err := s.replicateOne(ctx, p); err != nil {
+			status, message = ReplicationFailed, err.Error()
+			s.log.Warn("Failed to replicate attachment", "attachmentId", p.id, "attempt", p.attempts+1, "error", err)
+		}
+
+		// An attachment uploaded again meanwhile keeps its reset status and is copied next pass
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE attachments SET
+				replication_status = $2,
+				replication_attempts = replication_attempts + 1,
+				replication_error = NULLIF($3, ''),
+				replicated_at = CASE WHEN $2 = 'replicated' THEN NOW() ELSE replicated_at END
+			WHERE attachment_id = $1 AND uploaded_at = $4`,
+			p.id, status, message, p.uploadedAt)
+		if err != nil {
+			return result, fmt.Errorf("failed to record replication of %s: %w", p.id, err)
+		}
+		if status == ReplicationReplicated {
+			result.Replicated++
+		} else {
+			result.Failed++
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("attachment.replicated", result.Replicated),
+		attribute.Int("attachment.replication_failed", result.Failed),
+	)
+	if result.Replicated+result.Failed > 0 {
+		s.log.Info("Replicated attachments", "replicated", result.Replicated, "failed", result.Failed)
+	}
+	return result, nil
+}
+
+// replicateOne copies one attachment and checks the replica against the recorded hash
+func (s *replicationService) replicateOne(ctx context.Context, p pendingAttachment) error {
+	content, err := s.primary.Get(ctx, p.id)
+	if err != nil {
+		return fmt.Errorf("failed to read primary copy: %w", err)
+	}
+	defer content.Close()
+
+	hasher := sha256.New()
+	if err := s.replica.Put(ctx, p.id, io.TeeReader(content, hasher)); err != nil {
+		return fmt.Errorf("failed to write replica: %w", err)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); p.sha256.Valid && sum != p.sha256.String {
+		return fmt.Errorf("copied content has SHA-256 %s, expected %s", sum, p.sha256.String)
+	}
+	return nil
+}
+
+// Report counts attachments by replication status and optionally verifies replicas
+func (s *replicationService) Report(ctx context.Context, verify bool) (report *ReplicationReport, err error) {
+	ctx, span := tracing.Start(ctx, "attachment.ReplicationReport", attribute.Bool("attachment.verify", verify))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	report = &ReplicationReport{
+		Enabled:  s.replica != nil,
+		Failures: []ReplicationFailure{},
+		Problems: []ReplicaProblem{},
+	}
+	if s.replica != nil {
+		report.Replica = s.replica.Location()
+	}
+
+	var oldestPending sql.NullTime
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE replication_status = $1),
+		       COUNT(*) FILTER (WHERE replication_status = $2),
+		       COUNT(*) FILTER (WHERE replication_status = $3),
+		       MIN(uploaded_at) FILTER (WHERE replication_status <> $2)
+		FROM attachments`,
+		ReplicationPending, ReplicationReplicated, ReplicationFailed,
+	).Scan(&report.Pending, &report.Replicated, &report.Failed, &oldestPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count attachments by replication status: %w", err)
+	}
+	if oldestPending.Valid {
+		report.OldestPending = &oldestPending.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attachment_id, replication_attempts, COALESCE(replication_error, '')
+		FROM attachments
+		WHERE replication_status = $1 AND replication_attempts >= $2
+		ORDER BY uploaded_at`,
+		ReplicationFailed, s.config.MaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed replications: %w", err)
+	}
+	for rows.Next() {
+		var failure ReplicationFailure
+		if err := rows.Scan(&failure.AttachmentID, &failure.Attempts, &failure.Error); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan failed replication: %w", err)
+		}
+		report.Failures = append(report.Failures, failure)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list failed replications: %w", err)
+	}
+
+	if verify && s.replica != nil {
+		if err := s.verify(ctx, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// verify re-hashes the least recently replicated replicas and queues the ones that no
+// longer match their primary copy
+func (s *replicationService) verify(ctx context.Context, report *ReplicationReport) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attachment_id FROM attachments
+		WHERE replication_status = $1
+		ORDER BY replicated_at
+		LIMIT $2`,
+		ReplicationReplicated, s.config.VerifyLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list replicated attachments: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan replicated attachment: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list replicated attachments: %w", err)
+	}
+
+	for _, id := range ids {
+		problem, err := s.verifyOne(ctx, id)
+		if err != nil {
+			return err
+		}
+		report.Verified++
+		if problem == "" {
+			// Verified replicas move to the back of the queue
+			if _, err := s.db.ExecContext(ctx,
+				"UPDATE attachments SET replicated_at = NOW() WHERE attachment_id = $1 AND replication_status = $2",
+				id, ReplicationReplicated); err != nil {
+				return fmt.Errorf("failed to record verification of %s: %w", id, err)
+			}
+			continue
+		}
+
+		report.Problems = append(report.Problems, ReplicaProblem{AttachmentID: id, Problem: problem})
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE attachments SET replication_status = $2, replication_attempts = 0, replication_error = $3
+			WHERE attachment_id = $1 AND replication_status = $4`,
+			id, ReplicationPending, "replica "+problem, ReplicationReplicated); err != nil {
+			return fmt.Errorf("failed to queue %s for replication: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// verifyOne compares the replica of an attachment with its primary copy
+func (s *replicationService) verifyOne(ctx context.Context, id string) (string, error) {
+	replicaSum, err := s.replica.Hash(ctx, id)
+	if errors.Is(err, os.ErrNotExist) {
+		return ReplicaMissing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash replica of %s: %w", id, err)
+	}
+
+	content, err := s.primary.Get(ctx, id)
+	if err != nil {
+		// A primary copy that's gone leaves the replica as the only one; nothing to fix here
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read primary copy of %s: %w", id, err)
+	}
+	defer content.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, content); err != nil {
+		return "", fmt.Errorf("failed to hash primary copy of %s: %w", id, err)
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != replicaSum {
+		return ReplicaHashMismatch, nil
+	}
+	return "", nil
+}
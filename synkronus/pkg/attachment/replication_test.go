@@ -0,0 +1,142 @@
+package attachment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func newTestReplica(t *testing.T) ReplicaStore {
+	t.Helper()
+	replica, err := NewDirReplica(filepath.Join(t.TempDir(), "replica"))
+	if err != nil {
+		t.Fatalf("Failed to create replica: %v", err)
+	}
+	return replica
+}
+
+func TestReplicationService_Replicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	primary := newTestService(t, "")
+	result, err := primary.Save(context.Background(), "photo.jpg", strings.NewReader("pixels"), "")
+	if err != nil {
+		t.Fatalf("Failed to save attachment: %v", err)
+	}
+	replica := newTestReplica(t)
+	svc := NewReplicationService(db, primary, replica, DefaultReplicationConfig(), logger.NewLogger())
+
+	uploadedAt := time.Date(2025, 9, 18, 8, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT attachment_id, sha256, uploaded_at, replication_attempts\s+FROM attachments`).
+		WithArgs(ReplicationPending, ReplicationFailed, 5, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "sha256", "uploaded_at", "replication_attempts"}).
+			AddRow("photo.jpg", result.SHA256, uploadedAt, 0).
+			AddRow("gone.jpg", nil, uploadedAt, 2))
+	mock.ExpectExec(`UPDATE attachments SET\s+replication_status = \$2`).
+		WithArgs("photo.jpg", ReplicationReplicated, "", uploadedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE attachments SET\s+replication_status = \$2`).
+		WithArgs("gone.jpg", ReplicationFailed, sqlmock.AnyArg(), uploadedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	replicated, err := svc.Replicate(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replicated.Replicated != 1 || replicated.Failed != 1 {
+		t.Errorf("Expected 1 replicated and 1 failed, got %+v", replicated)
+	}
+	sum, err := replica.Hash(context.Background(), "photo.jpg")
+	if err != nil || sum != result.SHA256 {
+		t.Errorf("Expected replica with hash %s, got %s (%v)", result.SHA256, sum, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestReplicationService_ReportVerifies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	primary := newTestService(t, "")
+	replica := newTestReplica(t)
+	for _, id := range []string{"same.jpg", "changed.jpg", "lost.jpg"} {
+		if _, err := primary.Save(ctx, id, strings.NewReader("content of "+id), ""); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+	if err := replica.Put(ctx, "same.jpg", strings.NewReader("content of same.jpg")); err != nil {
+		t.Fatalf("Failed to write replica: %v", err)
+	}
+	if err := replica.Put(ctx, "changed.jpg", strings.NewReader("bit rot")); err != nil {
+		t.Fatalf("Failed to write replica: %v", err)
+	}
+	svc := NewReplicationService(db, primary, replica, DefaultReplicationConfig(), logger.NewLogger())
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FILTER`).
+		WithArgs(ReplicationPending, ReplicationReplicated, ReplicationFailed).
+		WillReturnRows(sqlmock.NewRows([]string{"pending", "replicated", "failed", "oldest"}).
+			AddRow(2, 3, 1, time.Date(2025, 9, 18, 8, 0, 0, 0, time.UTC)))
+	mock.ExpectQuery(`SELECT attachment_id, replication_attempts, COALESCE\(replication_error, ''\)`).
+		WithArgs(ReplicationFailed, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "replication_attempts", "replication_error"}).
+			AddRow("broken.jpg", 5, "failed to read primary copy"))
+	mock.ExpectQuery(`SELECT attachment_id FROM attachments\s+WHERE replication_status = \$1\s+ORDER BY replicated_at`).
+		WithArgs(ReplicationReplicated, 1000).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}).
+			AddRow("same.jpg").AddRow("changed.jpg").AddRow("lost.jpg"))
+	mock.ExpectExec(`UPDATE attachments SET replicated_at = NOW\(\)`).
+		WithArgs("same.jpg", ReplicationReplicated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE attachments SET replication_status = \$2, replication_attempts = 0`).
+		WithArgs("changed.jpg", ReplicationPending, "replica hash_mismatch", ReplicationReplicated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE attachments SET replication_status = \$2, replication_attempts = 0`).
+		WithArgs("lost.jpg", ReplicationPending, "replica missing", ReplicationReplicated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, err := svc.Report(ctx, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !report.Enabled || report.Pending != 2 || report.Replicated != 3 || report.Failed != 1 || report.OldestPending == nil {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].AttachmentID != "broken.jpg" {
+		t.Errorf("Unexpected failures: %+v", report.Failures)
+	}
+	if report.Verified != 3 || len(report.Problems) != 2 {
+		t.Fatalf("Expected 3 verified with 2 problems, got %d: %+v", report.Verified, report.Problems)
+	}
+	if report.Problems[0] != (ReplicaProblem{AttachmentID: "changed.jpg", Problem: ReplicaHashMismatch}) ||
+		report.Problems[1] != (ReplicaProblem{AttachmentID: "lost.jpg", Problem: ReplicaMissing}) {
+		t.Errorf("Unexpected problems: %+v", report.Problems)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDirReplica_RejectsEscapingIDs(t *testing.T) {
+	replica := newTestReplica(t)
+	for _, id := range []string{"../outside.jpg", "/etc/passwd", ""} {
+		if err := replica.Put(context.Background(), id, strings.NewReader("x")); err != os.ErrInvalid {
+			t.Errorf("Expected os.ErrInvalid for %q, got %v", id, err)
+		}
+	}
+}
@@ -1,27 +1,49 @@
 package attachment
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/opendataensemble/synkronus/pkg/config"
 )
 
 type Service interface {
-	// Save stores the attachment with the given ID
-	Save(ctx context.Context, attachmentID string, file io.Reader) error
+	// Save stores the attachment with the given ID. What happens when the ID already
+	// exists depends on policy; an empty policy uses the configured one. Refused uploads
+	// return an error wrapping os.ErrExist.
+	Save(ctx context.Context, attachmentID string, file io.Reader, policy OverwritePolicy) (*SaveResult, error)
 
 	// Get retrieves the attachment with the given ID
 	Get(ctx context.Context, attachmentID string) (io.ReadCloser, error)
 
 	// Exists checks if an attachment with the given ID exists
 	Exists(ctx context.Context, attachmentID string) (bool, error)
+
+	// SaveVariant stores a derived version of an attachment, e.g. a transcoded video,
+	// provided the attachment's content still has the hash sourceSHA256 the variant was
+	// made from; otherwise it returns ErrSourceChanged
+	SaveVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string, content io.Reader) (*SaveResult, error)
+
+	// GetVariant retrieves a variant of an attachment; the error wraps os.ErrNotExist when
+	// there is none
+	GetVariant(ctx context.Context, attachmentID, variant string) (io.ReadCloser, error)
+
+	// PromoteVariant replaces the content of an attachment with its variant, discarding the
+	// content, provided the content still has the hash sourceSHA256
+	PromoteVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string) error
 }
 
 type service struct {
 	storagePath string
+	policy      OverwritePolicy // default overwrite policy
+	exifPolicy  ExifPolicy      // what happens to the EXIF of uploaded images
+	mu          sync.Mutex      // serializes replacing stored content
 }
 
 func NewService(cfg *config.Config) (Service, error) {
@@ -31,8 +53,20 @@ func NewService(cfg *config.Config) (Service, error) {
 		return nil, err
 	}
 
+	policy, err := ParseOverwritePolicy(cfg.AttachmentOverwritePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	exifPolicy, err := ParseExifPolicy(cfg.AttachmentExifPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	return &service{
 		storagePath: storagePath,
+		policy:      policy,
+		exifPolicy:  exifPolicy,
 	}, nil
 }
 
@@ -48,37 +82,106 @@ func (s *service) getAttachmentPath(attachmentID string) (string, error) {
 		return "", os.ErrInvalid
 	}
 
+	// The upload, version and variant directories are not attachments
+	first := strings.SplitN(filepath.ToSlash(cleanPath), "/", 2)[0]
+	if first == uploadsDir || first == versionsDir || first == variantsDir {
+		return "", os.ErrInvalid
+	}
+
 	return filepath.Join(s.storagePath, cleanPath), nil
 }
 
-func (s *service) Save(ctx context.Context, attachmentID string, file io.Reader) error {
+func (s *service) Save(ctx context.Context, attachmentID string, file io.Reader, policy OverwritePolicy) (*SaveResult, error) {
 	path, err := s.getAttachmentPath(attachmentID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if policy == "" {
+		policy = s.policy
 	}
 
-	// Check if file already exists
+	// Check if file already exists, so rejected uploads aren't written at all
 	if _, err := os.Stat(path); err == nil {
-		return os.ErrExist
+		if policy == PolicyReject {
+			return nil, os.ErrExist
+		}
 	} else if !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 
-	// Create all parent directories
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
+	// Images are processed before hashing, so the hash covers the stored content and
+	// repeated uploads of one image still compare equal
+	file, exif, err := s.processUpload(file)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create new file
-	dst, err := os.Create(path)
+	tmpPath, sum, size, err := s.writeUpload(file)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &SaveResult{Outcome: OutcomeCreated, SHA256: sum, Size: size, Exif: exif}
+	existing, err := fileSHA256(path)
+	switch {
+	case os.IsNotExist(err):
+		// Create all parent directories
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case policy == PolicyReject:
+		return nil, os.ErrExist
+	case existing == sum:
+		result.Outcome = OutcomeUnchanged
+		return result, nil
+	case policy == PolicyIdempotent:
+		return nil, ErrContentConflict
+	default:
+		result.Outcome = OutcomeReplaced
+		result.PreviousSHA256 = existing
+		if result.PreviousVersion, err = s.keepVersion(attachmentID, path); err != nil {
+			return nil, err
+		}
 	}
-	defer dst.Close()
 
-	// Copy file content
-	_, err = io.Copy(dst, file)
-	return err
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	// Variants were made from the previous content
+	if err := s.removeVariants(attachmentID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// processUpload applies the EXIF policy when the upload is a JPEG or PNG image. Only
+// images are read into memory; other uploads are streamed as before.
+func (s *service) processUpload(file io.Reader) (io.Reader, *ExifData, error) {
+	if s.exifPolicy == ExifKeep || s.exifPolicy == "" {
+		return file, nil, nil
+	}
+
+	br := bufio.NewReader(file)
+	head, err := br.Peek(len(pngMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if !isImage(head) {
+		return br, nil, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, exif := processImage(data, s.exifPolicy)
+	return bytes.NewReader(data), exif, nil
 }
 
 func (s *service) Get(ctx context.Context, attachmentID string) (io.ReadCloser, error) {
@@ -0,0 +1,84 @@
+package attachment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned when a signed download URL does not verify
+	ErrInvalidSignature = errors.New("invalid download signature")
+	// ErrSignatureExpired is returned when a signed download URL is past its expiry
+	ErrSignatureExpired = errors.New("download URL has expired")
+)
+
+// URLSigner creates and verifies expiring HMAC signatures for attachment download URLs
+type URLSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewURLSigner creates a signer whose URLs are valid for ttl
+func NewURLSigner(secret string, ttl time.Duration) *URLSigner {
+	return &URLSigner{
+		secret: []byte(secret),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Sign returns the query parameters that grant access to attachmentID for clientID until the TTL elapses
+func (s *URLSigner) Sign(attachmentID, clientID string) url.Values {
+	return s.SignUntil(attachmentID, clientID, s.Expiry())
+}
+
+// Expiry returns when a URL signed now expires, to the second
+func (s *URLSigner) Expiry() time.Time {
+	return time.Unix(s.now().Add(s.ttl).Unix(), 0).UTC()
+}
+
+// SignUntil returns the query parameters that grant access to attachmentID for clientID
+// until expiresAt
+func (s *URLSigner) SignUntil(attachmentID, clientID string, expiresAt time.Time) url.Values {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	params := url.Values{}
+	params.Set("expires", expires)
+	if clientID != "" {
+		params.Set("client_id", clientID)
+	}
+	params.Set("signature", s.signature(attachmentID, clientID, expires))
+	return params
+}
+
+// Verify checks the signature and expiry of a signed download request
+func (s *URLSigner) Verify(attachmentID, clientID, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := s.signature(attachmentID, clientID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if s.now().Unix() > expiresAt {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// signature computes the hex HMAC-SHA256 over the signed fields
+func (s *URLSigner) signature(attachmentID, clientID, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(attachmentID + "\n" + clientID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package attachment
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner("secret", time.Minute)
+	now := time.Unix(1700000000, 0)
+	signer.now = func() time.Time { return now }
+
+	params := signer.Sign("photo.jpg", "client-1")
+	expires := params.Get("expires")
+	signature := params.Get("signature")
+
+	tests := []struct {
+		name         string
+		attachmentID string
+		clientID     string
+		expires      string
+		signature    string
+		at           time.Time
+		expectedErr  error
+	}{
+		{name: "valid", attachmentID: "photo.jpg", clientID: "client-1", expires: expires, signature: signature, at: now},
+		{name: "other attachment", attachmentID: "other.jpg", clientID: "client-1", expires: expires, signature: signature, at: now, expectedErr: ErrInvalidSignature},
+		{name: "other client", attachmentID: "photo.jpg", clientID: "client-2", expires: expires, signature: signature, at: now, expectedErr: ErrInvalidSignature},
+		{name: "extended expiry", attachmentID: "photo.jpg", clientID: "client-1", expires: "9999999999", signature: signature, at: now, expectedErr: ErrInvalidSignature},
+		{name: "malformed expiry", attachmentID: "photo.jpg", clientID: "client-1", expires: "soon", signature: signature, at: now, expectedErr: ErrInvalidSignature},
+		{name: "expired", attachmentID: "photo.jpg", clientID: "client-1", expires: expires, signature: signature, at: now.Add(2 * time.Minute), expectedErr: ErrSignatureExpired},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signer.now = func() time.Time { return tc.at }
+			err := signer.Verify(tc.attachmentID, tc.clientID, tc.expires, tc.signature)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package attachment
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// MaxKnownHashes limits the hashes a client may send with a manifest request
+const MaxKnownHashes = 100000
+
+// ValidHash reports whether hash is a hex SHA-256, in either case
+func ValidHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// hashSet holds the content hashes a client already has; hashes are stored in lower case
+// as they are recorded on upload
+type hashSet map[string]struct{}
+
+// knownHashSet builds the set of hashes from a manifest request
+func knownHashSet(hashes []string) hashSet {
+	set := make(hashSet, len(hashes))
+	for _, hash := range hashes {
+		set[strings.ToLower(hash)] = struct{}{}
+	}
+	return set
+}
+
+// has reports whether the client holds content with the given hash
+func (s hashSet) has(hash *string) bool {
+	if hash == nil {
+		return false
+	}
+	_, ok := s[*hash]
+	return ok
+}
@@ -0,0 +1,109 @@
+package attachment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// hashOf returns the hex SHA-256 of content, as recorded on upload
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGetManifest_KnownHashes(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(20))
+	mock.ExpectExec(`INSERT INTO client_checkpoints`).
+		WithArgs("client-1", 10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM latest_operations l\s+LEFT JOIN attachments a`).
+		WithArgs(10, "client-1").
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "operation", "size", "content_type", "version", "sha256"}).
+			AddRow("restored.jpg", "create", 300000, "image/jpeg", 11, hashOf("restored")).
+			AddRow("new.jpg", "create", 200000, "image/jpeg", 12, hashOf("new")).
+			AddRow("legacy.jpg", "create", 100000, "image/jpeg", 13, nil).
+			AddRow("removed.jpg", "delete", nil, nil, 14, nil))
+
+	// Hashes match whatever case the client sends them in
+	manifest, err := svc.GetManifest(context.Background(), AttachmentManifestRequest{
+		ClientID: "client-1", SinceVersion: 10,
+		KnownHashes: []string{strings.ToUpper(hashOf("restored")), hashOf("elsewhere")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	skippable := map[string]bool{}
+	for _, op := range manifest.Operations {
+		skippable[op.AttachmentID] = op.Skippable
+		if op.Operation == "download" && op.DownloadURL == nil {
+			t.Errorf("Download %s has no download URL", op.AttachmentID)
+		}
+	}
+	if !skippable["restored.jpg"] || skippable["new.jpg"] || skippable["legacy.jpg"] || skippable["removed.jpg"] {
+		t.Errorf("Expected only restored.jpg to be skippable, got %v", skippable)
+	}
+	if hash := manifest.Operations[1].Hash; hash == nil || *hash != hashOf("new") {
+		t.Errorf("Expected the hash of new.jpg, got %v", hash)
+	}
+	if manifest.Operations[2].Hash != nil {
+		t.Errorf("Expected no hash for an attachment without metadata")
+	}
+	if manifest.OperationCount.Download != 3 || manifest.OperationCount.Skippable != 1 ||
+		manifest.TotalDownloadSize != 600000 || manifest.SkippableDownloadSize != 300000 {
+		t.Errorf("Unexpected totals %+v, size %d, skippable size %d",
+			manifest.OperationCount, manifest.TotalDownloadSize, manifest.SkippableDownloadSize)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetManifest_KnownHashesSkipBudget(t *testing.T) {
+	svc, mock := newBudgetTestService(t)
+
+	// The client holds new-photo.jpg, so it fits the budget alongside old-photo.jpg
+	expectBudgetedManifest(mock, 10, 25, 25, budgetRows())
+	manifest, err := svc.GetManifest(context.Background(), AttachmentManifestRequest{
+		ClientID: "client-1", SinceVersion: 10, MaxDownloadBudgetBytes: 550000,
+		KnownHashes: []string{hashOf("new-photo")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if deferred := operationIDs(manifest.Operations, true); len(deferred) != 1 || deferred[0] != "orphan.pdf" {
+		t.Errorf("Expected only orphan.pdf to be deferred, got %v", deferred)
+	}
+	if manifest.OperationCount.Skippable != 1 || manifest.SkippableDownloadSize != 400000 ||
+		manifest.TotalDownloadSize-manifest.SkippableDownloadSize != 550000 {
+		t.Errorf("Unexpected totals %+v, size %d, skippable size %d",
+			manifest.OperationCount, manifest.TotalDownloadSize, manifest.SkippableDownloadSize)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestValidHash(t *testing.T) {
+	for hash, want := range map[string]bool{
+		hashOf("x"):                  true,
+		strings.ToUpper(hashOf("x")): true,
+		hashOf("x")[:63]:             false,
+		strings.Repeat("g", 64):      false,
+		"":                           false,
+	} {
+		if got := ValidHash(hash); got != want {
+			t.Errorf("ValidHash(%q) = %v, want %v", hash, got, want)
+		}
+	}
+}
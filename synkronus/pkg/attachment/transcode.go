@@ -0,0 +1,464 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Transcode statuses of stored videos; other attachments have none
+const (
+	TranscodePending    = "pending"
+	TranscodeTranscoded = "transcoded"
+	TranscodeFailed     = "failed"
+)
+
+// TranscodedContentType is the content type of transcoded videos
+const TranscodedContentType = "video/mp4"
+
+// TranscodeInfo describes the transcoding of a video attachment
+type TranscodeInfo struct {
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// Size is the size of the transcoded video in bytes
+	Size         *int64     `json:"size,omitempty"`
+	TranscodedAt *time.Time `json:"transcoded_at,omitempty"`
+}
+
+// Transcoder converts a video file into a web-friendly MP4
+type Transcoder interface {
+	// Transcode reads the video at input and writes the MP4 to output
+	Transcode(ctx context.Context, input, output string) error
+}
+
+// FFmpegConfig describes the target of ffmpeg transcoding
+type FFmpegConfig struct {
+	// Path is the ffmpeg binary
+	Path string
+	// MaxHeight scales taller videos down, keeping the aspect ratio; 0 keeps the size
+	MaxHeight int
+	// VideoCodec is the ffmpeg video encoder, e.g. libx264
+	VideoCodec string
+	// CRF is the constant rate factor; lower is better quality and larger files
+	CRF int
+}
+
+// DefaultFFmpegConfig returns H.264 at up to 720p
+func DefaultFFmpegConfig() FFmpegConfig {
+	return FFmpegConfig{
+		Path:       "ffmpeg",
+		MaxHeight:  720,
+		VideoCodec: "libx264",
+		CRF:        23,
+	}
+}
+
+type ffmpegTranscoder struct {
+	config FFmpegConfig
+}
+
+// NewFFmpegTranscoder creates a transcoder running the ffmpeg binary of config
+func NewFFmpegTranscoder(config FFmpegConfig) Transcoder {
+	defaults := DefaultFFmpegConfig()
+	if config.Path == "" {
+		config.Path = defaults.Path
+	}
+	if config.VideoCodec == "" {
+		config.VideoCodec = defaults.VideoCodec
+	}
+	return &ffmpegTranscoder{config: config}
+}
+
+// maxStderr caps the ffmpeg output kept for error messages
+const maxStderr = 4096
+
+func (t *ffmpegTranscoder) Transcode(ctx context.Context, input, output string) error {
+	cmd := exec.CommandContext(ctx, t.config.Path, ffmpegArgs(t.config, input, output)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxStderr}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("ffmpeg stopped: %w", ctx.Err())
+		}
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// ffmpegArgs builds the ffmpeg command line: the first video stream and any audio, encoded
+// as H.264 (or VideoCodec) and AAC in an MP4 whose index is at the front, so players can
+// start streaming before the whole file is downloaded
+func ffmpegArgs(config FFmpegConfig, input, output string) []string {
+	args := []string{"-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c:v", config.VideoCodec, "-preset", "veryfast", "-crf", strconv.Itoa(config.CRF), "-pix_fmt", "yuv420p",
+	}
+	if config.MaxHeight > 0 {
+		// Never upscale; -2 keeps the width even, as H.264 requires
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", config.MaxHeight))
+	}
+	return append(args, "-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart", "-f", "mp4", output)
+}
+
+// limitedWriter keeps the first limit bytes written to it
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		if len(p) > room {
+			w.buf.Write(p[:room])
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// TranscodeConfig contains video transcoding configuration
+type TranscodeConfig struct {
+	// Interval is how often pending videos are transcoded; 0 disables the schedule
+	Interval time.Duration
+	// BatchSize caps the videos transcoded per pass
+	BatchSize int
+	// MaxAttempts is how often a failing video is retried before it is left as uploaded
+	MaxAttempts int
+	// Timeout bounds the transcoding of one video
+	Timeout time.Duration
+	// KeepOriginal keeps the uploaded video next to the transcoded one; otherwise the
+	// transcoded video replaces it
+	KeepOriginal bool
+	// TempDir holds the copies ffmpeg reads and writes; empty uses the system default
+	TempDir string
+}
+
+// DefaultTranscodeConfig returns a default configuration
+func DefaultTranscodeConfig() TranscodeConfig {
+	return TranscodeConfig{
+		Interval:     time.Minute,
+		BatchSize:    10,
+		MaxAttempts:  3,
+		Timeout:      30 * time.Minute,
+		KeepOriginal: true,
+	}
+}
+
+// TranscodeResult summarizes a transcoding pass
+type TranscodeResult struct {
+	Transcoded int `json:"transcoded"`
+	Failed     int `json:"failed"`
+}
+
+// TranscodeService transcodes uploaded videos to a streamable variant
+type TranscodeService interface {
+	// Transcode converts a batch of pending videos
+	Transcode(ctx context.Context) (*TranscodeResult, error)
+
+	// Start transcodes on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type transcodeService struct {
+	db         *sql.DB
+	storage    Service
+	transcoder Transcoder // nil when transcoding is not configured
+	config     TranscodeConfig
+	log        *logger.Logger
+}
+
+// NewTranscodeService creates a service transcoding the videos in storage. A nil
+// transcoder disables transcoding; videos are then served as uploaded.
+func NewTranscodeService(db *sql.DB, storage Service, transcoder Transcoder, config TranscodeConfig, log *logger.Logger) TranscodeService {
+	defaults := DefaultTranscodeConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	return &transcodeService{
+		db:         db,
+		storage:    storage,
+		transcoder: transcoder,
+		config:     config,
+		log:        log,
+	}
+}
+
+// Start transcodes on the configured schedule until ctx is cancelled
+func (s *transcodeService) Start(ctx context.Context) {
+	if s.transcoder == nil || s.storage == nil || s.config.Interval <= 0 {
+		s.log.Info("Video transcoding disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			// Keep going while full batches come back, so a backlog drains
+			for {
+				result, err := s.Transcode(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						s.log.Error("Failed to transcode videos", "error", err)
+					}
+					break
+				}
+				if result.Transcoded+result.Failed < s.config.BatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pendingVideo is a video waiting to be transcoded
+type pendingVideo struct {
+	id         string
+	uploadedAt time.Time
+	attempts   int
+}
+
+// transcoded is the outcome of transcoding one video
+type transcoded struct {
+	sha256 string
+	size   int64
+}
+
+// Transcode converts a batch of pending videos
+func (s *transcodeService) Transcode(ctx context.Context) (result *TranscodeResult, err error) {
+	ctx, span := tracing.Start(ctx, "attachment.Transcode")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if s.transcoder == nil || s.storage == nil {
+		return &TranscodeResult{}, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attachment_id, uploaded_at, transcode_attempts
+		FROM attachments
+		WHERE transcode_status = $1 OR (transcode_status = $2 AND transcode_attempts < $3)
+		ORDER BY uploaded_at
+		LIMIT $4`,
+		TranscodePending, TranscodeFailed, s.config.MaxAttempts, s.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending videos: %w", err)
+	}
+	var pending []pendingVideo
+	for rows.Next() {
+		var p pendingVideo
+		if err := rows.Scan(&p.id, &p.uploadedAt, &p.attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending video: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending videos: %w", err)
+	}
+
+	result = &TranscodeResult{}
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		start := time.Now()
+		out, err := s.transcodeOne(ctx, p.id)
+		switch {
+		case errors.Is(err, ErrSourceChanged):
+			// Uploaded again meanwhile; the new upload is pending and transcoded next pass
+			s.log.Info("Video replaced while transcoding", "attachmentId", p.id)
+			continue
+		case err != nil:
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			s.log.Warn("Failed to transcode video", "attachmentId", p.id, "attempt", p.attempts+1, "error", err)
+			if err := s.recordFailure(ctx, p, err); err != nil {
+				return result, err
+			}
+			result.Failed++
+		default:
+			if err := s.recordTranscoded(ctx, p, out); err != nil {
+				return result, err
+			}
+			s.log.Info("Transcoded video", "attachmentId", p.id, "size", out.size,
+				"keptOriginal", s.config.KeepOriginal, "duration", time.Since(start))
+			result.Transcoded++
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("attachment.transcoded", result.Transcoded),
+		attribute.Int("attachment.transcode_failed", result.Failed),
+	)
+	return result, nil
+}
+
+// transcodeOne converts one video and stores the result as its web variant, or in its
+// place when originals aren't kept
+func (s *transcodeService) transcodeOne(ctx context.Context, attachmentID string) (*transcoded, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	// ffmpeg needs a seekable file, as MP4s often have their index at the end
+	input, err := os.CreateTemp(s.config.TempDir, "transcode-in-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input.Name())
+	sourceSHA256, err := s.copyOriginal(ctx, attachmentID, input)
+	if closeErr := input.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := os.CreateTemp(s.config.TempDir, "transcode-out-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	if err := s.transcoder.Transcode(ctx, input.Name(), output.Name()); err != nil {
+		return nil, err
+	}
+
+	video, err := os.Open(output.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer video.Close()
+	saved, err := s.storage.SaveVariant(ctx, attachmentID, VariantWeb, sourceSHA256, video)
+	if err != nil {
+		return nil, err
+	}
+	if !s.config.KeepOriginal {
+		if err := s.storage.PromoteVariant(ctx, attachmentID, VariantWeb, sourceSHA256); err != nil {
+			return nil, err
+		}
+	}
+	return &transcoded{sha256: saved.SHA256, size: saved.Size}, nil
+}
+
+// copyOriginal copies the stored video to file and returns its hash
+func (s *transcodeService) copyOriginal(ctx context.Context, attachmentID string, file *os.File) (string, error) {
+	content, err := s.storage.Get(ctx, attachmentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read video: %w", err)
+	}
+	defer content.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), content); err != nil {
+		return "", fmt.Errorf("failed to copy video: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// recordTranscoded marks a video transcoded. A video whose transcoded content replaced the
+// upload gets the new hash, size and content type, is replicated again and gets an update
+// operation, so clients download the new content.
+func (s *transcodeService) recordTranscoded(ctx context.Context, p pendingVideo, out *transcoded) error {
+	if s.config.KeepOriginal {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE attachments SET
+				transcode_status = $2,
+				transcode_attempts = transcode_attempts + 1,
+				transcode_error = NULL,
+				transcoded_at = NOW(),
+				transcoded_size = $3
+			WHERE attachment_id = $1 AND uploaded_at = $4`,
+			p.id, TranscodeTranscoded, out.size, p.uploadedAt)
+		if err != nil {
+			return fmt.Errorf("failed to record transcoding of %s: %w", p.id, err)
+		}
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A video uploaded again meanwhile keeps the metadata of the new upload
+	res, err := tx.ExecContext(ctx, `
+		UPDATE attachments SET
+			transcode_status = $2,
+			transcode_attempts = transcode_attempts + 1,
+			transcode_error = NULL,
+			transcoded_at = NOW(),
+			transcoded_size = $3,
+			size = $3,
+			sha256 = $4,
+			content_type = $5,
+			replication_status = 'pending',
+			replication_attempts = 0,
+			replication_error = NULL,
+			replicated_at = NULL
+		WHERE attachment_id = $1 AND uploaded_at = $6`,
+		p.id, TranscodeTranscoded, out.size, out.sha256, TranscodedContentType, p.uploadedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record transcoding of %s: %w", p.id, err)
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated == 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO attachment_operations (attachment_id, operation, size, content_type)
+		VALUES ($1, 'update', $2, $3)`,
+		p.id, out.size, TranscodedContentType)
+	if err != nil {
+		return fmt.Errorf("failed to record attachment operation for %s: %w", p.id, err)
+	}
+	return tx.Commit()
+}
+
+// recordFailure counts a failed attempt
+func (s *transcodeService) recordFailure(ctx context.Context, p pendingVideo, cause error) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE attachments SET
+			transcode_status = $2,
+			transcode_attempts = transcode_attempts + 1,
+			transcode_error = $3
+		WHERE attachment_id = $1 AND uploaded_at = $4`,
+		p.id, TranscodeFailed, cause.Error(), p.uploadedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record failed transcoding of %s: %w", p.id, err)
+	}
+	return nil
+}
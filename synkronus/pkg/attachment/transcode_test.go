@@ -0,0 +1,185 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// fakeTranscoder "transcodes" by prefixing the input, or fails for inputs containing "corrupt"
+type fakeTranscoder struct{}
+
+func (fakeTranscoder) Transcode(ctx context.Context, input, output string) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "corrupt") {
+		return errors.New("ffmpeg failed: invalid data found when processing input")
+	}
+	return os.WriteFile(output, append([]byte("mp4:"), data...), 0644)
+}
+
+func readAll(t *testing.T, content io.ReadCloser, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	return string(data)
+}
+
+func TestTranscodeService_KeepsOriginal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	storage := newTestService(t, "")
+	for id, content := range map[string]string{"clip.mov": "raw frames", "broken.mov": "raw corrupt"} {
+		if _, err := storage.Save(ctx, id, strings.NewReader(content), ""); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+	config := DefaultTranscodeConfig()
+	config.TempDir = t.TempDir()
+	svc := NewTranscodeService(db, storage, fakeTranscoder{}, config, logger.NewLogger())
+
+	uploadedAt := time.Date(2025, 9, 22, 8, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT attachment_id, uploaded_at, transcode_attempts\s+FROM attachments`).
+		WithArgs(TranscodePending, TranscodeFailed, 3, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "uploaded_at", "transcode_attempts"}).
+			AddRow("clip.mov", uploadedAt, 0).
+			AddRow("broken.mov", uploadedAt, 1))
+	mock.ExpectExec(`UPDATE attachments SET\s+transcode_status = \$2`).
+		WithArgs("clip.mov", TranscodeTranscoded, int64(len("mp4:raw frames")), uploadedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE attachments SET\s+transcode_status = \$2`).
+		WithArgs("broken.mov", TranscodeFailed, sqlmock.AnyArg(), uploadedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := svc.Transcode(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Transcoded != 1 || result.Failed != 1 {
+		t.Errorf("Expected 1 transcoded and 1 failed, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	content, err := storage.GetVariant(ctx, "clip.mov", VariantWeb)
+	if got := readAll(t, content, err); got != "mp4:raw frames" {
+		t.Errorf("Unexpected variant %q", got)
+	}
+	content, err = storage.Get(ctx, "clip.mov")
+	if got := readAll(t, content, err); got != "raw frames" {
+		t.Errorf("Expected the original to be kept, got %q", got)
+	}
+
+	// Uploading new content drops the variant made from the old one
+	if _, err := storage.Save(ctx, "clip.mov", strings.NewReader("new frames"), PolicyOverwrite); err != nil {
+		t.Fatalf("Failed to replace clip: %v", err)
+	}
+	if _, err := storage.GetVariant(ctx, "clip.mov", VariantWeb); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the stale variant to be removed, got %v", err)
+	}
+}
+
+func TestTranscodeService_ReplacesOriginal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	storage := newTestService(t, "")
+	if _, err := storage.Save(ctx, "clip.mov", strings.NewReader("raw frames"), ""); err != nil {
+		t.Fatalf("Failed to save clip: %v", err)
+	}
+	config := DefaultTranscodeConfig()
+	config.TempDir = t.TempDir()
+	config.KeepOriginal = false
+	svc := NewTranscodeService(db, storage, fakeTranscoder{}, config, logger.NewLogger())
+
+	uploadedAt := time.Date(2025, 9, 22, 8, 0, 0, 0, time.UTC)
+	size := int64(len("mp4:raw frames"))
+	mock.ExpectQuery(`SELECT attachment_id, uploaded_at, transcode_attempts\s+FROM attachments`).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "uploaded_at", "transcode_attempts"}).
+			AddRow("clip.mov", uploadedAt, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE attachments SET\s+transcode_status = \$2.*sha256 = \$4`).
+		WithArgs("clip.mov", TranscodeTranscoded, size, sqlmock.AnyArg(), TranscodedContentType, uploadedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO attachment_operations`).
+		WithArgs("clip.mov", size, TranscodedContentType).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	result, err := svc.Transcode(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Transcoded != 1 {
+		t.Errorf("Expected 1 transcoded, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	content, err := storage.Get(ctx, "clip.mov")
+	if got := readAll(t, content, err); got != "mp4:raw frames" {
+		t.Errorf("Expected the transcoded video in place of the original, got %q", got)
+	}
+	if _, err := storage.GetVariant(ctx, "clip.mov", VariantWeb); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no separate variant, got %v", err)
+	}
+}
+
+func TestSaveVariant_SourceChanged(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestService(t, "")
+	if _, err := storage.Save(ctx, "clip.mov", strings.NewReader("raw frames"), ""); err != nil {
+		t.Fatalf("Failed to save clip: %v", err)
+	}
+	_, err := storage.SaveVariant(ctx, "clip.mov", VariantWeb, "not the hash of the stored content", strings.NewReader("mp4"))
+	if !errors.Is(err, ErrSourceChanged) {
+		t.Errorf("Expected ErrSourceChanged, got %v", err)
+	}
+	if _, err := storage.GetVariant(ctx, "clip.mov", "../clip.mov"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Expected os.ErrInvalid for a variant outside the attachment, got %v", err)
+	}
+	if _, err := storage.Get(ctx, ".variants/clip.mov/web"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Expected variants not to be attachments, got %v", err)
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	args := strings.Join(ffmpegArgs(DefaultFFmpegConfig(), "in.mov", "out.mp4"), " ")
+	for _, want := range []string{"-i in.mov", "-c:v libx264", "-crf 23", "scale=-2:'min(720,ih)'", "-movflags +faststart", "-f mp4 out.mp4"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected %q in %q", want, args)
+		}
+	}
+
+	config := DefaultFFmpegConfig()
+	config.MaxHeight = 0
+	if args := strings.Join(ffmpegArgs(config, "in.mov", "out.mp4"), " "); strings.Contains(args, "scale=") {
+		t.Errorf("Expected no scaling without a max height, got %q", args)
+	}
+}
@@ -0,0 +1,111 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VariantWeb is the transcoded, streamable variant of a video attachment
+const VariantWeb = "web"
+
+// ErrSourceChanged is returned when an attachment's content changed after a variant was
+// made from it
+var ErrSourceChanged = errors.New("attachment content changed since the variant was made")
+
+// variantPath returns where a variant of an attachment is stored
+func (s *service) variantPath(attachmentID, variant string) (string, error) {
+	if _, err := s.getAttachmentPath(attachmentID); err != nil {
+		return "", err
+	}
+	if variant == "" || strings.ContainsAny(variant, `/\`) || !filepath.IsLocal(variant) {
+		return "", os.ErrInvalid
+	}
+	return filepath.Join(s.storagePath, variantsDir, filepath.Clean(attachmentID), variant), nil
+}
+
+// removeVariants deletes every variant of an attachment
+func (s *service) removeVariants(attachmentID string) error {
+	return os.RemoveAll(filepath.Join(s.storagePath, variantsDir, filepath.Clean(attachmentID)))
+}
+
+// checkSource fails with ErrSourceChanged unless the stored content has hash sourceSHA256.
+// The caller holds s.mu.
+func (s *service) checkSource(path, sourceSHA256 string) error {
+	current, err := fileSHA256(path)
+	if os.IsNotExist(err) {
+		return ErrSourceChanged
+	}
+	if err != nil {
+		return err
+	}
+	if current != sourceSHA256 {
+		return ErrSourceChanged
+	}
+	return nil
+}
+
+func (s *service) SaveVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string, content io.Reader) (*SaveResult, error) {
+	path, err := s.getAttachmentPath(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.variantPath(attachmentID, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpPath, sum, size, err := s.writeUpload(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A variant of replaced content would be served for the new content
+	if err := s.checkSource(path, sourceSHA256); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return nil, err
+	}
+	return &SaveResult{Outcome: OutcomeCreated, SHA256: sum, Size: size}, nil
+}
+
+func (s *service) GetVariant(ctx context.Context, attachmentID, variant string) (io.ReadCloser, error) {
+	path, err := s.variantPath(attachmentID, variant)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *service) PromoteVariant(ctx context.Context, attachmentID, variant, sourceSHA256 string) error {
+	path, err := s.getAttachmentPath(attachmentID)
+	if err != nil {
+		return err
+	}
+	source, err := s.variantPath(attachmentID, variant)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkSource(path, sourceSHA256); err != nil {
+		return err
+	}
+	if err := os.Rename(source, path); err != nil {
+		return err
+	}
+	return s.removeVariants(attachmentID)
+}
@@ -4,13 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/opendataensemble/synkronus/internal/models"
 	"github.com/opendataensemble/synkronus/internal/repository"
 	"github.com/opendataensemble/synkronus/pkg/logger"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Config contains authentication configuration
@@ -25,6 +26,16 @@ type Config struct {
 	AdminUsername string
 	// AdminPassword is the default admin password
 	AdminPassword string
+	// Password selects the algorithm and parameters for new password hashes
+	Password PasswordConfig
+	// SessionCheckInterval is how long an access token's session is trusted to be active
+	// before it is checked again, which bounds how long a revoked device keeps access
+	SessionCheckInterval time.Duration
+	// ImpersonationTokenExpiration is how long a token an admin is issued to act as another
+	// user is valid; such tokens cannot be refreshed
+	ImpersonationTokenExpiration time.Duration
+	// Cookies configures the cookie sessions of the portal
+	Cookies CookieConfig
 }
 
 // DefaultConfig returns a default configuration
@@ -35,6 +46,15 @@ func DefaultConfig() Config {
 		RefreshTokenExpiration: time.Hour * 24 * 7,
 		AdminUsername:          "admin",
 		AdminPassword:          "admin",
+		Password: PasswordConfig{
+			Algorithm: PasswordAlgorithmBcrypt,
+		},
+		SessionCheckInterval:         30 * time.Second,
+		ImpersonationTokenExpiration: 15 * time.Minute,
+		Cookies: CookieConfig{
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		},
 	}
 }
 
@@ -42,14 +62,24 @@ func DefaultConfig() Config {
 type AuthClaims struct {
 	Username string      `json:"username"`
 	Role     models.Role `json:"role"`
+	// SessionID is the session the token was issued for; empty for tokens issued before
+	// sessions were tracked
+	SessionID string `json:"sid,omitempty"`
+	// ImpersonatedBy is the admin acting as the user with this token; empty for the user's
+	// own tokens
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // Service provides authentication functionality
 type Service struct {
-	config         Config
-	userRepository repository.UserRepositoryInterface
-	log            *logger.Logger
+	config            Config
+	userRepository    repository.UserRepositoryInterface
+	sessionRepository repository.SessionRepositoryInterface
+	log               *logger.Logger
+
+	sessionMu      sync.Mutex
+	sessionChecked map[string]time.Time // session ID -> when it was last found active
 }
 
 // Config returns the service configuration
@@ -58,11 +88,13 @@ func (s *Service) Config() Config {
 }
 
 // NewService creates a new authentication service
-func NewService(config Config, userRepo repository.UserRepositoryInterface, log *logger.Logger) *Service {
+func NewService(config Config, userRepo repository.UserRepositoryInterface, sessionRepo repository.SessionRepositoryInterface, log *logger.Logger) *Service {
 	return &Service{
-		config:         config,
-		userRepository: userRepo,
-		log:            log,
+		config:            config,
+		userRepository:    userRepo,
+		sessionRepository: sessionRepo,
+		log:               log,
+		sessionChecked:    make(map[string]time.Time),
 	}
 }
 
@@ -82,19 +114,18 @@ func (s *Service) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password using the configured algorithm
 func (s *Service) HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := hashPassword(s.config.Password, password)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	return string(hashedBytes), nil
+	return hash, nil
 }
 
-// VerifyPassword checks if a password matches a hash
+// VerifyPassword checks if a password matches a bcrypt or argon2id hash
 func (s *Service) VerifyPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return verifyPassword(password, hash)
 }
 
 // CheckPasswordHash is an alias for VerifyPassword to implement the ServiceInterface
@@ -117,26 +148,35 @@ func (s *Service) Authenticate(ctx context.Context, username, password string) (
 		return nil, errors.New("invalid credentials")
 	}
 
+	if needsRehash(s.config.Password, user.PasswordHash) {
+		s.rehashPassword(ctx, user, password)
+	}
+
 	return user, nil
 }
 
-// GenerateToken creates a new JWT token for a user
-func (s *Service) GenerateToken(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(s.config.TokenExpiration)
-
-	claims := &AuthClaims{
-		Username: user.Username,
-		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   user.ID.String(),
-		},
+// rehashPassword upgrades a stored hash to the configured algorithm and parameters.
+// Failures are logged and do not affect the login.
+func (s *Service) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hash, err := s.HashPassword(password)
+	if err != nil {
+		s.log.Warn("Failed to rehash password", "username", user.Username, "error", err)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	previous := user.PasswordHash
+	user.PasswordHash = hash
+	if err := s.userRepository.Update(ctx, user); err != nil {
+		user.PasswordHash = previous
+		s.log.Warn("Failed to store rehashed password", "username", user.Username, "error", err)
+		return
+	}
+	s.log.Info("Rehashed password with current parameters", "username", user.Username)
+}
 
-	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+// GenerateToken creates a new JWT token for a user
+func (s *Service) GenerateToken(user *models.User) (string, error) {
+	tokenString, err := s.signToken(user, time.Now().Add(s.config.TokenExpiration), "")
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -146,26 +186,38 @@ func (s *Service) GenerateToken(user *models.User) (string, error) {
 
 // GenerateRefreshToken creates a new refresh token for a user
 func (s *Service) GenerateRefreshToken(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(s.config.RefreshTokenExpiration)
+	tokenString, err := s.signToken(user, time.Now().Add(s.config.RefreshTokenExpiration), "")
+	if err != nil {
+		return "", fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	return tokenString, nil
+}
 
-	claims := &AuthClaims{
-		Username: user.Username,
-		Role:     user.Role, // Include role in refresh token as well
+// signToken signs a JWT for a user, tied to a session if sessionID is set
+func (s *Service) signToken(user *models.User, expirationTime time.Time, sessionID string) (string, error) {
+	return s.signClaims(newClaims(user, expirationTime, sessionID))
+}
+
+// newClaims builds the claims of a token for a user
+func newClaims(user *models.User, expirationTime time.Time, sessionID string) *AuthClaims {
+	return &AuthClaims{
+		Username:  user.Username,
+		Role:      user.Role, // Included in refresh tokens as well
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.ID.String(),
 		},
 	}
+}
 
+// signClaims signs a JWT with the given claims
+func (s *Service) signClaims(claims *AuthClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign refresh token: %w", err)
-	}
-
-	return tokenString, nil
+	return token.SignedString([]byte(s.config.JWTSecret))
 }
 
 // ValidateToken validates a JWT token and returns the claims
@@ -190,13 +242,17 @@ func (s *Service) ValidateToken(tokenString string) (*AuthClaims, error) {
 	return claims, nil
 }
 
-// RefreshToken validates a refresh token and generates a new access token
-func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+// RefreshToken validates a refresh token and generates a new access token. The refresh
+// token's session must still be active; tokens issued before sessions were tracked start one.
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (string, string, error) {
 	// Validate the refresh token
 	claims, err := s.ValidateToken(refreshToken)
 	if err != nil {
 		return "", "", fmt.Errorf("invalid refresh token: %w", err)
 	}
+	if claims.ImpersonatedBy != "" {
+		return "", "", ErrImpersonationRefresh
+	}
 
 	// Get the user
 	user, err := s.userRepository.GetByUsername(ctx, claims.Username)
@@ -208,16 +264,8 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (string
 		return "", "", errors.New("user not found")
 	}
 
-	// Generate new tokens
-	newToken, err := s.GenerateToken(user)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	if claims.SessionID == "" {
+		return s.StartSession(ctx, user, client)
 	}
-
-	newRefreshToken, err := s.GenerateRefreshToken(user)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
-	}
-
-	return newToken, newRefreshToken, nil
+	return s.continueSession(ctx, user, claims.SessionID, client)
 }
@@ -30,7 +30,7 @@ func setupTestService() (*Service, *mocks.MockUserRepository) {
 	log := logger.NewLogger()
 
 	// Create the auth service with the mock repository
-	service := NewService(config, mockRepo, log)
+	service := NewService(config, mockRepo, mocks.NewMockSessionRepository(), log)
 
 	return service, mockRepo
 }
@@ -132,7 +132,7 @@ func TestRefreshToken(t *testing.T) {
 	assert.NotEmpty(t, refreshToken)
 
 	// Test the refresh token functionality
-	newToken, newRefreshToken, err := service.RefreshToken(ctx, refreshToken)
+	newToken, newRefreshToken, err := service.RefreshToken(ctx, refreshToken, ClientInfo{})
 
 	// Assertions
 	require.NoError(t, err)
@@ -201,7 +201,7 @@ func TestInitialize(t *testing.T) {
 		AdminPassword:          "admin",
 	}
 	log := logger.NewLogger()
-	service := NewService(config, mockRepo, log)
+	service := NewService(config, mockRepo, mocks.NewMockSessionRepository(), log)
 	ctx := context.Background()
 
 	// Test initialization
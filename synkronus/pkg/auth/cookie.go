@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CookieConfig configures the cookie sessions of the portal. When enabled, logging in
+// through the /api routes also sets the tokens as HttpOnly cookies, which then
+// authenticate /api requests without an Authorization header. Such requests must echo
+// the CSRF cookie in a header unless they only read.
+type CookieConfig struct {
+	// Enabled turns cookie sessions on; bearer tokens work either way
+	Enabled bool
+	// Secure limits the cookies to HTTPS; only turn it off for local development
+	Secure bool
+	// SameSite is the SameSite attribute of the cookies, strict or lax
+	SameSite http.SameSite
+}
+
+// ParseSameSite parses a SameSite setting: strict or lax. None is refused, as it would
+// send the session cookies along with requests from other sites.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite setting %q: must be strict or lax", value)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+)
+
+var (
+	// ErrImpersonationNotAllowed is returned when an admin tries to impersonate an admin,
+	// including themselves
+	ErrImpersonationNotAllowed = errors.New("admins cannot be impersonated")
+
+	// ErrImpersonationRefresh is returned when an impersonation token is used to refresh
+	ErrImpersonationRefresh = errors.New("impersonation tokens cannot be refreshed")
+)
+
+// MaxImpersonationReasonLength is the longest reason an admin may give for impersonating
+const MaxImpersonationReasonLength = 500
+
+// Impersonate starts a short-lived session of a user for an admin to act as them, for example
+// to see what the user pulls. The token names the admin, cannot be refreshed and is recorded
+// in the impersonation audit trail with the admin's reason.
+func (s *Service) Impersonate(ctx context.Context, admin, username, reason string, client ClientInfo) (string, *models.Session, error) {
+	user, err := s.sessionUser(ctx, username)
+	if err != nil {
+		return "", nil, err
+	}
+	if user.Role == models.RoleAdmin {
+		return "", nil, ErrImpersonationNotAllowed
+	}
+
+	session := &models.Session{
+		UserID:         user.ID,
+		DeviceName:     truncate("Impersonated by "+admin, maxDeviceNameLength),
+		IPAddress:      truncate(client.IPAddress, maxIPAddressLength),
+		UserAgent:      truncate(client.UserAgent, maxUserAgentLength),
+		ExpiresAt:      time.Now().Add(s.config.ImpersonationTokenExpiration),
+		ImpersonatedBy: &admin,
+	}
+	if err := s.sessionRepository.Create(ctx, session); err != nil {
+		return "", nil, fmt.Errorf("failed to start impersonation session: %w", err)
+	}
+
+	// No token is handed out unless its use can be traced back to the admin
+	entry := &models.ImpersonationAuditEntry{
+		SessionID: session.ID,
+		Admin:     admin,
+		Username:  user.Username,
+		Action:    models.ImpersonationStart,
+		Reason:    &reason,
+	}
+	if err := s.sessionRepository.AddImpersonationAudit(ctx, entry); err != nil {
+		if _, revokeErr := s.sessionRepository.Revoke(ctx, session.ID, user.ID); revokeErr != nil {
+			s.log.Error("Failed to revoke unaudited impersonation session", "session", session.ID, "error", revokeErr)
+		}
+		return "", nil, fmt.Errorf("failed to audit impersonation: %w", err)
+	}
+
+	claims := newClaims(user, session.ExpiresAt, session.ID.String())
+	claims.ImpersonatedBy = admin
+	token, err := s.signClaims(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	s.log.Info("Impersonation started", "admin", admin, "username", user.Username, "session", session.ID, "reason", reason, "expiresAt", session.ExpiresAt)
+	return token, session, nil
+}
+
+// RecordImpersonatedRequest adds a request made with an impersonation token to the audit trail
+func (s *Service) RecordImpersonatedRequest(ctx context.Context, claims *AuthClaims, method, path string, status int) error {
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("invalid impersonation session: %w", err)
+	}
+
+	entry := &models.ImpersonationAuditEntry{
+		SessionID: sessionID,
+		Admin:     claims.ImpersonatedBy,
+		Username:  claims.Username,
+		Action:    models.ImpersonationRequest,
+		Method:    &method,
+		Path:      &path,
+		Status:    &status,
+	}
+	if err := s.sessionRepository.AddImpersonationAudit(ctx, entry); err != nil {
+		return fmt.Errorf("failed to audit impersonated request: %w", err)
+	}
+	return nil
+}
+
+// ListImpersonationAudit lists the newest limit impersonation audit entries, only those of
+// one impersonated user if username is set
+func (s *Service) ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error) {
+	entries, err := s.sessionRepository.ListImpersonationAudit(ctx, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list impersonation audit: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonate(t *testing.T) {
+	service, _ := setupTestService()
+	service.config.SessionCheckInterval = 0
+	service.config.ImpersonationTokenExpiration = DefaultConfig().ImpersonationTokenExpiration
+	ctx := context.Background()
+
+	token, session, err := service.Impersonate(ctx, "admin", "testuser", "ticket 42", ClientInfo{IPAddress: "10.0.0.9"})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(DefaultConfig().ImpersonationTokenExpiration), session.ExpiresAt, time.Minute)
+
+	// The token acts as the user and names the admin
+	claims, err := service.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", claims.Username)
+	assert.Equal(t, models.RoleReadWrite, claims.Role)
+	assert.Equal(t, "admin", claims.ImpersonatedBy)
+	assert.Equal(t, session.ID.String(), claims.SessionID)
+	assert.NoError(t, service.CheckSession(ctx, claims))
+
+	// It cannot be turned into a regular session
+	_, _, err = service.RefreshToken(ctx, token, ClientInfo{})
+	assert.ErrorIs(t, err, ErrImpersonationRefresh)
+
+	require.NoError(t, service.RecordImpersonatedRequest(ctx, claims, "POST", "/sync/pull", 200))
+	entries, err := service.ListImpersonationAudit(ctx, "testuser", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.ImpersonationRequest, entries[0].Action)
+	assert.Equal(t, "/sync/pull", *entries[0].Path)
+	assert.Equal(t, models.ImpersonationStart, entries[1].Action)
+	assert.Equal(t, "ticket 42", *entries[1].Reason)
+
+	// The user can end it like any of their sessions
+	require.NoError(t, service.RevokeSession(ctx, "testuser", session.ID))
+	assert.ErrorIs(t, service.CheckSession(ctx, claims), ErrSessionRevoked)
+}
+
+func TestImpersonateRejectsAdmins(t *testing.T) {
+	service, _ := setupTestService()
+	ctx := context.Background()
+
+	_, _, err := service.Impersonate(ctx, "admin", "admin", "curious", ClientInfo{})
+	assert.ErrorIs(t, err, ErrImpersonationNotAllowed)
+	_, _, err = service.Impersonate(ctx, "admin", "nobody", "curious", ClientInfo{})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	entries, err := service.ListImpersonationAudit(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 
+	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
 )
 
@@ -20,8 +21,35 @@ type AuthServiceInterface interface {
 	// GenerateRefreshToken generates a refresh token for the given user
 	GenerateRefreshToken(user *models.User) (string, error)
 
-	// RefreshToken refreshes a token using the given refresh token
-	RefreshToken(ctx context.Context, refreshToken string) (string, string, error)
+	// StartSession records a new session for the user and returns an access and refresh token for it
+	StartSession(ctx context.Context, user *models.User, client ClientInfo) (string, string, error)
+
+	// RefreshToken refreshes a token using the given refresh token, if its session is still active
+	RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (string, string, error)
+
+	// CheckSession returns ErrSessionRevoked if the session of validated claims was revoked
+	CheckSession(ctx context.Context, claims *AuthClaims) error
+
+	// ListSessions lists a user's active sessions
+	ListSessions(ctx context.Context, username string) ([]models.Session, error)
+
+	// RevokeSession revokes one of a user's sessions
+	RevokeSession(ctx context.Context, username string, id uuid.UUID) error
+
+	// RevokeSessions revokes all of a user's sessions and returns how many were active
+	RevokeSessions(ctx context.Context, username string) (int, error)
+
+	// RevokeOtherSessions revokes a user's sessions except keep and returns how many were active
+	RevokeOtherSessions(ctx context.Context, username string, keep uuid.UUID) (int, error)
+
+	// Impersonate issues an admin a short-lived, audited token to act as a non-admin user
+	Impersonate(ctx context.Context, admin, username, reason string, client ClientInfo) (string, *models.Session, error)
+
+	// RecordImpersonatedRequest adds a request made with an impersonation token to the audit trail
+	RecordImpersonatedRequest(ctx context.Context, claims *AuthClaims, method, path string, status int) error
+
+	// ListImpersonationAudit lists the newest impersonation audit entries
+	ListImpersonationAudit(ctx context.Context, username string, limit int) ([]models.ImpersonationAuditEntry, error)
 
 	// ValidateToken validates a JWT token and returns the claims
 	ValidateToken(tokenString string) (*AuthClaims, error)
@@ -29,7 +57,7 @@ type AuthServiceInterface interface {
 	// Initialize initializes the authentication service
 	Initialize(ctx context.Context) error
 
-	// HashPassword hashes a password using bcrypt
+	// HashPassword hashes a password using the configured algorithm
 	HashPassword(password string) (string, error)
 
 	// CheckPasswordHash compares a password with a hash
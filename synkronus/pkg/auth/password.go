@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+// Default argon2id parameters (RFC 9106 second recommended option, with less memory)
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// ErrUnknownPasswordAlgorithm is returned for an unsupported PasswordConfig.Algorithm
+var ErrUnknownPasswordAlgorithm = errors.New("unknown password hashing algorithm")
+
+// PasswordConfig selects how new password hashes are created. Hashes made with other
+// algorithms or parameters still verify and are replaced on the next successful login.
+type PasswordConfig struct {
+	// Algorithm is bcrypt or argon2id; empty means bcrypt
+	Algorithm string
+	// BcryptCost is the bcrypt work factor; 0 means bcrypt.DefaultCost
+	BcryptCost int
+	// Argon2Memory is the argon2id memory in KiB; 0 means 64 MiB
+	Argon2Memory uint32
+	// Argon2Iterations is the argon2id number of passes; 0 means 3
+	Argon2Iterations uint32
+	// Argon2Parallelism is the argon2id number of lanes; 0 means 2
+	Argon2Parallelism uint8
+}
+
+// Validate checks that the configured algorithm and parameters are usable
+func (c PasswordConfig) Validate() error {
+	switch c.Algorithm {
+	case "", PasswordAlgorithmBcrypt:
+		if c.BcryptCost != 0 && (c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost) {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordAlgorithmArgon2id:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownPasswordAlgorithm, c.Algorithm)
+	}
+	return nil
+}
+
+// withDefaults fills unset parameters
+func (c PasswordConfig) withDefaults() PasswordConfig {
+	if c.Algorithm == "" {
+		c.Algorithm = PasswordAlgorithmBcrypt
+	}
+	if c.BcryptCost == 0 {
+		c.BcryptCost = bcrypt.DefaultCost
+	}
+	if c.Argon2Memory == 0 {
+		c.Argon2Memory = defaultArgon2Memory
+	}
+	if c.Argon2Iterations == 0 {
+		c.Argon2Iterations = defaultArgon2Iterations
+	}
+	if c.Argon2Parallelism == 0 {
+		c.Argon2Parallelism = defaultArgon2Parallelism
+	}
+	return c
+}
+
+// argon2Params are the parameters encoded in an argon2id hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// hashPassword creates a hash with the configured algorithm
+func hashPassword(config PasswordConfig, password string) (string, error) {
+	config = config.withDefaults()
+
+	if config.Algorithm == PasswordAlgorithmArgon2id {
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, config.Argon2Iterations, config.Argon2Memory, config.Argon2Parallelism, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, config.Argon2Memory, config.Argon2Iterations, config.Argon2Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedBytes), nil
+}
+
+// verifyPassword checks a password against a bcrypt or argon2id hash
+func verifyPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(key, params.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// needsRehash reports whether hash was made with a different algorithm or different
+// parameters than config
+func needsRehash(config PasswordConfig, hash string) bool {
+	config = config.withDefaults()
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if config.Algorithm != PasswordAlgorithmArgon2id {
+			return true
+		}
+		params, err := parseArgon2Hash(hash)
+		if err != nil {
+			return true
+		}
+		return params.memory != config.Argon2Memory ||
+			params.iterations != config.Argon2Iterations ||
+			params.parallelism != config.Argon2Parallelism
+	}
+
+	if config.Algorithm != PasswordAlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != config.BcryptCost
+}
+
+// parseArgon2Hash decodes a $argon2id$v=19$m=...,t=...,p=...$salt$key hash
+func parseArgon2Hash(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgorithmArgon2id {
+		return nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2id version")
+	}
+
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	return params, nil
+}
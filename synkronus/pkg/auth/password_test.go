@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Config keeps argon2id cheap enough for unit tests
+var testArgon2Config = PasswordConfig{
+	Algorithm:         PasswordAlgorithmArgon2id,
+	Argon2Memory:      1024,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+}
+
+func TestHashPassword_Argon2id(t *testing.T) {
+	hash, err := hashPassword(testArgon2Config, "secret")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(t, verifyPassword("secret", hash))
+	assert.False(t, verifyPassword("wrong", hash))
+	assert.False(t, needsRehash(testArgon2Config, hash))
+
+	// Salts differ between hashes of the same password
+	other, err := hashPassword(testArgon2Config, "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := hashPassword(PasswordConfig{BcryptCost: bcrypt.MinCost}, "secret")
+	require.NoError(t, err)
+	argonHash, err := hashPassword(testArgon2Config, "secret")
+	require.NoError(t, err)
+
+	stronger := testArgon2Config
+	stronger.Argon2Iterations = 2
+
+	assert.False(t, needsRehash(PasswordConfig{BcryptCost: bcrypt.MinCost}, bcryptHash))
+	assert.True(t, needsRehash(PasswordConfig{BcryptCost: bcrypt.MinCost + 1}, bcryptHash), "bcrypt cost changed")
+	assert.True(t, needsRehash(testArgon2Config, bcryptHash), "algorithm changed to argon2id")
+	assert.True(t, needsRehash(PasswordConfig{Algorithm: PasswordAlgorithmBcrypt}, argonHash), "algorithm changed to bcrypt")
+	assert.True(t, needsRehash(stronger, argonHash), "argon2id parameters changed")
+	assert.True(t, needsRehash(testArgon2Config, "not-a-hash"))
+}
+
+func TestPasswordConfigValidate(t *testing.T) {
+	assert.NoError(t, PasswordConfig{}.Validate())
+	assert.NoError(t, testArgon2Config.Validate())
+	assert.Error(t, PasswordConfig{BcryptCost: 100}.Validate())
+	assert.ErrorIs(t, PasswordConfig{Algorithm: "md5"}.Validate(), ErrUnknownPasswordAlgorithm)
+}
+
+func TestAuthenticate_RehashesOnLogin(t *testing.T) {
+	service, mockRepo := setupTestService()
+	ctx := context.Background()
+
+	user, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(user.PasswordHash, "$2"))
+
+	// Raise the parameters: the next successful login upgrades the stored hash
+	service.config.Password = testArgon2Config
+
+	authenticated, err := service.Authenticate(ctx, "testuser", "password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authenticated.PasswordHash, "$argon2id$"))
+
+	stored, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.PasswordHash, "$argon2id$"))
+	assert.True(t, verifyPassword("password123", stored.PasswordHash))
+
+	// The upgraded hash keeps working and is not rewritten again
+	_, err = service.Authenticate(ctx, "testuser", "password123")
+	require.NoError(t, err)
+	again, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	assert.Equal(t, stored.PasswordHash, again.PasswordHash)
+
+	// A failed login never touches the stored hash
+	service.config.Password = PasswordConfig{Algorithm: PasswordAlgorithmBcrypt}
+	_, err = service.Authenticate(ctx, "testuser", "wrong")
+	assert.Error(t, err)
+	unchanged, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	assert.Equal(t, stored.PasswordHash, unchanged.PasswordHash)
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+)
+
+var (
+	// ErrSessionRevoked is returned for a token whose session was revoked or has expired
+	ErrSessionRevoked = errors.New("session has been revoked or has expired")
+
+	// ErrSessionNotFound is returned when revoking a session the user doesn't have
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrUserNotFound is returned when listing or revoking the sessions of an unknown user
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Stored lengths of client details; longer values are cut
+const (
+	maxDeviceNameLength = 255
+	maxIPAddressLength  = 64
+	maxUserAgentLength  = 512
+)
+
+// ClientInfo describes the device a session is used from
+type ClientInfo struct {
+	// DeviceName is the name the client gives its device at login
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+}
+
+// StartSession records a new session for a user and issues an access and refresh token for it
+func (s *Service) StartSession(ctx context.Context, user *models.User, client ClientInfo) (string, string, error) {
+	session := &models.Session{
+		UserID:     user.ID,
+		DeviceName: truncate(client.DeviceName, maxDeviceNameLength),
+		IPAddress:  truncate(client.IPAddress, maxIPAddressLength),
+		UserAgent:  truncate(client.UserAgent, maxUserAgentLength),
+		ExpiresAt:  time.Now().Add(s.config.RefreshTokenExpiration),
+	}
+	if err := s.sessionRepository.Create(ctx, session); err != nil {
+		return "", "", fmt.Errorf("failed to start session: %w", err)
+	}
+
+	return s.sessionTokens(user, session.ID.String(), session.ExpiresAt)
+}
+
+// continueSession extends an active session on refresh and issues new tokens for it
+func (s *Service) continueSession(ctx context.Context, user *models.User, sessionID string, client ClientInfo) (string, string, error) {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return "", "", ErrSessionRevoked
+	}
+
+	expiresAt := time.Now().Add(s.config.RefreshTokenExpiration)
+	ok, err := s.sessionRepository.Touch(ctx, id, user.ID, truncate(client.IPAddress, maxIPAddressLength), expiresAt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to refresh session: %w", err)
+	}
+	if !ok {
+		s.forgetSession(sessionID)
+		return "", "", ErrSessionRevoked
+	}
+
+	return s.sessionTokens(user, sessionID, expiresAt)
+}
+
+// sessionTokens signs an access and refresh token for a session
+func (s *Service) sessionTokens(user *models.User, sessionID string, refreshExpiresAt time.Time) (string, string, error) {
+	token, err := s.signToken(user, time.Now().Add(s.config.TokenExpiration), sessionID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	refreshToken, err := s.signToken(user, refreshExpiresAt, sessionID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	return token, refreshToken, nil
+}
+
+// CheckSession returns ErrSessionRevoked if the session of a validated token is no longer
+// active. Active sessions are remembered for SessionCheckInterval so most requests don't
+// query the database; tokens without a session are left to expire.
+func (s *Service) CheckSession(ctx context.Context, claims *AuthClaims) error {
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	s.sessionMu.Lock()
+	checked, ok := s.sessionChecked[claims.SessionID]
+	s.sessionMu.Unlock()
+	if ok && time.Since(checked) < s.config.SessionCheckInterval {
+		return nil
+	}
+
+	id, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	active, err := s.sessionRepository.IsActive(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	if !active {
+		s.forgetSession(claims.SessionID)
+		return ErrSessionRevoked
+	}
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	now := time.Now()
+	// Drop stale entries now and then so sessions that are no longer used don't pile up
+	if len(s.sessionChecked) >= 10000 {
+		for sessionID, at := range s.sessionChecked {
+			if now.Sub(at) >= s.config.SessionCheckInterval {
+				delete(s.sessionChecked, sessionID)
+			}
+		}
+	}
+	s.sessionChecked[claims.SessionID] = now
+	return nil
+}
+
+// ListSessions lists a user's active sessions, most recently used first
+func (s *Service) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	user, err := s.sessionUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionRepository.ListActive(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one of a user's sessions, logging that device out
+func (s *Service) RevokeSession(ctx context.Context, username string, id uuid.UUID) error {
+	user, err := s.sessionUser(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.sessionRepository.Revoke(ctx, id, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.forgetSession(id.String())
+
+	s.log.Info("Session revoked", "username", username, "session", id)
+	return nil
+}
+
+// RevokeSessions revokes all of a user's sessions, logging them out everywhere, and
+// returns how many were active
+func (s *Service) RevokeSessions(ctx context.Context, username string) (int, error) {
+	return s.RevokeOtherSessions(ctx, username, uuid.Nil)
+}
+
+// RevokeOtherSessions revokes a user's sessions except keep, e.g. the one that changed the
+// password, and returns how many were active
+func (s *Service) RevokeOtherSessions(ctx context.Context, username string, keep uuid.UUID) (int, error) {
+	user, err := s.sessionUser(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	ids, err := s.sessionRepository.RevokeForUser(ctx, user.ID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	for _, id := range ids {
+		s.forgetSession(id.String())
+	}
+
+	if keep == uuid.Nil {
+		s.log.Info("All sessions revoked", "username", username, "count", len(ids))
+	} else {
+		s.log.Info("Other sessions revoked", "username", username, "kept", keep, "count", len(ids))
+	}
+	return len(ids), nil
+}
+
+// sessionUser looks up the user whose sessions are listed or revoked
+func (s *Service) sessionUser(ctx context.Context, username string) (*models.User, error) {
+	user, err := s.userRepository.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// forgetSession drops a session from the active cache so this instance rejects its tokens at once
+func (s *Service) forgetSession(sessionID string) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	delete(s.sessionChecked, sessionID)
+}
+
+// truncate cuts a client-supplied value to the stored length
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	// Don't leave half of a multi-byte character behind
+	return strings.ToValidUTF8(value[:length], "")
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	service, mockRepo := setupTestService()
+	service.config.SessionCheckInterval = 0 // Check the repository on every request
+	ctx := context.Background()
+
+	user, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+
+	token, refreshToken, err := service.StartSession(ctx, user, ClientInfo{DeviceName: "Field tablet", IPAddress: "10.0.0.7", UserAgent: "formulus/1.4"})
+	require.NoError(t, err)
+
+	claims, err := service.ValidateToken(token)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.SessionID)
+	assert.NoError(t, service.CheckSession(ctx, claims))
+
+	sessions, err := service.ListSessions(ctx, "testuser")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Field tablet", sessions[0].DeviceName)
+	assert.Equal(t, claims.SessionID, sessions[0].ID.String())
+
+	// Refreshing keeps the session and records the new address
+	_, refreshToken, err = service.RefreshToken(ctx, refreshToken, ClientInfo{IPAddress: "10.0.0.8"})
+	require.NoError(t, err)
+	sessions, err = service.ListSessions(ctx, "testuser")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "10.0.0.8", sessions[0].IPAddress)
+
+	// Another user can't revoke it
+	assert.ErrorIs(t, service.RevokeSession(ctx, "admin", sessions[0].ID), ErrSessionNotFound)
+
+	require.NoError(t, service.RevokeSession(ctx, "testuser", sessions[0].ID))
+	assert.ErrorIs(t, service.CheckSession(ctx, claims), ErrSessionRevoked)
+	_, _, err = service.RefreshToken(ctx, refreshToken, ClientInfo{})
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	assert.ErrorIs(t, service.RevokeSession(ctx, "testuser", sessions[0].ID), ErrSessionNotFound)
+}
+
+func TestRefreshTokenWithoutSessionStartsOne(t *testing.T) {
+	service, mockRepo := setupTestService()
+	ctx := context.Background()
+
+	user, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+
+	// Tokens issued before sessions were tracked have no session ID
+	refreshToken, err := service.GenerateRefreshToken(user)
+	require.NoError(t, err)
+
+	token, _, err := service.RefreshToken(ctx, refreshToken, ClientInfo{IPAddress: "10.0.0.7"})
+	require.NoError(t, err)
+	claims, err := service.ValidateToken(token)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.SessionID)
+
+	sessions, err := service.ListSessions(ctx, "testuser")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	service, mockRepo := setupTestService()
+	service.config.SessionCheckInterval = 0
+	ctx := context.Background()
+
+	user, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	var tokens []string
+	for _, device := range []string{"phone", "tablet"} {
+		token, _, err := service.StartSession(ctx, user, ClientInfo{DeviceName: device})
+		require.NoError(t, err)
+		tokens = append(tokens, token)
+	}
+
+	// Cache the first session as active; revocation must still take effect at once
+	claims, err := service.ValidateToken(tokens[0])
+	require.NoError(t, err)
+	service.config.SessionCheckInterval = DefaultConfig().SessionCheckInterval
+	require.NoError(t, service.CheckSession(ctx, claims))
+
+	count, err := service.RevokeSessions(ctx, "testuser")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ErrorIs(t, service.CheckSession(ctx, claims), ErrSessionRevoked)
+
+	sessions, err := service.ListSessions(ctx, "testuser")
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	_, err = service.RevokeSessions(ctx, "nobody")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	service, mockRepo := setupTestService()
+	service.config.SessionCheckInterval = 0
+	ctx := context.Background()
+
+	user, err := mockRepo.GetByUsername(ctx, "testuser")
+	require.NoError(t, err)
+	var claims []*AuthClaims
+	for _, device := range []string{"phone", "tablet"} {
+		token, _, err := service.StartSession(ctx, user, ClientInfo{DeviceName: device})
+		require.NoError(t, err)
+		c, err := service.ValidateToken(token)
+		require.NoError(t, err)
+		claims = append(claims, c)
+	}
+
+	// The session that changed the password stays logged in
+	keep := uuid.MustParse(claims[0].SessionID)
+	count, err := service.RevokeOtherSessions(ctx, "testuser", keep)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, service.CheckSession(ctx, claims[0]))
+	assert.ErrorIs(t, service.CheckSession(ctx, claims[1]), ErrSessionRevoked)
+
+	sessions, err := service.ListSessions(ctx, "testuser")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, keep, sessions[0].ID)
+}
+
+func TestCheckSessionWithoutSessionID(t *testing.T) {
+	service, _ := setupTestService()
+	claims := &AuthClaims{Username: "testuser", Role: models.RoleReadWrite}
+	assert.NoError(t, service.CheckSession(context.Background(), claims))
+
+	claims.SessionID = uuid.NewString()
+	assert.ErrorIs(t, service.CheckSession(context.Background(), claims), ErrSessionRevoked)
+}
+
+func TestTruncateKeepsValidUTF8(t *testing.T) {
+	assert.Equal(t, "ab", truncate("abé", 3))
+	assert.Equal(t, "short", truncate("short", 10))
+}
@@ -0,0 +1,370 @@
+package batchupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPatch is returned for a JSON Patch or field set that can't be applied to any document
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// errPatchFailed is returned when a patch can't be applied to one document, e.g. a test
+// operation that doesn't match or a path that doesn't exist
+var errPatchFailed = errors.New("patch does not apply")
+
+// Operation is a JSON Patch (RFC 6902) operation. Paths are JSON Pointers (RFC 6901)
+// into the observation data, e.g. /water_source or /household/members/0/age.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// compiledOperation is an operation with its pointers split and its value decoded
+type compiledOperation struct {
+	op    string
+	path  []string
+	from  []string
+	value interface{}
+}
+
+// Patch is a validated sequence of operations
+type Patch []compiledOperation
+
+// CompilePatch validates operations
+func CompilePatch(operations []Operation) (Patch, error) {
+	patch := make(Patch, 0, len(operations))
+	for i, operation := range operations {
+		compiled := compiledOperation{op: operation.Op}
+		var err error
+		if compiled.path, err = parsePointer(operation.Path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+		switch operation.Op {
+		case "add", "replace", "test":
+			if len(operation.Value) == 0 {
+				return nil, fmt.Errorf("%w: operation %d: %s requires a value", ErrInvalidPatch, i, operation.Op)
+			}
+			if compiled.value, err = decodeValue(operation.Value); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+			}
+		case "remove":
+		case "move", "copy":
+			if compiled.from, err = parsePointer(operation.From); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: from: %v", ErrInvalidPatch, i, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: operation %d: unknown op %q", ErrInvalidPatch, i, operation.Op)
+		}
+		if len(compiled.path) == 0 && operation.Op != "test" {
+			return nil, fmt.Errorf("%w: operation %d: the data itself can't be replaced", ErrInvalidPatch, i)
+		}
+		patch = append(patch, compiled)
+	}
+	return patch, nil
+}
+
+// FieldSetPatch turns a field set into a patch. Keys are field names, with dots
+// reaching into objects (household.head.name); missing objects along the way are created.
+func FieldSetPatch(set map[string]json.RawMessage) (Patch, error) {
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	patch := make(Patch, 0, len(set))
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("%w: invalid field %q", ErrInvalidPatch, field)
+			}
+		}
+		value, err := decodeValue(set[field])
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s: %v", ErrInvalidPatch, field, err)
+		}
+		patch = append(patch, compiledOperation{op: "set", path: path, value: value})
+	}
+	return patch, nil
+}
+
+// Apply applies the patch to a copy of data and returns the copy. Operations apply in
+// order and the patch applies as a whole or not at all.
+func (p Patch) Apply(data map[string]interface{}) (map[string]interface{}, error) {
+	doc := deepCopy(data).(map[string]interface{})
+	for _, operation := range p {
+		var err error
+		switch operation.op {
+		case "add":
+			err = addValue(doc, operation.path, deepCopy(operation.value))
+		case "remove":
+			_, err = removeValue(doc, operation.path)
+		case "replace":
+			if _, err = removeValue(doc, operation.path); err == nil {
+				err = addValue(doc, operation.path, deepCopy(operation.value))
+			}
+		case "move":
+			var value interface{}
+			if value, err = removeValue(doc, operation.from); err == nil {
+				err = addValue(doc, operation.path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = getValue(doc, operation.from); err == nil {
+				err = addValue(doc, operation.path, deepCopy(value))
+			}
+		case "test":
+			var value interface{}
+			if value, err = getValue(doc, operation.path); err == nil && !equalJSON(value, operation.value) {
+				err = fmt.Errorf("%w: test of /%s failed", errPatchFailed, strings.Join(operation.path, "/"))
+			}
+		case "set":
+			err = setField(doc, operation.path, deepCopy(operation.value))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// decodeValue decodes a JSON value keeping numbers as written
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// parent walks to the container holding the last token of path
+func parent(doc map[string]interface{}, path []string) (interface{}, string, error) {
+	var container interface{} = doc
+	for _, token := range path[:len(path)-1] {
+		child, err := child(container, token)
+		if err != nil {
+			return nil, "", err
+		}
+		container = child
+	}
+	return container, path[len(path)-1], nil
+}
+
+// child returns the member or element token of container
+func child(container interface{}, token string) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		value, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s does not exist", errPatchFailed, token)
+		}
+		return value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		return c[index], nil
+	default:
+		return nil, fmt.Errorf("%w: %s is not in an object or array", errPatchFailed, token)
+	}
+}
+
+// arrayIndex parses an array index no greater than max
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %s", errPatchFailed, token)
+	}
+	return index, nil
+}
+
+func getValue(doc map[string]interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return doc, nil
+	}
+	container, last, err := parent(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	return child(container, last)
+}
+
+// addValue adds a member or inserts an array element. Arrays are replaced in their
+// parent, so the parent must be an object or array itself.
+func addValue(doc map[string]interface{}, path []string, value interface{}) error {
+	container, last, err := parent(doc, path)
+	if err != nil {
+		return err
+	}
+	switch c := container.(type) {
+	case map[string]interface{}:
+		c[last] = value
+		return nil
+	case []interface{}:
+		index := len(c)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(c)); err != nil {
+				return err
+			}
+		}
+		c = append(c, nil)
+		copy(c[index+1:], c[index:])
+		c[index] = value
+		return replaceContainer(doc, path[:len(path)-1], c)
+	default:
+		return fmt.Errorf("%w: /%s is not in an object or array", errPatchFailed, strings.Join(path, "/"))
+	}
+}
+
+func removeValue(doc map[string]interface{}, path []string) (interface{}, error) {
+	container, last, err := parent(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	switch c := container.(type) {
+	case map[string]interface{}:
+		value, ok := c[last]
+		if !ok {
+			return nil, fmt.Errorf("%w: /%s does not exist", errPatchFailed, strings.Join(path, "/"))
+		}
+		delete(c, last)
+		return value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		value := c[index]
+		c = append(c[:index], c[index+1:]...)
+		return value, replaceContainer(doc, path[:len(path)-1], c)
+	default:
+		return nil, fmt.Errorf("%w: /%s is not in an object or array", errPatchFailed, strings.Join(path, "/"))
+	}
+}
+
+// replaceContainer stores a resized array back at path
+func replaceContainer(doc map[string]interface{}, path []string, value []interface{}) error {
+	container, last, err := parent(doc, path)
+	if err != nil {
+		return err
+	}
+	switch c := container.(type) {
+	case map[string]interface{}:
+		c[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(c)-1)
+		if err != nil {
+			return err
+		}
+		c[index] = value
+	}
+	return nil
+}
+
+// setField sets a dotted field, creating missing objects along the way
+func setField(doc map[string]interface{}, path []string, value interface{}) error {
+	object := doc
+	for _, name := range path[:len(path)-1] {
+		next, ok := object[name]
+		if !ok || next == nil {
+			created := map[string]interface{}{}
+			object[name] = created
+			object = created
+			continue
+		}
+		nested, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: %s is not an object", errPatchFailed, name)
+		}
+		object = nested
+	}
+	object[path[len(path)-1]] = value
+	return nil
+}
+
+// deepCopy copies decoded JSON
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// equalJSON compares decoded JSON values; numbers compare by value
+func equalJSON(a, b interface{}) bool {
+	if an, ok := a.(json.Number); ok {
+		if bn, ok := b.(json.Number); ok {
+			af, aErr := an.Float64()
+			bf, bErr := bn.Float64()
+			if aErr == nil && bErr == nil {
+				return af == bf
+			}
+			return an == bn
+		}
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, item := range av {
+			other, ok := bv[key]
+			if !ok || !equalJSON(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equalJSON(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,134 @@
+package batchupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPatchApply(t *testing.T) {
+	data := `{"water_source":"bore hole","household":{"members":[{"age":3},{"age":40}]},"tags":["a"]}`
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+		failed   bool
+	}{
+		{
+			name:     "replace",
+			patch:    `[{"op":"replace","path":"/water_source","value":"borehole"}]`,
+			expected: `{"water_source":"borehole","household":{"members":[{"age":3},{"age":40}]},"tags":["a"]}`,
+		},
+		{
+			name:     "test then replace nested",
+			patch:    `[{"op":"test","path":"/household/members/1/age","value":40},{"op":"replace","path":"/household/members/1/age","value":41}]`,
+			expected: `{"water_source":"bore hole","household":{"members":[{"age":3},{"age":41}]},"tags":["a"]}`,
+		},
+		{
+			name:     "add to array and remove",
+			patch:    `[{"op":"add","path":"/tags/-","value":"b"},{"op":"add","path":"/tags/0","value":"z"},{"op":"remove","path":"/water_source"}]`,
+			expected: `{"household":{"members":[{"age":3},{"age":40}]},"tags":["z","a","b"]}`,
+		},
+		{
+			name:     "move and copy",
+			patch:    `[{"op":"move","from":"/water_source","path":"/source"},{"op":"copy","from":"/tags","path":"/labels"}]`,
+			expected: `{"source":"bore hole","household":{"members":[{"age":3},{"age":40}]},"tags":["a"],"labels":["a"]}`,
+		},
+		{
+			name:     "escaped pointer",
+			patch:    `[{"op":"add","path":"/a~1b","value":1}]`,
+			expected: `{"a/b":1,"water_source":"bore hole","household":{"members":[{"age":3},{"age":40}]},"tags":["a"]}`,
+		},
+		{
+			name:   "failed test",
+			patch:  `[{"op":"test","path":"/water_source","value":"river"},{"op":"remove","path":"/tags"}]`,
+			failed: true,
+		},
+		{
+			name:   "missing path",
+			patch:  `[{"op":"replace","path":"/missing","value":1}]`,
+			failed: true,
+		},
+		{
+			name:   "index out of range",
+			patch:  `[{"op":"remove","path":"/tags/5"}]`,
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var operations []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &operations); err != nil {
+				t.Fatalf("Invalid test patch: %v", err)
+			}
+			patch, err := CompilePatch(operations)
+			if err != nil {
+				t.Fatalf("Failed to compile patch: %v", err)
+			}
+			original := decodeData(json.RawMessage(data))
+			patched, err := patch.Apply(original)
+			if tt.failed {
+				if !errors.Is(err, errPatchFailed) {
+					t.Fatalf("Expected the patch not to apply, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to apply patch: %v", err)
+			}
+			if !equalJSON(patched, decodeData(json.RawMessage(tt.expected))) {
+				encoded, _ := json.Marshal(patched)
+				t.Errorf("Expected %s, got %s", tt.expected, encoded)
+			}
+			// The input is left untouched
+			if !equalJSON(original, decodeData(json.RawMessage(data))) {
+				t.Errorf("Apply modified its input")
+			}
+		})
+	}
+}
+
+func TestCompilePatchErrors(t *testing.T) {
+	for _, patch := range []string{
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"replace","path":"a","value":1}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"remove","path":""}]`,
+		`[{"op":"move","path":"/a","from":"b"}]`,
+	} {
+		var operations []Operation
+		if err := json.Unmarshal([]byte(patch), &operations); err != nil {
+			t.Fatalf("Invalid test patch: %v", err)
+		}
+		if _, err := CompilePatch(operations); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("Expected ErrInvalidPatch for %s, got %v", patch, err)
+		}
+	}
+}
+
+func TestFieldSetPatch(t *testing.T) {
+	patch, err := FieldSetPatch(map[string]json.RawMessage{
+		"water_source":   json.RawMessage(`"borehole"`),
+		"household.head": json.RawMessage(`{"name":"A"}`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to build patch: %v", err)
+	}
+	patched, err := patch.Apply(map[string]interface{}{"water_source": "bore hole"})
+	if err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	expected := decodeData(json.RawMessage(`{"water_source":"borehole","household":{"head":{"name":"A"}}}`))
+	if !equalJSON(patched, expected) {
+		t.Errorf("Unexpected result: %v", patched)
+	}
+
+	// A field inside a non-object doesn't apply
+	if _, err := patch.Apply(map[string]interface{}{"household": "none"}); !errors.Is(err, errPatchFailed) {
+		t.Errorf("Expected the set not to apply, got %v", err)
+	}
+	if _, err := FieldSetPatch(map[string]json.RawMessage{"a..b": json.RawMessage(`1`)}); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Expected ErrInvalidPatch for an empty field name, got %v", err)
+	}
+}
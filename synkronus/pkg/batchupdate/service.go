@@ -0,0 +1,544 @@
+// Package batchupdate cleans observation data in bulk: it applies a field set or a JSON
+// Patch to every observation of a form type matching a predicate, in a background job
+// that records an audit entry per change and gives changed observations new versions.
+package batchupdate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidRequest is returned for a batch update that can't be run
+	ErrInvalidRequest = errors.New("invalid batch update")
+	// ErrJobNotFound is returned for an unknown job ID
+	ErrJobNotFound = errors.New("batch update job not found")
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Config contains batch update configuration
+type Config struct {
+	// BatchSize is the number of observations updated per transaction
+	BatchSize int
+	// PreviewLimit is the number of changes listed by a dry run
+	PreviewLimit int
+	// Calculator recomputes calculated fields of changed observations; nil leaves them as patched
+	Calculator Calculator
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:    500,
+		PreviewLimit: 20,
+	}
+}
+
+// Calculator recomputes the x-calculated fields of an observation's data
+type Calculator interface {
+	Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []calculation.Mismatch, error)
+}
+
+// Request describes a batch update. Exactly one of Set and Patch is given.
+type Request struct {
+	// FormType selects the observations to update
+	FormType string `json:"form_type"`
+	// Where is a predicate in the x-calculated expression language, e.g.
+	// "water_source == 'bore hole'"; observations for which it is true are updated.
+	// Empty matches every observation of the form type.
+	Where string `json:"where,omitempty"`
+	// Set maps field names (dots reach into objects) to their new values
+	Set map[string]json.RawMessage `json:"set,omitempty"`
+	// Patch is a JSON Patch applied to the data of each matching observation
+	Patch []Operation `json:"patch,omitempty"`
+	// Reason is recorded with the job and every audit entry
+	Reason string `json:"reason,omitempty"`
+}
+
+// Change is the data of one observation before and after the update
+type Change struct {
+	ObservationID string          `json:"observation_id"`
+	Version       int64           `json:"version"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+}
+
+// Preview is the outcome of a dry run
+type Preview struct {
+	Scanned int `json:"scanned"`
+	Matched int `json:"matched"`
+	// Changed observations would get new data; matched observations the update leaves
+	// as they are are not counted
+	Changed int `json:"changed"`
+	// Skipped observations matched but the patch did not apply, e.g. a failing test operation
+	Skipped int `json:"skipped"`
+	// Changes lists the first changed observations
+	Changes []Change `json:"changes"`
+}
+
+// Job is a batch update run in the background
+type Job struct {
+	ID          int64      `json:"id"`
+	Status      string     `json:"status"`
+	Request     Request    `json:"request"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	Scanned     int        `json:"scanned"`
+	Matched     int        `json:"matched"`
+	Updated     int        `json:"updated"`
+	Skipped     int        `json:"skipped"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Service runs batch updates of observation data
+type Service interface {
+	// Initialize fails the jobs that a restart interrupted
+	Initialize(ctx context.Context) error
+	// Preview reports what a batch update would change, without changing anything
+	Preview(ctx context.Context, req Request) (*Preview, error)
+	// Submit validates a batch update and starts it as a background job
+	Submit(ctx context.Context, req Request, requestedBy string) (*Job, error)
+	// GetJob returns a job with its progress
+	GetJob(ctx context.Context, id int64) (*Job, error)
+	// ListJobs returns the most recent jobs, newest first
+	ListJobs(ctx context.Context, limit int) ([]Job, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+	jobs   sync.WaitGroup // running jobs
+}
+
+// NewService creates a new batch update service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	defaults := DefaultConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.PreviewLimit <= 0 {
+		config.PreviewLimit = defaults.PreviewLimit
+	}
+	return &service{db: db, config: config, log: log}
+}
+
+// plan is a validated request
+type plan struct {
+	formType string
+	where    *calculation.Expression
+	patch    Patch
+}
+
+// compile validates a request
+func compile(req Request) (*plan, error) {
+	if strings.TrimSpace(req.FormType) == "" {
+		return nil, fmt.Errorf("%w: form_type is required", ErrInvalidRequest)
+	}
+	if (len(req.Set) == 0) == (len(req.Patch) == 0) {
+		return nil, fmt.Errorf("%w: exactly one of set and patch is required", ErrInvalidRequest)
+	}
+
+	p := &plan{formType: req.FormType}
+	if strings.TrimSpace(req.Where) != "" {
+		where, err := calculation.Parse(req.Where)
+		if err != nil {
+			return nil, fmt.Errorf("%w: where: %v", ErrInvalidRequest, err)
+		}
+		p.where = where
+	}
+
+	var err error
+	if len(req.Set) > 0 {
+		p.patch, err = FieldSetPatch(req.Set)
+	} else {
+		p.patch, err = CompilePatch(req.Patch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return p, nil
+}
+
+// storedObservation is an observation being updated
+type storedObservation struct {
+	id      string
+	version int64
+	before  json.RawMessage
+	after   json.RawMessage
+}
+
+// outcome of applying a plan to one observation
+const (
+	unmatched = iota
+	unchanged
+	skipped
+	changed
+)
+
+// apply runs the plan on one observation, setting obs.after when the data changes
+func (s *service) apply(ctx context.Context, p *plan, obs *storedObservation) int {
+	data := decodeData(obs.before)
+	if data == nil {
+		return unmatched
+	}
+	if p.where != nil && p.where.Eval(data) != true {
+		return unmatched
+	}
+
+	patched, err := p.patch.Apply(data)
+	if err != nil {
+		return skipped
+	}
+	if equalJSON(data, patched) {
+		return unchanged
+	}
+
+	after, err := json.Marshal(patched)
+	if err != nil {
+		return skipped
+	}
+	if s.config.Calculator != nil {
+		recomputed, _, err := s.config.Calculator.Recompute(ctx, p.formType, after)
+		if err != nil {
+			s.log.Warn("Failed to recompute calculated fields", "error", err, "observationId", obs.id, "formType", p.formType)
+		} else {
+			after = recomputed
+		}
+	}
+	obs.after = after
+	return changed
+}
+
+// decodeData parses observation data, keeping numbers as written; data that isn't a
+// JSON object yields nil
+func decodeData(data json.RawMessage) map[string]interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+	return object
+}
+
+// scan calls fn with each batch of observations of the form type, in observation ID order
+func (s *service) scan(ctx context.Context, formType string, fn func([]storedObservation) error) error {
+	after := ""
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT observation_id, version, data
+			FROM observations
+			WHERE form_type = $1 AND NOT deleted AND observation_id > $2
+			ORDER BY observation_id
+			LIMIT $3`,
+			formType, after, s.config.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query observations: %w", err)
+		}
+
+		var batch []storedObservation
+		for rows.Next() {
+			var obs storedObservation
+			var data []byte
+			if err := rows.Scan(&obs.id, &obs.version, &data); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan observation: %w", err)
+			}
+			obs.before = data
+			batch = append(batch, obs)
+			after = obs.id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating observations: %w", err)
+		}
+
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		if len(batch) < s.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// Preview reports what a batch update would change
+func (s *service) Preview(ctx context.Context, req Request) (_ *Preview, err error) {
+	ctx, span := tracing.Start(ctx, "batchupdate.Preview", attribute.String("batchupdate.form_type", req.FormType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	p, err := compile(req)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{Changes: []Change{}}
+	err = s.scan(ctx, p.formType, func(batch []storedObservation) error {
+		for i := range batch {
+			obs := &batch[i]
+			preview.Scanned++
+			switch s.apply(ctx, p, obs) {
+			case unmatched:
+				continue
+			case skipped:
+				preview.Skipped++
+			case changed:
+				preview.Changed++
+				if len(preview.Changes) < s.config.PreviewLimit {
+					preview.Changes = append(preview.Changes, Change{ObservationID: obs.id, Version: obs.version, Before: obs.before, After: obs.after})
+				}
+			}
+			preview.Matched++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// Submit records a job and runs it in the background
+func (s *service) Submit(ctx context.Context, req Request, requestedBy string) (_ *Job, err error) {
+	ctx, span := tracing.Start(ctx, "batchupdate.Submit", attribute.String("batchupdate.form_type", req.FormType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	p, err := compile(req)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	job := &Job{Status: StatusQueued, Request: req, RequestedBy: requestedBy}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO observation_batch_updates (form_type, request, reason, requested_by, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		req.FormType, encoded, req.Reason, nullString(requestedBy), StatusQueued).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch update job: %w", err)
+	}
+
+	s.log.Info("Batch update submitted", "jobId", job.ID, "formType", req.FormType, "requestedBy", requestedBy)
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.run(context.Background(), job.ID, p, requestedBy, req.Reason)
+	}()
+	return job, nil
+}
+
+// run processes a job to completion, recording its progress
+func (s *service) run(ctx context.Context, jobID int64, p *plan, requestedBy, reason string) {
+	ctx, span := tracing.Start(ctx, "batchupdate.run", attribute.Int64("batchupdate.job_id", jobID))
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE observation_batch_updates SET status = $1, started_at = NOW() WHERE id = $2",
+		StatusRunning, jobID); err != nil {
+		s.log.Error("Failed to start batch update job", "jobId", jobID, "error", err)
+	}
+
+	var scanned, matched, updated, skippedCount int
+	err := s.scan(ctx, p.formType, func(batch []storedObservation) error {
+		var changes []storedObservation
+		for i := range batch {
+			obs := &batch[i]
+			scanned++
+			switch s.apply(ctx, p, obs) {
+			case unmatched:
+				continue
+			case skipped:
+				skippedCount++
+			case changed:
+				changes = append(changes, *obs)
+			}
+			matched++
+		}
+
+		if len(changes) > 0 {
+			n, err := s.write(ctx, jobID, changes, requestedBy, reason)
+			if err != nil {
+				return err
+			}
+			updated += n
+			// Observations changed since they were read keep their data
+			skippedCount += len(changes) - n
+		}
+
+		_, err := s.db.ExecContext(ctx,
+			"UPDATE observation_batch_updates SET scanned = $1, matched = $2, updated = $3, skipped = $4 WHERE id = $5",
+			scanned, matched, updated, skippedCount, jobID)
+		return err
+	})
+
+	status, message := StatusCompleted, ""
+	if err != nil {
+		status, message = StatusFailed, err.Error()
+		tracing.RecordError(span, err)
+		s.log.Error("Batch update failed", "jobId", jobID, "error", err)
+	} else {
+		s.log.Info("Batch update completed", "jobId", jobID, "scanned", scanned, "matched", matched, "updated", updated, "skipped", skippedCount)
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE observation_batch_updates
+		SET status = $1, error = $2, scanned = $3, matched = $4, updated = $5, skipped = $6, finished_at = NOW()
+		WHERE id = $7`,
+		status, nullString(message), scanned, matched, updated, skippedCount, jobID); err != nil {
+		s.log.Error("Failed to finish batch update job", "jobId", jobID, "error", err)
+	}
+}
+
+// write stores changed observations with new versions and an audit entry each, in one
+// transaction. Observations whose version changed since they were read are left alone.
+func (s *service) write(ctx context.Context, jobID int64, changes []storedObservation, requestedBy, reason string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE sync_version SET current_version = current_version + $1, updated_at = NOW() WHERE id = 1 RETURNING current_version",
+		len(changes)).Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve versions: %w", err)
+	}
+	version := current - int64(len(changes)) + 1
+
+	updated := 0
+	for _, obs := range changes {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE observations SET data = $1, updated_at = NOW(), version = $2 WHERE observation_id = $3 AND version = $4",
+			[]byte(obs.after), version, obs.id, obs.version)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update observation %s: %w", obs.id, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO observation_audit (observation_id, batch_update_id, previous_version, version, data_before, data_after, changed_by, reason)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				obs.id, jobID, obs.version, version, []byte(obs.before), []byte(obs.after), nullString(requestedBy), nullString(reason)); err != nil {
+				return 0, fmt.Errorf("failed to record audit entry for %s: %w", obs.id, err)
+			}
+		}
+		version++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// Initialize fails the jobs that were running or queued when the server stopped
+func (s *service) Initialize(ctx context.Context) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE observation_batch_updates
+		SET status = $1, error = 'interrupted by a server restart', finished_at = NOW()
+		WHERE status IN ($2, $3)`,
+		StatusFailed, StatusQueued, StatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to fail interrupted batch updates: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		s.log.Warn("Marked interrupted batch updates as failed", "count", n)
+	}
+	return nil
+}
+
+const jobColumns = `id, status, request, requested_by, scanned, matched, updated, skipped, error, created_at, started_at, finished_at`
+
+// scanJob reads a row of jobColumns
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var request []byte
+	var requestedBy, message sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Status, &request, &requestedBy, &job.Scanned, &job.Matched, &job.Updated, &job.Skipped,
+		&message, &job.CreatedAt, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(request, &job.Request); err != nil {
+		return nil, fmt.Errorf("failed to decode request of job %d: %w", job.ID, err)
+	}
+	job.RequestedBy = requestedBy.String
+	job.Error = message.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// GetJob returns a job
+func (s *service) GetJob(ctx context.Context, id int64) (*Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM observation_batch_updates WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch update job: %w", err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the most recent jobs
+func (s *service) ListJobs(ctx context.Context, limit int) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+jobColumns+" FROM observation_batch_updates ORDER BY id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batch update jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan batch update job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
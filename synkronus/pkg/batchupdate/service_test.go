@@ -0,0 +1,220 @@
+package batchupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// observationRows returns the rows of a scan
+func observationRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"observation_id", "version", "data"}).
+		AddRow("obs-1", int64(3), []byte(`{"water_source":"bore hole","village":"A"}`)).
+		AddRow("obs-2", int64(4), []byte(`{"water_source":"river","village":"B"}`)).
+		AddRow("obs-3", int64(5), []byte(`{"water_source":"bore hole","village":"C"}`))
+}
+
+var waterSourceFix = Request{
+	FormType: "household",
+	Where:    "water_source == 'bore hole'",
+	Set:      map[string]json.RawMessage{"water_source": json.RawMessage(`"borehole"`)},
+	Reason:   "Normalize option value",
+}
+
+func TestCompile(t *testing.T) {
+	set := map[string]json.RawMessage{"a": json.RawMessage(`1`)}
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"missing form type", Request{Set: set}},
+		{"neither set nor patch", Request{FormType: "household"}},
+		{"both set and patch", Request{FormType: "household", Set: set, Patch: []Operation{{Op: "remove", Path: "/a"}}}},
+		{"invalid where", Request{FormType: "household", Set: set, Where: "a == "}},
+		{"invalid patch", Request{FormType: "household", Patch: []Operation{{Op: "remove", Path: "a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compile(tt.req); !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("Expected ErrInvalidRequest, got %v", err)
+			}
+		})
+	}
+
+	if _, err := compile(waterSourceFix); err != nil {
+		t.Errorf("Expected a valid request, got %v", err)
+	}
+}
+
+func TestService_Preview(t *testing.T) {
+	config := DefaultConfig()
+	config.PreviewLimit = 1
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, config, logger.NewLogger()).(*service)
+
+	mock.ExpectQuery(`SELECT observation_id, version, data`).
+		WithArgs("household", "", 500).
+		WillReturnRows(observationRows())
+
+	preview, err := s.Preview(context.Background(), waterSourceFix)
+	if err != nil {
+		t.Fatalf("Failed to preview: %v", err)
+	}
+	if preview.Scanned != 3 || preview.Matched != 2 || preview.Changed != 2 || preview.Skipped != 0 {
+		t.Errorf("Unexpected counts: %+v", preview)
+	}
+	if len(preview.Changes) != 1 || preview.Changes[0].ObservationID != "obs-1" {
+		t.Fatalf("Expected the first change only, got %+v", preview.Changes)
+	}
+	if string(preview.Changes[0].After) != `{"village":"A","water_source":"borehole"}` {
+		t.Errorf("Unexpected data after: %s", preview.Changes[0].After)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_PreviewSkipsFailedPatches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, DefaultConfig(), logger.NewLogger()).(*service)
+	mock.ExpectQuery(`SELECT observation_id, version, data`).WillReturnRows(observationRows())
+
+	preview, err := s.Preview(context.Background(), Request{
+		FormType: "household",
+		Patch: []Operation{
+			{Op: "test", Path: "/village", Value: json.RawMessage(`"B"`)},
+			{Op: "replace", Path: "/water_source", Value: json.RawMessage(`"stream"`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to preview: %v", err)
+	}
+	if preview.Matched != 3 || preview.Changed != 1 || preview.Skipped != 2 {
+		t.Errorf("Unexpected counts: %+v", preview)
+	}
+}
+
+func TestService_SubmitAndRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, DefaultConfig(), logger.NewLogger()).(*service)
+	ctx := context.Background()
+
+	mock.ExpectQuery(`INSERT INTO observation_batch_updates`).
+		WithArgs("household", sqlmock.AnyArg(), "Normalize option value", "admin", StatusQueued).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), time.Now()))
+	mock.ExpectExec(`UPDATE observation_batch_updates SET status = \$1, started_at`).
+		WithArgs(StatusRunning, int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT observation_id, version, data`).WillReturnRows(observationRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(11)))
+	mock.ExpectExec(`UPDATE observations SET data`).
+		WithArgs([]byte(`{"village":"A","water_source":"borehole"}`), int64(10), "obs-1", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observation_audit`).
+		WithArgs("obs-1", int64(7), int64(3), int64(10), sqlmock.AnyArg(), sqlmock.AnyArg(), "admin", "Normalize option value").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// obs-3 changed since it was read
+	mock.ExpectExec(`UPDATE observations SET data`).
+		WithArgs(sqlmock.AnyArg(), int64(11), "obs-3", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE observation_batch_updates SET scanned`).
+		WithArgs(3, 2, 1, 1, int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE observation_batch_updates\s+SET status = \$1, error`).
+		WithArgs(StatusCompleted, nil, 3, 2, 1, 1, int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	job, err := s.Submit(ctx, waterSourceFix, "admin")
+	if err != nil {
+		t.Fatalf("Failed to submit: %v", err)
+	}
+	if job.ID != 7 || job.Status != StatusQueued {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+	s.jobs.Wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_SubmitInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, DefaultConfig(), logger.NewLogger()).(*service)
+	if _, err := s.Submit(context.Background(), Request{FormType: "household"}, "admin"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected no queries: %v", err)
+	}
+}
+
+func TestService_GetJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, DefaultConfig(), logger.NewLogger()).(*service)
+	ctx := context.Background()
+	columns := []string{"id", "status", "request", "requested_by", "scanned", "matched", "updated", "skipped", "error", "created_at", "started_at", "finished_at"}
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, status, request`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(int64(7), StatusCompleted, []byte(`{"form_type":"household","set":{"a":1}}`),
+			"admin", 3, 2, 2, 0, nil, now, now, now))
+	job, err := s.GetJob(ctx, 7)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Request.FormType != "household" || job.Updated != 2 || job.FinishedAt == nil || job.RequestedBy != "admin" {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	mock.ExpectQuery(`SELECT id, status, request`).WithArgs(int64(8)).WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := s.GetJob(ctx, 8); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestService_Initialize(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, DefaultConfig(), logger.NewLogger()).(*service)
+	mock.ExpectExec(`UPDATE observation_batch_updates`).
+		WithArgs(StatusFailed, StatusQueued, StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := s.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
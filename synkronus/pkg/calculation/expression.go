@@ -0,0 +1,621 @@
+package calculation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidExpression is returned for an x-calculated formula that can't be parsed
+var ErrInvalidExpression = errors.New("invalid calculation expression")
+
+// Expression is a parsed x-calculated formula. Formulas are arithmetic over the
+// observation's data fields:
+//
+//	weight / ((height / 100) * (height / 100))
+//	if(age >= 18, 'adult', 'child')
+//	round(systolic / diastolic, 2)
+//
+// Values are numbers, strings, booleans or null. Arithmetic with a missing field or
+// division by zero yields null rather than an error, so a partly filled form computes
+// what it can.
+type Expression struct {
+	source string
+	root   node
+	fields []string
+}
+
+// Source returns the formula text
+func (e *Expression) Source() string {
+	return e.source
+}
+
+// Fields returns the data field paths the formula reads, in order of first use
+func (e *Expression) Fields() []string {
+	return e.fields
+}
+
+// Eval evaluates the formula over an observation's data
+func (e *Expression) Eval(data map[string]interface{}) interface{} {
+	return normalizeValue(e.root.eval(data))
+}
+
+// Parse parses an x-calculated formula
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, source, err)
+	}
+	p := &parser{tokens: tokens, seen: map[string]bool{}}
+	root, err := p.parseExpression(0)
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, source, err)
+	}
+	return &Expression{source: source, root: root, fields: p.fields}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists the operator tokens, longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ","}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+					i++
+				}
+			}
+			if _, err := strconv.ParseFloat(source[start:i], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", source[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], pos: start})
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			for i++; ; i++ {
+				if i >= len(source) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+					sb.WriteByte(source[i])
+					continue
+				}
+				if source[i] == c {
+					i++
+					break
+				}
+				sb.WriteByte(source[i])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			start := i
+			for i < len(source) && (source[i] == '_' || source[i] == '.' || source[i] >= 'A' && source[i] <= 'Z' ||
+				source[i] >= 'a' && source[i] <= 'z' || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+			name := source[start:i]
+			if strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+				return nil, fmt.Errorf("invalid field path %q at position %d", name, start)
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: name, pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// binaryPrecedence is the binding power of each binary operator
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// unaryPrecedence binds unary minus and not tighter than any binary operator
+const unaryPrecedence = 7
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields []string
+	seen   map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokenOperator || t.text != op {
+		return fmt.Errorf("expected %q at position %d", op, t.pos)
+	}
+	return nil
+}
+
+// parseExpression parses operators binding tighter than minPrecedence
+func (p *parser) parseExpression(minPrecedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		precedence, ok := binaryPrecedence[t.text]
+		if t.kind != tokenOperator || !ok || precedence <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpression(precedence)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "-" || t.text == "!") {
+		p.next()
+		operand, err := p.parseExpression(unaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: t.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		f, _ := strconv.ParseFloat(t.text, 64)
+		return literalNode{value: f}, nil
+	case tokenString:
+		return literalNode{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		if p.peek().kind == tokenOperator && p.peek().text == "(" {
+			return p.parseCall(t)
+		}
+		if !p.seen[t.text] {
+			p.seen[t.text] = true
+			p.fields = append(p.fields, t.text)
+		}
+		return fieldNode{path: strings.Split(t.text, ".")}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	p.next() // (
+
+	var args []node
+	if t := p.peek(); t.kind != tokenOperator || t.text != ")" {
+		for {
+			arg, err := p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if t := p.peek(); t.kind == tokenOperator && t.text == "," {
+				p.next()
+				continue
+			}
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s at position %d", name.text, name.pos)
+	}
+	return callNode{fn: fn, args: args}, nil
+}
+
+// node is an element of a parsed formula
+type node interface {
+	eval(data map[string]interface{}) interface{}
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+type fieldNode struct {
+	path []string
+}
+
+func (n fieldNode) eval(data map[string]interface{}) interface{} {
+	var value interface{} = data
+	for _, key := range n.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	return value
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n unaryNode) eval(data map[string]interface{}) interface{} {
+	value := n.operand.eval(data)
+	if n.op == "!" {
+		return !truthy(value)
+	}
+	if f, ok := toNumber(value); ok {
+		return -f
+	}
+	return nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) eval(data map[string]interface{}) interface{} {
+	// Logical operators short-circuit
+	switch n.op {
+	case "&&":
+		return truthy(n.left.eval(data)) && truthy(n.right.eval(data))
+	case "||":
+		return truthy(n.left.eval(data)) || truthy(n.right.eval(data))
+	}
+
+	left, right := n.left.eval(data), n.right.eval(data)
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "<", "<=", ">", ">=":
+		c, ok := compare(left, right)
+		if !ok {
+			return nil
+		}
+		switch n.op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}
+
+	a, okA := toNumber(left)
+	b, okB := toNumber(right)
+	if !okA || !okB {
+		return nil
+	}
+	switch n.op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		if b == 0 {
+			return nil
+		}
+		return a / b
+	case "%":
+		if b == 0 {
+			return nil
+		}
+		return math.Mod(a, b)
+	}
+	return nil
+}
+
+type callNode struct {
+	fn   function
+	args []node
+}
+
+func (n callNode) eval(data map[string]interface{}) interface{} {
+	return n.fn.call(n.args, data)
+}
+
+// function is a formula function. Arguments are passed unevaluated so that if() and
+// coalesce() only evaluate what they need.
+type function struct {
+	minArgs, maxArgs int // maxArgs -1 is variadic
+	call             func(args []node, data map[string]interface{}) interface{}
+}
+
+// functions are the functions available to formulas
+var functions = map[string]function{
+	"abs":   numericFunction(math.Abs),
+	"floor": numericFunction(math.Floor),
+	"ceil":  numericFunction(math.Ceil),
+	"round": {minArgs: 1, maxArgs: 2, call: func(args []node, data map[string]interface{}) interface{} {
+		x, ok := toNumber(args[0].eval(data))
+		if !ok {
+			return nil
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			if digits, ok = toNumber(args[1].eval(data)); !ok {
+				return nil
+			}
+		}
+		scale := math.Pow(10, math.Trunc(digits))
+		return math.Round(x*scale) / scale
+	}},
+	"min": {minArgs: 1, maxArgs: -1, call: func(args []node, data map[string]interface{}) interface{} {
+		return extreme(args, data, func(a, b float64) bool { return a < b })
+	}},
+	"max": {minArgs: 1, maxArgs: -1, call: func(args []node, data map[string]interface{}) interface{} {
+		return extreme(args, data, func(a, b float64) bool { return a > b })
+	}},
+	"if": {minArgs: 3, maxArgs: 3, call: func(args []node, data map[string]interface{}) interface{} {
+		if truthy(args[0].eval(data)) {
+			return args[1].eval(data)
+		}
+		return args[2].eval(data)
+	}},
+	"coalesce": {minArgs: 1, maxArgs: -1, call: func(args []node, data map[string]interface{}) interface{} {
+		for _, arg := range args {
+			if value := arg.eval(data); value != nil {
+				return value
+			}
+		}
+		return nil
+	}},
+	"concat": {minArgs: 1, maxArgs: -1, call: func(args []node, data map[string]interface{}) interface{} {
+		var sb strings.Builder
+		for _, arg := range args {
+			sb.WriteString(toString(arg.eval(data)))
+		}
+		return sb.String()
+	}},
+	"number": {minArgs: 1, maxArgs: 1, call: func(args []node, data map[string]interface{}) interface{} {
+		if f, ok := toNumber(args[0].eval(data)); ok {
+			return f
+		}
+		return nil
+	}},
+	"count": {minArgs: 1, maxArgs: 1, call: func(args []node, data map[string]interface{}) interface{} {
+		switch v := args[0].eval(data).(type) {
+		case nil:
+			return 0.0
+		case []interface{}:
+			return float64(len(v))
+		default:
+			return 1.0
+		}
+	}},
+}
+
+// numericFunction wraps a single-argument math function
+func numericFunction(f func(float64) float64) function {
+	return function{minArgs: 1, maxArgs: 1, call: func(args []node, data map[string]interface{}) interface{} {
+		if x, ok := toNumber(args[0].eval(data)); ok {
+			return f(x)
+		}
+		return nil
+	}}
+}
+
+// extreme returns the smallest or largest numeric argument, ignoring nulls
+func extreme(args []node, data map[string]interface{}, better func(a, b float64) bool) interface{} {
+	var result interface{}
+	for _, arg := range args {
+		x, ok := toNumber(arg.eval(data))
+		if !ok {
+			continue
+		}
+		if result == nil || better(x, result.(float64)) {
+			result = x
+		}
+	}
+	return result
+}
+
+// toNumber converts numbers and numeric strings; other values aren't numbers
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString formats a value for concat; null is empty
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// truthy treats null, false, zero and the empty string as false
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+// equal compares values, numerically when both sides are numbers or numeric strings
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if x, ok := a.(bool); ok {
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	x, okA := a.(string)
+	y, okB := b.(string)
+	return okA && okB && x == y
+}
+
+// compare orders two numbers or two strings
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	x, okA := a.(string)
+	y, okB := b.(string)
+	if !okA || !okB {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// normalizeValue turns results that can't be stored in JSON into null
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case nil, bool, string:
+	default:
+		// Formulas store scalars; copying arrays or objects is not a calculation
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,101 @@
+package calculation
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestExpression_Eval(t *testing.T) {
+	data := map[string]interface{}{
+		"weight":    json.Number("70"),
+		"height":    json.Number("175"),
+		"age":       float64(17),
+		"name":      "Ada",
+		"count_str": "3",
+		"consented": true,
+		"household": map[string]interface{}{"members": []interface{}{"a", "b"}, "size": json.Number("4")},
+	}
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"-2 * 3", -6.0},
+		{"7 % 4", 3.0},
+		{"round(weight / ((height / 100) * (height / 100)), 1)", 22.9},
+		{"count_str * 2", 6.0},
+		{"household.size + 1", 5.0},
+		{"count(household.members)", 2.0},
+		{"count(missing)", 0.0},
+		{"if(age >= 18, 'adult', 'child')", "child"},
+		{"age >= 18 || consented", true},
+		{"!consented", false},
+		{"name == 'Ada' && age < 18", true},
+		{"age != 17", false},
+		{`concat(name, " (", age, ")")`, "Ada (17)"},
+		{"min(weight, missing, 12)", 12.0},
+		{"max(weight, height)", 175.0},
+		{"coalesce(missing, weight)", 70.0},
+		{"abs(-3) + floor(2.7) + ceil(0.2)", 6.0},
+		{"number('2.5') * 2", 5.0},
+		{"1.5e2", 150.0},
+		// Missing fields, division by zero and mismatched types yield null
+		{"missing + 1", nil},
+		{"weight / 0", nil},
+		{"name * 2", nil},
+		{"name < 3", nil},
+		{"household", nil},
+		{"null", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if got := expr.Eval(data); got != tt.expected {
+				t.Errorf("Expected %v (%T), got %v (%T)", tt.expected, tt.expected, got, got)
+			}
+		})
+	}
+}
+
+func TestExpression_Fields(t *testing.T) {
+	expr, err := Parse("if(a > 0, b.c + a, round(d))")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fields := expr.Fields()
+	if len(fields) != 3 || fields[0] != "a" || fields[1] != "b.c" || fields[2] != "d" {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"1 +",
+		"(a + b",
+		"a b",
+		"unknown(a)",
+		"round()",
+		"if(a, b)",
+		"'unterminated",
+		"a..b",
+		"a.",
+		"1.2.3",
+		"a # b",
+		"a = b",
+	} {
+		t.Run(source, func(t *testing.T) {
+			if _, err := Parse(source); !errors.Is(err, ErrInvalidExpression) {
+				t.Errorf("Expected ErrInvalidExpression, got %v", err)
+			}
+		})
+	}
+}
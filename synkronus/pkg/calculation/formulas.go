@@ -0,0 +1,171 @@
+package calculation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// CalculatedKeyword is the schema.json property keyword declaring a calculated field
+const CalculatedKeyword = "x-calculated"
+
+// Formula is the x-calculated expression of one top-level data field
+type Formula struct {
+	Field      string
+	Expression *Expression
+}
+
+// Formulas are the calculated fields of a form, in evaluation order: a formula comes
+// after the calculated fields it reads
+type Formulas []Formula
+
+// ParseSchema reads the x-calculated formulas from a form's schema.json. It fails on
+// formulas that don't parse and on calculated fields that depend on each other in a cycle.
+func ParseSchema(data []byte) (Formulas, error) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	byField := make(map[string]*Expression)
+	for field, raw := range schema.Properties {
+		var property map[string]interface{}
+		if err := json.Unmarshal(raw, &property); err != nil {
+			continue
+		}
+		value, ok := property[CalculatedKeyword]
+		if !ok {
+			continue
+		}
+		source, ok := value.(string)
+		if !ok || strings.TrimSpace(source) == "" {
+			return nil, fmt.Errorf("%w: %s of %s must be a non-empty string", ErrInvalidExpression, CalculatedKeyword, field)
+		}
+		expr, err := Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		byField[field] = expr
+	}
+
+	return orderFormulas(byField)
+}
+
+// orderFormulas sorts the formulas so that each comes after the calculated fields it
+// reads. Independent formulas keep alphabetical order so the result is stable.
+func orderFormulas(byField map[string]*Expression) (Formulas, error) {
+	fields := make([]string, 0, len(byField))
+	for field := range byField {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(fields))
+	ordered := make(Formulas, 0, len(fields))
+
+	var visit func(field string, path []string) error
+	visit = func(field string, path []string) error {
+		switch state[field] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: calculated fields depend on each other: %s", ErrInvalidExpression, strings.Join(append(path, field), " -> "))
+		}
+		state[field] = visiting
+		for _, ref := range byField[field].Fields() {
+			dependency := strings.SplitN(ref, ".", 2)[0]
+			if _, ok := byField[dependency]; ok {
+				if err := visit(dependency, append(path, field)); err != nil {
+					return err
+				}
+			}
+		}
+		state[field] = done
+		ordered = append(ordered, Formula{Field: field, Expression: byField[field]})
+		return nil
+	}
+
+	for _, field := range fields {
+		if err := visit(field, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Fingerprint identifies the formulas of a form; it changes when any formula is
+// added, removed or edited. No formulas yield an empty fingerprint.
+func (f Formulas) Fingerprint() string {
+	if len(f) == 0 {
+		return ""
+	}
+	lines := make([]string, len(f))
+	for i, formula := range f {
+		lines[i] = formula.Field + "=" + formula.Expression.Source()
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Mismatch is a calculated field whose value in the submitted data differed from the
+// value computed by the server
+type Mismatch struct {
+	Field       string      `json:"field"`
+	ClientValue interface{} `json:"client_value"`
+	ServerValue interface{} `json:"server_value"`
+}
+
+// Apply computes the formulas over data and writes the values into it. Fields whose
+// formula yields null are removed. It returns the fields whose existing value differed,
+// and whether data was changed at all.
+func (f Formulas) Apply(data map[string]interface{}) ([]Mismatch, bool) {
+	var mismatches []Mismatch
+	changed := false
+	for _, formula := range f {
+		computed := formula.Expression.Eval(data)
+		existing, present := data[formula.Field]
+		if present && sameValue(existing, computed) {
+			continue
+		}
+		if !present && computed == nil {
+			continue
+		}
+
+		if present && existing != nil {
+			mismatches = append(mismatches, Mismatch{Field: formula.Field, ClientValue: existing, ServerValue: computed})
+		}
+		if computed == nil {
+			delete(data, formula.Field)
+		} else {
+			data[formula.Field] = computed
+		}
+		changed = true
+	}
+	return mismatches, changed
+}
+
+// sameValue reports whether a stored value matches a computed one. Numbers are
+// compared with a small relative tolerance, as clients compute in other floating
+// point environments and may store numbers as strings.
+func sameValue(existing, computed interface{}) bool {
+	if computed == nil || existing == nil {
+		return computed == nil && existing == nil
+	}
+	if c, ok := computed.(float64); ok {
+		e, ok := toNumber(existing)
+		return ok && math.Abs(e-c) <= 1e-9*math.Max(1, math.Max(math.Abs(e), math.Abs(c)))
+	}
+	return equal(existing, computed)
+}
@@ -0,0 +1,127 @@
+package calculation
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"weight": {"type": "number"},
+		"height": {"type": "number"},
+		"bmi_class": {"type": "string", "x-calculated": "if(bmi >= 25, 'overweight', 'normal')"},
+		"bmi": {"type": "number", "x-calculated": "round(weight / ((height / 100) * (height / 100)), 1)"},
+		"note": {"type": "string"}
+	}
+}`
+
+func TestParseSchema_OrdersDependencies(t *testing.T) {
+	formulas, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if len(formulas) != 2 || formulas[0].Field != "bmi" || formulas[1].Field != "bmi_class" {
+		t.Fatalf("Expected bmi before bmi_class, got %+v", formulas)
+	}
+}
+
+func TestParseSchema_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"cycle":      `{"properties": {"a": {"x-calculated": "b"}, "b": {"x-calculated": "c + 1"}, "c": {"x-calculated": "a"}}}`,
+		"self":       `{"properties": {"a": {"x-calculated": "a + 1"}}}`,
+		"not string": `{"properties": {"a": {"x-calculated": 5}}}`,
+		"empty":      `{"properties": {"a": {"x-calculated": " "}}}`,
+		"syntax":     `{"properties": {"a": {"x-calculated": "b +"}}}`,
+	}
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseSchema([]byte(schema)); !errors.Is(err, ErrInvalidExpression) {
+				t.Errorf("Expected ErrInvalidExpression, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormulas_Fingerprint(t *testing.T) {
+	a, _ := ParseSchema([]byte(testSchema))
+	b, _ := ParseSchema([]byte(`{"properties": {
+		"bmi": {"x-calculated": "round(weight / ((height / 100) * (height / 100)), 1)"},
+		"bmi_class": {"x-calculated": "if(bmi >= 25, 'overweight', 'normal')"}
+	}}`))
+	c, _ := ParseSchema([]byte(`{"properties": {"bmi": {"x-calculated": "weight / (height * height)"}}}`))
+
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("Expected the same formulas to share a fingerprint")
+	}
+	if a.Fingerprint() == c.Fingerprint() {
+		t.Errorf("Expected a changed formula to change the fingerprint")
+	}
+	if Formulas(nil).Fingerprint() != "" {
+		t.Errorf("Expected no formulas to have an empty fingerprint")
+	}
+}
+
+func TestFormulas_Apply(t *testing.T) {
+	formulas, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		data       map[string]interface{}
+		expected   map[string]interface{}
+		mismatches []string
+		changed    bool
+	}{
+		{
+			name:     "fills missing values",
+			data:     map[string]interface{}{"weight": json.Number("90"), "height": json.Number("180")},
+			expected: map[string]interface{}{"bmi": 27.8, "bmi_class": "overweight"},
+			changed:  true,
+		},
+		{
+			name:     "matching client values are kept",
+			data:     map[string]interface{}{"weight": json.Number("90"), "height": json.Number("180"), "bmi": json.Number("27.8"), "bmi_class": "overweight"},
+			expected: map[string]interface{}{"bmi": json.Number("27.8"), "bmi_class": "overweight"},
+		},
+		{
+			name:       "differing client values are replaced",
+			data:       map[string]interface{}{"weight": json.Number("60"), "height": json.Number("180"), "bmi": "27.8", "bmi_class": "overweight"},
+			expected:   map[string]interface{}{"bmi": 18.5, "bmi_class": "normal"},
+			mismatches: []string{"bmi", "bmi_class"},
+			changed:    true,
+		},
+		{
+			name:       "values without inputs are removed",
+			data:       map[string]interface{}{"bmi": json.Number("22")},
+			expected:   map[string]interface{}{"bmi_class": "normal"},
+			mismatches: []string{"bmi"},
+			changed:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, changed := formulas.Apply(tt.data)
+			if changed != tt.changed {
+				t.Errorf("Expected changed=%v, got %v", tt.changed, changed)
+			}
+			for _, field := range []string{"bmi", "bmi_class"} {
+				if tt.data[field] != tt.expected[field] {
+					t.Errorf("Expected %s=%v, got %v", field, tt.expected[field], tt.data[field])
+				}
+			}
+			if len(mismatches) != len(tt.mismatches) {
+				t.Fatalf("Expected mismatches %v, got %+v", tt.mismatches, mismatches)
+			}
+			for i, m := range mismatches {
+				if m.Field != tt.mismatches[i] {
+					t.Errorf("Expected mismatch on %s, got %+v", tt.mismatches[i], m)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package calculation
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Config contains calculation configuration
+type Config struct {
+	// BundlePath is the active app bundle directory; x-calculated formulas are read from
+	// its form schemas
+	BundlePath string
+	// BackfillInterval is how often the formulas are checked for changes; 0 disables the schedule
+	BackfillInterval time.Duration
+	// BackfillBatchSize is the number of observations recomputed per transaction
+	BackfillBatchSize int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		BackfillInterval:  5 * time.Minute,
+		BackfillBatchSize: 500,
+	}
+}
+
+// BackfillQuery selects the form types to backfill
+type BackfillQuery struct {
+	// FormType recomputes only this form type, even if its formulas are unchanged
+	FormType string
+}
+
+// FormBackfill is the outcome of backfilling one form type
+type FormBackfill struct {
+	FormType    string `json:"form_type"`
+	Fingerprint string `json:"fingerprint"`
+	Scanned     int    `json:"scanned"`
+	Updated     int    `json:"updated"`
+}
+
+// BackfillResult lists the form types whose observations were recomputed
+type BackfillResult struct {
+	Forms          []FormBackfill `json:"forms"`
+	CurrentVersion int64          `json:"current_version"`
+}
+
+// Service recomputes calculated fields declared with x-calculated in the active app
+// bundle's form schemas
+type Service interface {
+	// Recompute computes the calculated fields of an observation's data. It returns the
+	// data with the server's values and the fields whose submitted value differed.
+	// Data of forms without calculated fields is returned unchanged.
+	Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []Mismatch, error)
+
+	// Backfill recomputes the stored observations of form types whose formulas changed
+	// since their last backfill, giving changed observations new sync versions
+	Backfill(ctx context.Context, query BackfillQuery) (*BackfillResult, error)
+
+	// Start backfills on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+
+	schemas *formschema.Cache[Formulas]
+
+	backfillMu sync.Mutex
+}
+
+// NewService creates a new calculation service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+		schemas: formschema.NewCache(config.BundlePath, func(formType string, data []byte) (Formulas, error) {
+			formulas, err := ParseSchema(data)
+			if err != nil {
+				return nil, fmt.Errorf("schema of %s: %w", formType, err)
+			}
+			return formulas, nil
+		}),
+	}
+}
+
+// formulas returns the formulas of a form type in the active app bundle. Schemas are
+// re-read when the bundle changes them; a form without a schema has no formulas.
+func (s *service) formulas(formType string) (Formulas, error) {
+	return s.schemas.Get(formType)
+}
+
+// decodeData parses observation data, keeping numbers as written; data that isn't a
+// JSON object yields nil
+func decodeData(data json.RawMessage) map[string]interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+	return object
+}
+
+// Recompute computes the calculated fields of an observation's data
+func (s *service) Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []Mismatch, error) {
+	formulas, err := s.formulas(formType)
+	if err != nil || len(formulas) == 0 {
+		return data, nil, err
+	}
+
+	object := decodeData(data)
+	if object == nil {
+		return data, nil, nil
+	}
+	mismatches, changed := formulas.Apply(object)
+	if !changed {
+		return data, nil, nil
+	}
+
+	recomputed, err := json.Marshal(object)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode recomputed data: %w", err)
+	}
+	return recomputed, mismatches, nil
+}
+
+// Start backfills on the configured schedule until ctx is cancelled
+func (s *service) Start(ctx context.Context) {
+	if s.config.BackfillInterval <= 0 {
+		s.log.Info("Calculation backfill schedule disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.BackfillInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Backfill(ctx, BackfillQuery{}); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to backfill calculated fields", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Backfill recomputes the stored observations of form types whose formulas changed
+func (s *service) Backfill(ctx context.Context, query BackfillQuery) (_ *BackfillResult, err error) {
+	ctx, span := tracing.Start(ctx, "calculation.Backfill", attribute.String("calculation.form_type", query.FormType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	// The scheduled and on-demand backfills would otherwise recompute the same rows
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+
+	formTypes := []string{query.FormType}
+	if query.FormType == "" {
+		if formTypes, err = s.storedFormTypes(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	applied, err := s.appliedFingerprints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BackfillResult{Forms: []FormBackfill{}}
+	for _, formType := range formTypes {
+		formulas, err := s.formulas(formType)
+		if err != nil {
+			// A broken schema shouldn't keep the other forms from being backfilled
+			s.log.Error("Skipping calculated field backfill", "formType", formType, "error", err)
+			continue
+		}
+
+		fingerprint := formulas.Fingerprint()
+		if query.FormType == "" && applied[formType] == fingerprint {
+			continue
+		}
+
+		form := FormBackfill{FormType: formType, Fingerprint: fingerprint}
+		if len(formulas) > 0 {
+			if err := s.backfillForm(ctx, formType, formulas, &form); err != nil {
+				return nil, fmt.Errorf("failed to backfill %s: %w", formType, err)
+			}
+		}
+		if err := s.saveFingerprint(ctx, formType, fingerprint); err != nil {
+			return nil, err
+		}
+		result.Forms = append(result.Forms, form)
+
+		s.log.Info("Backfilled calculated fields",
+			"formType", formType,
+			"formulaCount", len(formulas),
+			"scanned", form.Scanned,
+			"updated", form.Updated)
+	}
+
+	if err := s.db.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&result.CurrentVersion); err != nil {
+		return nil, fmt.Errorf("failed to get current version: %w", err)
+	}
+	span.SetAttributes(attribute.Int("calculation.form_count", len(result.Forms)))
+	return result, nil
+}
+
+// storedFormTypes returns the form types that have live observations
+func (s *service) storedFormTypes(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT form_type FROM observations WHERE NOT deleted AND form_type <> '' ORDER BY form_type")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query form types: %w", err)
+	}
+	defer rows.Close()
+
+	var formTypes []string
+	for rows.Next() {
+		var formType string
+		if err := rows.Scan(&formType); err != nil {
+			return nil, fmt.Errorf("failed to scan form type: %w", err)
+		}
+		formTypes = append(formTypes, formType)
+	}
+	return formTypes, rows.Err()
+}
+
+// appliedFingerprints returns the fingerprint of the formulas last backfilled per form type
+func (s *service) appliedFingerprints(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT form_type, fingerprint FROM calculation_fingerprints")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calculation fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]string)
+	for rows.Next() {
+		var formType, fingerprint string
+		if err := rows.Scan(&formType, &fingerprint); err != nil {
+			return nil, fmt.Errorf("failed to scan calculation fingerprint: %w", err)
+		}
+		applied[formType] = fingerprint
+	}
+	return applied, rows.Err()
+}
+
+// saveFingerprint records the formulas a form type was backfilled with
+func (s *service) saveFingerprint(ctx context.Context, formType, fingerprint string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO calculation_fingerprints (form_type, fingerprint, applied_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (form_type) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, applied_at = NOW()`,
+		formType, fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to save calculation fingerprint: %w", err)
+	}
+	return nil
+}
+
+// storedObservation is an observation read for recomputation
+type storedObservation struct {
+	id      string
+	version int64
+	data    map[string]interface{}
+}
+
+// backfillForm recomputes the live observations of a form type in batches. Each batch
+// with changes is written in its own transaction with freshly reserved versions, so
+// clients pull the new values.
+func (s *service) backfillForm(ctx context.Context, formType string, formulas Formulas, form *FormBackfill) error {
+	batchSize := s.config.BackfillBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultConfig().BackfillBatchSize
+	}
+
+	after := ""
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT observation_id, version, data
+			FROM observations
+			WHERE form_type = $1 AND NOT deleted AND observation_id > $2
+			ORDER BY observation_id
+			LIMIT $3`,
+			formType, after, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query observations: %w", err)
+		}
+
+		var changed []storedObservation
+		count := 0
+		for rows.Next() {
+			var obs storedObservation
+			var data []byte
+			if err := rows.Scan(&obs.id, &obs.version, &data); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan observation: %w", err)
+			}
+			count++
+			after = obs.id
+
+			if obs.data = decodeData(data); obs.data == nil {
+				continue
+			}
+			if _, ok := formulas.Apply(obs.data); ok {
+				changed = append(changed, obs)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating observations: %w", err)
+		}
+
+		form.Scanned += count
+		if len(changed) > 0 {
+			updated, err := s.writeRecomputed(ctx, changed)
+			if err != nil {
+				return err
+			}
+			form.Updated += updated
+		}
+
+		if count < batchSize {
+			return nil
+		}
+	}
+}
+
+// writeRecomputed stores recomputed observations with new versions. Observations
+// changed since they were read are skipped; the push that changed them recomputed them.
+func (s *service) writeRecomputed(ctx context.Context, changed []storedObservation) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE sync_version SET current_version = current_version + $1, updated_at = NOW() WHERE id = 1 RETURNING current_version",
+		len(changed)).Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve versions: %w", err)
+	}
+	version := current - int64(len(changed)) + 1
+
+	updated := 0
+	for _, obs := range changed {
+		data, err := json.Marshal(obs.data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode observation %s: %w", obs.id, err)
+		}
+		res, err := tx.ExecContext(ctx,
+			"UPDATE observations SET data = $1, updated_at = NOW(), version = $2 WHERE observation_id = $3 AND version = $4",
+			data, version, obs.id, obs.version)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update observation %s: %w", obs.id, err)
+		}
+		version++
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
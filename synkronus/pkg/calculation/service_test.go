@@ -0,0 +1,176 @@
+package calculation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestService_Recompute(t *testing.T) {
+	config := DefaultConfig()
+	config.BundlePath = t.TempDir()
+	forms := filepath.Join(config.BundlePath, "forms")
+	formschema.WriteSchema(t, forms, "anc_visit", testSchema)
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, config, logger.NewLogger()).(*service)
+	ctx := context.Background()
+
+	data, mismatches, err := s.Recompute(ctx, "anc_visit", json.RawMessage(`{"weight":60,"height":180,"bmi":30,"note":"ok"}`))
+	if err != nil {
+		t.Fatalf("Failed to recompute: %v", err)
+	}
+	if string(data) != `{"bmi":18.5,"bmi_class":"normal","height":180,"note":"ok","weight":60}` {
+		t.Errorf("Unexpected data: %s", data)
+	}
+	if len(mismatches) != 1 || mismatches[0].Field != "bmi" || mismatches[0].ServerValue != 18.5 {
+		t.Errorf("Unexpected mismatches: %+v", mismatches)
+	}
+
+	// Unchanged data is returned as pushed, byte for byte
+	pushed := json.RawMessage(`{"weight": 60, "height": 180, "bmi": 18.5, "bmi_class": "normal"}`)
+	if data, _, _ := s.Recompute(ctx, "anc_visit", pushed); string(data) != string(pushed) {
+		t.Errorf("Expected unchanged data, got %s", data)
+	}
+
+	// Forms without a schema or formulas, and non-object data, are left alone
+	for _, formType := range []string{"unknown", "../anc_visit", ""} {
+		if data, _, err := s.Recompute(ctx, formType, json.RawMessage(`{"bmi":1}`)); err != nil || string(data) != `{"bmi":1}` {
+			t.Errorf("Expected %q to be left alone, got %s, %v", formType, data, err)
+		}
+	}
+	if data, _, err := s.Recompute(ctx, "anc_visit", json.RawMessage(`[1]`)); err != nil || string(data) != `[1]` {
+		t.Errorf("Expected non-object data to be left alone, got %s, %v", data, err)
+	}
+
+	// A new bundle version with a different formula is picked up
+	formschema.WriteSchema(t, forms, "anc_visit", `{"properties": {"bmi": {"x-calculated": "weight / height"}}}`)
+	if data, _, _ := s.Recompute(ctx, "anc_visit", json.RawMessage(`{"weight":60,"height":30}`)); string(data) != `{"bmi":2,"height":30,"weight":60}` {
+		t.Errorf("Expected the new formula to apply, got %s", data)
+	}
+
+	// A broken schema is an error rather than silently unchanged data
+	formschema.WriteSchema(t, forms, "anc_visit", `{"properties": {"bmi": {"x-calculated": "weight /"}}}`)
+	if _, _, err := s.Recompute(ctx, "anc_visit", json.RawMessage(`{}`)); err == nil {
+		t.Errorf("Expected an error for a broken formula")
+	}
+}
+
+func TestService_Backfill(t *testing.T) {
+	config := DefaultConfig()
+	config.BundlePath = t.TempDir()
+	forms := filepath.Join(config.BundlePath, "forms")
+	config.BackfillBatchSize = 2
+	formschema.WriteSchema(t, forms, "anc_visit", testSchema)
+	formschema.WriteSchema(t, forms, "household", `{"properties": {"size": {"type": "number"}}}`)
+	formschema.WriteSchema(t, forms, "triage", `{"properties": {"score": {"x-calculated": "a + b"}}}`)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, config, logger.NewLogger()).(*service)
+
+	formulas, _ := s.formulas("anc_visit")
+	triage, _ := s.formulas("triage")
+
+	mock.ExpectQuery(`SELECT DISTINCT form_type FROM observations`).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}).AddRow("anc_visit").AddRow("household").AddRow("triage"))
+	mock.ExpectQuery(`SELECT form_type, fingerprint FROM calculation_fingerprints`).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type", "fingerprint"}).
+			AddRow("anc_visit", "outdated").
+			AddRow("triage", triage.Fingerprint()))
+
+	// anc_visit changed: two full batches and a short one; only obs-1 and obs-3 differ
+	mock.ExpectQuery(`SELECT observation_id, version, data\s+FROM observations`).
+		WithArgs("anc_visit", "", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "version", "data"}).
+			AddRow("obs-1", int64(5), []byte(`{"weight":90,"height":180}`)).
+			AddRow("obs-2", int64(6), []byte(`{"weight":60,"height":180,"bmi":18.5,"bmi_class":"normal"}`)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(11)))
+	mock.ExpectExec(`UPDATE observations SET data = \$1, updated_at = NOW\(\), version = \$2 WHERE observation_id = \$3 AND version = \$4`).
+		WithArgs([]byte(`{"bmi":27.8,"bmi_class":"overweight","height":180,"weight":90}`), int64(11), "obs-1", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT observation_id, version, data\s+FROM observations`).
+		WithArgs("anc_visit", "obs-2", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "version", "data"}).
+			AddRow("obs-3", int64(7), []byte(`{"weight":60,"height":180,"bmi":99}`)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(12)))
+	// Changed by a push since it was read
+	mock.ExpectExec(`UPDATE observations SET data`).
+		WithArgs(sqlmock.AnyArg(), int64(12), "obs-3", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO calculation_fingerprints`).
+		WithArgs("anc_visit", formulas.Fingerprint()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// household has no formulas and never had any; triage is unchanged
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(12)))
+
+	result, err := s.Backfill(context.Background(), BackfillQuery{})
+	if err != nil {
+		t.Fatalf("Failed to backfill: %v", err)
+	}
+	if len(result.Forms) != 1 || result.CurrentVersion != 12 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if form := result.Forms[0]; form.FormType != "anc_visit" || form.Scanned != 3 || form.Updated != 1 {
+		t.Errorf("Unexpected form backfill: %+v", form)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_BackfillFormType(t *testing.T) {
+	config := DefaultConfig()
+	config.BundlePath = t.TempDir()
+	forms := filepath.Join(config.BundlePath, "forms")
+	formschema.WriteSchema(t, forms, "triage", `{"properties": {"score": {"x-calculated": "a + b"}}}`)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	s := NewService(db, config, logger.NewLogger()).(*service)
+	triage, _ := s.formulas("triage")
+
+	// A requested form type is recomputed even though its fingerprint is current
+	mock.ExpectQuery(`SELECT form_type, fingerprint FROM calculation_fingerprints`).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type", "fingerprint"}).AddRow("triage", triage.Fingerprint()))
+	mock.ExpectQuery(`SELECT observation_id, version, data\s+FROM observations`).
+		WithArgs("triage", "", 500).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "version", "data"}).
+			AddRow("obs-1", int64(3), []byte(`{"a":1,"b":2,"score":3}`)))
+	mock.ExpectExec(`INSERT INTO calculation_fingerprints`).
+		WithArgs("triage", triage.Fingerprint()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(3)))
+
+	result, err := s.Backfill(context.Background(), BackfillQuery{FormType: "triage"})
+	if err != nil {
+		t.Fatalf("Failed to backfill: %v", err)
+	}
+	if len(result.Forms) != 1 || result.Forms[0].Scanned != 1 || result.Forms[0].Updated != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package cdn integrates with a content delivery network in front of the server: it
+// builds the public URLs clients download through and purges cached URLs that changed.
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultTimeout bounds a purge when the context has no deadline
+const defaultTimeout = 10 * time.Second
+
+// Config contains CDN configuration
+type Config struct {
+	// PublicURL is the base URL clients reach the server through, e.g.
+	// https://cdn.example.org. Empty leaves URLs relative to the server.
+	PublicURL string
+	// PurgeURL receives purge requests; purging is disabled when empty. The request is
+	// a POST of {"files": [<absolute URL>, ...]}, the format of Cloudflare's purge API.
+	PurgeURL string
+	// PurgeToken is sent as a bearer token with purge requests when set
+	PurgeToken string
+	// BatchSize is the maximum number of URLs per purge request
+	BatchSize int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		BatchSize: 30, // Cloudflare's limit per request
+	}
+}
+
+// Enabled reports whether purging is configured
+func (c Config) Enabled() bool {
+	return c.PurgeURL != "" && c.PublicURL != ""
+}
+
+// CDN builds public URLs and purges them from the CDN cache
+type CDN interface {
+	// URL returns the public URL of a server path such as /app-bundle/manifest
+	URL(path string) string
+	// Purge evicts the public URLs of server paths from the CDN cache
+	Purge(ctx context.Context, paths []string) error
+}
+
+type client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// New creates a CDN client. Purge does nothing unless config is Enabled.
+func New(config Config) CDN {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultConfig().BatchSize
+	}
+	config.PublicURL = strings.TrimRight(config.PublicURL, "/")
+	return &client{config: config, httpClient: &http.Client{}}
+}
+
+// URL returns the public URL of path
+func (c *client) URL(path string) string {
+	return c.config.PublicURL + path
+}
+
+// Purge sends the public URLs of paths to the purge endpoint in batches
+func (c *client) Purge(ctx context.Context, paths []string) (err error) {
+	if !c.config.Enabled() || len(paths) == 0 {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "cdn.Purge", attribute.Int("cdn.path_count", len(paths)))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = c.URL(path)
+	}
+	for start := 0; start < len(urls); start += c.config.BatchSize {
+		end := start + c.config.BatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		if err := c.purgeBatch(ctx, urls[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeBatch sends one purge request
+func (c *client) purgeBatch(ctx context.Context, urls []string) error {
+	body, err := json.Marshal(map[string][]string{"files": urls})
+	if err != nil {
+		return fmt.Errorf("failed to encode purge request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.PurgeURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create purge request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.PurgeToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.PurgeToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("purge request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("purge request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPurgeBatches(t *testing.T) {
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected request: %s %q", r.Method, r.Header.Get("Authorization"))
+		}
+		var body struct {
+			Files []string `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode purge request: %v", err)
+		}
+		batches = append(batches, body.Files)
+	}))
+	defer server.Close()
+
+	c := New(Config{PublicURL: "https://cdn.example.org/", PurgeURL: server.URL, PurgeToken: "secret", BatchSize: 2})
+	if got := c.URL("/app-bundle/manifest"); got != "https://cdn.example.org/app-bundle/manifest" {
+		t.Errorf("Unexpected URL %q", got)
+	}
+
+	err := c.Purge(context.Background(), []string{"/app-bundle/manifest", "/app-bundle/versions", "/app-bundle/download-zip"})
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("Expected batches of 2 and 1, got %v", batches)
+	}
+	if batches[1][0] != "https://cdn.example.org/app-bundle/download-zip" {
+		t.Errorf("Unexpected purged URL %q", batches[1][0])
+	}
+}
+
+func TestPurgeErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"success":false}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c := New(Config{PublicURL: "https://cdn.example.org", PurgeURL: server.URL})
+	if err := c.Purge(context.Background(), []string{"/app-bundle/manifest"}); err == nil {
+		t.Error("Expected an error for a rejected purge")
+	}
+}
+
+func TestPurgeDisabled(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer server.Close()
+
+	// Without a public URL there are no absolute URLs to purge
+	c := New(Config{PurgeURL: server.URL})
+	if err := c.Purge(context.Background(), []string{"/app-bundle/manifest"}); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no purge request, got %d", calls)
+	}
+}
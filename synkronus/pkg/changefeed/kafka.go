@@ -0,0 +1,103 @@
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// kafkaRESTPublisher produces to Kafka through the v2 API of the Confluent REST Proxy,
+// which Redpanda's HTTP proxy also implements
+type kafkaRESTPublisher struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+func newKafkaRESTPublisher(u *url.URL, topic string) *kafkaRESTPublisher {
+	p := &kafkaRESTPublisher{client: &http.Client{}}
+	if u.User != nil {
+		p.username = u.User.Username()
+		p.password, _ = u.User.Password()
+	}
+	base := *u
+	base.User = nil
+	p.endpoint = strings.TrimRight(base.String(), "/") + "/topics/" + url.PathEscape(topic)
+	return p
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		Offset    int64   `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Publish produces all messages in one request; the proxy answers once Kafka acknowledged them
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, messages []Message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, msg := range messages {
+		records[i] = kafkaRecord{Key: msg.Key, Value: msg.Value}
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": records})
+	if err != nil {
+		return fmt.Errorf("failed to encode Kafka records: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the Kafka REST Proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka REST Proxy returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var result kafkaProduceResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid Kafka REST Proxy response: %w", err)
+	}
+	if len(result.Offsets) != len(messages) {
+		return fmt.Errorf("kafka REST Proxy acknowledged %d of %d records", len(result.Offsets), len(messages))
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil || offset.Error != nil {
+			reason := ""
+			if offset.Error != nil {
+				reason = *offset.Error
+			}
+			return fmt.Errorf("kafka rejected a record: %s", reason)
+		}
+	}
+	return nil
+}
+
+func (p *kafkaRESTPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
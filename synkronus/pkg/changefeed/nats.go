@@ -0,0 +1,277 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsPublisher publishes to NATS JetStream over the NATS client protocol. Every message
+// is sent with a reply subject, and JetStream answers once the stream stored it. The
+// Nats-Msg-Id header lets the stream drop redeliveries within its duplicate window.
+type natsPublisher struct {
+	url     *url.URL
+	subject string
+
+	mu    sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string
+}
+
+func newNATSPublisher(u *url.URL, subject string) *natsPublisher {
+	return &natsPublisher{url: u, subject: subject}
+}
+
+// natsInfo is the part of the server's INFO the publisher needs
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+}
+
+// natsAck is JetStream's answer to a publish
+type natsAck struct {
+	Stream string `json:"stream"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// Publish sends all messages, then waits for each acknowledgement. A failure closes the
+// connection; the next call reconnects.
+func (p *natsPublisher) Publish(ctx context.Context, messages []Message) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if err != nil {
+			p.closeConn()
+		}
+	}()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	if err := p.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool, len(messages))
+	w := bufio.NewWriter(p.conn)
+	for i, msg := range messages {
+		reply := p.inbox + "." + strconv.Itoa(i)
+		pending[reply] = true
+		header := "NATS/1.0\r\nNats-Msg-Id: " + msg.ID + "\r\n\r\n"
+		fmt.Fprintf(w, "HPUB %s %s %d %d\r\n%s", p.subject, reply, len(header), len(header)+len(msg.Value), header)
+		w.Write(msg.Value)
+		w.WriteString("\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+
+	for len(pending) > 0 {
+		subject, headers, payload, err := p.readMessage()
+		if err != nil {
+			return fmt.Errorf("failed to read NATS acknowledgement: %w", err)
+		}
+		if !pending[subject] {
+			continue
+		}
+		delete(pending, subject)
+
+		if strings.HasPrefix(headers, "NATS/1.0 503") {
+			return fmt.Errorf("no JetStream stream stores subject %s", p.subject)
+		}
+		var ack natsAck
+		if err := json.Unmarshal(payload, &ack); err != nil {
+			return fmt.Errorf("invalid JetStream acknowledgement: %w", err)
+		}
+		if ack.Error != nil {
+			return fmt.Errorf("JetStream rejected a message: %s (%d)", ack.Error.Description, ack.Error.Code)
+		}
+	}
+	return nil
+}
+
+// connect opens the connection, authenticates and subscribes to the reply inbox
+func (p *natsPublisher) connect(ctx context.Context) error {
+	host := p.url.Host
+	if p.url.Port() == "" {
+		host = net.JoinHostPort(p.url.Hostname(), "4222")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	p.conn, p.r = conn, bufio.NewReader(conn)
+
+	if err := p.handshake(ctx); err != nil {
+		p.closeConn()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) handshake(ctx context.Context) error {
+	line, err := p.readLine()
+	if err != nil {
+		return fmt.Errorf("failed to read NATS server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("invalid NATS server info: %w", err)
+	}
+	if !info.Headers {
+		return errors.New("the NATS server doesn't support headers; NATS 2.2 or later is required")
+	}
+
+	useTLS := p.url.Scheme == "tls" || info.TLSRequired
+	if useTLS {
+		tlsConn := tls.Client(p.conn, &tls.Config{ServerName: p.url.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("NATS TLS handshake failed: %w", err)
+		}
+		p.conn, p.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"tls_required":  useTLS,
+		"name":          "synkronus",
+		"lang":          "go",
+		"version":       "1.0.0",
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if user := p.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	p.inbox = "_INBOX.synkronus." + hex.EncodeToString(suffix)
+
+	// The PONG confirms the server accepted the credentials
+	if _, err := fmt.Fprintf(p.conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", connect, p.inbox); err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS refused the connection: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case line == "PING":
+			if _, err := io.WriteString(p.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readMessage reads until the next MSG or HMSG, answering pings on the way
+func (p *natsPublisher) readMessage() (subject, headers string, payload []byte, err error) {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return "", "", nil, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			if _, err := io.WriteString(p.conn, "PONG\r\n"); err != nil {
+				return "", "", nil, err
+			}
+		case "-ERR":
+			return "", "", nil, fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case "MSG", "HMSG":
+			// MSG <subject> <sid> [reply] <size>; HMSG <subject> <sid> [reply] <header size> <size>
+			headerSize, size := 0, 0
+			if fields[0] == "HMSG" && len(fields) >= 5 {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			if len(fields) >= 4 {
+				size, err = strconv.Atoi(fields[len(fields)-1])
+			}
+			if len(fields) < 4 || err != nil || headerSize > size {
+				return "", "", nil, fmt.Errorf("malformed NATS message %q", line)
+			}
+			body := make([]byte, size+2)
+			if _, err := io.ReadFull(p.r, body); err != nil {
+				return "", "", nil, err
+			}
+			return fields[1], string(body[:headerSize]), body[headerSize:size], nil
+		}
+	}
+}
+
+func (p *natsPublisher) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (p *natsPublisher) closeConn() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.r = nil, nil
+	}
+}
+
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeConn()
+	return nil
+}
@@ -0,0 +1,64 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Brokers the change feed can publish to
+const (
+	BrokerNATS      = "nats"
+	BrokerKafkaREST = "kafka-rest"
+)
+
+// ErrInvalidBroker is returned for an unknown broker or an unusable broker URL
+var ErrInvalidBroker = errors.New("invalid change feed broker")
+
+// Message is one change as sent to the broker
+type Message struct {
+	// ID identifies the change so brokers that deduplicate can drop redeliveries
+	ID string
+	// Key is the observation ID; brokers that partition keep the changes of one
+	// observation in order
+	Key string
+	// Value is the JSON-encoded Event
+	Value []byte
+}
+
+// Publisher delivers messages to a broker. Publish returns only once the broker
+// acknowledged every message, so an error means some may need to be sent again.
+type Publisher interface {
+	Publish(ctx context.Context, messages []Message) error
+	Close() error
+}
+
+// NewPublisher creates the publisher of a broker. The URL is nats://[user:pass@]host:port
+// (or tls://) for NATS JetStream, and the base URL of a Confluent REST Proxy or compatible
+// HTTP proxy for Kafka.
+func NewPublisher(broker, rawURL, topic string) (Publisher, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("%w: a topic is required", ErrInvalidBroker)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid URL %q", ErrInvalidBroker, rawURL)
+	}
+
+	switch strings.ToLower(broker) {
+	case BrokerNATS:
+		if u.Scheme != "nats" && u.Scheme != "tls" {
+			return nil, fmt.Errorf("%w: NATS URLs start with nats:// or tls://", ErrInvalidBroker)
+		}
+		return newNATSPublisher(u, topic), nil
+	case BrokerKafkaREST:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("%w: Kafka REST Proxy URLs start with http:// or https://", ErrInvalidBroker)
+		}
+		return newKafkaRESTPublisher(u, topic), nil
+	default:
+		return nil, fmt.Errorf("%w %q: expected %s or %s", ErrInvalidBroker, broker, BrokerNATS, BrokerKafkaREST)
+	}
+}
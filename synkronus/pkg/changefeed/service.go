@@ -0,0 +1,432 @@
+// Package changefeed publishes observation changes to a message broker
+package changefeed
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrDisabled is returned when the change feed is used without a configured broker
+var ErrDisabled = errors.New("the change feed is not enabled")
+
+// ErrReplayUnavailable is returned when a replay starts at a change already pruned
+var ErrReplayUnavailable = errors.New("pruned changes can't be replayed")
+
+// publishLockKey is the advisory lock held while publishing, so only one server instance
+// publishes at a time and changes leave in sequence
+const publishLockKey = 0x63686766 // "chgf"
+
+// Config contains change feed configuration
+type Config struct {
+	// Broker is nats or kafka-rest; empty disables the change feed
+	Broker string
+	Topic  string
+	// PollInterval is how often the outbox is checked for new changes
+	PollInterval time.Duration
+	// BatchSize caps the changes sent to the broker at once
+	BatchSize int
+	// PublishTimeout bounds one batch, including the broker's acknowledgements
+	PublishTimeout time.Duration
+	// Retention is how long published changes are kept for replays
+	Retention time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Topic:          "synkronus.observations",
+		PollInterval:   5 * time.Second,
+		BatchSize:      100,
+		PublishTimeout: 30 * time.Second,
+		Retention:      7 * 24 * time.Hour,
+	}
+}
+
+// Event is the message published for one observation change. Seq increases with every
+// change; consumers keep the last seq they processed as their cursor, and may see a
+// change more than once.
+type Event struct {
+	Seq           int64           `json:"seq"`
+	Operation     string          `json:"operation"` // create, update or delete
+	ObservationID string          `json:"observation_id"`
+	FormType      string          `json:"form_type"`
+	FormVersion   string          `json:"form_version"`
+	Version       int64           `json:"version"`
+	Deleted       bool            `json:"deleted"`
+	Data          json.RawMessage `json:"data"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
+
+// Status describes the change feed
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	Broker  string `json:"broker,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	// Pending counts recorded changes the broker hasn't acknowledged yet
+	Pending          int64      `json:"pending"`
+	LastPublishedSeq *int64     `json:"last_published_seq,omitempty"`
+	LastPublishedAt  *time.Time `json:"last_published_at,omitempty"`
+	// OldestReplayableSeq is the first change a replay can start at; older ones were
+	// pruned after their retention
+	OldestReplayableSeq int64 `json:"oldest_replayable_seq"`
+	// LastError is the last publish failure of this server instance, cleared by the next success
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Service publishes the changes recorded in the observation_changes outbox. A change is
+// marked published only after the broker acknowledged it, so delivery is at least once.
+type Service interface {
+	// Initialize turns recording of changes on when a broker is configured, and off otherwise
+	Initialize(ctx context.Context) error
+
+	// Start publishes on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+
+	// PublishPending publishes one batch of unpublished changes and returns its size
+	PublishPending(ctx context.Context) (int, error)
+
+	// Status reports the backlog and the last published change
+	Status(ctx context.Context) (*Status, error)
+
+	// Replay marks the retained changes from fromSeq on as unpublished, so they are
+	// published again, and returns how many were marked
+	Replay(ctx context.Context, fromSeq int64) (int64, error)
+
+	// FirstSeqAfterVersion returns the seq of the first recorded change with a sync version
+	// above version, or 0 when there is none. It returns ErrReplayUnavailable when changes
+	// after version may already have been pruned.
+	FirstSeqAfterVersion(ctx context.Context, version int64) (int64, error)
+}
+
+type service struct {
+	db        *sql.DB
+	config    Config
+	publisher Publisher
+	log       *logger.Logger
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// NewService creates a new change feed service; publisher is nil when the change feed is disabled
+func NewService(db *sql.DB, config Config, publisher Publisher, log *logger.Logger) Service {
+	defaults := DefaultConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = defaults.PublishTimeout
+	}
+	return &service{
+		db:        db,
+		config:    config,
+		publisher: publisher,
+		log:       log,
+	}
+}
+
+func (s *service) enabled() bool {
+	return s.publisher != nil
+}
+
+// Initialize turns recording of changes on or off to match the configuration
+func (s *service) Initialize(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE change_feed_state SET enabled = $1 WHERE id = 1", s.enabled()); err != nil {
+		return fmt.Errorf("failed to update change feed state: %w", err)
+	}
+	return nil
+}
+
+// Start publishes on the configured schedule until ctx is cancelled
+func (s *service) Start(ctx context.Context) {
+	if !s.enabled() {
+		s.log.Info("Change feed disabled")
+		return
+	}
+	if s.config.PollInterval <= 0 {
+		s.log.Info("Change feed schedule disabled")
+		return
+	}
+
+	go func() {
+		defer s.publisher.Close()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.publishBacklog(ctx)
+			if err := s.prune(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to prune published observation changes", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// publishBacklog publishes batches until the outbox is drained or publishing fails
+func (s *service) publishBacklog(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := s.PublishPending(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Error("Failed to publish observation changes", "error", err)
+			}
+			return
+		}
+		if n < s.config.BatchSize {
+			return
+		}
+	}
+}
+
+// PublishPending publishes the oldest unpublished changes. The rows stay locked until the
+// broker acknowledged them; if publishing fails nothing is marked and the batch is sent
+// again on the next run.
+func (s *service) PublishPending(ctx context.Context) (published int, err error) {
+	if !s.enabled() {
+		return 0, ErrDisabled
+	}
+	ctx, span := tracing.Start(ctx, "changefeed.PublishPending")
+	defer span.End()
+	defer func() {
+		tracing.RecordError(span, err)
+		span.SetAttributes(attribute.Int("changefeed.published", published))
+	}()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", publishLockKey).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to lock the change feed: %w", err)
+	}
+	if !locked {
+		// Another instance is publishing
+		return 0, nil
+	}
+
+	events, err := s.unpublished(ctx, tx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	messages := make([]Message, len(events))
+	seqs := make([]int64, len(events))
+	for i, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode change %d: %w", event.Seq, err)
+		}
+		id := strconv.FormatInt(event.Seq, 10)
+		messages[i] = Message{ID: id, Key: event.ObservationID, Value: value}
+		seqs[i] = event.Seq
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, s.config.PublishTimeout)
+	defer cancel()
+	if err := s.publisher.Publish(publishCtx, messages); err != nil {
+		s.setLastError(err.Error())
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE observation_changes SET published_at = NOW() WHERE seq = ANY($1)", pq.Array(seqs)); err != nil {
+		return 0, fmt.Errorf("failed to mark changes published: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit published changes: %w", err)
+	}
+
+	s.setLastError("")
+	return len(events), nil
+}
+
+// unpublished reads the oldest unpublished changes
+func (s *service) unpublished(ctx context.Context, tx *sql.Tx) ([]Event, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT seq, operation, observation_id, form_type, form_version, version, deleted, data, changed_at
+		FROM observation_changes
+		WHERE published_at IS NULL
+		ORDER BY seq
+		LIMIT $1
+	`, s.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unpublished changes: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var data []byte
+		if err := rows.Scan(&e.Seq, &e.Operation, &e.ObservationID, &e.FormType, &e.FormVersion,
+			&e.Version, &e.Deleted, &data, &e.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan change: %w", err)
+		}
+		e.Data = data
+		e.ChangedAt = e.ChangedAt.UTC()
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read unpublished changes: %w", err)
+	}
+	return events, nil
+}
+
+// prune deletes published changes older than the retention and remembers the last one
+// deleted, so replays from before it are refused rather than silently incomplete
+func (s *service) prune(ctx context.Context) error {
+	if s.config.Retention <= 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `
+		WITH pruned AS (
+			DELETE FROM observation_changes WHERE published_at < $1 RETURNING seq
+		)
+		UPDATE change_feed_state
+		SET pruned_through = GREATEST(pruned_through, (SELECT COALESCE(MAX(seq), 0) FROM pruned))
+		WHERE id = 1
+	`, time.Now().Add(-s.config.Retention))
+	return err
+}
+
+func (s *service) setLastError(message string) {
+	s.mu.Lock()
+	s.lastError = message
+	s.mu.Unlock()
+}
+
+// Status reports the backlog and the last published change
+func (s *service) Status(ctx context.Context) (_ *Status, err error) {
+	ctx, span := tracing.Start(ctx, "changefeed.Status")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	status := &Status{Enabled: s.enabled()}
+	if status.Enabled {
+		status.Broker = s.config.Broker
+		status.Topic = s.config.Topic
+	}
+	s.mu.Lock()
+	status.LastError = s.lastError
+	s.mu.Unlock()
+
+	var lastSeq sql.NullInt64
+	var lastAt sql.NullTime
+	var prunedThrough int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE published_at IS NULL),
+			MAX(seq) FILTER (WHERE published_at IS NOT NULL),
+			MAX(published_at),
+			(SELECT pruned_through FROM change_feed_state WHERE id = 1)
+		FROM observation_changes
+	`).Scan(&status.Pending, &lastSeq, &lastAt, &prunedThrough)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change feed status: %w", err)
+	}
+	if lastSeq.Valid {
+		status.LastPublishedSeq = &lastSeq.Int64
+	}
+	if lastAt.Valid {
+		status.LastPublishedAt = &lastAt.Time
+	}
+	status.OldestReplayableSeq = prunedThrough + 1
+	return status, nil
+}
+
+// Replay marks the retained changes from fromSeq on as unpublished
+func (s *service) Replay(ctx context.Context, fromSeq int64) (_ int64, err error) {
+	if !s.enabled() {
+		return 0, ErrDisabled
+	}
+	ctx, span := tracing.Start(ctx, "changefeed.Replay", attribute.Int64("changefeed.from_seq", fromSeq))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Wait for a running publish so it doesn't mark the replayed rows published again
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", publishLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock the change feed: %w", err)
+	}
+
+	var prunedThrough int64
+	if err := tx.QueryRowContext(ctx,
+		"SELECT pruned_through FROM change_feed_state WHERE id = 1").Scan(&prunedThrough); err != nil {
+		return 0, fmt.Errorf("failed to read change feed state: %w", err)
+	}
+	if fromSeq <= prunedThrough {
+		return 0, fmt.Errorf("%w (oldest replayable change is %d)", ErrReplayUnavailable, prunedThrough+1)
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE observation_changes SET published_at = NULL WHERE seq >= $1 AND published_at IS NOT NULL", fromSeq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark changes for replay: %w", err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count replayed changes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit replay: %w", err)
+	}
+
+	s.log.Info("Change feed replay requested", "fromSeq", fromSeq, "changes", marked)
+	return marked, nil
+}
+
+// FirstSeqAfterVersion finds where a replay for a consumer that ingested up to version starts
+func (s *service) FirstSeqAfterVersion(ctx context.Context, version int64) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "changefeed.FirstSeqAfterVersion", attribute.Int64("changefeed.version", version))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	// Versions also count attachment writes, so they have gaps; a retained change at or before
+	// version is the only proof that nothing after it was pruned
+	var seq sql.NullInt64
+	var retainedBefore bool
+	var prunedThrough int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT (SELECT MIN(seq) FROM observation_changes WHERE version > $1),
+		       EXISTS (SELECT 1 FROM observation_changes WHERE version <= $1),
+		       pruned_through
+		FROM change_feed_state WHERE id = 1
+	`, version).Scan(&seq, &retainedBefore, &prunedThrough)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find changes after version %d: %w", version, err)
+	}
+	if !seq.Valid {
+		return 0, nil
+	}
+	if prunedThrough > 0 && !retainedBefore {
+		return 0, fmt.Errorf("%w (changes after version %d may have been pruned; export since that version instead)",
+			ErrReplayUnavailable, version)
+	}
+	return seq.Int64, nil
+}
@@ -0,0 +1,239 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+type recordingPublisher struct {
+	published [][]Message
+	err       error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, messages []Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, messages)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+var changeColumns = []string{"seq", "operation", "observation_id", "form_type", "form_version", "version", "deleted", "data", "changed_at"}
+
+func TestService_PublishPending(t *testing.T) {
+	publisher := &recordingPublisher{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Broker = BrokerNATS
+	config.BatchSize = 2
+	svc := NewService(db, config, publisher, logger.NewLogger())
+	changedAt := time.Date(2025, 9, 17, 8, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WithArgs(publishLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`FROM observation_changes\s+WHERE published_at IS NULL\s+ORDER BY seq`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(changeColumns).
+			AddRow(11, "create", "obs-1", "household", "1.0", 40, false, []byte(`{"size":4}`), changedAt).
+			AddRow(12, "delete", "obs-2", "household", "1.0", 41, true, []byte(`{}`), changedAt))
+	mock.ExpectExec(`UPDATE observation_changes SET published_at = NOW\(\) WHERE seq = ANY`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := svc.PublishPending(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 changes published, got %d, %v", n, err)
+	}
+	if len(publisher.published) != 1 || len(publisher.published[0]) != 2 {
+		t.Fatalf("Expected one batch of two messages, got %+v", publisher.published)
+	}
+	msg := publisher.published[0][1]
+	if msg.ID != "12" || msg.Key != "obs-2" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	var event Event
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		t.Fatalf("Invalid event: %v", err)
+	}
+	if event.Seq != 12 || event.Operation != "delete" || !event.Deleted || event.Version != 41 || !event.ChangedAt.Equal(changedAt) {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_PublishPendingFailureKeepsChanges(t *testing.T) {
+	publisher := &recordingPublisher{err: errors.New("broker down")}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Broker = BrokerNATS
+	config.BatchSize = 2
+	svc := NewService(db, config, publisher, logger.NewLogger())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`FROM observation_changes`).
+		WillReturnRows(sqlmock.NewRows(changeColumns).
+			AddRow(11, "update", "obs-1", "household", "1.0", 40, false, []byte(`{}`), time.Now()))
+	// Nothing is marked published
+	mock.ExpectRollback()
+
+	if _, err := svc.PublishPending(context.Background()); err == nil {
+		t.Fatal("Expected the broker error")
+	}
+
+	mock.ExpectQuery(`SELECT\s+COUNT\(\*\) FILTER`).
+		WillReturnRows(sqlmock.NewRows([]string{"pending", "last_seq", "last_at", "pruned_through"}).AddRow(1, nil, nil, 0))
+	status, err := svc.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Pending != 1 || status.LastError != "broker down" || status.OldestReplayableSeq != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_PublishPendingSkipsWhileLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Broker = BrokerNATS
+	config.BatchSize = 2
+	svc := NewService(db, config, &recordingPublisher{}, logger.NewLogger())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectRollback()
+
+	if n, err := svc.PublishPending(context.Background()); err != nil || n != 0 {
+		t.Errorf("Expected nothing published, got %d, %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Replay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Broker = BrokerNATS
+	config.BatchSize = 2
+	svc := NewService(db, config, &recordingPublisher{}, logger.NewLogger())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT pruned_through FROM change_feed_state`).
+		WillReturnRows(sqlmock.NewRows([]string{"pruned_through"}).AddRow(100))
+	mock.ExpectRollback()
+
+	if _, err := svc.Replay(context.Background(), 50); !errors.Is(err, ErrReplayUnavailable) {
+		t.Errorf("Expected ErrReplayUnavailable, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT pruned_through FROM change_feed_state`).
+		WillReturnRows(sqlmock.NewRows([]string{"pruned_through"}).AddRow(100))
+	mock.ExpectExec(`UPDATE observation_changes SET published_at = NULL WHERE seq >= \$1`).WithArgs(int64(101)).
+		WillReturnResult(sqlmock.NewResult(0, 25))
+	mock.ExpectCommit()
+
+	n, err := svc.Replay(context.Background(), 101)
+	if err != nil || n != 25 {
+		t.Errorf("Expected 25 changes requeued, got %d, %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Disabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), nil, logger.NewLogger())
+
+	// Recording stops so the outbox doesn't grow
+	mock.ExpectExec(`UPDATE change_feed_state SET enabled = \$1`).WithArgs(false).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.Initialize(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.PublishPending(context.Background()); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+	if _, err := svc.Replay(context.Background(), 1); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_FirstSeqAfterVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Broker = BrokerNATS
+	config.BatchSize = 2
+	svc := NewService(db, config, &recordingPublisher{}, logger.NewLogger())
+	columns := []string{"min", "exists", "pruned_through"}
+	query := `SELECT \(SELECT MIN\(seq\) FROM observation_changes WHERE version > \$1\)`
+
+	mock.ExpectQuery(query).WithArgs(int64(40)).WillReturnRows(sqlmock.NewRows(columns).AddRow(117, true, 100))
+	mock.ExpectQuery(query).WithArgs(int64(90)).WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, false, 100))
+	mock.ExpectQuery(query).WithArgs(int64(10)).WillReturnRows(sqlmock.NewRows(columns).AddRow(101, false, 100))
+	mock.ExpectQuery(query).WithArgs(int64(0)).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, false, 0))
+
+	if seq, err := svc.FirstSeqAfterVersion(context.Background(), 40); err != nil || seq != 117 {
+		t.Errorf("Expected seq 117, got %d, %v", seq, err)
+	}
+	if seq, err := svc.FirstSeqAfterVersion(context.Background(), 90); err != nil || seq != 0 {
+		t.Errorf("Expected no seq, got %d, %v", seq, err)
+	}
+	// Nothing at or before version 10 is retained, so its next changes may be gone
+	if _, err := svc.FirstSeqAfterVersion(context.Background(), 10); !errors.Is(err, ErrReplayUnavailable) {
+		t.Errorf("Expected ErrReplayUnavailable, got %v", err)
+	}
+	if seq, err := svc.FirstSeqAfterVersion(context.Background(), 0); err != nil || seq != 1 {
+		t.Errorf("Expected seq 1, got %d, %v", seq, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Package checkpoint records the sync watermark clients report after syncing: the version
+// they pulled up to and how many records they pushed. The watermarks hold back attachment
+// operation compaction, show admins which devices are behind, and raise an alert for
+// devices that stopped syncing while the server moved on.
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxClientIDLength is the size of client_checkpoints.client_id
+const maxClientIDLength = 255
+
+var (
+	// ErrInvalidCheckpoint is returned for a checkpoint without a client or with negative numbers
+	ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+	// ErrVersionAhead is returned for a pulled version the server hasn't reached
+	ErrVersionAhead = errors.New("pulled version is ahead of the current version")
+)
+
+// Config contains checkpoint configuration
+type Config struct {
+	// StalledAfter is how long a client that is behind may go without a checkpoint before
+	// it counts as stalled; 0 disables stalled-client detection
+	StalledAfter time.Duration
+	// CheckInterval is how often stalled clients are looked for; 0 disables the alerts
+	CheckInterval time.Duration
+	// AlertEmail receives stalled-client alerts; alerts are only logged when empty
+	AlertEmail string
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		StalledAfter:  72 * time.Hour,
+		CheckInterval: time.Hour,
+	}
+}
+
+// Checkpoint is the sync watermark a client reports
+type Checkpoint struct {
+	ClientID      string
+	Username      string
+	PulledVersion int64
+	PushedCount   int64
+}
+
+// Client is the last checkpoint of a client and how far it is behind
+type Client struct {
+	ClientID      string    `json:"client_id"`
+	Username      *string   `json:"username,omitempty"`
+	PulledVersion int64     `json:"pulled_version"`
+	PushedCount   int64     `json:"pushed_count"`
+	CheckpointAt  time.Time `json:"checkpoint_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	// AttachmentVersion is the since_version of the client's last attachment manifest request
+	AttachmentVersion *int64 `json:"attachment_version,omitempty"`
+	// Behind is how many versions the server is ahead of the pulled version
+	Behind int64 `json:"behind"`
+	// Stalled is set for clients that are behind and haven't checkpointed within StalledAfter
+	Stalled bool `json:"stalled"`
+}
+
+// Query selects the clients to list
+type Query struct {
+	MinBehind   int64 // Only clients at least this many versions behind
+	StalledOnly bool
+}
+
+// ClientList is the admin view of client checkpoints
+type ClientList struct {
+	CurrentVersion int64    `json:"current_version"`
+	Clients        []Client `json:"clients"`
+}
+
+// Service records and reports client sync checkpoints
+type Service interface {
+	// Record stores a client's checkpoint, replacing its previous one
+	Record(ctx context.Context, checkpoint Checkpoint) (*Client, error)
+
+	// List returns the clients that reported a checkpoint, furthest behind first
+	List(ctx context.Context, query Query) (*ClientList, error)
+
+	// AlertStalled alerts about clients that stalled since their last checkpoint and
+	// returns them. Each stall is alerted once.
+	AlertStalled(ctx context.Context) ([]Client, error)
+
+	// Start looks for stalled clients on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type service struct {
+	db     *sql.DB
+	mailer mail.Mailer
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new checkpoint service. A nil mailer only logs stalled-client alerts.
+func NewService(db *sql.DB, mailer mail.Mailer, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		mailer: mailer,
+		config: config,
+		log:    log,
+	}
+}
+
+const clientColumns = "client_id, username, pulled_version, pushed_count, checkpoint_at, last_seen_at, attachment_version"
+
+// Start looks for stalled clients on the configured schedule until ctx is cancelled
+func (s *service) Start(ctx context.Context) {
+	if s.config.StalledAfter <= 0 || s.config.CheckInterval <= 0 {
+		s.log.Info("Stalled sync client alerts disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.AlertStalled(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to check for stalled sync clients", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Record stores a client's checkpoint. A client that starts over (e.g. after a reinstall)
+// moves its checkpoint back.
+func (s *service) Record(ctx context.Context, checkpoint Checkpoint) (_ *Client, err error) {
+	ctx, span := tracing.Start(ctx, "checkpoint.Record",
+		attribute.String("checkpoint.client_id", checkpoint.ClientID),
+		attribute.Int64("checkpoint.pulled_version", checkpoint.PulledVersion))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	switch {
+	case checkpoint.ClientID == "" || len(checkpoint.ClientID) > maxClientIDLength:
+		return nil, fmt.Errorf("%w: client_id is required (max %d characters)", ErrInvalidCheckpoint, maxClientIDLength)
+	case checkpoint.PulledVersion < 0 || checkpoint.PushedCount < 0:
+		return nil, fmt.Errorf("%w: pulled_version and pushed_count must not be negative", ErrInvalidCheckpoint)
+	}
+
+	current, err := s.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.PulledVersion > current {
+		return nil, fmt.Errorf("%w (current version is %d)", ErrVersionAhead, current)
+	}
+
+	// A checkpoint ends a stall, so the next one is alerted again
+	query := `
+		INSERT INTO client_checkpoints (client_id, pulled_version, pushed_count, username, checkpoint_at, last_seen_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW(), NOW())
+		ON CONFLICT (client_id) DO UPDATE SET
+			pulled_version = EXCLUDED.pulled_version,
+			pushed_count = EXCLUDED.pushed_count,
+			username = COALESCE(EXCLUDED.username, client_checkpoints.username),
+			checkpoint_at = EXCLUDED.checkpoint_at,
+			last_seen_at = EXCLUDED.last_seen_at,
+			stalled_alerted_at = NULL
+		RETURNING ` + clientColumns
+	client, err := s.scanClient(s.db.QueryRowContext(ctx, query,
+		checkpoint.ClientID, checkpoint.PulledVersion, checkpoint.PushedCount, checkpoint.Username), current, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Debug("Recorded sync checkpoint", "clientId", client.ClientID, "pulledVersion", client.PulledVersion,
+		"pushedCount", client.PushedCount, "behind", client.Behind)
+	return client, nil
+}
+
+// List returns the clients that reported a checkpoint
+func (s *service) List(ctx context.Context, query Query) (_ *ClientList, err error) {
+	ctx, span := tracing.Start(ctx, "checkpoint.List",
+		attribute.Int64("checkpoint.min_behind", query.MinBehind), attribute.Bool("checkpoint.stalled_only", query.StalledOnly))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	current, err := s.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+clientColumns+` FROM client_checkpoints
+		WHERE pulled_version IS NOT NULL AND $1 - pulled_version >= $2
+		ORDER BY pulled_version, client_id`, current, query.MinBehind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	list := &ClientList{CurrentVersion: current, Clients: []Client{}}
+	for rows.Next() {
+		client, err := s.scanClient(rows, current, now)
+		if err != nil {
+			return nil, err
+		}
+		if query.StalledOnly && !client.Stalled {
+			continue
+		}
+		list.Clients = append(list.Clients, *client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read client checkpoints: %w", err)
+	}
+	return list, nil
+}
+
+// AlertStalled alerts about clients that stalled since their last checkpoint
+func (s *service) AlertStalled(ctx context.Context) (_ []Client, err error) {
+	ctx, span := tracing.Start(ctx, "checkpoint.AlertStalled")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if s.config.StalledAfter <= 0 {
+		return nil, nil
+	}
+	current, err := s.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+clientColumns+` FROM client_checkpoints
+		WHERE pulled_version < $1 AND checkpoint_at < $2 AND stalled_alerted_at IS NULL
+		ORDER BY pulled_version, client_id`, current, now.Add(-s.config.StalledAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stalled clients: %w", err)
+	}
+	defer rows.Close()
+
+	stalled := []Client{}
+	for rows.Next() {
+		client, err := s.scanClient(rows, current, now)
+		if err != nil {
+			return nil, err
+		}
+		stalled = append(stalled, *client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stalled clients: %w", err)
+	}
+	span.SetAttributes(attribute.Int("checkpoint.stalled", len(stalled)))
+	if len(stalled) == 0 {
+		return stalled, nil
+	}
+
+	clientIDs := make([]string, 0, len(stalled))
+	for _, client := range stalled {
+		clientIDs = append(clientIDs, client.ClientID)
+		s.log.Warn("Sync client stalled", "clientId", client.ClientID, "pulledVersion", client.PulledVersion,
+			"behind", client.Behind, "lastCheckpoint", client.CheckpointAt)
+	}
+
+	// Unsent alerts are retried on the next check
+	if s.mailer != nil && s.config.AlertEmail != "" {
+		if err := s.mailer.Send(ctx, s.alertMessage(stalled, current)); err != nil {
+			return nil, fmt.Errorf("failed to send stalled client alert: %w", err)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE client_checkpoints SET stalled_alerted_at = NOW() WHERE client_id = ANY($1)", pq.Array(clientIDs)); err != nil {
+		return nil, fmt.Errorf("failed to record stalled client alert: %w", err)
+	}
+	return stalled, nil
+}
+
+// alertMessage lists the stalled clients for AlertEmail
+func (s *service) alertMessage(stalled []Client, current int64) mail.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%d device(s) have not reported a sync checkpoint for more than %s while the server moved on to version %d:\n\n",
+		len(stalled), s.config.StalledAfter, current)
+	for _, client := range stalled {
+		user := "unknown user"
+		if client.Username != nil {
+			user = *client.Username
+		}
+		fmt.Fprintf(&body, "- %s (%s): pulled version %d, %d versions behind, last checkpoint %s\n",
+			client.ClientID, user, client.PulledVersion, client.Behind, client.CheckpointAt.UTC().Format(time.RFC3339))
+	}
+	body.WriteString("\nEach device is reported once; it is reported again if it stalls after its next checkpoint.\n")
+
+	return mail.Message{
+		To:      s.config.AlertEmail,
+		Subject: fmt.Sprintf("Synkronus: %d sync client(s) stalled", len(stalled)),
+		Body:    body.String(),
+	}
+}
+
+// currentVersion returns the latest committed sync version
+func (s *service) currentVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := s.db.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read current version: %w", err)
+	}
+	return version, nil
+}
+
+// scanClient scans a checkpoint row and computes how far the client is behind current
+func (s *service) scanClient(row interface{ Scan(...any) error }, current int64, now time.Time) (*Client, error) {
+	var client Client
+	var username sql.NullString
+	var attachmentVersion sql.NullInt64
+	if err := row.Scan(&client.ClientID, &username, &client.PulledVersion, &client.PushedCount,
+		&client.CheckpointAt, &client.LastSeenAt, &attachmentVersion); err != nil {
+		return nil, fmt.Errorf("failed to scan client checkpoint: %w", err)
+	}
+	if username.Valid {
+		client.Username = &username.String
+	}
+	if attachmentVersion.Valid {
+		client.AttachmentVersion = &attachmentVersion.Int64
+	}
+	if current > client.PulledVersion {
+		client.Behind = current - client.PulledVersion
+	}
+	client.Stalled = client.Behind > 0 && s.config.StalledAfter > 0 && now.Sub(client.CheckpointAt) > s.config.StalledAfter
+	return &client, nil
+}
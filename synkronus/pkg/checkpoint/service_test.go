@@ -0,0 +1,159 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+)
+
+var clientRowColumns = []string{"client_id", "username", "pulled_version", "pushed_count", "checkpoint_at", "last_seen_at", "attachment_version"}
+
+type fakeMailer struct {
+	sent []mail.Message
+	err  error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func expectCurrentVersion(mock sqlmock.Sqlmock, version int64) {
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(version))
+}
+
+func TestService_Record(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, nil, DefaultConfig(), logger.NewLogger())
+	now := time.Now()
+
+	expectCurrentVersion(mock, 120)
+	mock.ExpectQuery(`INSERT INTO client_checkpoints`).WithArgs("device-1", int64(100), int64(7), "alice").
+		WillReturnRows(sqlmock.NewRows(clientRowColumns).AddRow("device-1", "alice", 100, 7, now, now, nil))
+
+	client, err := svc.Record(context.Background(), Checkpoint{ClientID: "device-1", Username: "alice", PulledVersion: 100, PushedCount: 7})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.Behind != 20 || client.Stalled || client.AttachmentVersion != nil || client.Username == nil || *client.Username != "alice" {
+		t.Errorf("Unexpected client: %+v", client)
+	}
+
+	expectCurrentVersion(mock, 120)
+	if _, err := svc.Record(context.Background(), Checkpoint{ClientID: "device-1", PulledVersion: 121}); !errors.Is(err, ErrVersionAhead) {
+		t.Errorf("Expected ErrVersionAhead, got %v", err)
+	}
+
+	for _, checkpoint := range []Checkpoint{
+		{PulledVersion: 1},
+		{ClientID: strings.Repeat("x", maxClientIDLength+1)},
+		{ClientID: "device-1", PulledVersion: -1},
+		{ClientID: "device-1", PushedCount: -1},
+	} {
+		if _, err := svc.Record(context.Background(), checkpoint); !errors.Is(err, ErrInvalidCheckpoint) {
+			t.Errorf("Expected ErrInvalidCheckpoint for %+v, got %v", checkpoint, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, nil, Config{StalledAfter: 24 * time.Hour}, logger.NewLogger())
+	now := time.Now()
+
+	expectCurrentVersion(mock, 50)
+	mock.ExpectQuery(`FROM client_checkpoints\s+WHERE pulled_version IS NOT NULL`).WithArgs(int64(50), int64(1)).
+		WillReturnRows(sqlmock.NewRows(clientRowColumns).
+			AddRow("old-tablet", nil, 10, 3, now.Add(-48*time.Hour), now.Add(-48*time.Hour), 10).
+			AddRow("phone", "bob", 45, 0, now.Add(-time.Hour), now.Add(-time.Hour), nil))
+
+	list, err := svc.List(context.Background(), Query{MinBehind: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if list.CurrentVersion != 50 || len(list.Clients) != 2 {
+		t.Fatalf("Unexpected list: %+v", list)
+	}
+	if !list.Clients[0].Stalled || list.Clients[0].Behind != 40 || list.Clients[1].Stalled || list.Clients[1].Behind != 5 {
+		t.Errorf("Unexpected clients: %+v", list.Clients)
+	}
+
+	expectCurrentVersion(mock, 50)
+	mock.ExpectQuery(`FROM client_checkpoints`).WithArgs(int64(50), int64(0)).
+		WillReturnRows(sqlmock.NewRows(clientRowColumns).
+			AddRow("old-tablet", nil, 10, 3, now.Add(-48*time.Hour), now.Add(-48*time.Hour), 10).
+			AddRow("phone", "bob", 45, 0, now.Add(-time.Hour), now.Add(-time.Hour), nil))
+	list, err = svc.List(context.Background(), Query{StalledOnly: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(list.Clients) != 1 || list.Clients[0].ClientID != "old-tablet" {
+		t.Errorf("Expected only the stalled client, got %+v", list.Clients)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_AlertStalled(t *testing.T) {
+	mailer := &fakeMailer{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, mailer, Config{StalledAfter: 24 * time.Hour, AlertEmail: "ops@example.org"}, logger.NewLogger())
+	checkpointAt := time.Now().Add(-48 * time.Hour)
+
+	expectCurrentVersion(mock, 50)
+	mock.ExpectQuery(`FROM client_checkpoints\s+WHERE pulled_version < \$1 AND checkpoint_at < \$2 AND stalled_alerted_at IS NULL`).
+		WithArgs(int64(50), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(clientRowColumns).AddRow("old-tablet", "alice", 10, 3, checkpointAt, checkpointAt, nil))
+	mock.ExpectExec(`UPDATE client_checkpoints SET stalled_alerted_at = NOW\(\) WHERE client_id = ANY\(\$1\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stalled, err := svc.AlertStalled(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stalled) != 1 || stalled[0].Behind != 40 {
+		t.Errorf("Unexpected stalled clients: %+v", stalled)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "ops@example.org" ||
+		!strings.Contains(mailer.sent[0].Body, "old-tablet (alice): pulled version 10, 40 versions behind") {
+		t.Errorf("Unexpected alert: %+v", mailer.sent)
+	}
+
+	// A failed alert leaves the clients unmarked, so the next check retries it
+	mailer.err = errors.New("connection refused")
+	expectCurrentVersion(mock, 50)
+	mock.ExpectQuery(`FROM client_checkpoints`).
+		WillReturnRows(sqlmock.NewRows(clientRowColumns).AddRow("old-tablet", "alice", 10, 3, checkpointAt, checkpointAt, nil))
+	if _, err := svc.AlertStalled(context.Background()); err == nil {
+		t.Error("Expected the mail error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
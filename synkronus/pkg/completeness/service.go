@@ -0,0 +1,414 @@
+// Package completeness reports how many stored observations lack the fields their form's
+// schema requires. Clients are expected to enforce required fields, so a rise in incomplete
+// submissions from some clients points at an app version that bypasses validation. It also
+// counts observations missing the media of fields tagged x-attachment-required.
+package completeness
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Supported time windows
+const (
+	WindowHour = "hour"
+	WindowDay  = "day"
+	WindowWeek = "week"
+)
+
+// unknownClient is the group for observations pushed before client tracking existed
+const unknownClient = "unknown"
+
+// ErrUnknownFormType is returned for a form type the active app bundle doesn't have
+var ErrUnknownFormType = errors.New("unknown form type")
+
+// Config contains completeness report configuration
+type Config struct {
+	// DefaultPeriod is how far back a report looks when no start is given
+	DefaultPeriod time.Duration
+	// AttachmentGrace is how long after a push the attachments it refers to may still be
+	// uploaded before the observation counts as missing media
+	AttachmentGrace time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		DefaultPeriod:   30 * 24 * time.Hour,
+		AttachmentGrace: time.Hour,
+	}
+}
+
+// Bundle is the part of the app bundle service the report reads required fields from
+type Bundle interface {
+	GetManifest(ctx context.Context) (*appbundle.Manifest, error)
+	GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error)
+}
+
+// Query selects the observations to report on
+type Query struct {
+	// FormType limits the report to one form; empty reports every form with required
+	// fields or required attachments
+	FormType string
+	// Window is the time window observations are grouped by; empty is WindowDay
+	Window string
+	From   *time.Time // inclusive, by created_at
+	To     *time.Time // exclusive, by created_at
+}
+
+// Group is the completeness of one client's observations created in one time window
+type Group struct {
+	ClientID    string    `json:"client_id"`
+	WindowStart time.Time `json:"window_start"`
+	Total       int64     `json:"total"`
+	Incomplete  int64     `json:"incomplete"`
+	// IncompletePercent is the share of observations missing at least one required field
+	IncompletePercent float64 `json:"incomplete_percent"`
+	// Missing counts the observations missing each required field; complete fields are omitted
+	Missing map[string]int64 `json:"missing"`
+	// MissingMedia counts the observations missing at least one required attachment
+	MissingMedia int64 `json:"missing_media"`
+}
+
+// FormReport is the completeness of one form type's observations
+type FormReport struct {
+	FormType          string           `json:"form_type"`
+	RequiredFields    []string         `json:"required_fields"`
+	Total             int64            `json:"total"`
+	Incomplete        int64            `json:"incomplete"`
+	IncompletePercent float64          `json:"incomplete_percent"`
+	Missing           map[string]int64 `json:"missing"`
+	// AttachmentFields are the fields tagged x-attachment-required
+	AttachmentFields []string `json:"attachment_fields"`
+	MissingMedia     int64    `json:"missing_media"`
+	// MissingAttachments counts the observations missing each required attachment
+	MissingAttachments map[string]int64 `json:"missing_attachments"`
+	Groups             []Group          `json:"groups"`
+}
+
+// Report lists the required-field completeness of observations per form type
+type Report struct {
+	BundleVersion string       `json:"bundle_version"`
+	Window        string       `json:"window"`
+	From          time.Time    `json:"from"`
+	To            *time.Time   `json:"to,omitempty"`
+	Forms         []FormReport `json:"forms"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+}
+
+// Service computes required-field completeness reports
+type Service interface {
+	// Report counts, per form type, client and time window, the observations missing
+	// fields or attachments the active app bundle's schemas require
+	Report(ctx context.Context, query Query) (*Report, error)
+}
+
+type service struct {
+	db     *sql.DB
+	bundle Bundle
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new completeness report service
+func NewService(db *sql.DB, bundle Bundle, config Config, log *logger.Logger) Service {
+	if config.DefaultPeriod <= 0 {
+		config.DefaultPeriod = DefaultConfig().DefaultPeriod
+	}
+	if config.AttachmentGrace < 0 {
+		config.AttachmentGrace = 0
+	}
+	return &service{db: db, bundle: bundle, config: config, log: log}
+}
+
+// ValidWindow reports whether window is a supported time window
+func ValidWindow(window string) bool {
+	switch window {
+	case WindowHour, WindowDay, WindowWeek:
+		return true
+	}
+	return false
+}
+
+// Report counts the observations missing required fields
+func (s *service) Report(ctx context.Context, query Query) (_ *Report, err error) {
+	ctx, span := tracing.Start(ctx, "completeness.Report", attribute.String("completeness.form_type", query.FormType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	window := query.Window
+	if window == "" {
+		window = WindowDay
+	}
+	if !ValidWindow(window) {
+		return nil, fmt.Errorf("invalid window %q", window)
+	}
+
+	manifest, err := s.bundle.GetManifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app bundle manifest: %w", err)
+	}
+	appInfo, err := s.bundle.GetAppInfo(ctx, manifest.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app info: %w", err)
+	}
+
+	formTypes := make([]string, 0, len(appInfo.Forms))
+	if query.FormType != "" {
+		if _, ok := appInfo.Forms[query.FormType]; !ok {
+			return nil, fmt.Errorf("%w: the active app bundle has no form %s", ErrUnknownFormType, query.FormType)
+		}
+		formTypes = append(formTypes, query.FormType)
+	} else {
+		for formType, form := range appInfo.Forms {
+			if len(requiredFields(form)) > 0 || len(attachmentFields(form)) > 0 {
+				formTypes = append(formTypes, formType)
+			}
+		}
+		sort.Strings(formTypes)
+	}
+
+	report := &Report{
+		BundleVersion: manifest.Version,
+		Window:        window,
+		To:            query.To,
+		Forms:         []FormReport{},
+		GeneratedAt:   time.Now().UTC(),
+	}
+	if query.From != nil {
+		report.From = *query.From
+	} else {
+		report.From = report.GeneratedAt.Add(-s.config.DefaultPeriod)
+	}
+
+	for _, formType := range formTypes {
+		form, err := s.formReport(ctx, formType, requiredFields(appInfo.Forms[formType]), window, report.From, query.To)
+		if err != nil {
+			return nil, err
+		}
+		form.AttachmentFields = attachmentFields(appInfo.Forms[formType])
+		if err := s.countMissingMedia(ctx, form, window, report.From, query.To, report.GeneratedAt.Add(-s.config.AttachmentGrace)); err != nil {
+			return nil, err
+		}
+		report.Forms = append(report.Forms, *form)
+	}
+	span.SetAttributes(attribute.Int("completeness.forms", len(report.Forms)))
+	return report, nil
+}
+
+// requiredFields lists the fields a form's schema requires, in schema order
+func requiredFields(form appbundle.FormInfo) []string {
+	fields := []string{}
+	for _, field := range form.Fields {
+		if field.Required {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// attachmentFields lists the fields a form's schema tags x-attachment-required, in schema order
+func attachmentFields(form appbundle.FormInfo) []string {
+	fields := []string{}
+	for _, field := range form.Fields {
+		if field.AttachmentRequired {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// groupKey identifies a group while its rows are collected
+type groupKey struct {
+	client string
+	start  time.Time
+}
+
+// formReport counts the incomplete observations of one form type. A required field is
+// missing when the key is absent, JSON null or an empty string.
+func (s *service) formReport(ctx context.Context, formType string, required []string, window string, from time.Time, to *time.Time) (*FormReport, error) {
+	form := &FormReport{
+		FormType:           formType,
+		RequiredFields:     required,
+		Missing:            map[string]int64{},
+		AttachmentFields:   []string{},
+		MissingAttachments: map[string]int64{},
+		Groups:             []Group{},
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(client_id, $1), date_trunc($2, created_at AT TIME ZONE 'UTC'),
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE EXISTS (
+		           SELECT 1 FROM unnest($3::TEXT[]) AS field WHERE COALESCE(data->>field, '') = ''))
+		FROM observations
+		WHERE form_type = $4 AND NOT deleted AND created_at >= $5 AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+		GROUP BY 1, 2
+		ORDER BY 2, 1`,
+		unknownClient, window, pq.Array(required), formType, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count observations of %s: %w", formType, err)
+	}
+	index := make(map[groupKey]int)
+	for rows.Next() {
+		var group Group
+		if err := rows.Scan(&group.ClientID, &group.WindowStart, &group.Total, &group.Incomplete); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan completeness counts: %w", err)
+		}
+		group.WindowStart = group.WindowStart.UTC()
+		group.IncompletePercent = percent(group.Incomplete, group.Total)
+		group.Missing = map[string]int64{}
+		index[groupKey{group.ClientID, group.WindowStart}] = len(form.Groups)
+		form.Groups = append(form.Groups, group)
+		form.Total += group.Total
+		form.Incomplete += group.Incomplete
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read completeness counts: %w", err)
+	}
+	form.IncompletePercent = percent(form.Incomplete, form.Total)
+	if form.Incomplete == 0 {
+		return form, nil
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT COALESCE(client_id, $1), date_trunc($2, created_at AT TIME ZONE 'UTC'), field, COUNT(*)
+		FROM observations CROSS JOIN unnest($3::TEXT[]) AS field
+		WHERE form_type = $4 AND NOT deleted AND created_at >= $5 AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+		  AND COALESCE(data->>field, '') = ''
+		GROUP BY 1, 2, 3`,
+		unknownClient, window, pq.Array(required), formType, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count missing fields of %s: %w", formType, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key groupKey
+		var field string
+		var count int64
+		if err := rows.Scan(&key.client, &key.start, &field, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan missing field counts: %w", err)
+		}
+		// Groups first seen by this query were created after the totals were counted
+		i, ok := index[groupKey{key.client, key.start.UTC()}]
+		if !ok {
+			continue
+		}
+		form.Groups[i].Missing[field] += count
+		form.Missing[field] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read missing field counts: %w", err)
+	}
+	return form, nil
+}
+
+// mediaReference is the attachment a field's answer refers to: a string answer, the filename
+// of a {filename, uri} object, or the uri when it embeds the media as a data URL
+const mediaReference = `
+	SELECT CASE jsonb_typeof(data->field)
+	       WHEN 'string' THEN data->>field
+	       WHEN 'object' THEN COALESCE(NULLIF(data->field->>'filename', ''),
+	                                   CASE WHEN data->field->>'uri' LIKE 'data:%' THEN data->field->>'uri' END)
+	       END AS ref`
+
+// mediaMissing holds for a reference that is empty, or names an attachment that wasn't
+// uploaded although the observation was pushed before the grace cutoff $7
+const mediaMissing = `(COALESCE(media.ref, '') = '' OR (media.ref NOT LIKE 'data:%' AND updated_at < $7
+	AND NOT EXISTS (SELECT 1 FROM attachments WHERE attachments.attachment_id = media.ref)))`
+
+// countMissingMedia counts the observations of a form missing required attachments. An
+// attachment is missing when the answer has no reference, or when it refers to one that
+// hasn't been uploaded although the observation was last pushed before cutoff.
+func (s *service) countMissingMedia(ctx context.Context, form *FormReport, window string, from time.Time, to *time.Time, cutoff time.Time) error {
+	if len(form.AttachmentFields) == 0 {
+		return nil
+	}
+	index := make(map[groupKey]int, len(form.Groups))
+	for i, group := range form.Groups {
+		index[groupKey{group.ClientID, group.WindowStart}] = i
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(client_id, $1), date_trunc($2, created_at AT TIME ZONE 'UTC'), COUNT(*)
+		FROM observations
+		WHERE form_type = $4 AND NOT deleted AND created_at >= $5 AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+		  AND EXISTS (
+		      SELECT 1 FROM unnest($3::TEXT[]) AS field CROSS JOIN LATERAL (`+mediaReference+`) media
+		      WHERE `+mediaMissing+`)
+		GROUP BY 1, 2`,
+		unknownClient, window, pq.Array(form.AttachmentFields), form.FormType, from, to, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to count missing media of %s: %w", form.FormType, err)
+	}
+	for rows.Next() {
+		var key groupKey
+		var count int64
+		if err := rows.Scan(&key.client, &key.start, &count); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan missing media counts: %w", err)
+		}
+		// Groups first seen by this query were created after the totals were counted
+		i, ok := index[groupKey{key.client, key.start.UTC()}]
+		if !ok {
+			continue
+		}
+		form.Groups[i].MissingMedia += count
+		form.MissingMedia += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read missing media counts: %w", err)
+	}
+	if form.MissingMedia == 0 {
+		return nil
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT COALESCE(client_id, $1), date_trunc($2, created_at AT TIME ZONE 'UTC'), field, COUNT(*)
+		FROM observations CROSS JOIN unnest($3::TEXT[]) AS field CROSS JOIN LATERAL (`+mediaReference+`) media
+		WHERE form_type = $4 AND NOT deleted AND created_at >= $5 AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+		  AND `+mediaMissing+`
+		GROUP BY 1, 2, 3`,
+		unknownClient, window, pq.Array(form.AttachmentFields), form.FormType, from, to, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to count missing attachments of %s: %w", form.FormType, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key groupKey
+		var field string
+		var count int64
+		if err := rows.Scan(&key.client, &key.start, &field, &count); err != nil {
+			return fmt.Errorf("failed to scan missing attachment counts: %w", err)
+		}
+		if _, ok := index[groupKey{key.client, key.start.UTC()}]; ok {
+			form.MissingAttachments[field] += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read missing attachment counts: %w", err)
+	}
+	return nil
+}
+
+// percent returns part as a percentage of total, rounded to two decimals
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
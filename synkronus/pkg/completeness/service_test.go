@@ -0,0 +1,200 @@
+package completeness
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+type fakeBundle struct {
+	info *appbundle.AppInfo
+}
+
+func (b *fakeBundle) GetManifest(ctx context.Context) (*appbundle.Manifest, error) {
+	return &appbundle.Manifest{Version: "4"}, nil
+}
+
+func (b *fakeBundle) GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error) {
+	return b.info, nil
+}
+
+func testBundle() *fakeBundle {
+	return &fakeBundle{info: &appbundle.AppInfo{Forms: map[string]appbundle.FormInfo{
+		"household": {Fields: []appbundle.FieldInfo{
+			{Name: "name", Required: true},
+			{Name: "notes"},
+			{Name: "members", Required: true},
+		}},
+		"visit": {Fields: []appbundle.FieldInfo{{Name: "notes"}}},
+	}}}
+}
+
+func TestService_Report(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, testBundle(), DefaultConfig(), logger.NewLogger())
+
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day1, day2 := from, from.AddDate(0, 0, 1)
+	required := pq.Array([]string{"name", "members"})
+
+	mock.ExpectQuery(`SELECT COALESCE\(client_id, \$1\), date_trunc\(\$2, created_at AT TIME ZONE 'UTC'\),\s+COUNT\(\*\)`).
+		WithArgs("unknown", "day", required, "household", from, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "total", "incomplete"}).
+			AddRow("device-a", day1, 10, 0).
+			AddRow("device-b", day1, 8, 6).
+			AddRow("device-b", day2, 4, 1))
+	mock.ExpectQuery(`CROSS JOIN unnest\(\$3::TEXT\[\]\) AS field`).
+		WithArgs("unknown", "day", required, "household", from, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "field", "count"}).
+			AddRow("device-b", day1, "name", 6).
+			AddRow("device-b", day1, "members", 2).
+			AddRow("device-b", day2, "members", 1))
+
+	// visit has no required fields and is left out
+	report, err := svc.Report(context.Background(), Query{From: &from})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if report.BundleVersion != "4" || report.Window != "day" {
+		t.Errorf("Expected bundle 4 by day, got %s by %s", report.BundleVersion, report.Window)
+	}
+	if len(report.Forms) != 1 {
+		t.Fatalf("Expected 1 form, got %d: %+v", len(report.Forms), report.Forms)
+	}
+	form := report.Forms[0]
+	if form.FormType != "household" || form.Total != 22 || form.Incomplete != 7 {
+		t.Errorf("Expected 7 of 22 household observations incomplete, got %d of %d (%s)", form.Incomplete, form.Total, form.FormType)
+	}
+	if form.IncompletePercent != 31.82 {
+		t.Errorf("Expected 31.82%% incomplete, got %v", form.IncompletePercent)
+	}
+	if form.Missing["name"] != 6 || form.Missing["members"] != 3 {
+		t.Errorf("Unexpected missing field counts: %v", form.Missing)
+	}
+	if len(form.Groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d", len(form.Groups))
+	}
+	if group := form.Groups[1]; group.ClientID != "device-b" || group.IncompletePercent != 75 || group.Missing["members"] != 2 {
+		t.Errorf("Unexpected device-b group: %+v", group)
+	}
+	if group := form.Groups[0]; len(group.Missing) != 0 || group.IncompletePercent != 0 {
+		t.Errorf("Expected device-a to be complete, got %+v", group)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Report_CompleteFormSkipsFieldCounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, testBundle(), DefaultConfig(), logger.NewLogger())
+
+	mock.ExpectQuery(`SELECT COALESCE\(client_id, \$1\)`).
+		WithArgs("unknown", "week", pq.Array([]string{}), "visit", sqlmock.AnyArg(), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "total", "incomplete"}).
+			AddRow("device-a", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), 3, 0))
+
+	report, err := svc.Report(context.Background(), Query{FormType: "visit", Window: WindowWeek})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.Forms) != 1 || report.Forms[0].Total != 3 || report.Forms[0].Incomplete != 0 {
+		t.Errorf("Unexpected report: %+v", report.Forms)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Report_UnknownFormType(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, testBundle(), DefaultConfig(), logger.NewLogger())
+	if _, err := svc.Report(context.Background(), Query{FormType: "unknown"}); !errors.Is(err, ErrUnknownFormType) {
+		t.Errorf("Expected ErrUnknownFormType, got %v", err)
+	}
+	if _, err := svc.Report(context.Background(), Query{Window: "month"}); err == nil {
+		t.Error("Expected an error for an unsupported window")
+	}
+}
+
+func TestService_Report_MissingMedia(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	bundle := &fakeBundle{info: &appbundle.AppInfo{Forms: map[string]appbundle.FormInfo{
+		"consent": {Fields: []appbundle.FieldInfo{
+			{Name: "photo", AttachmentRequired: true},
+			{Name: "signature", AttachmentRequired: true},
+			{Name: "notes"},
+		}},
+		"visit": {Fields: []appbundle.FieldInfo{{Name: "notes"}}},
+	}}}
+	svc := NewService(db, bundle, Config{AttachmentGrace: time.Hour}, logger.NewLogger())
+
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	attachments := pq.Array([]string{"photo", "signature"})
+	cutoff := sqlmock.AnyArg()
+
+	// consent has no required fields but is reported for its attachments
+	mock.ExpectQuery(`SELECT COALESCE\(client_id, \$1\), date_trunc\(\$2, created_at AT TIME ZONE 'UTC'\),\s+COUNT\(\*\)`).
+		WithArgs("unknown", "day", pq.Array([]string{}), "consent", from, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "total", "incomplete"}).
+			AddRow("device-a", from, 10, 0).
+			AddRow("device-b", from, 5, 0))
+	mock.ExpectQuery(`AND EXISTS \(\s+SELECT 1 FROM unnest\(\$3::TEXT\[\]\) AS field CROSS JOIN LATERAL`).
+		WithArgs("unknown", "day", attachments, "consent", from, nil, cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "count"}).
+			AddRow("device-b", from, 3))
+	mock.ExpectQuery(`GROUP BY 1, 2, 3`).
+		WithArgs("unknown", "day", attachments, "consent", from, nil, cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"client", "window_start", "field", "count"}).
+			AddRow("device-b", from, "photo", 3).
+			AddRow("device-b", from, "signature", 1))
+
+	report, err := svc.Report(context.Background(), Query{From: &from})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.Forms) != 1 {
+		t.Fatalf("Expected 1 form, got %+v", report.Forms)
+	}
+	form := report.Forms[0]
+	if form.FormType != "consent" || form.MissingMedia != 3 || form.Incomplete != 0 {
+		t.Errorf("Expected 3 consent observations missing media, got %+v", form)
+	}
+	if form.MissingAttachments["photo"] != 3 || form.MissingAttachments["signature"] != 1 {
+		t.Errorf("Unexpected missing attachment counts: %v", form.MissingAttachments)
+	}
+	if form.Groups[0].MissingMedia != 0 || form.Groups[1].MissingMedia != 3 {
+		t.Errorf("Unexpected groups: %+v", form.Groups)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
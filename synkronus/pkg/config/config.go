@@ -20,16 +20,217 @@ type Config struct {
 	// Authentication
 	JWTSecret string
 
+	// Password hashing; stored hashes with other parameters are upgraded on login
+	PasswordHashAlgorithm string // bcrypt or argon2id
+	BcryptCost            int    // bcrypt work factor
+	Argon2MemoryKB        int    // argon2id memory in KiB
+	Argon2Iterations      int    // argon2id passes
+	Argon2Parallelism     int    // argon2id lanes
+
+	// Admin impersonation
+	ImpersonationTokenTTLMinutes int // Lifetime of tokens admins are issued to act as another user
+
+	// Portal cookie sessions
+	PortalCookieSessions bool   // Let the portal keep its tokens in HttpOnly cookies, with CSRF tokens, on the /api routes
+	PortalCookieSecure   bool   // Send the session cookies over HTTPS only
+	PortalCookieSameSite string // SameSite attribute of the session cookies: strict or lax
+
+	// Security headers
+	SecurityHeaders       bool   // Send X-Content-Type-Options, X-Frame-Options, Referrer-Policy and Content-Security-Policy
+	ContentSecurityPolicy string // Content-Security-Policy header; empty leaves it out
+	HSTSMaxAgeSeconds     int    // max-age of Strict-Transport-Security; 0 leaves the header out
+
 	// Logging
 	LogLevel string
 
 	// File storage
 	DataDir string // Base directory for file storage (attachments, etc.)
 
+	// Served files; each defaults to the copy embedded in the binary
+	StaticDir  string // Directory served under /static and for /favicon.ico
+	OpenAPIDir string // Directory with swagger-ui.html and synkronus.yaml, served under /openapi
+	PortalDir  string // Built portal (synkronus-portal/dist) served at /; the portal is only served when embedded or set
+
+	// Attachment download URLs
+	AttachmentURLTTL    int    // Lifetime in seconds of signed download URLs; 0 issues permanent paths
+	AttachmentURLSecret string // HMAC key for signed URLs (defaults to JWTSecret)
+
+	// Attachment uploads
+	AttachmentOverwritePolicy string // reject, overwrite or idempotent; applies when an upload has no X-Overwrite-Policy header
+	AttachmentExifPolicy      string // keep, strip (GPS position and capture times) or extract (into the attachment metadata)
+
+	// Attachment archives
+	AttachmentArchiveMaxFiles int // Maximum number of files in one POST /attachments/archive download; 0 is unlimited
+
+	// Attachment replication
+	AttachmentReplicaPath                string // Directory uploads are mirrored to, e.g. a second disk or a mounted bucket; empty disables replication
+	AttachmentReplicationIntervalSeconds int    // Interval between replication passes
+	AttachmentReplicationMaxAttempts     int    // Attempts before a failing attachment is left for an admin
+
+	// Video transcoding
+	AttachmentTranscodeFFmpegPath      string // ffmpeg binary videos are transcoded with; empty disables transcoding
+	AttachmentTranscodeMaxHeight       int    // Height videos are scaled down to; 0 keeps the uploaded size
+	AttachmentTranscodeVideoCodec      string // ffmpeg video encoder, e.g. libx264
+	AttachmentTranscodeCRF             int    // Constant rate factor; lower is better quality and larger files
+	AttachmentTranscodeKeepOriginal    bool   // Keep the uploaded video next to the transcoded one
+	AttachmentTranscodeTimeoutSeconds  int    // Time limit for transcoding one video
+	AttachmentTranscodeIntervalSeconds int    // Interval between transcoding passes
+
+	// Attachment previews
+	AttachmentPreviewDefaultSize    int    // Longest edge in pixels of image and PDF previews
+	AttachmentPreviewMaxSize        int    // Largest preview size a request may ask for
+	AttachmentPreviewMaxSourceMB    int    // Largest attachment, in MB, that is previewed
+	AttachmentPreviewPDFToPPMPath   string // pdftoppm binary PDF pages are rendered with; empty disables PDF previews
+	AttachmentPreviewTimeoutSeconds int    // Time limit for making one preview
+
+	// Required attachments (fields tagged x-attachment-required)
+	AttachmentRequiredGraceMinutes int // Time after a push for referenced attachments to be uploaded before the observation counts as missing media
+
+	// Self-registration invitations
+	InviteTTLHours int    // Default lifetime in hours of new invitations
+	InviteURLBase  string // Registration page URL; when set, invitations include a link with ?invite=<token>
+
+	// Email delivery (password reset); disabled unless SMTPHost is set
+	SMTPHost     string
+	SMTPPort     int    // 465 uses implicit TLS; other ports use STARTTLS when offered
+	SMTPUsername string // PLAIN auth is used when set
+	SMTPPassword string
+	SMTPFrom     string // Sender address, e.g. "Synkronus <noreply@example.org>"
+
+	// Self-service password reset
+	PasswordResetTTLMinutes int    // Lifetime of emailed reset links
+	PasswordResetURLBase    string // Reset page URL; emails link to it with ?token=<token>
+
 	// App Bundle settings
 	AppBundlePath   string
 	MaxVersionsKept int
 
+	AppBundlePushMaxWaitSeconds int    // Longest a push may queue behind a running push (?wait=)
+	AppBundleTesters            string // Comma-separated usernames who, like admins, see and preview internal versions
+	AppBundleMaxSizeMB          int    // Largest total size of a pushed bundle's files; 0 is unlimited
+	AppBundleMaxForms           int    // Most forms a pushed bundle may have; 0 is unlimited
+	AppBundleMaxRenderers       int    // Most custom renderers a pushed bundle may have; 0 is unlimited
+	AppBundleMaxUploadMB        int    // Largest bundle zip a push may upload, not overridable; 0 is unlimited
+	AppBundleUploadStore        string // Where pushed zips are staged while validated: "disk" or "memory"
+	AppBundleBootCheckChrome    string // Chrome or Chromium binary that boot checks pushed bundles; empty disables the check
+	AppBundleBootCheckTimeout   int    // Longest a boot check may run, in seconds
+
+	// Data export settings
+	ExportPublicKeyPath string // PEM RSA public key used to encrypt x-sensitive fields in exports
+	ExportNestedColumns bool   // Export schema-declared array/object fields as Parquet list/struct columns
+
+	// Export exclusions, enforced for every export and every caller
+	ExportExcludeFormTypes string // Comma-separated form types never exported
+	ExportExcludeFields    string // Comma-separated form_type.field entries never exported; "*" matches any form type
+	ExportFieldAllowlist   string // Comma-separated form_type.field entries; listed form types export only these fields
+
+	// Attachment operation compaction
+	AttachmentCompactionMinutes   int // Interval between compaction runs; 0 disables compaction
+	AttachmentCompactionClientTTL int // Days after which an unseen client no longer holds back compaction
+
+	// Tombstone compaction
+	SyncTombstoneCompactionMinutes int // Interval between tombstone compaction runs; 0 disables compaction
+	SyncTombstoneRetentionDays     int // Days deleted observations are kept as tombstones; 0 keeps them forever
+
+	// Database diagnostics
+	EnsureIndexes        bool // Create missing sync indexes at startup
+	SlowQueryThresholdMs int  // Mean execution time above which /diagnostics/database reports a query
+
+	// Database failover handling
+	DBRetryMaxAttempts       int // Attempts for sync, manifest and export queries failing with connection errors; 1 disables retries
+	DBRetryInitialBackoffMs  int // Wait before the first retry; doubles with every retry
+	DBRetryMaxBackoffMs      int // Maximum wait between retries
+	DBBreakerThreshold       int // Consecutive failed operations that open the circuit breaker; 0 disables it
+	DBBreakerCooldownSeconds int // How long the open breaker answers 503 before testing the database again
+
+	// Prepared statements
+	DBStatementCacheSize int // Prepared statements kept for sync and manifest queries; 0 runs them unprepared
+
+	// Observation statistics
+	StatsRefreshMinutes int     // Interval between stats refreshes; 0 disables the schedule
+	StatsGridSize       float64 // Geolocation grid cell size in degrees
+
+	// Duplicate detection report defaults
+	DedupTimeWindowHours   int     // Only observations created this close together are compared
+	DedupMaxDistanceMeters float64 // Located observations farther apart are not duplicates; 0 ignores location
+	DedupMinScore          float64 // Data similarity (0..1) at which a pair is reported
+	DedupMaxObservations   int     // Cap on observations scanned per report
+
+	// Pushed timestamps
+	SyncTimestampFormat           string // strict accepts RFC3339 only; lenient also converts common other formats
+	SyncFutureTimestampPolicy     string // warn or reject records whose timestamps are ahead of the server clock
+	SyncClockSkewToleranceSeconds int    // How far ahead of the server clock timestamps may be; 0 disables the check
+
+	// Push conflicts
+	SyncConflictPolicy string // client_wins, server_wins, last_write_wins or reject for records changed since the client pulled them
+
+	// Pushed data validation
+	SyncValidateData bool // Fail pushed records whose data doesn't match their form's schema.json
+
+	// Client sync checkpoints
+	SyncStalledClientHours  int    // Hours a client that is behind may go without a checkpoint before it counts as stalled; 0 disables
+	SyncStalledCheckMinutes int    // Interval between checks for stalled clients; 0 disables the alerts
+	SyncStalledAlertEmail   string // Address stalled-client alerts are emailed to; alerts are only logged when empty
+
+	// Observation review locks
+	ObservationLockDefaultTTLMinutes int // Lock duration when the request doesn't set one
+	ObservationLockMaxTTLMinutes     int // Longest lock a reviewer may take
+
+	// Export reports
+	ExportReportMaxRows        int // Rows a report returns at most; more are left out and flagged as truncated
+	ExportReportTimeoutSeconds int // Statement timeout of one report run
+
+	// Export schedules
+	ExportScheduleDir                   string // Directory scheduled exports are written under
+	ExportScheduleIntervalSeconds       int    // Interval between checks for due schedules; 0 disables scheduled runs
+	ExportScheduleWebhookTimeoutSeconds int    // Timeout of one webhook delivery
+
+	// Observation change feed
+	ChangeFeedBroker        string // nats or kafka-rest; empty disables the change feed
+	ChangeFeedURL           string // nats://host:4222 or tls://host:4222 for NATS; base URL of the Kafka REST Proxy
+	ChangeFeedTopic         string // NATS subject or Kafka topic changes are published to
+	ChangeFeedPollSeconds   int    // Interval between checks for unpublished changes
+	ChangeFeedBatchSize     int    // Changes published per broker request
+	ChangeFeedRetentionDays int    // Days published changes are kept for replays; 0 keeps them forever
+
+	// Form data migration scripts shipped in app bundles
+	BundleMigrationNodePath       string // Node.js binary that runs migration scripts on the server; empty disables server-side migration
+	BundleMigrationTimeoutSeconds int    // Time limit for one script run over a batch of observations
+
+	// Calculated fields
+	CalculationBackfillMinutes int // Interval between checks for changed x-calculated formulas; 0 disables the schedule
+
+	// CDN in front of /app-bundle
+	CDNPublicURL      string // Base URL clients download the app bundle through; manifest file URLs use it
+	CDNPurgeURL       string // Purge API endpoint called on pushes and version switches; purging is disabled when empty
+	CDNPurgeToken     string // Bearer token for the purge API
+	CDNPurgeBatchSize int    // Maximum URLs per purge request
+
+	// Observation PDFs
+	PDFPageSize string // Paper size of observation PDFs: A4, A5, Letter or Legal
+
+	// Feature flags
+	FeatureFlagCacheSeconds int // How long flag lookups are cached before the database is read again
+
+	// Maintenance mode
+	MaintenanceCacheSeconds      int // How long the maintenance state is cached before the database is read again
+	MaintenanceRetryAfterSeconds int // Retry-After sent while in maintenance, unless set when enabling it
+
+	// Sync payload encryption
+	PayloadEncryption       string // off, optional or required; encrypts sync and attachment upload bodies with keys negotiated at login
+	PayloadEncryptionSecret string // Key that seals stored session keys (defaults to JWTSecret)
+	PayloadKeyTTLHours      int    // How long a negotiated key may be used before the client negotiates a new one
+	PayloadMaxBodyMB        int    // Largest encrypted request or response body, held in memory to be decrypted or encrypted
+
+	// Tracing
+	OTLPEndpoint     string  // OTLP/HTTP collector URL; tracing is disabled when empty
+	TraceServiceName string  // service.name reported on spans
+	TraceSampleRatio float64 // Fraction of new traces to sample (0..1)
+
+	// Demo mode
+	DemoMode     bool   // Seed a sample app bundle, demo users and synthetic observations on startup
+	DemoPassword string // Password of the demo users
+
 	// Internal tracking
 	Source string // Source of the configuration (env, .env file path, etc.)
 }
@@ -139,7 +340,168 @@ func Load(log *logger.Logger) (*Config, error) {
 		LogLevel:        getEnvOrDefault("LOG_LEVEL", "info"),
 		AppBundlePath:   getEnvOrDefault("APP_BUNDLE_PATH", "./data/app-bundles"),
 		MaxVersionsKept: getEnvIntOrDefault("MAX_VERSIONS_KEPT", 5),
-		Source:          configSource,
+
+		StaticDir:  getEnvOrDefault("STATIC_DIR", ""),
+		OpenAPIDir: getEnvOrDefault("OPENAPI_DIR", ""),
+		PortalDir:  getEnvOrDefault("PORTAL_DIR", ""),
+
+		PasswordHashAlgorithm: getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		BcryptCost:            getEnvIntOrDefault("BCRYPT_COST", 10),
+		Argon2MemoryKB:        getEnvIntOrDefault("ARGON2_MEMORY_KB", 64*1024),
+		Argon2Iterations:      getEnvIntOrDefault("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getEnvIntOrDefault("ARGON2_PARALLELISM", 2),
+
+		ImpersonationTokenTTLMinutes: getEnvIntOrDefault("IMPERSONATION_TOKEN_TTL_MINUTES", 15),
+
+		PortalCookieSessions: getEnvBoolOrDefault("PORTAL_COOKIE_SESSIONS", false),
+		PortalCookieSecure:   getEnvBoolOrDefault("PORTAL_COOKIE_SECURE", true),
+		PortalCookieSameSite: getEnvOrDefault("PORTAL_COOKIE_SAMESITE", "strict"),
+
+		SecurityHeaders:       getEnvBoolOrDefault("SECURITY_HEADERS", false),
+		ContentSecurityPolicy: getEnvOrDefault("CONTENT_SECURITY_POLICY", "frame-ancestors 'none'"),
+		HSTSMaxAgeSeconds:     getEnvIntOrDefault("HSTS_MAX_AGE_SECONDS", 0),
+
+		AttachmentURLTTL:    getEnvIntOrDefault("ATTACHMENT_URL_TTL_SECONDS", 0),
+		AttachmentURLSecret: getEnvOrDefault("ATTACHMENT_URL_SECRET", ""),
+
+		AttachmentOverwritePolicy: getEnvOrDefault("ATTACHMENT_OVERWRITE_POLICY", "reject"),
+		AttachmentExifPolicy:      getEnvOrDefault("ATTACHMENT_EXIF_POLICY", "keep"),
+
+		AttachmentArchiveMaxFiles: getEnvIntOrDefault("ATTACHMENT_ARCHIVE_MAX_FILES", 1000),
+
+		AttachmentReplicaPath:                getEnvOrDefault("ATTACHMENT_REPLICA_PATH", ""),
+		AttachmentReplicationIntervalSeconds: getEnvIntOrDefault("ATTACHMENT_REPLICATION_INTERVAL_SECONDS", 60),
+		AttachmentReplicationMaxAttempts:     getEnvIntOrDefault("ATTACHMENT_REPLICATION_MAX_ATTEMPTS", 5),
+
+		AttachmentTranscodeFFmpegPath:      getEnvOrDefault("ATTACHMENT_TRANSCODE_FFMPEG_PATH", ""),
+		AttachmentTranscodeMaxHeight:       getEnvIntOrDefault("ATTACHMENT_TRANSCODE_MAX_HEIGHT", 720),
+		AttachmentTranscodeVideoCodec:      getEnvOrDefault("ATTACHMENT_TRANSCODE_VIDEO_CODEC", "libx264"),
+		AttachmentTranscodeCRF:             getEnvIntOrDefault("ATTACHMENT_TRANSCODE_CRF", 23),
+		AttachmentTranscodeKeepOriginal:    getEnvBoolOrDefault("ATTACHMENT_TRANSCODE_KEEP_ORIGINAL", true),
+		AttachmentTranscodeTimeoutSeconds:  getEnvIntOrDefault("ATTACHMENT_TRANSCODE_TIMEOUT_SECONDS", 1800),
+		AttachmentTranscodeIntervalSeconds: getEnvIntOrDefault("ATTACHMENT_TRANSCODE_INTERVAL_SECONDS", 60),
+
+		AttachmentPreviewDefaultSize:    getEnvIntOrDefault("ATTACHMENT_PREVIEW_DEFAULT_SIZE", 512),
+		AttachmentPreviewMaxSize:        getEnvIntOrDefault("ATTACHMENT_PREVIEW_MAX_SIZE", 1024),
+		AttachmentPreviewMaxSourceMB:    getEnvIntOrDefault("ATTACHMENT_PREVIEW_MAX_SOURCE_MB", 50),
+		AttachmentPreviewPDFToPPMPath:   getEnvOrDefault("ATTACHMENT_PREVIEW_PDFTOPPM_PATH", ""),
+		AttachmentPreviewTimeoutSeconds: getEnvIntOrDefault("ATTACHMENT_PREVIEW_TIMEOUT_SECONDS", 30),
+
+		AttachmentRequiredGraceMinutes: getEnvIntOrDefault("ATTACHMENT_REQUIRED_GRACE_MINUTES", 60),
+
+		AppBundlePushMaxWaitSeconds: getEnvIntOrDefault("APP_BUNDLE_PUSH_MAX_WAIT_SECONDS", 300),
+		AppBundleTesters:            getEnvOrDefault("APP_BUNDLE_TESTERS", ""),
+		AppBundleMaxSizeMB:          getEnvIntOrDefault("APP_BUNDLE_MAX_SIZE_MB", 100),
+		AppBundleMaxForms:           getEnvIntOrDefault("APP_BUNDLE_MAX_FORMS", 200),
+		AppBundleMaxRenderers:       getEnvIntOrDefault("APP_BUNDLE_MAX_RENDERERS", 50),
+		AppBundleMaxUploadMB:        getEnvIntOrDefault("APP_BUNDLE_MAX_UPLOAD_MB", 256),
+		AppBundleUploadStore:        getEnvOrDefault("APP_BUNDLE_UPLOAD_STORE", "disk"),
+		AppBundleBootCheckChrome:    getEnvOrDefault("APP_BUNDLE_BOOT_CHECK_CHROME", ""),
+		AppBundleBootCheckTimeout:   getEnvIntOrDefault("APP_BUNDLE_BOOT_CHECK_TIMEOUT_SECONDS", 60),
+
+		InviteTTLHours: getEnvIntOrDefault("INVITE_TTL_HOURS", 72),
+		InviteURLBase:  getEnvOrDefault("INVITE_URL_BASE", ""),
+
+		SMTPHost:     getEnvOrDefault("SMTP_HOST", ""),
+		SMTPPort:     getEnvIntOrDefault("SMTP_PORT", 587),
+		SMTPUsername: getEnvOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword: getEnvOrDefault("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnvOrDefault("SMTP_FROM", ""),
+
+		PasswordResetTTLMinutes: getEnvIntOrDefault("PASSWORD_RESET_TTL_MINUTES", 60),
+		PasswordResetURLBase:    getEnvOrDefault("PASSWORD_RESET_URL_BASE", ""),
+
+		ExportPublicKeyPath: getEnvOrDefault("EXPORT_PUBLIC_KEY_PATH", ""),
+		ExportNestedColumns: getEnvBoolOrDefault("EXPORT_NESTED_COLUMNS", false),
+
+		ExportExcludeFormTypes: getEnvOrDefault("EXPORT_EXCLUDE_FORM_TYPES", ""),
+		ExportExcludeFields:    getEnvOrDefault("EXPORT_EXCLUDE_FIELDS", ""),
+		ExportFieldAllowlist:   getEnvOrDefault("EXPORT_FIELD_ALLOWLIST", ""),
+
+		AttachmentCompactionMinutes:   getEnvIntOrDefault("ATTACHMENT_COMPACTION_INTERVAL_MINUTES", 60),
+		AttachmentCompactionClientTTL: getEnvIntOrDefault("ATTACHMENT_COMPACTION_CLIENT_TTL_DAYS", 90),
+
+		SyncTombstoneCompactionMinutes: getEnvIntOrDefault("SYNC_TOMBSTONE_COMPACTION_INTERVAL_MINUTES", 60),
+		SyncTombstoneRetentionDays:     getEnvIntOrDefault("SYNC_TOMBSTONE_RETENTION_DAYS", 0),
+
+		EnsureIndexes:        getEnvBoolOrDefault("DB_ENSURE_INDEXES", true),
+		SlowQueryThresholdMs: getEnvIntOrDefault("DB_SLOW_QUERY_THRESHOLD_MS", 200),
+
+		DBRetryMaxAttempts:       getEnvIntOrDefault("DB_RETRY_MAX_ATTEMPTS", 4),
+		DBRetryInitialBackoffMs:  getEnvIntOrDefault("DB_RETRY_INITIAL_BACKOFF_MS", 100),
+		DBRetryMaxBackoffMs:      getEnvIntOrDefault("DB_RETRY_MAX_BACKOFF_MS", 2000),
+		DBBreakerThreshold:       getEnvIntOrDefault("DB_CIRCUIT_BREAKER_THRESHOLD", 5),
+		DBBreakerCooldownSeconds: getEnvIntOrDefault("DB_CIRCUIT_BREAKER_COOLDOWN_SECONDS", 10),
+
+		DBStatementCacheSize: getEnvIntOrDefault("DB_STATEMENT_CACHE_SIZE", 128),
+
+		StatsRefreshMinutes: getEnvIntOrDefault("STATS_REFRESH_INTERVAL_MINUTES", 15),
+		StatsGridSize:       getEnvFloatOrDefault("STATS_GRID_SIZE_DEGREES", 0.1),
+
+		DedupTimeWindowHours:   getEnvIntOrDefault("DEDUP_TIME_WINDOW_HOURS", 24),
+		DedupMaxDistanceMeters: getEnvFloatOrDefault("DEDUP_MAX_DISTANCE_METERS", 50),
+		DedupMinScore:          getEnvFloatOrDefault("DEDUP_MIN_SCORE", 0.9),
+		DedupMaxObservations:   getEnvIntOrDefault("DEDUP_MAX_OBSERVATIONS", 50000),
+
+		SyncTimestampFormat:           getEnvOrDefault("SYNC_TIMESTAMP_FORMAT", "lenient"),
+		SyncFutureTimestampPolicy:     getEnvOrDefault("SYNC_FUTURE_TIMESTAMP_POLICY", "warn"),
+		SyncClockSkewToleranceSeconds: getEnvIntOrDefault("SYNC_CLOCK_SKEW_TOLERANCE_SECONDS", 300),
+
+		SyncConflictPolicy: getEnvOrDefault("SYNC_CONFLICT_POLICY", "client_wins"),
+
+		SyncValidateData: getEnvBoolOrDefault("SYNC_VALIDATE_DATA", false),
+
+		SyncStalledClientHours:  getEnvIntOrDefault("SYNC_STALLED_CLIENT_HOURS", 72),
+		SyncStalledCheckMinutes: getEnvIntOrDefault("SYNC_STALLED_CHECK_INTERVAL_MINUTES", 60),
+		SyncStalledAlertEmail:   getEnvOrDefault("SYNC_STALLED_ALERT_EMAIL", ""),
+
+		ObservationLockDefaultTTLMinutes: getEnvIntOrDefault("OBSERVATION_LOCK_DEFAULT_TTL_MINUTES", 30),
+		ObservationLockMaxTTLMinutes:     getEnvIntOrDefault("OBSERVATION_LOCK_MAX_TTL_MINUTES", 480),
+
+		ExportReportMaxRows:        getEnvIntOrDefault("EXPORT_REPORT_MAX_ROWS", 100000),
+		ExportReportTimeoutSeconds: getEnvIntOrDefault("EXPORT_REPORT_TIMEOUT_SECONDS", 60),
+
+		ExportScheduleDir:                   getEnvOrDefault("EXPORT_SCHEDULE_DIR", "./data/exports"),
+		ExportScheduleIntervalSeconds:       getEnvIntOrDefault("EXPORT_SCHEDULE_INTERVAL_SECONDS", 60),
+		ExportScheduleWebhookTimeoutSeconds: getEnvIntOrDefault("EXPORT_SCHEDULE_WEBHOOK_TIMEOUT_SECONDS", 30),
+
+		ChangeFeedBroker:        getEnvOrDefault("CHANGE_FEED_BROKER", ""),
+		ChangeFeedURL:           getEnvOrDefault("CHANGE_FEED_URL", ""),
+		ChangeFeedTopic:         getEnvOrDefault("CHANGE_FEED_TOPIC", "synkronus.observations"),
+		ChangeFeedPollSeconds:   getEnvIntOrDefault("CHANGE_FEED_POLL_INTERVAL_SECONDS", 5),
+		ChangeFeedBatchSize:     getEnvIntOrDefault("CHANGE_FEED_BATCH_SIZE", 100),
+		ChangeFeedRetentionDays: getEnvIntOrDefault("CHANGE_FEED_RETENTION_DAYS", 7),
+
+		BundleMigrationNodePath:       getEnvOrDefault("BUNDLE_MIGRATION_NODE_PATH", "node"),
+		BundleMigrationTimeoutSeconds: getEnvIntOrDefault("BUNDLE_MIGRATION_TIMEOUT_SECONDS", 60),
+
+		CalculationBackfillMinutes: getEnvIntOrDefault("CALCULATION_BACKFILL_INTERVAL_MINUTES", 5),
+
+		CDNPublicURL:      getEnvOrDefault("CDN_PUBLIC_URL", ""),
+		CDNPurgeURL:       getEnvOrDefault("CDN_PURGE_URL", ""),
+		CDNPurgeToken:     getEnvOrDefault("CDN_PURGE_TOKEN", ""),
+		CDNPurgeBatchSize: getEnvIntOrDefault("CDN_PURGE_BATCH_SIZE", 30),
+
+		PDFPageSize: getEnvOrDefault("PDF_PAGE_SIZE", "A4"),
+
+		FeatureFlagCacheSeconds: getEnvIntOrDefault("FEATURE_FLAG_CACHE_SECONDS", 30),
+
+		MaintenanceCacheSeconds:      getEnvIntOrDefault("MAINTENANCE_CACHE_SECONDS", 5),
+		MaintenanceRetryAfterSeconds: getEnvIntOrDefault("MAINTENANCE_RETRY_AFTER_SECONDS", 300),
+
+		PayloadEncryption:       getEnvOrDefault("PAYLOAD_ENCRYPTION", "off"),
+		PayloadEncryptionSecret: getEnvOrDefault("PAYLOAD_ENCRYPTION_SECRET", ""),
+		PayloadKeyTTLHours:      getEnvIntOrDefault("PAYLOAD_KEY_TTL_HOURS", 168),
+		PayloadMaxBodyMB:        getEnvIntOrDefault("PAYLOAD_MAX_BODY_MB", 32),
+
+		OTLPEndpoint:     getEnvOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TraceServiceName: getEnvOrDefault("OTEL_SERVICE_NAME", "synkronus"),
+		TraceSampleRatio: getEnvFloatOrDefault("OTEL_TRACES_SAMPLER_ARG", 1.0),
+
+		DemoMode:     getEnvBoolOrDefault("DEMO_MODE", false),
+		DemoPassword: getEnvOrDefault("DEMO_PASSWORD", "demo"),
+
+		Source: configSource,
 	}, nil
 }
 
@@ -160,3 +522,23 @@ func getEnvIntOrDefault(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvFloatOrDefault retrieves an environment variable as a float or returns a default value
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvBoolOrDefault retrieves an environment variable as a boolean or returns a default value
+func getEnvBoolOrDefault(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
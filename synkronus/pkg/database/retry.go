@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// ErrUnavailable is matched by the errors of operations that failed because the database
+// couldn't be reached, e.g. during a primary failover
+var ErrUnavailable = errors.New("database unavailable")
+
+// UnavailableError is returned by Retrier.Do when transient errors outlasted the retries
+// or the circuit breaker is open
+type UnavailableError struct {
+	Operation string
+	// Err is the last transient error; nil when the breaker rejected the operation
+	Err error
+	// RetryAfter is how long callers should wait before trying again
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %v (circuit breaker open)", e.Operation, ErrUnavailable)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Operation, ErrUnavailable, e.Err)
+}
+
+// Is makes errors.Is(err, ErrUnavailable) match
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// noRetryError marks an error that must not be retried
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string { return e.err.Error() }
+func (e *noRetryError) Unwrap() error { return e.err }
+
+// NoRetry marks err so Retrier.Do doesn't retry it, for failures whose outcome is unknown
+// such as a connection lost while committing. A transient err still counts as the
+// database being unavailable.
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &noRetryError{err: err}
+}
+
+// IsTransient reports whether err is a connection failure that may go away on its own, as
+// during a primary failover: broken or refused connections, and server errors telling
+// the client to reconnect or that the server is a read-only standby
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03", // cannot_connect_now
+			"25006": // read_only_sql_transaction: connected to a demoted primary
+			return true
+		}
+		return pqErr.Code.Class() == "08" // connection_exception
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryConfig contains retry and circuit breaker configuration
+type RetryConfig struct {
+	// MaxAttempts is the number of times an operation is tried; 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry; it doubles with every retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+	// BreakerThreshold is the number of consecutive operations failing with transient
+	// errors that opens the circuit breaker; 0 disables the breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long the open breaker rejects operations before letting one
+	// through to test the database
+	BreakerCooldown time.Duration
+	// DegradedWindow is how long health stays degraded after a transient error
+	DegradedWindow time.Duration
+}
+
+// DefaultRetryConfig returns a default configuration
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:      4,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  10 * time.Second,
+		DegradedWindow:   time.Minute,
+	}
+}
+
+// Health statuses
+const (
+	// HealthOK means no transient errors were seen recently
+	HealthOK = "ok"
+	// HealthDegraded means operations needed retries or failed recently, but the
+	// database answers
+	HealthDegraded = "degraded"
+	// HealthUnavailable means the circuit breaker is open
+	HealthUnavailable = "unavailable"
+)
+
+// Health describes the connection health seen by a Retrier
+type Health struct {
+	Status              string     `json:"status"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Retries             int64      `json:"retries"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	// OpenUntil is when the open breaker lets the next operation through
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// Retrier retries database operations that fail with transient errors, with exponential
+// backoff, and stops sending operations to a database that keeps failing. A nil Retrier
+// runs operations once.
+type Retrier struct {
+	config RetryConfig
+	log    *logger.Logger
+	// ping tests the database for Health while the breaker is open
+	ping  func(ctx context.Context) error
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	lastErr   error
+	lastErrAt time.Time
+	retries   int64
+}
+
+// NewRetrier creates a new retrier
+func NewRetrier(config RetryConfig, log *logger.Logger) *Retrier {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &Retrier{
+		config: config,
+		log:    log,
+		sleep:  sleepContext,
+	}
+}
+
+// Do runs fn, retrying it while it fails with a transient error. When the retries run
+// out, or the breaker is open, it returns an *UnavailableError. fn must be safe to run
+// again after a transient error, e.g. a query or a transaction that was rolled back.
+func (r *Retrier) Do(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	if r == nil {
+		return fn(ctx)
+	}
+	if wait := r.openFor(); wait > 0 {
+		return &UnavailableError{Operation: operation, RetryAfter: wait}
+	}
+
+	backoff := r.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			r.succeeded()
+			return nil
+		}
+		if !IsTransient(err) {
+			// The database answered; the caller's context ending says nothing about it
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				r.succeeded()
+			}
+			return err
+		}
+
+		var noRetry *noRetryError
+		if errors.As(err, &noRetry) || attempt >= r.config.MaxAttempts || ctx.Err() != nil {
+			return r.failed(operation, err)
+		}
+		r.log.Warn("Retrying database operation after a transient error",
+			"operation", operation, "attempt", attempt, "backoff", backoff, "error", err)
+		r.mu.Lock()
+		r.retries++
+		r.lastErr, r.lastErrAt = err, time.Now()
+		r.mu.Unlock()
+		if err := r.sleep(ctx, jitter(backoff)); err != nil {
+			return r.failed(operation, err)
+		}
+		if backoff *= 2; backoff > r.config.MaxBackoff {
+			backoff = r.config.MaxBackoff
+		}
+	}
+}
+
+// openFor returns how long the breaker still rejects operations
+func (r *Retrier) openFor() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Until(r.openUntil)
+}
+
+func (r *Retrier) succeeded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures >= r.config.BreakerThreshold && r.config.BreakerThreshold > 0 {
+		r.log.Info("Database is reachable again, closing circuit breaker")
+	}
+	r.failures = 0
+	r.openUntil = time.Time{}
+}
+
+// failed records an operation that ran out of retries, opening the breaker once enough
+// operations failed in a row
+func (r *Retrier) failed(operation string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures++
+	r.lastErr, r.lastErrAt = err, time.Now()
+	retryAfter := r.config.BreakerCooldown
+	if r.config.BreakerThreshold > 0 && r.failures >= r.config.BreakerThreshold {
+		if r.openUntil.IsZero() || time.Now().After(r.openUntil) {
+			r.log.Error("Database unavailable, opening circuit breaker",
+				"operation", operation, "failures", r.failures, "cooldown", r.config.BreakerCooldown, "error", err)
+		}
+		r.openUntil = time.Now().Add(r.config.BreakerCooldown)
+	} else {
+		r.log.Error("Database operation failed after retries", "operation", operation, "error", err)
+	}
+	return &UnavailableError{Operation: operation, Err: err, RetryAfter: retryAfter}
+}
+
+// Health reports the connection health. While the breaker is open and its cooldown has
+// passed, the database is pinged so health recovers without waiting for traffic.
+func (r *Retrier) Health(ctx context.Context) Health {
+	if r == nil {
+		return Health{Status: HealthOK}
+	}
+	r.mu.Lock()
+	probe := r.ping != nil && r.config.BreakerThreshold > 0 && r.failures >= r.config.BreakerThreshold && !time.Now().Before(r.openUntil)
+	r.mu.Unlock()
+	if probe {
+		_ = r.Do(ctx, "ping", r.ping)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	health := Health{Status: HealthOK, ConsecutiveFailures: r.failures, Retries: r.retries}
+	if r.lastErr != nil {
+		lastErrAt := r.lastErrAt
+		health.LastError = r.lastErr.Error()
+		health.LastErrorAt = &lastErrAt
+		if time.Since(r.lastErrAt) < r.config.DegradedWindow {
+			health.Status = HealthDegraded
+		}
+	}
+	if r.config.BreakerThreshold > 0 && r.failures >= r.config.BreakerThreshold {
+		openUntil := r.openUntil
+		health.Status = HealthUnavailable
+		health.OpenUntil = &openUntil
+	}
+	return health
+}
+
+// jitter spreads retries of concurrent requests over [d/2, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
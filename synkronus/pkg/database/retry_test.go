@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func newTestRetrier(config RetryConfig) (*Retrier, *[]time.Duration) {
+	r := NewRetrier(config, logger.NewLogger())
+	var sleeps []time.Duration
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return r, &sleeps
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("syntax error"), false},
+		{fmt.Errorf("query failed: %w", syscall.ECONNREFUSED), true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "25006"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, expected %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetrierDo_RetriesTransientErrors(t *testing.T) {
+	r, sleeps := newTestRetrier(DefaultRetryConfig())
+	calls := 0
+	err := r.Do(context.Background(), "test", func(ctx context.Context) error {
+		if calls++; calls < 3 {
+			return syscall.ECONNRESET
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if calls != 3 || len(*sleeps) != 2 {
+		t.Fatalf("Expected 3 calls and 2 backoffs, got %d and %d", calls, len(*sleeps))
+	}
+	if s := (*sleeps)[1]; s < 100*time.Millisecond || s >= 200*time.Millisecond {
+		t.Errorf("Expected the second backoff in [100ms, 200ms), got %v", s)
+	}
+	if health := r.Health(context.Background()); health.Status != HealthDegraded || health.Retries != 2 {
+		t.Errorf("Expected degraded health with 2 retries, got %+v", health)
+	}
+}
+
+func TestRetrierDo_DoesNotRetry(t *testing.T) {
+	r, _ := newTestRetrier(DefaultRetryConfig())
+
+	calls := 0
+	constraint := &pq.Error{Code: "23505"}
+	if err := r.Do(context.Background(), "test", func(ctx context.Context) error { calls++; return constraint }); err != constraint {
+		t.Errorf("Expected the error itself, got %v", err)
+	}
+
+	err := r.Do(context.Background(), "test", func(ctx context.Context) error {
+		calls++
+		return NoRetry(fmt.Errorf("commit: %w", syscall.ECONNRESET))
+	})
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Expected an unavailable error wrapping the cause, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected each operation to run once, got %d calls", calls)
+	}
+}
+
+func TestRetrierDo_CircuitBreaker(t *testing.T) {
+	config := DefaultRetryConfig()
+	config.MaxAttempts = 2
+	config.BreakerThreshold = 2
+	r, _ := newTestRetrier(config)
+	pinged := false
+	r.ping = func(ctx context.Context) error { pinged = true; return nil }
+
+	calls := 0
+	failing := func(ctx context.Context) error { calls++; return syscall.ECONNREFUSED }
+	for i := 0; i < 2; i++ {
+		if err := r.Do(context.Background(), "test", failing); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Expected an unavailable error, got %v", err)
+		}
+	}
+	if calls != 4 {
+		t.Fatalf("Expected 4 calls, got %d", calls)
+	}
+
+	// The open breaker rejects operations without running them
+	var unavailable *UnavailableError
+	err := r.Do(context.Background(), "test", failing)
+	if !errors.As(err, &unavailable) || unavailable.Err != nil || unavailable.RetryAfter <= 0 || calls != 4 {
+		t.Fatalf("Expected the breaker to reject the operation, got %v after %d calls", err, calls)
+	}
+	if health := r.Health(context.Background()); health.Status != HealthUnavailable || health.OpenUntil == nil || pinged {
+		t.Errorf("Expected unavailable health without a ping, got %+v", health)
+	}
+
+	// Once the cooldown passed, health pings the database and the breaker closes
+	r.mu.Lock()
+	r.openUntil = time.Now().Add(-time.Second)
+	r.mu.Unlock()
+	if health := r.Health(context.Background()); health.Status != HealthDegraded || health.ConsecutiveFailures != 0 || !pinged {
+		t.Errorf("Expected the ping to close the breaker, got %+v", health)
+	}
+	if err := r.Do(context.Background(), "test", func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected operations to run again, got %v", err)
+	}
+}
+
+func TestRetrierDo_Nil(t *testing.T) {
+	var r *Retrier
+	calls := 0
+	err := r.Do(context.Background(), "test", func(ctx context.Context) error { calls++; return syscall.ECONNRESET })
+	if !errors.Is(err, syscall.ECONNRESET) || calls != 1 {
+		t.Errorf("Expected a nil retrier to run the operation once, got %v after %d calls", err, calls)
+	}
+	if health := r.Health(context.Background()); health.Status != HealthOK {
+		t.Errorf("Expected ok health, got %+v", health)
+	}
+}
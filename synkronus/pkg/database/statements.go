@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Querier runs statements on a database, a transaction or a StatementCache
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// StatementCache runs queries as prepared statements, preparing each query text once and
+// reusing the statement for later calls. database/sql prepares a statement again on every
+// connection it runs on, so the cache saves the parse and plan of hot queries on every
+// connection of the pool.
+//
+// The cache holds at most size statements; further query texts run unprepared, so a
+// caller building queries from unbounded input can't exhaust server resources. Statements
+// are kept until Close.
+type StatementCache struct {
+	db   *sql.DB
+	size int
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// NewStatementCache creates a cache of up to size prepared statements on db. A size of 0
+// or less returns nil, which callers treat as running queries unprepared.
+func NewStatementCache(db *sql.DB, size int) *StatementCache {
+	if size <= 0 {
+		return nil
+	}
+	return &StatementCache{db: db, size: size, stmts: make(map[string]*sql.Stmt)}
+}
+
+// statement returns the prepared statement of query; nil when the cache is full or the
+// query can't be prepared, in which case it runs unprepared and reports its own error
+func (c *StatementCache) statement(ctx context.Context, query string) *sql.Stmt {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= c.size
+	c.mu.Unlock()
+	if ok {
+		return stmt
+	}
+	if full {
+		return nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.stmts[query]; ok {
+		// Another caller prepared it meanwhile
+		stmt.Close()
+		return existing
+	}
+	if len(c.stmts) >= c.size {
+		stmt.Close()
+		return nil
+	}
+	c.stmts[query] = stmt
+	return stmt
+}
+
+// Len returns the number of cached statements
+func (c *StatementCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.stmts)
+}
+
+// ExecContext implements Querier
+func (c *StatementCache) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := c.statement(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+// QueryContext implements Querier
+func (c *StatementCache) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := c.statement(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements Querier
+func (c *StatementCache) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := c.statement(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+// Tx returns a Querier running the cached statements in tx
+func (c *StatementCache) Tx(tx *sql.Tx) Querier {
+	return &txStatements{cache: c, tx: tx}
+}
+
+// Close closes the cached statements
+func (c *StatementCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.stmts, query)
+	}
+	return firstErr
+}
+
+// txStatements runs the statements of a cache in a transaction
+type txStatements struct {
+	cache *StatementCache
+	tx    *sql.Tx
+}
+
+// ExecContext implements Querier
+func (t *txStatements) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := t.cache.statement(ctx, query); stmt != nil {
+		return t.tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	}
+	return t.tx.ExecContext(ctx, query, args...)
+}
+
+// QueryContext implements Querier
+func (t *txStatements) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := t.cache.statement(ctx, query); stmt != nil {
+		return t.tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+	}
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements Querier
+func (t *txStatements) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := t.cache.statement(ctx, query); stmt != nil {
+		return t.tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	}
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStatementCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	cache := NewStatementCache(db, 1)
+
+	// The first query is prepared once and reused
+	prepared := mock.ExpectPrepare(`SELECT current_version FROM sync_version`)
+	prepared.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(1)))
+	prepared.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(2)))
+	for want := int64(1); want <= 2; want++ {
+		var version int64
+		if err := cache.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&version); err != nil || version != want {
+			t.Fatalf("Expected version %d, got %d, %v", want, version, err)
+		}
+	}
+
+	// The cache is full, so other queries run unprepared
+	mock.ExpectExec(`UPDATE sync_version`).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := cache.ExecContext(ctx, "UPDATE sync_version SET current_version = current_version + 1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 cached statement, got %d", cache.Len())
+	}
+
+	// Transactions run the cached statement
+	mock.ExpectBegin()
+	prepared.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(3)))
+	mock.ExpectCommit()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	var version int64
+	if err := cache.Tx(tx).QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&version); err != nil || version != 3 {
+		t.Fatalf("Expected version 3, got %d, %v", version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	prepared.WillBeClosed()
+	if err := cache.Close(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	if NewStatementCache(db, 0) != nil {
+		t.Error("Expected a size of 0 to turn the cache off")
+	}
+}
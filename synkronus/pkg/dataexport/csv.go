@@ -0,0 +1,172 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ExportCSVZip exports observations data as a ZIP file containing a CSV file per form
+// type, with the columns of the Parquet export, for analysts without Arrow tooling
+func (s *service) ExportCSVZip(ctx context.Context) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.ExportCSVZip")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	formTypes, err := s.exportedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := s.exportEncryptor()
+	if err != nil {
+		return nil, err
+	}
+
+	zipBuffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(zipBuffer)
+	manifest := &ExportManifest{Format: "csv", Files: []ExportFile{}}
+
+	for _, formType := range formTypes {
+		file, err := s.exportFormTypeToCSV(ctx, formType, zipWriter, enc)
+		if err != nil {
+			zipWriter.Close()
+			return nil, fmt.Errorf("failed to export form type %s: %w", formType, err)
+		}
+		if file != nil {
+			manifest.Files = append(manifest.Files, *file)
+		}
+	}
+
+	if enc != nil && len(enc.manifest.Files) > 0 {
+		if err := writeEncryptionManifest(zipWriter, enc.manifest); err != nil {
+			zipWriter.Close()
+			return nil, err
+		}
+	}
+
+	if err := writeExportManifest(zipWriter, manifest); err != nil {
+		zipWriter.Close()
+		return nil, err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close ZIP writer: %w", err)
+	}
+	return io.NopCloser(bytes.NewReader(zipBuffer.Bytes())), nil
+}
+
+// exportFormTypeToCSV exports a single form type as a CSV file to the ZIP archive. It
+// returns nil when the form type has no observations.
+func (s *service) exportFormTypeToCSV(ctx context.Context, formType string, zipWriter *zip.Writer, enc *fieldEncryptor) (_ *ExportFile, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.exportFormType", attribute.String("dataexport.form_type", formType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	filename := s.sanitizeFilename(formType) + ".csv"
+	schema, observations, err := s.exportedRows(ctx, span, formType, filename, enc)
+	if err != nil {
+		return nil, err
+	}
+	if len(observations) == 0 {
+		return nil, nil
+	}
+
+	entry, err := createExportEntry(zipWriter, filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeCSVData(observations, schema, entry); err != nil {
+		return nil, fmt.Errorf("failed to write CSV data for %s: %w", formType, err)
+	}
+	return &ExportFile{FormType: formType, Path: filename, Rows: len(observations), Bytes: entry.bytes, SHA256: entry.sum()}, nil
+}
+
+// writeCSVData writes observations as CSV with a header row. The columns are those of
+// the Parquet schema; nulls are empty cells and nested values are JSON.
+func (s *service) writeCSVData(observations []ObservationRow, schema *FormTypeSchema, writer io.Writer) error {
+	fields := s.buildArrowSchema(schema).Fields()
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		header[i] = field.Name
+	}
+
+	w := csv.NewWriter(writer)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(header))
+	for _, obs := range observations {
+		row = row[:0]
+		syncedAt := ""
+		if obs.SyncedAt != nil {
+			syncedAt = *obs.SyncedAt
+		}
+		row = append(row,
+			obs.ObservationID,
+			obs.FormType,
+			obs.FormVersion,
+			obs.CreatedAt,
+			obs.UpdatedAt,
+			syncedAt,
+			strconv.FormatBool(obs.Deleted),
+			strconv.FormatInt(obs.Version, 10),
+			string(obs.Geolocation),
+		)
+		for _, col := range schema.Columns {
+			row = append(row, csvValue(col, obs.DataFields["data_"+col.Key]))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// csvValue formats a data field as a CSV cell. Values that don't fit the column type are
+// left empty, as they are null in the Parquet export.
+func csvValue(col FormTypeColumn, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if col.NestedType != nil {
+		decoded, ok := decodeNestedValue(value)
+		if !ok || decoded == nil {
+			return ""
+		}
+		data, err := json.Marshal(decoded)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+
+	switch col.SQLType {
+	case "numeric":
+		if v, ok := value.(float64); ok {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	case "boolean":
+		if v, ok := value.(bool); ok {
+			return strconv.FormatBool(v)
+		}
+		return ""
+	default:
+		if v, ok := value.(string); ok {
+			return v
+		}
+		return fmt.Sprintf("%v", value)
+	}
+}
@@ -0,0 +1,97 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func TestService_ExportCSVZip(t *testing.T) {
+	syncedAt := "2023-01-02T00:00:00Z"
+	db := &MockDatabaseInterface{
+		FormTypes: []string{"survey", "empty_form"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"survey": {
+				FormType: "survey",
+				Columns: []FormTypeColumn{
+					{Key: "comment", DataType: "string", SQLType: "text"},
+					{Key: "rating", DataType: "number", SQLType: "numeric"},
+					{Key: "consent", DataType: "boolean", SQLType: "boolean"},
+					{Key: "members", DataType: "array", SQLType: "text", NestedType: arrow.ListOf(arrow.BinaryTypes.String)},
+				},
+			},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"survey": {
+				{
+					ObservationID: "obs1", FormType: "survey", FormVersion: "1.0",
+					CreatedAt: "2023-01-01T00:00:00Z", UpdatedAt: "2023-01-01T00:00:00Z", SyncedAt: &syncedAt, Version: 1,
+					Geolocation: []byte(`{"latitude":1.5,"longitude":2.5}`),
+					DataFields: map[string]interface{}{
+						"data_comment": "Good, \"friendly\" service",
+						"data_rating":  4.5,
+						"data_consent": true,
+						"data_members": `["Ann","Bob"]`,
+					},
+				},
+				{
+					ObservationID: "obs2", FormType: "survey", FormVersion: "1.0",
+					CreatedAt: "2023-01-03T00:00:00Z", UpdatedAt: "2023-01-03T00:00:00Z", Deleted: true, Version: 2,
+					DataFields: map[string]interface{}{"data_rating": "not a number"},
+				},
+			},
+		},
+	}
+
+	zipReader, err := NewService(db, &config.Config{}).ExportCSVZip(context.Background())
+	if err != nil {
+		t.Fatalf("ExportCSVZip: %v", err)
+	}
+	defer zipReader.Close()
+	data, err := io.ReadAll(zipReader)
+	if err != nil {
+		t.Fatalf("Failed to read ZIP data: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open ZIP: %v", err)
+	}
+	if len(archive.File) != 2 || archive.File[0].Name != "survey.csv" || archive.File[1].Name != ExportManifestName {
+		t.Fatalf("Expected survey.csv and the export manifest, got %d files", len(archive.File))
+	}
+
+	f, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatalf("Failed to open survey.csv: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse survey.csv: %v", err)
+	}
+
+	want := [][]string{
+		{"observation_id", "form_type", "form_version", "created_at", "updated_at", "synced_at", "deleted", "version", "geolocation",
+			"data_comment", "data_rating", "data_consent", "data_members"},
+		{"obs1", "survey", "1.0", "2023-01-01T00:00:00Z", "2023-01-01T00:00:00Z", syncedAt, "false", "1", `{"latitude":1.5,"longitude":2.5}`,
+			`Good, "friendly" service`, "4.5", "true", `["Ann","Bob"]`},
+		{"obs2", "survey", "1.0", "2023-01-03T00:00:00Z", "2023-01-03T00:00:00Z", "", "true", "2", "",
+			"", "", "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d rows, got %d: %v", len(want), len(records), records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("Row %d column %s: expected %q, got %q", i, want[0][j], want[i][j], records[i][j])
+			}
+		}
+	}
+}
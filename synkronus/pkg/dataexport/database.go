@@ -3,6 +3,8 @@ package dataexport
 import (
 	"context"
 	"encoding/json"
+
+	"github.com/apache/arrow/go/v14/arrow"
 )
 
 // FormTypeColumn represents a column definition for a specific form type
@@ -10,6 +12,9 @@ type FormTypeColumn struct {
 	Key      string `json:"key"`
 	DataType string `json:"data_type"`
 	SQLType  string `json:"sql_type"`
+	// NestedType is the Arrow list/struct type used for array and object fields
+	// declared in the form schema; nil keeps the JSON text encoding
+	NestedType arrow.DataType `json:"-"`
 }
 
 // FormTypeSchema represents the schema for a specific form type
@@ -37,9 +42,14 @@ type DatabaseInterface interface {
 	// GetFormTypes returns all distinct form types in the observations table
 	GetFormTypes(ctx context.Context) ([]string, error)
 
+	// GetChangedFormTypes returns the distinct form types with observations changed in the
+	// version range, so incremental exports skip form types without changes
+	GetChangedFormTypes(ctx context.Context, versions VersionRange) ([]string, error)
+
 	// GetFormTypeSchema analyzes the JSON data structure for a form type and returns column definitions
 	GetFormTypeSchema(ctx context.Context, formType string) (*FormTypeSchema, error)
 
-	// GetObservationsForFormType returns all observations for a specific form type with flattened data
+	// GetObservationsForFormType returns all observations for a specific form type with flattened
+	// data, limited to the version range set with WithVersionRange
 	GetObservationsForFormType(ctx context.Context, formType string, schema *FormTypeSchema) ([]ObservationRow, error)
 }
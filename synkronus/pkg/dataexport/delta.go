@@ -0,0 +1,249 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DeltaManifestName is the name of the ZIP entry describing how to merge a delta export
+	DeltaManifestName = "delta_manifest.json"
+
+	// DeltaFormat identifies the layout of delta exports
+	DeltaFormat = "synkronus-delta/v1"
+
+	// DeltaOpColumn is the column of a changes file holding the operation of each row
+	DeltaOpColumn = "op"
+
+	// DeltaOpUpsert inserts the row's observation or replaces the stored one
+	DeltaOpUpsert = "upsert"
+
+	// DeltaOpDelete removes the row's observation
+	DeltaOpDelete = "delete"
+)
+
+// deltaInstructions explain in the manifest how to apply a delta export
+var deltaInstructions = []string{
+	"Start from the base snapshot at since_version: a full Parquet export whose X-Export-Version is since_version, or the result of merging the delta that ended there. With since_version 0 the base is empty.",
+	"Merge every file into the table of its form_type by key: rows whose op is delete remove the observation, rows whose op is upsert insert it or replace the stored one. merge_sql does this for a table named after the form type with the changes file loaded next to it.",
+	"An observation appears at most once per file, so rows can be applied in any order.",
+	"A changes file can have data_ columns the base table lacks, for fields added to the form since; add them to the base table first, empty for the stored observations.",
+	"Form types without changes have no file. The merged tables are at until_version, the since_version of the next delta.",
+}
+
+// DeltaManifest describes a delta export and how to merge it into a base snapshot
+type DeltaManifest struct {
+	Format string `json:"format"`
+	// SinceVersion is the version the base snapshot must be at
+	SinceVersion int64 `json:"since_version"`
+	// UntilVersion is the version the base snapshot is at once the delta is merged
+	UntilVersion int64     `json:"until_version"`
+	GeneratedAt  time.Time `json:"generated_at"`
+	// Key are the columns identifying an observation in the base and the changes files
+	Key []string `json:"key"`
+	// OpColumn holds DeltaOpUpsert or DeltaOpDelete for every row of the changes files
+	OpColumn     string      `json:"op_column"`
+	Files        []DeltaFile `json:"files"`
+	Instructions []string    `json:"instructions"`
+}
+
+// DeltaFile is the changes file of a form type in a delta export
+type DeltaFile struct {
+	FormType string `json:"form_type"`
+	// Path is the changes file in the delta export
+	Path string `json:"path"`
+	// Base is the form type's file in a full Parquet export
+	Base    string `json:"base"`
+	Upserts int    `json:"upserts"`
+	Deletes int    `json:"deletes"`
+	Bytes   int64  `json:"bytes"`
+	// SHA256 is the hex SHA-256 hash of the changes file
+	SHA256 string `json:"sha256"`
+	// MergeSQL merges the changes, loaded as a table named like Path without its extension,
+	// into a table named like Base without its extension
+	MergeSQL string `json:"merge_sql"`
+}
+
+// ExportDeltaZip exports the observations changed in the version range of ctx as a ZIP
+// file with a changes Parquet file per form type and a manifest describing the merge
+func (s *service) ExportDeltaZip(ctx context.Context) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.ExportDeltaZip")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	ctx = WithDeletions(ctx)
+	versions := VersionRangeOf(ctx)
+	span.SetAttributes(attribute.Int64("dataexport.since_version", versions.Since), attribute.Int64("dataexport.until_version", versions.Until))
+
+	formTypes, err := s.exportedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := s.exportEncryptor()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &DeltaManifest{
+		Format:       DeltaFormat,
+		SinceVersion: versions.Since,
+		UntilVersion: versions.Until,
+		GeneratedAt:  time.Now().UTC(),
+		Key:          []string{"observation_id"},
+		OpColumn:     DeltaOpColumn,
+		Files:        []DeltaFile{},
+		Instructions: deltaInstructions,
+	}
+
+	zipBuffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(zipBuffer)
+
+	for _, formType := range formTypes {
+		file, err := s.exportFormTypeDelta(ctx, formType, zipWriter, enc)
+		if err != nil {
+			zipWriter.Close()
+			return nil, fmt.Errorf("failed to export changes of form type %s: %w", formType, err)
+		}
+		if file != nil {
+			manifest.Files = append(manifest.Files, *file)
+		}
+	}
+
+	if enc != nil && len(enc.manifest.Files) > 0 {
+		if err := writeEncryptionManifest(zipWriter, enc.manifest); err != nil {
+			zipWriter.Close()
+			return nil, err
+		}
+	}
+
+	if err := writeDeltaManifest(zipWriter, manifest); err != nil {
+		zipWriter.Close()
+		return nil, err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close ZIP writer: %w", err)
+	}
+
+	return io.NopCloser(bytes.NewReader(zipBuffer.Bytes())), nil
+}
+
+// exportFormTypeDelta writes the changes file of a form type to the ZIP archive. It
+// returns nil when the form type has no changes.
+func (s *service) exportFormTypeDelta(ctx context.Context, formType string, zipWriter *zip.Writer, enc *fieldEncryptor) (_ *DeltaFile, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.exportFormTypeDelta", attribute.String("dataexport.form_type", formType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	table := s.sanitizeFilename(formType)
+	file := &DeltaFile{FormType: formType, Path: table + "_changes.parquet", Base: table + ".parquet"}
+
+	schema, observations, err := s.exportedRows(ctx, span, formType, file.Path, enc)
+	if err != nil || len(observations) == 0 {
+		return nil, err
+	}
+
+	// Deleted observations only carry their key and metadata
+	ops := make([]string, len(observations))
+	for i := range observations {
+		if observations[i].Deleted {
+			ops[i] = DeltaOpDelete
+			observations[i].DataFields = nil
+			observations[i].Geolocation = nil
+			file.Deletes++
+		} else {
+			ops[i] = DeltaOpUpsert
+			file.Upserts++
+		}
+	}
+
+	arrowSchema := s.buildArrowSchema(schema)
+	record, err := s.buildArrowRecord(observations, schema, arrowSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Arrow record: %w", err)
+	}
+	defer record.Release()
+
+	changes := withOpColumn(record, ops)
+	defer changes.Release()
+
+	entry, err := createExportEntry(zipWriter, file.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeParquetRecord(changes, entry); err != nil {
+		return nil, fmt.Errorf("failed to write parquet data for %s: %w", formType, err)
+	}
+	file.Bytes = entry.bytes
+	file.SHA256 = entry.sum()
+
+	file.MergeSQL = deltaMergeSQL(table, table+"_changes", arrowSchema)
+	return file, nil
+}
+
+// withOpColumn returns record with the op column in front
+func withOpColumn(record arrow.Record, ops []string) arrow.Record {
+	builder := array.NewStringBuilder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(ops, nil)
+	opArray := builder.NewArray()
+	defer opArray.Release()
+
+	fields := append([]arrow.Field{{Name: DeltaOpColumn, Type: arrow.BinaryTypes.String, Nullable: false}}, record.Schema().Fields()...)
+	columns := append([]arrow.Array{opArray}, record.Columns()...)
+	return array.NewRecord(arrow.NewSchema(fields, nil), columns, record.NumRows())
+}
+
+// deltaMergeSQL returns a MERGE statement applying the changes table to the base table
+func deltaMergeSQL(base, changes string, arrowSchema *arrow.Schema) string {
+	var columns, values, updates []string
+	for _, field := range arrowSchema.Fields() {
+		column := quoteDuckDBIdent(field.Name)
+		columns = append(columns, column)
+		values = append(values, "c."+column)
+		if field.Name != "observation_id" {
+			updates = append(updates, column+" = c."+column)
+		}
+	}
+
+	return fmt.Sprintf(`MERGE INTO %s AS t USING %s AS c ON t."observation_id" = c."observation_id" `+
+		`WHEN MATCHED AND c.%s = '%s' THEN DELETE `+
+		`WHEN MATCHED THEN UPDATE SET %s `+
+		`WHEN NOT MATCHED AND c.%s = '%s' THEN INSERT (%s) VALUES (%s)`,
+		quoteDuckDBIdent(base), quoteDuckDBIdent(changes),
+		quoteDuckDBIdent(DeltaOpColumn), DeltaOpDelete,
+		strings.Join(updates, ", "),
+		quoteDuckDBIdent(DeltaOpColumn), DeltaOpUpsert, strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// writeDeltaManifest adds the delta manifest to the ZIP archive
+func writeDeltaManifest(zipWriter *zip.Writer, manifest *DeltaManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal delta manifest: %w", err)
+	}
+
+	entry, err := createExportEntry(zipWriter, DeltaManifestName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write delta manifest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+// deltaMockDB records whether deleted observations were requested
+type deltaMockDB struct {
+	MockDatabaseInterface
+	deletions bool
+}
+
+func (m *deltaMockDB) GetFormTypes(ctx context.Context) ([]string, error) {
+	m.deletions = DeletionsIncluded(ctx)
+	return m.MockDatabaseInterface.GetFormTypes(ctx)
+}
+
+func (m *deltaMockDB) GetChangedFormTypes(ctx context.Context, versions VersionRange) ([]string, error) {
+	m.deletions = DeletionsIncluded(ctx)
+	return m.MockDatabaseInterface.GetChangedFormTypes(ctx, versions)
+}
+
+func TestService_ExportDeltaZip(t *testing.T) {
+	db := &deltaMockDB{MockDatabaseInterface: MockDatabaseInterface{
+		FormTypes: []string{"survey", "visit"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"survey": {FormType: "survey", Columns: []FormTypeColumn{{Key: "name", SQLType: "text"}}},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"survey": {
+				{ObservationID: "obs1", FormType: "survey", FormVersion: "1", Version: 12, DataFields: map[string]interface{}{"data_name": "Ann"}},
+				{ObservationID: "obs2", FormType: "survey", FormVersion: "1", Version: 14, Deleted: true, DataFields: map[string]interface{}{"data_name": "Bob"}},
+			},
+		},
+	}}
+	svc := NewService(db, &config.Config{})
+
+	ctx := WithVersionRange(context.Background(), VersionRange{Since: 10, Until: 20})
+	rc, err := svc.ExportDeltaZip(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer rc.Close()
+	if !db.deletions {
+		t.Error("Expected the delta export to include deleted observations")
+	}
+
+	zipData, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Failed to read ZIP data: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		t.Fatalf("Failed to parse ZIP file: %v", err)
+	}
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		entries[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	if len(entries) != 2 || entries["survey_changes.parquet"] == nil || entries[DeltaManifestName] == nil {
+		t.Fatalf("Expected survey_changes.parquet and the manifest, got %d entries", len(entries))
+	}
+
+	var manifest DeltaManifest
+	if err := json.Unmarshal(entries[DeltaManifestName], &manifest); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if manifest.Format != DeltaFormat || manifest.SinceVersion != 10 || manifest.UntilVersion != 20 || manifest.OpColumn != "op" {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if len(manifest.Files) != 1 {
+		t.Fatalf("Expected one changes file, got %+v", manifest.Files)
+	}
+	changes := manifest.Files[0]
+	if changes.Path != "survey_changes.parquet" || changes.Base != "survey.parquet" || changes.Upserts != 1 || changes.Deletes != 1 {
+		t.Errorf("Unexpected changes file %+v", changes)
+	}
+	for _, want := range []string{`MERGE INTO "survey" AS t USING "survey_changes" AS c`, `WHEN MATCHED AND c."op" = 'delete' THEN DELETE`, `"data_name" = c."data_name"`} {
+		if !strings.Contains(changes.MergeSQL, want) {
+			t.Errorf("Expected merge_sql to contain %s, got %s", want, changes.MergeSQL)
+		}
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(entries["survey_changes.parquet"]))
+	if err != nil {
+		t.Fatalf("Failed to open parquet file: %v", err)
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("Failed to create arrow reader: %v", err)
+	}
+	table, err := fr.ReadTable(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read table: %v", err)
+	}
+	defer table.Release()
+
+	schema := table.Schema()
+	if schema.Field(0).Name != "op" || schema.Field(1).Name != "observation_id" {
+		t.Fatalf("Expected op in front of the export columns, got %v", schema)
+	}
+	ops := table.Column(0).Data().Chunk(0).(*array.String)
+	names := table.Column(schema.FieldIndices("data_name")[0]).Data().Chunk(0).(*array.String)
+	if ops.Value(0) != "upsert" || names.Value(0) != "Ann" {
+		t.Errorf("Expected obs1 to be upserted with its data, got %s %q", ops.Value(0), names.Value(0))
+	}
+	if ops.Value(1) != "delete" || !names.IsNull(1) {
+		t.Errorf("Expected obs2 to be deleted without its data, got %s %q", ops.Value(1), names.Value(1))
+	}
+}
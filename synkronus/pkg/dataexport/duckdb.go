@@ -0,0 +1,318 @@
+package dataexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrDuckDBUnavailable is returned by ExportDuckDB when the server was built without
+// DuckDB support (build tag duckdb, requires cgo)
+var ErrDuckDBUnavailable = errors.New("DuckDB export is not available in this build")
+
+// duckDBWriter writes observation tables into a DuckDB database file
+type duckDBWriter interface {
+	// WriteTable creates the table with its indexes and inserts the observations
+	WriteTable(ctx context.Context, table duckDBTable, observations []ObservationRow) error
+	Close() error
+}
+
+// openDuckDB opens a new database file for writing. It is set by duckdb_writer.go
+// when the server is built with DuckDB support and nil otherwise.
+var openDuckDB func(path string) (duckDBWriter, error)
+
+// Formats returns the export formats this build serves under /dataexport; duckdb is only
+// listed when the server was built with DuckDB support
+func Formats() []string {
+	formats := []string{"parquet", "csv", "delta", "fhir"}
+	if openDuckDB != nil {
+		formats = append(formats, "duckdb")
+	}
+	return formats
+}
+
+// duckDBIdentPattern matches the characters replaced in table and column names
+var duckDBIdentPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// duckDBBaseColumns are the observation columns present in every table
+var duckDBBaseColumns = []string{
+	`"observation_id" VARCHAR NOT NULL`,
+	`"form_type" VARCHAR NOT NULL`,
+	`"form_version" VARCHAR NOT NULL`,
+	`"created_at" TIMESTAMPTZ NOT NULL`,
+	`"updated_at" TIMESTAMPTZ`,
+	`"synced_at" TIMESTAMPTZ`,
+	`"deleted" BOOLEAN NOT NULL`,
+	`"version" BIGINT NOT NULL`,
+	`"geolocation" VARCHAR`,
+}
+
+// duckDBTable describes the table of one form type
+type duckDBTable struct {
+	Name    string
+	Schema  *FormTypeSchema
+	Columns []string // Data column names, in schema column order
+}
+
+// newDuckDBTable names the table and data columns of a form type. Names are
+// unique case-insensitively, as DuckDB identifiers are.
+func newDuckDBTable(formType string, schema *FormTypeSchema, taken map[string]bool) duckDBTable {
+	table := duckDBTable{
+		Name:    uniqueDuckDBName(duckDBIdentPattern.ReplaceAllString(formType, "_"), taken),
+		Schema:  schema,
+		Columns: make([]string, len(schema.Columns)),
+	}
+
+	columns := map[string]bool{}
+	for _, base := range []string{"observation_id", "form_type", "form_version", "created_at", "updated_at", "synced_at", "deleted", "version", "geolocation"} {
+		columns[base] = true
+	}
+	for i, col := range schema.Columns {
+		table.Columns[i] = uniqueDuckDBName("data_"+col.Key, columns)
+	}
+	return table
+}
+
+// uniqueDuckDBName returns name, with a numeric suffix if it is already taken, and
+// marks the result as taken
+func uniqueDuckDBName(name string, taken map[string]bool) string {
+	if name == "" {
+		name = "_"
+	}
+	unique := name
+	for i := 2; taken[strings.ToLower(unique)]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	taken[strings.ToLower(unique)] = true
+	return unique
+}
+
+// Statements returns the DDL creating the table and its indexes
+func (t duckDBTable) Statements() []string {
+	defs := append([]string{}, duckDBBaseColumns...)
+	for i, col := range t.Schema.Columns {
+		defs = append(defs, fmt.Sprintf("%s %s", quoteDuckDBIdent(t.Columns[i]), duckDBColumnType(col)))
+	}
+
+	table := quoteDuckDBIdent(t.Name)
+	return []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(defs, ", ")),
+		fmt.Sprintf("CREATE INDEX %s ON %s (observation_id)", quoteDuckDBIdent("idx_"+t.Name+"_observation_id"), table),
+		fmt.Sprintf("CREATE INDEX %s ON %s (created_at)", quoteDuckDBIdent("idx_"+t.Name+"_created_at"), table),
+	}
+}
+
+// InsertStatement returns the parameterized INSERT for one row of the table
+func (t duckDBTable) InsertStatement() string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(duckDBBaseColumns)+len(t.Columns)), ", ")
+	return fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteDuckDBIdent(t.Name), placeholders)
+}
+
+// RowValues converts an observation into the values of one row of the table
+func (t duckDBTable) RowValues(obs ObservationRow) ([]interface{}, error) {
+	createdAt, err := parseExportTime(obs.CreatedAt)
+	if err != nil || createdAt == nil {
+		return nil, fmt.Errorf("invalid created_at %q for observation %s", obs.CreatedAt, obs.ObservationID)
+	}
+	updatedAt, err := parseExportTime(obs.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid updated_at %q for observation %s", obs.UpdatedAt, obs.ObservationID)
+	}
+	var syncedAt interface{}
+	if obs.SyncedAt != nil {
+		if syncedAt, err = parseExportTime(*obs.SyncedAt); err != nil {
+			return nil, fmt.Errorf("invalid synced_at %q for observation %s", *obs.SyncedAt, obs.ObservationID)
+		}
+	}
+	var geolocation interface{}
+	if obs.Geolocation != nil {
+		geolocation = string(obs.Geolocation)
+	}
+
+	values := []interface{}{
+		obs.ObservationID, obs.FormType, obs.FormVersion,
+		createdAt, updatedAt, syncedAt,
+		obs.Deleted, obs.Version, geolocation,
+	}
+	for _, col := range t.Schema.Columns {
+		values = append(values, duckDBValue(col, obs.DataFields["data_"+col.Key]))
+	}
+	return values, nil
+}
+
+// duckDBColumnType maps a form field to a DuckDB column type. Dates with unknown
+// parts (adate), arrays and objects are kept as text.
+func duckDBColumnType(col FormTypeColumn) string {
+	switch col.SQLType {
+	case "numeric":
+		return "DOUBLE"
+	case "boolean":
+		return "BOOLEAN"
+	default:
+		return "VARCHAR"
+	}
+}
+
+// duckDBValue converts a flattened field value to the column's type; values that
+// don't fit become NULL
+func duckDBValue(col FormTypeColumn, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	switch col.SQLType {
+	case "numeric":
+		switch v := value.(type) {
+		case float64:
+			return v
+		case int64:
+			return float64(v)
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+		return nil
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		}
+		return nil
+	default:
+		if v, ok := value.(string); ok {
+			return v
+		}
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// parseExportTime parses an observation timestamp; empty yields nil
+func parseExportTime(value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+	return t.UTC(), nil
+}
+
+// quoteDuckDBIdent quotes a table or column name
+func quoteDuckDBIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// ExportDuckDB exports observations as a DuckDB database file with one table per
+// form type
+func (s *service) ExportDuckDB(ctx context.Context) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.ExportDuckDB")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if openDuckDB == nil {
+		return nil, ErrDuckDBUnavailable
+	}
+
+	formTypes, err := s.exportedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "synkronus-duckdb-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	path := filepath.Join(dir, "observations.duckdb")
+	writer, err := openDuckDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DuckDB database: %w", err)
+	}
+
+	taken := map[string]bool{}
+	for _, formType := range formTypes {
+		if err := s.exportFormTypeToDuckDB(ctx, formType, writer, taken); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("failed to export form type %s: %w", formType, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close DuckDB database: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tempFileReader{File: file, dir: dir}, nil
+}
+
+// exportFormTypeToDuckDB writes the table of a single form type
+func (s *service) exportFormTypeToDuckDB(ctx context.Context, formType string, writer duckDBWriter, taken map[string]bool) (err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.exportFormTypeToDuckDB", attribute.String("dataexport.form_type", formType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	schema, err := s.exportedSchema(ctx, formType)
+	if err != nil {
+		return err
+	}
+
+	// As with FHIR, encrypted values have no place in typed columns, so sensitive
+	// fields are left out unless the caller may see them in plain text
+	if redactSensitive(ctx) || (s.config != nil && s.config.ExportPublicKeyPath != "") {
+		sensitive, err := s.sensitiveFields(formType)
+		if err != nil {
+			return err
+		}
+		schema = redactColumns(schema, sensitive)
+	}
+
+	observations, err := s.db.GetObservationsForFormType(ctx, formType, schema)
+	if err != nil {
+		return fmt.Errorf("failed to get observations for form type %s: %w", formType, err)
+	}
+	span.SetAttributes(attribute.Int("dataexport.row_count", len(observations)))
+
+	if len(observations) == 0 {
+		return nil
+	}
+
+	return writer.WriteTable(ctx, newDuckDBTable(formType, schema, taken), observations)
+}
+
+// tempFileReader reads an export file and removes its temporary directory on Close
+type tempFileReader struct {
+	*os.File
+	dir string
+}
+
+func (r *tempFileReader) Close() error {
+	err := r.File.Close()
+	os.RemoveAll(r.dir)
+	return err
+}
@@ -0,0 +1,179 @@
+package dataexport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/config"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// recordingDuckDBWriter keeps the written tables instead of creating a database
+type recordingDuckDBWriter struct {
+	path   string
+	tables []duckDBTable
+	rows   map[string][][]interface{}
+	closed bool
+}
+
+func (w *recordingDuckDBWriter) WriteTable(ctx context.Context, table duckDBTable, observations []ObservationRow) error {
+	for _, obs := range observations {
+		values, err := table.RowValues(obs)
+		if err != nil {
+			return err
+		}
+		w.rows[table.Name] = append(w.rows[table.Name], values)
+	}
+	w.tables = append(w.tables, table)
+	return nil
+}
+
+func (w *recordingDuckDBWriter) Close() error {
+	w.closed = true
+	return os.WriteFile(w.path, []byte("duckdb"), 0644)
+}
+
+// useRecordingDuckDB replaces the DuckDB driver for the duration of the test
+func useRecordingDuckDB(t *testing.T) *recordingDuckDBWriter {
+	t.Helper()
+	writer := &recordingDuckDBWriter{rows: map[string][][]interface{}{}}
+	previous := openDuckDB
+	openDuckDB = func(path string) (duckDBWriter, error) {
+		writer.path = path
+		return writer, nil
+	}
+	t.Cleanup(func() { openDuckDB = previous })
+	return writer
+}
+
+func TestService_ExportDuckDB(t *testing.T) {
+	writer := useRecordingDuckDB(t)
+	syncedAt := "2025-01-02T10:05:00.5+02:00"
+	mockDB := &MockDatabaseInterface{
+		FormTypes: []string{"anc-visit", "empty"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"anc-visit": {FormType: "anc-visit", Columns: []FormTypeColumn{
+				{Key: "Name", DataType: "string", SQLType: "text"},
+				{Key: "name", DataType: "string", SQLType: "text"},
+				{Key: "weight", DataType: "number", SQLType: "numeric"},
+				{Key: "pregnant", DataType: "boolean", SQLType: "boolean"},
+				{Key: "lmp", DataType: "string", SQLType: "adate"},
+			}},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"anc-visit": {{
+				ObservationID: "obs1",
+				FormType:      "anc-visit",
+				FormVersion:   "1.0",
+				CreatedAt:     "2025-01-02T10:00:00Z",
+				UpdatedAt:     "2025-01-02T11:00:00Z",
+				SyncedAt:      &syncedAt,
+				Version:       3,
+				Geolocation:   []byte(`{"latitude":1}`),
+				DataFields: map[string]interface{}{
+					"data_Name":     "Amina",
+					"data_weight":   []byte("61.5"),
+					"data_pregnant": true,
+					"data_lmp":      "2024-??-10",
+				},
+			}},
+		},
+	}
+
+	svc := NewService(mockDB, &config.Config{})
+	reader, err := svc.ExportDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("ExportDuckDB failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	if string(data) != "duckdb" {
+		t.Errorf("Expected the database file contents, got %q", data)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(writer.path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary directory to be removed, got %v", err)
+	}
+
+	// Form types without observations get no table
+	if len(writer.tables) != 1 {
+		t.Fatalf("Expected 1 table, got %d", len(writer.tables))
+	}
+	table := writer.tables[0]
+	if table.Name != "anc_visit" {
+		t.Errorf("Expected table anc_visit, got %s", table.Name)
+	}
+	if got := strings.Join(table.Columns, ","); got != "data_Name,data_name_2,data_weight,data_pregnant,data_lmp" {
+		t.Errorf("Unexpected column names %s", got)
+	}
+
+	statements := table.Statements()
+	for _, want := range []string{`"data_weight" DOUBLE`, `"data_pregnant" BOOLEAN`, `"data_lmp" VARCHAR`, `"created_at" TIMESTAMPTZ NOT NULL`} {
+		if !strings.Contains(statements[0], want) {
+			t.Errorf("Expected %q in %s", want, statements[0])
+		}
+	}
+	if len(statements) != 3 || !strings.Contains(statements[1], "(observation_id)") || !strings.Contains(statements[2], "(created_at)") {
+		t.Errorf("Expected indexes on observation_id and created_at, got %v", statements[1:])
+	}
+
+	row := writer.rows["anc_visit"][0]
+	if len(row) != len(duckDBBaseColumns)+len(table.Columns) {
+		t.Fatalf("Expected %d values, got %d", len(duckDBBaseColumns)+len(table.Columns), len(row))
+	}
+	if got := row[5].(time.Time); !got.Equal(time.Date(2025, 1, 2, 8, 5, 0, 5e8, time.UTC)) {
+		t.Errorf("Unexpected synced_at %v", got)
+	}
+	if row[8] != `{"latitude":1}` {
+		t.Errorf("Unexpected geolocation %v", row[8])
+	}
+	expected := []interface{}{"Amina", nil, 61.5, true, "2024-??-10"}
+	for i, want := range expected {
+		if row[9+i] != want {
+			t.Errorf("Column %s: expected %v, got %v", table.Columns[i], want, row[9+i])
+		}
+	}
+}
+
+func TestService_ExportDuckDB_RedactsSensitiveFields(t *testing.T) {
+	writer := useRecordingDuckDB(t)
+	dir := t.TempDir()
+	writeFHIRBundle(t, dir, "anc_visit", "")
+
+	mockDB := newFHIRTestDB()
+	mockDB.FormTypes = []string{"anc_visit"}
+	svc := NewService(mockDB, &config.Config{AppBundlePath: dir})
+	user := &models.User{Username: "viewer", Role: models.RoleReadOnly}
+	ctx := context.WithValue(context.Background(), authmw.UserKey, user)
+
+	reader, err := svc.ExportDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("ExportDuckDB failed: %v", err)
+	}
+	reader.Close()
+
+	for _, column := range writer.tables[0].Columns {
+		if column == "data_national_id" {
+			t.Errorf("Expected sensitive column to be omitted for non-admins")
+		}
+	}
+}
+
+func TestService_ExportDuckDB_Unavailable(t *testing.T) {
+	previous := openDuckDB
+	openDuckDB = nil
+	defer func() { openDuckDB = previous }()
+
+	svc := NewService(&MockDatabaseInterface{}, &config.Config{})
+	if _, err := svc.ExportDuckDB(context.Background()); !errors.Is(err, ErrDuckDBUnavailable) {
+		t.Errorf("Expected ErrDuckDBUnavailable, got %v", err)
+	}
+}
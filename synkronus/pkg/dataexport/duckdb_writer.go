@@ -0,0 +1,81 @@
+//go:build duckdb && cgo
+
+package dataexport
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/marcboeker/go-duckdb" // DuckDB driver
+)
+
+func init() {
+	openDuckDB = openDuckDBFile
+}
+
+// sqlDuckDBWriter writes tables through the go-duckdb database/sql driver
+type sqlDuckDBWriter struct {
+	db *sql.DB
+}
+
+// openDuckDBFile creates a DuckDB database at path
+func openDuckDBFile(path string) (duckDBWriter, error) {
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlDuckDBWriter{db: db}, nil
+}
+
+// WriteTable creates the table with its indexes and inserts the observations in
+// a single transaction
+func (w *sqlDuckDBWriter) WriteTable(ctx context.Context, table duckDBTable, observations []ObservationRow) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Indexes are created after loading, which is much faster in DuckDB
+	statements := table.Statements()
+	if _, err := tx.ExecContext(ctx, statements[0]); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table.Name, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, table.InsertStatement())
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into %s: %w", table.Name, err)
+	}
+	defer stmt.Close()
+
+	for _, obs := range observations {
+		values, err := table.RowValues(obs)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to insert observation %s: %w", obs.ObservationID, err)
+		}
+	}
+
+	for _, statement := range statements[1:] {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to index table %s: %w", table.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Close checkpoints and closes the database file
+func (w *sqlDuckDBWriter) Close() error {
+	if _, err := w.db.Exec("CHECKPOINT"); err != nil {
+		w.db.Close()
+		return err
+	}
+	return w.db.Close()
+}
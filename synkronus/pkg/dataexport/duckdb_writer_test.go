@@ -0,0 +1,65 @@
+//go:build duckdb && cgo
+
+package dataexport
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func TestService_ExportDuckDB_File(t *testing.T) {
+	mockDB := newFHIRTestDB()
+	mockDB.FormTypes = []string{"anc_visit"}
+	svc := NewService(mockDB, &config.Config{})
+	reader, err := svc.ExportDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("ExportDuckDB failed: %v", err)
+	}
+	defer reader.Close()
+
+	path := filepath.Join(t.TempDir(), "export.duckdb")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		t.Fatalf("Failed to copy export: %v", err)
+	}
+	file.Close()
+
+	db, err := sql.Open("duckdb", path+"?access_mode=read_only")
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	var weight sql.NullFloat64
+	var createdAt time.Time
+	err = db.QueryRow(`SELECT count(*) OVER (), data_weight, created_at FROM anc_visit ORDER BY created_at LIMIT 1`).
+		Scan(&count, &weight, &createdAt)
+	if err != nil {
+		t.Fatalf("Failed to query export: %v", err)
+	}
+	if count != 2 || !weight.Valid || weight.Float64 != 61.5 {
+		t.Errorf("Unexpected rows: count %d, weight %v", count, weight)
+	}
+	if !createdAt.Equal(time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected created_at %v", createdAt)
+	}
+
+	var indexes int
+	if err := db.QueryRow(`SELECT count(*) FROM duckdb_indexes() WHERE table_name = 'anc_visit'`).Scan(&indexes); err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	if indexes != 2 {
+		t.Errorf("Expected 2 indexes, got %d", indexes)
+	}
+}
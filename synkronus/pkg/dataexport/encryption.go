@@ -0,0 +1,216 @@
+package dataexport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// EncryptionManifestName is the name of the ZIP entry describing encrypted columns
+	EncryptionManifestName = "encryption.json"
+
+	// EncryptionAlgorithm identifies the hybrid scheme used for sensitive columns
+	EncryptionAlgorithm = "RSA-OAEP-SHA256+AES-256-GCM"
+
+	// EncryptedValuePrefix marks a cell value as encrypted
+	EncryptedValuePrefix = "enc:v1:"
+)
+
+// ErrInvalidPublicKey is returned when the export recipient key cannot be used
+var ErrInvalidPublicKey = errors.New("invalid export public key")
+
+// EncryptedColumn describes a column whose values were encrypted in an export file
+type EncryptedColumn struct {
+	Name string `json:"name"`
+	// Type is the SQL type the column had before encryption (text, numeric, boolean)
+	Type string `json:"type"`
+}
+
+// EncryptionManifest is written to the export ZIP so the recipient can decrypt sensitive columns
+type EncryptionManifest struct {
+	Algorithm      string                       `json:"algorithm"`
+	KeyFingerprint string                       `json:"key_fingerprint"`
+	EncryptedKey   string                       `json:"encrypted_key"`
+	Files          map[string][]EncryptedColumn `json:"files"`
+}
+
+// fieldEncryptor encrypts individual cell values with a per-export data key
+type fieldEncryptor struct {
+	aead     cipher.AEAD
+	manifest *EncryptionManifest
+}
+
+// newFieldEncryptor generates a fresh data key and wraps it for the recipient
+func newFieldEncryptor(pub *rsa.PublicKey) (*fieldEncryptor, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, dataKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	fingerprint, err := publicKeyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fieldEncryptor{
+		aead: aead,
+		manifest: &EncryptionManifest{
+			Algorithm:      EncryptionAlgorithm,
+			KeyFingerprint: fingerprint,
+			EncryptedKey:   base64.StdEncoding.EncodeToString(wrappedKey),
+			Files:          make(map[string][]EncryptedColumn),
+		},
+	}, nil
+}
+
+// encryptValue encrypts a JSON-encoded cell value, binding it to its column name
+func (e *fieldEncryptor) encryptValue(column string, value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode value for column %s: %w", column, err)
+	}
+
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, plaintext, []byte(column))
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// encryptColumns replaces sensitive data columns with encrypted text values.
+// It returns a copy of the schema in which encrypted columns are typed as text.
+func (e *fieldEncryptor) encryptColumns(filename string, schema *FormTypeSchema, observations []ObservationRow, sensitive map[string]bool) (*FormTypeSchema, error) {
+	if len(sensitive) == 0 {
+		return schema, nil
+	}
+
+	encSchema := &FormTypeSchema{
+		FormType: schema.FormType,
+		Columns:  make([]FormTypeColumn, len(schema.Columns)),
+	}
+	copy(encSchema.Columns, schema.Columns)
+
+	var columns []EncryptedColumn
+	for i, col := range encSchema.Columns {
+		if !sensitive[col.Key] {
+			continue
+		}
+
+		fieldName := "data_" + col.Key
+		for _, obs := range observations {
+			value, exists := obs.DataFields[fieldName]
+			if !exists || value == nil {
+				continue
+			}
+			encrypted, err := e.encryptValue(fieldName, value)
+			if err != nil {
+				return nil, err
+			}
+			obs.DataFields[fieldName] = encrypted
+		}
+
+		columns = append(columns, EncryptedColumn{Name: fieldName, Type: col.SQLType})
+		encSchema.Columns[i].DataType = "string"
+		encSchema.Columns[i].SQLType = "text"
+		encSchema.Columns[i].NestedType = nil
+	}
+
+	if len(columns) > 0 {
+		e.manifest.Files[filename] = columns
+	}
+
+	return encSchema, nil
+}
+
+// loadPublicKey reads a PEM-encoded RSA public key (PKIX or PKCS#1)
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found in %s", ErrInvalidPublicKey, path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: only RSA keys are supported", ErrInvalidPublicKey)
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block type %q", ErrInvalidPublicKey, block.Type)
+	}
+}
+
+// publicKeyFingerprint returns the hex SHA-256 of the DER-encoded public key
+func publicKeyFingerprint(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sensitiveFields returns the top-level fields tagged x-sensitive in the active
+// app bundle's schema for the given form type. A missing schema yields no fields.
+func (s *service) sensitiveFields(formType string) (map[string]bool, error) {
+	properties, err := s.formSchemaProperties(formType)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool)
+	for name, raw := range properties {
+		prop, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if sensitive, ok := prop["x-sensitive"].(bool); ok && sensitive {
+			fields[name] = true
+		}
+	}
+
+	return fields, nil
+}
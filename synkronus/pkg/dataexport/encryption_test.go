@@ -0,0 +1,198 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func writeTestPublicKey(t *testing.T, dir string) *rsa.PrivateKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "export.pub"), pemData, 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return priv
+}
+
+func TestService_ExportParquetZip_EncryptsSensitiveFields(t *testing.T) {
+	dir := t.TempDir()
+	priv := writeTestPublicKey(t, dir)
+
+	bundlePath := filepath.Join(dir, "bundle")
+	formDir := filepath.Join(bundlePath, "forms", "survey")
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	schemaJSON := `{"type":"object","properties":{"name":{"type":"string"},"national_id":{"type":"string","x-sensitive":true},"income":{"type":"number","x-sensitive":true}}}`
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schemaJSON), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	mockDB := &MockDatabaseInterface{
+		FormTypes: []string{"survey"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"survey": {
+				FormType: "survey",
+				Columns: []FormTypeColumn{
+					{Key: "name", DataType: "string", SQLType: "text"},
+					{Key: "national_id", DataType: "string", SQLType: "text"},
+					{Key: "income", DataType: "number", SQLType: "numeric"},
+				},
+			},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"survey": {
+				{
+					ObservationID: "obs1",
+					FormType:      "survey",
+					FormVersion:   "1.0",
+					CreatedAt:     "2023-01-01T00:00:00Z",
+					UpdatedAt:     "2023-01-01T00:00:00Z",
+					Version:       1,
+					DataFields: map[string]interface{}{
+						"data_name":        "Alice",
+						"data_national_id": "CM123456",
+						"data_income":      1250.5,
+					},
+				},
+			},
+		},
+	}
+
+	cfg := &config.Config{
+		AppBundlePath:       bundlePath,
+		ExportPublicKeyPath: filepath.Join(dir, "export.pub"),
+	}
+	svc := NewService(mockDB, cfg)
+
+	rc, err := svc.ExportParquetZip(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer rc.Close()
+
+	zipData, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Failed to read ZIP data: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		t.Fatalf("Failed to parse ZIP file: %v", err)
+	}
+
+	var manifest EncryptionManifest
+	found := false
+	for _, f := range zr.File {
+		if f.Name != EncryptionManifestName {
+			continue
+		}
+		found = true
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open manifest: %v", err)
+		}
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			t.Fatalf("Failed to decode manifest: %v", err)
+		}
+		r.Close()
+	}
+	if !found {
+		t.Fatalf("Expected %s in export", EncryptionManifestName)
+	}
+
+	columns := manifest.Files["survey.parquet"]
+	if len(columns) != 2 {
+		t.Fatalf("Expected 2 encrypted columns, got %d", len(columns))
+	}
+
+	// Observation values are replaced in place, so they can be checked directly
+	obs := mockDB.ObservationsData["survey"][0]
+	if obs.DataFields["data_name"] != "Alice" {
+		t.Errorf("Expected non-sensitive field to stay in plaintext, got %v", obs.DataFields["data_name"])
+	}
+
+	wrappedKey, _ := base64.StdEncoding.DecodeString(manifest.EncryptedKey)
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, wrappedKey, nil)
+	if err != nil {
+		t.Fatalf("Failed to unwrap data key: %v", err)
+	}
+	block, _ := aes.NewCipher(dataKey)
+	aead, _ := cipher.NewGCM(block)
+
+	value, ok := obs.DataFields["data_national_id"].(string)
+	if !ok || !strings.HasPrefix(value, EncryptedValuePrefix) {
+		t.Fatalf("Expected encrypted value, got %v", obs.DataFields["data_national_id"])
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedValuePrefix))
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte("data_national_id"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt value: %v", err)
+	}
+	if string(plaintext) != `"CM123456"` {
+		t.Errorf("Expected decrypted value %q, got %q", `"CM123456"`, plaintext)
+	}
+}
+
+func TestLoadPublicKey_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(path, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	if _, err := loadPublicKey(path); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
+
+func TestSensitiveFields_InvalidFormType(t *testing.T) {
+	dir := t.TempDir()
+	// A schema in the forms directory itself, which "." would otherwise resolve to
+	for _, path := range []string{
+		filepath.Join(dir, "forms", "schema.json"),
+		filepath.Join(dir, "forms", "survey", "schema.json"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`{"properties": {"national_id": {"type": "string", "x-sensitive": true}}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := NewService(&MockDatabaseInterface{}, &config.Config{AppBundlePath: dir}).(*service)
+
+	if fields, err := svc.sensitiveFields("survey"); err != nil || !fields["national_id"] {
+		t.Fatalf("Expected national_id to be sensitive, got %v, %v", fields, err)
+	}
+	for _, formType := range []string{".", "..", "../forms", ""} {
+		if fields, err := svc.sensitiveFields(formType); err != nil || len(fields) != 0 {
+			t.Errorf("Expected no sensitive fields for %q, got %v, %v", formType, fields, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package dataexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// exportRules are the form types and fields withheld from every export, admins
+// included. They combine the server configuration with the app bundle metadata.
+type exportRules struct {
+	// excludedFormTypes are never exported
+	excludedFormTypes map[string]bool
+	// excludedFields maps a form type, or "*" for all of them, to fields never exported
+	excludedFields map[string]map[string]bool
+	// allowedFields maps a form type to the only fields exported for it
+	allowedFields map[string]map[string]bool
+}
+
+// formExportMetadata is the export metadata of a form's schema.json: "x-export": false
+// on the schema or a property withholds it, "x-export-fields" lists the only
+// properties exported
+type formExportMetadata struct {
+	Export     *bool    `json:"x-export"`
+	Fields     []string `json:"x-export-fields"`
+	Properties map[string]struct {
+		Export *bool `json:"x-export"`
+	} `json:"properties"`
+}
+
+// configExportRules parses the export exclusions and allowlists of the configuration
+func (s *service) configExportRules() (*exportRules, error) {
+	rules := &exportRules{
+		excludedFormTypes: make(map[string]bool),
+		excludedFields:    make(map[string]map[string]bool),
+		allowedFields:     make(map[string]map[string]bool),
+	}
+	if s.config == nil {
+		return rules, nil
+	}
+
+	for _, formType := range splitList(s.config.ExportExcludeFormTypes) {
+		rules.excludedFormTypes[formType] = true
+	}
+	if err := parseFieldList("EXPORT_EXCLUDE_FIELDS", s.config.ExportExcludeFields, rules.excludedFields); err != nil {
+		return nil, err
+	}
+	if err := parseFieldList("EXPORT_FIELD_ALLOWLIST", s.config.ExportFieldAllowlist, rules.allowedFields); err != nil {
+		return nil, err
+	}
+	if _, ok := rules.allowedFields["*"]; ok {
+		return nil, fmt.Errorf("invalid EXPORT_FIELD_ALLOWLIST: allowlists must name a form type")
+	}
+	return rules, nil
+}
+
+// exportedFormTypes returns the form types with observations that may be exported, limited
+// to those changed in the version range of ctx and the form types it requests
+func (s *service) exportedFormTypes(ctx context.Context) ([]string, error) {
+	rules, err := s.configExportRules()
+	if err != nil {
+		return nil, err
+	}
+
+	// Incremental exports only have files for form types that changed
+	var formTypes []string
+	if versions := VersionRangeOf(ctx); versions.Since > 0 {
+		formTypes, err = s.db.GetChangedFormTypes(ctx, versions)
+	} else {
+		formTypes, err = s.db.GetFormTypes(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get form types: %w", err)
+	}
+	// Files are written in form type order whatever order the database returns them in
+	sort.Strings(formTypes)
+
+	var requested map[string]bool
+	if only := FormTypesOf(ctx); only != nil {
+		requested = make(map[string]bool, len(only))
+		for _, formType := range only {
+			requested[formType] = true
+		}
+	}
+
+	exported := make([]string, 0, len(formTypes))
+	for _, formType := range formTypes {
+		if rules.excludedFormTypes[formType] || (requested != nil && !requested[formType]) {
+			continue
+		}
+		meta, err := s.formExportMetadata(formType)
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil && meta.Export != nil && !*meta.Export {
+			continue
+		}
+		exported = append(exported, formType)
+	}
+	return exported, nil
+}
+
+// exportedSchema returns the columns of a form type that may be exported
+func (s *service) exportedSchema(ctx context.Context, formType string) (*FormTypeSchema, error) {
+	schema, err := s.db.GetFormTypeSchema(ctx, formType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema for form type %s: %w", formType, err)
+	}
+
+	rules, err := s.configExportRules()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.formExportMetadata(formType)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[string]bool)
+	for field := range rules.excludedFields["*"] {
+		excluded[field] = true
+	}
+	for field := range rules.excludedFields[formType] {
+		excluded[field] = true
+	}
+	var allowlists []map[string]bool
+	if allowed, ok := rules.allowedFields[formType]; ok {
+		allowlists = append(allowlists, allowed)
+	}
+	if meta != nil {
+		for name, prop := range meta.Properties {
+			if prop.Export != nil && !*prop.Export {
+				excluded[name] = true
+			}
+		}
+		if meta.Fields != nil {
+			allowed := make(map[string]bool, len(meta.Fields))
+			for _, field := range meta.Fields {
+				allowed[field] = true
+			}
+			allowlists = append(allowlists, allowed)
+		}
+	}
+
+	// A field must pass every allowlist, so the configuration can narrow the bundle's
+	for _, col := range schema.Columns {
+		for _, allowed := range allowlists {
+			if !allowed[col.Key] {
+				excluded[col.Key] = true
+			}
+		}
+	}
+	return redactColumns(schema, excluded), nil
+}
+
+// formExportMetadata reads the export metadata of a form in the active app bundle; a
+// missing schema yields nil
+func (s *service) formExportMetadata(formType string) (*formExportMetadata, error) {
+	data, err := s.readFormFile(formType, "schema.json")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var meta formExportMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid schema for %s: %w", formType, err)
+	}
+	return &meta, nil
+}
+
+// parseFieldList adds comma-separated form_type.field entries to fields; "*" as the
+// form type applies the entry to every form type
+func parseFieldList(name, value string, fields map[string]map[string]bool) error {
+	for _, entry := range splitList(value) {
+		formType, field, ok := strings.Cut(entry, ".")
+		if !ok || formType == "" || field == "" {
+			return fmt.Errorf("invalid %s entry %q: expected form_type.field", name, entry)
+		}
+		if fields[formType] == nil {
+			fields[formType] = make(map[string]bool)
+		}
+		fields[formType][field] = true
+	}
+	return nil
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -0,0 +1,184 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func newExclusionTestDB() *MockDatabaseInterface {
+	columns := func(keys ...string) []FormTypeColumn {
+		var cols []FormTypeColumn
+		for _, key := range keys {
+			cols = append(cols, FormTypeColumn{Key: key, DataType: "string", SQLType: "text"})
+		}
+		return cols
+	}
+	row := func(formType string) []ObservationRow {
+		return []ObservationRow{{ObservationID: formType + "-1", FormType: formType, FormVersion: "1", CreatedAt: "2025-01-01T00:00:00Z", UpdatedAt: "2025-01-01T00:00:00Z", Version: 1, DataFields: map[string]interface{}{}}}
+	}
+	return &MockDatabaseInterface{
+		FormTypes: []string{"household", "qa_check", "survey", "visit"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"household": {FormType: "household", Columns: columns("name", "comments", "village")},
+			"qa_check":  {FormType: "qa_check", Columns: columns("result")},
+			"survey":    {FormType: "survey", Columns: columns("score", "notes", "enumerator")},
+			"visit":     {FormType: "visit", Columns: columns("date", "comments", "reason")},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"household": row("household"),
+			"qa_check":  row("qa_check"),
+			"survey":    row("survey"),
+			"visit":     row("visit"),
+		},
+	}
+}
+
+func writeFormSchema(t *testing.T, dir, formType, schema string) {
+	t.Helper()
+	formDir := filepath.Join(dir, "forms", formType)
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+}
+
+func TestService_ExportExclusions(t *testing.T) {
+	writer := useRecordingDuckDB(t)
+	dir := t.TempDir()
+	// The bundle withholds the QA form, a free-text field and narrows the survey
+	writeFormSchema(t, dir, "qa_check", `{"type":"object","x-export":false,"properties":{"result":{"type":"string"}}}`)
+	writeFormSchema(t, dir, "household", `{"type":"object","properties":{"name":{"type":"string"},"village":{"type":"string","x-export":false}}}`)
+	writeFormSchema(t, dir, "survey", `{"type":"object","x-export-fields":["score","notes"],"properties":{}}`)
+
+	svc := NewService(newExclusionTestDB(), &config.Config{
+		AppBundlePath:          dir,
+		ExportExcludeFormTypes: "archived",
+		ExportExcludeFields:    "*.comments, visit.reason",
+		ExportFieldAllowlist:   "survey.score,survey.enumerator",
+	})
+
+	reader, err := svc.ExportDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("ExportDuckDB failed: %v", err)
+	}
+	reader.Close()
+
+	got := map[string][]string{}
+	for _, table := range writer.tables {
+		got[table.Name] = table.Columns
+	}
+	want := map[string][]string{
+		"household": {"data_name"},
+		// Both the bundle's and the configuration's allowlist apply
+		"survey": {"data_score"},
+		"visit":  {"data_date"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected tables %v, got %v", want, got)
+	}
+}
+
+func TestService_ExportExclusions_ConfigOnly(t *testing.T) {
+	svc := NewService(newExclusionTestDB(), &config.Config{
+		ExportExcludeFormTypes: "qa_check,visit",
+		ExportFieldAllowlist:   "household.name",
+	})
+
+	rc, err := svc.ExportParquetZip(context.Background())
+	if err != nil {
+		t.Fatalf("ExportParquetZip failed: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("Failed to read ZIP data: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse ZIP file: %v", err)
+	}
+	var files []string
+	for _, f := range zr.File {
+		files = append(files, f.Name)
+	}
+	if want := []string{"household.parquet", "survey.parquet", ExportManifestName}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected files %v, got %v", want, files)
+	}
+
+	table := readExportedTable(t, svc, "household.parquet")
+	defer table.Release()
+	for i := 0; i < int(table.NumCols()); i++ {
+		if col := table.Schema().Field(i).Name; strings.HasPrefix(col, "data_") && col != "data_name" {
+			t.Errorf("Expected only data_name to be exported, found %s", col)
+		}
+	}
+}
+
+func TestService_ExportParquetZipFilters(t *testing.T) {
+	db := newExclusionTestDB()
+	db.ObservationsData["survey"][0].Version = 5
+	svc := NewService(db, &config.Config{ExportExcludeFormTypes: "qa_check"})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected []string
+	}{
+		{"changed since a version", WithVersionRange(context.Background(), VersionRange{Since: 2}), []string{"survey.parquet", ExportManifestName}},
+		{"requested form types", WithFormTypes(context.Background(), "visit", "qa_check"), []string{"visit.parquet", ExportManifestName}},
+		{"requested form types without changes", WithFormTypes(WithVersionRange(context.Background(), VersionRange{Since: 2}), "visit"), []string{ExportManifestName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := svc.ExportParquetZip(tt.ctx)
+			if err != nil {
+				t.Fatalf("ExportParquetZip failed: %v", err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("Failed to read ZIP data: %v", err)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to parse ZIP file: %v", err)
+			}
+			var files []string
+			for _, f := range zr.File {
+				files = append(files, f.Name)
+			}
+			if !reflect.DeepEqual(files, tt.expected) {
+				t.Errorf("Expected files %v, got %v", tt.expected, files)
+			}
+		})
+	}
+}
+
+func TestService_ExportExclusions_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{name: "field without form type", cfg: config.Config{ExportExcludeFields: "comments"}},
+		{name: "wildcard allowlist", cfg: config.Config{ExportFieldAllowlist: "*.name"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService(newExclusionTestDB(), &tc.cfg)
+			if _, err := svc.ExportParquetZip(context.Background()); err == nil {
+				t.Error("Expected an invalid setting to fail the export")
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package dataexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// FHIRMappingFile is the per-form mapping file in the app bundle, next to schema.json.
+// Only form types with a mapping file are exported to FHIR.
+const FHIRMappingFile = "fhir.json"
+
+// Supported FHIR resource types
+const (
+	FHIRPatient               = "Patient"
+	FHIRObservation           = "Observation"
+	FHIRQuestionnaireResponse = "QuestionnaireResponse"
+)
+
+// ErrInvalidFHIRMapping is returned when a form's fhir.json cannot be used
+var ErrInvalidFHIRMapping = errors.New("invalid FHIR mapping")
+
+// fhirIdentifierSystem is the identifier system of observation IDs on exported resources
+const fhirIdentifierSystem = "urn:synkronus:observation"
+
+// fhirIDPattern matches the characters allowed in FHIR resource ids
+var fhirIDPattern = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// FHIRMapping describes how the observations of one form type become FHIR resources.
+// Every observation produces one resource per entry, for example:
+//
+//	{"resources": [
+//	  {"resourceType": "Patient", "key": "patient",
+//	   "fields": {"name.0.given.0": "first_name", "gender": "sex", "birthDate": "dob"}},
+//	  {"resourceType": "Observation", "subject": "patient", "value": "weight", "unit": "kg",
+//	   "code": {"system": "http://loinc.org", "code": "29463-7", "display": "Body weight"}},
+//	  {"resourceType": "QuestionnaireResponse", "subject": "patient",
+//	   "questionnaire": "https://example.org/Questionnaire/anc_visit"}
+//	]}
+type FHIRMapping struct {
+	Resources []FHIRResourceMapping `json:"resources"`
+}
+
+// FHIRResourceMapping maps observation fields onto a single FHIR resource
+type FHIRResourceMapping struct {
+	ResourceType string `json:"resourceType"`
+	// Key names the resource so others can reference it as their subject
+	Key string `json:"key,omitempty"`
+	// Subject is the key of the Patient this resource is about
+	Subject string `json:"subject,omitempty"`
+
+	// Fields maps dotted Patient element paths (numbers index arrays) to form fields
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Code identifies what an Observation measures
+	Code *FHIRCoding `json:"code,omitempty"`
+	// Value is the form field holding the Observation value
+	Value string `json:"value,omitempty"`
+	// Unit is the UCUM unit of numeric Observation values
+	Unit string `json:"unit,omitempty"`
+
+	// Questionnaire is the canonical URL a QuestionnaireResponse answers
+	Questionnaire string `json:"questionnaire,omitempty"`
+}
+
+// FHIRCoding is a FHIR Coding
+type FHIRCoding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+// ExportFHIR exports observations of form types with a fhir.json mapping as FHIR
+// resources in NDJSON, one resource per line
+func (s *service) ExportFHIR(ctx context.Context) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.ExportFHIR")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	formTypes, err := s.exportedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	resourceCount := 0
+	for _, formType := range formTypes {
+		mapping, err := s.fhirMapping(formType)
+		if err != nil {
+			return nil, err
+		}
+		if mapping == nil {
+			continue
+		}
+
+		n, err := s.exportFormTypeToFHIR(ctx, formType, mapping, buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export form type %s to FHIR: %w", formType, err)
+		}
+		resourceCount += n
+	}
+	span.SetAttributes(attribute.Int("dataexport.fhir_resources", resourceCount))
+
+	return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+}
+
+// fhirMapping loads and checks the FHIR mapping of a form type; nil when it has none
+func (s *service) fhirMapping(formType string) (*FHIRMapping, error) {
+	data, err := s.readFormFile(formType, FHIRMappingFile)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var mapping FHIRMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("%w for %s: %v", ErrInvalidFHIRMapping, formType, err)
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, fmt.Errorf("%w for %s: %v", ErrInvalidFHIRMapping, formType, err)
+	}
+	return &mapping, nil
+}
+
+// validate checks resource types, required settings and subject references
+func (m *FHIRMapping) validate() error {
+	patients := make(map[string]bool)
+	for _, res := range m.Resources {
+		if res.ResourceType == FHIRPatient && res.Key != "" {
+			patients[res.Key] = true
+		}
+	}
+
+	for i, res := range m.Resources {
+		switch res.ResourceType {
+		case FHIRPatient:
+			if len(res.Fields) == 0 {
+				return fmt.Errorf("resource %d: Patient needs fields", i)
+			}
+			for path := range res.Fields {
+				first := strings.Split(path, ".")[0]
+				if _, err := strconv.Atoi(first); err == nil || first == "" {
+					return fmt.Errorf("resource %d: field path %q must start with an element name", i, path)
+				}
+			}
+		case FHIRObservation:
+			if res.Code == nil || res.Code.Code == "" {
+				return fmt.Errorf("resource %d: Observation needs a code", i)
+			}
+			if res.Value == "" {
+				return fmt.Errorf("resource %d: Observation needs a value field", i)
+			}
+		case FHIRQuestionnaireResponse:
+		default:
+			return fmt.Errorf("resource %d: unsupported resourceType %q", i, res.ResourceType)
+		}
+		if res.Subject != "" && !patients[res.Subject] {
+			return fmt.Errorf("resource %d: subject %q is not the key of a Patient", i, res.Subject)
+		}
+	}
+	return nil
+}
+
+// exportFormTypeToFHIR writes the resources of every observation of a form type
+func (s *service) exportFormTypeToFHIR(ctx context.Context, formType string, mapping *FHIRMapping, w io.Writer) (int, error) {
+	schema, err := s.exportedSchema(ctx, formType)
+	if err != nil {
+		return 0, err
+	}
+
+	// FHIR has no place for encrypted values, so sensitive fields are left out unless
+	// the caller may see them in plain text
+	if redactSensitive(ctx) || (s.config != nil && s.config.ExportPublicKeyPath != "") {
+		sensitive, err := s.sensitiveFields(formType)
+		if err != nil {
+			return 0, err
+		}
+		schema = redactColumns(schema, sensitive)
+	}
+
+	observations, err := s.db.GetObservationsForFormType(ctx, formType, schema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get observations for form type %s: %w", formType, err)
+	}
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for _, obs := range observations {
+		for _, resource := range fhirResources(mapping, schema, obs) {
+			if err := encoder.Encode(resource); err != nil {
+				return count, fmt.Errorf("failed to write FHIR resource: %w", err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// fhirResources builds the resources of one observation. Resources whose mapped
+// fields are all empty are left out, along with references to them.
+func fhirResources(mapping *FHIRMapping, schema *FormTypeSchema, obs ObservationRow) []map[string]interface{} {
+	values := fhirFieldValues(schema, obs)
+
+	// Patients first, so others can reference those that were produced
+	references := make(map[string]string)
+	var resources []map[string]interface{}
+	for i, res := range mapping.Resources {
+		if res.ResourceType != FHIRPatient {
+			continue
+		}
+		patient := map[string]interface{}{}
+		paths := make([]string, 0, len(res.Fields))
+		for path := range res.Fields {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if value, ok := values[res.Fields[path]]; ok {
+				setFHIRPath(patient, strings.Split(path, "."), value)
+			}
+		}
+		if len(patient) == 0 {
+			continue
+		}
+		id := fhirResourceID(obs.ObservationID, res, i)
+		patient["resourceType"] = FHIRPatient
+		patient["id"] = id
+		// Keep identifiers mapped from the form, e.g. a national ID
+		identifiers, _ := patient["identifier"].([]interface{})
+		patient["identifier"] = append(identifiers, fhirIdentifier(obs.ObservationID))
+		if res.Key != "" {
+			references[res.Key] = FHIRPatient + "/" + id
+		}
+		resources = append(resources, patient)
+	}
+
+	for i, res := range mapping.Resources {
+		var resource map[string]interface{}
+		switch res.ResourceType {
+		case FHIRObservation:
+			value, ok := values[res.Value]
+			if !ok {
+				continue
+			}
+			resource = map[string]interface{}{
+				"status":            "final",
+				"code":              map[string]interface{}{"coding": []FHIRCoding{*res.Code}},
+				"effectiveDateTime": obs.CreatedAt,
+			}
+			for key, v := range fhirObservationValue(value, res.Unit) {
+				resource[key] = v
+			}
+		case FHIRQuestionnaireResponse:
+			resource = map[string]interface{}{
+				"status":   "completed",
+				"authored": obs.CreatedAt,
+				"item":     fhirQuestionnaireItems(values),
+			}
+			if res.Questionnaire != "" {
+				resource["questionnaire"] = res.Questionnaire
+			}
+		default:
+			continue
+		}
+
+		resource["resourceType"] = res.ResourceType
+		resource["id"] = fhirResourceID(obs.ObservationID, res, i)
+		if res.ResourceType == FHIRQuestionnaireResponse {
+			// QuestionnaireResponse.identifier is a single Identifier
+			resource["identifier"] = fhirIdentifier(obs.ObservationID)
+		} else {
+			resource["identifier"] = []map[string]string{fhirIdentifier(obs.ObservationID)}
+		}
+		if ref, ok := references[res.Subject]; ok {
+			resource["subject"] = map[string]string{"reference": ref}
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources
+}
+
+// fhirFieldValues decodes the observation's data fields into JSON values by field name
+func fhirFieldValues(schema *FormTypeSchema, obs ObservationRow) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, col := range schema.Columns {
+		raw, ok := obs.DataFields["data_"+col.Key]
+		if !ok || raw == nil {
+			continue
+		}
+		if b, ok := raw.([]byte); ok {
+			raw = string(b)
+		}
+
+		switch col.SQLType {
+		case "numeric":
+			if str, ok := raw.(string); ok {
+				if f, err := strconv.ParseFloat(str, 64); err == nil {
+					raw = f
+				}
+			}
+		case "text":
+			// Arrays and objects come back as JSON text
+			if str, ok := raw.(string); ok && (col.DataType == "array" || col.DataType == "object") {
+				var decoded interface{}
+				if json.Unmarshal([]byte(str), &decoded) == nil {
+					raw = decoded
+				}
+			}
+		}
+		values[col.Key] = raw
+	}
+	return values
+}
+
+// fhirObservationValue picks the Observation value[x] element for a JSON value
+func fhirObservationValue(value interface{}, unit string) map[string]interface{} {
+	switch v := value.(type) {
+	case float64, int, int64:
+		quantity := map[string]interface{}{"value": v}
+		if unit != "" {
+			quantity["unit"] = unit
+			quantity["system"] = "http://unitsofmeasure.org"
+			quantity["code"] = unit
+		}
+		return map[string]interface{}{"valueQuantity": quantity}
+	case bool:
+		return map[string]interface{}{"valueBoolean": v}
+	case string:
+		return map[string]interface{}{"valueString": v}
+	default:
+		text, _ := json.Marshal(v)
+		return map[string]interface{}{"valueString": string(text)}
+	}
+}
+
+// fhirQuestionnaireItems answers one item per form field, ordered by field name
+func fhirQuestionnaireItems(values map[string]interface{}) []map[string]interface{} {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		var answer map[string]interface{}
+		switch v := values[name].(type) {
+		case float64:
+			if v == float64(int64(v)) {
+				answer = map[string]interface{}{"valueInteger": int64(v)}
+			} else {
+				answer = map[string]interface{}{"valueDecimal": v}
+			}
+		case bool:
+			answer = map[string]interface{}{"valueBoolean": v}
+		case string:
+			answer = map[string]interface{}{"valueString": v}
+		default:
+			text, _ := json.Marshal(v)
+			answer = map[string]interface{}{"valueString": string(text)}
+		}
+		items = append(items, map[string]interface{}{
+			"linkId": name,
+			"answer": []map[string]interface{}{answer},
+		})
+	}
+	return items
+}
+
+// setFHIRPath sets a value at a dotted element path, creating objects for names and
+// arrays for numeric tokens along the way
+func setFHIRPath(node map[string]interface{}, tokens []string, value interface{}) {
+	var set func(current interface{}, tokens []string) interface{}
+	set = func(current interface{}, tokens []string) interface{} {
+		if len(tokens) == 0 {
+			return value
+		}
+		if index, err := strconv.Atoi(tokens[0]); err == nil && index >= 0 {
+			list, _ := current.([]interface{})
+			for len(list) <= index {
+				list = append(list, nil)
+			}
+			list[index] = set(list[index], tokens[1:])
+			return list
+		}
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			obj = map[string]interface{}{}
+		}
+		obj[tokens[0]] = set(obj[tokens[0]], tokens[1:])
+		return obj
+	}
+	set(node, tokens)
+}
+
+// fhirIdentifier links a resource back to the observation it came from
+func fhirIdentifier(observationID string) map[string]string {
+	return map[string]string{"system": fhirIdentifierSystem, "value": observationID}
+}
+
+// fhirResourceID derives a stable resource id from the observation, so re-exports
+// update resources instead of duplicating them
+func fhirResourceID(observationID string, res FHIRResourceMapping, index int) string {
+	suffix := res.Key
+	if suffix == "" {
+		suffix = strings.ToLower(res.ResourceType) + strconv.Itoa(index)
+	}
+	id := fhirIDPattern.ReplaceAllString(observationID+"-"+suffix, "-")
+	if len(id) > 64 {
+		sum := sha256.Sum256([]byte(observationID + "-" + suffix))
+		id = hex.EncodeToString(sum[:])
+	}
+	return id
+}
@@ -0,0 +1,185 @@
+package dataexport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/config"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+const testFHIRMapping = `{
+	"resources": [
+		{"resourceType": "Patient", "key": "patient",
+		 "fields": {"name.0.given.0": "first_name", "gender": "sex", "identifier.0.value": "national_id"}},
+		{"resourceType": "Observation", "subject": "patient", "value": "weight", "unit": "kg",
+		 "code": {"system": "http://loinc.org", "code": "29463-7", "display": "Body weight"}},
+		{"resourceType": "QuestionnaireResponse", "subject": "patient",
+		 "questionnaire": "https://example.org/Questionnaire/anc_visit"}
+	]
+}`
+
+// writeFHIRBundle writes schema.json and, when given, fhir.json for a form
+func writeFHIRBundle(t *testing.T, dir, form, mapping string) {
+	t.Helper()
+	formDir := filepath.Join(dir, "forms", form)
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	schemaJSON := `{"type":"object","properties":{"first_name":{"type":"string"},"sex":{"type":"string"},"national_id":{"type":"string","x-sensitive":true},"weight":{"type":"number"},"visits":{"type":"array"}}}`
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schemaJSON), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	if mapping != "" {
+		if err := os.WriteFile(filepath.Join(formDir, FHIRMappingFile), []byte(mapping), 0644); err != nil {
+			t.Fatalf("Failed to write mapping: %v", err)
+		}
+	}
+}
+
+func newFHIRTestDB() *MockDatabaseInterface {
+	columns := []FormTypeColumn{
+		{Key: "first_name", DataType: "string", SQLType: "text"},
+		{Key: "national_id", DataType: "string", SQLType: "text"},
+		{Key: "sex", DataType: "string", SQLType: "text"},
+		{Key: "visits", DataType: "array", SQLType: "text"},
+		{Key: "weight", DataType: "number", SQLType: "numeric"},
+	}
+	return &MockDatabaseInterface{
+		FormTypes: []string{"anc_visit", "unmapped"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"anc_visit": {FormType: "anc_visit", Columns: columns},
+			"unmapped":  {FormType: "unmapped", Columns: columns},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"anc_visit": {
+				{
+					ObservationID: "obs1",
+					FormType:      "anc_visit",
+					CreatedAt:     "2025-01-02T10:00:00Z",
+					DataFields: map[string]interface{}{
+						"data_first_name":  "Amina",
+						"data_sex":         "female",
+						"data_national_id": "CM123",
+						"data_weight":      []byte("61.5"),
+						"data_visits":      `[1,2]`,
+					},
+				},
+				{
+					// No patient fields and no weight: only the questionnaire response remains
+					ObservationID: "obs2",
+					FormType:      "anc_visit",
+					CreatedAt:     "2025-01-03T10:00:00Z",
+					DataFields:    map[string]interface{}{"data_visits": `[]`},
+				},
+			},
+			"unmapped": {{ObservationID: "obs3", FormType: "unmapped", DataFields: map[string]interface{}{"data_sex": "male"}}},
+		},
+	}
+}
+
+// readNDJSON decodes one resource per line
+func readNDJSON(t *testing.T, r io.Reader) []map[string]interface{} {
+	t.Helper()
+	var resources []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var resource map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &resource); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+func TestService_ExportFHIR(t *testing.T) {
+	dir := t.TempDir()
+	writeFHIRBundle(t, dir, "anc_visit", testFHIRMapping)
+	writeFHIRBundle(t, dir, "unmapped", "")
+
+	svc := NewService(newFHIRTestDB(), &config.Config{AppBundlePath: dir})
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "admin", Role: models.RoleAdmin})
+
+	reader, err := svc.ExportFHIR(ctx)
+	if err != nil {
+		t.Fatalf("ExportFHIR failed: %v", err)
+	}
+	resources := readNDJSON(t, reader)
+
+	// obs1: Patient, Observation, QuestionnaireResponse; obs2: QuestionnaireResponse
+	if len(resources) != 4 {
+		t.Fatalf("Expected 4 resources, got %d: %v", len(resources), resources)
+	}
+
+	patient := resources[0]
+	if patient["resourceType"] != "Patient" || patient["id"] != "obs1-patient" || patient["gender"] != "female" {
+		t.Errorf("Unexpected patient %v", patient)
+	}
+	name := patient["name"].([]interface{})[0].(map[string]interface{})
+	if given := name["given"].([]interface{}); given[0] != "Amina" {
+		t.Errorf("Expected the given name at name.0.given.0, got %v", name)
+	}
+	identifiers := patient["identifier"].([]interface{})
+	if len(identifiers) != 2 || identifiers[0].(map[string]interface{})["value"] != "CM123" {
+		t.Errorf("Expected the mapped national_id and the observation identifier, got %v", identifiers)
+	}
+
+	observation := resources[1]
+	quantity := observation["valueQuantity"].(map[string]interface{})
+	if observation["resourceType"] != "Observation" || quantity["value"] != 61.5 || quantity["unit"] != "kg" {
+		t.Errorf("Unexpected observation %v", observation)
+	}
+	if subject := observation["subject"].(map[string]interface{}); subject["reference"] != "Patient/obs1-patient" {
+		t.Errorf("Expected the observation to reference the patient, got %v", subject)
+	}
+
+	response := resources[3]
+	if response["resourceType"] != "QuestionnaireResponse" || response["subject"] != nil {
+		t.Errorf("Expected an unlinked questionnaire response for obs2, got %v", response)
+	}
+	if identifier := response["identifier"].(map[string]interface{}); identifier["value"] != "obs2" {
+		t.Errorf("Expected the observation ID as identifier, got %v", identifier)
+	}
+}
+
+func TestService_ExportFHIR_RedactsSensitiveFields(t *testing.T) {
+	dir := t.TempDir()
+	writeFHIRBundle(t, dir, "anc_visit", testFHIRMapping)
+
+	svc := NewService(newFHIRTestDB(), &config.Config{AppBundlePath: dir})
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "viewer", Role: models.RoleReadOnly})
+
+	reader, err := svc.ExportFHIR(ctx)
+	if err != nil {
+		t.Fatalf("ExportFHIR failed: %v", err)
+	}
+	resources := readNDJSON(t, reader)
+	if len(resources) != 4 {
+		t.Fatalf("Expected 4 resources, got %d", len(resources))
+	}
+	for _, resource := range resources {
+		data, _ := json.Marshal(resource)
+		if strings.Contains(string(data), "CM123") {
+			t.Errorf("Sensitive value leaked into %s", data)
+		}
+	}
+}
+
+func TestService_ExportFHIR_InvalidMapping(t *testing.T) {
+	dir := t.TempDir()
+	writeFHIRBundle(t, dir, "anc_visit", `{"resources":[{"resourceType":"Observation","value":"weight","subject":"nobody"}]}`)
+
+	svc := NewService(newFHIRTestDB(), &config.Config{AppBundlePath: dir})
+	if _, err := svc.ExportFHIR(context.Background()); !errors.Is(err, ErrInvalidFHIRMapping) {
+		t.Fatalf("Expected ErrInvalidFHIRMapping, got %v", err)
+	}
+}
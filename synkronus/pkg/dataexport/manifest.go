@@ -0,0 +1,103 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"time"
+)
+
+// ExportManifestName is the name of the ZIP entry listing the files of a Parquet or CSV
+// export with their SHA-256 hashes
+const ExportManifestName = "export_manifest.json"
+
+// parquetCreatedBy is the created_by of the Parquet files of exports
+const parquetCreatedBy = "synkronus"
+
+// exportEntryTime is the modification time of every ZIP entry, so that exports of the
+// same data are byte-identical. It is the earliest time ZIP can record.
+var exportEntryTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ExportManifest lists the data files of an export. It holds no timestamps, so exports of
+// the same data have the same manifest.
+type ExportManifest struct {
+	// Format is parquet or csv
+	Format string       `json:"format"`
+	Files  []ExportFile `json:"files"`
+}
+
+// ExportFile is the file of a form type in an export
+type ExportFile struct {
+	FormType string `json:"form_type"`
+	Path     string `json:"path"`
+	Rows     int    `json:"rows"`
+	Bytes    int64  `json:"bytes"`
+	// SHA256 is the hex SHA-256 hash of the file's content
+	SHA256 string `json:"sha256"`
+}
+
+// exportEntry is a ZIP entry being written that counts and hashes its content
+type exportEntry struct {
+	w     io.Writer
+	hash  hash.Hash
+	bytes int64
+}
+
+// createExportEntry adds an entry with the fixed modification time to the ZIP archive
+func createExportEntry(zipWriter *zip.Writer, name string) (*exportEntry, error) {
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: exportEntryTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ZIP file entry %s: %w", name, err)
+	}
+	return &exportEntry{w: w, hash: sha256.New()}, nil
+}
+
+func (e *exportEntry) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	e.hash.Write(p[:n])
+	e.bytes += int64(n)
+	return n, err
+}
+
+// sum returns the hex SHA-256 hash of what was written
+func (e *exportEntry) sum() string {
+	return hex.EncodeToString(e.hash.Sum(nil))
+}
+
+// writeExportManifest adds the export manifest to the ZIP archive
+func writeExportManifest(zipWriter *zip.Writer, manifest *ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export manifest: %w", err)
+	}
+
+	entry, err := createExportEntry(zipWriter, ExportManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write export manifest: %w", err)
+	}
+	return nil
+}
+
+// sortObservations puts rows in server version order, whatever order the database
+// returned them in. Versions are unique per observation; the ID breaks ties between rows
+// of the same change.
+func sortObservations(observations []ObservationRow) {
+	sort.SliceStable(observations, func(i, j int) bool {
+		if observations[i].Version != observations[j].Version {
+			return observations[i].Version < observations[j].Version
+		}
+		return observations[i].ObservationID < observations[j].ObservationID
+	})
+}
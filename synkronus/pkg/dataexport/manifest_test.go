@@ -0,0 +1,116 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+// deterministicTestDB returns form types and rows in the order given, as a database
+// without ORDER BY would
+func deterministicTestDB(formTypes []string, rows []ObservationRow) *MockDatabaseInterface {
+	return &MockDatabaseInterface{
+		FormTypes: formTypes,
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"survey": {FormType: "survey", Columns: []FormTypeColumn{{Key: "age", DataType: "number", SQLType: "numeric"}}},
+			"visit":  {FormType: "visit", Columns: []FormTypeColumn{{Key: "note", DataType: "string", SQLType: "text"}}},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"survey": rows,
+			"visit": {{
+				ObservationID: "v1", FormType: "visit", FormVersion: "1", CreatedAt: "2024-01-01T00:00:00Z",
+				UpdatedAt: "2024-01-01T00:00:00Z", Version: 4, DataFields: map[string]interface{}{"data_note": "ok"},
+			}},
+		},
+	}
+}
+
+func readExport(t *testing.T, rc io.ReadCloser, err error) []byte {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	return data
+}
+
+func TestService_ExportsAreDeterministic(t *testing.T) {
+	rows := []ObservationRow{
+		{ObservationID: "b", FormType: "survey", FormVersion: "1", CreatedAt: "2024-01-02T00:00:00Z", UpdatedAt: "2024-01-02T00:00:00Z", Version: 3, DataFields: map[string]interface{}{"data_age": 41.0}},
+		{ObservationID: "a", FormType: "survey", FormVersion: "1", CreatedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-01T00:00:00Z", Version: 1, DataFields: map[string]interface{}{"data_age": 30.0}},
+		{ObservationID: "c", FormType: "survey", FormVersion: "1", CreatedAt: "2024-01-03T00:00:00Z", UpdatedAt: "2024-01-03T00:00:00Z", Version: 2},
+	}
+	reversed := []ObservationRow{rows[2], rows[1], rows[0]}
+	ctx := context.Background()
+
+	for _, format := range []string{"parquet", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			export := func(db *MockDatabaseInterface) []byte {
+				svc := NewService(db, &config.Config{})
+				if format == "csv" {
+					rc, err := svc.ExportCSVZip(ctx)
+					return readExport(t, rc, err)
+				}
+				rc, err := svc.ExportParquetZip(ctx)
+				return readExport(t, rc, err)
+			}
+			first := export(deterministicTestDB([]string{"survey", "visit"}, append([]ObservationRow{}, rows...)))
+			second := export(deterministicTestDB([]string{"visit", "survey"}, append([]ObservationRow{}, reversed...)))
+			if !bytes.Equal(first, second) {
+				t.Fatal("Exports of the same data differ")
+			}
+
+			archive, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+			if err != nil {
+				t.Fatalf("Failed to open ZIP: %v", err)
+			}
+			contents := map[string][]byte{}
+			for _, file := range archive.File {
+				if !file.Modified.Equal(exportEntryTime) {
+					t.Errorf("Entry %s has modification time %s", file.Name, file.Modified)
+				}
+				f, err := file.Open()
+				if err != nil {
+					t.Fatalf("Failed to open %s: %v", file.Name, err)
+				}
+				contents[file.Name], _ = io.ReadAll(f)
+				f.Close()
+			}
+
+			var manifest ExportManifest
+			if err := json.Unmarshal(contents[ExportManifestName], &manifest); err != nil {
+				t.Fatalf("Failed to parse export manifest: %v", err)
+			}
+			if manifest.Format != format || len(manifest.Files) != 2 {
+				t.Fatalf("Unexpected manifest %+v", manifest)
+			}
+			if manifest.Files[0].FormType != "survey" || manifest.Files[0].Rows != 3 || manifest.Files[1].FormType != "visit" {
+				t.Errorf("Files are not in form type order: %+v", manifest.Files)
+			}
+			for _, file := range manifest.Files {
+				sum := sha256.Sum256(contents[file.Path])
+				if file.SHA256 != hex.EncodeToString(sum[:]) || file.Bytes != int64(len(contents[file.Path])) {
+					t.Errorf("Manifest entry of %s doesn't match its content", file.Path)
+				}
+			}
+		})
+	}
+
+	// Rows are in server version order
+	sorted := append([]ObservationRow{}, reversed...)
+	sortObservations(sorted)
+	if sorted[0].ObservationID != "a" || sorted[1].ObservationID != "c" || sorted[2].ObservationID != "b" {
+		t.Errorf("Unexpected row order %s %s %s", sorted[0].ObservationID, sorted[1].ObservationID, sorted[2].ObservationID)
+	}
+}
@@ -0,0 +1,214 @@
+package dataexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+)
+
+// readFormFile reads a file of the given form type from the active app bundle,
+// e.g. its schema.json. A missing file yields nil.
+func (s *service) readFormFile(formType, name string) ([]byte, error) {
+	if s.config == nil {
+		return nil, nil
+	}
+	path := formschema.File(s.config.AppBundlePath, formType, name)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s for %s: %w", name, formType, err)
+	}
+	return data, nil
+}
+
+// formSchemaProperties returns the top-level properties of the active app bundle's
+// schema for the given form type. A missing schema yields nil.
+func (s *service) formSchemaProperties(formType string) (map[string]interface{}, error) {
+	data, err := s.readFormFile(formType, "schema.json")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var schema struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema for %s: %w", formType, err)
+	}
+	return schema.Properties, nil
+}
+
+// applyNestedColumns types array and object columns declared in the form's schema
+// as Arrow list/struct columns. Columns whose observed JSON type doesn't match the
+// declaration keep the default text encoding.
+func (s *service) applyNestedColumns(formType string, schema *FormTypeSchema) (*FormTypeSchema, error) {
+	properties, err := s.formSchemaProperties(formType)
+	if err != nil {
+		return nil, err
+	}
+	if len(properties) == 0 {
+		return schema, nil
+	}
+
+	nested := &FormTypeSchema{
+		FormType: schema.FormType,
+		Columns:  make([]FormTypeColumn, len(schema.Columns)),
+	}
+	copy(nested.Columns, schema.Columns)
+
+	for i, col := range nested.Columns {
+		if col.DataType != "array" && col.DataType != "object" {
+			continue
+		}
+		prop, ok := properties[col.Key].(map[string]interface{})
+		if !ok || schemaType(prop) != col.DataType {
+			continue
+		}
+		if dt := arrowTypeForSchema(prop); dt != nil && dt.ID() != arrow.STRING {
+			nested.Columns[i].NestedType = dt
+		}
+	}
+
+	return nested, nil
+}
+
+// schemaType returns the JSON Schema type of prop, ignoring "null" in type unions
+func schemaType(prop map[string]interface{}) string {
+	switch t := prop["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// arrowTypeForSchema maps a JSON Schema property to an Arrow type. Arrays become
+// lists of their item type and objects with declared properties become structs;
+// anything else is kept as its JSON text.
+func arrowTypeForSchema(prop map[string]interface{}) arrow.DataType {
+	switch schemaType(prop) {
+	case "number", "integer":
+		return arrow.PrimitiveTypes.Float64
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean
+	case "array":
+		items, ok := prop["items"].(map[string]interface{})
+		if !ok {
+			return arrow.BinaryTypes.String
+		}
+		return arrow.ListOf(arrowTypeForSchema(items))
+	case "object":
+		properties, ok := prop["properties"].(map[string]interface{})
+		if !ok || len(properties) == 0 {
+			return arrow.BinaryTypes.String
+		}
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fields := make([]arrow.Field, 0, len(names))
+		for _, name := range names {
+			child, ok := properties[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+			}
+			fields = append(fields, arrow.Field{Name: name, Type: arrowTypeForSchema(child), Nullable: true})
+		}
+		return arrow.StructOf(fields...)
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// decodeNestedValue parses the JSON text of an array or object column
+func decodeNestedValue(value interface{}) (interface{}, bool) {
+	var raw []byte
+	switch v := value.(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	case []interface{}, map[string]interface{}:
+		return v, true
+	default:
+		return nil, false
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// appendNestedValue appends a decoded JSON value to a builder of the matching
+// Arrow type. Values that don't fit the declared type are appended as null.
+func appendNestedValue(b array.Builder, value interface{}) {
+	if value == nil {
+		b.AppendNull()
+		return
+	}
+
+	switch fb := b.(type) {
+	case *array.ListBuilder:
+		items, ok := value.([]interface{})
+		if !ok {
+			fb.AppendNull()
+			return
+		}
+		fb.Append(true)
+		for _, item := range items {
+			appendNestedValue(fb.ValueBuilder(), item)
+		}
+	case *array.StructBuilder:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			fb.AppendNull()
+			return
+		}
+		fb.Append(true)
+		structType := fb.Type().(*arrow.StructType)
+		for i, field := range structType.Fields() {
+			appendNestedValue(fb.FieldBuilder(i), fields[field.Name])
+		}
+	case *array.Float64Builder:
+		if v, ok := value.(float64); ok {
+			fb.Append(v)
+		} else {
+			fb.AppendNull()
+		}
+	case *array.BooleanBuilder:
+		if v, ok := value.(bool); ok {
+			fb.Append(v)
+		} else {
+			fb.AppendNull()
+		}
+	case *array.StringBuilder:
+		if v, ok := value.(string); ok {
+			fb.Append(v)
+			return
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			fb.AppendNull()
+			return
+		}
+		fb.Append(string(data))
+	default:
+		b.AppendNull()
+	}
+}
@@ -0,0 +1,244 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/opendataensemble/synkronus/pkg/config"
+)
+
+func TestService_ExportParquetZip_NestedColumns(t *testing.T) {
+	dir := t.TempDir()
+	formDir := filepath.Join(dir, "forms", "household")
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	schemaJSON := `{"type":"object","properties":{
+		"members":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}}}},
+		"tags":{"type":["array","null"],"items":{"type":"string"}},
+		"address":{"type":"object","properties":{"city":{"type":"string"},"verified":{"type":"boolean"}}},
+		"extra":{"type":"object"}
+	}}`
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schemaJSON), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	mockDB := &MockDatabaseInterface{
+		FormTypes: []string{"household"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"household": {
+				FormType: "household",
+				Columns: []FormTypeColumn{
+					{Key: "address", DataType: "object", SQLType: "text"},
+					{Key: "extra", DataType: "object", SQLType: "text"},
+					{Key: "members", DataType: "array", SQLType: "text"},
+					{Key: "tags", DataType: "array", SQLType: "text"},
+				},
+			},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"household": {
+				{
+					ObservationID: "obs1",
+					FormType:      "household",
+					FormVersion:   "1.0",
+					CreatedAt:     "2023-01-01T00:00:00Z",
+					UpdatedAt:     "2023-01-01T00:00:00Z",
+					Version:       1,
+					DataFields: map[string]interface{}{
+						"data_address": `{"city":"Kampala","verified":true}`,
+						"data_extra":   `{"note":"x"}`,
+						"data_members": `[{"name":"Ann","age":34},{"name":"Bob","age":7}]`,
+						"data_tags":    `["rural","tenant"]`,
+					},
+				},
+				{
+					ObservationID: "obs2",
+					FormType:      "household",
+					FormVersion:   "1.0",
+					CreatedAt:     "2023-01-02T00:00:00Z",
+					UpdatedAt:     "2023-01-02T00:00:00Z",
+					Version:       2,
+					DataFields: map[string]interface{}{
+						"data_members": `[]`,
+						"data_tags":    `not json`,
+					},
+				},
+			},
+		},
+	}
+
+	svc := NewService(mockDB, &config.Config{AppBundlePath: dir, ExportNestedColumns: true})
+	table := readExportedTable(t, svc, "household.parquet")
+	defer table.Release()
+
+	columns := map[string]arrow.Array{}
+	for i, field := range table.Schema().Fields() {
+		chunks := table.Column(i).Data().Chunks()
+		if len(chunks) != 1 {
+			t.Fatalf("Expected a single chunk for %s, got %d", field.Name, len(chunks))
+		}
+		columns[field.Name] = chunks[0]
+	}
+
+	members, ok := columns["data_members"].(*array.List)
+	if !ok {
+		t.Fatalf("Expected data_members to be a list column, got %s", columns["data_members"].DataType())
+	}
+	memberStructs := members.ListValues().(*array.Struct)
+	if memberStructs.Len() != 2 {
+		t.Fatalf("Expected 2 members in total, got %d", memberStructs.Len())
+	}
+	structType := memberStructs.DataType().(*arrow.StructType)
+	ageIdx, _ := structType.FieldIdx("age")
+	nameIdx, _ := structType.FieldIdx("name")
+	if got := memberStructs.Field(nameIdx).(*array.String).Value(1); got != "Bob" {
+		t.Errorf("Expected second member name Bob, got %q", got)
+	}
+	if got := memberStructs.Field(ageIdx).(*array.Float64).Value(0); got != 34 {
+		t.Errorf("Expected first member age 34, got %v", got)
+	}
+	if start, end := members.ValueOffsets(1); members.IsNull(1) || start != end {
+		t.Errorf("Expected an empty, non-null member list for obs2")
+	}
+
+	tags, ok := columns["data_tags"].(*array.List)
+	if !ok {
+		t.Fatalf("Expected data_tags to be a list column, got %s", columns["data_tags"].DataType())
+	}
+	if !tags.IsNull(1) {
+		t.Errorf("Expected unparseable tags to be null")
+	}
+
+	address, ok := columns["data_address"].(*array.Struct)
+	if !ok {
+		t.Fatalf("Expected data_address to be a struct column, got %s", columns["data_address"].DataType())
+	}
+	cityIdx, _ := address.DataType().(*arrow.StructType).FieldIdx("city")
+	if got := address.Field(cityIdx).(*array.String).Value(0); got != "Kampala" {
+		t.Errorf("Expected city Kampala, got %q", got)
+	}
+	if !address.IsNull(1) {
+		t.Errorf("Expected missing address to be null")
+	}
+
+	// Objects without declared properties stay JSON text
+	if _, ok := columns["data_extra"].(*array.String); !ok {
+		t.Errorf("Expected data_extra to stay a string column, got %s", columns["data_extra"].DataType())
+	}
+}
+
+func TestService_ExportParquetZip_NestedColumnsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	formDir := filepath.Join(dir, "forms", "household")
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	schemaJSON := `{"type":"object","properties":{"tags":{"type":"array","items":{"type":"string"}}}}`
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schemaJSON), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	mockDB := &MockDatabaseInterface{
+		FormTypes: []string{"household"},
+		FormTypeSchemas: map[string]*FormTypeSchema{
+			"household": {
+				FormType: "household",
+				Columns:  []FormTypeColumn{{Key: "tags", DataType: "array", SQLType: "text"}},
+			},
+		},
+		ObservationsData: map[string][]ObservationRow{
+			"household": {
+				{
+					ObservationID: "obs1",
+					FormType:      "household",
+					FormVersion:   "1.0",
+					CreatedAt:     "2023-01-01T00:00:00Z",
+					UpdatedAt:     "2023-01-01T00:00:00Z",
+					Version:       1,
+					DataFields:    map[string]interface{}{"data_tags": `["rural"]`},
+				},
+			},
+		},
+	}
+
+	svc := NewService(mockDB, &config.Config{AppBundlePath: dir})
+	table := readExportedTable(t, svc, "household.parquet")
+	defer table.Release()
+
+	idx := table.Schema().FieldIndices("data_tags")
+	if len(idx) != 1 {
+		t.Fatalf("Expected data_tags column")
+	}
+	if dt := table.Schema().Field(idx[0]).Type; dt.ID() != arrow.STRING {
+		t.Errorf("Expected data_tags to be a string column by default, got %s", dt)
+	}
+}
+
+// readExportedTable exports and reads back one Parquet file from the ZIP archive
+func readExportedTable(t *testing.T, svc Service, name string) arrow.Table {
+	t.Helper()
+	return readExportedTableAs(t, context.Background(), svc, name)
+}
+
+// readExportedTableAs exports with the given request context and reads one Parquet file
+func readExportedTableAs(t *testing.T, ctx context.Context, svc Service, name string) arrow.Table {
+	t.Helper()
+
+	rc, err := svc.ExportParquetZip(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer rc.Close()
+
+	zipData, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Failed to read ZIP data: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		t.Fatalf("Failed to parse ZIP file: %v", err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+
+		pf, err := file.NewParquetReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to open parquet file: %v", err)
+		}
+		fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		if err != nil {
+			t.Fatalf("Failed to create arrow reader: %v", err)
+		}
+		table, err := fr.ReadTable(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to read table: %v", err)
+		}
+		return table
+	}
+
+	t.Fatalf("Expected %s in export", name)
+	return nil
+}
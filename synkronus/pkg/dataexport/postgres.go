@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
 // postgresDB implements DatabaseInterface for PostgreSQL
@@ -26,6 +29,9 @@ func (p *postgresDB) GetFormTypes(ctx context.Context) ([]string, error) {
 		WHERE deleted = false 
 		ORDER BY form_type
 	`
+	if DeletionsIncluded(ctx) {
+		query = `SELECT DISTINCT form_type FROM observations ORDER BY form_type`
+	}
 
 	rows, err := p.db.QueryContext(ctx, query)
 	if err != nil {
@@ -49,6 +55,37 @@ func (p *postgresDB) GetFormTypes(ctx context.Context) ([]string, error) {
 	return formTypes, nil
 }
 
+// GetChangedFormTypes returns the distinct form types with observations changed in the
+// version range; deleted observations only count when ctx includes deletions
+func (p *postgresDB) GetChangedFormTypes(ctx context.Context, versions VersionRange) ([]string, error) {
+	deletedFilter := " AND deleted = false"
+	if DeletionsIncluded(ctx) {
+		deletedFilter = ""
+	}
+	query := `SELECT DISTINCT form_type FROM observations
+		WHERE version > $1 AND ($2 = 0 OR version <= $2)` + deletedFilter + `
+		ORDER BY form_type`
+
+	rows, err := p.db.QueryContext(ctx, query, versions.Since, versions.Until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query changed form types: %w", err)
+	}
+	defer rows.Close()
+
+	var formTypes []string
+	for rows.Next() {
+		var formType string
+		if err := rows.Scan(&formType); err != nil {
+			return nil, fmt.Errorf("failed to scan form type: %w", err)
+		}
+		formTypes = append(formTypes, formType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating changed form types: %w", err)
+	}
+	return formTypes, nil
+}
+
 // GetFormTypeSchema analyzes the JSON data structure for a form type and returns column definitions
 func (p *postgresDB) GetFormTypeSchema(ctx context.Context, formType string) (*FormTypeSchema, error) {
 	// Use the provided SQL query to analyze the data structure
@@ -141,20 +178,27 @@ func (p *postgresDB) GetFormTypeSchema(ctx context.Context, formType string) (*F
 
 // GetObservationsForFormType returns all observations for a specific form type with flattened data
 func (p *postgresDB) GetObservationsForFormType(ctx context.Context, formType string, schema *FormTypeSchema) ([]ObservationRow, error) {
-	// Build the dynamic SELECT clause for data fields
+	// Data keys come from pushed data, so they are bound as parameters and only appear in
+	// the query text as quoted aliases. Parameters $1 to $3 are the form type and the
+	// version range.
+	versions := VersionRangeOf(ctx)
+	args := []interface{}{formType, versions.Since, versions.Until}
 	var selectParts []string
 	for _, col := range schema.Columns {
+		args = append(args, col.Key)
+		value := "(data ->> $" + strconv.Itoa(len(args)) + ")"
+		alias := pq.QuoteIdentifier("data_" + col.Key)
 		switch col.SQLType {
 		case "numeric":
-			selectParts = append(selectParts, fmt.Sprintf("(data ->> '%s')::numeric AS data_%s", col.Key, col.Key))
+			selectParts = append(selectParts, value+"::numeric AS "+alias)
 		case "boolean":
-			selectParts = append(selectParts, fmt.Sprintf("(data ->> '%s')::boolean AS data_%s", col.Key, col.Key))
+			selectParts = append(selectParts, value+"::boolean AS "+alias)
 		case "adate":
 			// Adate strings in YYYY-MM-DD format are sortable as text
 			// The year-first format ensures proper chronological ordering
-			selectParts = append(selectParts, fmt.Sprintf("(data ->> '%s')::text AS data_%s", col.Key, col.Key))
+			selectParts = append(selectParts, value+"::text AS "+alias)
 		default:
-			selectParts = append(selectParts, fmt.Sprintf("(data ->> '%s')::text AS data_%s", col.Key, col.Key))
+			selectParts = append(selectParts, value+"::text AS "+alias)
 		}
 	}
 
@@ -163,6 +207,13 @@ func (p *postgresDB) GetObservationsForFormType(ctx context.Context, formType st
 		selectClause = ", " + strings.Join(selectParts, ", ")
 	}
 
+	// Delta exports include deleted observations so they can be removed downstream
+	deletedFilter := " AND deleted = false"
+	if DeletionsIncluded(ctx) {
+		deletedFilter = ""
+	}
+
+	// Rows come in server version order, which a reset device clock can't scramble
 	query := fmt.Sprintf(`
 		SELECT 
 			observation_id,
@@ -176,11 +227,12 @@ func (p *postgresDB) GetObservationsForFormType(ctx context.Context, formType st
 			geolocation
 			%s
 		FROM observations 
-		WHERE form_type = $1 AND deleted = false
-		ORDER BY created_at
-	`, selectClause)
+		WHERE form_type = $1%s
+		  AND version > $2 AND ($3 = 0 OR version <= $3)
+		ORDER BY version, observation_id
+	`, selectClause, deletedFilter)
 
-	rows, err := p.db.QueryContext(ctx, query, formType)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query observations for form type %s: %w", formType, err)
 	}
@@ -206,7 +206,8 @@ func TestPostgresDB_GetObservationsForFormType(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(`SELECT`).WithArgs(tt.formType).WillReturnRows(tt.mockRows)
+			mock.ExpectQuery(`\(data ->> \$4\)::text AS "data_question", \(data ->> \$5\)::numeric AS "data_rating"`).
+				WithArgs(tt.formType, int64(0), int64(0), "question", "rating").WillReturnRows(tt.mockRows)
 
 			observations, err := pgDB.GetObservationsForFormType(context.Background(), tt.formType, schema)
 
@@ -241,3 +242,133 @@ func TestPostgresDB_GetObservationsForFormType(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresDB_GetObservationsForFormType_VersionRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	pgDB := NewPostgresDB(db)
+	schema := &FormTypeSchema{FormType: "survey"}
+
+	mock.ExpectQuery(`AND version > \$2 AND \(\$3 = 0 OR version <= \$3\)`).
+		WithArgs("survey", int64(10), int64(20)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"observation_id", "form_type", "form_version", "created_at", "updated_at",
+			"synced_at", "deleted", "version", "geolocation",
+		}).AddRow("obs11", "survey", "1.0", "2023-01-01T00:00:00Z", "2023-01-01T00:00:00Z", nil, false, int64(11), nil))
+
+	ctx := WithVersionRange(context.Background(), VersionRange{Since: 10, Until: 20})
+	observations, err := pgDB.GetObservationsForFormType(ctx, "survey", schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(observations) != 1 || observations[0].Version != 11 {
+		t.Errorf("Expected only obs11, got %+v", observations)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDB_GetChangedFormTypes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	pgDB := NewPostgresDB(db)
+	mock.ExpectQuery(`SELECT DISTINCT form_type FROM observations\s+WHERE version > \$1 AND \(\$2 = 0 OR version <= \$2\) AND deleted = false`).
+		WithArgs(int64(10), int64(20)).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}).AddRow("survey"))
+	// Delta exports also count deletes as changes
+	mock.ExpectQuery(`WHERE version > \$1 AND \(\$2 = 0 OR version <= \$2\)\s+ORDER BY form_type`).
+		WithArgs(int64(10), int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}).AddRow("survey").AddRow("visit"))
+
+	formTypes, err := pgDB.GetChangedFormTypes(context.Background(), VersionRange{Since: 10, Until: 20})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(formTypes) != 1 || formTypes[0] != "survey" {
+		t.Errorf("Expected [survey], got %v", formTypes)
+	}
+	formTypes, err = pgDB.GetChangedFormTypes(WithDeletions(context.Background()), VersionRange{Since: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(formTypes) != 2 {
+		t.Errorf("Expected [survey visit], got %v", formTypes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDB_Deletions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	pgDB := NewPostgresDB(db)
+	ctx := WithDeletions(context.Background())
+
+	mock.ExpectQuery(`SELECT DISTINCT form_type FROM observations ORDER BY form_type`).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}).AddRow("survey"))
+	mock.ExpectQuery(`WHERE form_type = \$1\s+AND version > \$2`).
+		WithArgs("survey", int64(0), int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"observation_id", "form_type", "form_version", "created_at", "updated_at",
+			"synced_at", "deleted", "version", "geolocation",
+		}).AddRow("obs1", "survey", "1.0", "2023-01-01T00:00:00Z", "2023-01-02T00:00:00Z", nil, true, int64(3), nil))
+
+	if _, err := pgDB.GetFormTypes(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	observations, err := pgDB.GetObservationsForFormType(ctx, "survey", &FormTypeSchema{FormType: "survey"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(observations) != 1 || !observations[0].Deleted {
+		t.Errorf("Expected the deleted obs1, got %+v", observations)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDB_GetObservationsForFormType_HostileKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	pgDB := NewPostgresDB(db)
+	key := `x') AS a FROM observations; DROP TABLE observations; --"`
+	schema := &FormTypeSchema{FormType: "survey", Columns: []FormTypeColumn{{Key: key, SQLType: "text"}}}
+
+	// The key is only bound as a parameter; the alias quotes its double quote
+	mock.ExpectQuery(`\(data ->> \$4\)::text AS "data_x'\) AS a FROM observations; DROP TABLE observations; --"""\s+FROM observations`).
+		WithArgs("survey", int64(0), int64(0), key).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"observation_id", "form_type", "form_version", "created_at", "updated_at",
+			"synced_at", "deleted", "version", "geolocation", "data_x",
+		}).AddRow("obs1", "survey", "1.0", "2023-01-01T00:00:00Z", "2023-01-01T00:00:00Z", nil, false, int64(1), nil, "value"))
+
+	observations, err := pgDB.GetObservationsForFormType(context.Background(), "survey", schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(observations) != 1 || observations[0].DataFields["data_"+key] != "value" {
+		t.Errorf("Unexpected observations %+v", observations)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
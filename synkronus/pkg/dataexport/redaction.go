@@ -0,0 +1,54 @@
+package dataexport
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// anonymizeKey marks a context whose exports are redacted for every caller
+type anonymizeKey struct{}
+
+// WithAnonymization returns a context in which exports omit fields tagged x-sensitive
+// regardless of the caller's role
+func WithAnonymization(ctx context.Context) context.Context {
+	return context.WithValue(ctx, anonymizeKey{}, true)
+}
+
+// Anonymized reports whether ctx was marked with WithAnonymization
+func Anonymized(ctx context.Context) bool {
+	anonymized, _ := ctx.Value(anonymizeKey{}).(bool)
+	return anonymized
+}
+
+// redactSensitive reports whether fields tagged x-sensitive must be dropped from an
+// export for the caller in ctx. Only admins receive full data unless the export is
+// anonymized; exports requested without an authenticated user are server-internal
+// and are not redacted.
+func redactSensitive(ctx context.Context) bool {
+	if Anonymized(ctx) {
+		return true
+	}
+	user := authmw.GetUserFromContext(ctx)
+	return user != nil && user.Role != models.RoleAdmin
+}
+
+// redactColumns returns a copy of the schema without the sensitive columns
+func redactColumns(schema *FormTypeSchema, sensitive map[string]bool) *FormTypeSchema {
+	if len(sensitive) == 0 {
+		return schema
+	}
+
+	redacted := &FormTypeSchema{
+		FormType: schema.FormType,
+		Columns:  make([]FormTypeColumn, 0, len(schema.Columns)),
+	}
+	for _, col := range schema.Columns {
+		if !sensitive[col.Key] {
+			redacted.Columns = append(redacted.Columns, col)
+		}
+	}
+
+	return redacted
+}
@@ -0,0 +1,120 @@
+package dataexport
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/config"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+func TestService_ExportParquetZip_RedactsByRole(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPublicKey(t, dir)
+
+	formDir := filepath.Join(dir, "forms", "survey")
+	if err := os.MkdirAll(formDir, 0755); err != nil {
+		t.Fatalf("Failed to create form dir: %v", err)
+	}
+	schemaJSON := `{"type":"object","properties":{"name":{"type":"string"},"national_id":{"type":"string","x-sensitive":true}}}`
+	if err := os.WriteFile(filepath.Join(formDir, "schema.json"), []byte(schemaJSON), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	newDB := func() *MockDatabaseInterface {
+		return &MockDatabaseInterface{
+			FormTypes: []string{"survey"},
+			FormTypeSchemas: map[string]*FormTypeSchema{
+				"survey": {
+					FormType: "survey",
+					Columns: []FormTypeColumn{
+						{Key: "name", DataType: "string", SQLType: "text"},
+						{Key: "national_id", DataType: "string", SQLType: "text"},
+					},
+				},
+			},
+			ObservationsData: map[string][]ObservationRow{
+				"survey": {
+					{
+						ObservationID: "obs1",
+						FormType:      "survey",
+						FormVersion:   "1.0",
+						CreatedAt:     "2023-01-01T00:00:00Z",
+						UpdatedAt:     "2023-01-01T00:00:00Z",
+						Version:       1,
+						DataFields: map[string]interface{}{
+							"data_name":        "Alice",
+							"data_national_id": "CM123456",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		role          models.Role
+		withKey       bool
+		anonymize     bool
+		wantSensitive bool
+	}{
+		{name: "read-only user", role: models.RoleReadOnly, wantSensitive: false},
+		{name: "read-write user", role: models.RoleReadWrite, wantSensitive: false},
+		{name: "read-only user with encryption key", role: models.RoleReadOnly, withKey: true, wantSensitive: false},
+		{name: "admin", role: models.RoleAdmin, wantSensitive: true},
+		{name: "admin with anonymized export", role: models.RoleAdmin, anonymize: true, wantSensitive: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{AppBundlePath: dir}
+			if tc.withKey {
+				cfg.ExportPublicKeyPath = filepath.Join(dir, "export.pub")
+			}
+			svc := NewService(newDB(), cfg)
+
+			user := &models.User{Username: "tester", Role: tc.role}
+			ctx := context.WithValue(context.Background(), authmw.UserKey, user)
+			if tc.anonymize {
+				ctx = WithAnonymization(ctx)
+			}
+			table := readExportedTableAs(t, ctx, svc, "survey.parquet")
+			defer table.Release()
+
+			schema := table.Schema()
+			if len(schema.FieldIndices("data_name")) != 1 {
+				t.Errorf("Expected non-sensitive column data_name in export")
+			}
+			hasSensitive := len(schema.FieldIndices("data_national_id")) == 1
+			if hasSensitive != tc.wantSensitive {
+				t.Errorf("Expected data_national_id present=%v, got %v", tc.wantSensitive, hasSensitive)
+			}
+		})
+	}
+}
+
+func TestService_ExportParquetZip_NoUserIsNotRedacted(t *testing.T) {
+	schema := &FormTypeSchema{
+		FormType: "survey",
+		Columns: []FormTypeColumn{
+			{Key: "name", DataType: "string", SQLType: "text"},
+			{Key: "national_id", DataType: "string", SQLType: "text"},
+		},
+	}
+
+	if redactSensitive(context.Background()) {
+		t.Errorf("Expected exports without an authenticated user to be unredacted")
+	}
+
+	redacted := redactColumns(schema, map[string]bool{"national_id": true})
+	if len(redacted.Columns) != 1 || redacted.Columns[0].Key != "name" {
+		t.Errorf("Expected only the name column to remain, got %+v", redacted.Columns)
+	}
+	if len(schema.Columns) != 2 {
+		t.Errorf("Expected the original schema to be left untouched")
+	}
+}
@@ -0,0 +1,63 @@
+package dataexport
+
+import (
+	"context"
+
+	"github.com/opendataensemble/synkronus/pkg/database"
+)
+
+// retryDB retries the export queries of a DatabaseInterface that fail with connection errors
+type retryDB struct {
+	db    DatabaseInterface
+	retry *database.Retrier
+}
+
+// WithRetry wraps db so queries failing with connection errors, e.g. during a primary
+// failover, are retried. Exports read every row before writing a file, so a retried
+// query never produces a partial export.
+func WithRetry(db DatabaseInterface, retry *database.Retrier) DatabaseInterface {
+	if retry == nil {
+		return db
+	}
+	return &retryDB{db: db, retry: retry}
+}
+
+func (r *retryDB) GetFormTypes(ctx context.Context) ([]string, error) {
+	var formTypes []string
+	err := r.retry.Do(ctx, "export form types", func(ctx context.Context) error {
+		var err error
+		formTypes, err = r.db.GetFormTypes(ctx)
+		return err
+	})
+	return formTypes, err
+}
+
+func (r *retryDB) GetChangedFormTypes(ctx context.Context, versions VersionRange) ([]string, error) {
+	var formTypes []string
+	err := r.retry.Do(ctx, "export changed form types", func(ctx context.Context) error {
+		var err error
+		formTypes, err = r.db.GetChangedFormTypes(ctx, versions)
+		return err
+	})
+	return formTypes, err
+}
+
+func (r *retryDB) GetFormTypeSchema(ctx context.Context, formType string) (*FormTypeSchema, error) {
+	var schema *FormTypeSchema
+	err := r.retry.Do(ctx, "export schema", func(ctx context.Context) error {
+		var err error
+		schema, err = r.db.GetFormTypeSchema(ctx, formType)
+		return err
+	})
+	return schema, err
+}
+
+func (r *retryDB) GetObservationsForFormType(ctx context.Context, formType string, schema *FormTypeSchema) ([]ObservationRow, error) {
+	var rows []ObservationRow
+	err := r.retry.Do(ctx, "export observations", func(ctx context.Context) error {
+		var err error
+		rows, err = r.db.GetObservationsForFormType(ctx, formType, schema)
+		return err
+	})
+	return rows, err
+}
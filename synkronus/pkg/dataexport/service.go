@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -14,12 +15,33 @@ import (
 	"github.com/apache/arrow/go/v14/parquet"
 	"github.com/apache/arrow/go/v14/parquet/pqarrow"
 	"github.com/opendataensemble/synkronus/pkg/config"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Service defines the interface for data export operations
 type Service interface {
 	// ExportParquetZip exports observations data as a ZIP file containing Parquet files per form type
 	ExportParquetZip(ctx context.Context) (io.ReadCloser, error)
+
+	// ExportCSVZip exports observations data as a ZIP file containing a CSV file per form
+	// type, with the same columns as the Parquet files
+	ExportCSVZip(ctx context.Context) (io.ReadCloser, error)
+
+	// ExportDeltaZip exports the observations changed in the version range set with
+	// WithVersionRange as a ZIP file with a changes Parquet file per form type, whose op
+	// column says whether to upsert or delete each observation, and a manifest describing
+	// how to merge them into a base snapshot
+	ExportDeltaZip(ctx context.Context) (io.ReadCloser, error)
+
+	// ExportFHIR exports observations of form types with a fhir.json mapping in the app
+	// bundle as FHIR resources, one JSON resource per line (NDJSON)
+	ExportFHIR(ctx context.Context) (io.ReadCloser, error)
+
+	// ExportDuckDB exports observations as a DuckDB database file with one table per
+	// form type. Returns ErrDuckDBUnavailable unless built with the duckdb tag.
+	ExportDuckDB(ctx context.Context) (io.ReadCloser, error)
 }
 
 // service implements the Service interface
@@ -37,23 +59,52 @@ func NewService(db DatabaseInterface, cfg *config.Config) Service {
 }
 
 // ExportParquetZip exports observations data as a ZIP file containing Parquet files per form type
-func (s *service) ExportParquetZip(ctx context.Context) (io.ReadCloser, error) {
-	// Get all form types
-	formTypes, err := s.db.GetFormTypes(ctx)
+func (s *service) ExportParquetZip(ctx context.Context) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.ExportParquetZip")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	// Get all form types that may be exported
+	formTypes, err := s.exportedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up column encryption if a recipient key is configured
+	enc, err := s.exportEncryptor()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get form types: %w", err)
+		return nil, err
 	}
 
 	// Create ZIP buffer
 	zipBuffer := &bytes.Buffer{}
 	zipWriter := zip.NewWriter(zipBuffer)
+	manifest := &ExportManifest{Format: "parquet", Files: []ExportFile{}}
 
 	// Process each form type
 	for _, formType := range formTypes {
-		if err := s.exportFormTypeToZip(ctx, formType, zipWriter); err != nil {
+		file, err := s.exportFormTypeToZip(ctx, formType, zipWriter, enc)
+		if err != nil {
 			zipWriter.Close()
 			return nil, fmt.Errorf("failed to export form type %s: %w", formType, err)
 		}
+		if file != nil {
+			manifest.Files = append(manifest.Files, *file)
+		}
+	}
+
+	// Describe encrypted columns so the recipient can decrypt them
+	if enc != nil && len(enc.manifest.Files) > 0 {
+		if err := writeEncryptionManifest(zipWriter, enc.manifest); err != nil {
+			zipWriter.Close()
+			return nil, err
+		}
+	}
+
+	// List the files with their hashes so recipients can verify and deduplicate them
+	if err := writeExportManifest(zipWriter, manifest); err != nil {
+		zipWriter.Close()
+		return nil, err
 	}
 
 	// Close ZIP writer
@@ -65,38 +116,99 @@ func (s *service) ExportParquetZip(ctx context.Context) (io.ReadCloser, error) {
 	return io.NopCloser(bytes.NewReader(zipBuffer.Bytes())), nil
 }
 
-// exportFormTypeToZip exports a single form type as a parquet file to the ZIP archive
-func (s *service) exportFormTypeToZip(ctx context.Context, formType string, zipWriter *zip.Writer) error {
-	// Get schema for this form type
-	schema, err := s.db.GetFormTypeSchema(ctx, formType)
+// exportEncryptor returns the encryptor for sensitive columns, or nil when no recipient
+// key is configured
+func (s *service) exportEncryptor() (*fieldEncryptor, error) {
+	if s.config == nil || s.config.ExportPublicKeyPath == "" {
+		return nil, nil
+	}
+	pub, err := loadPublicKey(s.config.ExportPublicKeyPath)
 	if err != nil {
-		return fmt.Errorf("failed to get schema for form type %s: %w", formType, err)
+		return nil, err
 	}
+	return newFieldEncryptor(pub)
+}
 
-	// Get observations for this form type
-	observations, err := s.db.GetObservationsForFormType(ctx, formType, schema)
+// exportFormTypeToZip exports a single form type as a parquet file to the ZIP archive. It
+// returns nil when the form type has no observations.
+func (s *service) exportFormTypeToZip(ctx context.Context, formType string, zipWriter *zip.Writer, enc *fieldEncryptor) (_ *ExportFile, err error) {
+	ctx, span := tracing.Start(ctx, "dataexport.exportFormType", attribute.String("dataexport.form_type", formType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	filename := s.sanitizeFilename(formType) + ".parquet"
+	schema, observations, err := s.exportedRows(ctx, span, formType, filename, enc)
 	if err != nil {
-		return fmt.Errorf("failed to get observations for form type %s: %w", formType, err)
+		return nil, err
 	}
 
 	// Skip if no observations
 	if len(observations) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// Create parquet file in ZIP
-	filename := s.sanitizeFilename(formType) + ".parquet"
-	zipFile, err := zipWriter.Create(filename)
+	entry, err := createExportEntry(zipWriter, filename)
 	if err != nil {
-		return fmt.Errorf("failed to create ZIP file entry %s: %w", filename, err)
+		return nil, err
 	}
 
 	// Write parquet data
-	if err := s.writeParquetData(observations, schema, zipFile); err != nil {
-		return fmt.Errorf("failed to write parquet data for %s: %w", formType, err)
+	if err := s.writeParquetData(observations, schema, entry); err != nil {
+		return nil, fmt.Errorf("failed to write parquet data for %s: %w", formType, err)
 	}
 
-	return nil
+	return &ExportFile{FormType: formType, Path: filename, Rows: len(observations), Bytes: entry.bytes, SHA256: entry.sum()}, nil
+}
+
+// exportedRows returns the observations of a form type to write to the export file
+// filename, with the columns they are written with: fields withheld from exports are left
+// out, and sensitive fields are dropped or encrypted
+func (s *service) exportedRows(ctx context.Context, span trace.Span, formType, filename string, enc *fieldEncryptor) (*FormTypeSchema, []ObservationRow, error) {
+	// Get schema for this form type, without the fields withheld from exports
+	schema, err := s.exportedSchema(ctx, formType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Get observations for this form type
+	observations, err := s.db.GetObservationsForFormType(ctx, formType, schema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get observations for form type %s: %w", formType, err)
+	}
+
+	span.SetAttributes(attribute.Int("dataexport.row_count", len(observations)))
+
+	if len(observations) == 0 {
+		return schema, nil, nil
+	}
+	sortObservations(observations)
+
+	// Keep the structure of repeat groups and nested objects declared in the schema
+	if s.config != nil && s.config.ExportNestedColumns {
+		if schema, err = s.applyNestedColumns(formType, schema); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Fields tagged x-sensitive in the app bundle schema are dropped for non-admin
+	// callers and otherwise encrypted when a recipient key is configured
+	redact := redactSensitive(ctx)
+	if redact || enc != nil {
+		sensitive, err := s.sensitiveFields(formType)
+		if err != nil {
+			return nil, nil, err
+		}
+		if redact {
+			redacted := redactColumns(schema, sensitive)
+			span.SetAttributes(attribute.Int("dataexport.redacted_columns", len(schema.Columns)-len(redacted.Columns)))
+			schema = redacted
+		} else if schema, err = enc.encryptColumns(filename, schema, observations, sensitive); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt sensitive fields for %s: %w", formType, err)
+		}
+	}
+
+	return schema, observations, nil
 }
 
 // writeParquetData writes observation data as parquet format
@@ -111,11 +223,16 @@ func (s *service) writeParquetData(observations []ObservationRow, schema *FormTy
 	}
 	defer record.Release()
 
-	// Write as Parquet
-	props := parquet.NewWriterProperties()
+	return writeParquetRecord(record, writer)
+}
+
+// writeParquetRecord writes an Arrow record as a Parquet file. The writer is named without
+// the library version, so a library upgrade doesn't change the bytes of an export.
+func writeParquetRecord(record arrow.Record, writer io.Writer) error {
+	props := parquet.NewWriterProperties(parquet.WithCreatedBy(parquetCreatedBy))
 	arrowProps := pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema())
 
-	pqWriter, err := pqarrow.NewFileWriter(arrowSchema, writer, props, arrowProps)
+	pqWriter, err := pqarrow.NewFileWriter(record.Schema(), writer, props, arrowProps)
 	if err != nil {
 		return fmt.Errorf("failed to create parquet writer: %w", err)
 	}
@@ -146,10 +263,12 @@ func (s *service) buildArrowSchema(schema *FormTypeSchema) *arrow.Schema {
 	for _, col := range schema.Columns {
 		fieldName := "data_" + col.Key
 		var fieldType arrow.DataType
-		switch col.SQLType {
-		case "numeric":
+		switch {
+		case col.NestedType != nil:
+			fieldType = col.NestedType
+		case col.SQLType == "numeric":
 			fieldType = arrow.PrimitiveTypes.Float64
-		case "boolean":
+		case col.SQLType == "boolean":
 			fieldType = arrow.FixedWidthTypes.Boolean
 		default:
 			fieldType = arrow.BinaryTypes.String
@@ -209,6 +328,15 @@ func (s *service) buildArrowRecord(observations []ObservationRow, schema *FormTy
 				continue
 			}
 
+			if col.NestedType != nil {
+				if decoded, ok := decodeNestedValue(value); ok {
+					appendNestedValue(fieldBuilder, decoded)
+				} else {
+					fieldBuilder.AppendNull()
+				}
+				continue
+			}
+
 			switch col.SQLType {
 			case "numeric":
 				if fb, ok := fieldBuilder.(*array.Float64Builder); ok {
@@ -241,6 +369,25 @@ func (s *service) buildArrowRecord(observations []ObservationRow, schema *FormTy
 	return builder.NewRecord(), nil
 }
 
+// writeEncryptionManifest adds the encryption manifest to the ZIP archive
+func writeEncryptionManifest(zipWriter *zip.Writer, manifest *EncryptionManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal encryption manifest: %w", err)
+	}
+
+	entry, err := createExportEntry(zipWriter, EncryptionManifestName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write encryption manifest: %w", err)
+	}
+
+	return nil
+}
+
 // sanitizeFilename sanitizes a form type name for use as a filename
 func (s *service) sanitizeFilename(formType string) string {
 	// Replace invalid filename characters
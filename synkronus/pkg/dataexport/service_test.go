@@ -27,6 +27,23 @@ func (m *MockDatabaseInterface) GetFormTypes(ctx context.Context) ([]string, err
 	return m.FormTypes, nil
 }
 
+// GetChangedFormTypes returns the form types with observation data in the version range
+func (m *MockDatabaseInterface) GetChangedFormTypes(ctx context.Context, versions VersionRange) ([]string, error) {
+	if m.GetFormTypesError != nil {
+		return nil, m.GetFormTypesError
+	}
+	var changed []string
+	for _, formType := range m.FormTypes {
+		for _, row := range m.ObservationsData[formType] {
+			if row.Version > versions.Since && (versions.Until == 0 || row.Version <= versions.Until) && (!row.Deleted || DeletionsIncluded(ctx)) {
+				changed = append(changed, formType)
+				break
+			}
+		}
+	}
+	return changed, nil
+}
+
 func (m *MockDatabaseInterface) GetFormTypeSchema(ctx context.Context, formType string) (*FormTypeSchema, error) {
 	if m.GetSchemaError != nil {
 		return nil, m.GetSchemaError
@@ -110,7 +127,7 @@ func TestService_ExportParquetZip(t *testing.T) {
 					},
 				},
 			},
-			expectedFiles: []string{"survey.parquet", "inspection.parquet"},
+			expectedFiles: []string{"survey.parquet", "inspection.parquet", ExportManifestName},
 			expectError:   false,
 		},
 		{
@@ -120,7 +137,7 @@ func TestService_ExportParquetZip(t *testing.T) {
 				FormTypeSchemas:  map[string]*FormTypeSchema{},
 				ObservationsData: map[string][]ObservationRow{},
 			},
-			expectedFiles: []string{},
+			expectedFiles: []string{ExportManifestName},
 			expectError:   false,
 		},
 		{
@@ -137,7 +154,7 @@ func TestService_ExportParquetZip(t *testing.T) {
 					"empty_form": {},
 				},
 			},
-			expectedFiles: []string{},
+			expectedFiles: []string{ExportManifestName},
 			expectError:   false,
 		},
 	}
@@ -0,0 +1,58 @@
+package dataexport
+
+import "context"
+
+// VersionRange limits an export to observations whose sync version is after Since and
+// at most Until. Zero values leave that end open.
+type VersionRange struct {
+	Since int64
+	Until int64
+}
+
+// versionRangeKey marks a context whose exports are limited to a version range
+type versionRangeKey struct{}
+
+// WithVersionRange returns a context in which exports only include observations in the
+// version range, e.g. the changes since a downstream consumer's last load
+func WithVersionRange(ctx context.Context, versions VersionRange) context.Context {
+	return context.WithValue(ctx, versionRangeKey{}, versions)
+}
+
+// VersionRangeOf returns the version range of ctx; the zero range exports everything
+func VersionRangeOf(ctx context.Context) VersionRange {
+	versions, _ := ctx.Value(versionRangeKey{}).(VersionRange)
+	return versions
+}
+
+// formTypesKey marks a context whose exports are limited to some form types
+type formTypesKey struct{}
+
+// WithFormTypes returns a context in which exports only include the given form types, e.g.
+// the ones a scheduled pipeline loads; none leaves exports unfiltered
+func WithFormTypes(ctx context.Context, formTypes ...string) context.Context {
+	if len(formTypes) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, formTypesKey{}, formTypes)
+}
+
+// FormTypesOf returns the form types exports in ctx are limited to; nil exports all of them
+func FormTypesOf(ctx context.Context) []string {
+	formTypes, _ := ctx.Value(formTypesKey{}).([]string)
+	return formTypes
+}
+
+// deletionsKey marks a context whose exports include deleted observations
+type deletionsKey struct{}
+
+// WithDeletions returns a context in which exports also include deleted observations, so a
+// delta export can tell downstream systems to remove them
+func WithDeletions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deletionsKey{}, true)
+}
+
+// DeletionsIncluded reports whether exports in ctx include deleted observations
+func DeletionsIncluded(ctx context.Context) bool {
+	included, _ := ctx.Value(deletionsKey{}).(bool)
+	return included
+}
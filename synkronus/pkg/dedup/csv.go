@@ -0,0 +1,51 @@
+package dedup
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// csvHeader is the column layout of the CSV report, one row per duplicate pair
+var csvHeader = []string{
+	"cluster_id",
+	"form_type",
+	"observation_id",
+	"matched_observation_id",
+	"score",
+	"time_delta_seconds",
+	"distance_meters",
+}
+
+// WriteCSV writes the report as CSV with one row per duplicate pair
+func WriteCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, cluster := range report.Clusters {
+		for _, pair := range cluster.Pairs {
+			distance := ""
+			if pair.DistanceMeters != nil {
+				distance = strconv.FormatFloat(*pair.DistanceMeters, 'f', -1, 64)
+			}
+			record := []string{
+				strconv.Itoa(cluster.ID),
+				cluster.FormType,
+				pair.ObservationID,
+				pair.MatchedObservationID,
+				strconv.FormatFloat(pair.Score, 'f', -1, 64),
+				strconv.FormatInt(pair.TimeDeltaSeconds, 10),
+				distance,
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("failed to write CSV row: %w", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,443 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxMergeLosers caps the number of observations merged into a winner at once
+const MaxMergeLosers = 100
+
+var (
+	// ErrInvalidMerge is returned for a merge that can't be run
+	ErrInvalidMerge = errors.New("invalid merge")
+	// ErrObservationNotFound is returned when an observation of a merge doesn't exist or
+	// is already deleted
+	ErrObservationNotFound = errors.New("observation not found")
+)
+
+// MergeRequest merges duplicate observations into the one that is kept
+type MergeRequest struct {
+	// Winner is the observation that is kept
+	Winner string `json:"winner"`
+	// Losers are the duplicates merged into the winner
+	Losers []string `json:"losers"`
+	// Reason is recorded with the merge
+	Reason string `json:"reason,omitempty"`
+	// Force merges observations other users hold review locks on; the locks are reported
+	// in the result and stay in place
+	Force bool `json:"force,omitempty"`
+}
+
+// MergedAttachment is an attachment referenced by a loser's data
+type MergedAttachment struct {
+	AttachmentID string `json:"attachment_id"`
+	// From is the loser referencing the attachment
+	From string `json:"from"`
+	// Field is the data field holding the reference; dots separate nested objects
+	Field string `json:"field"`
+	// Moved is true when the field was copied to the winner, which had no value for it;
+	// otherwise the attachment stays referenced by the loser's tombstone only
+	Moved bool `json:"moved"`
+}
+
+// MergeResult is the outcome of a merge
+type MergeResult struct {
+	ID       int64    `json:"id"`
+	Winner   string   `json:"winner"`
+	Losers   []string `json:"losers"`
+	FormType string   `json:"form_type"`
+	// WinnerVersion is the winner's version after the merge; it only changes when
+	// attachments were moved to it
+	WinnerVersion int64              `json:"winner_version"`
+	Attachments   []MergedAttachment `json:"attachments"`
+	MergedBy      string             `json:"merged_by,omitempty"`
+	MergedAt      time.Time          `json:"merged_at"`
+	// OverriddenLocks are the review locks of other users a forced merge went past
+	OverriddenLocks []observationlock.Lock `json:"overridden_locks,omitempty"`
+}
+
+// mergedObservation is an observation taking part in a merge
+type mergedObservation struct {
+	id       string
+	formType string
+	deleted  bool
+	version  int64
+	data     json.RawMessage
+}
+
+// attachmentField is a data field of a loser holding attachment references
+type attachmentField struct {
+	path  []string
+	value interface{}
+	ids   []string
+}
+
+// validateMerge checks a merge request and returns the losers without duplicates
+func validateMerge(req MergeRequest) ([]string, error) {
+	if strings.TrimSpace(req.Winner) == "" {
+		return nil, fmt.Errorf("%w: winner is required", ErrInvalidMerge)
+	}
+	seen := map[string]bool{}
+	var losers []string
+	for _, id := range req.Losers {
+		if strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("%w: losers must not be empty strings", ErrInvalidMerge)
+		}
+		if id == req.Winner {
+			return nil, fmt.Errorf("%w: the winner can't also be a loser", ErrInvalidMerge)
+		}
+		if !seen[id] {
+			seen[id] = true
+			losers = append(losers, id)
+		}
+	}
+	if len(losers) == 0 {
+		return nil, fmt.Errorf("%w: at least one loser is required", ErrInvalidMerge)
+	}
+	if len(losers) > MaxMergeLosers {
+		return nil, fmt.Errorf("%w: at most %d losers can be merged at once", ErrInvalidMerge, MaxMergeLosers)
+	}
+	return losers, nil
+}
+
+// Merge keeps the winner and turns the losers into tombstones linked to it, in one
+// transaction. Attachment fields of the losers the winner has no value for are copied to
+// the winner. Every changed observation gets a new version, so devices pull the
+// tombstones and the updated winner.
+func (s *service) Merge(ctx context.Context, req MergeRequest, mergedBy string) (_ *MergeResult, err error) {
+	ctx, span := tracing.Start(ctx, "dedup.Merge",
+		attribute.String("observation.id", req.Winner),
+		attribute.Int("dedup.losers", len(req.Losers)),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	losers, err := validateMerge(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	observations, err := lockObservations(ctx, tx, append([]string{req.Winner}, losers...))
+	if err != nil {
+		return nil, err
+	}
+	winner := observations[req.Winner]
+	for _, id := range append([]string{req.Winner}, losers...) {
+		obs, ok := observations[id]
+		if !ok || obs.deleted {
+			return nil, fmt.Errorf("%w: %s", ErrObservationNotFound, id)
+		}
+		if obs.formType != winner.formType {
+			return nil, fmt.Errorf("%w: %s is a %s observation, the winner a %s one", ErrInvalidMerge, id, obs.formType, winner.formType)
+		}
+	}
+
+	// Taking a lock checks the observation's row, which is locked until the merge ends, so
+	// no lock can be taken between this read and the commit
+	locks, err := heldLocks(ctx, tx, append([]string{req.Winner}, losers...), mergedBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(locks) > 0 && !req.Force {
+		return nil, &observationlock.LockedError{Lock: locks[0]}
+	}
+
+	// Move the attachment fields of the losers the winner doesn't have
+	winnerData, ok := decodeObject(winner.data)
+	if !ok {
+		return nil, fmt.Errorf("%w: the winner's data is not a JSON object", ErrInvalidMerge)
+	}
+	attachments := []MergedAttachment{}
+	moved := false
+	for _, id := range losers {
+		fields, err := attachmentFields(ctx, tx, observations[id].data)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			fieldMoved := setIfAbsent(winnerData, field.path, field.value)
+			moved = moved || fieldMoved
+			for _, attachmentID := range field.ids {
+				attachments = append(attachments, MergedAttachment{
+					AttachmentID: attachmentID,
+					From:         id,
+					Field:        strings.Join(field.path, "."),
+					Moved:        fieldMoved,
+				})
+			}
+		}
+	}
+
+	count := len(losers)
+	if moved {
+		count++
+	}
+	var current int64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE sync_version SET current_version = current_version + $1, updated_at = NOW() WHERE id = 1 RETURNING current_version",
+		count).Scan(&current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve versions: %w", err)
+	}
+	version := current - int64(count) + 1
+
+	for _, id := range losers {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE observations SET deleted = true, merged_into = $1, updated_at = NOW(), version = $2 WHERE observation_id = $3",
+			req.Winner, version, id); err != nil {
+			return nil, fmt.Errorf("failed to mark %s merged: %w", id, err)
+		}
+		version++
+	}
+
+	result := &MergeResult{
+		Winner:        req.Winner,
+		Losers:        losers,
+		FormType:      winner.formType,
+		WinnerVersion: winner.version,
+		Attachments:   attachments,
+		MergedBy:      mergedBy,
+
+		OverriddenLocks: locks,
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "merged duplicates " + strings.Join(losers, ", ")
+	}
+	if moved {
+		after, err := json.Marshal(winnerData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the winner's data: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE observations SET data = $1, updated_at = NOW(), version = $2 WHERE observation_id = $3",
+			after, version, req.Winner); err != nil {
+			return nil, fmt.Errorf("failed to update %s: %w", req.Winner, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO observation_audit (observation_id, previous_version, version, data_before, data_after, changed_by, reason)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			req.Winner, winner.version, version, []byte(winner.data), after, nullString(mergedBy), reason); err != nil {
+			return nil, fmt.Errorf("failed to record audit entry for %s: %w", req.Winner, err)
+		}
+		result.WinnerVersion = version
+	}
+
+	encoded, err := json.Marshal(attachments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attachments: %w", err)
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO observation_merges (winner_id, loser_ids, form_type, attachments, reason, merged_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, merged_at`,
+		req.Winner, pq.Array(losers), winner.formType, encoded, nullString(req.Reason), nullString(mergedBy)).Scan(&result.ID, &result.MergedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record merge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if len(locks) > 0 {
+		s.log.Warn("Merge overrode review locks", "winner", req.Winner, "mergedBy", mergedBy, "locks", len(locks))
+	}
+	s.log.Info("Observations merged", "winner", req.Winner, "losers", losers, "mergedBy", mergedBy, "attachments", len(attachments))
+	return result, nil
+}
+
+// lockObservations reads the observations of a merge, locking their rows until the
+// transaction ends
+func lockObservations(ctx context.Context, tx *sql.Tx, ids []string) (map[string]mergedObservation, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT observation_id, form_type, deleted, version, data
+		FROM observations
+		WHERE observation_id = ANY($1)
+		ORDER BY observation_id
+		FOR UPDATE`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+	defer rows.Close()
+
+	observations := make(map[string]mergedObservation, len(ids))
+	for rows.Next() {
+		var obs mergedObservation
+		var data []byte
+		if err := rows.Scan(&obs.id, &obs.formType, &obs.deleted, &obs.version, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan observation: %w", err)
+		}
+		obs.data = data
+		observations[obs.id] = obs
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating observations: %w", err)
+	}
+	return observations, nil
+}
+
+// heldLocks returns the active review locks other users than username hold on the
+// observations, by observation ID
+func heldLocks(ctx context.Context, tx *sql.Tx, ids []string, username string) ([]observationlock.Lock, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT observation_id, owner, COALESCE(reason, ''), acquired_at, expires_at
+		FROM observation_locks
+		WHERE observation_id = ANY($1) AND owner <> $2 AND expires_at > NOW()
+		ORDER BY observation_id`,
+		pq.Array(ids), username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []observationlock.Lock
+	for rows.Next() {
+		var lock observationlock.Lock
+		if err := rows.Scan(&lock.ObservationID, &lock.Owner, &lock.Reason, &lock.AcquiredAt, &lock.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan observation lock: %w", err)
+		}
+		locks = append(locks, lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating observation locks: %w", err)
+	}
+	return locks, nil
+}
+
+// attachmentFields returns the fields of data holding references to stored attachments:
+// strings, or arrays of strings, that are attachment IDs. Fields are ordered by path.
+func attachmentFields(ctx context.Context, tx *sql.Tx, data json.RawMessage) ([]attachmentField, error) {
+	object, ok := decodeObject(data)
+	if !ok {
+		return nil, nil
+	}
+	var candidates []attachmentField
+	var walk func(object map[string]interface{}, path []string)
+	walk = func(object map[string]interface{}, path []string) {
+		for key, value := range object {
+			fieldPath := append(append([]string{}, path...), key)
+			switch v := value.(type) {
+			case string:
+				candidates = append(candidates, attachmentField{path: fieldPath, value: v, ids: []string{v}})
+			case []interface{}:
+				var ids []string
+				for _, item := range v {
+					if id, ok := item.(string); ok {
+						ids = append(ids, id)
+					}
+				}
+				if len(ids) > 0 {
+					candidates = append(candidates, attachmentField{path: fieldPath, value: v, ids: ids})
+				}
+			case map[string]interface{}:
+				walk(v, fieldPath)
+			}
+		}
+	}
+	walk(object, nil)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var values []string
+	for _, candidate := range candidates {
+		values = append(values, candidate.ids...)
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT attachment_id FROM attachments WHERE attachment_id = ANY($1)", pq.Array(values))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+	stored := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		stored[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachments: %w", err)
+	}
+
+	var fields []attachmentField
+	for _, candidate := range candidates {
+		var ids []string
+		for _, id := range candidate.ids {
+			if stored[id] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			candidate.ids = ids
+			fields = append(fields, candidate)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return strings.Join(fields[i].path, ".") < strings.Join(fields[j].path, ".")
+	})
+	return fields, nil
+}
+
+// setIfAbsent sets the field at path to value when object has no value there, creating
+// missing objects on the way; a path through a non-object value is left alone
+func setIfAbsent(object map[string]interface{}, path []string, value interface{}) bool {
+	for _, key := range path[:len(path)-1] {
+		next, exists := object[key]
+		if !exists || next == nil {
+			child := map[string]interface{}{}
+			object[key] = child
+			object = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		object = child
+	}
+	key := path[len(path)-1]
+	if current, exists := object[key]; exists && current != nil && current != "" {
+		return false
+	}
+	object[key] = value
+	return true
+}
+
+// decodeObject parses observation data, keeping numbers as written
+func decodeObject(data json.RawMessage) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// nullString returns nil for an empty string, so it is stored as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
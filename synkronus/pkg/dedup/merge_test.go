@@ -0,0 +1,200 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+)
+
+var (
+	mergeColumns = []string{"observation_id", "form_type", "deleted", "version", "data"}
+	lockColumns  = []string{"observation_id", "owner", "reason", "acquired_at", "expires_at"}
+)
+
+func TestService_Merge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT observation_id, form_type, deleted, version, data\s+FROM observations\s+WHERE observation_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"obs1", "obs2", "obs3"})).
+		WillReturnRows(sqlmock.NewRows(mergeColumns).
+			AddRow("obs1", "household", false, int64(5), []byte(`{"name":"Ann","photo":""}`)).
+			AddRow("obs2", "household", false, int64(6), []byte(`{"name":"Ann","photo":"att-1","extra":{"sig":"att-2"}}`)).
+			AddRow("obs3", "household", false, int64(7), []byte(`{"name":"ann"}`)))
+	// The merging admin's own lock doesn't stop the merge
+	mock.ExpectQuery(`SELECT observation_id, owner, .* FROM observation_locks\s+WHERE observation_id = ANY\(\$1\) AND owner <> \$2 AND expires_at > NOW\(\)`).
+		WithArgs(pq.Array([]string{"obs1", "obs2", "obs3"}), "admin").
+		WillReturnRows(sqlmock.NewRows(lockColumns))
+	// Only stored attachments count; the other strings of the data are plain values
+	mock.ExpectQuery(`SELECT attachment_id FROM attachments WHERE attachment_id = ANY\(\$1\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}).AddRow("att-1").AddRow("att-2"))
+	mock.ExpectQuery(`SELECT attachment_id FROM attachments`).
+		WithArgs(pq.Array([]string{"ann"})).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}))
+	mock.ExpectQuery(`UPDATE sync_version SET current_version = current_version \+ \$1`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(13)))
+	mock.ExpectExec(`UPDATE observations SET deleted = true, merged_into = \$1`).
+		WithArgs("obs1", int64(11), "obs2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE observations SET deleted = true, merged_into = \$1`).
+		WithArgs("obs1", int64(12), "obs3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE observations SET data = \$1`).
+		WithArgs([]byte(`{"extra":{"sig":"att-2"},"name":"Ann","photo":"att-1"}`), int64(13), "obs1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observation_audit`).
+		WithArgs("obs1", int64(5), int64(13), sqlmock.AnyArg(), sqlmock.AnyArg(), "admin", "same household").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO observation_merges`).
+		WithArgs("obs1", pq.Array([]string{"obs2", "obs3"}), "household", sqlmock.AnyArg(), "same household", "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "merged_at"}).AddRow(int64(1), now))
+	mock.ExpectCommit()
+
+	// Duplicate losers are merged once
+	result, err := svc.Merge(context.Background(), MergeRequest{Winner: "obs1", Losers: []string{"obs2", "obs3", "obs2"}, Reason: "same household"}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ID != 1 || result.WinnerVersion != 13 || result.FormType != "household" || len(result.Losers) != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if len(result.Attachments) != 2 {
+		t.Fatalf("Expected 2 attachments, got %+v", result.Attachments)
+	}
+	if a := result.Attachments[0]; a.AttachmentID != "att-2" || a.Field != "extra.sig" || a.From != "obs2" || !a.Moved {
+		t.Errorf("Unexpected attachment %+v", a)
+	}
+	if a := result.Attachments[1]; a.AttachmentID != "att-1" || a.Field != "photo" || !a.Moved {
+		t.Errorf("Unexpected attachment %+v", a)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Merge_Rejected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	ctx := context.Background()
+
+	for _, req := range []MergeRequest{
+		{Losers: []string{"obs2"}},
+		{Winner: "obs1"},
+		{Winner: "obs1", Losers: []string{"obs1"}},
+		{Winner: "obs1", Losers: []string{""}},
+	} {
+		if _, err := svc.Merge(ctx, req, "admin"); !errors.Is(err, ErrInvalidMerge) {
+			t.Errorf("Merge(%+v): expected ErrInvalidMerge, got %v", req, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows
+		expected error
+	}{
+		{
+			name:     "missing loser",
+			rows:     sqlmock.NewRows(mergeColumns).AddRow("obs1", "household", false, int64(1), []byte(`{}`)),
+			expected: ErrObservationNotFound,
+		},
+		{
+			name: "deleted loser",
+			rows: sqlmock.NewRows(mergeColumns).
+				AddRow("obs1", "household", false, int64(1), []byte(`{}`)).
+				AddRow("obs2", "household", true, int64(2), []byte(`{}`)),
+			expected: ErrObservationNotFound,
+		},
+		{
+			name: "other form type",
+			rows: sqlmock.NewRows(mergeColumns).
+				AddRow("obs1", "household", false, int64(1), []byte(`{}`)).
+				AddRow("obs2", "survey", false, int64(2), []byte(`{}`)),
+			expected: ErrInvalidMerge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT observation_id, form_type, deleted, version, data`).WillReturnRows(tt.rows)
+			mock.ExpectRollback()
+			if _, err := svc.Merge(ctx, MergeRequest{Winner: "obs1", Losers: []string{"obs2"}}, "admin"); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestService_Merge_Locked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	expectLocked := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT observation_id, form_type, deleted, version, data`).
+			WillReturnRows(sqlmock.NewRows(mergeColumns).
+				AddRow("obs1", "household", false, int64(1), []byte(`{"name":"Ann"}`)).
+				AddRow("obs2", "household", false, int64(2), []byte(`{"name":"Ann"}`)))
+		mock.ExpectQuery(`FROM observation_locks`).
+			WithArgs(pq.Array([]string{"obs1", "obs2"}), "admin").
+			WillReturnRows(sqlmock.NewRows(lockColumns).AddRow("obs2", "alice", "checking ages", now, now.Add(time.Hour)))
+	}
+
+	// Another reviewer's lock refuses the merge before anything changes
+	expectLocked()
+	mock.ExpectRollback()
+	_, err = svc.Merge(ctx, MergeRequest{Winner: "obs1", Losers: []string{"obs2"}}, "admin")
+	var locked *observationlock.LockedError
+	if !errors.As(err, &locked) || locked.Lock.ObservationID != "obs2" || locked.Lock.Owner != "alice" {
+		t.Fatalf("Expected obs2 to be locked by alice, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	// Forcing the merge goes past the lock and reports it
+	expectLocked()
+	mock.ExpectQuery(`SELECT attachment_id FROM attachments`).WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}))
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(10)))
+	mock.ExpectExec(`UPDATE observations SET deleted = true`).WithArgs("obs1", int64(10), "obs2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO observation_merges`).WillReturnRows(sqlmock.NewRows([]string{"id", "merged_at"}).AddRow(int64(2), now))
+	mock.ExpectCommit()
+	result, err := svc.Merge(ctx, MergeRequest{Winner: "obs1", Losers: []string{"obs2"}, Force: true}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.OverriddenLocks) != 1 || result.OverriddenLocks[0].Owner != "alice" {
+		t.Errorf("Expected alice's lock to be reported, got %+v", result.OverriddenLocks)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
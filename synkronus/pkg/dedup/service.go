@@ -0,0 +1,379 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// earthRadiusMeters is the mean Earth radius used for haversine distances
+const earthRadiusMeters = 6371000.0
+
+// Config contains the default duplicate-detection heuristics
+type Config struct {
+	// TimeWindow is how far apart two observations of the same form may have been
+	// created and still be compared
+	TimeWindow time.Duration
+	// MaxDistanceMeters excludes pairs whose geolocations are farther apart; 0 ignores location
+	MaxDistanceMeters float64
+	// MinScore is the data similarity (0..1) at which a pair is reported
+	MinScore float64
+	// MaxObservations caps how many observations a report scans
+	MaxObservations int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		TimeWindow:        24 * time.Hour,
+		MaxDistanceMeters: 50,
+		MinScore:          0.9,
+		MaxObservations:   50000,
+	}
+}
+
+// Query selects the observations to scan and overrides the configured heuristics
+type Query struct {
+	FormType          string
+	From              *time.Time // inclusive, by created_at
+	To                *time.Time // exclusive, by created_at
+	Fields            []string   // data fields to compare; all fields when empty
+	TimeWindow        *time.Duration
+	MaxDistanceMeters *float64
+	MinScore          *float64
+}
+
+// Pair is two observations judged to be probable duplicates
+type Pair struct {
+	ObservationID        string   `json:"observation_id"`
+	MatchedObservationID string   `json:"matched_observation_id"`
+	Score                float64  `json:"score"`
+	TimeDeltaSeconds     int64    `json:"time_delta_seconds"`
+	DistanceMeters       *float64 `json:"distance_meters,omitempty"`
+}
+
+// Cluster is a group of observations connected by duplicate pairs
+type Cluster struct {
+	ID             int      `json:"id"`
+	FormType       string   `json:"form_type"`
+	ObservationIDs []string `json:"observation_ids"`
+	MaxScore       float64  `json:"max_score"`
+	Pairs          []Pair   `json:"pairs"`
+}
+
+// Report lists probable duplicate clusters for review
+type Report struct {
+	ObservationsScanned int `json:"observations_scanned"`
+	// Truncated is true when MaxObservations was reached and later observations were not scanned
+	Truncated         bool      `json:"truncated"`
+	MinScore          float64   `json:"min_score"`
+	TimeWindowHours   float64   `json:"time_window_hours"`
+	MaxDistanceMeters float64   `json:"max_distance_meters"`
+	Fields            []string  `json:"fields,omitempty"`
+	Clusters          []Cluster `json:"clusters"`
+	GeneratedAt       time.Time `json:"generated_at"`
+}
+
+// Service detects probable duplicate observations across existing data
+type Service interface {
+	// Report scans observations and returns clusters of probable duplicates
+	Report(ctx context.Context, query Query) (*Report, error)
+	// Merge keeps the winner of req and turns the losers into tombstones merged into it
+	Merge(ctx context.Context, req MergeRequest, mergedBy string) (*MergeResult, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new deduplication service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// observation is the part of an observation the heuristics look at
+type observation struct {
+	id        string
+	formType  string
+	createdAt time.Time
+	data      map[string]interface{}
+	lat, lon  float64
+	located   bool
+}
+
+// Report scans observations and returns clusters of probable duplicates
+func (s *service) Report(ctx context.Context, query Query) (_ *Report, err error) {
+	ctx, span := tracing.Start(ctx, "dedup.Report", attribute.String("dedup.form_type", query.FormType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	window := s.config.TimeWindow
+	if query.TimeWindow != nil {
+		window = *query.TimeWindow
+	}
+	maxDistance := s.config.MaxDistanceMeters
+	if query.MaxDistanceMeters != nil {
+		maxDistance = *query.MaxDistanceMeters
+	}
+	minScore := s.config.MinScore
+	if query.MinScore != nil {
+		minScore = *query.MinScore
+	}
+
+	observations, truncated, err := s.loadObservations(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("dedup.observations_scanned", len(observations)))
+
+	var pairs []Pair
+	for start := 0; start < len(observations); {
+		// Observations are ordered by form type, so each form is a contiguous run
+		end := start
+		for end < len(observations) && observations[end].formType == observations[start].formType {
+			end++
+		}
+		pairs = append(pairs, findPairs(observations[start:end], query.Fields, window, maxDistance, minScore)...)
+		start = end
+	}
+
+	report := &Report{
+		ObservationsScanned: len(observations),
+		Truncated:           truncated,
+		MinScore:            minScore,
+		TimeWindowHours:     window.Hours(),
+		MaxDistanceMeters:   maxDistance,
+		Fields:              query.Fields,
+		Clusters:            buildClusters(observations, pairs),
+		GeneratedAt:         time.Now().UTC(),
+	}
+	span.SetAttributes(attribute.Int("dedup.clusters", len(report.Clusters)))
+
+	return report, nil
+}
+
+// loadObservations reads live observations ordered by form type and creation time
+func (s *service) loadObservations(ctx context.Context, query Query) ([]observation, bool, error) {
+	sqlQuery := `SELECT observation_id, form_type, created_at, data, geolocation
+		FROM observations
+		WHERE NOT deleted`
+	var args []interface{}
+	if query.FormType != "" {
+		args = append(args, query.FormType)
+		sqlQuery += fmt.Sprintf(" AND form_type = $%d", len(args))
+	}
+	if query.From != nil {
+		args = append(args, *query.From)
+		sqlQuery += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if query.To != nil {
+		args = append(args, *query.To)
+		sqlQuery += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	args = append(args, s.config.MaxObservations+1)
+	sqlQuery += fmt.Sprintf(" ORDER BY form_type, created_at, observation_id LIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query observations: %w", err)
+	}
+	defer rows.Close()
+
+	var observations []observation
+	for rows.Next() {
+		var obs observation
+		var data []byte
+		var geolocation []byte
+		if err := rows.Scan(&obs.id, &obs.formType, &obs.createdAt, &data, &geolocation); err != nil {
+			return nil, false, fmt.Errorf("failed to scan observation: %w", err)
+		}
+		if err := json.Unmarshal(data, &obs.data); err != nil {
+			s.log.Warn("Skipping observation with invalid data", "observationId", obs.id, "error", err)
+			continue
+		}
+		obs.lat, obs.lon, obs.located = parseGeolocation(geolocation)
+		observations = append(observations, obs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to read observations: %w", err)
+	}
+
+	truncated := len(observations) > s.config.MaxObservations
+	if truncated {
+		observations = observations[:s.config.MaxObservations]
+	}
+	return observations, truncated, nil
+}
+
+// findPairs compares observations of one form type created within window of each other
+func findPairs(observations []observation, fields []string, window time.Duration, maxDistance, minScore float64) []Pair {
+	var pairs []Pair
+	for i := range observations {
+		a := &observations[i]
+		for j := i + 1; j < len(observations); j++ {
+			b := &observations[j]
+			delta := b.createdAt.Sub(a.createdAt)
+			if delta > window {
+				break
+			}
+
+			var distance *float64
+			if a.located && b.located {
+				d := haversine(a.lat, a.lon, b.lat, b.lon)
+				if maxDistance > 0 && d > maxDistance {
+					continue
+				}
+				d = math.Round(d*10) / 10
+				distance = &d
+			}
+
+			score := similarity(a.data, b.data, fields)
+			if score < minScore {
+				continue
+			}
+			pairs = append(pairs, Pair{
+				ObservationID:        a.id,
+				MatchedObservationID: b.id,
+				Score:                math.Round(score*1000) / 1000,
+				TimeDeltaSeconds:     int64(delta / time.Second),
+				DistanceMeters:       distance,
+			})
+		}
+	}
+	return pairs
+}
+
+// similarity is the fraction of compared fields whose values are equal. Fields missing
+// from both observations are ignored; strings are compared case-insensitively.
+func similarity(a, b map[string]interface{}, fields []string) float64 {
+	if len(fields) == 0 {
+		seen := make(map[string]bool, len(a)+len(b))
+		for key := range a {
+			seen[key] = true
+		}
+		for key := range b {
+			seen[key] = true
+		}
+		for key := range seen {
+			fields = append(fields, key)
+		}
+	}
+
+	compared, matched := 0, 0
+	for _, field := range fields {
+		va, okA := a[field]
+		vb, okB := b[field]
+		if !okA && !okB {
+			continue
+		}
+		compared++
+		if okA && okB && normalize(va) == normalize(vb) {
+			matched++
+		}
+	}
+	if compared == 0 {
+		return 0
+	}
+	return float64(matched) / float64(compared)
+}
+
+// normalize renders a JSON value for comparison
+func normalize(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return "s:" + strings.ToLower(strings.TrimSpace(s))
+	}
+	encoded, _ := json.Marshal(value)
+	return "j:" + string(encoded)
+}
+
+// parseGeolocation extracts latitude and longitude from the geolocation column
+func parseGeolocation(raw []byte) (float64, float64, bool) {
+	if len(raw) == 0 {
+		return 0, 0, false
+	}
+	var geo struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal(raw, &geo); err != nil || geo.Latitude == nil || geo.Longitude == nil {
+		return 0, 0, false
+	}
+	return *geo.Latitude, *geo.Longitude, true
+}
+
+// haversine returns the great-circle distance in meters between two coordinates
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// buildClusters groups observations connected by pairs, ordered by their earliest observation
+func buildClusters(observations []observation, pairs []Pair) []Cluster {
+	parent := make(map[string]string)
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	for _, pair := range pairs {
+		for _, id := range []string{pair.ObservationID, pair.MatchedObservationID} {
+			if _, ok := parent[id]; !ok {
+				parent[id] = id
+			}
+		}
+		parent[find(pair.MatchedObservationID)] = find(pair.ObservationID)
+	}
+
+	clusters := []Cluster{}
+	index := make(map[string]int)
+	for _, obs := range observations {
+		if _, ok := parent[obs.id]; !ok {
+			continue
+		}
+		root := find(obs.id)
+		i, ok := index[root]
+		if !ok {
+			i = len(clusters)
+			index[root] = i
+			clusters = append(clusters, Cluster{FormType: obs.formType})
+		}
+		clusters[i].ObservationIDs = append(clusters[i].ObservationIDs, obs.id)
+	}
+	for _, pair := range pairs {
+		c := &clusters[index[find(pair.ObservationID)]]
+		c.Pairs = append(c.Pairs, pair)
+		if pair.Score > c.MaxScore {
+			c.MaxScore = pair.Score
+		}
+	}
+
+	// Most certain clusters first, keeping the scan order for ties
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].MaxScore > clusters[j].MaxScore
+	})
+	for i := range clusters {
+		clusters[i].ID = i + 1
+	}
+	return clusters
+}
@@ -0,0 +1,160 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var observationColumns = []string{"observation_id", "form_type", "created_at", "data", "geolocation"}
+
+func TestService_Report(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	base := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	here := []byte(`{"latitude":0.3476,"longitude":32.5825}`)
+	nearby := []byte(`{"latitude":0.3477,"longitude":32.5825}`) // ~11 m away
+	farAway := []byte(`{"latitude":0.4476,"longitude":32.5825}`)
+
+	rows := sqlmock.NewRows(observationColumns).
+		// obs1, obs2 and obs3 chain into one cluster; obs2 differs only in name casing
+		AddRow("obs1", "household", base, []byte(`{"name":"Ann","members":4,"village":"Kira"}`), here).
+		AddRow("obs2", "household", base.Add(time.Hour), []byte(`{"name":"ann ","members":4,"village":"Kira"}`), nearby).
+		AddRow("obs3", "household", base.Add(2*time.Hour), []byte(`{"name":"Ann","members":4,"village":"Kira"}`), here).
+		// Same data but too far away
+		AddRow("obs4", "household", base.Add(3*time.Hour), []byte(`{"name":"Ann","members":4,"village":"Kira"}`), farAway).
+		// Same data but outside the time window of obs3
+		AddRow("obs5", "household", base.Add(72*time.Hour), []byte(`{"name":"Ann","members":4,"village":"Kira"}`), nil).
+		// Different data
+		AddRow("obs6", "household", base.Add(72*time.Hour+time.Minute), []byte(`{"name":"Bob","members":2,"village":"Kira"}`), nil).
+		// Other form types are never compared with household
+		AddRow("obs7", "survey", base, []byte(`{"name":"Ann","members":4,"village":"Kira"}`), nil)
+	mock.ExpectQuery(`SELECT observation_id, form_type, created_at, data, geolocation\s+FROM observations\s+WHERE NOT deleted ORDER BY form_type, created_at, observation_id LIMIT \$1`).
+		WithArgs(50001).
+		WillReturnRows(rows)
+
+	report, err := svc.Report(context.Background(), Query{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if report.ObservationsScanned != 7 || report.Truncated {
+		t.Errorf("Expected 7 observations scanned without truncation, got %d (truncated=%v)", report.ObservationsScanned, report.Truncated)
+	}
+	if len(report.Clusters) != 1 {
+		t.Fatalf("Expected 1 cluster, got %d: %+v", len(report.Clusters), report.Clusters)
+	}
+	cluster := report.Clusters[0]
+	if strings.Join(cluster.ObservationIDs, ",") != "obs1,obs2,obs3" {
+		t.Errorf("Expected cluster obs1,obs2,obs3, got %v", cluster.ObservationIDs)
+	}
+	if cluster.ID != 1 || cluster.FormType != "household" || cluster.MaxScore != 1 {
+		t.Errorf("Unexpected cluster metadata: %+v", cluster)
+	}
+	if len(cluster.Pairs) != 3 {
+		t.Fatalf("Expected 3 pairs, got %+v", cluster.Pairs)
+	}
+	first := cluster.Pairs[0]
+	if first.ObservationID != "obs1" || first.MatchedObservationID != "obs2" || first.TimeDeltaSeconds != 3600 {
+		t.Errorf("Unexpected first pair: %+v", first)
+	}
+	if first.DistanceMeters == nil || *first.DistanceMeters < 10 || *first.DistanceMeters > 12 {
+		t.Errorf("Expected a distance of about 11 m, got %v", first.DistanceMeters)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, report); err != nil {
+		t.Fatalf("Unexpected CSV error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected header and 3 rows, got %q", buf.String())
+	}
+	if lines[0] != "cluster_id,form_type,observation_id,matched_observation_id,score,time_delta_seconds,distance_meters" {
+		t.Errorf("Unexpected CSV header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "1,household,obs1,obs2,1,3600,1") {
+		t.Errorf("Unexpected CSV row %q", lines[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Report_QueryOverrides(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.MaxObservations = 2
+	svc := NewService(db, config, logger.NewLogger())
+
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	base := from.Add(time.Hour)
+	rows := sqlmock.NewRows(observationColumns).
+		AddRow("obs1", "household", base, []byte(`{"name":"Ann","members":4,"notes":"first"}`), nil).
+		AddRow("obs2", "household", base.Add(time.Minute), []byte(`{"name":"Ann","members":4,"notes":"second"}`), nil).
+		AddRow("obs3", "household", base.Add(2*time.Minute), []byte(`{"name":"Ann","members":4,"notes":"third"}`), nil)
+	mock.ExpectQuery(`WHERE NOT deleted AND form_type = \$1 AND created_at >= \$2 AND created_at < \$3 ORDER BY`).
+		WithArgs("household", from, to, 3).
+		WillReturnRows(rows)
+
+	// Comparing only name and members makes obs1 and obs2 identical
+	minScore := 0.5
+	report, err := svc.Report(context.Background(), Query{
+		FormType: "household",
+		From:     &from,
+		To:       &to,
+		Fields:   []string{"name", "members"},
+		MinScore: &minScore,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !report.Truncated || report.ObservationsScanned != 2 {
+		t.Errorf("Expected the scan to be truncated at 2 observations, got %d (truncated=%v)", report.ObservationsScanned, report.Truncated)
+	}
+	if report.MinScore != 0.5 {
+		t.Errorf("Expected min_score override to be reported, got %v", report.MinScore)
+	}
+	if len(report.Clusters) != 1 || len(report.Clusters[0].Pairs) != 1 || report.Clusters[0].Pairs[0].Score != 1 {
+		t.Errorf("Expected one exact pair, got %+v", report.Clusters)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := map[string]interface{}{"name": "Ann", "age": float64(30), "tags": []interface{}{"x"}}
+	b := map[string]interface{}{"name": " ANN", "age": float64(31), "tags": []interface{}{"x"}, "extra": true}
+
+	// name and tags match; age differs; extra is only in b
+	if got := similarity(a, b, nil); got != 0.5 {
+		t.Errorf("Expected similarity 0.5, got %v", got)
+	}
+	if got := similarity(a, b, []string{"name", "tags"}); got != 1 {
+		t.Errorf("Expected similarity 1 on selected fields, got %v", got)
+	}
+	if got := similarity(a, b, []string{"missing"}); got != 0 {
+		t.Errorf("Expected similarity 0 when no field is present, got %v", got)
+	}
+}
@@ -0,0 +1,395 @@
+// Package demo seeds an install with sample data: an app bundle with a household survey,
+// one user per role, and synthetic observations with photo attachments. The data depends
+// only on the configuration, so evaluation installs and end-to-end tests start from the
+// same state every time. Seeding is idempotent; data that is already there is left alone.
+package demo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"github.com/opendataensemble/synkronus/pkg/user"
+)
+
+//go:embed bundle
+var bundleFS embed.FS
+
+const (
+	// FormType is the form of the sample app bundle the observations are made with
+	FormType = "household"
+	// ClientID is recorded as the client that pushed the observations
+	ClientID = "demo-seed"
+
+	observationPrefix = "demo-household-"
+)
+
+// Usernames of the demo users, one per role
+const (
+	AdminUsername     = "demo-admin"
+	CollectorUsername = "demo-collector"
+	ViewerUsername    = "demo-viewer"
+)
+
+// Config contains demo seeding configuration
+type Config struct {
+	// Password is the password of every demo user
+	Password string
+	// Observations is the number of synthetic observations
+	Observations int
+	// PhotoEvery attaches a photo to every n-th observation; 0 attaches none
+	PhotoEvery int
+	// Seed drives the synthetic data; the same seed gives the same data
+	Seed uint64
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Password:     "demo",
+		Observations: 24,
+		PhotoEvery:   3,
+		Seed:         1,
+	}
+}
+
+// Result reports what a seed created; parts that already existed are not counted
+type Result struct {
+	Users         []string `json:"users"`
+	BundleVersion string   `json:"bundle_version,omitempty"`
+	Observations  int      `json:"observations"`
+	Attachments   int      `json:"attachments"`
+}
+
+// Users creates the demo users
+type Users interface {
+	CreateUser(ctx context.Context, username, password string, role models.Role) (*models.User, error)
+}
+
+// Bundles stores the sample app bundle
+type Bundles interface {
+	GetVersions(ctx context.Context) ([]string, error)
+	PushBundle(ctx context.Context, zipReader io.Reader) (*appbundle.Manifest, error)
+}
+
+// Observations stores the synthetic observations
+type Observations interface {
+	ProcessPushedRecords(ctx context.Context, records []sync.Observation, clientID string, transmissionID string) (*sync.SyncPushResult, error)
+}
+
+// AttachmentStore stores the photos
+type AttachmentStore interface {
+	Save(ctx context.Context, attachmentID string, file io.Reader, policy attachment.OverwritePolicy) (*attachment.SaveResult, error)
+}
+
+// AttachmentRecorder records the photos in the attachment metadata and manifest
+type AttachmentRecorder interface {
+	RecordMetadata(ctx context.Context, meta attachment.Metadata) error
+	RecordOperation(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error
+}
+
+// Service seeds demo data
+type Service interface {
+	// Seed creates the demo data that doesn't exist yet
+	Seed(ctx context.Context) (*Result, error)
+}
+
+type service struct {
+	db           *sql.DB
+	users        Users
+	bundles      Bundles
+	observations Observations
+	attachments  AttachmentStore
+	recorder     AttachmentRecorder
+	config       Config
+	log          *logger.Logger
+}
+
+// NewService creates a demo seeding service. Photos are skipped when attachments is nil.
+func NewService(db *sql.DB, users Users, bundles Bundles, observations Observations, attachments AttachmentStore, recorder AttachmentRecorder, config Config, log *logger.Logger) Service {
+	if config.Observations < 0 {
+		config.Observations = 0
+	}
+	return &service{
+		db:           db,
+		users:        users,
+		bundles:      bundles,
+		observations: observations,
+		attachments:  attachments,
+		recorder:     recorder,
+		config:       config,
+		log:          log,
+	}
+}
+
+func (s *service) Seed(ctx context.Context) (_ *Result, err error) {
+	ctx, span := tracing.Start(ctx, "demo.Seed")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result := &Result{Users: []string{}}
+	if err := s.seedUsers(ctx, result); err != nil {
+		return nil, err
+	}
+	if err := s.seedBundle(ctx, result); err != nil {
+		return nil, err
+	}
+
+	// Observations and their photos are seeded together, only into an install that has
+	// none of them, so seeding again doesn't bump their versions
+	var seeded bool
+	err = s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM observations WHERE observation_id LIKE $1)",
+		observationPrefix+"%").Scan(&seeded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for demo observations: %w", err)
+	}
+	if seeded {
+		s.log.Info("Demo observations already seeded")
+		return result, nil
+	}
+
+	data := Generate(s.config)
+	if err := s.seedPhotos(ctx, data.Photos, result); err != nil {
+		return nil, err
+	}
+	if len(data.Observations) > 0 {
+		// Observations are owned by the collector, as if they had pushed them
+		collectorCtx := context.WithValue(ctx, authmw.UserKey, &models.User{Username: CollectorUsername, Role: models.RoleReadWrite})
+		push, err := s.observations.ProcessPushedRecords(collectorCtx, data.Observations, ClientID, "demo-seed")
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed demo observations: %w", err)
+		}
+		if len(push.FailedRecords) > 0 {
+			return nil, fmt.Errorf("failed to seed %d demo observations: %v", len(push.FailedRecords), push.FailedRecords[0]["error"])
+		}
+		result.Observations = push.SuccessCount
+	}
+	return result, nil
+}
+
+// seedUsers creates the demo users that don't exist yet
+func (s *service) seedUsers(ctx context.Context, result *Result) error {
+	for _, u := range []struct {
+		username string
+		role     models.Role
+	}{
+		{AdminUsername, models.RoleAdmin},
+		{CollectorUsername, models.RoleReadWrite},
+		{ViewerUsername, models.RoleReadOnly},
+	} {
+		_, err := s.users.CreateUser(ctx, u.username, s.config.Password, u.role)
+		if errors.Is(err, user.ErrUserExists) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create demo user %s: %w", u.username, err)
+		}
+		result.Users = append(result.Users, u.username)
+	}
+	return nil
+}
+
+// seedBundle pushes the sample app bundle unless a bundle has been pushed before, which
+// would be replaced as the active version
+func (s *service) seedBundle(ctx context.Context, result *Result) error {
+	versions, err := s.bundles.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list app bundle versions: %w", err)
+	}
+	if len(versions) > 0 {
+		s.log.Info("App bundle already pushed, not seeding the demo bundle", "versions", len(versions))
+		return nil
+	}
+
+	bundle, err := Bundle()
+	if err != nil {
+		return err
+	}
+	manifest, err := s.bundles.PushBundle(ctx, bytes.NewReader(bundle))
+	if err != nil {
+		return fmt.Errorf("failed to push demo app bundle: %w", err)
+	}
+	result.BundleVersion = manifest.Version
+	return nil
+}
+
+// seedPhotos stores the photos and records them like uploads
+func (s *service) seedPhotos(ctx context.Context, photos map[string][]byte, result *Result) error {
+	if s.attachments == nil {
+		if len(photos) > 0 {
+			s.log.Warn("Attachment storage unavailable, seeding demo observations without photos")
+		}
+		return nil
+	}
+
+	contentType := "image/png"
+	uploadedBy := CollectorUsername
+	for _, id := range sortedKeys(photos) {
+		saved, err := s.attachments.Save(ctx, id, bytes.NewReader(photos[id]), attachment.PolicyIdempotent)
+		if err != nil {
+			return fmt.Errorf("failed to store demo attachment %s: %w", id, err)
+		}
+		if saved.Outcome == attachment.OutcomeUnchanged {
+			continue
+		}
+		result.Attachments++
+
+		if s.recorder == nil {
+			continue
+		}
+		meta := attachment.Metadata{
+			AttachmentID: id,
+			Size:         saved.Size,
+			ContentType:  &contentType,
+			SHA256:       &saved.SHA256,
+			UploadedBy:   &uploadedBy,
+		}
+		if err := s.recorder.RecordMetadata(ctx, meta); err != nil {
+			return fmt.Errorf("failed to record demo attachment %s: %w", id, err)
+		}
+		size := int(saved.Size)
+		if err := s.recorder.RecordOperation(ctx, id, "create", "", &size, &contentType); err != nil {
+			return fmt.Errorf("failed to record demo attachment %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Bundle returns the sample app bundle as a zip archive
+func Bundle() ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	err := fs.WalkDir(bundleFS, "bundle", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := bundleFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := w.Create(strings.TrimPrefix(path, "bundle/"))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build demo app bundle: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build demo app bundle: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Data is the synthetic data of a seed
+type Data struct {
+	Observations []sync.Observation
+	// Photos are PNG images by attachment ID; observations reference them in data.photo
+	Photos map[string][]byte
+}
+
+var (
+	firstNames   = []string{"Aisha", "Brian", "Christine", "Daniel", "Esther", "Francis", "Grace", "Henry", "Irene", "Joseph", "Lillian", "Moses", "Naome", "Patrick", "Ruth", "Samuel"}
+	lastNames    = []string{"Akello", "Byaruhanga", "Kato", "Mugisha", "Nakato", "Namubiru", "Okello", "Ssempijja", "Tumusiime", "Wasswa"}
+	villages     = []string{"Bukoto", "Kireka", "Namugongo", "Ntinda", "Wakiso"}
+	waterSources = []string{"piped", "borehole", "well", "river", "rainwater"}
+)
+
+// start is when the first synthetic observation was made
+var start = time.Date(2025, time.March, 3, 8, 0, 0, 0, time.UTC)
+
+// Generate returns the synthetic observations and photos for a configuration
+func Generate(config Config) Data {
+	rng := rand.New(rand.NewPCG(config.Seed, config.Seed))
+	data := Data{Photos: map[string][]byte{}}
+	at := start
+	for i := 1; i <= config.Observations; i++ {
+		// A few visits a day, during working hours
+		at = at.Add(time.Duration(40+rng.IntN(180)) * time.Minute)
+		if at.Hour() >= 17 {
+			at = time.Date(at.Year(), at.Month(), at.Day()+1, 8, rng.IntN(60), 0, 0, time.UTC)
+		}
+
+		fields := map[string]any{
+			"head_name":    firstNames[rng.IntN(len(firstNames))] + " " + lastNames[rng.IntN(len(lastNames))],
+			"village":      villages[rng.IntN(len(villages))],
+			"members":      1 + rng.IntN(9),
+			"water_source": waterSources[rng.IntN(len(waterSources))],
+			"has_latrine":  rng.IntN(4) > 0,
+			"visit_date":   at.Format(time.DateOnly),
+		}
+		if config.PhotoEvery > 0 && i%config.PhotoEvery == 0 {
+			id := fmt.Sprintf("demo-house-%03d.png", i)
+			data.Photos[id] = photo(rng)
+			fields["photo"] = id
+		}
+		encoded, _ := json.Marshal(fields)
+
+		timestamp := at.Format(time.RFC3339)
+		data.Observations = append(data.Observations, sync.Observation{
+			ObservationID: fmt.Sprintf("%s%03d", observationPrefix, i),
+			FormType:      FormType,
+			FormVersion:   "1",
+			Data:          encoded,
+			CreatedAt:     timestamp,
+			UpdatedAt:     timestamp,
+			Geolocation: &sync.Geolocation{
+				// Around Kampala
+				Latitude:  0.3476 + (rng.Float64()-0.5)*0.2,
+				Longitude: 32.5825 + (rng.Float64()-0.5)*0.2,
+				Accuracy:  float64(3 + rng.IntN(20)),
+			},
+		})
+	}
+	return data
+}
+
+// photo draws a small gradient standing in for a photo
+func photo(rng *rand.Rand) []byte {
+	from := color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+	to := color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+	const width, height = 64, 48
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mix := func(a, b uint8) uint8 { return uint8((int(a)*(width-x) + int(b)*x) / width) }
+			img.Set(x, y, color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), 255})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
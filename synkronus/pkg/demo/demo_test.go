@@ -0,0 +1,132 @@
+package demo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/attachment"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/sync"
+	"github.com/opendataensemble/synkronus/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUsers map[string]models.Role
+
+func (f fakeUsers) CreateUser(ctx context.Context, username, password string, role models.Role) (*models.User, error) {
+	if _, ok := f[username]; ok {
+		return nil, user.ErrUserExists
+	}
+	f[username] = role
+	return &models.User{Username: username, Role: role}, nil
+}
+
+type fakeObservations struct {
+	pushed      []sync.Observation
+	submittedBy string
+}
+
+func (f *fakeObservations) ProcessPushedRecords(ctx context.Context, records []sync.Observation, clientID string, transmissionID string) (*sync.SyncPushResult, error) {
+	f.pushed = append(f.pushed, records...)
+	if u := authmw.GetUserFromContext(ctx); u != nil {
+		f.submittedBy = u.Username
+	}
+	return &sync.SyncPushResult{SuccessCount: len(records)}, nil
+}
+
+type fakeAttachments map[string][]byte
+
+func (f fakeAttachments) Save(ctx context.Context, attachmentID string, file io.Reader, policy attachment.OverwritePolicy) (*attachment.SaveResult, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := f[attachmentID]; ok && bytes.Equal(existing, data) {
+		return &attachment.SaveResult{Outcome: attachment.OutcomeUnchanged, Size: int64(len(data))}, nil
+	}
+	f[attachmentID] = data
+	return &attachment.SaveResult{Outcome: attachment.OutcomeCreated, SHA256: "sum", Size: int64(len(data))}, nil
+}
+
+type fakeRecorder struct {
+	metadata   []attachment.Metadata
+	operations []string
+}
+
+func (f *fakeRecorder) RecordMetadata(ctx context.Context, meta attachment.Metadata) error {
+	f.metadata = append(f.metadata, meta)
+	return nil
+}
+
+func (f *fakeRecorder) RecordOperation(ctx context.Context, attachmentID, operation, clientID string, size *int, contentType *string) error {
+	f.operations = append(f.operations, operation+" "+attachmentID)
+	return nil
+}
+
+func TestSeed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	log := logger.NewLogger()
+	users := fakeUsers{AdminUsername: models.RoleAdmin}
+	bundles := appbundle.NewService(appbundle.Config{BundlePath: t.TempDir(), VersionsPath: t.TempDir(), MaxVersions: 5}, log)
+	observations := &fakeObservations{}
+	attachments := fakeAttachments{}
+	recorder := &fakeRecorder{}
+	svc := NewService(db, users, bundles, observations, attachments, recorder, DefaultConfig(), log)
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM observations WHERE observation_id LIKE \$1\)`).
+		WithArgs("demo-household-%").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	result, err := svc.Seed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{CollectorUsername, ViewerUsername}, result.Users, "existing users are kept")
+	assert.Equal(t, models.RoleReadOnly, users[ViewerUsername])
+	assert.NotEmpty(t, result.BundleVersion, "the embedded bundle passes validation")
+	assert.Equal(t, 24, result.Observations)
+	assert.Equal(t, 8, result.Attachments)
+	assert.Len(t, recorder.metadata, 8)
+	assert.Contains(t, recorder.operations, "create demo-house-003.png")
+	assert.Equal(t, CollectorUsername, observations.submittedBy)
+
+	var data map[string]any
+	require.NoError(t, json.Unmarshal(observations.pushed[2].Data, &data))
+	assert.Equal(t, "demo-house-003.png", data["photo"])
+	assert.Contains(t, attachments, "demo-house-003.png")
+
+	// Seeding again leaves everything as it is
+	mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	result, err = svc.Seed(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Users)
+	assert.Empty(t, result.BundleVersion)
+	assert.Zero(t, result.Observations)
+	assert.Len(t, observations.pushed, 24)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGenerate_Reproducible(t *testing.T) {
+	config := DefaultConfig()
+	first, second := Generate(config), Generate(config)
+	assert.Equal(t, first, second)
+
+	config.Seed = 2
+	other := Generate(config)
+	assert.NotEqual(t, first.Observations[0].Data, other.Observations[0].Data)
+
+	for _, o := range first.Observations {
+		assert.Equal(t, FormType, o.FormType)
+		assert.Equal(t, o.CreatedAt, o.UpdatedAt)
+	}
+}
@@ -0,0 +1,293 @@
+package diagnostics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RequiredIndex is an index the sync hot paths depend on
+type RequiredIndex struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// RequiredIndexes lists the indexes checked at startup and by the diagnostics report.
+// An existing index whose leading columns match satisfies the requirement.
+var RequiredIndexes = []RequiredIndex{
+	{Name: "idx_observations_version_observation_id", Table: "observations", Columns: []string{"version", "observation_id"}},
+	{Name: "idx_observations_form_type_version", Table: "observations", Columns: []string{"form_type", "version"}},
+	{Name: "idx_attachment_operations_version_client", Table: "attachment_operations", Columns: []string{"version", "client_id"}},
+}
+
+// monitoredTables are the tables whose scan counters are included in the report
+var monitoredTables = []string{"observations", "attachment_operations", "sync_version"}
+
+// Config contains diagnostics configuration
+type Config struct {
+	// EnsureIndexes creates missing required indexes at startup
+	EnsureIndexes bool
+	// SlowQueryThreshold is the mean execution time above which a query is reported
+	SlowQueryThreshold time.Duration
+	// SlowQueryLimit caps the number of slow queries reported
+	SlowQueryLimit int
+	// Retry is the retrier whose connection health is reported; nil always reports ok
+	Retry *database.Retrier
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		EnsureIndexes:      true,
+		SlowQueryThreshold: 200 * time.Millisecond,
+		SlowQueryLimit:     10,
+	}
+}
+
+// SlowQuery is an entry from pg_stat_statements
+type SlowQuery struct {
+	Query       string  `json:"query"`
+	Calls       int64   `json:"calls"`
+	MeanTimeMs  float64 `json:"mean_time_ms"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	Rows        int64   `json:"rows"`
+}
+
+// TableScanStats are the scan counters for a table from pg_stat_user_tables
+type TableScanStats struct {
+	Table       string `json:"table"`
+	SeqScans    int64  `json:"seq_scans"`
+	SeqRowsRead int64  `json:"seq_rows_read"`
+	IndexScans  int64  `json:"index_scans"`
+	LiveRows    int64  `json:"live_rows"`
+}
+
+// Report describes the database health of the sync hot paths
+type Report struct {
+	MissingIndexes []RequiredIndex  `json:"missing_indexes"`
+	Tables         []TableScanStats `json:"tables"`
+	// SlowQueriesAvailable is false when the pg_stat_statements extension is not installed
+	SlowQueriesAvailable bool        `json:"slow_queries_available"`
+	SlowQueryThresholdMs int64       `json:"slow_query_threshold_ms"`
+	SlowQueries          []SlowQuery `json:"slow_queries"`
+	// Connection reports retried and failed operations, e.g. during a primary failover
+	Connection  database.Health `json:"connection"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// Service checks and reports on the database indexes and query performance
+type Service interface {
+	// EnsureIndexes creates any missing required indexes and returns their names
+	EnsureIndexes(ctx context.Context) ([]string, error)
+
+	// Report returns missing indexes, table scan counters and slow queries
+	Report(ctx context.Context) (*Report, error)
+
+	// ConnectionHealth reports whether database operations needed retries or fail
+	ConnectionHealth(ctx context.Context) database.Health
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new diagnostics service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// ConnectionHealth reports whether database operations needed retries or fail
+func (s *service) ConnectionHealth(ctx context.Context) database.Health {
+	return s.config.Retry.Health(ctx)
+}
+
+// EnsureIndexes creates any missing required indexes and returns their names
+func (s *service) EnsureIndexes(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "diagnostics.EnsureIndexes")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	missing, err := s.missingIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !s.config.EnsureIndexes {
+		for _, idx := range missing {
+			s.log.Warn("Required index is missing", "index", idx.Name, "table", idx.Table, "columns", idx.Columns)
+		}
+		return nil, nil
+	}
+
+	var created []string
+	for _, idx := range missing {
+		// CONCURRENTLY avoids blocking pushes on large tables; it cannot run in a transaction
+		query := fmt.Sprintf("CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s (%s)",
+			idx.Name, idx.Table, strings.Join(idx.Columns, ", "))
+		start := time.Now()
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return created, fmt.Errorf("failed to create index %s: %w", idx.Name, err)
+		}
+		s.log.Info("Created missing index", "index", idx.Name, "table", idx.Table, "duration", time.Since(start))
+		created = append(created, idx.Name)
+	}
+	span.SetAttributes(attribute.Int("diagnostics.indexes_created", len(created)))
+
+	return created, nil
+}
+
+// Report returns missing indexes, table scan counters and slow queries
+func (s *service) Report(ctx context.Context) (_ *Report, err error) {
+	ctx, span := tracing.Start(ctx, "diagnostics.Report")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	report := &Report{
+		Tables:               []TableScanStats{},
+		SlowQueries:          []SlowQuery{},
+		SlowQueryThresholdMs: s.config.SlowQueryThreshold.Milliseconds(),
+		Connection:           s.ConnectionHealth(ctx),
+		GeneratedAt:          time.Now().UTC(),
+	}
+
+	if report.MissingIndexes, err = s.missingIndexes(ctx); err != nil {
+		return nil, err
+	}
+	if report.Tables, err = s.tableScanStats(ctx); err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')",
+	).Scan(&report.SlowQueriesAvailable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for pg_stat_statements: %w", err)
+	}
+	if report.SlowQueriesAvailable {
+		if report.SlowQueries, err = s.slowQueries(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// missingIndexes returns the required indexes not covered by a valid index's leading columns
+func (s *service) missingIndexes(ctx context.Context) ([]RequiredIndex, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.relname,
+		       ARRAY_TO_STRING(ARRAY(
+		           SELECT a.attname
+		           FROM UNNEST(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+		           JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		           ORDER BY k.ord
+		       ), ',')
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = CURRENT_SCHEMA() AND i.indisvalid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string][]string)
+	for rows.Next() {
+		var table, columns string
+		if err := rows.Scan(&table, &columns); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		existing[table] = append(existing[table], columns)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	missing := []RequiredIndex{}
+	for _, idx := range RequiredIndexes {
+		prefix := strings.Join(idx.Columns, ",")
+		covered := false
+		for _, columns := range existing[idx.Table] {
+			if columns == prefix || strings.HasPrefix(columns, prefix+",") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, idx)
+		}
+	}
+
+	return missing, nil
+}
+
+// tableScanStats returns scan counters for the monitored tables
+func (s *service) tableScanStats(ctx context.Context) ([]TableScanStats, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT relname, seq_scan, seq_tup_read, COALESCE(idx_scan, 0), n_live_tup
+		FROM pg_stat_user_tables
+		WHERE schemaname = CURRENT_SCHEMA() AND relname = ANY($1)
+		ORDER BY relname`, pq.Array(monitoredTables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	tables := []TableScanStats{}
+	for rows.Next() {
+		var t TableScanStats
+		if err := rows.Scan(&t.Table, &t.SeqScans, &t.SeqRowsRead, &t.IndexScans, &t.LiveRows); err != nil {
+			return nil, fmt.Errorf("failed to scan table statistics: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+
+	return tables, nil
+}
+
+// slowQueries returns the statements whose mean execution time exceeds the threshold
+func (s *service) slowQueries(ctx context.Context) ([]SlowQuery, error) {
+	thresholdMs := float64(s.config.SlowQueryThreshold) / float64(time.Millisecond)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT query, calls, mean_exec_time, total_exec_time, rows
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = CURRENT_DATABASE())
+		  AND mean_exec_time >= $1
+		ORDER BY mean_exec_time DESC
+		LIMIT $2`, thresholdMs, s.config.SlowQueryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_statements: %w", err)
+	}
+	defer rows.Close()
+
+	queries := []SlowQuery{}
+	for rows.Next() {
+		var q SlowQuery
+		if err := rows.Scan(&q.Query, &q.Calls, &q.MeanTimeMs, &q.TotalTimeMs, &q.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan slow query: %w", err)
+		}
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read slow queries: %w", err)
+	}
+
+	return queries, nil
+}
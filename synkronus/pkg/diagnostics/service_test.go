@@ -0,0 +1,148 @@
+package diagnostics
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// indexRows returns existing indexes as (table, comma-separated columns) rows
+func indexRows(indexes ...[2]string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"relname", "columns"})
+	for _, idx := range indexes {
+		rows.AddRow(idx[0], idx[1])
+	}
+	return rows
+}
+
+func TestService_EnsureIndexes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	// A wider index with matching leading columns covers the requirement
+	mock.ExpectQuery(`FROM pg_index`).WillReturnRows(indexRows(
+		[2]string{"observations", "observation_id"},
+		[2]string{"observations", "form_type,version,observation_id"},
+		[2]string{"attachment_operations", "version,client_id"},
+	))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_observations_version_observation_id ON observations (version, observation_id)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	created, err := svc.EnsureIndexes(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(created) != 1 || created[0] != "idx_observations_version_observation_id" {
+		t.Errorf("Expected only idx_observations_version_observation_id to be created, got %v", created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_EnsureIndexes_Disabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.EnsureIndexes = false
+	svc := NewService(db, config, logger.NewLogger())
+
+	// Only the check runs; no CREATE INDEX is expected
+	mock.ExpectQuery(`FROM pg_index`).WillReturnRows(indexRows())
+
+	created, err := svc.EnsureIndexes(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(created) != 0 {
+		t.Errorf("Expected no indexes to be created, got %v", created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Report(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	mock.ExpectQuery(`FROM pg_index`).WillReturnRows(indexRows(
+		[2]string{"observations", "version,observation_id"},
+	))
+	mock.ExpectQuery(`FROM pg_stat_user_tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "seq_scan", "seq_tup_read", "idx_scan", "n_live_tup"}).
+			AddRow("observations", 120, 5400000, 3, 45000))
+	mock.ExpectQuery(`pg_extension`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM pg_stat_statements`).
+		WithArgs(float64(200), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"query", "calls", "mean_exec_time", "total_exec_time", "rows"}).
+			AddRow("SELECT * FROM observations WHERE version > $1", 40, 950.5, 38020.0, 4000))
+
+	report, err := svc.Report(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.MissingIndexes) != 2 {
+		t.Fatalf("Expected 2 missing indexes, got %+v", report.MissingIndexes)
+	}
+	if report.MissingIndexes[0].Name != "idx_observations_form_type_version" || report.MissingIndexes[1].Table != "attachment_operations" {
+		t.Errorf("Unexpected missing indexes: %+v", report.MissingIndexes)
+	}
+	if len(report.Tables) != 1 || report.Tables[0].SeqScans != 120 {
+		t.Errorf("Unexpected table stats: %+v", report.Tables)
+	}
+	if !report.SlowQueriesAvailable || len(report.SlowQueries) != 1 || report.SlowQueries[0].MeanTimeMs != 950.5 {
+		t.Errorf("Unexpected slow queries: %+v", report.SlowQueries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Report_WithoutPgStatStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	mock.ExpectQuery(`FROM pg_index`).WillReturnRows(indexRows())
+	mock.ExpectQuery(`FROM pg_stat_user_tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "seq_scan", "seq_tup_read", "idx_scan", "n_live_tup"}))
+	mock.ExpectQuery(`pg_extension`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	report, err := svc.Report(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.SlowQueriesAvailable || len(report.SlowQueries) != 0 {
+		t.Errorf("Expected no slow query stats, got %+v", report.SlowQueries)
+	}
+	if len(report.MissingIndexes) != len(RequiredIndexes) {
+		t.Errorf("Expected all %d required indexes to be missing, got %d", len(RequiredIndexes), len(report.MissingIndexes))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
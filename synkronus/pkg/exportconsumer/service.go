@@ -0,0 +1,213 @@
+// Package exportconsumer keeps a registry of named downstream systems and the last sync
+// version each has ingested. Exports and change feed replays can start after a consumer's
+// acknowledged version, so loads neither leave gaps nor load the same changes twice.
+package exportconsumer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidName is returned for consumer names that don't match namePattern
+	ErrInvalidName = errors.New("consumer names must be lowercase letters, digits, '.', '_' and '-', starting with a letter or digit (max 64 characters)")
+	// ErrNotFound is returned for a consumer that never acknowledged a version
+	ErrNotFound = errors.New("export consumer not found")
+	// ErrVersionAhead is returned when acknowledging a version the server hasn't reached
+	ErrVersionAhead = errors.New("acknowledged version is ahead of the current version")
+	// ErrVersionBehind is returned when an acknowledgement would move a consumer back
+	ErrVersionBehind = errors.New("acknowledged version is behind the consumer's last acknowledgement")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Consumer is a downstream system and the last version it ingested
+type Consumer struct {
+	Name         string    `json:"name"`
+	AckedVersion int64     `json:"acked_version"`
+	AckedAt      time.Time `json:"acked_at"`
+	AckedBy      *string   `json:"acked_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Lag is how many versions the server is ahead of the acknowledgement
+	Lag int64 `json:"lag"`
+}
+
+// Service records the versions downstream consumers have ingested
+type Service interface {
+	// CurrentVersion returns the latest committed sync version
+	CurrentVersion(ctx context.Context) (int64, error)
+	// List returns every consumer, sorted by name
+	List(ctx context.Context) ([]Consumer, error)
+	// Get returns a consumer, or ErrNotFound
+	Get(ctx context.Context, name string) (*Consumer, error)
+	// Ack records that a consumer ingested everything up to version, creating the consumer
+	// on its first acknowledgement. Moving a consumer back requires reset.
+	Ack(ctx context.Context, name string, version int64, reset bool, ackedBy string) (*Consumer, error)
+	// Delete removes a consumer
+	Delete(ctx context.Context, name string) error
+}
+
+type service struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+// NewService creates a new export consumer service
+func NewService(db *sql.DB, log *logger.Logger) Service {
+	return &service{db: db, log: log}
+}
+
+// ValidName reports whether name can be used for a consumer
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// CurrentVersion returns the latest committed sync version. Writers bump sync_version in
+// their transaction, so every change up to it has committed.
+func (s *service) CurrentVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := s.db.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read current version: %w", err)
+	}
+	return version, nil
+}
+
+// List returns every consumer
+func (s *service) List(ctx context.Context) (_ []Consumer, err error) {
+	ctx, span := tracing.Start(ctx, "exportconsumer.List")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	current, err := s.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT name, acked_version, acked_at, acked_by, created_at FROM export_consumers ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export consumers: %w", err)
+	}
+	defer rows.Close()
+
+	consumers := []Consumer{}
+	for rows.Next() {
+		consumer, err := scanConsumer(rows, current)
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, *consumer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read export consumers: %w", err)
+	}
+	return consumers, nil
+}
+
+// Get returns a consumer
+func (s *service) Get(ctx context.Context, name string) (_ *Consumer, err error) {
+	ctx, span := tracing.Start(ctx, "exportconsumer.Get", attribute.String("exportconsumer.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	current, err := s.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := scanConsumer(s.db.QueryRowContext(ctx,
+		"SELECT name, acked_version, acked_at, acked_by, created_at FROM export_consumers WHERE name = $1", name), current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return consumer, err
+}
+
+// Ack records the version a consumer ingested
+func (s *service) Ack(ctx context.Context, name string, version int64, reset bool, ackedBy string) (_ *Consumer, err error) {
+	ctx, span := tracing.Start(ctx, "exportconsumer.Ack",
+		attribute.String("exportconsumer.name", name), attribute.Int64("exportconsumer.version", version))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	current, err := s.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > current {
+		return nil, fmt.Errorf("%w (current version is %d)", ErrVersionAhead, current)
+	}
+
+	// A single statement so concurrent acknowledgements can't move the consumer back
+	query := `
+		INSERT INTO export_consumers (name, acked_version, acked_by)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (name) DO UPDATE SET
+			acked_version = EXCLUDED.acked_version,
+			acked_at = NOW(),
+			acked_by = EXCLUDED.acked_by
+		WHERE $4 OR export_consumers.acked_version <= EXCLUDED.acked_version
+		RETURNING name, acked_version, acked_at, acked_by, created_at
+	`
+	consumer, err := scanConsumer(s.db.QueryRowContext(ctx, query, name, version, ackedBy, reset), current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVersionBehind
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Export consumer acknowledged version", "consumer", name, "version", version, "reset", reset, "by", ackedBy)
+	return consumer, nil
+}
+
+// Delete removes a consumer
+func (s *service) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "exportconsumer.Delete", attribute.String("exportconsumer.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM export_consumers WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete export consumer: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete export consumer: %w", err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanConsumer scans a consumer row and computes its lag behind current
+func scanConsumer(row interface{ Scan(...any) error }, current int64) (*Consumer, error) {
+	var consumer Consumer
+	var ackedBy sql.NullString
+	err := row.Scan(&consumer.Name, &consumer.AckedVersion, &consumer.AckedAt, &ackedBy, &consumer.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan export consumer: %w", err)
+	}
+	if ackedBy.Valid {
+		consumer.AckedBy = &ackedBy.String
+	}
+	if current > consumer.AckedVersion {
+		consumer.Lag = current - consumer.AckedVersion
+	}
+	return &consumer, nil
+}
@@ -0,0 +1,105 @@
+package exportconsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var consumerColumns = []string{"name", "acked_version", "acked_at", "acked_by", "created_at"}
+
+func expectCurrentVersion(mock sqlmock.Sqlmock, version int64) {
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(version))
+}
+
+func TestService_Ack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, logger.NewLogger())
+	now := time.Now()
+
+	expectCurrentVersion(mock, 120)
+	mock.ExpectQuery(`INSERT INTO export_consumers`).WithArgs("warehouse", int64(100), "admin", false).
+		WillReturnRows(sqlmock.NewRows(consumerColumns).AddRow("warehouse", 100, now, "admin", now))
+
+	consumer, err := svc.Ack(context.Background(), "warehouse", 100, false, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if consumer.AckedVersion != 100 || consumer.Lag != 20 || consumer.AckedBy == nil || *consumer.AckedBy != "admin" {
+		t.Errorf("Unexpected consumer: %+v", consumer)
+	}
+
+	// The upsert returns nothing when the consumer already acknowledged a later version
+	expectCurrentVersion(mock, 120)
+	mock.ExpectQuery(`INSERT INTO export_consumers`).WithArgs("warehouse", int64(90), "admin", false).
+		WillReturnRows(sqlmock.NewRows(consumerColumns))
+	if _, err := svc.Ack(context.Background(), "warehouse", 90, false, "admin"); !errors.Is(err, ErrVersionBehind) {
+		t.Errorf("Expected ErrVersionBehind, got %v", err)
+	}
+
+	expectCurrentVersion(mock, 120)
+	if _, err := svc.Ack(context.Background(), "warehouse", 121, false, "admin"); !errors.Is(err, ErrVersionAhead) {
+		t.Errorf("Expected ErrVersionAhead, got %v", err)
+	}
+
+	if _, err := svc.Ack(context.Background(), "Data Warehouse", 1, false, "admin"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_GetAndDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, logger.NewLogger())
+
+	expectCurrentVersion(mock, 10)
+	mock.ExpectQuery(`SELECT name, acked_version, acked_at, acked_by, created_at FROM export_consumers WHERE name = \$1`).
+		WithArgs("missing").WillReturnRows(sqlmock.NewRows(consumerColumns))
+	if _, err := svc.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	mock.ExpectExec(`DELETE FROM export_consumers WHERE name = \$1`).WithArgs("warehouse").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM export_consumers WHERE name = \$1`).WithArgs("warehouse").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.Delete(context.Background(), "warehouse"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := svc.Delete(context.Background(), "warehouse"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"warehouse":         true,
+		"dhis2.sync-prod_1": true,
+		"":                  false,
+		"-warehouse":        false,
+		"Warehouse":         false,
+		"data warehouse":    false,
+	} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+// Package exportreport stores named report definitions registered by admins and runs
+// them. A report is either a parameterized read-only SQL query or a declarative spec
+// joining form types; both may only read the observations and attachments tables.
+package exportreport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidName is returned for report names that don't match namePattern
+	ErrInvalidName = errors.New("report names must be lowercase letters, digits, '.', '_' and '-', starting with a letter or digit (max 64 characters)")
+	// ErrNotFound is returned for a report that isn't defined
+	ErrNotFound = errors.New("report not found")
+	// ErrInvalidDefinition is returned for a definition that can't be saved
+	ErrInvalidDefinition = errors.New("invalid report definition")
+	// ErrInvalidParameter is returned when running a report with a missing or malformed parameter
+	ErrInvalidParameter = errors.New("invalid report parameter")
+)
+
+var (
+	namePattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+	parameterPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+)
+
+// Parameter types
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeNumber    = "number"
+	TypeBoolean   = "boolean"
+	TypeDate      = "date"
+	TypeTimestamp = "timestamp"
+)
+
+// reservedParameters are query parameters of the report endpoint itself
+var reservedParameters = map[string]bool{"format": true}
+
+// readableTables are the only tables a report may read
+var readableTables = map[string]bool{"observations": true, "attachments": true}
+
+// Parameter is a value a report is run with, given as a query parameter of the same name
+type Parameter struct {
+	Name string `json:"name"`
+	// Type is string (the default), integer, number, boolean, date (2006-01-02) or
+	// timestamp (RFC 3339)
+	Type        string  `json:"type,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Default     *string `json:"default,omitempty"`
+}
+
+// Definition is a named report. Exactly one of SQL and Spec is set.
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// SQL is a single SELECT statement with :name placeholders for the parameters
+	SQL        string      `json:"sql,omitempty"`
+	Spec       *Spec       `json:"spec,omitempty"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Roles besides admin that may run the report. Reports read the stored data as is,
+	// without the export exclusions and redaction, so only admins run them by default.
+	Roles     []string  `json:"roles,omitempty"`
+	CreatedBy *string   `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedBy *string   `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CanRun reports whether a user of role may run the report
+func (d *Definition) CanRun(role models.Role) bool {
+	return role == models.RoleAdmin || slices.Contains(d.Roles, string(role))
+}
+
+// Result is the output of a report
+type Result struct {
+	Columns []string
+	// Rows hold strings, int64, float64, bool, time.Time, json.Number, json.RawMessage
+	// or nil
+	Rows [][]any
+	// Truncated is set when the report had more rows than the configured maximum
+	Truncated bool
+}
+
+// Config contains report settings
+type Config struct {
+	// MaxRows caps the rows of one report
+	MaxRows int
+	// Timeout bounds the query of one report
+	Timeout time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxRows: 100000,
+		Timeout: time.Minute,
+	}
+}
+
+// Service stores and runs report definitions
+type Service interface {
+	// List returns every report, sorted by name
+	List(ctx context.Context) ([]Definition, error)
+	// Get returns a report, or ErrNotFound
+	Get(ctx context.Context, name string) (*Definition, error)
+	// Save validates and creates or replaces a report. Its query is planned, not run, to
+	// check that it only reads the observations and attachments tables.
+	Save(ctx context.Context, definition Definition, savedBy string) (*Definition, error)
+	// Delete removes a report
+	Delete(ctx context.Context, name string) error
+	// Run runs a report with the given parameter values in a read-only transaction
+	Run(ctx context.Context, definition *Definition, values map[string]string) (*Result, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new report service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	defaults := DefaultConfig()
+	if config.MaxRows <= 0 {
+		config.MaxRows = defaults.MaxRows
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	return &service{db: db, config: config, log: log}
+}
+
+// ValidName reports whether name can be used for a report
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+const definitionColumns = "name, description, sql, spec, parameters, roles, created_by, created_at, updated_by, updated_at"
+
+// List returns every report
+func (s *service) List(ctx context.Context) (_ []Definition, err error) {
+	ctx, span := tracing.Start(ctx, "exportreport.List")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+definitionColumns+" FROM export_reports ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reports: %w", err)
+	}
+	defer rows.Close()
+
+	definitions := []Definition{}
+	for rows.Next() {
+		definition, err := scanDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, *definition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reports: %w", err)
+	}
+	return definitions, nil
+}
+
+// Get returns a report
+func (s *service) Get(ctx context.Context, name string) (_ *Definition, err error) {
+	ctx, span := tracing.Start(ctx, "exportreport.Get", attribute.String("exportreport.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	definition, err := scanDefinition(s.db.QueryRowContext(ctx,
+		"SELECT "+definitionColumns+" FROM export_reports WHERE name = $1", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return definition, err
+}
+
+// Save validates and creates or replaces a report
+func (s *service) Save(ctx context.Context, definition Definition, savedBy string) (_ *Definition, err error) {
+	ctx, span := tracing.Start(ctx, "exportreport.Save", attribute.String("exportreport.name", definition.Name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if err := validate(&definition); err != nil {
+		return nil, err
+	}
+	if err := s.checkTables(ctx, &definition); err != nil {
+		return nil, err
+	}
+
+	var spec any // NULL for SQL reports
+	if definition.Spec != nil {
+		encoded, err := json.Marshal(definition.Spec)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(encoded)
+	}
+	if definition.Parameters == nil {
+		definition.Parameters = []Parameter{}
+	}
+	if definition.Roles == nil {
+		definition.Roles = []string{}
+	}
+	parameters, err := json.Marshal(definition.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	var by *string
+	if savedBy != "" {
+		by = &savedBy
+	}
+
+	saved, err := scanDefinition(s.db.QueryRowContext(ctx, `
+		INSERT INTO export_reports (name, description, sql, spec, parameters, roles, created_by, created_at, updated_by, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, NOW(), $7, NOW())
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			sql = EXCLUDED.sql,
+			spec = EXCLUDED.spec,
+			parameters = EXCLUDED.parameters,
+			roles = EXCLUDED.roles,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING `+definitionColumns,
+		definition.Name, definition.Description, definition.SQL, spec, parameters, pq.Array(definition.Roles), by))
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Report saved", "report", saved.Name, "by", savedBy)
+	return saved, nil
+}
+
+// Delete removes a report
+func (s *service) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "exportreport.Delete", attribute.String("exportreport.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM export_reports WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete report: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	s.log.Info("Report deleted", "report", name)
+	return nil
+}
+
+// Run runs a report in a read-only transaction
+func (s *service) Run(ctx context.Context, definition *Definition, values map[string]string) (result *Result, err error) {
+	ctx, span := tracing.Start(ctx, "exportreport.Run", attribute.String("exportreport.name", definition.Name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	args := make(map[string]any)
+	for _, param := range definition.Parameters {
+		raw, ok := values[param.Name]
+		if !ok && param.Default != nil {
+			raw, ok = *param.Default, true
+		}
+		if !ok {
+			if param.Required {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidParameter, param.Name)
+			}
+			continue
+		}
+		value, err := parseValue(param, raw)
+		if err != nil {
+			return nil, err
+		}
+		args[param.Name] = value
+	}
+
+	query, names, err := compile(definition, args)
+	if err != nil {
+		return nil, err
+	}
+	bound := make([]any, len(names))
+	for i, name := range names {
+		bound[i] = args[name] // nil for an optional parameter that isn't given
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start report transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", s.config.Timeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("failed to limit report duration: %w", err)
+	}
+
+	// The newline ends a trailing line comment of the query
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (%s\n) AS report LIMIT %d", query, s.config.MaxRows+1), bound...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run report: %w", err)
+	}
+	defer rows.Close()
+
+	result, err = readResult(rows, s.config.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("exportreport.rows", len(result.Rows)))
+	s.log.Info("Report run", "report", definition.Name, "rows", len(result.Rows), "truncated", result.Truncated)
+	return result, nil
+}
+
+// validate checks a definition before it is saved and fills in parameter defaults
+func validate(definition *Definition) error {
+	if !ValidName(definition.Name) {
+		return ErrInvalidName
+	}
+	if (strings.TrimSpace(definition.SQL) == "") == (definition.Spec == nil) {
+		return fmt.Errorf("%w: set either sql or spec", ErrInvalidDefinition)
+	}
+
+	seen := make(map[string]bool)
+	for i := range definition.Parameters {
+		param := &definition.Parameters[i]
+		if !parameterPattern.MatchString(param.Name) || reservedParameters[param.Name] {
+			return fmt.Errorf("%w: parameter name %q must be lowercase letters, digits and '_' and not format", ErrInvalidDefinition, param.Name)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("%w: parameter %s is declared twice", ErrInvalidDefinition, param.Name)
+		}
+		seen[param.Name] = true
+		if param.Type == "" {
+			param.Type = TypeString
+		}
+		if _, err := zeroValue(param.Type); err != nil {
+			return err
+		}
+		if param.Default != nil {
+			if _, err := parseValue(*param, *param.Default); err != nil {
+				return fmt.Errorf("%w: default of %s: %v", ErrInvalidDefinition, param.Name, err)
+			}
+		}
+	}
+
+	for _, role := range definition.Roles {
+		switch models.Role(role) {
+		case models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin:
+		default:
+			return fmt.Errorf("%w: unknown role %q", ErrInvalidDefinition, role)
+		}
+	}
+
+	// Every parameter given, so every filter of a spec is checked
+	all := make(map[string]any)
+	for _, param := range definition.Parameters {
+		all[param.Name] = nil
+	}
+	_, _, err := compile(definition, all)
+	return err
+}
+
+// compile returns the query of a definition with $n placeholders and the parameter
+// names in placeholder order. given holds the parameters that have a value.
+func compile(definition *Definition, given map[string]any) (string, []string, error) {
+	declared := make(map[string]Parameter, len(definition.Parameters))
+	for _, param := range definition.Parameters {
+		declared[param.Name] = param
+	}
+
+	query := definition.SQL
+	if definition.Spec != nil {
+		present := make(map[string]bool, len(given))
+		for name := range given {
+			present[name] = true
+		}
+		var err error
+		if query, err = compileSpec(definition.Spec, declared, present); err != nil {
+			return "", nil, err
+		}
+	}
+
+	tokens, err := tokenize(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+	if err := validateSQL(tokens); err != nil {
+		return "", nil, err
+	}
+	return bindParams(query, tokens, declared)
+}
+
+// checkTables plans the query of a definition and fails unless every table it reads is
+// observations or attachments. The plan covers subqueries, CTEs and views, which a
+// textual check would miss.
+func (s *service) checkTables(ctx context.Context, definition *Definition) error {
+	all := make(map[string]any)
+	for _, param := range definition.Parameters {
+		all[param.Name] = nil
+	}
+	query, names, err := compile(definition, all)
+	if err != nil {
+		return err
+	}
+	args := make([]any, len(names))
+	for i, name := range names {
+		for _, param := range definition.Parameters {
+			if param.Name == name {
+				args[i], _ = zeroValue(param.Type)
+			}
+		}
+	}
+
+	var plan []byte
+	if err := s.db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			return fmt.Errorf("%w: %s", ErrInvalidDefinition, pqErr.Message)
+		}
+		return fmt.Errorf("failed to plan report query: %w", err)
+	}
+	var parsed any
+	if err := json.Unmarshal(plan, &parsed); err != nil {
+		return fmt.Errorf("failed to read report query plan: %w", err)
+	}
+	return checkPlan(parsed)
+}
+
+// checkPlan walks a JSON query plan and fails on tables other than readableTables and
+// on plan nodes that write
+func checkPlan(node any) error {
+	switch n := node.(type) {
+	case []any:
+		for _, child := range n {
+			if err := checkPlan(child); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		if relation, ok := n["Relation Name"].(string); ok && !readableTables[relation] {
+			return fmt.Errorf("%w: reports may only read the observations and attachments tables, not %s", ErrInvalidDefinition, relation)
+		}
+		if nodeType, _ := n["Node Type"].(string); nodeType == "ModifyTable" || nodeType == "LockRows" {
+			return fmt.Errorf("%w: reports may only read", ErrInvalidDefinition)
+		}
+		for _, child := range n {
+			if err := checkPlan(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zeroValue returns a value of a parameter type, used to plan a query
+func zeroValue(paramType string) (any, error) {
+	switch paramType {
+	case TypeString:
+		return "", nil
+	case TypeInteger:
+		return int64(0), nil
+	case TypeNumber:
+		return float64(0), nil
+	case TypeBoolean:
+		return false, nil
+	case TypeDate, TypeTimestamp:
+		return time.Unix(0, 0).UTC(), nil
+	}
+	return nil, fmt.Errorf("%w: parameter type must be string, integer, number, boolean, date or timestamp, not %q", ErrInvalidDefinition, paramType)
+}
+
+// parseValue converts a parameter value given as text
+func parseValue(param Parameter, raw string) (any, error) {
+	var value any
+	var err error
+	switch param.Type {
+	case TypeInteger:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case TypeNumber:
+		value, err = strconv.ParseFloat(raw, 64)
+	case TypeBoolean:
+		value, err = strconv.ParseBool(raw)
+	case TypeDate:
+		value, err = time.Parse(time.DateOnly, raw)
+	case TypeTimestamp:
+		value, err = time.Parse(time.RFC3339, raw)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a %s", ErrInvalidParameter, param.Name, param.Type)
+	}
+	return value, nil
+}
+
+// readResult reads up to maxRows rows of a report
+func readResult(rows *sql.Rows, maxRows int) (*Result, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report columns: %w", err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report columns: %w", err)
+	}
+
+	result := &Result{Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to read report row: %w", err)
+		}
+		for i, value := range values {
+			values[i] = normalize(value, types[i].DatabaseTypeName())
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to run report: %w", err)
+	}
+	return result, nil
+}
+
+// normalize converts the text the driver returns for some column types
+func normalize(value any, databaseType string) any {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	switch databaseType {
+	case "JSON", "JSONB":
+		return json.RawMessage(slices.Clone(b))
+	case "NUMERIC":
+		return json.Number(b)
+	}
+	return string(b)
+}
+
+// scanDefinition reads an export_reports row selected with definitionColumns
+func scanDefinition(row interface{ Scan(...any) error }) (*Definition, error) {
+	var definition Definition
+	var description, query sql.NullString
+	var spec, parameters []byte
+	var roles pq.StringArray
+	if err := row.Scan(&definition.Name, &description, &query, &spec, &parameters, &roles,
+		&definition.CreatedBy, &definition.CreatedAt, &definition.UpdatedBy, &definition.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	definition.Description = description.String
+	definition.SQL = query.String
+	definition.Roles = roles
+	if spec != nil {
+		if err := json.Unmarshal(spec, &definition.Spec); err != nil {
+			return nil, fmt.Errorf("failed to read report spec: %w", err)
+		}
+	}
+	if err := json.Unmarshal(parameters, &definition.Parameters); err != nil {
+		return nil, fmt.Errorf("failed to read report parameters: %w", err)
+	}
+	return &definition, nil
+}
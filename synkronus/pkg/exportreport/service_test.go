@@ -0,0 +1,172 @@
+package exportreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var reportColumns = []string{"name", "description", "sql", "spec", "parameters", "roles", "created_by", "created_at", "updated_by", "updated_at"}
+
+func explainPlan(relations ...string) string {
+	var plans []map[string]any
+	for _, relation := range relations {
+		plans = append(plans, map[string]any{"Node Type": "Seq Scan", "Relation Name": relation})
+	}
+	plan, _ := json.Marshal([]map[string]any{{"Plan": map[string]any{"Node Type": "Hash Join", "Plans": plans}}})
+	return string(plan)
+}
+
+func TestService_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, Config{}, logger.NewLogger())
+	now := time.Now()
+	definition := Definition{
+		Name:       "daily-counts",
+		SQL:        "SELECT form_type, count(*) FROM observations WHERE created_at >= :since GROUP BY form_type",
+		Parameters: []Parameter{{Name: "since", Type: TypeDate, Required: true}},
+		Roles:      []string{"read-only"},
+	}
+
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT form_type, count\(\*\) FROM observations WHERE created_at >= \$1`).
+		WithArgs(time.Unix(0, 0).UTC()).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(explainPlan("observations", "attachments")))
+	mock.ExpectQuery(`INSERT INTO export_reports`).
+		WithArgs("daily-counts", "", definition.SQL, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), "admin").
+		WillReturnRows(sqlmock.NewRows(reportColumns).AddRow("daily-counts", nil, definition.SQL, nil,
+			`[{"name":"since","type":"date","required":true}]`, "{read-only}", "admin", now, "admin", now))
+
+	saved, err := svc.Save(context.Background(), definition, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if saved.SQL != definition.SQL || len(saved.Parameters) != 1 || saved.Parameters[0].Type != TypeDate || !saved.CanRun(models.RoleReadOnly) {
+		t.Errorf("Unexpected definition: %+v", saved)
+	}
+	if saved.CanRun(models.RoleReadWrite) || !saved.CanRun(models.RoleAdmin) {
+		t.Errorf("Expected only admins and read-only users to run the report")
+	}
+
+	// A query reading another table, e.g. through a subquery, is rejected by its plan
+	definition.SQL = "SELECT * FROM observations WHERE submitted_by IN (SELECT username FROM users)"
+	definition.Parameters = nil
+	mock.ExpectQuery(`EXPLAIN`).WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(explainPlan("observations", "users")))
+	if _, err := svc.Save(context.Background(), definition, "admin"); !errors.Is(err, ErrInvalidDefinition) {
+		t.Errorf("Expected ErrInvalidDefinition, got %v", err)
+	}
+
+	// Invalid definitions never reach the database
+	for name, invalid := range map[string]Definition{
+		"writes":             {Name: "wipe", SQL: "DELETE FROM observations"},
+		"sql and spec":       {Name: "both", SQL: "SELECT 1", Spec: householdSpec()},
+		"neither":            {Name: "none"},
+		"unknown role":       {Name: "roles", SQL: "SELECT 1", Roles: []string{"guest"}},
+		"reserved parameter": {Name: "params", SQL: "SELECT :format", Parameters: []Parameter{{Name: "format"}}},
+		"unknown type":       {Name: "types", SQL: "SELECT :n", Parameters: []Parameter{{Name: "n", Type: "uuid"}}},
+	} {
+		if _, err := svc.Save(context.Background(), invalid, "admin"); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("%s: expected ErrInvalidDefinition, got %v", name, err)
+		}
+	}
+	if _, err := svc.Save(context.Background(), Definition{Name: "Daily Counts", SQL: "SELECT 1"}, "admin"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Run(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, Config{MaxRows: 2, Timeout: 5 * time.Second}, logger.NewLogger())
+	created := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	definition := &Definition{
+		Name: "households",
+		SQL:  "SELECT observation_id, data, created_at FROM observations WHERE form_type = :form AND version > :min_version -- live only",
+		Parameters: []Parameter{
+			{Name: "form", Type: TypeString, Required: true},
+			{Name: "min_version", Type: TypeInteger, Default: stringPtr("0")},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL statement_timeout = 5000`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// The trailing comment is cut, so it cannot comment out the LIMIT
+	mock.ExpectQuery(`SELECT \* FROM \(SELECT observation_id, data, created_at FROM observations WHERE form_type = \$1 AND version > \$2 \) AS report LIMIT 3`).
+		WithArgs("household", int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "data", "created_at"}).
+			AddRow("obs-1", []byte(`{"size":4}`), created).
+			AddRow("obs-2", []byte(`{"size":2}`), created).
+			AddRow("obs-3", []byte(`{"size":1}`), created))
+	mock.ExpectRollback()
+
+	result, err := svc.Run(context.Background(), definition, map[string]string{"form": "household"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Rows) != 2 || !result.Truncated {
+		t.Errorf("Expected 2 rows, truncated; got %d, %v", len(result.Rows), result.Truncated)
+	}
+
+	var csv bytes.Buffer
+	if err := result.WriteCSV(&csv); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	expected := "observation_id,data,created_at\nobs-1,\"{\"\"size\"\":4}\",2025-09-01T08:00:00Z\nobs-2,\"{\"\"size\"\":2}\",2025-09-01T08:00:00Z\n"
+	if csv.String() != expected {
+		t.Errorf("Expected CSV\n%s\ngot\n%s", expected, csv.String())
+	}
+	var rows []map[string]any
+	var out bytes.Buffer
+	if err := result.WriteJSON(&out); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil || len(rows) != 2 || rows[0]["observation_id"] != "obs-1" {
+		t.Errorf("Unexpected JSON %s: %v", out.String(), err)
+	}
+
+	// Parameters are checked before the query runs
+	if _, err := svc.Run(context.Background(), definition, map[string]string{}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Expected ErrInvalidParameter for a missing parameter, got %v", err)
+	}
+	if _, err := svc.Run(context.Background(), definition, map[string]string{"form": "household", "min_version": "ten"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Expected ErrInvalidParameter for a malformed parameter, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, Config{}, logger.NewLogger())
+	mock.ExpectExec(`DELETE FROM export_reports`).WithArgs("gone").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.Delete(context.Background(), "gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
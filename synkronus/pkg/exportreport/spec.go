@@ -0,0 +1,267 @@
+package exportreport
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Spec declares a report over form types without SQL: one row per live observation of
+// From, joined with the observations of other form types that reference it
+type Spec struct {
+	From    Source   `json:"from"`
+	Joins   []Join   `json:"joins,omitempty"`
+	Columns []Column `json:"columns"`
+	Filters []Filter `json:"filters,omitempty"`
+	// OrderBy sorts the rows; by default they are in the order From was created
+	OrderBy []Order `json:"order_by,omitempty"`
+}
+
+// Source is a form type and the alias its fields are referenced by
+type Source struct {
+	FormType string `json:"form_type"`
+	As       string `json:"as"`
+}
+
+// Join adds the observations of another form type whose Field equals Equals, a field
+// of a form type listed before it. Fields are referenced as alias.field.
+type Join struct {
+	Source
+	Field  string `json:"field"`
+	Equals string `json:"equals"`
+	// Required drops rows without a match; by default they are kept with empty columns
+	Required bool `json:"required,omitempty"`
+}
+
+// Column is an output column
+type Column struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+}
+
+// Filter keeps the rows whose Field compares to a literal Value or to the report
+// parameter Param. A filter on an optional parameter that isn't given is skipped.
+type Filter struct {
+	Field string `json:"field"`
+	// Op is =, !=, <, <=, > or >=
+	Op    string `json:"op"`
+	Value any    `json:"value,omitempty"`
+	Param string `json:"param,omitempty"`
+}
+
+// Order sorts by a field
+type Order struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// metadataFields are the observation columns a field reference can name besides the
+// form data; data.<name> reaches a form field with one of these names
+var metadataFields = map[string]bool{
+	"observation_id": true, "form_type": true, "form_version": true, "created_at": true,
+	"updated_at": true, "submitted_by": true, "version": true,
+}
+
+var (
+	aliasPattern     = regexp.MustCompile(`^[a-z][a-z0-9_]{0,30}$`)
+	dataFieldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// specOps maps the filter operators to SQL
+var specOps = map[string]string{"=": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+// specCompiler turns a spec into a query with :name placeholders
+type specCompiler struct {
+	aliases map[string]bool
+	params  map[string]Parameter
+}
+
+// compileSpec builds the query of a spec. Filters on parameters missing from given are
+// left out.
+func compileSpec(spec *Spec, params map[string]Parameter, given map[string]bool) (string, error) {
+	c := &specCompiler{aliases: make(map[string]bool), params: params}
+
+	if err := c.addSource(spec.From); err != nil {
+		return "", err
+	}
+	base := quoteIdent(spec.From.As)
+	var from strings.Builder
+	fmt.Fprintf(&from, "FROM observations %s", base)
+	for i, join := range spec.Joins {
+		if err := c.addSource(join.Source); err != nil {
+			return "", err
+		}
+		field, err := c.field(join.Field)
+		if err != nil {
+			return "", fmt.Errorf("joins[%d].field: %w", i, err)
+		}
+		if alias, _, _ := strings.Cut(join.Field, "."); alias != join.As {
+			return "", fmt.Errorf("%w: joins[%d].field must be a field of %s", ErrInvalidDefinition, i, join.As)
+		}
+		equals, err := c.field(join.Equals)
+		if err != nil {
+			return "", fmt.Errorf("joins[%d].equals: %w", i, err)
+		}
+		if alias, _, _ := strings.Cut(join.Equals, "."); alias == join.As {
+			return "", fmt.Errorf("%w: joins[%d].equals must be a field of an earlier form type", ErrInvalidDefinition, i)
+		}
+		kind := "LEFT JOIN"
+		if join.Required {
+			kind = "JOIN"
+		}
+		alias := quoteIdent(join.As)
+		fmt.Fprintf(&from, "\n%s observations %s ON %s.form_type = %s AND NOT %s.deleted AND (%s)::text = (%s)::text",
+			kind, alias, alias, quoteLiteral(join.FormType), alias, field, equals)
+	}
+
+	if len(spec.Columns) == 0 {
+		return "", fmt.Errorf("%w: a spec needs at least one column", ErrInvalidDefinition)
+	}
+	names := make(map[string]bool)
+	columns := make([]string, 0, len(spec.Columns))
+	for i, column := range spec.Columns {
+		if column.Name == "" || names[column.Name] {
+			return "", fmt.Errorf("%w: columns[%d] needs a unique name", ErrInvalidDefinition, i)
+		}
+		names[column.Name] = true
+		field, err := c.field(column.Field)
+		if err != nil {
+			return "", fmt.Errorf("columns[%d]: %w", i, err)
+		}
+		columns = append(columns, field+" AS "+quoteIdent(column.Name))
+	}
+
+	where := []string{
+		fmt.Sprintf("%s.form_type = %s", base, quoteLiteral(spec.From.FormType)),
+		fmt.Sprintf("NOT %s.deleted", base),
+	}
+	for i, filter := range spec.Filters {
+		condition, err := c.filter(filter, given)
+		if err != nil {
+			return "", fmt.Errorf("filters[%d]: %w", i, err)
+		}
+		if condition != "" {
+			where = append(where, condition)
+		}
+	}
+
+	order := []string{base + ".created_at", base + ".observation_id"}
+	if len(spec.OrderBy) > 0 {
+		order = order[:0]
+		for i, o := range spec.OrderBy {
+			field, err := c.field(o.Field)
+			if err != nil {
+				return "", fmt.Errorf("order_by[%d]: %w", i, err)
+			}
+			if o.Desc {
+				field += " DESC"
+			}
+			order = append(order, field)
+		}
+	}
+
+	return fmt.Sprintf("SELECT %s\n%s\nWHERE %s\nORDER BY %s",
+		strings.Join(columns, ", "), from.String(), strings.Join(where, " AND "), strings.Join(order, ", ")), nil
+}
+
+// addSource registers the alias of a form type
+func (c *specCompiler) addSource(source Source) error {
+	if source.FormType == "" {
+		return fmt.Errorf("%w: every source needs a form_type", ErrInvalidDefinition)
+	}
+	if !aliasPattern.MatchString(source.As) {
+		return fmt.Errorf("%w: alias %q must be lowercase letters, digits and '_', starting with a letter", ErrInvalidDefinition, source.As)
+	}
+	if c.aliases[source.As] {
+		return fmt.Errorf("%w: alias %q is used twice", ErrInvalidDefinition, source.As)
+	}
+	c.aliases[source.As] = true
+	return nil
+}
+
+// field returns the SQL expression of an alias.field reference. Form data fields are
+// text; nested fields are reached with dots.
+func (c *specCompiler) field(ref string) (string, error) {
+	alias, path, ok := strings.Cut(ref, ".")
+	if !ok || !c.aliases[alias] {
+		return "", fmt.Errorf("%w: %q must start with the alias of a form type listed before it", ErrInvalidDefinition, ref)
+	}
+	if metadataFields[path] {
+		return quoteIdent(alias) + "." + path, nil
+	}
+	path = strings.TrimPrefix(path, "data.")
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if !dataFieldPattern.MatchString(segment) {
+			return "", fmt.Errorf("%w: invalid field %q", ErrInvalidDefinition, ref)
+		}
+	}
+	return fmt.Sprintf("(%s.data #>> '{%s}')", quoteIdent(alias), strings.Join(segments, ",")), nil
+}
+
+// filter returns the condition of a filter, or "" when it compares to a parameter that
+// wasn't given
+func (c *specCompiler) filter(filter Filter, given map[string]bool) (string, error) {
+	op, ok := specOps[filter.Op]
+	if !ok {
+		return "", fmt.Errorf("%w: op must be =, !=, <, <=, > or >=", ErrInvalidDefinition)
+	}
+	field, err := c.field(filter.Field)
+	if err != nil {
+		return "", err
+	}
+	_, path, _ := strings.Cut(filter.Field, ".")
+	data := !metadataFields[path]
+
+	var value, valueType string
+	switch {
+	case filter.Param != "" && filter.Value != nil:
+		return "", fmt.Errorf("%w: use either value or param", ErrInvalidDefinition)
+	case filter.Param != "":
+		param, ok := c.params[filter.Param]
+		if !ok {
+			return "", fmt.Errorf("%w: parameter %q is not declared", ErrInvalidDefinition, filter.Param)
+		}
+		if !given[filter.Param] {
+			return "", nil
+		}
+		value, valueType = ":"+filter.Param, param.Type
+	default:
+		switch v := filter.Value.(type) {
+		case string:
+			value, valueType = quoteLiteral(v), TypeString
+		case float64:
+			value, valueType = strconv.FormatFloat(v, 'f', -1, 64), TypeNumber
+		case bool:
+			value, valueType = strconv.FormatBool(v), TypeBoolean
+		default:
+			return "", fmt.Errorf("%w: value must be a string, number or boolean", ErrInvalidDefinition)
+		}
+	}
+
+	// Form data is text; compare it as the type of the value
+	if data {
+		switch valueType {
+		case TypeInteger, TypeNumber:
+			field += "::numeric"
+		case TypeBoolean:
+			field += "::boolean"
+		case TypeDate:
+			field += "::date"
+		case TypeTimestamp:
+			field += "::timestamptz"
+		}
+	}
+	return fmt.Sprintf("%s %s %s", field, op, value), nil
+}
+
+// quoteIdent quotes an SQL identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes an SQL string constant; the server uses standard conforming strings
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
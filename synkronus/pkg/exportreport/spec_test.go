@@ -0,0 +1,90 @@
+package exportreport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func householdSpec() *Spec {
+	return &Spec{
+		From: Source{FormType: "household", As: "h"},
+		Joins: []Join{{
+			Source: Source{FormType: "member", As: "m"},
+			Field:  "m.household_id",
+			Equals: "h.observation_id",
+		}},
+		Columns: []Column{
+			{Name: "household", Field: "h.observation_id"},
+			{Name: "village", Field: "h.address.village"},
+			{Name: "member age", Field: "m.age"},
+		},
+		Filters: []Filter{
+			{Field: "h.district", Op: "=", Param: "district"},
+			{Field: "m.age", Op: ">=", Value: float64(18)},
+			{Field: "h.created_at", Op: ">=", Param: "since"},
+		},
+	}
+}
+
+func TestCompileSpec(t *testing.T) {
+	params := map[string]Parameter{
+		"district": {Name: "district", Type: TypeString},
+		"since":    {Name: "since", Type: TypeDate},
+	}
+
+	query, err := compileSpec(householdSpec(), params, map[string]bool{"district": true})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	for _, part := range []string{
+		`SELECT "h".observation_id AS "household", ("h".data #>> '{address,village}') AS "village", ("m".data #>> '{age}') AS "member age"`,
+		`FROM observations "h"`,
+		`LEFT JOIN observations "m" ON "m".form_type = 'member' AND NOT "m".deleted AND (("m".data #>> '{household_id}'))::text = ("h".observation_id)::text`,
+		`WHERE "h".form_type = 'household' AND NOT "h".deleted AND ("h".data #>> '{district}') = :district AND ("m".data #>> '{age}')::numeric >= 18`,
+		`ORDER BY "h".created_at, "h".observation_id`,
+	} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected the query to contain\n%s\ngot\n%s", part, query)
+		}
+	}
+	// The filter on since is left out, as since wasn't given
+	if strings.Contains(query, ":since") {
+		t.Errorf("Expected the filter on since to be skipped:\n%s", query)
+	}
+
+	// The compiled query passes the same checks as SQL reports
+	tokens, err := tokenize(query)
+	if err != nil {
+		t.Fatalf("Failed to tokenize: %v", err)
+	}
+	if err := validateSQL(tokens); err != nil {
+		t.Errorf("Compiled query is rejected: %v", err)
+	}
+}
+
+func TestCompileSpec_Invalid(t *testing.T) {
+	params := map[string]Parameter{"district": {Name: "district"}}
+	for name, modify := range map[string]func(*Spec){
+		"unknown alias":               func(s *Spec) { s.Columns[0].Field = "x.name" },
+		"bad alias":                   func(s *Spec) { s.From.As = "H; DROP" },
+		"duplicate alias":             func(s *Spec) { s.Joins[0].As = "h" },
+		"bad field":                   func(s *Spec) { s.Columns[1].Field = "h.name'--" },
+		"no columns":                  func(s *Spec) { s.Columns = nil },
+		"duplicate column":            func(s *Spec) { s.Columns[1].Name = "household" },
+		"unknown op":                  func(s *Spec) { s.Filters[0].Op = "LIKE" },
+		"undeclared param":            func(s *Spec) { s.Filters[0].Param = "region" },
+		"value and param":             func(s *Spec) { s.Filters[0].Value = "North" },
+		"join on itself":              func(s *Spec) { s.Joins[0].Equals = "m.observation_id" },
+		"join field of another alias": func(s *Spec) { s.Joins[0].Field = "h.household_id" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			spec := householdSpec()
+			spec.Filters = spec.Filters[:2]
+			modify(spec)
+			if _, err := compileSpec(spec, params, map[string]bool{"district": true}); !errors.Is(err, ErrInvalidDefinition) {
+				t.Errorf("Expected ErrInvalidDefinition, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package exportreport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of SQL tokens
+const (
+	tokenWord   = iota // unquoted identifier or keyword, lowercased
+	tokenQuoted        // "quoted identifier"
+	tokenString        // string constant, including E'' and dollar quoting
+	tokenNumber
+	tokenParam // :name placeholder; text is the name
+	tokenOp    // operator or punctuation, one character at a time
+)
+
+// token is a lexical token of a report query; pos and end are its byte offsets
+type token struct {
+	kind int
+	text string
+	pos  int
+	end  int
+}
+
+// tokenize splits a query into tokens, dropping whitespace and comments. Its job is
+// validation, not parsing: it only needs to tell keywords and function names from the
+// contents of strings, quoted identifiers and comments.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			// Block comments nest in PostgreSQL
+			depth := 0
+			for i < len(query) {
+				if strings.HasPrefix(query[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(query[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("unterminated comment at offset %d", start)
+			}
+		case c == '\'':
+			end, err := scanString(query, i+1, false)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, token{kind: tokenString, text: query[start:i], pos: start, end: i})
+		case (c == 'e' || c == 'E') && i+1 < len(query) && query[i+1] == '\'':
+			end, err := scanString(query, i+2, true)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, token{kind: tokenString, text: query[start:i], pos: start, end: i})
+		case c == '"':
+			i++
+			for {
+				next := strings.IndexByte(query[i:], '"')
+				if next < 0 {
+					return nil, fmt.Errorf("unterminated quoted identifier at offset %d", start)
+				}
+				i += next + 1
+				if i < len(query) && query[i] == '"' {
+					i++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, token{kind: tokenQuoted, text: query[start:i], pos: start, end: i})
+		case c == '$':
+			// Dollar quoting: $$...$$ or $tag$...$tag$
+			j := i + 1
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			if j >= len(query) || query[j] != '$' || (j > i+1 && isDigit(query[i+1])) {
+				return nil, fmt.Errorf("positional parameters like $1 are not supported at offset %d; use :name", start)
+			}
+			tag := query[i : j+1]
+			end := strings.Index(query[j+1:], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string at offset %d", start)
+			}
+			i = j + 1 + end + len(tag)
+			tokens = append(tokens, token{kind: tokenString, text: query[start:i], pos: start, end: i})
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]) && (i == 0 || query[i-1] != ':'):
+			i++
+			for i < len(query) && isIdentChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: query[start+1 : i], pos: start, end: i})
+		case isIdentStart(c):
+			for i < len(query) && (isIdentChar(query[i]) || query[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(query[start:i]), pos: start, end: i})
+		case isDigit(c):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.' || query[i] == 'e' || query[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: query[start:i], pos: start, end: i})
+		default:
+			i++
+			tokens = append(tokens, token{kind: tokenOp, text: query[start:i], pos: start, end: i})
+		}
+	}
+	return tokens, nil
+}
+
+// scanString returns the offset after the string constant whose body starts at i.
+// Quotes are escaped by doubling them, and in E” strings also by a backslash.
+func scanString(query string, i int, backslashes bool) (int, error) {
+	start := i - 1
+	for i < len(query) {
+		switch {
+		case backslashes && query[i] == '\\':
+			i += 2
+		case query[i] == '\'':
+			if i+1 < len(query) && query[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+	return 0, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// forbiddenWords can't appear in a report query outside strings and quoted identifiers.
+// They write, lock or change the session; the transaction reports run in is read-only
+// as well, so this is the first of two barriers.
+var forbiddenWords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true,
+	"truncate": true, "drop": true, "alter": true, "create": true, "grant": true,
+	"revoke": true, "copy": true, "call": true, "do": true, "execute": true,
+	"prepare": true, "deallocate": true, "lock": true, "vacuum": true, "cluster": true,
+	"reindex": true, "refresh": true, "listen": true, "notify": true, "set": true,
+	"reset": true, "into": true, "share": true,
+}
+
+// forbiddenFunction reports whether a report query may not call a function. System
+// functions can read files, other tables or server settings, sleep, or signal backends;
+// the *_to_xml functions run a query given as a string, which no check can see.
+func forbiddenFunction(name string) bool {
+	switch {
+	case strings.HasPrefix(name, "pg_"), strings.HasPrefix(name, "lo_"), strings.HasPrefix(name, "dblink"),
+		strings.Contains(name, "to_xml"), strings.HasPrefix(name, "txid_"):
+		return true
+	}
+	switch name {
+	case "set_config", "current_setting", "nextval", "setval", "currval", "lastval", "version":
+		return true
+	}
+	return false
+}
+
+// validateSQL checks that a report query is a single SELECT (or WITH ... SELECT)
+// statement that neither writes nor calls system functions. Which tables it reads is
+// checked against the query plan.
+func validateSQL(tokens []token) error {
+	tokens = trimSemicolons(tokens)
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: the query is empty", ErrInvalidDefinition)
+	}
+	if first := tokens[0]; first.kind != tokenWord || (first.text != "select" && first.text != "with") {
+		return fmt.Errorf("%w: the query must be a SELECT statement", ErrInvalidDefinition)
+	}
+	for i, t := range tokens {
+		name := t.text
+		if t.kind == tokenQuoted {
+			// "pg_sleep"(1) calls pg_sleep too
+			name = strings.ReplaceAll(t.text[1:len(t.text)-1], `""`, `"`)
+		}
+		call := i+1 < len(tokens) && tokens[i+1].kind == tokenOp && tokens[i+1].text == "("
+		switch {
+		case t.kind == tokenOp && t.text == ";":
+			return fmt.Errorf("%w: the query must be a single statement", ErrInvalidDefinition)
+		case t.kind == tokenWord && forbiddenWords[name]:
+			return fmt.Errorf("%w: %s is not allowed in a report query", ErrInvalidDefinition, strings.ToUpper(name))
+		case (t.kind == tokenWord || t.kind == tokenQuoted) && call && forbiddenFunction(name):
+			return fmt.Errorf("%w: function %s is not allowed in a report query", ErrInvalidDefinition, name)
+		}
+	}
+	return nil
+}
+
+// trimSemicolons drops the semicolons ending a query
+func trimSemicolons(tokens []token) []token {
+	for len(tokens) > 0 && tokens[len(tokens)-1].kind == tokenOp && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// bindParams replaces the :name placeholders of a validated query with $1, $2, ... and
+// returns the parameter names in placeholder order. A name used twice gets one number.
+// Trailing semicolons are dropped, so the query can be wrapped.
+func bindParams(query string, tokens []token, declared map[string]Parameter) (string, []string, error) {
+	tokens = trimSemicolons(tokens)
+	var out strings.Builder
+	var names []string
+	numbers := make(map[string]int)
+	last := 0
+	for _, t := range tokens {
+		if t.kind != tokenParam {
+			continue
+		}
+		if _, ok := declared[t.text]; !ok {
+			return "", nil, fmt.Errorf("%w: parameter :%s is not declared", ErrInvalidDefinition, t.text)
+		}
+		n, ok := numbers[t.text]
+		if !ok {
+			names = append(names, t.text)
+			n = len(names)
+			numbers[t.text] = n
+		}
+		out.WriteString(query[last:t.pos])
+		out.WriteString("$" + strconv.Itoa(n))
+		last = t.end
+	}
+	end := len(query)
+	if len(tokens) > 0 {
+		end = tokens[len(tokens)-1].end
+	}
+	out.WriteString(query[last:end])
+	return out.String(), names, nil
+}
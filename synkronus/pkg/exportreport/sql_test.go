@@ -0,0 +1,66 @@
+package exportreport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateSQL(t *testing.T) {
+	for query, valid := range map[string]bool{
+		"SELECT observation_id FROM observations":                                       true,
+		"select count(*) from observations where form_type = :form_type;":               true,
+		"WITH recent AS (SELECT * FROM observations) SELECT * FROM recent":              true,
+		"SELECT data->>'update' AS \"delete\" FROM observations -- drop table users":    true,
+		"SELECT $$insert into users$$, 'pg_sleep(1)', E'it\\'s; fine' FROM attachments": true,
+		"SELECT created_at::date FROM observations /* nested /* ; */ comment */":        true,
+		"":                                   false,
+		"DELETE FROM observations":           false,
+		"SELECT 1; DELETE FROM observations": false,
+		"WITH gone AS (DELETE FROM observations RETURNING *) SELECT * FROM gone": false,
+		"SELECT * INTO copy FROM observations":                                   false,
+		"SELECT * FROM observations FOR UPDATE":                                  false,
+		"SELECT pg_sleep(10)":                                                    false,
+		"SELECT \"pg_read_file\"('/etc/passwd')":                                 false,
+		"SELECT query_to_xml('select * from users', true, true, '')":             false,
+		"SELECT set_config('role', 'admin', true)":                               false,
+		"SELECT * FROM observations WHERE version > $1":                          false,
+		"SELECT 'unterminated FROM observations":                                 false,
+	} {
+		tokens, err := tokenize(query)
+		if err == nil {
+			err = validateSQL(tokens)
+		}
+		if valid && err != nil {
+			t.Errorf("Expected %q to be valid, got %v", query, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	query := "SELECT data::text FROM observations WHERE form_type = :form AND created_at >= :since AND data->>'a' = ':form' AND form_type <> :form;"
+	tokens, err := tokenize(query)
+	if err != nil {
+		t.Fatalf("Failed to tokenize: %v", err)
+	}
+	declared := map[string]Parameter{"form": {Name: "form"}, "since": {Name: "since", Type: TypeDate}}
+
+	bound, names, err := bindParams(query, tokens, declared)
+	if err != nil {
+		t.Fatalf("Failed to bind: %v", err)
+	}
+	expected := "SELECT data::text FROM observations WHERE form_type = $1 AND created_at >= $2 AND data->>'a' = ':form' AND form_type <> $1"
+	if bound != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, bound)
+	}
+	if strings.Join(names, ",") != "form,since" {
+		t.Errorf("Expected form,since, got %v", names)
+	}
+
+	if _, _, err := bindParams(query, tokens, map[string]Parameter{"form": {Name: "form"}}); !errors.Is(err, ErrInvalidDefinition) {
+		t.Errorf("Expected ErrInvalidDefinition for an undeclared parameter, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package exportreport
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Output formats of reports
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// WriteCSV writes the result as CSV with a header row. Empty values are NULL.
+func (r *Result) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(r.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(r.Columns))
+	for _, row := range r.Rows {
+		for i, value := range row {
+			record[i] = formatValue(value)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the result as a JSON array of objects whose keys are in column order
+func (r *Result) WriteJSON(w io.Writer) error {
+	keys := make([][]byte, len(r.Columns))
+	for i, column := range r.Columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+	for n, row := range r.Rows {
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString("\n{")
+		for i, value := range row {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("failed to encode column %s: %w", r.Columns[i], err)
+			}
+			bw.Write(keys[i])
+			bw.WriteByte(':')
+			bw.Write(encoded)
+		}
+		bw.WriteByte('}')
+	}
+	bw.WriteString("\n]\n")
+	return bw.Flush()
+}
+
+// formatValue renders a result value as CSV text
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.RawMessage:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
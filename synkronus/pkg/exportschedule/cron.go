@@ -0,0 +1,174 @@
+package exportschedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCron is returned for a cron expression that can't be parsed
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// cronDescriptors are the shorthands accepted besides five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField bounds one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are Sunday
+}
+
+// Cron is a parsed five-field cron expression (minute, hour, day of month, month, day of
+// week), evaluated in UTC
+type Cron struct {
+	minutes, hours, days, months, weekdays []bool
+	// As in cron, a day matches either day field when both are restricted
+	anyDay, anyWeekday bool
+}
+
+// ParseCron parses a five-field cron expression or one of @yearly, @monthly, @weekly,
+// @daily and @hourly. Fields take *, values, ranges (1-5), lists (1,15) and steps (*/10).
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w: expected 5 fields (minute hour day-of-month month day-of-week), got %d", ErrInvalidCron, len(parts))
+	}
+
+	sets := make([][]bool, len(parts))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 7
+	sets[4][0] = sets[4][0] || sets[4][7]
+
+	return &Cron{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4][:7],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the values a field matches, indexed by value
+func parseCronField(part string, field cronField) ([]bool, error) {
+	set := make([]bool, field.max+1)
+	for _, item := range strings.Split(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: bad step %q in %s field", ErrInvalidCron, stepPart, field.name)
+			}
+			step = n
+		}
+
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = cronValue(lowPart, field); err != nil {
+				return nil, err
+			}
+			high = low
+			if isRange {
+				if high, err = cronValue(highPart, field); err != nil {
+					return nil, err
+				}
+				if high < low {
+					return nil, fmt.Errorf("%w: range %s is backwards in %s field", ErrInvalidCron, rangePart, field.name)
+				}
+			} else if hasStep {
+				// 5/15 means from 5 to the end in steps of 15
+				high = field.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// cronValue parses a single value of a field
+func cronValue(raw string, field cronField) (int, error) {
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("%w: %q in %s field is not a number from %d to %d", ErrInvalidCron, raw, field.name, field.min, field.max)
+	}
+	return v, nil
+}
+
+// dayMatches reports whether the day fields match a date
+func (c *Cron) dayMatches(t time.Time) bool {
+	day := c.days[t.Day()]
+	weekday := c.weekdays[t.Weekday()]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Next returns the first time after t the expression matches, or the zero time if it
+// never does (such as 0 0 31 2 *)
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every valid expression matches within eight years, which covers leap days
+	end := t.AddDate(8, 0, 0)
+	for t.Before(end) {
+		if !c.months[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,58 @@
+package exportschedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, 9, 24, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 9, 24, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 9, 24, 10, 30, 0, 0, time.UTC)},
+		{"0 6 * * *", time.Date(2025, 9, 25, 6, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 9, 25, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 9, 24, 11, 0, 0, 0, time.UTC)},
+		{"30 7 * * 1-5", time.Date(2025, 9, 25, 7, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 9, 28, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1,15 1,7 *", time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2025, 9, 24, 10, 25, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches
+		{"0 0 1 * 5", time.Date(2025, 9, 26, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := cron.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCron_NeverMatches(t *testing.T) {
+	cron, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if next := cron.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next run, got %v", next)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@often"} {
+		if _, err := ParseCron(expr); !errors.Is(err, ErrInvalidCron) {
+			t.Errorf("ParseCron(%q): expected ErrInvalidCron, got %v", expr, err)
+		}
+	}
+}
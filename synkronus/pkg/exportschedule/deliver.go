@@ -0,0 +1,136 @@
+package exportschedule
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Destination types
+const (
+	// DestinationDirectory writes each run to a new file in a directory under Config.Dir
+	DestinationDirectory = "directory"
+	// DestinationWebhook posts each run to a URL
+	DestinationWebhook = "webhook"
+)
+
+// Destination is where the output of a scheduled report is delivered
+type Destination struct {
+	// Type is directory or webhook
+	Type string `json:"type"`
+	// Path is the directory, relative to the server's export schedule directory, that
+	// directory deliveries are written to; empty for the directory itself
+	Path string `json:"path,omitempty"`
+	// URL receives webhook deliveries as a POST of the report
+	URL string `json:"url,omitempty"`
+}
+
+// validate checks a destination before a schedule is saved
+func (d *Destination) validate() error {
+	switch d.Type {
+	case DestinationDirectory:
+		if d.URL != "" {
+			return fmt.Errorf("%w: directory destinations take a path, not a url", ErrInvalidSchedule)
+		}
+		if d.Path != "" && !filepath.IsLocal(d.Path) {
+			return fmt.Errorf("%w: destination path must be relative and stay inside the export schedule directory", ErrInvalidSchedule)
+		}
+	case DestinationWebhook:
+		if d.Path != "" {
+			return fmt.Errorf("%w: webhook destinations take a url, not a path", ErrInvalidSchedule)
+		}
+		u, err := url.Parse(d.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: webhook url must be an http or https URL", ErrInvalidSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: destination type must be %s or %s", ErrInvalidSchedule, DestinationDirectory, DestinationWebhook)
+	}
+	return nil
+}
+
+// delivery is the output of one run
+type delivery struct {
+	schedule    string
+	report      string
+	format      string
+	contentType string
+	body        []byte
+	truncated   bool
+	ranAt       time.Time
+}
+
+// deliver sends the output of a run to the schedule's destination and describes where it went
+func (s *service) deliver(ctx context.Context, destination Destination, d *delivery) (string, error) {
+	switch destination.Type {
+	case DestinationDirectory:
+		return s.writeFile(destination, d)
+	case DestinationWebhook:
+		return s.postWebhook(ctx, destination, d)
+	}
+	return "", fmt.Errorf("unknown destination type %q", destination.Type)
+}
+
+// writeFile writes a run to a new file named after the schedule and the time of the run
+func (s *service) writeFile(destination Destination, d *delivery) (string, error) {
+	if s.config.Dir == "" {
+		return "", fmt.Errorf("no export schedule directory is configured")
+	}
+	dir := filepath.Join(s.config.Dir, destination.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create export directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.%s", d.schedule, d.ranAt.UTC().Format("20060102T150405Z"), d.format)
+	path := filepath.Join(dir, name)
+
+	// Write next to the target and rename, so readers never pick up half a file
+	tmp, err := os.CreateTemp(dir, ".export-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(d.body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	return filepath.Join(destination.Path, name), nil
+}
+
+// postWebhook posts a run to the destination URL; any status but 2xx fails the delivery
+func (s *service) postWebhook(ctx context.Context, destination Destination, d *delivery) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destination.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", d.contentType)
+	req.Header.Set("X-Export-Schedule", d.schedule)
+	req.Header.Set("X-Report-Name", d.report)
+	req.Header.Set("X-Report-Truncated", strconv.FormatBool(d.truncated))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return destination.URL, nil
+}
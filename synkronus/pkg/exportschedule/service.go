@@ -0,0 +1,478 @@
+// Package exportschedule runs export reports on cron schedules and delivers their output
+// to a directory or a webhook, so recurring deliveries need no one to download them.
+package exportschedule
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidName is returned for schedule names that don't match namePattern
+	ErrInvalidName = errors.New("schedule names must be lowercase letters, digits, '.', '_' and '-', starting with a letter or digit (max 64 characters)")
+	// ErrNotFound is returned for a schedule that isn't defined
+	ErrNotFound = errors.New("export schedule not found")
+	// ErrInvalidSchedule is returned for a schedule that can't be saved
+	ErrInvalidSchedule = errors.New("invalid export schedule")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Run outcomes
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Schedule runs a named export report on a cron expression and delivers its output
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is a five-field cron expression evaluated in UTC, or a shorthand like @daily
+	Cron   string `json:"cron"`
+	Report string `json:"report"`
+	// Format is csv (the default) or json
+	Format string `json:"format,omitempty"`
+	// Parameters are the values the report is run with
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	Destination Destination       `json:"destination"`
+	NextRunAt   *time.Time        `json:"next_run_at,omitempty"`
+	// The outcome of the latest run, scheduled or run now
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastStatus   *string    `json:"last_status,omitempty"`
+	LastError    *string    `json:"last_error,omitempty"`
+	LastDelivery *string    `json:"last_delivery,omitempty"`
+	CreatedBy    *string    `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedBy    *string    `json:"updated_by,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RunResult is the outcome of one run of a schedule
+type RunResult struct {
+	Schedule  string    `json:"schedule"`
+	Report    string    `json:"report"`
+	Status    string    `json:"status"`
+	Rows      int       `json:"rows"`
+	Truncated bool      `json:"truncated"`
+	Delivery  string    `json:"delivery,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	RanAt     time.Time `json:"ran_at"`
+}
+
+// Config contains export schedule settings
+type Config struct {
+	// Dir is the directory that directory destinations write under
+	Dir string
+	// Interval is how often due schedules are looked for; 0 disables the schedule
+	Interval time.Duration
+	// WebhookTimeout bounds one webhook delivery
+	WebhookTimeout time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Interval:       time.Minute,
+		WebhookTimeout: 30 * time.Second,
+	}
+}
+
+// Service stores export schedules and runs them when they are due
+type Service interface {
+	// List returns every schedule, sorted by name
+	List(ctx context.Context) ([]Schedule, error)
+	// Get returns a schedule, or ErrNotFound
+	Get(ctx context.Context, name string) (*Schedule, error)
+	// Save validates and creates or replaces a schedule; its next run is computed from now
+	Save(ctx context.Context, schedule Schedule, savedBy string) (*Schedule, error)
+	// Delete removes a schedule
+	Delete(ctx context.Context, name string) error
+	// RunNow runs a schedule at once, without moving its next scheduled run. A failed run
+	// is reported in the result, not as an error.
+	RunNow(ctx context.Context, name string) (*RunResult, error)
+	// Start runs due schedules on the configured interval until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type service struct {
+	db         *sql.DB
+	reports    exportreport.Service
+	httpClient *http.Client
+	config     Config
+	log        *logger.Logger
+}
+
+// NewService creates a new export schedule service running reports of the report service
+func NewService(db *sql.DB, reports exportreport.Service, config Config, log *logger.Logger) Service {
+	if config.WebhookTimeout <= 0 {
+		config.WebhookTimeout = DefaultConfig().WebhookTimeout
+	}
+	return &service{db: db, reports: reports, httpClient: &http.Client{}, config: config, log: log}
+}
+
+// ValidName reports whether name can be used for a schedule
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+const scheduleColumns = "name, cron, report, format, parameters, destination, next_run_at, last_run_at, last_status, last_error, last_delivery, created_by, created_at, updated_by, updated_at"
+
+// List returns every schedule
+func (s *service) List(ctx context.Context) (_ []Schedule, err error) {
+	ctx, span := tracing.Start(ctx, "exportschedule.List")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+scheduleColumns+" FROM export_schedules ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export schedules: %w", err)
+	}
+	defer rows.Close()
+	return scanSchedules(rows)
+}
+
+// Get returns a schedule
+func (s *service) Get(ctx context.Context, name string) (_ *Schedule, err error) {
+	ctx, span := tracing.Start(ctx, "exportschedule.Get", attribute.String("exportschedule.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	schedule, err := scanSchedule(s.db.QueryRowContext(ctx,
+		"SELECT "+scheduleColumns+" FROM export_schedules WHERE name = $1", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return schedule, err
+}
+
+// Save validates and creates or replaces a schedule
+func (s *service) Save(ctx context.Context, schedule Schedule, savedBy string) (_ *Schedule, err error) {
+	ctx, span := tracing.Start(ctx, "exportschedule.Save", attribute.String("exportschedule.name", schedule.Name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	cron, err := s.validate(ctx, &schedule)
+	if err != nil {
+		return nil, err
+	}
+	next := cron.Next(time.Now())
+
+	parameters, err := json.Marshal(schedule.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := json.Marshal(schedule.Destination)
+	if err != nil {
+		return nil, err
+	}
+	var by *string
+	if savedBy != "" {
+		by = &savedBy
+	}
+
+	saved, err := scanSchedule(s.db.QueryRowContext(ctx, `
+		INSERT INTO export_schedules (name, cron, report, format, parameters, destination, next_run_at, created_by, created_at, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), $8, NOW())
+		ON CONFLICT (name) DO UPDATE SET
+			cron = EXCLUDED.cron,
+			report = EXCLUDED.report,
+			format = EXCLUDED.format,
+			parameters = EXCLUDED.parameters,
+			destination = EXCLUDED.destination,
+			next_run_at = EXCLUDED.next_run_at,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING `+scheduleColumns,
+		schedule.Name, schedule.Cron, schedule.Report, schedule.Format, parameters, destination, next, by))
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Export schedule saved", "schedule", saved.Name, "report", saved.Report, "cron", saved.Cron, "nextRunAt", next, "by", savedBy)
+	return saved, nil
+}
+
+// validate checks a schedule before it is saved, fills in its defaults and returns its
+// parsed cron expression
+func (s *service) validate(ctx context.Context, schedule *Schedule) (*Cron, error) {
+	if !ValidName(schedule.Name) {
+		return nil, ErrInvalidName
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: cron expression %q never matches", ErrInvalidSchedule, schedule.Cron)
+	}
+
+	if schedule.Format == "" {
+		schedule.Format = exportreport.FormatCSV
+	}
+	if schedule.Format != exportreport.FormatCSV && schedule.Format != exportreport.FormatJSON {
+		return nil, fmt.Errorf("%w: format must be csv or json", ErrInvalidSchedule)
+	}
+	if err := schedule.Destination.validate(); err != nil {
+		return nil, err
+	}
+
+	// The report must exist and get every parameter it requires
+	definition, err := s.reports.Get(ctx, schedule.Report)
+	if errors.Is(err, exportreport.ErrNotFound) {
+		return nil, fmt.Errorf("%w: report %q is not defined", ErrInvalidSchedule, schedule.Report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	declared := make(map[string]bool, len(definition.Parameters))
+	for _, param := range definition.Parameters {
+		declared[param.Name] = true
+		if _, ok := schedule.Parameters[param.Name]; param.Required && param.Default == nil && !ok {
+			return nil, fmt.Errorf("%w: report %s requires parameter %s", ErrInvalidSchedule, definition.Name, param.Name)
+		}
+	}
+	for name := range schedule.Parameters {
+		if !declared[name] {
+			return nil, fmt.Errorf("%w: report %s has no parameter %s", ErrInvalidSchedule, definition.Name, name)
+		}
+	}
+	if schedule.Parameters == nil {
+		schedule.Parameters = map[string]string{}
+	}
+	return cron, nil
+}
+
+// Delete removes a schedule
+func (s *service) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "exportschedule.Delete", attribute.String("exportschedule.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM export_schedules WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete export schedule: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	s.log.Info("Export schedule deleted", "schedule", name)
+	return nil
+}
+
+// RunNow runs a schedule at once
+func (s *service) RunNow(ctx context.Context, name string) (*RunResult, error) {
+	schedule, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	result := s.run(ctx, schedule)
+	if err := s.record(ctx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Start runs due schedules on the configured interval until ctx is cancelled
+func (s *service) Start(ctx context.Context) {
+	if s.config.Interval <= 0 {
+		s.log.Info("Export schedules disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.runDue(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to run due export schedules", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDue runs the schedules whose next run has come and returns how many ran. Each is moved
+// to its next run before it runs, so an instance that claims a run is the only one running
+// it; runs missed while the server was down are made up once.
+func (s *service) runDue(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "exportschedule.runDue")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+scheduleColumns+" FROM export_schedules WHERE next_run_at <= NOW() ORDER BY next_run_at LIMIT 20")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query due export schedules: %w", err)
+	}
+	due, err := scanSchedules(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for i := range due {
+		schedule := &due[i]
+		claimed, err := s.claim(ctx, schedule)
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			continue
+		}
+		result := s.run(ctx, schedule)
+		if err := s.record(ctx, result); err != nil {
+			return ran, err
+		}
+		ran++
+	}
+	span.SetAttributes(attribute.Int("exportschedule.ran", ran))
+	return ran, nil
+}
+
+// claim moves a due schedule to its next run, unless another instance already did
+func (s *service) claim(ctx context.Context, schedule *Schedule) (bool, error) {
+	var next *time.Time
+	if cron, err := ParseCron(schedule.Cron); err == nil {
+		if t := cron.Next(time.Now()); !t.IsZero() {
+			next = &t
+		}
+	}
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE export_schedules SET next_run_at = $2 WHERE name = $1 AND next_run_at = $3",
+		schedule.Name, next, schedule.NextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim export schedule: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim export schedule: %w", err)
+	}
+	return n == 1, nil
+}
+
+// run runs the report of a schedule and delivers its output
+func (s *service) run(ctx context.Context, schedule *Schedule) *RunResult {
+	ctx, span := tracing.Start(ctx, "exportschedule.run", attribute.String("exportschedule.name", schedule.Name))
+	defer span.End()
+
+	result := &RunResult{Schedule: schedule.Name, Report: schedule.Report, Status: StatusOK, RanAt: time.Now()}
+	fail := func(err error) *RunResult {
+		tracing.RecordError(span, err)
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		s.log.Error("Export schedule run failed", "schedule", schedule.Name, "report", schedule.Report, "error", err)
+		return result
+	}
+
+	definition, err := s.reports.Get(ctx, schedule.Report)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get report: %w", err))
+	}
+	output, err := s.reports.Run(ctx, definition, schedule.Parameters)
+	if err != nil {
+		return fail(err)
+	}
+	result.Rows = len(output.Rows)
+	result.Truncated = output.Truncated
+
+	contentType := "text/csv; charset=utf-8"
+	write := output.WriteCSV
+	if schedule.Format == exportreport.FormatJSON {
+		contentType, write = "application/json", output.WriteJSON
+	}
+	var body bytes.Buffer
+	if err := write(&body); err != nil {
+		return fail(fmt.Errorf("failed to write report: %w", err))
+	}
+
+	result.Delivery, err = s.deliver(ctx, schedule.Destination, &delivery{
+		schedule:    schedule.Name,
+		report:      schedule.Report,
+		format:      schedule.Format,
+		contentType: contentType,
+		body:        body.Bytes(),
+		truncated:   output.Truncated,
+		ranAt:       result.RanAt,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	s.log.Info("Export schedule ran", "schedule", schedule.Name, "report", schedule.Report, "rows", result.Rows, "delivery", result.Delivery)
+	return result
+}
+
+// record stores the outcome of a run on its schedule
+func (s *service) record(ctx context.Context, result *RunResult) error {
+	var runError, runDelivery *string
+	if result.Error != "" {
+		runError = &result.Error
+	}
+	if result.Delivery != "" {
+		runDelivery = &result.Delivery
+	}
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE export_schedules SET last_run_at = $2, last_status = $3, last_error = $4, last_delivery = $5 WHERE name = $1",
+		result.Schedule, result.RanAt, result.Status, runError, runDelivery)
+	if err != nil {
+		return fmt.Errorf("failed to record export schedule run: %w", err)
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSchedule reads a schedule selected with scheduleColumns
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var schedule Schedule
+	var parameters, destination []byte
+	err := row.Scan(&schedule.Name, &schedule.Cron, &schedule.Report, &schedule.Format, &parameters, &destination,
+		&schedule.NextRunAt, &schedule.LastRunAt, &schedule.LastStatus, &schedule.LastError, &schedule.LastDelivery,
+		&schedule.CreatedBy, &schedule.CreatedAt, &schedule.UpdatedBy, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(parameters, &schedule.Parameters); err != nil {
+		return nil, fmt.Errorf("failed to read parameters of export schedule %s: %w", schedule.Name, err)
+	}
+	if err := json.Unmarshal(destination, &schedule.Destination); err != nil {
+		return nil, fmt.Errorf("failed to read destination of export schedule %s: %w", schedule.Name, err)
+	}
+	return &schedule, nil
+}
+
+// scanSchedules reads all schedules of a query
+func scanSchedules(rows *sql.Rows) ([]Schedule, error) {
+	schedules := []Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read export schedules: %w", err)
+	}
+	return schedules, nil
+}
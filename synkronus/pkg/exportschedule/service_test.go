@@ -0,0 +1,263 @@
+package exportschedule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/exportreport"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var scheduleColumnNames = strings.Split(scheduleColumns, ", ")
+
+// fakeReports holds one report with a required and an optional parameter
+type fakeReports struct {
+	exportreport.Service
+	values map[string]string
+}
+
+func (f *fakeReports) Get(ctx context.Context, name string) (*exportreport.Definition, error) {
+	if name != "daily-counts" {
+		return nil, exportreport.ErrNotFound
+	}
+	return &exportreport.Definition{Name: name, Parameters: []exportreport.Parameter{
+		{Name: "since", Type: exportreport.TypeDate, Required: true},
+		{Name: "form_type"},
+	}}, nil
+}
+
+func (f *fakeReports) Run(ctx context.Context, definition *exportreport.Definition, values map[string]string) (*exportreport.Result, error) {
+	f.values = values
+	return &exportreport.Result{Columns: []string{"form_type", "observations"}, Rows: [][]any{{"household", int64(12)}}}, nil
+}
+
+func scheduleRow(name, destination string) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(scheduleColumnNames).AddRow(name, "0 6 * * *", "daily-counts", "csv",
+		`{"since":"2025-09-01"}`, destination, now.Add(time.Hour), nil, nil, nil, nil, "admin", now, "admin", now)
+}
+
+func TestService_SaveValidates(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, &fakeReports{}, Config{}, logger.NewLogger()).(*service)
+	valid := Schedule{
+		Name:        "daily",
+		Cron:        "0 6 * * *",
+		Report:      "daily-counts",
+		Parameters:  map[string]string{"since": "2025-09-01"},
+		Destination: Destination{Type: DestinationDirectory, Path: "partners/moh"},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Schedule)
+		want   error
+	}{
+		{"bad name", func(s *Schedule) { s.Name = "Daily Counts" }, ErrInvalidName},
+		{"bad cron", func(s *Schedule) { s.Cron = "0 25 * * *" }, ErrInvalidSchedule},
+		{"cron never matches", func(s *Schedule) { s.Cron = "0 0 30 2 *" }, ErrInvalidSchedule},
+		{"bad format", func(s *Schedule) { s.Format = "xlsx" }, ErrInvalidSchedule},
+		{"unknown report", func(s *Schedule) { s.Report = "missing" }, ErrInvalidSchedule},
+		{"missing parameter", func(s *Schedule) { s.Parameters = nil }, ErrInvalidSchedule},
+		{"unknown parameter", func(s *Schedule) { s.Parameters["district"] = "north" }, ErrInvalidSchedule},
+		{"path escapes", func(s *Schedule) { s.Destination.Path = "../etc" }, ErrInvalidSchedule},
+		{"absolute path", func(s *Schedule) { s.Destination.Path = "/tmp" }, ErrInvalidSchedule},
+		{"bad destination type", func(s *Schedule) { s.Destination.Type = "ftp" }, ErrInvalidSchedule},
+		{"webhook without url", func(s *Schedule) { s.Destination = Destination{Type: DestinationWebhook} }, ErrInvalidSchedule},
+		{"webhook not http", func(s *Schedule) { s.Destination = Destination{Type: DestinationWebhook, URL: "file:///etc/passwd"} }, ErrInvalidSchedule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := valid
+			schedule.Parameters = map[string]string{"since": "2025-09-01"}
+			tt.modify(&schedule)
+			if _, err := svc.Save(context.Background(), schedule, "admin"); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestService_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, &fakeReports{}, Config{}, logger.NewLogger()).(*service)
+	destination := `{"type":"directory","path":"partners/moh"}`
+
+	mock.ExpectQuery(`INSERT INTO export_schedules`).
+		WithArgs("daily", "0 6 * * *", "daily-counts", "csv", []byte(`{"since":"2025-09-01"}`), []byte(destination), sqlmock.AnyArg(), "admin").
+		WillReturnRows(scheduleRow("daily", destination))
+
+	saved, err := svc.Save(context.Background(), Schedule{
+		Name:        "daily",
+		Cron:        "0 6 * * *",
+		Report:      "daily-counts",
+		Parameters:  map[string]string{"since": "2025-09-01"},
+		Destination: Destination{Type: DestinationDirectory, Path: "partners/moh"},
+	}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if saved.Destination.Path != "partners/moh" || saved.Parameters["since"] != "2025-09-01" || saved.NextRunAt == nil {
+		t.Errorf("Unexpected schedule: %+v", saved)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_RunNowToDirectory(t *testing.T) {
+	dir := t.TempDir()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	reports := &fakeReports{}
+	svc := NewService(db, reports, Config{Dir: dir}, logger.NewLogger()).(*service)
+
+	mock.ExpectQuery(`SELECT .+ FROM export_schedules WHERE name = \$1`).
+		WithArgs("daily").
+		WillReturnRows(scheduleRow("daily", `{"type":"directory","path":"partners"}`))
+	mock.ExpectExec(`UPDATE export_schedules SET last_run_at = \$2, last_status = \$3, last_error = \$4, last_delivery = \$5 WHERE name = \$1`).
+		WithArgs("daily", sqlmock.AnyArg(), StatusOK, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := svc.RunNow(context.Background(), "daily")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusOK || result.Rows != 1 || !strings.HasPrefix(result.Delivery, "partners/daily-") {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if reports.values["since"] != "2025-09-01" {
+		t.Errorf("Report ran with %v", reports.values)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, result.Delivery))
+	if err != nil {
+		t.Fatalf("Export not written: %v", err)
+	}
+	if string(content) != "form_type,observations\nhousehold,12\n" {
+		t.Errorf("Unexpected export: %q", content)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_RunNowToWebhook(t *testing.T) {
+	var received string
+	var headers http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received, headers = string(body), r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+
+		t.Fatalf("Failed to create mock database: %v", err)
+
+	}
+
+	defer db.Close()
+
+	svc := NewService(db, &fakeReports{}, Config{}, logger.NewLogger()).(*service)
+	destination := `{"type":"webhook","url":"` + server.URL + `/ingest"}`
+	for _, want := range []string{StatusOK, StatusFailed} {
+		mock.ExpectQuery(`SELECT .+ FROM export_schedules WHERE name = \$1`).
+			WithArgs("daily").
+			WillReturnRows(scheduleRow("daily", destination))
+		mock.ExpectExec(`UPDATE export_schedules SET last_run_at`).
+			WithArgs("daily", sqlmock.AnyArg(), want, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	result, err := svc.RunNow(context.Background(), "daily")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusOK || result.Delivery != server.URL+"/ingest" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if received != "form_type,observations\nhousehold,12\n" || headers.Get("X-Export-Schedule") != "daily" || headers.Get("X-Report-Name") != "daily-counts" {
+		t.Errorf("Unexpected delivery: %q %v", received, headers)
+	}
+
+	// A webhook that doesn't accept the delivery fails the run
+	status = http.StatusBadGateway
+	result, err = svc.RunNow(context.Background(), "daily")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusFailed || !strings.Contains(result.Error, "502") {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_RunDueClaimsEachRunOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, &fakeReports{}, Config{Dir: t.TempDir()}, logger.NewLogger()).(*service)
+
+	mock.ExpectQuery(`SELECT .+ FROM export_schedules WHERE next_run_at <= NOW\(\)`).
+		WillReturnRows(scheduleRow("daily", `{"type":"directory"}`))
+	// Another instance claimed it first
+	mock.ExpectExec(`UPDATE export_schedules SET next_run_at = \$2 WHERE name = \$1 AND next_run_at = \$3`).
+		WithArgs("daily", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ran, err := svc.runDue(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("Expected no runs, got %d", ran)
+	}
+
+	mock.ExpectQuery(`SELECT .+ FROM export_schedules WHERE next_run_at <= NOW\(\)`).
+		WillReturnRows(scheduleRow("daily", `{"type":"directory"}`))
+	mock.ExpectExec(`UPDATE export_schedules SET next_run_at = \$2 WHERE name = \$1 AND next_run_at = \$3`).
+		WithArgs("daily", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE export_schedules SET last_run_at`).
+		WithArgs("daily", sqlmock.AnyArg(), StatusOK, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err = svc.runDue(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("Expected one run, got %d", ran)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
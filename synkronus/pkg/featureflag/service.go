@@ -0,0 +1,307 @@
+package featureflag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Flags honored by the server
+const (
+	// AnonymizedExport drops fields tagged x-sensitive from data exports for every
+	// caller, admins included
+	AnonymizedExport = "anonymized_export"
+)
+
+// Definition describes a flag the server knows about
+type Definition struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// Definitions lists the flags honored by the server. Other flags can still be set; they
+// have no effect on the server but are reported to clients through /version.
+var Definitions = []Definition{
+	{
+		Name:        AnonymizedExport,
+		Description: "Omit fields tagged x-sensitive from data exports for all users, including admins",
+	},
+}
+
+var (
+	// ErrInvalidName is returned for flag names that are not lowercase snake_case
+	ErrInvalidName = errors.New("flag names must be lowercase letters, digits and underscores, starting with a letter (max 64 characters)")
+	// ErrFlagNotFound is returned when resetting a flag that has no stored value
+	ErrFlagNotFound = errors.New("feature flag not found")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Flag is the current state of a feature flag
+type Flag struct {
+	Name        string     `json:"name"`
+	Enabled     bool       `json:"enabled"`
+	Default     bool       `json:"default"`
+	Known       bool       `json:"known"` // honored by the server, not only reported to clients
+	Description string     `json:"description,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"` // unset while the flag uses its default
+	UpdatedBy   *string    `json:"updated_by,omitempty"`
+}
+
+// Config contains feature flag settings
+type Config struct {
+	// CacheTTL is how long lookups are served from memory. Changes made through this
+	// instance apply at once; other instances see them once their cache expires.
+	CacheTTL time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		CacheTTL: 30 * time.Second,
+	}
+}
+
+// Service stores per-deployment feature flags and answers cached lookups
+type Service interface {
+	// IsEnabled reports whether a flag is on. Lookup failures fall back to the last
+	// known state, or to the flag's default.
+	IsEnabled(ctx context.Context, name string) bool
+	// Active returns the names of all enabled flags, sorted
+	Active(ctx context.Context) []string
+	// List returns every known or stored flag, sorted by name
+	List(ctx context.Context) ([]Flag, error)
+	// Set turns a flag on or off; an empty description keeps the current one
+	Set(ctx context.Context, name string, enabled bool, description, updatedBy string) (*Flag, error)
+	// Reset removes the stored value so the flag uses its default again
+	Reset(ctx context.Context, name string) error
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+
+	mu       sync.Mutex
+	cached   map[string]bool
+	loadedAt time.Time
+}
+
+// NewService creates a new feature flag service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// definition returns the built-in definition of a flag
+func definition(name string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// IsEnabled reports whether a flag is on
+func (s *service) IsEnabled(ctx context.Context, name string) bool {
+	return s.states(ctx)[name]
+}
+
+// Active returns the names of all enabled flags
+func (s *service) Active(ctx context.Context) []string {
+	active := []string{}
+	for name, enabled := range s.states(ctx) {
+		if enabled {
+			active = append(active, name)
+		}
+	}
+	sort.Strings(active)
+	return active
+}
+
+// states returns the state of every flag, reading the database when the cache expired
+func (s *service) states(ctx context.Context) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.loadedAt) < s.config.CacheTTL {
+		return s.cached
+	}
+
+	states, err := s.load(ctx)
+	if err != nil {
+		if s.cached != nil {
+			s.log.Warn("Failed to refresh feature flags, using the last known state", "error", err)
+			return s.cached
+		}
+		s.log.Warn("Failed to load feature flags, using defaults", "error", err)
+		return defaultStates()
+	}
+
+	s.cached = states
+	s.loadedAt = time.Now()
+	return states
+}
+
+// load reads the stored flags on top of the defaults
+func (s *service) load(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, enabled FROM feature_flags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	states := defaultStates()
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		states[name] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feature flags: %w", err)
+	}
+
+	return states, nil
+}
+
+// defaultStates returns the default state of the known flags
+func defaultStates() map[string]bool {
+	states := make(map[string]bool, len(Definitions))
+	for _, def := range Definitions {
+		states[def.Name] = def.Default
+	}
+	return states
+}
+
+// invalidate makes the next lookup read the database
+func (s *service) invalidate() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+// List returns every known or stored flag
+func (s *service) List(ctx context.Context) (_ []Flag, err error) {
+	ctx, span := tracing.Start(ctx, "featureflag.List")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT name, enabled, description, updated_at, updated_by FROM feature_flags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := make(map[string]Flag)
+	for _, def := range Definitions {
+		flags[def.Name] = Flag{Name: def.Name, Enabled: def.Default, Default: def.Default, Known: true, Description: def.Description}
+	}
+	for rows.Next() {
+		flag, err := scanFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags[flag.Name] = *flag
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feature flags: %w", err)
+	}
+
+	list := make([]Flag, 0, len(flags))
+	for _, flag := range flags {
+		list = append(list, flag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Set turns a flag on or off
+func (s *service) Set(ctx context.Context, name string, enabled bool, description, updatedBy string) (_ *Flag, err error) {
+	ctx, span := tracing.Start(ctx, "featureflag.Set",
+		attribute.String("featureflag.name", name), attribute.Bool("featureflag.enabled", enabled))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+
+	query := `
+		INSERT INTO feature_flags (name, enabled, description, updated_by)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		ON CONFLICT (name) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			description = COALESCE(EXCLUDED.description, feature_flags.description),
+			updated_at = NOW(),
+			updated_by = EXCLUDED.updated_by
+		RETURNING name, enabled, description, updated_at, updated_by
+	`
+
+	flag, err := scanFlag(s.db.QueryRowContext(ctx, query, name, enabled, description, updatedBy))
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+
+	s.log.Info("Feature flag changed", "flag", name, "enabled", enabled, "by", updatedBy)
+	return flag, nil
+}
+
+// Reset removes the stored value of a flag
+func (s *service) Reset(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "featureflag.Reset", attribute.String("featureflag.name", name))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM feature_flags WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to reset feature flag: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrFlagNotFound
+	}
+	s.invalidate()
+
+	s.log.Info("Feature flag reset to default", "flag", name)
+	return nil
+}
+
+// scanFlag reads a feature_flags row and fills in the built-in definition
+func scanFlag(row interface{ Scan(...any) error }) (*Flag, error) {
+	var flag Flag
+	var description, updatedBy sql.NullString
+	var updatedAt time.Time
+	if err := row.Scan(&flag.Name, &flag.Enabled, &description, &updatedAt, &updatedBy); err != nil {
+		return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+	}
+	flag.UpdatedAt = &updatedAt
+	if updatedBy.Valid {
+		flag.UpdatedBy = &updatedBy.String
+	}
+	if def, ok := definition(flag.Name); ok {
+		flag.Known = true
+		flag.Default = def.Default
+		flag.Description = def.Description
+	}
+	if description.Valid {
+		flag.Description = description.String
+	}
+	return &flag, nil
+}
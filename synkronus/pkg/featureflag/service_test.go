@@ -0,0 +1,129 @@
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestService_IsEnabledCachesLookups(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, Config{CacheTTL: time.Minute}, logger.NewLogger())
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT name, enabled FROM feature_flags`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "enabled"}).
+			AddRow(AnonymizedExport, true).
+			AddRow("client_dark_mode", true).
+			AddRow("async_push", false))
+
+	if !svc.IsEnabled(ctx, AnonymizedExport) {
+		t.Errorf("Expected %s to be enabled", AnonymizedExport)
+	}
+	// Served from the cache; a second query would fail the expectations
+	if svc.IsEnabled(ctx, "async_push") {
+		t.Errorf("Expected async_push to be disabled")
+	}
+	if got := svc.Active(ctx); len(got) != 2 || got[0] != AnonymizedExport || got[1] != "client_dark_mode" {
+		t.Errorf("Unexpected active flags: %v", got)
+	}
+
+	// Changing a flag invalidates the cache
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO feature_flags`).
+		WithArgs(AnonymizedExport, false, "", "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "enabled", "description", "updated_at", "updated_by"}).
+			AddRow(AnonymizedExport, false, nil, now, "admin"))
+	flag, err := svc.Set(ctx, AnonymizedExport, false, "", "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !flag.Known || flag.Description == "" || flag.UpdatedBy == nil || *flag.UpdatedBy != "admin" {
+		t.Errorf("Expected the built-in definition to be filled in, got %+v", flag)
+	}
+
+	mock.ExpectQuery(`SELECT name, enabled FROM feature_flags`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "enabled"}).AddRow(AnonymizedExport, false))
+	if svc.IsEnabled(ctx, AnonymizedExport) {
+		t.Errorf("Expected %s to be disabled after Set", AnonymizedExport)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_IsEnabledFallsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, Config{CacheTTL: 0}, logger.NewLogger())
+	ctx := context.Background()
+
+	// Without a previous state the defaults apply
+	mock.ExpectQuery(`SELECT name, enabled FROM feature_flags`).WillReturnError(errors.New("connection refused"))
+	if svc.IsEnabled(ctx, AnonymizedExport) {
+		t.Errorf("Expected the default state when the database is unavailable")
+	}
+
+	// Afterwards the last known state is kept
+	mock.ExpectQuery(`SELECT name, enabled FROM feature_flags`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "enabled"}).AddRow(AnonymizedExport, true))
+	mock.ExpectQuery(`SELECT name, enabled FROM feature_flags`).WillReturnError(errors.New("connection refused"))
+	if !svc.IsEnabled(ctx, AnonymizedExport) || !svc.IsEnabled(ctx, AnonymizedExport) {
+		t.Errorf("Expected the last known state when a refresh fails")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_SetRejectsInvalidNames(t *testing.T) {
+	svc := NewService(nil, DefaultConfig(), logger.NewLogger())
+	for _, name := range []string{"", "Async", "async-push", "1flag"} {
+		if _, err := svc.Set(context.Background(), name, true, "", "admin"); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Set(%q) error = %v, want ErrInvalidName", name, err)
+		}
+	}
+}
+
+func TestService_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	mock.ExpectQuery(`SELECT name, enabled, description, updated_at, updated_by FROM feature_flags`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "enabled", "description", "updated_at", "updated_by"}).
+			AddRow("client_dark_mode", true, "Dark theme in the app", time.Now(), "admin"))
+
+	flags, err := svc.List(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(flags) != 2 || flags[0].Name != AnonymizedExport || flags[1].Name != "client_dark_mode" {
+		t.Fatalf("Unexpected flags: %+v", flags)
+	}
+	if !flags[0].Known || flags[0].Enabled || flags[0].UpdatedAt != nil {
+		t.Errorf("Expected %s at its default, got %+v", AnonymizedExport, flags[0])
+	}
+	if flags[1].Known || !flags[1].Enabled {
+		t.Errorf("Expected an enabled client-only flag, got %+v", flags[1])
+	}
+}
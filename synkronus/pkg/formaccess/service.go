@@ -0,0 +1,154 @@
+// Package formaccess reads the roles form schemas require with x-required-role
+package formaccess
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// Config contains form access configuration
+type Config struct {
+	// BundlePath is the active app bundle; a form schema's x-required-role limits who
+	// syncs the form
+	BundlePath string
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// Service tells which roles may push and pull the observations of a form type. A schema
+// declares x-required-role as a role name or a list of them; a user needs one of them,
+// where admin includes read-write and read-write includes read-only.
+type Service interface {
+	// RequiredRoles returns the roles declared by the form type's schema; nil when the form
+	// is open to every user
+	RequiredRoles(formType string) ([]models.Role, error)
+
+	// DeniedFormTypes lists the form types of the active bundle a role may not access,
+	// sorted by name
+	DeniedFormTypes(role models.Role) ([]string, error)
+}
+
+// roleRanks orders the roles; a role includes every role of a lower rank
+var roleRanks = map[models.Role]int{
+	models.RoleReadOnly:  1,
+	models.RoleReadWrite: 2,
+	models.RoleAdmin:     3,
+}
+
+// Allowed reports whether a user with role may access a form that requires one of roles
+func Allowed(role models.Role, roles []models.Role) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	rank := roleRanks[role]
+	for _, required := range roles {
+		if rank > 0 && rank >= roleRanks[required] {
+			return true
+		}
+	}
+	return false
+}
+
+type service struct {
+	config  Config
+	log     *logger.Logger
+	schemas *formschema.Cache[[]models.Role]
+}
+
+// NewService creates a new form access service
+func NewService(config Config, log *logger.Logger) Service {
+	return &service{
+		config: config,
+		log:    log,
+		schemas: formschema.NewCache(config.BundlePath, func(formType string, data []byte) ([]models.Role, error) {
+			roles, err := ParseSchema(data)
+			if err != nil {
+				// A schema we can't read keeps the form to admins rather than opening it to everyone
+				log.Warn("Restricting form to admins", "formType", formType, "error", err)
+				return []models.Role{models.RoleAdmin}, nil
+			}
+			return roles, nil
+		}),
+	}
+}
+
+// RequiredRoles returns the roles declared by the form type's schema. Schemas are re-read
+// when the bundle changes them.
+func (s *service) RequiredRoles(formType string) ([]models.Role, error) {
+	return s.schemas.Get(formType)
+}
+
+// DeniedFormTypes lists the form types of the active bundle a role may not access
+func (s *service) DeniedFormTypes(role models.Role) ([]string, error) {
+	seen := make(map[string]bool)
+	var denied []string
+	for _, dir := range formschema.Dirs(s.config.BundlePath) {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list forms: %w", err)
+		}
+		for _, entry := range entries {
+			formType := entry.Name()
+			if !entry.IsDir() || seen[formType] {
+				continue
+			}
+			seen[formType] = true
+			roles, err := s.RequiredRoles(formType)
+			if err != nil {
+				return nil, err
+			}
+			if !Allowed(role, roles) {
+				denied = append(denied, formType)
+			}
+		}
+	}
+	sort.Strings(denied)
+	return denied, nil
+}
+
+// ParseSchema reads x-required-role from the root of a form schema. It accepts a role
+// name or a list of role names.
+func ParseSchema(data []byte) ([]models.Role, error) {
+	var schema struct {
+		RequiredRole json.RawMessage `json:"x-required-role"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if len(schema.RequiredRole) == 0 || string(schema.RequiredRole) == "null" {
+		return nil, nil
+	}
+
+	var names []string
+	var name string
+	if err := json.Unmarshal(schema.RequiredRole, &name); err == nil {
+		names = []string{name}
+	} else if err := json.Unmarshal(schema.RequiredRole, &names); err != nil {
+		return nil, fmt.Errorf("x-required-role must be a role name or a list of role names")
+	}
+
+	roles := make([]models.Role, 0, len(names))
+	for _, name := range names {
+		role := models.Role(name)
+		if _, ok := roleRanks[role]; !ok {
+			return nil, fmt.Errorf("x-required-role: unknown role %q", name)
+		}
+		roles = append(roles, role)
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("x-required-role must name at least one role")
+	}
+	return roles, nil
+}
@@ -0,0 +1,89 @@
+package formaccess
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		expected []models.Role
+		wantErr  bool
+	}{
+		{"no requirement", `{"type":"object"}`, nil, false},
+		{"single role", `{"x-required-role":"read-write"}`, []models.Role{models.RoleReadWrite}, false},
+		{"list of roles", `{"x-required-role":["admin","read-write"]}`, []models.Role{models.RoleAdmin, models.RoleReadWrite}, false},
+		{"unknown role", `{"x-required-role":"supervisor"}`, nil, true},
+		{"empty list", `{"x-required-role":[]}`, nil, true},
+		{"wrong type", `{"x-required-role":3}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, err := ParseSchema([]byte(tt.schema))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(roles, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, roles)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	readWrite := []models.Role{models.RoleReadWrite}
+	if !Allowed(models.RoleReadOnly, nil) {
+		t.Error("Expected open forms to be allowed")
+	}
+	if Allowed(models.RoleReadOnly, readWrite) {
+		t.Error("Expected read-only to lack read-write")
+	}
+	if !Allowed(models.RoleReadWrite, readWrite) || !Allowed(models.RoleAdmin, readWrite) {
+		t.Error("Expected read-write and admin to have read-write")
+	}
+	if Allowed(models.Role("unknown"), []models.Role{models.RoleReadOnly}) {
+		t.Error("Expected an unknown role to have no access")
+	}
+}
+
+func TestService_DeniedFormTypes(t *testing.T) {
+	config := DefaultConfig()
+	config.BundlePath = t.TempDir()
+	forms := filepath.Join(config.BundlePath, "forms")
+	formschema.WriteSchema(t, forms, "household", `{"type":"object"}`)
+	formschema.WriteSchema(t, forms, "payments", `{"type":"object","x-required-role":"admin"}`)
+	formschema.WriteSchema(t, filepath.Join(config.BundlePath, "app", "forms"), "visits", `{"type":"object","x-required-role":["read-write"]}`)
+	formschema.WriteSchema(t, forms, "broken", `{"x-required-role":"supervisor"}`)
+	s := NewService(config, logger.NewLogger())
+
+	tests := map[models.Role][]string{
+		models.RoleReadOnly:  {"broken", "payments", "visits"},
+		models.RoleReadWrite: {"broken", "payments"},
+		models.RoleAdmin:     nil,
+	}
+	for role, expected := range tests {
+		denied, err := s.DeniedFormTypes(role)
+		if err != nil {
+			t.Fatalf("DeniedFormTypes(%s): %v", role, err)
+		}
+		if !reflect.DeepEqual(denied, expected) {
+			t.Errorf("%s: expected %v, got %v", role, expected, denied)
+		}
+	}
+
+	// A changed schema is picked up
+	formschema.WriteSchema(t, forms, "payments", `{"type":"object","x-required-role":"read-only"}`)
+	if roles, err := s.RequiredRoles("payments"); err != nil || !reflect.DeepEqual(roles, []models.Role{models.RoleReadOnly}) {
+		t.Errorf("Expected the rewritten requirement, got %v (%v)", roles, err)
+	}
+	if roles, err := s.RequiredRoles("../payments"); err != nil || roles != nil {
+		t.Errorf("Expected no requirement for an invalid form type, got %v (%v)", roles, err)
+	}
+}
@@ -0,0 +1,128 @@
+package formmigration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Script is a migration script's source
+type Script struct {
+	Path   string // Path within the app bundle, for error messages
+	Source []byte
+}
+
+// Runner runs a chain of migration scripts over a batch of observations. input is a JSON
+// array of inputRecord; the output is a JSON array of outputRecord in the same order.
+type Runner interface {
+	Run(ctx context.Context, scripts []Script, input []byte) ([]byte, error)
+}
+
+// runnerScript loads the migration modules given as arguments and applies them in order to
+// each observation read from stdin. A script exports the migrate function itself or as
+// `migrate`; returning undefined keeps the data it was given, which it may have modified.
+const runnerScript = `'use strict';
+const fs = require('fs');
+const path = require('path');
+function fail(message) {
+  process.stderr.write(message);
+  process.exit(1);
+}
+const steps = process.argv.slice(2).map((file, i) => {
+  let mod;
+  try {
+    mod = require(path.resolve(file));
+  } catch (e) {
+    fail('script ' + i + ' failed to load: ' + ((e && e.message) || e));
+  }
+  const migrate = typeof mod === 'function' ? mod : mod && mod.migrate;
+  if (typeof migrate !== 'function') {
+    fail('script ' + i + ' does not export a migrate function');
+  }
+  return migrate;
+});
+const input = JSON.parse(fs.readFileSync(0, 'utf8'));
+const output = input.map((record) => {
+  try {
+    let data = record.data;
+    for (const migrate of steps) {
+      const result = migrate(data, record.observation);
+      if (result !== undefined) data = result;
+    }
+    if (data === null || typeof data !== 'object' || Array.isArray(data)) {
+      throw new Error('migration did not return an object');
+    }
+    return { data };
+  } catch (e) {
+    return { error: String((e && e.message) || e) };
+  }
+});
+process.stdout.write(JSON.stringify(output));
+`
+
+// nodeRunner runs scripts with a Node.js binary, one process per batch
+type nodeRunner struct {
+	nodePath string
+}
+
+// NewNodeRunner creates a runner using the Node.js binary at nodePath, looked up in PATH
+// when it has no directory
+func NewNodeRunner(nodePath string) Runner {
+	return &nodeRunner{nodePath: nodePath}
+}
+
+func (r *nodeRunner) Run(ctx context.Context, scripts []Script, input []byte) ([]byte, error) {
+	node, err := exec.LookPath(r.nodePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	dir, err := os.MkdirTemp("", "synkronus-formmigration-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{filepath.Join(dir, "runner.js")}
+	if err := os.WriteFile(args[0], []byte(runnerScript), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write migration runner: %w", err)
+	}
+	for i, script := range scripts {
+		// .cjs keeps the scripts CommonJS whatever package.json sits above the directory
+		name := filepath.Join(dir, "step"+strconv.Itoa(i)+".cjs")
+		if err := os.WriteFile(name, script.Source, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write migration script %s: %w", script.Path, err)
+		}
+		args = append(args, name)
+	}
+
+	cmd := exec.CommandContext(ctx, node, args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("migration scripts timed out: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("migration scripts failed: %v: %s", err, describeFailure(stderr.String(), scripts))
+	}
+	return stdout.Bytes(), nil
+}
+
+// describeFailure shortens the runner's error output and names scripts by their bundle path
+func describeFailure(stderr string, scripts []Script) string {
+	message := strings.TrimSpace(stderr)
+	if len(message) > 1000 {
+		message = message[:1000] + "..."
+	}
+	for i, script := range scripts {
+		message = strings.ReplaceAll(message, "script "+strconv.Itoa(i)+" ", script.Path+" ")
+	}
+	return message
+}
@@ -0,0 +1,68 @@
+package formmigration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func requireNode(t *testing.T) Runner {
+	t.Helper()
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("Node.js is not installed")
+	}
+	return NewNodeRunner("node")
+}
+
+func TestNodeRunner(t *testing.T) {
+	runner := requireNode(t)
+	scripts := []Script{
+		{Path: "forms/survey/migrations/1_2.js", Source: []byte(`
+			module.exports = function migrate(data, observation) {
+				if (data.fail) throw new Error('cannot migrate ' + observation.observation_id);
+				return { ...data, household_size: Number(data.size), size: undefined };
+			};`)},
+		{Path: "forms/survey/migrations/2_3.js", Source: []byte(`
+			exports.migrate = (data) => { data.migrated = true; };`)},
+	}
+	input := `[
+		{"data": {"size": "4"}, "observation": {"observation_id": "obs-1", "form_version": "1"}},
+		{"data": {"fail": true}, "observation": {"observation_id": "obs-2", "form_version": "1"}}
+	]`
+
+	output, err := runner.Run(context.Background(), scripts, []byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var records []outputRecord
+	if err := json.Unmarshal(output, &records); err != nil {
+		t.Fatalf("Invalid output %s: %v", output, err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %s", output)
+	}
+	if string(records[0].Data) != `{"household_size":4,"migrated":true}` {
+		t.Errorf("Unexpected migrated data %s", records[0].Data)
+	}
+	if records[1].Error != "cannot migrate obs-2" {
+		t.Errorf("Expected the script error, got %+v", records[1])
+	}
+}
+
+func TestNodeRunner_BrokenScript(t *testing.T) {
+	runner := requireNode(t)
+	_, err := runner.Run(context.Background(), []Script{{Path: "forms/survey/migrations/1_2.js", Source: []byte(`module.exports = 42;`)}}, []byte(`[]`))
+	if err == nil || !strings.Contains(err.Error(), "forms/survey/migrations/1_2.js does not export a migrate function") {
+		t.Errorf("Expected the export error, got %v", err)
+	}
+}
+
+func TestNodeRunner_MissingBinary(t *testing.T) {
+	runner := NewNodeRunner("/nonexistent/node")
+	if _, err := runner.Run(context.Background(), nil, []byte(`[]`)); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,467 @@
+// Package formmigration brings stored observations up to the current version of their form
+// after an app bundle switch. It runs the migrations/{from}_{to}.js scripts the bundle
+// ships for the form, the same scripts clients run on their local data.
+package formmigration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidRequest is returned for a migration that can't be run
+	ErrInvalidRequest = errors.New("invalid form migration")
+	// ErrUnavailable is returned when the server can't run migration scripts
+	ErrUnavailable = errors.New("migration scripts can't be run on this server")
+)
+
+// Config contains form migration configuration
+type Config struct {
+	// NodePath is the Node.js binary that runs migration scripts; empty disables server-side migration
+	NodePath string
+	// BatchSize is the number of observations migrated per script run and transaction
+	BatchSize int
+	// Timeout bounds one script run
+	Timeout time.Duration
+	// PreviewLimit is the number of changes listed by a dry run
+	PreviewLimit int
+	// Runner runs the scripts; nil uses Node.js at NodePath
+	Runner Runner
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		NodePath:     "node",
+		BatchSize:    200,
+		Timeout:      time.Minute,
+		PreviewLimit: 20,
+	}
+}
+
+// Bundle is the part of the app bundle service migrations read from
+type Bundle interface {
+	GetManifest(ctx context.Context) (*appbundle.Manifest, error)
+	GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error)
+	GetFile(ctx context.Context, path string) (io.ReadCloser, *appbundle.File, error)
+}
+
+// Request selects the observations to migrate
+type Request struct {
+	FormType string `json:"form_type"`
+	// DryRun runs the scripts and reports the outcome without storing anything
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Change is the data of one observation before and after migration
+type Change struct {
+	ObservationID string          `json:"observation_id"`
+	FromVersion   string          `json:"from_version"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+}
+
+// Failure is an observation a script threw on
+type Failure struct {
+	ObservationID string `json:"observation_id"`
+	FromVersion   string `json:"from_version"`
+	Error         string `json:"error"`
+}
+
+// Result is the outcome of a migration run
+type Result struct {
+	FormType      string `json:"form_type"`
+	BundleVersion string `json:"bundle_version"`
+	// ToVersion is the form version observations were migrated to
+	ToVersion string `json:"to_version"`
+	DryRun    bool   `json:"dry_run"`
+	// Scanned observations had an older form version
+	Scanned  int `json:"scanned"`
+	Migrated int `json:"migrated"`
+	Failed   int `json:"failed"`
+	// Skipped observations changed while they were migrated and keep their new data
+	Skipped int `json:"skipped"`
+	// Unmigratable observations have a form version no script chain starts from
+	Unmigratable         int      `json:"unmigratable"`
+	UnmigratableVersions []string `json:"unmigratable_versions"`
+	// Changes lists the first migrated observations of a dry run
+	Changes []Change `json:"changes,omitempty"`
+	// Failures lists the first observations a script failed on
+	Failures []Failure `json:"failures"`
+}
+
+// Service migrates stored observations to the current form version
+type Service interface {
+	// Run migrates the observations of a form type whose form version isn't the one of the
+	// active bundle, giving migrated observations new versions so clients pull them
+	Run(ctx context.Context, req Request, requestedBy string) (*Result, error)
+}
+
+type service struct {
+	db     *sql.DB
+	bundle Bundle
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new form migration service
+func NewService(db *sql.DB, bundle Bundle, config Config, log *logger.Logger) Service {
+	defaults := DefaultConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.PreviewLimit <= 0 {
+		config.PreviewLimit = defaults.PreviewLimit
+	}
+	if config.Runner == nil && config.NodePath != "" {
+		config.Runner = NewNodeRunner(config.NodePath)
+	}
+	return &service{db: db, bundle: bundle, config: config, log: log}
+}
+
+// storedObservation is an observation being migrated
+type storedObservation struct {
+	id          string
+	formVersion string
+	version     int64
+	createdAt   time.Time
+	updatedAt   time.Time
+	before      json.RawMessage
+	after       json.RawMessage
+}
+
+// inputRecord is an observation handed to the scripts; observation is their second argument
+type inputRecord struct {
+	Data        json.RawMessage `json:"data"`
+	Observation struct {
+		ObservationID string    `json:"observation_id"`
+		FormType      string    `json:"form_type"`
+		FormVersion   string    `json:"form_version"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+	} `json:"observation"`
+}
+
+// outputRecord is the migrated data of an observation, or why the scripts failed on it
+type outputRecord struct {
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+}
+
+// run is the state of one migration run
+type run struct {
+	req     Request
+	form    appbundle.FormInfo
+	scripts map[string]Script // by bundle path
+	result  *Result
+}
+
+// Run migrates the observations of a form type
+func (s *service) Run(ctx context.Context, req Request, requestedBy string) (_ *Result, err error) {
+	ctx, span := tracing.Start(ctx, "formmigration.Run",
+		attribute.String("formmigration.form_type", req.FormType), attribute.Bool("formmigration.dry_run", req.DryRun))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if s.config.Runner == nil {
+		return nil, fmt.Errorf("%w: no Node.js binary is configured", ErrUnavailable)
+	}
+	if strings.TrimSpace(req.FormType) == "" {
+		return nil, fmt.Errorf("%w: form_type is required", ErrInvalidRequest)
+	}
+
+	manifest, err := s.bundle.GetManifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app bundle manifest: %w", err)
+	}
+	appInfo, err := s.bundle.GetAppInfo(ctx, manifest.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app info: %w", err)
+	}
+	form, ok := appInfo.Forms[req.FormType]
+	if !ok {
+		return nil, fmt.Errorf("%w: the active app bundle has no form %s", ErrInvalidRequest, req.FormType)
+	}
+	if form.Version == "" {
+		return nil, fmt.Errorf("%w: the schema of form %s declares no version", ErrInvalidRequest, req.FormType)
+	}
+
+	r := &run{
+		req:     req,
+		form:    form,
+		scripts: make(map[string]Script),
+		result: &Result{
+			FormType:             req.FormType,
+			BundleVersion:        manifest.Version,
+			ToVersion:            form.Version,
+			DryRun:               req.DryRun,
+			UnmigratableVersions: []string{},
+			Failures:             []Failure{},
+		},
+	}
+	if req.DryRun {
+		r.result.Changes = []Change{}
+	}
+
+	err = s.scan(ctx, req.FormType, form.Version, func(batch []storedObservation) error {
+		return s.migrateBatch(ctx, r, batch, requestedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Form migration finished", "formType", req.FormType, "toVersion", form.Version, "dryRun", req.DryRun,
+		"scanned", r.result.Scanned, "migrated", r.result.Migrated, "failed", r.result.Failed,
+		"skipped", r.result.Skipped, "unmigratable", r.result.Unmigratable)
+	return r.result, nil
+}
+
+// migrateBatch runs the scripts over a batch, one script chain per form version, and
+// stores the migrated observations
+func (s *service) migrateBatch(ctx context.Context, r *run, batch []storedObservation, requestedBy string) error {
+	byVersion := make(map[string][]*storedObservation)
+	var versions []string
+	for i := range batch {
+		obs := &batch[i]
+		if _, ok := byVersion[obs.formVersion]; !ok {
+			versions = append(versions, obs.formVersion)
+		}
+		byVersion[obs.formVersion] = append(byVersion[obs.formVersion], obs)
+	}
+
+	var migrated []storedObservation
+	for _, from := range versions {
+		group := byVersion[from]
+		r.result.Scanned += len(group)
+
+		chain, err := r.form.MigrationChain(from)
+		if errors.Is(err, appbundle.ErrNoMigrationPath) {
+			r.result.Unmigratable += len(group)
+			r.noteUnmigratable(from)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		scripts, err := s.loadScripts(ctx, r, chain)
+		if err != nil {
+			return err
+		}
+		outputs, err := s.runScripts(ctx, r.req.FormType, scripts, group)
+		if err != nil {
+			return err
+		}
+
+		for i, obs := range group {
+			out := outputs[i]
+			if out.Error != "" || len(out.Data) == 0 {
+				r.result.Failed++
+				if len(r.result.Failures) < s.config.PreviewLimit {
+					r.result.Failures = append(r.result.Failures, Failure{ObservationID: obs.id, FromVersion: from, Error: out.Error})
+				}
+				continue
+			}
+			obs.after = out.Data
+			migrated = append(migrated, *obs)
+		}
+	}
+
+	if len(migrated) == 0 {
+		return nil
+	}
+	if r.req.DryRun {
+		r.result.Migrated += len(migrated)
+		for _, obs := range migrated {
+			if len(r.result.Changes) < s.config.PreviewLimit {
+				r.result.Changes = append(r.result.Changes, Change{ObservationID: obs.id, FromVersion: obs.formVersion, Before: obs.before, After: obs.after})
+			}
+		}
+		return nil
+	}
+
+	n, err := s.write(ctx, r.req.FormType, r.form.Version, migrated, requestedBy)
+	if err != nil {
+		return err
+	}
+	r.result.Migrated += n
+	r.result.Skipped += len(migrated) - n
+	return nil
+}
+
+func (r *run) noteUnmigratable(version string) {
+	for _, v := range r.result.UnmigratableVersions {
+		if v == version {
+			return
+		}
+	}
+	r.result.UnmigratableVersions = append(r.result.UnmigratableVersions, version)
+}
+
+// loadScripts reads the scripts of a chain from the active bundle
+func (s *service) loadScripts(ctx context.Context, r *run, chain []appbundle.MigrationInfo) ([]Script, error) {
+	scripts := make([]Script, 0, len(chain))
+	for _, step := range chain {
+		script, ok := r.scripts[step.Path]
+		if !ok {
+			file, _, err := s.bundle.GetFile(ctx, step.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open migration script %s: %w", step.Path, err)
+			}
+			source, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read migration script %s: %w", step.Path, err)
+			}
+			script = Script{Path: step.Path, Source: source}
+			r.scripts[step.Path] = script
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// runScripts runs a script chain over observations of one form version
+func (s *service) runScripts(ctx context.Context, formType string, scripts []Script, group []*storedObservation) ([]outputRecord, error) {
+	inputs := make([]inputRecord, len(group))
+	for i, obs := range group {
+		inputs[i].Data = obs.before
+		inputs[i].Observation.ObservationID = obs.id
+		inputs[i].Observation.FormType = formType
+		inputs[i].Observation.FormVersion = obs.formVersion
+		inputs[i].Observation.CreatedAt = obs.createdAt
+		inputs[i].Observation.UpdatedAt = obs.updatedAt
+	}
+	input, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode observations: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	output, err := s.config.Runner.Run(ctx, scripts, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []outputRecord
+	if err := json.Unmarshal(output, &outputs); err != nil {
+		return nil, fmt.Errorf("invalid migration script output: %w", err)
+	}
+	if len(outputs) != len(group) {
+		return nil, fmt.Errorf("migration scripts returned %d of %d observations", len(outputs), len(group))
+	}
+	return outputs, nil
+}
+
+// scan calls fn with each batch of observations of the form type that have another form
+// version, in observation ID order
+func (s *service) scan(ctx context.Context, formType, currentVersion string, fn func([]storedObservation) error) error {
+	after := ""
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT observation_id, form_version, version, created_at, updated_at, data
+			FROM observations
+			WHERE form_type = $1 AND form_version <> $2 AND NOT deleted AND observation_id > $3
+			ORDER BY observation_id
+			LIMIT $4`,
+			formType, currentVersion, after, s.config.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query observations: %w", err)
+		}
+
+		var batch []storedObservation
+		for rows.Next() {
+			var obs storedObservation
+			var data []byte
+			if err := rows.Scan(&obs.id, &obs.formVersion, &obs.version, &obs.createdAt, &obs.updatedAt, &data); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan observation: %w", err)
+			}
+			obs.before = data
+			batch = append(batch, obs)
+			after = obs.id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating observations: %w", err)
+		}
+
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		if len(batch) < s.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// write stores migrated observations with the new form version, new versions and an audit
+// entry each, in one transaction. Observations whose version changed since they were read
+// are left alone.
+func (s *service) write(ctx context.Context, formType, toVersion string, migrated []storedObservation, requestedBy string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE sync_version SET current_version = current_version + $1, updated_at = NOW() WHERE id = 1 RETURNING current_version",
+		len(migrated)).Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve versions: %w", err)
+	}
+	version := current - int64(len(migrated)) + 1
+
+	updated := 0
+	for _, obs := range migrated {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE observations SET data = $1, form_version = $2, updated_at = NOW(), version = $3 WHERE observation_id = $4 AND version = $5",
+			[]byte(obs.after), toVersion, version, obs.id, obs.version)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update observation %s: %w", obs.id, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+			reason := fmt.Sprintf("form migration of %s from version %s to %s", formType, obs.formVersion, toVersion)
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO observation_audit (observation_id, previous_version, version, data_before, data_after, changed_by, reason)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				obs.id, obs.version, version, []byte(obs.before), []byte(obs.after), nullString(requestedBy), reason); err != nil {
+				return 0, fmt.Errorf("failed to record audit entry for %s: %w", obs.id, err)
+			}
+		}
+		version++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
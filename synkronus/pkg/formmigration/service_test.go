@@ -0,0 +1,190 @@
+package formmigration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+type fakeBundle struct {
+	form  appbundle.FormInfo
+	files map[string]string
+}
+
+func (b *fakeBundle) GetManifest(ctx context.Context) (*appbundle.Manifest, error) {
+	return &appbundle.Manifest{Version: "4"}, nil
+}
+
+func (b *fakeBundle) GetAppInfo(ctx context.Context, version string) (*appbundle.AppInfo, error) {
+	return &appbundle.AppInfo{Version: version, Forms: map[string]appbundle.FormInfo{"survey": b.form}}, nil
+}
+
+func (b *fakeBundle) GetFile(ctx context.Context, path string) (io.ReadCloser, *appbundle.File, error) {
+	content, ok := b.files[path]
+	if !ok {
+		return nil, nil, appbundle.ErrFileNotFound
+	}
+	return io.NopCloser(bytes.NewBufferString(content)), &appbundle.File{Path: path}, nil
+}
+
+// fakeRunner records the scripts of each run and answers with the outputs it is given
+type fakeRunner struct {
+	runs    [][]string
+	outputs []string
+}
+
+func (r *fakeRunner) Run(ctx context.Context, scripts []Script, input []byte) ([]byte, error) {
+	var paths []string
+	for _, script := range scripts {
+		paths = append(paths, script.Path)
+	}
+	r.runs = append(r.runs, paths)
+	output := r.outputs[0]
+	r.outputs = r.outputs[1:]
+	return []byte(output), nil
+}
+
+var observationColumns = []string{"observation_id", "form_version", "version", "created_at", "updated_at", "data"}
+
+// surveyBundle is an app bundle whose survey form is at version 3, with migrations from 1
+func surveyBundle() *fakeBundle {
+	return &fakeBundle{
+		form: appbundle.FormInfo{
+			Version: "3",
+			Migrations: []appbundle.MigrationInfo{
+				{From: "1", To: "2", Path: "forms/survey/migrations/1_2.js"},
+				{From: "2", To: "3", Path: "forms/survey/migrations/2_3.js"},
+			},
+		},
+		files: map[string]string{
+			"forms/survey/migrations/1_2.js": "module.exports = d => d",
+			"forms/survey/migrations/2_3.js": "module.exports = d => d",
+		},
+	}
+}
+
+func TestService_Run(t *testing.T) {
+	runner := &fakeRunner{outputs: []string{
+		`[{"data":{"size":4}},{"error":"size is not a number"}]`,
+		`[{"data":{"size":2}}]`,
+	}}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Runner = runner
+	svc := NewService(db, surveyBundle(), config, logger.NewLogger())
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM observations\s+WHERE form_type = \$1 AND form_version <> \$2`).WithArgs("survey", "3", "", 200).
+		WillReturnRows(sqlmock.NewRows(observationColumns).
+			AddRow("obs-1", "1", 10, now, now, []byte(`{"size":"4"}`)).
+			AddRow("obs-2", "2", 11, now, now, []byte(`{"size":2}`)).
+			AddRow("obs-3", "1", 12, now, now, []byte(`{"size":"many"}`)).
+			AddRow("obs-4", "0.9", 13, now, now, []byte(`{}`)))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version SET current_version = current_version \+ \$1`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(101))
+	mock.ExpectExec(`UPDATE observations SET data = \$1, form_version = \$2`).
+		WithArgs([]byte(`{"size":4}`), "3", int64(100), "obs-1", int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observation_audit`).
+		WithArgs("obs-1", int64(10), int64(100), []byte(`{"size":"4"}`), []byte(`{"size":4}`), "admin", "form migration of survey from version 1 to 3").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// obs-2 was pushed again while it was migrated
+	mock.ExpectExec(`UPDATE observations SET data = \$1, form_version = \$2`).
+		WithArgs([]byte(`{"size":2}`), "3", int64(101), "obs-2", int64(11)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	result, err := svc.Run(context.Background(), Request{FormType: "survey"}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Scanned != 4 || result.Migrated != 1 || result.Skipped != 1 || result.Failed != 1 || result.Unmigratable != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result.ToVersion != "3" || result.BundleVersion != "4" {
+		t.Errorf("Unexpected versions %+v", result)
+	}
+	if len(result.UnmigratableVersions) != 1 || result.UnmigratableVersions[0] != "0.9" {
+		t.Errorf("Unexpected unmigratable versions %v", result.UnmigratableVersions)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].ObservationID != "obs-3" || result.Failures[0].Error != "size is not a number" {
+		t.Errorf("Unexpected failures %+v", result.Failures)
+	}
+	// Version 1 runs the whole chain, version 2 only its last step
+	if len(runner.runs) != 2 || len(runner.runs[0]) != 2 || len(runner.runs[1]) != 1 || runner.runs[1][0] != "forms/survey/migrations/2_3.js" {
+		t.Errorf("Unexpected script runs %v", runner.runs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_RunDryRun(t *testing.T) {
+	runner := &fakeRunner{outputs: []string{`[{"data":{"size":4}}]`}}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Runner = runner
+	svc := NewService(db, surveyBundle(), config, logger.NewLogger())
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM observations`).
+		WillReturnRows(sqlmock.NewRows(observationColumns).AddRow("obs-1", "1", 10, now, now, []byte(`{"size":"4"}`)))
+
+	result, err := svc.Run(context.Background(), Request{FormType: "survey", DryRun: true}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Migrated != 1 || len(result.Changes) != 1 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	change := result.Changes[0]
+	var after map[string]interface{}
+	if err := json.Unmarshal(change.After, &after); err != nil || after["size"] != float64(4) || change.FromVersion != "1" {
+		t.Errorf("Unexpected change %+v", change)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_RunValidation(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Runner = &fakeRunner{}
+	svc := NewService(db, surveyBundle(), config, logger.NewLogger())
+	for _, formType := range []string{"", "unknown"} {
+		if _, err := svc.Run(context.Background(), Request{FormType: formType}, "admin"); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Run(%q): expected ErrInvalidRequest, got %v", formType, err)
+		}
+	}
+
+	config = DefaultConfig()
+	config.NodePath = ""
+	disabled := NewService(db, &fakeBundle{}, config, logger.NewLogger())
+	if _, err := disabled.Run(context.Background(), Request{FormType: "survey"}, "admin"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+}
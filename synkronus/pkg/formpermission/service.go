@@ -0,0 +1,231 @@
+// Package formpermission stores which roles and users may push and pull the observations
+// of a form type. A form type nobody was granted stays open to every user; once granted,
+// only admins and the granted roles and users sync it.
+package formpermission
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/formaccess"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrInvalidGrant is returned for grants without a form type, or without exactly one
+	// of a role and a username
+	ErrInvalidGrant = errors.New("a grant needs a form_type and either a role or a username")
+	// ErrUnknownRole is returned when granting a role that doesn't exist
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrUserNotFound is returned when granting a form type to a user that doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrGrantNotFound is returned when revoking a grant that doesn't exist
+	ErrGrantNotFound = errors.New("form permission not found")
+)
+
+// roles are the roles form types can be granted to, from the least to the most privileged
+var roles = []models.Role{models.RoleReadOnly, models.RoleReadWrite, models.RoleAdmin}
+
+// Grant lets a role or a user push and pull the observations of a form type. A role grant
+// includes the roles above it.
+type Grant struct {
+	ID        int64       `json:"id"`
+	FormType  string      `json:"form_type"`
+	Role      models.Role `json:"role,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	CreatedBy string      `json:"created_by,omitempty"`
+}
+
+// Filter narrows the grants List returns; empty fields match every grant
+type Filter struct {
+	FormType string
+	Role     models.Role
+	Username string
+}
+
+// Service stores form permission grants
+type Service interface {
+	// List returns the grants matching filter, by form type
+	List(ctx context.Context, filter Filter) ([]Grant, error)
+	// Grant stores a grant, or returns the existing one when the role or user already
+	// has the form type
+	Grant(ctx context.Context, grant Grant, createdBy string) (*Grant, error)
+	// Revoke removes a grant, or fails with ErrGrantNotFound
+	Revoke(ctx context.Context, id int64) error
+	// DeniedFormTypes lists the granted form types user isn't granted, sorted by name;
+	// none for admins
+	DeniedFormTypes(ctx context.Context, user *models.User) ([]string, error)
+}
+
+type service struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+// NewService creates a new form permission service
+func NewService(db *sql.DB, log *logger.Logger) Service {
+	return &service{
+		db:  db,
+		log: log,
+	}
+}
+
+const grantColumns = "id, form_type, COALESCE(role, ''), COALESCE(username, ''), created_at, COALESCE(created_by, '')"
+
+// List returns the grants matching filter
+func (s *service) List(ctx context.Context, filter Filter) ([]Grant, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+grantColumns+` FROM form_permissions
+		WHERE ($1 = '' OR form_type = $1) AND ($2 = '' OR role = $2) AND ($3 = '' OR username = $3)
+		ORDER BY form_type, role NULLS LAST, username, id`,
+		filter.FormType, string(filter.Role), filter.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query form permissions: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []Grant{}
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, *grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read form permissions: %w", err)
+	}
+	return grants, nil
+}
+
+// Grant stores a grant, or returns the existing one
+func (s *service) Grant(ctx context.Context, grant Grant, createdBy string) (_ *Grant, err error) {
+	ctx, span := tracing.Start(ctx, "formpermission.Grant",
+		attribute.String("form.type", grant.FormType),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	grant.FormType = strings.TrimSpace(grant.FormType)
+	grant.Username = strings.TrimSpace(grant.Username)
+	if grant.FormType == "" || (grant.Role == "") == (grant.Username == "") {
+		return nil, ErrInvalidGrant
+	}
+	if grant.Role != "" && !validRole(grant.Role) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRole, grant.Role)
+	}
+
+	stored, err := scanGrant(s.db.QueryRowContext(ctx, `
+		INSERT INTO form_permissions (form_type, role, username, created_by)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''))
+		ON CONFLICT DO NOTHING
+		RETURNING `+grantColumns,
+		grant.FormType, string(grant.Role), grant.Username, createdBy))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, grant.Username)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// Granted before; the existing grant is returned unchanged
+		return scanGrant(s.db.QueryRowContext(ctx, `
+			SELECT `+grantColumns+` FROM form_permissions
+			WHERE form_type = $1 AND COALESCE(role, '') = $2 AND COALESCE(username, '') = $3`,
+			grant.FormType, string(grant.Role), grant.Username))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Form permission granted", "formType", stored.FormType, "role", stored.Role, "username", stored.Username, "by", createdBy)
+	return stored, nil
+}
+
+// Revoke removes a grant
+func (s *service) Revoke(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "formpermission.Revoke")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	grant, err := scanGrant(s.db.QueryRowContext(ctx,
+		"DELETE FROM form_permissions WHERE id = $1 RETURNING "+grantColumns, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrGrantNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log.Info("Form permission revoked", "formType", grant.FormType, "role", grant.Role, "username", grant.Username)
+	return nil
+}
+
+// DeniedFormTypes lists the granted form types user isn't granted by name or by a role
+// their own role includes
+func (s *service) DeniedFormTypes(ctx context.Context, user *models.User) ([]string, error) {
+	if user == nil || user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	var included []string
+	for _, role := range roles {
+		if formaccess.Allowed(user.Role, []models.Role{role}) {
+			included = append(included, string(role))
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT form_type FROM form_permissions
+		WHERE form_type NOT IN (
+			SELECT form_type FROM form_permissions WHERE username = $1 OR role = ANY($2)
+		)
+		ORDER BY form_type`,
+		user.Username, pq.Array(included))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query form permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var denied []string
+	for rows.Next() {
+		var formType string
+		if err := rows.Scan(&formType); err != nil {
+			return nil, fmt.Errorf("failed to read form permission: %w", err)
+		}
+		denied = append(denied, formType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read form permissions: %w", err)
+	}
+	return denied, nil
+}
+
+// validRole reports whether role is one of the roles of the server
+func validRole(role models.Role) bool {
+	for _, known := range roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// scanGrant reads a form_permissions row selected with grantColumns
+func scanGrant(row interface{ Scan(...any) error }) (*Grant, error) {
+	var grant Grant
+	var role string
+	if err := row.Scan(&grant.ID, &grant.FormType, &role, &grant.Username, &grant.CreatedAt, &grant.CreatedBy); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read form permission: %w", err)
+	}
+	grant.Role = models.Role(role)
+	return &grant, nil
+}
@@ -0,0 +1,134 @@
+package formpermission
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var grantRowColumns = []string{"id", "form_type", "role", "username", "created_at", "created_by"}
+
+func TestService_Grant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO form_permissions`).
+		WithArgs("payments", "read-write", "", "admin").
+		WillReturnRows(sqlmock.NewRows(grantRowColumns).AddRow(int64(1), "payments", "read-write", "", now, "admin"))
+	grant, err := svc.Grant(ctx, Grant{FormType: " payments ", Role: models.RoleReadWrite}, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if grant.ID != 1 || grant.Role != models.RoleReadWrite || grant.Username != "" {
+		t.Errorf("Unexpected grant %+v", grant)
+	}
+
+	// Granting again returns the existing grant
+	mock.ExpectQuery(`INSERT INTO form_permissions`).
+		WithArgs("payments", "", "alice", "admin").
+		WillReturnRows(sqlmock.NewRows(grantRowColumns))
+	mock.ExpectQuery(`SELECT .* FROM form_permissions\s+WHERE form_type = \$1`).
+		WithArgs("payments", "", "alice").
+		WillReturnRows(sqlmock.NewRows(grantRowColumns).AddRow(int64(2), "payments", "", "alice", now, "admin"))
+	if grant, err := svc.Grant(ctx, Grant{FormType: "payments", Username: "alice"}, "admin"); err != nil || grant.ID != 2 {
+		t.Errorf("Expected the existing grant, got %+v, %v", grant, err)
+	}
+
+	// Unknown users fail the foreign key
+	mock.ExpectQuery(`INSERT INTO form_permissions`).WillReturnError(&pq.Error{Code: "23503"})
+	if _, err := svc.Grant(ctx, Grant{FormType: "payments", Username: "nobody"}, "admin"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	for _, invalid := range []Grant{
+		{Role: models.RoleReadOnly},
+		{FormType: "payments"},
+		{FormType: "payments", Role: models.RoleReadOnly, Username: "alice"},
+	} {
+		if _, err := svc.Grant(ctx, invalid, "admin"); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("Grant(%+v): expected ErrInvalidGrant, got %v", invalid, err)
+		}
+	}
+	if _, err := svc.Grant(ctx, Grant{FormType: "payments", Role: "owner"}, "admin"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Revoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, logger.NewLogger())
+
+	mock.ExpectQuery(`DELETE FROM form_permissions WHERE id = \$1`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(grantRowColumns).AddRow(int64(1), "payments", "read-write", "", time.Now(), ""))
+	if err := svc.Revoke(context.Background(), 1); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	mock.ExpectQuery(`DELETE FROM form_permissions`).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows(grantRowColumns))
+	if err := svc.Revoke(context.Background(), 9); !errors.Is(err, ErrGrantNotFound) {
+		t.Errorf("Expected ErrGrantNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_DeniedFormTypes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, logger.NewLogger())
+	ctx := context.Background()
+
+	// A read-write user holds the grants of read-only and read-write
+	mock.ExpectQuery(`SELECT DISTINCT form_type FROM form_permissions`).
+		WithArgs("alice", pq.Array([]string{"read-only", "read-write"})).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}).AddRow("payments").AddRow("salaries"))
+	denied, err := svc.DeniedFormTypes(ctx, &models.User{Username: "alice", Role: models.RoleReadWrite})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(denied, []string{"payments", "salaries"}) {
+		t.Errorf("Unexpected denied form types %v", denied)
+	}
+
+	mock.ExpectQuery(`SELECT DISTINCT form_type FROM form_permissions`).
+		WithArgs("bob", pq.Array([]string{"read-only"})).
+		WillReturnRows(sqlmock.NewRows([]string{"form_type"}))
+	if denied, err := svc.DeniedFormTypes(ctx, &models.User{Username: "bob", Role: models.RoleReadOnly}); err != nil || denied != nil {
+		t.Errorf("Expected no denied form types, got %v, %v", denied, err)
+	}
+
+	// Admins sync every form type without a query
+	if denied, err := svc.DeniedFormTypes(ctx, &models.User{Username: "root", Role: models.RoleAdmin}); err != nil || denied != nil {
+		t.Errorf("Expected admins to sync everything, got %v, %v", denied, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
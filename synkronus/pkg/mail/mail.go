@@ -0,0 +1,193 @@
+// Package mail sends plain-text notification emails over SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+)
+
+// ErrInvalidAddress is returned for recipient addresses that can't be used in a header
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// defaultTimeout bounds a delivery when the context has no deadline
+const defaultTimeout = 30 * time.Second
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	// Send delivers msg, returning once the server has accepted it
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config contains SMTP configuration
+type Config struct {
+	// Host is the SMTP server; email is disabled when empty
+	Host string
+	// Port is the SMTP port. 465 uses implicit TLS; other ports upgrade with STARTTLS
+	// when the server offers it.
+	Port int
+	// Username and Password authenticate with PLAIN auth when Username is set
+	Username string
+	Password string
+	// From is the sender address, e.g. "Synkronus <noreply@example.org>"
+	From string
+}
+
+// Enabled reports whether an SMTP server is configured
+func (c Config) Enabled() bool {
+	return c.Host != ""
+}
+
+// ValidateAddress checks that address is a single bare email address
+func ValidateAddress(address string) error {
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	return nil
+}
+
+type smtpMailer struct {
+	config Config
+}
+
+// NewSMTPMailer creates a mailer that delivers through the configured SMTP server
+func NewSMTPMailer(config Config) Mailer {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &smtpMailer{config: config}
+}
+
+// Send delivers msg through the SMTP server
+func (m *smtpMailer) Send(ctx context.Context, msg Message) (err error) {
+	ctx, span := tracing.Start(ctx, "mail.Send")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if err := ValidateAddress(msg.To); err != nil {
+		return err
+	}
+	from, err := netmail.ParseAddress(m.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	data, err := m.format(from, msg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if _, isTLS := conn.(*tls.Conn); !isTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server rejected recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, with TLS from the start on port 465
+func (m *smtpMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+	if m.config.Port == 465 {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.config.Host}}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// format renders msg as an RFC 5322 message with CRLF line endings
+func (m *smtpMailer) format(from *netmail.Address, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("subject must be a single line")
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	for _, line := range strings.Split(body, "\n") {
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes(), nil
+}
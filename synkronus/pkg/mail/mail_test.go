@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts one message without TLS or auth and records it
+func fakeSMTPServer(t *testing.T) (host string, port int, received <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	out := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+
+		var envelope strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "MAIL FROM"), strings.HasPrefix(cmd, "RCPT TO"):
+				envelope.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				reply("250 queued")
+				out <- envelope.String() + data.String()
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	mailer := NewSMTPMailer(Config{Host: host, Port: port, From: "Synkronus <noreply@example.org>"})
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Body:    "Hello alice,\n.hidden line\nBye",
+	})
+	require.NoError(t, err)
+
+	msg := <-received
+	assert.Contains(t, msg, "MAIL FROM:<noreply@example.org>")
+	assert.Contains(t, msg, "RCPT TO:<alice@example.com>")
+	assert.Contains(t, msg, "From: \"Synkronus\" <noreply@example.org>\r\n")
+	assert.Contains(t, msg, "To: alice@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Reset your password\r\n")
+	assert.Contains(t, msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	// Lines starting with a dot are escaped on the wire
+	assert.Contains(t, msg, "\r\n\r\nHello alice,\r\n..hidden line\r\nBye\r\n")
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer(Config{Host: "localhost", Port: 1, From: "noreply@example.org"})
+
+	err := mailer.Send(context.Background(), Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"})
+	assert.True(t, errors.Is(err, ErrInvalidAddress))
+
+	err = mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi\r\nBcc: eve@example.com"})
+	assert.Error(t, err)
+}
+
+func TestValidateAddress(t *testing.T) {
+	for address, valid := range map[string]bool{
+		"alice@example.com":         true,
+		"Alice <alice@example.com>": false,
+		"not an address":            false,
+		"a@example.com, b@ex.com":   false,
+		"":                          false,
+	} {
+		assert.Equal(t, valid, ValidateAddress(address) == nil, strconv.Quote(address))
+	}
+}
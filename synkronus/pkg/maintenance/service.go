@@ -0,0 +1,177 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidRetryAfter is returned for a negative Retry-After
+var ErrInvalidRetryAfter = errors.New("retry_after_seconds must not be negative")
+
+// State is the maintenance mode of the deployment
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// RetryAfterSeconds is sent in the Retry-After header of rejected requests
+	RetryAfterSeconds int        `json:"retry_after_seconds"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"` // unset until maintenance mode is first changed
+	UpdatedBy         *string    `json:"updated_by,omitempty"`
+}
+
+// Config contains maintenance mode settings
+type Config struct {
+	// CacheTTL is how long the state is served from memory. Changes made through this
+	// instance apply at once; other instances see them once their cache expires.
+	CacheTTL time.Duration
+	// RetryAfter is used when maintenance is enabled without a Retry-After
+	RetryAfter time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		CacheTTL:   5 * time.Second,
+		RetryAfter: 5 * time.Minute,
+	}
+}
+
+// Service stores the maintenance mode shared by all server instances
+type Service interface {
+	// Current returns the cached state. Lookup failures fall back to the last known
+	// state, or to maintenance being off.
+	Current(ctx context.Context) State
+	// Get reads the state from the database
+	Get(ctx context.Context) (*State, error)
+	// Set turns maintenance mode on or off. A zero retryAfterSeconds uses the configured
+	// default; an empty message clears the message.
+	Set(ctx context.Context, enabled bool, message string, retryAfterSeconds int, updatedBy string) (*State, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+
+	mu       sync.Mutex
+	cached   *State
+	loadedAt time.Time
+}
+
+// NewService creates a new maintenance mode service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// Current returns the cached state, reading the database when the cache expired
+func (s *service) Current(ctx context.Context) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.loadedAt) < s.config.CacheTTL {
+		return *s.cached
+	}
+
+	state, err := s.Get(ctx)
+	if err != nil {
+		if s.cached != nil {
+			s.log.Warn("Failed to refresh maintenance mode, using the last known state", "error", err)
+			return *s.cached
+		}
+		s.log.Warn("Failed to load maintenance mode, assuming it is off", "error", err)
+		return s.defaultState()
+	}
+
+	s.cached = state
+	s.loadedAt = time.Now()
+	return *state
+}
+
+// Get reads the state from the database
+func (s *service) Get(ctx context.Context) (_ *State, err error) {
+	ctx, span := tracing.Start(ctx, "maintenance.Get")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	state, err := scanState(s.db.QueryRowContext(ctx,
+		"SELECT enabled, message, retry_after_seconds, updated_at, updated_by FROM maintenance_mode"))
+	if errors.Is(err, sql.ErrNoRows) {
+		state := s.defaultState()
+		return &state, nil
+	}
+	return state, err
+}
+
+// Set turns maintenance mode on or off
+func (s *service) Set(ctx context.Context, enabled bool, message string, retryAfterSeconds int, updatedBy string) (_ *State, err error) {
+	ctx, span := tracing.Start(ctx, "maintenance.Set", attribute.Bool("maintenance.enabled", enabled))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if retryAfterSeconds < 0 {
+		return nil, ErrInvalidRetryAfter
+	}
+	if retryAfterSeconds == 0 {
+		retryAfterSeconds = s.defaultState().RetryAfterSeconds
+	}
+
+	query := `
+		INSERT INTO maintenance_mode (id, enabled, message, retry_after_seconds, updated_by)
+		VALUES (TRUE, $1, NULLIF($2, ''), $3, NULLIF($4, ''))
+		ON CONFLICT (id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			message = EXCLUDED.message,
+			retry_after_seconds = EXCLUDED.retry_after_seconds,
+			updated_at = NOW(),
+			updated_by = EXCLUDED.updated_by
+		RETURNING enabled, message, retry_after_seconds, updated_at, updated_by
+	`
+
+	state, err := scanState(s.db.QueryRowContext(ctx, query, enabled, message, retryAfterSeconds, updatedBy))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cached = state
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+
+	s.log.Info("Maintenance mode changed", "enabled", enabled, "retryAfterSeconds", retryAfterSeconds, "by", updatedBy)
+	return state, nil
+}
+
+// defaultState is the state before maintenance mode was ever set
+func (s *service) defaultState() State {
+	return State{RetryAfterSeconds: int(s.config.RetryAfter / time.Second)}
+}
+
+// scanState reads the maintenance_mode row
+func scanState(row interface{ Scan(...any) error }) (*State, error) {
+	var state State
+	var message, updatedBy sql.NullString
+	var updatedAt time.Time
+	if err := row.Scan(&state.Enabled, &message, &state.RetryAfterSeconds, &updatedAt, &updatedBy); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read maintenance mode: %w", err)
+	}
+	state.Message = message.String
+	state.UpdatedAt = &updatedAt
+	if updatedBy.Valid {
+		state.UpdatedBy = &updatedBy.String
+	}
+	return &state, nil
+}
@@ -0,0 +1,90 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var stateColumns = []string{"enabled", "message", "retry_after_seconds", "updated_at", "updated_by"}
+
+func TestService_CurrentCachesState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, Config{CacheTTL: time.Minute, RetryAfter: 2 * time.Minute}, logger.NewLogger())
+	ctx := context.Background()
+
+	// No row yet: maintenance is off and uses the configured Retry-After
+	mock.ExpectQuery(`SELECT enabled, message, retry_after_seconds, updated_at, updated_by FROM maintenance_mode`).
+		WillReturnRows(sqlmock.NewRows(stateColumns))
+	if state := svc.Current(ctx); state.Enabled || state.RetryAfterSeconds != 120 {
+		t.Errorf("Unexpected default state %+v", state)
+	}
+	// Served from the cache; a second query would fail the expectations
+	svc.Current(ctx)
+
+	// Setting the state replaces the cache without another read
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO maintenance_mode`).
+		WithArgs(true, "Upgrading the database", 120, "admin").
+		WillReturnRows(sqlmock.NewRows(stateColumns).AddRow(true, "Upgrading the database", 120, now, "admin"))
+	state, err := svc.Set(ctx, true, "Upgrading the database", 0, "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !state.Enabled || state.UpdatedBy == nil || *state.UpdatedBy != "admin" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if current := svc.Current(ctx); !current.Enabled || current.Message != "Upgrading the database" {
+		t.Errorf("Expected maintenance to be on, got %+v", current)
+	}
+
+	if _, err := svc.Set(ctx, true, "", -1, "admin"); !errors.Is(err, ErrInvalidRetryAfter) {
+		t.Errorf("Expected ErrInvalidRetryAfter, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_CurrentKeepsLastStateOnError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, Config{CacheTTL: 0, RetryAfter: time.Minute}, logger.NewLogger())
+	ctx := context.Background()
+
+	// Nothing known yet: a failed lookup leaves the server serving requests
+	mock.ExpectQuery(`FROM maintenance_mode`).WillReturnError(errors.New("connection refused"))
+	if svc.Current(ctx).Enabled {
+		t.Error("Expected maintenance to be off when the state can't be read")
+	}
+
+	mock.ExpectQuery(`FROM maintenance_mode`).
+		WillReturnRows(sqlmock.NewRows(stateColumns).AddRow(true, nil, 60, time.Now(), nil))
+	if !svc.Current(ctx).Enabled {
+		t.Fatal("Expected maintenance to be on")
+	}
+
+	// The database going away during a migration keeps maintenance on
+	mock.ExpectQuery(`FROM maintenance_mode`).WillReturnError(errors.New("connection refused"))
+	if !svc.Current(ctx).Enabled {
+		t.Error("Expected the last known state to be used")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/auth"
+)
+
+const (
+	// AccessCookieName holds the access token of a portal cookie session
+	AccessCookieName = "synk_access"
+	// RefreshCookieName holds the refresh token of a portal cookie session
+	RefreshCookieName = "synk_refresh"
+	// CSRFCookieName holds the CSRF token; it is readable by the portal's scripts
+	CSRFCookieName = "synk_csrf"
+	// CSRFHeader must echo the CSRF cookie on requests of cookie sessions that change data
+	CSRFHeader = "X-CSRF-Token"
+
+	// cookiePath limits the session cookies to the portal routes
+	cookiePath = "/api/"
+	// refreshCookiePath limits the refresh token to the routes that use it
+	refreshCookiePath = "/api/auth/"
+)
+
+// PortalCookies reports whether a request may use a cookie session: cookie sessions are
+// enabled and it is made to the /api routes of the portal
+func PortalCookies(config auth.Config, r *http.Request) bool {
+	return config.Cookies.Enabled && strings.HasPrefix(r.URL.Path, cookiePath)
+}
+
+// SetSessionCookies sets the tokens of a new or refreshed session as cookies, along with
+// a new CSRF token
+func SetSessionCookies(w http.ResponseWriter, config auth.Config, token, refreshToken string) error {
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+
+	cookies := config.Cookies
+	http.SetCookie(w, &http.Cookie{
+		Name: AccessCookieName, Value: token, Path: cookiePath,
+		MaxAge: int(config.TokenExpiration / time.Second), HttpOnly: true, Secure: cookies.Secure, SameSite: cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: RefreshCookieName, Value: refreshToken, Path: refreshCookiePath,
+		MaxAge: int(config.RefreshTokenExpiration / time.Second), HttpOnly: true, Secure: cookies.Secure, SameSite: cookies.SameSite,
+	})
+	// The portal is served at /, so the CSRF cookie must be visible there
+	http.SetCookie(w, &http.Cookie{
+		Name: CSRFCookieName, Value: base64.RawURLEncoding.EncodeToString(csrf), Path: "/",
+		MaxAge: int(config.RefreshTokenExpiration / time.Second), Secure: cookies.Secure, SameSite: cookies.SameSite,
+	})
+	return nil
+}
+
+// ClearSessionCookies removes the cookies of a cookie session
+func ClearSessionCookies(w http.ResponseWriter, config auth.Config) {
+	for name, path := range map[string]string{AccessCookieName: cookiePath, RefreshCookieName: refreshCookiePath, CSRFCookieName: "/"} {
+		http.SetCookie(w, &http.Cookie{
+			Name: name, Path: path, MaxAge: -1,
+			HttpOnly: name != CSRFCookieName, Secure: config.Cookies.Secure, SameSite: config.Cookies.SameSite,
+		})
+	}
+}
+
+// SessionCookie returns the value of a session cookie of the request, or "" when cookie
+// sessions don't apply to it or it has none
+func SessionCookie(config auth.Config, r *http.Request, name string) string {
+	if !PortalCookies(config, r) {
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// CheckCSRF reports whether a request of a cookie session may proceed: requests that
+// only read always may, others must echo the CSRF cookie in the CSRF header
+func CheckCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/internal/repository/mocks"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddlewareCookieSession(t *testing.T) {
+	log := logger.NewLogger()
+	config := auth.DefaultConfig()
+	config.Cookies.Enabled = true
+	service := auth.NewService(config, mocks.NewMockUserRepository(), mocks.NewMockSessionRepository(), log)
+
+	token, _, err := service.StartSession(context.Background(), &models.User{Username: "testuser", Role: models.RoleReadWrite}, auth.ClientInfo{})
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := AuthMiddleware(service, log)(ok)
+	call := func(method, path, bearer, csrf string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: AccessCookieName, Value: token})
+		req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: "csrf-token"})
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		if csrf != "" {
+			req.Header.Set(CSRFHeader, csrf)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Cookie sessions read freely but need the CSRF token to write
+	assert.Equal(t, http.StatusNoContent, call(http.MethodGet, "/api/observations/mine", "", ""))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/api/sync/push", "", ""))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/api/sync/push", "", "wrong"))
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/api/sync/push", "", "csrf-token"))
+
+	// Cookies don't authenticate the routes of bearer clients
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/observations/mine", "", ""))
+
+	// Bearer tokens are exempt from CSRF checks
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/api/sync/push", token, ""))
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/sync/push", token, ""))
+
+	// Cookies are ignored unless cookie sessions are enabled
+	config.Cookies.Enabled = false
+	service = auth.NewService(config, mocks.NewMockUserRepository(), mocks.NewMockSessionRepository(), log)
+	handler = AuthMiddleware(service, log)(ok)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/api/observations/mine", "", ""))
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// ImpersonatedByHeader names the admin on responses to requests made with an impersonation
+// token, so tools can show that they act as another user
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// impersonationReadPaths are the POST endpoints an impersonation token may call: they only
+// read what the user would receive
+var impersonationReadPaths = map[string]bool{
+	"/sync/pull":            true,
+	"/attachments/manifest": true,
+	"/attachments/archive":  true,
+}
+
+// impersonationAllows reports whether a request may be made with an impersonation token.
+// Impersonation is for seeing what a user sees, so it cannot change data in their name.
+func impersonationAllows(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return impersonationReadPaths[strings.TrimPrefix(r.URL.Path, "/api")]
+	}
+	return false
+}
+
+// serveImpersonated serves a request made with an impersonation token, rejecting writes,
+// and adds it with its response status to the impersonation audit trail
+func serveImpersonated(authService auth.AuthServiceInterface, log *logger.Logger, claims *auth.AuthClaims, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Header().Set(ImpersonatedByHeader, claims.ImpersonatedBy)
+
+	if impersonationAllows(r) {
+		next.ServeHTTP(ww, r)
+	} else {
+		http.Error(ww, "Impersonation tokens are read-only", http.StatusForbidden)
+	}
+
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	log.Info("Impersonated request", "admin", claims.ImpersonatedBy, "username", claims.Username, "session", claims.SessionID, "method", r.Method, "path", r.URL.Path, "status", status)
+
+	// Record the request even if the client has gone away
+	ctx := context.WithoutCancel(r.Context())
+	if err := authService.RecordImpersonatedRequest(ctx, claims, r.Method, r.URL.Path, status); err != nil {
+		log.Error("Failed to audit impersonated request", "admin", claims.ImpersonatedBy, "username", claims.Username, "error", err)
+	}
+}
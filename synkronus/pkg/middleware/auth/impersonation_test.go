@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/repository/mocks"
+	"github.com/opendataensemble/synkronus/pkg/auth"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddlewareImpersonation(t *testing.T) {
+	log := logger.NewLogger()
+	service := auth.NewService(auth.DefaultConfig(), mocks.NewMockUserRepository(), mocks.NewMockSessionRepository(), log)
+	ctx := context.Background()
+
+	token, _, err := service.Impersonate(ctx, "admin", "testuser", "ticket 42", auth.ClientInfo{})
+	require.NoError(t, err)
+
+	var served []string
+	handler := AuthMiddleware(service, log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, GetUserFromContext(r.Context()).Username)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Reads act as the user and name the admin
+	rr := call(http.MethodGet, "/observations/mine")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "admin", rr.Header().Get(ImpersonatedByHeader))
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/api/sync/pull").Code)
+
+	// Writes are refused
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/sync/push").Code)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/users/change-password").Code)
+	assert.Equal(t, []string{"testuser", "testuser"}, served)
+
+	// Every request is audited with its outcome
+	entries, err := service.ListImpersonationAudit(ctx, "testuser", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	assert.Equal(t, "/users/change-password", *entries[0].Path)
+	assert.Equal(t, http.StatusForbidden, *entries[0].Status)
+	assert.Equal(t, "/observations/mine", *entries[3].Path)
+	assert.Equal(t, http.StatusNoContent, *entries[3].Status)
+	assert.Equal(t, "admin", entries[3].Admin)
+}
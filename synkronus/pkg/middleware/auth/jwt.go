@@ -50,6 +50,13 @@ func JWTMiddleware(authService auth.AuthServiceInterface, log *logger.Logger) fu
 				return
 			}
 
+			// Reject tokens of revoked sessions, such as a lost device that was logged out
+			if err := authService.CheckSession(r.Context(), claims); err != nil {
+				log.Warn("Rejected token of inactive session", "username", claims.Username, "error", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
 			// Add claims to context
 			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
 
@@ -62,6 +69,12 @@ func JWTMiddleware(authService auth.AuthServiceInterface, log *logger.Logger) fu
 			// Add user to context
 			ctx = context.WithValue(ctx, UserKey, user)
 
+			// Requests of an admin acting as the user are read-only and audited
+			if claims.ImpersonatedBy != "" {
+				serveImpersonated(authService, log, claims, next, w, r.WithContext(ctx))
+				return
+			}
+
 			// Call the next handler with the updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -14,23 +14,35 @@ import (
 func AuthMiddleware(authService auth.AuthServiceInterface, log *logger.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get token from Authorization header
+			// Get token from Authorization header, or from the cookie of a portal cookie
+			// session. Bearer tokens are not sent by browsers on their own, so only cookie
+			// sessions need CSRF protection.
+			var tokenString string
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				log.Warn("Missing Authorization header")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
+			if cookie := SessionCookie(authService.Config(), r, AccessCookieName); authHeader == "" && cookie != "" {
+				if !CheckCSRF(r) {
+					log.Warn("Missing or invalid CSRF token", "path", r.URL.Path)
+					http.Error(w, "Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+					return
+				}
+				tokenString = cookie
+			} else {
+				if authHeader == "" {
+					log.Warn("Missing Authorization header")
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
 
-			// Check if the header has the Bearer prefix
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				log.Warn("Invalid Authorization header format")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
+				// Check if the header has the Bearer prefix
+				if !strings.HasPrefix(authHeader, "Bearer ") {
+					log.Warn("Invalid Authorization header format")
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
 
-			// Extract the token
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+				// Extract the token
+				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+			}
 
 			// Validate the token
 			claims, err := authService.ValidateToken(tokenString)
@@ -40,14 +52,28 @@ func AuthMiddleware(authService auth.AuthServiceInterface, log *logger.Logger) f
 				return
 			}
 
+			// Reject tokens of revoked sessions, such as a lost device that was logged out
+			if err := authService.CheckSession(r.Context(), claims); err != nil {
+				log.Warn("Rejected token of inactive session", "username", claims.Username, "error", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
 			// Create a user from claims
 			user := &models.User{
 				Username: claims.Username,
 				Role:     getModelRole(string(claims.Role)), // Convert auth.Role to models.Role
 			}
 
-			// Add user to context
+			// Add user and claims to context
 			ctx := context.WithValue(r.Context(), UserKey, user)
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
+
+			// Requests of an admin acting as the user are read-only and audited
+			if claims.ImpersonatedBy != "" {
+				serveImpersonated(authService, log, claims, next, w, r.WithContext(ctx))
+				return
+			}
 
 			// Call the next handler with the updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
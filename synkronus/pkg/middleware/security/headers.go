@@ -0,0 +1,55 @@
+// Package security adds HTTP security headers to responses
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config selects the security headers sent with every response
+type Config struct {
+	// Enabled turns the headers on. They are opt-in: X-Frame-Options and frame-ancestors
+	// would keep hosts from embedding app bundle and portal assets.
+	Enabled bool
+	// ContentSecurityPolicy is sent as Content-Security-Policy unless empty
+	ContentSecurityPolicy string
+	// HSTSMaxAge is the max-age of Strict-Transport-Security; 0 leaves the header out,
+	// as it commits browsers to HTTPS for that long
+	HSTSMaxAge time.Duration
+}
+
+// DefaultConfig returns the headers sent once enabled, unless configured otherwise
+func DefaultConfig() Config {
+	return Config{
+		ContentSecurityPolicy: "frame-ancestors 'none'",
+	}
+}
+
+// Headers returns a middleware setting the configured security headers. Responses of the
+// auth routes, which carry tokens, are also kept out of caches.
+func Headers(config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !config.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", "DENY")
+			// Signed attachment URLs must not leak to other sites through the Referer
+			header.Set("Referrer-Policy", "no-referrer")
+			if config.ContentSecurityPolicy != "" {
+				header.Set("Content-Security-Policy", config.ContentSecurityPolicy)
+			}
+			if config.HSTSMaxAge > 0 {
+				header.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(config.HSTSMaxAge/time.Second)))
+			}
+			if strings.HasPrefix(r.URL.Path, "/auth/") || strings.HasPrefix(r.URL.Path, "/api/auth/") {
+				header.Set("Cache-Control", "no-store")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	serve := func(config Config, path string) http.Header {
+		rr := httptest.NewRecorder()
+		Headers(config)(ok).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Header()
+	}
+
+	// Headers are opt-in
+	assert.Empty(t, serve(DefaultConfig(), "/sync/pull").Get("X-Frame-Options"))
+
+	config := DefaultConfig()
+	config.Enabled = true
+	header := serve(config, "/sync/pull")
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", header.Get("Referrer-Policy"))
+	assert.Equal(t, "frame-ancestors 'none'", header.Get("Content-Security-Policy"))
+	assert.Empty(t, header.Get("Strict-Transport-Security"))
+	assert.Empty(t, header.Get("Cache-Control"))
+
+	config.HSTSMaxAge = 365 * 24 * time.Hour
+	header = serve(config, "/api/auth/login")
+	assert.Equal(t, "max-age=31536000; includeSubDomains", header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "no-store", header.Get("Cache-Control"))
+}
@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Audit log of attachment downloads
+CREATE TABLE IF NOT EXISTS attachment_downloads (
+    id BIGSERIAL PRIMARY KEY,
+    attachment_id VARCHAR(255) NOT NULL,
+    username VARCHAR(255), -- NULL when access was granted by a signed URL
+    client_id VARCHAR(255),
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    signed BOOLEAN NOT NULL DEFAULT FALSE,
+    downloaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_downloads_attachment_id ON attachment_downloads(attachment_id);
+CREATE INDEX IF NOT EXISTS idx_attachment_downloads_downloaded_at ON attachment_downloads(downloaded_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_attachment_downloads_downloaded_at;
+DROP INDEX IF EXISTS idx_attachment_downloads_attachment_id;
+DROP TABLE IF EXISTS attachment_downloads;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Track which client last pushed each observation
+ALTER TABLE observations ADD COLUMN IF NOT EXISTS client_id VARCHAR(255);
+
+-- Daily observation counts per dimension (form_type, client, grid_cell), refreshed by the stats service
+CREATE TABLE IF NOT EXISTS observation_daily_stats (
+    day DATE NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+    bucket VARCHAR(255) NOT NULL,
+    observation_count BIGINT NOT NULL,
+    PRIMARY KEY (day, dimension, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_daily_stats_dimension_day ON observation_daily_stats(dimension, day);
+
+-- Single-row refresh watermark for observation_daily_stats
+CREATE TABLE IF NOT EXISTS observation_stats_state (
+    id INTEGER PRIMARY KEY DEFAULT 1,
+    refreshed_at TIMESTAMP WITH TIME ZONE,
+    grid_size DOUBLE PRECISION,
+    CONSTRAINT observation_stats_state_single_row CHECK (id = 1)
+);
+
+INSERT INTO observation_stats_state (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS observation_stats_state;
+DROP INDEX IF EXISTS idx_observation_daily_stats_dimension_day;
+DROP TABLE IF EXISTS observation_daily_stats;
+ALTER TABLE observations DROP COLUMN IF EXISTS client_id;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Invitations gate self-registration; only a hash of the invite token is stored
+CREATE TABLE IF NOT EXISTS invitations (
+    id UUID PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    email VARCHAR(255),
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_expires_at ON invitations(expires_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_invitations_expires_at;
+DROP TABLE IF EXISTS invitations;
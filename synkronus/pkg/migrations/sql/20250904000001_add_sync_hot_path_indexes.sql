@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Pull pages through observations in (version, observation_id) order
+CREATE INDEX IF NOT EXISTS idx_observations_version_observation_id ON observations(version, observation_id);
+
+-- Pulls and exports filtered by schema type
+CREATE INDEX IF NOT EXISTS idx_observations_form_type_version ON observations(form_type, version);
+
+-- Attachment manifest lookups; created by the attachment_operations migration but
+-- repeated here for databases where it was dropped or never built
+CREATE INDEX IF NOT EXISTS idx_attachment_operations_version_client ON attachment_operations(version, client_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_observations_form_type_version;
+DROP INDEX IF EXISTS idx_observations_version_observation_id;
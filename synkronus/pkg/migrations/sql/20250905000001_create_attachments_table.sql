@@ -0,0 +1,36 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Metadata of stored attachments, written on upload
+CREATE TABLE IF NOT EXISTS attachments (
+    attachment_id VARCHAR(255) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    content_type VARCHAR(255),
+    sha256 CHAR(64), -- NULL for attachments uploaded before this table existed
+    uploaded_by VARCHAR(255), -- NULL when unknown
+    uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    scan_status VARCHAR(20) NOT NULL DEFAULT 'not_scanned'
+        CHECK (scan_status IN ('not_scanned', 'pending', 'clean', 'infected', 'error')),
+    scanned_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_uploaded_at ON attachments(uploaded_at);
+CREATE INDEX IF NOT EXISTS idx_attachments_scan_status ON attachments(scan_status);
+
+-- Backfill from the operations log for attachments that are still live
+INSERT INTO attachments (attachment_id, size, content_type, uploaded_at)
+SELECT attachment_id, COALESCE(size, 0), content_type, created_at
+FROM (
+    SELECT DISTINCT ON (attachment_id) attachment_id, operation, size, content_type, created_at
+    FROM attachment_operations
+    ORDER BY attachment_id, version DESC
+) latest
+WHERE operation <> 'delete'
+ON CONFLICT (attachment_id) DO NOTHING;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_attachments_scan_status;
+DROP INDEX IF EXISTS idx_attachments_uploaded_at;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Per-deployment feature flags; a flag without a row uses its built-in default
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name VARCHAR(64) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    description TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(255)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS feature_flags;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- The sync service now assigns observation versions itself with a single
+-- UPDATE ... RETURNING on sync_version inside the push transaction. Installs that
+-- never got the trigger served a stale current_version, so bring the counter up to
+-- the highest version in use before the trigger is retired.
+INSERT INTO sync_version (id, current_version) VALUES (1, 1) ON CONFLICT (id) DO NOTHING;
+
+UPDATE sync_version
+SET current_version = GREATEST(
+        current_version,
+        (SELECT COALESCE(MAX(version), 1) FROM observations),
+        (SELECT COALESCE(MAX(version), 1) FROM attachment_operations)
+    ),
+    updated_at = NOW()
+WHERE id = 1;
+
+DROP TRIGGER IF EXISTS observations_version_trigger ON observations;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+CREATE OR REPLACE FUNCTION increment_sync_version() RETURNS TRIGGER AS 'BEGIN UPDATE sync_version SET current_version = current_version + 1, updated_at = NOW() WHERE id = 1; NEW.version = (SELECT current_version FROM sync_version WHERE id = 1); NEW.updated_at = NOW(); RETURN NEW; END;' LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS observations_version_trigger ON observations;
+CREATE TRIGGER observations_version_trigger
+    BEFORE INSERT OR UPDATE ON observations
+    FOR EACH ROW
+    EXECUTE FUNCTION increment_sync_version();
@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Last sync position reported by each client. The oldest attachment_version among
+-- recently seen clients is the watermark below which attachment operations can be
+-- compacted without any client missing a change.
+CREATE TABLE IF NOT EXISTS client_checkpoints (
+    client_id VARCHAR(255) PRIMARY KEY,
+    attachment_version BIGINT NOT NULL DEFAULT 0,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_checkpoints_last_seen_at ON client_checkpoints(last_seen_at);
+
+-- Compaction and the manifest query both look up operations per attachment by version
+CREATE INDEX IF NOT EXISTS idx_attachment_operations_attachment_version ON attachment_operations(attachment_id, version);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_attachment_operations_attachment_version;
+DROP INDEX IF EXISTS idx_client_checkpoints_last_seen_at;
+DROP TABLE IF EXISTS client_checkpoints;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Fingerprint of the x-calculated formulas each form type's stored observations were
+-- last recomputed with; a different fingerprint in the active app bundle triggers a backfill
+CREATE TABLE IF NOT EXISTS calculation_fingerprints (
+    form_type VARCHAR(255) PRIMARY KEY,
+    fingerprint VARCHAR(64) NOT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS calculation_fingerprints;
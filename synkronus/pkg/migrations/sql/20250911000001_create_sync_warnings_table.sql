@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Warnings returned to clients on push, kept per client so that recurring problems
+-- (missing form_type, wrong device clocks) can be followed up. Clients acknowledge
+-- warnings once they have been dealt with.
+CREATE TABLE IF NOT EXISTS sync_warnings (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    transmission_id VARCHAR(255),
+    observation_id VARCHAR(255),
+    code VARCHAR(64) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_warnings_client_code ON sync_warnings(client_id, code);
+CREATE INDEX IF NOT EXISTS idx_sync_warnings_unacknowledged ON sync_warnings(client_id) WHERE acknowledged_at IS NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_sync_warnings_unacknowledged;
+DROP INDEX IF EXISTS idx_sync_warnings_client_code;
+DROP TABLE IF EXISTS sync_warnings;
@@ -0,0 +1,45 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Batch updates of observation data (data cleaning), run as background jobs
+CREATE TABLE IF NOT EXISTS observation_batch_updates (
+    id BIGSERIAL PRIMARY KEY,
+    form_type VARCHAR(255) NOT NULL,
+    request JSONB NOT NULL,
+    reason TEXT,
+    requested_by VARCHAR(255),
+    status VARCHAR(16) NOT NULL,
+    scanned INTEGER NOT NULL DEFAULT 0,
+    matched INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Audit log of server-side changes to observation data, with the data before and after
+CREATE TABLE IF NOT EXISTS observation_audit (
+    id BIGSERIAL PRIMARY KEY,
+    observation_id VARCHAR(255) NOT NULL,
+    batch_update_id BIGINT REFERENCES observation_batch_updates(id) ON DELETE SET NULL,
+    previous_version BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    data_before JSONB NOT NULL,
+    data_after JSONB NOT NULL,
+    changed_by VARCHAR(255),
+    reason TEXT,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_audit_observation_id ON observation_audit(observation_id);
+CREATE INDEX IF NOT EXISTS idx_observation_audit_batch_update_id ON observation_audit(batch_update_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_observation_audit_batch_update_id;
+DROP INDEX IF EXISTS idx_observation_audit_observation_id;
+DROP TABLE IF EXISTS observation_audit;
+DROP TABLE IF EXISTS observation_batch_updates;
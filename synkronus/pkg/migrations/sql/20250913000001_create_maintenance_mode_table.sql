@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Maintenance mode of the deployment. Holds at most one row; no row means maintenance is off.
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    enabled BOOLEAN NOT NULL,
+    message TEXT,
+    retry_after_seconds INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(255)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS maintenance_mode;
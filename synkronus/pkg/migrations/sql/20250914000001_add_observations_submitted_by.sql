@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- User who first pushed an observation; NULL for observations pushed before it was tracked
+ALTER TABLE observations ADD COLUMN IF NOT EXISTS submitted_by VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_observations_submitted_by ON observations(submitted_by, created_at DESC) WHERE submitted_by IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_observations_submitted_by;
+ALTER TABLE observations DROP COLUMN IF EXISTS submitted_by;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- updated_at as reported by the client, normalized to UTC; updated_at itself is the server time of the change
+ALTER TABLE observations ADD COLUMN IF NOT EXISTS client_updated_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+ALTER TABLE observations DROP COLUMN IF EXISTS client_updated_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- EXIF of images uploaded while ATTACHMENT_EXIF_POLICY=extract
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS exif JSONB;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS exif;
@@ -0,0 +1,73 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Outbox of observation changes for the change feed. Rows are written by a trigger in the
+-- transaction that changes the observation, so they become visible only once it commits.
+CREATE TABLE IF NOT EXISTS observation_changes (
+    seq BIGSERIAL PRIMARY KEY,
+    observation_id VARCHAR(255) NOT NULL,
+    operation VARCHAR(10) NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    form_type VARCHAR(255) NOT NULL,
+    form_version VARCHAR(50) NOT NULL,
+    version BIGINT NOT NULL,
+    deleted BOOLEAN NOT NULL,
+    data JSONB NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE -- NULL until the broker acknowledged the change
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_changes_unpublished ON observation_changes(seq) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_observation_changes_published_at ON observation_changes(published_at);
+
+-- Whether changes are recorded; the server turns this on when a broker is configured so
+-- the outbox doesn't grow on deployments without a change feed. Replays can't start at or
+-- before pruned_through, the last change deleted after its retention.
+CREATE TABLE IF NOT EXISTS change_feed_state (
+    id INTEGER PRIMARY KEY DEFAULT 1,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    pruned_through BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT change_feed_state_single_row CHECK (id = 1)
+);
+
+INSERT INTO change_feed_state (id, enabled) VALUES (1, FALSE) ON CONFLICT (id) DO NOTHING;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_observation_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF NOT COALESCE((SELECT enabled FROM change_feed_state WHERE id = 1), FALSE) THEN
+        RETURN NULL;
+    END IF;
+    -- Updates that don't produce a new version (e.g. synced_at) aren't changes
+    IF TG_OP = 'UPDATE' AND NEW.version = OLD.version THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO observation_changes (observation_id, operation, form_type, form_version, version, deleted, data)
+    VALUES (
+        NEW.observation_id,
+        CASE
+            WHEN NEW.deleted THEN 'delete'
+            WHEN TG_OP = 'INSERT' THEN 'create'
+            ELSE 'update'
+        END,
+        NEW.form_type, NEW.form_version, NEW.version, NEW.deleted, NEW.data);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS observations_change_trigger ON observations;
+CREATE TRIGGER observations_change_trigger
+    AFTER INSERT OR UPDATE ON observations
+    FOR EACH ROW
+    EXECUTE FUNCTION record_observation_change();
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TRIGGER IF EXISTS observations_change_trigger ON observations;
+DROP FUNCTION IF EXISTS record_observation_change();
+DROP TABLE IF EXISTS change_feed_state;
+DROP INDEX IF EXISTS idx_observation_changes_published_at;
+DROP INDEX IF EXISTS idx_observation_changes_unpublished;
+DROP TABLE IF EXISTS observation_changes;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Replication of stored attachments to the secondary storage (ATTACHMENT_REPLICA_PATH).
+-- Existing attachments start out pending so they are mirrored as well.
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS replication_status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (replication_status IN ('pending', 'replicated', 'failed')),
+    ADD COLUMN IF NOT EXISTS replication_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS replication_error TEXT,
+    ADD COLUMN IF NOT EXISTS replicated_at TIMESTAMP WITH TIME ZONE;
+
+-- The replication worker only looks for attachments still to be mirrored
+CREATE INDEX IF NOT EXISTS idx_attachments_replication_pending
+    ON attachments(uploaded_at) WHERE replication_status <> 'replicated';
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_attachments_replication_pending;
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS replicated_at,
+    DROP COLUMN IF EXISTS replication_error,
+    DROP COLUMN IF EXISTS replication_attempts,
+    DROP COLUMN IF EXISTS replication_status;
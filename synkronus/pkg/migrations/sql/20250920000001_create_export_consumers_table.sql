@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Downstream systems that load exports record the last sync version they ingested, so
+-- their next export or change feed replay starts right after it
+CREATE TABLE IF NOT EXISTS export_consumers (
+    name VARCHAR(64) PRIMARY KEY,
+    acked_version BIGINT NOT NULL,
+    acked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    acked_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS export_consumers;
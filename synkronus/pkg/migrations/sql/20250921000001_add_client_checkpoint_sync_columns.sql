@@ -0,0 +1,28 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Clients report their observation sync watermark to POST /sync/checkpoint. A client that
+-- checkpoints before it fetches the attachment manifest has no attachment_version yet.
+ALTER TABLE client_checkpoints ALTER COLUMN attachment_version DROP NOT NULL;
+ALTER TABLE client_checkpoints ALTER COLUMN attachment_version DROP DEFAULT;
+ALTER TABLE client_checkpoints ADD COLUMN IF NOT EXISTS pulled_version BIGINT;
+ALTER TABLE client_checkpoints ADD COLUMN IF NOT EXISTS pushed_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE client_checkpoints ADD COLUMN IF NOT EXISTS username VARCHAR(255);
+ALTER TABLE client_checkpoints ADD COLUMN IF NOT EXISTS checkpoint_at TIMESTAMP WITH TIME ZONE;
+-- Set when a stalled-client alert was sent; cleared by the client's next checkpoint
+ALTER TABLE client_checkpoints ADD COLUMN IF NOT EXISTS stalled_alerted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_client_checkpoints_checkpoint_at ON client_checkpoints(checkpoint_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_client_checkpoints_checkpoint_at;
+ALTER TABLE client_checkpoints DROP COLUMN IF EXISTS stalled_alerted_at;
+ALTER TABLE client_checkpoints DROP COLUMN IF EXISTS checkpoint_at;
+ALTER TABLE client_checkpoints DROP COLUMN IF EXISTS username;
+ALTER TABLE client_checkpoints DROP COLUMN IF EXISTS pushed_count;
+ALTER TABLE client_checkpoints DROP COLUMN IF EXISTS pulled_version;
+UPDATE client_checkpoints SET attachment_version = 0 WHERE attachment_version IS NULL;
+ALTER TABLE client_checkpoints ALTER COLUMN attachment_version SET DEFAULT 0;
+ALTER TABLE client_checkpoints ALTER COLUMN attachment_version SET NOT NULL;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Transcoding of uploaded videos to a streamable variant (ATTACHMENT_TRANSCODE_FFMPEG_PATH).
+-- Only videos have a status; existing videos start out pending so they are transcoded as well.
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS transcode_status VARCHAR(20)
+        CHECK (transcode_status IN ('pending', 'transcoded', 'failed')),
+    ADD COLUMN IF NOT EXISTS transcode_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS transcode_error TEXT,
+    ADD COLUMN IF NOT EXISTS transcoded_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS transcoded_size BIGINT;
+
+UPDATE attachments SET transcode_status = 'pending' WHERE content_type LIKE 'video/%';
+
+-- The transcoding worker only looks for videos still to be transcoded
+CREATE INDEX IF NOT EXISTS idx_attachments_transcode_pending
+    ON attachments(uploaded_at) WHERE transcode_status IN ('pending', 'failed');
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_attachments_transcode_pending;
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS transcoded_size,
+    DROP COLUMN IF EXISTS transcoded_at,
+    DROP COLUMN IF EXISTS transcode_error,
+    DROP COLUMN IF EXISTS transcode_attempts,
+    DROP COLUMN IF EXISTS transcode_status;
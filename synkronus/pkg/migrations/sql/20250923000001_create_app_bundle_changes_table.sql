@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Every app bundle version push, draft promotion and version switch with the change log
+-- between the versions, so form changes can be traced after versions are cleaned up
+CREATE TABLE IF NOT EXISTS app_bundle_changes (
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('push', 'promote', 'switch', 'scheduled_switch')),
+    from_version VARCHAR(50),
+    to_version VARCHAR(50) NOT NULL,
+    actor VARCHAR(255),
+    changes JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_bundle_changes_created_at ON app_bundle_changes(created_at DESC);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_app_bundle_changes_created_at;
+DROP TABLE IF EXISTS app_bundle_changes;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Review locks on observations. A lock past its expires_at is free and is replaced by the
+-- next lock taken on the observation.
+CREATE TABLE IF NOT EXISTS observation_locks (
+    observation_id VARCHAR(255) PRIMARY KEY REFERENCES observations(observation_id) ON DELETE CASCADE,
+    owner VARCHAR(255) NOT NULL,
+    reason TEXT,
+    acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_locks_expires_at ON observation_locks(expires_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS observation_locks;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Named report definitions registered by admins: a read-only SQL query or a declarative
+-- spec joining form types, run by GET /dataexport/report/{name}
+CREATE TABLE IF NOT EXISTS export_reports (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT,
+    sql TEXT,
+    spec JSONB,
+    parameters JSONB NOT NULL DEFAULT '[]',
+    roles TEXT[] NOT NULL DEFAULT '{}',
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT export_reports_sql_or_spec CHECK ((sql IS NULL) <> (spec IS NULL))
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS export_reports;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Admins can impersonate a user with a short-lived session of that user. The session records
+-- the admin, so it shows up as impersonated in the user's session list.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS impersonated_by VARCHAR(255);
+
+-- Audit trail of impersonation: one 'start' row with the admin's reason when the token is
+-- issued, and one 'request' row for every request made with it
+CREATE TABLE IF NOT EXISTS impersonation_audit (
+    id BIGSERIAL PRIMARY KEY,
+    session_id UUID NOT NULL,
+    admin VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    reason TEXT,
+    method VARCHAR(16),
+    path TEXT,
+    status INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_created_at ON impersonation_audit(created_at);
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_session_id ON impersonation_audit(session_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS impersonation_audit;
+ALTER TABLE sessions DROP COLUMN IF EXISTS impersonated_by;
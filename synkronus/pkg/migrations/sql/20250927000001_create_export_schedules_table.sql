@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Export reports run on a cron schedule and delivered to a directory or webhook. Instances
+-- claim a due run by moving next_run_at on, so each run happens once.
+CREATE TABLE IF NOT EXISTS export_schedules (
+    name VARCHAR(64) PRIMARY KEY,
+    cron VARCHAR(255) NOT NULL,
+    report VARCHAR(64) NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'csv',
+    parameters JSONB NOT NULL DEFAULT '{}',
+    destination JSONB NOT NULL,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_status VARCHAR(16),
+    last_error TEXT,
+    last_delivery TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_schedules_next_run_at ON export_schedules(next_run_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS export_schedules;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Review workflow state of observations whose form declares x-workflow. Observations
+-- without a row are in the initial state of their form's workflow. Every change takes the
+-- next sync version, so clients pick up state changes with /workflow/changes.
+CREATE TABLE IF NOT EXISTS observation_workflow (
+    observation_id VARCHAR(255) PRIMARY KEY REFERENCES observations(observation_id) ON DELETE CASCADE,
+    form_type VARCHAR(255) NOT NULL,
+    state VARCHAR(63) NOT NULL,
+    assignee VARCHAR(255),
+    comment TEXT,
+    updated_by VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_workflow_version ON observation_workflow(version);
+CREATE INDEX IF NOT EXISTS idx_observation_workflow_form_state ON observation_workflow(form_type, state);
+CREATE INDEX IF NOT EXISTS idx_observation_workflow_assignee ON observation_workflow(assignee);
+
+-- Every transition and assignment, for the review history of an observation
+CREATE TABLE IF NOT EXISTS observation_workflow_events (
+    id BIGSERIAL PRIMARY KEY,
+    observation_id VARCHAR(255) NOT NULL REFERENCES observations(observation_id) ON DELETE CASCADE,
+    from_state VARCHAR(63) NOT NULL,
+    to_state VARCHAR(63) NOT NULL,
+    assignee VARCHAR(255),
+    actor VARCHAR(255) NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_workflow_events_observation ON observation_workflow_events(observation_id, id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS observation_workflow_events;
+DROP TABLE IF EXISTS observation_workflow;
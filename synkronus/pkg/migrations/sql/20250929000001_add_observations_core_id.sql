@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- core_id identifies the participant or household an observation is about, so the records
+-- of a case can be found across form types. Blank IDs are stored as NULL and left out of
+-- the index.
+ALTER TABLE observations
+    ADD COLUMN IF NOT EXISTS core_id TEXT GENERATED ALWAYS AS (NULLIF(data->>'core_id', '')) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_observations_core_id ON observations(core_id, created_at, observation_id)
+    WHERE core_id IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP INDEX IF EXISTS idx_observations_core_id;
+ALTER TABLE observations DROP COLUMN IF EXISTS core_id;
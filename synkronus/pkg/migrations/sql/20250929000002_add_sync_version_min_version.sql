@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- min_version is the highest version of a tombstone purged by compaction. Clients that
+-- last pulled an older version never saw those deletes and have to resync from scratch.
+ALTER TABLE sync_version ADD COLUMN IF NOT EXISTS min_version BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+ALTER TABLE sync_version DROP COLUMN IF EXISTS min_version;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Rollbacks to the version before the active one are recorded as their own action
+ALTER TABLE app_bundle_changes DROP CONSTRAINT IF EXISTS app_bundle_changes_action_check;
+ALTER TABLE app_bundle_changes ADD CONSTRAINT app_bundle_changes_action_check
+    CHECK (action IN ('push', 'promote', 'switch', 'scheduled_switch', 'rollback'));
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+UPDATE app_bundle_changes SET action = 'switch' WHERE action = 'rollback';
+ALTER TABLE app_bundle_changes DROP CONSTRAINT IF EXISTS app_bundle_changes_action_check;
+ALTER TABLE app_bundle_changes ADD CONSTRAINT app_bundle_changes_action_check
+    CHECK (action IN ('push', 'promote', 'switch', 'scheduled_switch'));
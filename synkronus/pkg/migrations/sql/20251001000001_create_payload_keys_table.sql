@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Session keys negotiated for application-layer payload encryption. The key material is
+-- sealed with a key derived from PAYLOAD_ENCRYPTION_SECRET, so a database dump alone
+-- doesn't decrypt captured traffic.
+CREATE TABLE IF NOT EXISTS payload_keys (
+    key_id VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    sealed_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payload_keys_username ON payload_keys(username, expires_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS payload_keys;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Grants of form types to roles or users. A form type without grants is open to every
+-- user; once granted, only the granted roles and users (and admins) push and pull it.
+CREATE TABLE IF NOT EXISTS form_permissions (
+    id BIGSERIAL PRIMARY KEY,
+    form_type VARCHAR(255) NOT NULL,
+    role VARCHAR(50),
+    username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_by VARCHAR(255),
+    CONSTRAINT form_permissions_subject CHECK ((role IS NULL) <> (username IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_form_permissions_role ON form_permissions(form_type, role) WHERE role IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_form_permissions_username ON form_permissions(form_type, username) WHERE username IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_form_permissions_username_lookup ON form_permissions(username) WHERE username IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS form_permissions;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied
+
+-- Observations merged into another one as duplicates are kept as tombstones that link to
+-- the observation they were merged into
+ALTER TABLE observations ADD COLUMN IF NOT EXISTS merged_into VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_observations_merged_into ON observations(merged_into) WHERE merged_into IS NOT NULL;
+
+-- Log of duplicate merges, with the attachments moved to the winner
+CREATE TABLE IF NOT EXISTS observation_merges (
+    id BIGSERIAL PRIMARY KEY,
+    winner_id VARCHAR(255) NOT NULL,
+    loser_ids TEXT[] NOT NULL,
+    form_type VARCHAR(255) NOT NULL,
+    attachments JSONB NOT NULL DEFAULT '[]',
+    reason TEXT,
+    merged_by VARCHAR(255),
+    merged_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_observation_merges_winner_id ON observation_merges(winner_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back
+
+DROP TABLE IF EXISTS observation_merges;
+DROP INDEX IF EXISTS idx_observations_merged_into;
+ALTER TABLE observations DROP COLUMN IF EXISTS merged_into;
@@ -0,0 +1,255 @@
+// Package observationlock stores review locks on observations. While a reviewer holds a
+// lock, sync pushes of the observation by other users are rejected, so a device can't
+// overwrite a record that is being corrected.
+package observationlock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrNotLocked is returned when the observation has no active lock
+	ErrNotLocked = errors.New("observation is not locked")
+	// ErrObservationNotFound is returned when locking an observation that doesn't exist
+	ErrObservationNotFound = errors.New("observation not found")
+	// ErrInvalidTTL is returned for a negative or too long lock duration
+	ErrInvalidTTL = errors.New("invalid lock duration")
+)
+
+// Lock is an active review lock
+type Lock struct {
+	ObservationID string    `json:"observation_id"`
+	Owner         string    `json:"owner"`
+	Reason        string    `json:"reason,omitempty"`
+	AcquiredAt    time.Time `json:"acquired_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// LockedError is returned when another user holds the lock
+type LockedError struct {
+	Lock Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("observation %s is locked by %s until %s", e.Lock.ObservationID, e.Lock.Owner, e.Lock.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+// Config contains lock settings
+type Config struct {
+	// DefaultTTL is how long a lock lasts when the request doesn't say
+	DefaultTTL time.Duration
+	// MaxTTL caps the lock duration
+	MaxTTL time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		DefaultTTL: 30 * time.Minute,
+		MaxTTL:     8 * time.Hour,
+	}
+}
+
+// Service stores review locks on observations
+type Service interface {
+	// Acquire locks an observation for owner, or extends owner's lock. A zero ttl uses the
+	// configured default. Another user's active lock fails with a *LockedError unless
+	// force is set, which admins use to take over the lock.
+	Acquire(ctx context.Context, observationID, owner, reason string, ttl time.Duration, force bool) (*Lock, error)
+	// Release removes owner's lock; force removes anyone's lock
+	Release(ctx context.Context, observationID, owner string, force bool) error
+	// Get returns the active lock of an observation, or ErrNotLocked
+	Get(ctx context.Context, observationID string) (*Lock, error)
+	// List returns all active locks, those expiring first first
+	List(ctx context.Context) ([]Lock, error)
+	// HeldByOthers returns the active locks on the observations that users other than
+	// username hold, by observation ID
+	HeldByOthers(ctx context.Context, observationIDs []string, username string) (map[string]Lock, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new observation lock service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+const lockColumns = "observation_id, owner, COALESCE(reason, ''), acquired_at, expires_at"
+
+// Acquire locks an observation for owner, or extends owner's lock
+func (s *service) Acquire(ctx context.Context, observationID, owner, reason string, ttl time.Duration, force bool) (_ *Lock, err error) {
+	ctx, span := tracing.Start(ctx, "observationlock.Acquire",
+		attribute.String("observation.id", observationID),
+		attribute.Bool("lock.force", force),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if ttl == 0 {
+		ttl = s.config.DefaultTTL
+	}
+	if ttl < 0 || (s.config.MaxTTL > 0 && ttl > s.config.MaxTTL) {
+		return nil, fmt.Errorf("%w: must be between 1 second and %s", ErrInvalidTTL, s.config.MaxTTL)
+	}
+
+	// Only the owner, an expired lock or an override replaces a lock. A renewed lock keeps
+	// the time it was first taken.
+	previous, err := s.Get(ctx, observationID)
+	if err != nil && !errors.Is(err, ErrNotLocked) {
+		return nil, err
+	}
+	query := `
+		INSERT INTO observation_locks (observation_id, owner, reason, acquired_at, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), NOW(), NOW() + $4 * INTERVAL '1 second')
+		ON CONFLICT (observation_id) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			reason = EXCLUDED.reason,
+			acquired_at = CASE
+				WHEN observation_locks.owner = EXCLUDED.owner AND observation_locks.expires_at > NOW()
+				THEN observation_locks.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE observation_locks.owner = EXCLUDED.owner OR observation_locks.expires_at <= NOW() OR $5
+		RETURNING ` + lockColumns
+	lock, err := scanLock(s.db.QueryRowContext(ctx, query, observationID, owner, reason, int64(ttl/time.Second), force))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Another user took the lock since it was read
+		current, getErr := s.Get(ctx, observationID)
+		if getErr != nil {
+			return nil, getErr
+		}
+		return nil, &LockedError{Lock: *current}
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return nil, ErrObservationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil && previous.Owner != owner {
+		s.log.Warn("Observation lock taken over", "observationId", observationID, "owner", owner, "previousOwner", previous.Owner)
+	} else {
+		s.log.Info("Observation locked", "observationId", observationID, "owner", owner, "expiresAt", lock.ExpiresAt)
+	}
+	return lock, nil
+}
+
+// Release removes owner's lock; force removes anyone's lock
+func (s *service) Release(ctx context.Context, observationID, owner string, force bool) (err error) {
+	ctx, span := tracing.Start(ctx, "observationlock.Release",
+		attribute.String("observation.id", observationID),
+		attribute.Bool("lock.force", force),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	lock, err := s.Get(ctx, observationID)
+	if err != nil {
+		return err
+	}
+	if lock.Owner != owner && !force {
+		return &LockedError{Lock: *lock}
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"DELETE FROM observation_locks WHERE observation_id = $1 AND owner = $2", observationID, lock.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to release observation lock: %w", err)
+	}
+	if lock.Owner != owner {
+		s.log.Warn("Observation lock released by override", "observationId", observationID, "by", owner, "owner", lock.Owner)
+	} else {
+		s.log.Info("Observation unlocked", "observationId", observationID, "owner", owner)
+	}
+	return nil
+}
+
+// Get returns the active lock of an observation
+func (s *service) Get(ctx context.Context, observationID string) (*Lock, error) {
+	lock, err := scanLock(s.db.QueryRowContext(ctx,
+		"SELECT "+lockColumns+" FROM observation_locks WHERE observation_id = $1 AND expires_at > NOW()", observationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotLocked
+	}
+	return lock, err
+}
+
+// List returns all active locks
+func (s *service) List(ctx context.Context) ([]Lock, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+lockColumns+" FROM observation_locks WHERE expires_at > NOW() ORDER BY expires_at, observation_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation locks: %w", err)
+	}
+	defer rows.Close()
+
+	locks := []Lock{}
+	for rows.Next() {
+		lock, err := scanLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, *lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read observation locks: %w", err)
+	}
+	return locks, nil
+}
+
+// HeldByOthers returns the active locks on the observations held by other users
+func (s *service) HeldByOthers(ctx context.Context, observationIDs []string, username string) (map[string]Lock, error) {
+	held := make(map[string]Lock)
+	if len(observationIDs) == 0 {
+		return held, nil
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+lockColumns+" FROM observation_locks WHERE observation_id = ANY($1) AND owner <> $2 AND expires_at > NOW()",
+		pq.Array(observationIDs), username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation locks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		lock, err := scanLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		held[lock.ObservationID] = *lock
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read observation locks: %w", err)
+	}
+	return held, nil
+}
+
+// scanLock reads an observation_locks row selected with lockColumns
+func scanLock(row interface{ Scan(...any) error }) (*Lock, error) {
+	var lock Lock
+	if err := row.Scan(&lock.ObservationID, &lock.Owner, &lock.Reason, &lock.AcquiredAt, &lock.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read observation lock: %w", err)
+	}
+	return &lock, nil
+}
@@ -0,0 +1,131 @@
+package observationlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var lockRowColumns = []string{"observation_id", "owner", "reason", "acquired_at", "expires_at"}
+
+func TestService_Acquire(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	// Free observation: locked with the default duration
+	mock.ExpectQuery(`SELECT .* FROM observation_locks WHERE observation_id = \$1 AND expires_at > NOW\(\)`).
+		WithArgs("obs-1").WillReturnRows(sqlmock.NewRows(lockRowColumns))
+	mock.ExpectQuery(`INSERT INTO observation_locks`).
+		WithArgs("obs-1", "alice", "fixing age", int64(1800), false).
+		WillReturnRows(sqlmock.NewRows(lockRowColumns).AddRow("obs-1", "alice", "fixing age", now, now.Add(30*time.Minute)))
+	lock, err := svc.Acquire(ctx, "obs-1", "alice", "fixing age", 0, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lock.Owner != "alice" || lock.Reason != "fixing age" {
+		t.Errorf("Unexpected lock %+v", lock)
+	}
+
+	// Held by alice: bob's upsert matches no row and gets alice's lock back
+	held := sqlmock.NewRows(lockRowColumns).AddRow("obs-1", "alice", "", now, now.Add(time.Hour))
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("obs-1").WillReturnRows(held)
+	mock.ExpectQuery(`INSERT INTO observation_locks`).
+		WithArgs("obs-1", "bob", "", int64(600), false).
+		WillReturnRows(sqlmock.NewRows(lockRowColumns))
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("obs-1").
+		WillReturnRows(sqlmock.NewRows(lockRowColumns).AddRow("obs-1", "alice", "", now, now.Add(time.Hour)))
+	var locked *LockedError
+	if _, err := svc.Acquire(ctx, "obs-1", "bob", "", 10*time.Minute, false); !errors.As(err, &locked) || locked.Lock.Owner != "alice" {
+		t.Errorf("Expected a LockedError naming alice, got %v", err)
+	}
+
+	// Unknown observations fail the foreign key
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("missing").WillReturnRows(sqlmock.NewRows(lockRowColumns))
+	mock.ExpectQuery(`INSERT INTO observation_locks`).WillReturnError(&pq.Error{Code: "23503"})
+	if _, err := svc.Acquire(ctx, "missing", "bob", "", 0, false); !errors.Is(err, ErrObservationNotFound) {
+		t.Errorf("Expected ErrObservationNotFound, got %v", err)
+	}
+
+	if _, err := svc.Acquire(ctx, "obs-1", "bob", "", 9*time.Hour, false); !errors.Is(err, ErrInvalidTTL) {
+		t.Errorf("Expected ErrInvalidTTL, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Release(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+	aliceLock := func() *sqlmock.Rows {
+		return sqlmock.NewRows(lockRowColumns).AddRow("obs-1", "alice", "", now, now.Add(time.Hour))
+	}
+
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("obs-1").WillReturnRows(aliceLock())
+	var locked *LockedError
+	if err := svc.Release(ctx, "obs-1", "bob", false); !errors.As(err, &locked) {
+		t.Errorf("Expected a LockedError, got %v", err)
+	}
+
+	// An admin override deletes alice's lock
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("obs-1").WillReturnRows(aliceLock())
+	mock.ExpectExec(`DELETE FROM observation_locks WHERE observation_id = \$1 AND owner = \$2`).
+		WithArgs("obs-1", "alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.Release(ctx, "obs-1", "admin", true); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT .* FROM observation_locks`).WithArgs("obs-1").WillReturnRows(sqlmock.NewRows(lockRowColumns))
+	if err := svc.Release(ctx, "obs-1", "alice", false); !errors.Is(err, ErrNotLocked) {
+		t.Errorf("Expected ErrNotLocked, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_HeldByOthers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .* FROM observation_locks WHERE observation_id = ANY\(\$1\) AND owner <> \$2 AND expires_at > NOW\(\)`).
+		WithArgs(pq.Array([]string{"obs-1", "obs-2"}), "collector").
+		WillReturnRows(sqlmock.NewRows(lockRowColumns).AddRow("obs-2", "alice", "", now, now.Add(time.Hour)))
+	held, err := svc.HeldByOthers(context.Background(), []string{"obs-1", "obs-2"}, "collector")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(held) != 1 || held["obs-2"].Owner != "alice" {
+		t.Errorf("Expected obs-2 held by alice, got %+v", held)
+	}
+
+	// Nothing to check, no query
+	if held, err := svc.HeldByOthers(context.Background(), nil, "collector"); err != nil || len(held) != 0 {
+		t.Errorf("Expected no locks, got %+v, %v", held, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+// Package payloadcrypto encrypts sync payloads between clients and the server on top of
+// TLS, for deployments where TLS ends at a proxy that must not see observation data. A
+// client sends an X25519 public key at login; the server answers with its own and both
+// derive an AES-256-GCM session key from the shared secret. Session keys are stored sealed
+// with a key derived from the server secret.
+package payloadcrypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Algorithm names the key agreement, key derivation and cipher of negotiated keys
+const Algorithm = "X25519-HKDF-SHA256-AES-256-GCM"
+
+// sessionKeyInfo is the HKDF info of session keys; the key ID is the salt
+const sessionKeyInfo = "synkronus payload v1"
+
+// sealKeyInfo is the HKDF info of the key that seals stored session keys
+const sealKeyInfo = "synkronus payload key seal v1"
+
+var (
+	// ErrDisabled is returned when negotiating a key while payload encryption is off
+	ErrDisabled = errors.New("payload encryption is disabled")
+	// ErrInvalidPublicKey is returned for a client key that isn't a base64 X25519 public key
+	ErrInvalidPublicKey = errors.New("invalid X25519 public key")
+	// ErrKeyNotFound is returned for a key that doesn't exist, has expired or belongs to
+	// another user
+	ErrKeyNotFound = errors.New("payload key not found or expired")
+	// ErrDecrypt is returned when a payload fails authentication
+	ErrDecrypt = errors.New("payload decryption failed")
+)
+
+// Mode controls whether clients may or must encrypt payloads
+type Mode string
+
+const (
+	// ModeOff disables payload encryption
+	ModeOff Mode = "off"
+	// ModeOptional encrypts the payloads of clients that negotiated a key
+	ModeOptional Mode = "optional"
+	// ModeRequired rejects plaintext payloads on the encrypted routes
+	ModeRequired Mode = "required"
+)
+
+// ParseMode parses a PAYLOAD_ENCRYPTION value; empty is off
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "", ModeOff:
+		return ModeOff, nil
+	case ModeOptional, ModeRequired:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown payload encryption mode %q, expected off, optional or required", value)
+	}
+}
+
+// Key describes a negotiated session key without its key material
+type Key struct {
+	KeyID     string    `json:"keyId"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Negotiation is the server's half of a key agreement, returned to the client
+type Negotiation struct {
+	KeyID string `json:"keyId"`
+	// ServerPublicKey is the base64 X25519 public key the client combines with its private key
+	ServerPublicKey string    `json:"serverPublicKey"`
+	Algorithm       string    `json:"algorithm"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
+// Config contains payload encryption settings
+type Config struct {
+	Mode Mode
+	// Secret seals stored session keys
+	Secret string
+	// KeyTTL is how long a negotiated key may be used
+	KeyTTL time.Duration
+	// MaxBodySize caps encrypted request and response bodies, which are held in memory to
+	// be decrypted or encrypted as a whole
+	MaxBodySize int64
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Mode:        ModeOff,
+		KeyTTL:      7 * 24 * time.Hour,
+		MaxBodySize: 32 << 20,
+	}
+}
+
+// Service negotiates and stores per-client payload keys
+type Service interface {
+	// Mode returns the configured mode
+	Mode() Mode
+	// MaxBodySize returns the largest encrypted body, in bytes, a request or response may have
+	MaxBodySize() int64
+	// Negotiate derives a new session key for username from the client's base64 X25519
+	// public key. It fails with ErrDisabled when the mode is off.
+	Negotiate(ctx context.Context, username, clientPublicKey string) (*Negotiation, error)
+	// SessionKey returns the key material of username's key, or ErrKeyNotFound
+	SessionKey(ctx context.Context, keyID, username string) ([]byte, error)
+	// List returns the unexpired keys of username, or of all users when username is empty,
+	// newest first
+	List(ctx context.Context, username string) ([]Key, error)
+	// Revoke deletes username's key; force deletes anyone's key
+	Revoke(ctx context.Context, keyID, username string, force bool) error
+}
+
+type service struct {
+	db      *sql.DB
+	config  Config
+	sealKey []byte
+	log     *logger.Logger
+}
+
+// NewService creates a new payload key service
+func NewService(db *sql.DB, config Config, log *logger.Logger) (Service, error) {
+	if config.Mode != ModeOff && config.Secret == "" {
+		return nil, errors.New("payload encryption needs a secret to seal session keys")
+	}
+	sealKey, err := hkdf.Key(sha256.New, []byte(config.Secret), nil, sealKeyInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive payload key seal: %w", err)
+	}
+	return &service{
+		db:      db,
+		config:  config,
+		sealKey: sealKey,
+		log:     log,
+	}, nil
+}
+
+const keyColumns = "key_id, username, created_at, expires_at"
+
+// Mode returns the configured mode
+func (s *service) Mode() Mode {
+	return s.config.Mode
+}
+
+// MaxBodySize returns the configured body size limit
+func (s *service) MaxBodySize() int64 {
+	return s.config.MaxBodySize
+}
+
+// Negotiate derives and stores a new session key for username
+func (s *service) Negotiate(ctx context.Context, username, clientPublicKey string) (_ *Negotiation, err error) {
+	ctx, span := tracing.Start(ctx, "payloadcrypto.Negotiate")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if s.config.Mode == ModeOff {
+		return nil, ErrDisabled
+	}
+	keyID := uuid.NewString()
+	serverPublicKey, sessionKey, err := DeriveServerKey(clientPublicKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := Seal(s.sealKey, sessionKey, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired keys are of no use to anyone, so each negotiation clears them out
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM payload_keys WHERE expires_at <= NOW()"); err != nil {
+		s.log.Warn("Failed to delete expired payload keys", "error", err)
+	}
+	var expiresAt time.Time
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO payload_keys (key_id, username, sealed_key, created_at, expires_at)
+		VALUES ($1, $2, $3, NOW(), NOW() + $4 * INTERVAL '1 second')
+		RETURNING expires_at`,
+		keyID, username, sealed, int64(s.config.KeyTTL/time.Second)).Scan(&expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payload key: %w", err)
+	}
+
+	s.log.Info("Negotiated payload key", "username", username, "keyId", keyID, "expiresAt", expiresAt)
+	return &Negotiation{
+		KeyID:           keyID,
+		ServerPublicKey: serverPublicKey,
+		Algorithm:       Algorithm,
+		ExpiresAt:       expiresAt,
+	}, nil
+}
+
+// SessionKey returns the key material of username's key
+func (s *service) SessionKey(ctx context.Context, keyID, username string) ([]byte, error) {
+	var sealed []byte
+	err := s.db.QueryRowContext(ctx,
+		"SELECT sealed_key FROM payload_keys WHERE key_id = $1 AND username = $2 AND expires_at > NOW()",
+		keyID, username).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload key: %w", err)
+	}
+	key, err := Open(s.sealKey, sealed, []byte(keyID))
+	if err != nil {
+		// The secret changed since the key was negotiated; the client has to negotiate again
+		s.log.Warn("Failed to unseal payload key", "keyId", keyID, "username", username)
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// List returns the unexpired keys of username, or of all users
+func (s *service) List(ctx context.Context, username string) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+keyColumns+" FROM payload_keys WHERE ($1 = '' OR username = $1) AND expires_at > NOW() ORDER BY created_at DESC, key_id",
+		username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payload keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		var key Key
+		if err := rows.Scan(&key.KeyID, &key.Username, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to read payload key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read payload keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke deletes username's key; force deletes anyone's key
+func (s *service) Revoke(ctx context.Context, keyID, username string, force bool) (err error) {
+	ctx, span := tracing.Start(ctx, "payloadcrypto.Revoke",
+		attribute.String("payload_key.id", keyID),
+		attribute.Bool("payload_key.force", force),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM payload_keys WHERE key_id = $1 AND (username = $2 OR $3)", keyID, username, force)
+	if err != nil {
+		return fmt.Errorf("failed to revoke payload key: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrKeyNotFound
+	}
+	s.log.Info("Revoked payload key", "keyId", keyID, "by", username)
+	return nil
+}
+
+// DeriveServerKey generates the server's key pair for a negotiation and returns its base64
+// public key and the session key shared with the client
+func DeriveServerKey(clientPublicKey, keyID string) (serverPublicKey string, sessionKey []byte, err error) {
+	clientKey, err := parsePublicKey(clientPublicKey)
+	if err != nil {
+		return "", nil, err
+	}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate payload key pair: %w", err)
+	}
+	sessionKey, err = deriveSessionKey(private, clientKey, keyID)
+	if err != nil {
+		return "", nil, err
+	}
+	return base64.StdEncoding.EncodeToString(private.PublicKey().Bytes()), sessionKey, nil
+}
+
+// DeriveClientKey returns the session key a client derives from its private key and the
+// server's half of the negotiation
+func DeriveClientKey(private *ecdh.PrivateKey, negotiation *Negotiation) ([]byte, error) {
+	serverKey, err := parsePublicKey(negotiation.ServerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return deriveSessionKey(private, serverKey, negotiation.KeyID)
+}
+
+// parsePublicKey decodes a base64 X25519 public key
+func parsePublicKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	return key, nil
+}
+
+// deriveSessionKey expands the X25519 shared secret into an AES-256 key, salted with the
+// key ID so every negotiation yields a distinct key
+func deriveSessionKey(private *ecdh.PrivateKey, public *ecdh.PublicKey, keyID string) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	return hkdf.Key(sha256.New, shared, []byte(keyID), sessionKeyInfo, 32)
+}
+
+// Seal encrypts plaintext with AES-256-GCM under key, binding aad, and returns the
+// random nonce followed by the ciphertext
+func Seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Open decrypts a payload made by Seal, failing with ErrDecrypt when the key, aad or
+// payload don't match
+func Open(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// RequestAAD is the additional data that binds an encrypted request body to its method,
+// path and key, so a body can't be replayed against another endpoint
+func RequestAAD(method, path, keyID string) []byte {
+	return []byte(method + " " + path + " " + keyID)
+}
+
+// ResponseAAD is the additional data of the encrypted response to a request, which keeps
+// a response from being passed off as a request
+func ResponseAAD(method, path, keyID string) []byte {
+	return []byte("response " + method + " " + path + " " + keyID)
+}
@@ -0,0 +1,205 @@
+package payloadcrypto
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+var keyRowColumns = []string{"key_id", "username", "created_at", "expires_at"}
+
+// captureArg records the value passed for a query argument
+type captureArg struct{ value driver.Value }
+
+func (c *captureArg) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func TestParseMode(t *testing.T) {
+	for value, expected := range map[string]Mode{"": ModeOff, "off": ModeOff, "Optional": ModeOptional, " required ": ModeRequired} {
+		mode, err := ParseMode(value)
+		if err != nil || mode != expected {
+			t.Errorf("ParseMode(%q) = %q, %v; expected %q", value, mode, err, expected)
+		}
+	}
+	if _, err := ParseMode("always"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestNewService_RequiresSecret(t *testing.T) {
+	config := DefaultConfig()
+	config.Mode = ModeOptional
+	if _, err := NewService(nil, config, logger.NewLogger()); err == nil {
+		t.Error("Expected an error without a secret")
+	}
+	if _, err := NewService(nil, DefaultConfig(), logger.NewLogger()); err != nil {
+		t.Errorf("Encryption that is off needs no secret: %v", err)
+	}
+}
+
+func TestService_NegotiateAndSessionKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Mode = ModeOptional
+	config.Secret = "test-secret"
+	created, err := NewService(db, config, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc := created.(*service)
+	ctx := context.Background()
+	client, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublicKey := base64.StdEncoding.EncodeToString(client.PublicKey().Bytes())
+
+	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+	sealed := &captureArg{}
+	mock.ExpectExec(`DELETE FROM payload_keys WHERE expires_at <= NOW\(\)`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`INSERT INTO payload_keys`).
+		WithArgs(sqlmock.AnyArg(), "alice", sealed, int64(7*24*3600)).
+		WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(expiresAt))
+	negotiation, err := svc.Negotiate(ctx, "alice", clientPublicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if negotiation.Algorithm != Algorithm || negotiation.KeyID == "" || !negotiation.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Unexpected negotiation %+v", negotiation)
+	}
+
+	// The client derives the same key the server stored, sealed
+	clientKey, err := DeriveClientKey(client, negotiation)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mock.ExpectQuery(`SELECT sealed_key FROM payload_keys WHERE key_id = \$1 AND username = \$2 AND expires_at > NOW\(\)`).
+		WithArgs(negotiation.KeyID, "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"sealed_key"}).AddRow(sealed.value))
+	serverKey, err := svc.SessionKey(ctx, negotiation.KeyID, "alice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(serverKey) != string(clientKey) || len(serverKey) != 32 {
+		t.Error("Client and server derived different session keys")
+	}
+	if string(sealed.value.([]byte)) == string(serverKey) {
+		t.Error("Session keys must not be stored in the clear")
+	}
+
+	// Another user's key or an expired one is not found
+	mock.ExpectQuery(`SELECT sealed_key FROM payload_keys`).WithArgs(negotiation.KeyID, "bob").
+		WillReturnRows(sqlmock.NewRows([]string{"sealed_key"}))
+	if _, err := svc.SessionKey(ctx, negotiation.KeyID, "bob"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if _, err := svc.Negotiate(ctx, "alice", "not a key"); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("Expected ErrInvalidPublicKey, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_NegotiateDisabled(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Mode = ModeOff
+	config.Secret = "test-secret"
+	created, err := NewService(db, config, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc := created.(*service)
+	if _, err := svc.Negotiate(context.Background(), "alice", ""); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestService_ListAndRevoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Mode = ModeRequired
+	config.Secret = "test-secret"
+	created, err := NewService(db, config, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc := created.(*service)
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT key_id, username, created_at, expires_at FROM payload_keys WHERE \(\$1 = '' OR username = \$1\)`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows(keyRowColumns).AddRow("k2", "alice", now, now.Add(time.Hour)).AddRow("k1", "alice", now.Add(-time.Hour), now))
+	keys, err := svc.List(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].KeyID != "k2" {
+		t.Errorf("Unexpected keys %+v", keys)
+	}
+
+	mock.ExpectExec(`DELETE FROM payload_keys WHERE key_id = \$1 AND \(username = \$2 OR \$3\)`).
+		WithArgs("k1", "alice", false).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.Revoke(ctx, "k1", "alice", false); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	mock.ExpectExec(`DELETE FROM payload_keys`).
+		WithArgs("k2", "bob", false).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.Revoke(ctx, "k2", "bob", false); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	aad := RequestAAD("POST", "/sync/push", "k1")
+	sealed, err := Seal(key, []byte(`{"records":[]}`), aad)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plaintext, err := Open(key, sealed, aad)
+	if err != nil || string(plaintext) != `{"records":[]}` {
+		t.Errorf("Open = %q, %v", plaintext, err)
+	}
+
+	// A body replayed against another endpoint, or passed off as a response, fails
+	for _, other := range [][]byte{RequestAAD("POST", "/sync/pull", "k1"), ResponseAAD("POST", "/sync/push", "k1")} {
+		if _, err := Open(key, sealed, other); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Expected ErrDecrypt, got %v", err)
+		}
+	}
+	if _, err := Open(key, sealed[:10], aad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for a truncated payload, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of blocks in a document
+const (
+	blockHeading = iota
+	blockField
+	blockImage
+	blockText
+)
+
+// block is one printable element of a form response
+type block struct {
+	kind  int
+	level int // nesting depth, for indentation
+	label string
+	text  string
+	image *imageRef
+}
+
+// imageRef is an image answer: an uploaded attachment or an image embedded in the data
+type imageRef struct {
+	attachmentID string
+	data         []byte
+}
+
+// mediaFormats are schema and UI formats whose answers are images
+var mediaFormats = map[string]bool{"image": true, "photo": true, "signature": true}
+
+// fileFormats are formats whose answers are files that can't be printed
+var fileFormats = map[string]bool{"audio": true, "video": true, "file": true}
+
+// buildDocument lays out the answers in data following the form's UI schema. Without a UI
+// schema the schema properties are listed by name; without a schema the data fields are.
+// Core fields are only printed when the UI schema renders them.
+func buildDocument(schema, ui, data map[string]any) []block {
+	var blocks []block
+	if ui != nil {
+		walkUI(&blocks, ui, schema, data, 0)
+		return blocks
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(properties))
+	for name, property := range properties {
+		if p, ok := property.(map[string]any); ok && (p["x-core"] == true || strings.HasPrefix(name, "core_")) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(properties) == 0 {
+		for name := range data {
+			if !strings.HasPrefix(name, "core_") {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, _ := properties[name].(map[string]any)
+		addAnswer(&blocks, fieldLabel(nil, property, name), property, nil, data[name], 0)
+	}
+	return blocks
+}
+
+// walkUI adds the blocks of a UI schema element. schema and data are the object the
+// element's scopes are relative to.
+func walkUI(blocks *[]block, node, schema, data map[string]any, level int) {
+	nodeType, _ := node["type"].(string)
+	switch nodeType {
+	case "Control":
+		name, property, value, ok := resolveScope(node, schema, data)
+		if !ok {
+			return
+		}
+		label := fieldLabel(node, property, name)
+		options, _ := node["options"].(map[string]any)
+		addAnswer(blocks, label, property, options, value, level)
+		return
+	case "Label":
+		if text, ok := node["text"].(string); ok && text != "" {
+			*blocks = append(*blocks, block{kind: blockText, level: level, text: text})
+		}
+		return
+	case "Group", "Category":
+		if label, ok := node["label"].(string); ok && label != "" {
+			*blocks = append(*blocks, block{kind: blockHeading, level: level, label: label})
+			level++
+		}
+	}
+
+	elements, _ := node["elements"].([]any)
+	for _, element := range elements {
+		if child, ok := element.(map[string]any); ok {
+			walkUI(blocks, child, schema, data, level)
+		}
+	}
+}
+
+// resolveScope follows a control's #/properties/... scope into the schema and the data
+func resolveScope(node, schema, data map[string]any) (string, map[string]any, any, bool) {
+	scope, _ := node["scope"].(string)
+	tokens := strings.Split(strings.TrimPrefix(scope, "#/"), "/")
+	if !strings.HasPrefix(scope, "#/") || len(tokens)%2 != 0 {
+		return "", nil, nil, false
+	}
+
+	property := schema
+	var value any = data
+	name := ""
+	for i := 0; i < len(tokens); i += 2 {
+		if tokens[i] != "properties" {
+			return "", nil, nil, false
+		}
+		name = strings.ReplaceAll(strings.ReplaceAll(tokens[i+1], "~1", "/"), "~0", "~")
+		properties, _ := property["properties"].(map[string]any)
+		property, _ = properties[name].(map[string]any)
+		object, _ := value.(map[string]any)
+		value = object[name]
+	}
+	return name, property, value, true
+}
+
+// fieldLabel is the label of a control, its schema title or its humanized name
+func fieldLabel(node, property map[string]any, name string) string {
+	if label, ok := node["label"].(string); ok && label != "" {
+		return label
+	}
+	if title, ok := property["title"].(string); ok && title != "" {
+		return title
+	}
+	name = strings.ReplaceAll(name, "_", " ")
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// addAnswer adds the blocks of one answer
+func addAnswer(blocks *[]block, label string, property, options map[string]any, value any, level int) {
+	format, _ := property["format"].(string)
+	if optionFormat, ok := options["format"].(string); ok {
+		format = optionFormat
+	}
+
+	if object, ok := value.(map[string]any); ok {
+		if kind, _ := object["type"].(string); mediaFormats[kind] || fileFormats[kind] {
+			format = kind
+		}
+	}
+
+	switch {
+	case value == nil:
+		*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: "-"})
+	case mediaFormats[format]:
+		if image := mediaImage(value); image != nil {
+			*blocks = append(*blocks, block{kind: blockImage, level: level, label: label, image: image})
+		} else {
+			*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: "[image not available]"})
+		}
+	case fileFormats[format]:
+		*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: fileName(value)})
+	default:
+		switch v := value.(type) {
+		case []any:
+			addArray(blocks, label, property, options, v, level)
+		case map[string]any:
+			if text, ok := geolocation(v); ok {
+				*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: text})
+				return
+			}
+			*blocks = append(*blocks, block{kind: blockHeading, level: level, label: label})
+			addObject(blocks, property, options, v, level+1)
+		default:
+			*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: scalarText(property, v)})
+		}
+	}
+}
+
+// addArray adds a list of scalars as one field and a list of objects as numbered sections
+func addArray(blocks *[]block, label string, property, options map[string]any, items []any, level int) {
+	itemSchema, _ := property["items"].(map[string]any)
+	objects := len(items) > 0
+	for _, item := range items {
+		if _, ok := item.(map[string]any); !ok {
+			objects = false
+		}
+	}
+	if !objects {
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = scalarText(itemSchema, item)
+		}
+		text := strings.Join(texts, ", ")
+		if text == "" {
+			text = "-"
+		}
+		*blocks = append(*blocks, block{kind: blockField, level: level, label: label, text: text})
+		return
+	}
+
+	for i, item := range items {
+		*blocks = append(*blocks, block{kind: blockHeading, level: level, label: fmt.Sprintf("%s %d", label, i+1)})
+		addObject(blocks, itemSchema, options, item.(map[string]any), level+1)
+	}
+}
+
+// addObject adds the fields of an object, laid out by the control's detail UI schema if it has one
+func addObject(blocks *[]block, schema, options, object map[string]any, level int) {
+	if detail, ok := options["detail"].(map[string]any); ok {
+		walkUI(blocks, detail, schema, object, level)
+		return
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, _ := properties[name].(map[string]any)
+		addAnswer(blocks, fieldLabel(nil, property, name), property, nil, object[name], level)
+	}
+}
+
+// scalarText formats a scalar answer, showing the title of enum options
+func scalarText(property map[string]any, value any) string {
+	oneOf, _ := property["oneOf"].([]any)
+	for _, option := range oneOf {
+		o, ok := option.(map[string]any)
+		if !ok || fmt.Sprint(o["const"]) != fmt.Sprint(value) {
+			continue
+		}
+		if title, ok := o["title"].(string); ok {
+			return title
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// mediaImage finds the image of a photo or signature answer: an embedded data URL, or
+// the attachment the answer's filename refers to
+func mediaImage(value any) *imageRef {
+	switch v := value.(type) {
+	case string:
+		if data := dataURL(v); data != nil {
+			return &imageRef{data: data}
+		}
+		return &imageRef{attachmentID: v}
+	case map[string]any:
+		if uri, ok := v["uri"].(string); ok {
+			if data := dataURL(uri); data != nil {
+				return &imageRef{data: data}
+			}
+		}
+		if filename, ok := v["filename"].(string); ok && filename != "" {
+			return &imageRef{attachmentID: filename}
+		}
+	}
+	return nil
+}
+
+// dataURL decodes a base64 data:image/... URL, returning nil for anything else
+func dataURL(uri string) []byte {
+	if !strings.HasPrefix(uri, "data:image/") {
+		return nil
+	}
+	_, encoded, ok := strings.Cut(uri, ";base64,")
+	if !ok {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// fileName names the file of an audio, video or file answer
+func fileName(value any) string {
+	if object, ok := value.(map[string]any); ok {
+		for _, key := range []string{"filename", "originalFileName"} {
+			if name, ok := object[key].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	if name, ok := value.(string); ok {
+		return name
+	}
+	return "-"
+}
+
+// geolocation formats a GPS answer
+func geolocation(object map[string]any) (string, bool) {
+	latitude, latOK := object["latitude"].(json.Number)
+	longitude, lonOK := object["longitude"].(json.Number)
+	if !latOK || !lonOK {
+		return "", false
+	}
+	text := latitude.String() + ", " + longitude.String()
+	if accuracy, ok := object["accuracy"].(json.Number); ok {
+		text += " (±" + accuracy.String() + " m)"
+	}
+	return text, true
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"title": "Consent",
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "title": "Participant name"},
+		"consent": {"type": "boolean"},
+		"water_source": {"type": "string", "oneOf": [{"const": "borehole", "title": "Borehole"}, {"const": "river", "title": "River"}]},
+		"signature": {"type": "object", "format": "signature"},
+		"photo": {"type": "object", "format": "photo"},
+		"location": {"type": "object"},
+		"members": {"type": "array", "items": {"type": "object", "properties": {"member_name": {"type": "string", "title": "Member"}}}},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"core_id": {"type": "string"}
+	}
+}`
+
+const testUI = `{
+	"type": "VerticalLayout",
+	"elements": [
+		{"type": "Label", "text": "Read the consent statement aloud."},
+		{"type": "Group", "label": "Participant", "elements": [
+			{"type": "Control", "scope": "#/properties/name"},
+			{"type": "Control", "scope": "#/properties/consent", "label": "Consent given"}
+		]},
+		{"type": "Control", "scope": "#/properties/water_source"},
+		{"type": "Control", "scope": "#/properties/signature"},
+		{"type": "Control", "scope": "#/properties/photo"},
+		{"type": "Control", "scope": "#/properties/location"},
+		{"type": "Control", "scope": "#/properties/members", "options": {"detail": {"type": "VerticalLayout", "elements": [
+			{"type": "Control", "scope": "#/properties/member_name"}
+		]}}},
+		{"type": "Control", "scope": "#/properties/tags"},
+		{"type": "Control", "scope": "#/properties/missing"}
+	]
+}`
+
+const testData = `{
+	"name": "Amina",
+	"consent": true,
+	"water_source": "borehole",
+	"signature": {"type": "signature", "filename": "sig.png", "uri": "data:image/png;base64,aGVsbG8="},
+	"photo": {"type": "image", "filename": "photo.jpg", "uri": "file:///photo.jpg"},
+	"location": {"latitude": 0.3476, "longitude": 32.5825, "accuracy": 5},
+	"members": [{"member_name": "Amina"}, {"member_name": "Juma"}],
+	"tags": ["a", "b"],
+	"core_id": "x1"
+}`
+
+func decode(t *testing.T, content string) map[string]any {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	var parsed map[string]any
+	if err := decoder.Decode(&parsed); err != nil {
+		t.Fatalf("Invalid test JSON: %v", err)
+	}
+	return parsed
+}
+
+// describe summarizes blocks as "level kind label: text" lines
+func describe(blocks []block) string {
+	var buf bytes.Buffer
+	kinds := map[int]string{blockHeading: "heading", blockField: "field", blockImage: "image", blockText: "text"}
+	for _, b := range blocks {
+		text := b.text
+		if b.image != nil {
+			text = b.image.attachmentID
+			if b.image.data != nil {
+				text = "embedded " + string(b.image.data)
+			}
+		}
+		fmt.Fprintf(&buf, "%d %s %s: %s\n", b.level, kinds[b.kind], b.label, text)
+	}
+	return buf.String()
+}
+
+func TestBuildDocument_UISchema(t *testing.T) {
+	blocks := buildDocument(decode(t, testSchema), decode(t, testUI), decode(t, testData))
+
+	expected := `0 text : Read the consent statement aloud.
+0 heading Participant: 
+1 field Participant name: Amina
+1 field Consent given: Yes
+0 field Water source: Borehole
+0 image Signature: embedded hello
+0 image Photo: photo.jpg
+0 field Location: 0.3476, 32.5825 (±5 m)
+0 heading Members 1: 
+1 field Member: Amina
+0 heading Members 2: 
+1 field Member: Juma
+0 field Tags: a, b
+0 field Missing: -
+`
+	if got := describe(blocks); got != expected {
+		t.Errorf("Unexpected document:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestBuildDocument_Fallbacks(t *testing.T) {
+	// Without a UI schema the schema properties are listed by name, without core fields
+	blocks := buildDocument(decode(t, testSchema), nil, decode(t, `{"name": "Amina", "consent": false, "core_id": "x1"}`))
+	got := describe(blocks)
+	for _, line := range []string{"0 field Consent: No\n", "0 field Participant name: Amina\n", "0 field Tags: -\n"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("Expected %q in:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "Core") {
+		t.Errorf("Expected core fields to be left out:\n%s", got)
+	}
+
+	// Without a schema the data fields are
+	blocks = buildDocument(nil, nil, decode(t, `{"b_field": 2, "a_field": "x", "core_id": "x1"}`))
+	if got := describe(blocks); got != "0 field A field: x\n0 field B field: 2\n" {
+		t.Errorf("Unexpected document:\n%s", got)
+	}
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"  // decode GIF answers
+	_ "image/jpeg" // decode JPEG answers
+	"image/png"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Layout in millimetres
+const (
+	margin         = 15.0
+	indent         = 6.0
+	lineHeight     = 5.0
+	maxImageWidth  = 90.0
+	maxImageHeight = 70.0
+)
+
+// drawPDF writes the blocks of an observation as a PDF
+func (s *service) drawPDF(ctx context.Context, obs *observation, schema map[string]any, blocks []block) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", s.config.PageSize, "")
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create PDF: %w", err)
+	}
+	// The core fonts are Latin-1; characters outside it print as "?"
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	title := obs.formType
+	if t, ok := schema["title"].(string); ok && t != "" {
+		title = t
+	}
+	pdf.SetTitle(title, true)
+	pdf.SetSubject(obs.id, true)
+	pdf.SetCreator("Synkronus", true)
+	pdf.SetCreationDate(obs.updatedAt)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+5)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.CellFormat(0, lineHeight, tr(fmt.Sprintf("%s - %s - page %d of {nb}", obs.formType, obs.id, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Title and record details
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.MultiCell(0, 8, tr(title), "", "L", false)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(90, 90, 90)
+	for _, line := range []string{
+		"Observation " + obs.id,
+		fmt.Sprintf("Form %s, version %s", obs.formType, obs.formVersion),
+		"Created " + obs.createdAt.UTC().Format("2006-01-02 15:04 MST") + ", last updated " + obs.updatedAt.UTC().Format("2006-01-02 15:04 MST"),
+		"Record version " + strconv.FormatInt(obs.version, 10),
+	} {
+		pdf.MultiCell(0, 4.5, tr(line), "", "L", false)
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pageWidth, _ := pdf.GetPageSize()
+	pdf.Ln(2)
+	pdf.Line(margin, pdf.GetY(), pageWidth-margin, pdf.GetY())
+	pdf.Ln(4)
+
+	images := 0
+	for _, b := range blocks {
+		left := margin + float64(b.level)*indent
+		pdf.SetLeftMargin(left)
+		pdf.SetX(left)
+		switch b.kind {
+		case blockHeading:
+			pdf.Ln(1)
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.MultiCell(0, 6, tr(b.label), "", "L", false)
+			pdf.Ln(1)
+		case blockText:
+			pdf.SetFont("Helvetica", "I", 10)
+			pdf.MultiCell(0, lineHeight, tr(b.text), "", "L", false)
+			pdf.Ln(2)
+		case blockField:
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.MultiCell(0, lineHeight, tr(b.label), "", "L", false)
+			pdf.SetFont("Helvetica", "", 10)
+			pdf.MultiCell(0, lineHeight, tr(b.text), "", "L", false)
+			pdf.Ln(2)
+		case blockImage:
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.MultiCell(0, lineHeight, tr(b.label), "", "L", false)
+			images++
+			if err := s.drawImage(ctx, pdf, b.image, "image"+strconv.Itoa(images), left); err != nil {
+				s.log.Warn("Leaving image out of observation PDF", "observationId", obs.id, "attachmentId", b.image.attachmentID, "error", err)
+				pdf.SetFont("Helvetica", "I", 10)
+				pdf.MultiCell(0, lineHeight, tr("[image not available]"), "", "L", false)
+			}
+			pdf.Ln(2)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawImage embeds an image answer, scaled to fit the image box
+func (s *service) drawImage(ctx context.Context, pdf *fpdf.Fpdf, ref *imageRef, name string, left float64) error {
+	data := ref.data
+	if data == nil {
+		var err error
+		if data, err = s.readAttachment(ctx, ref.attachmentID); err != nil {
+			return err
+		}
+	}
+	data, imageType, config, err := normalizeImage(data)
+	if err != nil {
+		return err
+	}
+
+	// Pixels are taken at 96 dpi and shrunk to fit the box
+	width := float64(config.Width) * 25.4 / 96
+	height := float64(config.Height) * 25.4 / 96
+	if scale := min(maxImageWidth/width, maxImageHeight/height, 1); scale < 1 {
+		width, height = width*scale, height*scale
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+height > pageHeight-bottom {
+		pdf.AddPage()
+	}
+	options := fpdf.ImageOptions{ImageType: imageType}
+	pdf.RegisterImageOptionsReader(name, options, bytes.NewReader(data))
+	pdf.ImageOptions(name, left, pdf.GetY(), width, height, true, options, 0, "")
+	return pdf.Error()
+}
+
+// normalizeImage checks that data is an image the PDF can embed. JPEGs are embedded as
+// they are; other images are re-encoded as 8-bit non-interlaced PNG, which keeps
+// transparency (signatures) and avoids PNG variants the PDF writer can't embed.
+func normalizeImage(data []byte) ([]byte, string, image.Config, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", config, fmt.Errorf("unsupported image: %w", err)
+	}
+	if format == "jpeg" {
+		return data, "JPG", config, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", config, fmt.Errorf("invalid image: %w", err)
+	}
+	rgba := image.NewNRGBA(decoded.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, "", config, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), "PNG", config, nil
+}
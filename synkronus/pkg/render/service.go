@@ -0,0 +1,192 @@
+// Package render produces printable documents of observations, laid out by the form's
+// schema and UI schema in the active app bundle.
+package render
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrObservationNotFound is returned for an unknown or deleted observation
+var ErrObservationNotFound = errors.New("observation not found")
+
+// Config contains rendering configuration
+type Config struct {
+	// BundlePath is the directory of the active app bundle, whose form schemas and UI
+	// schemas lay out the documents
+	BundlePath string
+	// PageSize is the paper size, e.g. A4 or Letter
+	PageSize string
+	// MaxImageBytes limits the size of an image answer that is embedded
+	MaxImageBytes int64
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		PageSize:      "A4",
+		MaxImageBytes: 20 << 20,
+	}
+}
+
+// Attachments reads uploaded attachments
+type Attachments interface {
+	Get(ctx context.Context, attachmentID string) (io.ReadCloser, error)
+}
+
+// PDF is a rendered observation
+type PDF struct {
+	ObservationID string
+	FormType      string
+	Content       []byte
+}
+
+// Filename is a download filename for the document
+func (p *PDF) Filename() string {
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '-' || r == '_' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				return r
+			}
+			return '_'
+		}, s)
+	}
+	return clean(p.FormType) + "-" + clean(p.ObservationID) + ".pdf"
+}
+
+// Service renders observations
+type Service interface {
+	// ObservationPDF renders the printable PDF of an observation: its answers under their
+	// labels, with photos and signatures embedded
+	ObservationPDF(ctx context.Context, observationID string) (*PDF, error)
+}
+
+type service struct {
+	db          *sql.DB
+	attachments Attachments
+	config      Config
+	log         *logger.Logger
+}
+
+// NewService creates a new rendering service; attachments may be nil, which leaves
+// attached images out
+func NewService(db *sql.DB, attachments Attachments, config Config, log *logger.Logger) Service {
+	defaults := DefaultConfig()
+	if config.PageSize == "" {
+		config.PageSize = defaults.PageSize
+	}
+	if config.MaxImageBytes <= 0 {
+		config.MaxImageBytes = defaults.MaxImageBytes
+	}
+	return &service{db: db, attachments: attachments, config: config, log: log}
+}
+
+// observation is the stored observation being rendered
+type observation struct {
+	id          string
+	formType    string
+	formVersion string
+	data        map[string]any
+	createdAt   time.Time
+	updatedAt   time.Time
+	version     int64
+}
+
+// ObservationPDF renders an observation
+func (s *service) ObservationPDF(ctx context.Context, observationID string) (_ *PDF, err error) {
+	ctx, span := tracing.Start(ctx, "render.ObservationPDF", attribute.String("render.observation_id", observationID))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	obs, err := s.loadObservation(ctx, observationID)
+	if err != nil {
+		return nil, err
+	}
+	schema := s.loadFormFile(obs.formType, "schema.json")
+	ui := s.loadFormFile(obs.formType, "ui.json")
+
+	content, err := s.drawPDF(ctx, obs, schema, buildDocument(schema, ui, obs.data))
+	if err != nil {
+		return nil, err
+	}
+	return &PDF{ObservationID: obs.id, FormType: obs.formType, Content: content}, nil
+}
+
+// loadObservation reads a live observation
+func (s *service) loadObservation(ctx context.Context, observationID string) (*observation, error) {
+	obs := &observation{id: observationID}
+	var data []byte
+	var deleted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT form_type, form_version, data, created_at, updated_at, deleted, version
+		FROM observations
+		WHERE observation_id = $1`,
+		observationID).Scan(&obs.formType, &obs.formVersion, &data, &obs.createdAt, &obs.updatedAt, &deleted, &obs.version)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && deleted) {
+		return nil, ErrObservationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get observation: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obs.data); err != nil {
+		// Data that isn't an object is printed without answers
+		obs.data = map[string]any{}
+	}
+	return obs, nil
+}
+
+// loadFormFile reads a JSON file of a form type in the active app bundle, or returns nil
+func (s *service) loadFormFile(formType, name string) map[string]any {
+	path := formschema.File(s.config.BundlePath, formType, name)
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		s.log.Warn("Ignoring unreadable form file", "path", path, "error", err)
+		return nil
+	}
+	var parsed map[string]any
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		s.log.Warn("Ignoring invalid form file", "path", path, "error", err)
+		return nil
+	}
+	return parsed
+}
+
+// readAttachment reads an attached image, up to the configured size
+func (s *service) readAttachment(ctx context.Context, attachmentID string) ([]byte, error) {
+	if s.attachments == nil {
+		return nil, errors.New("attachments are not available")
+	}
+	file, err := s.attachments.Get(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, s.config.MaxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.config.MaxImageBytes {
+		return nil, fmt.Errorf("larger than %d bytes", s.config.MaxImageBytes)
+	}
+	return data, nil
+}
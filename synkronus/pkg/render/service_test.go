@@ -0,0 +1,132 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// fakeAttachments serves in-memory attachments and records the requested IDs
+type fakeAttachments struct {
+	files     map[string][]byte
+	requested []string
+}
+
+func (f *fakeAttachments) Get(ctx context.Context, attachmentID string) (io.ReadCloser, error) {
+	f.requested = append(f.requested, attachmentID)
+	data, ok := f.files[attachmentID]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for x := 0; x < 400; x++ {
+		img.Set(x, x%300, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeConsentBundle writes an app bundle with the consent form and returns its path
+func writeConsentBundle(t *testing.T) string {
+	t.Helper()
+	bundle := t.TempDir()
+	dir := filepath.Join(bundle, "forms", "consent")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create form directory: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "schema.json"), []byte(testSchema), 0644)
+	os.WriteFile(filepath.Join(dir, "ui.json"), []byte(testUI), 0644)
+	return bundle
+}
+
+func observationRow(data string, deleted bool) *sqlmock.Rows {
+	now := time.Date(2025, 9, 12, 10, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows([]string{"form_type", "form_version", "data", "created_at", "updated_at", "deleted", "version"}).
+		AddRow("consent", "1.0.0", []byte(data), now, now, deleted, int64(42))
+}
+
+func TestService_ObservationPDF(t *testing.T) {
+	attachments := &fakeAttachments{files: map[string][]byte{"photo.jpg": testJPEG(t)}}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeConsentBundle(t)
+	s := NewService(db, attachments, config, logger.NewLogger()).(*service)
+
+	mock.ExpectQuery(`SELECT form_type, form_version, data`).
+		WithArgs("obs-1").
+		WillReturnRows(observationRow(testData, false))
+
+	pdf, err := s.ObservationPDF(context.Background(), "obs-1")
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !bytes.HasPrefix(pdf.Content, []byte("%PDF-")) {
+		t.Errorf("Expected a PDF, got %q", pdf.Content[:min(len(pdf.Content), 16)])
+	}
+	if pdf.Filename() != "consent-obs-1.pdf" {
+		t.Errorf("Unexpected filename %s", pdf.Filename())
+	}
+	// The photo is read from the attachments; the signature is embedded in the data but
+	// isn't a valid image, so it is left out without failing the document
+	if len(attachments.requested) != 1 || attachments.requested[0] != "photo.jpg" {
+		t.Errorf("Unexpected attachment reads: %v", attachments.requested)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_ObservationPDFNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeConsentBundle(t)
+	s := NewService(db, nil, config, logger.NewLogger()).(*service)
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT form_type`).WithArgs("missing").WillReturnRows(sqlmock.NewRows(nil))
+	if _, err := s.ObservationPDF(ctx, "missing"); !errors.Is(err, ErrObservationNotFound) {
+		t.Errorf("Expected ErrObservationNotFound, got %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT form_type`).WithArgs("deleted").WillReturnRows(observationRow(`{}`, true))
+	if _, err := s.ObservationPDF(ctx, "deleted"); !errors.Is(err, ErrObservationNotFound) {
+		t.Errorf("Expected ErrObservationNotFound for a deleted observation, got %v", err)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	jpg := testJPEG(t)
+	if data, imageType, config, err := normalizeImage(jpg); err != nil || imageType != "JPG" || !bytes.Equal(data, jpg) || config.Width != 400 {
+		t.Errorf("Expected the JPEG as it is, got %s, %v", imageType, err)
+	}
+	if _, _, _, err := normalizeImage([]byte("hello")); err == nil {
+		t.Errorf("Expected an error for data that isn't an image")
+	}
+}
@@ -0,0 +1,198 @@
+// Package requiredattachment checks that pushed observations come with the media their
+// form schema requires, for fields tagged x-attachment-required (e.g. a consent photo)
+package requiredattachment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Keyword is the schema.json property keyword declaring a field that needs an attachment
+const Keyword = "x-attachment-required"
+
+// Config contains required attachment configuration
+type Config struct {
+	// BundlePath is the active app bundle; fields tagged x-attachment-required in its
+	// form schemas need an uploaded attachment
+	BundlePath string
+	// Grace is how long after a push referenced attachments may still be uploaded before
+	// the observation is reported as missing media
+	Grace time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Grace: time.Hour,
+	}
+}
+
+// Pending is a required field referring to an attachment that hasn't been uploaded yet
+type Pending struct {
+	Field        string
+	AttachmentID string
+}
+
+// Result is the outcome of checking one record's data
+type Result struct {
+	// Missing lists the required fields without an attachment reference, sorted
+	Missing []string
+	// Pending lists the required fields whose attachment isn't uploaded yet, by field
+	Pending []Pending
+	// Deadline is when pending attachments must have arrived
+	Deadline time.Time
+}
+
+// Service checks the required attachments of pushed data
+type Service interface {
+	// Check returns the required fields of data that have no attachment or refer to one
+	// that isn't uploaded; forms without such fields always pass
+	Check(ctx context.Context, formType string, data json.RawMessage) (*Result, error)
+}
+
+type service struct {
+	db      *sql.DB
+	config  Config
+	log     *logger.Logger
+	schemas *formschema.Cache[[]string]
+}
+
+// NewService creates a new required attachment service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+		schemas: formschema.NewCache(config.BundlePath, func(formType string, data []byte) ([]string, error) {
+			fields, err := ParseSchema(data)
+			if err != nil {
+				log.Warn("Not checking required attachments of form", "formType", formType, "error", err)
+				return nil, nil
+			}
+			return fields, nil
+		}),
+	}
+}
+
+func (s *service) Check(ctx context.Context, formType string, data json.RawMessage) (_ *Result, err error) {
+	fields, err := s.schemas.Get(formType)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return &Result{}, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "requiredattachment.Check", attribute.String("requiredattachment.form_type", formType))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid data: %w", err)
+	}
+
+	result := &Result{Missing: []string{}, Pending: []Pending{}, Deadline: time.Now().Add(s.config.Grace).UTC()}
+	referenced := make(map[string]string, len(fields))
+	ids := []string{}
+	for _, field := range fields {
+		id, embedded := Reference(values[field])
+		switch {
+		case embedded:
+		case id == "":
+			result.Missing = append(result.Missing, field)
+		default:
+			referenced[field] = id
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT attachment_id FROM attachments WHERE attachment_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up attachments: %w", err)
+	}
+	defer rows.Close()
+	uploaded := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		uploaded[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read attachments: %w", err)
+	}
+
+	for _, field := range fields {
+		if id, ok := referenced[field]; ok && !uploaded[id] {
+			result.Pending = append(result.Pending, Pending{Field: field, AttachmentID: id})
+		}
+	}
+	return result, nil
+}
+
+// ParseSchema lists the top-level properties of a form schema tagged
+// "x-attachment-required": true, sorted
+func ParseSchema(data []byte) ([]string, error) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	fields := []string{}
+	for field, raw := range schema.Properties {
+		var property map[string]any
+		if err := json.Unmarshal(raw, &property); err != nil {
+			continue
+		}
+		if value, ok := property[Keyword]; ok {
+			required, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s of %s must be a boolean", Keyword, field)
+			}
+			if required {
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// Reference returns the attachment a media answer refers to: the answer itself when it
+// is a string, or the filename of a {filename, uri} object. Media embedded as a data URL
+// needs no upload and reports embedded.
+func Reference(value any) (attachmentID string, embedded bool) {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			return "", true
+		}
+		return v, false
+	case map[string]any:
+		if filename, ok := v["filename"].(string); ok && filename != "" {
+			return filename, false
+		}
+		if uri, ok := v["uri"].(string); ok && strings.HasPrefix(uri, "data:") {
+			return "", true
+		}
+	}
+	return "", false
+}
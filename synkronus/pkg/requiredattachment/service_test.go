@@ -0,0 +1,119 @@
+package requiredattachment
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+const consentSchema = `{
+	"properties": {
+		"name": {"type": "string"},
+		"consent_photo": {"type": "object", "x-attachment-required": true},
+		"signature": {"type": "string", "x-attachment-required": true},
+		"audio": {"type": "string", "x-attachment-required": false}
+	}
+}`
+
+func TestParseSchema(t *testing.T) {
+	fields, err := ParseSchema([]byte(consentSchema))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if !reflect.DeepEqual(fields, []string{"consent_photo", "signature"}) {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+
+	if _, err := ParseSchema([]byte(`{"properties":{"photo":{"x-attachment-required":"yes"}}}`)); err == nil {
+		t.Error("Expected an error for a non-boolean tag")
+	}
+	if _, err := ParseSchema([]byte(`{`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		id       string
+		embedded bool
+	}{
+		{"string", "p.jpg", "p.jpg", false},
+		{"object", map[string]any{"filename": "p.jpg", "uri": "file:///p.jpg"}, "p.jpg", false},
+		{"data URL", "data:image/png;base64,AAAA", "", true},
+		{"embedded object", map[string]any{"uri": "data:image/png;base64,AAAA"}, "", true},
+		{"device path only", map[string]any{"uri": "file:///p.jpg"}, "", false},
+		{"null", nil, "", false},
+		{"number", 3.0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, embedded := Reference(tt.value)
+			if id != tt.id || embedded != tt.embedded {
+				t.Errorf("Expected %q/%v, got %q/%v", tt.id, tt.embedded, id, embedded)
+			}
+		})
+	}
+}
+
+func TestService_Check(t *testing.T) {
+	bundle := t.TempDir()
+	dir := filepath.Join(bundle, "forms", "consent")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schema.json"), []byte(consentSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, Config{BundlePath: bundle, Grace: 30 * time.Minute}, logger.NewLogger())
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT attachment_id FROM attachments WHERE attachment_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"photo-1", "sig-1"})).
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}).AddRow("photo-1"))
+	result, err := svc.Check(ctx, "consent", json.RawMessage(`{"consent_photo":{"filename":"photo-1"},"signature":"sig-1"}`))
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(result.Missing) != 0 || !reflect.DeepEqual(result.Pending, []Pending{{Field: "signature", AttachmentID: "sig-1"}}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if until := time.Until(result.Deadline); until < 29*time.Minute || until > 30*time.Minute {
+		t.Errorf("Expected a deadline in 30 minutes, got %s", result.Deadline)
+	}
+
+	// Empty and embedded answers don't need a lookup
+	result, err = svc.Check(ctx, "consent", json.RawMessage(`{"consent_photo":null,"signature":"data:image/png;base64,AAAA"}`))
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Missing, []string{"consent_photo"}) || len(result.Pending) != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// Forms without tagged fields or without a schema pass
+	result, err = svc.Check(ctx, "household", json.RawMessage(`{}`))
+	if err != nil || len(result.Missing) != 0 || len(result.Pending) != 0 {
+		t.Errorf("Expected household to pass, got %+v, %v", result, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
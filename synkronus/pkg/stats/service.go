@@ -0,0 +1,287 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Supported group_by dimensions
+const (
+	GroupByFormType = "form_type"
+	GroupByClient   = "client"
+	GroupByGridCell = "grid_cell"
+)
+
+// unknownClient is the bucket for observations pushed before client tracking existed
+const unknownClient = "unknown"
+
+// refreshOverlap re-examines recently updated observations on every refresh so that
+// transactions committing while a refresh runs are not missed
+const refreshOverlap = 5 * time.Minute
+
+// ErrInvalidGroupBy is returned for an unsupported group_by dimension
+var ErrInvalidGroupBy = errors.New("invalid group_by")
+
+// Config contains stats configuration
+type Config struct {
+	// RefreshInterval is how often the summary tables are refreshed; 0 disables the schedule
+	RefreshInterval time.Duration
+	// GridSize is the edge length in degrees of the geolocation grid cells
+	GridSize float64
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		RefreshInterval: 15 * time.Minute,
+		GridSize:        0.1,
+	}
+}
+
+// Query selects the observation statistics to return
+type Query struct {
+	GroupBy string
+	From    *time.Time // inclusive, by day
+	To      *time.Time // inclusive, by day
+}
+
+// Bucket is the observation count for one day and group
+type Bucket struct {
+	Day   string `json:"day"`
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// ObservationStats is the result of a stats query
+type ObservationStats struct {
+	GroupBy     string     `json:"group_by"`
+	Buckets     []Bucket   `json:"buckets"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+}
+
+// Service materializes and serves observation statistics for dashboards
+type Service interface {
+	// Refresh recomputes the daily counts for days with changed observations
+	Refresh(ctx context.Context) error
+
+	// GetObservationStats returns daily counts from the summary tables
+	GetObservationStats(ctx context.Context, query Query) (*ObservationStats, error)
+
+	// Start refreshes on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+}
+
+// NewService creates a new stats service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// ValidGroupBy reports whether groupBy is a supported dimension
+func ValidGroupBy(groupBy string) bool {
+	switch groupBy {
+	case GroupByFormType, GroupByClient, GroupByGridCell:
+		return true
+	}
+	return false
+}
+
+// Start refreshes on the configured schedule until ctx is cancelled
+func (s *service) Start(ctx context.Context) {
+	if s.config.RefreshInterval <= 0 {
+		s.log.Info("Observation stats schedule disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to refresh observation stats", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Refresh recomputes the daily counts for days with changed observations
+func (s *service) Refresh(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "stats.Refresh", attribute.Float64("stats.grid_size", s.config.GridSize))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the watermark so concurrent refreshes serialize
+	var refreshedAt sql.NullTime
+	var gridSize sql.NullFloat64
+	err = tx.QueryRowContext(ctx,
+		"SELECT refreshed_at, grid_size FROM observation_stats_state WHERE id = 1 FOR UPDATE",
+	).Scan(&refreshedAt, &gridSize)
+	if err != nil {
+		return fmt.Errorf("failed to read stats watermark: %w", err)
+	}
+
+	// A changed grid invalidates every grid_cell bucket, so rebuild from scratch
+	since := time.Time{}
+	if refreshedAt.Valid && gridSize.Valid && gridSize.Float64 == s.config.GridSize {
+		since = refreshedAt.Time.Add(-refreshOverlap)
+	}
+	span.SetAttributes(attribute.Bool("stats.full_rebuild", since.IsZero()))
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{
+			query: `CREATE TEMP TABLE stats_touched_days ON COMMIT DROP AS
+				SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::DATE AS day
+				FROM observations WHERE updated_at > $1`,
+			args: []interface{}{since},
+		},
+		{
+			query: `DELETE FROM observation_daily_stats WHERE day IN (SELECT day FROM stats_touched_days)`,
+		},
+		{
+			query: `INSERT INTO observation_daily_stats (day, dimension, bucket, observation_count)
+				SELECT (created_at AT TIME ZONE 'UTC')::DATE, $1, form_type, COUNT(*)
+				FROM observations
+				WHERE NOT deleted AND (created_at AT TIME ZONE 'UTC')::DATE IN (SELECT day FROM stats_touched_days)
+				GROUP BY 1, 3`,
+			args: []interface{}{GroupByFormType},
+		},
+		{
+			query: `INSERT INTO observation_daily_stats (day, dimension, bucket, observation_count)
+				SELECT (created_at AT TIME ZONE 'UTC')::DATE, $1, COALESCE(client_id, $2), COUNT(*)
+				FROM observations
+				WHERE NOT deleted AND (created_at AT TIME ZONE 'UTC')::DATE IN (SELECT day FROM stats_touched_days)
+				GROUP BY 1, 3`,
+			args: []interface{}{GroupByClient, unknownClient},
+		},
+		{
+			// Cells are identified by their south-west corner
+			query: `INSERT INTO observation_daily_stats (day, dimension, bucket, observation_count)
+				SELECT (created_at AT TIME ZONE 'UTC')::DATE, $1,
+				       CONCAT((FLOOR((geolocation->>'latitude')::DOUBLE PRECISION / $2) * $2)::NUMERIC(9,4), ',',
+				              (FLOOR((geolocation->>'longitude')::DOUBLE PRECISION / $2) * $2)::NUMERIC(9,4)),
+				       COUNT(*)
+				FROM observations
+				WHERE NOT deleted AND geolocation IS NOT NULL
+				  AND (created_at AT TIME ZONE 'UTC')::DATE IN (SELECT day FROM stats_touched_days)
+				GROUP BY 1, 3`,
+			args: []interface{}{GroupByGridCell, s.config.GridSize},
+		},
+		{
+			query: `UPDATE observation_stats_state SET refreshed_at = NOW(), grid_size = $1 WHERE id = 1`,
+			args:  []interface{}{s.config.GridSize},
+		},
+	}
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return fmt.Errorf("failed to refresh observation stats: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit observation stats: %w", err)
+	}
+
+	s.log.Debug("Observation stats refreshed", "fullRebuild", since.IsZero(), "duration", time.Since(start))
+	return nil
+}
+
+// GetObservationStats returns daily counts from the summary tables
+func (s *service) GetObservationStats(ctx context.Context, query Query) (_ *ObservationStats, err error) {
+	ctx, span := tracing.Start(ctx, "stats.GetObservationStats", attribute.String("stats.group_by", query.GroupBy))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if !ValidGroupBy(query.GroupBy) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidGroupBy, query.GroupBy)
+	}
+
+	var queryBuilder strings.Builder
+	args := []interface{}{query.GroupBy}
+
+	queryBuilder.WriteString(`
+		SELECT day, bucket, observation_count
+		FROM observation_daily_stats
+		WHERE dimension = $1`)
+
+	if query.From != nil {
+		args = append(args, query.From.Format("2006-01-02"))
+		queryBuilder.WriteString(" AND day >= $" + strconv.Itoa(len(args)))
+	}
+	if query.To != nil {
+		args = append(args, query.To.Format("2006-01-02"))
+		queryBuilder.WriteString(" AND day <= $" + strconv.Itoa(len(args)))
+	}
+	queryBuilder.WriteString(" ORDER BY day ASC, bucket ASC")
+
+	rows, err := s.db.QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := &ObservationStats{
+		GroupBy: query.GroupBy,
+		Buckets: []Bucket{},
+	}
+	for rows.Next() {
+		var day time.Time
+		var bucket Bucket
+		if err := rows.Scan(&day, &bucket.Key, &bucket.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan observation stats: %w", err)
+		}
+		bucket.Day = day.Format("2006-01-02")
+		result.Buckets = append(result.Buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read observation stats: %w", err)
+	}
+
+	var refreshedAt sql.NullTime
+	err = s.db.QueryRowContext(ctx, "SELECT refreshed_at FROM observation_stats_state WHERE id = 1").Scan(&refreshedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read stats watermark: %w", err)
+	}
+	if refreshedAt.Valid {
+		result.RefreshedAt = &refreshedAt.Time
+	}
+	span.SetAttributes(attribute.Int("stats.bucket_count", len(result.Buckets)))
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestService_GetObservationStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	refreshedAt := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT day, bucket, observation_count FROM observation_daily_stats WHERE dimension = \$1 AND day >= \$2 ORDER BY day ASC, bucket ASC`).
+		WithArgs(GroupByGridCell, "2025-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"day", "bucket", "observation_count"}).
+			AddRow(day, "37.7000,-122.5000", 4).
+			AddRow(day, "37.8000,-122.5000", 1))
+	mock.ExpectQuery(`SELECT refreshed_at FROM observation_stats_state WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"refreshed_at"}).AddRow(refreshedAt))
+
+	result, err := svc.GetObservationStats(context.Background(), Query{GroupBy: GroupByGridCell, From: &from})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Buckets) != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", len(result.Buckets))
+	}
+	if result.Buckets[0].Day != "2025-01-02" || result.Buckets[0].Key != "37.7000,-122.5000" || result.Buckets[0].Count != 4 {
+		t.Errorf("Unexpected first bucket: %+v", result.Buckets[0])
+	}
+	if result.RefreshedAt == nil || !result.RefreshedAt.Equal(refreshedAt) {
+		t.Errorf("Expected refreshed_at %v, got %v", refreshedAt, result.RefreshedAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_GetObservationStats_InvalidGroupBy(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewService(db, DefaultConfig(), logger.NewLogger())
+	if _, err := svc.GetObservationStats(context.Background(), Query{GroupBy: "data"}); !errors.Is(err, ErrInvalidGroupBy) {
+		t.Errorf("Expected ErrInvalidGroupBy, got %v", err)
+	}
+}
+
+func TestService_Refresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		refreshedAt interface{}
+		gridSize    interface{}
+		fullRebuild bool
+	}{
+		{name: "first refresh rebuilds everything", refreshedAt: nil, gridSize: nil, fullRebuild: true},
+		{name: "incremental refresh", refreshedAt: time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC), gridSize: 0.1},
+		{name: "grid change rebuilds everything", refreshedAt: time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC), gridSize: 0.5, fullRebuild: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock database: %v", err)
+			}
+			defer db.Close()
+
+			svc := NewService(db, DefaultConfig(), logger.NewLogger())
+
+			since := time.Time{}
+			if !tt.fullRebuild {
+				since = tt.refreshedAt.(time.Time).Add(-refreshOverlap)
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT refreshed_at, grid_size FROM observation_stats_state WHERE id = 1 FOR UPDATE`).
+				WillReturnRows(sqlmock.NewRows([]string{"refreshed_at", "grid_size"}).AddRow(tt.refreshedAt, tt.gridSize))
+			mock.ExpectExec(`CREATE TEMP TABLE stats_touched_days`).WithArgs(since).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`DELETE FROM observation_daily_stats`).WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(`INSERT INTO observation_daily_stats`).WithArgs(GroupByFormType).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO observation_daily_stats`).WithArgs(GroupByClient, unknownClient).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO observation_daily_stats`).WithArgs(GroupByGridCell, 0.1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`UPDATE observation_stats_state`).WithArgs(0.1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			if err := svc.Refresh(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
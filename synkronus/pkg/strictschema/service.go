@@ -0,0 +1,214 @@
+// Package strictschema checks pushed observation data against the properties its form
+// schema declares, for forms that opt in with x-unknown-keys
+package strictschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// Mode is what a push does with data keys the form schema doesn't declare
+type Mode string
+
+const (
+	// ModeAllow stores unknown keys as pushed; the default
+	ModeAllow Mode = "allow"
+	// ModeStrip removes unknown keys and stores the rest of the record
+	ModeStrip Mode = "strip"
+	// ModeReject fails records with unknown keys
+	ModeReject Mode = "reject"
+)
+
+// Config contains strict schema configuration
+type Config struct {
+	// BundlePath is where the active app bundle is unpacked; forms opt into key checks
+	// with x-unknown-keys in their schema
+	BundlePath string
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// Result is the outcome of checking one record's data
+type Result struct {
+	Mode Mode
+	// Unknown lists the paths of keys the schema doesn't declare, sorted; nested keys are
+	// joined with dots and array elements are written as [i]
+	Unknown []string
+	// Data is the data to store: without the unknown keys in ModeStrip, otherwise as pushed
+	Data json.RawMessage
+}
+
+// Service checks pushed data against form schemas. A schema opts in by setting
+// x-unknown-keys at its root to strip or reject.
+type Service interface {
+	// Check returns the unknown keys of data for a form type; forms without a schema in
+	// the active bundle allow every key
+	Check(formType string, data json.RawMessage) (*Result, error)
+}
+
+// Schema is the part of a form schema the check needs
+type Schema struct {
+	Mode Mode
+	root *node
+}
+
+// node is an object in a form schema and the properties it declares
+type node struct {
+	properties map[string]*node
+	// items is the object schema of the elements of an array property
+	items *node
+}
+
+type service struct {
+	config  Config
+	log     *logger.Logger
+	schemas *formschema.Cache[*Schema]
+}
+
+// NewService creates a new strict schema service
+func NewService(config Config, log *logger.Logger) Service {
+	return &service{
+		config: config,
+		log:    log,
+		schemas: formschema.NewCache(config.BundlePath, func(formType string, data []byte) (*Schema, error) {
+			schema, err := ParseSchema(data)
+			if err != nil {
+				// Checking is opt-in, so a schema we can't read stores data as pushed
+				log.Warn("Not checking data keys of form", "formType", formType, "error", err)
+				return &Schema{Mode: ModeAllow}, nil
+			}
+			return schema, nil
+		}),
+	}
+}
+
+func (s *service) Check(formType string, data json.RawMessage) (*Result, error) {
+	schema, err := s.schemas.Get(formType)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return &Result{Mode: ModeAllow, Data: data}, nil
+	}
+	return schema.Check(data)
+}
+
+// ParseSchema reads x-unknown-keys and the declared properties from a form schema
+func ParseSchema(data []byte) (*Schema, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	schema := &Schema{Mode: ModeAllow}
+	if value, ok := raw["x-unknown-keys"]; ok && value != nil {
+		mode, _ := value.(string)
+		switch Mode(mode) {
+		case ModeAllow, ModeStrip, ModeReject:
+			schema.Mode = Mode(mode)
+		default:
+			return nil, fmt.Errorf("x-unknown-keys must be allow, strip or reject")
+		}
+	}
+	if schema.Mode != ModeAllow {
+		schema.root = parseNode(raw)
+	}
+	return schema, nil
+}
+
+// parseNode collects the properties an object schema declares; nil when it declares none,
+// so any key is allowed in it
+func parseNode(raw map[string]any) *node {
+	properties, ok := raw["properties"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	n := &node{properties: make(map[string]*node, len(properties))}
+	for name, value := range properties {
+		property, _ := value.(map[string]any)
+		child := parseNode(property)
+		if items, ok := property["items"].(map[string]any); ok {
+			if elements := parseNode(items); elements != nil {
+				child = &node{items: elements}
+			}
+		}
+		n.properties[name] = child
+	}
+	return n
+}
+
+// Check returns the unknown keys of data
+func (schema *Schema) Check(data json.RawMessage) (*Result, error) {
+	result := &Result{Mode: schema.Mode, Data: data}
+	if schema.Mode == ModeAllow || schema.root == nil || len(data) == 0 {
+		return result, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid data: %w", err)
+	}
+	stripped := schema.root.walk(value, "", &result.Unknown)
+	if len(result.Unknown) == 0 {
+		return result, nil
+	}
+	sort.Strings(result.Unknown)
+
+	if schema.Mode == ModeStrip {
+		encoded, err := json.Marshal(stripped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode data: %w", err)
+		}
+		result.Data = encoded
+	}
+	return result, nil
+}
+
+// walk appends the paths of undeclared keys in value to unknown and returns value
+// without them
+func (n *node) walk(value any, path string, unknown *[]string) any {
+	if n == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		if n.properties == nil {
+			return v
+		}
+		kept := make(map[string]any, len(v))
+		for key, child := range v {
+			property, ok := n.properties[key]
+			if !ok {
+				*unknown = append(*unknown, join(path, key))
+				continue
+			}
+			kept[key] = property.walk(child, join(path, key), unknown)
+		}
+		return kept
+	case []any:
+		if n.items == nil {
+			return v
+		}
+		kept := make([]any, len(v))
+		for i, element := range v {
+			kept[i] = n.items.walk(element, path+"["+strconv.Itoa(i)+"]", unknown)
+		}
+		return kept
+	}
+	return value
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
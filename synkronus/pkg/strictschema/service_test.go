@@ -0,0 +1,128 @@
+package strictschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+const householdSchema = `{
+	"x-unknown-keys": "%s",
+	"properties": {
+		"name": {"type": "string"},
+		"address": {"type": "object", "properties": {"village": {"type": "string"}}},
+		"members": {"type": "array", "items": {"type": "object", "properties": {"age": {"type": "integer"}}}},
+		"notes": {"type": "object"}
+	}
+}`
+
+func parse(t *testing.T, mode Mode) *Schema {
+	t.Helper()
+	schema, err := ParseSchema([]byte(fmt.Sprintf(householdSchema, mode)))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	return schema
+}
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		mode    Mode
+		wantErr bool
+	}{
+		{"default", `{"properties":{}}`, ModeAllow, false},
+		{"strip", `{"x-unknown-keys":"strip"}`, ModeStrip, false},
+		{"reject", `{"x-unknown-keys":"reject"}`, ModeReject, false},
+		{"unknown mode", `{"x-unknown-keys":"warn"}`, "", true},
+		{"wrong type", `{"x-unknown-keys":true}`, "", true},
+		{"invalid JSON", `{`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseSchema([]byte(tt.schema))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && schema.Mode != tt.mode {
+				t.Errorf("Expected mode %s, got %s", tt.mode, schema.Mode)
+			}
+		})
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	data := json.RawMessage(`{"name":"a","nmae":"a","address":{"village":"v","zip":"1"},"members":[{"age":3},{"age":4,"nick":"b"}],"notes":{"anything":1}}`)
+	want := []string{"address.zip", "members[1].nick", "nmae"}
+
+	result, err := parse(t, ModeStrip).Check(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Unknown, want) {
+		t.Errorf("Expected unknown keys %v, got %v", want, result.Unknown)
+	}
+	expected := `{"address":{"village":"v"},"members":[{"age":3},{"age":4}],"name":"a","notes":{"anything":1}}`
+	if string(result.Data) != expected {
+		t.Errorf("Expected stripped data %s, got %s", expected, result.Data)
+	}
+
+	result, err = parse(t, ModeReject).Check(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Unknown, want) || string(result.Data) != string(data) {
+		t.Errorf("Expected unknown keys and unchanged data, got %+v", result)
+	}
+
+	result, err = parse(t, ModeAllow).Check(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Unknown) != 0 {
+		t.Errorf("Expected allow mode not to check, got %v", result.Unknown)
+	}
+
+	// Data without unknown keys is stored exactly as pushed
+	clean := json.RawMessage(`{"name":"a", "members":[]}`)
+	if result, err := parse(t, ModeStrip).Check(clean); err != nil || string(result.Data) != string(clean) {
+		t.Errorf("Expected clean data unchanged, got %+v, %v", result, err)
+	}
+}
+
+func TestServiceCheck(t *testing.T) {
+	bundle := t.TempDir()
+	write := func(schema string) {
+		formschema.WriteSchema(t, filepath.Join(bundle, "forms"), "household", schema)
+	}
+
+	svc := NewService(Config{BundlePath: bundle}, logger.NewLogger())
+	data := json.RawMessage(`{"name":"a","extra":1}`)
+
+	write(fmt.Sprintf(householdSchema, ModeReject))
+	result, err := svc.Check("household", data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Mode != ModeReject || !reflect.DeepEqual(result.Unknown, []string{"extra"}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// A schema that doesn't parse doesn't block pushes
+	write(`{"x-unknown-keys":"sometimes"}`)
+	if result, err := svc.Check("household", data); err != nil || result.Mode != ModeAllow {
+		t.Errorf("Expected a broken schema to allow data, got %+v, %v", result, err)
+	}
+
+	for _, formType := range []string{"other", "../forms/household", ""} {
+		if result, err := svc.Check(formType, data); err != nil || result.Mode != ModeAllow || string(result.Data) != string(data) {
+			t.Errorf("Expected %q to allow data, got %+v, %v", formType, result, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// fakeAccess restricts payments to admins
+type fakeAccess struct{}
+
+func (fakeAccess) DeniedFormTypes(role models.Role) ([]string, error) {
+	if role == models.RoleAdmin {
+		return nil, nil
+	}
+	return []string{"payments"}, nil
+}
+
+func newAccessTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	config := DefaultConfig()
+	config.Access = fakeAccess{}
+	return NewService(db, config, logger.NewLogger()), mock
+}
+
+func userContext(role models.Role) context.Context {
+	return context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "someone", Role: role})
+}
+
+func TestService_ProcessPushedRecordsRequiredRole(t *testing.T) {
+	service, mock := newAccessTestService(t)
+	now := time.Now().UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "payments", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "household", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(8)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-2", "household", "1.0", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, "client-1", int64(8), "someone", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(userContext(models.RoleReadWrite), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 1 {
+		t.Fatalf("Expected the payments record to fail, got %+v", result)
+	}
+	if message := result.FailedRecords[0]["error"].(string); !strings.Contains(message, "form type payments requires a role") {
+		t.Errorf("Unexpected failure %q", message)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_GetRecordsSinceVersionRequiredRole(t *testing.T) {
+	service, mock := newAccessTestService(t)
+	columns := []string{"observation_id", "form_type", "form_version", "data", "created_at", "updated_at", "synced_at", "deleted", "version"}
+
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(9)))
+	mock.ExpectQuery(`SELECT min_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	mock.ExpectQuery(`WHERE version > \$1 AND form_type = ANY\(\$2\) AND NOT \(form_type = ANY\(\$3\)\) AND \(version > \$4::BIGINT OR \(version = \$5::BIGINT AND observation_id > \$6::VARCHAR\)\) ORDER BY version ASC, observation_id ASC LIMIT \$7`).
+		WithArgs(int64(0), pq.Array([]string{"household", "payments"}), pq.Array([]string{"payments"}), int64(3), int64(3), "obs-3", 11).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("obs-4", "household", "1.0", []byte(`{}`), "2025-09-14T07:30:00Z", "2025-09-14T07:30:00Z", nil, false, int64(4)))
+
+	result, err := service.GetRecordsSinceVersion(userContext(models.RoleReadOnly), 0, "client-1", []string{"household", "payments"}, 10, &SyncPullCursor{Version: 3, ID: "obs-3"})
+	if err != nil {
+		t.Fatalf("GetRecordsSinceVersion: %v", err)
+	}
+	if len(result.Records) != 1 || result.HasMore {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// Admins see every form type
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(9)))
+	mock.ExpectQuery(`SELECT min_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	mock.ExpectQuery(`WHERE version > \$1 ORDER BY version ASC, observation_id ASC LIMIT \$2`).
+		WithArgs(int64(0), 11).
+		WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := service.GetRecordsSinceVersion(userContext(models.RoleAdmin), 0, "client-1", nil, 10, nil); err != nil {
+		t.Fatalf("GetRecordsSinceVersion: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// fakePermissions grants salaries to alice only
+type fakePermissions struct{}
+
+func (fakePermissions) DeniedFormTypes(ctx context.Context, user *models.User) ([]string, error) {
+	if user.Username == "alice" {
+		return nil, nil
+	}
+	return []string{"salaries"}, nil
+}
+
+func TestService_FormPermissions(t *testing.T) {
+	service, mock := newAccessTestService(t)
+	service.config.Permissions = fakePermissions{}
+	columns := []string{"observation_id", "form_type", "form_version", "data", "created_at", "updated_at", "synced_at", "deleted", "version"}
+
+	// Pulls leave out the form types denied by role and the ones not granted
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(9)))
+	mock.ExpectQuery(`SELECT min_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	mock.ExpectQuery(`WHERE version > \$1 AND NOT \(form_type = ANY\(\$2\)\) ORDER BY version ASC, observation_id ASC LIMIT \$3`).
+		WithArgs(int64(0), pq.Array([]string{"payments", "salaries"}), 11).
+		WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := service.GetRecordsSinceVersion(userContext(models.RoleReadWrite), 0, "client-1", nil, 10, nil); err != nil {
+		t.Fatalf("GetRecordsSinceVersion: %v", err)
+	}
+
+	// Pushes of form types not granted to the user fail
+	now := time.Now().UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "salaries", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "household", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(10)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-2", "household", "1.0", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, "client-1", int64(10), "someone", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(userContext(models.RoleReadWrite), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 1 {
+		t.Fatalf("Expected the salaries record to fail, got %+v", result)
+	}
+	if message := result.FailedRecords[0]["error"].(string); !strings.Contains(message, "form type salaries isn't granted") {
+		t.Errorf("Unexpected failure %q", message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
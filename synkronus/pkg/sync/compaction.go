@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CompactionConfig contains tombstone compaction configuration
+type CompactionConfig struct {
+	// Interval is how often compaction runs; 0 disables the schedule
+	Interval time.Duration
+	// Retention is how long deleted observations are kept as tombstones, so clients
+	// pulling within it learn of the delete; 0 keeps them forever
+	Retention time.Duration
+	// BatchSize caps the tombstones purged per statement so compaction never holds long locks
+	BatchSize int
+}
+
+// DefaultCompactionConfig returns a default configuration, which keeps tombstones forever
+func DefaultCompactionConfig() CompactionConfig {
+	return CompactionConfig{
+		Interval:  time.Hour,
+		BatchSize: 5000,
+	}
+}
+
+// CompactionResult summarizes a compaction run
+type CompactionResult struct {
+	Purged int64 `json:"purged"` // Tombstones removed
+	// MinVersion is the purge horizon: clients that last pulled an older version have to
+	// resync from scratch
+	MinVersion int64 `json:"min_version"`
+}
+
+// CompactionService purges old tombstones so deleted observations don't accumulate forever
+type CompactionService interface {
+	// Compact purges tombstones older than the retention window and raises the purge horizon
+	Compact(ctx context.Context) (*CompactionResult, error)
+
+	// Start compacts on the configured schedule until ctx is cancelled
+	Start(ctx context.Context)
+}
+
+type compactionService struct {
+	db     *sql.DB
+	config CompactionConfig
+	log    *logger.Logger
+}
+
+// NewCompactionService creates a new tombstone compaction service
+func NewCompactionService(db *sql.DB, config CompactionConfig, log *logger.Logger) CompactionService {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultCompactionConfig().BatchSize
+	}
+	return &compactionService{
+		db:     db,
+		config: config,
+		log:    log,
+	}
+}
+
+// A batch of tombstones is purged and the horizon raised past them in one statement, so a
+// pull never sees the tombstones gone without the horizon that tells the client so.
+// Review locks and workflow rows of the purged observations go with them.
+const purgeTombstonesQuery = `WITH purged AS (
+	DELETE FROM observations WHERE observation_id IN (
+		SELECT observation_id FROM observations
+		WHERE deleted AND updated_at < $1
+		ORDER BY version
+		LIMIT $2)
+	RETURNING version)
+UPDATE sync_version SET min_version = GREATEST(min_version, (SELECT COALESCE(MAX(version), 0) FROM purged))
+WHERE id = 1
+RETURNING min_version, (SELECT COUNT(*) FROM purged)`
+
+// Start compacts on the configured schedule until ctx is cancelled
+func (s *compactionService) Start(ctx context.Context) {
+	if s.config.Interval <= 0 || s.config.Retention <= 0 {
+		s.log.Info("Tombstone compaction schedule disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Compact(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error("Failed to compact tombstones", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Compact purges tombstones older than the retention window and raises the purge horizon
+func (s *compactionService) Compact(ctx context.Context) (result *CompactionResult, err error) {
+	ctx, span := tracing.Start(ctx, "sync.CompactTombstones")
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	result = &CompactionResult{}
+	if s.config.Retention <= 0 {
+		return result, nil
+	}
+
+	start := time.Now()
+	cutoff := start.Add(-s.config.Retention)
+	for {
+		var purged int64
+		if err := s.db.QueryRowContext(ctx, purgeTombstonesQuery, cutoff, s.config.BatchSize).Scan(&result.MinVersion, &purged); err != nil {
+			return nil, fmt.Errorf("failed to purge tombstones: %w", err)
+		}
+		result.Purged += purged
+		if purged < int64(s.config.BatchSize) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	span.SetAttributes(
+		attribute.Int64("sync.compaction.purged", result.Purged),
+		attribute.Int64("sync.compaction.min_version", result.MinVersion),
+	)
+
+	s.log.Info("Compacted tombstones",
+		"purged", result.Purged,
+		"minVersion", result.MinVersion,
+		"retention", s.config.Retention,
+		"duration", time.Since(start))
+
+	return result, nil
+}
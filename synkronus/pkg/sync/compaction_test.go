@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestCompactionService_Compact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewCompactionService(db, CompactionConfig{Retention: 24 * time.Hour, BatchSize: 2}, logger.NewLogger())
+
+	// Full batches are repeated until one comes back short
+	mock.ExpectQuery(`WITH purged AS \(\s*DELETE FROM observations .* WHERE deleted AND updated_at < \$1 .* UPDATE sync_version SET min_version`).
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version", "count"}).AddRow(int64(40), int64(2)))
+	mock.ExpectQuery(`WITH purged AS`).
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version", "count"}).AddRow(int64(42), int64(1)))
+
+	result, err := svc.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Purged != 3 || result.MinVersion != 42 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCompactionService_CompactWithoutRetention(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	// Tombstones are kept forever by default, so nothing is queried
+	result, err := NewCompactionService(db, DefaultCompactionConfig(), logger.NewLogger()).Compact(context.Background())
+	if err != nil || result.Purged != 0 {
+		t.Fatalf("Expected nothing purged, got %+v, %v", result, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestService_GetRecordsSinceVersionResyncRequired checks that clients that last pulled
+// before the purge horizon are told to resync
+func TestService_GetRecordsSinceVersionResyncRequired(t *testing.T) {
+	store := newMemoryStore()
+	store.version, store.minVersion = 20, 12
+	store.observations["obs-1"] = Observation{ObservationID: "obs-1", FormType: "survey", Data: json.RawMessage(`{}`), Version: 15}
+	config := DefaultConfig()
+	config.Access = fakeAccess{}
+	service := NewServiceWithStore(store, config, logger.NewLogger())
+	ctx := userContext(models.RoleReadWrite)
+
+	for _, tt := range []struct {
+		sinceVersion int64
+		resync       bool
+	}{
+		{0, false},
+		{10, true},
+		{12, false},
+	} {
+		result, err := service.GetRecordsSinceVersion(ctx, tt.sinceVersion, "client-1", nil, 10, nil)
+		if err != nil {
+			t.Fatalf("GetRecordsSinceVersion: %v", err)
+		}
+		if result.MinVersion != 12 || result.ResyncRequired != tt.resync {
+			t.Errorf("Since version %d: expected min_version 12 and resync_required %v, got %+v", tt.sinceVersion, tt.resync, result)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides what happens to a pushed record that conflicts with the stored
+// observation, i.e. one that was changed since the version the client last pulled
+type ConflictPolicy string
+
+const (
+	// ConflictClientWins stores every pushed record, as if there were no conflicts
+	ConflictClientWins ConflictPolicy = "client_wins"
+	// ConflictServerWins keeps the stored observation and skips the pushed record
+	ConflictServerWins ConflictPolicy = "server_wins"
+	// ConflictLastWriteWins keeps whichever of the two has the later updated_at
+	ConflictLastWriteWins ConflictPolicy = "last_write_wins"
+	// ConflictReject fails the pushed record with the CONFLICT code
+	ConflictReject ConflictPolicy = "reject"
+)
+
+// Resolutions of a conflict
+const (
+	// ResolutionApplied marks a pushed record stored over the newer stored change
+	ResolutionApplied = "applied"
+	// ResolutionSkipped marks a pushed record that wasn't stored; the client gets the
+	// stored observation with its next pull
+	ResolutionSkipped = "skipped"
+	// ResolutionRejected marks a pushed record that failed; its error is in failed_records
+	ResolutionRejected = "rejected"
+)
+
+// FailureConflict is the code of failed records that conflict with the stored
+// observation under the reject policy
+const FailureConflict = "CONFLICT"
+
+// SyncConflict describes a pushed record that conflicted with the stored observation and
+// how it was resolved
+type SyncConflict struct {
+	Index         int    `json:"index"`
+	ObservationID string `json:"observation_id"`
+	Resolution    string `json:"resolution"`
+	// ClientVersion is the version the client last pulled, ServerVersion the stored one
+	ClientVersion int64 `json:"client_version"`
+	ServerVersion int64 `json:"server_version"`
+	// ClientUpdatedAt and ServerUpdatedAt are the updated_at of the pushed record and of
+	// the stored observation's last push, in RFC3339; empty when unknown
+	ClientUpdatedAt string `json:"client_updated_at,omitempty"`
+	ServerUpdatedAt string `json:"server_updated_at,omitempty"`
+}
+
+// ParseConflictPolicy parses a conflict policy name; empty yields ConflictClientWins
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return ConflictClientWins, nil
+	case ConflictClientWins, ConflictServerWins, ConflictLastWriteWins, ConflictReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q: expected client_wins, server_wins, last_write_wins or reject", name)
+	}
+}
+
+// resolveConflict checks a pushed record against the last stored change and returns the conflict,
+// or nil when there is none. A record conflicts when the stored observation has a later
+// version than the client pulled, unless it is the same change pushed again, e.g. after a
+// lost response.
+func resolveConflict(policy ConflictPolicy, index int, record Observation, updatedAt *time.Time, stored StoredChange) *SyncConflict {
+	if stored.Version <= record.Version {
+		return nil
+	}
+	// The updated_at the client sent with the stored observation, or the server time of
+	// the change when it sent none
+	storedAt := stored.UpdatedAt
+	if stored.ClientUpdatedAt != nil {
+		storedAt = *stored.ClientUpdatedAt
+	}
+	if updatedAt != nil && updatedAt.Equal(storedAt) {
+		return nil
+	}
+
+	conflict := &SyncConflict{
+		Index:           index,
+		ObservationID:   record.ObservationID,
+		ClientVersion:   record.Version,
+		ServerVersion:   stored.Version,
+		ServerUpdatedAt: storedAt.UTC().Format(time.RFC3339),
+	}
+	if updatedAt != nil {
+		conflict.ClientUpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	}
+
+	switch policy {
+	case ConflictServerWins:
+		conflict.Resolution = ResolutionSkipped
+	case ConflictLastWriteWins:
+		// A record without updated_at can't be shown to be newer
+		if updatedAt != nil && updatedAt.After(storedAt) {
+			conflict.Resolution = ResolutionApplied
+		} else {
+			conflict.Resolution = ResolutionSkipped
+		}
+	case ConflictReject:
+		conflict.Resolution = ResolutionRejected
+	default:
+		conflict.Resolution = ResolutionApplied
+	}
+	return conflict
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for name, want := range map[string]ConflictPolicy{
+		"":                  ConflictClientWins,
+		"server_wins":       ConflictServerWins,
+		" Last_Write_Wins ": ConflictLastWriteWins,
+		"reject":            ConflictReject,
+	} {
+		got, err := ParseConflictPolicy(name)
+		if err != nil || got != want {
+			t.Errorf("ParseConflictPolicy(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Error("Expected an unknown policy to fail")
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	stored := time.Date(2025, 9, 14, 10, 0, 0, 0, time.UTC)
+	earlier, later := stored.Add(-time.Hour), stored.Add(time.Hour)
+	change := StoredChange{Version: 7, ClientUpdatedAt: &stored}
+
+	tests := []struct {
+		name       string
+		policy     ConflictPolicy
+		version    int64
+		updatedAt  *time.Time
+		resolution string
+	}{
+		{"pulled the stored version", ConflictReject, 7, &earlier, ""},
+		{"same change pushed again", ConflictReject, 0, &stored, ""},
+		{"client wins", ConflictClientWins, 5, &earlier, ResolutionApplied},
+		{"server wins", ConflictServerWins, 5, &later, ResolutionSkipped},
+		{"later write wins", ConflictLastWriteWins, 5, &later, ResolutionApplied},
+		{"earlier write loses", ConflictLastWriteWins, 5, &earlier, ResolutionSkipped},
+		{"write without updated_at loses", ConflictLastWriteWins, 5, nil, ResolutionSkipped},
+		{"reject", ConflictReject, 0, &later, ResolutionRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := Observation{ObservationID: "obs-1", Version: tt.version}
+			conflict := resolveConflict(tt.policy, 3, record, tt.updatedAt, change)
+			if tt.resolution == "" {
+				if conflict != nil {
+					t.Fatalf("Expected no conflict, got %+v", conflict)
+				}
+				return
+			}
+			if conflict == nil || conflict.Resolution != tt.resolution {
+				t.Fatalf("Expected resolution %q, got %+v", tt.resolution, conflict)
+			}
+			if conflict.Index != 3 || conflict.ClientVersion != tt.version || conflict.ServerVersion != 7 || conflict.ServerUpdatedAt != "2025-09-14T10:00:00Z" {
+				t.Errorf("Unexpected conflict %+v", conflict)
+			}
+		})
+	}
+}
+
+// TestService_ProcessPushedRecordsConflicts pushes records changed on the server since
+// the client pulled them under each policy
+func TestService_ProcessPushedRecordsConflicts(t *testing.T) {
+	stored := time.Date(2025, 9, 14, 10, 0, 0, 0, time.UTC)
+	seed := func() *memoryStore {
+		store := newMemoryStore()
+		store.version = 10
+		for _, id := range []string{"obs-1", "obs-2"} {
+			store.observations[id] = Observation{ObservationID: id, FormType: "survey", Data: json.RawMessage(`{"v":"server"}`),
+				CreatedAt: stored.Format(time.RFC3339), UpdatedAt: stored.Format(time.RFC3339), Version: 10}
+		}
+		return store
+	}
+	records := []Observation{
+		// Changed after the server's change
+		{ObservationID: "obs-1", FormType: "survey", Data: json.RawMessage(`{"v":"client"}`), Version: 4,
+			CreatedAt: stored.Format(time.RFC3339), UpdatedAt: stored.Add(time.Hour).Format(time.RFC3339)},
+		// Changed before the server's change
+		{ObservationID: "obs-2", FormType: "survey", Data: json.RawMessage(`{"v":"client"}`), Version: 4,
+			CreatedAt: stored.Format(time.RFC3339), UpdatedAt: stored.Add(-time.Hour).Format(time.RFC3339)},
+		// New
+		{ObservationID: "obs-3", FormType: "survey", Data: json.RawMessage(`{"v":"client"}`),
+			CreatedAt: stored.Format(time.RFC3339), UpdatedAt: stored.Format(time.RFC3339)},
+	}
+
+	tests := []struct {
+		policy      ConflictPolicy
+		resolutions []string
+		successes   int
+		failed      int
+		clientData  map[string]bool
+	}{
+		{ConflictClientWins, nil, 3, 0, map[string]bool{"obs-1": true, "obs-2": true}},
+		{ConflictServerWins, []string{ResolutionSkipped, ResolutionSkipped}, 1, 0, map[string]bool{}},
+		{ConflictLastWriteWins, []string{ResolutionApplied, ResolutionSkipped}, 2, 0, map[string]bool{"obs-1": true}},
+		{ConflictReject, []string{ResolutionRejected, ResolutionRejected}, 1, 2, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			store := seed()
+			config := DefaultConfig()
+			config.Access = fakeAccess{}
+			config.ClockSkewTolerance = 0
+			config.ConflictPolicy = tt.policy
+			service := NewServiceWithStore(store, config, logger.NewLogger())
+
+			result, err := service.ProcessPushedRecords(userContext(models.RoleReadWrite), records, "client-1", "tx-1")
+			if err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			if result.SuccessCount != tt.successes || len(result.FailedRecords) != tt.failed {
+				t.Fatalf("Expected %d stored and %d failed records, got %+v", tt.successes, tt.failed, result)
+			}
+			if len(result.Conflicts) != len(tt.resolutions) {
+				t.Fatalf("Expected %d conflicts, got %+v", len(tt.resolutions), result.Conflicts)
+			}
+			for i, conflict := range result.Conflicts {
+				if conflict.Index != i || conflict.Resolution != tt.resolutions[i] || conflict.ServerVersion != 10 {
+					t.Errorf("Unexpected conflict %+v", conflict)
+				}
+			}
+			for _, failed := range result.FailedRecords {
+				if failed["code"] != FailureConflict {
+					t.Errorf("Expected failed records with the CONFLICT code, got %+v", failed)
+				}
+			}
+			for _, id := range []string{"obs-1", "obs-2"} {
+				if client := string(store.observations[id].Data) == `{"v":"client"}`; client != tt.clientData[id] {
+					t.Errorf("Expected %s to hold the client's data: %v, got %s", id, tt.clientData[id], store.observations[id].Data)
+				}
+			}
+			if _, ok := store.observations["obs-3"]; !ok {
+				t.Error("Expected the new record to be stored")
+			}
+		})
+	}
+}
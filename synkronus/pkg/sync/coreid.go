@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// coreIDKey limits the pulls of a context to the observations of one core ID
+type coreIDKey struct{}
+
+// WithCoreID returns a context in which pulls only return observations whose data has
+// core_id set to coreID, so a device can sync the records of one case across form types
+func WithCoreID(ctx context.Context, coreID string) context.Context {
+	return context.WithValue(ctx, coreIDKey{}, coreID)
+}
+
+// CoreIDOf returns the core ID pulls in ctx are limited to; empty for all observations
+func CoreIDOf(ctx context.Context) string {
+	coreID, _ := ctx.Value(coreIDKey{}).(string)
+	return coreID
+}
+
+// CoreID returns the core_id in the observation's data, as the observations table
+// computes it; empty when the data has none
+func (o Observation) CoreID() string {
+	var data struct {
+		CoreID json.RawMessage `json:"core_id"`
+	}
+	if err := json.Unmarshal(o.Data, &data); err != nil || len(data.CoreID) == 0 || string(data.CoreID) == "null" {
+		return ""
+	}
+	var coreID string
+	if err := json.Unmarshal(data.CoreID, &coreID); err == nil {
+		return coreID
+	}
+	// Postgres' ->> renders other JSON values as their text
+	return string(data.CoreID)
+}
+
+// CoreIDQuery selects the observations of a participant or household
+type CoreIDQuery struct {
+	CoreID string
+	// FormType limits the result to one form type; empty for all
+	FormType string
+	// IncludeDeleted adds deleted observations to the result
+	IncludeDeleted bool
+	// ExcludedFormTypes leaves out form types the caller may not see
+	ExcludedFormTypes []string
+	Limit             int
+	// Offset skips that many observations of the result
+	Offset int
+}
+
+// CoreIDPage is one page of the observations of a core ID
+type CoreIDPage struct {
+	Observations []Observation
+	HasMore      bool
+}
+
+// ListByCoreID lists the observations of a core ID across form types, oldest first
+func (s *Service) ListByCoreID(ctx context.Context, query CoreIDQuery) (_ *CoreIDPage, err error) {
+	ctx, span := tracing.Start(ctx, "sync.ListByCoreID",
+		attribute.String("sync.form_type", query.FormType),
+		attribute.Int("sync.limit", query.Limit),
+		attribute.Int("sync.offset", query.Offset),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if query.CoreID == "" {
+		return nil, fmt.Errorf("core_id is required")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = s.config.DefaultLimit
+	}
+	if limit > s.config.MaxRecordsPerSync {
+		limit = s.config.MaxRecordsPerSync
+	}
+
+	// Leave out form types the user's role may not see or isn't granted
+	if query.ExcludedFormTypes, err = s.excludedFormTypes(ctx); err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether there is another page
+	observations, err := s.store.Observations().ByCoreID(ctx, query, limit+1)
+	if err != nil {
+		s.log.Error("Failed to query observations by core ID", "error", err)
+		return nil, err
+	}
+
+	page := &CoreIDPage{Observations: observations}
+	if len(page.Observations) > limit {
+		page.Observations = page.Observations[:limit]
+		page.HasMore = true
+	}
+	span.SetAttributes(attribute.Int("sync.record_count", len(page.Observations)))
+	return page, nil
+}
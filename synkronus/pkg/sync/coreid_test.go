@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestObservation_CoreID(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"core_id": "HH-0042", "name": "Ann"}`, "HH-0042"},
+		{`{"core_id": 42}`, "42"},
+		{`{"core_id": null}`, ""},
+		{`{"name": "Ann"}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := (Observation{Data: json.RawMessage(tt.data)}).CoreID(); got != tt.want {
+			t.Errorf("CoreID of %s = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestService_ListByCoreID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	created := time.Date(2025, 9, 14, 9, 30, 0, 0, time.UTC)
+	columns := []string{"observation_id", "form_type", "form_version", "data", "created_at", "updated_at", "synced_at", "deleted", "version"}
+
+	mock.ExpectQuery(`FROM observations\s+WHERE core_id = \$1 AND NOT deleted AND form_type = \$2\s+ORDER BY created_at ASC, observation_id ASC\s+LIMIT \$3 OFFSET \$4`).
+		WithArgs("HH-0042", "visit", 3, 4).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("obs-1", "visit", "1.0", []byte(`{"core_id":"HH-0042"}`), created, created, nil, false, int64(3)).
+			AddRow("obs-2", "visit", "1.0", []byte(`{"core_id":"HH-0042"}`), created, created, nil, false, int64(5)).
+			AddRow("obs-3", "visit", "1.0", []byte(`{"core_id":"HH-0042"}`), created, created, nil, false, int64(8)))
+
+	page, err := service.ListByCoreID(context.Background(), CoreIDQuery{CoreID: "HH-0042", FormType: "visit", Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatalf("ListByCoreID: %v", err)
+	}
+	if len(page.Observations) != 2 || !page.HasMore || page.Observations[1].ObservationID != "obs-2" {
+		t.Fatalf("Expected 2 observations and another page, got %+v", page)
+	}
+
+	mock.ExpectQuery(`WHERE core_id = \$1\s+ORDER BY`).
+		WithArgs("HH-0042", 101, 0).
+		WillReturnRows(sqlmock.NewRows(columns))
+	page, err = service.ListByCoreID(context.Background(), CoreIDQuery{CoreID: "HH-0042", IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("ListByCoreID: %v", err)
+	}
+	if len(page.Observations) != 0 || page.HasMore {
+		t.Errorf("Expected no observations, got %+v", page)
+	}
+
+	if _, err := service.ListByCoreID(context.Background(), CoreIDQuery{}); err == nil {
+		t.Error("Expected an error without a core ID")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_GetRecordsSinceVersionByCoreID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	mock.ExpectQuery(`SELECT current_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(9)))
+	mock.ExpectQuery(`SELECT min_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	mock.ExpectQuery(`WHERE version > \$1 AND core_id = \$2 ORDER BY version ASC, observation_id ASC LIMIT \$3`).
+		WithArgs(int64(0), "HH-0042", 11).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "form_type", "form_version", "data", "created_at", "updated_at", "synced_at", "deleted", "version"}))
+
+	ctx := WithCoreID(context.Background(), "HH-0042")
+	if _, err := service.GetRecordsSinceVersion(ctx, 0, "client-1", nil, 10, nil); err != nil {
+		t.Fatalf("GetRecordsSinceVersion: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	gosync "sync"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// FailureInvalidData is the code of failed records whose data doesn't match their form's
+// schema; the failed record lists the problems in errors
+const FailureInvalidData = "INVALID_DATA"
+
+// DataValidator validates pushed observation data against form schemas
+type DataValidator interface {
+	// Validate returns the problems of data against the schema of a form type and version;
+	// none when it matches or there is no schema to check it against
+	Validate(ctx context.Context, formType, formVersion string, data json.RawMessage) ([]string, error)
+}
+
+// SchemaBundle is the part of the app bundle service form schemas are read from
+type SchemaBundle interface {
+	GetManifest(ctx context.Context) (*appbundle.Manifest, error)
+	GetVersionFile(ctx context.Context, version, path string) (io.ReadCloser, *appbundle.File, error)
+}
+
+// formSchema is a parsed schema.json with the form version it declares
+type formSchema struct {
+	version string
+	schema  map[string]any
+}
+
+// schemaKey identifies the schema of a form type in a bundle version
+type schemaKey struct {
+	bundleVersion string
+	formType      string
+}
+
+type schemaValidator struct {
+	bundle SchemaBundle
+	log    *logger.Logger
+
+	mu gosync.Mutex
+	// cache holds the schemas of the active bundle version's forms, nil for an invalid
+	// one; it is dropped when another version becomes active
+	cache         map[schemaKey]*formSchema
+	bundleVersion string
+}
+
+// NewSchemaValidator creates a validator that checks data against the schema.json of the
+// form in the active app bundle. Schemas are read once per bundle version.
+func NewSchemaValidator(bundle SchemaBundle, log *logger.Logger) DataValidator {
+	return &schemaValidator{
+		bundle: bundle,
+		log:    log,
+		cache:  make(map[schemaKey]*formSchema),
+	}
+}
+
+func (v *schemaValidator) Validate(ctx context.Context, formType, formVersion string, data json.RawMessage) ([]string, error) {
+	manifest, err := v.bundle.GetManifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app bundle manifest: %w", err)
+	}
+	if manifest.Version == "" || formType == "" {
+		return nil, nil
+	}
+	form, err := v.schema(ctx, manifest, formType)
+	if err != nil {
+		return nil, err
+	}
+	// Data of another form version can't be checked against this schema; migrations
+	// bring it up to date
+	if form == nil || (form.version != "" && formVersion != "" && form.version != formVersion) {
+		return nil, nil
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []string{fmt.Sprintf("data is not valid JSON: %v", err)}, nil
+	}
+	var problems []string
+	for _, violation := range appbundle.CheckSchema(form.schema, doc) {
+		pointer := violation.Pointer
+		if pointer == "" {
+			pointer = "data"
+		}
+		problems = append(problems, pointer+": "+violation.Message)
+	}
+	return problems, nil
+}
+
+// schema returns the parsed schema of a form type in the manifest's bundle version; nil
+// when the form has none. Only forms of the manifest are cached, so pushes of made-up form
+// types don't grow the cache.
+func (v *schemaValidator) schema(ctx context.Context, manifest *appbundle.Manifest, formType string) (*formSchema, error) {
+	path := schemaPath(manifest, formType)
+	if path == "" {
+		return nil, nil
+	}
+
+	key := schemaKey{bundleVersion: manifest.Version, formType: formType}
+	v.mu.Lock()
+	if v.bundleVersion != manifest.Version {
+		v.cache = make(map[schemaKey]*formSchema)
+		v.bundleVersion = manifest.Version
+	}
+	form, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok {
+		return form, nil
+	}
+
+	form, err := v.readSchema(ctx, manifest, formType, path)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	if v.bundleVersion == manifest.Version {
+		v.cache[key] = form
+	}
+	v.mu.Unlock()
+	return form, nil
+}
+
+// schemaPath returns the path of the schema.json of a form type in the manifest, or ""
+// when the form has none
+func schemaPath(manifest *appbundle.Manifest, formType string) string {
+	for _, candidate := range formschema.BundlePaths(formType, formschema.SchemaFile) {
+		for _, file := range manifest.Files {
+			if file.Path == candidate {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// readSchema reads the schema.json of a form type at path in the manifest's bundle version
+func (v *schemaValidator) readSchema(ctx context.Context, manifest *appbundle.Manifest, formType, path string) (*formSchema, error) {
+	file, _, err := v.bundle.GetVersionFile(ctx, manifest.Version, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema of %s: %w", formType, err)
+	}
+	defer file.Close()
+	var schema map[string]any
+	if err := json.NewDecoder(file).Decode(&schema); err != nil {
+		// Bundle pushes validate schemas, so this is a bundle from before that; its data
+		// is stored unchecked
+		v.log.Warn("Not validating data of form with an invalid schema", "formType", formType, "bundleVersion", manifest.Version, "error", err)
+		return nil, nil
+	}
+	return &formSchema{version: appbundle.SchemaVersion(schema), schema: schema}, nil
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+const householdSchema = `{
+	"version": "2",
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"members": {"type": "array", "minItems": 1},
+		"age": {"type": "number", "minimum": 0}
+	}
+}`
+
+// fakeBundle serves schemas from memory and counts the files read
+type fakeBundle struct {
+	version string
+	files   map[string]string
+	reads   int
+}
+
+func (b *fakeBundle) GetManifest(ctx context.Context) (*appbundle.Manifest, error) {
+	manifest := &appbundle.Manifest{Version: b.version}
+	for path := range b.files {
+		manifest.Files = append(manifest.Files, appbundle.File{Path: path})
+	}
+	return manifest, nil
+}
+
+func (b *fakeBundle) GetVersionFile(ctx context.Context, version, path string) (io.ReadCloser, *appbundle.File, error) {
+	content, ok := b.files[path]
+	if !ok {
+		return nil, nil, os.ErrNotExist
+	}
+	b.reads++
+	return io.NopCloser(strings.NewReader(content)), &appbundle.File{Path: path}, nil
+}
+
+func TestSchemaValidator(t *testing.T) {
+	bundle := &fakeBundle{version: "1", files: map[string]string{"forms/household/schema.json": householdSchema}}
+	validator := NewSchemaValidator(bundle, logger.NewLogger())
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		formType    string
+		formVersion string
+		data        string
+		problems    []string
+	}{
+		{"valid", "household", "2", `{"name":"Doe","members":[{}],"age":4}`, nil},
+		{"invalid", "household", "2", `{"members":[],"age":-3}`, []string{`data: missing "name"`, "/age: -3 is less than 0", "/members: has 0 items, expected at least 1"}},
+		{"other form version", "household", "1", `{"age":-3}`, nil},
+		{"form without a schema", "visit", "1", `{"age":-3}`, nil},
+		{"form type leaving the forms directory", "../forms/household", "2", `{"age":-3}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := validator.Validate(ctx, tt.formType, tt.formVersion, json.RawMessage(tt.data))
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if strings.Join(problems, "|") != strings.Join(tt.problems, "|") {
+				t.Errorf("Expected problems %q, got %q", tt.problems, problems)
+			}
+		})
+	}
+	if bundle.reads != 1 {
+		t.Errorf("Expected the schema to be read once, got %d reads", bundle.reads)
+	}
+	// Only forms of the bundle are cached, whatever form types clients push
+	if cached := len(validator.(*schemaValidator).cache); cached != 1 {
+		t.Errorf("Expected only household to be cached, got %d entries", cached)
+	}
+
+	// A new bundle version is read again
+	bundle.version = "2"
+	bundle.files["forms/household/schema.json"] = `{"version": "2", "type": "object", "required": ["name", "village"]}`
+	problems, err := validator.Validate(ctx, "household", "2", json.RawMessage(`{"name":"Doe"}`))
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0] != `data: missing "village"` {
+		t.Errorf("Expected the new schema's problems, got %q", problems)
+	}
+	if bundle.reads != 2 {
+		t.Errorf("Expected the new version's schema to be read, got %d reads", bundle.reads)
+	}
+}
+
+func TestService_ProcessPushedRecordsInvalidData(t *testing.T) {
+	store := newMemoryStore()
+	config := DefaultConfig()
+	config.Access = fakeAccess{}
+	config.Validator = NewSchemaValidator(&fakeBundle{version: "1", files: map[string]string{"forms/household/schema.json": householdSchema}}, logger.NewLogger())
+	service := NewServiceWithStore(store, config, logger.NewLogger())
+
+	now := "2025-09-20T10:00:00Z"
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "household", FormVersion: "2", Data: json.RawMessage(`{"name":"Doe"}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "household", FormVersion: "2", Data: json.RawMessage(`{"name":""}`), CreatedAt: now},
+	}
+	result, err := service.ProcessPushedRecords(userContext(models.RoleReadWrite), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 1 {
+		t.Fatalf("Expected one stored and one failed record, got %+v", result)
+	}
+	failed := result.FailedRecords[0]
+	if failed["index"] != 1 || failed["code"] != FailureInvalidData {
+		t.Errorf("Unexpected failed record %+v", failed)
+	}
+	if problems, _ := failed["errors"].([]string); len(problems) != 1 || problems[0] != "/name: must not be empty" {
+		t.Errorf("Unexpected problems %+v", failed["errors"])
+	}
+	if _, ok := store.observations["obs-2"]; ok {
+		t.Error("Expected the invalid record not to be stored")
+	}
+}
@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"context"
+	"sort"
+)
+
+// Outcomes of a record in a dry-run push
+const (
+	// OutcomeCreate marks a record that would be stored as a new observation
+	OutcomeCreate = "create"
+	// OutcomeUpdate marks a record that would replace a stored observation
+	OutcomeUpdate = "update"
+	// OutcomeSkipped marks a record that conflicts with the stored observation and would
+	// be skipped; the conflict is in conflicts
+	OutcomeSkipped = "skipped"
+	// OutcomeFailed marks a record that would fail; its error is in failed_records
+	OutcomeFailed = "failed"
+)
+
+// RecordOutcome is what a push would do with one record
+type RecordOutcome struct {
+	Index         int    `json:"index"`
+	ObservationID string `json:"observation_id"`
+	Outcome       string `json:"outcome"`
+}
+
+// dryRunKey marks a context whose pushes are checked without storing anything
+type dryRunKey struct{}
+
+// WithDryRun returns a context in which ProcessPushedRecords runs every check and the
+// writes of a push, then rolls them back, so clients can find problems with a large
+// upload before sending it for real
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether pushes in ctx are dry runs
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// failedOutcomes adds the outcomes of the failed records and sorts them by index
+func failedOutcomes(outcomes []RecordOutcome, failedRecords []map[string]interface{}) []RecordOutcome {
+	for _, failed := range failedRecords {
+		outcome := RecordOutcome{Outcome: OutcomeFailed}
+		outcome.Index, _ = failed["index"].(int)
+		if record, ok := failed["record"].(Observation); ok {
+			outcome.ObservationID = record.ObservationID
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Index < outcomes[j].Index })
+	return outcomes
+}
@@ -4,6 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/database"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/requiredattachment"
+	"github.com/opendataensemble/synkronus/pkg/strictschema"
 )
 
 // Common errors
@@ -54,6 +62,11 @@ type SyncResult struct {
 	Records        []Observation `json:"records"`
 	ChangeCutoff   int64         `json:"change_cutoff"`
 	HasMore        bool          `json:"has_more"`
+	// MinVersion is the purge horizon: tombstones up to it were purged by compaction
+	MinVersion int64 `json:"min_version"`
+	// ResyncRequired is set when the client pulled since a version older than MinVersion,
+	// so it missed purged deletes and has to pull again from version 0
+	ResyncRequired bool `json:"resync_required,omitempty"`
 }
 
 // SyncPushResult represents the result of a sync push operation
@@ -62,13 +75,49 @@ type SyncPushResult struct {
 	SuccessCount   int                      `json:"success_count"`
 	FailedRecords  []map[string]interface{} `json:"failed_records,omitempty"`
 	Warnings       []SyncWarning            `json:"warnings,omitempty"`
+	// DryRun is set when nothing was stored; Outcomes then tells what the push would do
+	// with each record
+	DryRun   bool            `json:"dry_run,omitempty"`
+	Outcomes []RecordOutcome `json:"outcomes,omitempty"`
+	// Conflicts lists the records changed on the server since the client pulled them and
+	// how the conflict policy resolved them
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
 }
 
-// SyncWarning represents a warning during sync operations
+// Warning codes of a sync push
+const (
+	// WarningMissingFormType flags a record pushed without form_type
+	WarningMissingFormType = "MISSING_FORM_TYPE"
+	// WarningCalculationMismatch flags a calculated field whose submitted value was
+	// replaced by the value computed by the server
+	WarningCalculationMismatch = "CALCULATION_MISMATCH"
+	// WarningClockSkew flags a record whose updated_at is ahead of the server clock
+	WarningClockSkew = "CLOCK_SKEW"
+	// WarningClockAnomaly flags an edit dated before the stored observation it replaces,
+	// although the device had pulled that one
+	WarningClockAnomaly = "CLOCK_ANOMALY"
+	// WarningTimestampNormalized flags a record whose timestamps were not RFC3339 and
+	// were converted
+	WarningTimestampNormalized = "TIMESTAMP_NORMALIZED"
+	// WarningUnknownKeysStripped flags a record whose data had keys its strict form
+	// schema doesn't declare, which were removed
+	WarningUnknownKeysStripped = "UNKNOWN_KEYS_STRIPPED"
+	// WarningAttachmentMissing flags a record without an attachment in a field its form
+	// schema tags x-attachment-required
+	WarningAttachmentMissing = "ATTACHMENT_MISSING"
+	// WarningAttachmentPending flags a record referring to a required attachment that
+	// hasn't been uploaded yet
+	WarningAttachmentPending = "ATTACHMENT_PENDING"
+)
+
+// SyncWarning represents a warning during sync operations. Warnings of a push are
+// recorded per client; WarningID identifies the recorded warning for acknowledgement.
 type SyncWarning struct {
-	ID      string `json:"id"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	ID        string `json:"id"`
+	WarningID int64  `json:"warning_id,omitempty"`
+	Code      string `json:"code"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
 }
 
 // SyncItem represents an item to be synchronized
@@ -87,6 +136,18 @@ type ServiceInterface interface {
 
 	// Initialize initializes the sync service
 	Initialize(ctx context.Context) error
+
+	// AcknowledgeWarnings marks recorded warnings of a client as acknowledged
+	AcknowledgeWarnings(ctx context.Context, clientID string, ack WarningAck) (int64, error)
+
+	// GetWarningSummary counts the recorded warnings per client and code
+	GetWarningSummary(ctx context.Context, query WarningQuery) ([]WarningSummary, error)
+
+	// ListSubmissions lists the observations a user submitted with their status
+	ListSubmissions(ctx context.Context, query SubmissionQuery) (*SubmissionPage, error)
+
+	// ListByCoreID lists the observations of a participant or household across form types
+	ListByCoreID(ctx context.Context, query CoreIDQuery) (*CoreIDPage, error)
 }
 
 // Config contains sync service configuration
@@ -96,4 +157,89 @@ type Config struct {
 
 	// DefaultLimit is the default limit when none is specified
 	DefaultLimit int
+
+	// Calculator recomputes calculated fields of pushed observations; nil stores data as pushed
+	Calculator Calculator
+
+	// ClockSkewTolerance is how far a record's updated_at may be ahead of the server
+	// clock before FutureTimestampPolicy applies
+	ClockSkewTolerance time.Duration
+
+	// TimestampFormat decides which created_at/updated_at formats are accepted
+	TimestampFormat TimestampFormat
+
+	// FutureTimestampPolicy decides whether records ahead of the server clock are stored
+	// with a CLOCK_SKEW warning or fail
+	FutureTimestampPolicy FutureTimestampPolicy
+
+	// ConflictPolicy decides what happens to pushed records changed on the server since
+	// the client pulled them
+	ConflictPolicy ConflictPolicy
+
+	// Access restricts form types to users with the roles their schemas require; nil lets
+	// every user push and pull every form type
+	Access FormAccess
+
+	// Permissions restricts granted form types to the roles and users they are granted
+	// to; nil lets every user push and pull every form type
+	Permissions FormPermissions
+
+	// Schemas strips or rejects data keys that strict form schemas don't declare; nil
+	// stores data as pushed
+	Schemas SchemaChecker
+
+	// Validator fails pushed records whose data doesn't match their form's schema; nil
+	// stores data unchecked
+	Validator DataValidator
+
+	// Retry retries pulls and pushes failing with connection errors, e.g. during a primary
+	// failover; nil runs them once
+	Retry *database.Retrier
+
+	// Statements runs the pull and push queries as cached prepared statements; nil runs
+	// them unprepared
+	Statements *database.StatementCache
+
+	// Locks rejects pushes of observations other users hold review locks on; nil lets
+	// every push through
+	Locks ObservationLocks
+
+	// Attachments finds fields tagged x-attachment-required whose attachment is absent or
+	// not uploaded yet; nil doesn't check
+	Attachments AttachmentChecker
+}
+
+// FailureLocked is the code of failed records another user holds a review lock on. The
+// failed record carries the lock, so clients can tell who is reviewing it and until when.
+const FailureLocked = "LOCKED"
+
+// ObservationLocks tells which observations users other than username hold review locks on
+type ObservationLocks interface {
+	HeldByOthers(ctx context.Context, observationIDs []string, username string) (map[string]observationlock.Lock, error)
+}
+
+// AttachmentChecker finds the required attachments pushed data lacks
+type AttachmentChecker interface {
+	Check(ctx context.Context, formType string, data json.RawMessage) (*requiredattachment.Result, error)
+}
+
+// FormAccess tells which form types a role may not push or pull
+type FormAccess interface {
+	DeniedFormTypes(role models.Role) ([]string, error)
+}
+
+// FormPermissions tells which form types a user isn't granted
+type FormPermissions interface {
+	DeniedFormTypes(ctx context.Context, user *models.User) ([]string, error)
+}
+
+// SchemaChecker finds the data keys a form schema doesn't declare
+type SchemaChecker interface {
+	Check(formType string, data json.RawMessage) (*strictschema.Result, error)
+}
+
+// Calculator recomputes the x-calculated fields of an observation's data, returning
+// the server's values and the fields whose submitted value differed
+type Calculator interface {
+	Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []calculation.Mismatch, error)
 }
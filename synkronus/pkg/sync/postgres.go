@@ -0,0 +1,497 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/database"
+)
+
+// querier runs statements on the database or in a transaction
+type querier = database.Querier
+
+// postgresRepositories implements the repositories on a PostgreSQL database or transaction
+type postgresRepositories struct {
+	q querier
+}
+
+func (r postgresRepositories) Observations() ObservationRepo { return postgresObservations(r) }
+func (r postgresRepositories) Versions() VersionRepo         { return postgresVersions(r) }
+func (r postgresRepositories) Warnings() WarningRepo         { return postgresWarnings(r) }
+
+// postgresStore is a Store on a PostgreSQL database
+type postgresStore struct {
+	postgresRepositories
+	db *sql.DB
+	// stmts is nil when queries run unprepared
+	stmts *database.StatementCache
+}
+
+// NewPostgresStore returns a Store keeping sync data in a PostgreSQL database
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{postgresRepositories: postgresRepositories{q: db}, db: db}
+}
+
+// NewCachedPostgresStore returns a Store keeping sync data in a PostgreSQL database that
+// runs its queries, in and out of transactions, as prepared statements from stmts. The
+// pull query has a fixed text for every combination of filters, so it stays cached too.
+func NewCachedPostgresStore(db *sql.DB, stmts *database.StatementCache) Store {
+	return &postgresStore{postgresRepositories: postgresRepositories{q: stmts}, db: db, stmts: stmts}
+}
+
+// Begin implements Store
+func (s *postgresStore) Begin(ctx context.Context) (UnitOfWork, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	var q querier = tx
+	if s.stmts != nil {
+		q = s.stmts.Tx(tx)
+	}
+	return &postgresUnitOfWork{postgresRepositories: postgresRepositories{q: q}, tx: tx}, nil
+}
+
+// postgresUnitOfWork is a UnitOfWork on a PostgreSQL transaction
+type postgresUnitOfWork struct {
+	postgresRepositories
+	tx *sql.Tx
+}
+
+// Savepoint implements UnitOfWork
+func (u *postgresUnitOfWork) Savepoint(ctx context.Context) error {
+	if _, err := u.tx.ExecContext(ctx, "SAVEPOINT dry_run_record"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	return nil
+}
+
+// RollbackToSavepoint implements UnitOfWork
+func (u *postgresUnitOfWork) RollbackToSavepoint(ctx context.Context) error {
+	if _, err := u.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT dry_run_record"); err != nil {
+		return fmt.Errorf("failed to roll back to savepoint: %w", err)
+	}
+	return nil
+}
+
+// Commit implements UnitOfWork
+func (u *postgresUnitOfWork) Commit() error {
+	if err := u.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Rollback implements UnitOfWork
+func (u *postgresUnitOfWork) Rollback() error {
+	if err := u.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("failed to rollback transaction: %w", err)
+	}
+	return nil
+}
+
+// postgresObservations implements ObservationRepo
+type postgresObservations postgresRepositories
+
+// ChangedSince implements ObservationRepo
+func (r postgresObservations) ChangedSince(ctx context.Context, query PullQuery) ([]Observation, error) {
+	var queryBuilder strings.Builder
+	var args []interface{}
+	argIndex := 1
+
+	queryBuilder.WriteString(`
+		SELECT observation_id, form_type, form_version, data,
+		       created_at, updated_at, synced_at, deleted, version
+		FROM observations
+		WHERE version > $`)
+	queryBuilder.WriteString(strconv.Itoa(argIndex))
+	args = append(args, query.SinceVersion)
+	argIndex++
+
+	// Add schema type filter if specified
+	if len(query.FormTypes) > 0 {
+		queryBuilder.WriteString(" AND form_type = ANY($")
+		queryBuilder.WriteString(strconv.Itoa(argIndex))
+		queryBuilder.WriteString(")")
+		args = append(args, pq.Array(query.FormTypes))
+		argIndex++
+	}
+
+	if len(query.ExcludedFormTypes) > 0 {
+		queryBuilder.WriteString(" AND NOT (form_type = ANY($")
+		queryBuilder.WriteString(strconv.Itoa(argIndex))
+		queryBuilder.WriteString("))")
+		args = append(args, pq.Array(query.ExcludedFormTypes))
+		argIndex++
+	}
+
+	if query.CoreID != "" {
+		queryBuilder.WriteString(" AND core_id = $")
+		queryBuilder.WriteString(strconv.Itoa(argIndex))
+		args = append(args, query.CoreID)
+		argIndex++
+	}
+
+	// Add cursor pagination if provided
+	if query.Cursor != nil {
+		queryBuilder.WriteString(" AND (version > $")
+		queryBuilder.WriteString(strconv.Itoa(argIndex))
+		queryBuilder.WriteString("::BIGINT OR (version = $")
+		queryBuilder.WriteString(strconv.Itoa(argIndex + 1))
+		queryBuilder.WriteString("::BIGINT AND observation_id > $")
+		queryBuilder.WriteString(strconv.Itoa(argIndex + 2))
+		queryBuilder.WriteString("::VARCHAR))")
+		args = append(args, query.Cursor.Version, query.Cursor.Version, query.Cursor.ID)
+		argIndex += 3
+	}
+
+	// Order by version and observation_id for consistent pagination
+	queryBuilder.WriteString(" ORDER BY version ASC, observation_id ASC")
+	queryBuilder.WriteString(" LIMIT $")
+	queryBuilder.WriteString(strconv.Itoa(argIndex))
+	args = append(args, query.Limit)
+
+	rows, err := r.q.QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+	defer rows.Close()
+	return scanObservations(rows)
+}
+
+// ByCoreID implements ObservationRepo
+func (r postgresObservations) ByCoreID(ctx context.Context, query CoreIDQuery, limit int) ([]Observation, error) {
+	args := []interface{}{query.CoreID}
+	conditions := []string{"core_id = $1"}
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "NOT deleted")
+	}
+	if query.FormType != "" {
+		args = append(args, query.FormType)
+		conditions = append(conditions, fmt.Sprintf("form_type = $%d", len(args)))
+	}
+	if len(query.ExcludedFormTypes) > 0 {
+		args = append(args, pq.Array(query.ExcludedFormTypes))
+		conditions = append(conditions, fmt.Sprintf("NOT (form_type = ANY($%d))", len(args)))
+	}
+	args = append(args, limit, query.Offset)
+
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT observation_id, form_type, form_version, data,
+		       created_at, updated_at, synced_at, deleted, version
+		FROM observations
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at ASC, observation_id ASC
+		LIMIT $`+fmt.Sprint(len(args)-1)+` OFFSET $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations by core ID: %w", err)
+	}
+	defer rows.Close()
+	return scanObservations(rows)
+}
+
+// scanObservations reads the observations selected by ChangedSince and ByCoreID
+func scanObservations(rows *sql.Rows) ([]Observation, error) {
+	var records []Observation
+	for rows.Next() {
+		var obs Observation
+		var syncedAt sql.NullString
+
+		err := rows.Scan(
+			&obs.ObservationID, &obs.FormType, &obs.FormVersion,
+			&obs.Data, &obs.CreatedAt, &obs.UpdatedAt, &syncedAt,
+			&obs.Deleted, &obs.Version,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan observation: %w", err)
+		}
+
+		if syncedAt.Valid {
+			obs.SyncedAt = &syncedAt.String
+		}
+
+		records = append(records, obs)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return records, nil
+}
+
+// Existing implements ObservationRepo
+func (r postgresObservations) Existing(ctx context.Context, ids []string) (map[string]bool, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT observation_id FROM observations WHERE observation_id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up stored observations: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan stored observation: %w", err)
+		}
+		stored[id] = true
+	}
+	return stored, rows.Err()
+}
+
+// LastChanges implements ObservationRepo
+func (r postgresObservations) LastChanges(ctx context.Context, ids []string) (map[string]StoredChange, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT observation_id, version, client_updated_at, updated_at FROM observations WHERE observation_id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up stored observations: %w", err)
+	}
+	defer rows.Close()
+
+	changes := make(map[string]StoredChange)
+	for rows.Next() {
+		var id string
+		var change StoredChange
+		var clientUpdatedAt sql.NullTime
+		if err := rows.Scan(&id, &change.Version, &clientUpdatedAt, &change.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stored observation: %w", err)
+		}
+		if clientUpdatedAt.Valid {
+			change.ClientUpdatedAt = &clientUpdatedAt.Time
+		}
+		changes[id] = change
+	}
+	return changes, rows.Err()
+}
+
+// Upsert implements ObservationRepo. updated_at is the server time of the change, as it
+// was when a trigger maintained versions.
+func (r postgresObservations) Upsert(ctx context.Context, write ObservationWrite) error {
+	record := write.Record
+	var geolocation, pushedBy, submittedBy interface{}
+	if write.Geolocation != nil {
+		geolocation = write.Geolocation
+	}
+	if write.ClientID != "" {
+		pushedBy = write.ClientID
+	}
+	if write.SubmittedBy != "" {
+		submittedBy = write.SubmittedBy
+	}
+
+	_, err := r.q.ExecContext(ctx, `
+		INSERT INTO observations (observation_id, form_type, form_version, data, created_at, updated_at, deleted, geolocation, client_id, version, submitted_by, client_updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (observation_id)
+		DO UPDATE SET
+			form_type = EXCLUDED.form_type,
+			form_version = EXCLUDED.form_version,
+			data = EXCLUDED.data,
+			updated_at = NOW(),
+			deleted = EXCLUDED.deleted,
+			geolocation = EXCLUDED.geolocation,
+			client_id = EXCLUDED.client_id,
+			version = EXCLUDED.version,
+			submitted_by = COALESCE(observations.submitted_by, EXCLUDED.submitted_by),
+			client_updated_at = EXCLUDED.client_updated_at`,
+		record.ObservationID, record.FormType, record.FormVersion,
+		record.Data, write.CreatedAt, record.Deleted,
+		geolocation, pushedBy, write.Version, submittedBy, write.ClientUpdatedAt)
+	return err
+}
+
+// Submissions implements ObservationRepo. Informational warnings, such as recomputed
+// calculations, don't flag an observation.
+func (r postgresObservations) Submissions(ctx context.Context, query SubmissionQuery, limit int) ([]Submission, error) {
+	args := []interface{}{query.Username}
+	conditions := []string{"o.submitted_by = $1", "NOT o.deleted"}
+	if query.FormType != "" {
+		args = append(args, query.FormType)
+		conditions = append(conditions, fmt.Sprintf("o.form_type = $%d", len(args)))
+	}
+	if query.Since != nil {
+		args = append(args, *query.Since)
+		conditions = append(conditions, fmt.Sprintf("o.created_at >= $%d", len(args)))
+	}
+	if query.Until != nil {
+		args = append(args, *query.Until)
+		conditions = append(conditions, fmt.Sprintf("o.created_at < $%d", len(args)))
+	}
+	statusFilter := ""
+	if query.Status != "" {
+		args = append(args, query.Status)
+		statusFilter = fmt.Sprintf("WHERE status = $%d", len(args))
+	}
+	args = append(args, limit, query.Offset)
+
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT observation_id, form_type, form_version, created_at, updated_at, version, status, flags
+		FROM (
+			SELECT o.observation_id, o.form_type, o.form_version, o.created_at, o.updated_at, o.version,
+			       COALESCE(w.codes, '{}') AS flags,
+			       CASE
+			           WHEN w.codes IS NOT NULL THEN '`+SubmissionFlagged+`'
+			           WHEN EXISTS (SELECT 1 FROM observation_audit a WHERE a.observation_id = o.observation_id) THEN '`+SubmissionReviewed+`'
+			           ELSE '`+SubmissionSynced+`'
+			       END AS status
+			FROM observations o
+			LEFT JOIN LATERAL (
+				SELECT ARRAY_AGG(DISTINCT code ORDER BY code) AS codes
+				FROM sync_warnings sw
+				WHERE sw.observation_id = o.observation_id
+				  AND sw.acknowledged_at IS NULL
+				  AND sw.severity <> '`+SeverityInfo+`'
+			) w ON TRUE
+			WHERE `+strings.Join(conditions, " AND ")+`
+		) submissions
+		`+statusFilter+`
+		ORDER BY created_at DESC, observation_id DESC
+		LIMIT $`+fmt.Sprint(len(args)-1)+` OFFSET $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submissions: %w", err)
+	}
+	defer rows.Close()
+
+	submissions := []Submission{}
+	for rows.Next() {
+		var sub Submission
+		var flags []string
+		if err := rows.Scan(&sub.ObservationID, &sub.FormType, &sub.FormVersion, &sub.CreatedAt, &sub.UpdatedAt, &sub.Version, &sub.Status, pq.Array(&flags)); err != nil {
+			return nil, fmt.Errorf("failed to scan submission: %w", err)
+		}
+		if len(flags) > 0 {
+			sub.Flags = flags
+		}
+		submissions = append(submissions, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read submissions: %w", err)
+	}
+	return submissions, nil
+}
+
+// postgresVersions implements VersionRepo
+type postgresVersions postgresRepositories
+
+// Current implements VersionRepo
+func (r postgresVersions) Current(ctx context.Context) (int64, error) {
+	var version int64
+	if err := r.q.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get current version: %w", err)
+	}
+	return version, nil
+}
+
+// MinVersion implements VersionRepo
+func (r postgresVersions) MinVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := r.q.QueryRowContext(ctx, "SELECT min_version FROM sync_version WHERE id = 1").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get minimum sync version: %w", err)
+	}
+	return version, nil
+}
+
+// Reserve implements VersionRepo in a single statement, which locks the sync_version row
+// until the transaction ends
+func (r postgresVersions) Reserve(ctx context.Context, n int) (int64, error) {
+	var current int64
+	err := r.q.QueryRowContext(ctx,
+		"UPDATE sync_version SET current_version = current_version + $1, updated_at = NOW() WHERE id = 1 RETURNING current_version",
+		n).Scan(&current)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to reserve versions: sync_version row is missing")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve versions: %w", err)
+	}
+	return current, nil
+}
+
+// postgresWarnings implements WarningRepo
+type postgresWarnings postgresRepositories
+
+// Record implements WarningRepo
+func (r postgresWarnings) Record(ctx context.Context, clientID, transmissionID string, warnings []SyncWarning) error {
+	for i := range warnings {
+		w := &warnings[i]
+		err := r.q.QueryRowContext(ctx, `
+			INSERT INTO sync_warnings (client_id, transmission_id, observation_id, code, severity, message)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`,
+			clientID, transmissionID, w.ID, w.Code, w.Severity, w.Message).Scan(&w.WarningID)
+		if err != nil {
+			return fmt.Errorf("failed to record warning: %w", err)
+		}
+	}
+	return nil
+}
+
+// Acknowledge implements WarningRepo
+func (r postgresWarnings) Acknowledge(ctx context.Context, clientID string, ack WarningAck) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE sync_warnings SET acknowledged_at = NOW()
+		WHERE client_id = $1 AND acknowledged_at IS NULL
+		  AND (id = ANY($2) OR code = ANY($3))`,
+		clientID, pq.Array(ack.IDs), pq.Array(ack.Codes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to acknowledge warnings: %w", err)
+	}
+	acknowledged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to acknowledge warnings: %w", err)
+	}
+	return acknowledged, nil
+}
+
+// Summary implements WarningRepo, clients with the most unacknowledged warnings first
+func (r postgresWarnings) Summary(ctx context.Context, query WarningQuery) ([]WarningSummary, error) {
+	var conditions []string
+	var args []interface{}
+	if query.ClientID != "" {
+		args = append(args, query.ClientID)
+		conditions = append(conditions, fmt.Sprintf("client_id = $%d", len(args)))
+	}
+	if query.Code != "" {
+		args = append(args, query.Code)
+		conditions = append(conditions, fmt.Sprintf("code = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	having := "HAVING COUNT(*) FILTER (WHERE acknowledged_at IS NULL) > 0"
+	if query.IncludeAcknowledged {
+		having = ""
+	}
+
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT client_id, code, MAX(severity), COUNT(*),
+		       COUNT(*) FILTER (WHERE acknowledged_at IS NULL),
+		       MIN(created_at), MAX(created_at),
+		       (ARRAY_AGG(message ORDER BY created_at DESC, id DESC))[1]
+		FROM sync_warnings
+		`+where+`
+		GROUP BY client_id, code
+		`+having+`
+		ORDER BY 5 DESC, 7 DESC, client_id, code`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query warnings: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []WarningSummary{}
+	for rows.Next() {
+		var w WarningSummary
+		if err := rows.Scan(&w.ClientID, &w.Code, &w.Severity, &w.Total, &w.Unacknowledged, &w.FirstSeenAt, &w.LastSeenAt, &w.LastMessage); err != nil {
+			return nil, fmt.Errorf("failed to scan warning summary: %w", err)
+		}
+		summaries = append(summaries, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read warning summary: %w", err)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"context"
+	"time"
+)
+
+// PullQuery selects a page of changed observations
+type PullQuery struct {
+	SinceVersion int64
+	// FormTypes limits the page to these form types; empty for all
+	FormTypes []string
+	// ExcludedFormTypes leaves out form types the caller may not see
+	ExcludedFormTypes []string
+	// CoreID limits the page to the observations of one participant or household; empty
+	// for all
+	CoreID string
+	// Cursor continues after the last observation of the previous page
+	Cursor *SyncPullCursor
+	Limit  int
+}
+
+// ObservationWrite is a pushed observation with what the server adds to it
+type ObservationWrite struct {
+	Record    Observation
+	Version   int64
+	CreatedAt time.Time
+	// ClientUpdatedAt is the updated_at the client sent; nil when it sent none
+	ClientUpdatedAt *time.Time
+	// Geolocation is the JSON of Record.Geolocation; nil when the record has none
+	Geolocation []byte
+	// ClientID is the client that pushed the observation; empty when unknown
+	ClientID string
+	// SubmittedBy is the user pushing the observation, kept as its owner when it is
+	// first stored; empty when the push isn't made for a user
+	SubmittedBy string
+}
+
+// StoredChange is the last change of a stored observation
+type StoredChange struct {
+	Version int64
+	// ClientUpdatedAt is the updated_at the client sent with it; nil when it sent none
+	ClientUpdatedAt *time.Time
+	// UpdatedAt is the server time of the change
+	UpdatedAt time.Time
+}
+
+// ObservationRepo reads and writes observations
+type ObservationRepo interface {
+	// ChangedSince returns up to query.Limit observations changed after
+	// query.SinceVersion, ordered by version and observation ID
+	ChangedSince(ctx context.Context, query PullQuery) ([]Observation, error)
+
+	// Existing returns which of ids are stored, deleted ones included
+	Existing(ctx context.Context, ids []string) (map[string]bool, error)
+
+	// LastChanges returns the last change of the stored observations among ids, deleted
+	// ones included
+	LastChanges(ctx context.Context, ids []string) (map[string]StoredChange, error)
+
+	// Upsert stores an observation, replacing the stored one with the same ID
+	Upsert(ctx context.Context, write ObservationWrite) error
+
+	// Submissions returns up to limit observations query.Username submitted, newest first,
+	// skipping query.Offset
+	Submissions(ctx context.Context, query SubmissionQuery, limit int) ([]Submission, error)
+
+	// ByCoreID returns up to limit observations of query.CoreID, oldest first, skipping
+	// query.Offset
+	ByCoreID(ctx context.Context, query CoreIDQuery, limit int) ([]Observation, error)
+}
+
+// VersionRepo reads and advances the global sync version
+type VersionRepo interface {
+	// Current returns the current version
+	Current(ctx context.Context) (int64, error)
+
+	// Reserve advances the version by n and returns the new current version; the
+	// reserved versions are current-n+1..current. In a unit of work it holds off other
+	// reservations until the unit ends, so concurrent pushes get non-overlapping versions.
+	Reserve(ctx context.Context, n int) (int64, error)
+
+	// MinVersion returns the purge horizon, the highest version of a purged tombstone
+	MinVersion(ctx context.Context) (int64, error)
+}
+
+// WarningRepo records sync warnings per client
+type WarningRepo interface {
+	// Record stores the warnings of a push and sets their WarningID
+	Record(ctx context.Context, clientID, transmissionID string, warnings []SyncWarning) error
+
+	// Acknowledge marks the selected warnings of a client as acknowledged and returns how
+	// many were not acknowledged before
+	Acknowledge(ctx context.Context, clientID string, ack WarningAck) (int64, error)
+
+	// Summary counts the warnings per client and code
+	Summary(ctx context.Context, query WarningQuery) ([]WarningSummary, error)
+}
+
+// Repositories gives access to the sync repositories
+type Repositories interface {
+	Observations() ObservationRepo
+	Versions() VersionRepo
+	Warnings() WarningRepo
+}
+
+// Store is where the sync service keeps its data. Its repositories each run on their
+// own; Begin starts a unit of work whose repositories share a transaction.
+type Store interface {
+	Repositories
+
+	// Begin starts a unit of work
+	Begin(ctx context.Context) (UnitOfWork, error)
+}
+
+// UnitOfWork is a transaction-scoped set of repositories. Its writes are only kept when
+// Commit succeeds; Rollback after Commit does nothing.
+type UnitOfWork interface {
+	Repositories
+
+	// Savepoint marks the point RollbackToSavepoint returns to, so a failed write can be
+	// undone without aborting the unit of work
+	Savepoint(ctx context.Context) error
+
+	// RollbackToSavepoint undoes the writes since the last Savepoint
+	RollbackToSavepoint(ctx context.Context) error
+
+	Commit() error
+	Rollback() error
+}
@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+// memoryStore keeps observations in memory; a unit of work writes to a copy that Commit
+// makes current
+type memoryStore struct {
+	observations map[string]Observation
+	version      int64
+	minVersion   int64
+	warnings     []SyncWarning
+	lastPull     PullQuery
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{observations: map[string]Observation{}}
+}
+
+func (m *memoryStore) Observations() ObservationRepo { return memoryObservations{m} }
+func (m *memoryStore) Versions() VersionRepo         { return memoryVersions{m} }
+func (m *memoryStore) Warnings() WarningRepo         { return memoryWarnings{m} }
+
+func (m *memoryStore) Begin(ctx context.Context) (UnitOfWork, error) {
+	work := &memoryStore{observations: map[string]Observation{}, version: m.version, warnings: m.warnings}
+	for id, obs := range m.observations {
+		work.observations[id] = obs
+	}
+	return &memoryUnitOfWork{memoryStore: work, parent: m}, nil
+}
+
+type memoryUnitOfWork struct {
+	*memoryStore
+	parent *memoryStore
+}
+
+func (u *memoryUnitOfWork) Savepoint(ctx context.Context) error           { return nil }
+func (u *memoryUnitOfWork) RollbackToSavepoint(ctx context.Context) error { return nil }
+func (u *memoryUnitOfWork) Rollback() error                               { return nil }
+func (u *memoryUnitOfWork) Commit() error {
+	u.parent.observations, u.parent.version, u.parent.warnings = u.observations, u.version, u.warnings
+	return nil
+}
+
+type memoryObservations struct{ m *memoryStore }
+
+func (r memoryObservations) ChangedSince(ctx context.Context, query PullQuery) ([]Observation, error) {
+	r.m.lastPull = query
+	excluded := map[string]bool{}
+	for _, formType := range query.ExcludedFormTypes {
+		excluded[formType] = true
+	}
+	var records []Observation
+	for _, obs := range r.m.observations {
+		if obs.Version > query.SinceVersion && !excluded[obs.FormType] && (query.CoreID == "" || obs.CoreID() == query.CoreID) {
+			records = append(records, obs)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	if len(records) > query.Limit {
+		records = records[:query.Limit]
+	}
+	return records, nil
+}
+
+func (r memoryObservations) Existing(ctx context.Context, ids []string) (map[string]bool, error) {
+	stored := map[string]bool{}
+	for _, id := range ids {
+		_, stored[id] = r.m.observations[id]
+	}
+	return stored, nil
+}
+
+func (r memoryObservations) LastChanges(ctx context.Context, ids []string) (map[string]StoredChange, error) {
+	changes := map[string]StoredChange{}
+	for _, id := range ids {
+		obs, ok := r.m.observations[id]
+		if !ok {
+			continue
+		}
+		change := StoredChange{Version: obs.Version}
+		if updatedAt, err := time.Parse(time.RFC3339Nano, obs.UpdatedAt); err == nil {
+			change.ClientUpdatedAt, change.UpdatedAt = &updatedAt, updatedAt
+		}
+		changes[id] = change
+	}
+	return changes, nil
+}
+
+func (r memoryObservations) Upsert(ctx context.Context, write ObservationWrite) error {
+	obs := write.Record
+	obs.Version = write.Version
+	r.m.observations[obs.ObservationID] = obs
+	return nil
+}
+
+func (r memoryObservations) Submissions(ctx context.Context, query SubmissionQuery, limit int) ([]Submission, error) {
+	return []Submission{}, nil
+}
+
+func (r memoryObservations) ByCoreID(ctx context.Context, query CoreIDQuery, limit int) ([]Observation, error) {
+	return []Observation{}, nil
+}
+
+type memoryVersions struct{ m *memoryStore }
+
+func (r memoryVersions) Current(ctx context.Context) (int64, error)    { return r.m.version, nil }
+func (r memoryVersions) MinVersion(ctx context.Context) (int64, error) { return r.m.minVersion, nil }
+func (r memoryVersions) Reserve(ctx context.Context, n int) (int64, error) {
+	r.m.version += int64(n)
+	return r.m.version, nil
+}
+
+type memoryWarnings struct{ m *memoryStore }
+
+func (r memoryWarnings) Record(ctx context.Context, clientID, transmissionID string, warnings []SyncWarning) error {
+	r.m.warnings = append(r.m.warnings, warnings...)
+	return nil
+}
+func (r memoryWarnings) Acknowledge(ctx context.Context, clientID string, ack WarningAck) (int64, error) {
+	return 0, nil
+}
+func (r memoryWarnings) Summary(ctx context.Context, query WarningQuery) ([]WarningSummary, error) {
+	return []WarningSummary{}, nil
+}
+
+// TestService_WithStore runs pushes and pulls against an in-memory store
+func TestService_WithStore(t *testing.T) {
+	store := newMemoryStore()
+	config := DefaultConfig()
+	config.Access = fakeAccess{}
+	service := NewServiceWithStore(store, config, logger.NewLogger())
+	ctx := userContext(models.RoleReadWrite)
+	now := time.Now().UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "household", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "household", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+		{ObservationID: "obs-3", FormType: "payments", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+	}
+
+	dryRun, err := service.ProcessPushedRecords(WithDryRun(ctx), records, "client-1", "tx-0")
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if dryRun.SuccessCount != 2 || len(store.observations) != 0 || store.version != 0 {
+		t.Errorf("Expected a dry run to store nothing, got %d successes, %d stored at version %d", dryRun.SuccessCount, len(store.observations), store.version)
+	}
+
+	pushed, err := service.ProcessPushedRecords(ctx, records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed.SuccessCount != 2 || len(pushed.FailedRecords) != 1 || pushed.CurrentVersion != 2 {
+		t.Errorf("Expected 2 stored records, 1 denied and version 2, got %+v", pushed)
+	}
+	if store.observations["obs-1"].Version != 1 || store.observations["obs-2"].Version != 2 {
+		t.Errorf("Expected consecutive versions, got %+v", store.observations)
+	}
+
+	page, err := service.GetRecordsSinceVersion(ctx, 0, "client-1", nil, 1, nil)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(page.Records) != 1 || !page.HasMore || page.ChangeCutoff != 1 || page.CurrentVersion != 2 {
+		t.Errorf("Expected the first of two records, got %+v", page)
+	}
+	if store.lastPull.Limit != 2 || len(store.lastPull.ExcludedFormTypes) != 1 || store.lastPull.ExcludedFormTypes[0] != "payments" {
+		t.Errorf("Expected a query for one extra record without payments, got %+v", store.lastPull)
+	}
+}
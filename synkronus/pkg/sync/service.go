@@ -3,25 +3,39 @@ package sync
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/database"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/strictschema"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Service provides version-based synchronization functionality with PostgreSQL
+// Service provides version-based synchronization. It decides what a pull returns and what
+// a push stores; reading and writing the data is left to its Store.
 type Service struct {
-	db     *sql.DB
+	store  Store
 	config Config
 	log    *logger.Logger
 }
 
-// NewService creates a new version-based sync service
+// NewService creates a new version-based sync service on a PostgreSQL database
 func NewService(db *sql.DB, config Config, log *logger.Logger) *Service {
+	if config.Statements != nil {
+		return NewServiceWithStore(NewCachedPostgresStore(db, config.Statements), config, log)
+	}
+	return NewServiceWithStore(NewPostgresStore(db), config, log)
+}
+
+// NewServiceWithStore creates a new version-based sync service on a Store
+func NewServiceWithStore(store Store, config Config, log *logger.Logger) *Service {
 	return &Service{
-		db:     db,
+		store:  store,
 		config: config,
 		log:    log,
 	}
@@ -32,6 +46,11 @@ func DefaultConfig() Config {
 	return Config{
 		MaxRecordsPerSync: 1000,
 		DefaultLimit:      100,
+
+		ClockSkewTolerance:    5 * time.Minute,
+		TimestampFormat:       TimestampLenient,
+		FutureTimestampPolicy: FutureWarn,
+		ConflictPolicy:        ConflictClientWins,
 	}
 }
 
@@ -44,22 +63,60 @@ func (s *Service) Initialize(ctx context.Context) error {
 // GetCurrentVersion returns the current database version
 func (s *Service) GetCurrentVersion(ctx context.Context) (int64, error) {
 	var version int64
-	query := "SELECT current_version FROM sync_version WHERE id = 1"
+	err := s.config.Retry.Do(ctx, "sync version", func(ctx context.Context) error {
+		var err error
+		version, err = s.currentVersion(ctx)
+		return err
+	})
+	return version, err
+}
 
-	err := s.db.QueryRowContext(ctx, query).Scan(&version)
+func (s *Service) currentVersion(ctx context.Context) (int64, error) {
+	version, err := s.store.Versions().Current(ctx)
 	if err != nil {
 		s.log.Error("Failed to get current version", "error", err)
-		return 0, fmt.Errorf("failed to get current version: %w", err)
+		return 0, err
 	}
-
 	return version, nil
 }
 
 // GetRecordsSinceVersion retrieves records that have changed since the specified version
-func (s *Service) GetRecordsSinceVersion(ctx context.Context, sinceVersion int64, clientID string, schemaTypes []string, limit int, cursor *SyncPullCursor) (*SyncResult, error) {
+func (s *Service) GetRecordsSinceVersion(ctx context.Context, sinceVersion int64, clientID string, schemaTypes []string, limit int, cursor *SyncPullCursor) (_ *SyncResult, err error) {
+	ctx, span := tracing.Start(ctx, "sync.GetRecordsSinceVersion",
+		attribute.String("sync.client_id", clientID),
+		attribute.Int64("sync.since_version", sinceVersion),
+		attribute.StringSlice("sync.schema_types", schemaTypes),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	var result *SyncResult
+	err = s.config.Retry.Do(ctx, "sync pull", func(ctx context.Context) error {
+		var err error
+		result, err = s.getRecordsSinceVersion(ctx, sinceVersion, clientID, schemaTypes, limit, cursor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.Int("sync.record_count", len(result.Records)),
+		attribute.Bool("sync.has_more", result.HasMore),
+		attribute.Int64("sync.current_version", result.CurrentVersion),
+	)
+	return result, nil
+}
+
+func (s *Service) getRecordsSinceVersion(ctx context.Context, sinceVersion int64, clientID string, schemaTypes []string, limit int, cursor *SyncPullCursor) (*SyncResult, error) {
 	// Get current version first
-	currentVersion, err := s.GetCurrentVersion(ctx)
+	currentVersion, err := s.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	minVersion, err := s.store.Versions().MinVersion(ctx)
 	if err != nil {
+		s.log.Error("Failed to get minimum sync version", "error", err)
 		return nil, err
 	}
 
@@ -73,95 +130,24 @@ func (s *Service) GetRecordsSinceVersion(ctx context.Context, sinceVersion int64
 		limit = s.config.MaxRecordsPerSync
 	}
 
-	// Build query with optional filters
-	var queryBuilder strings.Builder
-	var args []interface{}
-	argIndex := 1
-
-	queryBuilder.WriteString(`
-		SELECT observation_id, form_type, form_version, data, 
-		       created_at, updated_at, synced_at, deleted, version
-		FROM observations 
-		WHERE version > $`)
-	queryBuilder.WriteString(strconv.Itoa(argIndex))
-	args = append(args, sinceVersion)
-	argIndex++
-
-	// Add schema type filter if specified
-	if len(schemaTypes) > 0 {
-		queryBuilder.WriteString(" AND form_type = ANY($")
-		queryBuilder.WriteString(strconv.Itoa(argIndex))
-		queryBuilder.WriteString(")")
-		args = append(args, pq.Array(schemaTypes))
-		argIndex++
-	}
-
-	// Add cursor pagination if provided
-	if cursor != nil {
-		queryBuilder.WriteString(" AND (version > $")
-		queryBuilder.WriteString(strconv.Itoa(argIndex))
-		queryBuilder.WriteString("::BIGINT OR (version = $")
-		queryBuilder.WriteString(strconv.Itoa(argIndex + 1))
-		queryBuilder.WriteString("::BIGINT AND observation_id > $")
-		queryBuilder.WriteString(strconv.Itoa(argIndex + 2))
-		queryBuilder.WriteString("::VARCHAR))")
-		args = append(args, cursor.Version, cursor.Version, cursor.ID)
-		argIndex += 3
-	}
-
-	// Order by version and observation_id for consistent pagination
-	queryBuilder.WriteString(" ORDER BY version ASC, observation_id ASC")
-
-	// Add limit + 1 to check if there are more records
-	// Calculate the correct parameter index based on whether we have schema types or not
-	limitParamIndex := 1 // for sinceVersion
-	if len(schemaTypes) > 0 {
-		limitParamIndex = 2 // for sinceVersion and schemaTypes
-	}
-	if cursor != nil {
-		limitParamIndex += 3 // for cursor.Version, cursor.Version, cursor.ID
-	}
-	limitParamIndex++ // for the limit parameter itself
-
-	queryBuilder.WriteString(" LIMIT $")
-	queryBuilder.WriteString(strconv.Itoa(limitParamIndex))
-	args = append(args, limit+1)
-
-	// Execute query
-	sqlStmt := queryBuilder.String()
-	s.log.Debug("SQL query", "sql", sqlStmt, "args", args)
-	rows, err := s.db.QueryContext(ctx, sqlStmt, args...)
+	// Leave out form types the user's role may not see or isn't granted
+	denied, err := s.excludedFormTypes(ctx)
 	if err != nil {
-		s.log.Error("Failed to query observations", "error", err)
-		return nil, fmt.Errorf("failed to query observations: %w", err)
-	}
-	defer rows.Close()
-
-	var records []Observation
-	for rows.Next() {
-		var obs Observation
-		var syncedAt sql.NullString
-
-		err := rows.Scan(
-			&obs.ObservationID, &obs.FormType, &obs.FormVersion,
-			&obs.Data, &obs.CreatedAt, &obs.UpdatedAt, &syncedAt,
-			&obs.Deleted, &obs.Version,
-		)
-		if err != nil {
-			s.log.Error("Failed to scan observation row", "error", err)
-			return nil, fmt.Errorf("failed to scan observation: %w", err)
-		}
-
-		if syncedAt.Valid {
-			obs.SyncedAt = &syncedAt.String
-		}
-
-		records = append(records, obs)
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
-		s.log.Error("Error iterating observation rows", "error", err)
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+	// Ask for one record more than the limit to know if there are more
+	records, err := s.store.Observations().ChangedSince(ctx, PullQuery{
+		SinceVersion:      sinceVersion,
+		FormTypes:         schemaTypes,
+		ExcludedFormTypes: denied,
+		CoreID:            CoreIDOf(ctx),
+		Cursor:            cursor,
+		Limit:             limit + 1,
+	})
+	if err != nil {
+		s.log.Error("Failed to query observations", "error", err)
+		return nil, err
 	}
 
 	// Check if there are more records
@@ -181,6 +167,9 @@ func (s *Service) GetRecordsSinceVersion(ctx context.Context, sinceVersion int64
 		Records:        records,
 		ChangeCutoff:   changeCutoff,
 		HasMore:        hasMore,
+		MinVersion:     minVersion,
+		// Clients that pull from scratch get every live observation anyway
+		ResyncRequired: sinceVersion > 0 && sinceVersion < minVersion,
 	}
 
 	s.log.Info("Retrieved records since version",
@@ -189,33 +178,136 @@ func (s *Service) GetRecordsSinceVersion(ctx context.Context, sinceVersion int64
 		"recordCount", len(records),
 		"hasMore", hasMore,
 		"changeCutoff", changeCutoff,
+		"resyncRequired", result.ResyncRequired,
 		"clientId", clientID)
 
 	return result, nil
 }
 
+// deniedFormTypes lists the form types the user of ctx may not push or pull; none when
+// no access rules are configured or the call isn't made for a user
+func (s *Service) deniedFormTypes(ctx context.Context) ([]string, error) {
+	if s.config.Access == nil {
+		return nil, nil
+	}
+	user := authmw.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, nil
+	}
+	denied, err := s.config.Access.DeniedFormTypes(user.Role)
+	if err != nil {
+		s.log.Error("Failed to read form access rules", "error", err)
+		return nil, fmt.Errorf("failed to read form access rules: %w", err)
+	}
+	return denied, nil
+}
+
+// unpermittedFormTypes lists the granted form types the user of ctx isn't granted; none
+// when permissions are off
+func (s *Service) unpermittedFormTypes(ctx context.Context) ([]string, error) {
+	if s.config.Permissions == nil {
+		return nil, nil
+	}
+	user := authmw.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, nil
+	}
+	unpermitted, err := s.config.Permissions.DeniedFormTypes(ctx, user)
+	if err != nil {
+		s.log.Error("Failed to read form permissions", "error", err)
+		return nil, fmt.Errorf("failed to read form permissions: %w", err)
+	}
+	return unpermitted, nil
+}
+
+// excludedFormTypes lists the form types the user of ctx may not pull, by role or by
+// permission
+func (s *Service) excludedFormTypes(ctx context.Context) ([]string, error) {
+	denied, err := s.deniedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unpermitted, err := s.unpermittedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(denied, unpermitted...), nil
+}
+
 // ProcessPushedRecords processes records pushed from a client
-func (s *Service) ProcessPushedRecords(ctx context.Context, records []Observation, clientID string, transmissionID string) (*SyncPushResult, error) {
+func (s *Service) ProcessPushedRecords(ctx context.Context, records []Observation, clientID string, transmissionID string) (_ *SyncPushResult, err error) {
+	ctx, span := tracing.Start(ctx, "sync.ProcessPushedRecords",
+		attribute.String("sync.client_id", clientID),
+		attribute.String("sync.transmission_id", transmissionID),
+		attribute.Int("sync.record_count", len(records)),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	// A transaction that failed with a connection error was rolled back, so the whole push
+	// is retried
+	var result *SyncPushResult
+	err = s.config.Retry.Do(ctx, "sync push", func(ctx context.Context) error {
+		var err error
+		result, err = s.processPushedRecords(ctx, records, clientID, transmissionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.Int("sync.success_count", result.SuccessCount),
+		attribute.Int("sync.failed_count", len(result.FailedRecords)),
+		attribute.Int64("sync.current_version", result.CurrentVersion),
+	)
+	return result, nil
+}
+
+// processPushedRecords stores pushed records in a single transaction
+func (s *Service) processPushedRecords(ctx context.Context, records []Observation, clientID string, transmissionID string) (*SyncPushResult, error) {
 	var successCount int
 	var failedRecords []map[string]interface{}
 	var warnings []SyncWarning
 
-	// Begin transaction for atomic processing
-	tx, err := s.db.BeginTx(ctx, nil)
+	denied, err := s.deniedFormTypes(ctx)
 	if err != nil {
-		s.log.Error("Failed to begin transaction", "error", err)
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
+	}
+	deniedForms := make(map[string]bool, len(denied))
+	for _, formType := range denied {
+		deniedForms[formType] = true
+	}
+	unpermitted, err := s.unpermittedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unpermittedForms := make(map[string]bool, len(unpermitted))
+	for _, formType := range unpermitted {
+		unpermittedForms[formType] = true
 	}
 
-	committed := false
+	// The whole push is stored in one unit of work
+	uow, err := s.store.Begin(ctx)
+	if err != nil {
+		s.log.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
 	defer func() {
-		if !committed {
-			if err := tx.Rollback(); err != nil {
-				s.log.Error("Failed to rollback transaction", "error", err)
-			}
+		if err := uow.Rollback(); err != nil {
+			s.log.Error("Failed to rollback transaction", "error", err)
 		}
 	}()
 
+	// Validate the records before reserving versions for them
+	type pendingRecord struct {
+		index       int
+		record      Observation
+		timestamps  *normalizedTimestamps
+		geolocation []byte
+	}
+	pending := make([]pendingRecord, 0, len(records))
+	now := time.Now()
 	for i, record := range records {
 		// Validate required fields
 		if record.ObservationID == "" {
@@ -227,37 +319,336 @@ func (s *Service) ProcessPushedRecords(ctx context.Context, records []Observatio
 			continue
 		}
 
+		if deniedForms[record.FormType] {
+			failedRecords = append(failedRecords, map[string]interface{}{
+				"index":  i,
+				"error":  fmt.Sprintf("form type %s requires a role the user doesn't have", record.FormType),
+				"record": record,
+			})
+			continue
+		}
+		if unpermittedForms[record.FormType] {
+			failedRecords = append(failedRecords, map[string]interface{}{
+				"index":  i,
+				"error":  fmt.Sprintf("form type %s isn't granted to the user", record.FormType),
+				"record": record,
+			})
+			continue
+		}
+
+		// Timestamps are stored in UTC; formats other than RFC3339 only pass in lenient mode
+		timestamps, err := s.normalizeTimestamps(&record)
+		if err != nil {
+			failedRecords = append(failedRecords, map[string]interface{}{
+				"index":  i,
+				"error":  err.Error(),
+				"record": record,
+			})
+			continue
+		}
+		if skew := clockSkew(record, now); s.config.ClockSkewTolerance > 0 && skew > s.config.ClockSkewTolerance {
+			message := fmt.Sprintf("updated_at is %s ahead of the server clock", skew.Round(time.Second))
+			if s.config.FutureTimestampPolicy == FutureReject {
+				failedRecords = append(failedRecords, map[string]interface{}{
+					"index":  i,
+					"error":  message,
+					"record": record,
+				})
+				continue
+			}
+			warnings = append(warnings, newWarning(record.ObservationID, WarningClockSkew, message))
+		}
+
 		// Generate warnings for missing optional fields
 		if record.FormType == "" {
-			warnings = append(warnings, SyncWarning{
-				ID:      record.ObservationID,
-				Code:    "MISSING_FORM_TYPE",
-				Message: "form_type is empty but record was processed",
-			})
+			warnings = append(warnings, newWarning(record.ObservationID, WarningMissingFormType, "form_type is empty but record was processed"))
+		}
+		if len(timestamps.normalized) > 0 {
+			warnings = append(warnings, newWarning(record.ObservationID, WarningTimestampNormalized,
+				fmt.Sprintf("%s converted to RFC3339 in UTC", strings.Join(timestamps.normalized, " and "))))
+		}
+
+		// Geolocation is stored as JSONB; NULL when the record has none
+		var geolocation []byte
+		if record.Geolocation != nil {
+			geoJSON, err := json.Marshal(record.Geolocation)
+			if err != nil {
+				failedRecords = append(failedRecords, map[string]interface{}{
+					"index":  i,
+					"error":  fmt.Sprintf("invalid geolocation: %v", err),
+					"record": record,
+				})
+				continue
+			}
+			geolocation = geoJSON
+		}
+
+		// Strict forms don't store keys their schema doesn't declare
+		if s.config.Schemas != nil && !record.Deleted {
+			checked, err := s.config.Schemas.Check(record.FormType, record.Data)
+			if err != nil {
+				failedRecords = append(failedRecords, map[string]interface{}{
+					"index":  i,
+					"error":  err.Error(),
+					"record": record,
+				})
+				continue
+			}
+			if len(checked.Unknown) > 0 {
+				message := fmt.Sprintf("data keys not in the %s schema: %s", record.FormType, strings.Join(checked.Unknown, ", "))
+				if checked.Mode == strictschema.ModeReject {
+					failedRecords = append(failedRecords, map[string]interface{}{
+						"index":  i,
+						"error":  message,
+						"record": record,
+					})
+					continue
+				}
+				record.Data = checked.Data
+				warnings = append(warnings, newWarning(record.ObservationID, WarningUnknownKeysStripped, "removed "+message))
+			}
+		}
+
+		// Calculated fields take the server's values
+		if s.config.Calculator != nil && !record.Deleted {
+			data, mismatches, err := s.config.Calculator.Recompute(ctx, record.FormType, record.Data)
+			if err != nil {
+				// A broken formula in the app bundle shouldn't block data collection
+				s.log.Warn("Failed to recompute calculated fields", "error", err, "observationId", record.ObservationID, "formType", record.FormType)
+			} else {
+				record.Data = data
+				for _, m := range mismatches {
+					warnings = append(warnings, newWarning(record.ObservationID, WarningCalculationMismatch,
+						fmt.Sprintf("%s was %s, server computed %s", m.Field, formatWarningValue(m.ClientValue), formatWarningValue(m.ServerValue))))
+				}
+			}
+		}
+
+		// The data is validated as it will be stored, with calculated fields filled in
+		if s.config.Validator != nil && !record.Deleted {
+			problems, err := s.config.Validator.Validate(ctx, record.FormType, record.FormVersion, record.Data)
+			if err != nil {
+				s.log.Error("Failed to validate observation data", "error", err, "observationId", record.ObservationID, "formType", record.FormType)
+				return nil, fmt.Errorf("failed to validate observation data: %w", err)
+			}
+			if len(problems) > 0 {
+				failedRecords = append(failedRecords, map[string]interface{}{
+					"index":  i,
+					"code":   FailureInvalidData,
+					"error":  fmt.Sprintf("data doesn't match the %s schema: %s", record.FormType, strings.Join(problems, "; ")),
+					"errors": problems,
+					"record": record,
+				})
+				continue
+			}
+		}
+
+		// Required media may be uploaded after the push, within the grace window
+		if s.config.Attachments != nil && !record.Deleted {
+			checked, err := s.config.Attachments.Check(ctx, record.FormType, record.Data)
+			if err != nil {
+				s.log.Warn("Failed to check required attachments", "error", err, "observationId", record.ObservationID, "formType", record.FormType)
+			} else {
+				for _, field := range checked.Missing {
+					warnings = append(warnings, newWarning(record.ObservationID, WarningAttachmentMissing,
+						fmt.Sprintf("%s requires an attachment but has none", field)))
+				}
+				for _, p := range checked.Pending {
+					warnings = append(warnings, newWarning(record.ObservationID, WarningAttachmentPending,
+						fmt.Sprintf("%s refers to attachment %s, which must be uploaded by %s", p.Field, p.AttachmentID, checked.Deadline.Format(time.RFC3339))))
+				}
+			}
 		}
 
-		// Insert or update the observation
-		query := `
-			INSERT INTO observations (observation_id, form_type, form_version, data, created_at, updated_at, deleted)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-			ON CONFLICT (observation_id) 
-			DO UPDATE SET 
-				form_type = EXCLUDED.form_type,
-				form_version = EXCLUDED.form_version,
-				data = EXCLUDED.data,
-				updated_at = EXCLUDED.updated_at,
-				deleted = EXCLUDED.deleted,
-				version = observations.version + 1
-		`
-
-		_, err := tx.ExecContext(ctx, query,
-			record.ObservationID, record.FormType, record.FormVersion,
-			record.Data, record.CreatedAt, record.UpdatedAt, record.Deleted)
+		pending = append(pending, pendingRecord{index: i, record: record, timestamps: timestamps, geolocation: geolocation})
+	}
+
+	// Records under review by someone else are left as they are
+	if s.config.Locks != nil && len(pending) > 0 {
+		ids := make([]string, len(pending))
+		for i, p := range pending {
+			ids[i] = p.record.ObservationID
+		}
+		username := ""
+		if user := authmw.GetUserFromContext(ctx); user != nil {
+			username = user.Username
+		}
+		held, err := s.config.Locks.HeldByOthers(ctx, ids, username)
+		if err != nil {
+			s.log.Error("Failed to check observation locks", "error", err)
+			return nil, fmt.Errorf("failed to check observation locks: %w", err)
+		}
+		if len(held) > 0 {
+			unlocked := pending[:0]
+			for _, p := range pending {
+				lock, ok := held[p.record.ObservationID]
+				if !ok {
+					unlocked = append(unlocked, p)
+					continue
+				}
+				failedRecords = append(failedRecords, map[string]interface{}{
+					"index":  p.index,
+					"code":   FailureLocked,
+					"error":  fmt.Sprintf("observation is locked for review by %s until %s", lock.Owner, lock.ExpiresAt.UTC().Format(time.RFC3339)),
+					"lock":   lock,
+					"record": p.record,
+				})
+			}
+			pending = unlocked
+
+			// Warnings about records that weren't stored would only confuse the dashboard
+			kept := warnings[:0]
+			for _, w := range warnings {
+				if _, ok := held[w.ID]; !ok {
+					kept = append(kept, w)
+				}
+			}
+			warnings = kept
+		}
+	}
 
+	// An edit made after pulling the stored observation but dated before it means the
+	// device clock was reset. The server version still orders it after the stored one.
+	var edits []string
+	for _, p := range pending {
+		if p.record.Version > 0 && p.timestamps.updatedAt != nil {
+			edits = append(edits, p.record.ObservationID)
+		}
+	}
+	if len(edits) > 0 {
+		changes, err := uow.Observations().LastChanges(ctx, edits)
+		if err != nil {
+			s.log.Error("Failed to look up stored observations", "error", err)
+			return nil, err
+		}
+		for _, p := range pending {
+			stored, ok := changes[p.record.ObservationID]
+			if !ok {
+				continue
+			}
+			if message, anomaly := clockAnomaly(p.record, p.timestamps.updatedAt, stored); anomaly {
+				warnings = append(warnings, newWarning(p.record.ObservationID, WarningClockAnomaly, message))
+			}
+		}
+	}
+
+	// A dry run tells new records from updates, and doesn't reserve versions, so it
+	// doesn't hold off other pushes
+	dryRun := IsDryRun(ctx)
+	var stored map[string]bool
+	var outcomes []RecordOutcome
+	if dryRun && len(pending) > 0 {
+		ids := make([]string, len(pending))
+		for i, p := range pending {
+			ids[i] = p.record.ObservationID
+		}
+		if stored, err = uow.Observations().Existing(ctx, ids); err != nil {
+			s.log.Error("Failed to look up stored observations", "error", err)
+			return nil, err
+		}
+	}
+
+	// Reserve one version per record. Concurrent pushes wait for each other's
+	// reservations, so they get consecutive, non-overlapping versions.
+	var currentVersion int64
+	if len(pending) > 0 && !dryRun {
+		currentVersion, err = uow.Versions().Reserve(ctx, len(pending))
+	} else {
+		currentVersion, err = uow.Versions().Current(ctx)
+	}
+	if err != nil {
+		s.log.Error("Failed to get current version within transaction", "error", err)
+		return nil, err
+	}
+	nextVersion := currentVersion - int64(len(pending)) + 1
+	if dryRun {
+		nextVersion = currentVersion + 1
+	}
+
+	// Stored observations are looked up once the versions are reserved, so pushes that
+	// reserved before this one have committed and their changes are seen. client_wins
+	// stores every record anyway.
+	var lastChanges map[string]StoredChange
+	if s.config.ConflictPolicy != "" && s.config.ConflictPolicy != ConflictClientWins && len(pending) > 0 {
+		ids := make([]string, len(pending))
+		for i, p := range pending {
+			ids[i] = p.record.ObservationID
+		}
+		if lastChanges, err = uow.Observations().LastChanges(ctx, ids); err != nil {
+			s.log.Error("Failed to look up stored observations", "error", err)
+			return nil, err
+		}
+	}
+	var conflicts []SyncConflict
+	notStored := make(map[string]bool)
+
+	// The user who first pushes a record owns it for /observations/mine
+	var submittedBy string
+	if user := authmw.GetUserFromContext(ctx); user != nil {
+		submittedBy = user.Username
+	}
+
+	for _, p := range pending {
+		record := p.record
+		version := nextVersion
+		nextVersion++
+
+		if change, ok := lastChanges[record.ObservationID]; ok {
+			if conflict := resolveConflict(s.config.ConflictPolicy, p.index, record, p.timestamps.updatedAt, change); conflict != nil {
+				conflicts = append(conflicts, *conflict)
+				switch conflict.Resolution {
+				case ResolutionSkipped:
+					notStored[record.ObservationID] = true
+					if dryRun {
+						outcomes = append(outcomes, RecordOutcome{Index: p.index, ObservationID: record.ObservationID, Outcome: OutcomeSkipped})
+					}
+					continue
+				case ResolutionRejected:
+					notStored[record.ObservationID] = true
+					failedRecords = append(failedRecords, map[string]interface{}{
+						"index":    p.index,
+						"code":     FailureConflict,
+						"error":    fmt.Sprintf("observation was changed on the server at version %d after version %d was pulled", change.Version, record.Version),
+						"conflict": *conflict,
+						"record":   record,
+					})
+					continue
+				}
+			}
+		}
+
+		// A failed write aborts the unit of work; a dry run goes on with the other
+		// records from a savepoint
+		if dryRun {
+			if err := uow.Savepoint(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		err := uow.Observations().Upsert(ctx, ObservationWrite{
+			Record:          record,
+			Version:         version,
+			CreatedAt:       p.timestamps.createdAt,
+			ClientUpdatedAt: p.timestamps.updatedAt,
+			Geolocation:     p.geolocation,
+			ClientID:        clientID,
+			SubmittedBy:     submittedBy,
+		})
+
+		if err != nil && dryRun && !database.IsTransient(err) {
+			if rollbackErr := uow.RollbackToSavepoint(ctx); rollbackErr != nil {
+				return nil, rollbackErr
+			}
+		}
 		if err != nil {
 			s.log.Error("Failed to insert/update observation", "error", err, "observationId", record.ObservationID)
+			// Reporting the record as failed would make the client give up on it; the whole
+			// push is retried instead
+			if database.IsTransient(err) {
+				return nil, fmt.Errorf("failed to insert/update observation: %w", err)
+			}
 			failedRecords = append(failedRecords, map[string]interface{}{
-				"index":  i,
+				"index":  p.index,
 				"error":  fmt.Sprintf("database error: %v", err),
 				"record": record,
 			})
@@ -265,28 +656,67 @@ func (s *Service) ProcessPushedRecords(ctx context.Context, records []Observatio
 		}
 
 		successCount++
+		if dryRun {
+			outcome := OutcomeCreate
+			if stored[record.ObservationID] {
+				outcome = OutcomeUpdate
+			}
+			outcomes = append(outcomes, RecordOutcome{Index: p.index, ObservationID: record.ObservationID, Outcome: outcome})
+		}
 	}
 
-	// Get the current version WITHIN the transaction to ensure consistency
-	var currentVersion int64
-	err = tx.QueryRowContext(ctx, "SELECT current_version FROM sync_version ORDER BY id DESC LIMIT 1").Scan(&currentVersion)
-	if err != nil {
-		s.log.Error("Failed to get current version within transaction", "error", err)
-		return nil, fmt.Errorf("failed to get current version: %w", err)
+	// Warnings about records that weren't stored would only confuse the dashboard
+	if len(notStored) > 0 {
+		kept := warnings[:0]
+		for _, w := range warnings {
+			if !notStored[w.ID] {
+				kept = append(kept, w)
+			}
+		}
+		warnings = kept
+	}
+
+	// A dry run leaves the unit of work to be rolled back
+	if dryRun {
+		s.log.Info("Checked pushed records (dry run)",
+			"transmissionId", transmissionID,
+			"clientId", clientID,
+			"totalRecords", len(records),
+			"successCount", successCount,
+			"failedCount", len(failedRecords),
+			"warningCount", len(warnings))
+		return &SyncPushResult{
+			CurrentVersion: currentVersion,
+			SuccessCount:   successCount,
+			FailedRecords:  failedRecords,
+			Warnings:       warnings,
+			DryRun:         true,
+			Outcomes:       failedOutcomes(outcomes, failedRecords),
+			Conflicts:      conflicts,
+		}, nil
+	}
+
+	// Warnings are tracked per client so recurring problems show up on the admin dashboard
+	if clientID != "" && len(warnings) > 0 {
+		if err := uow.Warnings().Record(ctx, clientID, transmissionID, warnings); err != nil {
+			s.log.Error("Failed to record sync warnings", "error", err)
+			return nil, err
+		}
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
+	if err := uow.Commit(); err != nil {
 		s.log.Error("Failed to commit transaction", "error", err)
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		// The commit may have gone through; retrying would store the records twice under
+		// new versions
+		return nil, database.NoRetry(err)
 	}
-	committed = true
 
 	result := &SyncPushResult{
 		CurrentVersion: currentVersion,
 		SuccessCount:   successCount,
 		FailedRecords:  failedRecords,
 		Warnings:       warnings,
+		Conflicts:      conflicts,
 	}
 
 	s.log.Info("Processed pushed records",
@@ -296,7 +726,17 @@ func (s *Service) ProcessPushedRecords(ctx context.Context, records []Observatio
 		"successCount", successCount,
 		"failedCount", len(failedRecords),
 		"warningCount", len(warnings),
+		"conflictCount", len(conflicts),
 		"currentVersion", currentVersion)
 
 	return result, nil
 }
+
+// formatWarningValue formats a field value for a warning message as JSON
+func formatWarningValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
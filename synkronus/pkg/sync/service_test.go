@@ -5,11 +5,18 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/pkg/calculation"
+	"github.com/opendataensemble/synkronus/pkg/database"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/observationlock"
+	"github.com/opendataensemble/synkronus/pkg/requiredattachment"
+	"github.com/opendataensemble/synkronus/pkg/strictschema"
 )
 
 // TestService_VersionIncrement tests that database operations correctly increment current_version
@@ -223,3 +230,450 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 	t.Skip("Test database not configured - implement setupTestDB for your environment")
 	return nil, func() {}
 }
+
+// TestService_ProcessPushedRecordsReservesVersions checks that versions are assigned by
+// the service with a single UPDATE ... RETURNING, without relying on a trigger
+func TestService_ProcessPushedRecordsReservesVersions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now().Format(time.RFC3339)
+	createdAt, _ := time.Parse(time.RFC3339, now)
+	createdAt = createdAt.UTC()
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+		{ObservationID: "", FormType: "survey"}, // rejected before versions are reserved
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version SET current_version = current_version \+ \$1, updated_at = NOW\(\) WHERE id = 1 RETURNING current_version`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(42)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-1", "survey", "1.0", sqlmock.AnyArg(), createdAt, false, nil, "client-1", int64(41), nil, createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-2", "survey", "1.0", sqlmock.AnyArg(), createdAt, false, nil, "client-1", int64(42), nil, createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.CurrentVersion != 42 || result.SuccessCount != 2 || len(result.FailedRecords) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	// Without a sync_version row the push fails instead of serving a stale version
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	if _, err := service.ProcessPushedRecords(context.Background(), records[:1], "client-1", "tx-2"); err == nil {
+		t.Errorf("Expected an error when sync_version has no row")
+	}
+}
+
+// TestService_ProcessPushedRecordsDryRun checks that a dry run stores nothing, reserves no
+// versions and reports an outcome for every record, also after a record fails
+func TestService_ProcessPushedRecordsDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-new", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+		{ObservationID: "", FormType: "survey"},
+		{ObservationID: "obs-bad", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+		{ObservationID: "obs-old", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT observation_id FROM observations WHERE observation_id = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id"}).AddRow("obs-old"))
+	mock.ExpectQuery(`SELECT current_version FROM sync_version WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(10)))
+	mock.ExpectExec(`SAVEPOINT dry_run_record`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-new", "survey", "1.0", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, "client-1", int64(11), nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SAVEPOINT dry_run_record`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-bad", "survey", "1.0", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, "client-1", int64(12), nil, sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "22P02", Message: "invalid input syntax"})
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT dry_run_record`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT dry_run_record`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-old", "survey", "1.0", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, "client-1", int64(13), nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	result, err := service.ProcessPushedRecords(WithDryRun(context.Background()), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to check records: %v", err)
+	}
+	if !result.DryRun || result.CurrentVersion != 10 || result.SuccessCount != 2 || len(result.FailedRecords) != 2 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	expected := []RecordOutcome{
+		{Index: 0, ObservationID: "obs-new", Outcome: OutcomeCreate},
+		{Index: 1, ObservationID: "", Outcome: OutcomeFailed},
+		{Index: 2, ObservationID: "obs-bad", Outcome: OutcomeFailed},
+		{Index: 3, ObservationID: "obs-old", Outcome: OutcomeUpdate},
+	}
+	if !reflect.DeepEqual(result.Outcomes, expected) {
+		t.Errorf("Expected outcomes %+v, got %+v", expected, result.Outcomes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestService_ProcessPushedRecordsRetriesFailover checks that a connection error while
+// storing a record retries the whole push instead of reporting the record as failed
+func TestService_ProcessPushedRecordsRetriesFailover(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	retryConfig := database.DefaultRetryConfig()
+	retryConfig.InitialBackoff = time.Millisecond
+	config.Retry = database.NewRetrier(retryConfig, logger.NewLogger())
+	service := NewService(db, config, logger.NewLogger())
+	now := time.Now().UTC().Format(time.RFC3339)
+	records := []Observation{{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(7)))
+	mock.ExpectExec(`INSERT INTO observations`).WillReturnError(&pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(7)))
+	mock.ExpectExec(`INSERT INTO observations`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 0 {
+		t.Errorf("Expected the record stored on the retry, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// fakeLocks reports every listed observation as held by a reviewer
+type fakeLocks map[string]observationlock.Lock
+
+func (f fakeLocks) HeldByOthers(ctx context.Context, observationIDs []string, username string) (map[string]observationlock.Lock, error) {
+	held := make(map[string]observationlock.Lock)
+	for _, id := range observationIDs {
+		if lock, ok := f[id]; ok && lock.Owner != username {
+			held[id] = lock
+		}
+	}
+	return held, nil
+}
+
+// TestService_ProcessPushedRecordsLocked checks that records locked for review by another
+// user fail with the LOCKED code and the lock, and get no version
+func TestService_ProcessPushedRecordsLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.Locks = fakeLocks{"obs-2": {ObservationID: "obs-2", Owner: "reviewer", ExpiresAt: time.Now().Add(time.Hour)}}
+	service := NewService(db, config, logger.NewLogger())
+	now := time.Now().UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(5)))
+	mock.ExpectExec(`INSERT INTO observations`).WithArgs("obs-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(5), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 1 {
+		t.Fatalf("Expected one stored and one locked record, got %+v", result)
+	}
+	failed := result.FailedRecords[0]
+	if failed["index"] != 1 || failed["code"] != FailureLocked || failed["lock"].(observationlock.Lock).Owner != "reviewer" {
+		t.Errorf("Unexpected failed record %+v", failed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// fakeCalculator doubles the "x" field into "doubled"
+type fakeCalculator struct{}
+
+func (fakeCalculator) Recompute(ctx context.Context, formType string, data json.RawMessage) (json.RawMessage, []calculation.Mismatch, error) {
+	if formType == "broken" {
+		return nil, nil, fmt.Errorf("broken formula")
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return data, nil, nil
+	}
+	var mismatches []calculation.Mismatch
+	server := object["x"].(float64) * 2
+	if client, ok := object["doubled"]; ok && client != server {
+		mismatches = append(mismatches, calculation.Mismatch{Field: "doubled", ClientValue: client, ServerValue: server})
+	}
+	object["doubled"] = server
+	recomputed, _ := json.Marshal(object)
+	return recomputed, mismatches, nil
+}
+
+// TestService_ProcessPushedRecordsRecomputesCalculations checks that pushed data is
+// stored with the calculator's values and that differing client values are flagged
+func TestService_ProcessPushedRecordsRecomputesCalculations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.Calculator = fakeCalculator{}
+	service := NewService(db, config, logger.NewLogger())
+	now := time.Now().Format(time.RFC3339)
+	createdAt, _ := time.Parse(time.RFC3339, now)
+	createdAt = createdAt.UTC()
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{"x":2,"doubled":5}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "broken", FormVersion: "1.0", Data: json.RawMessage(`{"x":2}`), CreatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(2)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-1", "survey", "1.0", json.RawMessage(`{"doubled":4,"x":2}`), createdAt, false, nil, "client-1", int64(1), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// A calculator error keeps the data as pushed
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-2", "broken", "1.0", json.RawMessage(`{"x":2}`), createdAt, false, nil, "client-1", int64(2), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningCalculationMismatch, SeverityInfo, "doubled was 5, server computed 4").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 2 || len(result.Warnings) != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	warning := result.Warnings[0]
+	if warning.ID != "obs-1" || warning.Code != WarningCalculationMismatch || warning.Message != "doubled was 5, server computed 4" {
+		t.Errorf("Unexpected warning: %+v", warning)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// fakeSchemas checks data against schemas by form type
+type fakeSchemas map[string]string
+
+func (f fakeSchemas) Check(formType string, data json.RawMessage) (*strictschema.Result, error) {
+	schema, err := strictschema.ParseSchema([]byte(f[formType]))
+	if err != nil {
+		return nil, err
+	}
+	return schema.Check(data)
+}
+
+// TestService_ProcessPushedRecordsChecksUnknownKeys checks that strict forms strip or
+// reject data keys their schema doesn't declare
+func TestService_ProcessPushedRecordsChecksUnknownKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.Schemas = fakeSchemas{
+		"strip":  `{"x-unknown-keys":"strip","properties":{"name":{"type":"string"}}}`,
+		"reject": `{"x-unknown-keys":"reject","properties":{"name":{"type":"string"}}}`,
+		"open":   `{"properties":{"name":{"type":"string"}}}`,
+	}
+	service := NewService(db, config, logger.NewLogger())
+	now := time.Now().Format(time.RFC3339)
+	createdAt, _ := time.Parse(time.RFC3339, now)
+	createdAt = createdAt.UTC()
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "strip", FormVersion: "1.0", Data: json.RawMessage(`{"name":"a","Name":"a"}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "reject", FormVersion: "1.0", Data: json.RawMessage(`{"name":"b","extra":1}`), CreatedAt: now},
+		{ObservationID: "obs-3", FormType: "open", FormVersion: "1.0", Data: json.RawMessage(`{"name":"c","extra":1}`), CreatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(2)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-1", "strip", "1.0", json.RawMessage(`{"name":"a"}`), createdAt, false, nil, "client-1", int64(1), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-3", "open", "1.0", json.RawMessage(`{"name":"c","extra":1}`), createdAt, false, nil, "client-1", int64(2), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningUnknownKeysStripped, SeverityWarning, "removed data keys not in the strip schema: Name").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 2 || len(result.Warnings) != 1 || len(result.FailedRecords) != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if failed := result.FailedRecords[0]; failed["index"] != 1 || failed["error"] != "data keys not in the reject schema: extra" {
+		t.Errorf("Unexpected failed record: %+v", failed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// fakeAttachments reports the photo field of "consent" records as missing or pending
+type fakeAttachments struct{}
+
+func (fakeAttachments) Check(ctx context.Context, formType string, data json.RawMessage) (*requiredattachment.Result, error) {
+	result := &requiredattachment.Result{Deadline: time.Date(2025, 6, 1, 13, 0, 0, 0, time.UTC)}
+	if formType != "consent" {
+		return result, nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if id, ok := object["photo"].(string); ok {
+		result.Pending = append(result.Pending, requiredattachment.Pending{Field: "photo", AttachmentID: id})
+	} else {
+		result.Missing = append(result.Missing, "photo")
+	}
+	return result, nil
+}
+
+// TestService_ProcessPushedRecordsChecksRequiredAttachments checks that records lacking
+// required attachments are stored with warnings
+func TestService_ProcessPushedRecordsChecksRequiredAttachments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.Attachments = fakeAttachments{}
+	service := NewService(db, config, logger.NewLogger())
+	now := time.Now().Format(time.RFC3339)
+	createdAt, _ := time.Parse(time.RFC3339, now)
+	createdAt = createdAt.UTC()
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "consent", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now},
+		{ObservationID: "obs-2", FormType: "consent", FormVersion: "1.0", Data: json.RawMessage(`{"photo":"p.jpg"}`), CreatedAt: now},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(2)))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-1", "consent", "1.0", json.RawMessage(`{}`), createdAt, false, nil, "client-1", int64(1), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observations`).
+		WithArgs("obs-2", "consent", "1.0", json.RawMessage(`{"photo":"p.jpg"}`), createdAt, false, nil, "client-1", int64(2), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningAttachmentMissing, SeverityWarning, "photo requires an attachment but has none").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-2", WarningAttachmentPending, SeverityInfo, "photo refers to attachment p.jpg, which must be uploaded by 2025-06-01T13:00:00Z").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(8)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 2 || len(result.Warnings) != 2 || len(result.FailedRecords) != 0 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_CachedStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.Statements = database.NewStatementCache(db, 16)
+	service := NewService(db, config, logger.NewLogger())
+	ctx := context.Background()
+	columns := []string{"observation_id", "form_type", "form_version", "data", "created_at", "updated_at", "synced_at", "deleted", "version"}
+
+	// Every query of the first pull is prepared; the second pull reuses the statements
+	current := mock.ExpectPrepare(`SELECT current_version FROM sync_version`)
+	current.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(5)))
+	minVersion := mock.ExpectPrepare(`SELECT min_version FROM sync_version`)
+	minVersion.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	pull := mock.ExpectPrepare(`WHERE version > \$1 ORDER BY version ASC, observation_id ASC LIMIT \$2`)
+	pull.ExpectQuery().WithArgs(int64(0), 11).WillReturnRows(sqlmock.NewRows(columns))
+	current.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(5)))
+	minVersion.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"min_version"}).AddRow(int64(0)))
+	pull.ExpectQuery().WithArgs(int64(3), 11).WillReturnRows(sqlmock.NewRows(columns))
+
+	for _, since := range []int64{0, 3} {
+		if _, err := service.GetRecordsSinceVersion(ctx, since, "client-1", nil, 10, nil); err != nil {
+			t.Fatalf("GetRecordsSinceVersion: %v", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if n := config.Statements.Len(); n != 3 {
+		t.Errorf("Expected 3 cached statements, got %d", n)
+	}
+}
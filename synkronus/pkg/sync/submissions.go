@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Statuses of a submitted observation
+const (
+	// SubmissionSynced observations are stored on the server and need no attention
+	SubmissionSynced = "synced"
+	// SubmissionReviewed observations were corrected by an administrator after they were pushed
+	SubmissionReviewed = "reviewed"
+	// SubmissionFlagged observations have unacknowledged sync warnings that need a look
+	SubmissionFlagged = "flagged"
+)
+
+// SubmissionQuery selects the observations a user submitted
+type SubmissionQuery struct {
+	Username string
+	FormType string
+	// Status limits the result to one of the Submission* statuses
+	Status string
+	// Since and Until bound the observations' created_at; Until is exclusive
+	Since *time.Time
+	Until *time.Time
+	Limit int
+	// Offset skips that many observations of the result
+	Offset int
+}
+
+// Submission is an observation as its submitter sees it in their own records
+type Submission struct {
+	ObservationID string    `json:"observation_id"`
+	FormType      string    `json:"form_type"`
+	FormVersion   string    `json:"form_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int64     `json:"version"`
+	Status        string    `json:"status"`
+	// Flags are the codes of the unacknowledged warnings that flag the observation
+	Flags []string `json:"flags,omitempty"`
+}
+
+// SubmissionPage is one page of a user's submissions
+type SubmissionPage struct {
+	Submissions []Submission
+	HasMore     bool
+}
+
+// ValidSubmissionStatus reports whether status is one of the Submission* statuses
+func ValidSubmissionStatus(status string) bool {
+	switch status {
+	case SubmissionSynced, SubmissionReviewed, SubmissionFlagged:
+		return true
+	}
+	return false
+}
+
+// ListSubmissions lists the observations a user submitted, newest first
+func (s *Service) ListSubmissions(ctx context.Context, query SubmissionQuery) (_ *SubmissionPage, err error) {
+	ctx, span := tracing.Start(ctx, "sync.ListSubmissions",
+		attribute.String("sync.form_type", query.FormType),
+		attribute.String("sync.submission_status", query.Status),
+		attribute.Int("sync.limit", query.Limit),
+		attribute.Int("sync.offset", query.Offset),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if query.Username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = s.config.DefaultLimit
+	}
+
+	// One extra row tells whether there is another page
+	submissions, err := s.store.Observations().Submissions(ctx, query, limit+1)
+	if err != nil {
+		s.log.Error("Failed to query submissions", "error", err, "username", query.Username)
+		return nil, err
+	}
+
+	page := &SubmissionPage{Submissions: submissions}
+	if len(page.Submissions) > limit {
+		page.Submissions = page.Submissions[:limit]
+		page.HasMore = true
+	}
+	span.SetAttributes(attribute.Int("sync.submission_count", len(page.Submissions)))
+	return page, nil
+}
@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+// TestService_ProcessPushedRecordsSubmittedBy checks that a push records the pushing user
+func TestService_ProcessPushedRecordsSubmittedBy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now().UTC().Format(time.RFC3339)
+	createdAt, _ := time.Parse(time.RFC3339, now)
+	createdAt = createdAt.UTC()
+	records := []Observation{{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(5)))
+	mock.ExpectExec(`INSERT INTO observations .*submitted_by = COALESCE\(observations.submitted_by, EXCLUDED.submitted_by\)`).
+		WithArgs("obs-1", "survey", "1.0", sqlmock.AnyArg(), createdAt, false, nil, "client-1", int64(5), "enumerator", createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "enumerator"})
+	if _, err := service.ProcessPushedRecords(ctx, records, "client-1", "tx-1"); err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_ListSubmissions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	since := time.Date(2025, 9, 14, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 0, 1)
+	created := since.Add(9 * time.Hour)
+	columns := []string{"observation_id", "form_type", "form_version", "created_at", "updated_at", "version", "status", "flags"}
+
+	mock.ExpectQuery(`FROM observations o\s+LEFT JOIN LATERAL .* WHERE o.submitted_by = \$1 AND NOT o.deleted AND o.form_type = \$2 AND o.created_at >= \$3 AND o.created_at < \$4\s+\) submissions\s+WHERE status = \$5\s+ORDER BY created_at DESC, observation_id DESC\s+LIMIT \$6 OFFSET \$7`).
+		WithArgs("enumerator", "household", since, until, SubmissionFlagged, 3, 4).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("obs-3", "household", "1.0", created, created, int64(9), SubmissionFlagged, "{CLOCK_SKEW,MISSING_FORM_TYPE}").
+			AddRow("obs-2", "household", "1.0", created, created, int64(8), SubmissionFlagged, "{CLOCK_SKEW}").
+			AddRow("obs-1", "household", "1.0", created, created, int64(7), SubmissionFlagged, "{CLOCK_SKEW}"))
+
+	page, err := service.ListSubmissions(context.Background(), SubmissionQuery{
+		Username: "enumerator", FormType: "household", Status: SubmissionFlagged,
+		Since: &since, Until: &until, Limit: 2, Offset: 4,
+	})
+	if err != nil {
+		t.Fatalf("ListSubmissions: %v", err)
+	}
+	if len(page.Submissions) != 2 || !page.HasMore {
+		t.Fatalf("Expected 2 submissions and another page, got %+v", page)
+	}
+	if flags := page.Submissions[0].Flags; len(flags) != 2 || flags[1] != WarningMissingFormType {
+		t.Errorf("Unexpected flags %v", flags)
+	}
+
+	mock.ExpectQuery(`WHERE o.submitted_by = \$1 AND NOT o.deleted\s+\) submissions\s+ORDER BY`).
+		WithArgs("enumerator", 101, 0).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("obs-1", "household", "1.0", created, created, int64(7), SubmissionSynced, "{}"))
+
+	page, err = service.ListSubmissions(context.Background(), SubmissionQuery{Username: "enumerator"})
+	if err != nil {
+		t.Fatalf("ListSubmissions: %v", err)
+	}
+	if len(page.Submissions) != 1 || page.HasMore || page.Submissions[0].Flags != nil || page.Submissions[0].Status != SubmissionSynced {
+		t.Errorf("Unexpected page %+v", page)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -109,6 +109,7 @@ func ensureTestSchema(db *sql.DB) error {
 	dropQueries := []string{
 		"DROP TRIGGER IF EXISTS observations_version_trigger ON observations",
 		"DROP FUNCTION IF EXISTS update_sync_version()",
+		"DROP TABLE IF EXISTS sync_warnings",
 		"DROP TABLE IF EXISTS observations",
 		"DROP TABLE IF EXISTS sync_version",
 	}
@@ -143,7 +144,7 @@ func ensureTestSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to enable uuid-ossp extension: %w", err)
 	}
 
-	// Create observations table
+	// Create observations table. Versions are assigned by the sync service, not by a trigger.
 	observationsSQL := `
 		CREATE TABLE observations (
 			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -155,35 +156,31 @@ func ensureTestSchema(db *sql.DB) error {
 			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 			synced_at TIMESTAMP WITH TIME ZONE,
 			deleted BOOLEAN NOT NULL DEFAULT FALSE,
-			version BIGINT NOT NULL DEFAULT 1
+			version BIGINT NOT NULL DEFAULT 1,
+			geolocation JSONB,
+			client_id VARCHAR(255)
 		)
 	`
 	if _, err := db.Exec(observationsSQL); err != nil {
 		return fmt.Errorf("failed to create observations table: %w", err)
 	}
 
-	// Create trigger function
-	triggerFunctionSQL := `
-		CREATE OR REPLACE FUNCTION update_sync_version() RETURNS TRIGGER AS $$
-		BEGIN
-			UPDATE sync_version SET current_version = current_version + 1, updated_at = CURRENT_TIMESTAMP;
-			NEW.version = (SELECT current_version FROM sync_version ORDER BY id DESC LIMIT 1);
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-	`
-	if _, err := db.Exec(triggerFunctionSQL); err != nil {
-		return fmt.Errorf("failed to create trigger function: %w", err)
-	}
-
-	// Create trigger
-	triggerSQL := `
-		CREATE TRIGGER observations_version_trigger
-			BEFORE INSERT OR UPDATE ON observations
-			FOR EACH ROW EXECUTE FUNCTION update_sync_version();
+	// Create sync_warnings table; pushes record their warnings per client
+	syncWarningsSQL := `
+		CREATE TABLE sync_warnings (
+			id BIGSERIAL PRIMARY KEY,
+			client_id VARCHAR(255) NOT NULL,
+			transmission_id VARCHAR(255),
+			observation_id VARCHAR(255),
+			code VARCHAR(64) NOT NULL,
+			severity VARCHAR(16) NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			acknowledged_at TIMESTAMP WITH TIME ZONE
+		)
 	`
-	if _, err := db.Exec(triggerSQL); err != nil {
-		return fmt.Errorf("failed to create trigger: %w", err)
+	if _, err := db.Exec(syncWarningsSQL); err != nil {
+		return fmt.Errorf("failed to create sync_warnings table: %w", err)
 	}
 
 	return nil
@@ -195,6 +192,9 @@ func ResetTestData(db *sql.DB) error {
 	if _, err := db.Exec("DELETE FROM observations"); err != nil {
 		return fmt.Errorf("failed to clean observations: %w", err)
 	}
+	if _, err := db.Exec("DELETE FROM sync_warnings"); err != nil {
+		return fmt.Errorf("failed to clean sync warnings: %w", err)
+	}
 
 	// Reset sync version
 	if _, err := db.Exec("UPDATE sync_version SET current_version = 1, updated_at = CURRENT_TIMESTAMP"); err != nil {
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampFormat decides which created_at/updated_at formats a push accepts
+type TimestampFormat string
+
+const (
+	// TimestampStrict accepts RFC3339 timestamps only
+	TimestampStrict TimestampFormat = "strict"
+	// TimestampLenient also accepts common other formats, which are normalized and reported
+	// with a TIMESTAMP_NORMALIZED warning
+	TimestampLenient TimestampFormat = "lenient"
+)
+
+// FutureTimestampPolicy decides what happens to a record whose timestamps are ahead of
+// the server clock by more than the clock skew tolerance
+type FutureTimestampPolicy string
+
+const (
+	// FutureWarn stores the record with a CLOCK_SKEW warning
+	FutureWarn FutureTimestampPolicy = "warn"
+	// FutureReject fails the record
+	FutureReject FutureTimestampPolicy = "reject"
+)
+
+// ParseTimestampFormat parses a timestamp format name; empty yields TimestampLenient
+func ParseTimestampFormat(name string) (TimestampFormat, error) {
+	switch format := TimestampFormat(strings.ToLower(strings.TrimSpace(name))); format {
+	case "":
+		return TimestampLenient, nil
+	case TimestampStrict, TimestampLenient:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid timestamp format %q: expected strict or lenient", name)
+	}
+}
+
+// ParseFutureTimestampPolicy parses a future timestamp policy name; empty yields FutureWarn
+func ParseFutureTimestampPolicy(name string) (FutureTimestampPolicy, error) {
+	switch policy := FutureTimestampPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return FutureWarn, nil
+	case FutureWarn, FutureReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid future timestamp policy %q: expected warn or reject", name)
+	}
+}
+
+// lenientLayouts are the formats besides RFC3339 accepted in lenient mode. Layouts
+// without a zone are read as UTC; fractional seconds are accepted by all of them.
+var lenientLayouts = []string{
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseTimestamp parses a pushed timestamp and reports whether it was in a format other
+// than RFC3339. Numbers are read as Unix time, in milliseconds when they are large
+// enough to be (as JavaScript's Date.now() returns).
+func parseTimestamp(value string, format TimestampFormat) (t time.Time, normalized bool, err error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), false, nil
+	}
+	if format == TimestampStrict {
+		return time.Time{}, false, fmt.Errorf("%q is not an RFC3339 timestamp", value)
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n >= 1e11 || n <= -1e11 {
+			return time.UnixMilli(n).UTC(), true, nil
+		}
+		return time.Unix(n, 0).UTC(), true, nil
+	}
+	for _, layout := range lenientLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a recognized timestamp", value)
+}
+
+// normalizedTimestamps holds the parsed timestamps of a pushed record
+type normalizedTimestamps struct {
+	createdAt time.Time
+	// updatedAt is nil when the record has no updated_at
+	updatedAt *time.Time
+	// normalized lists the fields that were not RFC3339
+	normalized []string
+}
+
+// normalizeTimestamps validates created_at and updated_at of a record and rewrites them
+// as RFC3339 in UTC
+func (s *Service) normalizeTimestamps(record *Observation) (*normalizedTimestamps, error) {
+	if record.CreatedAt == "" {
+		return nil, fmt.Errorf("created_at is required")
+	}
+
+	ts := &normalizedTimestamps{}
+	createdAt, normalized, err := parseTimestamp(record.CreatedAt, s.config.TimestampFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid created_at: %w", err)
+	}
+	ts.createdAt = createdAt
+	record.CreatedAt = createdAt.Format(time.RFC3339Nano)
+	if normalized {
+		ts.normalized = append(ts.normalized, "created_at")
+	}
+
+	if record.UpdatedAt != "" {
+		updatedAt, normalized, err := parseTimestamp(record.UpdatedAt, s.config.TimestampFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid updated_at: %w", err)
+		}
+		ts.updatedAt = &updatedAt
+		record.UpdatedAt = updatedAt.Format(time.RFC3339Nano)
+		if normalized {
+			ts.normalized = append(ts.normalized, "updated_at")
+		}
+	}
+	return ts, nil
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	utc := time.Date(2025, 9, 14, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		value      string
+		format     TimestampFormat
+		expected   time.Time
+		normalized bool
+		wantErr    bool
+	}{
+		{"rfc3339 utc", "2025-09-14T07:30:00Z", TimestampStrict, utc, false, false},
+		{"rfc3339 offset", "2025-09-14T10:30:00+03:00", TimestampStrict, utc, false, false},
+		{"rfc3339 fraction", "2025-09-14T07:30:00.250Z", TimestampStrict, utc.Add(250 * time.Millisecond), false, false},
+		{"space separated in strict mode", "2025-09-14 07:30:00", TimestampStrict, time.Time{}, false, true},
+		{"space separated", "2025-09-14 07:30:00", TimestampLenient, utc, true, false},
+		{"zone without colon", "2025-09-14T10:30:00+0300", TimestampLenient, utc, true, false},
+		{"no zone with fraction", "2025-09-14T07:30:00.5", TimestampLenient, utc.Add(500 * time.Millisecond), true, false},
+		{"unix milliseconds", "1757835000000", TimestampLenient, utc, true, false},
+		{"unix seconds", "1757835000", TimestampLenient, utc, true, false},
+		{"date", "2025-09-14", TimestampLenient, utc.Truncate(24 * time.Hour), true, false},
+		{"garbage", "yesterday", TimestampLenient, time.Time{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, normalized, err := parseTimestamp(tt.value, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) || got.Location() != time.UTC || normalized != tt.normalized {
+				t.Errorf("Expected %s (normalized %v), got %s (normalized %v)", tt.expected, tt.normalized, got, normalized)
+			}
+		})
+	}
+}
+
+func TestParseTimestampOptions(t *testing.T) {
+	if format, err := ParseTimestampFormat(""); err != nil || format != TimestampLenient {
+		t.Errorf("Expected lenient by default, got %q (%v)", format, err)
+	}
+	if format, err := ParseTimestampFormat(" Strict "); err != nil || format != TimestampStrict {
+		t.Errorf("Expected strict, got %q (%v)", format, err)
+	}
+	if _, err := ParseTimestampFormat("loose"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if policy, err := ParseFutureTimestampPolicy(""); err != nil || policy != FutureWarn {
+		t.Errorf("Expected warn by default, got %q (%v)", policy, err)
+	}
+	if _, err := ParseFutureTimestampPolicy("ignore"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+// TestService_ProcessPushedRecordsTimestamps checks that pushed timestamps are validated,
+// normalized to UTC and stored as timestamps
+func TestService_ProcessPushedRecordsTimestamps(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := DefaultConfig()
+	config.FutureTimestampPolicy = FutureReject
+	service := NewService(db, config, logger.NewLogger())
+	future := time.Now().Add(3 * time.Hour).UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "2025-09-14 10:30:00+03:00", UpdatedAt: "2025-09-14T08:00:00+03:00"},
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "soon"},
+		{ObservationID: "obs-3", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: future, UpdatedAt: future},
+		{ObservationID: "obs-4", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`)},
+	}
+
+	createdAt := time.Date(2025, 9, 14, 7, 30, 0, 0, time.UTC)
+	updatedAt := time.Date(2025, 9, 14, 5, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(3)))
+	mock.ExpectExec(`INSERT INTO observations .*client_updated_at = EXCLUDED.client_updated_at`).
+		WithArgs("obs-1", "survey", "1.0", sqlmock.AnyArg(), createdAt, false, nil, "client-1", int64(3), nil, updatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningTimestampNormalized, SeverityInfo, "created_at converted to RFC3339 in UTC").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 1 || len(result.FailedRecords) != 3 {
+		t.Fatalf("Expected 1 stored and 3 failed records, got %+v", result)
+	}
+	for i, expected := range []string{"invalid created_at", "ahead of the server clock", "created_at is required"} {
+		if message := result.FailedRecords[i]["error"].(string); !strings.Contains(message, expected) {
+			t.Errorf("Expected failure %d to mention %q, got %q", i, expected, message)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
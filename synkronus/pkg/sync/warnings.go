@@ -0,0 +1,191 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Severities of a sync warning
+const (
+	// SeverityInfo warnings are informational: the server corrected the record
+	SeverityInfo = "info"
+	// SeverityWarning warnings point to a client problem that should be looked into
+	SeverityWarning = "warning"
+	// SeverityError warnings mean data was stored but is likely wrong
+	SeverityError = "error"
+)
+
+// WarningDefinition documents a warning code
+type WarningDefinition struct {
+	Code        string `json:"code"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+}
+
+// WarningCatalog lists every warning code a push can return
+var WarningCatalog = []WarningDefinition{
+	{
+		Code:        WarningMissingFormType,
+		Severity:    SeverityWarning,
+		Description: "The record was pushed without form_type. It was stored, but can't be exported or validated per form.",
+	},
+	{
+		Code:        WarningCalculationMismatch,
+		Severity:    SeverityInfo,
+		Description: "A submitted x-calculated field differed from the value computed by the server; the server's value was stored.",
+	},
+	{
+		Code:        WarningClockSkew,
+		Severity:    SeverityWarning,
+		Description: "The record's updated_at is ahead of the server clock; the device clock is probably wrong.",
+	},
+	{
+		Code:        WarningClockAnomaly,
+		Severity:    SeverityWarning,
+		Description: "The record's updated_at is before that of the stored observation it edits, although the device had pulled that one; the device clock was probably reset. The edit is stored as the newer one, ordered by server version.",
+	},
+	{
+		Code:        WarningTimestampNormalized,
+		Severity:    SeverityInfo,
+		Description: "The record's created_at or updated_at was not RFC3339; the server converted it to RFC3339 in UTC.",
+	},
+	{
+		Code:        WarningUnknownKeysStripped,
+		Severity:    SeverityWarning,
+		Description: "The record's data had keys its form schema doesn't declare (x-unknown-keys: strip); they were removed before storing.",
+	},
+	{
+		Code:        WarningAttachmentMissing,
+		Severity:    SeverityWarning,
+		Description: "A field the form schema tags x-attachment-required (e.g. a consent photo) has no attachment. The record was stored and counts as missing media in the completeness report.",
+	},
+	{
+		Code:        WarningAttachmentPending,
+		Severity:    SeverityInfo,
+		Description: "A field tagged x-attachment-required refers to an attachment that isn't uploaded yet. If it isn't uploaded within the grace window, the record counts as missing media in the completeness report.",
+	},
+}
+
+// LookupWarning returns the catalog entry of a warning code
+func LookupWarning(code string) (WarningDefinition, bool) {
+	for _, def := range WarningCatalog {
+		if def.Code == code {
+			return def, true
+		}
+	}
+	return WarningDefinition{}, false
+}
+
+// newWarning builds a warning with the severity from the catalog
+func newWarning(observationID, code, message string) SyncWarning {
+	severity := SeverityWarning
+	if def, ok := LookupWarning(code); ok {
+		severity = def.Severity
+	}
+	return SyncWarning{ID: observationID, Code: code, Severity: severity, Message: message}
+}
+
+// clockSkew reports how far a record's updated_at (or created_at, when updated_at is
+// missing) is ahead of now; zero when it isn't or the timestamp doesn't parse
+func clockSkew(record Observation, now time.Time) time.Duration {
+	timestamp := record.UpdatedAt
+	if timestamp == "" {
+		timestamp = record.CreatedAt
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return 0
+	}
+	if skew := t.Sub(now); skew > 0 {
+		return skew
+	}
+	return 0
+}
+
+// clockAnomaly reports an edit whose updated_at is before the client updated_at of the
+// stored observation it replaces, although its version shows the device had pulled the
+// stored one. Such an edit is newer whatever its timestamp says.
+func clockAnomaly(record Observation, updatedAt *time.Time, stored StoredChange) (string, bool) {
+	if updatedAt == nil || stored.ClientUpdatedAt == nil || record.Version <= 0 || record.Version < stored.Version {
+		return "", false
+	}
+	if !updatedAt.Before(*stored.ClientUpdatedAt) {
+		return "", false
+	}
+	return fmt.Sprintf("updated_at %s is before %s of the stored version %d this edit is based on",
+		updatedAt.Format(time.RFC3339), stored.ClientUpdatedAt.UTC().Format(time.RFC3339), stored.Version), true
+}
+
+// WarningAck selects the warnings of a client to acknowledge: those with one of the
+// IDs and those with one of the codes
+type WarningAck struct {
+	IDs   []int64
+	Codes []string
+}
+
+// WarningQuery filters the warning summary
+type WarningQuery struct {
+	ClientID string
+	Code     string
+	// IncludeAcknowledged also lists client/code pairs whose warnings were all acknowledged
+	IncludeAcknowledged bool
+}
+
+// WarningSummary counts the warnings of one code recorded for one client
+type WarningSummary struct {
+	ClientID       string    `json:"client_id"`
+	Code           string    `json:"code"`
+	Severity       string    `json:"severity"`
+	Total          int64     `json:"total"`
+	Unacknowledged int64     `json:"unacknowledged"`
+	FirstSeenAt    time.Time `json:"first_seen_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	LastMessage    string    `json:"last_message"`
+}
+
+// AcknowledgeWarnings marks warnings of a client as acknowledged and returns how many
+// were not acknowledged before
+func (s *Service) AcknowledgeWarnings(ctx context.Context, clientID string, ack WarningAck) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "sync.AcknowledgeWarnings",
+		attribute.String("sync.client_id", clientID),
+		attribute.Int("sync.warning_id_count", len(ack.IDs)),
+		attribute.StringSlice("sync.warning_codes", ack.Codes),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if len(ack.IDs) == 0 && len(ack.Codes) == 0 {
+		return 0, nil
+	}
+
+	acknowledged, err := s.store.Warnings().Acknowledge(ctx, clientID, ack)
+	if err != nil {
+		s.log.Error("Failed to acknowledge sync warnings", "error", err, "clientId", clientID)
+		return 0, err
+	}
+
+	s.log.Info("Acknowledged sync warnings", "clientId", clientID, "count", acknowledged)
+	return acknowledged, nil
+}
+
+// GetWarningSummary counts the recorded warnings per client and code, clients with the
+// most unacknowledged warnings first
+func (s *Service) GetWarningSummary(ctx context.Context, query WarningQuery) (_ []WarningSummary, err error) {
+	ctx, span := tracing.Start(ctx, "sync.GetWarningSummary",
+		attribute.String("sync.client_id", query.ClientID),
+		attribute.String("sync.warning_code", query.Code),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	summaries, err := s.store.Warnings().Summary(ctx, query)
+	if err != nil {
+		s.log.Error("Failed to query sync warnings", "error", err)
+		return nil, err
+	}
+	return summaries, nil
+}
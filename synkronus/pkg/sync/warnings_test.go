@@ -0,0 +1,225 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+)
+
+func TestWarningCatalog(t *testing.T) {
+	seen := map[string]bool{}
+	for _, def := range WarningCatalog {
+		if seen[def.Code] {
+			t.Errorf("Duplicate catalog entry %s", def.Code)
+		}
+		seen[def.Code] = true
+		switch def.Severity {
+		case SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			t.Errorf("%s has unknown severity %q", def.Code, def.Severity)
+		}
+		if def.Description == "" {
+			t.Errorf("%s has no description", def.Code)
+		}
+	}
+	for _, code := range []string{WarningMissingFormType, WarningCalculationMismatch, WarningClockSkew, WarningTimestampNormalized} {
+		if !seen[code] {
+			t.Errorf("%s is missing from the catalog", code)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	now := time.Date(2025, 9, 11, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		record   Observation
+		expected time.Duration
+	}{
+		{"in the past", Observation{UpdatedAt: "2025-09-11T11:00:00Z"}, 0},
+		{"ahead", Observation{UpdatedAt: "2025-09-11T14:00:00Z"}, 2 * time.Hour},
+		{"ahead in another zone", Observation{UpdatedAt: "2025-09-11T15:30:00+03:00"}, 30 * time.Minute},
+		{"created_at without updated_at", Observation{CreatedAt: "2025-09-11T12:10:00Z"}, 10 * time.Minute},
+		{"unparseable", Observation{UpdatedAt: "yesterday"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clockSkew(tt.record, now); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestService_ProcessPushedRecordsRecordsWarnings checks that push warnings carry a
+// severity and are stored for the client
+func TestService_ProcessPushedRecordsRecordsWarnings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	now := time.Now().UTC().Format(time.RFC3339)
+	future := time.Now().Add(3 * time.Hour).UTC().Format(time.RFC3339)
+	records := []Observation{
+		{ObservationID: "obs-1", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: now, UpdatedAt: now},
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: future, UpdatedAt: future},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(2)))
+	mock.ExpectExec(`INSERT INTO observations`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO observations`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningMissingFormType, SeverityWarning, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(10)))
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-2", WarningClockSkew, SeverityWarning, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(11)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if len(result.Warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %+v", result.Warnings)
+	}
+	if w := result.Warnings[0]; w.WarningID != 10 || w.Code != WarningMissingFormType || w.Severity != SeverityWarning {
+		t.Errorf("Unexpected warning: %+v", w)
+	}
+	if w := result.Warnings[1]; w.WarningID != 11 || w.Code != WarningClockSkew || w.ID != "obs-2" {
+		t.Errorf("Unexpected warning: %+v", w)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_ProcessPushedRecordsClockAnomaly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	storedAt := time.Date(2025, 9, 14, 10, 0, 0, 0, time.UTC)
+	records := []Observation{
+		// Edited after pulling version 5, on a device whose clock went back to January
+		{ObservationID: "obs-1", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "2025-01-01T08:00:00Z", UpdatedAt: "2025-01-01T09:00:00Z", Version: 5},
+		// Based on version 3 while the server has 7: a concurrent edit, not a clock reset
+		{ObservationID: "obs-2", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "2025-01-01T08:00:00Z", UpdatedAt: "2025-01-01T09:00:00Z", Version: 3},
+		// Dated after the stored change
+		{ObservationID: "obs-3", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "2025-09-14T08:00:00Z", UpdatedAt: "2025-09-15T09:00:00Z", Version: 6},
+		// New on the device
+		{ObservationID: "obs-4", FormType: "survey", FormVersion: "1.0", Data: json.RawMessage(`{}`), CreatedAt: "2025-01-01T08:00:00Z", UpdatedAt: "2025-01-01T09:00:00Z"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT observation_id, version, client_updated_at, updated_at FROM observations WHERE observation_id = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"observation_id", "version", "client_updated_at", "updated_at"}).
+			AddRow("obs-1", int64(5), storedAt, storedAt).
+			AddRow("obs-2", int64(7), storedAt, storedAt).
+			AddRow("obs-3", int64(6), storedAt, storedAt))
+	mock.ExpectQuery(`UPDATE sync_version`).WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(int64(11)))
+	for range records {
+		mock.ExpectExec(`INSERT INTO observations`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectQuery(`INSERT INTO sync_warnings`).
+		WithArgs("client-1", "tx-1", "obs-1", WarningClockAnomaly, SeverityWarning, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(12)))
+	mock.ExpectCommit()
+
+	result, err := service.ProcessPushedRecords(context.Background(), records, "client-1", "tx-1")
+	if err != nil {
+		t.Fatalf("Failed to process records: %v", err)
+	}
+	if result.SuccessCount != 4 || len(result.Warnings) != 1 {
+		t.Fatalf("Expected 4 stored records and one warning, got %+v", result)
+	}
+	if w := result.Warnings[0]; w.ID != "obs-1" || w.Code != WarningClockAnomaly || !strings.Contains(w.Message, "stored version 5") {
+		t.Errorf("Unexpected warning: %+v", w)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_AcknowledgeWarnings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+
+	mock.ExpectExec(`UPDATE sync_warnings SET acknowledged_at = NOW\(\)\s+WHERE client_id = \$1 AND acknowledged_at IS NULL`).
+		WithArgs("client-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	acknowledged, err := service.AcknowledgeWarnings(context.Background(), "client-1", WarningAck{IDs: []int64{1, 2}, Codes: []string{WarningClockSkew}})
+	if err != nil {
+		t.Fatalf("Failed to acknowledge warnings: %v", err)
+	}
+	if acknowledged != 3 {
+		t.Errorf("Expected 3 acknowledged, got %d", acknowledged)
+	}
+
+	// Nothing selected doesn't touch the database
+	if acknowledged, err := service.AcknowledgeWarnings(context.Background(), "client-1", WarningAck{}); err != nil || acknowledged != 0 {
+		t.Errorf("Expected no acknowledgement, got %d, %v", acknowledged, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_GetWarningSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	service := NewService(db, DefaultConfig(), logger.NewLogger())
+	first := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	last := time.Date(2025, 9, 11, 8, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM sync_warnings\s+WHERE client_id = \$1 AND code = \$2\s+GROUP BY client_id, code\s+HAVING`).
+		WithArgs("client-1", WarningClockSkew).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "code", "severity", "total", "unacknowledged", "first", "last", "message"}).
+			AddRow("client-1", WarningClockSkew, SeverityWarning, int64(4), int64(3), first, last, "updated_at is 2h0m0s ahead of the server clock"))
+
+	summaries, err := service.GetWarningSummary(context.Background(), WarningQuery{ClientID: "client-1", Code: WarningClockSkew})
+	if err != nil {
+		t.Fatalf("Failed to get warning summary: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Total != 4 || summaries[0].Unacknowledged != 3 || !summaries[0].LastSeenAt.Equal(last) {
+		t.Errorf("Unexpected summary: %+v", summaries)
+	}
+
+	// Including acknowledged warnings drops the HAVING clause
+	mock.ExpectQuery(`FROM sync_warnings\s+GROUP BY client_id, code\s+ORDER BY`).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "code", "severity", "total", "unacknowledged", "first", "last", "message"}))
+	summaries, err = service.GetWarningSummary(context.Background(), WarningQuery{IncludeAcknowledged: true})
+	if err != nil {
+		t.Fatalf("Failed to get warning summary: %v", err)
+	}
+	if summaries == nil || len(summaries) != 0 {
+		t.Errorf("Expected an empty summary, got %+v", summaries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/attachments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedName string
+		expectError  bool
+	}{
+		{name: "span named after route pattern", path: "/attachments/abc", expectedName: "GET /attachments/{id}"},
+		{name: "server error marks span failed", path: "/fail", expectedName: "GET /fail", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != before+1 {
+				t.Fatalf("Expected 1 new span, got %d", len(spans)-before)
+			}
+			span := spans[len(spans)-1]
+			if span.Name() != tc.expectedName {
+				t.Errorf("Expected span name %q, got %q", tc.expectedName, span.Name())
+			}
+			if tc.expectError && span.Status().Code != codes.Error {
+				t.Errorf("Expected error status, got %v", span.Status().Code)
+			}
+		})
+	}
+}
@@ -3,16 +3,20 @@ package user
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
 )
 
 // Common errors for user service
 var (
-	ErrUserNotFound    = errors.New("user not found")
-	ErrUserExists      = errors.New("user already exists")
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrInvalidRole     = errors.New("invalid role")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	ErrInvitationNotFound = errors.New("invitation not found")
 )
 
 // UserServiceInterface defines the interface for user management operations
@@ -25,14 +29,43 @@ type UserServiceInterface interface {
 	// Returns an error if the user doesn't exist
 	DeleteUser(ctx context.Context, username string) error
 
-	// ResetPassword resets a user's password (admin operation)
+	// ResetPassword resets a user's password (admin operation) and logs out all of the
+	// user's sessions
 	// Returns an error if the user doesn't exist
 	ResetPassword(ctx context.Context, username, newPassword string) error
 
-	// ChangePassword changes a user's password after verifying the current password
+	// ChangePassword changes a user's password after verifying the current password, and
+	// logs out the user's sessions other than keepSession (uuid.Nil logs out all)
 	// Returns an error if the user doesn't exist or the current password is incorrect
-	ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error
+	ChangePassword(ctx context.Context, username, currentPassword, newPassword string, keepSession uuid.UUID) error
 
 	// ListUsers lists all users in the system (admin operation)
 	ListUsers(ctx context.Context) ([]models.User, error)
+
+	// CreateInvitation creates a single-use registration invitation (admin operation)
+	// Returns the invitation and its token; only a hash of the token is stored
+	CreateInvitation(ctx context.Context, role models.Role, email, createdBy string, ttl time.Duration) (*models.Invitation, string, error)
+
+	// ListInvitations lists all invitations (admin operation)
+	ListInvitations(ctx context.Context) ([]models.Invitation, error)
+
+	// RevokeInvitation deletes an invitation (admin operation)
+	// Returns ErrInvitationNotFound if it doesn't exist
+	RevokeInvitation(ctx context.Context, id uuid.UUID) error
+
+	// RegisterWithInvitation creates a user with the invitation's role and consumes the invitation
+	// Returns ErrInvalidInvitation if the token is unknown, used or expired
+	RegisterWithInvitation(ctx context.Context, token, username, password string) (*models.User, error)
+
+	// SetEmail sets or clears a user's email address (admin operation)
+	// Returns ErrInvalidEmail or ErrEmailInUse for unusable addresses
+	SetEmail(ctx context.Context, username, email string) error
+
+	// RequestPasswordReset emails a reset link to the user with this username or email address
+	// Returns ErrPasswordResetDisabled without SMTP; unknown users are not reported
+	RequestPasswordReset(ctx context.Context, identifier string) error
+
+	// ResetPasswordWithToken sets a new password using an emailed reset token
+	// Returns ErrInvalidResetToken if the token is unknown, used or expired
+	ResetPasswordWithToken(ctx context.Context, token, newPassword string) error
 }
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockInvitationRepository mocks the invitation repository interface
+type MockInvitationRepository struct {
+	mock.Mock
+}
+
+func (m *MockInvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	args := m.Called(ctx, invitation)
+	return args.Error(0)
+}
+
+func (m *MockInvitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) Claim(ctx context.Context, id uuid.UUID, username string) (bool, error) {
+	args := m.Called(ctx, id, username)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockInvitationRepository) Release(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockInvitationRepository) List(ctx context.Context) ([]models.Invitation, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+// TestCreateInvitation tests that only the token hash is stored
+func TestCreateInvitation(t *testing.T) {
+	mockInviteRepo := new(MockInvitationRepository)
+	service := &Service{
+		inviteRepo: mockInviteRepo,
+		log:        logger.NewLogger(),
+	}
+	ctx := context.Background()
+
+	var stored *models.Invitation
+	mockInviteRepo.On("Create", ctx, mock.AnythingOfType("*models.Invitation")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*models.Invitation) }).
+		Return(nil)
+
+	invitation, token, err := service.CreateInvitation(ctx, models.RoleReadWrite, "a@example.com", "admin", time.Hour)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, stored, invitation)
+	assert.Equal(t, hashToken(token), stored.TokenHash)
+	assert.NotContains(t, stored.TokenHash, token)
+	assert.Equal(t, models.RoleReadWrite, stored.Role)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiresAt, time.Minute)
+
+	_, _, err = service.CreateInvitation(ctx, "invalid-role", "", "admin", time.Hour)
+	assert.Equal(t, ErrInvalidRole, err)
+
+	mockInviteRepo.AssertExpectations(t)
+}
+
+// TestRegisterWithInvitation tests the RegisterWithInvitation method
+func TestRegisterWithInvitation(t *testing.T) {
+	const token = "invite-token"
+	past := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		name          string
+		invitation    *models.Invitation
+		existingUser  *models.User
+		claimed       bool
+		createError   error
+		expectedError error
+	}{
+		{
+			name:       "Success",
+			invitation: &models.Invitation{ID: uuid.New(), Role: models.RoleAdmin, ExpiresAt: time.Now().Add(time.Hour)},
+			claimed:    true,
+		},
+		{
+			name:          "Unknown Token",
+			expectedError: ErrInvalidInvitation,
+		},
+		{
+			name:          "Expired",
+			invitation:    &models.Invitation{ID: uuid.New(), Role: models.RoleReadOnly, ExpiresAt: past},
+			expectedError: ErrInvalidInvitation,
+		},
+		{
+			name:          "Already Used",
+			invitation:    &models.Invitation{ID: uuid.New(), Role: models.RoleReadOnly, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &past},
+			expectedError: ErrInvalidInvitation,
+		},
+		{
+			name:          "Username Taken",
+			invitation:    &models.Invitation{ID: uuid.New(), Role: models.RoleReadOnly, ExpiresAt: time.Now().Add(time.Hour)},
+			existingUser:  &models.User{Username: "newuser"},
+			expectedError: ErrUserExists,
+		},
+		{
+			name:          "Lost Claim Race",
+			invitation:    &models.Invitation{ID: uuid.New(), Role: models.RoleReadOnly, ExpiresAt: time.Now().Add(time.Hour)},
+			claimed:       false,
+			expectedError: ErrInvalidInvitation,
+		},
+		{
+			name:          "Create Fails Releases Invitation",
+			invitation:    &models.Invitation{ID: uuid.New(), Role: models.RoleReadOnly, ExpiresAt: time.Now().Add(time.Hour)},
+			claimed:       true,
+			createError:   errors.New("create error"),
+			expectedError: errors.New("failed to create user: create error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockInviteRepo := new(MockInvitationRepository)
+			mockAuthService := new(MockAuthService)
+			service := &Service{
+				userRepo:    mockRepo,
+				inviteRepo:  mockInviteRepo,
+				authService: mockAuthService,
+				log:         logger.NewLogger(),
+			}
+			ctx := context.Background()
+
+			mockInviteRepo.On("GetByTokenHash", ctx, hashToken(token)).Return(tc.invitation, nil)
+			redeemable := tc.invitation != nil && tc.invitation.IsRedeemable(time.Now())
+			if redeemable {
+				// CreateUser checks again after the claim
+				mockRepo.On("GetByUsername", ctx, "newuser").Return(tc.existingUser, nil)
+			}
+			if redeemable && tc.existingUser == nil {
+				mockInviteRepo.On("Claim", ctx, tc.invitation.ID, "newuser").Return(tc.claimed, nil)
+			}
+			if tc.claimed {
+				mockAuthService.On("HashPassword", "password123").Return("hashed", nil)
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(u *models.User) bool {
+					return u.Username == "newuser" && u.Role == tc.invitation.Role
+				})).Return(tc.createError)
+			}
+			if tc.createError != nil {
+				mockInviteRepo.On("Release", ctx, tc.invitation.ID).Return(nil)
+			}
+
+			user, err := service.RegisterWithInvitation(ctx, token, "newuser", "password123")
+
+			if tc.expectedError != nil {
+				assert.Error(t, err)
+				assert.Nil(t, user)
+				assert.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.invitation.Role, user.Role)
+			}
+
+			mockRepo.AssertExpectations(t)
+			mockInviteRepo.AssertExpectations(t)
+			mockAuthService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+)
+
+// Password reset errors
+var (
+	ErrPasswordResetDisabled = errors.New("password reset by email is not configured")
+	ErrInvalidResetToken     = errors.New("invalid or expired password reset token")
+	ErrInvalidEmail          = errors.New("invalid email address")
+	ErrEmailInUse            = errors.New("email address already in use")
+)
+
+// PasswordResetConfig contains self-service password reset configuration
+type PasswordResetConfig struct {
+	// TTL is how long an emailed reset link stays valid
+	TTL time.Duration
+	// URLBase is the reset page; emails link to it with ?token=<token>. Without it
+	// the email contains the bare token.
+	URLBase string
+}
+
+// passwordResetTimeout bounds storing and emailing a reset link in the background
+const passwordResetTimeout = time.Minute
+
+// DefaultPasswordResetConfig returns a default configuration
+func DefaultPasswordResetConfig() PasswordResetConfig {
+	return PasswordResetConfig{
+		TTL: time.Hour,
+	}
+}
+
+// SetEmail sets or, with an empty email, clears a user's email address
+func (s *Service) SetEmail(ctx context.Context, username, email string) error {
+	email = strings.TrimSpace(email)
+	if email != "" {
+		if err := mail.ValidateAddress(email); err != nil {
+			return ErrInvalidEmail
+		}
+	}
+
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if email != "" {
+		owner, err := s.userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			return fmt.Errorf("failed to check for existing email: %w", err)
+		}
+		if owner != nil && owner.ID != user.ID {
+			return ErrEmailInUse
+		}
+	}
+
+	user.Email = email
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	s.log.Info("User email updated", "username", username)
+	return nil
+}
+
+// RequestPasswordReset emails a reset link to the user with the given username or
+// email address. Unknown users and users without an email address are not reported,
+// so the endpoint can't be used to discover accounts. The link is stored and sent in the
+// background, so known and unknown accounts also take the same time to answer.
+func (s *Service) RequestPasswordReset(ctx context.Context, identifier string) error {
+	if s.mailer == nil {
+		return ErrPasswordResetDisabled
+	}
+
+	identifier = strings.TrimSpace(identifier)
+	user, err := s.userRepo.GetByUsername(ctx, identifier)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil && strings.Contains(identifier, "@") {
+		if user, err = s.userRepo.GetByEmail(ctx, identifier); err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+	if user == nil || user.Email == "" {
+		s.log.Info("Password reset requested for unknown user or user without email", "identifier", identifier)
+		return nil
+	}
+
+	s.resets.Add(1)
+	go func() {
+		defer s.resets.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetTimeout)
+		defer cancel()
+		s.sendPasswordReset(ctx, user)
+	}()
+	return nil
+}
+
+// sendPasswordReset stores a new reset token for a user and emails the link. Failures are
+// logged, not returned: a failure only for existing users would reveal them.
+func (s *Service) sendPasswordReset(ctx context.Context, user *models.User) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		s.log.Error("Failed to generate password reset token", "username", user.Username, "error", err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	// Only the newest link works
+	if err := s.resetRepo.DeleteForUser(ctx, user.ID); err != nil {
+		s.log.Error("Failed to delete password reset tokens", "username", user.Username, "error", err)
+		return
+	}
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.resetConfig.TTL),
+	}
+	if err := s.resetRepo.Create(ctx, resetToken); err != nil {
+		s.log.Error("Failed to store password reset token", "username", user.Username, "error", err)
+		return
+	}
+
+	if err := s.mailer.Send(ctx, s.passwordResetMessage(user, token)); err != nil {
+		s.log.Error("Failed to send password reset email", "username", user.Username, "error", err)
+		return
+	}
+
+	s.log.Info("Password reset email sent", "username", user.Username, "expiresAt", resetToken.ExpiresAt)
+}
+
+// ResetPasswordWithToken sets a new password using an emailed reset token
+func (s *Service) ResetPasswordWithToken(ctx context.Context, token, newPassword string) error {
+	if token == "" || s.resetRepo == nil {
+		return ErrInvalidResetToken
+	}
+
+	username, err := s.resetRepo.Claim(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := s.authService.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.PasswordHash = hashedPassword
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// Any other link sent before this reset must not work afterwards
+	if err := s.resetRepo.DeleteForUser(ctx, user.ID); err != nil {
+		s.log.Error("Failed to delete password reset tokens", "username", username, "error", err)
+	}
+
+	// Whoever had the old password may still hold a session; like the token cleanup above,
+	// a failure doesn't undo the saved password
+	if _, err := s.authService.RevokeSessions(ctx, username); err != nil {
+		s.log.Warn("Password reset, but failed to revoke sessions", "username", username, "error", err)
+	}
+
+	s.log.Info("User password reset by email", "username", username)
+	return nil
+}
+
+// passwordResetMessage builds the reset email for user
+func (s *Service) passwordResetMessage(user *models.User, token string) mail.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\n", user.Username)
+	body.WriteString("A password reset was requested for your Synkronus account.\n")
+
+	validFor := s.resetConfig.TTL.Round(time.Minute)
+	if link := s.passwordResetURL(token); link != "" {
+		fmt.Fprintf(&body, "Choose a new password within %s using this link:\n\n%s\n\n", validFor, link)
+	} else {
+		fmt.Fprintf(&body, "Choose a new password within %s using this reset token:\n\n%s\n\n", validFor, token)
+	}
+	body.WriteString("If you did not ask for this, ignore this email; your password stays unchanged.\n")
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Synkronus password",
+		Body:    body.String(),
+	}
+}
+
+// passwordResetURL returns the reset page link for token, or "" without a reset page
+func (s *Service) passwordResetURL(token string) string {
+	if s.resetConfig.URLBase == "" {
+		return ""
+	}
+	base, err := url.Parse(s.resetConfig.URLBase)
+	if err != nil {
+		return ""
+	}
+	query := base.Query()
+	query.Set("token", token)
+	base.RawQuery = query.Encode()
+	return base.String()
+}
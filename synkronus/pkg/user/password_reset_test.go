@@ -0,0 +1,291 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockPasswordResetRepository mocks the password reset repository interface
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) Claim(ctx context.Context, tokenHash string) (string, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockPasswordResetRepository) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// recordingMailer keeps sent messages instead of delivering them
+type recordingMailer struct {
+	sent []mail.Message
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// TestRequestPasswordReset tests that reset links are only emailed to known addresses
+func TestRequestPasswordReset(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com"}
+	noEmail := &models.User{ID: uuid.New(), Username: "bob"}
+
+	testCases := []struct {
+		name       string
+		identifier string
+		byUsername *models.User
+		byEmail    *models.User
+		sendErr    error
+		expectSent bool
+	}{
+		{name: "By username", identifier: "alice", byUsername: alice, expectSent: true},
+		{name: "By email", identifier: "Alice@Example.com", byEmail: alice, expectSent: true},
+		{name: "Unknown user", identifier: "nobody@example.com"},
+		{name: "User without email", identifier: "bob", byUsername: noEmail},
+		{name: "Delivery failure is not reported", identifier: "alice", byUsername: alice, sendErr: errors.New("connection refused")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockUserRepo := new(MockUserRepository)
+			mockResetRepo := new(MockPasswordResetRepository)
+			mailer := &recordingMailer{err: tc.sendErr}
+			service := &Service{
+				userRepo:    mockUserRepo,
+				resetRepo:   mockResetRepo,
+				mailer:      mailer,
+				resetConfig: PasswordResetConfig{TTL: time.Hour, URLBase: "https://app.example.com/reset"},
+				log:         logger.NewLogger(),
+			}
+			ctx := context.Background()
+
+			mockUserRepo.On("GetByUsername", ctx, tc.identifier).Return(tc.byUsername, nil)
+			if tc.byUsername == nil && strings.Contains(tc.identifier, "@") {
+				mockUserRepo.On("GetByEmail", ctx, tc.identifier).Return(tc.byEmail, nil)
+			}
+
+			var stored *models.PasswordResetToken
+			if tc.expectSent || tc.sendErr != nil {
+				mockResetRepo.On("DeleteForUser", mock.Anything, alice.ID).Return(nil)
+				mockResetRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.PasswordResetToken")).
+					Run(func(args mock.Arguments) { stored = args.Get(1).(*models.PasswordResetToken) }).
+					Return(nil)
+			}
+
+			err := service.RequestPasswordReset(ctx, tc.identifier)
+			assert.NoError(t, err)
+			service.resets.Wait()
+
+			if tc.expectSent {
+				require.Len(t, mailer.sent, 1)
+				msg := mailer.sent[0]
+				assert.Equal(t, "alice@example.com", msg.To)
+				require.NotNil(t, stored)
+				assert.Equal(t, alice.ID, stored.UserID)
+				assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiresAt, time.Minute)
+
+				// The link carries the token whose hash was stored
+				start := strings.Index(msg.Body, "?token=")
+				require.NotEqual(t, -1, start)
+				token := strings.Fields(msg.Body[start+len("?token="):])[0]
+				assert.Equal(t, hashToken(token), stored.TokenHash)
+			} else {
+				assert.Empty(t, mailer.sent)
+			}
+
+			mockUserRepo.AssertExpectations(t)
+			mockResetRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// blockingMailer holds every message until release is closed
+type blockingMailer struct {
+	recordingMailer
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	<-m.release
+	return m.recordingMailer.Send(ctx, msg)
+}
+
+// TestRequestPasswordResetInBackground tests that existing accounts answer without waiting
+// for the email, and that the email outlives the request
+func TestRequestPasswordResetInBackground(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com"}
+	mockUserRepo := new(MockUserRepository)
+	mockResetRepo := new(MockPasswordResetRepository)
+	mailer := &blockingMailer{release: make(chan struct{})}
+	service := &Service{
+		userRepo:    mockUserRepo,
+		resetRepo:   mockResetRepo,
+		mailer:      mailer,
+		resetConfig: DefaultPasswordResetConfig(),
+		log:         logger.NewLogger(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockUserRepo.On("GetByUsername", ctx, "alice").Return(alice, nil)
+	mockResetRepo.On("DeleteForUser", mock.Anything, alice.ID).Return(nil)
+	mockResetRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.PasswordResetToken")).Return(nil)
+
+	require.NoError(t, service.RequestPasswordReset(ctx, "alice"))
+	cancel()
+	close(mailer.release)
+	service.resets.Wait()
+
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "alice@example.com", mailer.sent[0].To)
+	mockResetRepo.AssertExpectations(t)
+}
+
+// TestRequestPasswordResetDisabled tests that reset requests fail without SMTP
+func TestRequestPasswordResetDisabled(t *testing.T) {
+	service := &Service{log: logger.NewLogger()}
+	err := service.RequestPasswordReset(context.Background(), "alice")
+	assert.Equal(t, ErrPasswordResetDisabled, err)
+}
+
+// TestResetPasswordWithToken tests the ResetPasswordWithToken method
+func TestResetPasswordWithToken(t *testing.T) {
+	const token = "reset-token"
+	alice := &models.User{ID: uuid.New(), Username: "alice", PasswordHash: "old_hash"}
+
+	t.Run("Success", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepository)
+		mockResetRepo := new(MockPasswordResetRepository)
+		mockAuthService := new(MockAuthService)
+		service := &Service{
+			userRepo:    mockUserRepo,
+			resetRepo:   mockResetRepo,
+			authService: mockAuthService,
+			log:         logger.NewLogger(),
+		}
+		ctx := context.Background()
+
+		mockResetRepo.On("Claim", ctx, hashToken(token)).Return("alice", nil)
+		mockUserRepo.On("GetByUsername", ctx, "alice").Return(alice, nil)
+		mockAuthService.On("HashPassword", "new-password").Return("new_hash", nil)
+		mockUserRepo.On("Update", ctx, mock.MatchedBy(func(u *models.User) bool {
+			return u.Username == "alice" && u.PasswordHash == "new_hash"
+		})).Return(nil)
+		mockResetRepo.On("DeleteForUser", ctx, alice.ID).Return(nil)
+		mockAuthService.On("RevokeSessions", ctx, "alice").Return(3, nil)
+
+		err := service.ResetPasswordWithToken(ctx, token, "new-password")
+		assert.NoError(t, err)
+
+		mockUserRepo.AssertExpectations(t)
+		mockResetRepo.AssertExpectations(t)
+		mockAuthService.AssertExpectations(t)
+	})
+
+	t.Run("Revoke sessions error", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepository)
+		mockResetRepo := new(MockPasswordResetRepository)
+		mockAuthService := new(MockAuthService)
+		service := &Service{
+			userRepo:    mockUserRepo,
+			resetRepo:   mockResetRepo,
+			authService: mockAuthService,
+			log:         logger.NewLogger(),
+		}
+		ctx := context.Background()
+
+		mockResetRepo.On("Claim", ctx, hashToken(token)).Return("alice", nil)
+		mockUserRepo.On("GetByUsername", ctx, "alice").Return(alice, nil)
+		mockAuthService.On("HashPassword", "new-password").Return("new_hash", nil)
+		mockUserRepo.On("Update", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockResetRepo.On("DeleteForUser", ctx, alice.ID).Return(nil)
+		mockAuthService.On("RevokeSessions", ctx, "alice").Return(0, errors.New("db error"))
+
+		err := service.ResetPasswordWithToken(ctx, token, "new-password")
+		// The password is saved, so the reset succeeds
+		assert.NoError(t, err)
+		mockUserRepo.AssertExpectations(t)
+		mockAuthService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		mockResetRepo := new(MockPasswordResetRepository)
+		service := &Service{resetRepo: mockResetRepo, log: logger.NewLogger()}
+		ctx := context.Background()
+
+		mockResetRepo.On("Claim", ctx, hashToken(token)).Return("", nil)
+
+		err := service.ResetPasswordWithToken(ctx, token, "new-password")
+		assert.Equal(t, ErrInvalidResetToken, err)
+		assert.Equal(t, ErrInvalidResetToken, service.ResetPasswordWithToken(ctx, "", "new-password"))
+
+		mockResetRepo.AssertExpectations(t)
+	})
+}
+
+// TestSetEmail tests the SetEmail method
+func TestSetEmail(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com"}
+
+	testCases := []struct {
+		name          string
+		email         string
+		owner         *models.User
+		expectedError error
+	}{
+		{name: "Success", email: "alice@example.com"},
+		{name: "Clear", email: ""},
+		{name: "Invalid", email: "not an address", expectedError: ErrInvalidEmail},
+		{name: "In use", email: "BOB@example.com", owner: bob, expectedError: ErrEmailInUse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockUserRepo := new(MockUserRepository)
+			service := &Service{userRepo: mockUserRepo, log: logger.NewLogger()}
+			ctx := context.Background()
+			user := *alice
+
+			if tc.expectedError != ErrInvalidEmail {
+				mockUserRepo.On("GetByUsername", ctx, "alice").Return(&user, nil)
+			}
+			if tc.email != "" && tc.expectedError != ErrInvalidEmail {
+				mockUserRepo.On("GetByEmail", ctx, tc.email).Return(tc.owner, nil)
+			}
+			if tc.expectedError == nil {
+				mockUserRepo.On("Update", ctx, mock.MatchedBy(func(u *models.User) bool {
+					return u.Email == tc.email
+				})).Return(nil)
+			}
+
+			err := service.SetEmail(ctx, "alice", tc.email)
+			assert.Equal(t, tc.expectedError, err)
+			mockUserRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -2,27 +2,46 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/opendataensemble/synkronus/internal/models"
 	"github.com/opendataensemble/synkronus/internal/repository"
 	"github.com/opendataensemble/synkronus/pkg/auth"
 	"github.com/opendataensemble/synkronus/pkg/logger"
+	"github.com/opendataensemble/synkronus/pkg/mail"
 )
 
 // Service implements the UserServiceInterface
 type Service struct {
 	userRepo    repository.UserRepositoryInterface
+	inviteRepo  repository.InvitationRepositoryInterface
+	resetRepo   repository.PasswordResetRepositoryInterface
 	authService auth.AuthServiceInterface
+	mailer      mail.Mailer // nil when email is not configured
+	resetConfig PasswordResetConfig
+	resets      sync.WaitGroup // background password reset emails
 	log         *logger.Logger
 }
 
-// NewService creates a new user service
-func NewService(userRepo repository.UserRepositoryInterface, authService auth.AuthServiceInterface, log *logger.Logger) *Service {
+// NewService creates a new user service. A nil mailer disables password reset by email.
+func NewService(userRepo repository.UserRepositoryInterface, inviteRepo repository.InvitationRepositoryInterface, resetRepo repository.PasswordResetRepositoryInterface, authService auth.AuthServiceInterface, mailer mail.Mailer, resetConfig PasswordResetConfig, log *logger.Logger) *Service {
+	if resetConfig.TTL <= 0 {
+		resetConfig.TTL = DefaultPasswordResetConfig().TTL
+	}
 	return &Service{
 		userRepo:    userRepo,
+		inviteRepo:  inviteRepo,
+		resetRepo:   resetRepo,
 		authService: authService,
+		mailer:      mailer,
+		resetConfig: resetConfig,
 		log:         log,
 	}
 }
@@ -112,12 +131,19 @@ func (s *Service) ResetPassword(ctx context.Context, username, newPassword strin
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	// A reset usually answers a compromised account, so every device is logged out. The new
+	// password is saved by now, so a failure here doesn't fail the reset.
+	if _, err := s.authService.RevokeSessions(ctx, username); err != nil {
+		s.log.Warn("Password reset, but failed to revoke sessions", "username", username, "error", err)
+	}
+
 	s.log.Info("User password reset successfully", "username", username)
 	return nil
 }
 
-// ChangePassword changes a user's password after verifying the current password
-func (s *Service) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error {
+// ChangePassword changes a user's password after verifying the current password, logging
+// out the user's other sessions
+func (s *Service) ChangePassword(ctx context.Context, username, currentPassword, newPassword string, keepSession uuid.UUID) error {
 	// Get the user
 	user, err := s.userRepo.GetByUsername(ctx, username)
 	if err != nil {
@@ -145,6 +171,12 @@ func (s *Service) ChangePassword(ctx context.Context, username, currentPassword,
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	// The device changing the password stays logged in. The new password is saved by now,
+	// so a failure here doesn't fail the change.
+	if _, err := s.authService.RevokeOtherSessions(ctx, username, keepSession); err != nil {
+		s.log.Warn("Password changed, but failed to revoke other sessions", "username", username, "error", err)
+	}
+
 	s.log.Info("User password changed successfully", "username", username)
 	return nil
 }
@@ -157,3 +189,112 @@ func (s *Service) ListUsers(ctx context.Context) ([]models.User, error) {
 	}
 	return userList, nil
 }
+
+// CreateInvitation creates a single-use registration invitation
+func (s *Service) CreateInvitation(ctx context.Context, role models.Role, email, createdBy string, ttl time.Duration) (*models.Invitation, string, error) {
+	if role != models.RoleReadOnly && role != models.RoleReadWrite && role != models.RoleAdmin {
+		return nil, "", ErrInvalidRole
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	invitation := &models.Invitation{
+		ID:        uuid.New(),
+		TokenHash: hashToken(token),
+		Role:      role,
+		Email:     email,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := s.inviteRepo.Create(ctx, invitation); err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	s.log.Info("Invitation created", "id", invitation.ID, "role", role, "createdBy", createdBy, "expiresAt", invitation.ExpiresAt)
+	return invitation, token, nil
+}
+
+// ListInvitations lists all invitations
+func (s *Service) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	invitations, err := s.inviteRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation deletes an invitation
+func (s *Service) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.inviteRepo.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	if !deleted {
+		return ErrInvitationNotFound
+	}
+
+	s.log.Info("Invitation revoked", "id", id)
+	return nil
+}
+
+// RegisterWithInvitation creates a user with the invitation's role and consumes the invitation
+func (s *Service) RegisterWithInvitation(ctx context.Context, token, username, password string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation, err := s.inviteRepo.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if invitation == nil || !invitation.IsRedeemable(time.Now()) {
+		return nil, ErrInvalidInvitation
+	}
+
+	// Check the username before consuming the invitation so a taken name doesn't burn it
+	existingUser, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing user: %w", err)
+	}
+	if existingUser != nil {
+		return nil, ErrUserExists
+	}
+
+	// Claim atomically so concurrent registrations cannot share one invitation
+	claimed, err := s.inviteRepo.Claim(ctx, invitation.ID, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim invitation: %w", err)
+	}
+	if !claimed {
+		return nil, ErrInvalidInvitation
+	}
+
+	user, err := s.CreateUser(ctx, username, password, invitation.Role)
+	if err != nil {
+		if releaseErr := s.inviteRepo.Release(ctx, invitation.ID); releaseErr != nil {
+			s.log.Error("Failed to release invitation after registration failure", "id", invitation.ID, "error", releaseErr)
+		}
+		return nil, err
+	}
+
+	// The invited address lets the new user reset a forgotten password by email
+	if invitation.Email != "" {
+		if err := s.SetEmail(ctx, username, invitation.Email); err != nil {
+			s.log.Warn("Failed to set email from invitation", "id", invitation.ID, "username", username, "error", err)
+		}
+	}
+
+	s.log.Info("Invitation redeemed", "id", invitation.ID, "username", username)
+	return user, nil
+}
+
+// hashToken returns the stored form of an invitation or password reset token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
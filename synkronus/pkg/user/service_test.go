@@ -34,6 +34,14 @@ func (m *MockUserRepository) GetByUsername(ctx context.Context, username string)
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	args := m.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
 	args := m.Called(ctx, user)
 	return args.Error(0)
@@ -70,6 +78,16 @@ func (m *MockAuthService) VerifyPassword(password, hash string) bool {
 	return args.Bool(0)
 }
 
+func (m *MockAuthService) RevokeSessions(ctx context.Context, username string) (int, error) {
+	args := m.Called(ctx, username)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthService) RevokeOtherSessions(ctx context.Context, username string, keep uuid.UUID) (int, error) {
+	args := m.Called(ctx, username, keep)
+	return args.Int(0), args.Error(1)
+}
+
 // TestCreateUser tests the CreateUser method
 func TestCreateUser(t *testing.T) {
 	// Define test cases
@@ -341,6 +359,7 @@ func TestResetPassword(t *testing.T) {
 		getUser      func() (*models.User, error)
 		hashPassword func(string) (string, error)
 		updateError  error
+		revokeError  error
 		expectedErr  error
 	}
 
@@ -400,6 +419,17 @@ func TestResetPassword(t *testing.T) {
 			updateError: errors.New("update error"),
 			expectedErr: errors.New("failed to update user: update error"),
 		},
+		{
+			name: "Revoke Sessions Error Keeps Reset",
+			getUser: func() (*models.User, error) {
+				return &models.User{Username: "testuser", PasswordHash: "oldhash"}, nil
+			},
+			hashPassword: func(pw string) (string, error) {
+				return "newhash", nil
+			},
+			revokeError: errors.New("revoke error"),
+			expectedErr: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -411,6 +441,7 @@ func TestResetPassword(t *testing.T) {
 			mockRepo.On("GetByUsername", mock.Anything, "testuser").Return(tc.getUser())
 			mockAuth.On("HashPassword", "newpass").Return(tc.hashPassword("newpass"))
 			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*models.User")).Return(tc.updateError)
+			mockAuth.On("RevokeSessions", mock.Anything, "testuser").Return(2, tc.revokeError)
 
 			svc := &Service{
 				userRepo:    mockRepo,
@@ -421,6 +452,7 @@ func TestResetPassword(t *testing.T) {
 			err := svc.ResetPassword(context.Background(), "testuser", "newpass")
 			if tc.expectedErr == nil {
 				assert.NoError(t, err)
+				mockAuth.AssertCalled(t, "RevokeSessions", mock.Anything, "testuser")
 			} else {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), tc.expectedErr.Error())
@@ -459,8 +491,12 @@ func TestChangePassword(t *testing.T) {
 		return u.Username == "testuser" && u.PasswordHash == "hashed_newpassword"
 	})).Return(nil)
 
+	// Setup RevokeOtherSessions mock; the session changing the password is kept
+	currentSession := uuid.New()
+	mockAuthService.On("RevokeOtherSessions", ctx, "testuser", currentSession).Return(2, nil)
+
 	// Call the method we're testing
-	err := service.ChangePassword(ctx, "testuser", "oldpassword", "newpassword")
+	err := service.ChangePassword(ctx, "testuser", "oldpassword", "newpassword", currentSession)
 
 	// Verify results
 	assert.NoError(t, err)
@@ -493,7 +529,7 @@ func TestChangePassword_InvalidPassword(t *testing.T) {
 	mockAuthService.On("VerifyPassword", "wrongpassword", "").Return(false, nil)
 
 	// Call the method we're testing
-	err := service.ChangePassword(ctx, "testuser", "wrongpassword", "newpassword")
+	err := service.ChangePassword(ctx, "testuser", "wrongpassword", "newpassword", uuid.New())
 
 	// Verify results
 	assert.Error(t, err)
@@ -524,7 +560,7 @@ func TestChangePassword_UserNotFound(t *testing.T) {
 	mockRepo.On("GetByUsername", ctx, "testuser").Return(nil, ErrUserNotFound)
 
 	// Call the method we're testing
-	err := service.ChangePassword(ctx, "testuser", "oldpassword", "newpassword")
+	err := service.ChangePassword(ctx, "testuser", "oldpassword", "newpassword", uuid.New())
 
 	// Verify results
 	assert.Error(t, err)
@@ -533,3 +569,27 @@ func TestChangePassword_UserNotFound(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 	mockAuthService.AssertExpectations(t)
 }
+
+func TestChangePassword_RevokeError(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	mockAuthService := new(MockAuthService)
+	service := &Service{
+		userRepo:    mockRepo,
+		authService: mockAuthService,
+		log:         logger.NewLogger(),
+	}
+	ctx := context.Background()
+
+	mockRepo.On("GetByUsername", ctx, "testuser").Return(&models.User{Username: "testuser"}, nil)
+	mockAuthService.On("VerifyPassword", "oldpassword", "").Return(true)
+	mockAuthService.On("HashPassword", "newpassword").Return("hashed_newpassword", nil)
+	mockRepo.On("Update", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+	mockAuthService.On("RevokeOtherSessions", ctx, "testuser", uuid.Nil).Return(0, errors.New("db error"))
+
+	err := service.ChangePassword(ctx, "testuser", "oldpassword", "newpassword", uuid.Nil)
+	// The password is saved, so the change succeeds
+	assert.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+	mockAuthService.AssertExpectations(t)
+}
@@ -27,6 +27,7 @@ type SystemVersionInfo struct {
 	Database DatabaseInfo `json:"database,omitempty"`
 	System   SystemInfo   `json:"system"`
 	Build    BuildInfo    `json:"build"`
+	Features []string     `json:"features"` // enabled feature flags
 }
 
 type ServerInfo struct {
@@ -0,0 +1,166 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+)
+
+// Default workflow states
+const (
+	StateSubmitted = "submitted"
+	StateInReview  = "in_review"
+	StateApproved  = "approved"
+	StateReturned  = "returned"
+)
+
+// stateNamePattern is the form of workflow state names
+var stateNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// Definition is the workflow of a form type: the state new observations start in and the
+// states each state may move to. States without transitions are final.
+type Definition struct {
+	Initial     string              `json:"initial"`
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// DefaultDefinition returns the workflow of forms that declare "x-workflow": true.
+// Returned observations go back to submitted once they are corrected.
+func DefaultDefinition() *Definition {
+	return &Definition{
+		Initial: StateSubmitted,
+		Transitions: map[string][]string{
+			StateSubmitted: {StateInReview},
+			StateInReview:  {StateApproved, StateReturned},
+			StateReturned:  {StateSubmitted},
+		},
+	}
+}
+
+// States lists the states of the workflow, the initial state first and the others sorted
+func (d *Definition) States() []string {
+	seen := map[string]bool{d.Initial: true}
+	var others []string
+	add := func(state string) {
+		if !seen[state] {
+			seen[state] = true
+			others = append(others, state)
+		}
+	}
+	for from, targets := range d.Transitions {
+		add(from)
+		for _, to := range targets {
+			add(to)
+		}
+	}
+	sort.Strings(others)
+	return append([]string{d.Initial}, others...)
+}
+
+// HasState reports whether state is a state of the workflow
+func (d *Definition) HasState(state string) bool {
+	for _, s := range d.States() {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the states an observation in state may move to
+func (d *Definition) Next(state string) []string {
+	return append([]string{}, d.Transitions[state]...)
+}
+
+// Allows reports whether an observation in from may move to to
+func (d *Definition) Allows(from, to string) bool {
+	for _, next := range d.Transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the state names and that the initial state leads somewhere
+func (d *Definition) Validate() error {
+	if !stateNamePattern.MatchString(d.Initial) {
+		return fmt.Errorf("%w: initial state %q is not a lowercase name", ErrInvalidDefinition, d.Initial)
+	}
+	if len(d.Transitions[d.Initial]) == 0 {
+		return fmt.Errorf("%w: initial state %q has no transitions", ErrInvalidDefinition, d.Initial)
+	}
+	for from, targets := range d.Transitions {
+		if !stateNamePattern.MatchString(from) {
+			return fmt.Errorf("%w: state %q is not a lowercase name", ErrInvalidDefinition, from)
+		}
+		for _, to := range targets {
+			if !stateNamePattern.MatchString(to) {
+				return fmt.Errorf("%w: state %q is not a lowercase name", ErrInvalidDefinition, to)
+			}
+			if to == from {
+				return fmt.Errorf("%w: state %q moves to itself", ErrInvalidDefinition, from)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseSchema reads x-workflow from the root of a form schema: true for the default
+// workflow, or an object with the initial state and the transitions. It returns nil when
+// the form has no workflow.
+func ParseSchema(data []byte) (*Definition, error) {
+	var schema struct {
+		Workflow json.RawMessage `json:"x-workflow"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	switch raw := strings.TrimSpace(string(schema.Workflow)); raw {
+	case "", "null", "false":
+		return nil, nil
+	case "true":
+		return DefaultDefinition(), nil
+	}
+
+	var def Definition
+	if err := json.Unmarshal(schema.Workflow, &def); err != nil {
+		return nil, fmt.Errorf("%w: x-workflow must be true or an object with initial and transitions", ErrInvalidDefinition)
+	}
+	if def.Initial == "" {
+		def.Initial = StateSubmitted
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// definitions reads workflow definitions from the form schemas of the active app bundle
+type definitions struct {
+	schemas *formschema.Cache[*Definition]
+}
+
+// newDefinitions reads the workflows declared in the app bundle at bundlePath
+func newDefinitions(bundlePath string) *definitions {
+	return &definitions{
+		schemas: formschema.NewCache(bundlePath, func(formType string, data []byte) (*Definition, error) {
+			definition, err := ParseSchema(data)
+			if err != nil {
+				return nil, fmt.Errorf("form %s: %w", formType, err)
+			}
+			return definition, nil
+		}),
+	}
+}
+
+// get returns the workflow of a form type, or nil when it has none. Schemas are re-read
+// when the bundle changes them.
+func (d *definitions) get(formType string) (*Definition, error) {
+	return d.schemas.Get(formType)
+}
@@ -0,0 +1,84 @@
+package workflow
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		want    *Definition
+		wantErr bool
+	}{
+		{"absent", `{"type": "object"}`, nil, false},
+		{"disabled", `{"x-workflow": false}`, nil, false},
+		{"default", `{"x-workflow": true}`, DefaultDefinition(), false},
+		{"custom", `{"x-workflow": {"transitions": {"submitted": ["verified"], "verified": ["archived"]}}}`,
+			&Definition{Initial: StateSubmitted, Transitions: map[string][]string{"submitted": {"verified"}, "verified": {"archived"}}}, false},
+		{"initial without transitions", `{"x-workflow": {"initial": "draft", "transitions": {"submitted": ["approved"]}}}`, nil, true},
+		{"self transition", `{"x-workflow": {"transitions": {"submitted": ["submitted"]}}}`, nil, true},
+		{"state name", `{"x-workflow": {"transitions": {"submitted": ["In Review"]}}}`, nil, true},
+		{"wrong type", `{"x-workflow": "yes"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchema([]byte(tt.schema))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDefinition) {
+					t.Errorf("Expected ErrInvalidDefinition, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	def := DefaultDefinition()
+	if want := []string{"submitted", "approved", "in_review", "returned"}; !reflect.DeepEqual(def.States(), want) {
+		t.Errorf("Expected states %v, got %v", want, def.States())
+	}
+	if !def.Allows(StateInReview, StateReturned) || def.Allows(StateSubmitted, StateApproved) || def.Allows(StateApproved, StateInReview) {
+		t.Error("Unexpected transitions of the default workflow")
+	}
+	if !def.HasState(StateApproved) || def.HasState("archived") {
+		t.Error("Unexpected states of the default workflow")
+	}
+	if next := def.Next(StateApproved); len(next) != 0 {
+		t.Errorf("Expected approved to be final, got %v", next)
+	}
+}
+
+func TestDefinitions_Get(t *testing.T) {
+	bundle := t.TempDir()
+	forms := filepath.Join(bundle, "app", "forms")
+	formschema.WriteSchema(t, forms, "visit", `{"x-workflow": true}`)
+
+	defs := newDefinitions(bundle)
+	if def, err := defs.get("visit"); err != nil || def == nil || def.Initial != StateSubmitted {
+		t.Fatalf("Expected the default workflow, got %+v, %v", def, err)
+	}
+	for _, formType := range []string{"survey", "../visit", ".", ""} {
+		if def, err := defs.get(formType); err != nil || def != nil {
+			t.Errorf("Expected no workflow for %q, got %+v, %v", formType, def, err)
+		}
+	}
+
+	// A new bundle replaces the schema
+	formschema.WriteSchema(t, forms, "visit", `{"type": "object"}`)
+	if def, err := defs.get("visit"); err != nil || def != nil {
+		t.Errorf("Expected the workflow to be removed, got %+v, %v", def, err)
+	}
+}
@@ -0,0 +1,542 @@
+// Package workflow moves observations of forms that declare x-workflow through review
+// states, by default submitted → in_review → approved or returned, and assigns them to
+// reviewers. State changes take a sync version, so clients follow them like other changes.
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+	"github.com/opendataensemble/synkronus/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrNotFound is returned for observations that don't exist, are deleted or are of a
+	// form type the user may not access
+	ErrNotFound = errors.New("observation not found")
+	// ErrNoWorkflow is returned for observations whose form doesn't declare x-workflow
+	ErrNoWorkflow = errors.New("form has no workflow")
+	// ErrInvalidDefinition is returned when a form's x-workflow can't be used
+	ErrInvalidDefinition = errors.New("invalid workflow definition")
+	// ErrUnknownState is returned when filtering by a state the form's workflow doesn't have
+	ErrUnknownState = errors.New("unknown workflow state")
+	// ErrNotAssignee is returned when a reviewer changes an observation assigned to someone else
+	ErrNotAssignee = errors.New("observation is assigned to another reviewer")
+	// ErrInvalidAssignee is returned when assigning to a user who doesn't exist or can't review
+	ErrInvalidAssignee = errors.New("assignee must be a read-write or admin user")
+)
+
+// TransitionError is returned when the workflow doesn't allow moving an observation to a state
+type TransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("cannot move from %s to %s: %s is final", e.From, e.To, e.From)
+	}
+	return fmt.Sprintf("cannot move from %s to %s, only to %s", e.From, e.To, strings.Join(e.Allowed, ", "))
+}
+
+// Record is the workflow state of an observation, as clients receive it
+type Record struct {
+	ObservationID string `json:"observation_id"`
+	FormType      string `json:"form_type"`
+	State         string `json:"state"`
+	// Assignee is the reviewer the observation is assigned to; empty when unassigned
+	Assignee string `json:"assignee,omitempty"`
+	// Comment was given with the last change, e.g. why the observation was returned
+	Comment   string    `json:"comment,omitempty"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version is the sync version of the last change; 0 while the observation hasn't left
+	// its initial state
+	Version int64 `json:"version"`
+}
+
+// Event is a transition or assignment in the history of an observation
+type Event struct {
+	FromState string    `json:"from_state"`
+	ToState   string    `json:"to_state"`
+	Assignee  string    `json:"assignee,omitempty"`
+	Actor     string    `json:"actor"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Detail is the workflow state of an observation with what can happen next
+type Detail struct {
+	Record
+	// Transitions are the states the observation may move to
+	Transitions []string `json:"transitions"`
+	History     []Event  `json:"history"`
+}
+
+// TransitionRequest moves an observation to another state
+type TransitionRequest struct {
+	To      string
+	Comment string
+	// Actor is the user making the change
+	Actor string
+	// Admin lets the actor change observations assigned to someone else
+	Admin bool
+	// Force allows moving to any state of the workflow, e.g. to reopen an approved observation
+	Force bool
+}
+
+// Query selects observations of a form type by workflow state
+type Query struct {
+	FormType string
+	// State limits the result to observations in this state; empty for all
+	State string
+	// Assignee limits the result to observations assigned to this user; empty for all
+	Assignee string
+	Limit    int
+	Offset   int
+}
+
+// ChangesPage is a page of workflow changes for clients
+type ChangesPage struct {
+	CurrentVersion int64    `json:"current_version"`
+	Records        []Record `json:"records"`
+	HasMore        bool     `json:"has_more"`
+	// NextSinceVersion is the since_version to request the next page, or the next changes
+	// once HasMore is false
+	NextSinceVersion int64 `json:"next_since_version"`
+}
+
+// FormAccess tells which form types a role may not access
+type FormAccess interface {
+	DeniedFormTypes(role models.Role) ([]string, error)
+}
+
+// Config contains workflow settings
+type Config struct {
+	// BundlePath is the active app bundle; forms opt into review with x-workflow in
+	// their schema
+	BundlePath string
+	// Access hides form types from users without the roles their schemas require; nil
+	// shows every form type to every user
+	Access FormAccess
+	// DefaultPageSize is the page size when a query doesn't set one
+	DefaultPageSize int
+	// MaxPageSize caps the page size of queries and changes
+	MaxPageSize int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		DefaultPageSize: 100,
+		MaxPageSize:     500,
+	}
+}
+
+// Service stores the workflow state of observations
+type Service interface {
+	// Definition returns the workflow of a form type; nil when it has none
+	Definition(formType string) (*Definition, error)
+	// Get returns the workflow state of an observation with its history
+	Get(ctx context.Context, observationID string) (*Detail, error)
+	// Transition moves an observation to another state. It fails with a *TransitionError
+	// when the workflow doesn't allow the move, and with ErrNotAssignee when the
+	// observation is assigned to another user and the actor isn't an admin.
+	Transition(ctx context.Context, observationID string, req TransitionRequest) (*Record, error)
+	// Assign assigns an observation to a reviewer; an empty assignee unassigns it
+	Assign(ctx context.Context, observationID, assignee, actor string) (*Record, error)
+	// List returns the observations of a form type with their workflow state, oldest first
+	List(ctx context.Context, query Query) ([]Record, error)
+	// Changes returns up to limit workflow changes after sinceVersion, oldest first
+	Changes(ctx context.Context, sinceVersion int64, limit int) (*ChangesPage, error)
+}
+
+type service struct {
+	db     *sql.DB
+	config Config
+	log    *logger.Logger
+	defs   *definitions
+}
+
+// NewService creates a new workflow service
+func NewService(db *sql.DB, config Config, log *logger.Logger) Service {
+	return &service{
+		db:     db,
+		config: config,
+		log:    log,
+		defs:   newDefinitions(config.BundlePath),
+	}
+}
+
+const recordColumns = "observation_id, form_type, state, COALESCE(assignee, ''), COALESCE(comment, ''), updated_by, updated_at, version"
+
+// currentQuery reads the workflow record of an observation, with an empty state and
+// version 0 while it has none
+const currentQuery = `
+	SELECT o.observation_id, o.form_type, COALESCE(w.state, ''), COALESCE(w.assignee, ''),
+		COALESCE(w.comment, ''), COALESCE(w.updated_by, ''), COALESCE(w.updated_at, o.updated_at),
+		COALESCE(w.version, 0)
+	FROM observations o
+	LEFT JOIN observation_workflow w ON w.observation_id = o.observation_id
+	WHERE o.observation_id = $1 AND NOT o.deleted`
+
+// Definition returns the workflow of a form type
+func (s *service) Definition(formType string) (*Definition, error) {
+	return s.defs.get(formType)
+}
+
+// Get returns the workflow state of an observation with its history
+func (s *service) Get(ctx context.Context, observationID string) (_ *Detail, err error) {
+	ctx, span := tracing.Start(ctx, "workflow.Get", attribute.String("observation.id", observationID))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	record, def, err := s.current(ctx, s.db, observationID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT from_state, to_state, COALESCE(assignee, ''), actor, COALESCE(comment, ''), created_at
+		FROM observation_workflow_events WHERE observation_id = $1 ORDER BY id`, observationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflow history: %w", err)
+	}
+	defer rows.Close()
+
+	detail := &Detail{Record: *record, Transitions: def.Next(record.State), History: []Event{}}
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.FromState, &event.ToState, &event.Assignee, &event.Actor, &event.Comment, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read workflow history: %w", err)
+		}
+		detail.History = append(detail.History, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workflow history: %w", err)
+	}
+	return detail, nil
+}
+
+// Transition moves an observation to another state
+func (s *service) Transition(ctx context.Context, observationID string, req TransitionRequest) (_ *Record, err error) {
+	ctx, span := tracing.Start(ctx, "workflow.Transition",
+		attribute.String("observation.id", observationID),
+		attribute.String("workflow.to", req.To),
+		attribute.Bool("workflow.force", req.Force),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	record, def, err := s.current(ctx, tx, observationID, true)
+	if err != nil {
+		return nil, err
+	}
+	if record.Assignee != "" && record.Assignee != req.Actor && !req.Admin {
+		return nil, fmt.Errorf("%w: %s", ErrNotAssignee, record.Assignee)
+	}
+	allowed := def.Allows(record.State, req.To) || (req.Force && req.To != record.State && def.HasState(req.To))
+	if !allowed {
+		return nil, &TransitionError{From: record.State, To: req.To, Allowed: def.Next(record.State)}
+	}
+
+	from := record.State
+	record.State, record.Comment = req.To, req.Comment
+	saved, err := s.save(ctx, tx, *record, from, req.Actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow change: %w", err)
+	}
+
+	s.log.Info("Observation workflow state changed", "observationId", observationID, "from", from, "to", saved.State, "by", req.Actor, "force", req.Force)
+	return saved, nil
+}
+
+// Assign assigns an observation to a reviewer
+func (s *service) Assign(ctx context.Context, observationID, assignee, actor string) (_ *Record, err error) {
+	ctx, span := tracing.Start(ctx, "workflow.Assign", attribute.String("observation.id", observationID))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	if assignee != "" {
+		var role models.Role
+		err := s.db.QueryRowContext(ctx, "SELECT role FROM users WHERE username = $1", assignee).Scan(&role)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && role != models.RoleReadWrite && role != models.RoleAdmin) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAssignee, assignee)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up assignee: %w", err)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	record, _, err := s.current(ctx, tx, observationID, true)
+	if err != nil {
+		return nil, err
+	}
+	record.Assignee = assignee
+	saved, err := s.save(ctx, tx, *record, record.State, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow change: %w", err)
+	}
+
+	s.log.Info("Observation assigned for review", "observationId", observationID, "assignee", assignee, "by", actor)
+	return saved, nil
+}
+
+// List returns the observations of a form type with their workflow state
+func (s *service) List(ctx context.Context, query Query) (_ []Record, err error) {
+	ctx, span := tracing.Start(ctx, "workflow.List",
+		attribute.String("workflow.form_type", query.FormType),
+		attribute.String("workflow.state", query.State),
+	)
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	def, err := s.definition(ctx, query.FormType)
+	if err != nil {
+		return nil, err
+	}
+	if query.State != "" && !def.HasState(query.State) {
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownState, query.State, strings.Join(def.States(), ", "))
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT o.observation_id, o.form_type, COALESCE(w.state, $2), COALESCE(w.assignee, ''),
+			COALESCE(w.comment, ''), COALESCE(w.updated_by, ''), COALESCE(w.updated_at, o.updated_at),
+			COALESCE(w.version, 0)
+		FROM observations o
+		LEFT JOIN observation_workflow w ON w.observation_id = o.observation_id
+		WHERE o.form_type = $1 AND NOT o.deleted
+		  AND ($3 = '' OR COALESCE(w.state, $2) = $3)
+		  AND ($4 = '' OR w.assignee = $4)
+		ORDER BY o.created_at, o.observation_id
+		LIMIT $5 OFFSET $6`,
+		query.FormType, def.Initial, query.State, query.Assignee, s.pageSize(query.Limit), max(query.Offset, 0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflow states: %w", err)
+	}
+	defer rows.Close()
+	return scanRecords(rows)
+}
+
+// Changes returns the workflow changes after sinceVersion
+func (s *service) Changes(ctx context.Context, sinceVersion int64, limit int) (_ *ChangesPage, err error) {
+	ctx, span := tracing.Start(ctx, "workflow.Changes", attribute.Int64("workflow.since_version", sinceVersion))
+	defer span.End()
+	defer func() { tracing.RecordError(span, err) }()
+
+	denied, err := s.deniedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions are taken under a lock on sync_version, so every change up to the current
+	// version is committed once the current version is
+	page := &ChangesPage{}
+	err = s.db.QueryRowContext(ctx, "SELECT current_version FROM sync_version WHERE id = 1").Scan(&page.CurrentVersion)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get current version: %w", err)
+	}
+
+	limit = s.pageSize(limit)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+recordColumns+`
+		FROM observation_workflow
+		WHERE version > $1 AND version <= $2 AND NOT (form_type = ANY($3))
+		ORDER BY version
+		LIMIT $4`,
+		sinceVersion, page.CurrentVersion, pq.Array(denied), limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflow changes: %w", err)
+	}
+	defer rows.Close()
+	if page.Records, err = scanRecords(rows); err != nil {
+		return nil, err
+	}
+
+	page.NextSinceVersion = max(sinceVersion, page.CurrentVersion)
+	if len(page.Records) > limit {
+		page.Records = page.Records[:limit]
+		page.HasMore = true
+		page.NextSinceVersion = page.Records[limit-1].Version
+	}
+	return page, nil
+}
+
+// querier runs queries on the database or in a transaction
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// current reads the workflow record of an observation, in its form's initial state while
+// it has none. With lock set the observation is locked until the transaction ends, so
+// changes to it are made one after the other.
+func (s *service) current(ctx context.Context, q querier, observationID string, lock bool) (*Record, *Definition, error) {
+	query := currentQuery
+	if lock {
+		query += " FOR UPDATE OF o"
+	}
+	record, err := scanRecord(q.QueryRowContext(ctx, query, observationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	def, err := s.definition(ctx, record.FormType)
+	if errors.Is(err, ErrNoWorkflow) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoWorkflow, record.FormType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if record.State == "" {
+		record.State = def.Initial
+	}
+	return record, def, nil
+}
+
+// definition returns the workflow of a form type the user of ctx may access
+func (s *service) definition(ctx context.Context, formType string) (*Definition, error) {
+	denied, err := s.deniedFormTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range denied {
+		if d == formType {
+			return nil, ErrNotFound
+		}
+	}
+
+	def, err := s.defs.get(formType)
+	if err != nil {
+		s.log.Error("Invalid form workflow", "formType", formType, "error", err)
+		return nil, err
+	}
+	if def == nil {
+		return nil, ErrNoWorkflow
+	}
+	return def, nil
+}
+
+// deniedFormTypes lists the form types the user of ctx may not access; none when no
+// access rules are configured or the call isn't made for a user
+func (s *service) deniedFormTypes(ctx context.Context) ([]string, error) {
+	denied := []string{}
+	if s.config.Access == nil {
+		return denied, nil
+	}
+	user := authmw.GetUserFromContext(ctx)
+	if user == nil {
+		return denied, nil
+	}
+	formTypes, err := s.config.Access.DeniedFormTypes(user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read form access rules: %w", err)
+	}
+	return append(denied, formTypes...), nil
+}
+
+// save stores the workflow record of an observation with the next sync version and adds
+// the change to its history
+func (s *service) save(ctx context.Context, tx *sql.Tx, record Record, from, actor string) (*Record, error) {
+	saved, err := scanRecord(tx.QueryRowContext(ctx, `
+		WITH next AS (
+			UPDATE sync_version SET current_version = current_version + 1, updated_at = NOW()
+			WHERE id = 1
+			RETURNING current_version
+		)
+		INSERT INTO observation_workflow (observation_id, form_type, state, assignee, comment, updated_by, updated_at, version)
+		SELECT $1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NOW(), current_version FROM next
+		ON CONFLICT (observation_id) DO UPDATE SET
+			form_type = EXCLUDED.form_type,
+			state = EXCLUDED.state,
+			assignee = EXCLUDED.assignee,
+			comment = EXCLUDED.comment,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at,
+			version = EXCLUDED.version
+		RETURNING `+recordColumns,
+		record.ObservationID, record.FormType, record.State, record.Assignee, record.Comment, actor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save workflow state: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO observation_workflow_events (observation_id, from_state, to_state, assignee, actor, comment)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''))`,
+		record.ObservationID, from, record.State, record.Assignee, actor, record.Comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record workflow history: %w", err)
+	}
+	return saved, nil
+}
+
+// pageSize returns the page size for a requested limit
+func (s *service) pageSize(limit int) int {
+	if limit <= 0 {
+		limit = s.config.DefaultPageSize
+	}
+	if s.config.MaxPageSize > 0 && limit > s.config.MaxPageSize {
+		limit = s.config.MaxPageSize
+	}
+	return limit
+}
+
+// scanRecord reads a row selected with recordColumns or currentQuery
+func scanRecord(row interface{ Scan(...any) error }) (*Record, error) {
+	var record Record
+	err := row.Scan(&record.ObservationID, &record.FormType, &record.State, &record.Assignee,
+		&record.Comment, &record.UpdatedBy, &record.UpdatedAt, &record.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read workflow state: %w", err)
+	}
+	return &record, nil
+}
+
+// scanRecords reads all rows selected with recordColumns
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	records := []Record{}
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workflow states: %w", err)
+	}
+	return records, nil
+}
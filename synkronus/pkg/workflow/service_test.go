@@ -0,0 +1,246 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opendataensemble/synkronus/internal/models"
+	"github.com/opendataensemble/synkronus/pkg/appbundle/formschema"
+	"github.com/opendataensemble/synkronus/pkg/logger"
+	authmw "github.com/opendataensemble/synkronus/pkg/middleware/auth"
+)
+
+var recordRowColumns = []string{"observation_id", "form_type", "state", "assignee", "comment", "updated_by", "updated_at", "version"}
+
+// staticAccess denies the same form types to every role
+type staticAccess []string
+
+func (a staticAccess) DeniedFormTypes(models.Role) ([]string, error) { return a, nil }
+
+// writeWorkflowBundle writes an app bundle whose visit form has the default workflow and
+// whose survey form has none, and returns its path
+func writeWorkflowBundle(t *testing.T) string {
+	t.Helper()
+	bundle := t.TempDir()
+	forms := filepath.Join(bundle, "forms")
+	formschema.WriteSchema(t, forms, "visit", `{"x-workflow": true}`)
+	formschema.WriteSchema(t, forms, "survey", `{"type": "object"}`)
+	return bundle
+}
+
+func TestService_Transition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeWorkflowBundle(t)
+	svc := NewService(db, config, logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	// No workflow row yet: the observation is submitted and may go into review
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o\s+LEFT JOIN observation_workflow w .* FOR UPDATE OF o`).WithArgs("obs-1").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-1", "visit", "", "", "", "", now, 0))
+	mock.ExpectQuery(`UPDATE sync_version SET current_version = current_version \+ 1.*INSERT INTO observation_workflow`).
+		WithArgs("obs-1", "visit", StateInReview, "", "looking", "alice").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-1", "visit", StateInReview, "", "looking", "alice", now, 42))
+	mock.ExpectExec(`INSERT INTO observation_workflow_events`).
+		WithArgs("obs-1", StateSubmitted, StateInReview, "", "alice", "looking").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	record, err := svc.Transition(ctx, "obs-1", TransitionRequest{To: StateInReview, Comment: "looking", Actor: "alice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.State != StateInReview || record.Version != 42 {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	// Submitted observations can't be approved without a review
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o`).WithArgs("obs-2").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-2", "visit", "", "", "", "", now, 0))
+	mock.ExpectRollback()
+	var transitionErr *TransitionError
+	if _, err := svc.Transition(ctx, "obs-2", TransitionRequest{To: StateApproved, Actor: "alice"}); !errors.As(err, &transitionErr) ||
+		transitionErr.From != StateSubmitted || len(transitionErr.Allowed) != 1 {
+		t.Errorf("Expected a TransitionError from submitted, got %v", err)
+	}
+
+	// Only the assignee or an admin may change assigned observations
+	assigned := func() *sqlmock.Rows {
+		return sqlmock.NewRows(recordRowColumns).AddRow("obs-3", "visit", StateInReview, "bob", "", "carol", now, 40)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o`).WithArgs("obs-3").WillReturnRows(assigned())
+	mock.ExpectRollback()
+	if _, err := svc.Transition(ctx, "obs-3", TransitionRequest{To: StateApproved, Actor: "alice"}); !errors.Is(err, ErrNotAssignee) {
+		t.Errorf("Expected ErrNotAssignee, got %v", err)
+	}
+
+	// Admins may force an approved observation back into review
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o`).WithArgs("obs-4").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-4", "visit", StateApproved, "bob", "", "bob", now, 41))
+	mock.ExpectQuery(`INSERT INTO observation_workflow`).
+		WithArgs("obs-4", "visit", StateInReview, "bob", "reopened", "carol").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-4", "visit", StateInReview, "bob", "reopened", "carol", now, 43))
+	mock.ExpectExec(`INSERT INTO observation_workflow_events`).
+		WithArgs("obs-4", StateApproved, StateInReview, "bob", "carol", "reopened").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if _, err := svc.Transition(ctx, "obs-4", TransitionRequest{To: StateInReview, Comment: "reopened", Actor: "carol", Admin: true, Force: true}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Forms without x-workflow
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o`).WithArgs("obs-5").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-5", "survey", "", "", "", "", now, 0))
+	mock.ExpectRollback()
+	if _, err := svc.Transition(ctx, "obs-5", TransitionRequest{To: StateInReview, Actor: "alice"}); !errors.Is(err, ErrNoWorkflow) {
+		t.Errorf("Expected ErrNoWorkflow, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Assign(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeWorkflowBundle(t)
+	svc := NewService(db, config, logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT role FROM users WHERE username = \$1`).WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(models.RoleReadWrite))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM observations o`).WithArgs("obs-1").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-1", "visit", "", "", "", "", now, 0))
+	mock.ExpectQuery(`INSERT INTO observation_workflow`).
+		WithArgs("obs-1", "visit", StateSubmitted, "bob", "", "admin").
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-1", "visit", StateSubmitted, "bob", "", "admin", now, 7))
+	mock.ExpectExec(`INSERT INTO observation_workflow_events`).
+		WithArgs("obs-1", StateSubmitted, StateSubmitted, "bob", "admin", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	record, err := svc.Assign(ctx, "obs-1", "bob", "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.Assignee != "bob" || record.State != StateSubmitted {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	mock.ExpectQuery(`SELECT role FROM users`).WithArgs("viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(models.RoleReadOnly))
+	if _, err := svc.Assign(ctx, "obs-1", "viewer", "admin"); !errors.Is(err, ErrInvalidAssignee) {
+		t.Errorf("Expected ErrInvalidAssignee for a read-only user, got %v", err)
+	}
+	mock.ExpectQuery(`SELECT role FROM users`).WithArgs("nobody").WillReturnRows(sqlmock.NewRows([]string{"role"}))
+	if _, err := svc.Assign(ctx, "obs-1", "nobody", "admin"); !errors.Is(err, ErrInvalidAssignee) {
+		t.Errorf("Expected ErrInvalidAssignee for an unknown user, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeWorkflowBundle(t)
+	config.Access = staticAccess{"secret"}
+	svc := NewService(db, config, logger.NewLogger())
+	ctx := context.WithValue(context.Background(), authmw.UserKey, &models.User{Username: "alice", Role: models.RoleReadOnly})
+	now := time.Now()
+
+	mock.ExpectQuery(`COALESCE\(w.state, \$2\) = \$3`).
+		WithArgs("visit", StateSubmitted, StateReturned, "bob", 100, 0).
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).AddRow("obs-1", "visit", StateReturned, "bob", "missing photo", "bob", now, 9))
+	records, err := svc.List(ctx, Query{FormType: "visit", State: StateReturned, Assignee: "bob"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Comment != "missing photo" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+
+	if _, err := svc.List(ctx, Query{FormType: "visit", State: "archived"}); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Expected ErrUnknownState, got %v", err)
+	}
+	if _, err := svc.List(ctx, Query{FormType: "survey"}); !errors.Is(err, ErrNoWorkflow) {
+		t.Errorf("Expected ErrNoWorkflow, got %v", err)
+	}
+	if _, err := svc.List(ctx, Query{FormType: "secret"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a denied form type, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestService_Changes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	config := DefaultConfig()
+	config.BundlePath = writeWorkflowBundle(t)
+	svc := NewService(db, config, logger.NewLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(20))
+	mock.ExpectQuery(`FROM observation_workflow\s+WHERE version > \$1 AND version <= \$2 AND NOT \(form_type = ANY\(\$3\)\)`).
+		WithArgs(int64(5), int64(20), "{}", 3).
+		WillReturnRows(sqlmock.NewRows(recordRowColumns).
+			AddRow("obs-1", "visit", StateInReview, "", "", "alice", now, 6).
+			AddRow("obs-2", "visit", StateApproved, "", "", "alice", now, 9).
+			AddRow("obs-3", "visit", StateReturned, "", "", "alice", now, 12))
+	page, err := svc.Changes(ctx, 5, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !page.HasMore || len(page.Records) != 2 || page.NextSinceVersion != 9 || page.CurrentVersion != 20 {
+		t.Errorf("Unexpected page %+v", page)
+	}
+
+	mock.ExpectQuery(`SELECT current_version FROM sync_version`).
+		WillReturnRows(sqlmock.NewRows([]string{"current_version"}).AddRow(20))
+	mock.ExpectQuery(`FROM observation_workflow`).WithArgs(int64(20), int64(20), "{}", 101).
+		WillReturnRows(sqlmock.NewRows(recordRowColumns))
+	page, err = svc.Changes(ctx, 20, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.HasMore || len(page.Records) != 0 || page.NextSinceVersion != 20 {
+		t.Errorf("Unexpected page %+v", page)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+#!/bin/sh
+# Builds self-contained synkronus binaries for every supported platform into bin/release.
+# Static assets and the Swagger UI are always embedded; the portal is embedded when
+# synkronus-portal has been built (npm run build), or from PORTAL_DIST.
+set -e
+
+cd "$(dirname "$0")/.."
+
+version=$(git describe --tags --always --dirty)
+commit=$(git rev-parse HEAD)
+build_time=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+ldflags="-w -s \
+  -X 'github.com/opendataensemble/synkronus/pkg/version.version=$version' \
+  -X 'github.com/opendataensemble/synkronus/pkg/version.commit=$commit' \
+  -X 'github.com/opendataensemble/synkronus/pkg/version.buildTime=$build_time'"
+
+portal_dist=${PORTAL_DIST:-../synkronus-portal/dist}
+if [ -f "$portal_dist/index.html" ]; then
+  echo "Embedding the portal from $portal_dist"
+  find portal -mindepth 1 ! -name .gitkeep -exec rm -rf {} +
+  cp -R "$portal_dist"/. portal/
+else
+  echo "No portal build at $portal_dist; building without the portal"
+fi
+
+mkdir -p bin/release
+for platform in ${PLATFORMS:-linux/amd64 linux/arm64 linux/arm darwin/amd64 darwin/arm64 windows/amd64 windows/arm64}; do
+  os=${platform%/*}
+  arch=${platform#*/}
+  output="bin/release/synkronus-$version-$os-$arch"
+  if [ "$os" = windows ]; then
+    output="$output.exe"
+  fi
+  echo "Building $output"
+  CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath -ldflags="$ldflags" -o "$output" ./cmd/synkronus
+done